@@ -71,7 +71,13 @@ build_and_push() {
     
     # Build
     echo "  Building..."
-    if docker build -t "$full_name" -t "$latest_name" "$path" 2>/dev/null; then
+    # Dockerfiles that pull in other packages build from the repository root
+    local context="$path"
+    if grep -q '^COPY packages/' "$path/Dockerfile" 2>/dev/null; then
+        context="."
+    fi
+
+    if docker build -f "$path/Dockerfile" -t "$full_name" -t "$latest_name" "$context" 2>/dev/null; then
         echo -e "${GREEN}  ✅ Built${NC}"
         BUILD_SUCCESS+=("$name")
         
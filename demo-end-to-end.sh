@@ -102,14 +102,14 @@ deploy_quantum_capsule_services() {
     # Build Sandbox Executor
     log_info "Building Sandbox Executor..."
     cd packages/sandbox-executor
-    docker build -t localhost:5000/sandbox-executor:latest .
+    docker build -t localhost:5000/sandbox-executor:latest -f Dockerfile ../..
     docker push localhost:5000/sandbox-executor:latest
     cd ../..
     
     # Build Capsule Builder
     log_info "Building Capsule Builder..."
     cd packages/capsule-builder
-    docker build -t localhost:5000/capsule-builder:latest .
+    docker build -t localhost:5000/capsule-builder:latest -f Dockerfile ../..
     docker push localhost:5000/capsule-builder:latest
     cd ../..
     
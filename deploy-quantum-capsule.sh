@@ -52,14 +52,14 @@ build_and_push_images() {
     # Build Sandbox Executor
     log_info "Building Sandbox Executor..."
     cd packages/sandbox-executor
-    docker build -t $REGISTRY/sandbox-executor:latest .
+    docker build -t $REGISTRY/sandbox-executor:latest -f Dockerfile ../..
     docker push $REGISTRY/sandbox-executor:latest
     cd ../..
     
     # Build Capsule Builder
     log_info "Building Capsule Builder..."
     cd packages/capsule-builder
-    docker build -t $REGISTRY/capsule-builder:latest .
+    docker build -t $REGISTRY/capsule-builder:latest -f Dockerfile ../..
     docker push $REGISTRY/capsule-builder:latest
     cd ../..
     
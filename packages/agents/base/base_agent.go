@@ -219,17 +219,26 @@ func (a *BaseAgent) RequestCollaboration(ctx context.Context, targetAgent string
 	}
 }
 
-// ParticipateInConsensus participates in a multi-agent consensus
-func (a *BaseAgent) ParticipateInConsensus(ctx context.Context, topic string, proposal interface{}) (bool, error) {
+// CastVote decides on a consensus proposal and explains the decision
+func (a *BaseAgent) CastVote(ctx context.Context, topic string, proposal interface{}) (types.Vote, error) {
 	// Analyze the proposal based on agent's expertise
 	decision := a.analyzeProposal(proposal)
-	
-	vote := types.Vote{
+
+	return types.Vote{
 		AgentID:   a.id,
 		Decision:  decision,
 		Reasoning: fmt.Sprintf("Agent %s (%s) votes %v based on analysis", a.id, a.role, decision),
 		Timestamp: time.Now(),
+	}, nil
+}
+
+// ParticipateInConsensus participates in a multi-agent consensus
+func (a *BaseAgent) ParticipateInConsensus(ctx context.Context, topic string, proposal interface{}) (bool, error) {
+	vote, err := a.CastVote(ctx, topic, proposal)
+	if err != nil {
+		return false, err
 	}
+	decision := vote.Decision
 
 	// Send vote
 	msg := &types.Message{
@@ -0,0 +1,248 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// AgentState is the orchestrator's lifecycle state for an agent
+type AgentState string
+
+const (
+	AgentActive   AgentState = "active"
+	AgentDraining AgentState = "draining"
+	AgentStopped  AgentState = "stopped"
+)
+
+// maxStoppedAgents bounds how many stopped agents are kept for listing
+const maxStoppedAgents = 100
+
+// ErrAgentNotFound is returned when stopping an agent that isn't registered
+var ErrAgentNotFound = errors.New("agent not found")
+
+// runningTask is the task an agent is executing and how to cancel it
+type runningTask struct {
+	task   *types.Task
+	cancel context.CancelFunc
+}
+
+// AgentInfo describes an agent and its lifecycle state
+type AgentInfo struct {
+	ID          string             `json:"id"`
+	Role        types.AgentRole    `json:"role"`
+	Status      types.AgentStatus  `json:"status"`
+	State       AgentState         `json:"state"`
+	CurrentTask string             `json:"current_task,omitempty"`
+	LastActive  time.Time          `json:"last_active"`
+	StoppedAt   *time.Time         `json:"stopped_at,omitempty"`
+	Metrics     types.AgentMetrics `json:"metrics"`
+}
+
+// StopResult reports what happened when an agent was stopped
+type StopResult struct {
+	AgentID       string     `json:"agent_id"`
+	State         AgentState `json:"state"`
+	Forced        bool       `json:"forced"`
+	RequeuedTask  string     `json:"requeued_task,omitempty"`
+	DrainDuration string     `json:"drain_duration"`
+}
+
+// StopAgent stops an agent. The agent is marked draining so it takes no new
+// tasks, then its in-flight task is given until ctx is done to finish. If
+// force is set, or the task is still running when ctx is done, the task is
+// cancelled and requeued. The agent is then shut down and unregistered.
+func (o *AgentOrchestrator) StopAgent(ctx context.Context, agentID string, force bool) (*StopResult, error) {
+	started := time.Now()
+
+	o.mu.Lock()
+	agent, ok := o.agents[agentID]
+	if !ok {
+		o.mu.Unlock()
+		return nil, ErrAgentNotFound
+	}
+	o.agentStates[agentID] = AgentDraining
+	o.mu.Unlock()
+
+	result := &StopResult{AgentID: agentID, Forced: force}
+
+	if !force {
+		o.waitForIdle(ctx, agentID)
+	}
+
+	o.mu.Lock()
+	if run, busy := o.running[agentID]; busy {
+		run.cancel()
+		result.RequeuedTask = o.requeueTask(run.task)
+		if !force {
+			log.Printf("Agent %s did not drain in time, requeued task %s", agentID, run.task.ID)
+		}
+	}
+	delete(o.running, agentID)
+	delete(o.busyAgents, agentID)
+	delete(o.agents, agentID)
+	delete(o.agentStates, agentID)
+	delete(o.lastActive, agentID)
+	delete(o.assignedTasks, agentID)
+
+	role := agent.Role()
+	pool := o.agentPools[role][:0]
+	for _, a := range o.agentPools[role] {
+		if a.ID() != agentID {
+			pool = append(pool, a)
+		}
+	}
+	o.agentPools[role] = pool
+	o.mu.Unlock()
+
+	// Shutdown ctx may already be spent by the drain wait
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := agent.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Agent %s shutdown error: %v", agentID, err)
+	}
+	o.bus.unsubscribeAll(shutdownCtx, agentID)
+
+	stoppedAt := time.Now()
+	o.mu.Lock()
+	o.stoppedAgents = append(o.stoppedAgents, AgentInfo{
+		ID:         agentID,
+		Role:       role,
+		Status:     agent.Status(),
+		State:      AgentStopped,
+		LastActive: stoppedAt,
+		StoppedAt:  &stoppedAt,
+		Metrics:    agent.GetMetrics(),
+	})
+	if len(o.stoppedAgents) > maxStoppedAgents {
+		o.stoppedAgents = o.stoppedAgents[len(o.stoppedAgents)-maxStoppedAgents:]
+	}
+	o.mu.Unlock()
+
+	if result.RequeuedTask != "" {
+		go o.dispatchQueuedTasks(context.Background())
+	}
+
+	result.State = AgentStopped
+	result.DrainDuration = time.Since(started).String()
+	return result, nil
+}
+
+// waitForIdle blocks until the agent has no running task or ctx is done
+func (o *AgentOrchestrator) waitForIdle(ctx context.Context, agentID string) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		o.mu.RLock()
+		_, busy := o.running[agentID]
+		o.mu.RUnlock()
+		if !busy {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// requeueTask puts a fresh pending copy of a preempted task back on the
+// queue and returns its ID. Callers must hold o.mu.
+func (o *AgentOrchestrator) requeueTask(task *types.Task) string {
+	pending := &types.Task{
+		ID:           task.ID,
+		Type:         task.Type,
+		Description:  task.Description,
+		Priority:     task.Priority,
+		Requirements: task.Requirements,
+		Dependencies: task.Dependencies,
+		Status:       types.TaskPending,
+		CreatedAt:    task.CreatedAt,
+
+		PreferredRole:        task.PreferredRole,
+		RequiredCapabilities: task.RequiredCapabilities,
+	}
+	o.tasks[pending.ID] = pending
+	o.recordTransition(pending, types.TaskPending, "")
+	o.queue.Enqueue(pending)
+	return pending.ID
+}
+
+// ListAgents returns registered agents followed by recently stopped ones
+func (o *AgentOrchestrator) ListAgents() []AgentInfo {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	agents := make([]AgentInfo, 0, len(o.agents)+len(o.stoppedAgents))
+	for id, agent := range o.agents {
+		info := AgentInfo{
+			ID:         id,
+			Role:       agent.Role(),
+			Status:     agent.Status(),
+			State:      o.agentStates[id],
+			LastActive: o.lastActive[id],
+			Metrics:    agent.GetMetrics(),
+		}
+		if run, ok := o.running[id]; ok {
+			info.CurrentTask = run.task.ID
+		}
+		agents = append(agents, info)
+	}
+	agents = append(agents, o.stoppedAgents...)
+
+	return agents
+}
+
+// StartIdleReaper stops agents that have been idle longer than idleTimeout,
+// checking every interval until stop is closed
+func (o *AgentOrchestrator) StartIdleReaper(idleTimeout, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				o.reapIdleAgents(idleTimeout)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (o *AgentOrchestrator) reapIdleAgents(idleTimeout time.Duration) {
+	cutoff := time.Now().Add(-idleTimeout)
+
+	o.mu.RLock()
+	var idle []string
+	for id := range o.agents {
+		if o.agentStates[id] != AgentActive || o.busyAgents[id] {
+			continue
+		}
+		if o.lastActive[id].Before(cutoff) {
+			idle = append(idle, id)
+		}
+	}
+	o.mu.RUnlock()
+
+	for _, id := range idle {
+		// Idle agents usually have nothing to drain, but one may have picked
+		// up a task since the check above
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		_, err := o.StopAgent(ctx, id, false)
+		cancel()
+		if err != nil {
+			if err != ErrAgentNotFound {
+				log.Printf("Failed to reap idle agent %s: %v", id, err)
+			}
+			continue
+		}
+		log.Printf("Stopped agent %s after %s idle", id, idleTimeout)
+	}
+}
@@ -0,0 +1,215 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// taskProfile is the role that owns a task type and the capabilities the
+// work calls on
+type taskProfile struct {
+	Role         types.AgentRole
+	Capabilities []types.AgentCapability
+}
+
+// taskProfiles is the capability taxonomy of the task types the
+// orchestrator knows. Agents of the owning role can take a task; any agent
+// with all of a task's required capabilities can too.
+var taskProfiles = map[string]taskProfile{
+	"analyze_requirements": {types.RoleProjectManager, []types.AgentCapability{types.CapRequirementsAnalysis, types.CapDocumentation}},
+	"design_system":        {types.RoleArchitect, []types.AgentCapability{types.CapSystemDesign, types.CapDataModeling}},
+	"generate_api":         {types.RoleBackendDev, []types.AgentCapability{types.CapCodeGeneration, types.CapTestGeneration}},
+	"generate_ui":          {types.RoleFrontendDev, []types.AgentCapability{types.CapCodeGeneration}},
+	"migrate_database":     {types.RoleDatabaseAdmin, []types.AgentCapability{types.CapDataModeling}},
+	"setup_infrastructure": {types.RoleDevOps, []types.AgentCapability{types.CapInfrastructureSetup, types.CapMonitoringSetup}},
+	"generate_tests":       {types.RoleQA, []types.AgentCapability{types.CapTestGeneration}},
+	"security_audit":       {types.RoleSecurity, []types.AgentCapability{types.CapSecurityAudit}},
+}
+
+// knownCapabilities are the capabilities a task may require
+var knownCapabilities = map[types.AgentCapability]bool{
+	types.CapRequirementsAnalysis: true, types.CapSystemDesign: true, types.CapCodeGeneration: true,
+	types.CapTestGeneration: true, types.CapInfrastructureSetup: true, types.CapSecurityAudit: true,
+	types.CapPerformanceOptimization: true, types.CapDocumentation: true, types.CapDataModeling: true,
+	types.CapMonitoringSetup: true, types.CapabilityThreatModeling: true, types.CapabilitySecurityAnalysis: true,
+	types.CapabilityComplianceValidation: true, types.CapabilityRiskAssessment: true,
+	types.CapabilityIncidentResponse: true, types.CapabilityForensics: true, types.CapabilityPenetrationTesting: true,
+}
+
+// Weights of an agent's score for a task, out of 1
+const (
+	capabilityWeight    = 0.5
+	successRateWeight   = 0.3
+	preferredRoleWeight = 0.2
+)
+
+// ValidateTaskHints rejects required capabilities outside the taxonomy, so
+// a typo fails the request rather than matching no agent
+func ValidateTaskHints(task *types.Task) error {
+	var unknown []string
+	for _, capability := range task.RequiredCapabilities {
+		if !knownCapabilities[capability] {
+			unknown = append(unknown, string(capability))
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown required capabilities: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// wantedCapabilities are the capabilities the task's type calls on plus
+// the ones it requires
+func wantedCapabilities(task *types.Task) []types.AgentCapability {
+	seen := make(map[types.AgentCapability]bool)
+	var wanted []types.AgentCapability
+	for _, capability := range append(append([]types.AgentCapability(nil), taskProfiles[task.Type].Capabilities...), task.RequiredCapabilities...) {
+		if !seen[capability] {
+			seen[capability] = true
+			wanted = append(wanted, capability)
+		}
+	}
+	return wanted
+}
+
+func hasCapabilities(agent types.Agent, capabilities []types.AgentCapability) bool {
+	has := make(map[types.AgentCapability]bool)
+	for _, capability := range agent.Capabilities() {
+		has[capability] = true
+	}
+	for _, capability := range capabilities {
+		if !has[capability] {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *AgentOrchestrator) canHandleTask(agent types.Agent, task *types.Task) bool {
+	if !hasCapabilities(agent, task.RequiredCapabilities) {
+		return false
+	}
+	if profile, ok := taskProfiles[task.Type]; ok && agent.Role() == profile.Role {
+		return true
+	}
+	return len(task.RequiredCapabilities) > 0
+}
+
+// agentScore is how well an idle agent suits a task
+type agentScore struct {
+	agent      types.Agent
+	score      float64
+	matched    int
+	wanted     int
+	successful float64
+	history    int
+	preferred  bool
+	// assigned is how many tasks the agent has been given, its share of
+	// the load
+	assigned int
+}
+
+// scoreAgent rates an agent by the task's capabilities it has, its success
+// rate and whether it has the preferred role. Agents without history count
+// as successful so new agents get work.
+func (o *AgentOrchestrator) scoreAgent(agent types.Agent, task *types.Task, wanted []types.AgentCapability) agentScore {
+	s := agentScore{agent: agent, wanted: len(wanted), successful: 1, assigned: o.assignedTasks[agent.ID()]}
+	for _, capability := range wanted {
+		if hasCapabilities(agent, []types.AgentCapability{capability}) {
+			s.matched++
+		}
+	}
+	overlap := 1.0
+	if s.wanted > 0 {
+		overlap = float64(s.matched) / float64(s.wanted)
+	}
+
+	metrics := agent.GetMetrics()
+	s.history = metrics.TasksCompleted + metrics.TasksFailed
+	if s.history > 0 {
+		s.successful = float64(metrics.TasksCompleted) / float64(s.history)
+	}
+	s.preferred = task.PreferredRole != "" && agent.Role() == task.PreferredRole
+
+	s.score = capabilityWeight*overlap + successRateWeight*s.successful
+	if s.preferred {
+		s.score += preferredRoleWeight
+	}
+	return s
+}
+
+// scoreEpsilon is the difference below which two scores tie
+const scoreEpsilon = 1e-9
+
+// findSuitableAgent picks the best idle agent for the task and explains
+// the choice. Agents run one task at a time, so busy ones aren't
+// candidates; among equal scores the agent given the fewest tasks wins,
+// then the one idle longest, then the lowest ID. Callers must hold o.mu.
+func (o *AgentOrchestrator) findSuitableAgent(task *types.Task) (types.Agent, string) {
+	wanted := wantedCapabilities(task)
+	var candidates []agentScore
+	for _, agent := range o.agents {
+		if o.busyAgents[agent.ID()] || o.agentStates[agent.ID()] != AgentActive {
+			continue
+		}
+		if agent.Status() != types.StatusIdle && agent.Status() != types.StatusAnalyzing {
+			continue
+		}
+		if o.canHandleTask(agent, task) {
+			candidates = append(candidates, o.scoreAgent(agent, task, wanted))
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ""
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if diff := a.score - b.score; diff > scoreEpsilon || diff < -scoreEpsilon {
+			return diff > 0
+		}
+		if a.assigned != b.assigned {
+			return a.assigned < b.assigned
+		}
+		if idleA, idleB := o.lastActive[a.agent.ID()], o.lastActive[b.agent.ID()]; !idleA.Equal(idleB) {
+			return idleA.Before(idleB)
+		}
+		return a.agent.ID() < b.agent.ID()
+	})
+	return candidates[0].agent, assignmentRationale(candidates)
+}
+
+// assignmentRationale describes the winning score and, against the
+// runner-up, what decided it
+func assignmentRationale(candidates []agentScore) string {
+	best := candidates[0]
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s) scored %.2f: %d/%d capabilities", best.agent.ID(), best.agent.Role(), best.score, best.matched, best.wanted)
+	if best.history > 0 {
+		fmt.Fprintf(&b, ", %.0f%% success over %d tasks", best.successful*100, best.history)
+	} else {
+		b.WriteString(", no task history")
+	}
+	if best.preferred {
+		b.WriteString(", preferred role")
+	}
+
+	if len(candidates) == 1 {
+		b.WriteString("; the only capable idle agent")
+		return b.String()
+	}
+	next := candidates[1]
+	fmt.Fprintf(&b, "; chosen from %d capable idle agents", len(candidates))
+	switch diff := best.score - next.score; {
+	case diff > scoreEpsilon:
+		fmt.Fprintf(&b, ", ahead of %s at %.2f", next.agent.ID(), next.score)
+	case best.assigned != next.assigned:
+		fmt.Fprintf(&b, ", tied with %s and given fewer tasks (%d vs %d)", next.agent.ID(), best.assigned, next.assigned)
+	default:
+		fmt.Fprintf(&b, ", tied with %s and idle longer", next.agent.ID())
+	}
+	return b.String()
+}
@@ -0,0 +1,283 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// profiledAgent is a blocking agent with a role, capabilities and a task
+// history
+type profiledAgent struct {
+	*blockingAgent
+	role         types.AgentRole
+	capabilities []types.AgentCapability
+	metrics      types.AgentMetrics
+}
+
+func newProfiledAgent(id string, role types.AgentRole, capabilities ...types.AgentCapability) *profiledAgent {
+	return &profiledAgent{blockingAgent: newBlockingAgent(id), role: role, capabilities: capabilities}
+}
+
+func (a *profiledAgent) Role() types.AgentRole                 { return a.role }
+func (a *profiledAgent) Capabilities() []types.AgentCapability { return a.capabilities }
+func (a *profiledAgent) GetMetrics() types.AgentMetrics        { return a.metrics }
+
+// backendCapabilities are all the capabilities generate_api calls on
+var backendCapabilities = []types.AgentCapability{types.CapCodeGeneration, types.CapTestGeneration}
+
+// addAgents registers the agents, all last active at the same time
+func addAgents(o *AgentOrchestrator, agents ...types.Agent) {
+	now := time.Now()
+	for _, agent := range agents {
+		addAgent(o, agent)
+		o.lastActive[agent.ID()] = now
+	}
+}
+
+func pick(o *AgentOrchestrator, task *types.Task) (string, string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	agent, rationale := o.findSuitableAgent(task)
+	if agent == nil {
+		return "", rationale
+	}
+	return agent.ID(), rationale
+}
+
+func TestFindSuitableAgentScores(t *testing.T) {
+	api := &types.Task{Type: "generate_api"}
+	tests := []struct {
+		name      string
+		agents    func() []*profiledAgent
+		task      *types.Task
+		want      string
+		rationale string
+	}{
+		{
+			name: "more of the task's capabilities",
+			agents: func() []*profiledAgent {
+				return []*profiledAgent{
+					newProfiledAgent("a", types.RoleBackendDev, types.CapCodeGeneration),
+					newProfiledAgent("b", types.RoleBackendDev, backendCapabilities...),
+				}
+			},
+			task:      api,
+			want:      "b",
+			rationale: "b (backend-developer) scored 0.80: 2/2 capabilities, no task history; chosen from 2 capable idle agents, ahead of a at 0.55",
+		},
+		{
+			name: "higher success rate",
+			agents: func() []*profiledAgent {
+				a := newProfiledAgent("a", types.RoleBackendDev, backendCapabilities...)
+				a.metrics = types.AgentMetrics{TasksCompleted: 5, TasksFailed: 5}
+				b := newProfiledAgent("b", types.RoleBackendDev, backendCapabilities...)
+				b.metrics = types.AgentMetrics{TasksCompleted: 9, TasksFailed: 1}
+				return []*profiledAgent{a, b}
+			},
+			task:      api,
+			want:      "b",
+			rationale: "b (backend-developer) scored 0.77: 2/2 capabilities, 90% success over 10 tasks; chosen from 2 capable idle agents, ahead of a at 0.65",
+		},
+		{
+			name: "preferred role",
+			agents: func() []*profiledAgent {
+				return []*profiledAgent{
+					newProfiledAgent("a", types.RoleBackendDev, backendCapabilities...),
+					newProfiledAgent("b", types.RoleFrontendDev, backendCapabilities...),
+				}
+			},
+			task: &types.Task{
+				Type:                 "generate_api",
+				PreferredRole:        types.RoleFrontendDev,
+				RequiredCapabilities: []types.AgentCapability{types.CapCodeGeneration},
+			},
+			want:      "b",
+			rationale: "b (frontend-developer) scored 1.00: 2/2 capabilities, no task history, preferred role; chosen from 2 capable idle agents, ahead of a at 0.80",
+		},
+		{
+			name: "only capable agent",
+			agents: func() []*profiledAgent {
+				return []*profiledAgent{
+					newProfiledAgent("a", types.RoleBackendDev, backendCapabilities...),
+					newProfiledAgent("b", types.RoleArchitect, types.CapSystemDesign),
+				}
+			},
+			task:      api,
+			want:      "a",
+			rationale: "a (backend-developer) scored 0.80: 2/2 capabilities, no task history; the only capable idle agent",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewAgentOrchestrator("", nil)
+			for _, agent := range tt.agents() {
+				addAgents(o, agent)
+			}
+			got, rationale := pick(o, tt.task)
+			if got != tt.want {
+				t.Errorf("picked %q, want %q", got, tt.want)
+			}
+			if rationale != tt.rationale {
+				t.Errorf("rationale = %q\nwant %q", rationale, tt.rationale)
+			}
+		})
+	}
+}
+
+func TestFindSuitableAgentTieBreaking(t *testing.T) {
+	o := NewAgentOrchestrator("", nil)
+	a := newProfiledAgent("a", types.RoleBackendDev, backendCapabilities...)
+	b := newProfiledAgent("b", types.RoleBackendDev, backendCapabilities...)
+	c := newProfiledAgent("c", types.RoleBackendDev, backendCapabilities...)
+	addAgents(o, c, b, a)
+	task := &types.Task{Type: "generate_api"}
+
+	// Equal in every way, the lowest ID wins
+	if got, _ := pick(o, task); got != "a" {
+		t.Errorf("picked %s, want a", got)
+	}
+
+	// Idle longest wins next
+	o.lastActive["b"] = o.lastActive["a"].Add(-time.Minute)
+	got, rationale := pick(o, task)
+	if got != "b" || !strings.HasSuffix(rationale, "tied with a and idle longer") {
+		t.Errorf("picked %s (%s), want b idle longest", got, rationale)
+	}
+
+	// Fewer assigned tasks win over idle time
+	o.assignedTasks["a"], o.assignedTasks["b"] = 1, 1
+	got, rationale = pick(o, task)
+	if got != "c" || !strings.HasSuffix(rationale, "tied with b and given fewer tasks (0 vs 1)") {
+		t.Errorf("picked %s (%s), want c with the fewest tasks", got, rationale)
+	}
+
+	// And a better score wins over both
+	a.metrics = types.AgentMetrics{TasksCompleted: 1}
+	b.metrics = types.AgentMetrics{TasksCompleted: 1, TasksFailed: 1}
+	c.metrics = types.AgentMetrics{TasksFailed: 1}
+	if got, _ := pick(o, task); got != "a" {
+		t.Errorf("picked %s, want a with the best success rate", got)
+	}
+}
+
+func TestAssignTaskBalancesLoad(t *testing.T) {
+	o := NewAgentOrchestrator("", nil)
+	agents := []*profiledAgent{
+		newProfiledAgent("a", types.RoleBackendDev, backendCapabilities...),
+		newProfiledAgent("b", types.RoleBackendDev, backendCapabilities...),
+		newProfiledAgent("c", types.RoleBackendDev, backendCapabilities...),
+	}
+	for _, agent := range agents {
+		close(agent.release)
+		addAgents(o, agent)
+	}
+
+	// Run tasks one at a time so every agent is idle for each assignment
+	for i := 0; i < 9; i++ {
+		task := &types.Task{ID: fmt.Sprintf("task-%d", i+1), Type: "generate_api"}
+		if err := o.AssignTask(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			o.mu.RLock()
+			busy := len(o.busyAgents)
+			o.mu.RUnlock()
+			if busy == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s never finished", task.ID)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	for _, agent := range agents {
+		if got := len(agent.started); got != 3 {
+			t.Errorf("agent %s ran %d tasks, want 3", agent.ID(), got)
+		}
+	}
+}
+
+func TestAssignTaskRequiredCapabilities(t *testing.T) {
+	o := NewAgentOrchestrator("", nil)
+	backend := newProfiledAgent("backend", types.RoleBackendDev, backendCapabilities...)
+	devops := newProfiledAgent("devops", types.RoleDevOps, types.CapInfrastructureSetup, types.CapCodeGeneration)
+	addAgents(o, backend, devops)
+
+	// Nobody can audit security, so the task is refused outright
+	audit := &types.Task{ID: "audit", Type: "generate_api", RequiredCapabilities: []types.AgentCapability{types.CapSecurityAudit}}
+	if err := o.AssignTask(context.Background(), audit); !errors.Is(err, ErrNoCapableAgent) {
+		t.Errorf("err = %v, want ErrNoCapableAgent", err)
+	}
+
+	// Required capabilities rule out the backend role and let devops in
+	infra := &types.Task{
+		ID:                   "infra",
+		Type:                 "generate_api",
+		RequiredCapabilities: []types.AgentCapability{types.CapInfrastructureSetup},
+	}
+	if got, _ := pick(o, infra); got != "devops" {
+		t.Errorf("picked %q, want devops", got)
+	}
+
+	// A task type outside the taxonomy needs required capabilities to run
+	if o.HasCapableAgent(&types.Task{Type: "write_poetry"}) {
+		t.Error("unknown task type without required capabilities is runnable")
+	}
+	if !o.HasCapableAgent(&types.Task{Type: "write_poetry", RequiredCapabilities: []types.AgentCapability{types.CapCodeGeneration}}) {
+		t.Error("unknown task type with satisfiable required capabilities is not runnable")
+	}
+}
+
+func TestAssignTaskRecordsRationale(t *testing.T) {
+	o := NewAgentOrchestrator("", nil)
+	agent := newProfiledAgent("backend-1", types.RoleBackendDev, backendCapabilities...)
+	close(agent.release)
+	addAgents(o, agent)
+
+	task := &types.Task{ID: "task-1", Type: "generate_api"}
+	if err := o.AssignTask(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	want := "backend-1 (backend-developer) scored 0.80: 2/2 capabilities, no task history; the only capable idle agent"
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		record, err := o.GetTask("task-1")
+		if err == nil && record.Status == types.TaskCompleted {
+			if record.AssignmentRationale != want {
+				t.Errorf("record rationale = %q, want %q", record.AssignmentRationale, want)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task-1 record = %+v, %v; want completed", record, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if task.AssignmentRationale != want {
+		t.Errorf("task rationale = %q, want %q", task.AssignmentRationale, want)
+	}
+}
+
+func TestValidateTaskHints(t *testing.T) {
+	valid := &types.Task{RequiredCapabilities: []types.AgentCapability{types.CapCodeGeneration, types.CapabilityForensics}}
+	if err := ValidateTaskHints(valid); err != nil {
+		t.Errorf("valid hints: %v", err)
+	}
+	invalid := &types.Task{RequiredCapabilities: []types.AgentCapability{"code-gen", types.CapDocumentation, "telepathy"}}
+	if err := ValidateTaskHints(invalid); err == nil || err.Error() != "unknown required capabilities: code-gen, telepathy" {
+		t.Errorf("err = %v", err)
+	}
+}
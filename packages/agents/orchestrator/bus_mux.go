@@ -0,0 +1,106 @@
+package orchestrator
+
+import (
+	"context"
+	"sync"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// busMux shares one subscription per topic on the underlying bus between
+// agents, so stopping one agent doesn't unsubscribe its peers from shared
+// topics like consensus and agent.broadcast
+type busMux struct {
+	bus      types.MessageBus
+	handlers map[string]map[string]func(*types.Message) // topic -> agent ID -> handler
+	mu       sync.RWMutex
+}
+
+func newBusMux(bus types.MessageBus) *busMux {
+	return &busMux{
+		bus:      bus,
+		handlers: make(map[string]map[string]func(*types.Message)),
+	}
+}
+
+func (m *busMux) subscribe(ctx context.Context, owner, topic string, handler func(*types.Message)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.handlers[topic]; !ok {
+		if err := m.bus.Subscribe(ctx, topic, func(msg *types.Message) { m.dispatch(topic, msg) }); err != nil {
+			return err
+		}
+		m.handlers[topic] = make(map[string]func(*types.Message))
+	}
+	m.handlers[topic][owner] = handler
+	return nil
+}
+
+func (m *busMux) unsubscribe(ctx context.Context, owner, topic string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	owners, ok := m.handlers[topic]
+	if !ok {
+		return nil
+	}
+	delete(owners, owner)
+	if len(owners) > 0 {
+		return nil
+	}
+	delete(m.handlers, topic)
+	return m.bus.Unsubscribe(ctx, topic)
+}
+
+// unsubscribeAll drops every subscription held by owner
+func (m *busMux) unsubscribeAll(ctx context.Context, owner string) {
+	m.mu.RLock()
+	var topics []string
+	for topic, owners := range m.handlers {
+		if _, ok := owners[owner]; ok {
+			topics = append(topics, topic)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, topic := range topics {
+		m.unsubscribe(ctx, owner, topic)
+	}
+}
+
+func (m *busMux) dispatch(topic string, msg *types.Message) {
+	m.mu.RLock()
+	handlers := make([]func(*types.Message), 0, len(m.handlers[topic]))
+	for _, handler := range m.handlers[topic] {
+		handlers = append(handlers, handler)
+	}
+	m.mu.RUnlock()
+
+	for _, handler := range handlers {
+		go handler(msg)
+	}
+}
+
+// scoped returns a MessageBus whose subscriptions belong to owner
+func (m *busMux) scoped(owner string) types.MessageBus {
+	return &agentBus{mux: m, owner: owner}
+}
+
+// agentBus is the MessageBus handed to a single agent
+type agentBus struct {
+	mux   *busMux
+	owner string
+}
+
+func (b *agentBus) Publish(ctx context.Context, topic string, msg *types.Message) error {
+	return b.mux.bus.Publish(ctx, topic, msg)
+}
+
+func (b *agentBus) Subscribe(ctx context.Context, topic string, handler func(*types.Message)) error {
+	return b.mux.subscribe(ctx, b.owner, topic, handler)
+}
+
+func (b *agentBus) Unsubscribe(ctx context.Context, topic string) error {
+	return b.mux.unsubscribe(ctx, b.owner, topic)
+}
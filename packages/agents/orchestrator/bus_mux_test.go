@@ -0,0 +1,200 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// natsBus is a minimal NATS MessageBus, enough to run the mux against a
+// real server
+type natsBus struct {
+	conn *nats.Conn
+	subs map[string]*nats.Subscription
+	mu   sync.Mutex
+}
+
+func (b *natsBus) Publish(ctx context.Context, topic string, msg *types.Message) error {
+	data, _ := json.Marshal(msg)
+	return b.conn.Publish(topic, data)
+}
+
+func (b *natsBus) Subscribe(ctx context.Context, topic string, handler func(*types.Message)) error {
+	sub, err := b.conn.Subscribe(topic, func(m *nats.Msg) {
+		var msg types.Message
+		if json.Unmarshal(m.Data, &msg) == nil {
+			handler(&msg)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.subs[topic] = sub
+	b.mu.Unlock()
+	return b.conn.Flush()
+}
+
+func (b *natsBus) Unsubscribe(ctx context.Context, topic string) error {
+	b.mu.Lock()
+	sub := b.subs[topic]
+	delete(b.subs, topic)
+	b.mu.Unlock()
+	if sub == nil {
+		return nil
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		return err
+	}
+	return b.conn.Flush()
+}
+
+// subscriptions counts client subscriptions on the server, leaving out the
+// server's own
+func subscriptions(s *server.Server, baseline uint32) uint32 {
+	return s.NumSubscriptions() - baseline
+}
+
+func runNATS(t *testing.T) (*server.Server, *natsBus) {
+	t.Helper()
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	s := natstest.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+
+	conn, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	return s, &natsBus{conn: conn, subs: make(map[string]*nats.Subscription)}
+}
+
+// received counts messages per agent
+type received struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (r *received) handler(agentID string) func(*types.Message) {
+	return func(*types.Message) {
+		r.mu.Lock()
+		r.counts[agentID]++
+		r.mu.Unlock()
+	}
+}
+
+func (r *received) get(agentID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[agentID]
+}
+
+// publish sends one message on topic and waits for it to be handled
+func publish(t *testing.T, bus types.MessageBus, topic string) {
+	t.Helper()
+	if err := bus.Publish(context.Background(), topic, &types.Message{ID: "m", Content: "hi"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestBusMuxSharesSubscriptions(t *testing.T) {
+	s, bus := runNATS(t)
+	baseline := s.NumSubscriptions()
+	mux := newBusMux(bus)
+	ctx := context.Background()
+	got := &received{counts: make(map[string]int)}
+
+	backend := mux.scoped("backend-1")
+	frontend := mux.scoped("frontend-1")
+	backend.Subscribe(ctx, "consensus", got.handler("backend-1"))
+	frontend.Subscribe(ctx, "consensus", got.handler("frontend-1"))
+	backend.Subscribe(ctx, "agent.backend-1", got.handler("backend-1"))
+
+	// One server subscription per topic, however many agents listen
+	if n := subscriptions(s, baseline); n != 2 {
+		t.Fatalf("server has %d subscriptions, want 2", n)
+	}
+
+	publish(t, frontend, "consensus")
+	if got.get("backend-1") != 1 || got.get("frontend-1") != 1 {
+		t.Fatalf("received %v, want one consensus message each", got.counts)
+	}
+
+	// Stopping one agent leaves its peers subscribed to shared topics
+	if err := backend.Unsubscribe(ctx, "consensus"); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	if n := subscriptions(s, baseline); n != 2 {
+		t.Fatalf("server has %d subscriptions after one agent left, want 2", n)
+	}
+	publish(t, frontend, "consensus")
+	if got.get("backend-1") != 1 || got.get("frontend-1") != 2 {
+		t.Fatalf("received %v, want only frontend-1 to get the second message", got.counts)
+	}
+
+	// The last listener leaving drops the server subscription
+	frontend.Unsubscribe(ctx, "consensus")
+	if n := subscriptions(s, baseline); n != 1 {
+		t.Fatalf("server has %d subscriptions, want 1", n)
+	}
+	publish(t, bus, "consensus")
+	if got.get("frontend-1") != 2 {
+		t.Fatalf("frontend-1 received %d messages after unsubscribing, want 2", got.get("frontend-1"))
+	}
+}
+
+func TestBusMuxUnsubscribeAll(t *testing.T) {
+	s, bus := runNATS(t)
+	baseline := s.NumSubscriptions()
+	mux := newBusMux(bus)
+	ctx := context.Background()
+	got := &received{counts: make(map[string]int)}
+
+	mux.subscribe(ctx, "backend-1", "agent.broadcast", got.handler("backend-1"))
+	mux.subscribe(ctx, "backend-1", "agent.backend-1", got.handler("backend-1"))
+	mux.subscribe(ctx, "qa-1", "agent.broadcast", got.handler("qa-1"))
+
+	mux.unsubscribeAll(ctx, "backend-1")
+	if n := subscriptions(s, baseline); n != 1 {
+		t.Fatalf("server has %d subscriptions, want only agent.broadcast", n)
+	}
+
+	publish(t, bus, "agent.broadcast")
+	publish(t, bus, "agent.backend-1")
+	if got.get("backend-1") != 0 || got.get("qa-1") != 1 {
+		t.Fatalf("received %v, want only qa-1 to get the broadcast", got.counts)
+	}
+
+	// Unsubscribing from a topic the agent never joined is a no-op
+	if err := mux.unsubscribe(ctx, "backend-1", "agent.broadcast"); err != nil {
+		t.Fatalf("unsubscribe: %v", err)
+	}
+	if n := subscriptions(s, baseline); n != 1 {
+		t.Fatalf("server has %d subscriptions, want 1", n)
+	}
+}
+
+func TestBusMuxResubscribeAfterLastListenerLeft(t *testing.T) {
+	_, bus := runNATS(t)
+	mux := newBusMux(bus)
+	ctx := context.Background()
+	got := &received{counts: make(map[string]int)}
+
+	mux.subscribe(ctx, "backend-1", "consensus", got.handler("backend-1"))
+	mux.unsubscribe(ctx, "backend-1", "consensus")
+	mux.subscribe(ctx, "backend-2", "consensus", got.handler("backend-2"))
+
+	publish(t, bus, "consensus")
+	if got.get("backend-1") != 0 || got.get("backend-2") != 1 {
+		t.Fatalf("received %v, want only backend-2", got.counts)
+	}
+}
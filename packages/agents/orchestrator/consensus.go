@@ -0,0 +1,314 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// DefaultConsensusTimeout bounds how long RequestConsensus waits for votes
+const DefaultConsensusTimeout = 30 * time.Second
+
+var (
+	// ErrConsensusNotFound is returned when a consensus session has no record
+	ErrConsensusNotFound = errors.New("consensus not found")
+	// ErrQuorumUnreachable is returned when too few agents are active to
+	// meet a request's min_participants or quorum
+	ErrQuorumUnreachable = errors.New("quorum cannot be met with active agents")
+)
+
+// ConsensusOutcome is the decision a consensus session reached
+type ConsensusOutcome string
+
+const (
+	ConsensusApproved ConsensusOutcome = "approved"
+	ConsensusRejected ConsensusOutcome = "rejected"
+	// ConsensusNoQuorum means fewer agents voted than the quorum requires
+	ConsensusNoQuorum ConsensusOutcome = "no_quorum"
+)
+
+// ConsensusOptions tune a consensus request. Zero values use the defaults.
+type ConsensusOptions struct {
+	ProjectID string
+	// MinParticipants is how many active agents must be asked to vote
+	MinParticipants int
+	// Quorum is how many votes must be cast for the outcome to count;
+	// it defaults to a majority of the participants
+	Quorum  int
+	Timeout time.Duration
+}
+
+// ConsensusVote is one participant's vote, or why it didn't vote
+type ConsensusVote struct {
+	AgentID   string          `json:"agent_id"`
+	Role      types.AgentRole `json:"role"`
+	Decision  *bool           `json:"decision,omitempty"` // nil if the agent abstained
+	Reasoning string          `json:"reasoning,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	VotedAt   time.Time       `json:"voted_at"`
+}
+
+// ConsensusBreakdown counts the votes of a session
+type ConsensusBreakdown struct {
+	Approve int `json:"approve"`
+	Reject  int `json:"reject"`
+	Abstain int `json:"abstain"`
+}
+
+// ConsensusRecord is a completed consensus session: who was asked, how
+// each agent voted and why, and what was decided
+type ConsensusRecord struct {
+	ID           string             `json:"id"`
+	ProjectID    string             `json:"project_id,omitempty"`
+	Topic        string             `json:"topic"`
+	Proposal     interface{}        `json:"proposal"`
+	Participants []string           `json:"participants"`
+	Quorum       int                `json:"quorum"`
+	Votes        []ConsensusVote    `json:"votes"`
+	Breakdown    ConsensusBreakdown `json:"breakdown"`
+	Outcome      ConsensusOutcome   `json:"outcome"`
+	// Confidence is the share of cast votes that agree with the outcome,
+	// 0 when nothing was decided
+	Confidence float64   `json:"confidence"`
+	StartedAt  time.Time `json:"started_at"`
+	DecidedAt  time.Time `json:"decided_at"`
+}
+
+// ConsensusStore persists consensus records. Implementations must be safe
+// for concurrent use.
+type ConsensusStore interface {
+	Save(record *ConsensusRecord) error
+	Get(id string) (*ConsensusRecord, error)
+	// List returns records for projectID ("" for all) newest first
+	List(projectID string, limit int) ([]*ConsensusRecord, error)
+}
+
+// MemoryConsensusStore keeps consensus records in memory
+type MemoryConsensusStore struct {
+	records map[string]*ConsensusRecord
+	mu      sync.RWMutex
+}
+
+// NewMemoryConsensusStore creates an empty in-memory consensus store
+func NewMemoryConsensusStore() *MemoryConsensusStore {
+	return &MemoryConsensusStore{
+		records: make(map[string]*ConsensusRecord),
+	}
+}
+
+func (s *MemoryConsensusStore) Save(record *ConsensusRecord) error {
+	copied := *record
+	copied.Votes = append([]ConsensusVote(nil), record.Votes...)
+
+	s.mu.Lock()
+	s.records[record.ID] = &copied
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryConsensusStore) Get(id string) (*ConsensusRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return nil, ErrConsensusNotFound
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (s *MemoryConsensusStore) List(projectID string, limit int) ([]*ConsensusRecord, error) {
+	s.mu.RLock()
+	records := []*ConsensusRecord{}
+	for _, record := range s.records {
+		if projectID == "" || record.ProjectID == projectID {
+			copied := *record
+			records = append(records, &copied)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].StartedAt.After(records[j].StartedAt)
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// SetConsensusStore replaces the store consensus records are kept in
+func (o *AgentOrchestrator) SetConsensusStore(store ConsensusStore) {
+	o.mu.Lock()
+	o.consensusStore = store
+	o.mu.Unlock()
+}
+
+// GetConsensus returns a recorded consensus session
+func (o *AgentOrchestrator) GetConsensus(id string) (*ConsensusRecord, error) {
+	o.mu.RLock()
+	store := o.consensusStore
+	o.mu.RUnlock()
+	return store.Get(id)
+}
+
+// ListConsensus returns recorded consensus sessions for a project, newest first
+func (o *AgentOrchestrator) ListConsensus(projectID string, limit int) ([]*ConsensusRecord, error) {
+	o.mu.RLock()
+	store := o.consensusStore
+	o.mu.RUnlock()
+	return store.List(projectID, limit)
+}
+
+// RequestConsensus asks every active agent to vote on a proposal, records
+// each vote with its reasoning and returns the decision. It fails with
+// ErrQuorumUnreachable before asking anyone if too few agents are active.
+func (o *AgentOrchestrator) RequestConsensus(ctx context.Context, topic string, proposal interface{}, opts ConsensusOptions) (*ConsensusRecord, error) {
+	o.mu.RLock()
+	participants := o.getActiveAgentIDs()
+	agents := make(map[string]types.Agent, len(participants))
+	for _, id := range participants {
+		agents[id] = o.agents[id]
+	}
+	store := o.consensusStore
+	o.mu.RUnlock()
+	sort.Strings(participants)
+
+	quorum := opts.Quorum
+	if quorum <= 0 {
+		quorum = len(participants)/2 + 1 // Simple majority
+	}
+	if len(participants) == 0 || len(participants) < opts.MinParticipants || len(participants) < quorum {
+		return nil, fmt.Errorf("%w: %d active, min_participants %d, quorum %d",
+			ErrQuorumUnreachable, len(participants), opts.MinParticipants, quorum)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultConsensusTimeout
+	}
+	record := &ConsensusRecord{
+		ID:           uuid.New().String(),
+		ProjectID:    opts.ProjectID,
+		Topic:        topic,
+		Proposal:     proposal,
+		Participants: participants,
+		Quorum:       quorum,
+		StartedAt:    time.Now(),
+	}
+
+	// Announce the request so progress streams and other replicas see it
+	msg := &types.Message{
+		From:    "orchestrator",
+		Type:    types.MsgTypeConsensus,
+		Content: fmt.Sprintf("Consensus request: %s", topic),
+		Metadata: map[string]interface{}{
+			"consensus": &types.ConsensusRequest{
+				ID:            record.ID,
+				Topic:         topic,
+				Proposal:      proposal,
+				RequiredVotes: quorum,
+				Deadline:      record.StartedAt.Add(timeout),
+				Participants:  participants,
+				Votes:         make(map[string]types.Vote),
+			},
+		},
+	}
+	if err := o.messageBus.Publish(ctx, "consensus", msg); err != nil {
+		return nil, err
+	}
+
+	voteCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	record.Votes = o.collectVotes(voteCtx, topic, proposal, participants, agents)
+	record.decide()
+
+	if err := store.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to save consensus record: %w", err)
+	}
+	return record, nil
+}
+
+// collectVotes asks each participant for its vote in parallel. Agents that
+// fail or don't answer before ctx is done abstain.
+func (o *AgentOrchestrator) collectVotes(ctx context.Context, topic string, proposal interface{}, participants []string, agents map[string]types.Agent) []ConsensusVote {
+	votes := make([]ConsensusVote, len(participants))
+	var wg sync.WaitGroup
+	for i, id := range participants {
+		agent := agents[id]
+		votes[i] = ConsensusVote{AgentID: id, Role: agent.Role()}
+
+		wg.Add(1)
+		go func(vote *ConsensusVote, agent types.Agent) {
+			defer wg.Done()
+
+			done := make(chan struct{})
+			var cast types.Vote
+			var err error
+			go func() {
+				defer close(done)
+				if voter, ok := agent.(types.ConsensusVoter); ok {
+					cast, err = voter.CastVote(ctx, topic, proposal)
+					return
+				}
+				cast.Decision, err = agent.ParticipateInConsensus(ctx, topic, proposal)
+			}()
+
+			select {
+			case <-done:
+			case <-ctx.Done():
+				vote.Error = "no vote before the deadline"
+				vote.VotedAt = time.Now()
+				return
+			}
+			vote.VotedAt = time.Now()
+			if err != nil {
+				vote.Error = err.Error()
+				return
+			}
+			decision := cast.Decision
+			vote.Decision = &decision
+			vote.Reasoning = cast.Reasoning
+		}(&votes[i], agent)
+	}
+	wg.Wait()
+	return votes
+}
+
+// decide tallies the votes into the breakdown, outcome and confidence
+func (r *ConsensusRecord) decide() {
+	r.Breakdown = ConsensusBreakdown{}
+	for _, vote := range r.Votes {
+		switch {
+		case vote.Decision == nil:
+			r.Breakdown.Abstain++
+		case *vote.Decision:
+			r.Breakdown.Approve++
+		default:
+			r.Breakdown.Reject++
+		}
+	}
+	r.DecidedAt = time.Now()
+
+	cast := r.Breakdown.Approve + r.Breakdown.Reject
+	switch {
+	case cast < r.Quorum:
+		r.Outcome = ConsensusNoQuorum
+		r.Confidence = 0
+		return
+	case r.Breakdown.Approve > r.Breakdown.Reject:
+		r.Outcome = ConsensusApproved
+		r.Confidence = float64(r.Breakdown.Approve) / float64(cast)
+	default:
+		// A tie doesn't carry the proposal
+		r.Outcome = ConsensusRejected
+		r.Confidence = float64(r.Breakdown.Reject) / float64(cast)
+	}
+}
@@ -0,0 +1,175 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// discardBus accepts and drops every message
+type discardBus struct{}
+
+func (discardBus) Publish(context.Context, string, *types.Message) error         { return nil }
+func (discardBus) Subscribe(context.Context, string, func(*types.Message)) error { return nil }
+func (discardBus) Unsubscribe(context.Context, string) error                     { return nil }
+
+// votingAgent explains its votes; a zero delay answers at once and a
+// negative one never answers
+type votingAgent struct {
+	*blockingAgent
+	decision bool
+	err      error
+	delay    time.Duration
+}
+
+func newVotingAgent(id string, decision bool) *votingAgent {
+	return &votingAgent{blockingAgent: newBlockingAgent(id), decision: decision}
+}
+
+func (a *votingAgent) CastVote(ctx context.Context, topic string, proposal interface{}) (types.Vote, error) {
+	if a.delay < 0 {
+		<-ctx.Done()
+		return types.Vote{}, ctx.Err()
+	}
+	time.Sleep(a.delay)
+	if a.err != nil {
+		return types.Vote{}, a.err
+	}
+	reasoning := "rejects " + topic
+	if a.decision {
+		reasoning = "approves " + topic
+	}
+	return types.Vote{AgentID: a.id, Decision: a.decision, Reasoning: reasoning, Timestamp: time.Now()}, nil
+}
+
+func TestRequestConsensusRecordsVotes(t *testing.T) {
+	o := NewAgentOrchestrator("", discardBus{})
+	addAgent(o, newVotingAgent("a", true))
+	addAgent(o, newVotingAgent("b", true))
+	addAgent(o, newVotingAgent("c", false))
+	addAgent(o, newBlockingAgent("d")) // votes yes without reasoning
+
+	record, err := o.RequestConsensus(context.Background(), "use postgres", map[string]interface{}{"db": "postgres"},
+		ConsensusOptions{ProjectID: "proj-1"})
+	if err != nil {
+		t.Fatalf("RequestConsensus: %v", err)
+	}
+
+	if record.Outcome != ConsensusApproved || record.Quorum != 3 {
+		t.Fatalf("outcome = %s with quorum %d, want approved with a majority quorum of 3", record.Outcome, record.Quorum)
+	}
+	if record.Breakdown != (ConsensusBreakdown{Approve: 3, Reject: 1}) {
+		t.Fatalf("breakdown = %+v", record.Breakdown)
+	}
+	if record.Confidence != 0.75 {
+		t.Fatalf("confidence = %v, want 0.75", record.Confidence)
+	}
+
+	votes := map[string]ConsensusVote{}
+	for _, vote := range record.Votes {
+		votes[vote.AgentID] = vote
+	}
+	if v := votes["c"]; v.Decision == nil || *v.Decision || v.Reasoning != "rejects use postgres" {
+		t.Fatalf("vote of c = %+v, want a reasoned rejection", v)
+	}
+	if v := votes["d"]; v.Decision == nil || !*v.Decision {
+		t.Fatalf("vote of d = %+v, want an approval", v)
+	}
+
+	stored, err := o.GetConsensus(record.ID)
+	if err != nil || stored.Topic != "use postgres" || len(stored.Votes) != 4 {
+		t.Fatalf("GetConsensus = %+v, %v", stored, err)
+	}
+	if _, err := o.GetConsensus("missing"); !errors.Is(err, ErrConsensusNotFound) {
+		t.Fatalf("GetConsensus(missing) error = %v", err)
+	}
+}
+
+func TestRequestConsensusAbstentions(t *testing.T) {
+	o := NewAgentOrchestrator("", discardBus{})
+	addAgent(o, newVotingAgent("a", true))
+	failing := newVotingAgent("b", true)
+	failing.err = errors.New("llm unavailable")
+	addAgent(o, failing)
+	silent := newVotingAgent("c", true)
+	silent.delay = -1
+	addAgent(o, silent)
+
+	record, err := o.RequestConsensus(context.Background(), "t", nil, ConsensusOptions{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("RequestConsensus: %v", err)
+	}
+	if record.Breakdown != (ConsensusBreakdown{Approve: 1, Abstain: 2}) {
+		t.Fatalf("breakdown = %+v", record.Breakdown)
+	}
+	// One vote cast of the two a majority of three needs
+	if record.Outcome != ConsensusNoQuorum || record.Confidence != 0 {
+		t.Fatalf("outcome = %s (confidence %v), want no_quorum", record.Outcome, record.Confidence)
+	}
+	for _, vote := range record.Votes {
+		if vote.AgentID != "a" && (vote.Decision != nil || vote.Error == "") {
+			t.Fatalf("vote = %+v, want an abstention with its reason", vote)
+		}
+	}
+}
+
+func TestRequestConsensusQuorumUnreachable(t *testing.T) {
+	o := NewAgentOrchestrator("", discardBus{})
+	addAgent(o, newVotingAgent("a", true))
+	addAgent(o, newVotingAgent("b", true))
+	draining := newVotingAgent("c", true)
+	addAgent(o, draining)
+	o.agentStates["c"] = AgentDraining
+
+	for _, opts := range []ConsensusOptions{
+		{MinParticipants: 3},
+		{Quorum: 3},
+	} {
+		if _, err := o.RequestConsensus(context.Background(), "t", nil, opts); !errors.Is(err, ErrQuorumUnreachable) {
+			t.Errorf("%+v: error = %v, want ErrQuorumUnreachable", opts, err)
+		}
+	}
+
+	record, err := o.RequestConsensus(context.Background(), "t", nil, ConsensusOptions{MinParticipants: 2, Quorum: 2})
+	if err != nil || len(record.Participants) != 2 {
+		t.Fatalf("record = %+v, %v, want the two active agents", record, err)
+	}
+}
+
+func TestRequestConsensusTieIsRejected(t *testing.T) {
+	o := NewAgentOrchestrator("", discardBus{})
+	addAgent(o, newVotingAgent("a", true))
+	addAgent(o, newVotingAgent("b", false))
+
+	record, err := o.RequestConsensus(context.Background(), "t", nil, ConsensusOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Outcome != ConsensusRejected || record.Confidence != 0.5 {
+		t.Fatalf("outcome = %s (confidence %v), want rejected at 0.5", record.Outcome, record.Confidence)
+	}
+}
+
+func TestListConsensusByProject(t *testing.T) {
+	o := NewAgentOrchestrator("", discardBus{})
+	addAgent(o, newVotingAgent("a", true))
+
+	ctx := context.Background()
+	first, _ := o.RequestConsensus(ctx, "first", nil, ConsensusOptions{ProjectID: "p1"})
+	second, _ := o.RequestConsensus(ctx, "second", nil, ConsensusOptions{ProjectID: "p1"})
+	o.RequestConsensus(ctx, "other", nil, ConsensusOptions{ProjectID: "p2"})
+
+	records, err := o.ListConsensus("p1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].ID != second.ID || records[1].ID != first.ID {
+		t.Fatalf("records = %+v, want p1's sessions newest first", records)
+	}
+	if all, _ := o.ListConsensus("", 0); len(all) != 3 {
+		t.Fatalf("listed %d sessions without a project filter, want 3", len(all))
+	}
+}
@@ -0,0 +1,142 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// blockingAgent is a backend agent whose Execute runs until released
+type blockingAgent struct {
+	id      string
+	started chan string
+	release chan struct{}
+}
+
+func newBlockingAgent(id string) *blockingAgent {
+	return &blockingAgent{id: id, started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (a *blockingAgent) ID() string                            { return a.id }
+func (a *blockingAgent) Role() types.AgentRole                 { return types.RoleBackendDev }
+func (a *blockingAgent) Capabilities() []types.AgentCapability { return nil }
+func (a *blockingAgent) Status() types.AgentStatus             { return types.StatusIdle }
+func (a *blockingAgent) Initialize(context.Context, *types.AgentContext) error {
+	return nil
+}
+func (a *blockingAgent) Execute(ctx context.Context, task *types.Task) error {
+	a.started <- task.ID
+	select {
+	case <-a.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+func (a *blockingAgent) Shutdown(context.Context) error                       { return nil }
+func (a *blockingAgent) SendMessage(context.Context, *types.Message) error    { return nil }
+func (a *blockingAgent) ReceiveMessage(context.Context, *types.Message) error { return nil }
+func (a *blockingAgent) RequestCollaboration(context.Context, string, interface{}) (interface{}, error) {
+	return nil, nil
+}
+func (a *blockingAgent) ParticipateInConsensus(context.Context, string, interface{}) (bool, error) {
+	return true, nil
+}
+func (a *blockingAgent) LearnFromFeedback(context.Context, interface{}) error { return nil }
+func (a *blockingAgent) GetMetrics() types.AgentMetrics                       { return types.AgentMetrics{} }
+
+// addAgent registers an agent without going through SpawnAgent
+func addAgent(o *AgentOrchestrator, agent types.Agent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.agents[agent.ID()] = agent
+	o.agentStates[agent.ID()] = AgentActive
+	o.lastActive[agent.ID()] = time.Now()
+}
+
+func waitStarted(t *testing.T, agent *blockingAgent, want string) {
+	t.Helper()
+	select {
+	case id := <-agent.started:
+		if id != want {
+			t.Fatalf("agent started %s, want %s", id, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("task %s never started", want)
+	}
+}
+
+func TestDrainWaitsForRunningTasks(t *testing.T) {
+	o := NewAgentOrchestrator("", nil)
+	agent := newBlockingAgent("backend-1")
+	addAgent(o, agent)
+
+	ctx := context.Background()
+	o.EnqueueTask(ctx, &types.Task{ID: "running", Type: "generate_api"})
+	waitStarted(t, agent, "running")
+	// The only agent is busy, so this one stays queued
+	o.EnqueueTask(ctx, &types.Task{ID: "queued", Type: "generate_api", Priority: 5})
+
+	done := make(chan []*types.Task)
+	go func() { done <- o.Drain(ctx) }()
+
+	select {
+	case <-done:
+		t.Fatal("Drain returned while a task was still running")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	close(agent.release)
+	var incomplete []*types.Task
+	select {
+	case incomplete = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Drain did not return after the running task finished")
+	}
+
+	if len(incomplete) != 1 || incomplete[0].ID != "queued" {
+		t.Fatalf("incomplete = %v, want only the queued task", incomplete)
+	}
+	if incomplete[0].Status != types.TaskPending || incomplete[0].Priority != 5 {
+		t.Fatalf("incomplete task = %+v, want pending with its priority", incomplete[0])
+	}
+
+	record, err := o.GetTask("running")
+	if err != nil {
+		t.Fatalf("GetTask: %v", err)
+	}
+	if record.Status != types.TaskCompleted {
+		t.Fatalf("running task status = %s, want completed", record.Status)
+	}
+
+	// Draining stops the freed agent from picking up the queued task
+	select {
+	case id := <-agent.started:
+		t.Fatalf("task %s started while draining", id)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestDrainReturnsRunningTasksOnTimeout(t *testing.T) {
+	o := NewAgentOrchestrator("", nil)
+	agent := newBlockingAgent("backend-1")
+	addAgent(o, agent)
+	defer close(agent.release)
+
+	o.EnqueueTask(context.Background(), &types.Task{ID: "stuck", Type: "generate_api"})
+	waitStarted(t, agent, "stuck")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	incomplete := o.Drain(ctx)
+
+	if len(incomplete) != 1 || incomplete[0].ID != "stuck" {
+		t.Fatalf("incomplete = %v, want the stuck task", incomplete)
+	}
+	task := incomplete[0]
+	if task.Status != types.TaskPending || task.Assignee != "" || task.StartedAt != nil {
+		t.Fatalf("incomplete task = %+v, want it reset to pending", task)
+	}
+}
@@ -2,7 +2,9 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -23,8 +25,36 @@ type AgentOrchestrator struct {
 	// Agent pools for scaling
 	agentPools   map[types.AgentRole][]types.Agent
 	maxAgentsPerRole int
+
+	// Pending tasks waiting for an idle agent, and agents currently running a task
+	queue      *TaskQueue
+	busyAgents map[string]bool
+	draining   bool
+
+	// Task lifecycle records for status queries. Transitions are queued
+	// under mu and written by flushTransitions, so store I/O never happens
+	// while mu is held; storeMu keeps the writes in order.
+	taskStore   TaskStore
+	transitions []pendingTransition
+	storeMu     sync.Mutex
+
+	// Completed consensus sessions, for auditing decisions
+	consensusStore ConsensusStore
+
+	// Agent lifecycle: per-agent bus subscriptions, drain state, the task
+	// each busy agent is running, when each agent was last active and how
+	// many tasks each has been given
+	bus           *busMux
+	agentStates   map[string]AgentState
+	running       map[string]*runningTask
+	lastActive    map[string]time.Time
+	assignedTasks map[string]int
+	stoppedAgents []AgentInfo
 }
 
+// ErrNoCapableAgent is returned when no registered agent can handle a task type
+var ErrNoCapableAgent = errors.New("no agent with the required capabilities")
+
 // NewAgentOrchestrator creates a new orchestrator
 func NewAgentOrchestrator(llmEndpoint string, messageBus types.MessageBus) *AgentOrchestrator {
 	return &AgentOrchestrator{
@@ -34,6 +64,15 @@ func NewAgentOrchestrator(llmEndpoint string, messageBus types.MessageBus) *Agen
 		llmEndpoint:  llmEndpoint,
 		messageBus:   messageBus,
 		maxAgentsPerRole: 3,
+		queue:        NewTaskQueue(),
+		busyAgents:   make(map[string]bool),
+		taskStore:    NewMemoryTaskStore(),
+		consensusStore: NewMemoryConsensusStore(),
+		bus:          newBusMux(messageBus),
+		agentStates:  make(map[string]AgentState),
+		running:      make(map[string]*runningTask),
+		lastActive:   make(map[string]time.Time),
+		assignedTasks: make(map[string]int),
 		sharedMemory: &types.SharedMemory{
 			ProjectContext:   make(map[string]interface{}),
 			DesignDecisions:  []types.DesignDecision{},
@@ -47,25 +86,43 @@ func NewAgentOrchestrator(llmEndpoint string, messageBus types.MessageBus) *Agen
 
 // ProcessRequest orchestrates agents to handle a user request
 func (o *AgentOrchestrator) ProcessRequest(ctx context.Context, requirements string, projectID string) (*ProcessResult, error) {
+	return o.ProcessRequestWithProgress(ctx, requirements, projectID, uuid.New().String(), nil)
+}
+
+// ProcessRequestWithProgress runs ProcessRequest under the given session ID,
+// reporting agents, tasks, generated files and consensus to progress as the
+// run goes
+func (o *AgentOrchestrator) ProcessRequestWithProgress(ctx context.Context, requirements string, projectID string, sessionID string, progress ProgressFunc) (*ProcessResult, error) {
 	// Create agent context
 	agentCtx := &types.AgentContext{
 		ProjectID:    projectID,
-		SessionID:    uuid.New().String(),
+		SessionID:    sessionID,
 		Requirements: requirements,
 		SharedMemory: o.sharedMemory,
 		MessageBus:   o.messageBus,
 	}
 
+	tracker := newProgressTracker(o, sessionID, progress)
+	tracker.send(ProgressEvent{Type: ProgressSessionStarted, Message: "Analyzing requirements"})
+
 	// Analyze requirements and determine needed agents
 	neededAgents := o.analyzeRequirements(requirements)
 	
 	// Spawn required agents
-	if err := o.spawnAgents(ctx, neededAgents, agentCtx); err != nil {
+	if err := o.spawnAgents(ctx, neededAgents, agentCtx, tracker); err != nil {
 		return nil, fmt.Errorf("failed to spawn agents: %w", err)
 	}
 
-	// Create and distribute tasks
+	// Create and distribute tasks, reporting progress until execution ends
 	tasks := o.createTasks(requirements, neededAgents)
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	watched := make(chan struct{})
+	go tracker.watch(watchCtx, tasks, watched)
+	defer func() {
+		stopWatching()
+		<-watched
+	}()
+
 	if err := o.distributeTasks(ctx, tasks); err != nil {
 		return nil, fmt.Errorf("failed to distribute tasks: %w", err)
 	}
@@ -78,6 +135,11 @@ func (o *AgentOrchestrator) ProcessRequest(ctx context.Context, requirements str
 
 	// Aggregate results
 	finalResult := o.aggregateResults(results)
+
+	// Collect the last task's output before handing back the stages
+	stopWatching()
+	<-watched
+	finalResult.Stages = tracker.stages
 	
 	return finalResult, nil
 }
@@ -112,13 +174,20 @@ func (o *AgentOrchestrator) SpawnAgent(ctx context.Context, role types.AgentRole
 		return nil, fmt.Errorf("unsupported agent role: %s", role)
 	}
 
+	// Give the agent its own view of the bus so stopping it only drops its
+	// own subscriptions
+	scopedCtx := *agentCtx
+	scopedCtx.MessageBus = o.bus.scoped(agent.ID())
+
 	// Initialize the agent
-	if err := agent.Initialize(ctx, agentCtx); err != nil {
+	if err := agent.Initialize(ctx, &scopedCtx); err != nil {
 		return nil, fmt.Errorf("failed to initialize agent: %w", err)
 	}
 
 	// Register agent
 	o.agents[agent.ID()] = agent
+	o.agentStates[agent.ID()] = AgentActive
+	o.lastActive[agent.ID()] = time.Now()
 	
 	// Add to agent pool
 	if o.agentPools[role] == nil {
@@ -126,66 +195,80 @@ func (o *AgentOrchestrator) SpawnAgent(ctx context.Context, role types.AgentRole
 	}
 	o.agentPools[role] = append(o.agentPools[role], agent)
 
+	// A new agent may be able to take queued work
+	go o.dispatchQueuedTasks(context.Background())
+
 	return agent, nil
 }
 
 // AssignTask assigns a task to an appropriate agent
 func (o *AgentOrchestrator) AssignTask(ctx context.Context, task *types.Task) error {
-	o.mu.RLock()
-	defer o.mu.RUnlock()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.hasCapableAgent(task) {
+		return fmt.Errorf("task %s of type %s: %w", task.ID, task.Type, ErrNoCapableAgent)
+	}
 
 	// Find suitable agent based on task requirements
-	agent := o.findSuitableAgent(task)
+	agent, rationale := o.findSuitableAgent(task)
 	if agent == nil {
-		return fmt.Errorf("no suitable agent found for task %s", task.ID)
+		return fmt.Errorf("no idle agent available for task %s", task.ID)
 	}
 
-	// Assign task
-	task.Assignee = agent.ID()
+	o.recordTransition(task, types.TaskPending, "")
+	o.startTask(ctx, agent, task, rationale)
+	return nil
+}
+
+// EnqueueTask queues a task for dispatch. Queued tasks are handed to idle
+// agents by descending priority, FIFO within the same priority.
+func (o *AgentOrchestrator) EnqueueTask(ctx context.Context, task *types.Task) {
+	o.mu.Lock()
 	o.tasks[task.ID] = task
+	o.recordTransition(task, types.TaskPending, "")
+	o.mu.Unlock()
 
-	// Execute task
-	go func() {
-		if err := agent.Execute(ctx, task); err != nil {
-			fmt.Printf("Task %s failed: %v\n", task.ID, err)
-		}
-	}()
+	o.queue.Enqueue(task)
+	o.dispatchQueuedTasks(ctx)
+}
 
-	return nil
+// HasCapableAgent reports whether any registered agent, busy or not, can
+// handle the task
+func (o *AgentOrchestrator) HasCapableAgent(task *types.Task) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.hasCapableAgent(task)
 }
 
-// RequestConsensus initiates a multi-agent consensus process
-func (o *AgentOrchestrator) RequestConsensus(ctx context.Context, topic string, proposal interface{}) (*types.ConsensusRequest, error) {
-	consensus := &types.ConsensusRequest{
-		ID:           uuid.New().String(),
-		Topic:        topic,
-		Proposal:     proposal,
-		RequiredVotes: len(o.agents) / 2 + 1, // Simple majority
-		Deadline:     time.Now().Add(30 * time.Second),
-		Participants: o.getActiveAgentIDs(),
-		Votes:        make(map[string]types.Vote),
-	}
-
-	// Broadcast consensus request to all agents
-	msg := &types.Message{
-		From:    "orchestrator",
-		Type:    types.MsgTypeConsensus,
-		Content: fmt.Sprintf("Consensus request: %s", topic),
-		Metadata: map[string]interface{}{
-			"consensus": consensus,
-		},
-	}
+// SetTaskStore replaces the store used to record task lifecycles
+func (o *AgentOrchestrator) SetTaskStore(store TaskStore) {
+	o.mu.Lock()
+	o.taskStore = store
+	o.mu.Unlock()
+}
 
-	if err := o.messageBus.Publish(ctx, "consensus", msg); err != nil {
-		return nil, err
-	}
+// GetTask returns the lifecycle record of a task
+func (o *AgentOrchestrator) GetTask(id string) (*TaskRecord, error) {
+	o.flushTransitions()
+	o.mu.RLock()
+	store := o.taskStore
+	o.mu.RUnlock()
+	return store.Get(id)
+}
 
-	// Wait for votes
-	if err := o.collectVotes(ctx, consensus); err != nil {
-		return nil, err
-	}
+// ListTasks returns task records matching filter, newest first
+func (o *AgentOrchestrator) ListTasks(filter TaskFilter) ([]*TaskRecord, error) {
+	o.flushTransitions()
+	o.mu.RLock()
+	store := o.taskStore
+	o.mu.RUnlock()
+	return store.List(filter)
+}
 
-	return consensus, nil
+// QueueMetrics returns the current depth and wait times of the task queue
+func (o *AgentOrchestrator) QueueMetrics() QueueMetrics {
+	return o.queue.Metrics()
 }
 
 // MonitorAgents checks the health and performance of all agents
@@ -201,6 +284,52 @@ func (o *AgentOrchestrator) MonitorAgents() map[string]types.AgentMetrics {
 	return metrics
 }
 
+// Drain stops dispatching queued work and waits for in-flight tasks to
+// finish until ctx is done. It returns copies of every task that did not
+// complete, reset to pending, so the caller can persist and requeue them.
+func (o *AgentOrchestrator) Drain(ctx context.Context) []*types.Task {
+	o.mu.Lock()
+	o.draining = true
+	o.mu.Unlock()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+wait:
+	for {
+		o.mu.RLock()
+		busy := len(o.busyAgents)
+		o.mu.RUnlock()
+		if busy == 0 {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	o.flushTransitions()
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	incomplete := []*types.Task{}
+	for _, task := range o.tasks {
+		if task.Status == types.TaskCompleted || task.Status == types.TaskFailed {
+			continue
+		}
+		pending := *task
+		pending.Status = types.TaskPending
+		pending.Assignee = ""
+		pending.StartedAt = nil
+		incomplete = append(incomplete, &pending)
+	}
+
+	return incomplete
+}
+
 // Shutdown gracefully stops all agents
 func (o *AgentOrchestrator) Shutdown(ctx context.Context) error {
 	o.mu.Lock()
@@ -236,11 +365,18 @@ func (o *AgentOrchestrator) analyzeRequirements(requirements string) []types.Age
 	return agents
 }
 
-func (o *AgentOrchestrator) spawnAgents(ctx context.Context, roles []types.AgentRole, agentCtx *types.AgentContext) error {
+func (o *AgentOrchestrator) spawnAgents(ctx context.Context, roles []types.AgentRole, agentCtx *types.AgentContext, tracker *progressTracker) error {
 	for _, role := range roles {
-		if _, err := o.SpawnAgent(ctx, role, agentCtx); err != nil {
+		agent, err := o.SpawnAgent(ctx, role, agentCtx)
+		if err != nil {
 			return fmt.Errorf("failed to spawn %s agent: %w", role, err)
 		}
+		tracker.send(ProgressEvent{
+			Type:    ProgressAgentSpawned,
+			AgentID: agent.ID(),
+			Role:    role,
+			Message: fmt.Sprintf("%s agent ready", role),
+		})
 	}
 	return nil
 }
@@ -373,47 +509,205 @@ func (o *AgentOrchestrator) aggregateResults(results map[string]interface{}) *Pr
 	}
 }
 
-func (o *AgentOrchestrator) findSuitableAgent(task *types.Task) types.Agent {
-	// Find agent with required capabilities and lowest workload
-	var bestAgent types.Agent
-	lowestTasks := int(^uint(0) >> 1) // Max int
+// dispatchQueuedTasks hands queued tasks to idle agents in priority order
+func (o *AgentOrchestrator) dispatchQueuedTasks(ctx context.Context) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.draining {
+		return
+	}
 
-	for _, agent := range o.agents {
-		if agent.Status() == types.StatusIdle || agent.Status() == types.StatusAnalyzing {
-			// Check if agent can handle this task type
-			if o.canHandleTask(agent, task) {
-				metrics := agent.GetMetrics()
-				currentTasks := metrics.TasksCompleted + metrics.TasksFailed
-				if currentTasks < lowestTasks {
-					bestAgent = agent
-					lowestTasks = currentTasks
-				}
+	assignments := make(map[string]types.Agent)
+	rationales := make(map[string]string)
+	dispatched := o.queue.DequeueMatching(func(task *types.Task) bool {
+		agent, rationale := o.findSuitableAgent(task)
+		if agent == nil {
+			return false
+		}
+		// Reserve the agent so lower priority tasks can't claim it in this pass
+		o.busyAgents[agent.ID()] = true
+		assignments[task.ID] = agent
+		rationales[task.ID] = rationale
+		return true
+	})
+
+	for _, task := range dispatched {
+		o.startTask(ctx, assignments[task.ID], task, rationales[task.ID])
+	}
+}
+
+// startTask marks the agent busy and executes the task in the background,
+// recording why the agent was chosen. Callers must hold o.mu.
+func (o *AgentOrchestrator) startTask(ctx context.Context, agent types.Agent, task *types.Task, rationale string) {
+	task.Assignee = agent.ID()
+	task.AssignmentRationale = rationale
+	task.Status = types.TaskAssigned
+	o.tasks[task.ID] = task
+	o.busyAgents[agent.ID()] = true
+	o.assignedTasks[agent.ID()]++
+	o.recordTransition(task, types.TaskAssigned, agent.ID())
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	run := &runningTask{task: task, cancel: cancel}
+	o.running[agent.ID()] = run
+
+	go func() {
+		defer cancel()
+
+		o.mu.Lock()
+		if o.running[agent.ID()] != run {
+			o.mu.Unlock()
+			return
+		}
+		task.Status = types.TaskInProgress
+		o.recordTransition(task, types.TaskInProgress, agent.ID())
+		o.mu.Unlock()
+
+		err := agent.Execute(taskCtx, task)
+		if err != nil {
+			fmt.Printf("Task %s failed: %v\n", task.ID, err)
+		}
+
+		o.mu.Lock()
+		o.lastActive[agent.ID()] = time.Now()
+		if o.running[agent.ID()] != run {
+			// The agent was force stopped and the task requeued
+			o.mu.Unlock()
+			return
+		}
+		delete(o.running, agent.ID())
+		if err != nil {
+			task.Status = types.TaskFailed
+			if task.Error == "" {
+				task.Error = err.Error()
 			}
+		} else if task.Status != types.TaskFailed {
+			task.Status = types.TaskCompleted
 		}
+		o.recordTransition(task, task.Status, agent.ID())
+		delete(o.busyAgents, agent.ID())
+		o.mu.Unlock()
+
+		// The agent is free again, pick up any queued work
+		o.dispatchQueuedTasks(context.Background())
+	}()
+}
+
+// pendingTransition is a status transition waiting to be written, with
+// the task fields as they were when it happened
+type pendingTransition struct {
+	store        TaskStore
+	taskID       string
+	createdAt    time.Time
+	taskType     string
+	description  string
+	priority     int
+	requirements map[string]interface{}
+	result       interface{}
+	err          string
+	status       types.TaskStatus
+	agentID      string
+	rationale    string
+	at           time.Time
+}
+
+// recordTransition queues a status transition for the task's record and
+// starts a writer if none is running. Callers must hold o.mu.
+func (o *AgentOrchestrator) recordTransition(task *types.Task, status types.TaskStatus, agentID string) {
+	o.transitions = append(o.transitions, pendingTransition{
+		store:        o.taskStore,
+		taskID:       task.ID,
+		createdAt:    task.CreatedAt,
+		taskType:     task.Type,
+		description:  task.Description,
+		priority:     task.Priority,
+		requirements: task.Requirements,
+		result:       task.Result,
+		err:          task.Error,
+		status:       status,
+		agentID:      agentID,
+		rationale:    task.AssignmentRationale,
+		at:           time.Now(),
+	})
+	if len(o.transitions) == 1 {
+		go o.flushTransitions()
 	}
+}
 
-	return bestAgent
+// flushTransitions writes queued transitions to the task store in the order
+// they were recorded. It must not be called with o.mu held.
+func (o *AgentOrchestrator) flushTransitions() {
+	o.storeMu.Lock()
+	defer o.storeMu.Unlock()
+
+	for {
+		o.mu.Lock()
+		batch := o.transitions
+		o.transitions = nil
+		o.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+		for _, t := range batch {
+			writeTransition(t)
+		}
+	}
 }
 
-func (o *AgentOrchestrator) canHandleTask(agent types.Agent, task *types.Task) bool {
-	// Map task types to agent roles
-	taskRoleMap := map[string]types.AgentRole{
-		"analyze_requirements": types.RoleProjectManager,
-		"design_system":        types.RoleArchitect,
-		"generate_api":         types.RoleBackendDev,
+// writeTransition appends a transition to the task's stored record
+func writeTransition(t pendingTransition) {
+	record, err := t.store.Get(t.taskID)
+	if err != nil {
+		record = &TaskRecord{
+			ID:        t.taskID,
+			CreatedAt: t.createdAt,
+		}
+		if record.CreatedAt.IsZero() {
+			record.CreatedAt = t.at
+		}
 	}
 
-	requiredRole, ok := taskRoleMap[task.Type]
-	if !ok {
-		return false
+	record.Type = t.taskType
+	record.Description = t.description
+	record.Priority = t.priority
+	record.Requirements = t.requirements
+	record.Status = t.status
+	record.AgentID = t.agentID
+	record.AssignmentRationale = t.rationale
+	record.Result = t.result
+	record.Error = t.err
+	record.UpdatedAt = t.at
+	record.Transitions = append(record.Transitions, TaskTransition{
+		Status:  t.status,
+		AgentID: t.agentID,
+		At:      t.at,
+	})
+
+	if err := t.store.Save(record); err != nil {
+		log.Printf("Failed to record task %s transition to %s: %v", t.taskID, t.status, err)
 	}
+}
 
-	return agent.Role() == requiredRole
+// hasCapableAgent reports whether any registered agent can handle the task.
+// Callers must hold o.mu.
+func (o *AgentOrchestrator) hasCapableAgent(task *types.Task) bool {
+	for _, agent := range o.agents {
+		if o.agentStates[agent.ID()] == AgentActive && o.canHandleTask(agent, task) {
+			return true
+		}
+	}
+	return false
 }
 
+// getActiveAgentIDs returns agents that aren't finished, failed or
+// draining; callers hold o.mu
 func (o *AgentOrchestrator) getActiveAgentIDs() []string {
 	ids := []string{}
 	for id, agent := range o.agents {
+		if o.agentStates[id] == AgentDraining {
+			continue
+		}
 		if agent.Status() != types.StatusCompleted && agent.Status() != types.StatusFailed {
 			ids = append(ids, id)
 		}
@@ -421,12 +715,6 @@ func (o *AgentOrchestrator) getActiveAgentIDs() []string {
 	return ids
 }
 
-func (o *AgentOrchestrator) collectVotes(ctx context.Context, consensus *types.ConsensusRequest) error {
-	// Simplified vote collection
-	// In production, this would actually collect and validate votes
-	return nil
-}
-
 func (o *AgentOrchestrator) extractArchitecture() map[string]interface{} {
 	if o.sharedMemory.ProjectContext != nil {
 		if arch, ok := o.sharedMemory.ProjectContext["architecture"]; ok {
@@ -466,4 +754,5 @@ type ProcessResult struct {
 	Tests         []string               `json:"tests"`
 	Documentation string                 `json:"documentation"`
 	Metrics       map[string]interface{} `json:"metrics"`
+	Stages        []StageOutput          `json:"stages,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,230 @@
+package orchestrator
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// ProgressEventType identifies a step of a ProcessRequest run
+type ProgressEventType string
+
+const (
+	ProgressSessionStarted ProgressEventType = "session.started"
+	ProgressAgentSpawned   ProgressEventType = "agent.spawned"
+	ProgressTaskStarted    ProgressEventType = "task.started"
+	ProgressTaskCompleted  ProgressEventType = "task.completed"
+	ProgressTaskFailed     ProgressEventType = "task.failed"
+	ProgressArtifact       ProgressEventType = "artifact"
+	ProgressConsensus      ProgressEventType = "consensus"
+)
+
+// ProgressEvent reports a step of a ProcessRequest run as it happens
+type ProgressEvent struct {
+	Type      ProgressEventType `json:"type"`
+	SessionID string            `json:"session_id"`
+	AgentID   string            `json:"agent_id,omitempty"`
+	Role      types.AgentRole   `json:"role,omitempty"`
+	TaskID    string            `json:"task_id,omitempty"`
+	TaskType  string            `json:"task_type,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Data      interface{}       `json:"data,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// ProgressFunc receives progress events. It is called from the run's own
+// goroutines and must not block for long.
+type ProgressFunc func(ProgressEvent)
+
+// progressInterval is how often task status is checked for changes
+const progressInterval = 100 * time.Millisecond
+
+// StageOutput is what one agent produced for its task during a run
+type StageOutput struct {
+	TaskID      string            `json:"task_id"`
+	TaskType    string            `json:"task_type"`
+	AgentID     string            `json:"agent_id"`
+	Role        types.AgentRole   `json:"role"`
+	Result      interface{}       `json:"result,omitempty"`
+	Files       map[string]string `json:"files,omitempty"`
+	CompletedAt time.Time         `json:"completed_at"`
+}
+
+// progressTracker turns task status changes, new generated files and
+// consensus messages into progress events for one session, and collects
+// each completed task's output
+type progressTracker struct {
+	o         *AgentOrchestrator
+	sessionID string
+	emit      ProgressFunc
+
+	statuses map[string]types.TaskStatus
+	files    map[string]bool
+	stages   []StageOutput
+}
+
+func newProgressTracker(o *AgentOrchestrator, sessionID string, emit ProgressFunc) *progressTracker {
+	t := &progressTracker{
+		o:         o,
+		sessionID: sessionID,
+		emit:      emit,
+		statuses:  make(map[string]types.TaskStatus),
+		files:     make(map[string]bool),
+	}
+
+	// Shared memory outlives sessions, only report files generated from now on
+	o.mu.RLock()
+	for path := range o.sharedMemory.GeneratedCode {
+		t.files[path] = true
+	}
+	o.mu.RUnlock()
+
+	return t
+}
+
+func (t *progressTracker) send(event ProgressEvent) {
+	if t.emit == nil {
+		return
+	}
+	event.SessionID = t.sessionID
+	event.Timestamp = time.Now()
+	t.emit(event)
+}
+
+// watch reports progress on tasks until ctx is done, then reports any
+// changes left since the last check
+func (t *progressTracker) watch(ctx context.Context, tasks []*types.Task, done chan<- struct{}) {
+	defer close(done)
+
+	if t.emit != nil {
+		owner := "session:" + t.sessionID
+		if err := t.o.bus.subscribe(ctx, owner, "consensus", t.onConsensus); err == nil {
+			defer t.o.bus.unsubscribe(context.Background(), owner, "consensus")
+		}
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.check(tasks)
+		case <-ctx.Done():
+			t.check(tasks)
+			return
+		}
+	}
+}
+
+func (t *progressTracker) check(tasks []*types.Task) {
+	for _, task := range tasks {
+		t.o.mu.RLock()
+		status, assignee, result, errMsg := task.Status, task.Assignee, task.Result, task.Error
+		t.o.mu.RUnlock()
+
+		previous := t.statuses[task.ID]
+		if status == previous {
+			continue
+		}
+		t.statuses[task.ID] = status
+
+		event := ProgressEvent{
+			AgentID:  assignee,
+			Role:     t.o.agentRole(assignee),
+			TaskID:   task.ID,
+			TaskType: task.Type,
+		}
+		switch status {
+		case types.TaskInProgress:
+			event.Type = ProgressTaskStarted
+			event.Message = task.Description
+			t.send(event)
+		case types.TaskCompleted:
+			if previous != types.TaskInProgress {
+				// Finished between checks, still report that it started
+				started := event
+				started.Type = ProgressTaskStarted
+				started.Message = task.Description
+				t.send(started)
+			}
+			event.Type = ProgressTaskCompleted
+			event.Data = result
+			t.send(event)
+			t.stages = append(t.stages, StageOutput{
+				TaskID:      task.ID,
+				TaskType:    task.Type,
+				AgentID:     assignee,
+				Role:        event.Role,
+				Result:      result,
+				Files:       t.checkArtifacts(event),
+				CompletedAt: time.Now(),
+			})
+		case types.TaskFailed:
+			event.Type = ProgressTaskFailed
+			event.Message = errMsg
+			t.send(event)
+		}
+	}
+}
+
+// checkArtifacts reports files generated since the last check, attributed
+// to the task that just completed, and returns them
+func (t *progressTracker) checkArtifacts(completed ProgressEvent) map[string]string {
+	t.o.mu.RLock()
+	var paths []string
+	contents := make(map[string]string)
+	for path, content := range t.o.sharedMemory.GeneratedCode {
+		if !t.files[path] {
+			paths = append(paths, path)
+			contents[path] = content
+		}
+	}
+	t.o.mu.RUnlock()
+
+	if len(paths) == 0 {
+		return nil
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		t.files[path] = true
+		t.send(ProgressEvent{
+			Type:     ProgressArtifact,
+			AgentID:  completed.AgentID,
+			Role:     completed.Role,
+			TaskID:   completed.TaskID,
+			TaskType: completed.TaskType,
+			Message:  path,
+			Data: map[string]interface{}{
+				"path":    path,
+				"content": contents[path],
+			},
+		})
+	}
+	return contents
+}
+
+func (t *progressTracker) onConsensus(msg *types.Message) {
+	t.send(ProgressEvent{
+		Type:    ProgressConsensus,
+		AgentID: msg.From,
+		Message: msg.Content,
+		Data:    msg.Metadata,
+	})
+}
+
+// agentRole returns the role of a registered agent, or "" if unknown
+func (o *AgentOrchestrator) agentRole(agentID string) types.AgentRole {
+	if agentID == "" {
+		return ""
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if agent, ok := o.agents[agentID]; ok {
+		return agent.Role()
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package orchestrator
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// queuedTask wraps a task with the bookkeeping needed for ordering
+type queuedTask struct {
+	task       *types.Task
+	seq        uint64
+	enqueuedAt time.Time
+	index      int
+}
+
+// taskHeap orders tasks by descending priority, FIFO within a priority
+type taskHeap []*queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].task.Priority != h[j].task.Priority {
+		return h[i].task.Priority > h[j].task.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	item := x.(*queuedTask)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+// QueueMetrics reports the state of the task queue
+type QueueMetrics struct {
+	Depth           int           `json:"depth"`
+	TotalEnqueued   int64         `json:"total_enqueued"`
+	TotalDispatched int64         `json:"total_dispatched"`
+	AverageWaitTime time.Duration `json:"average_wait_time"`
+	MaxWaitTime     time.Duration `json:"max_wait_time"`
+	OldestWaiting   time.Duration `json:"oldest_waiting"`
+}
+
+// TaskQueue is a priority queue of tasks waiting for an idle agent
+type TaskQueue struct {
+	items taskHeap
+	seq   uint64
+	now   func() time.Time
+	mu    sync.Mutex
+
+	totalEnqueued   int64
+	totalDispatched int64
+	totalWait       time.Duration
+	maxWait         time.Duration
+}
+
+// NewTaskQueue creates an empty task queue
+func NewTaskQueue() *TaskQueue {
+	return &TaskQueue{
+		items: taskHeap{},
+		now:   time.Now,
+	}
+}
+
+// Enqueue adds a task to the queue
+func (q *TaskQueue) Enqueue(task *types.Task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	heap.Push(&q.items, &queuedTask{
+		task:       task,
+		seq:        q.seq,
+		enqueuedAt: q.now(),
+	})
+	q.totalEnqueued++
+}
+
+// Dequeue removes and returns the highest priority task, or nil if empty
+func (q *TaskQueue) Dequeue() *types.Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil
+	}
+	item := heap.Pop(&q.items).(*queuedTask)
+	q.recordDispatch(item)
+	return item.task
+}
+
+// DequeueMatching removes and returns tasks in dispatch order for which
+// match returns true. Tasks that do not match stay queued in their
+// original position so a busy role does not block other roles.
+func (q *TaskQueue) DequeueMatching(match func(*types.Task) bool) []*types.Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var skipped []*queuedTask
+	var dispatched []*types.Task
+	for len(q.items) > 0 {
+		item := heap.Pop(&q.items).(*queuedTask)
+		if match(item.task) {
+			q.recordDispatch(item)
+			dispatched = append(dispatched, item.task)
+			continue
+		}
+		skipped = append(skipped, item)
+	}
+
+	// Restore skipped tasks, keeping their original sequence numbers
+	for _, item := range skipped {
+		heap.Push(&q.items, item)
+	}
+
+	return dispatched
+}
+
+// Len returns the number of queued tasks
+func (q *TaskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Metrics returns a snapshot of queue depth and wait times
+func (q *TaskQueue) Metrics() QueueMetrics {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	metrics := QueueMetrics{
+		Depth:           len(q.items),
+		TotalEnqueued:   q.totalEnqueued,
+		TotalDispatched: q.totalDispatched,
+		MaxWaitTime:     q.maxWait,
+	}
+	if q.totalDispatched > 0 {
+		metrics.AverageWaitTime = q.totalWait / time.Duration(q.totalDispatched)
+	}
+
+	now := q.now()
+	for _, item := range q.items {
+		if wait := now.Sub(item.enqueuedAt); wait > metrics.OldestWaiting {
+			metrics.OldestWaiting = wait
+		}
+	}
+
+	return metrics
+}
+
+func (q *TaskQueue) recordDispatch(item *queuedTask) {
+	wait := q.now().Sub(item.enqueuedAt)
+	q.totalDispatched++
+	q.totalWait += wait
+	if wait > q.maxWait {
+		q.maxWait = wait
+	}
+}
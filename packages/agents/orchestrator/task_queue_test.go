@@ -0,0 +1,146 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+func dequeueAll(q *TaskQueue) []string {
+	var ids []string
+	for task := q.Dequeue(); task != nil; task = q.Dequeue() {
+		ids = append(ids, task.ID)
+	}
+	return ids
+}
+
+func assertOrder(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("dispatched %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("dispatched %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTaskQueueDispatchOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []types.Task
+		want  []string
+	}{
+		{
+			name: "higher priority first",
+			tasks: []types.Task{
+				{ID: "low", Priority: 1},
+				{ID: "high", Priority: 10},
+				{ID: "medium", Priority: 5},
+			},
+			want: []string{"high", "medium", "low"},
+		},
+		{
+			name: "FIFO within a priority",
+			tasks: []types.Task{
+				{ID: "a", Priority: 3},
+				{ID: "b", Priority: 3},
+				{ID: "c", Priority: 3},
+				{ID: "d", Priority: 3},
+			},
+			want: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "FIFO kept across interleaved priorities",
+			tasks: []types.Task{
+				{ID: "low-1", Priority: 1},
+				{ID: "high-1", Priority: 9},
+				{ID: "low-2", Priority: 1},
+				{ID: "high-2", Priority: 9},
+				{ID: "zero", Priority: 0},
+				{ID: "high-3", Priority: 9},
+			},
+			want: []string{"high-1", "high-2", "high-3", "low-1", "low-2", "zero"},
+		},
+		{
+			name: "negative priorities after default",
+			tasks: []types.Task{
+				{ID: "background", Priority: -1},
+				{ID: "default"},
+			},
+			want: []string{"default", "background"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewTaskQueue()
+			for i := range tt.tasks {
+				q.Enqueue(&tt.tasks[i])
+			}
+			assertOrder(t, dequeueAll(q), tt.want)
+			if q.Len() != 0 {
+				t.Fatalf("queue has %d tasks left", q.Len())
+			}
+		})
+	}
+}
+
+func TestTaskQueueDequeueEmpty(t *testing.T) {
+	if task := NewTaskQueue().Dequeue(); task != nil {
+		t.Fatalf("Dequeue on empty queue = %v, want nil", task)
+	}
+}
+
+func TestTaskQueueDequeueMatchingKeepsOrder(t *testing.T) {
+	q := NewTaskQueue()
+	for _, task := range []*types.Task{
+		{ID: "code-1", Type: "code", Priority: 1},
+		{ID: "design-1", Type: "design", Priority: 5},
+		{ID: "code-2", Type: "code", Priority: 5},
+		{ID: "design-2", Type: "design", Priority: 1},
+		{ID: "code-3", Type: "code", Priority: 5},
+	} {
+		q.Enqueue(task)
+	}
+
+	var matched []string
+	for _, task := range q.DequeueMatching(func(task *types.Task) bool { return task.Type == "code" }) {
+		matched = append(matched, task.ID)
+	}
+	assertOrder(t, matched, []string{"code-2", "code-3", "code-1"})
+
+	// Skipped tasks keep their priority and FIFO position
+	assertOrder(t, dequeueAll(q), []string{"design-1", "design-2"})
+}
+
+func TestTaskQueueMetrics(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	q := NewTaskQueue()
+	q.now = func() time.Time { return now }
+
+	q.Enqueue(&types.Task{ID: "a"})
+	now = now.Add(2 * time.Second)
+	q.Enqueue(&types.Task{ID: "b"})
+	now = now.Add(4 * time.Second)
+
+	q.Dequeue() // a waited 6s
+	metrics := q.Metrics()
+	if metrics.Depth != 1 || metrics.TotalEnqueued != 2 || metrics.TotalDispatched != 1 {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+	if metrics.MaxWaitTime != 6*time.Second || metrics.AverageWaitTime != 6*time.Second {
+		t.Fatalf("wait times = %+v, want 6s", metrics)
+	}
+	if metrics.OldestWaiting != 4*time.Second {
+		t.Fatalf("oldest waiting = %s, want 4s", metrics.OldestWaiting)
+	}
+
+	q.Dequeue() // b waited 4s
+	metrics = q.Metrics()
+	if metrics.AverageWaitTime != 5*time.Second || metrics.OldestWaiting != 0 {
+		t.Fatalf("metrics after drain = %+v", metrics)
+	}
+}
@@ -0,0 +1,124 @@
+package orchestrator
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// ErrTaskNotFound is returned when a task has no record in the store
+var ErrTaskNotFound = errors.New("task not found")
+
+// TaskTransition records a task entering a status
+type TaskTransition struct {
+	Status  types.TaskStatus `json:"status"`
+	AgentID string           `json:"agent_id,omitempty"`
+	At      time.Time        `json:"at"`
+}
+
+// TaskRecord is the tracked state of a task across its lifecycle
+type TaskRecord struct {
+	ID           string                 `json:"id"`
+	Type         string                 `json:"type"`
+	Description  string                 `json:"description"`
+	Priority     int                    `json:"priority"`
+	Status       types.TaskStatus       `json:"status"`
+	AgentID      string                 `json:"agent_id,omitempty"`
+	Requirements map[string]interface{} `json:"requirements,omitempty"`
+	Result       interface{}            `json:"result,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	Transitions  []TaskTransition       `json:"transitions"`
+	// AssignmentRationale explains why the agent was chosen
+	AssignmentRationale string `json:"assignment_rationale,omitempty"`
+}
+
+// TaskFilter selects tasks when listing. Zero values match everything.
+type TaskFilter struct {
+	Status  types.TaskStatus
+	AgentID string
+	Limit   int
+}
+
+// Matches reports whether a record satisfies the filter
+func (f TaskFilter) Matches(record *TaskRecord) bool {
+	if f.Status != "" && record.Status != f.Status {
+		return false
+	}
+	if f.AgentID != "" && record.AgentID != f.AgentID {
+		return false
+	}
+	return true
+}
+
+// TaskStore persists task records. Implementations must be safe for concurrent use.
+type TaskStore interface {
+	Save(record *TaskRecord) error
+	Get(id string) (*TaskRecord, error)
+	// List returns matching records newest first
+	List(filter TaskFilter) ([]*TaskRecord, error)
+}
+
+// MemoryTaskStore keeps task records in memory
+type MemoryTaskStore struct {
+	records map[string]*TaskRecord
+	mu      sync.RWMutex
+}
+
+// NewMemoryTaskStore creates an empty in-memory task store
+func NewMemoryTaskStore() *MemoryTaskStore {
+	return &MemoryTaskStore{
+		records: make(map[string]*TaskRecord),
+	}
+}
+
+func (s *MemoryTaskStore) Save(record *TaskRecord) error {
+	copied := *record
+	copied.Transitions = append([]TaskTransition(nil), record.Transitions...)
+
+	s.mu.Lock()
+	s.records[record.ID] = &copied
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryTaskStore) Get(id string) (*TaskRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (s *MemoryTaskStore) List(filter TaskFilter) ([]*TaskRecord, error) {
+	s.mu.RLock()
+	records := []*TaskRecord{}
+	for _, record := range s.records {
+		if filter.Matches(record) {
+			copied := *record
+			records = append(records, &copied)
+		}
+	}
+	s.mu.RUnlock()
+
+	sortTaskRecords(records)
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[:filter.Limit]
+	}
+	return records, nil
+}
+
+// sortTaskRecords orders records newest first
+func sortTaskRecords(records []*TaskRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+}
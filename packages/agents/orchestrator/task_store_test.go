@@ -0,0 +1,92 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// slowTaskStore is a memory store whose Save waits until released, like a
+// Redis store that has stopped answering
+type slowTaskStore struct {
+	*MemoryTaskStore
+	release chan struct{}
+}
+
+func (s *slowTaskStore) Save(record *TaskRecord) error {
+	<-s.release
+	return s.MemoryTaskStore.Save(record)
+}
+
+func TestSlowTaskStoreDoesNotBlockOrchestrator(t *testing.T) {
+	o := NewAgentOrchestrator("", nil)
+	store := &slowTaskStore{MemoryTaskStore: NewMemoryTaskStore(), release: make(chan struct{})}
+	o.SetTaskStore(store)
+	agent := newBlockingAgent("backend-1")
+	addAgent(o, agent)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctx := context.Background()
+		o.EnqueueTask(ctx, &types.Task{ID: "task-1", Type: "generate_api"})
+		o.EnqueueTask(ctx, &types.Task{ID: "task-2", Type: "generate_api"})
+		o.ListAgents()
+		o.HasCapableAgent(&types.Task{Type: "generate_api"})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("orchestrator blocked on the task store")
+	}
+	waitStarted(t, agent, "task-1")
+
+	close(store.release)
+	close(agent.release)
+	waitStarted(t, agent, "task-2")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		record, err := o.GetTask("task-2")
+		if err == nil && record.Status == types.TaskCompleted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task-2 record = %+v, %v; want completed", record, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Transitions are written in the order they happened
+	for _, id := range []string{"task-1", "task-2"} {
+		record, err := o.GetTask(id)
+		if err != nil {
+			t.Fatalf("GetTask(%s): %v", id, err)
+		}
+		var statuses []types.TaskStatus
+		for _, transition := range record.Transitions {
+			statuses = append(statuses, transition.Status)
+		}
+		want := fmt.Sprint([]types.TaskStatus{types.TaskPending, types.TaskAssigned, types.TaskInProgress, types.TaskCompleted})
+		if fmt.Sprint(statuses) != want {
+			t.Fatalf("%s transitions = %v, want %s", id, statuses, want)
+		}
+	}
+}
+
+func TestGetTaskSeesTransitionsJustRecorded(t *testing.T) {
+	o := NewAgentOrchestrator("", nil)
+	o.EnqueueTask(context.Background(), &types.Task{ID: "queued", Type: "generate_api"})
+
+	record, err := o.GetTask("queued")
+	if err != nil || record.Status != types.TaskPending {
+		t.Fatalf("GetTask = %+v, %v; want the pending record", record, err)
+	}
+	if tasks, _ := o.ListTasks(TaskFilter{Status: types.TaskPending}); len(tasks) != 1 {
+		t.Fatalf("ListTasks = %v, want the queued task", tasks)
+	}
+}
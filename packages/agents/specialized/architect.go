@@ -352,18 +352,26 @@ func (a *ArchitectAgent) handleCollaboration(ctx context.Context, msg *types.Mes
 	return a.SendMessage(ctx, reply)
 }
 
+// CastVote evaluates a consensus proposal from the architecture perspective
+func (a *ArchitectAgent) CastVote(ctx context.Context, topic string, proposal interface{}) (types.Vote, error) {
+	proposalMap, _ := proposal.(map[string]interface{})
+	decision := a.evaluateProposal(topic, proposalMap)
+
+	return types.Vote{
+		AgentID:   a.ID(),
+		Decision:  decision,
+		Reasoning: a.getDecisionReasoning(topic, proposalMap, decision),
+		Timestamp: time.Now(),
+	}, nil
+}
+
 func (a *ArchitectAgent) handleConsensus(ctx context.Context, msg *types.Message) error {
 	topic, _ := msg.Metadata["topic"].(string)
-	proposal, _ := msg.Metadata["proposal"].(map[string]interface{})
 	
 	// Evaluate proposal from architecture perspective
-	decision := a.evaluateProposal(topic, proposal)
-	
-	vote := types.Vote{
-		AgentID:   a.ID(),
-		Decision:  decision,
-		Reasoning: a.getDecisionReasoning(topic, proposal, decision),
-		Timestamp: time.Now(),
+	vote, err := a.CastVote(ctx, topic, msg.Metadata["proposal"])
+	if err != nil {
+		return err
 	}
 
 	reply := &types.Message{
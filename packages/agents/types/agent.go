@@ -102,6 +102,13 @@ type Task struct {
 	CreatedAt    time.Time              `json:"created_at"`
 	StartedAt    *time.Time             `json:"started_at,omitempty"`
 	CompletedAt  *time.Time             `json:"completed_at,omitempty"`
+
+	// Assignment hints: agents of the preferred role score higher, and
+	// agents lacking any required capability can't take the task
+	PreferredRole        AgentRole         `json:"preferred_role,omitempty"`
+	RequiredCapabilities []AgentCapability `json:"required_capabilities,omitempty"`
+	// AssignmentRationale explains why the assignee was chosen
+	AssignmentRationale string `json:"assignment_rationale,omitempty"`
 }
 
 // TaskStatus represents the status of a task
@@ -109,6 +116,7 @@ type TaskStatus string
 
 const (
 	TaskPending    TaskStatus = "pending"
+	TaskAssigned   TaskStatus = "assigned"
 	TaskInProgress TaskStatus = "in_progress"
 	TaskCompleted  TaskStatus = "completed"
 	TaskFailed     TaskStatus = "failed"
@@ -236,4 +244,10 @@ type Vote struct {
 	Decision  bool      `json:"decision"`
 	Reasoning string    `json:"reasoning"`
 	Timestamp time.Time `json:"timestamp"`
+}
+
+// ConsensusVoter is implemented by agents that can explain their consensus
+// votes; the orchestrator records the reasoning alongside each decision
+type ConsensusVoter interface {
+	CastVote(ctx context.Context, topic string, proposal interface{}) (Vote, error)
 }
\ No newline at end of file
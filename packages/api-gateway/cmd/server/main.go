@@ -10,9 +10,14 @@ import (
     "time"
 
     "github.com/QuantumLayer-dev/quantumlayer-platform/packages/api-gateway/internal/proxy"
+    "github.com/QuantumLayer-dev/quantumlayer-platform/packages/api-gateway/internal/ratelimit"
+    "github.com/QuantumLayer-dev/quantumlayer-platform/packages/api-gateway/internal/validation"
     "github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/config"
+    "github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
     "github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/telemetry"
     "github.com/gin-gonic/gin"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "github.com/redis/go-redis/v9"
     "github.com/sirupsen/logrus"
 )
 
@@ -41,10 +46,38 @@ func main() {
     _ = tracer
 
     // Initialize proxy handler
-    proxyHandler := proxy.NewProxyHandler()
+    proxy.SetLogger(logger)
+    proxyHandler := proxy.NewProxyHandler(cfg.Proxy)
+
+    // Initialize rate limiter; buckets live in Redis so every replica
+    // enforces the same limits
+    var redisClient *redis.Client
+    if cfg.Redis.Enabled {
+        redisClient = redis.NewClient(&redis.Options{
+            Addr:     fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+            Password: cfg.Redis.Password,
+            DB:       cfg.Redis.DB,
+        })
+        defer redisClient.Close()
+    }
+    limiter := ratelimit.New(redisClient, cfg.RateLimit, logger)
+    generateLimit := limiter.Limit("generate")
+    readLimit := limiter.Limit("read")
+    defaultLimit := limiter.Limit("default")
+
+    // Cap body sizes and reject malformed generation requests at the edge
+    validator, err := validation.New(cfg.Request, logger)
+    if err != nil {
+        logger.WithError(err).Fatal("Failed to load request schemas")
+    }
+    generateBody := validator.Body("generate", validation.SchemaWorkflowGenerate)
+    llmBody := validator.Body("llm", validation.SchemaLLMGenerate)
+    defaultBody := validator.Body("default", "")
 
     // Setup Gin router
     router := gin.New()
+    router.Use(logging.RequestID())
+    router.Use(logging.Middleware(logger.WithField("service", "api-gateway")))
     router.Use(gin.Recovery())
     router.Use(corsMiddleware())
 
@@ -57,12 +90,14 @@ func main() {
         })
     })
 
-    router.GET("/ready", func(c *gin.Context) {
-        c.JSON(http.StatusOK, gin.H{"status": "ready"})
-    })
+    router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+    // Ready unless a critical upstream is down; a degraded gateway still
+    // serves what it can
+    router.GET("/ready", proxyHandler.GetAggregateHealth)
 
     // GraphQL endpoint - forward to appropriate service
-    router.POST("/graphql", func(c *gin.Context) {
+    router.POST("/graphql", defaultBody, func(c *gin.Context) {
         // For now, return service status
         proxyHandler.GetServiceStatus(c)
     })
@@ -71,48 +106,52 @@ func main() {
     v1 := router.Group("/api/v1")
     {
         // Service status endpoint
-        v1.GET("/status", proxyHandler.GetServiceStatus)
+        v1.GET("/status", readLimit, proxyHandler.GetServiceStatus)
+        v1.GET("/health/aggregate", readLimit, proxyHandler.GetAggregateHealth)
 
         // Workflow generation endpoints
-        v1.POST("/generate", proxyHandler.ProxyToWorkflow)
+        v1.POST("/generate", generateLimit, generateBody, proxyHandler.ProxyToWorkflow)
+
+        // Workflow status, drops and capsule for one generation in a single call
+        v1.GET("/generations/:workflow_id", readLimit, proxyHandler.GetGeneration)
         
         // Workflow endpoints - proxy to workflow-api
         workflows := v1.Group("/workflows")
         {
             // Specific routes must come before wildcard routes
-            workflows.POST("/generate", proxyHandler.ProxyToWorkflow)
-            workflows.POST("/generate-extended", proxyHandler.ProxyToWorkflowExtended)
+            workflows.POST("/generate", generateLimit, generateBody, proxyHandler.ProxyToWorkflow)
+            workflows.POST("/generate-extended", generateLimit, generateBody, proxyHandler.ProxyToWorkflowExtended)
             // Remove wildcard routes as they conflict with specific routes
             // For additional workflow endpoints, add them explicitly
         }
         
         // LLM Router endpoints
-        llm := v1.Group("/llm")
+        llm := v1.Group("/llm", defaultLimit)
         {
-            llm.POST("/generate", proxyHandler.ProxyToLLMRouter)
-            llm.POST("/stream", proxyHandler.ProxyToLLMRouter)
+            llm.POST("/generate", llmBody, proxyHandler.ProxyToLLMRouter)
+            llm.POST("/stream", llmBody, proxyHandler.ProxyToLLMRouter)
             // Remove wildcard route to avoid conflicts
         }
         
         // Agent Orchestrator endpoints
         agents := v1.Group("/agents")
         {
-            agents.POST("/create", proxyHandler.ProxyToAgentOrchestrator)
-            agents.GET("/list", proxyHandler.ProxyToAgentOrchestrator)
-            agents.GET("/status", proxyHandler.ProxyToAgentOrchestrator)
-            agents.POST("/execute", proxyHandler.ProxyToAgentOrchestrator)
+            agents.POST("/create", defaultLimit, defaultBody, proxyHandler.ProxyToAgentOrchestrator)
+            agents.GET("/list", readLimit, proxyHandler.ProxyToAgentOrchestrator)
+            agents.GET("/status", readLimit, proxyHandler.ProxyToAgentOrchestrator)
+            agents.POST("/execute", defaultLimit, defaultBody, proxyHandler.ProxyToAgentOrchestrator)
         }
         
         // Meta Prompt Engine endpoints
         prompts := v1.Group("/prompts")
         {
-            prompts.POST("/generate", proxyHandler.ProxyToMetaPromptEngine)
-            prompts.POST("/optimize", proxyHandler.ProxyToMetaPromptEngine)
-            prompts.GET("/templates", proxyHandler.ProxyToMetaPromptEngine)
+            prompts.POST("/generate", defaultLimit, defaultBody, proxyHandler.ProxyToMetaPromptEngine)
+            prompts.POST("/optimize", defaultLimit, defaultBody, proxyHandler.ProxyToMetaPromptEngine)
+            prompts.GET("/templates", readLimit, proxyHandler.ProxyToMetaPromptEngine)
         }
         
         // Parser endpoints
-        parser := v1.Group("/parser")
+        parser := v1.Group("/parser", defaultLimit, defaultBody)
         {
             parser.POST("/parse", proxyHandler.ProxyToParser)
             parser.POST("/validate", proxyHandler.ProxyToParser)
@@ -156,7 +195,8 @@ func corsMiddleware() gin.HandlerFunc {
     return func(c *gin.Context) {
         c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
         c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-        c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+        c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+        c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Cache, X-RateLimit-Limit, X-RateLimit-Remaining, Retry-After")
         c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
         if c.Request.Method == "OPTIONS" {
@@ -0,0 +1,18 @@
+// Package middleware gives the gateway's handlers access to what the shared
+// request ID and access log middleware track for each request
+package middleware
+
+import (
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// UpstreamKey holds the name of the service a request was proxied to, for
+// the access log
+const UpstreamKey = logging.UpstreamKey
+
+// GetRequestID returns the correlation ID logging.RequestID set for the
+// request
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(logging.RequestIDKey)
+}
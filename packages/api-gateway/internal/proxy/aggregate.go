@@ -0,0 +1,273 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/api-gateway/internal/middleware"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Sources of a generation view, as named in source_errors
+const (
+	sourceWorkflow = "workflow"
+	sourceResult   = "result"
+	sourceDrops    = "drops"
+	sourceCapsule  = "capsule"
+)
+
+// GenerationView combines what the UI needs to render one generation. A
+// source that couldn't be reached is left empty and described in
+// SourceErrors instead of failing the request.
+type GenerationView struct {
+	WorkflowID   string                 `json:"workflow_id"`
+	Workflow     json.RawMessage        `json:"workflow,omitempty"`
+	Result       json.RawMessage        `json:"result,omitempty"`
+	Drops        json.RawMessage        `json:"drops,omitempty"`
+	Capsule      *CapsuleSummary        `json:"capsule"`
+	SourceErrors map[string]SourceError `json:"source_errors,omitempty"`
+	GeneratedAt  time.Time              `json:"generated_at"`
+}
+
+// CapsuleSummary is a capsule's metadata without its file contents
+type CapsuleSummary struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Language  string          `json:"language"`
+	Framework string          `json:"framework"`
+	Type      string          `json:"type"`
+	Files     int             `json:"files"`
+	Size      int64           `json:"size"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// SourceError describes why one source of an aggregate is missing
+type SourceError struct {
+	Service string `json:"service"`
+	Status  int    `json:"status,omitempty"` // upstream HTTP status, if it answered
+	Error   string `json:"error"`
+}
+
+// aggregateCache keeps complete aggregates for a short time so UI polling
+// doesn't fan out to every upstream on each request
+type aggregateCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedView
+}
+
+type cachedView struct {
+	view    *GenerationView
+	expires time.Time
+}
+
+func newAggregateCache(ttl time.Duration) *aggregateCache {
+	return &aggregateCache{ttl: ttl, entries: make(map[string]cachedView)}
+}
+
+func (a *aggregateCache) get(key string) (*GenerationView, bool) {
+	if a.ttl <= 0 {
+		return nil, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.view, true
+}
+
+func (a *aggregateCache) put(key string, view *GenerationView) {
+	if a.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, entry := range a.entries {
+		if now.After(entry.expires) {
+			delete(a.entries, k)
+		}
+	}
+	a.entries[key] = cachedView{view: view, expires: now.Add(a.ttl)}
+}
+
+// generationCacheKey keys a cached view by the caller's API key, hashed so
+// keys aren't held in memory, and the workflow
+func generationCacheKey(apiKey, workflowID string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8]) + "/" + workflowID
+}
+
+// errNotFound is returned by getJSON when the upstream answers 404
+var errNotFound = errors.New("not found")
+
+// getJSON GETs path from an upstream on behalf of the caller and returns
+// the response body. The caller's API key is forwarded so upstreams scope
+// the data to its tenant; without one the gateway's service key is sent. A
+// failure is returned as a SourceError alongside the error.
+func (p *ProxyHandler) getJSON(ctx context.Context, u *upstream, path, requestID, apiKey string) (json.RawMessage, *SourceError, error) {
+	req, err := http.NewRequest(http.MethodGet, u.baseURL+path, nil)
+	if err != nil {
+		return nil, &SourceError{Service: u.name, Error: err.Error()}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if requestID != "" {
+		req.Header.Set(apierror.RequestIDHeader, requestID)
+	}
+	if apiKey != "" {
+		req.Header.Set(authmiddleware.Header, apiKey)
+	} else {
+		authmiddleware.SetServiceKey(req)
+	}
+
+	resp, cancel, err := u.call(ctx, p.httpClient, req)
+	if err != nil {
+		msg := err.Error()
+		if isBreakerRejection(err) {
+			msg = "circuit breaker is " + u.breaker.State().String()
+		}
+		return nil, &SourceError{Service: u.name, Error: msg}, err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &SourceError{Service: u.name, Error: err.Error()}, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &SourceError{Service: u.name, Status: resp.StatusCode, Error: "not found"}, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("%s returned %d", u.name, resp.StatusCode)
+		return nil, &SourceError{Service: u.name, Status: resp.StatusCode, Error: err.Error()}, err
+	}
+	return body, nil, nil
+}
+
+// GetGeneration returns a workflow's status and result, its drops summary
+// and the capsule built from it in one response. The sources are fetched in
+// parallel under one deadline; complete responses are cached briefly, per
+// API key so one tenant's view is never served to another.
+func (p *ProxyHandler) GetGeneration(c *gin.Context) {
+	workflowID := c.Param("workflow_id")
+	apiKey := c.GetHeader(authmiddleware.Header)
+	cacheKey := generationCacheKey(apiKey, workflowID)
+	if view, ok := p.generationCache.get(cacheKey); ok {
+		c.Header("X-Cache", "HIT")
+		c.JSON(http.StatusOK, view)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(p.aggregate.Timeout)*time.Second)
+	defer cancel()
+
+	requestID := middleware.GetRequestID(c)
+	id := url.PathEscape(workflowID)
+	view := &GenerationView{WorkflowID: workflowID}
+
+	var mu sync.Mutex
+	fail := func(source string, srcErr *SourceError) {
+		mu.Lock()
+		defer mu.Unlock()
+		if view.SourceErrors == nil {
+			view.SourceErrors = make(map[string]SourceError)
+		}
+		view.SourceErrors[source] = *srcErr
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		status, srcErr, err := p.getJSON(ctx, p.workflowAPI, "/api/v1/workflows/"+id, requestID, apiKey)
+		if err != nil {
+			fail(sourceWorkflow, srcErr)
+			return
+		}
+		view.Workflow = status
+
+		// The result endpoint blocks on running workflows, so only ask
+		// for it once the workflow has completed
+		var described struct {
+			Status string `json:"status"`
+		}
+		if json.Unmarshal(status, &described) != nil || !strings.Contains(strings.ToLower(described.Status), "completed") {
+			return
+		}
+		result, srcErr, err := p.getJSON(ctx, p.workflowAPI, "/api/v1/workflows/"+id+"/result", requestID, apiKey)
+		if err != nil {
+			fail(sourceResult, srcErr)
+			return
+		}
+		view.Result = result
+	}()
+
+	go func() {
+		defer wg.Done()
+		summary, srcErr, err := p.getJSON(ctx, p.quantumDrops, "/api/v1/workflows/"+id+"/summary", requestID, apiKey)
+		if err != nil {
+			fail(sourceDrops, srcErr)
+			return
+		}
+		view.Drops = summary
+	}()
+
+	go func() {
+		defer wg.Done()
+		body, srcErr, err := p.getJSON(ctx, p.capsuleBuilder, "/api/v1/workflows/"+id+"/capsule", requestID, apiKey)
+		if errors.Is(err, errNotFound) {
+			// No capsule has been built yet
+			return
+		}
+		if err != nil {
+			fail(sourceCapsule, srcErr)
+			return
+		}
+
+		var capsule struct {
+			CapsuleSummary
+			Structure map[string]json.RawMessage `json:"structure"`
+		}
+		if err := json.Unmarshal(body, &capsule); err != nil {
+			fail(sourceCapsule, &SourceError{Service: p.capsuleBuilder.name, Error: "invalid capsule response"})
+			return
+		}
+		capsule.Files = len(capsule.Structure)
+		view.Capsule = &capsule.CapsuleSummary
+	}()
+
+	wg.Wait()
+	view.GeneratedAt = time.Now()
+
+	if len(view.SourceErrors) > 0 {
+		logger.WithFields(logrus.Fields{
+			"workflow_id":   workflowID,
+			"request_id":    requestID,
+			"source_errors": view.SourceErrors,
+		}).Warn("Generation view is incomplete")
+	} else {
+		p.generationCache.put(cacheKey, view)
+	}
+
+	c.Header("X-Cache", "MISS")
+	c.JSON(http.StatusOK, view)
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/config"
+	"github.com/gin-gonic/gin"
+)
+
+// generationBackends serves a completed workflow, its result, a drops
+// summary and a capsule; tests replace the servers they want to fail
+type generationBackends struct {
+	workflowAPI, quantumDrops, capsuleBuilder string
+}
+
+func newGenerationBackends(t *testing.T) *generationBackends {
+	serve := func(routes map[string]string) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, ok := routes[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	return &generationBackends{
+		workflowAPI: serve(map[string]string{
+			"/api/v1/workflows/wf-1":        `{"workflow_id":"wf-1","status":"COMPLETED"}`,
+			"/api/v1/workflows/wf-1/result": `{"code":"print(1)"}`,
+		}),
+		quantumDrops: serve(map[string]string{
+			"/api/v1/workflows/wf-1/summary": `{"total_drops":3}`,
+		}),
+		capsuleBuilder: serve(map[string]string{
+			"/api/v1/workflows/wf-1/capsule": `{"id":"cap-1","name":"app","language":"python","structure":{"main.py":{},"README.md":{}}}`,
+		}),
+	}
+}
+
+// newGenerationRouter serves GET /generations/:workflow_id from the
+// backends. Upstreams time out after a second; complete views are cached.
+func newGenerationRouter(t *testing.T, b *generationBackends) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger.SetOutput(io.Discard)
+	t.Setenv("WORKFLOW_API_URL", b.workflowAPI)
+	t.Setenv("QUANTUM_DROPS_URL", b.quantumDrops)
+	t.Setenv("CAPSULE_BUILDER_URL", b.capsuleBuilder)
+	p := NewProxyHandler(config.ProxyConfig{
+		Timeout:   1,
+		Breaker:   config.BreakerConfig{MinRequests: 10, FailureRate: 0.5, Interval: 60, OpenTimeout: 30, HalfOpenRequests: 1},
+		Aggregate: config.AggregateConfig{Timeout: 5, CacheTTL: 60},
+	})
+	router := gin.New()
+	router.GET("/generations/:workflow_id", p.GetGeneration)
+	return router
+}
+
+func getGeneration(t *testing.T, router http.Handler) (*GenerationView, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/generations/wf-1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var view GenerationView
+	if err := json.Unmarshal(w.Body.Bytes(), &view); err != nil {
+		t.Fatalf("decode view: %v", err)
+	}
+	return &view, w.Header().Get("X-Cache")
+}
+
+func TestGetGenerationComplete(t *testing.T) {
+	router := newGenerationRouter(t, newGenerationBackends(t))
+
+	view, cache := getGeneration(t, router)
+	if cache != "MISS" || len(view.SourceErrors) != 0 {
+		t.Fatalf("X-Cache %q, source errors %v", cache, view.SourceErrors)
+	}
+	if view.Workflow == nil || view.Result == nil || string(view.Drops) != `{"total_drops":3}` {
+		t.Errorf("view = %+v", view)
+	}
+	if view.Capsule == nil || view.Capsule.ID != "cap-1" || view.Capsule.Files != 2 {
+		t.Errorf("capsule = %+v, want cap-1 with 2 files", view.Capsule)
+	}
+
+	if _, cache := getGeneration(t, router); cache != "HIT" {
+		t.Errorf("second request X-Cache = %q, want HIT", cache)
+	}
+}
+
+func TestGetGenerationMixedFailures(t *testing.T) {
+	backends := newGenerationBackends(t)
+
+	// The workflow answers but its result fails
+	workflowAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/workflows/wf-1/result" {
+			http.Error(w, "temporal unavailable", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, `{"workflow_id":"wf-1","status":"COMPLETED"}`)
+	}))
+	defer workflowAPI.Close()
+	backends.workflowAPI = workflowAPI.URL
+
+	// quantum-drops hangs past the upstream timeout
+	release := make(chan struct{})
+	quantumDrops := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer quantumDrops.Close()
+	defer close(release)
+	backends.quantumDrops = quantumDrops.URL
+
+	// capsule-builder is down
+	capsuleBuilder := httptest.NewServer(http.NotFoundHandler())
+	capsuleBuilder.Close()
+	backends.capsuleBuilder = capsuleBuilder.URL
+
+	router := newGenerationRouter(t, backends)
+	view, cache := getGeneration(t, router)
+
+	if string(view.Workflow) != `{"workflow_id":"wf-1","status":"COMPLETED"}` {
+		t.Errorf("workflow = %s, want the status that was fetched", view.Workflow)
+	}
+	if view.Result != nil || view.Drops != nil || view.Capsule != nil {
+		t.Errorf("failed sources were filled in: %+v", view)
+	}
+	if len(view.SourceErrors) != 3 {
+		t.Fatalf("source errors = %+v, want result, drops and capsule", view.SourceErrors)
+	}
+	if result := view.SourceErrors[sourceResult]; result.Service != "workflow-api" || result.Status != http.StatusInternalServerError {
+		t.Errorf("result error = %+v, want workflow-api 500", result)
+	}
+	if drops := view.SourceErrors[sourceDrops]; drops.Service != "quantum-drops" || drops.Status != 0 || drops.Error == "" {
+		t.Errorf("drops error = %+v, want a quantum-drops timeout", drops)
+	}
+	if capsule := view.SourceErrors[sourceCapsule]; capsule.Service != "capsule-builder" || capsule.Status != 0 || capsule.Error == "" {
+		t.Errorf("capsule error = %+v, want capsule-builder unreachable", capsule)
+	}
+
+	// Incomplete views are not cached
+	if cache != "MISS" {
+		t.Errorf("X-Cache = %q, want MISS", cache)
+	}
+	if _, cache := getGeneration(t, router); cache != "MISS" {
+		t.Errorf("second request X-Cache = %q, want MISS", cache)
+	}
+}
+
+func TestGetGenerationWithoutCapsule(t *testing.T) {
+	backends := newGenerationBackends(t)
+	capsuleBuilder := httptest.NewServer(http.NotFoundHandler())
+	defer capsuleBuilder.Close()
+	backends.capsuleBuilder = capsuleBuilder.URL
+
+	view, _ := getGeneration(t, newGenerationRouter(t, backends))
+	if view.Capsule != nil || len(view.SourceErrors) != 0 {
+		t.Errorf("capsule %+v, source errors %v: a missing capsule is not an error", view.Capsule, view.SourceErrors)
+	}
+}
+
+func TestGetGenerationSendsAPIKey(t *testing.T) {
+	t.Setenv("SERVICE_API_KEY", "gateway-key")
+	backends := newGenerationBackends(t)
+	var mu sync.Mutex
+	var keys []string
+	workflowAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get("X-API-Key"))
+		mu.Unlock()
+		io.WriteString(w, `{"workflow_id":"wf-1","status":"RUNNING"}`)
+	}))
+	defer workflowAPI.Close()
+	backends.workflowAPI = workflowAPI.URL
+	router := newGenerationRouter(t, backends)
+
+	get := func(apiKey string) string {
+		req := httptest.NewRequest(http.MethodGet, "/generations/wf-1", nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Header().Get("X-Cache")
+	}
+
+	// Each caller's view is fetched with its own key and cached for it alone
+	for _, apiKey := range []string{"tenant-a-key", "tenant-b-key", "tenant-a-key", ""} {
+		get(apiKey)
+	}
+	want := []string{"tenant-a-key", "tenant-b-key", "gateway-key"}
+	if len(keys) != len(want) {
+		t.Fatalf("workflow-api got keys %q, want %q", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("workflow-api got keys %q, want %q", keys, want)
+			break
+		}
+	}
+	if cache := get("tenant-b-key"); cache != "HIT" {
+		t.Errorf("X-Cache = %q for a cached tenant, want HIT", cache)
+	}
+}
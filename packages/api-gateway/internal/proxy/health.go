@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/api-gateway/internal/middleware"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Overall states of the aggregated health check
+const (
+	HealthHealthy     = "healthy"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+// defaultHealthTimeout is used when proxy.health.timeout isn't set
+const defaultHealthTimeout = 1500 * time.Millisecond
+
+// AggregateHealth is the gateway's health including its upstreams
+type AggregateHealth struct {
+	Status    string                   `json:"status"`
+	Services  map[string]ServiceHealth `json:"services"`
+	CheckedAt time.Time                `json:"checked_at"`
+}
+
+// ServiceHealth is the result of probing one upstream's /health
+type ServiceHealth struct {
+	Status     string `json:"status"` // "up" or "down"
+	Critical   bool   `json:"critical"`
+	HTTPStatus int    `json:"http_status,omitempty"`
+	LatencyMS  int64  `json:"latency_ms"`
+	Error      string `json:"error,omitempty"`
+	Breaker    string `json:"circuit_breaker"`
+}
+
+// upstreams returns every backend the gateway proxies to
+func (p *ProxyHandler) upstreams() []*upstream {
+	return []*upstream{
+		p.workflowAPI,
+		p.llmRouter,
+		p.agentOrchestrator,
+		p.metaPromptEngine,
+		p.parser,
+		p.quantumDrops,
+		p.capsuleBuilder,
+	}
+}
+
+func (p *ProxyHandler) isCritical(u *upstream) bool {
+	for _, key := range p.health.Critical {
+		if key == u.key {
+			return true
+		}
+	}
+	return false
+}
+
+// probe GETs an upstream's /health. Probes bypass the circuit breaker so a
+// readiness check neither trips it nor is hidden behind it.
+func (p *ProxyHandler) probe(ctx context.Context, u *upstream, requestID string) ServiceHealth {
+	health := ServiceHealth{
+		Status:   "down",
+		Critical: p.isCritical(u),
+		Breaker:  u.breaker.State().String(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.baseURL+"/health", nil)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	if requestID != "" {
+		req.Header.Set(apierror.RequestIDHeader, requestID)
+	}
+
+	start := time.Now()
+	resp, err := p.httpClient.Do(req)
+	health.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		health.Error = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			health.Error = "health check timed out"
+		}
+		return health
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	health.HTTPStatus = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		health.Error = fmt.Sprintf("%s returned %d", u.name, resp.StatusCode)
+		return health
+	}
+	health.Status = "up"
+	return health
+}
+
+// CheckHealth probes every upstream in parallel. The gateway is unavailable
+// if a critical upstream is down and degraded if any other one is.
+func (p *ProxyHandler) CheckHealth(ctx context.Context, requestID string) *AggregateHealth {
+	timeout := time.Duration(p.health.Timeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report := &AggregateHealth{Status: HealthHealthy, Services: make(map[string]ServiceHealth)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams() {
+		wg.Add(1)
+		go func(u *upstream) {
+			defer wg.Done()
+			health := p.probe(ctx, u, requestID)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Services[u.name] = health
+			if health.Status == "up" {
+				return
+			}
+			if health.Critical {
+				report.Status = HealthUnavailable
+			} else if report.Status == HealthHealthy {
+				report.Status = HealthDegraded
+			}
+		}(u)
+	}
+	wg.Wait()
+	report.CheckedAt = time.Now()
+	return report
+}
+
+// GetAggregateHealth reports the health of the gateway and its upstreams,
+// answering 503 while the gateway is unavailable so it can back /ready
+func (p *ProxyHandler) GetAggregateHealth(c *gin.Context) {
+	report := p.CheckHealth(c.Request.Context(), middleware.GetRequestID(c))
+
+	status := http.StatusOK
+	if report.Status == HealthUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	if report.Status != HealthHealthy {
+		down := []string{}
+		for name, health := range report.Services {
+			if health.Status != "up" {
+				down = append(down, name)
+			}
+		}
+		logger.WithFields(logrus.Fields{
+			"status":     report.Status,
+			"down":       down,
+			"request_id": middleware.GetRequestID(c),
+		}).Warn("Upstream health check failed")
+	}
+	c.JSON(status, report)
+}
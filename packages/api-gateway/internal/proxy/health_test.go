@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Environment variables naming each upstream's URL
+var upstreamEnv = map[string]string{
+	"workflow-api":       "WORKFLOW_API_URL",
+	"llm-router":         "LLM_ROUTER_URL",
+	"agent-orchestrator": "AGENT_ORCHESTRATOR_URL",
+	"meta-prompt-engine": "META_PROMPT_ENGINE_URL",
+	"parser":             "PARSER_URL",
+	"quantum-drops":      "QUANTUM_DROPS_URL",
+	"capsule-builder":    "CAPSULE_BUILDER_URL",
+}
+
+func healthyBackend(t *testing.T) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"status":"healthy"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func failingBackend(t *testing.T) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func slowBackend(t *testing.T) string {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		srv.Close()
+	})
+	return srv.URL
+}
+
+func unreachableBackend(t *testing.T) string {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	return srv.URL
+}
+
+// newHealthTestHandler points every upstream at a healthy backend except
+// those in overrides
+func newHealthTestHandler(t *testing.T, overrides map[string]string) *ProxyHandler {
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.PanicLevel)
+
+	for name, env := range upstreamEnv {
+		url, ok := overrides[name]
+		if !ok {
+			url = healthyBackend(t)
+		}
+		t.Setenv(env, url)
+	}
+	return NewProxyHandler(config.ProxyConfig{
+		Timeout: 5,
+		Breaker: config.BreakerConfig{MinRequests: 10, FailureRate: 0.5, Interval: 60, OpenTimeout: 30, HalfOpenRequests: 1},
+		Health:  config.HealthConfig{Timeout: 300, Critical: []string{"workflow_api", "llm_router"}},
+	})
+}
+
+func TestCheckHealthAllHealthy(t *testing.T) {
+	p := newHealthTestHandler(t, nil)
+
+	report := p.CheckHealth(context.Background(), "")
+	if report.Status != HealthHealthy {
+		t.Fatalf("status = %q, want %q: %+v", report.Status, HealthHealthy, report.Services)
+	}
+	if len(report.Services) != len(upstreamEnv) {
+		t.Fatalf("got %d services, want %d", len(report.Services), len(upstreamEnv))
+	}
+	for name, health := range report.Services {
+		if health.Status != "up" || health.HTTPStatus != http.StatusOK {
+			t.Errorf("%s = %+v, want up", name, health)
+		}
+	}
+	if !report.Services["workflow-api"].Critical || report.Services["parser"].Critical {
+		t.Errorf("critical flags wrong: %+v", report.Services)
+	}
+}
+
+func TestCheckHealthNonCriticalDownIsDegraded(t *testing.T) {
+	p := newHealthTestHandler(t, map[string]string{
+		"parser":          failingBackend(t),
+		"capsule-builder": unreachableBackend(t),
+	})
+
+	report := p.CheckHealth(context.Background(), "")
+	if report.Status != HealthDegraded {
+		t.Fatalf("status = %q, want %q", report.Status, HealthDegraded)
+	}
+	if parser := report.Services["parser"]; parser.Status != "down" || parser.HTTPStatus != http.StatusInternalServerError {
+		t.Errorf("parser = %+v, want down with 500", parser)
+	}
+	if capsule := report.Services["capsule-builder"]; capsule.Status != "down" || capsule.Error == "" {
+		t.Errorf("capsule-builder = %+v, want down with an error", capsule)
+	}
+	if report.Services["workflow-api"].Status != "up" {
+		t.Errorf("workflow-api = %+v, want up", report.Services["workflow-api"])
+	}
+}
+
+func TestCheckHealthCriticalDownIsUnavailable(t *testing.T) {
+	p := newHealthTestHandler(t, map[string]string{
+		"llm-router": unreachableBackend(t),
+		"parser":     failingBackend(t),
+	})
+
+	report := p.CheckHealth(context.Background(), "")
+	if report.Status != HealthUnavailable {
+		t.Fatalf("status = %q, want %q", report.Status, HealthUnavailable)
+	}
+	if report.Services["llm-router"].Status != "down" {
+		t.Errorf("llm-router = %+v, want down", report.Services["llm-router"])
+	}
+}
+
+func TestCheckHealthTimesOutSlowUpstreams(t *testing.T) {
+	p := newHealthTestHandler(t, map[string]string{"workflow-api": slowBackend(t)})
+
+	start := time.Now()
+	report := p.CheckHealth(context.Background(), "")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("health check took %v, want it bounded by the probe timeout", elapsed)
+	}
+	if report.Status != HealthUnavailable {
+		t.Fatalf("status = %q, want %q", report.Status, HealthUnavailable)
+	}
+	if got := report.Services["workflow-api"].Error; got != "health check timed out" {
+		t.Errorf("workflow-api error = %q, want a timeout", got)
+	}
+	if report.Services["llm-router"].Status != "up" {
+		t.Errorf("llm-router = %+v, want up", report.Services["llm-router"])
+	}
+}
+
+func TestGetAggregateHealthStatusCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		overrides func(t *testing.T) map[string]string
+		code      int
+		status    string
+	}{
+		{"healthy", func(t *testing.T) map[string]string { return nil }, http.StatusOK, HealthHealthy},
+		{"degraded", func(t *testing.T) map[string]string {
+			return map[string]string{"quantum-drops": failingBackend(t)}
+		}, http.StatusOK, HealthDegraded},
+		{"unavailable", func(t *testing.T) map[string]string {
+			return map[string]string{"workflow-api": unreachableBackend(t)}
+		}, http.StatusServiceUnavailable, HealthUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newHealthTestHandler(t, tt.overrides(t))
+			router := gin.New()
+			router.GET("/ready", p.GetAggregateHealth)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+			if rec.Code != tt.code {
+				t.Fatalf("code = %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			var report AggregateHealth
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.status || len(report.Services) != len(upstreamEnv) {
+				t.Errorf("report = %+v, want status %q for every service", report, tt.status)
+			}
+		})
+	}
+}
@@ -2,17 +2,28 @@ package proxy
 
 import (
     "bytes"
+    "context"
     "io"
     "net/http"
     "os"
     "time"
 
+    "github.com/QuantumLayer-dev/quantumlayer-platform/packages/api-gateway/internal/middleware"
+    "github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+    "github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/config"
     "github.com/gin-gonic/gin"
     "github.com/sirupsen/logrus"
 )
 
 var logger = logrus.New()
 
+const healthCheckTimeout = 5 * time.Second
+
+// SetLogger makes the proxy log through the gateway's logger
+func SetLogger(l *logrus.Logger) {
+    logger = l
+}
+
 // ServiceURLs holds the URLs for backend services
 type ServiceURLs struct {
     WorkflowAPI      string
@@ -20,27 +31,43 @@ type ServiceURLs struct {
     AgentOrchestrator string
     MetaPromptEngine  string
     Parser           string
+    QuantumDrops      string
+    CapsuleBuilder    string
 }
 
 // ProxyHandler handles proxying requests to backend services
 type ProxyHandler struct {
     urls       ServiceURLs
     httpClient *http.Client
+
+    workflowAPI       *upstream
+    llmRouter         *upstream
+    agentOrchestrator *upstream
+    metaPromptEngine  *upstream
+    parser            *upstream
+    quantumDrops      *upstream
+    capsuleBuilder    *upstream
+
+    aggregate       config.AggregateConfig
+    generationCache *aggregateCache
+    health          config.HealthConfig
 }
 
-// NewProxyHandler creates a new proxy handler with service URLs from environment
-func NewProxyHandler() *ProxyHandler {
+// NewProxyHandler creates a new proxy handler with service URLs from
+// environment, and timeouts and circuit breakers from the proxy config
+func NewProxyHandler(cfg config.ProxyConfig) *ProxyHandler {
     urls := ServiceURLs{
         WorkflowAPI:      getEnvOrDefault("WORKFLOW_API_URL", "http://workflow-api.temporal.svc.cluster.local:8080"),
         LLMRouter:        getEnvOrDefault("LLM_ROUTER_URL", "http://llm-router.quantumlayer.svc.cluster.local:8080"),
         AgentOrchestrator: getEnvOrDefault("AGENT_ORCHESTRATOR_URL", "http://agent-orchestrator.quantumlayer.svc.cluster.local:8083"),
         MetaPromptEngine:  getEnvOrDefault("META_PROMPT_ENGINE_URL", "http://meta-prompt-engine.quantumlayer.svc.cluster.local:8085"),
         Parser:           getEnvOrDefault("PARSER_URL", "http://parser.quantumlayer.svc.cluster.local:8086"),
+        QuantumDrops:      getEnvOrDefault("QUANTUM_DROPS_URL", "http://quantum-drops.quantumlayer.svc.cluster.local:8090"),
+        CapsuleBuilder:    getEnvOrDefault("CAPSULE_BUILDER_URL", "http://capsule-builder.quantumlayer.svc.cluster.local:8086"),
     }
 
-    // Create HTTP client with timeouts
+    // Create HTTP client; each upstream sets its own timeout per request
     client := &http.Client{
-        Timeout: 60 * time.Second, // 60 second timeout for workflow operations
         Transport: &http.Transport{
             MaxIdleConns:        100,
             MaxIdleConnsPerHost: 10,
@@ -54,11 +81,23 @@ func NewProxyHandler() *ProxyHandler {
         "agent_orchestrator": urls.AgentOrchestrator,
         "meta_prompt_engine": urls.MetaPromptEngine,
         "parser":            urls.Parser,
+        "quantum_drops":      urls.QuantumDrops,
+        "capsule_builder":    urls.CapsuleBuilder,
     }).Info("Initialized proxy handler with service URLs")
 
     return &ProxyHandler{
-        urls:       urls,
-        httpClient: client,
+        urls:              urls,
+        httpClient:        client,
+        workflowAPI:       newUpstream("workflow-api", "workflow_api", urls.WorkflowAPI, cfg),
+        llmRouter:         newUpstream("llm-router", "llm_router", urls.LLMRouter, cfg),
+        agentOrchestrator: newUpstream("agent-orchestrator", "agent_orchestrator", urls.AgentOrchestrator, cfg),
+        metaPromptEngine:  newUpstream("meta-prompt-engine", "meta_prompt_engine", urls.MetaPromptEngine, cfg),
+        parser:            newUpstream("parser", "parser", urls.Parser, cfg),
+        quantumDrops:      newUpstream("quantum-drops", "quantum_drops", urls.QuantumDrops, cfg),
+        capsuleBuilder:    newUpstream("capsule-builder", "capsule_builder", urls.CapsuleBuilder, cfg),
+        aggregate:         cfg.Aggregate,
+        generationCache:   newAggregateCache(time.Duration(cfg.Aggregate.CacheTTL) * time.Second),
+        health:            cfg.Health,
     }
 }
 
@@ -79,8 +118,9 @@ func (p *ProxyHandler) ProxyToWorkflow(c *gin.Context) {
     }
 
     logger.WithFields(logrus.Fields{
-        "endpoint": endpoint,
-        "method":   c.Request.Method,
+        "endpoint":   endpoint,
+        "method":     c.Request.Method,
+        "request_id": middleware.GetRequestID(c),
     }).Info("Proxying request to workflow API")
 
     // Create new request
@@ -97,18 +137,14 @@ func (p *ProxyHandler) ProxyToWorkflow(c *gin.Context) {
             req.Header.Add(key, value)
         }
     }
+    setUpstream(c, req, "workflow-api")
 
     // Execute request
-    resp, err := p.httpClient.Do(req)
-    if err != nil {
-        logger.WithError(err).WithField("endpoint", endpoint).Error("Failed to proxy request")
-        c.JSON(http.StatusServiceUnavailable, gin.H{
-            "error": "Service unavailable",
-            "service": "workflow-api",
-            "details": err.Error(),
-        })
+    resp, cancel, ok := p.workflowAPI.do(c, p.httpClient, req)
+    if !ok {
         return
     }
+    defer cancel()
     defer resp.Body.Close()
 
     // Read response
@@ -143,8 +179,9 @@ func (p *ProxyHandler) ProxyToWorkflowExtended(c *gin.Context) {
     endpoint := p.urls.WorkflowAPI + "/api/v1/workflows/generate-extended"
     
     logger.WithFields(logrus.Fields{
-        "endpoint": endpoint,
-        "method":   "POST",
+        "endpoint":   endpoint,
+        "method":     "POST",
+        "request_id": middleware.GetRequestID(c),
     }).Info("Proxying extended workflow request")
 
     // Create new request
@@ -166,18 +203,14 @@ func (p *ProxyHandler) ProxyToWorkflowExtended(c *gin.Context) {
             }
         }
     }
+    setUpstream(c, req, "workflow-api")
 
     // Execute request
-    resp, err := p.httpClient.Do(req)
-    if err != nil {
-        logger.WithError(err).WithField("endpoint", endpoint).Error("Failed to proxy extended workflow request")
-        c.JSON(http.StatusServiceUnavailable, gin.H{
-            "error": "Service unavailable",
-            "service": "workflow-api",
-            "details": err.Error(),
-        })
+    resp, cancel, ok := p.workflowAPI.do(c, p.httpClient, req)
+    if !ok {
         return
     }
+    defer cancel()
     defer resp.Body.Close()
 
     // Read response
@@ -194,26 +227,28 @@ func (p *ProxyHandler) ProxyToWorkflowExtended(c *gin.Context) {
 
 // ProxyToLLMRouter proxies requests to LLM Router
 func (p *ProxyHandler) ProxyToLLMRouter(c *gin.Context) {
-    p.proxyToService(c, p.urls.LLMRouter, "llm-router")
+    p.proxyToService(c, p.llmRouter)
 }
 
 // ProxyToAgentOrchestrator proxies requests to Agent Orchestrator
 func (p *ProxyHandler) ProxyToAgentOrchestrator(c *gin.Context) {
-    p.proxyToService(c, p.urls.AgentOrchestrator, "agent-orchestrator")
+    p.proxyToService(c, p.agentOrchestrator)
 }
 
 // ProxyToMetaPromptEngine proxies requests to Meta Prompt Engine
 func (p *ProxyHandler) ProxyToMetaPromptEngine(c *gin.Context) {
-    p.proxyToService(c, p.urls.MetaPromptEngine, "meta-prompt-engine")
+    p.proxyToService(c, p.metaPromptEngine)
 }
 
 // ProxyToParser proxies requests to Parser service
 func (p *ProxyHandler) ProxyToParser(c *gin.Context) {
-    p.proxyToService(c, p.urls.Parser, "parser")
+    p.proxyToService(c, p.parser)
 }
 
 // Generic proxy function for services
-func (p *ProxyHandler) proxyToService(c *gin.Context, baseURL, serviceName string) {
+func (p *ProxyHandler) proxyToService(c *gin.Context, u *upstream) {
+    serviceName := u.name
+
     // Read request body
     body, err := io.ReadAll(c.Request.Body)
     if err != nil {
@@ -224,12 +259,13 @@ func (p *ProxyHandler) proxyToService(c *gin.Context, baseURL, serviceName strin
 
     // Build endpoint
     path := c.Param("path")
-    endpoint := baseURL + path
+    endpoint := u.baseURL + path
 
     logger.WithFields(logrus.Fields{
-        "service":  serviceName,
-        "endpoint": endpoint,
-        "method":   c.Request.Method,
+        "service":    serviceName,
+        "endpoint":   endpoint,
+        "method":     c.Request.Method,
+        "request_id": middleware.GetRequestID(c),
     }).Info("Proxying request")
 
     // Create new request
@@ -248,21 +284,14 @@ func (p *ProxyHandler) proxyToService(c *gin.Context, baseURL, serviceName strin
             }
         }
     }
+    setUpstream(c, req, serviceName)
 
     // Execute request
-    resp, err := p.httpClient.Do(req)
-    if err != nil {
-        logger.WithError(err).WithFields(logrus.Fields{
-            "service":  serviceName,
-            "endpoint": endpoint,
-        }).Error("Failed to proxy request")
-        c.JSON(http.StatusServiceUnavailable, gin.H{
-            "error":   "Service unavailable",
-            "service": serviceName,
-            "details": err.Error(),
-        })
+    resp, cancel, ok := u.do(c, p.httpClient, req)
+    if !ok {
         return
     }
+    defer cancel()
     defer resp.Body.Close()
 
     // Read response
@@ -277,9 +306,28 @@ func (p *ProxyHandler) proxyToService(c *gin.Context, baseURL, serviceName strin
     c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
 }
 
-// CheckServiceHealth checks if a service is healthy
-func (p *ProxyHandler) CheckServiceHealth(serviceURL string) bool {
-    resp, err := p.httpClient.Get(serviceURL + "/health")
+// setUpstream makes sure an upstream request carries the gateway's request
+// ID and records the service it goes to for the access log
+func setUpstream(c *gin.Context, req *http.Request, serviceName string) {
+    req.Header.Set(apierror.RequestIDHeader, middleware.GetRequestID(c))
+    c.Set(middleware.UpstreamKey, serviceName)
+}
+
+// CheckServiceHealth checks if a service is healthy, tagging the check with
+// the request ID of the request that triggered it
+func (p *ProxyHandler) CheckServiceHealth(serviceURL, requestID string) bool {
+    ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+    defer cancel()
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, serviceURL+"/health", nil)
+    if err != nil {
+        return false
+    }
+    if requestID != "" {
+        req.Header.Set(apierror.RequestIDHeader, requestID)
+    }
+
+    resp, err := p.httpClient.Do(req)
     if err != nil {
         return false
     }
@@ -289,23 +337,33 @@ func (p *ProxyHandler) CheckServiceHealth(serviceURL string) bool {
 
 // GetServiceStatus returns the status of all backend services
 func (p *ProxyHandler) GetServiceStatus(c *gin.Context) {
+    requestID := middleware.GetRequestID(c)
     status := gin.H{
         "platform": "QuantumLayer",
         "version":  "2.0.0",
         "services": gin.H{
-            "workflow-api":       p.checkHealth(p.urls.WorkflowAPI),
-            "llm-router":        p.checkHealth(p.urls.LLMRouter),
-            "agent-orchestrator": p.checkHealth(p.urls.AgentOrchestrator),
-            "meta-prompt-engine": p.checkHealth(p.urls.MetaPromptEngine),
-            "parser":            p.checkHealth(p.urls.Parser),
+            "workflow-api":       p.checkHealth(p.urls.WorkflowAPI, requestID),
+            "llm-router":        p.checkHealth(p.urls.LLMRouter, requestID),
+            "agent-orchestrator": p.checkHealth(p.urls.AgentOrchestrator, requestID),
+            "meta-prompt-engine": p.checkHealth(p.urls.MetaPromptEngine, requestID),
+            "parser":            p.checkHealth(p.urls.Parser, requestID),
+        },
+        "circuit_breakers": gin.H{
+            "workflow-api":       p.workflowAPI.breakerStatus(),
+            "llm-router":         p.llmRouter.breakerStatus(),
+            "agent-orchestrator": p.agentOrchestrator.breakerStatus(),
+            "meta-prompt-engine": p.metaPromptEngine.breakerStatus(),
+            "parser":             p.parser.breakerStatus(),
+            "quantum-drops":      p.quantumDrops.breakerStatus(),
+            "capsule-builder":    p.capsuleBuilder.breakerStatus(),
         },
     }
 
     c.JSON(http.StatusOK, status)
 }
 
-func (p *ProxyHandler) checkHealth(serviceURL string) string {
-    if p.CheckServiceHealth(serviceURL) {
+func (p *ProxyHandler) checkHealth(serviceURL, requestID string) string {
+    if p.CheckServiceHealth(serviceURL, requestID) {
         return "healthy"
     }
     return "unhealthy"
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/config"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// requestIDBackend records the X-Request-ID of every request it serves
+type requestIDBackend struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (b *requestIDBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	b.ids = append(b.ids, r.Header.Get(logging.RequestIDHeader))
+	b.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// newGatewayRouter routes /llm/* to the LLM router upstream behind the
+// gateway's request ID and access log middleware, logging to the returned
+// buffer
+func newGatewayRouter(t *testing.T, llmRouterURL string) (*gin.Engine, *bytes.Buffer) {
+	gin.SetMode(gin.TestMode)
+	logger.SetOutput(io.Discard)
+	t.Setenv("LLM_ROUTER_URL", llmRouterURL)
+	p := NewProxyHandler(config.ProxyConfig{
+		Timeout: 5,
+		Breaker: config.BreakerConfig{MinRequests: 10, FailureRate: 0.5, Interval: 60, OpenTimeout: 30, HalfOpenRequests: 1},
+	})
+
+	var logs bytes.Buffer
+	accessLogger := logrus.New()
+	accessLogger.SetOutput(&logs)
+	accessLogger.SetFormatter(&logrus.JSONFormatter{})
+
+	router := gin.New()
+	router.Use(logging.RequestID(), logging.Middleware(accessLogger.WithField("service", "api-gateway")))
+	router.Any("/llm/*path", p.ProxyToLLMRouter)
+	return router, &logs
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	tests := []struct {
+		name     string
+		sent     string
+		generate bool // whether the gateway must replace the sent ID
+	}{
+		{name: "caller ID", sent: "req-123"},
+		{name: "missing", sent: "", generate: true},
+		{name: "log injection", sent: "req-1\" level=error msg=forged", generate: true},
+		{name: "too long", sent: strings.Repeat("a", 129), generate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &requestIDBackend{}
+			upstream := httptest.NewServer(backend)
+			defer upstream.Close()
+			router, logs := newGatewayRouter(t, upstream.URL)
+
+			req := httptest.NewRequest(http.MethodGet, "/llm/providers", nil)
+			if tt.sent != "" {
+				req.Header.Set(logging.RequestIDHeader, tt.sent)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+
+			returned := w.Header().Get(logging.RequestIDHeader)
+			if len(backend.ids) != 1 || backend.ids[0] != returned {
+				t.Fatalf("upstream got IDs %q, response carries %q", backend.ids, returned)
+			}
+			if tt.generate {
+				if returned == "" || returned == tt.sent {
+					t.Errorf("sent %q, got %q, want a generated ID", tt.sent, returned)
+				}
+			} else if returned != tt.sent {
+				t.Errorf("got %q, want the caller's %q", returned, tt.sent)
+			}
+
+			var line map[string]interface{}
+			if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+				t.Fatalf("access log %q: %v", logs.String(), err)
+			}
+			if line["request_id"] != returned || line["upstream_service"] != "llm-router" || line["service"] != "api-gateway" {
+				t.Errorf("access log = %v", line)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/sony/gobreaker"
+)
+
+var (
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_upstream_request_duration_seconds",
+		Help:    "Duration of requests proxied to upstream services",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"upstream", "outcome"})
+
+	breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_circuit_breaker_state",
+		Help: "Circuit breaker state per upstream: 0 closed, 1 half-open, 2 open",
+	}, []string{"upstream"})
+
+	breakerRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_circuit_breaker_rejections_total",
+		Help: "Requests rejected because an upstream's circuit breaker was open",
+	}, []string{"upstream"})
+)
+
+// upstream is a backend service with its own timeout and circuit breaker
+type upstream struct {
+	name        string
+	key         string // the service's key under proxy.upstreams
+	baseURL     string
+	timeout     time.Duration
+	openTimeout time.Duration
+	breaker     *gobreaker.TwoStepCircuitBreaker
+
+	mu       sync.Mutex
+	openedAt time.Time
+}
+
+// newUpstream creates an upstream configured by the gateway's proxy
+// settings. configKey is the service's key under proxy.upstreams.
+func newUpstream(name, configKey, baseURL string, cfg config.ProxyConfig) *upstream {
+	u := &upstream{
+		name:        name,
+		key:         configKey,
+		baseURL:     baseURL,
+		timeout:     time.Duration(cfg.UpstreamTimeout(configKey)) * time.Second,
+		openTimeout: time.Duration(cfg.Breaker.OpenTimeout) * time.Second,
+	}
+
+	breaker := cfg.Breaker
+	u.breaker = gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:        name,
+		MaxRequests: breaker.HalfOpenRequests,
+		Interval:    time.Duration(breaker.Interval) * time.Second,
+		Timeout:     u.openTimeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			if counts.Requests < breaker.MinRequests {
+				return false
+			}
+			return float64(counts.TotalFailures)/float64(counts.Requests) >= breaker.FailureRate
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			if to == gobreaker.StateOpen {
+				u.mu.Lock()
+				u.openedAt = time.Now()
+				u.mu.Unlock()
+			}
+			breakerState.WithLabelValues(name).Set(float64(to))
+			logger.WithFields(logrus.Fields{
+				"upstream": name,
+				"from":     from.String(),
+				"to":       to.String(),
+			}).Warn("Circuit breaker state changed")
+		},
+	})
+	breakerState.WithLabelValues(name).Set(float64(gobreaker.StateClosed))
+	return u
+}
+
+// retryAfter is how long until an open breaker lets a probe request through
+func (u *upstream) retryAfter() int {
+	u.mu.Lock()
+	remaining := u.openTimeout - time.Since(u.openedAt)
+	u.mu.Unlock()
+	return int(math.Max(1, math.Ceil(remaining.Seconds())))
+}
+
+// call sends a request to the upstream under its timeout and circuit
+// breaker. Transport errors, timeouts and 5xx responses count as failures;
+// a cancelled ctx doesn't, since a caller giving up says nothing about the
+// upstream's health. When the breaker rejects the request the error is
+// gobreaker.ErrOpenState or gobreaker.ErrTooManyRequests. On success the
+// caller must call cancel once it has read the body.
+func (u *upstream) call(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, context.CancelFunc, error) {
+	done, err := u.breaker.Allow()
+	if err != nil {
+		breakerRejections.WithLabelValues(u.name).Inc()
+		return nil, nil, err
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, u.timeout)
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(reqCtx))
+	elapsed := time.Since(start).Seconds()
+
+	if err != nil {
+		cancel()
+		callerGone := ctx.Err() != nil
+		done(callerGone)
+
+		outcome := "error"
+		if errors.Is(reqCtx.Err(), context.DeadlineExceeded) && !callerGone {
+			outcome = "timeout"
+		}
+		upstreamDuration.WithLabelValues(u.name, outcome).Observe(elapsed)
+		return nil, nil, err
+	}
+
+	failed := resp.StatusCode >= 500
+	done(!failed)
+	outcome := "success"
+	if failed {
+		outcome = "server_error"
+	}
+	upstreamDuration.WithLabelValues(u.name, outcome).Observe(elapsed)
+	return resp, cancel, nil
+}
+
+// isBreakerRejection reports whether err means the breaker refused a call
+func isBreakerRejection(err error) bool {
+	return errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests)
+}
+
+// do is call for a proxied gin request. When the call fails it responds
+// itself (503 with a retry_after hint if the breaker is open, 504 on
+// timeout, 503 otherwise) and returns false.
+func (u *upstream) do(c *gin.Context, client *http.Client, req *http.Request) (*http.Response, context.CancelFunc, bool) {
+	resp, cancel, err := u.call(c.Request.Context(), client, req)
+	if err == nil {
+		return resp, cancel, true
+	}
+
+	if isBreakerRejection(err) {
+		retryAfter := u.retryAfter()
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":       "Service unavailable",
+			"service":     u.name,
+			"details":     "circuit breaker is " + u.breaker.State().String(),
+			"retry_after": retryAfter,
+		})
+		return nil, nil, false
+	}
+
+	status := http.StatusServiceUnavailable
+	if errors.Is(err, context.DeadlineExceeded) && c.Request.Context().Err() == nil {
+		status = http.StatusGatewayTimeout
+	}
+	logger.WithError(err).WithFields(logrus.Fields{
+		"service":  u.name,
+		"endpoint": req.URL.String(),
+	}).Error("Failed to proxy request")
+	c.JSON(status, gin.H{
+		"error":   "Service unavailable",
+		"service": u.name,
+		"details": err.Error(),
+	})
+	return nil, nil, false
+}
+
+// breakerStatus describes an upstream's breaker for the status endpoint
+func (u *upstream) breakerStatus() gin.H {
+	counts := u.breaker.Counts()
+	status := gin.H{
+		"state":           u.breaker.State().String(),
+		"requests":        counts.Requests,
+		"failures":        counts.TotalFailures,
+		"timeout_seconds": u.timeout.Seconds(),
+	}
+	if u.breaker.State() == gobreaker.StateOpen {
+		status["retry_after"] = u.retryAfter()
+	}
+	return status
+}
@@ -0,0 +1,180 @@
+// Package ratelimit limits how often each client may call the gateway,
+// using token buckets kept in Redis so limits hold across replicas
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/api-gateway/internal/middleware"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers set on rate limited routes
+const (
+	LimitHeader     = "X-RateLimit-Limit"
+	RemainingHeader = "X-RateLimit-Remaining"
+)
+
+// redisTimeout bounds a bucket update so a slow Redis can't stall requests
+const redisTimeout = 100 * time.Millisecond
+
+var (
+	throttled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_rate_limited_requests_total",
+		Help: "Requests rejected with 429 by the rate limiter",
+	}, []string{"group"})
+
+	limiterErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_rate_limit_errors_total",
+		Help: "Requests let through because the rate limiter couldn't reach Redis",
+	}, []string{"group"})
+)
+
+// tokenBucket takes a token from the bucket in KEYS[1], refilling it for the
+// time since it was last used. ARGV is the bucket size, the refill rate in
+// tokens per millisecond, the current time in milliseconds and the key's
+// TTL in milliseconds. It returns whether the request is allowed, the
+// tokens left and, if not allowed, the milliseconds until a token is free.
+var tokenBucket = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(now))
+redis.call("PEXPIRE", KEYS[1], ttl)
+return {allowed, math.floor(tokens), wait}
+`)
+
+// Limiter applies the configured limits per route group
+type Limiter struct {
+	client *redis.Client
+	cfg    config.RateLimitConfig
+	bypass map[string]bool
+	logger *logrus.Logger
+}
+
+// New creates a limiter. With a nil client or limits disabled, Limit
+// lets every request through.
+func New(client *redis.Client, cfg config.RateLimitConfig, logger *logrus.Logger) *Limiter {
+	bypass := make(map[string]bool, len(cfg.Bypass))
+	for _, subject := range cfg.Bypass {
+		bypass[subject] = true
+	}
+	return &Limiter{client: client, cfg: cfg, bypass: bypass, logger: logger}
+}
+
+// Subject identifies the client a request is limited as: the internal
+// service that called through the mesh, or else the client IP
+func Subject(c *gin.Context) string {
+	if identity := serviceIdentity(c.GetHeader("X-Forwarded-Client-Cert")); identity != "" {
+		return identity
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// serviceIdentity returns the spiffe:// URI of the peer in an Istio
+// X-Forwarded-Client-Cert header. The sidecar replaces the header on
+// inbound requests, so callers can't forge it. With several elements the
+// last one is the hop closest to the gateway.
+func serviceIdentity(xfcc string) string {
+	if xfcc == "" {
+		return ""
+	}
+	elements := strings.Split(xfcc, ",")
+	for _, field := range strings.Split(elements[len(elements)-1], ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if ok && strings.EqualFold(key, "URI") && strings.HasPrefix(value, "spiffe://") {
+			return value
+		}
+	}
+	return ""
+}
+
+// Limit rate limits a route group per client. Requests over the limit get
+// 429 with Retry-After. If Redis can't be reached the request is let
+// through: an outage of the limiter shouldn't take the gateway down.
+func (l *Limiter) Limit(group string) gin.HandlerFunc {
+	rule, ok := l.cfg.Rule(group)
+	if !l.cfg.Enabled || l.client == nil || !ok {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	burst := rule.Burst
+	if burst <= 0 {
+		burst = rule.Requests
+	}
+	period := time.Duration(rule.Period) * time.Second
+	rate := float64(rule.Requests) / float64(period.Milliseconds())
+	// A bucket left alone this long is full again, so it can be dropped
+	ttl := int64(math.Ceil(float64(burst)/rate)) + 1000
+
+	return func(c *gin.Context) {
+		subject := Subject(c)
+		if l.bypass[subject] {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), redisTimeout)
+		defer cancel()
+		res, err := tokenBucket.Run(ctx, l.client,
+			[]string{"ratelimit:" + group + ":" + subject},
+			burst, rate, time.Now().UnixMilli(), ttl,
+		).Int64Slice()
+		if err != nil || len(res) != 3 {
+			limiterErrors.WithLabelValues(group).Inc()
+			l.logger.WithError(err).WithField("group", group).Warn("Rate limiter unavailable, allowing request")
+			c.Next()
+			return
+		}
+
+		c.Header(LimitHeader, strconv.Itoa(burst))
+		c.Header(RemainingHeader, strconv.FormatInt(res[1], 10))
+		if res[0] == 1 {
+			c.Next()
+			return
+		}
+
+		retryAfter := int(math.Ceil(float64(res[2]) / 1000))
+		throttled.WithLabelValues(group).Inc()
+		l.logger.WithFields(logrus.Fields{
+			"group":       group,
+			"subject":     subject,
+			"request_id":  middleware.GetRequestID(c),
+			"retry_after": retryAfter,
+		}).Warn("Rate limit exceeded")
+
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		apierror.RespondError(c, apierror.New(apierror.CodeRateLimited, "rate limit exceeded").
+			WithDetails(gin.H{"group": group, "retry_after": retryAfter}))
+	}
+}
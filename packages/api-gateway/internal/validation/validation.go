@@ -0,0 +1,161 @@
+// Package validation rejects oversized and malformed request bodies at the
+// gateway, before they are proxied to a service
+package validation
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/api-gateway/internal/middleware"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Schemas of the request bodies routes can validate, named after their
+// files in schemas/
+const (
+	SchemaWorkflowGenerate = "workflow_generate"
+	SchemaLLMGenerate      = "llm_generate"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+var rejected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_rejected_bodies_total",
+	Help: "Request bodies rejected before proxying, by reason",
+}, []string{"group", "reason"})
+
+// FieldError is one schema violation, reported in the error details
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validator checks request bodies against the configured size limits and
+// the gateway's schemas
+type Validator struct {
+	cfg     config.RequestConfig
+	schemas map[string]*gojsonschema.Schema
+	logger  *logrus.Logger
+}
+
+// New compiles the embedded schemas
+func New(cfg config.RequestConfig, logger *logrus.Logger) (*Validator, error) {
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*gojsonschema.Schema, len(entries))
+	for _, entry := range entries {
+		data, err := schemaFiles.ReadFile("schemas/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema %s: %w", entry.Name(), err)
+		}
+		schemas[strings.TrimSuffix(entry.Name(), ".json")] = schema
+	}
+	return &Validator{cfg: cfg, schemas: schemas, logger: logger}, nil
+}
+
+// Body returns middleware that rejects bodies over the route group's limit
+// with 413 and, if schema is set and validation is enabled, bodies that
+// don't match it with 400. The body is buffered so handlers can read it as
+// usual.
+func (v *Validator) Body(group, schema string) gin.HandlerFunc {
+	limit := v.cfg.BodyLimit(group)
+	var compiled *gojsonschema.Schema
+	if schema != "" && v.cfg.ValidateSchemas {
+		var ok bool
+		if compiled, ok = v.schemas[schema]; !ok {
+			panic("validation: unknown schema " + schema)
+		}
+	}
+
+	return func(c *gin.Context) {
+		if limit > 0 && c.Request.ContentLength > limit {
+			v.tooLarge(c, group, limit)
+			return
+		}
+
+		reader := io.Reader(c.Request.Body)
+		if limit > 0 {
+			reader = io.LimitReader(c.Request.Body, limit+1)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			apierror.RespondError(c, apierror.Validation("failed to read request body"))
+			return
+		}
+		if limit > 0 && int64(len(body)) > limit {
+			v.tooLarge(c, group, limit)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+
+		if compiled == nil {
+			c.Next()
+			return
+		}
+		result, err := compiled.Validate(gojsonschema.NewBytesLoader(body))
+		if err != nil {
+			rejected.WithLabelValues(group, "invalid_json").Inc()
+			apierror.RespondError(c, apierror.Validation("request body is not valid JSON"))
+			return
+		}
+		if !result.Valid() {
+			fields := make([]FieldError, 0, len(result.Errors()))
+			for _, e := range result.Errors() {
+				fields = append(fields, FieldError{Field: errorField(e), Message: e.Description()})
+			}
+			rejected.WithLabelValues(group, "schema").Inc()
+			v.logger.WithFields(logrus.Fields{
+				"group":      group,
+				"schema":     schema,
+				"errors":     len(fields),
+				"request_id": middleware.GetRequestID(c),
+			}).Warn("Request body failed schema validation")
+			apierror.RespondError(c, apierror.Validation("request body does not match the "+schema+" schema").
+				WithDetails(gin.H{"errors": fields}))
+			return
+		}
+		c.Next()
+	}
+}
+
+// errorField names the field a schema error is about. Missing properties
+// are reported on their parent, so name the property itself instead.
+func errorField(e gojsonschema.ResultError) string {
+	field := e.Field()
+	if property, ok := e.Details()["property"].(string); ok && e.Type() == "required" {
+		if field == gojsonschema.STRING_CONTEXT_ROOT {
+			return property
+		}
+		return field + "." + property
+	}
+	return field
+}
+
+func (v *Validator) tooLarge(c *gin.Context, group string, limit int64) {
+	rejected.WithLabelValues(group, "too_large").Inc()
+	v.logger.WithFields(logrus.Fields{
+		"group":          group,
+		"content_length": c.Request.ContentLength,
+		"limit":          limit,
+		"request_id":     middleware.GetRequestID(c),
+	}).Warn("Request body too large")
+	apierror.RespondError(c, apierror.New(apierror.CodePayloadTooLarge, "request body too large").
+		WithDetails(gin.H{"max_bytes": limit}))
+}
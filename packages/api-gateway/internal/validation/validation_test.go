@@ -0,0 +1,174 @@
+package validation
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestRouter serves POST /generate and /llm behind the validator. The
+// handlers echo the body they received, so tests can check it was kept.
+func newTestRouter(t *testing.T, cfg config.RequestConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	v, err := New(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "application/json", body)
+	}
+	router := gin.New()
+	router.POST("/generate", v.Body("generate", SchemaWorkflowGenerate), echo)
+	router.POST("/llm", v.Body("llm", SchemaLLMGenerate), echo)
+	router.POST("/other", v.Body("default", ""), echo)
+	return router
+}
+
+func post(router *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) *apierror.Error {
+	t.Helper()
+	var resp apierror.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error == nil {
+		t.Fatalf("not an error response: %s", rec.Body)
+	}
+	return resp.Error
+}
+
+var testConfig = config.RequestConfig{
+	MaxBodyBytes:    1024,
+	Groups:          map[string]int64{"generate": 256},
+	ValidateSchemas: true,
+}
+
+const validGenerate = `{"prompt": "a REST API", "language": "go", "type": "api"}`
+
+func TestBodyPassesValidRequests(t *testing.T) {
+	router := newTestRouter(t, testConfig)
+
+	for path, body := range map[string]string{
+		"/generate": validGenerate,
+		"/llm":      `{"messages": [{"role": "user", "content": "hi"}], "max_tokens": 10}`,
+		"/other":    `not even JSON`,
+	} {
+		rec := post(router, path, body)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: code = %d, want 200: %s", path, rec.Code, rec.Body)
+		}
+		if rec.Body.String() != body {
+			t.Errorf("%s: handler got %q, want the original body", path, rec.Body)
+		}
+	}
+}
+
+func TestBodyRejectsOversizedBodies(t *testing.T) {
+	router := newTestRouter(t, testConfig)
+
+	tests := []struct {
+		path  string
+		size  int
+		limit float64
+	}{
+		{"/generate", 300, 256}, // the generate group's own limit
+		{"/other", 2000, 1024},  // the default limit
+		{"/llm", 1025, 1024},    // no group entry, so the default
+	}
+	for _, tt := range tests {
+		body := `{"prompt": "` + strings.Repeat("x", tt.size) + `"}`
+		rec := post(router, tt.path, body)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: code = %d, want 413", tt.path, rec.Code)
+			continue
+		}
+		apiErr := decodeError(t, rec)
+		details, _ := apiErr.Details.(map[string]interface{})
+		if apiErr.Code != apierror.CodePayloadTooLarge || details["max_bytes"] != tt.limit {
+			t.Errorf("%s: error = %+v, want payload_too_large with max_bytes %v", tt.path, apiErr, tt.limit)
+		}
+	}
+}
+
+func TestBodyRejectsOversizedChunkedBodies(t *testing.T) {
+	router := newTestRouter(t, testConfig)
+
+	// Without a Content-Length the limit is enforced while reading
+	req := httptest.NewRequest(http.MethodPost, "/other", io.MultiReader(strings.NewReader(strings.Repeat("x", 5000))))
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("code = %d, want 413", rec.Code)
+	}
+}
+
+func TestBodyRejectsSchemaInvalidBodies(t *testing.T) {
+	router := newTestRouter(t, testConfig)
+
+	tests := []struct {
+		name, path, body string
+		field            string
+	}{
+		{"missing language", "/generate", `{"prompt": "a REST API", "type": "api"}`, "language"},
+		{"wrong type", "/generate", `{"prompt": "x", "language": "go", "type": "api", "generate_tests": "yes"}`, "generate_tests"},
+		{"bad role", "/llm", `{"messages": [{"role": "robot", "content": "hi"}]}`, "messages.0.role"},
+		{"no messages or template", "/llm", `{"max_tokens": 10}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(router, tt.path, tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("code = %d, want 400: %s", rec.Code, rec.Body)
+			}
+			apiErr := decodeError(t, rec)
+			if apiErr.Code != apierror.CodeValidation {
+				t.Errorf("code = %s, want validation_error", apiErr.Code)
+			}
+			if tt.field != "" && !strings.Contains(rec.Body.String(), `"field":"`+tt.field+`"`) {
+				t.Errorf("errors don't name %s: %s", tt.field, rec.Body)
+			}
+		})
+	}
+}
+
+func TestBodyRejectsInvalidJSON(t *testing.T) {
+	router := newTestRouter(t, testConfig)
+
+	rec := post(router, "/generate", `{"prompt": `)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("code = %d, want 400", rec.Code)
+	}
+	if apiErr := decodeError(t, rec); apiErr.Message != "request body is not valid JSON" {
+		t.Errorf("message = %q", apiErr.Message)
+	}
+}
+
+func TestBodySchemaValidationCanBeDisabled(t *testing.T) {
+	cfg := testConfig
+	cfg.ValidateSchemas = false
+	router := newTestRouter(t, cfg)
+
+	if rec := post(router, "/generate", `{"prompt": 1}`); rec.Code != http.StatusOK {
+		t.Errorf("code = %d, want 200 with validation disabled", rec.Code)
+	}
+	if rec := post(router, "/generate", strings.Repeat("x", 300)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("code = %d, want the size limit to still apply", rec.Code)
+	}
+}
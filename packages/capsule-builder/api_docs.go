@@ -0,0 +1,634 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIEndpoint is a route registration found in a service's code
+type APIEndpoint struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler,omitempty"`
+}
+
+// DataModel is a model class or struct found in a service's code
+type DataModel struct {
+	Name   string       `json:"name"`
+	Kind   string       `json:"kind"` // pydantic, sqlalchemy, mongoose, sequelize, gorm, sql, bson
+	Fields []ModelField `json:"fields,omitempty"`
+}
+
+// ModelField is one field of a data model
+type ModelField struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// CodeDocs is what a service's code says about its API, as documented in
+// its README
+type CodeDocs struct {
+	Endpoints []APIEndpoint `json:"endpoints"`
+	Models    []DataModel   `json:"models"`
+}
+
+func (d CodeDocs) empty() bool {
+	return len(d.Endpoints) == 0 && len(d.Models) == 0
+}
+
+// extractCodeDocs finds the routes and models in code written in language.
+// Languages without an extractor document nothing.
+func extractCodeDocs(language, code string) CodeDocs {
+	var docs CodeDocs
+	switch strings.ToLower(language) {
+	case "python":
+		docs = CodeDocs{Endpoints: pythonEndpoints(code), Models: pythonModels(code)}
+	case "javascript", "typescript":
+		docs = CodeDocs{Endpoints: expressEndpoints(code), Models: nodeModels(code)}
+	case "go":
+		docs = goCodeDocs(code)
+	}
+	sort.SliceStable(docs.Endpoints, func(i, j int) bool { return docs.Endpoints[i].Path < docs.Endpoints[j].Path })
+	return docs
+}
+
+// joinRoute joins a router prefix and a route path
+func joinRoute(prefix, route string) string {
+	if prefix == "" {
+		return route
+	}
+	joined := path.Join(prefix, route)
+	if strings.HasSuffix(route, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+var (
+	pythonRouterPrefix = regexp.MustCompile(`(?m)^(\w+)\s*=\s*(?:fastapi\.)?APIRouter\(.*\bprefix\s*=\s*["']([^"']*)["']`)
+	pythonInclude      = regexp.MustCompile(`\.include_router\(\s*(\w+)[^)]*\bprefix\s*=\s*["']([^"']*)["']`)
+	pythonBlueprint    = regexp.MustCompile(`(?m)^(\w+)\s*=\s*Blueprint\(.*\burl_prefix\s*=\s*["']([^"']*)["']`)
+	pythonDecorator    = regexp.MustCompile(`^\s*@(\w+)\.(get|post|put|patch|delete|head|options|route|api_route)\(\s*["']([^"']*)["'](.*)$`)
+	pythonMethods      = regexp.MustCompile(`methods\s*=\s*[\[(]([^\])]*)[\])]`)
+	pythonDef          = regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`)
+	pythonClass        = regexp.MustCompile(`^class\s+(\w+)\s*\(([^)]*)\)\s*:`)
+	pythonAnnotated    = regexp.MustCompile(`^\s+(\w+)\s*:\s*([^=]+?)\s*(?:=.*)?$`)
+	pythonColumn       = regexp.MustCompile(`^\s+(\w+)\s*=\s*(?:\w+\.)?(?:Column|mapped_column)\(\s*(?:["'][^"']*["']\s*,\s*)?([\w.]+)?`)
+	pythonMapped       = regexp.MustCompile(`^Mapped\[(.+)\]$`)
+	pythonQuoted       = regexp.MustCompile(`["'](\w+)["']`)
+)
+
+// pythonEndpoints finds FastAPI and Flask route decorators, with the
+// prefixes their routers are declared or included with
+func pythonEndpoints(code string) []APIEndpoint {
+	prefixes := make(map[string]string)
+	for _, m := range pythonRouterPrefix.FindAllStringSubmatch(code, -1) {
+		prefixes[m[1]] = m[2]
+	}
+	for _, m := range pythonBlueprint.FindAllStringSubmatch(code, -1) {
+		prefixes[m[1]] = m[2]
+	}
+	for _, m := range pythonInclude.FindAllStringSubmatch(code, -1) {
+		prefixes[m[1]] = joinRoute(m[2], prefixes[m[1]])
+	}
+
+	var endpoints, pending []APIEndpoint
+	for _, line := range strings.Split(code, "\n") {
+		if m := pythonDecorator.FindStringSubmatch(line); m != nil {
+			methods := []string{strings.ToUpper(m[2])}
+			if m[2] == "route" || m[2] == "api_route" {
+				methods = []string{"GET"}
+				if list := pythonMethods.FindStringSubmatch(m[4]); list != nil {
+					methods = nil
+					for _, method := range pythonQuoted.FindAllStringSubmatch(list[1], -1) {
+						methods = append(methods, strings.ToUpper(method[1]))
+					}
+				}
+			}
+			for _, method := range methods {
+				pending = append(pending, APIEndpoint{Method: method, Path: joinRoute(prefixes[m[1]], m[3])})
+			}
+			continue
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		if m := pythonDef.FindStringSubmatch(line); m != nil {
+			for i := range pending {
+				pending[i].Handler = m[1]
+			}
+			endpoints = append(endpoints, pending...)
+			pending = nil
+		}
+	}
+	return endpoints
+}
+
+// pythonModelKind tells which kind of model a class with these bases is,
+// or "" for classes that aren't models
+func pythonModelKind(bases string) string {
+	for _, base := range strings.Split(bases, ",") {
+		switch strings.TrimSpace(base) {
+		case "BaseModel", "pydantic.BaseModel":
+			return "pydantic"
+		case "Base", "db.Model", "DeclarativeBase":
+			return "sqlalchemy"
+		}
+		if strings.HasPrefix(strings.TrimSpace(base), "table=True") {
+			return "sqlmodel"
+		}
+	}
+	return ""
+}
+
+// pythonModels finds pydantic and SQLAlchemy model classes and the fields
+// declared directly in their bodies
+func pythonModels(code string) []DataModel {
+	var models []DataModel
+	var current *DataModel
+	indent := ""
+	for _, line := range strings.Split(code, "\n") {
+		if m := pythonClass.FindStringSubmatch(line); m != nil {
+			current, indent = nil, ""
+			if kind := pythonModelKind(m[2]); kind != "" {
+				models = append(models, DataModel{Name: m[1], Kind: kind})
+				current = &models[len(models)-1]
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if current == nil || trimmed == "" {
+			continue
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		switch {
+		case lineIndent == "":
+			current = nil
+			continue
+		case indent == "":
+			indent = lineIndent
+		case lineIndent != indent:
+			// Method bodies and nested classes
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "__") {
+			continue
+		}
+		if m := pythonColumn.FindStringSubmatch(line); m != nil {
+			current.Fields = append(current.Fields, ModelField{Name: m[1], Type: m[2]})
+			continue
+		}
+		if m := pythonAnnotated.FindStringSubmatch(line); m != nil && !strings.HasPrefix(m[1], "_") {
+			fieldType := strings.TrimSpace(m[2])
+			if mapped := pythonMapped.FindStringSubmatch(fieldType); mapped != nil {
+				fieldType = mapped[1]
+			}
+			current.Fields = append(current.Fields, ModelField{Name: m[1], Type: fieldType})
+		}
+	}
+	return models
+}
+
+var (
+	expressRoute   = regexp.MustCompile(`\b(\w+)\.(get|post|put|patch|delete|all|options|head)\(\s*['"` + "`" + `](/[^'"` + "`" + `]*|\*)['"` + "`" + `]`)
+	expressChain   = regexp.MustCompile(`\b(\w+)\.route\(\s*['"` + "`" + `](/[^'"` + "`" + `]*)['"` + "`" + `]\s*\)`)
+	expressChained = regexp.MustCompile(`^\s*\.(get|post|put|patch|delete|all)\(`)
+	expressMount   = regexp.MustCompile(`\b\w+\.use\(\s*['"` + "`" + `](/[^'"` + "`" + `]*)['"` + "`" + `]\s*,\s*(?:[\w.]+\s*,\s*)*(\w+)\s*\)`)
+	expressHandler = regexp.MustCompile(`,\s*([\w.]+)\s*\)\s*;?\s*$`)
+	mongooseModel  = regexp.MustCompile(`\b(?:mongoose\.)?model\(\s*['"](\w+)['"]\s*,\s*(\w+)`)
+	mongooseSchema = regexp.MustCompile(`\b(\w+)\s*=\s*new\s+(?:mongoose\.)?Schema\(\s*\{`)
+	sequelizeModel = regexp.MustCompile(`\.define\(\s*['"](\w+)['"]\s*,\s*\{`)
+	sequelizeInit  = regexp.MustCompile(`\b(\w+)\.init\(\s*\{`)
+	jsFieldType    = regexp.MustCompile(`^\{[^{}]*\btype\s*:\s*([\w.\[\]]+)`)
+	jsIdentifier   = regexp.MustCompile(`^[\w.]+$`)
+)
+
+// expressEndpoints finds Express route registrations, including routers
+// mounted under a prefix with app.use
+func expressEndpoints(code string) []APIEndpoint {
+	prefixes := make(map[string]string)
+	for _, m := range expressMount.FindAllStringSubmatch(code, -1) {
+		prefixes[m[2]] = m[1]
+	}
+
+	var endpoints []APIEndpoint
+	for _, m := range expressRoute.FindAllStringSubmatchIndex(code, -1) {
+		receiver, method, route := code[m[2]:m[3]], code[m[4]:m[5]], code[m[6]:m[7]]
+		endpoint := APIEndpoint{Method: strings.ToUpper(method), Path: joinRoute(prefixes[receiver], route)}
+		if endpoint.Method == "ALL" {
+			endpoint.Method = "ANY"
+		}
+		// A handler passed by name on the same line is documented
+		rest := code[m[1]:]
+		if end := strings.IndexByte(rest, '\n'); end >= 0 {
+			rest = rest[:end]
+		}
+		if h := expressHandler.FindStringSubmatch(rest); h != nil {
+			endpoint.Handler = h[1]
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	// router.route('/items').get(list).post(create)
+	for _, m := range expressChain.FindAllStringSubmatchIndex(code, -1) {
+		receiver, route := code[m[2]:m[3]], code[m[4]:m[5]]
+		rest := code[m[1]:]
+		for {
+			c := expressChained.FindStringSubmatchIndex(rest)
+			if c == nil {
+				break
+			}
+			args, end := balanced(rest, c[1]-1, '(', ')')
+			if end < 0 {
+				break
+			}
+			endpoint := APIEndpoint{Method: strings.ToUpper(rest[c[2]:c[3]]), Path: joinRoute(prefixes[receiver], route)}
+			if last := lastArgument(args); jsIdentifier.MatchString(last) {
+				endpoint.Handler = last
+			}
+			endpoints = append(endpoints, endpoint)
+			rest = rest[end+1:]
+		}
+	}
+	return endpoints
+}
+
+// balanced returns the text between the bracket at open and its match, and
+// the index of the match, or -1 if it isn't closed
+func balanced(s string, open int, left, right byte) (string, int) {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == left:
+			depth++
+		case c == right:
+			depth--
+			if depth == 0 {
+				return s[open+1 : i], i
+			}
+		}
+	}
+	return "", -1
+}
+
+// splitTopLevel splits s at commas outside brackets and strings
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '{' || c == '[' || c == '(':
+			depth++
+		case c == '}' || c == ']' || c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func lastArgument(args string) string {
+	parts := splitTopLevel(args)
+	return strings.TrimSpace(parts[len(parts)-1])
+}
+
+// objectFields reads the keys of a JS object literal's body and the types
+// their values declare
+func objectFields(body string) []ModelField {
+	var fields []ModelField
+	for _, part := range splitTopLevel(body) {
+		key, value, found := strings.Cut(part, ":")
+		key = strings.Trim(strings.TrimSpace(key), `'"`)
+		if !found || !jsIdentifier.MatchString(key) {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		field := ModelField{Name: key}
+		switch {
+		case jsIdentifier.MatchString(value):
+			field.Type = value
+		case strings.HasPrefix(value, "["):
+			field.Type = "Array"
+		case jsFieldType.MatchString(value):
+			field.Type = jsFieldType.FindStringSubmatch(value)[1]
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// nodeModels finds mongoose and Sequelize models
+func nodeModels(code string) []DataModel {
+	schemas := make(map[string][]ModelField)
+	for _, m := range mongooseSchema.FindAllStringSubmatchIndex(code, -1) {
+		if body, end := balanced(code, m[1]-1, '{', '}'); end >= 0 {
+			schemas[code[m[2]:m[3]]] = objectFields(body)
+		}
+	}
+
+	var models []DataModel
+	for _, m := range mongooseModel.FindAllStringSubmatch(code, -1) {
+		if fields, ok := schemas[m[2]]; ok {
+			models = append(models, DataModel{Name: m[1], Kind: "mongoose", Fields: fields})
+		}
+	}
+	for _, m := range sequelizeModel.FindAllStringSubmatchIndex(code, -1) {
+		if body, end := balanced(code, m[1]-1, '{', '}'); end >= 0 {
+			models = append(models, DataModel{Name: code[m[2]:m[3]], Kind: "sequelize", Fields: objectFields(body)})
+		}
+	}
+	for _, m := range sequelizeInit.FindAllStringSubmatchIndex(code, -1) {
+		name := code[m[2]:m[3]]
+		if !strings.Contains(code, "class "+name+" extends Model") {
+			continue
+		}
+		if body, end := balanced(code, m[1]-1, '{', '}'); end >= 0 {
+			models = append(models, DataModel{Name: name, Kind: "sequelize", Fields: objectFields(body)})
+		}
+	}
+	return models
+}
+
+// goRouteMethods maps gin, echo and chi router methods to HTTP methods
+var goRouteMethods = map[string]string{
+	"GET": "GET", "POST": "POST", "PUT": "PUT", "PATCH": "PATCH", "DELETE": "DELETE",
+	"HEAD": "HEAD", "OPTIONS": "OPTIONS", "Any": "ANY",
+	"Get": "GET", "Post": "POST", "Put": "PUT", "Patch": "PATCH", "Delete": "DELETE",
+}
+
+// goRoutePattern is the fallback for Go code that doesn't parse
+var goRoutePattern = regexp.MustCompile(`\b\w+\.(GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS|Any)\(\s*"([^"]*)"(?:\s*,\s*([\w.]+)\s*\))?`)
+
+// goCodeDocs reads gin-style route registrations, following Group
+// prefixes, and structs tagged for a database. Code that doesn't parse
+// falls back to matching routes textually.
+func goCodeDocs(code string) CodeDocs {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", code, 0)
+	if err != nil {
+		var docs CodeDocs
+		for _, m := range goRoutePattern.FindAllStringSubmatch(code, -1) {
+			docs.Endpoints = append(docs.Endpoints, APIEndpoint{Method: goRouteMethods[m[1]], Path: m[2], Handler: m[3]})
+		}
+		return docs
+	}
+
+	var docs CodeDocs
+	prefixes := make(map[string]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			// v1 := r.Group("/api/v1")
+			if len(n.Lhs) != 1 || len(n.Rhs) != 1 {
+				return true
+			}
+			name, ok := n.Lhs[0].(*ast.Ident)
+			receiver, method, args := goCall(n.Rhs[0])
+			if ok && method == "Group" && len(args) > 0 {
+				if prefix, ok := goString(args[0]); ok {
+					prefixes[name.Name] = joinRoute(prefixes[receiver], prefix)
+				}
+			}
+		case *ast.CallExpr:
+			if endpoint, ok := goEndpoint(n, prefixes); ok {
+				docs.Endpoints = append(docs.Endpoints, endpoint)
+			}
+		case *ast.TypeSpec:
+			if model, ok := goModel(n); ok {
+				docs.Models = append(docs.Models, model)
+			}
+		}
+		return true
+	})
+	return docs
+}
+
+// goCall splits receiver.Method(args...) into its parts
+func goCall(expr ast.Expr) (receiver, method string, args []ast.Expr) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return "", "", nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", "", nil
+	}
+	if ident, ok := sel.X.(*ast.Ident); ok {
+		receiver = ident.Name
+	}
+	return receiver, sel.Sel.Name, call.Args
+}
+
+func goString(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// goEndpoint reads r.GET("/path", handler), r.Handle("GET", "/path", h)
+// and mux.HandleFunc("/path", h)
+func goEndpoint(call *ast.CallExpr, prefixes map[string]string) (APIEndpoint, bool) {
+	receiver, method, args := goCall(call)
+	var endpoint APIEndpoint
+	var pathArg int
+	switch {
+	case goRouteMethods[method] != "" && len(args) >= 2:
+		endpoint.Method = goRouteMethods[method]
+	case method == "Handle" && len(args) >= 3:
+		m, ok := goString(args[0])
+		if !ok {
+			return endpoint, false
+		}
+		endpoint.Method, pathArg = strings.ToUpper(m), 1
+	case method == "HandleFunc" && len(args) == 2:
+		endpoint.Method = "ANY"
+	default:
+		return endpoint, false
+	}
+	route, ok := goString(args[pathArg])
+	if !ok || !strings.HasPrefix(route, "/") {
+		return endpoint, false
+	}
+	endpoint.Path = joinRoute(prefixes[receiver], route)
+	switch handler := args[len(args)-1].(type) {
+	case *ast.Ident, *ast.SelectorExpr:
+		endpoint.Handler = types.ExprString(handler)
+	}
+	return endpoint, true
+}
+
+// goModel reads a struct whose fields are tagged for gorm, sqlx or the
+// mongo driver, or that embeds gorm.Model
+func goModel(spec *ast.TypeSpec) (DataModel, bool) {
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return DataModel{}, false
+	}
+	model := DataModel{Name: spec.Name.Name}
+	for _, field := range st.Fields.List {
+		fieldType := types.ExprString(field.Type)
+		if len(field.Names) == 0 {
+			if fieldType == "gorm.Model" {
+				model.Kind = "gorm"
+				model.Fields = append(model.Fields, ModelField{Name: "ID", Type: "uint"},
+					ModelField{Name: "CreatedAt", Type: "time.Time"}, ModelField{Name: "UpdatedAt", Type: "time.Time"},
+					ModelField{Name: "DeletedAt", Type: "gorm.DeletedAt"})
+			}
+			continue
+		}
+		if field.Tag != nil && model.Kind == "" {
+			switch tag := field.Tag.Value; {
+			case strings.Contains(tag, `gorm:"`):
+				model.Kind = "gorm"
+			case strings.Contains(tag, `db:"`):
+				model.Kind = "sql"
+			case strings.Contains(tag, `bson:"`):
+				model.Kind = "bson"
+			}
+		}
+		for _, name := range field.Names {
+			if name.IsExported() {
+				model.Fields = append(model.Fields, ModelField{Name: name.Name, Type: fieldType})
+			}
+		}
+	}
+	return model, model.Kind != ""
+}
+
+// markdownCell escapes a value for a markdown table cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// renderCodeDocs renders the API Endpoints and Data Models sections
+func renderCodeDocs(docs CodeDocs) string {
+	var b strings.Builder
+	if len(docs.Endpoints) > 0 {
+		b.WriteString("## API Endpoints\n\n| Method | Path | Handler |\n| --- | --- | --- |\n")
+		for _, e := range docs.Endpoints {
+			handler := "-"
+			if e.Handler != "" {
+				handler = "`" + markdownCell(e.Handler) + "`"
+			}
+			fmt.Fprintf(&b, "| %s | `%s` | %s |\n", e.Method, markdownCell(e.Path), handler)
+		}
+		b.WriteString("\n")
+	}
+	if len(docs.Models) > 0 {
+		b.WriteString("## Data Models\n\n")
+		for _, m := range docs.Models {
+			fmt.Fprintf(&b, "### %s\n\n_%s model_\n\n", m.Name, m.Kind)
+			if len(m.Fields) == 0 {
+				continue
+			}
+			b.WriteString("| Field | Type |\n| --- | --- |\n")
+			for _, f := range m.Fields {
+				fieldType := "-"
+				if f.Type != "" {
+					fieldType = "`" + markdownCell(f.Type) + "`"
+				}
+				fmt.Fprintf(&b, "| `%s` | %s |\n", markdownCell(f.Name), fieldType)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// insertReadmeSection puts section before the README's License section,
+// or at its end if it has none
+func insertReadmeSection(readme, section string) string {
+	if i := strings.Index(readme, "\n## License"); i >= 0 {
+		return readme[:i+1] + section + readme[i+1:]
+	}
+	return strings.TrimRight(readme, "\n") + "\n\n" + strings.TrimRight(section, "\n") + "\n"
+}
+
+// withCodeDocs documents the endpoints and models found in a service's
+// code in its README. With nothing detected the README is left as the
+// template wrote it.
+func withCodeDocs(readme string, docs CodeDocs) string {
+	if docs.empty() {
+		return readme
+	}
+	return insertReadmeSection(readme, renderCodeDocs(docs))
+}
+
+// ReadmeEnrichment previews what a build will document in its READMEs
+type ReadmeEnrichment struct {
+	Enriched  bool `json:"enriched"`
+	Endpoints int  `json:"endpoints"`
+	Models    int  `json:"models"`
+	// Services tells, for multi-service capsules, which services' READMEs
+	// are enriched
+	Services map[string]bool `json:"services,omitempty"`
+}
+
+func readmeEnrichment(req BuildRequest) ReadmeEnrichment {
+	if len(req.Services) == 0 {
+		docs := extractCodeDocs(req.Language, req.Code)
+		return ReadmeEnrichment{Enriched: !docs.empty(), Endpoints: len(docs.Endpoints), Models: len(docs.Models)}
+	}
+	enrichment := ReadmeEnrichment{Services: make(map[string]bool, len(req.Services))}
+	for _, svc := range req.Services {
+		docs := extractCodeDocs(svc.Language, svc.Code)
+		enrichment.Services[svc.Name] = !docs.empty()
+		enrichment.Enriched = enrichment.Enriched || !docs.empty()
+		enrichment.Endpoints += len(docs.Endpoints)
+		enrichment.Models += len(docs.Models)
+	}
+	return enrichment
+}
+
+// readmeFooter records where a capsule's README came from
+func readmeFooter(workflowID string, generatedAt time.Time) string {
+	return fmt.Sprintf("\n---\n\n_Generated by QuantumLayer from workflow `%s` on %s._\n",
+		workflowID, generatedAt.UTC().Format(time.RFC3339))
+}
+
+// stampReadmes adds the traceability footer to every README in a capsule
+func stampReadmes(capsule *StructuredCapsule) {
+	footer := readmeFooter(capsule.WorkflowID, capsule.CreatedAt)
+	for filePath, file := range capsule.Structure {
+		if path.Base(filePath) != "README.md" {
+			continue
+		}
+		file.Content = strings.TrimRight(file.Content, "\n") + "\n" + footer
+		capsule.Size += int64(len(file.Content) - len(capsule.Structure[filePath].Content))
+		capsule.Structure[filePath] = file
+	}
+}
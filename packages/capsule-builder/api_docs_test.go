@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routes summarizes endpoints as "METHOD path handler" for comparison
+func routes(endpoints []APIEndpoint) []string {
+	summary := make([]string, 0, len(endpoints))
+	for _, e := range endpoints {
+		summary = append(summary, strings.TrimSpace(e.Method+" "+e.Path+" "+e.Handler))
+	}
+	return summary
+}
+
+// fields summarizes a model as "Kind Name: field type, ..."
+func fields(m DataModel) string {
+	parts := make([]string, 0, len(m.Fields))
+	for _, f := range m.Fields {
+		parts = append(parts, strings.TrimSpace(f.Name+" "+f.Type))
+	}
+	return m.Kind + " " + m.Name + ": " + strings.Join(parts, ", ")
+}
+
+func assertRoutes(t *testing.T, got []APIEndpoint, want []string) {
+	t.Helper()
+	summary := routes(got)
+	if strings.Join(summary, "\n") != strings.Join(want, "\n") {
+		t.Errorf("endpoints =\n%s\nwant\n%s", strings.Join(summary, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func assertModels(t *testing.T, got []DataModel, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("models = %+v, want %v", got, want)
+	}
+	for i := range want {
+		if fields(got[i]) != want[i] {
+			t.Errorf("model %d = %q, want %q", i, fields(got[i]), want[i])
+		}
+	}
+}
+
+func TestPythonCodeDocs(t *testing.T) {
+	code := `from fastapi import APIRouter, FastAPI
+from pydantic import BaseModel
+from sqlalchemy import Column, Integer, String
+from sqlalchemy.orm import Mapped, mapped_column
+
+app = FastAPI()
+router = APIRouter(prefix="/items")
+
+class Item(BaseModel):
+    name: str
+    price: float = 0.0
+
+    def label(self) -> str:
+        total: int = 1
+        return self.name
+
+class Order(Base):
+    __tablename__ = "orders"
+    id = Column(Integer, primary_key=True)
+    customer: Mapped[str] = mapped_column(String(80))
+
+@router.get("/{item_id}")
+async def read_item(item_id: int):
+    return {}
+
+@router.post("/")
+def create_item(item: Item):
+    return item
+
+@app.get("/health")
+def health():
+    return {"status": "ok"}
+
+app.include_router(router)
+`
+	docs := extractCodeDocs("python", code)
+	assertRoutes(t, docs.Endpoints, []string{
+		"GET /health health",
+		"POST /items/ create_item",
+		"GET /items/{item_id} read_item",
+	})
+	assertModels(t, docs.Models, []string{
+		"pydantic Item: name str, price float",
+		"sqlalchemy Order: id Integer, customer str",
+	})
+
+	flask := `bp = Blueprint("users", __name__, url_prefix="/users")
+
+@bp.route("/<int:id>", methods=["GET", "DELETE"])
+def user(id):
+    pass
+`
+	assertRoutes(t, extractCodeDocs("python", flask).Endpoints, []string{
+		"GET /users/<int:id> user",
+		"DELETE /users/<int:id> user",
+	})
+}
+
+func TestNodeCodeDocs(t *testing.T) {
+	code := `const express = require('express');
+const mongoose = require('mongoose');
+const app = express();
+const router = express.Router();
+
+const userSchema = new mongoose.Schema({
+  email: { type: String, required: true },
+  age: Number,
+});
+const User = mongoose.model('User', userSchema);
+
+const Post = sequelize.define('Post', {
+  title: DataTypes.STRING,
+  body: { type: DataTypes.TEXT },
+});
+
+router.get('/', listUsers);
+router.post('/', authenticate, createUser);
+router.route('/:id').get(getUser).delete(deleteUser);
+
+app.use('/api/users', router);
+app.get('/health', (req, res) => res.json({ ok: true }));
+`
+	docs := extractCodeDocs("javascript", code)
+	assertRoutes(t, docs.Endpoints, []string{
+		"GET /api/users/ listUsers",
+		"POST /api/users/ createUser",
+		"GET /api/users/:id getUser",
+		"DELETE /api/users/:id deleteUser",
+		"GET /health",
+	})
+	assertModels(t, docs.Models, []string{
+		"mongoose User: email String, age Number",
+		"sequelize Post: title DataTypes.STRING, body DataTypes.TEXT",
+	})
+}
+
+func TestGoCodeDocs(t *testing.T) {
+	code := "package main\n\n" +
+		"import (\n\t\"github.com/gin-gonic/gin\"\n\t\"gorm.io/gorm\"\n)\n\n" +
+		"type Product struct {\n\tgorm.Model\n\tName  string\n\tPrice float64\n}\n\n" +
+		"type Review struct {\n\tID     uint   `db:\"id\"`\n\tRating int    `db:\"rating\"`\n\tnote   string\n}\n\n" +
+		"type config struct{ Port string }\n\n" +
+		"func main() {\n\tr := gin.Default()\n\tr.GET(\"/health\", health)\n" +
+		"\tv1 := r.Group(\"/api/v1\")\n\tv1.GET(\"/products\", h.ListProducts)\n\tv1.POST(\"/products\", h.CreateProduct)\n" +
+		"\thttp.HandleFunc(\"/metrics\", metrics)\n}\n"
+
+	docs := extractCodeDocs("go", code)
+	assertRoutes(t, docs.Endpoints, []string{
+		"GET /api/v1/products h.ListProducts",
+		"POST /api/v1/products h.CreateProduct",
+		"GET /health health",
+		"ANY /metrics metrics",
+	})
+	assertModels(t, docs.Models, []string{
+		"gorm Product: ID uint, CreatedAt time.Time, UpdatedAt time.Time, DeletedAt gorm.DeletedAt, Name string, Price float64",
+		"sql Review: ID uint, Rating int",
+	})
+
+	// Code that doesn't parse still has its routes found
+	broken := "func main() {\n\tr.GET(\"/ping\", ping)\n"
+	assertRoutes(t, extractCodeDocs("go", broken).Endpoints, []string{"GET /ping ping"})
+}
+
+func TestReadmeEnrichment(t *testing.T) {
+	req := BuildRequest{
+		WorkflowID: "wf-docs",
+		Language:   "python",
+		Framework:  "fastapi",
+		Type:       "api",
+		Name:       "items",
+		Code:       "@app.get(\"/items\")\ndef list_items():\n    return []\n",
+	}
+	capsule := buildStructuredCapsule("capsule-1", req)
+	readme := capsule.Structure["README.md"].Content
+	if !strings.Contains(readme, "## API Endpoints") || !strings.Contains(readme, "| GET | `/items` | `list_items` |") {
+		t.Errorf("README doesn't document the endpoint:\n%s", readme)
+	}
+	if strings.Contains(readme, "## License") && strings.Index(readme, "## API Endpoints") > strings.Index(readme, "## License") {
+		t.Errorf("endpoints documented after the License section:\n%s", readme)
+	}
+	footer := readmeFooter("wf-docs", capsule.CreatedAt)
+	if !strings.HasSuffix(readme, footer) || !strings.Contains(footer, capsule.CreatedAt.UTC().Format(time.RFC3339)) {
+		t.Errorf("README doesn't end with the footer %q:\n%s", footer, readme)
+	}
+
+	var size int64
+	for _, file := range capsule.Structure {
+		size += int64(len(file.Content))
+	}
+	if capsule.Size != size {
+		t.Errorf("capsule size = %d, want %d", capsule.Size, size)
+	}
+
+	// Code with nothing to document keeps the template README
+	req.Code = "print('hello')\n"
+	readme = buildStructuredCapsule("capsule-2", req).Structure["README.md"].Content
+	if strings.Contains(readme, "## API Endpoints") || strings.Contains(readme, "## Data Models") {
+		t.Errorf("README documents undetected code:\n%s", readme)
+	}
+	if !strings.Contains(readme, "workflow `wf-docs`") {
+		t.Errorf("README has no footer:\n%s", readme)
+	}
+}
+
+func TestPreviewShowsReadmeEnrichment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/preview", handlePreviewStructure)
+	body := `{"workflow_id": "wf-1", "language": "javascript", "type": "api", "name": "svc",
+		"code": "app.get('/users', listUsers);\napp.post('/users', createUser);"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/preview", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response struct {
+		ReadmeEnrichment ReadmeEnrichment `json:"readme_enrichment"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if got := response.ReadmeEnrichment; !got.Enriched || got.Endpoints != 2 || got.Models != 0 {
+		t.Errorf("readme_enrichment = %+v, want 2 endpoints", got)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// compose is the part of a compose file the tests look at
+type compose struct {
+	Services map[string]struct {
+		Build       string                       `yaml:"build"`
+		Image       string                       `yaml:"image"`
+		Environment []string                     `yaml:"environment"`
+		DependsOn   map[string]map[string]string `yaml:"depends_on"`
+		Healthcheck struct {
+			Test []string `yaml:"test"`
+		} `yaml:"healthcheck"`
+		Volumes  []string `yaml:"volumes"`
+		Networks []string `yaml:"networks"`
+	} `yaml:"services"`
+	Networks map[string]interface{} `yaml:"networks"`
+	Volumes  map[string]interface{} `yaml:"volumes"`
+}
+
+func parseCompose(t *testing.T, structure map[string]FileContent) compose {
+	t.Helper()
+	file, ok := structure["docker-compose.yml"]
+	if !ok {
+		t.Fatal("no docker-compose.yml")
+	}
+	var c compose
+	if err := yaml.Unmarshal([]byte(file.Content), &c); err != nil {
+		t.Fatalf("docker-compose.yml doesn't parse: %v\n%s", err, file.Content)
+	}
+	return c
+}
+
+// envExample reads the assigned variables of a .env.example
+func envExample(content string) map[string]string {
+	env := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		if name, value, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(line, "#") {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+func TestBackingServicesCompose(t *testing.T) {
+	capsule := buildStructuredCapsule("capsule-1", BuildRequest{
+		Language:        "python",
+		Framework:       "fastapi",
+		Type:            "api",
+		Name:            "svc",
+		Code:            "from fastapi import FastAPI\napp = FastAPI()",
+		BackingServices: []string{"postgres", "redis"},
+	})
+	c := parseCompose(t, capsule.Structure)
+
+	app := c.Services["app"]
+	if app.Build != "." {
+		t.Errorf("app build = %q, want the capsule's Dockerfile", app.Build)
+	}
+	for _, name := range []string{"postgres", "redis"} {
+		svc := c.Services[name]
+		if svc.Image != backingServiceCatalog[name].Image || len(svc.Healthcheck.Test) == 0 {
+			t.Errorf("%s = %+v, want its image with a healthcheck", name, svc)
+		}
+		if app.DependsOn[name]["condition"] != "service_healthy" {
+			t.Errorf("app waits on %s with %v, want service_healthy", name, app.DependsOn[name])
+		}
+		if len(svc.Volumes) != 1 || !strings.HasPrefix(svc.Volumes[0], name+"-data:") || !hasKey(c.Volumes, name+"-data") {
+			t.Errorf("%s volumes = %v, want a declared named volume", name, svc.Volumes)
+		}
+		if len(svc.Networks) != 1 || svc.Networks[0] != composeNetwork {
+			t.Errorf("%s networks = %v, want %s", name, svc.Networks, composeNetwork)
+		}
+	}
+	if len(app.Networks) != 1 || !hasKey(c.Networks, composeNetwork) {
+		t.Errorf("app networks = %v, declared %v, want the shared network", app.Networks, c.Networks)
+	}
+
+	// Everything the app is given to reach a service is in .env.example
+	example := envExample(capsule.Structure[".env.example"].Content)
+	for _, v := range app.Environment {
+		name, value, _ := strings.Cut(v, "=")
+		if name != "PORT" && example[name] != value {
+			t.Errorf(".env.example %s = %q, compose sets %q", name, example[name], value)
+		}
+	}
+	if example["DATABASE_URL"] == "" || example["REDIS_URL"] == "" {
+		t.Errorf(".env.example = %v, want the service URLs", example)
+	}
+
+	if capsule.Metadata.StartCommand != "docker compose up" {
+		t.Errorf("start command = %q, want docker compose up", capsule.Metadata.StartCommand)
+	}
+}
+
+func hasKey(m map[string]interface{}, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func TestNoBackingServices(t *testing.T) {
+	req := BuildRequest{Language: "python", Type: "api", Name: "svc", Code: "print('hi')"}
+	capsule := buildStructuredCapsule("capsule-1", req)
+	if _, ok := capsule.Structure["docker-compose.yml"]; ok {
+		t.Error("docker-compose.yml written without backing services")
+	}
+	if capsule.Metadata.StartCommand == "docker compose up" {
+		t.Error("start command uses compose without backing services")
+	}
+	if url, ok := envExample(capsule.Structure[".env.example"].Content)["DATABASE_URL"]; !ok || url != "" {
+		t.Errorf(".env.example DATABASE_URL = %q, want an empty placeholder", url)
+	}
+}
+
+func TestMultiServiceBackingServices(t *testing.T) {
+	capsule := buildStructuredCapsule("capsule-1", BuildRequest{
+		Name: "shop",
+		Services: []ServiceSpec{
+			{Name: "api", Language: "go", Type: "api", Code: "package main\n\nfunc main() {}"},
+			{Name: "worker", Language: "python", Type: "cli", Code: "print('hi')"},
+		},
+		BackingServices: []string{"mongodb"},
+	})
+	c := parseCompose(t, capsule.Structure)
+
+	if c.Services["api"].DependsOn["mongodb"]["condition"] != "service_healthy" {
+		t.Errorf("api depends_on = %v, want mongodb healthy", c.Services["api"].DependsOn)
+	}
+	if c.Services["mongodb"].Image == "" || !hasKey(c.Volumes, "mongodb-data") {
+		t.Errorf("mongodb = %+v, volumes %v, want the service with its volume", c.Services["mongodb"], c.Volumes)
+	}
+	if _, ok := capsule.Structure["services/api/docker-compose.yml"]; ok {
+		t.Error("service got its own compose file")
+	}
+	if example := envExample(capsule.Structure["services/api/.env.example"].Content); example["MONGODB_URL"] == "" {
+		t.Errorf("api .env.example = %v, want MONGODB_URL", example)
+	}
+}
+
+func TestValidateBackingServices(t *testing.T) {
+	tests := []struct {
+		names []string
+		err   string
+	}{
+		{[]string{"postgres", "redis", "rabbitmq"}, ""},
+		{[]string{"cassandra"}, "unsupported backing service"},
+		{[]string{"redis", "redis"}, "duplicate"},
+		{[]string{"postgres", "mysql"}, "both set DATABASE_URL"},
+	}
+	for _, tt := range tests {
+		err := validateBackingServices(tt.names)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("validateBackingServices(%v) = %v, want %q", tt.names, err, tt.err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/build", handleBuildCapsule)
+	body := `{"workflow_id": "wf-1", "language": "go", "type": "api", "name": "svc", "code": "package main", "backing_services": ["cassandra"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/build", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown backing service = %d, want 400", w.Code)
+	}
+}
+
+func TestPreviewIncludesCompose(t *testing.T) {
+	req := BuildRequest{Language: "go", Type: "api", Name: "svc", Code: "package main", BackingServices: []string{"redis"}}
+	structure := make(map[string]FileContent)
+	for _, file := range previewFiles(req) {
+		structure[file.Path] = FileContent{Path: file.Path, Content: file.content}
+	}
+	if c := parseCompose(t, structure); c.Services["redis"].Image == "" {
+		t.Errorf("preview compose = %+v, want redis", c)
+	}
+}
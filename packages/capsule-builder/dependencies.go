@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ecosystemPyPI = "pypi"
+	ecosystemNPM  = "npm"
+	ecosystemGo   = "go"
+
+	registryTimeout = 5 * time.Second
+
+	// How long a resolved latest version is reused, and how long a failed
+	// lookup falls back to the snapshot before the registry is tried again
+	versionCacheTTL   = time.Hour
+	versionFailureTTL = 5 * time.Minute
+
+	maxNPMPackageName = 214
+)
+
+var (
+	pythonNamePattern   = regexp.MustCompile(`^([A-Za-z0-9](?:[A-Za-z0-9._-]*[A-Za-z0-9])?)\s*(\[[A-Za-z0-9._,\s-]*\])?\s*(.*)$`)
+	pythonClausePattern = regexp.MustCompile(`^(===|==|!=|<=|>=|~=|<|>)\s*[A-Za-z0-9.*+!_-]+$`)
+	pythonNormalize     = regexp.MustCompile(`[-_.]+`)
+
+	npmNamePattern    = regexp.MustCompile(`^(?:@[a-z0-9-~][a-z0-9-._~]*/)?[a-z0-9-~][a-z0-9-._~]*$`)
+	npmVersionPattern = regexp.MustCompile(`^[0-9A-Za-z.*^~<>=|+ -]+$`)
+
+	goPathPattern    = regexp.MustCompile(`^[a-z0-9-]+(?:\.[a-z0-9-]+)+(?:/[A-Za-z0-9._~+-]+)+$`)
+	goVersionPattern = regexp.MustCompile(`^v\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?$`)
+)
+
+// knownGoodVersions pins common packages when their registry can't be
+// reached, so an offline build still produces a reproducible manifest
+var knownGoodVersions = map[string]map[string]string{
+	ecosystemPyPI: {
+		"django":     "5.0.3",
+		"fastapi":    "0.110.0",
+		"flask":      "3.0.2",
+		"httpx":      "0.27.0",
+		"pydantic":   "2.6.4",
+		"pytest":     "8.1.1",
+		"requests":   "2.31.0",
+		"sqlalchemy": "2.0.29",
+		"uvicorn":    "0.29.0",
+	},
+	ecosystemNPM: {
+		"axios":     "1.6.8",
+		"cors":      "2.8.5",
+		"dotenv":    "16.4.5",
+		"express":   "4.19.2",
+		"jest":      "29.7.0",
+		"lodash":    "4.17.21",
+		"nodemon":   "3.1.0",
+		"react":     "18.2.0",
+		"react-dom": "18.2.0",
+	},
+	ecosystemGo: {
+		"github.com/gin-gonic/gin":     "v1.9.1",
+		"github.com/google/uuid":       "v1.6.0",
+		"github.com/gorilla/mux":       "v1.8.1",
+		"github.com/lib/pq":            "v1.10.9",
+		"github.com/redis/go-redis/v9": "v9.5.1",
+		"github.com/sirupsen/logrus":   "v1.9.3",
+		"github.com/stretchr/testify":  "v1.9.0",
+		"golang.org/x/sync":            "v0.6.0",
+		"gopkg.in/yaml.v3":             "v3.0.1",
+	},
+}
+
+// Dependency is a parsed dependency entry. Version holds the exact version
+// or, for Python, the full version specifier.
+type Dependency struct {
+	Ecosystem string `json:"ecosystem,omitempty"`
+	Name      string `json:"name"`
+	Extras    string `json:"extras,omitempty"`
+	Version   string `json:"version,omitempty"`
+}
+
+// String formats the dependency as a line of its ecosystem's manifest. It
+// parses back to the same dependency.
+func (d Dependency) String() string {
+	switch d.Ecosystem {
+	case ecosystemPyPI:
+		return d.Name + d.Extras + d.Version
+	case ecosystemNPM, ecosystemGo:
+		return d.Name + "@" + d.Version
+	default:
+		return d.Name
+	}
+}
+
+// floating reports whether the dependency still needs a version pinned
+func (d Dependency) floating() bool {
+	switch d.Ecosystem {
+	case ecosystemPyPI:
+		return d.Version == ""
+	case ecosystemNPM:
+		return d.Version == "latest" || d.Version == "*"
+	case ecosystemGo:
+		return d.Version == "" || d.Version == "latest"
+	default:
+		return false
+	}
+}
+
+// DependencyIssue reports a dependency entry left out of the capsule
+type DependencyIssue struct {
+	Service    string `json:"service,omitempty"`
+	Dependency string `json:"dependency"`
+	Error      string `json:"error"`
+}
+
+// dependencyEcosystem returns the package ecosystem for a language, or ""
+// when its dependencies are written as given
+func dependencyEcosystem(language string) string {
+	switch strings.ToLower(language) {
+	case "python":
+		return ecosystemPyPI
+	case "javascript", "typescript":
+		return ecosystemNPM
+	case "go":
+		return ecosystemGo
+	default:
+		return ""
+	}
+}
+
+// parseDependency checks an entry against the ecosystem's naming rules
+func parseDependency(ecosystem, raw string) (Dependency, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Dependency{}, fmt.Errorf("empty dependency")
+	}
+
+	switch ecosystem {
+	case ecosystemPyPI:
+		return parsePythonDependency(raw)
+	case ecosystemNPM:
+		return parseNPMDependency(raw)
+	case ecosystemGo:
+		return parseGoDependency(raw)
+	default:
+		return Dependency{Name: raw}, nil
+	}
+}
+
+// parsePythonDependency accepts a PEP 508 name with optional extras and
+// version specifiers, e.g. "uvicorn[standard]>=0.20,<1"
+func parsePythonDependency(raw string) (Dependency, error) {
+	m := pythonNamePattern.FindStringSubmatch(raw)
+	if m == nil {
+		return Dependency{}, fmt.Errorf("%q is not a valid Python package name", raw)
+	}
+	dep := Dependency{Ecosystem: ecosystemPyPI, Name: m[1], Extras: strings.ReplaceAll(m[2], " ", "")}
+
+	if spec := strings.TrimSpace(m[3]); spec != "" {
+		clauses := strings.Split(spec, ",")
+		for i, clause := range clauses {
+			clause = strings.ReplaceAll(strings.TrimSpace(clause), " ", "")
+			if !pythonClausePattern.MatchString(clause) {
+				return Dependency{}, fmt.Errorf("%q is not a valid version specifier", spec)
+			}
+			clauses[i] = clause
+		}
+		dep.Version = strings.Join(clauses, ",")
+	}
+	return dep, nil
+}
+
+// parseNPMDependency accepts "name", "name@version" and scoped packages
+func parseNPMDependency(raw string) (Dependency, error) {
+	name, version := raw, "latest"
+	if i := strings.LastIndex(raw, "@"); i > 0 {
+		name, version = raw[:i], strings.TrimSpace(raw[i+1:])
+	}
+
+	if len(name) > maxNPMPackageName || !npmNamePattern.MatchString(name) {
+		return Dependency{}, fmt.Errorf("%q is not a valid npm package name", name)
+	}
+	if version == "" || !npmVersionPattern.MatchString(version) {
+		return Dependency{}, fmt.Errorf("%q is not a valid npm version range", version)
+	}
+	return Dependency{Ecosystem: ecosystemNPM, Name: name, Version: version}, nil
+}
+
+// parseGoDependency accepts "module", "module@version" and the go.mod form
+// "module version"
+func parseGoDependency(raw string) (Dependency, error) {
+	path, version := raw, ""
+	if i := strings.IndexAny(raw, "@ \t"); i >= 0 {
+		path, version = raw[:i], strings.TrimSpace(raw[i+1:])
+	}
+
+	if !goPathPattern.MatchString(path) {
+		return Dependency{}, fmt.Errorf("%q is not a valid Go module path", path)
+	}
+	if version != "" && version != "latest" && !goVersionPattern.MatchString(version) {
+		return Dependency{}, fmt.Errorf("%q is not a valid Go module version", version)
+	}
+	return Dependency{Ecosystem: ecosystemGo, Name: path, Version: version}, nil
+}
+
+// manifestDependencies parses entries for the manifest templates, leaving
+// out any that are invalid
+func manifestDependencies(language string, deps []string) []Dependency {
+	ecosystem := dependencyEcosystem(language)
+	parsed := make([]Dependency, 0, len(deps))
+	for _, raw := range deps {
+		if dep, err := parseDependency(ecosystem, raw); err == nil {
+			parsed = append(parsed, dep)
+		}
+	}
+	return parsed
+}
+
+// pinRequestDependencies validates the request's dependencies and, unless
+// pin_versions is false, pins floating versions. Entries are rewritten in
+// their manifest form; invalid ones are removed and reported.
+func pinRequestDependencies(ctx context.Context, req *BuildRequest) []DependencyIssue {
+	pin := req.PinVersions == nil || *req.PinVersions
+
+	var issues []DependencyIssue
+	for i := range req.Services {
+		svc := &req.Services[i]
+		deps, svcIssues := pinDependencies(ctx, svc.Language, svc.Dependencies, pin)
+		for j := range svcIssues {
+			svcIssues[j].Service = svc.Name
+		}
+		svc.Dependencies = deps
+		issues = append(issues, svcIssues...)
+	}
+
+	deps, topIssues := pinDependencies(ctx, req.Language, req.Dependencies, pin)
+	req.Dependencies = deps
+	return append(issues, topIssues...)
+}
+
+func pinDependencies(ctx context.Context, language string, raw []string, pin bool) ([]string, []DependencyIssue) {
+	if len(raw) == 0 {
+		return raw, nil
+	}
+
+	ecosystem := dependencyEcosystem(language)
+	deps := make([]string, 0, len(raw))
+	var issues []DependencyIssue
+	for _, entry := range raw {
+		dep, err := parseDependency(ecosystem, entry)
+		if err == nil && dep.floating() {
+			switch {
+			case pin:
+				err = dependencyResolver.pin(ctx, &dep)
+			case dep.Ecosystem == ecosystemGo:
+				err = fmt.Errorf("a version is required for %s when pin_versions is false", dep.Name)
+			}
+		}
+		if err != nil {
+			issues = append(issues, DependencyIssue{Dependency: entry, Error: err.Error()})
+			continue
+		}
+		deps = append(deps, dep.String())
+	}
+	return deps, issues
+}
+
+// VersionResolver looks up the latest version of packages on PyPI, npm and
+// the Go module proxy. Results are cached, and lookups that fail fall back
+// to knownGoodVersions.
+type VersionResolver struct {
+	pypiURL    string
+	npmURL     string
+	goProxyURL string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedVersion
+	now   func() time.Time
+}
+
+type cachedVersion struct {
+	version string
+	err     error
+	expires time.Time
+}
+
+var dependencyResolver = newVersionResolverFromEnv()
+
+// newVersionResolverFromEnv reads the registry URLs from PYPI_URL,
+// NPM_REGISTRY_URL and GO_PROXY_URL
+func newVersionResolverFromEnv() *VersionResolver {
+	return newVersionResolver(
+		envOrDefault("PYPI_URL", "https://pypi.org"),
+		envOrDefault("NPM_REGISTRY_URL", "https://registry.npmjs.org"),
+		envOrDefault("GO_PROXY_URL", "https://proxy.golang.org"),
+	)
+}
+
+func newVersionResolver(pypiURL, npmURL, goProxyURL string) *VersionResolver {
+	return &VersionResolver{
+		pypiURL:    strings.TrimRight(pypiURL, "/"),
+		npmURL:     strings.TrimRight(npmURL, "/"),
+		goProxyURL: strings.TrimRight(goProxyURL, "/"),
+		httpClient: &http.Client{Timeout: registryTimeout},
+		cache:      make(map[string]cachedVersion),
+		now:        time.Now,
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// pin sets the dependency's version to the latest release
+func (r *VersionResolver) pin(ctx context.Context, dep *Dependency) error {
+	version, err := r.Latest(ctx, dep.Ecosystem, dep.Name)
+	if err != nil {
+		return err
+	}
+	if dep.Ecosystem == ecosystemPyPI {
+		version = "==" + version
+	}
+	dep.Version = version
+	return nil
+}
+
+// Latest returns the latest version of a package
+func (r *VersionResolver) Latest(ctx context.Context, ecosystem, name string) (string, error) {
+	key := ecosystem + ":" + name
+	if ecosystem == ecosystemPyPI {
+		key = ecosystem + ":" + normalizePythonName(name)
+	}
+
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && r.now().Before(cached.expires) {
+		return cached.version, cached.err
+	}
+
+	version, err := r.fetchLatest(ctx, ecosystem, name)
+	ttl := versionCacheTTL
+	if err != nil {
+		logger.WithError(err).WithFields(logrus.Fields{
+			"ecosystem": ecosystem,
+			"package":   name,
+		}).Warn("Failed to resolve latest version, using snapshot")
+
+		ttl = versionFailureTTL
+		version, err = snapshotVersion(ecosystem, name)
+	}
+
+	r.mu.Lock()
+	r.cache[key] = cachedVersion{version: version, err: err, expires: r.now().Add(ttl)}
+	r.mu.Unlock()
+	return version, err
+}
+
+func (r *VersionResolver) fetchLatest(ctx context.Context, ecosystem, name string) (string, error) {
+	switch ecosystem {
+	case ecosystemPyPI:
+		var body struct {
+			Info struct {
+				Version string `json:"version"`
+			} `json:"info"`
+		}
+		err := r.getJSON(ctx, r.pypiURL+"/pypi/"+url.PathEscape(normalizePythonName(name))+"/json", &body)
+		return body.Info.Version, err
+	case ecosystemNPM:
+		var body struct {
+			Version string `json:"version"`
+		}
+		err := r.getJSON(ctx, r.npmURL+"/"+url.PathEscape(name)+"/latest", &body)
+		return body.Version, err
+	case ecosystemGo:
+		var body struct {
+			Version string `json:"Version"`
+		}
+		err := r.getJSON(ctx, r.goProxyURL+"/"+escapeModulePath(name)+"/@latest", &body)
+		return body.Version, err
+	default:
+		return "", fmt.Errorf("unknown ecosystem %q", ecosystem)
+	}
+}
+
+func (r *VersionResolver) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode registry response: %w", err)
+	}
+	return nil
+}
+
+func snapshotVersion(ecosystem, name string) (string, error) {
+	if ecosystem == ecosystemPyPI {
+		name = normalizePythonName(name)
+	}
+	if version, ok := knownGoodVersions[ecosystem][name]; ok {
+		return version, nil
+	}
+	return "", fmt.Errorf("could not resolve the latest version of %s", name)
+}
+
+// normalizePythonName applies PEP 503 normalization
+func normalizePythonName(name string) string {
+	return strings.ToLower(pythonNormalize.ReplaceAllString(name, "-"))
+}
+
+// escapeModulePath applies the module proxy's case encoding, where each
+// upper-case letter becomes '!' and its lower-case form
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
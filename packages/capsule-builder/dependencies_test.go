@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseDependency(t *testing.T) {
+	tests := []struct {
+		ecosystem string
+		raw       string
+		want      string
+		wantErr   bool
+	}{
+		{ecosystemPyPI, "fastapi", "fastapi", false},
+		{ecosystemPyPI, "fastapi>=0.100", "fastapi>=0.100", false},
+		{ecosystemPyPI, "uvicorn[standard] >= 0.20, < 1", "uvicorn[standard]>=0.20,<1", false},
+		{ecosystemPyPI, "Flask_Login==0.6.3", "Flask_Login==0.6.3", false},
+		{ecosystemPyPI, "fastapi 0.100", "", true},
+		{ecosystemPyPI, "-e git+https://example.com/repo", "", true},
+		{ecosystemNPM, "express", "express@latest", false},
+		{ecosystemNPM, "express@^4.18.0", "express@^4.18.0", false},
+		{ecosystemNPM, "@types/node@20.11.0", "@types/node@20.11.0", false},
+		{ecosystemNPM, "@types/node", "@types/node@latest", false},
+		{ecosystemNPM, "fastapi>=0.100", "", true},
+		{ecosystemNPM, "Express", "", true},
+		{ecosystemNPM, `lodash@1.0"`, "", true},
+		{ecosystemGo, "github.com/gin-gonic/gin", "github.com/gin-gonic/gin@", false},
+		{ecosystemGo, "github.com/gin-gonic/gin v1.9.1", "github.com/gin-gonic/gin@v1.9.1", false},
+		{ecosystemGo, "github.com/BurntSushi/toml@v1.3.2", "github.com/BurntSushi/toml@v1.3.2", false},
+		{ecosystemGo, "gin", "", true},
+		{ecosystemGo, "github.com/gin-gonic/gin@1.9.1", "", true},
+		{"", "org.postgresql:postgresql:42.7.1", "org.postgresql:postgresql:42.7.1", false},
+		{ecosystemPyPI, "  ", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ecosystem+"/"+tt.raw, func(t *testing.T) {
+			dep, err := parseDependency(tt.ecosystem, tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && dep.String() != tt.want {
+				t.Fatalf("String() = %q, want %q", dep.String(), tt.want)
+			}
+		})
+	}
+}
+
+// registryStub serves the latest version of every package as 9.9.9 and
+// counts the lookups it answers
+func registryStub(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var lookups int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/pypi/"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"info": map[string]string{"version": "9.9.9"}})
+		case strings.HasSuffix(r.URL.Path, "/@latest"):
+			json.NewEncoder(w).Encode(map[string]string{"Version": "v9.9.9"})
+		case strings.HasSuffix(r.URL.Path, "/latest"):
+			json.NewEncoder(w).Encode(map[string]string{"version": "9.9.9"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &lookups
+}
+
+// useResolver swaps the resolver used by builds for the test
+func useResolver(t *testing.T, r *VersionResolver) {
+	t.Helper()
+	previous := dependencyResolver
+	dependencyResolver = r
+	t.Cleanup(func() { dependencyResolver = previous })
+}
+
+func TestVersionResolverLatest(t *testing.T) {
+	server, lookups := registryStub(t)
+	r := newVersionResolver(server.URL, server.URL, server.URL)
+
+	tests := []struct {
+		ecosystem string
+		name      string
+		want      string
+	}{
+		{ecosystemPyPI, "FastAPI", "9.9.9"},
+		{ecosystemNPM, "@types/node", "9.9.9"},
+		{ecosystemGo, "github.com/BurntSushi/toml", "v9.9.9"},
+	}
+	for _, tt := range tests {
+		got, err := r.Latest(context.Background(), tt.ecosystem, tt.name)
+		if err != nil || got != tt.want {
+			t.Fatalf("Latest(%s, %s) = %q, %v; want %q", tt.ecosystem, tt.name, got, err, tt.want)
+		}
+	}
+
+	// Cached, including under a differently spelled Python name
+	if _, err := r.Latest(context.Background(), ecosystemPyPI, "fastapi"); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(lookups); got != 3 {
+		t.Fatalf("registry answered %d lookups, want 3", got)
+	}
+}
+
+func TestVersionResolverOfflineFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	r := newVersionResolver(server.URL, server.URL, server.URL)
+
+	got, err := r.Latest(context.Background(), ecosystemPyPI, "FastAPI")
+	if err != nil || got != knownGoodVersions[ecosystemPyPI]["fastapi"] {
+		t.Fatalf("Latest = %q, %v; want the snapshot version", got, err)
+	}
+	if _, err := r.Latest(context.Background(), ecosystemNPM, "left-pad"); err == nil {
+		t.Fatal("package outside the snapshot resolved while offline")
+	}
+}
+
+func TestPinRequestDependencies(t *testing.T) {
+	server, _ := registryStub(t)
+	useResolver(t, newVersionResolver(server.URL, server.URL, server.URL))
+	no := false
+
+	tests := []struct {
+		name        string
+		req         BuildRequest
+		wantDeps    []string
+		wantInvalid []string
+	}{
+		{
+			name:        "python",
+			req:         BuildRequest{Language: "python", Dependencies: []string{"fastapi", "pydantic>=2", "not a package"}},
+			wantDeps:    []string{"fastapi==9.9.9", "pydantic>=2"},
+			wantInvalid: []string{"not a package"},
+		},
+		{
+			name:        "npm",
+			req:         BuildRequest{Language: "javascript", Dependencies: []string{"express", "cors@2.8.5", "fastapi>=0.100"}},
+			wantDeps:    []string{"express@9.9.9", "cors@2.8.5"},
+			wantInvalid: []string{"fastapi>=0.100"},
+		},
+		{
+			name:     "go",
+			req:      BuildRequest{Language: "go", Dependencies: []string{"github.com/google/uuid"}},
+			wantDeps: []string{"github.com/google/uuid@v9.9.9"},
+		},
+		{
+			name:        "floating",
+			req:         BuildRequest{Language: "python", PinVersions: &no, Dependencies: []string{"fastapi", "bad name"}},
+			wantDeps:    []string{"fastapi"},
+			wantInvalid: []string{"bad name"},
+		},
+		{
+			name:        "floating go needs a version",
+			req:         BuildRequest{Language: "go", PinVersions: &no, Dependencies: []string{"github.com/google/uuid", "github.com/lib/pq@v1.10.9"}},
+			wantDeps:    []string{"github.com/lib/pq@v1.10.9"},
+			wantInvalid: []string{"github.com/google/uuid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			issues := pinRequestDependencies(context.Background(), &req)
+
+			if strings.Join(req.Dependencies, " ") != strings.Join(tt.wantDeps, " ") {
+				t.Fatalf("dependencies = %v, want %v", req.Dependencies, tt.wantDeps)
+			}
+			var invalid []string
+			for _, issue := range issues {
+				if issue.Error == "" {
+					t.Fatalf("issue %+v has no error", issue)
+				}
+				invalid = append(invalid, issue.Dependency)
+			}
+			if strings.Join(invalid, " ") != strings.Join(tt.wantInvalid, " ") {
+				t.Fatalf("invalid = %v, want %v", invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestPinServiceDependencies(t *testing.T) {
+	server, _ := registryStub(t)
+	useResolver(t, newVersionResolver(server.URL, server.URL, server.URL))
+
+	req := BuildRequest{Services: []ServiceSpec{
+		{Name: "api", Language: "python", Dependencies: []string{"fastapi"}},
+		{Name: "web", Language: "javascript", Dependencies: []string{"react", "React"}},
+	}}
+	issues := pinRequestDependencies(context.Background(), &req)
+
+	if got := req.Services[1].Dependencies; len(got) != 1 || got[0] != "react@9.9.9" {
+		t.Fatalf("web dependencies = %v", got)
+	}
+	if len(issues) != 1 || issues[0].Service != "web" || issues[0].Dependency != "React" {
+		t.Fatalf("issues = %+v, want React reported for web", issues)
+	}
+}
+
+func TestPinnedManifests(t *testing.T) {
+	server, _ := registryStub(t)
+	useResolver(t, newVersionResolver(server.URL, server.URL, server.URL))
+
+	tests := []struct {
+		language string
+		deps     []string
+		path     string
+		want     string
+	}{
+		{"python", []string{"fastapi", "uvicorn[standard]>=0.20"}, "requirements.txt", "fastapi==9.9.9\nuvicorn[standard]>=0.20\n"},
+		{"go", []string{"github.com/google/uuid"}, "go.mod", "\tgithub.com/google/uuid v9.9.9\n"},
+	}
+	for _, tt := range tests {
+		req := BuildRequest{Language: tt.language, Name: "demo", Dependencies: tt.deps}
+		pinRequestDependencies(context.Background(), &req)
+		content := buildStructuredCapsule("capsule-1", req).Structure[tt.path].Content
+		if !strings.Contains(content, tt.want) {
+			t.Fatalf("%s = %q, want it to contain %q", tt.path, content, tt.want)
+		}
+	}
+
+	req := BuildRequest{Language: "javascript", Name: "demo", Dependencies: []string{"express", "@types/node@^20", "fastapi>=0.100"}}
+	pinRequestDependencies(context.Background(), &req)
+	var pkg struct {
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	content := buildStructuredCapsule("capsule-1", req).Structure["package.json"].Content
+	if err := json.Unmarshal([]byte(content), &pkg); err != nil {
+		t.Fatalf("package.json is not valid JSON: %v\n%s", err, content)
+	}
+	if len(pkg.Dependencies) != 2 || pkg.Dependencies["express"] != "9.9.9" || pkg.Dependencies["@types/node"] != "^20" {
+		t.Fatalf("package.json dependencies = %v", pkg.Dependencies)
+	}
+}
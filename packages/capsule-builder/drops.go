@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// WorkflowDrop is a QuantumDrop as returned by the quantum-drops service
+type WorkflowDrop struct {
+	ID        string                 `json:"id"`
+	Stage     string                 `json:"stage"`
+	Type      string                 `json:"type"`
+	Artifact  string                 `json:"artifact"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Version   int                    `json:"version"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// FileProvenance records which drop a capsule file came from
+type FileProvenance struct {
+	DropID    string    `json:"drop_id"`
+	DropType  string    `json:"drop_type"`
+	Stage     string    `json:"stage"`
+	Version   int       `json:"version,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BuildFromDropsRequest builds a capsule from every drop of a workflow.
+// Language, framework and type fall back to the code drop's metadata.
+type BuildFromDropsRequest struct {
+	WorkflowID  string `json:"workflow_id" binding:"required"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Framework   string `json:"framework,omitempty"`
+	Type        string `json:"type,omitempty"`
+}
+
+// fetchWorkflowDrops gets all drops for a workflow, oldest first
+func fetchWorkflowDrops(workflowID string) ([]WorkflowDrop, error) {
+	dropsURL := os.Getenv("QUANTUM_DROPS_URL")
+	if dropsURL == "" {
+		dropsURL = "http://quantum-drops.quantumlayer.svc.cluster.local:8090"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/workflows/%s/drops", dropsURL, workflowID), nil)
+	if err != nil {
+		return nil, apierror.Internal("failed to create drops request")
+	}
+	authmiddleware.SetServiceKey(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.WithError(err).WithField("workflow_id", workflowID).Error("Failed to fetch workflow drops")
+		return nil, apierror.Internal("failed to fetch workflow drops")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.WithFields(logrus.Fields{
+			"workflow_id": workflowID,
+			"status":      resp.StatusCode,
+		}).Warn("Workflow drops not available")
+		return nil, apierror.NotFound("workflow drops not found")
+	}
+
+	var drops struct {
+		Drops []WorkflowDrop `json:"drops"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&drops); err != nil {
+		logger.WithError(err).WithField("workflow_id", workflowID).Error("Failed to parse workflow drops")
+		return nil, apierror.Internal("failed to parse drops")
+	}
+	return drops.Drops, nil
+}
+
+// metadataString returns a string value from drop metadata
+func (d WorkflowDrop) metadataString(key string) string {
+	if v, ok := d.Metadata[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (d WorkflowDrop) provenance() *FileProvenance {
+	return &FileProvenance{
+		DropID:    d.ID,
+		DropType:  d.Type,
+		Stage:     d.Stage,
+		Version:   d.Version,
+		CreatedAt: d.CreatedAt,
+	}
+}
+
+// dropFilePath returns a relative path from a drop's "path" metadata, or ""
+// if it has none or it would leave the capsule
+func dropFilePath(d WorkflowDrop) string {
+	p := d.metadataString("path")
+	if p == "" {
+		p = d.metadataString("file_name")
+	}
+	if p == "" || strings.HasPrefix(p, "/") {
+		return ""
+	}
+	p = path.Clean(p)
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return ""
+	}
+	return p
+}
+
+// dropFile maps a file-producing drop to a capsule file. Drops that don't
+// produce a file (prompts, structure, deployments, ...) return false.
+func dropFile(d WorkflowDrop, language, projectType string) (FileContent, bool) {
+	file := FileContent{Path: dropFilePath(d), Content: d.Artifact}
+
+	switch d.Type {
+	case "code":
+		file.Type = "source"
+		if file.Path == "" {
+			file.Path = getMainFilePath(language, projectType)
+		}
+	case "tests":
+		file.Type = "test"
+		if file.Path == "" {
+			file.Path = getTestFilePath(language)
+		}
+	case "documentation", "docs":
+		file.Type = "doc"
+		if file.Path == "" {
+			file.Path = "README.md"
+			if d.Stage != "" && d.Stage != "documentation" {
+				file.Path = "docs/" + strings.ToUpper(d.Stage) + ".md"
+			}
+		}
+	case "frd":
+		file.Type = "doc"
+		if file.Path == "" {
+			file.Path = "docs/FRD.md"
+		}
+	case "test_plan":
+		file.Type = "doc"
+		if file.Path == "" {
+			file.Path = "docs/TEST_PLAN.md"
+		}
+	case "config":
+		// A config drop can't be placed without knowing its file name
+		file.Type = "config"
+		if file.Path == "" {
+			return FileContent{}, false
+		}
+	default:
+		return FileContent{}, false
+	}
+
+	file.Description = fmt.Sprintf("From %s drop %s", d.Type, d.ID)
+	file.Provenance = d.provenance()
+	return file, true
+}
+
+// buildCapsuleFromDrops lays out the project template for the workflow's
+// latest code drop and overlays every file-producing drop on it. Later drops
+// replace earlier ones at the same path. It also returns the build request
+// the template was laid out from.
+func buildCapsuleFromDrops(id string, req BuildFromDropsRequest, drops []WorkflowDrop) (*StructuredCapsule, BuildRequest, error) {
+	var code *WorkflowDrop
+	for i := range drops {
+		if drops[i].Type == "code" {
+			code = &drops[i]
+		}
+	}
+	if code == nil {
+		return nil, BuildRequest{}, apierror.Unprocessable("workflow has no code drop")
+	}
+
+	buildReq := BuildRequest{
+		WorkflowID:  req.WorkflowID,
+		Language:    firstNonEmpty(req.Language, code.metadataString("language")),
+		Framework:   firstNonEmpty(req.Framework, code.metadataString("framework")),
+		Type:        firstNonEmpty(req.Type, code.metadataString("type")),
+		Name:        firstNonEmpty(req.Name, fmt.Sprintf("project-%s", req.WorkflowID)),
+		Description: req.Description,
+		Code:        code.Artifact,
+	}
+	capsule := buildStructuredCapsule(id, buildReq)
+
+	// A code drop with its own path replaces the template's main file
+	if codePath := dropFilePath(*code); codePath != "" {
+		mainFile := getMainFilePath(buildReq.Language, buildReq.Type)
+		capsule.Size -= int64(len(capsule.Structure[mainFile].Content))
+		delete(capsule.Structure, mainFile)
+	}
+
+	var skipped []string
+	for _, drop := range drops {
+		if drop.Type == "tests" {
+			buildReq.Tests = drop.Artifact
+		}
+		file, ok := dropFile(drop, buildReq.Language, buildReq.Type)
+		if !ok {
+			skipped = append(skipped, drop.ID)
+			continue
+		}
+		if prev, ok := capsule.Structure[file.Path]; ok {
+			capsule.Size -= int64(len(prev.Content))
+		}
+		capsule.Structure[file.Path] = file
+		capsule.Size += int64(len(file.Content))
+	}
+	capsule.Lint = lintCapsule(capsule)
+
+	logger.WithFields(logrus.Fields{
+		"workflow_id": req.WorkflowID,
+		"drops":       len(drops),
+		"skipped":     skipped,
+	}).Debug("Mapped workflow drops to capsule files")
+	return capsule, buildReq, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// handleBuildFromDrops builds and stores a capsule from all of a workflow's
+// drops in one step
+func handleBuildFromDrops(c *gin.Context) {
+	var req BuildFromDropsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+
+	drops, err := fetchWorkflowDrops(req.WorkflowID)
+	if err != nil {
+		apierror.RespondError(c, err)
+		return
+	}
+
+	capsuleID := fmt.Sprintf("capsule-%s", uuid.New().String())
+	capsule, buildReq, err := buildCapsuleFromDrops(capsuleID, req, drops)
+	if err != nil {
+		apierror.RespondError(c, err)
+		return
+	}
+
+	capsuleStorage[capsuleID] = capsule
+	logCapsuleBuilt(capsule, buildReq)
+
+	c.JSON(http.StatusCreated, capsule)
+}
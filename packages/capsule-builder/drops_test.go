@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveDrops stands in for quantum-drops, answering every workflow with drops
+func serveDrops(t *testing.T, drops []WorkflowDrop) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"drops": drops})
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("QUANTUM_DROPS_URL", srv.URL)
+}
+
+func buildFromWorkflow(body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/build-from-workflow", handleBuildFromWorkflow)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/build-from-workflow", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBuildFromWorkflowUsesRequestedLanguage(t *testing.T) {
+	serveDrops(t, []WorkflowDrop{
+		{ID: "drop-1", Stage: "code_generation", Type: "code", Artifact: "print('hi')"},
+		{ID: "drop-2", Stage: "test_generation", Type: "tests", Artifact: "def test_hi(): pass"},
+	})
+
+	w := buildFromWorkflow(`{"workflow_id": "wf-1", "language": "python", "type": "cli", "name": "hello"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+	var capsule StructuredCapsule
+	if err := json.Unmarshal(w.Body.Bytes(), &capsule); err != nil {
+		t.Fatal(err)
+	}
+	if capsule.Language != "python" || capsule.Type != "cli" || capsule.Name != "hello" {
+		t.Errorf("capsule = %s/%s/%s, want python/cli/hello", capsule.Language, capsule.Type, capsule.Name)
+	}
+	if _, ok := capsuleStorage[capsule.ID]; !ok {
+		t.Errorf("capsule %s was not stored", capsule.ID)
+	}
+}
+
+func TestBuildFromWorkflowWithoutCode(t *testing.T) {
+	serveDrops(t, []WorkflowDrop{{ID: "drop-1", Stage: "frd_generation", Type: "frd", Artifact: "# FRD"}})
+
+	w := buildFromWorkflow(`{"workflow_id": "wf-1"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "no code drop") {
+		t.Errorf("body = %s, want the missing code reported", w.Body.String())
+	}
+}
+
+func TestDropFilePath(t *testing.T) {
+	tests := []struct {
+		metadata map[string]interface{}
+		want     string
+	}{
+		{nil, ""},
+		{map[string]interface{}{"path": "src/app.py"}, "src/app.py"},
+		{map[string]interface{}{"path": "src/./lib/../app.py"}, "src/app.py"},
+		{map[string]interface{}{"file_name": "config.yaml"}, "config.yaml"},
+		{map[string]interface{}{"path": "app.py", "file_name": "other.py"}, "app.py"},
+		{map[string]interface{}{"path": 42}, ""},
+		// Paths leaving the capsule are dropped
+		{map[string]interface{}{"path": "/etc/passwd"}, ""},
+		{map[string]interface{}{"path": "../secrets.env"}, ""},
+		{map[string]interface{}{"path": "src/../../secrets.env"}, ""},
+		{map[string]interface{}{"path": ".."}, ""},
+		{map[string]interface{}{"path": "."}, ""},
+	}
+	for _, tt := range tests {
+		if got := dropFilePath(WorkflowDrop{Metadata: tt.metadata}); got != tt.want {
+			t.Errorf("dropFilePath(%v) = %q, want %q", tt.metadata, got, tt.want)
+		}
+	}
+}
+
+func TestDropFile(t *testing.T) {
+	tests := []struct {
+		drop     WorkflowDrop
+		wantPath string
+		wantType string
+	}{
+		{WorkflowDrop{Type: "code"}, "main.py", "source"},
+		{WorkflowDrop{Type: "code", Metadata: map[string]interface{}{"path": "app/server.py"}}, "app/server.py", "source"},
+		{WorkflowDrop{Type: "tests"}, "tests/test_main.py", "test"},
+		{WorkflowDrop{Type: "documentation", Stage: "documentation"}, "README.md", "doc"},
+		{WorkflowDrop{Type: "docs", Stage: "architecture"}, "docs/ARCHITECTURE.md", "doc"},
+		{WorkflowDrop{Type: "frd"}, "docs/FRD.md", "doc"},
+		{WorkflowDrop{Type: "test_plan"}, "docs/TEST_PLAN.md", "doc"},
+		{WorkflowDrop{Type: "config", Metadata: map[string]interface{}{"file_name": ".env.example"}}, ".env.example", "config"},
+		// Drops that aren't files, or can't be placed, are skipped
+		{WorkflowDrop{Type: "config"}, "", ""},
+		{WorkflowDrop{Type: "prompt"}, "", ""},
+		{WorkflowDrop{Type: "structure"}, "", ""},
+	}
+	for _, tt := range tests {
+		tt.drop.ID = "drop-1"
+		tt.drop.Artifact = "content"
+		file, ok := dropFile(tt.drop, "python", "api")
+		if ok != (tt.wantPath != "") || file.Path != tt.wantPath || file.Type != tt.wantType {
+			t.Errorf("dropFile(%s %v) = %q %q %v, want %q %q", tt.drop.Type, tt.drop.Metadata, file.Path, file.Type, ok, tt.wantPath, tt.wantType)
+			continue
+		}
+		if ok && (file.Content != "content" || file.Provenance == nil || file.Provenance.DropID != "drop-1" || file.Provenance.DropType != tt.drop.Type) {
+			t.Errorf("dropFile(%s) = %+v", tt.drop.Type, file)
+		}
+	}
+}
+
+// workflowDrops is a generation workflow's drops, oldest first
+func workflowDrops() []WorkflowDrop {
+	python := map[string]interface{}{"language": "python", "framework": "fastapi", "type": "api"}
+	return []WorkflowDrop{
+		{ID: "d1", Stage: "frd_generation", Type: "frd", Artifact: "# FRD", Version: 1},
+		{ID: "d2", Stage: "code_generation", Type: "code", Artifact: "print('v1')", Metadata: python, Version: 1},
+		{ID: "d3", Stage: "test_generation", Type: "tests", Artifact: "def test_v1(): pass", Version: 1},
+		{ID: "d4", Stage: "code_generation", Type: "code", Artifact: "print('v2')", Metadata: python, Version: 2},
+		{ID: "d5", Stage: "structure", Type: "structure", Artifact: "{}"},
+		{ID: "d6", Stage: "config", Type: "config", Artifact: "DEBUG=false", Metadata: map[string]interface{}{"path": "../.env"}},
+		{ID: "d7", Stage: "config", Type: "config", Artifact: "PORT=8000", Metadata: map[string]interface{}{"file_name": ".env.example"}},
+	}
+}
+
+func TestBuildCapsuleFromDrops(t *testing.T) {
+	capsule, buildReq, err := buildCapsuleFromDrops("capsule-1", BuildFromDropsRequest{WorkflowID: "wf-1"}, workflowDrops())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The template comes from the latest code drop's metadata
+	if buildReq.Language != "python" || buildReq.Framework != "fastapi" || buildReq.Type != "api" || buildReq.Name != "project-wf-1" {
+		t.Errorf("build request = %+v", buildReq)
+	}
+	if buildReq.Code != "print('v2')" || buildReq.Tests != "def test_v1(): pass" {
+		t.Errorf("code %q, tests %q", buildReq.Code, buildReq.Tests)
+	}
+	if _, ok := capsule.Structure["requirements.txt"]; !ok {
+		t.Error("template files are missing")
+	}
+
+	// Later drops replace earlier ones at the same path
+	want := map[string]string{
+		"main.py":            "d4",
+		"tests/test_main.py": "d3",
+		"docs/FRD.md":        "d1",
+		".env.example":       "d7",
+	}
+	for path, dropID := range want {
+		file, ok := capsule.Structure[path]
+		if !ok || file.Provenance == nil || file.Provenance.DropID != dropID {
+			t.Errorf("%s = %+v, want it from %s", path, file, dropID)
+		}
+	}
+	if file := capsule.Structure["main.py"]; file.Content != "print('v2')" || file.Provenance.Version != 2 {
+		t.Errorf("main.py = %q version %d, want the latest code", file.Content, file.Provenance.Version)
+	}
+	if _, ok := capsule.Structure["../.env"]; ok {
+		t.Error("a drop was written outside the capsule")
+	}
+
+	var size int64
+	for _, file := range capsule.Structure {
+		size += int64(len(file.Content))
+	}
+	if capsule.Size != size {
+		t.Errorf("size = %d, want %d", capsule.Size, size)
+	}
+}
+
+func TestBuildCapsuleFromDropsOverrides(t *testing.T) {
+	drops := []WorkflowDrop{{
+		ID: "d1", Type: "code", Artifact: "package main",
+		Metadata: map[string]interface{}{"language": "python", "type": "api", "path": "cmd/server/main.go"},
+	}}
+	req := BuildFromDropsRequest{WorkflowID: "wf-1", Name: "server", Language: "go", Type: "cli"}
+	capsule, buildReq, err := buildCapsuleFromDrops("capsule-1", req, drops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buildReq.Language != "go" || buildReq.Type != "cli" || capsule.Name != "server" {
+		t.Errorf("request fields didn't override the drop's metadata: %+v", buildReq)
+	}
+
+	// A code drop with its own path replaces the template's main file
+	if _, ok := capsule.Structure["main.go"]; ok {
+		t.Error("template main.go kept beside the code drop's own path")
+	}
+	if file := capsule.Structure["cmd/server/main.go"]; file.Content != "package main" {
+		t.Errorf("cmd/server/main.go = %q", file.Content)
+	}
+}
+
+func buildFromDrops(body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/build-from-drops", handleBuildFromDrops)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/build-from-drops", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBuildFromDrops(t *testing.T) {
+	serveDrops(t, workflowDrops())
+
+	w := buildFromDrops(`{"workflow_id": "wf-1", "name": "shop"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d %s, want 201", w.Code, w.Body)
+	}
+	var capsule StructuredCapsule
+	if err := json.Unmarshal(w.Body.Bytes(), &capsule); err != nil {
+		t.Fatal(err)
+	}
+	if capsule.Name != "shop" || capsule.Structure["main.py"].Provenance == nil {
+		t.Errorf("capsule = %s with main.py %+v", capsule.Name, capsule.Structure["main.py"])
+	}
+	if _, ok := capsuleStorage[capsule.ID]; !ok {
+		t.Errorf("capsule %s was not stored", capsule.ID)
+	}
+}
+
+func TestBuildFromDropsFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		drops      http.HandlerFunc
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "no workflow ID",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown workflow",
+			drops:      func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) },
+			body:       `{"workflow_id": "wf-missing"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "no code drop",
+			drops: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{"drops": []WorkflowDrop{{ID: "d1", Type: "frd", Artifact: "# FRD"}}})
+			},
+			body:       `{"workflow_id": "wf-1"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "malformed drops",
+			drops:      func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("not json")) },
+			body:       `{"workflow_id": "wf-1"}`,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.drops != nil {
+				srv := httptest.NewServer(tt.drops)
+				t.Cleanup(srv.Close)
+				t.Setenv("QUANTUM_DROPS_URL", srv.URL)
+			}
+			if w := buildFromDrops(tt.body); w.Code != tt.wantStatus {
+				t.Errorf("status = %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const githubTimeout = 30 * time.Second
+
+// GitHubExportRequest describes where to push a capsule. The repository is
+// created under Owner, or the token's user when Owner is empty, if it
+// doesn't exist yet.
+type GitHubExportRequest struct {
+	Token   string `json:"token" binding:"required"`
+	Owner   string `json:"owner,omitempty"`
+	Repo    string `json:"repo" binding:"required"`
+	Branch  string `json:"branch,omitempty"`
+	Message string `json:"message,omitempty"`
+	Private bool   `json:"private,omitempty"`
+}
+
+// GitHubExportResult describes the commit made for an export
+type GitHubExportResult struct {
+	RepositoryURL string `json:"repository_url"`
+	Branch        string `json:"branch"`
+	CommitSHA     string `json:"commit_sha"`
+	CommitURL     string `json:"commit_url"`
+	Files         int    `json:"files"`
+	Created       bool   `json:"created"`
+}
+
+// githubError is a failed GitHub API call
+type githubError struct {
+	status  int
+	message string
+}
+
+func (e *githubError) Error() string {
+	return fmt.Sprintf("GitHub returned status %d: %s", e.status, e.message)
+}
+
+// githubClient makes authenticated calls to the GitHub REST API at
+// GITHUB_API_URL, which defaults to github.com
+type githubClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func newGitHubClient(token string) *githubClient {
+	baseURL := os.Getenv("GITHUB_API_URL")
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+	return &githubClient{
+		baseURL:    baseURL,
+		token:      token,
+		httpClient: &http.Client{Timeout: githubTimeout},
+	}
+}
+
+func (g *githubClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode GitHub request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, g.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("GitHub request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var msg struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&msg)
+		return &githubError{status: resp.StatusCode, message: msg.Message}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode GitHub response: %w", err)
+		}
+	}
+	return nil
+}
+
+type githubRepo struct {
+	FullName      string `json:"full_name"`
+	HTMLURL       string `json:"html_url"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+type githubRef struct {
+	Object struct {
+		SHA string `json:"sha"`
+	} `json:"object"`
+}
+
+type githubCommit struct {
+	SHA     string `json:"sha"`
+	HTMLURL string `json:"html_url"`
+	Tree    struct {
+		SHA string `json:"sha"`
+	} `json:"tree"`
+}
+
+type githubTreeEntry struct {
+	Path    string `json:"path"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+func isGitHubStatus(err error, status int) bool {
+	var ghErr *githubError
+	return errors.As(err, &ghErr) && ghErr.status == status
+}
+
+// repository returns the target repository, creating it when missing.
+// New repositories are initialized so they have a commit to build on.
+func (g *githubClient) repository(req GitHubExportRequest) (*githubRepo, bool, error) {
+	owner := req.Owner
+	if owner == "" {
+		var user struct {
+			Login string `json:"login"`
+		}
+		if err := g.do(http.MethodGet, "/user", nil, &user); err != nil {
+			return nil, false, err
+		}
+		owner = user.Login
+	}
+
+	var repo githubRepo
+	err := g.do(http.MethodGet, "/repos/"+url.PathEscape(owner)+"/"+url.PathEscape(req.Repo), nil, &repo)
+	if err == nil {
+		return &repo, false, nil
+	}
+	if !isGitHubStatus(err, http.StatusNotFound) {
+		return nil, false, err
+	}
+
+	create := map[string]interface{}{
+		"name":      req.Repo,
+		"private":   req.Private,
+		"auto_init": true,
+	}
+	path := "/user/repos"
+	if req.Owner != "" {
+		// Organizations have their own endpoint; fall back to the user's
+		// when the owner is the token's user rather than an organization
+		path = "/orgs/" + url.PathEscape(req.Owner) + "/repos"
+	}
+	err = g.do(http.MethodPost, path, create, &repo)
+	if err != nil && req.Owner != "" && isGitHubStatus(err, http.StatusNotFound) {
+		err = g.do(http.MethodPost, "/user/repos", create, &repo)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &repo, true, nil
+}
+
+// exportCapsule commits every file of the capsule to the branch on top of
+// its current head, creating the branch from the default branch if needed
+func exportCapsule(g *githubClient, capsule *StructuredCapsule, req GitHubExportRequest) (*GitHubExportResult, error) {
+	repo, created, err := g.repository(req)
+	if err != nil {
+		return nil, err
+	}
+
+	branch := req.Branch
+	if branch == "" {
+		branch = repo.DefaultBranch
+	}
+	message := req.Message
+	if message == "" {
+		message = fmt.Sprintf("Initial commit of %s from QuantumLayer", capsule.Name)
+	}
+	repoPath := "/repos/" + repo.FullName
+
+	// Build on the branch's head, or the default branch's for a new branch
+	var ref githubRef
+	newBranch := false
+	err = g.do(http.MethodGet, repoPath+"/git/ref/heads/"+url.PathEscape(branch), nil, &ref)
+	if isGitHubStatus(err, http.StatusNotFound) {
+		newBranch = true
+		err = g.do(http.MethodGet, repoPath+"/git/ref/heads/"+url.PathEscape(repo.DefaultBranch), nil, &ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var parent githubCommit
+	if err := g.do(http.MethodGet, repoPath+"/git/commits/"+ref.Object.SHA, nil, &parent); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(capsule.Structure))
+	for path := range capsule.Structure {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	entries := make([]githubTreeEntry, 0, len(paths)+1)
+	for _, path := range paths {
+		file := capsule.Structure[path]
+		mode := "100644"
+		if file.Executable {
+			mode = "100755"
+		}
+		entries = append(entries, githubTreeEntry{Path: path, Mode: mode, Type: "blob", Content: file.Content})
+	}
+	metadataJSON, _ := json.MarshalIndent(capsule.Metadata, "", "  ")
+	entries = append(entries, githubTreeEntry{Path: ".quantum/metadata.json", Mode: "100644", Type: "blob", Content: string(metadataJSON)})
+
+	var tree struct {
+		SHA string `json:"sha"`
+	}
+	err = g.do(http.MethodPost, repoPath+"/git/trees", map[string]interface{}{
+		"base_tree": parent.Tree.SHA,
+		"tree":      entries,
+	}, &tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var commit githubCommit
+	err = g.do(http.MethodPost, repoPath+"/git/commits", map[string]interface{}{
+		"message": message,
+		"tree":    tree.SHA,
+		"parents": []string{parent.SHA},
+	}, &commit)
+	if err != nil {
+		return nil, err
+	}
+
+	if newBranch {
+		err = g.do(http.MethodPost, repoPath+"/git/refs", map[string]string{
+			"ref": "refs/heads/" + branch,
+			"sha": commit.SHA,
+		}, nil)
+	} else {
+		err = g.do(http.MethodPatch, repoPath+"/git/refs/heads/"+url.PathEscape(branch), map[string]interface{}{
+			"sha": commit.SHA,
+		}, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &GitHubExportResult{
+		RepositoryURL: repo.HTMLURL,
+		Branch:        branch,
+		CommitSHA:     commit.SHA,
+		CommitURL:     commit.HTMLURL,
+		Files:         len(entries),
+		Created:       created,
+	}, nil
+}
+
+// handleExportGitHub pushes a built capsule to a GitHub repository
+func handleExportGitHub(c *gin.Context) {
+	id := c.Param("id")
+
+	capsule, exists := capsuleStorage[id]
+	if !exists {
+		apierror.RespondError(c, apierror.NotFound("capsule not found"))
+		return
+	}
+
+	var req GitHubExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+
+	exportLog := logger.WithFields(logrus.Fields{
+		"capsule_id": id,
+		"owner":      req.Owner,
+		"repo":       req.Repo,
+		"branch":     req.Branch,
+	})
+
+	result, err := exportCapsule(newGitHubClient(req.Token), capsule, req)
+	if err != nil {
+		exportLog.WithError(err).Error("GitHub export failed")
+
+		var ghErr *githubError
+		if !errors.As(err, &ghErr) {
+			apierror.RespondError(c, apierror.Upstream("GitHub export failed").WithDetails(err.Error()))
+			return
+		}
+		switch ghErr.status {
+		case http.StatusUnauthorized:
+			apierror.RespondError(c, apierror.New(apierror.CodeUnauthorized, "GitHub rejected the token"))
+		case http.StatusForbidden, http.StatusNotFound:
+			apierror.RespondError(c, apierror.New(apierror.CodeForbidden, "Token can't access the repository").WithDetails(ghErr.message))
+		case http.StatusConflict:
+			apierror.RespondError(c, apierror.Conflict("Repository is empty; initialize it before exporting").WithDetails(ghErr.message))
+		case http.StatusUnprocessableEntity:
+			apierror.RespondError(c, apierror.Unprocessable("GitHub rejected the export").WithDetails(ghErr.message))
+		default:
+			apierror.RespondError(c, apierror.Upstream("GitHub export failed").WithDetails(ghErr.Error()))
+		}
+		return
+	}
+
+	exportLog.WithFields(logrus.Fields{
+		"commit_sha": result.CommitSHA,
+		"files":      result.Files,
+		"created":    result.Created,
+	}).Info("Capsule exported to GitHub")
+
+	c.JSON(http.StatusCreated, result)
+}
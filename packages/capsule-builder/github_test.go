@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeGitHub implements the parts of the GitHub REST API an export uses.
+// Repositories are keyed by full name and hold their branch heads.
+type fakeGitHub struct {
+	mu    sync.Mutex
+	login string
+	orgs  map[string]bool
+	repos map[string]map[string]string // full name to branch to commit SHA
+	fail  map[string]int               // "METHOD path" to the status to fail with
+
+	calls   []string
+	created map[string]interface{} // body of the repository creation
+	tree    struct {
+		BaseTree string            `json:"base_tree"`
+		Tree     []githubTreeEntry `json:"tree"`
+	}
+	commit struct {
+		Message string   `json:"message"`
+		Tree    string   `json:"tree"`
+		Parents []string `json:"parents"`
+	}
+	auth []string
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	call := r.Method + " " + r.URL.Path
+	f.calls = append(f.calls, call)
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	if status, ok := f.fail[call]; ok {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"message": "failed by test"})
+		return
+	}
+
+	reply := func(v interface{}) { json.NewEncoder(w).Encode(v) }
+	notFound := func() {
+		w.WriteHeader(http.StatusNotFound)
+		reply(map[string]string{"message": "Not Found"})
+	}
+	repoJSON := func(fullName string) map[string]string {
+		return map[string]string{"full_name": fullName, "html_url": "https://github.test/" + fullName, "default_branch": "main"}
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case call == "GET /user":
+		reply(map[string]string{"login": f.login})
+	case r.Method == http.MethodPost && (call == "POST /user/repos" || len(parts) == 3 && parts[0] == "orgs"):
+		owner := f.login
+		if parts[0] == "orgs" {
+			if !f.orgs[parts[1]] {
+				notFound()
+				return
+			}
+			owner = parts[1]
+		}
+		json.NewDecoder(r.Body).Decode(&f.created)
+		name := owner + "/" + f.created["name"].(string)
+		f.repos[name] = map[string]string{"main": "sha-init"}
+		w.WriteHeader(http.StatusCreated)
+		reply(repoJSON(name))
+	case parts[0] == "repos" && len(parts) >= 3:
+		name := parts[1] + "/" + parts[2]
+		branches, ok := f.repos[name]
+		if !ok {
+			notFound()
+			return
+		}
+		rest := strings.Join(parts[3:], "/")
+		switch {
+		case r.Method == http.MethodGet && rest == "":
+			reply(repoJSON(name))
+		case r.Method == http.MethodGet && strings.HasPrefix(rest, "git/ref/heads/"):
+			sha, ok := branches[strings.TrimPrefix(rest, "git/ref/heads/")]
+			if !ok {
+				notFound()
+				return
+			}
+			reply(map[string]interface{}{"object": map[string]string{"sha": sha}})
+		case r.Method == http.MethodGet && strings.HasPrefix(rest, "git/commits/"):
+			sha := strings.TrimPrefix(rest, "git/commits/")
+			reply(map[string]interface{}{"sha": sha, "tree": map[string]string{"sha": "tree-of-" + sha}})
+		case call == "POST /repos/"+name+"/git/trees":
+			json.NewDecoder(r.Body).Decode(&f.tree)
+			reply(map[string]string{"sha": "tree-new"})
+		case call == "POST /repos/"+name+"/git/commits":
+			json.NewDecoder(r.Body).Decode(&f.commit)
+			reply(map[string]string{"sha": "sha-new", "html_url": "https://github.test/" + name + "/commit/sha-new"})
+		case call == "POST /repos/"+name+"/git/refs":
+			var ref struct{ Ref, SHA string }
+			json.NewDecoder(r.Body).Decode(&ref)
+			branches[strings.TrimPrefix(ref.Ref, "refs/heads/")] = ref.SHA
+			w.WriteHeader(http.StatusCreated)
+			reply(ref)
+		case r.Method == http.MethodPatch && strings.HasPrefix(rest, "git/refs/heads/"):
+			var ref struct{ SHA string }
+			json.NewDecoder(r.Body).Decode(&ref)
+			branches[strings.TrimPrefix(rest, "git/refs/heads/")] = ref.SHA
+			reply(ref)
+		default:
+			notFound()
+		}
+	default:
+		notFound()
+	}
+}
+
+// useGitHub serves a fake GitHub API to the export for one test
+func useGitHub(t *testing.T) *fakeGitHub {
+	t.Helper()
+	f := &fakeGitHub{
+		login: "octocat",
+		orgs:  map[string]bool{"quantum": true},
+		repos: map[string]map[string]string{"octocat/existing": {"main": "sha-main"}},
+		fail:  map[string]int{},
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	t.Setenv("GITHUB_API_URL", srv.URL)
+	return f
+}
+
+// storedCapsule puts a small capsule with an executable script in storage
+func storedCapsule(t *testing.T) *StructuredCapsule {
+	t.Helper()
+	capsule := &StructuredCapsule{
+		ID:   "capsule-gh",
+		Name: "hello",
+		Structure: map[string]FileContent{
+			"main.py": {Path: "main.py", Content: "print('hello')"},
+			"run.sh":  {Path: "run.sh", Content: "#!/bin/sh\npython main.py", Executable: true},
+		},
+		Metadata: CapsuleMetadata{Version: "1.0.0"},
+	}
+	capsuleStorage[capsule.ID] = capsule
+	t.Cleanup(func() { delete(capsuleStorage, capsule.ID) })
+	return capsule
+}
+
+func exportToGitHub(id, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/capsules/:id/export/github", handleExportGitHub)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/capsules/"+id+"/export/github", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestExportToExistingBranch(t *testing.T) {
+	gh := useGitHub(t)
+	storedCapsule(t)
+
+	w := exportToGitHub("capsule-gh", `{"token": "ghp_test", "owner": "octocat", "repo": "existing", "message": "Add hello"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d %s, want 201", w.Code, w.Body)
+	}
+	var result GitHubExportResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	want := GitHubExportResult{
+		RepositoryURL: "https://github.test/octocat/existing",
+		Branch:        "main",
+		CommitSHA:     "sha-new",
+		CommitURL:     "https://github.test/octocat/existing/commit/sha-new",
+		Files:         3,
+	}
+	if result != want {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+
+	// The commit goes on top of the branch head and moves the branch
+	if gh.tree.BaseTree != "tree-of-sha-main" || gh.commit.Tree != "tree-new" ||
+		len(gh.commit.Parents) != 1 || gh.commit.Parents[0] != "sha-main" || gh.commit.Message != "Add hello" {
+		t.Errorf("tree base %s, commit %+v", gh.tree.BaseTree, gh.commit)
+	}
+	if head := gh.repos["octocat/existing"]["main"]; head != "sha-new" {
+		t.Errorf("main = %s, want the new commit", head)
+	}
+
+	modes := map[string]string{}
+	for _, entry := range gh.tree.Tree {
+		modes[entry.Path] = entry.Mode
+		if entry.Type != "blob" {
+			t.Errorf("%s has type %s", entry.Path, entry.Type)
+		}
+	}
+	wantModes := map[string]string{"main.py": "100644", "run.sh": "100755", ".quantum/metadata.json": "100644"}
+	if !reflect.DeepEqual(modes, wantModes) {
+		t.Errorf("tree modes = %v, want %v", modes, wantModes)
+	}
+	for _, auth := range gh.auth {
+		if auth != "Bearer ghp_test" {
+			t.Errorf("Authorization = %q", auth)
+		}
+	}
+}
+
+func TestExportCreatesRepositoryAndBranch(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantRepo    string
+		wantCreate  string
+		wantBranch  string
+		wantPrivate bool
+	}{
+		{
+			name:       "user repository",
+			body:       `{"token": "t", "repo": "fresh"}`,
+			wantRepo:   "octocat/fresh",
+			wantCreate: "POST /user/repos",
+			wantBranch: "main",
+		},
+		{
+			name:        "organization repository on a new branch",
+			body:        `{"token": "t", "owner": "quantum", "repo": "fresh", "branch": "capsule", "private": true}`,
+			wantRepo:    "quantum/fresh",
+			wantCreate:  "POST /orgs/quantum/repos",
+			wantBranch:  "capsule",
+			wantPrivate: true,
+		},
+		{
+			// The owner is the token's user, which has no org endpoint
+			name:       "owner that isn't an organization",
+			body:       `{"token": "t", "owner": "octocat", "repo": "fresh"}`,
+			wantRepo:   "octocat/fresh",
+			wantCreate: "POST /user/repos",
+			wantBranch: "main",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := useGitHub(t)
+			storedCapsule(t)
+
+			w := exportToGitHub("capsule-gh", tt.body)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status = %d %s, want 201; calls %v", w.Code, w.Body, gh.calls)
+			}
+			var result GitHubExportResult
+			json.Unmarshal(w.Body.Bytes(), &result)
+			if !result.Created || result.Branch != tt.wantBranch || result.RepositoryURL != "https://github.test/"+tt.wantRepo {
+				t.Errorf("result = %+v", result)
+			}
+
+			created := false
+			for _, call := range gh.calls {
+				created = created || call == tt.wantCreate
+			}
+			if !created {
+				t.Errorf("calls = %v, want %s", gh.calls, tt.wantCreate)
+			}
+			if gh.created["auto_init"] != true || gh.created["private"] != tt.wantPrivate {
+				t.Errorf("created with %v", gh.created)
+			}
+
+			// A new branch starts from the default branch
+			branches := gh.repos[tt.wantRepo]
+			if branches[tt.wantBranch] != "sha-new" || gh.commit.Parents[0] != "sha-init" {
+				t.Errorf("branches = %v, parents %v", branches, gh.commit.Parents)
+			}
+			if tt.wantBranch != "main" && branches["main"] != "sha-init" {
+				t.Errorf("main moved to %s", branches["main"])
+			}
+		})
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		fail       string
+		status     int
+		wantStatus int
+		wantCode   string
+	}{
+		{"bad token", "GET /repos/octocat/existing", http.StatusUnauthorized, http.StatusUnauthorized, "unauthorized"},
+		{"no access", "POST /repos/octocat/existing/git/trees", http.StatusForbidden, http.StatusForbidden, "forbidden"},
+		{"empty repository", "GET /repos/octocat/existing/git/ref/heads/main", http.StatusConflict, http.StatusConflict, "conflict"},
+		{"rejected commit", "POST /repos/octocat/existing/git/commits", http.StatusUnprocessableEntity, http.StatusUnprocessableEntity, "unprocessable"},
+		{"GitHub outage", "PATCH /repos/octocat/existing/git/refs/heads/main", http.StatusInternalServerError, http.StatusBadGateway, "upstream_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh := useGitHub(t)
+			gh.fail[tt.fail] = tt.status
+			storedCapsule(t)
+
+			w := exportToGitHub("capsule-gh", `{"token": "t", "owner": "octocat", "repo": "existing"}`)
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), `"code":"`+tt.wantCode+`"`) {
+				t.Errorf("status = %d %s, want %d %s", w.Code, w.Body, tt.wantStatus, tt.wantCode)
+			}
+			if head := gh.repos["octocat/existing"]["main"]; head != "sha-main" {
+				t.Errorf("main moved to %s after a failed export", head)
+			}
+		})
+	}
+
+	useGitHub(t)
+	if w := exportToGitHub("capsule-missing", `{"token": "t", "repo": "existing"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown capsule = %d, want 404", w.Code)
+	}
+	storedCapsule(t)
+	if w := exportToGitHub("capsule-gh", `{"repo": "existing"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing token = %d, want 400", w.Code)
+	}
+}
@@ -3,8 +3,13 @@ module github.com/QuantumLayer-dev/quantumlayer-platform/packages/capsule-builde
 go 1.21
 
 require (
+	github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared v0.0.0
 	github.com/gin-gonic/gin v1.9.1
 	github.com/google/uuid v1.5.0
+	github.com/pelletier/go-toml/v2 v2.0.8
+	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/mod v0.10.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -22,14 +27,14 @@ require (
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
-	github.com/pelletier/go-toml/v2 v2.0.8 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.11 // indirect
 	golang.org/x/arch v0.3.0 // indirect
 	golang.org/x/crypto v0.9.0 // indirect
 	golang.org/x/net v0.10.0 // indirect
-	golang.org/x/sys v0.8.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	google.golang.org/protobuf v1.30.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared => ../shared
@@ -0,0 +1,788 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// Lint severities. Errors fail a strict build; warnings never do.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintFinding is a structural problem found in a capsule before packaging
+type LintFinding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Service  string `json:"service,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Message  string `json:"message"`
+}
+
+// LintReport lists a capsule's lint findings, errors first
+type LintReport struct {
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+	Findings []LintFinding `json:"findings"`
+}
+
+// lintProject is what the lint checks look at
+type lintProject struct {
+	Language     string
+	Type         string
+	StartCommand string
+	Structure    map[string]FileContent
+}
+
+// lintCheck is one structural check. Languages limits it to projects in
+// those languages; a check without languages runs on every project.
+type lintCheck struct {
+	Name      string
+	Languages []string
+	Run       func(p lintProject) []LintFinding
+}
+
+var lintChecks = []lintCheck{
+	{Name: "entrypoint", Run: lintEntrypoint},
+	{Name: "dockerfile", Run: lintDockerfile},
+	{Name: "manifest", Run: lintManifests},
+	{Name: "python-package", Languages: []string{"python"}, Run: lintPythonPackages},
+	{Name: "test-imports", Languages: []string{"python"}, Run: lintPythonTestImports},
+	{Name: "test-imports", Languages: []string{"javascript", "typescript"}, Run: lintNodeTestImports},
+	{Name: "test-imports", Languages: []string{"go"}, Run: lintGoTestImports},
+}
+
+func (check lintCheck) appliesTo(language string) bool {
+	if len(check.Languages) == 0 {
+		return true
+	}
+	for _, l := range check.Languages {
+		if strings.EqualFold(l, language) {
+			return true
+		}
+	}
+	return false
+}
+
+// lintCapsule runs every check that applies to the capsule's language
+func lintCapsule(capsule *StructuredCapsule) *LintReport {
+	p := lintProject{
+		Language:     strings.ToLower(capsule.Language),
+		Type:         capsule.Type,
+		StartCommand: capsule.Metadata.StartCommand,
+		Structure:    capsule.Structure,
+	}
+
+	report := &LintReport{Findings: []LintFinding{}}
+	for _, check := range lintChecks {
+		if !check.appliesTo(p.Language) {
+			continue
+		}
+		for _, finding := range check.Run(p) {
+			finding.Check = check.Name
+			report.add(finding)
+		}
+	}
+	report.sort()
+	return report
+}
+
+func (r *LintReport) add(finding LintFinding) {
+	switch finding.Severity {
+	case LintError:
+		r.Errors++
+	case LintWarning:
+		r.Warnings++
+	}
+	r.Findings = append(r.Findings, finding)
+}
+
+// merge adds a service's findings, with paths relative to the capsule root
+func (r *LintReport) merge(service, prefix string, other *LintReport) {
+	for _, finding := range other.Findings {
+		finding.Service = service
+		if finding.Path != "" {
+			finding.Path = prefix + finding.Path
+		}
+		r.add(finding)
+	}
+	r.sort()
+}
+
+func (r *LintReport) sort() {
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		a, b := r.Findings[i], r.Findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity == LintError
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Check < b.Check
+	})
+}
+
+// lintEntrypoint checks the start command runs a file the capsule has, and
+// that Go projects have a main package to build
+func lintEntrypoint(p lintProject) []LintFinding {
+	if p.Type == "library" {
+		return nil
+	}
+
+	var findings []LintFinding
+	if p.Language == "go" && !hasGoMain(p.Structure) {
+		findings = append(findings, LintFinding{
+			Severity: LintError,
+			Path:     "main.go",
+			Message:  "no file at the root declares package main with a main function, so there is nothing to build",
+		})
+	}
+
+	args := startArgs(p)
+	script := commandScript(args)
+	if script == "" {
+		return findings
+	}
+	if !hasScript(p.Structure, script) {
+		return append(findings, LintFinding{
+			Severity: LintError,
+			Path:     script,
+			Message:  fmt.Sprintf("start command %q runs %s, which isn't in the capsule", p.StartCommand, script),
+		})
+	}
+
+	mainFile := getMainFilePath(p.Language, p.Type)
+	if _, ok := p.Structure[mainFile]; ok && !sameScript(script, mainFile) {
+		findings = append(findings, LintFinding{
+			Severity: LintWarning,
+			Path:     script,
+			Message:  fmt.Sprintf("start command runs %s but the code was placed in %s", script, mainFile),
+		})
+	}
+
+	// An ASGI or WSGI server also needs the application object it names
+	if module, attr := serverApp(args); attr != "" {
+		file, ok := p.Structure[moduleFile(module)]
+		if !ok {
+			file = p.Structure[strings.ReplaceAll(module, ".", "/")+"/__init__.py"]
+		}
+		if !pythonDefines(file.Content, attr) {
+			findings = append(findings, LintFinding{
+				Severity: LintWarning,
+				Path:     file.Path,
+				Message:  fmt.Sprintf("start command serves %s:%s, but %s doesn't define %s", module, attr, file.Path, attr),
+			})
+		}
+	}
+	return findings
+}
+
+// startArgs splits the start command, following "npm start" to the start
+// script in package.json
+func startArgs(p lintProject) []string {
+	args := strings.Fields(p.StartCommand)
+	if len(args) < 2 || args[0] != "npm" || (args[1] != "start" && strings.Join(args[1:], " ") != "run start") {
+		return args
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal([]byte(p.Structure["package.json"].Content), &pkg); err != nil {
+		return nil
+	}
+	return strings.Fields(pkg.Scripts["start"])
+}
+
+// commandScript returns the project file a command runs, or "" when it
+// runs something installed or built
+func commandScript(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	switch path.Base(args[0]) {
+	case "python", "python3", "node":
+		for i, arg := range args[1:] {
+			if arg == "-m" {
+				// Only servers run as modules are followed to the app
+				return commandScript(args[i+2:])
+			}
+			if !strings.HasPrefix(arg, "-") {
+				return path.Clean(arg)
+			}
+		}
+	case "uvicorn", "gunicorn":
+		if module, _ := serverApp(args); module != "" {
+			return moduleFile(module)
+		}
+	case "sh", "bash":
+		for _, arg := range args[1:] {
+			if arg == "-c" {
+				return ""
+			}
+			if !strings.HasPrefix(arg, "-") {
+				return path.Clean(arg)
+			}
+		}
+	default:
+		// A script run directly, not a binary the build produced
+		if strings.HasPrefix(args[0], "./") && path.Ext(args[0]) != "" {
+			return path.Clean(args[0])
+		}
+	}
+	return ""
+}
+
+// serverApp returns the module and application an ASGI or WSGI server
+// command serves
+func serverApp(args []string) (module, attr string) {
+	if len(args) == 0 || (path.Base(args[0]) != "uvicorn" && path.Base(args[0]) != "gunicorn") {
+		return "", ""
+	}
+	for _, arg := range args[1:] {
+		if module, attr, ok := strings.Cut(arg, ":"); ok && !strings.HasPrefix(arg, "-") {
+			return module, attr
+		}
+	}
+	return "", ""
+}
+
+func moduleFile(module string) string {
+	return strings.ReplaceAll(module, ".", "/") + ".py"
+}
+
+// hasScript reports whether a script is in the capsule. A Python module may
+// be a package, and a JavaScript file may be compiled from the TypeScript
+// source next to it.
+func hasScript(structure map[string]FileContent, script string) bool {
+	if _, ok := structure[script]; ok {
+		return true
+	}
+	var alternative string
+	switch path.Ext(script) {
+	case ".py":
+		alternative = strings.TrimSuffix(script, ".py") + "/__init__.py"
+	case ".js":
+		alternative = strings.TrimSuffix(script, ".js") + ".ts"
+	default:
+		return false
+	}
+	_, ok := structure[alternative]
+	return ok
+}
+
+func sameScript(script, file string) bool {
+	return script == file || strings.TrimSuffix(script, ".js")+".ts" == file
+}
+
+// pythonDefines reports whether Python source assigns or defines name at
+// the top level
+func pythonDefines(source, name string) bool {
+	pattern := regexp.MustCompile(`(?m)^(?:` + regexp.QuoteMeta(name) + `\s*(?::[^=\n]*)?=[^=]|(?:async\s+)?def\s+` + regexp.QuoteMeta(name) + `\s*\(|from\s+\S+\s+import\s+.*\b` + regexp.QuoteMeta(name) + `\b)`)
+	return pattern.MatchString(source)
+}
+
+var (
+	goPackageMainPattern = regexp.MustCompile(`(?m)^package\s+main\b`)
+	goFuncMainPattern    = regexp.MustCompile(`(?m)^func\s+main\s*\(\s*\)`)
+)
+
+func hasGoMain(structure map[string]FileContent) bool {
+	for filePath, file := range structure {
+		if path.Dir(filePath) != "." || path.Ext(filePath) != ".go" || strings.HasSuffix(filePath, "_test.go") {
+			continue
+		}
+		if goPackageMainPattern.MatchString(file.Content) && goFuncMainPattern.MatchString(file.Content) {
+			return true
+		}
+	}
+	return false
+}
+
+// dockerInstruction is one Dockerfile instruction with its arguments
+type dockerInstruction struct {
+	Keyword string
+	Args    string
+}
+
+// dockerInstructions splits a Dockerfile into instructions, joining
+// continued lines and dropping comments
+func dockerInstructions(content string) []dockerInstruction {
+	var instructions []dockerInstruction
+	var current strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if current.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		if strings.HasSuffix(trimmed, "\\") {
+			current.WriteString(strings.TrimSuffix(trimmed, "\\") + " ")
+			continue
+		}
+		current.WriteString(trimmed)
+		keyword, args, _ := strings.Cut(current.String(), " ")
+		instructions = append(instructions, dockerInstruction{Keyword: strings.ToUpper(keyword), Args: strings.TrimSpace(args)})
+		current.Reset()
+	}
+	return instructions
+}
+
+// dockerArgs splits instruction arguments given in exec (JSON) or shell form
+func dockerArgs(args string) []string {
+	if strings.HasPrefix(args, "[") {
+		var exec []string
+		if err := json.Unmarshal([]byte(args), &exec); err == nil {
+			return exec
+		}
+	}
+	return strings.Fields(args)
+}
+
+// lintDockerfile checks the files the Dockerfile copies from the build
+// context and the script it runs are in the capsule
+func lintDockerfile(p lintProject) []LintFinding {
+	dockerfile, ok := p.Structure["Dockerfile"]
+	if !ok {
+		return nil
+	}
+
+	var findings []LintFinding
+	var entrypoint, cmd []string
+	fromStage := false
+	for _, in := range dockerInstructions(dockerfile.Content) {
+		switch in.Keyword {
+		case "FROM":
+			entrypoint, cmd, fromStage = nil, nil, false
+		case "COPY", "ADD":
+			sources, stage := copySources(dockerArgs(in.Args))
+			if stage {
+				fromStage = true
+				continue
+			}
+			for _, src := range sources {
+				if !inBuildContext(p.Structure, src) {
+					findings = append(findings, LintFinding{
+						Severity: LintError,
+						Path:     "Dockerfile",
+						Message:  fmt.Sprintf("%s source %s isn't in the capsule", in.Keyword, src),
+					})
+				}
+			}
+		case "ENTRYPOINT":
+			entrypoint = dockerArgs(in.Args)
+		case "CMD":
+			cmd = dockerArgs(in.Args)
+		}
+	}
+
+	// The final stage's command runs files copied from the build context.
+	// Artifacts copied from an earlier stage are built, not in the capsule.
+	if fromStage {
+		return findings
+	}
+	command := cmd
+	if len(entrypoint) > 0 {
+		command = append(entrypoint, cmd...)
+	}
+	script := commandScript(command)
+	if script == "" {
+		return findings
+	}
+	if !hasScript(p.Structure, script) {
+		return append(findings, LintFinding{
+			Severity: LintError,
+			Path:     "Dockerfile",
+			Message:  fmt.Sprintf("the container runs %s, which isn't in the capsule", script),
+		})
+	}
+	if start := commandScript(startArgs(p)); start != "" && start != script {
+		findings = append(findings, LintFinding{
+			Severity: LintWarning,
+			Path:     "Dockerfile",
+			Message:  fmt.Sprintf("the container runs %s but the start command runs %s", script, start),
+		})
+	}
+	return findings
+}
+
+// copySources returns the build context paths a COPY or ADD reads, or
+// reports that it copies from another stage
+func copySources(args []string) (sources []string, fromStage bool) {
+	var paths []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--from=") {
+			return nil, true
+		}
+		if !strings.HasPrefix(arg, "--") {
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) < 2 {
+		return nil, false
+	}
+	for _, src := range paths[:len(paths)-1] {
+		if !strings.Contains(src, "://") {
+			sources = append(sources, src)
+		}
+	}
+	return sources, false
+}
+
+// inBuildContext reports whether a COPY source matches a file or directory
+// in the capsule
+func inBuildContext(structure map[string]FileContent, src string) bool {
+	src = strings.TrimPrefix(path.Clean(src), "/")
+	if src == "." || src == "" {
+		return true
+	}
+	glob := strings.ContainsAny(src, "*?[")
+	for filePath := range structure {
+		if filePath == src || strings.HasPrefix(filePath, src+"/") {
+			return true
+		}
+		if matched, _ := path.Match(src, filePath); glob && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// lintManifests checks JSON, TOML and XML files and go.mod parse
+func lintManifests(p lintProject) []LintFinding {
+	var findings []LintFinding
+	for filePath, file := range p.Structure {
+		var err error
+		switch {
+		case path.Base(filePath) == "go.mod":
+			err = checkGoMod(filePath, file.Content)
+		case path.Ext(filePath) == ".json":
+			var v interface{}
+			err = json.Unmarshal([]byte(file.Content), &v)
+		case path.Ext(filePath) == ".toml":
+			var v map[string]interface{}
+			err = toml.Unmarshal([]byte(file.Content), &v)
+		case path.Ext(filePath) == ".xml":
+			err = checkXML(file.Content)
+		default:
+			continue
+		}
+		if err != nil {
+			findings = append(findings, LintFinding{
+				Severity: LintError,
+				Path:     filePath,
+				Message:  fmt.Sprintf("%s doesn't parse: %v", path.Base(filePath), err),
+			})
+		}
+	}
+	return findings
+}
+
+// checkGoMod parses a go.mod and checks its module path is importable
+func checkGoMod(filePath, content string) error {
+	f, err := modfile.ParseLax(filePath, []byte(content), nil)
+	if err != nil {
+		return err
+	}
+	if f.Module == nil {
+		return errors.New("no module directive")
+	}
+	return module.CheckImportPath(f.Module.Mod.Path)
+}
+
+func checkXML(content string) error {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	root := false
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			root = true
+		}
+	}
+	if !root {
+		return errors.New("no root element")
+	}
+	return nil
+}
+
+// lintPythonPackages checks every directory holding Python modules has an
+// __init__.py
+func lintPythonPackages(p lintProject) []LintFinding {
+	dirs := make(map[string]bool)
+	for filePath := range p.Structure {
+		if path.Ext(filePath) != ".py" {
+			continue
+		}
+		for dir := path.Dir(filePath); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	var findings []LintFinding
+	for dir := range dirs {
+		initFile := dir + "/__init__.py"
+		if _, ok := p.Structure[initFile]; ok {
+			continue
+		}
+		finding := LintFinding{
+			Severity: LintError,
+			Path:     initFile,
+			Message:  fmt.Sprintf("%s holds Python modules but isn't a package, so they can't be imported from it", dir),
+		}
+		if isTestDir(dir) {
+			// pytest puts a test directory that isn't a package on sys.path
+			// in place of the project root
+			finding.Severity = LintWarning
+			finding.Message = fmt.Sprintf("%s isn't a package, so pytest won't put the project root on sys.path for its tests", dir)
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+func isTestDir(dir string) bool {
+	for _, part := range strings.Split(dir, "/") {
+		if part == "tests" || part == "test" || part == "__tests__" {
+			return true
+		}
+	}
+	return false
+}
+
+// isTestFile reports whether a capsule file holds tests
+func isTestFile(file FileContent) bool {
+	base := path.Base(file.Path)
+	switch {
+	case file.Type == "test":
+		return true
+	case strings.HasSuffix(base, "_test.go"):
+		return true
+	case path.Ext(base) == ".py":
+		return base != "conftest.py" && (strings.HasPrefix(base, "test_") || strings.HasSuffix(base, "_test.py"))
+	default:
+		return strings.Contains(base, ".test.") || strings.Contains(base, ".spec.")
+	}
+}
+
+var (
+	pythonFromImportPattern = regexp.MustCompile(`(?m)^\s*from\s+([A-Za-z_][\w.]*)\s+import\b`)
+	pythonImportPattern     = regexp.MustCompile(`(?m)^\s*import\s+([^\n#;]+)`)
+)
+
+// pythonImports lists the absolute module imports in Python source
+func pythonImports(source string) []string {
+	var imports []string
+	for _, m := range pythonFromImportPattern.FindAllStringSubmatch(source, -1) {
+		imports = append(imports, m[1])
+	}
+	for _, m := range pythonImportPattern.FindAllStringSubmatch(source, -1) {
+		for _, name := range strings.Split(m[1], ",") {
+			name, _, _ = strings.Cut(strings.TrimSpace(name), " ")
+			if name != "" {
+				imports = append(imports, name)
+			}
+		}
+	}
+	return imports
+}
+
+// lintPythonTestImports checks tests import the project and that the
+// project modules they import exist
+func lintPythonTestImports(p lintProject) []LintFinding {
+	// Top-level names importable from the project root
+	local := make(map[string]bool)
+	for filePath, file := range p.Structure {
+		if path.Ext(filePath) != ".py" || isTestFile(file) {
+			continue
+		}
+		top, _, nested := strings.Cut(filePath, "/")
+		if !nested {
+			top = strings.TrimSuffix(top, ".py")
+		}
+		local[top] = true
+	}
+
+	var findings []LintFinding
+	for filePath, file := range p.Structure {
+		if path.Ext(filePath) != ".py" || !isTestFile(file) {
+			continue
+		}
+		imported := false
+		for _, name := range pythonImports(file.Content) {
+			top, _, _ := strings.Cut(name, ".")
+			if !local[top] {
+				continue
+			}
+			imported = true
+			if !hasPythonModule(p.Structure, name) {
+				findings = append(findings, LintFinding{
+					Severity: LintError,
+					Path:     filePath,
+					Message:  fmt.Sprintf("imports %s, which isn't in the capsule", name),
+				})
+			}
+		}
+		if !imported {
+			findings = append(findings, LintFinding{
+				Severity: LintWarning,
+				Path:     filePath,
+				Message:  "doesn't import any of the project's modules",
+			})
+		}
+	}
+	return findings
+}
+
+// hasPythonModule reports whether a dotted module name is a module or
+// package in the capsule
+func hasPythonModule(structure map[string]FileContent, name string) bool {
+	dir := strings.ReplaceAll(name, ".", "/")
+	if _, ok := structure[dir+".py"]; ok {
+		return true
+	}
+	for filePath := range structure {
+		if strings.HasPrefix(filePath, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+var nodeImportPattern = regexp.MustCompile(`(?:require\(\s*|import\(\s*|\bfrom\s+|\bimport\s+)['"]([^'"]+)['"]`)
+
+// nodeResolveSuffixes are tried in order when resolving a relative import
+var nodeResolveSuffixes = []string{"", ".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs", ".json", "/index.js", "/index.jsx", "/index.ts", "/index.tsx"}
+
+// lintNodeTestImports checks tests import the project and that their
+// relative imports resolve
+func lintNodeTestImports(p lintProject) []LintFinding {
+	var findings []LintFinding
+	for filePath, file := range p.Structure {
+		if !isTestFile(file) {
+			continue
+		}
+		imported := false
+		for _, m := range nodeImportPattern.FindAllStringSubmatch(file.Content, -1) {
+			spec := m[1]
+			if !strings.HasPrefix(spec, "./") && !strings.HasPrefix(spec, "../") {
+				continue
+			}
+			imported = true
+			if !resolvesNodeImport(p.Structure, path.Join(path.Dir(filePath), spec)) {
+				findings = append(findings, LintFinding{
+					Severity: LintError,
+					Path:     filePath,
+					Message:  fmt.Sprintf("imports %s, which doesn't resolve to a file in the capsule", spec),
+				})
+			}
+		}
+		if !imported {
+			findings = append(findings, LintFinding{
+				Severity: LintWarning,
+				Path:     filePath,
+				Message:  "doesn't import any of the project's modules",
+			})
+		}
+	}
+	return findings
+}
+
+func resolvesNodeImport(structure map[string]FileContent, target string) bool {
+	for _, suffix := range nodeResolveSuffixes {
+		if _, ok := structure[target+suffix]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lintGoTestImports checks test files belong to their directory's package
+// and that the module packages they import exist
+func lintGoTestImports(p lintProject) []LintFinding {
+	modulePath := modfile.ModulePath([]byte(p.Structure["go.mod"].Content))
+	fset := token.NewFileSet()
+
+	// The package each directory's code belongs to
+	packages := make(map[string]string)
+	for filePath, file := range p.Structure {
+		if path.Ext(filePath) != ".go" || strings.HasSuffix(filePath, "_test.go") {
+			continue
+		}
+		if f, err := parser.ParseFile(fset, filePath, file.Content, parser.PackageClauseOnly); err == nil {
+			packages[path.Dir(filePath)] = f.Name.Name
+		}
+	}
+
+	var findings []LintFinding
+	for filePath, file := range p.Structure {
+		if !strings.HasSuffix(filePath, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filePath, file.Content, parser.ImportsOnly)
+		if err != nil {
+			findings = append(findings, LintFinding{
+				Severity: LintError,
+				Path:     filePath,
+				Message:  fmt.Sprintf("doesn't parse: %v", err),
+			})
+			continue
+		}
+
+		dir := path.Dir(filePath)
+		if pkg, ok := packages[dir]; ok && f.Name.Name != pkg && f.Name.Name != pkg+"_test" {
+			findings = append(findings, LintFinding{
+				Severity: LintError,
+				Path:     filePath,
+				Message:  fmt.Sprintf("is package %s but the code beside it is package %s", f.Name.Name, pkg),
+			})
+		}
+
+		if modulePath == "" {
+			continue
+		}
+		for _, spec := range f.Imports {
+			importPath := strings.Trim(spec.Path.Value, `"`)
+			if importPath != modulePath && !strings.HasPrefix(importPath, modulePath+"/") {
+				continue
+			}
+			pkgDir := strings.TrimPrefix(strings.TrimPrefix(importPath, modulePath), "/")
+			if pkgDir == "" {
+				pkgDir = "."
+			}
+			pkg, ok := packages[pkgDir]
+			switch {
+			case !ok:
+				findings = append(findings, LintFinding{
+					Severity: LintError,
+					Path:     filePath,
+					Message:  fmt.Sprintf("imports %s, which isn't in the capsule", importPath),
+				})
+			case pkg == "main":
+				findings = append(findings, LintFinding{
+					Severity: LintError,
+					Path:     filePath,
+					Message:  fmt.Sprintf("imports %s, which is package main and can't be imported", importPath),
+				})
+			}
+		}
+	}
+	return findings
+}
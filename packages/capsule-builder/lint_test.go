@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// project lays out files by path for a lint check
+func project(language, projectType, start string, files map[string]string) lintProject {
+	structure := make(map[string]FileContent, len(files))
+	for path, content := range files {
+		structure[path] = FileContent{Path: path, Content: content}
+	}
+	return lintProject{Language: language, Type: projectType, StartCommand: start, Structure: structure}
+}
+
+// findings summarizes a check's findings as "severity path" for comparison
+func findings(got []LintFinding) []string {
+	summary := make([]string, 0, len(got))
+	for _, f := range got {
+		summary = append(summary, f.Severity+" "+f.Path)
+	}
+	return summary
+}
+
+func assertFindings(t *testing.T, got []LintFinding, want []string) {
+	t.Helper()
+	summary := findings(got)
+	if len(summary) != len(want) {
+		t.Fatalf("findings = %v, want %v: %+v", summary, want, got)
+	}
+	for _, w := range want {
+		found := false
+		for _, s := range summary {
+			found = found || s == w
+		}
+		if !found {
+			t.Fatalf("findings = %v, want %v: %+v", summary, want, got)
+		}
+	}
+}
+
+func TestLintEntrypoint(t *testing.T) {
+	tests := []struct {
+		name string
+		p    lintProject
+		want []string
+	}{
+		{
+			name: "python script",
+			p:    project("python", "cli", "python main.py", map[string]string{"main.py": "print('hi')"}),
+		},
+		{
+			name: "python script missing",
+			p:    project("python", "cli", "python main.py", map[string]string{"src/cli.py": "print('hi')"}),
+			want: []string{"error main.py"},
+		},
+		{
+			name: "uvicorn app",
+			p:    project("python", "api", "uvicorn main:app --reload", map[string]string{"main.py": "app = FastAPI()"}),
+		},
+		{
+			name: "uvicorn app not defined",
+			p:    project("python", "api", "uvicorn main:app --reload", map[string]string{"main.py": "application = FastAPI()"}),
+			want: []string{"warning main.py"},
+		},
+		{
+			name: "uvicorn package",
+			p:    project("python", "api", "uvicorn app:app", map[string]string{"app/__init__.py": "def app(scope): ..."}),
+		},
+		{
+			name: "npm start follows package.json",
+			p: project("javascript", "web", "npm start", map[string]string{
+				"package.json": `{"scripts": {"start": "node server.js"}}`,
+				"src/index.js": "",
+			}),
+			want: []string{"error server.js"},
+		},
+		{
+			name: "start command runs another file",
+			p: project("javascript", "api", "node server.js", map[string]string{
+				"index.js":  "",
+				"server.js": "",
+			}),
+			want: []string{"warning server.js"},
+		},
+		{
+			name: "compiled typescript",
+			p:    project("typescript", "api", "node index.js", map[string]string{"index.ts": ""}),
+		},
+		{
+			name: "go without main",
+			p:    project("go", "api", "./app", map[string]string{"main.go": "package server\n\nfunc Run() {}"}),
+			want: []string{"error main.go"},
+		},
+		{
+			name: "go main",
+			p:    project("go", "api", "./app", map[string]string{"main.go": "package main\n\nfunc main() {}"}),
+		},
+		{
+			name: "library",
+			p:    project("python", "library", "python main.py", map[string]string{"src/__init__.py": ""}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertFindings(t, lintEntrypoint(tt.p), tt.want)
+		})
+	}
+}
+
+func TestLintDockerfile(t *testing.T) {
+	tests := []struct {
+		name  string
+		start string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name:  "copies and runs project files",
+			start: "python main.py",
+			files: map[string]string{
+				"Dockerfile":       "FROM python:3.11\nCOPY requirements.txt .\nCOPY . .\nCMD [\"python\", \"main.py\"]",
+				"requirements.txt": "",
+				"main.py":          "",
+			},
+		},
+		{
+			name: "missing copy source",
+			files: map[string]string{
+				"Dockerfile":   "FROM node:18\nCOPY package*.json ./\nCOPY src/ ./src/\nCOPY config.yaml \\\n  /etc/app/\nCMD [\"node\", \"src/index.js\"]",
+				"src/index.js": "",
+			},
+			want: []string{"error Dockerfile", "error Dockerfile"},
+		},
+		{
+			name:  "runs a missing script",
+			start: "python main.py",
+			files: map[string]string{
+				"Dockerfile": "FROM python:3.11\nCOPY . .\nCMD python app.py",
+				"main.py":    "",
+			},
+			want: []string{"error Dockerfile"},
+		},
+		{
+			name:  "runs another script than the start command",
+			start: "python main.py",
+			files: map[string]string{
+				"Dockerfile": "FROM python:3.11\nCOPY . .\nENTRYPOINT [\"python\"]\nCMD [\"worker.py\"]",
+				"main.py":    "",
+				"worker.py":  "",
+			},
+			want: []string{"warning Dockerfile"},
+		},
+		{
+			name: "run script",
+			files: map[string]string{
+				"Dockerfile": "FROM alpine\n# Entrypoint\nCOPY . .\nCMD [\"./run.sh\"]",
+			},
+			want: []string{"error Dockerfile"},
+		},
+		{
+			name:  "built artifact",
+			start: "./app",
+			files: map[string]string{
+				"Dockerfile": "FROM golang AS builder\nCOPY go.* ./\nCOPY . .\nRUN go build -o app\nFROM alpine\nCOPY --from=builder /app/app .\nCMD [\"./app\"]",
+				"go.mod":     "module example.com/app",
+			},
+		},
+		{
+			name:  "no Dockerfile",
+			files: map[string]string{"main.py": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertFindings(t, lintDockerfile(project("", "api", tt.start, tt.files)), tt.want)
+		})
+	}
+}
+
+func TestLintManifests(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		wantErr bool
+	}{
+		{name: "package.json", path: "package.json", content: `{"name": "app"}`},
+		{name: "package.json with unescaped quote", path: "package.json", content: `{"description": "the "best" app"}`, wantErr: true},
+		{name: "pyproject.toml", path: "pyproject.toml", content: "[project]\nname = \"app\"\n"},
+		{name: "broken toml", path: "Cargo.toml", content: "[package\nname = \"app\"", wantErr: true},
+		{name: "pom.xml", path: "pom.xml", content: `<?xml version="1.0"?><project><artifactId>app</artifactId></project>`},
+		{name: "unclosed xml", path: "pom.xml", content: `<project><artifactId>app</project>`, wantErr: true},
+		{name: "go.mod", path: "go.mod", content: "module example.com/app\n\ngo 1.21\n"},
+		{name: "go.mod with local module", path: "go.mod", content: "module my-service\n\ngo 1.21\n"},
+		{name: "go.mod module with a space", path: "go.mod", content: "module my service\n\ngo 1.21\n", wantErr: true},
+		{name: "go.mod without module", path: "go.mod", content: "go 1.21\n", wantErr: true},
+		{name: "service go.mod", path: "services/api/go.mod", content: "module bad path!\n", wantErr: true},
+		{name: "other files", path: "main.py", content: "{"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lintManifests(project("", "", "", map[string]string{tt.path: tt.content}))
+			if (len(got) > 0) != tt.wantErr {
+				t.Fatalf("findings = %+v, want error %t", got, tt.wantErr)
+			}
+			if tt.wantErr && (got[0].Severity != LintError || got[0].Path != tt.path) {
+				t.Errorf("finding = %+v, want an error for %s", got[0], tt.path)
+			}
+		})
+	}
+}
+
+func TestLintPythonPackages(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name:  "packages",
+			files: map[string]string{"main.py": "", "app/__init__.py": "", "app/models.py": "", "tests/__init__.py": "", "tests/test_main.py": ""},
+		},
+		{
+			name:  "missing package marker",
+			files: map[string]string{"main.py": "", "app/models.py": "", "app/api/__init__.py": "", "app/api/routes.py": ""},
+			want:  []string{"error app/__init__.py"},
+		},
+		{
+			name:  "test directory",
+			files: map[string]string{"main.py": "", "tests/test_main.py": ""},
+			want:  []string{"warning tests/__init__.py"},
+		},
+		{
+			name:  "no python in directory",
+			files: map[string]string{"main.py": "", "static/app.js": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertFindings(t, lintPythonPackages(project("python", "api", "", tt.files)), tt.want)
+		})
+	}
+}
+
+func TestLintPythonTestImports(t *testing.T) {
+	tests := []struct {
+		name  string
+		tests string
+		want  []string
+	}{
+		{name: "from module", tests: "from main import app\n\ndef test_app(): ..."},
+		{name: "package module", tests: "import pytest\nimport app.models as models\n"},
+		{name: "missing module", tests: "from app.routes import router\n", want: []string{"error tests/test_main.py"}},
+		{name: "no project import", tests: "import pytest\n\ndef test_nothing(): ...", want: []string{"warning tests/test_main.py"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := project("python", "api", "", map[string]string{
+				"main.py":            "",
+				"app/__init__.py":    "",
+				"app/models.py":      "",
+				"tests/test_main.py": tt.tests,
+			})
+			assertFindings(t, lintPythonTestImports(p), tt.want)
+		})
+	}
+}
+
+func TestLintNodeTestImports(t *testing.T) {
+	tests := []struct {
+		name  string
+		tests string
+		want  []string
+	}{
+		{name: "require", tests: "const app = require('../index');"},
+		{name: "import directory", tests: "import request from 'supertest';\nimport { router } from '../src/routes';"},
+		{name: "unresolved", tests: "const app = require('../app');", want: []string{"error tests/main.test.js"}},
+		{name: "no project import", tests: "const request = require('supertest');", want: []string{"warning tests/main.test.js"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := project("javascript", "api", "", map[string]string{
+				"index.js":            "",
+				"src/routes/index.js": "",
+				"tests/main.test.js":  tt.tests,
+			})
+			assertFindings(t, lintNodeTestImports(p), tt.want)
+		})
+	}
+}
+
+func TestLintGoTestImports(t *testing.T) {
+	tests := []struct {
+		name  string
+		tests string
+		want  []string
+	}{
+		{name: "same package", tests: "package main\n\nimport \"testing\"\n"},
+		{name: "module package", tests: "package main\n\nimport \"example.com/app/handlers\"\n"},
+		{name: "wrong package", tests: "package app\n", want: []string{"error main_test.go"}},
+		{name: "missing package", tests: "package main\n\nimport \"example.com/app/models\"\n", want: []string{"error main_test.go"}},
+		{name: "imports main", tests: "package main_test\n\nimport \"example.com/app\"\n", want: []string{"error main_test.go"}},
+		{name: "syntax error", tests: "package main\n\nimport (\n", want: []string{"error main_test.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := project("go", "api", "", map[string]string{
+				"go.mod":               "module example.com/app\n",
+				"main.go":              "package main\n\nfunc main() {}",
+				"handlers/handlers.go": "package handlers",
+				"main_test.go":         tt.tests,
+			})
+			assertFindings(t, lintGoTestImports(p), tt.want)
+		})
+	}
+}
+
+func TestLintTemplates(t *testing.T) {
+	// The templates themselves mustn't trip the checks
+	tests := []BuildRequest{
+		{Language: "python", Framework: "fastapi", Type: "api", Name: "svc", Code: "from fastapi import FastAPI\napp = FastAPI()", Tests: "from main import app"},
+		{Language: "python", Type: "cli", Name: "svc", Code: "print('hi')"},
+		{Language: "javascript", Framework: "express", Type: "api", Name: "svc", Code: "module.exports = app;", Tests: "const app = require('../index');"},
+		{Language: "typescript", Framework: "express", Type: "api", Name: "svc", Code: "export default app;"},
+		{Language: "go", Framework: "gin", Type: "api", Name: "svc", Code: "package main\n\nfunc main() {}", Tests: "package main\n\nimport \"testing\""},
+		{Language: "java", Framework: "spring", Type: "api", Name: "svc", Code: "public class Main {}"},
+	}
+	for _, req := range tests {
+		t.Run(req.Language+"/"+req.Framework, func(t *testing.T) {
+			capsule := buildStructuredCapsule("capsule-1", req)
+			if capsule.Lint == nil || capsule.Lint.Errors != 0 {
+				t.Errorf("lint = %+v, want no errors", capsule.Lint)
+			}
+		})
+	}
+}
+
+func TestLintMultiServiceCapsule(t *testing.T) {
+	capsule := buildStructuredCapsule("capsule-1", BuildRequest{
+		Name: "shop",
+		Services: []ServiceSpec{
+			{Name: "api", Language: "go", Type: "api", Code: "package main\n\nfunc main() {}"},
+			{Name: "broken", Language: "go", Type: "api", Code: "package lib"},
+		},
+	})
+	if capsule.Lint.Errors != 1 {
+		t.Fatalf("lint = %+v, want one error", capsule.Lint)
+	}
+	if f := capsule.Lint.Findings[0]; f.Service != "broken" || f.Path != "services/broken/main.go" || f.Check != "entrypoint" {
+		t.Errorf("finding = %+v, want the broken service's entrypoint", f)
+	}
+}
+
+func TestBuildCapsuleStrict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/build", handleBuildCapsule)
+	build := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/build", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// A module name with a space breaks go.mod
+	body := `{"workflow_id": "wf-1", "language": "go", "type": "api", "name": "my service", "code": "package main\n\nfunc main() {}"%s}`
+
+	w := build(strings.Replace(body, "%s", "", 1))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+	var capsule StructuredCapsule
+	if err := json.Unmarshal(w.Body.Bytes(), &capsule); err != nil {
+		t.Fatal(err)
+	}
+	if capsule.Lint == nil || capsule.Lint.Errors != 1 || capsule.Lint.Findings[0].Path != "go.mod" {
+		t.Errorf("lint = %+v, want the go.mod error", capsule.Lint)
+	}
+
+	w = build(strings.Replace(body, "%s", `, "strict": true`, 1))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("strict status = %d, want 422: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Error struct {
+			Details LintReport `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error.Details.Errors != 1 {
+		t.Errorf("body = %s, want the lint report in the error details", w.Body.String())
+	}
+}
@@ -6,29 +6,47 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 )
 
-// BuildRequest represents a request to build a structured capsule
+// BuildRequest represents a request to build a structured capsule. A
+// multi-service capsule lists its services instead of giving the language,
+// type and code at the top level.
 type BuildRequest struct {
 	WorkflowID   string                 `json:"workflow_id" binding:"required"`
-	Language     string                 `json:"language" binding:"required"`
+	Language     string                 `json:"language" binding:"required_without=Services"`
 	Framework    string                 `json:"framework,omitempty"`
-	Type         string                 `json:"type" binding:"required"` // api, web, cli, library
+	Type         string                 `json:"type" binding:"required_without=Services"` // api, web, cli, library
 	Name         string                 `json:"name" binding:"required"`
 	Description  string                 `json:"description,omitempty"`
-	Code         string                 `json:"code" binding:"required"`
+	Code         string                 `json:"code" binding:"required_without=Services"`
 	Tests        string                 `json:"tests,omitempty"`
 	Dependencies []string               `json:"dependencies,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Services     []ServiceSpec          `json:"services,omitempty" binding:"omitempty,dive"`
+
+	// BackingServices names catalog services, such as postgres or redis,
+	// the capsule runs against through its docker-compose.yml
+	BackingServices []string `json:"backing_services,omitempty"`
+
+	// PinVersions set to false leaves dependencies without a version
+	// floating instead of pinning them to the latest release
+	PinVersions *bool `json:"pin_versions,omitempty"`
+
+	// Strict rejects a capsule with lint errors instead of building it
+	Strict bool `json:"strict,omitempty"`
 }
 
 // StructuredCapsule represents a fully organized project
@@ -44,6 +62,13 @@ type StructuredCapsule struct {
 	Metadata    CapsuleMetadata        `json:"metadata"`
 	CreatedAt   time.Time              `json:"created_at"`
 	Size        int64                  `json:"size"`
+
+	// InvalidDependencies lists the requested dependencies left out of
+	// the manifests
+	InvalidDependencies []DependencyIssue `json:"invalid_dependencies,omitempty"`
+
+	// Lint holds the structural problems found before packaging
+	Lint *LintReport `json:"lint,omitempty"`
 }
 
 // FileContent represents a file in the capsule
@@ -53,6 +78,9 @@ type FileContent struct {
 	Type        string `json:"type"` // source, test, config, doc, asset
 	Executable  bool   `json:"executable,omitempty"`
 	Description string `json:"description,omitempty"`
+
+	// Provenance is set for files taken from a workflow's drops
+	Provenance *FileProvenance `json:"provenance,omitempty"`
 }
 
 // CapsuleMetadata contains capsule metadata
@@ -89,10 +117,21 @@ type FileTemplate struct {
 var (
 	// Storage for built capsules (in production, use S3/MinIO)
 	capsuleStorage = make(map[string]*StructuredCapsule)
+
+	logger = logging.New("capsule-builder")
 )
 
 func main() {
-	r := gin.Default()
+	auth, err := authmiddleware.FromEnv()
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid authentication configuration")
+	}
+	if warning := auth.Warning(); warning != "" {
+		logger.Warn("Authentication: " + warning)
+	}
+
+	r := gin.New()
+	r.Use(logging.Middleware(logger), gin.Recovery(), authmiddleware.Middleware(auth))
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -107,10 +146,16 @@ func main() {
 		
 		// Get capsule structure
 		v1.GET("/capsules/:id", handleGetCapsule)
+
+		// Get the latest capsule built for a workflow
+		v1.GET("/workflows/:workflow_id/capsule", handleGetWorkflowCapsule)
 		
 		// Download capsule as tar.gz
 		v1.GET("/capsules/:id/download", handleDownloadCapsule)
-		
+
+		// Push capsule to a GitHub repository
+		v1.POST("/capsules/:id/export/github", handleExportGitHub)
+
 		// Get file from capsule
 		v1.GET("/capsules/:id/files/*path", handleGetFile)
 		
@@ -120,8 +165,14 @@ func main() {
 		// Preview capsule structure (without building)
 		v1.POST("/preview", handlePreviewStructure)
 		
+		// Compare the previews of two configurations
+		v1.POST("/preview/diff", handlePreviewDiff)
+		
 		// Build from workflow result
 		v1.POST("/build-from-workflow", handleBuildFromWorkflow)
+
+		// Build a multi-file capsule from all of a workflow's drops
+		v1.POST("/build-from-drops", handleBuildFromDrops)
 	}
 
 	port := os.Getenv("PORT")
@@ -129,36 +180,81 @@ func main() {
 		port = "8092"
 	}
 
-	log.Printf("Starting Capsule Builder on port %s", port)
+	logger.WithField("port", port).Info("Starting Capsule Builder")
 	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+		logger.WithError(err).Fatal("Failed to start server")
 	}
 }
 
 func handleBuildCapsule(c *gin.Context) {
 	var req BuildRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.RespondError(c, apierror.Validation(err.Error()))
 		return
 	}
+	if err := validateBuildRequest(req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+
+	invalid := pinRequestDependencies(c.Request.Context(), &req)
 
 	// Generate capsule ID
 	capsuleID := fmt.Sprintf("capsule-%s", uuid.New().String())
 
 	// Build structured capsule
 	capsule := buildStructuredCapsule(capsuleID, req)
+	capsule.InvalidDependencies = invalid
+
+	if req.Strict && capsule.Lint.Errors > 0 {
+		apierror.RespondError(c, apierror.Unprocessable(
+			fmt.Sprintf("capsule has %d lint errors", capsule.Lint.Errors)).WithDetails(capsule.Lint))
+		return
+	}
 
 	// Store capsule
 	capsuleStorage[capsuleID] = capsule
+	logCapsuleBuilt(capsule, req)
 
 	c.JSON(http.StatusCreated, capsule)
 }
 
+// logCapsuleBuilt records a new capsule. The submitted code and tests are
+// described by size and hash; their content is only logged at debug level.
+func logCapsuleBuilt(capsule *StructuredCapsule, req BuildRequest) {
+	logger.WithFields(logging.Content(logger, "code", req.Code)).
+		WithFields(logging.Content(logger, "tests", req.Tests)).
+		WithFields(logrus.Fields{
+			"capsule_id":  capsule.ID,
+			"workflow_id": capsule.WorkflowID,
+			"language":    capsule.Language,
+			"framework":   capsule.Framework,
+			"type":        capsule.Type,
+			"services":    len(req.Services),
+			"files":       len(capsule.Structure),
+			"size_bytes":  capsule.Size,
+			"lint_errors": capsule.Lint.Errors,
+		}).Info("Capsule built")
+}
+
 func buildStructuredCapsule(id string, req BuildRequest) *StructuredCapsule {
+	var capsule *StructuredCapsule
+	if len(req.Services) > 0 {
+		capsule = buildMultiServiceCapsule(id, req)
+	} else {
+		capsule = buildServiceCapsule(id, req)
+		addBackingServices(capsule, req)
+	}
+	stampReadmes(capsule)
+	return capsule
+}
+
+// buildServiceCapsule lays out a single service from its template
+func buildServiceCapsule(id string, req BuildRequest) *StructuredCapsule {
 	structure := make(map[string]FileContent)
 	
 	// Get template for the language/framework/type combination
-	template := getProjectTemplate(req.Language, req.Framework, req.Type)
+	template := requestTemplate(req)
 	
 	// Apply template to generate structure
 	for _, file := range template.Files {
@@ -189,6 +285,12 @@ func buildStructuredCapsule(id string, req BuildRequest) *StructuredCapsule {
 		}
 	}
 
+	// Document the code's routes and models in the README
+	if readme, ok := structure["README.md"]; ok {
+		readme.Content = withCodeDocs(readme.Content, extractCodeDocs(req.Language, req.Code))
+		structure["README.md"] = readme
+	}
+
 	// Create metadata
 	metadata := CapsuleMetadata{
 		Version:      "1.0.0",
@@ -207,7 +309,7 @@ func buildStructuredCapsule(id string, req BuildRequest) *StructuredCapsule {
 		totalSize += int64(len(file.Content))
 	}
 
-	return &StructuredCapsule{
+	capsule := &StructuredCapsule{
 		ID:          id,
 		WorkflowID:  req.WorkflowID,
 		Name:        req.Name,
@@ -220,6 +322,8 @@ func buildStructuredCapsule(id string, req BuildRequest) *StructuredCapsule {
 		CreatedAt:   time.Now(),
 		Size:        totalSize,
 	}
+	capsule.Lint = lintCapsule(capsule)
+	return capsule
 }
 
 func getProjectTemplate(language, framework, projectType string) ProjectTemplate {
@@ -516,8 +620,9 @@ func generateFileContent(file FileTemplate, req BuildRequest) string {
 		"Language":     req.Language,
 		"Framework":    req.Framework,
 		"Type":         req.Type,
-		"Dependencies": req.Dependencies,
+		"Dependencies": manifestDependencies(req.Language, req.Dependencies),
 		"Metadata":     req.Metadata,
+		"Env":          appEnvironment(req.BackingServices),
 	}
 
 	if err := tmpl.Execute(&buf, data); err != nil {
@@ -663,19 +768,38 @@ func handleGetCapsule(c *gin.Context) {
 
 	capsule, exists := capsuleStorage[id]
 	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "capsule not found"})
+		apierror.RespondError(c, apierror.NotFound("capsule not found"))
 		return
 	}
 
 	c.JSON(http.StatusOK, capsule)
 }
 
+// handleGetWorkflowCapsule returns the most recently built capsule for a
+// workflow
+func handleGetWorkflowCapsule(c *gin.Context) {
+	workflowID := c.Param("workflow_id")
+
+	var latest *StructuredCapsule
+	for _, capsule := range capsuleStorage {
+		if capsule.WorkflowID == workflowID && (latest == nil || capsule.CreatedAt.After(latest.CreatedAt)) {
+			latest = capsule
+		}
+	}
+	if latest == nil {
+		apierror.RespondError(c, apierror.NotFound("no capsule built for workflow"))
+		return
+	}
+
+	c.JSON(http.StatusOK, latest)
+}
+
 func handleDownloadCapsule(c *gin.Context) {
 	id := c.Param("id")
 
 	capsule, exists := capsuleStorage[id]
 	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "capsule not found"})
+		apierror.RespondError(c, apierror.NotFound("capsule not found"))
 		return
 	}
 
@@ -698,12 +822,14 @@ func handleDownloadCapsule(c *gin.Context) {
 		}
 
 		if err := tarWriter.WriteHeader(header); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to write tar header"})
+			logger.WithError(err).WithField("capsule_id", id).Error("Failed to write tar header")
+			apierror.RespondError(c, apierror.Internal("failed to write tar header"))
 			return
 		}
 
 		if _, err := tarWriter.Write([]byte(file.Content)); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to write tar content"})
+			logger.WithError(err).WithField("capsule_id", id).Error("Failed to write tar content")
+			apierror.RespondError(c, apierror.Internal("failed to write tar content"))
 			return
 		}
 	}
@@ -735,13 +861,13 @@ func handleGetFile(c *gin.Context) {
 
 	capsule, exists := capsuleStorage[id]
 	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "capsule not found"})
+		apierror.RespondError(c, apierror.NotFound("capsule not found"))
 		return
 	}
 
 	file, exists := capsule.Structure[strings.TrimPrefix(filePath, "/")]
 	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		apierror.RespondError(c, apierror.NotFound("file not found"))
 		return
 	}
 
@@ -800,46 +926,114 @@ func handleListTemplates(c *gin.Context) {
 	})
 }
 
-func handlePreviewStructure(c *gin.Context) {
-	var req BuildRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+// PreviewFile is a file a build request would emit
+type PreviewFile struct {
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Size    int    `json:"size"`
+	content string
+}
+
+// PreviewDiffRequest holds the two build configurations to compare
+type PreviewDiffRequest struct {
+	Base   BuildRequest `json:"base" binding:"required"`
+	Target BuildRequest `json:"target" binding:"required"`
+}
+
+// FileChange describes a file emitted by both configurations that differs
+type FileChange struct {
+	Path       string `json:"path"`
+	BaseType   string `json:"base_type"`
+	TargetType string `json:"target_type"`
+	BaseSize   int    `json:"base_size"`
+	TargetSize int    `json:"target_size"`
+}
+
+// previewFiles lists the files a build request would emit, in the order
+// buildStructuredCapsule writes them
+func previewFiles(req BuildRequest) []PreviewFile {
+	if len(req.Services) > 0 {
+		structure, _ := buildServicesStructure(req)
+		files := make([]PreviewFile, 0, len(structure))
+		for _, file := range structure {
+			files = append(files, PreviewFile{
+				Path:    file.Path,
+				Type:    file.Type,
+				Size:    len(file.Content),
+				content: file.Content,
+			})
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+		return files
 	}
 
 	// Get template
-	template := getProjectTemplate(req.Language, req.Framework, req.Type)
+	template := requestTemplate(req)
 
 	// Build file list
-	files := make([]map[string]interface{}, 0, len(template.Files)+2)
+	files := make([]PreviewFile, 0, len(template.Files)+2)
 
 	// Add template files
+	docs := extractCodeDocs(req.Language, req.Code)
 	for _, file := range template.Files {
-		files = append(files, map[string]interface{}{
-			"path": file.Path,
-			"type": file.Type,
-			"size": len(generateFileContent(file, req)),
+		content := generateFileContent(file, req)
+		if file.Path == "README.md" {
+			content = withCodeDocs(content, docs)
+		}
+		files = append(files, PreviewFile{
+			Path:    file.Path,
+			Type:    file.Type,
+			Size:    len(content),
+			content: content,
 		})
 	}
 
 	// Add main code file
 	mainFile := getMainFilePath(req.Language, req.Type)
-	files = append(files, map[string]interface{}{
-		"path": mainFile,
-		"type": "source",
-		"size": len(req.Code),
+	files = append(files, PreviewFile{
+		Path:    mainFile,
+		Type:    "source",
+		Size:    len(req.Code),
+		content: req.Code,
 	})
 
 	// Add test file if provided
 	if req.Tests != "" {
 		testFile := getTestFilePath(req.Language)
-		files = append(files, map[string]interface{}{
-			"path": testFile,
-			"type": "test",
-			"size": len(req.Tests),
+		files = append(files, PreviewFile{
+			Path:    testFile,
+			Type:    "test",
+			Size:    len(req.Tests),
+			content: req.Tests,
 		})
 	}
 
+	if len(req.BackingServices) > 0 {
+		content := generateAppCompose(req)
+		files = append(files, PreviewFile{
+			Path:    "docker-compose.yml",
+			Type:    "config",
+			Size:    len(content),
+			content: content,
+		})
+	}
+
+	return files
+}
+
+func handlePreviewStructure(c *gin.Context) {
+	var req BuildRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	if err := validateBuildRequest(req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+
+	files := previewFiles(req)
+
 	c.JSON(http.StatusOK, gin.H{
 		"name":      req.Name,
 		"language":  req.Language,
@@ -847,56 +1041,113 @@ func handlePreviewStructure(c *gin.Context) {
 		"type":      req.Type,
 		"files":     files,
 		"total":     len(files),
+		// The README footer with the workflow ID and build time is added on
+		// build, so previews of the same request compare equal
+		"readme_enrichment": readmeEnrichment(req),
 	})
 }
 
-func handleBuildFromWorkflow(c *gin.Context) {
-	var req struct {
-		WorkflowID string `json:"workflow_id" binding:"required"`
-	}
-
+// handlePreviewDiff compares the files two build configurations would emit
+func handlePreviewDiff(c *gin.Context) {
+	var req PreviewDiffRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.RespondError(c, apierror.Validation(err.Error()))
 		return
 	}
+	for _, r := range []BuildRequest{req.Base, req.Target} {
+		if err := validateBuildRequest(r); err != nil {
+			apierror.RespondError(c, apierror.Validation(err.Error()))
+			return
+		}
+	}
+
+	added, removed, changed, unchanged := diffPreviews(previewFiles(req.Base), previewFiles(req.Target))
 
-	// Fetch workflow result from QuantumDrops service
-	dropsURL := os.Getenv("QUANTUM_DROPS_URL")
-	if dropsURL == "" {
-		dropsURL = "http://quantum-drops.quantumlayer.svc.cluster.local:8090"
+	c.JSON(http.StatusOK, gin.H{
+		"added":     added,
+		"removed":   removed,
+		"changed":   changed,
+		"unchanged": unchanged,
+		"summary": gin.H{
+			"added":     len(added),
+			"removed":   len(removed),
+			"changed":   len(changed),
+			"unchanged": len(unchanged),
+		},
+	})
+}
+
+// diffPreviews compares two previews by path. A file is changed when its
+// type or content differs. Results are sorted by path.
+func diffPreviews(base, target []PreviewFile) (added, removed []PreviewFile, changed []FileChange, unchanged []string) {
+	// Later entries win, as they do when the capsule is built
+	baseFiles := make(map[string]PreviewFile, len(base))
+	for _, file := range base {
+		baseFiles[file.Path] = file
+	}
+	targetFiles := make(map[string]PreviewFile, len(target))
+	for _, file := range target {
+		targetFiles[file.Path] = file
 	}
 
-	resp, err := http.Get(fmt.Sprintf("%s/api/v1/workflows/%s/drops", dropsURL, req.WorkflowID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch workflow drops"})
-		return
+	added, removed, changed, unchanged = []PreviewFile{}, []PreviewFile{}, []FileChange{}, []string{}
+	for path, file := range targetFiles {
+		previous, ok := baseFiles[path]
+		switch {
+		case !ok:
+			added = append(added, file)
+		case previous.Type != file.Type || previous.content != file.content:
+			changed = append(changed, FileChange{
+				Path:       path,
+				BaseType:   previous.Type,
+				TargetType: file.Type,
+				BaseSize:   previous.Size,
+				TargetSize: file.Size,
+			})
+		default:
+			unchanged = append(unchanged, path)
+		}
+	}
+	for path, file := range baseFiles {
+		if _, ok := targetFiles[path]; !ok {
+			removed = append(removed, file)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusNotFound, gin.H{"error": "workflow drops not found"})
-		return
+	sort.Slice(added, func(i, j int) bool { return added[i].Path < added[j].Path })
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Path < removed[j].Path })
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Path < changed[j].Path })
+	sort.Strings(unchanged)
+	return added, removed, changed, unchanged
+}
+
+// handleBuildFromWorkflow builds a capsule from the code and tests a
+// workflow stored as drops. The caller may pass the language, framework and
+// type the workflow was started with, which the drops don't record.
+func handleBuildFromWorkflow(c *gin.Context) {
+	var req struct {
+		WorkflowID string `json:"workflow_id" binding:"required"`
+		Language   string `json:"language,omitempty"`
+		Framework  string `json:"framework,omitempty"`
+		Type       string `json:"type,omitempty"`
+		Name       string `json:"name,omitempty"`
 	}
 
-	// Parse drops
-	var drops struct {
-		Drops []struct {
-			Type     string `json:"type"`
-			Artifact string `json:"artifact"`
-			Stage    string `json:"stage"`
-		} `json:"drops"`
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&drops); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse drops"})
+	drops, err := fetchWorkflowDrops(req.WorkflowID)
+	if err != nil {
+		apierror.RespondError(c, err)
 		return
 	}
 
 	// Extract code and test drops
 	var code, tests string
-	var language, framework, projectType string
 
-	for _, drop := range drops.Drops {
+	for _, drop := range drops {
 		switch drop.Type {
 		case "code":
 			code = drop.Artifact
@@ -907,14 +1158,23 @@ func handleBuildFromWorkflow(c *gin.Context) {
 			// TODO: Extract language, framework, type from FRD
 		}
 	}
+	if code == "" {
+		apierror.RespondError(c, apierror.Unprocessable("workflow has no code drop to package"))
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("project-%s", req.WorkflowID)
+	}
 
 	// Build request from drops
 	buildReq := BuildRequest{
 		WorkflowID:  req.WorkflowID,
-		Language:    language,
-		Framework:   framework,
-		Type:        projectType,
-		Name:        fmt.Sprintf("project-%s", req.WorkflowID),
+		Language:    req.Language,
+		Framework:   req.Framework,
+		Type:        req.Type,
+		Name:        name,
 		Code:        code,
 		Tests:       tests,
 	}
@@ -925,6 +1185,7 @@ func handleBuildFromWorkflow(c *gin.Context) {
 
 	// Store capsule
 	capsuleStorage[capsuleID] = capsule
+	logCapsuleBuilt(capsule, buildReq)
 
 	c.JSON(http.StatusCreated, capsule)
 }
@@ -1072,8 +1333,8 @@ build/
 
 	envTemplate = `# Environment Variables
 PORT=8080
-DATABASE_URL=
-API_KEY=
+{{range .Env}}{{.Name}}={{.Value}}
+{{end}}API_KEY=
 DEBUG=false`
 
 	packageJSONTemplate = `{
@@ -1088,7 +1349,7 @@ DEBUG=false`
   },
   "dependencies": {
     {{range $i, $dep := .Dependencies}}{{if $i}},{{end}}
-    "{{$dep}}": "latest"{{end}}
+    "{{$dep.Name}}": "{{$dep.Version}}"{{end}}
   },
   "devDependencies": {
     "jest": "^29.0.0",
@@ -1118,7 +1379,7 @@ DEBUG=false`
 go 1.21
 
 require (
-	{{range .Dependencies}}{{.}}
+	{{range .Dependencies}}{{.Name}} {{.Version}}
 	{{end}}
 )`
 
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postJSON serves one JSON POST to path with handler
+func postJSON(path string, handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST(path, handler)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func previewPaths(files []PreviewFile) []string {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestPreviewMatchesBuild(t *testing.T) {
+	req := BuildRequest{
+		WorkflowID: "wf-1",
+		Language:   "python",
+		Framework:  "fastapi",
+		Type:       "api",
+		Name:       "svc",
+		Code:       "print('hello')\n",
+		Tests:      "def test_hello(): pass\n",
+	}
+	files := previewFiles(req)
+
+	capsule := buildStructuredCapsule("capsule-1", req)
+	var built []string
+	for path := range capsule.Structure {
+		built = append(built, path)
+	}
+	sort.Strings(built)
+	if got := previewPaths(files); !reflect.DeepEqual(got, built) {
+		t.Errorf("preview lists %v, build writes %v", got, built)
+	}
+
+	for _, file := range files {
+		switch file.Path {
+		case "main.py":
+			if file.Type != "source" || file.Size != len(req.Code) {
+				t.Errorf("main.py = %s, %d bytes", file.Type, file.Size)
+			}
+		case "tests/test_main.py":
+			if file.Type != "test" || file.Size != len(req.Tests) {
+				t.Errorf("tests/test_main.py = %s, %d bytes", file.Type, file.Size)
+			}
+		}
+		if file.Size != len(file.content) {
+			t.Errorf("%s size %d, content %d bytes", file.Path, file.Size, len(file.content))
+		}
+	}
+}
+
+func TestDiffPreviews(t *testing.T) {
+	base := []PreviewFile{
+		{Path: "README.md", Type: "documentation", Size: 6, content: "# svc\n"},
+		{Path: "main.py", Type: "source", Size: 5, content: "pass\n"},
+		{Path: "setup.py", Type: "config", Size: 2, content: "{}"},
+		{Path: "Dockerfile", Type: "config", Size: 4, content: "FROM"},
+	}
+	target := []PreviewFile{
+		{Path: "main.py", Type: "source", Size: 13, content: "print('hi')\n"},
+		{Path: "README.md", Type: "documentation", Size: 6, content: "# svc\n"},
+		{Path: "tests/test_main.py", Type: "test", Size: 5, content: "pass\n"},
+		{Path: "setup.py", Type: "source", Size: 2, content: "{}"},
+		// A later entry for the same path replaces the earlier one
+		{Path: "Dockerfile", Type: "config", Size: 3, content: "RUN"},
+		{Path: "Dockerfile", Type: "config", Size: 4, content: "FROM"},
+	}
+
+	added, removed, changed, unchanged := diffPreviews(base, target)
+	if got := previewPaths(added); !reflect.DeepEqual(got, []string{"tests/test_main.py"}) {
+		t.Errorf("added = %v", got)
+	}
+	if len(removed) != 0 {
+		t.Errorf("removed = %v, want none", previewPaths(removed))
+	}
+	wantChanged := []FileChange{
+		{Path: "main.py", BaseType: "source", TargetType: "source", BaseSize: 5, TargetSize: 13},
+		// Same content under another type still counts as a change
+		{Path: "setup.py", BaseType: "config", TargetType: "source", BaseSize: 2, TargetSize: 2},
+	}
+	if !reflect.DeepEqual(changed, wantChanged) {
+		t.Errorf("changed = %+v, want %+v", changed, wantChanged)
+	}
+	if !reflect.DeepEqual(unchanged, []string{"Dockerfile", "README.md"}) {
+		t.Errorf("unchanged = %v", unchanged)
+	}
+
+	added, removed, changed, unchanged = diffPreviews(target, base)
+	if len(added) != 0 || !reflect.DeepEqual(previewPaths(removed), []string{"tests/test_main.py"}) || len(changed) != 2 || len(unchanged) != 2 {
+		t.Errorf("reversed diff = added %v, removed %v, changed %v, unchanged %v", previewPaths(added), previewPaths(removed), changed, unchanged)
+	}
+}
+
+func TestPreviewDiff(t *testing.T) {
+	base := `{"workflow_id": "wf-1", "language": "python", "type": "api", "name": "svc", "code": "print('a')"}`
+	tests := []struct {
+		name                    string
+		target                  string
+		added, removed, changed []string
+	}{
+		{
+			name:   "identical",
+			target: base,
+		},
+		{
+			name:    "new code and tests",
+			target:  `{"workflow_id": "wf-1", "language": "python", "type": "api", "name": "svc", "code": "print('b')\n", "tests": "def test(): pass"}`,
+			added:   []string{"tests/test_main.py"},
+			changed: []string{"main.py"},
+		},
+		{
+			name:    "another language",
+			target:  `{"workflow_id": "wf-1", "language": "go", "type": "api", "name": "svc", "code": "package main"}`,
+			added:   []string{"main.go"},
+			removed: []string{"main.py"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON("/api/v1/preview/diff", handlePreviewDiff, `{"base": `+base+`, "target": `+tt.target+`}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Added     []PreviewFile  `json:"added"`
+				Removed   []PreviewFile  `json:"removed"`
+				Changed   []FileChange   `json:"changed"`
+				Unchanged []string       `json:"unchanged"`
+				Summary   map[string]int `json:"summary"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			contains := func(paths []string, want []string) bool {
+				set := make(map[string]bool, len(paths))
+				for _, p := range paths {
+					set[p] = true
+				}
+				for _, p := range want {
+					if !set[p] {
+						return false
+					}
+				}
+				return true
+			}
+			var changed []string
+			for _, c := range resp.Changed {
+				changed = append(changed, c.Path)
+			}
+			if !contains(previewPaths(resp.Added), tt.added) || !contains(previewPaths(resp.Removed), tt.removed) || !contains(changed, tt.changed) {
+				t.Errorf("added %v, removed %v, changed %v; want at least %v, %v, %v",
+					previewPaths(resp.Added), previewPaths(resp.Removed), changed, tt.added, tt.removed, tt.changed)
+			}
+			if tt.target == base && (len(resp.Added)+len(resp.Removed)+len(resp.Changed) != 0 || len(resp.Unchanged) == 0) {
+				t.Errorf("identical configurations differ: %s", w.Body)
+			}
+			want := map[string]int{"added": len(resp.Added), "removed": len(resp.Removed), "changed": len(resp.Changed), "unchanged": len(resp.Unchanged)}
+			if !reflect.DeepEqual(resp.Summary, want) {
+				t.Errorf("summary = %v, want %v", resp.Summary, want)
+			}
+		})
+	}
+
+	if w := postJSON("/api/v1/preview/diff", handlePreviewDiff, `{"base": `+base+`}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing target = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ServiceSpec describes one service of a multi-service capsule
+type ServiceSpec struct {
+	Name         string   `json:"name" binding:"required"`
+	Language     string   `json:"language" binding:"required"`
+	Framework    string   `json:"framework,omitempty"`
+	Type         string   `json:"type" binding:"required"` // api, web, cli, library
+	Description  string   `json:"description,omitempty"`
+	Code         string   `json:"code" binding:"required"`
+	Tests        string   `json:"tests,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+	Port         int      `json:"port,omitempty"`
+}
+
+// serviceNamePattern keeps service names usable as directory and compose
+// service names
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// validateServices checks service names are safe and unique
+func validateServices(services []ServiceSpec) error {
+	seen := make(map[string]bool, len(services))
+	for _, svc := range services {
+		if !serviceNamePattern.MatchString(svc.Name) {
+			return fmt.Errorf("service name %q must be lowercase letters, digits, '-' or '_'", svc.Name)
+		}
+		if seen[svc.Name] {
+			return fmt.Errorf("duplicate service name %q", svc.Name)
+		}
+		seen[svc.Name] = true
+	}
+	return nil
+}
+
+// buildRequest returns the single-service request used to lay out svc
+func (svc ServiceSpec) buildRequest(parent BuildRequest) BuildRequest {
+	description := svc.Description
+	if description == "" {
+		description = parent.Description
+	}
+	return BuildRequest{
+		WorkflowID:   parent.WorkflowID,
+		Language:     svc.Language,
+		Framework:    svc.Framework,
+		Type:         svc.Type,
+		Name:         svc.Name,
+		Description:  description,
+		Code:         svc.Code,
+		Tests:        svc.Tests,
+		Dependencies: svc.Dependencies,
+		Metadata:     parent.Metadata,
+		// Each service's .env.example lists what the compose file injects
+		BackingServices: parent.BackingServices,
+	}
+}
+
+// buildServicesStructure lays out each service under services/<name>/ as it
+// would be built on its own, and adds a docker-compose.yml and README
+// covering all of them. Each service is linted on its own.
+func buildServicesStructure(req BuildRequest) (map[string]FileContent, *LintReport) {
+	structure := make(map[string]FileContent)
+	lint := &LintReport{Findings: []LintFinding{}}
+	for _, svc := range req.Services {
+		prefix := "services/" + svc.Name + "/"
+		service := buildServiceCapsule("", svc.buildRequest(req))
+		for path, file := range service.Structure {
+			file.Path = prefix + path
+			structure[file.Path] = file
+		}
+		lint.merge(svc.Name, prefix, service.Lint)
+	}
+
+	structure["docker-compose.yml"] = FileContent{
+		Path:        "docker-compose.yml",
+		Content:     generateCompose(req.Services, req.BackingServices),
+		Type:        "config",
+		Description: "Runs all services together",
+	}
+	structure["README.md"] = FileContent{
+		Path:    "README.md",
+		Content: generateServicesReadme(req),
+		Type:    "doc",
+	}
+	return structure, lint
+}
+
+// servicePorts assigns each service a port: the requested one, or the
+// language default. Host ports are bumped past ports already taken so
+// services with the same default can run side by side.
+func servicePorts(services []ServiceSpec) (container, host map[string]int) {
+	container = make(map[string]int, len(services))
+	host = make(map[string]int, len(services))
+	taken := make(map[int]bool, len(services))
+
+	// Explicit ports are claimed first so defaults move out of their way
+	for _, svc := range services {
+		if svc.Port > 0 {
+			container[svc.Name] = svc.Port
+			host[svc.Name] = svc.Port
+			taken[svc.Port] = true
+		}
+	}
+	for _, svc := range services {
+		if svc.Port > 0 {
+			continue
+		}
+		port := getDefaultPort(svc.Language)
+		container[svc.Name] = port
+		for taken[port] {
+			port++
+		}
+		host[svc.Name] = port
+		taken[port] = true
+	}
+	return container, host
+}
+
+func getDefaultPort(language string) int {
+	switch strings.ToLower(language) {
+	case "python":
+		return 8000
+	case "javascript", "typescript":
+		return 3000
+	default:
+		return 8080
+	}
+}
+
+// generateCompose wires the services together, each built from its own
+// directory, with the backing services they share
+func generateCompose(services []ServiceSpec, backing []string) string {
+	container, host := servicePorts(services)
+
+	apps := make([]composeApp, 0, len(services))
+	for _, svc := range services {
+		apps = append(apps, composeApp{
+			Name:     svc.Name,
+			Build:    "./services/" + svc.Name,
+			Listens:  listens(svc.Type),
+			Port:     container[svc.Name],
+			HostPort: host[svc.Name],
+		})
+	}
+	return writeCompose(apps, backing)
+}
+
+func generateServicesReadme(req BuildRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", req.Name)
+	if req.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", req.Description)
+	}
+	b.WriteString("## Services\n\n")
+
+	for _, svc := range req.Services {
+		stack := svc.Language
+		if svc.Framework != "" {
+			stack += "/" + svc.Framework
+		}
+		fmt.Fprintf(&b, "- `services/%s` - %s %s\n", svc.Name, stack, svc.Type)
+	}
+	if len(req.BackingServices) > 0 {
+		b.WriteString("\n## Backing services\n\n")
+		for _, name := range req.BackingServices {
+			fmt.Fprintf(&b, "- `%s` - %s\n", name, backingServiceCatalog[name].Image)
+		}
+	}
+
+	b.WriteString("\n## Running\n\n```bash\ndocker compose up --build\n```\n")
+	return b.String()
+}
+
+// buildMultiServiceCapsule builds a capsule with one directory per service
+func buildMultiServiceCapsule(id string, req BuildRequest) *StructuredCapsule {
+	structure, lint := buildServicesStructure(req)
+
+	var dependencies []string
+	for _, svc := range req.Services {
+		dependencies = append(dependencies, svc.Dependencies...)
+	}
+	dependencies = append(dependencies, req.Dependencies...)
+
+	var totalSize int64
+	for _, file := range structure {
+		totalSize += int64(len(file.Content))
+	}
+
+	return &StructuredCapsule{
+		ID:          id,
+		WorkflowID:  req.WorkflowID,
+		Name:        req.Name,
+		Language:    req.Language,
+		Framework:   req.Framework,
+		Type:        req.Type,
+		Description: req.Description,
+		Structure:   structure,
+		Metadata: CapsuleMetadata{
+			Version:      "1.0.0",
+			Author:       "QuantumLayer Platform",
+			License:      "MIT",
+			Dependencies: dependencies,
+			Scripts: map[string]string{
+				"build": "docker compose build",
+				"start": "docker compose up",
+			},
+			BuildCommand: "docker compose build",
+			StartCommand: "docker compose up",
+		},
+		CreatedAt: time.Now(),
+		Size:      totalSize,
+		Lint:      lint,
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []string
+		wantErr  string
+	}{
+		{"none", nil, ""},
+		{"valid", []string{"api", "worker_2", "web-ui"}, ""},
+		{"uppercase", []string{"API"}, `service name "API" must be`},
+		{"path", []string{"../api"}, `service name "../api" must be`},
+		{"leading dash", []string{"-api"}, `service name "-api" must be`},
+		{"empty", []string{""}, `service name "" must be`},
+		{"duplicate", []string{"api", "worker", "api"}, `duplicate service name "api"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := make([]ServiceSpec, len(tt.services))
+			for i, name := range tt.services {
+				services[i] = ServiceSpec{Name: name}
+			}
+			err := validateServices(services)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServicePorts(t *testing.T) {
+	container, host := servicePorts([]ServiceSpec{
+		{Name: "api", Language: "python"},
+		{Name: "admin", Language: "python"},
+		{Name: "web", Language: "javascript", Port: 8000},
+		{Name: "worker", Language: "go"},
+	})
+
+	// The explicit port is claimed first; defaults move past taken host
+	// ports but keep listening on their own port inside the container
+	wantContainer := map[string]int{"api": 8000, "admin": 8000, "web": 8000, "worker": 8080}
+	wantHost := map[string]int{"api": 8001, "admin": 8002, "web": 8000, "worker": 8080}
+	if !reflect.DeepEqual(container, wantContainer) {
+		t.Errorf("container ports = %v, want %v", container, wantContainer)
+	}
+	if !reflect.DeepEqual(host, wantHost) {
+		t.Errorf("host ports = %v, want %v", host, wantHost)
+	}
+}
+
+func shopRequest() BuildRequest {
+	return BuildRequest{
+		WorkflowID:  "wf-shop",
+		Name:        "shop",
+		Description: "Online shop",
+		Services: []ServiceSpec{
+			{Name: "api", Language: "python", Framework: "fastapi", Type: "api", Code: "print('api')", Tests: "def test_api(): pass"},
+			{Name: "worker", Language: "python", Type: "cli", Code: "print('worker')", Dependencies: []string{"celery"}},
+			{Name: "web", Language: "javascript", Type: "web", Code: "console.log('web')", Port: 8000},
+		},
+		Dependencies: []string{"shared-lib"},
+	}
+}
+
+func TestMultiServiceCapsule(t *testing.T) {
+	capsule := buildStructuredCapsule("capsule-1", shopRequest())
+
+	// Each service is laid out under its own directory as if built alone
+	for _, path := range []string{
+		"services/api/main.py", "services/api/tests/test_main.py", "services/api/Dockerfile",
+		"services/worker/main.py", "services/worker/Dockerfile",
+		"services/web/src/index.js", "services/web/package.json",
+		"docker-compose.yml", "README.md",
+	} {
+		if _, ok := capsule.Structure[path]; !ok {
+			t.Errorf("no %s", path)
+		}
+	}
+	for path, file := range capsule.Structure {
+		if file.Path != path {
+			t.Errorf("%s has path %s", path, file.Path)
+		}
+		if path != "docker-compose.yml" && path != "README.md" && !strings.HasPrefix(path, "services/") {
+			t.Errorf("%s is outside services/", path)
+		}
+	}
+	if got := capsule.Structure["services/worker/main.py"].Content; got != "print('worker')" {
+		t.Errorf("worker main.py = %q", got)
+	}
+
+	compose := capsule.Structure["docker-compose.yml"].Content
+	for _, want := range []string{
+		"build: ./services/api", "build: ./services/worker", "build: ./services/web",
+		`"8001:8000"`, `"8000:8000"`,
+	} {
+		if !strings.Contains(compose, want) {
+			t.Errorf("docker-compose.yml has no %s:\n%s", want, compose)
+		}
+	}
+
+	readme := capsule.Structure["README.md"].Content
+	for _, want := range []string{"# shop", "Online shop", "- `services/api` - python/fastapi api", "- `services/web` - javascript web"} {
+		if !strings.Contains(readme, want) {
+			t.Errorf("README has no %q:\n%s", want, readme)
+		}
+	}
+
+	if !reflect.DeepEqual(capsule.Metadata.Dependencies, []string{"celery", "shared-lib"}) {
+		t.Errorf("dependencies = %v", capsule.Metadata.Dependencies)
+	}
+	var size int64
+	for _, file := range capsule.Structure {
+		size += int64(len(file.Content))
+	}
+	if capsule.Size != size {
+		t.Errorf("size = %d, want %d", capsule.Size, size)
+	}
+}
+
+func TestBuildMultiServiceCapsule(t *testing.T) {
+	// Without dependencies, so nothing is looked up in package registries
+	req := shopRequest()
+	req.Dependencies = nil
+	for i := range req.Services {
+		req.Services[i].Dependencies = nil
+	}
+	valid, _ := json.Marshal(req)
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"services", string(valid), http.StatusCreated},
+		{"duplicate services", `{"workflow_id": "wf", "name": "shop", "services": [
+			{"name": "api", "language": "go", "type": "api", "code": "package main"},
+			{"name": "api", "language": "go", "type": "api", "code": "package main"}]}`, http.StatusBadRequest},
+		{"unsafe service name", `{"workflow_id": "wf", "name": "shop", "services": [
+			{"name": "../api", "language": "go", "type": "api", "code": "package main"}]}`, http.StatusBadRequest},
+		{"service without code", `{"workflow_id": "wf", "name": "shop", "services": [
+			{"name": "api", "language": "go", "type": "api"}]}`, http.StatusBadRequest},
+		{"neither services nor code", `{"workflow_id": "wf", "name": "shop"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON("/api/v1/build", handleBuildCapsule, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			if w.Code != http.StatusCreated {
+				return
+			}
+			var capsule StructuredCapsule
+			if err := json.Unmarshal(w.Body.Bytes(), &capsule); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := capsule.Structure["services/web/src/index.js"]; !ok {
+				t.Errorf("built capsule has no web service")
+			}
+			if _, ok := capsuleStorage[capsule.ID]; !ok {
+				t.Errorf("capsule %s was not stored", capsule.ID)
+			}
+		})
+	}
+}
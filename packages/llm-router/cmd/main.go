@@ -11,12 +11,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/llm-router/internal/embeddings"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/llm-router/internal/models"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/llm-router/internal/redact"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/llm-router/internal/routing"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/llm-router/internal/templates"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
@@ -24,8 +30,41 @@ import (
 var (
 	logger        *zap.Logger
 	bedrockClient *bedrockruntime.Client
+
+	// redactor scrubs secrets and PII from prompt and response text before
+	// it is logged
+	redactor *redact.Redactor
+
+	// routingPolicy picks the Azure OpenAI deployment for /generate requests
+	routingPolicy routing.Policy
+
+	// modelRegistry describes the deployments /generate can route to
+	modelRegistry *models.Registry
+
+	// templateStore holds the prompt templates /generate can render
+	templateStore templates.Store
+
+	// embeddingService serves /api/v1/embeddings
+	embeddingService *embeddings.Service
 )
 
+// chatMessage is one message of a chat completion
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// defaultTemperature is used when neither the request nor its template
+// sets one
+const defaultTemperature = 0.7
+
+// defaultMaxTokens is the completion budget of requests that don't set one
+const defaultMaxTokens = 1000
+
+// servedProviders are the providers /generate calls, so the only ones
+// automatic routing may pick
+var servedProviders = []string{"azure"}
+
 func main() {
 	// Production logger
 	var err error
@@ -34,6 +73,34 @@ func main() {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 	defer logger.Sync()
+
+	redactor, err = redact.FromEnv()
+	if err != nil {
+		logger.Fatal("Failed to initialize redaction", zap.Error(err))
+	}
+	logger.Info("Log redaction configured", zap.Bool("enabled", redactor.Enabled()))
+
+	routingPolicy, err = routing.FromEnv()
+	if err != nil {
+		logger.Fatal("Failed to load model routing policy", zap.Error(err))
+	}
+	logger.Info("Model routing configured", zap.Any("tasks", routingPolicy.Tasks))
+
+	modelRegistry, err = models.FromEnv()
+	if err != nil {
+		logger.Fatal("Failed to load model registry", zap.Error(err))
+	}
+	names := make([]string, 0, len(modelRegistry.Models))
+	for _, m := range modelRegistry.Models {
+		names = append(names, m.Name)
+	}
+	logger.Info("Model registry loaded", zap.Strings("models", names))
+	for task, model := range routingPolicy.Tasks {
+		if _, ok := modelRegistry.Lookup(model); !ok {
+			logger.Warn("Routed model is missing from the registry, its context window is not checked",
+				zap.String("task", task), zap.String("model", model))
+		}
+	}
 	
 	// Initialize AWS Bedrock client
 	initBedrock()
@@ -60,6 +127,23 @@ func main() {
 		}
 	}
 
+	// Keep prompt templates in Redis when it is available so every replica
+	// renders the same versions
+	if redisClient != nil {
+		templateStore = templates.NewRedisStore(redisClient)
+	} else {
+		logger.Warn("Prompt templates are kept in memory and will be lost on restart")
+		templateStore = templates.NewMemoryStore()
+	}
+
+	// Embeddings are cached per input in Redis when it is available
+	var embeddingCache embeddings.Cache
+	if redisClient != nil {
+		embeddingCache = embeddings.NewRedisCache(redisClient)
+	}
+	embeddingService = newEmbeddingService(embeddingCache)
+	logger.Info("Embeddings configured", zap.Strings("providers", embeddingService.Providers()))
+
 	// THIS IS THE ISSUE: We need to use the llmrouter package Server
 	// But first, let's create a simple working server with real endpoints
 	
@@ -69,6 +153,9 @@ func main() {
 	http.HandleFunc("/api/v1/complete", completeHandler)
 	http.HandleFunc("/v1/chat/completions", completeHandler) // OpenAI compatible
 	http.HandleFunc("/generate", generateHandler) // Workflow compatible
+	templates.NewHandler(templateStore).Register(http.DefaultServeMux)
+	models.NewHandler(modelRegistry).Register(http.DefaultServeMux)
+	embeddings.NewHandler(embeddingService).Register(http.DefaultServeMux)
 	
 	// Start server
 	srv := &http.Server{
@@ -140,6 +227,21 @@ func initBedrock() {
 	logger.Info("Initialized AWS Bedrock client", zap.String("region", region))
 }
 
+// newEmbeddingService embeds with Azure OpenAI when it is configured and
+// Bedrock Titan when its client is, trying them in that order
+func newEmbeddingService(cache embeddings.Cache) *embeddings.Service {
+	var embedders []embeddings.Embedder
+	if endpoint, apiKey := os.Getenv("AZURE_OPENAI_ENDPOINT"), os.Getenv("AZURE_OPENAI_KEY"); endpoint != "" && apiKey != "" {
+		embedders = append(embedders, embeddings.NewAzureEmbedder(endpoint, apiKey,
+			getEnv("AZURE_OPENAI_EMBEDDING_DEPLOYMENT", embeddings.DefaultAzureDeployment)))
+	}
+	if bedrockClient != nil {
+		embedders = append(embedders, embeddings.NewBedrockEmbedder(bedrockClient,
+			getEnv("AWS_BEDROCK_EMBEDDING_MODEL", embeddings.DefaultBedrockModel)))
+	}
+	return embeddings.NewService(logger, cache, embedders...)
+}
+
 func completeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -174,6 +276,10 @@ func completeHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	prompt += "\n\nAssistant:"
+	logger.Debug("Completion request",
+		zap.String("prompt", redactor.Preview(prompt, 500)),
+		zap.Int("max_tokens", req.MaxTokens),
+	)
 	
 	// Call AWS Bedrock if client is initialized
 	var responseContent string
@@ -227,19 +333,48 @@ func generateHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// The workflow sends messages in OpenAI format with provider field
 	var req struct {
-		Messages []struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"messages"`
-		MaxTokens   int     `json:"max_tokens,omitempty"`
-		Provider    string  `json:"provider,omitempty"`
-		Temperature float64 `json:"temperature,omitempty"`
+		Messages    []chatMessage `json:"messages"`
+		MaxTokens   int           `json:"max_tokens,omitempty"`
+		Provider    string        `json:"provider,omitempty"`
+		Temperature float64       `json:"temperature,omitempty"`
+		Task        string        `json:"task,omitempty"`  // code, summarize, classify, reason, ...
+		Model       string        `json:"model,omitempty"` // overrides the task's deployment
+		// Routing selects the model from the registry, unless Model is set
+		Routing *models.Routing `json:"routing,omitempty"`
+		// Template is rendered into a final user message
+		Template *templates.Ref `json:"template,omitempty"`
 	}
 	
 	if err := json.Unmarshal(body, &req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+
+	// Render the template; its defaults apply to anything the request
+	// doesn't set
+	var tmpl *templates.Template
+	if req.Template != nil {
+		tmpl, err = templateStore.Get(r.Context(), req.Template.Name, req.Template.Version)
+		var prompt string
+		if err == nil {
+			prompt, err = tmpl.Render(req.Template.Variables)
+		}
+		if err != nil {
+			templates.WriteRenderError(w, err)
+			return
+		}
+
+		req.Messages = append(req.Messages, chatMessage{Role: "user", Content: prompt})
+		if req.Model == "" && req.Task == "" && req.Routing == nil {
+			req.Model, req.Task = tmpl.Model, tmpl.Task
+		}
+		if req.MaxTokens == 0 {
+			req.MaxTokens = tmpl.MaxTokens
+		}
+		if req.Temperature == 0 {
+			req.Temperature = tmpl.Temperature
+		}
+	}
 	
 	// Build prompt for Claude - extract user content
 	var userContent string
@@ -249,21 +384,51 @@ func generateHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	
-	// Always use Azure OpenAI
+	logger.Debug("Generate request",
+		zap.String("prompt", redactor.Preview(userContent, 500)),
+		zap.String("provider", req.Provider),
+		zap.Int("max_tokens", req.MaxTokens),
+		zap.Bool("template", tmpl != nil),
+	)
+
+	// Always use Azure OpenAI. The deployment is the explicit model, else
+	// the one automatic routing selects, else the task's; a request too
+	// large for it is rejected before calling Azure.
 	var responseContent string
-	// Try different deployments based on request needs
-	deployment := os.Getenv("AZURE_OPENAI_DEPLOYMENT")
-	if deployment == "" {
-		// Default to gpt-4.1 for best quality
-		deployment = "gpt-4.1"
-	}
-	
-	// For faster responses, use gpt-4.1-mini or gpt-35-turbo
-	if req.MaxTokens > 0 && req.MaxTokens < 500 {
-		deployment = "gpt-4.1-mini" // Faster for smaller responses
+	tokens := models.Tokens{Prompt: promptTokens(req.Messages), Completion: req.MaxTokens}
+	if tokens.Completion == 0 {
+		tokens.Completion = defaultMaxTokens
+	}
+	var deployment, reason string
+	var selection *models.Selection
+	if req.Routing != nil && req.Model == "" {
+		sel, err := modelRegistry.Select(*req.Routing, tokens, servedProviders...)
+		if err != nil {
+			models.WriteSelectionError(w, err)
+			return
+		}
+		selection = &sel
+		deployment, reason = sel.Model, sel.Rationale
+	} else {
+		route, err := routingPolicy.Route(req.Task, req.Model, req.MaxTokens)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := modelRegistry.CheckContext(route.Model, tokens); err != nil {
+			models.WriteSelectionError(w, err)
+			return
+		}
+		deployment, reason = route.Model, route.Reason
 	}
+	logger.Debug("Routed generate request",
+		zap.String("task", req.Task),
+		zap.String("deployment", deployment),
+		zap.String("reason", reason),
+		zap.Int("prompt_tokens", tokens.Prompt),
+	)
 	
-	responseContent = callAzureOpenAIWithDeployment(req.Messages, req.MaxTokens, deployment)
+	responseContent = callAzureOpenAIWithDeployment(req.Messages, req.MaxTokens, req.Temperature, deployment)
 	
 	// Return workflow-compatible response (simple format with content field)
 	w.Header().Set("Content-Type", "application/json")
@@ -274,13 +439,39 @@ func generateHandler(w http.ResponseWriter, r *http.Request) {
 			"completion_tokens": len(responseContent) / 4,
 			"total_tokens":      (len(userContent) + len(responseContent)) / 4,
 		},
-		"model":    deployment,
-		"provider": "azure",
+		"model":          deployment,
+		"routing_reason": reason,
+		"provider":       "azure",
+	}
+	if selection != nil {
+		response["routing"] = selection
+	}
+
+	// Record the call against the template version that was rendered
+	if tmpl != nil {
+		response["template"] = map[string]interface{}{"name": tmpl.Name, "version": tmpl.Version}
+		usage := templates.Usage{
+			PromptTokens:     len(userContent) / 4,
+			CompletionTokens: len(responseContent) / 4,
+			Failed:           strings.HasPrefix(responseContent, "Error:"),
+		}
+		if err := templateStore.RecordUsage(r.Context(), tmpl.Name, tmpl.Version, usage); err != nil {
+			logger.Warn("Failed to record template usage", zap.String("template", tmpl.Name), zap.Error(err))
+		}
 	}
 	
 	json.NewEncoder(w).Encode(response)
 }
 
+// promptTokens estimates the prompt tokens of a chat request
+func promptTokens(messages []chatMessage) int {
+	contents := make([]string, len(messages))
+	for i, msg := range messages {
+		contents[i] = msg.Content
+	}
+	return models.EstimateTokens(contents...)
+}
+
 func callBedrock(prompt string, maxTokens int) string {
 	if maxTokens == 0 {
 		maxTokens = 1000
@@ -310,7 +501,7 @@ func callBedrock(prompt string, maxTokens int) string {
 	})
 	
 	if err != nil {
-		logger.Error("Bedrock API call failed", zap.Error(err))
+		logger.Error("Bedrock API call failed", zap.String("error", redactor.String(err.Error())))
 		return fmt.Sprintf("Error: %v", err)
 	}
 	
@@ -363,7 +554,7 @@ func callBedrockMessages(userContent string, maxTokens int) string {
 	})
 	
 	if err != nil {
-		logger.Error("Bedrock API call failed", zap.Error(err))
+		logger.Error("Bedrock API call failed", zap.String("error", redactor.String(err.Error())))
 		return fmt.Sprintf("Error: %v", err)
 	}
 	
@@ -383,12 +574,12 @@ func callBedrockMessages(userContent string, maxTokens int) string {
 		}
 	}
 	
-	logger.Error("Unexpected response format", zap.Any("response", resp))
+	logger.Error("Unexpected response format", zap.String("response", redactor.JSON(resp)))
 	return "Error: Unexpected response format"
 }
 
 // callAzureOpenAIWithDeployment calls Azure OpenAI API with specific deployment
-func callAzureOpenAIWithDeployment(messages []struct{Role string `json:"role"`; Content string `json:"content"`}, maxTokens int, deployment string) string {
+func callAzureOpenAIWithDeployment(messages []chatMessage, maxTokens int, temperature float64, deployment string) string {
 	endpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")
 	apiKey := os.Getenv("AZURE_OPENAI_KEY")
 	
@@ -398,7 +589,10 @@ func callAzureOpenAIWithDeployment(messages []struct{Role string `json:"role"`;
 	}
 	
 	if maxTokens == 0 {
-		maxTokens = 1000
+		maxTokens = defaultMaxTokens
+	}
+	if temperature == 0 {
+		temperature = defaultTemperature
 	}
 	
 	// Build request URL
@@ -408,7 +602,7 @@ func callAzureOpenAIWithDeployment(messages []struct{Role string `json:"role"`;
 	requestBody := map[string]interface{}{
 		"messages": messages,
 		"max_tokens": maxTokens,
-		"temperature": 0.7,
+		"temperature": temperature,
 	}
 	
 	reqBody, err := json.Marshal(requestBody)
@@ -464,11 +658,11 @@ func callAzureOpenAIWithDeployment(messages []struct{Role string `json:"role"`;
 	// Check for error in response
 	if errorInfo, ok := azureResp["error"].(map[string]interface{}); ok {
 		if msg, ok := errorInfo["message"].(string); ok {
-			logger.Error("Azure API error", zap.String("error", msg))
+			logger.Error("Azure API error", zap.String("error", redactor.String(msg)))
 			return fmt.Sprintf("Error: Azure API: %s", msg)
 		}
 	}
 	
-	logger.Error("Unexpected Azure response format", zap.Any("response", azureResp))
+	logger.Error("Unexpected Azure response format", zap.String("response", redactor.JSON(azureResp)))
 	return "Error: Unexpected Azure response format"
 }
\ No newline at end of file
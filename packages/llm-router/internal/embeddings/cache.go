@@ -0,0 +1,74 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cacheTTL is how long a vector stays cached; an input's vector never
+// changes for a given model
+const cacheTTL = 7 * 24 * time.Hour
+
+// Cache holds vectors by key
+type Cache interface {
+	// Get returns the vector of each key, nil where there is none
+	Get(ctx context.Context, keys []string) ([][]float32, error)
+	Set(ctx context.Context, vectors map[string][]float32) error
+}
+
+// RedisCache keeps vectors in Redis as little-endian float32s
+type RedisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache caches vectors with an existing Redis client
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (c *RedisCache) Get(ctx context.Context, keys []string) ([][]float32, error) {
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([][]float32, len(keys))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			vectors[i] = decodeVector([]byte(s))
+		}
+	}
+	return vectors, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, vectors map[string][]float32) error {
+	pipe := c.client.Pipeline()
+	for key, vector := range vectors {
+		pipe.Set(ctx, key, encodeVector(vector), cacheTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return data
+}
+
+// decodeVector returns nil for data that isn't a whole number of floats
+func decodeVector(data []byte) []float32 {
+	if len(data) == 0 || len(data)%4 != 0 {
+		return nil
+	}
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector
+}
@@ -0,0 +1,355 @@
+// Package embeddings turns text into vectors with Azure OpenAI or Bedrock
+// Titan, batching inputs to what each provider accepts in one call and
+// caching each input's vector
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/llm-router/internal/models"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/llm-router/internal/redact"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// Limits of one request
+const (
+	// MaxInputs is how many strings one request may embed
+	MaxInputs = 256
+	// MaxInputTokens is the estimated size limit of each string, the
+	// smallest context of the supported embedding models
+	MaxInputTokens = 8000
+	// maxConcurrentBatches bounds the provider calls one request makes at
+	// once
+	maxConcurrentBatches = 4
+)
+
+var (
+	// ErrUnknownProvider is a request for a provider that isn't configured
+	ErrUnknownProvider = errors.New("embeddings provider is not configured")
+	// ErrNoProviders means no embeddings provider is configured at all
+	ErrNoProviders = errors.New("no embeddings provider is configured")
+)
+
+// InputError is a request the guards reject before calling a provider
+type InputError struct {
+	// TooLarge is set when the request exceeds a limit rather than being
+	// malformed
+	TooLarge bool
+	Message  string
+}
+
+func (e *InputError) Error() string {
+	return e.Message
+}
+
+// ProviderError is a request every candidate provider failed
+type ProviderError struct {
+	Failures map[string]string
+}
+
+func (e *ProviderError) Error() string {
+	failures := make([]string, 0, len(e.Failures))
+	for name, msg := range e.Failures {
+		failures = append(failures, name+": "+msg)
+	}
+	sort.Strings(failures)
+	return "embeddings failed: " + strings.Join(failures, "; ")
+}
+
+// Request asks for the embeddings of Input
+type Request struct {
+	Input []string `json:"input"`
+	// Model is a hint: a deployment or model ID the provider uses if it
+	// serves it, in place of its default
+	Model string `json:"model,omitempty"`
+	// Provider pins the request to azure or bedrock. Pinned requests never
+	// fail over, since vectors from different models can't be compared.
+	Provider string `json:"provider,omitempty"`
+}
+
+// Embedding is the vector of the input at Index
+type Embedding struct {
+	Index  int       `json:"index"`
+	Vector []float32 `json:"embedding"`
+}
+
+// Usage is what a request cost. Cached inputs cost no tokens.
+type Usage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+	CachedInputs int `json:"cached_inputs"`
+}
+
+// Response holds a vector per input, in input order
+type Response struct {
+	Object     string      `json:"object"`
+	Provider   string      `json:"provider"`
+	Model      string      `json:"model"`
+	Dimensions int         `json:"dimensions"`
+	Data       []Embedding `json:"data"`
+	Usage      Usage       `json:"usage"`
+	// Batches is how many provider calls the request took
+	Batches int `json:"batches"`
+	// Fallback is set when the first provider failed and another served
+	// the request
+	Fallback bool `json:"fallback,omitempty"`
+}
+
+// Batch is what a provider returned for one call
+type Batch struct {
+	Vectors [][]float32
+	Tokens  int
+}
+
+// Embedder is a provider's embeddings API
+type Embedder interface {
+	// Name is what requests pin the provider by
+	Name() string
+	// Model is the model a hint resolves to; hints the provider doesn't
+	// serve resolve to its default
+	Model(hint string) string
+	// MaxBatch is how many inputs one call may embed
+	MaxBatch() int
+	// Embed returns one vector per input, in order
+	Embed(ctx context.Context, model string, inputs []string) (*Batch, error)
+}
+
+// ProviderUsage accumulates a provider's embeddings traffic
+type ProviderUsage struct {
+	Requests     int64 `json:"requests"`
+	Failures     int64 `json:"failures"`
+	Inputs       int64 `json:"inputs"`
+	CachedInputs int64 `json:"cached_inputs"`
+	Batches      int64 `json:"batches"`
+	Tokens       int64 `json:"tokens"`
+}
+
+// Service routes embeddings requests to providers
+type Service struct {
+	providers map[string]Embedder
+	// order is the failover order of unpinned requests
+	order  []string
+	cache  Cache
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	usage map[string]*ProviderUsage
+}
+
+// NewService routes to embedders, trying them in the order given. cache
+// may be nil.
+func NewService(logger *zap.Logger, cache Cache, embedders ...Embedder) *Service {
+	s := &Service{
+		providers: make(map[string]Embedder),
+		cache:     cache,
+		logger:    logger,
+		usage:     make(map[string]*ProviderUsage),
+	}
+	for _, e := range embedders {
+		s.providers[e.Name()] = e
+		s.order = append(s.order, e.Name())
+		s.usage[e.Name()] = &ProviderUsage{}
+	}
+	return s
+}
+
+// Providers are the configured providers in failover order
+func (s *Service) Providers() []string {
+	return append([]string(nil), s.order...)
+}
+
+// Usage returns each provider's traffic so far
+func (s *Service) Usage() map[string]ProviderUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := make(map[string]ProviderUsage, len(s.usage))
+	for name, u := range s.usage {
+		usage[name] = *u
+	}
+	return usage
+}
+
+func (s *Service) record(provider string, fn func(*ProviderUsage)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s.usage[provider])
+}
+
+// Validate applies the max-input guard
+func Validate(req Request) error {
+	switch {
+	case len(req.Input) == 0:
+		return &InputError{Message: "input must list at least one string"}
+	case len(req.Input) > MaxInputs:
+		return &InputError{TooLarge: true, Message: fmt.Sprintf("input has %d strings, more than the limit of %d", len(req.Input), MaxInputs)}
+	}
+	for i, input := range req.Input {
+		if input == "" {
+			return &InputError{Message: fmt.Sprintf("input[%d] is empty", i)}
+		}
+		if tokens := models.EstimateTokens(input); tokens > MaxInputTokens {
+			return &InputError{TooLarge: true, Message: fmt.Sprintf("input[%d] is about %d tokens, more than the limit of %d", i, tokens, MaxInputTokens)}
+		}
+	}
+	return nil
+}
+
+// Embed embeds every input with the pinned provider, or with the first
+// configured provider that succeeds
+func (s *Service) Embed(ctx context.Context, req Request) (*Response, error) {
+	if err := Validate(req); err != nil {
+		return nil, err
+	}
+	candidates := s.order
+	if req.Provider != "" {
+		if _, ok := s.providers[req.Provider]; !ok {
+			return nil, fmt.Errorf("%w: %q (configured: %v)", ErrUnknownProvider, req.Provider, s.order)
+		}
+		candidates = []string{req.Provider}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoProviders
+	}
+
+	failures := make(map[string]string)
+	for i, name := range candidates {
+		resp, err := s.embedWith(ctx, s.providers[name], req)
+		if err == nil {
+			resp.Fallback = i > 0
+			return resp, nil
+		}
+		s.record(name, func(u *ProviderUsage) { u.Failures++ })
+		s.logger.Warn("Embeddings provider failed",
+			zap.String("provider", name),
+			zap.Int("inputs", len(req.Input)),
+			zap.Error(err),
+		)
+		failures[name] = err.Error()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, &ProviderError{Failures: failures}
+}
+
+// embedWith serves a request from the cache and one provider
+func (s *Service) embedWith(ctx context.Context, e Embedder, req Request) (*Response, error) {
+	model := e.Model(req.Model)
+	vectors := make([][]float32, len(req.Input))
+
+	keys := make([]string, len(req.Input))
+	for i, input := range req.Input {
+		keys[i] = redact.CacheKey("llm-router:embedding:", e.Name(), model, input)
+	}
+	if s.cache != nil {
+		cached, err := s.cache.Get(ctx, keys)
+		if err != nil {
+			s.logger.Warn("Embeddings cache read failed", zap.Error(err))
+		} else {
+			copy(vectors, cached)
+		}
+	}
+
+	// Deduplicate the misses so repeated inputs are embedded once
+	var missing []string
+	positions := make(map[string][]int)
+	for i, input := range req.Input {
+		if vectors[i] != nil {
+			continue
+		}
+		if _, seen := positions[input]; !seen {
+			missing = append(missing, input)
+		}
+		positions[input] = append(positions[input], i)
+	}
+	cachedInputs := len(req.Input)
+	for _, at := range positions {
+		cachedInputs -= len(at)
+	}
+
+	batches := split(missing, e.MaxBatch())
+	results := make([]*Batch, len(batches))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentBatches)
+	for i, batch := range batches {
+		i, batch := i, batch
+		g.Go(func() error {
+			result, err := e.Embed(gctx, model, batch)
+			if err != nil {
+				return err
+			}
+			if len(result.Vectors) != len(batch) {
+				return fmt.Errorf("%s returned %d vectors for %d inputs", e.Name(), len(result.Vectors), len(batch))
+			}
+			results[i] = result
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	tokens := 0
+	fresh := make(map[string][]float32, len(missing))
+	for i, batch := range batches {
+		tokens += results[i].Tokens
+		for j, input := range batch {
+			fresh[keys[positions[input][0]]] = results[i].Vectors[j]
+			for _, at := range positions[input] {
+				vectors[at] = results[i].Vectors[j]
+			}
+		}
+	}
+
+	resp := &Response{
+		Object:     "list",
+		Provider:   e.Name(),
+		Model:      model,
+		Dimensions: len(vectors[0]),
+		Data:       make([]Embedding, len(vectors)),
+		Usage:      Usage{PromptTokens: tokens, TotalTokens: tokens, CachedInputs: cachedInputs},
+		Batches:    len(batches),
+	}
+	for i, vector := range vectors {
+		if len(vector) != resp.Dimensions {
+			return nil, fmt.Errorf("%s returned vectors of %d and %d dimensions", e.Name(), resp.Dimensions, len(vector))
+		}
+		resp.Data[i] = Embedding{Index: i, Vector: vector}
+	}
+
+	if s.cache != nil && len(fresh) > 0 {
+		if err := s.cache.Set(ctx, fresh); err != nil {
+			s.logger.Warn("Embeddings cache write failed", zap.Error(err))
+		}
+	}
+	s.record(e.Name(), func(u *ProviderUsage) {
+		u.Requests++
+		u.Inputs += int64(len(req.Input))
+		u.CachedInputs += int64(cachedInputs)
+		u.Batches += int64(len(batches))
+		u.Tokens += int64(tokens)
+	})
+	return resp, nil
+}
+
+// split cuts inputs into batches of at most size
+func split(inputs []string, size int) [][]string {
+	if size < 1 {
+		size = 1
+	}
+	var batches [][]string
+	for len(inputs) > size {
+		batches = append(batches, inputs[:size])
+		inputs = inputs[size:]
+	}
+	if len(inputs) > 0 {
+		batches = append(batches, inputs)
+	}
+	return batches
+}
@@ -0,0 +1,277 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// stubEmbedder embeds "input-N" as [N, batch size], recording each batch.
+// Batches holding earlier inputs answer later, so results arrive out of
+// order.
+type stubEmbedder struct {
+	name     string
+	maxBatch int
+	err      error
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (s *stubEmbedder) Name() string             { return s.name }
+func (s *stubEmbedder) Model(hint string) string { return s.name + "-model" }
+func (s *stubEmbedder) MaxBatch() int            { return s.maxBatch }
+
+func (s *stubEmbedder) Embed(ctx context.Context, model string, inputs []string) (*Batch, error) {
+	s.mu.Lock()
+	s.batches = append(s.batches, inputs)
+	s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	first := inputNumber(inputs[0])
+	time.Sleep(time.Duration(100-first) * 100 * time.Microsecond)
+
+	batch := &Batch{Tokens: len(inputs)}
+	for _, input := range inputs {
+		batch.Vectors = append(batch.Vectors, []float32{float32(inputNumber(input)), float32(len(inputs))})
+	}
+	return batch, nil
+}
+
+func (s *stubEmbedder) calls() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.batches...)
+}
+
+func inputNumber(input string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(input, "input-"))
+	return n
+}
+
+func inputs(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("input-%d", i)
+	}
+	return out
+}
+
+// memoryCache is a Cache in a map
+type memoryCache struct {
+	vectors map[string][]float32
+}
+
+func (c *memoryCache) Get(ctx context.Context, keys []string) ([][]float32, error) {
+	out := make([][]float32, len(keys))
+	for i, key := range keys {
+		out[i] = c.vectors[key]
+	}
+	return out, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, vectors map[string][]float32) error {
+	for key, vector := range vectors {
+		c.vectors[key] = vector
+	}
+	return nil
+}
+
+func TestEmbedBatchesAndKeepsOrder(t *testing.T) {
+	stub := &stubEmbedder{name: "azure", maxBatch: AzureMaxBatch}
+	service := NewService(zap.NewNop(), nil, stub)
+
+	resp, err := service.Embed(context.Background(), Request{Input: inputs(40)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := stub.calls()
+	sizes := make(map[int]int)
+	for _, batch := range calls {
+		sizes[len(batch)]++
+	}
+	if len(calls) != 3 || sizes[16] != 2 || sizes[8] != 1 || resp.Batches != 3 {
+		t.Fatalf("made %d calls of sizes %v, want 16, 16 and 8", len(calls), sizes)
+	}
+	if len(resp.Data) != 40 {
+		t.Fatalf("got %d embeddings, want 40", len(resp.Data))
+	}
+	for i, e := range resp.Data {
+		if e.Index != i || e.Vector[0] != float32(i) {
+			t.Errorf("data[%d] = index %d, vector of input-%v", i, e.Index, e.Vector[0])
+		}
+	}
+	if resp.Provider != "azure" || resp.Model != "azure-model" || resp.Dimensions != 2 || resp.Usage.TotalTokens != 40 {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestEmbedOneInputPerCall(t *testing.T) {
+	stub := &stubEmbedder{name: "bedrock", maxBatch: BedrockMaxBatch}
+	resp, err := NewService(zap.NewNop(), nil, stub).Embed(context.Background(), Request{Input: inputs(10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := stub.calls(); len(calls) != 10 || resp.Batches != 10 {
+		t.Fatalf("made %d calls, want one per input", len(calls))
+	}
+	for i, e := range resp.Data {
+		if e.Vector[0] != float32(i) {
+			t.Errorf("data[%d] holds the vector of input-%v", i, e.Vector[0])
+		}
+	}
+}
+
+func TestEmbedDeduplicatesAndCaches(t *testing.T) {
+	stub := &stubEmbedder{name: "azure", maxBatch: AzureMaxBatch}
+	cache := &memoryCache{vectors: make(map[string][]float32)}
+	service := NewService(zap.NewNop(), cache, stub)
+
+	req := Request{Input: []string{"input-1", "input-2", "input-1"}}
+	resp, err := service.Embed(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := stub.calls(); len(calls) != 1 || len(calls[0]) != 2 {
+		t.Fatalf("calls = %v, want the repeated input embedded once", calls)
+	}
+	if resp.Data[2].Vector[0] != 1 || resp.Usage.CachedInputs != 0 || len(cache.vectors) != 2 {
+		t.Errorf("response = %+v, cached %d vectors", resp, len(cache.vectors))
+	}
+
+	req.Input = append(req.Input, "input-3")
+	resp, err = service.Embed(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := stub.calls(); len(calls) != 2 || len(calls[1]) != 1 || calls[1][0] != "input-3" {
+		t.Fatalf("calls = %v, want only the new input embedded", calls)
+	}
+	for i, want := range []float32{1, 2, 1, 3} {
+		if resp.Data[i].Vector[0] != want {
+			t.Errorf("data[%d] holds the vector of input-%v", i, resp.Data[i].Vector[0])
+		}
+	}
+	if resp.Usage.CachedInputs != 3 || resp.Usage.TotalTokens != 1 {
+		t.Errorf("usage = %+v, want 3 cached inputs and 1 token", resp.Usage)
+	}
+}
+
+func TestEmbedFailover(t *testing.T) {
+	failing := &stubEmbedder{name: "azure", maxBatch: AzureMaxBatch, err: errors.New("throttled")}
+	backup := &stubEmbedder{name: "bedrock", maxBatch: BedrockMaxBatch}
+	service := NewService(zap.NewNop(), nil, failing, backup)
+
+	resp, err := service.Embed(context.Background(), Request{Input: inputs(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Provider != "bedrock" || !resp.Fallback {
+		t.Errorf("served by %s, fallback %v; want bedrock after azure failed", resp.Provider, resp.Fallback)
+	}
+
+	// A pinned request never fails over
+	_, err = service.Embed(context.Background(), Request{Input: inputs(2), Provider: "azure"})
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Failures["azure"] != "throttled" || len(providerErr.Failures) != 1 {
+		t.Errorf("err = %v, want azure's failure only", err)
+	}
+
+	usage := service.Usage()
+	if usage["azure"].Failures != 2 || usage["bedrock"].Requests != 1 || usage["bedrock"].Inputs != 2 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestEmbedWrongVectorCount(t *testing.T) {
+	service := NewService(zap.NewNop(), nil, shortEmbedder{})
+	_, err := service.Embed(context.Background(), Request{Input: inputs(3)})
+	if err == nil || !strings.Contains(err.Error(), "returned 2 vectors for 3 inputs") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// shortEmbedder drops the last vector of every batch
+type shortEmbedder struct{}
+
+func (shortEmbedder) Name() string             { return "azure" }
+func (shortEmbedder) Model(hint string) string { return "m" }
+func (shortEmbedder) MaxBatch() int            { return AzureMaxBatch }
+
+func (shortEmbedder) Embed(ctx context.Context, model string, inputs []string) (*Batch, error) {
+	batch := &Batch{}
+	for range inputs[1:] {
+		batch.Vectors = append(batch.Vectors, []float32{1})
+	}
+	return batch, nil
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		tooLarge bool
+		want     string
+	}{
+		{"no input", nil, false, "input must list at least one string"},
+		{"empty string", []string{"a", ""}, false, "input[1] is empty"},
+		{"too many inputs", inputs(MaxInputs + 1), true, "input has 257 strings, more than the limit of 256"},
+		{"input too long", []string{"a", strings.Repeat("word ", MaxInputTokens*2)}, true, "input[1] is about"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(Request{Input: tt.input})
+			var inputErr *InputError
+			if !errors.As(err, &inputErr) || inputErr.TooLarge != tt.tooLarge || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q (too large %v)", err, tt.want, tt.tooLarge)
+			}
+		})
+	}
+	if err := Validate(Request{Input: inputs(MaxInputs)}); err != nil {
+		t.Errorf("the maximum number of inputs: %v", err)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	stub := &stubEmbedder{name: "azure", maxBatch: AzureMaxBatch}
+	handler := NewHandler(NewService(zap.NewNop(), nil, stub))
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"embeds", http.MethodPost, `{"input": ["input-1"]}`, http.StatusOK},
+		{"too many inputs", http.MethodPost, fmt.Sprintf(`{"input": ["%s"]}`, strings.Join(inputs(MaxInputs+1), `", "`)), http.StatusRequestEntityTooLarge},
+		{"empty input", http.MethodPost, `{"input": []}`, http.StatusBadRequest},
+		{"unknown provider", http.MethodPost, `{"input": ["a"], "provider": "openai"}`, http.StatusBadRequest},
+		{"invalid JSON", http.MethodPost, `{"input": `, http.StatusBadRequest},
+		{"wrong method", http.MethodGet, ``, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, EmbeddingsPath, strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d %s, want %d", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	NewHandler(NewService(zap.NewNop(), nil)).ServeHTTP(w, httptest.NewRequest(http.MethodPost, EmbeddingsPath, strings.NewReader(`{"input": ["a"]}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("no providers: status = %d, want 503", w.Code)
+	}
+}
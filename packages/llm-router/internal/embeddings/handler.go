@@ -0,0 +1,107 @@
+package embeddings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Paths the handler serves
+const (
+	EmbeddingsPath = "/api/v1/embeddings"
+	UsagePath      = "/api/v1/usage/embeddings"
+)
+
+// maxBodyBytes bounds a request body: MaxInputs inputs of MaxInputTokens
+// estimated tokens each, plus JSON overhead
+const maxBodyBytes = MaxInputs*MaxInputTokens*4 + 1<<20
+
+// Handler serves the embeddings API:
+//
+//	POST /api/v1/embeddings        embed {"input": [...], "model", "provider"}
+//	GET  /api/v1/usage/embeddings  traffic per provider
+type Handler struct {
+	service *Service
+}
+
+// NewHandler serves embeddings from service
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// Register adds the handler's routes to mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle(EmbeddingsPath, h)
+	mux.Handle(UsagePath, h)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == UsagePath {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"providers": h.service.Providers(),
+			"usage":     h.service.Usage(),
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+
+	resp, err := h.service.Embed(r.Context(), req)
+	if err != nil {
+		writeEmbedError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeEmbedError(w http.ResponseWriter, err error) {
+	var inputErr *InputError
+	var providerErr *ProviderError
+	switch {
+	case errors.As(err, &inputErr) && inputErr.TooLarge:
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{
+			"error":            err.Error(),
+			"code":             "input_too_large",
+			"max_inputs":       MaxInputs,
+			"max_input_tokens": MaxInputTokens,
+		})
+	case errors.As(err, &inputErr), errors.Is(err, ErrUnknownProvider):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNoProviders):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.As(err, &providerErr):
+		writeJSON(w, http.StatusBadGateway, map[string]interface{}{
+			"error":     err.Error(),
+			"providers": providerErr.Failures,
+		})
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
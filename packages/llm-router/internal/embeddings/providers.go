@@ -0,0 +1,206 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// Provider limits on inputs per call
+const (
+	// AzureMaxBatch is the most inputs an Azure OpenAI embeddings call
+	// takes for every embedding model version
+	AzureMaxBatch = 16
+	// BedrockMaxBatch is 1: Titan embeds one inputText per call
+	BedrockMaxBatch = 1
+)
+
+// Default models
+const (
+	DefaultAzureDeployment = "text-embedding-ada-002"
+	DefaultBedrockModel    = "amazon.titan-embed-text-v1"
+)
+
+const (
+	azureAPIVersion     = "2023-05-15"
+	azureMaxErrorBytes  = 512
+	azureMaxResponseLen = 64 << 20
+)
+
+// AzureEmbedder calls an Azure OpenAI embeddings deployment
+type AzureEmbedder struct {
+	endpoint   string
+	apiKey     string
+	deployment string
+	client     *http.Client
+}
+
+// NewAzureEmbedder calls deployment, the default for requests without a
+// model hint, at endpoint
+func NewAzureEmbedder(endpoint, apiKey, deployment string) *AzureEmbedder {
+	if deployment == "" {
+		deployment = DefaultAzureDeployment
+	}
+	return &AzureEmbedder{
+		endpoint:   strings.TrimRight(endpoint, "/"),
+		apiKey:     apiKey,
+		deployment: deployment,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (a *AzureEmbedder) Name() string {
+	return "azure"
+}
+
+// Model takes any hint but a Bedrock model ID as a deployment name
+func (a *AzureEmbedder) Model(hint string) string {
+	if hint == "" || strings.HasPrefix(hint, "amazon.") {
+		return a.deployment
+	}
+	return hint
+}
+
+func (a *AzureEmbedder) MaxBatch() int {
+	return AzureMaxBatch
+}
+
+type azureEmbeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (a *AzureEmbedder) Embed(ctx context.Context, model string, inputs []string) (*Batch, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": inputs})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/openai/deployments/%s/embeddings?api-version=%s", a.endpoint, url.PathEscape(model), azureAPIVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api-key", a.apiKey)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("azure embeddings call failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, azureMaxResponseLen))
+	if err != nil {
+		return nil, fmt.Errorf("reading azure embeddings response: %w", err)
+	}
+
+	var parsed azureEmbeddingsResponse
+	parseErr := json.Unmarshal(data, &parsed)
+	if resp.StatusCode != http.StatusOK {
+		if parseErr == nil && parsed.Error != nil {
+			return nil, fmt.Errorf("azure embeddings: %s (code: %s)", parsed.Error.Message, parsed.Error.Code)
+		}
+		if len(data) > azureMaxErrorBytes {
+			data = data[:azureMaxErrorBytes]
+		}
+		return nil, fmt.Errorf("azure embeddings returned status %d: %s", resp.StatusCode, data)
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("parsing azure embeddings response: %w", parseErr)
+	}
+
+	sort.Slice(parsed.Data, func(i, j int) bool { return parsed.Data[i].Index < parsed.Data[j].Index })
+	batch := &Batch{Vectors: make([][]float32, len(parsed.Data)), Tokens: parsed.Usage.PromptTokens}
+	for i, d := range parsed.Data {
+		batch.Vectors[i] = d.Embedding
+	}
+	return batch, nil
+}
+
+// BedrockInvoker is the part of the Bedrock runtime client the embedder
+// uses
+type BedrockInvoker interface {
+	InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error)
+}
+
+// BedrockEmbedder calls a Titan embeddings model
+type BedrockEmbedder struct {
+	client BedrockInvoker
+	model  string
+}
+
+// NewBedrockEmbedder calls model, the default for requests without a Titan
+// model hint
+func NewBedrockEmbedder(client BedrockInvoker, model string) *BedrockEmbedder {
+	if model == "" {
+		model = DefaultBedrockModel
+	}
+	return &BedrockEmbedder{client: client, model: model}
+}
+
+func (b *BedrockEmbedder) Name() string {
+	return "bedrock"
+}
+
+// Model takes Titan embedding model IDs; other hints name models Bedrock
+// doesn't serve
+func (b *BedrockEmbedder) Model(hint string) string {
+	if strings.HasPrefix(hint, "amazon.titan-embed") {
+		return hint
+	}
+	return b.model
+}
+
+func (b *BedrockEmbedder) MaxBatch() int {
+	return BedrockMaxBatch
+}
+
+func (b *BedrockEmbedder) Embed(ctx context.Context, model string, inputs []string) (*Batch, error) {
+	batch := &Batch{Vectors: make([][]float32, len(inputs))}
+	for i, input := range inputs {
+		body, err := json.Marshal(map[string]string{"inputText": input})
+		if err != nil {
+			return nil, err
+		}
+		output, err := b.client.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(model),
+			ContentType: aws.String("application/json"),
+			Accept:      aws.String("application/json"),
+			Body:        body,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("bedrock embeddings call failed: %w", err)
+		}
+		var resp struct {
+			Embedding           []float32 `json:"embedding"`
+			InputTextTokenCount int       `json:"inputTextTokenCount"`
+		}
+		if err := json.Unmarshal(output.Body, &resp); err != nil {
+			return nil, fmt.Errorf("parsing bedrock embeddings response: %w", err)
+		}
+		if len(resp.Embedding) == 0 {
+			return nil, fmt.Errorf("bedrock returned no embedding")
+		}
+		batch.Vectors[i] = resp.Embedding
+		batch.Tokens += resp.InputTextTokenCount
+	}
+	return batch, nil
+}
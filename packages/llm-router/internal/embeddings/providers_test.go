@@ -0,0 +1,79 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAzureEmbedderSortsByIndex(t *testing.T) {
+	var path, key string
+	var sent struct {
+		Input []string `json:"input"`
+	}
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, key = r.URL.Path, r.Header.Get("api-key")
+		json.NewDecoder(r.Body).Decode(&sent)
+		// Azure doesn't promise the data in input order
+		io.WriteString(w, `{"data": [
+			{"index": 2, "embedding": [2]},
+			{"index": 0, "embedding": [0]},
+			{"index": 1, "embedding": [1]}
+		], "usage": {"prompt_tokens": 9}}`)
+	}))
+	defer azure.Close()
+
+	embedder := NewAzureEmbedder(azure.URL+"/", "test-key", "")
+	batch, err := embedder.Embed(context.Background(), embedder.Model(""), []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/openai/deployments/"+DefaultAzureDeployment+"/embeddings" || key != "test-key" || len(sent.Input) != 3 {
+		t.Errorf("called %s with key %q and %v", path, key, sent.Input)
+	}
+	for i, vector := range batch.Vectors {
+		if vector[0] != float32(i) {
+			t.Errorf("vector %d = %v", i, vector)
+		}
+	}
+	if batch.Tokens != 9 {
+		t.Errorf("tokens = %d, want 9", batch.Tokens)
+	}
+}
+
+func TestAzureEmbedderErrors(t *testing.T) {
+	azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error": {"code": "too_many_inputs", "message": "Too many inputs"}}`)
+	}))
+	defer azure.Close()
+
+	_, err := NewAzureEmbedder(azure.URL, "k", "").Embed(context.Background(), "d", []string{"a"})
+	if err == nil || err.Error() != "azure embeddings: Too many inputs (code: too_many_inputs)" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestModelHints(t *testing.T) {
+	azure := NewAzureEmbedder("https://example.com", "k", "embed-large")
+	bedrock := NewBedrockEmbedder(nil, "")
+	for _, tt := range []struct {
+		embedder Embedder
+		hint     string
+		want     string
+	}{
+		{azure, "", "embed-large"},
+		{azure, "text-embedding-3-small", "text-embedding-3-small"},
+		{azure, "amazon.titan-embed-text-v2:0", "embed-large"},
+		{bedrock, "", DefaultBedrockModel},
+		{bedrock, "amazon.titan-embed-text-v2:0", "amazon.titan-embed-text-v2:0"},
+		{bedrock, "text-embedding-3-small", DefaultBedrockModel},
+	} {
+		if got := tt.embedder.Model(tt.hint); got != tt.want {
+			t.Errorf("%s.Model(%q) = %q, want %q", tt.embedder.Name(), tt.hint, got, tt.want)
+		}
+	}
+}
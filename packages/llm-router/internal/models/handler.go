@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ModelsPath lists the registry
+const ModelsPath = "/api/v1/models"
+
+// Handler serves GET /api/v1/models: every model with its provider,
+// context window, cost, latency class and capabilities, plus the routing
+// objectives and capabilities a request may ask for
+type Handler struct {
+	registry *Registry
+}
+
+// NewHandler serves the models in registry
+func NewHandler(registry *Registry) *Handler {
+	return &Handler{registry: registry}
+}
+
+// Register adds the handler's route to mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle(ModelsPath, h)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"models":            h.registry.Models,
+		"objectives":        Objectives,
+		"default_objective": DefaultObjective,
+		"capabilities":      h.registry.Capabilities(),
+	})
+}
+
+// WriteSelectionError writes the 400 response for a request no model can
+// serve. A request too large for the context window gets its token count.
+func WriteSelectionError(w http.ResponseWriter, err error) {
+	var tooLarge *ContextError
+	if errors.As(err, &tooLarge) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":          err.Error(),
+			"code":           "context_length_exceeded",
+			"model":          tooLarge.Model,
+			"context_window": tooLarge.ContextWindow,
+			"prompt_tokens":  tooLarge.Tokens.Prompt,
+			"max_tokens":     tooLarge.Tokens.Completion,
+			"total_tokens":   tooLarge.Tokens.Total(),
+		})
+		return
+	}
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
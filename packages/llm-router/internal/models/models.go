@@ -0,0 +1,383 @@
+// Package models describes the models the router can send requests to and
+// picks one for a request from what it needs and what it optimizes for
+package models
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Objectives a request can optimize model selection for
+const (
+	OptimizeCost    = "cost"
+	OptimizeLatency = "latency"
+	OptimizeQuality = "quality"
+)
+
+// DefaultObjective is used when a request asks for automatic routing
+// without saying what to optimize
+const DefaultObjective = OptimizeQuality
+
+// Objectives lists the objectives Select understands
+var Objectives = []string{OptimizeCost, OptimizeLatency, OptimizeQuality}
+
+// latencyRank orders latency classes, fastest first
+var latencyRank = map[string]int{"low": 0, "medium": 1, "high": 2}
+
+//go:embed models.json
+var defaultRegistry []byte
+
+// Model describes one model the router can call
+type Model struct {
+	// Name is the deployment or model ID sent to the provider
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	// ContextWindow is the most prompt and completion tokens a request
+	// may use
+	ContextWindow   int     `json:"context_window"`
+	InputCostPer1K  float64 `json:"input_cost_per_1k"`  // USD
+	OutputCostPer1K float64 `json:"output_cost_per_1k"` // USD
+	// Latency is the model's latency class: low, medium or high
+	Latency string `json:"latency"`
+	// Quality ranks models against each other, higher is better
+	Quality int `json:"quality"`
+	// Capabilities are tags such as code, json-mode and long-context
+	Capabilities []string `json:"capabilities"`
+}
+
+// HasCapability reports whether the model is tagged with capability
+func (m Model) HasCapability(capability string) bool {
+	for _, c := range m.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Cost estimates the price of a request in USD
+func (m Model) Cost(tokens Tokens) float64 {
+	return float64(tokens.Prompt)/1000*m.InputCostPer1K + float64(tokens.Completion)/1000*m.OutputCostPer1K
+}
+
+// Tokens is the size of a request: its prompt and the most completion
+// tokens it allows
+type Tokens struct {
+	Prompt     int `json:"prompt_tokens"`
+	Completion int `json:"max_tokens"`
+}
+
+// Total is the context the request needs
+func (t Tokens) Total() int {
+	return t.Prompt + t.Completion
+}
+
+// EstimateTokens estimates the prompt tokens of chat messages at about four
+// characters a token, plus the per message overhead of the chat format
+func EstimateTokens(contents ...string) int {
+	tokens := 0
+	for _, content := range contents {
+		tokens += (len(content)+3)/4 + 4
+	}
+	return tokens
+}
+
+// Registry holds the available models
+type Registry struct {
+	Models []Model `json:"models"`
+}
+
+// Default returns the registry of the deployments the router ships with
+func Default() *Registry {
+	reg, err := Parse(defaultRegistry)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded model registry: %v", err))
+	}
+	return reg
+}
+
+// FromEnv loads the registry from the JSON file at MODEL_REGISTRY_PATH, or
+// returns the default registry when it isn't set
+func FromEnv() (*Registry, error) {
+	path := os.Getenv("MODEL_REGISTRY_PATH")
+	if path == "" {
+		return Default(), nil
+	}
+	return Load(path)
+}
+
+// Load reads a registry file
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model registry: %w", err)
+	}
+	reg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return reg, nil
+}
+
+// Parse parses and validates a registry
+func Parse(data []byte) (*Registry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var reg Registry
+	if err := dec.Decode(&reg); err != nil {
+		return nil, fmt.Errorf("invalid model registry: %w", err)
+	}
+	if len(reg.Models) == 0 {
+		return nil, fmt.Errorf("invalid model registry: no models")
+	}
+
+	seen := make(map[string]bool)
+	for i := range reg.Models {
+		m := &reg.Models[i]
+		m.Name = strings.TrimSpace(m.Name)
+		m.Provider = strings.ToLower(strings.TrimSpace(m.Provider))
+		m.Latency = strings.ToLower(strings.TrimSpace(m.Latency))
+		m.Capabilities = normalize(m.Capabilities)
+
+		switch {
+		case m.Name == "":
+			return nil, fmt.Errorf("invalid model registry: model %d has no name", i+1)
+		case seen[m.Name]:
+			return nil, fmt.Errorf("invalid model registry: model %s is listed twice", m.Name)
+		case m.Provider == "":
+			return nil, fmt.Errorf("invalid model registry: model %s has no provider", m.Name)
+		case m.ContextWindow <= 0:
+			return nil, fmt.Errorf("invalid model registry: model %s needs a positive context_window", m.Name)
+		case m.InputCostPer1K < 0 || m.OutputCostPer1K < 0:
+			return nil, fmt.Errorf("invalid model registry: model %s has a negative cost", m.Name)
+		case m.Quality <= 0:
+			return nil, fmt.Errorf("invalid model registry: model %s needs a positive quality", m.Name)
+		}
+		if _, ok := latencyRank[m.Latency]; !ok {
+			return nil, fmt.Errorf("invalid model registry: model %s has latency %q, expected low, medium or high", m.Name, m.Latency)
+		}
+		seen[m.Name] = true
+	}
+	return &reg, nil
+}
+
+// normalize lowercases tags and drops blanks and duplicates
+func normalize(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// Lookup returns the model called name
+func (reg *Registry) Lookup(name string) (Model, bool) {
+	for _, m := range reg.Models {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Model{}, false
+}
+
+// Capabilities returns every capability some model has, sorted
+func (reg *Registry) Capabilities() []string {
+	return capabilitiesOf(reg.Models)
+}
+
+func capabilitiesOf(models []Model) []string {
+	seen := make(map[string]bool)
+	var capabilities []string
+	for _, m := range models {
+		for _, c := range m.Capabilities {
+			if !seen[c] {
+				seen[c] = true
+				capabilities = append(capabilities, c)
+			}
+		}
+	}
+	sort.Strings(capabilities)
+	return capabilities
+}
+
+// ContextError rejects a request that doesn't fit a model's context window
+type ContextError struct {
+	Model         string
+	ContextWindow int
+	Tokens        Tokens
+}
+
+func (e *ContextError) Error() string {
+	return fmt.Sprintf("request needs %d tokens (%d prompt + %d completion) but %s has a context window of %d tokens",
+		e.Tokens.Total(), e.Tokens.Prompt, e.Tokens.Completion, e.Model, e.ContextWindow)
+}
+
+// CheckContext returns a ContextError when a request doesn't fit the named
+// model. Models missing from the registry aren't checked.
+func (reg *Registry) CheckContext(name string, tokens Tokens) error {
+	if m, ok := reg.Lookup(name); ok && tokens.Total() > m.ContextWindow {
+		return &ContextError{Model: m.Name, ContextWindow: m.ContextWindow, Tokens: tokens}
+	}
+	return nil
+}
+
+// Routing is a request's ask for automatic model selection
+type Routing struct {
+	Optimize string   `json:"optimize,omitempty"` // cost, latency or quality
+	Require  []string `json:"require,omitempty"`  // capabilities the model must have
+}
+
+// Selection is the model chosen for a request and why
+type Selection struct {
+	Model     string   `json:"model"`
+	Provider  string   `json:"provider"`
+	Optimize  string   `json:"optimize"`
+	Require   []string `json:"require,omitempty"`
+	Rationale string   `json:"rationale"`
+	// Candidates are the models that matched, best first
+	Candidates []string `json:"candidates"`
+	// Excluded maps models that were ruled out to the reason
+	Excluded map[string]string `json:"excluded,omitempty"`
+	// EstimatedCost is the chosen model's price for the request in USD
+	EstimatedCost float64 `json:"estimated_cost_usd"`
+}
+
+// Select picks the best model for a request. Models without every
+// required capability, or too small for the request, are ruled out, and
+// the rest are ranked by the objective, breaking ties on cost. When
+// providers are given only their models are considered.
+func (reg *Registry) Select(routing Routing, tokens Tokens, providers ...string) (Selection, error) {
+	objective := strings.ToLower(strings.TrimSpace(routing.Optimize))
+	if objective == "" {
+		objective = DefaultObjective
+	}
+	if !contains(Objectives, objective) {
+		return Selection{}, fmt.Errorf("unknown routing objective %q, expected one of: %s", routing.Optimize, strings.Join(Objectives, ", "))
+	}
+	require := normalize(routing.Require)
+
+	sel := Selection{Optimize: objective, Require: require, Excluded: make(map[string]string)}
+	var available, capable, fitting []Model
+	for _, m := range reg.Models {
+		if len(providers) > 0 && !contains(providers, m.Provider) {
+			sel.Excluded[m.Name] = "provider " + m.Provider + " is not served"
+			continue
+		}
+		available = append(available, m)
+		if missing := missingCapabilities(m, require); len(missing) > 0 {
+			sel.Excluded[m.Name] = "lacks " + strings.Join(missing, ", ")
+			continue
+		}
+		capable = append(capable, m)
+		if tokens.Total() > m.ContextWindow {
+			sel.Excluded[m.Name] = fmt.Sprintf("context window of %d tokens is too small", m.ContextWindow)
+			continue
+		}
+		fitting = append(fitting, m)
+	}
+
+	if len(capable) == 0 {
+		for _, c := range require {
+			if !offered(available, c) {
+				return Selection{}, fmt.Errorf("no model offers %s, available capabilities: %s", c, strings.Join(capabilitiesOf(available), ", "))
+			}
+		}
+		return Selection{}, fmt.Errorf("no model offers all of: %s", strings.Join(require, ", "))
+	}
+	if len(fitting) == 0 {
+		largest := capable[0]
+		for _, m := range capable[1:] {
+			if m.ContextWindow > largest.ContextWindow {
+				largest = m
+			}
+		}
+		return Selection{}, &ContextError{Model: largest.Name, ContextWindow: largest.ContextWindow, Tokens: tokens}
+	}
+
+	sort.SliceStable(fitting, func(i, j int) bool {
+		a, b := fitting[i], fitting[j]
+		switch objective {
+		case OptimizeLatency:
+			if latencyRank[a.Latency] != latencyRank[b.Latency] {
+				return latencyRank[a.Latency] < latencyRank[b.Latency]
+			}
+		case OptimizeQuality:
+			if a.Quality != b.Quality {
+				return a.Quality > b.Quality
+			}
+		}
+		if a.Cost(tokens) != b.Cost(tokens) {
+			return a.Cost(tokens) < b.Cost(tokens)
+		}
+		return a.Quality > b.Quality
+	})
+
+	best := fitting[0]
+	sel.Model, sel.Provider = best.Name, best.Provider
+	sel.EstimatedCost = best.Cost(tokens)
+	for _, m := range fitting {
+		sel.Candidates = append(sel.Candidates, m.Name)
+	}
+	if len(sel.Excluded) == 0 {
+		sel.Excluded = nil
+	}
+
+	matching := fmt.Sprintf("%d models", len(fitting))
+	if len(fitting) == 1 {
+		matching = "the only model"
+	}
+	if len(require) > 0 {
+		matching += " with " + strings.Join(require, ", ")
+	}
+	matching += fmt.Sprintf(" fitting %d tokens", tokens.Total())
+	switch objective {
+	case OptimizeCost:
+		sel.Rationale = fmt.Sprintf("optimize cost: %s is the cheapest of %s at an estimated $%.4f", best.Name, matching, sel.EstimatedCost)
+	case OptimizeLatency:
+		sel.Rationale = fmt.Sprintf("optimize latency: %s has the lowest latency class (%s) of %s", best.Name, best.Latency, matching)
+	case OptimizeQuality:
+		sel.Rationale = fmt.Sprintf("optimize quality: %s has the highest quality (%d) of %s", best.Name, best.Quality, matching)
+	}
+	if len(fitting) == 1 {
+		sel.Rationale = fmt.Sprintf("optimize %s: %s is %s", objective, best.Name, matching)
+	}
+	return sel, nil
+}
+
+func missingCapabilities(m Model, require []string) []string {
+	var missing []string
+	for _, c := range require {
+		if !m.HasCapability(c) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+func offered(models []Model, capability string) bool {
+	for _, m := range models {
+		if m.HasCapability(capability) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testRegistry has a cheap fast model, a slow strong one with a small
+// context window, and a model from a provider the router may not serve
+func testRegistry(t *testing.T) *Registry {
+	t.Helper()
+	reg, err := Parse([]byte(`{"models": [
+		{"name": "fast", "provider": "azure", "context_window": 100000, "input_cost_per_1k": 0.1, "output_cost_per_1k": 0.2,
+		 "latency": "low", "quality": 2, "capabilities": ["code", "json-mode"]},
+		{"name": "strong", "provider": "azure", "context_window": 8000, "input_cost_per_1k": 1, "output_cost_per_1k": 2,
+		 "latency": "high", "quality": 5, "capabilities": ["code", "reasoning"]},
+		{"name": "other", "provider": "bedrock", "context_window": 200000, "input_cost_per_1k": 0.05, "output_cost_per_1k": 0.1,
+		 "latency": "medium", "quality": 4, "capabilities": ["code", "vision"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func TestSelect(t *testing.T) {
+	reg := testRegistry(t)
+	small := Tokens{Prompt: 1000, Completion: 1000}
+	tests := []struct {
+		name      string
+		routing   Routing
+		tokens    Tokens
+		providers []string
+		want      string
+		wantCands []string
+		excluded  []string
+	}{
+		{name: "quality by default", tokens: small, want: "strong", wantCands: []string{"strong", "other", "fast"}},
+		{name: "cost", routing: Routing{Optimize: "cost"}, tokens: small, want: "other", wantCands: []string{"other", "fast", "strong"}},
+		{name: "latency", routing: Routing{Optimize: " Latency "}, tokens: small, want: "fast", wantCands: []string{"fast", "other", "strong"}},
+		{name: "served providers only", routing: Routing{Optimize: "cost"}, tokens: small, providers: []string{"azure"},
+			want: "fast", wantCands: []string{"fast", "strong"}, excluded: []string{"other"}},
+		{name: "required capability", routing: Routing{Require: []string{"JSON-mode"}}, tokens: small,
+			want: "fast", wantCands: []string{"fast"}, excluded: []string{"other", "strong"}},
+		{name: "too large for the best model", tokens: Tokens{Prompt: 7000, Completion: 2000},
+			want: "other", wantCands: []string{"other", "fast"}, excluded: []string{"strong"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := reg.Select(tt.routing, tt.tokens, tt.providers...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sel.Model != tt.want || !reflect.DeepEqual(sel.Candidates, tt.wantCands) {
+				t.Errorf("selected %s of %v, want %s of %v", sel.Model, sel.Candidates, tt.want, tt.wantCands)
+			}
+			var excluded []string
+			for name := range sel.Excluded {
+				excluded = append(excluded, name)
+			}
+			sort.Strings(excluded)
+			if strings.Join(excluded, ",") != strings.Join(tt.excluded, ",") {
+				t.Errorf("excluded %v, want %v", sel.Excluded, tt.excluded)
+			}
+			if sel.Rationale == "" || !strings.Contains(sel.Rationale, sel.Model) {
+				t.Errorf("rationale %q doesn't name %s", sel.Rationale, sel.Model)
+			}
+			m, _ := reg.Lookup(sel.Model)
+			if sel.Provider != m.Provider || sel.EstimatedCost != m.Cost(tt.tokens) {
+				t.Errorf("provider %s cost %f, want %s %f", sel.Provider, sel.EstimatedCost, m.Provider, m.Cost(tt.tokens))
+			}
+		})
+	}
+}
+
+func TestSelectRationale(t *testing.T) {
+	reg := testRegistry(t)
+	sel, _ := reg.Select(Routing{Optimize: "cost", Require: []string{"code"}}, Tokens{Prompt: 1000, Completion: 1000})
+	if want := "optimize cost: other is the cheapest of 3 models with code fitting 2000 tokens at an estimated $0.1500"; sel.Rationale != want {
+		t.Errorf("rationale = %q, want %q", sel.Rationale, want)
+	}
+	sel, _ = reg.Select(Routing{Require: []string{"vision"}}, Tokens{Prompt: 10})
+	if want := "optimize quality: other is the only model with vision fitting 10 tokens"; sel.Rationale != want {
+		t.Errorf("rationale = %q, want %q", sel.Rationale, want)
+	}
+}
+
+func TestSelectTiesPreferCheaper(t *testing.T) {
+	reg, err := Parse([]byte(`{"models": [
+		{"name": "pricey", "provider": "azure", "context_window": 1000, "input_cost_per_1k": 2, "output_cost_per_1k": 2, "latency": "low", "quality": 3},
+		{"name": "cheap", "provider": "azure", "context_window": 1000, "input_cost_per_1k": 1, "output_cost_per_1k": 1, "latency": "low", "quality": 3}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, objective := range Objectives {
+		if sel, _ := reg.Select(Routing{Optimize: objective}, Tokens{Prompt: 10}); sel.Model != "cheap" {
+			t.Errorf("%s: selected %s, want the cheaper of two equal models", objective, sel.Model)
+		}
+	}
+}
+
+func TestSelectErrors(t *testing.T) {
+	reg := testRegistry(t)
+	tests := []struct {
+		name      string
+		routing   Routing
+		tokens    Tokens
+		providers []string
+		want      string
+	}{
+		{"unknown objective", Routing{Optimize: "vibes"}, Tokens{}, nil,
+			`unknown routing objective "vibes", expected one of: cost, latency, quality`},
+		{"capability nobody offers", Routing{Require: []string{"audio"}}, Tokens{}, nil,
+			"no model offers audio, available capabilities: code, json-mode, reasoning, vision"},
+		{"capability of an unserved provider", Routing{Require: []string{"vision"}}, Tokens{}, []string{"azure"},
+			"no model offers vision, available capabilities: code, json-mode, reasoning"},
+		{"no single model with both", Routing{Require: []string{"json-mode", "reasoning"}}, Tokens{}, nil,
+			"no model offers all of: json-mode, reasoning"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := reg.Select(tt.routing, tt.tokens, tt.providers...)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	// Too large for every capable model: the error names the largest
+	_, err := reg.Select(Routing{Require: []string{"code"}}, Tokens{Prompt: 150000, Completion: 60000})
+	var tooLarge *ContextError
+	if !errors.As(err, &tooLarge) || tooLarge.Model != "other" || tooLarge.ContextWindow != 200000 || tooLarge.Tokens.Total() != 210000 {
+		t.Errorf("err = %v, want a ContextError for other", err)
+	}
+}
+
+func TestCheckContext(t *testing.T) {
+	reg := testRegistry(t)
+	if err := reg.CheckContext("strong", Tokens{Prompt: 6000, Completion: 2000}); err != nil {
+		t.Errorf("exactly the context window: %v", err)
+	}
+	err := reg.CheckContext("strong", Tokens{Prompt: 6001, Completion: 2000})
+	var tooLarge *ContextError
+	if !errors.As(err, &tooLarge) || tooLarge.Model != "strong" {
+		t.Fatalf("err = %v, want a ContextError", err)
+	}
+	if want := "request needs 8001 tokens (6001 prompt + 2000 completion) but strong has a context window of 8000 tokens"; err.Error() != want {
+		t.Errorf("err = %q, want %q", err, want)
+	}
+	if err := reg.CheckContext("unregistered", Tokens{Prompt: 1 << 30}); err != nil {
+		t.Errorf("unregistered model: %v, want it unchecked", err)
+	}
+}
+
+func TestWriteSelectionError(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteSelectionError(w, &ContextError{Model: "strong", ContextWindow: 8000, Tokens: Tokens{Prompt: 9000, Completion: 100}})
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadRequest || body["code"] != "context_length_exceeded" || body["total_tokens"] != float64(9100) {
+		t.Errorf("response = %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	WriteSelectionError(w, errors.New("no model offers audio"))
+	if w.Code != http.StatusBadRequest || strings.Contains(w.Body.String(), "context_length_exceeded") {
+		t.Errorf("response = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestParse(t *testing.T) {
+	reg, err := Parse([]byte(`{"models": [{"name": " m ", "provider": "Azure", "context_window": 10, "latency": "LOW", "quality": 1,
+		"capabilities": ["Code", "code", " "]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := reg.Models[0]
+	if m.Name != "m" || m.Provider != "azure" || m.Latency != "low" || !reflect.DeepEqual(m.Capabilities, []string{"code"}) {
+		t.Errorf("normalized to %+v", m)
+	}
+
+	model := `{"name": "m", "provider": "azure", "context_window": 10, "latency": "low", "quality": 1}`
+	for _, tt := range []struct{ registry, want string }{
+		{`{"models": []}`, "no models"},
+		{`{"models": [` + model + `, ` + model + `]}`, "listed twice"},
+		{`{"models": [{"name": "m", "context_window": 10, "latency": "low", "quality": 1}]}`, "has no provider"},
+		{`{"models": [{"name": "m", "provider": "azure", "latency": "low", "quality": 1}]}`, "positive context_window"},
+		{`{"models": [{"name": "m", "provider": "azure", "context_window": 10, "latency": "low"}]}`, "positive quality"},
+		{`{"models": [{"name": "m", "provider": "azure", "context_window": 10, "latency": "instant", "quality": 1}]}`, `latency "instant"`},
+		{`{"models": [{"name": "m", "provider": "azure", "context_window": 10, "latency": "low", "quality": 1, "input_cost_per_1k": -1}]}`, "negative cost"},
+		{`{"models": [{"name": "m", "provider": "azure", "context_window": 10, "latency": "low", "quality": 1, "window": 5}]}`, "unknown field"},
+	} {
+		if _, err := Parse([]byte(tt.registry)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.registry, err, tt.want)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	reg, err := FromEnv()
+	if err != nil || len(reg.Models) == 0 {
+		t.Fatalf("default registry = %v, %v", reg, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "models.json")
+	os.WriteFile(path, []byte(`{"models": [{"name": "m", "provider": "azure", "context_window": 10, "latency": "low", "quality": 1}]}`), 0644)
+	t.Setenv("MODEL_REGISTRY_PATH", path)
+	if reg, err = FromEnv(); err != nil || len(reg.Models) != 1 || reg.Models[0].Name != "m" {
+		t.Errorf("registry from file = %v, %v", reg, err)
+	}
+
+	t.Setenv("MODEL_REGISTRY_PATH", filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := FromEnv(); err == nil {
+		t.Error("missing registry file accepted")
+	}
+}
@@ -0,0 +1,140 @@
+// Package redact scrubs secrets and PII from prompt and completion text
+// before it is logged. It never changes what is sent to a provider or
+// returned to the caller.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// rule replaces matches of pattern with [REDACTED:name]
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// secretPatterns match common credentials. They are always applied when
+// redaction is enabled.
+var secretPatterns = []rule{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws_secret_key", regexp.MustCompile(`(?i)(aws.{0,20}(?:secret|key).{0,20}?['"=:\s])[A-Za-z0-9/+]{40}\b`)},
+	{"anthropic_key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{"openai_key", regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"bearer_token", regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/-]{16,}=*`)},
+	{"password", regexp.MustCompile(`(?i)((?:password|passwd|secret|api[_-]?key)\s*[=:]\s*['"]?)[^\s'"]{6,}`)},
+}
+
+// defaultPII is used when REDACTION_PII_PATTERNS isn't set
+var defaultPII = map[string]string{
+	"email": `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+}
+
+// Redactor scrubs text for logging. The zero value redacts nothing.
+type Redactor struct {
+	rules []rule
+}
+
+// New returns a redactor applying the built-in secret patterns and the
+// given PII patterns, keyed by the name shown in their replacement. A nil
+// pii map uses the default PII patterns.
+func New(pii map[string]string) (*Redactor, error) {
+	if pii == nil {
+		pii = defaultPII
+	}
+
+	rules := append([]rule(nil), secretPatterns...)
+	names := make([]string, 0, len(pii))
+	for name := range pii {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pattern, err := regexp.Compile(pii[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid PII pattern %q: %w", name, err)
+		}
+		rules = append(rules, rule{name: name, pattern: pattern})
+	}
+	return &Redactor{rules: rules}, nil
+}
+
+// FromEnv builds a redactor from REDACTION_ENABLED (on unless "false") and
+// REDACTION_PII_PATTERNS, a JSON object of name to regular expression that
+// replaces the default PII patterns
+func FromEnv() (*Redactor, error) {
+	if os.Getenv("REDACTION_ENABLED") == "false" {
+		return &Redactor{}, nil
+	}
+
+	var pii map[string]string
+	if raw := os.Getenv("REDACTION_PII_PATTERNS"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &pii); err != nil {
+			return nil, fmt.Errorf("invalid REDACTION_PII_PATTERNS: %w", err)
+		}
+	}
+	return New(pii)
+}
+
+// Enabled reports whether the redactor changes anything
+func (r *Redactor) Enabled() bool {
+	return r != nil && len(r.rules) > 0
+}
+
+// String returns s with every secret and PII match replaced by
+// [REDACTED:<name>]. Patterns with a leading capture group, such as
+// "password=", keep that group so the context stays readable.
+func (r *Redactor) String(s string) string {
+	if !r.Enabled() || s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		replacement := "[REDACTED:" + rule.name + "]"
+		if rule.pattern.NumSubexp() > 0 {
+			replacement = "${1}" + replacement
+		}
+		s = rule.pattern.ReplaceAllString(s, replacement)
+	}
+	return s
+}
+
+// JSON marshals v and redacts the result, for logging provider payloads
+func (r *Redactor) JSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return r.String(fmt.Sprint(v))
+	}
+	return r.String(string(data))
+}
+
+// CacheKey derives a cache key from request content. The content is hashed
+// rather than redacted: the key carries no plaintext, and requests that
+// differ only in a secret don't share cached responses.
+func CacheKey(prefix string, parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return prefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// Preview returns at most n runes of s, redacted, for debug logs
+func (r *Redactor) Preview(s string, n int) string {
+	s = r.String(s)
+	if runes := []rune(s); len(runes) > n {
+		return strings.TrimSpace(string(runes[:n])) + "..."
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+// Package routing chooses the Azure OpenAI deployment for a request from
+// the kind of task it performs
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Tasks with a default deployment. A policy may add others.
+const (
+	TaskCode      = "code"
+	TaskReason    = "reason"
+	TaskSummarize = "summarize"
+	TaskClassify  = "classify"
+)
+
+// Defaults used when AZURE_OPENAI_DEPLOYMENT and AZURE_OPENAI_SMALL_DEPLOYMENT
+// are not set
+const (
+	DefaultDeployment = "gpt-4.1"
+	SmallDeployment   = "gpt-4.1-mini"
+
+	// smallMaxTokens is the max_tokens below which a request without a
+	// task goes to the small deployment
+	smallMaxTokens = 500
+)
+
+// Policy maps tasks to deployments
+type Policy struct {
+	Default string
+	Small   string
+	Tasks   map[string]string
+}
+
+// Decision is the deployment chosen for a request and why
+type Decision struct {
+	Model  string `json:"model"`
+	Reason string `json:"reason"`
+}
+
+// DefaultPolicy sends code generation and reasoning to the default
+// deployment and short, shallow tasks to the small one
+func DefaultPolicy(defaultModel, smallModel string) Policy {
+	return Policy{
+		Default: defaultModel,
+		Small:   smallModel,
+		Tasks: map[string]string{
+			TaskCode:      defaultModel,
+			TaskReason:    defaultModel,
+			TaskSummarize: smallModel,
+			TaskClassify:  smallModel,
+		},
+	}
+}
+
+// FromEnv builds the default policy from AZURE_OPENAI_DEPLOYMENT and
+// AZURE_OPENAI_SMALL_DEPLOYMENT, then applies MODEL_ROUTING_POLICY, a JSON
+// object of task to deployment that adds tasks or replaces their defaults
+func FromEnv() (Policy, error) {
+	defaultModel := os.Getenv("AZURE_OPENAI_DEPLOYMENT")
+	if defaultModel == "" {
+		defaultModel = DefaultDeployment
+	}
+	smallModel := os.Getenv("AZURE_OPENAI_SMALL_DEPLOYMENT")
+	if smallModel == "" {
+		smallModel = SmallDeployment
+	}
+	policy := DefaultPolicy(defaultModel, smallModel)
+
+	if raw := os.Getenv("MODEL_ROUTING_POLICY"); raw != "" {
+		var tasks map[string]string
+		if err := json.Unmarshal([]byte(raw), &tasks); err != nil {
+			return Policy{}, fmt.Errorf("invalid MODEL_ROUTING_POLICY: %w", err)
+		}
+		for task, model := range tasks {
+			task = strings.ToLower(strings.TrimSpace(task))
+			if task == "" || model == "" {
+				return Policy{}, fmt.Errorf("invalid MODEL_ROUTING_POLICY: empty task or model")
+			}
+			policy.Tasks[task] = model
+		}
+	}
+	return policy, nil
+}
+
+// Route picks the deployment for a request. An explicit model always wins;
+// otherwise the task decides. Requests without a task keep the old
+// behaviour of sending small max_tokens to the small deployment.
+func (p Policy) Route(task, model string, maxTokens int) (Decision, error) {
+	if model != "" {
+		return Decision{Model: model, Reason: "explicit model"}, nil
+	}
+
+	if task = strings.ToLower(strings.TrimSpace(task)); task != "" {
+		m, ok := p.Tasks[task]
+		if !ok {
+			return Decision{}, fmt.Errorf("unknown task %q, expected one of: %s", task, strings.Join(p.TaskNames(), ", "))
+		}
+		return Decision{Model: m, Reason: "task " + task}, nil
+	}
+
+	if maxTokens > 0 && maxTokens < smallMaxTokens {
+		return Decision{Model: p.Small, Reason: fmt.Sprintf("max_tokens below %d", smallMaxTokens)}, nil
+	}
+	return Decision{Model: p.Default, Reason: "default"}, nil
+}
+
+// TaskNames returns the tasks the policy routes, sorted
+func (p Policy) TaskNames() []string {
+	names := make([]string, 0, len(p.Tasks))
+	for task := range p.Tasks {
+		names = append(names, task)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,95 @@
+package routing
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	policy := DefaultPolicy("big", "small")
+	policy.Tasks["translate"] = "translator"
+
+	tests := []struct {
+		name      string
+		task      string
+		model     string
+		maxTokens int
+		want      Decision
+		wantErr   string
+	}{
+		{name: "code", task: "code", want: Decision{Model: "big", Reason: "task code"}},
+		{name: "reason", task: "reason", maxTokens: 100, want: Decision{Model: "big", Reason: "task reason"}},
+		{name: "summarize", task: "summarize", maxTokens: 4000, want: Decision{Model: "small", Reason: "task summarize"}},
+		{name: "classify", task: " Classify ", want: Decision{Model: "small", Reason: "task classify"}},
+		{name: "added task", task: "translate", want: Decision{Model: "translator", Reason: "task translate"}},
+		{name: "explicit model over task", task: "summarize", model: "big-32k", want: Decision{Model: "big-32k", Reason: "explicit model"}},
+		{name: "explicit model over unknown task", task: "poetry", model: "big", want: Decision{Model: "big", Reason: "explicit model"}},
+		{name: "no task, small budget", maxTokens: 499, want: Decision{Model: "small", Reason: "max_tokens below 500"}},
+		{name: "no task, large budget", maxTokens: 500, want: Decision{Model: "big", Reason: "default"}},
+		{name: "no task, no budget", want: Decision{Model: "big", Reason: "default"}},
+		{name: "unknown task", task: "poetry", wantErr: `unknown task "poetry", expected one of: classify, code, reason, summarize, translate`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Route(tt.task, tt.model, tt.maxTokens)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Route(%q, %q, %d) = %+v, want %+v", tt.task, tt.model, tt.maxTokens, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	policy, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(policy, DefaultPolicy(DefaultDeployment, SmallDeployment)) {
+		t.Errorf("policy = %+v, want the default deployments", policy)
+	}
+
+	t.Setenv("AZURE_OPENAI_DEPLOYMENT", "gpt-4o")
+	t.Setenv("AZURE_OPENAI_SMALL_DEPLOYMENT", "gpt-4o-mini")
+	t.Setenv("MODEL_ROUTING_POLICY", `{"Summarize": "gpt-4o", " extract ": "gpt-4o-mini"}`)
+	policy, err = FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		TaskCode:      "gpt-4o",
+		TaskReason:    "gpt-4o",
+		TaskSummarize: "gpt-4o",
+		TaskClassify:  "gpt-4o-mini",
+		"extract":     "gpt-4o-mini",
+	}
+	if policy.Default != "gpt-4o" || policy.Small != "gpt-4o-mini" || !reflect.DeepEqual(policy.Tasks, want) {
+		t.Errorf("policy = %+v, want overrides applied to %v", policy, want)
+	}
+}
+
+func TestFromEnvRejectsInvalidPolicy(t *testing.T) {
+	for _, raw := range []string{`not json`, `["code"]`, `{"": "gpt-4o"}`, `{"code": ""}`} {
+		t.Setenv("MODEL_ROUTING_POLICY", raw)
+		if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), "MODEL_ROUTING_POLICY") {
+			t.Errorf("%s: err = %v, want an invalid MODEL_ROUTING_POLICY error", raw, err)
+		}
+	}
+}
+
+func TestDefaultPoliciesDontShareTasks(t *testing.T) {
+	a := DefaultPolicy("big", "small")
+	a.Tasks[TaskCode] = "changed"
+	if b := DefaultPolicy("big", "small"); b.Tasks[TaskCode] != "big" {
+		t.Errorf("code routes to %q after changing another policy", b.Tasks[TaskCode])
+	}
+}
@@ -0,0 +1,224 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Paths the handler serves
+const (
+	TemplatesPath = "/api/v1/templates"
+	UsagePath     = "/api/v1/usage/templates"
+)
+
+// Handler serves the template API:
+//
+//	POST /api/v1/templates                      create version 1
+//	GET  /api/v1/templates                      latest version of each
+//	GET  /api/v1/templates/{name}[?version=N]   one version, latest by default
+//	PUT  /api/v1/templates/{name}               add the next version
+//	GET  /api/v1/templates/{name}/versions      every version
+//	GET  /api/v1/templates/{name}/usage         usage per version
+//	GET  /api/v1/usage/templates                usage of every template
+type Handler struct {
+	store Store
+}
+
+// NewHandler serves the templates in store
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+// Register adds the handler's routes to mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle(TemplatesPath, h)
+	mux.Handle(TemplatesPath+"/", h)
+	mux.Handle(UsagePath, h)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == UsagePath {
+		h.serveStats(w, r, "")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, TemplatesPath), "/"), "/")
+	switch {
+	case parts[0] == "":
+		h.serveCollection(w, r)
+	case len(parts) == 1:
+		h.serveTemplate(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "versions":
+		h.serveVersions(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "usage":
+		h.serveStats(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// templateRequest is the body of a create or update
+type templateRequest struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Body        string  `json:"body"`
+	Model       string  `json:"model"`
+	Task        string  `json:"task"`
+	MaxTokens   int     `json:"max_tokens"`
+	Temperature float64 `json:"temperature"`
+}
+
+func (h *Handler) serveCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		templates, err := h.store.List(r.Context())
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"templates": templates, "total": len(templates)})
+	case http.MethodPost:
+		t, ok := readTemplate(w, r, "")
+		if !ok {
+			return
+		}
+		created, err := h.store.Create(r.Context(), t)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *Handler) serveTemplate(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		version := 0
+		if v := r.URL.Query().Get("version"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				writeError(w, http.StatusBadRequest, "version must be a positive integer")
+				return
+			}
+			version = n
+		}
+		t, err := h.store.Get(r.Context(), name, version)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	case http.MethodPut:
+		t, ok := readTemplate(w, r, name)
+		if !ok {
+			return
+		}
+		added, err := h.store.AddVersion(r.Context(), t)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, added)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *Handler) serveVersions(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	versions, err := h.store.Versions(r.Context(), name)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"name": name, "versions": versions})
+}
+
+func (h *Handler) serveStats(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	stats, err := h.store.Stats(r.Context(), name)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"usage": stats})
+}
+
+// readTemplate reads and validates a template from the request body. For
+// updates the name comes from the path.
+func readTemplate(w http.ResponseWriter, r *http.Request, name string) (*Template, bool) {
+	var req templateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxBodyBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return nil, false
+	}
+	if name != "" {
+		if req.Name != "" && req.Name != name {
+			writeError(w, http.StatusBadRequest, "name in body does not match the path")
+			return nil, false
+		}
+		req.Name = name
+	}
+
+	t := &Template{
+		Name:        req.Name,
+		Description: req.Description,
+		Body:        req.Body,
+		Model:       req.Model,
+		Task:        req.Task,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+	if err := t.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return t, true
+}
+
+// WriteRenderError responds to a failed render: 404 for an unknown
+// template, 400 listing any missing variables
+func WriteRenderError(w http.ResponseWriter, err error) {
+	var missing *MissingVariablesError
+	if errors.As(err, &missing) {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":             err.Error(),
+			"missing_variables": missing.Missing,
+		})
+		return
+	}
+	writeStoreError(w, err)
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrExists):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,231 @@
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Each template's versions are an append-only Redis list, so a version's
+// number is its position and stored versions are never rewritten
+const (
+	redisTemplateKeyPrefix = "llm-router:template:"
+	redisTemplateNamesKey  = "llm-router:templates"
+	redisUsageKeyPrefix    = "llm-router:template-usage:"
+)
+
+// appendVersion pushes a version only if the template's existence matches
+// ARGV[2] ("0" to create, "1" to add a version) and returns the new
+// version, or 0 if it didn't match
+var appendVersion = redis.NewScript(`
+if tostring(redis.call('EXISTS', KEYS[1])) ~= ARGV[2] then
+	return 0
+end
+redis.call('SADD', KEYS[2], ARGV[3])
+return redis.call('RPUSH', KEYS[1], ARGV[1])
+`)
+
+// RedisStore keeps templates and their usage in Redis
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore stores templates with an existing Redis client
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Create(ctx context.Context, t *Template) (*Template, error) {
+	stored, err := s.append(ctx, t, "0")
+	if err == ErrNotFound {
+		return nil, ErrExists
+	}
+	return stored, err
+}
+
+func (s *RedisStore) AddVersion(ctx context.Context, t *Template) (*Template, error) {
+	return s.append(ctx, t, "1")
+}
+
+func (s *RedisStore) append(ctx context.Context, t *Template, exists string) (*Template, error) {
+	stored := *t
+	stored.Version = 0
+	stored.CreatedAt = time.Now().UTC()
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode template: %w", err)
+	}
+
+	keys := []string{redisTemplateKeyPrefix + t.Name, redisTemplateNamesKey}
+	version, err := appendVersion.Run(ctx, s.client, keys, data, exists, t.Name).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save template: %w", err)
+	}
+	if version == 0 {
+		return nil, ErrNotFound
+	}
+	stored.Version = version
+	return &stored, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, name string, version int) (*Template, error) {
+	key := redisTemplateKeyPrefix + name
+	var data string
+	var err error
+	if version == 0 {
+		var length *redis.IntCmd
+		var last *redis.StringCmd
+		_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			length = pipe.LLen(ctx, key)
+			last = pipe.LIndex(ctx, key, -1)
+			return nil
+		})
+		if err == nil {
+			version, data = int(length.Val()), last.Val()
+		}
+	} else if version > 0 {
+		data, err = s.client.LIndex(ctx, key, int64(version-1)).Result()
+	} else {
+		return nil, ErrNotFound
+	}
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return decodeTemplate(data, version)
+}
+
+func (s *RedisStore) Versions(ctx context.Context, name string) ([]*Template, error) {
+	values, err := s.client.LRange(ctx, redisTemplateKeyPrefix+name, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list template versions: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+
+	versions := make([]*Template, 0, len(values))
+	for i, data := range values {
+		t, err := decodeTemplate(data, i+1)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, t)
+	}
+	return versions, nil
+}
+
+func (s *RedisStore) List(ctx context.Context) ([]*Template, error) {
+	names, err := s.client.SMembers(ctx, redisTemplateNamesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	sort.Strings(names)
+
+	latest := make([]*Template, 0, len(names))
+	for _, name := range names {
+		t, err := s.Get(ctx, name, 0)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		latest = append(latest, t)
+	}
+	return latest, nil
+}
+
+func (s *RedisStore) RecordUsage(ctx context.Context, name string, version int, usage Usage) error {
+	key := fmt.Sprintf("%s%s:%d", redisUsageKeyPrefix, name, version)
+	failed := 0
+	if usage.Failed {
+		failed = 1
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.HIncrBy(ctx, key, "calls", 1)
+	pipe.HIncrBy(ctx, key, "errors", int64(failed))
+	pipe.HIncrBy(ctx, key, "prompt_tokens", int64(usage.PromptTokens))
+	pipe.HIncrBy(ctx, key, "completion_tokens", int64(usage.CompletionTokens))
+	pipe.HSet(ctx, key, "last_used_at", time.Now().UTC().Format(time.RFC3339Nano))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record template usage: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Stats(ctx context.Context, name string) ([]Stats, error) {
+	var names []string
+	if name != "" {
+		exists, err := s.client.Exists(ctx, redisTemplateKeyPrefix+name).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get template: %w", err)
+		}
+		if exists == 0 {
+			return nil, ErrNotFound
+		}
+		names = []string{name}
+	} else {
+		var err error
+		if names, err = s.client.SMembers(ctx, redisTemplateNamesKey).Result(); err != nil {
+			return nil, fmt.Errorf("failed to list templates: %w", err)
+		}
+	}
+
+	all := []Stats{}
+	for _, n := range names {
+		count, err := s.client.LLen(ctx, redisTemplateKeyPrefix+n).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get template: %w", err)
+		}
+		for version := 1; version <= int(count); version++ {
+			fields, err := s.client.HGetAll(ctx, fmt.Sprintf("%s%s:%d", redisUsageKeyPrefix, n, version)).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get template usage: %w", err)
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			all = append(all, decodeStats(n, version, fields))
+		}
+	}
+	sortStats(all)
+	return all, nil
+}
+
+func decodeTemplate(data string, version int) (*Template, error) {
+	var t Template
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return nil, fmt.Errorf("failed to decode template: %w", err)
+	}
+	t.Version = version
+	return &t, nil
+}
+
+func decodeStats(name string, version int, fields map[string]string) Stats {
+	count := func(field string) int64 {
+		n, _ := strconv.ParseInt(fields[field], 10, 64)
+		return n
+	}
+	stats := Stats{
+		Name:             name,
+		Version:          version,
+		Calls:            count("calls"),
+		Errors:           count("errors"),
+		PromptTokens:     count("prompt_tokens"),
+		CompletionTokens: count("completion_tokens"),
+	}
+	if at, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(fields["last_used_at"])); err == nil {
+		stats.LastUsedAt = &at
+	}
+	return stats
+}
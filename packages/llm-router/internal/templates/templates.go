@@ -0,0 +1,304 @@
+// Package templates stores named, versioned prompt templates and renders
+// them for /generate. Versions are immutable: changing a template adds a
+// version, so a workflow that pins one always renders the same prompt.
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("template not found")
+	ErrExists   = errors.New("template already exists")
+)
+
+// maxBodyBytes caps the size of a template body
+const maxBodyBytes = 64 << 10
+
+var (
+	namePattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,99}$`)
+	variablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+)
+
+// Template is one version of a prompt template. Body refers to variables as
+// {{name}}; the other fields are defaults for requests that use it.
+type Template struct {
+	Name        string    `json:"name"`
+	Version     int       `json:"version"`
+	Description string    `json:"description,omitempty"`
+	Body        string    `json:"body"`
+	Variables   []string  `json:"variables"`
+	Model       string    `json:"model,omitempty"`
+	Task        string    `json:"task,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+	Temperature float64   `json:"temperature,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Ref selects a template version and the values for its variables. A zero
+// version means the latest, which replays can't rely on.
+type Ref struct {
+	Name      string                 `json:"name"`
+	Version   int                    `json:"version,omitempty"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Usage is one call of a template
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	Failed           bool
+}
+
+// Stats are the accumulated calls of one template version
+type Stats struct {
+	Name             string     `json:"name"`
+	Version          int        `json:"version"`
+	Calls            int64      `json:"calls"`
+	Errors           int64      `json:"errors"`
+	PromptTokens     int64      `json:"prompt_tokens"`
+	CompletionTokens int64      `json:"completion_tokens"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Store persists templates. Implementations must be safe for concurrent
+// use and never change a stored version.
+type Store interface {
+	// Create stores version 1 of a new template, or returns ErrExists
+	Create(ctx context.Context, t *Template) (*Template, error)
+	// AddVersion stores the next version of an existing template
+	AddVersion(ctx context.Context, t *Template) (*Template, error)
+	// Get returns a version of a template, the latest if version is zero
+	Get(ctx context.Context, name string, version int) (*Template, error)
+	// Versions returns every version of a template, oldest first
+	Versions(ctx context.Context, name string) ([]*Template, error)
+	// List returns the latest version of every template, sorted by name
+	List(ctx context.Context) ([]*Template, error)
+
+	RecordUsage(ctx context.Context, name string, version int, usage Usage) error
+	// Stats returns usage per version of a template, or of every template
+	// if name is empty
+	Stats(ctx context.Context, name string) ([]Stats, error)
+}
+
+// Validate checks a template's name and body and fills in its variables
+func (t *Template) Validate() error {
+	if !namePattern.MatchString(t.Name) {
+		return fmt.Errorf("invalid template name %q: use lowercase letters, digits, '.', '_' and '-'", t.Name)
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return fmt.Errorf("template body is required")
+	}
+	if len(t.Body) > maxBodyBytes {
+		return fmt.Errorf("template body exceeds %d bytes", maxBodyBytes)
+	}
+	if t.MaxTokens < 0 || t.Temperature < 0 || t.Temperature > 2 {
+		return fmt.Errorf("max_tokens must not be negative and temperature must be between 0 and 2")
+	}
+	t.Variables = variableNames(t.Body)
+	return nil
+}
+
+// variableNames returns the distinct variables a body uses, sorted
+func variableNames(body string) []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, match := range variablePattern.FindAllStringSubmatch(body, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MissingVariablesError is returned when rendering without a value for
+// every variable
+type MissingVariablesError struct {
+	Missing []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return "missing template variables: " + strings.Join(e.Missing, ", ")
+}
+
+// Render substitutes variables into the body. Strings are inserted as-is
+// and other values as JSON.
+func (t *Template) Render(variables map[string]interface{}) (string, error) {
+	var missing []string
+	for _, name := range t.Variables {
+		if _, ok := variables[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", &MissingVariablesError{Missing: missing}
+	}
+
+	return variablePattern.ReplaceAllStringFunc(t.Body, func(match string) string {
+		name := variablePattern.FindStringSubmatch(match)[1]
+		switch v := variables[name].(type) {
+		case string:
+			return v
+		default:
+			data, _ := json.Marshal(v)
+			return string(data)
+		}
+	}), nil
+}
+
+// MemoryStore keeps templates in memory; they are lost on restart
+type MemoryStore struct {
+	versions map[string][]*Template
+	stats    map[string]map[int]*Stats
+	mu       sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		versions: make(map[string][]*Template),
+		stats:    make(map[string]map[int]*Stats),
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, t *Template) (*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.versions[t.Name]; ok {
+		return nil, ErrExists
+	}
+	return s.add(t), nil
+}
+
+func (s *MemoryStore) AddVersion(ctx context.Context, t *Template) (*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.versions[t.Name]; !ok {
+		return nil, ErrNotFound
+	}
+	return s.add(t), nil
+}
+
+// add appends t as the next version. The caller holds s.mu.
+func (s *MemoryStore) add(t *Template) *Template {
+	stored := *t
+	stored.Version = len(s.versions[t.Name]) + 1
+	stored.CreatedAt = time.Now().UTC()
+	s.versions[t.Name] = append(s.versions[t.Name], &stored)
+
+	copied := stored
+	return &copied
+}
+
+func (s *MemoryStore) Get(ctx context.Context, name string, version int) (*Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions := s.versions[name]
+	if version == 0 {
+		version = len(versions)
+	}
+	if version < 1 || version > len(versions) {
+		return nil, ErrNotFound
+	}
+	copied := *versions[version-1]
+	return &copied, nil
+}
+
+func (s *MemoryStore) Versions(ctx context.Context, name string) ([]*Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions, ok := s.versions[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := make([]*Template, 0, len(versions))
+	for _, t := range versions {
+		c := *t
+		copied = append(copied, &c)
+	}
+	return copied, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*Template, error) {
+	s.mu.RLock()
+	latest := make([]*Template, 0, len(s.versions))
+	for _, versions := range s.versions {
+		c := *versions[len(versions)-1]
+		latest = append(latest, &c)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(latest, func(i, j int) bool { return latest[i].Name < latest[j].Name })
+	return latest, nil
+}
+
+func (s *MemoryStore) RecordUsage(ctx context.Context, name string, version int, usage Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stats[name] == nil {
+		s.stats[name] = make(map[int]*Stats)
+	}
+	stats, ok := s.stats[name][version]
+	if !ok {
+		stats = &Stats{Name: name, Version: version}
+		s.stats[name][version] = stats
+	}
+	stats.add(usage, time.Now().UTC())
+	return nil
+}
+
+func (s *MemoryStore) Stats(ctx context.Context, name string) ([]Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if name != "" {
+		if _, ok := s.versions[name]; !ok {
+			return nil, ErrNotFound
+		}
+	}
+	all := []Stats{}
+	for n, versions := range s.stats {
+		if name != "" && n != name {
+			continue
+		}
+		for _, stats := range versions {
+			all = append(all, *stats)
+		}
+	}
+	sortStats(all)
+	return all, nil
+}
+
+func (s *Stats) add(usage Usage, at time.Time) {
+	s.Calls++
+	if usage.Failed {
+		s.Errors++
+	}
+	s.PromptTokens += int64(usage.PromptTokens)
+	s.CompletionTokens += int64(usage.CompletionTokens)
+	s.LastUsedAt = &at
+}
+
+func sortStats(stats []Stats) {
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Name != stats[j].Name {
+			return stats[i].Name < stats[j].Name
+		}
+		return stats[i].Version < stats[j].Version
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxBatchSteps bounds how many requests one batch may carry
+const maxBatchSteps = 50
+
+// BatchMode decides what a batch does after a step fails
+type BatchMode string
+
+const (
+	// BatchStopOnError skips the steps after the first failure
+	BatchStopOnError BatchMode = "stop_on_error"
+	// BatchContinue runs every step whatever the earlier ones did
+	BatchContinue BatchMode = "continue"
+)
+
+// BatchRequest is an ordered list of MCP requests executed one after the
+// other. Steps without a service, auth or request ID take the batch's.
+type BatchRequest struct {
+	Requests  []MCPRequest `json:"requests"`
+	Mode      BatchMode    `json:"mode"` // stop_on_error (default) or continue
+	Service   string       `json:"service"`
+	RequestID string       `json:"request_id"`
+	Auth      *AuthContext `json:"auth,omitempty"`
+}
+
+// BatchStep is the outcome of one request in a batch
+type BatchStep struct {
+	Index  int    `json:"index"`
+	Tool   string `json:"tool"`
+	Status int    `json:"status"` // the status /api/v1/execute would have answered with
+	// Skipped steps weren't run because an earlier step failed
+	Skipped bool `json:"skipped,omitempty"`
+	MCPResponse
+}
+
+// BatchResponse reports every step of a batch in request order
+type BatchResponse struct {
+	Success   bool        `json:"success"` // every step succeeded
+	Mode      BatchMode   `json:"mode"`
+	RequestID string      `json:"request_id"`
+	Steps     []BatchStep `json:"steps"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Skipped   int         `json:"skipped"`
+	Duration  float64     `json:"duration_ms"`
+}
+
+// validate checks a batch and fills in its defaults
+func (b *BatchRequest) validate() error {
+	if len(b.Requests) == 0 {
+		return fmt.Errorf("batch has no requests")
+	}
+	if len(b.Requests) > maxBatchSteps {
+		return fmt.Errorf("batch has %d requests, at most %d are allowed", len(b.Requests), maxBatchSteps)
+	}
+	switch b.Mode {
+	case "":
+		b.Mode = BatchStopOnError
+	case BatchStopOnError, BatchContinue:
+	default:
+		return fmt.Errorf("unknown batch mode %q: use %s or %s", b.Mode, BatchStopOnError, BatchContinue)
+	}
+	for i, req := range b.Requests {
+		if req.Tool == "" {
+			return fmt.Errorf("request %d has no tool", i)
+		}
+	}
+	return nil
+}
+
+// step returns the batch's i-th request with the batch's defaults applied
+func (b *BatchRequest) step(i int) MCPRequest {
+	req := b.Requests[i]
+	if req.Service == "" {
+		req.Service = b.Service
+	}
+	if req.Auth == nil {
+		req.Auth = b.Auth
+	}
+	if req.RequestID == "" && b.RequestID != "" {
+		req.RequestID = fmt.Sprintf("%s.%d", b.RequestID, i)
+	}
+	return req
+}
+
+// executeBatch runs a batch's steps in order. Each step goes through the
+// cache, rate limiter and circuit breakers as if it were sent on its own.
+func (g *MCPGateway) executeBatch(batch BatchRequest) BatchResponse {
+	start := time.Now()
+	response := BatchResponse{Mode: batch.Mode, RequestID: batch.RequestID, Steps: make([]BatchStep, len(batch.Requests))}
+
+	failed := false
+	for i := range batch.Requests {
+		req := batch.step(i)
+		step := &response.Steps[i]
+		step.Index, step.Tool = i, req.Tool
+		if failed && batch.Mode == BatchStopOnError {
+			step.Skipped = true
+			step.RequestID = req.RequestID
+			step.Error = "skipped after an earlier step failed"
+			response.Skipped++
+			continue
+		}
+
+		var err error
+		step.MCPResponse, step.Status, err = g.run(req)
+		if err != nil {
+			failed = true
+			response.Failed++
+			continue
+		}
+		response.Succeeded++
+	}
+
+	response.Success = !failed
+	response.Duration = float64(time.Since(start).Milliseconds())
+	return response
+}
+
+// executeBatchHandler runs several MCP requests in one round-trip. The
+// batch answers 200 whatever its steps did; each step carries its own
+// status.
+func (g *MCPGateway) executeBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var batch BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := batch.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.executeBatch(batch))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// batchGateway is a gateway whose JIRA fails for QL-404 and counts the
+// other tickets it serves
+func batchGateway(t *testing.T) (*MCPGateway, *int32) {
+	var served int32
+	jira := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/QL-404") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		atomic.AddInt32(&served, 1)
+		w.Write([]byte(`{"id": "10001", "key": "QL-1", "fields": {"summary": "Generation failed"}}`))
+	}))
+	t.Cleanup(jira.Close)
+	t.Setenv("JIRA_BASE_URL", jira.URL)
+	return NewMCPGateway(), &served
+}
+
+func executeBatchRequest(t *testing.T, gateway *MCPGateway, mode string) BatchResponse {
+	t.Helper()
+	body := `{"mode": "` + mode + `", "service": "qtest", "request_id": "batch-1", "requests": [
+		{"tool": "github.read_repo", "input": {"repo": "quantumlayer/platform"}},
+		{"tool": "jira.get_ticket", "input": {"key": "QL-404"}},
+		{"tool": "jira.get_ticket", "input": {"key": "QL-1"}, "request_id": "lookup"}
+	]}`
+	w := httptest.NewRecorder()
+	gateway.executeBatchHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/execute-batch", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var response BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Steps) != 3 {
+		t.Fatalf("steps = %+v, want 3", response.Steps)
+	}
+	return response
+}
+
+func TestExecuteBatchStopsOnError(t *testing.T) {
+	gateway, served := batchGateway(t)
+	response := executeBatchRequest(t, gateway, "")
+
+	if response.Success || response.Mode != BatchStopOnError {
+		t.Errorf("batch = success %v, mode %s, want a failed stop_on_error batch", response.Success, response.Mode)
+	}
+	if response.Succeeded != 1 || response.Failed != 1 || response.Skipped != 1 {
+		t.Errorf("counts = %d/%d/%d, want 1 succeeded, 1 failed, 1 skipped", response.Succeeded, response.Failed, response.Skipped)
+	}
+
+	steps := response.Steps
+	if !steps[0].Success || steps[0].Status != http.StatusOK || steps[0].RequestID != "batch-1.0" {
+		t.Errorf("step 0 = %+v, want success as batch-1.0", steps[0])
+	}
+	if steps[1].Success || steps[1].Status != http.StatusBadGateway || steps[1].Details == nil {
+		t.Errorf("step 1 = %+v, want JIRA's failure as 502", steps[1])
+	}
+	if !steps[2].Skipped || steps[2].Success || steps[2].RequestID != "lookup" {
+		t.Errorf("step 2 = %+v, want skipped", steps[2])
+	}
+	if *served != 0 {
+		t.Errorf("JIRA served %d tickets after the failure", *served)
+	}
+}
+
+func TestExecuteBatchContinuesAfterError(t *testing.T) {
+	gateway, served := batchGateway(t)
+	response := executeBatchRequest(t, gateway, "continue")
+
+	if response.Success || response.Succeeded != 2 || response.Failed != 1 || response.Skipped != 0 {
+		t.Errorf("batch = %+v, want 2 succeeded and 1 failed", response)
+	}
+	if response.Steps[1].Status != http.StatusBadGateway {
+		t.Errorf("step 1 = %+v, want 502", response.Steps[1])
+	}
+	step := response.Steps[2]
+	if step.Skipped || !step.Success || step.Status != http.StatusOK || step.Index != 2 || step.Tool != "jira.get_ticket" {
+		t.Errorf("step 2 = %+v, want the ticket", step)
+	}
+	if ticket, _ := step.Data.(map[string]interface{}); ticket["key"] != "QL-1" {
+		t.Errorf("step 2 data = %v", step.Data)
+	}
+	if *served != 1 {
+		t.Errorf("JIRA served %d tickets, want 1", *served)
+	}
+}
+
+func TestExecuteBatchValidates(t *testing.T) {
+	gateway := &MCPGateway{}
+	for _, body := range []string{
+		`{"requests": []}`,
+		`{"mode": "retry", "requests": [{"tool": "github.read_repo"}]}`,
+		`{"requests": [{"input": {}}]}`,
+		`{"requests": [` + strings.Repeat(`{"tool": "github.read_repo"},`, maxBatchSteps) + `{"tool": "github.read_repo"}]}`,
+	} {
+		w := httptest.NewRecorder()
+		gateway.executeBatchHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/execute-batch", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status %d for %.60s, want 400", w.Code, body)
+		}
+	}
+}
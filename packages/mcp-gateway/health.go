@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var circuitState = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "mcp_gateway_circuit_state",
+		Help: "Connector circuit breaker state: 0 closed, 1 half-open, 2 open",
+	},
+	[]string{"connector"},
+)
+
+func init() {
+	prometheus.MustRegister(circuitState)
+}
+
+// Pinger is a connector that can check its upstream is reachable
+type Pinger interface {
+	Configured() bool
+	Ping(ctx context.Context) error
+}
+
+// BreakerState is the state of a connector's circuit breaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerSettings tune every connector's circuit breaker
+type BreakerSettings struct {
+	// FailureThreshold consecutive upstream failures open the circuit
+	FailureThreshold int
+	// Cooldown is how long an open circuit rejects calls before letting
+	// one through to test the connector
+	Cooldown time.Duration
+}
+
+// breakerSettingsFromEnv reads MCP_BREAKER_FAILURES and
+// MCP_BREAKER_COOLDOWN, defaulting to 5 failures and 30s
+func breakerSettingsFromEnv() BreakerSettings {
+	settings := BreakerSettings{FailureThreshold: 5, Cooldown: 30 * time.Second}
+	if n, err := strconv.Atoi(os.Getenv("MCP_BREAKER_FAILURES")); err == nil && n > 0 {
+		settings.FailureThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("MCP_BREAKER_COOLDOWN")); err == nil && d > 0 {
+		settings.Cooldown = d
+	}
+	return settings
+}
+
+// CircuitOpenError rejects a call to a connector whose circuit is open
+type CircuitOpenError struct {
+	Connector  string `json:"connector"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after"` // seconds until a call may go through
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s connector unavailable: %s", e.Connector, e.Message)
+}
+
+// GatewayStatus is 503: the connector is failing, not the request
+func (e *CircuitOpenError) GatewayStatus() int {
+	return http.StatusServiceUnavailable
+}
+
+// isConnectorFailure reports whether err means the connector's upstream
+// failed. Errors the caller caused, which connectors answer with a 4xx,
+// don't count against it.
+func isConnectorFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var connErr gatewayError
+	if errors.As(err, &connErr) && connErr.GatewayStatus() < 500 {
+		return false
+	}
+	return true
+}
+
+// CircuitBreaker stops calling a connector after repeated failures, then
+// lets a single call through after a cooldown to see if it has recovered
+type CircuitBreaker struct {
+	name     string
+	settings BreakerSettings
+	now      func() time.Time
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	lastError string
+	trial     bool // a half-open call is in flight
+}
+
+func newCircuitBreaker(name string, settings BreakerSettings) *CircuitBreaker {
+	b := &CircuitBreaker{name: name, settings: settings, now: time.Now, state: BreakerClosed}
+	circuitState.WithLabelValues(name).Set(0)
+	return b
+}
+
+// setState must be called with mu held
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state != state {
+		log.Printf("Circuit for %s connector is now %s", b.name, state)
+	}
+	b.state = state
+	value := map[BreakerState]float64{BreakerClosed: 0, BreakerHalfOpen: 1, BreakerOpen: 2}[state]
+	circuitState.WithLabelValues(b.name).Set(value)
+}
+
+// allow reports whether a call may go ahead, or the error rejecting it
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		if wait := b.openedAt.Add(b.settings.Cooldown).Sub(b.now()); wait > 0 {
+			return b.openError(wait)
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.trial {
+			return b.openError(0)
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// openError must be called with mu held
+func (b *CircuitBreaker) openError(wait time.Duration) *CircuitOpenError {
+	message := fmt.Sprintf("circuit open after %d consecutive failures", b.failures)
+	if b.lastError != "" {
+		message += ", last: " + b.lastError
+	}
+	return &CircuitOpenError{
+		Connector:  b.name,
+		Code:       "circuit_open",
+		Message:    message,
+		RetryAfter: max(1, int(math.Ceil(wait.Seconds()))),
+	}
+}
+
+// record counts the outcome of a call allow let through
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if !isConnectorFailure(err) {
+		b.failures = 0
+		b.setState(BreakerClosed)
+		return
+	}
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == BreakerHalfOpen || b.failures >= b.settings.FailureThreshold {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// Call runs fn unless the circuit is open, and records how it went
+func (b *CircuitBreaker) Call(fn func() (interface{}, error)) (interface{}, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	data, err := fn()
+	b.record(err)
+	return data, err
+}
+
+// BreakerStatus is a snapshot of a circuit breaker
+type BreakerStatus struct {
+	State     BreakerState `json:"state"`
+	Failures  int          `json:"consecutive_failures"`
+	LastError string       `json:"last_error,omitempty"`
+	OpenedAt  *time.Time   `json:"opened_at,omitempty"`
+}
+
+// Status reports the breaker's state
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, Failures: b.failures, LastError: b.lastError}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// ConnectorHealth holds each connector's circuit breaker and health probe
+type ConnectorHealth struct {
+	settings   BreakerSettings
+	names      []string // in registration order
+	breakers   map[string]*CircuitBreaker
+	pingers    map[string]Pinger
+	probeLimit time.Duration
+}
+
+// NewConnectorHealth creates an empty registry
+func NewConnectorHealth(settings BreakerSettings) *ConnectorHealth {
+	return &ConnectorHealth{
+		settings:   settings,
+		breakers:   make(map[string]*CircuitBreaker),
+		pingers:    make(map[string]Pinger),
+		probeLimit: 5 * time.Second,
+	}
+}
+
+// Register adds a connector, named after the prefix of its tools, with
+// the probe checking it. A nil pinger leaves the connector unprobed.
+func (h *ConnectorHealth) Register(name string, pinger Pinger) {
+	h.names = append(h.names, name)
+	h.breakers[name] = newCircuitBreaker(name, h.settings)
+	if pinger != nil {
+		h.pingers[name] = pinger
+	}
+}
+
+// Breaker returns the circuit breaker of the connector serving tool, or
+// nil if no registered connector does
+func (h *ConnectorHealth) Breaker(tool string) *CircuitBreaker {
+	name, _, _ := strings.Cut(tool, ".")
+	return h.breakers[name]
+}
+
+// Call runs a tool through its connector's circuit breaker
+func (h *ConnectorHealth) Call(tool string, fn func() (interface{}, error)) (interface{}, error) {
+	breaker := h.Breaker(tool)
+	if breaker == nil {
+		return fn()
+	}
+	return breaker.Call(fn)
+}
+
+// ConnectorStatus is one connector's health
+type ConnectorStatus struct {
+	Name string `json:"name"`
+	// Status is healthy, unhealthy, unconfigured, or unchecked for
+	// connectors without a probe
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	LatencyMS float64       `json:"latency_ms,omitempty"`
+	Breaker   BreakerStatus `json:"breaker"`
+}
+
+// Check probes every connector concurrently. A connector whose circuit is
+// open is unhealthy whatever its probe says.
+func (h *ConnectorHealth) Check(ctx context.Context) []ConnectorStatus {
+	statuses := make([]ConnectorStatus, len(h.names))
+	var wg sync.WaitGroup
+	for i, name := range h.names {
+		statuses[i] = ConnectorStatus{Name: name, Status: "unchecked", Breaker: h.breakers[name].Status()}
+		pinger, ok := h.pingers[name]
+		if !ok {
+			continue
+		}
+		if !pinger.Configured() {
+			statuses[i].Status = "unconfigured"
+			continue
+		}
+
+		wg.Add(1)
+		go func(status *ConnectorStatus) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, h.probeLimit)
+			defer cancel()
+			start := time.Now()
+			err := pinger.Ping(probeCtx)
+			status.LatencyMS = float64(time.Since(start).Milliseconds())
+			if err != nil {
+				status.Status = "unhealthy"
+				status.Error = err.Error()
+				return
+			}
+			status.Status = "healthy"
+		}(&statuses[i])
+	}
+	wg.Wait()
+
+	for i := range statuses {
+		if statuses[i].Breaker.State == BreakerOpen {
+			statuses[i].Status = "unhealthy"
+			if statuses[i].Error == "" {
+				statuses[i].Error = "circuit open: " + statuses[i].Breaker.LastError
+			}
+		}
+	}
+	return statuses
+}
+
+// connectorsHealthHandler reports every connector's health. The gateway is
+// degraded, not down, while some connectors are unhealthy, so the status
+// code stays 200.
+func (g *MCPGateway) connectorsHealthHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := g.Connectors.Check(r.Context())
+	overall, unhealthy := "healthy", 0
+	for _, status := range statuses {
+		if status.Status == "unhealthy" {
+			overall = "degraded"
+			unhealthy++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     overall,
+		"unhealthy":  unhealthy,
+		"connectors": statuses,
+		"checked_at": time.Now(),
+	})
+}
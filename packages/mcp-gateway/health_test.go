@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// clientError is a connector error the caller caused
+type clientError struct{}
+
+func (clientError) Error() string      { return "bad input" }
+func (clientError) GatewayStatus() int { return http.StatusBadRequest }
+
+// stubConnector is a connector whose calls and probes fail while down
+type stubConnector struct {
+	calls      int
+	down       bool
+	configured bool
+}
+
+func (s *stubConnector) call() (interface{}, error) {
+	s.calls++
+	if s.down {
+		return nil, errors.New("connection refused")
+	}
+	return "ok", nil
+}
+
+func (s *stubConnector) Configured() bool { return s.configured }
+
+func (s *stubConnector) Ping(ctx context.Context) error {
+	if s.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	breaker := newCircuitBreaker("stub", BreakerSettings{FailureThreshold: 3, Cooldown: 30 * time.Second})
+	breaker.now = func() time.Time { return now }
+	stub := &stubConnector{down: true}
+
+	// Errors the caller caused don't count
+	breaker.Call(stub.call)
+	breaker.Call(stub.call)
+	breaker.Call(func() (interface{}, error) { return nil, clientError{} })
+	breaker.Call(stub.call)
+	if status := breaker.Status(); status.State != BreakerClosed || status.Failures != 1 {
+		t.Fatalf("after a client error: %+v, want closed with 1 failure", status)
+	}
+
+	breaker.Call(stub.call)
+	breaker.Call(stub.call)
+	if status := breaker.Status(); status.State != BreakerOpen || status.LastError != "connection refused" {
+		t.Fatalf("after 3 failures: %+v, want open", status)
+	}
+
+	_, err := breaker.Call(stub.call)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || openErr.GatewayStatus() != http.StatusServiceUnavailable || openErr.RetryAfter != 30 {
+		t.Fatalf("call while open: %v, want a 503 circuit_open error", err)
+	}
+	if stub.calls != 5 {
+		t.Errorf("connector called %d times, want the open circuit to skip it", stub.calls)
+	}
+
+	// After the cooldown one trial goes through; failing reopens
+	now = now.Add(31 * time.Second)
+	breaker.Call(stub.call)
+	if stub.calls != 6 || breaker.Status().State != BreakerOpen {
+		t.Errorf("failed trial: %d calls, state %s, want 6 and open", stub.calls, breaker.Status().State)
+	}
+
+	now = now.Add(31 * time.Second)
+	stub.down = false
+	if data, err := breaker.Call(stub.call); err != nil || data != "ok" {
+		t.Errorf("trial after recovery = %v, %v", data, err)
+	}
+	if status := breaker.Status(); status.State != BreakerClosed || status.Failures != 0 {
+		t.Errorf("after recovery: %+v, want closed", status)
+	}
+}
+
+func TestCircuitBreakerAllowsOneTrial(t *testing.T) {
+	breaker := newCircuitBreaker("stub", BreakerSettings{FailureThreshold: 1, Cooldown: time.Nanosecond})
+	breaker.Call(func() (interface{}, error) { return nil, errors.New("timeout") })
+	time.Sleep(time.Millisecond)
+
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("first call after the cooldown rejected: %v", err)
+	}
+	if err := breaker.allow(); err == nil {
+		t.Error("second call let through while the trial is in flight")
+	}
+}
+
+func TestExecuteShortCircuitsFailingConnector(t *testing.T) {
+	var hits int32
+	jira := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer jira.Close()
+	t.Setenv("JIRA_BASE_URL", jira.URL)
+	t.Setenv("MCP_BREAKER_FAILURES", "2")
+	gateway := NewMCPGateway()
+
+	execute := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		gateway.executeHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/execute",
+			strings.NewReader(`{"tool": "jira.get_ticket", "input": {"key": "QL-1"}}`)))
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := execute(); w.Code != http.StatusBadGateway {
+			t.Fatalf("call %d: status %d, want JIRA's failure as 502", i, w.Code)
+		}
+	}
+
+	w := execute()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Fatalf("status %d, Retry-After %q, want 503 after 30s", w.Code, w.Header().Get("Retry-After"))
+	}
+	var response struct {
+		Success bool             `json:"success"`
+		Details CircuitOpenError `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Success || response.Details.Code != "circuit_open" || response.Details.Connector != "jira" {
+		t.Errorf("response = %s", w.Body.String())
+	}
+	if hits != 2 {
+		t.Errorf("JIRA called %d times, want the open circuit to stop at 2", hits)
+	}
+
+	// Other connectors are unaffected
+	if breaker := gateway.Connectors.Breaker("confluence.get_page"); breaker.Status().State != BreakerClosed {
+		t.Errorf("confluence circuit is %s", breaker.Status().State)
+	}
+}
+
+func TestConnectorsHealthReflectsOutage(t *testing.T) {
+	health := NewConnectorHealth(BreakerSettings{FailureThreshold: 1, Cooldown: time.Minute})
+	flaky := &stubConnector{configured: true}
+	health.Register("up", &stubConnector{configured: true})
+	health.Register("down", &stubConnector{configured: true, down: true})
+	health.Register("off", &stubConnector{})
+	health.Register("flaky", flaky)
+	health.Register("stub", nil)
+
+	// flaky answers its probe but its last call failed
+	health.Call("flaky.op", func() (interface{}, error) { return nil, errors.New("502 from upstream") })
+
+	gateway := &MCPGateway{Connectors: health}
+	w := httptest.NewRecorder()
+	gateway.connectorsHealthHandler(w, httptest.NewRequest(http.MethodGet, "/connectors/health", nil))
+
+	var report struct {
+		Status     string            `json:"status"`
+		Unhealthy  int               `json:"unhealthy"`
+		Connectors []ConnectorStatus `json:"connectors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || report.Status != "degraded" || report.Unhealthy != 2 {
+		t.Errorf("status %d, report %+v, want 200 degraded with 2 unhealthy", w.Code, report)
+	}
+
+	want := map[string]string{"up": "healthy", "down": "unhealthy", "off": "unconfigured", "flaky": "unhealthy", "stub": "unchecked"}
+	for i, status := range report.Connectors {
+		if name := health.names[i]; status.Name != name {
+			t.Errorf("connector %d is %s, want registration order (%s)", i, status.Name, name)
+		}
+		if status.Status != want[status.Name] {
+			t.Errorf("%s is %s, want %s (%+v)", status.Name, status.Status, want[status.Name], status)
+		}
+	}
+	if report.Connectors[3].Breaker.State != BreakerOpen || !strings.Contains(report.Connectors[3].Error, "502 from upstream") {
+		t.Errorf("flaky = %+v, want its open circuit reported", report.Connectors[3])
+	}
+}
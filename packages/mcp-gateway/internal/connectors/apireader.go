@@ -0,0 +1,493 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	apiMaxSpecBytes = 5 << 20
+	// apiMaxBodyBytes is how much of a probed response is returned;
+	// apiMaxValidateBytes is how much is read for schema validation
+	apiMaxBodyBytes     = 64 << 10
+	apiMaxValidateBytes = 1 << 20
+	apiDefaultTimeout   = 10 * time.Second
+	apiMaxTimeout       = 30 * time.Second
+	apiSpecTimeout      = 15 * time.Second
+)
+
+// APIReaderConnector reads OpenAPI specs and probes the endpoints they
+// describe. Outbound requests never reach private, loopback or link-local
+// addresses unless their networks are allowed.
+type APIReaderConnector struct {
+	guard addressGuard
+}
+
+// NewAPIReaderConnector creates an API reader that may additionally reach
+// the networks listed in APIREADER_ALLOWED_NETWORKS (comma separated CIDRs)
+func NewAPIReaderConnector() *APIReaderConnector {
+	allowed, err := ParseNetworks(os.Getenv("APIREADER_ALLOWED_NETWORKS"))
+	if err != nil {
+		log.Printf("Warning: ignoring APIREADER_ALLOWED_NETWORKS: %v", err)
+		allowed = nil
+	}
+	return newAPIReaderConnector(allowed)
+}
+
+func newAPIReaderConnector(allowed []*net.IPNet) *APIReaderConnector {
+	return &APIReaderConnector{guard: addressGuard{allowed: allowed}}
+}
+
+// APIReaderError is a request the API reader refused
+type APIReaderError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIReaderError) Error() string {
+	return fmt.Sprintf("api %s: %s", e.Code, e.Message)
+}
+
+// GatewayStatus is the status to answer the gateway's caller with
+func (e *APIReaderError) GatewayStatus() int {
+	return e.Status
+}
+
+func invalidAPIInput(format string, args ...interface{}) *APIReaderError {
+	return &APIReaderError{Status: http.StatusBadRequest, Code: "invalid_request", Message: fmt.Sprintf(format, args...)}
+}
+
+// requestError wraps a failed outbound request, singling out ones the
+// address guard refused
+func requestError(what string, err error) error {
+	if isForbidden(err) {
+		return &APIReaderError{Status: http.StatusForbidden, Code: "forbidden_address", Message: err.Error()}
+	}
+	return &APIReaderError{Status: http.StatusBadGateway, Code: "fetch_failed", Message: fmt.Sprintf("%s: %v", what, err)}
+}
+
+// specSource is a spec given by URL or inline. Inline specs may be a JSON
+// object or a JSON or YAML document in a string.
+type specSource struct {
+	URL  string          `json:"url"`
+	Spec json.RawMessage `json:"spec"`
+}
+
+func (a *APIReaderConnector) loadSpec(ctx context.Context, src specSource) (*APISpec, error) {
+	var data []byte
+	switch {
+	case len(src.Spec) > 0:
+		data = src.Spec
+		var text string
+		if json.Unmarshal(src.Spec, &text) == nil {
+			data = []byte(text)
+		}
+	case src.URL != "":
+		var err error
+		if data, err = a.fetchSpec(ctx, src.URL); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, invalidAPIInput("url or spec is required")
+	}
+
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return nil, &APIReaderError{Status: http.StatusUnprocessableEntity, Code: "invalid_spec", Message: err.Error()}
+	}
+	return spec, nil
+}
+
+func (a *APIReaderConnector) fetchSpec(ctx context.Context, specURL string) ([]byte, error) {
+	u, err := url.Parse(specURL)
+	if err != nil || u.Host == "" {
+		return nil, invalidAPIInput("invalid spec url %q", specURL)
+	}
+	if err := checkScheme(u.Scheme); err != nil {
+		return nil, invalidAPIInput("%v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, invalidAPIInput("%v", err)
+	}
+	req.Header.Set("Accept", "application/json, application/yaml, text/yaml, */*")
+	resp, err := newGuardedClient(a.guard, apiSpecTimeout).Do(req)
+	if err != nil {
+		return nil, requestError("fetching spec", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIReaderError{Status: http.StatusBadGateway, Code: "fetch_failed", Message: fmt.Sprintf("fetching spec: status %d", resp.StatusCode)}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, apiMaxSpecBytes+1))
+	if err != nil {
+		return nil, requestError("reading spec", err)
+	}
+	if len(data) > apiMaxSpecBytes {
+		return nil, &APIReaderError{Status: http.StatusUnprocessableEntity, Code: "spec_too_large", Message: fmt.Sprintf("spec is larger than %d bytes", apiMaxSpecBytes)}
+	}
+	return data, nil
+}
+
+// ReadSpec fetches or takes an inline OpenAPI 2 or 3 spec and returns its
+// normalized operations
+func (a *APIReaderConnector) ReadSpec(input json.RawMessage) (interface{}, error) {
+	var src specSource
+	if err := json.Unmarshal(input, &src); err != nil {
+		return nil, invalidAPIInput("invalid input: %v", err)
+	}
+	return a.loadSpec(context.Background(), src)
+}
+
+// EndpointAuth is the credential TestEndpoint sends
+type EndpointAuth struct {
+	Type     string `json:"type"` // bearer, basic or api_key
+	Token    string `json:"token,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Name and In locate an API key; they default to the spec's apiKey
+	// scheme
+	Name  string `json:"name,omitempty"`
+	In    string `json:"in,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+type testEndpointInput struct {
+	specSource
+	OperationID string            `json:"operation_id"`
+	Method      string            `json:"method"`
+	Path        string            `json:"path"`
+	BaseURL     string            `json:"base_url"`
+	PathParams  map[string]string `json:"path_params"`
+	Query       map[string]string `json:"query"`
+	Headers     map[string]string `json:"headers"`
+	Body        json.RawMessage   `json:"body"`
+	Auth        *EndpointAuth     `json:"auth"`
+	TimeoutMS   int               `json:"timeout_ms"`
+}
+
+// EndpointResult is the outcome of probing one operation
+type EndpointResult struct {
+	OperationID   string            `json:"operation_id,omitempty"`
+	Method        string            `json:"method"`
+	URL           string            `json:"url"`
+	Status        int               `json:"status,omitempty"`
+	LatencyMS     int64             `json:"latency_ms"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Body          string            `json:"body,omitempty"`
+	BodyTruncated bool              `json:"body_truncated,omitempty"`
+	// Error is set when no response came back, e.g. on timeouts
+	Error      string           `json:"error,omitempty"`
+	Validation SchemaValidation `json:"validation"`
+}
+
+// SchemaValidation reports whether a response matched its documented schema
+type SchemaValidation struct {
+	Checked bool `json:"checked"`
+	Valid   bool `json:"valid"`
+	// Response is the documented response checked against: the status
+	// code, its range (2XX) or "default"
+	Response string   `json:"response,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Reason   string   `json:"reason,omitempty"` // why the response wasn't checked
+}
+
+// TestEndpoint calls one operation of a spec against a base URL and
+// checks the response against the operation's documented responses
+func (a *APIReaderConnector) TestEndpoint(input json.RawMessage) (interface{}, error) {
+	var in testEndpointInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil, invalidAPIInput("invalid input: %v", err)
+	}
+
+	timeout := apiDefaultTimeout
+	if in.TimeoutMS > 0 {
+		timeout = time.Duration(in.TimeoutMS) * time.Millisecond
+		if timeout > apiMaxTimeout {
+			timeout = apiMaxTimeout
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	spec, err := a.loadSpec(ctx, in.specSource)
+	if err != nil {
+		return nil, err
+	}
+	op, err := findOperation(spec, in.OperationID, in.Method, in.Path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := buildRequest(ctx, spec, op, &in)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EndpointResult{OperationID: op.ID, Method: op.Method, URL: req.URL.String()}
+	client := newGuardedClient(a.guard, timeout)
+	// Redirects are part of what's being tested, so they are reported
+	// rather than followed
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.LatencyMS = time.Since(start).Milliseconds()
+		if isForbidden(err) {
+			return nil, requestError("calling endpoint", err)
+		}
+		result.Error = err.Error()
+		result.Validation.Reason = "no response"
+		return result, nil
+	}
+	defer resp.Body.Close()
+
+	body, readErr := io.ReadAll(io.LimitReader(resp.Body, apiMaxValidateBytes+1))
+	result.LatencyMS = time.Since(start).Milliseconds()
+	result.Status = resp.StatusCode
+	result.Headers = make(map[string]string, len(resp.Header))
+	for name := range resp.Header {
+		result.Headers[name] = resp.Header.Get(name)
+	}
+	if readErr != nil {
+		result.Error = "reading body: " + readErr.Error()
+	}
+	complete := readErr == nil && len(body) <= apiMaxValidateBytes
+	result.Body = string(body)
+	if len(body) > apiMaxBodyBytes {
+		result.Body = string(body[:apiMaxBodyBytes])
+		result.BodyTruncated = true
+	}
+
+	result.Validation = validateResponse(op, resp.StatusCode, resp.Header.Get("Content-Type"), body, complete)
+	return result, nil
+}
+
+func findOperation(spec *APISpec, id, method, path string) (*Operation, error) {
+	if id == "" && (method == "" || path == "") {
+		return nil, invalidAPIInput("operation_id or method and path are required")
+	}
+	for i := range spec.Operations {
+		op := &spec.Operations[i]
+		if id != "" && op.ID == id {
+			return op, nil
+		}
+		if id == "" && strings.EqualFold(op.Method, method) && op.Path == path {
+			return op, nil
+		}
+	}
+	if id != "" {
+		return nil, invalidAPIInput("operation %q not found in spec", id)
+	}
+	return nil, invalidAPIInput("operation %s %s not found in spec", strings.ToUpper(method), path)
+}
+
+// buildRequest fills in an operation's path, query and headers, checking
+// that every required parameter was supplied
+func buildRequest(ctx context.Context, spec *APISpec, op *Operation, in *testEndpointInput) (*http.Request, error) {
+	baseURL := in.BaseURL
+	if baseURL == "" && len(spec.Servers) > 0 {
+		baseURL = spec.Servers[0]
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Host == "" {
+		return nil, invalidAPIInput("an absolute base_url is required, the spec's servers give %q", baseURL)
+	}
+	if err := checkScheme(base.Scheme); err != nil {
+		return nil, invalidAPIInput("%v", err)
+	}
+
+	var missing []string
+	path := op.Path
+	query := base.Query()
+	for k, v := range in.Query {
+		query.Set(k, v)
+	}
+	for _, param := range op.Parameters {
+		var supplied bool
+		switch param.In {
+		case "path":
+			var value string
+			if value, supplied = in.PathParams[param.Name]; supplied {
+				path = strings.ReplaceAll(path, "{"+param.Name+"}", url.PathEscape(value))
+			}
+		case "query":
+			_, supplied = in.Query[param.Name]
+		case "header":
+			supplied = hasHeader(in.Headers, param.Name)
+		default:
+			continue
+		}
+		if param.Required && !supplied {
+			missing = append(missing, param.In+" parameter "+param.Name)
+		}
+	}
+	if op.RequestBody != nil && op.RequestBody.Required && len(in.Body) == 0 {
+		missing = append(missing, "request body")
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, invalidAPIInput("missing %s", strings.Join(missing, ", "))
+	}
+
+	// Path parameters are already escaped, so parse the joined path rather
+	// than assigning it
+	ref, err := url.Parse(strings.TrimSuffix(base.EscapedPath(), "/") + path)
+	if err != nil {
+		return nil, invalidAPIInput("invalid path: %v", err)
+	}
+	target := *base
+	target.Path, target.RawPath = ref.Path, ref.RawPath
+	target.RawQuery = query.Encode()
+
+	var body io.Reader
+	if len(in.Body) > 0 {
+		body = bytes.NewReader(in.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, op.Method, target.String(), body)
+	if err != nil {
+		return nil, invalidAPIInput("%v", err)
+	}
+	if body != nil {
+		contentType := "application/json"
+		if op.RequestBody != nil && op.RequestBody.ContentType != "" {
+			contentType = op.RequestBody.ContentType
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json, */*")
+	for k, v := range in.Headers {
+		req.Header.Set(k, v)
+	}
+	if in.Auth != nil {
+		if err := applyEndpointAuth(req, spec, op, in.Auth); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func applyEndpointAuth(req *http.Request, spec *APISpec, op *Operation, auth *EndpointAuth) error {
+	switch auth.Type {
+	case "bearer":
+		if auth.Token == "" {
+			return invalidAPIInput("bearer auth needs a token")
+		}
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	case "basic":
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case "api_key":
+		name, in := auth.Name, auth.In
+		if name == "" {
+			// Use the apiKey scheme the operation asks for
+			for _, set := range op.Auth {
+				for _, schemeName := range set {
+					if scheme := spec.SecuritySchemes[schemeName]; scheme.Type == "apiKey" && name == "" {
+						name, in = scheme.Name, scheme.In
+					}
+				}
+			}
+		}
+		if name == "" {
+			return invalidAPIInput("api_key auth needs a name, the operation has no apiKey scheme")
+		}
+		switch in {
+		case "", "header":
+			req.Header.Set(name, auth.Value)
+		case "query":
+			q := req.URL.Query()
+			q.Set(name, auth.Value)
+			req.URL.RawQuery = q.Encode()
+		case "cookie":
+			req.AddCookie(&http.Cookie{Name: name, Value: auth.Value})
+		default:
+			return invalidAPIInput("unsupported api_key location %q", in)
+		}
+	default:
+		return invalidAPIInput("unsupported auth type %q", auth.Type)
+	}
+	return nil
+}
+
+// documentedResponse finds the response documented for status: the exact
+// code, then its range, then the default
+func documentedResponse(op *Operation, status int) (string, Response, bool) {
+	for _, key := range []string{fmt.Sprint(status), fmt.Sprintf("%dXX", status/100), fmt.Sprintf("%dxx", status/100), "default"} {
+		if response, ok := op.Responses[key]; ok {
+			return key, response, true
+		}
+	}
+	return "", Response{}, false
+}
+
+func validateResponse(op *Operation, status int, contentType string, body []byte, complete bool) SchemaValidation {
+	key, documented, ok := documentedResponse(op, status)
+	if !ok {
+		return SchemaValidation{Checked: true, Errors: []string{fmt.Sprintf("status %d is not documented", status)}}
+	}
+	v := SchemaValidation{Response: key}
+	switch {
+	case documented.Schema == nil:
+		v.Reason = "no schema documented"
+		return v
+	case !isJSONContentType(documented.ContentType):
+		v.Reason = "documented content type " + documented.ContentType + " is not JSON"
+		return v
+	case !complete:
+		v.Reason = fmt.Sprintf("body is larger than %d bytes", apiMaxValidateBytes)
+		return v
+	}
+
+	v.Checked = true
+	if contentType != "" && !isJSONContentType(contentType) {
+		v.Errors = []string{"content type " + contentType + " is not JSON"}
+		return v
+	}
+	schemaLoader, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(documented.Schema))
+	if err != nil {
+		return SchemaValidation{Response: key, Reason: "documented schema is invalid: " + err.Error()}
+	}
+	result, err := schemaLoader.Validate(gojsonschema.NewBytesLoader(body))
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) || len(body) == 0 {
+			v.Errors = []string{"body is not valid JSON"}
+		} else {
+			v.Errors = []string{err.Error()}
+		}
+		return v
+	}
+	v.Valid = result.Valid()
+	for _, e := range result.Errors() {
+		v.Errors = append(v.Errors, e.String())
+	}
+	return v
+}
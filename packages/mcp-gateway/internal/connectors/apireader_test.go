@@ -0,0 +1,427 @@
+package connectors
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const petstoreV3 = `
+openapi: 3.0.3
+info:
+  title: Petstore
+  version: 1.0.0
+servers:
+  - url: https://{region}.pets.example.com/v1
+    variables:
+      region:
+        default: eu
+security:
+  - apiKey: []
+paths:
+  /pets/{petId}:
+    parameters:
+      - name: petId
+        in: path
+        schema: {type: integer}
+    get:
+      operationId: getPet
+      parameters:
+        - name: verbose
+          in: query
+          schema: {type: boolean}
+      responses:
+        200:
+          description: A pet
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/Pet'}
+        default:
+          description: Error
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/Error'}
+  /pets:
+    post:
+      operationId: createPet
+      security: []
+      requestBody:
+        required: true
+        content:
+          application/xml:
+            schema: {$ref: '#/components/schemas/Pet'}
+          application/json:
+            schema: {$ref: '#/components/schemas/Pet'}
+      responses:
+        '201': {description: Created}
+      callbacks:
+        created: {}
+components:
+  securitySchemes:
+    apiKey: {type: apiKey, in: header, name: X-API-Key}
+  schemas:
+    Pet:
+      type: object
+      required: [id, name]
+      properties:
+        id: {type: integer}
+        name: {type: string}
+        tag: {type: string, nullable: true}
+        parent: {$ref: '#/components/schemas/Pet'}
+    Error:
+      type: object
+      properties:
+        message: {type: string}
+`
+
+const petstoreV2 = `{
+	"swagger": "2.0",
+	"info": {"title": "Petstore", "version": "1"},
+	"host": "pets.example.com",
+	"basePath": "/v2",
+	"schemes": ["https"],
+	"securityDefinitions": {"basic": {"type": "basic"}},
+	"paths": {
+		"/pets": {
+			"post": {
+				"operationId": "createPet",
+				"security": [{"basic": []}],
+				"parameters": [
+					{"name": "pet", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Pet"}},
+					{"name": "dryRun", "in": "query", "type": "boolean"},
+					{"name": "photo", "in": "formData", "type": "file"}
+				],
+				"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}
+			}
+		}
+	},
+	"definitions": {
+		"Pet": {"type": "object", "properties": {"name": {"type": "string", "x-nullable": true}, "owner": {"$ref": "other.json#/Owner"}}}
+	}
+}`
+
+func operationByID(t *testing.T, spec *APISpec, id string) Operation {
+	t.Helper()
+	for _, op := range spec.Operations {
+		if op.ID == id {
+			return op
+		}
+	}
+	t.Fatalf("operation %s not found in %+v", id, spec.Operations)
+	return Operation{}
+}
+
+func TestParseSpecOpenAPI3(t *testing.T) {
+	spec, err := ParseSpec([]byte(petstoreV3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Title != "Petstore" || spec.SpecVersion != "3.0.3" || len(spec.Operations) != 2 {
+		t.Fatalf("spec = %+v", spec)
+	}
+	if len(spec.Servers) != 1 || spec.Servers[0] != "https://eu.pets.example.com/v1" {
+		t.Errorf("servers = %v, want the variable's default filled in", spec.Servers)
+	}
+	if scheme := spec.SecuritySchemes["apiKey"]; scheme.In != "header" || scheme.Name != "X-API-Key" {
+		t.Errorf("apiKey scheme = %+v", scheme)
+	}
+
+	get := operationByID(t, spec, "getPet")
+	if get.Method != "GET" || get.Path != "/pets/{petId}" || len(get.Parameters) != 2 {
+		t.Fatalf("getPet = %+v", get)
+	}
+	if p := get.Parameters[0]; p.Name != "petId" || !p.Required || string(p.Schema) != `{"type":"integer"}` {
+		t.Errorf("path parameter = %+v, want it inherited from the path item and required", p)
+	}
+	if len(get.Auth) != 1 || get.Auth[0][0] != "apiKey" {
+		t.Errorf("auth = %v, want the global requirement", get.Auth)
+	}
+
+	var pet map[string]interface{}
+	json.Unmarshal(get.Responses["200"].Schema, &pet)
+	props := pet["properties"].(map[string]interface{})
+	if tag := props["tag"].(map[string]interface{}); len(tag["type"].([]interface{})) != 2 {
+		t.Errorf("tag = %v, want nullable turned into a null type", tag)
+	}
+	if parent := props["parent"].(map[string]interface{}); len(parent) != 0 {
+		t.Errorf("parent = %v, want the recursive ref left empty", parent)
+	}
+
+	create := operationByID(t, spec, "createPet")
+	if create.RequestBody == nil || create.RequestBody.ContentType != "application/json" || !create.RequestBody.Required {
+		t.Errorf("request body = %+v, want the JSON content", create.RequestBody)
+	}
+	if len(create.Auth) != 0 {
+		t.Errorf("auth = %v, want the operation's empty security to override", create.Auth)
+	}
+
+	for _, want := range []string{"recursive $ref #/components/schemas/Pet", "callbacks on POST /pets"} {
+		if !contains(spec.Unsupported, want) {
+			t.Errorf("unsupported = %v, missing %q", spec.Unsupported, want)
+		}
+	}
+}
+
+func TestParseSpecSwagger2(t *testing.T) {
+	spec, err := ParseSpec([]byte(petstoreV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Servers) != 1 || spec.Servers[0] != "https://pets.example.com/v2" {
+		t.Errorf("servers = %v", spec.Servers)
+	}
+	if scheme := spec.SecuritySchemes["basic"]; scheme.Type != "http" || scheme.Scheme != "basic" {
+		t.Errorf("basic scheme = %+v", scheme)
+	}
+
+	op := operationByID(t, spec, "createPet")
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "dryRun" || string(op.Parameters[0].Schema) != `{"type":"boolean"}` {
+		t.Errorf("parameters = %+v, want only the query parameter", op.Parameters)
+	}
+	if op.RequestBody == nil || !op.RequestBody.Required || !strings.Contains(string(op.RequestBody.Schema), `"name"`) {
+		t.Errorf("request body = %+v, want the body parameter", op.RequestBody)
+	}
+	if !strings.Contains(string(op.Responses["200"].Schema), `["string","null"]`) {
+		t.Errorf("response schema = %s, want x-nullable turned into a null type", op.Responses["200"].Schema)
+	}
+	for _, want := range []string{"external $ref other.json#/Owner", "formData parameters on POST /pets"} {
+		if !contains(spec.Unsupported, want) {
+			t.Errorf("unsupported = %v, missing %q", spec.Unsupported, want)
+		}
+	}
+}
+
+func TestParseSpecRejectsOtherDocuments(t *testing.T) {
+	for _, doc := range []string{`{"openapi": "2.5"}`, `just text`, `{"swagger": `} {
+		if _, err := ParseSpec([]byte(doc)); err == nil {
+			t.Errorf("ParseSpec(%q) succeeded", doc)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// loopbackAllowed lets tests reach httptest servers
+func loopbackAllowed(t *testing.T) *APIReaderConnector {
+	networks, err := ParseNetworks("127.0.0.0/8, ::1/128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newAPIReaderConnector(networks)
+}
+
+func testInput(t *testing.T, fields map[string]interface{}) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReadSpecFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write([]byte(petstoreV3))
+	}))
+	defer srv.Close()
+
+	result, err := loopbackAllowed(t).ReadSpec(testInput(t, map[string]interface{}{"url": srv.URL + "/openapi.yaml"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec := result.(*APISpec); len(spec.Operations) != 2 {
+		t.Errorf("operations = %+v", spec.Operations)
+	}
+}
+
+func TestReadSpecDeniesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the guarded client reached a loopback server")
+	}))
+	defer srv.Close()
+
+	for _, u := range []string{srv.URL, "http://169.254.169.254/latest/meta-data"} {
+		_, err := newAPIReaderConnector(nil).ReadSpec(testInput(t, map[string]interface{}{"url": u}))
+		var apiErr *APIReaderError
+		if !errors.As(err, &apiErr) || apiErr.Code != "forbidden_address" || apiErr.GatewayStatus() != http.StatusForbidden {
+			t.Errorf("%s: err = %v, want forbidden_address", u, err)
+		}
+	}
+
+	if _, err := newAPIReaderConnector(nil).ReadSpec(testInput(t, map[string]interface{}{"url": "file:///etc/passwd"})); err == nil {
+		t.Error("file URL was accepted")
+	}
+}
+
+func TestAddressGuard(t *testing.T) {
+	_, allowed, _ := net.ParseCIDR("10.1.0.0/16")
+	guard := addressGuard{allowed: []*net.IPNet{allowed}}
+
+	for ip, wantErr := range map[string]bool{
+		"93.184.216.34":      false,
+		"10.1.2.3":           false, // explicitly allowed
+		"10.2.0.1":           true,
+		"127.0.0.1":          true,
+		"169.254.169.254":    true,
+		"::ffff:192.168.0.1": true,
+		"fd00::1":            true,
+		"2606:4700::1":       false,
+	} {
+		if err := guard.check(net.ParseIP(ip)); (err != nil) != wantErr {
+			t.Errorf("check(%s) = %v, want error %v", ip, err, wantErr)
+		}
+	}
+}
+
+func TestTestEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "secret" {
+			t.Errorf("X-API-Key = %q, want the key from the spec's apiKey scheme", r.Header.Get("X-API-Key"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/pets/1":
+			w.Write([]byte(`{"id": 1, "name": "Rex", "tag": null}`))
+		case "/v1/pets/2":
+			w.Write([]byte(`{"id": "two"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "not found: ` + r.URL.EscapedPath() + `"}`))
+		}
+	}))
+	defer srv.Close()
+
+	call := func(petID string) *EndpointResult {
+		t.Helper()
+		result, err := loopbackAllowed(t).TestEndpoint(testInput(t, map[string]interface{}{
+			"spec":         petstoreV3,
+			"operation_id": "getPet",
+			"base_url":     srv.URL + "/v1",
+			"path_params":  map[string]string{"petId": petID},
+			"query":        map[string]string{"verbose": "true"},
+			"auth":         map[string]string{"type": "api_key", "value": "secret"},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.(*EndpointResult)
+	}
+
+	ok := call("1")
+	if ok.Status != http.StatusOK || ok.URL != srv.URL+"/v1/pets/1?verbose=true" || ok.Body == "" {
+		t.Errorf("result = %+v", ok)
+	}
+	if v := ok.Validation; !v.Checked || !v.Valid || v.Response != "200" {
+		t.Errorf("validation = %+v, want a valid 200", v)
+	}
+
+	invalid := call("2")
+	if v := invalid.Validation; !v.Checked || v.Valid || len(v.Errors) < 2 {
+		t.Errorf("validation = %+v, want the id type and missing name reported", v)
+	}
+
+	notFound := call("a/b")
+	if notFound.Status != http.StatusNotFound || !strings.Contains(notFound.Body, "/v1/pets/a%2Fb") {
+		t.Errorf("result = %+v, want the path parameter escaped", notFound)
+	}
+	if v := notFound.Validation; !v.Valid || v.Response != "default" {
+		t.Errorf("validation = %+v, want the 404 checked against default", v)
+	}
+}
+
+func TestTestEndpointTruncatesLargeBodies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "name": "` + strings.Repeat("x", apiMaxBodyBytes) + `"}`))
+	}))
+	defer srv.Close()
+
+	result, err := loopbackAllowed(t).TestEndpoint(testInput(t, map[string]interface{}{
+		"spec":        petstoreV3,
+		"method":      "get",
+		"path":        "/pets/{petId}",
+		"base_url":    srv.URL,
+		"path_params": map[string]string{"petId": "1"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := result.(*EndpointResult)
+	if !r.BodyTruncated || len(r.Body) != apiMaxBodyBytes {
+		t.Errorf("body is %d bytes, truncated %v", len(r.Body), r.BodyTruncated)
+	}
+	if !r.Validation.Valid {
+		t.Errorf("validation = %+v, want the whole body validated", r.Validation)
+	}
+}
+
+func TestTestEndpointRejectsBadInput(t *testing.T) {
+	c := loopbackAllowed(t)
+	tests := []struct {
+		name  string
+		input map[string]interface{}
+		want  string
+	}{
+		{"missing path param", map[string]interface{}{"spec": petstoreV3, "operation_id": "getPet", "base_url": "http://127.0.0.1"}, "path parameter petId"},
+		{"missing body", map[string]interface{}{"spec": petstoreV3, "operation_id": "createPet", "base_url": "http://127.0.0.1"}, "request body"},
+		{"unknown operation", map[string]interface{}{"spec": petstoreV3, "operation_id": "nope"}, "not found"},
+		{"no spec", map[string]interface{}{"operation_id": "getPet"}, "url or spec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.TestEndpoint(testInput(t, tt.input))
+			var apiErr *APIReaderError
+			if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest || !strings.Contains(apiErr.Message, tt.want) {
+				t.Errorf("err = %v, want a 400 mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestEndpointDeniesPrivateBaseURL(t *testing.T) {
+	_, err := newAPIReaderConnector(nil).TestEndpoint(testInput(t, map[string]interface{}{
+		"spec":         petstoreV3,
+		"operation_id": "getPet",
+		"base_url":     "http://10.0.0.1:8080",
+		"path_params":  map[string]string{"petId": "1"},
+	}))
+	var apiErr *APIReaderError
+	if !errors.As(err, &apiErr) || apiErr.Code != "forbidden_address" {
+		t.Errorf("err = %v, want forbidden_address", err)
+	}
+}
+
+func TestTestEndpointTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	result, err := loopbackAllowed(t).TestEndpoint(testInput(t, map[string]interface{}{
+		"spec":         petstoreV3,
+		"operation_id": "getPet",
+		"base_url":     srv.URL,
+		"path_params":  map[string]string{"petId": "1"},
+		"timeout_ms":   50,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := result.(*EndpointResult); r.Error == "" || r.Status != 0 || r.Validation.Checked {
+		t.Errorf("result = %+v, want a timeout error", r)
+	}
+}
@@ -0,0 +1,106 @@
+package connectors
+
+import "encoding/json"
+
+const apiSpecSourceProperties = `
+		"url": {"type": "string", "format": "uri", "description": "Where to fetch the spec"},
+		"spec": {"description": "The spec itself, as an object or a JSON or YAML string"}`
+
+// APIReaderTools are the API reader connector's tools
+var APIReaderTools = []ToolSpec{
+	{
+		Name:        "api.read_spec",
+		Description: "Read an OpenAPI 2 or 3 spec and list its operations",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {` + apiSpecSourceProperties + `
+	}
+}`),
+		OutputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"title": {"type": "string"},
+		"version": {"type": "string"},
+		"spec_version": {"type": "string"},
+		"servers": {"type": "array", "items": {"type": "string"}},
+		"operations": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"operation_id": {"type": "string"},
+					"method": {"type": "string"},
+					"path": {"type": "string"},
+					"summary": {"type": "string"},
+					"parameters": {"type": "array"},
+					"request_body": {"type": "object"},
+					"responses": {"type": "object"},
+					"auth": {"type": "array", "items": {"type": "array", "items": {"type": "string"}}}
+				},
+				"required": ["method", "path", "responses"]
+			}
+		},
+		"security_schemes": {"type": "object"},
+		"unsupported": {"type": "array", "items": {"type": "string"}}
+	},
+	"required": ["spec_version", "servers", "operations"]
+}`),
+	},
+	{
+		Name:        "api.test_endpoint",
+		Description: "Call one operation of an OpenAPI spec and check the response against it",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {` + apiSpecSourceProperties + `,
+		"operation_id": {"type": "string"},
+		"method": {"type": "string"},
+		"path": {"type": "string", "description": "Path template as written in the spec"},
+		"base_url": {"type": "string", "format": "uri", "description": "Defaults to the spec's first server"},
+		"path_params": {"type": "object", "additionalProperties": {"type": "string"}},
+		"query": {"type": "object", "additionalProperties": {"type": "string"}},
+		"headers": {"type": "object", "additionalProperties": {"type": "string"}},
+		"body": {},
+		"auth": {
+			"type": "object",
+			"properties": {
+				"type": {"enum": ["bearer", "basic", "api_key"]},
+				"token": {"type": "string"},
+				"username": {"type": "string"},
+				"password": {"type": "string"},
+				"name": {"type": "string"},
+				"in": {"enum": ["header", "query", "cookie"]},
+				"value": {"type": "string"}
+			},
+			"required": ["type"]
+		},
+		"timeout_ms": {"type": "integer", "minimum": 1, "maximum": 30000, "default": 10000}
+	}
+}`),
+		OutputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"operation_id": {"type": "string"},
+		"method": {"type": "string"},
+		"url": {"type": "string"},
+		"status": {"type": "integer"},
+		"latency_ms": {"type": "integer"},
+		"headers": {"type": "object", "additionalProperties": {"type": "string"}},
+		"body": {"type": "string"},
+		"body_truncated": {"type": "boolean"},
+		"error": {"type": "string"},
+		"validation": {
+			"type": "object",
+			"properties": {
+				"checked": {"type": "boolean"},
+				"valid": {"type": "boolean"},
+				"response": {"type": "string"},
+				"errors": {"type": "array", "items": {"type": "string"}},
+				"reason": {"type": "string"}
+			},
+			"required": ["checked", "valid"]
+		}
+	},
+	"required": ["method", "url", "latency_ms", "validation"]
+}`),
+	},
+}
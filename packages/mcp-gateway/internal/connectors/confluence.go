@@ -0,0 +1,562 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	confluenceMaxRetries   = 3
+	confluenceMaxRetryWait = 30 * time.Second
+	// confluenceMaxAttachment caps each decoded image attachment
+	confluenceMaxAttachment = 20 << 20
+)
+
+// ConfluenceAuth holds Confluence credentials: an account email with an API
+// token for basic auth, or a personal access token sent as a bearer token
+type ConfluenceAuth struct {
+	Email    string
+	APIToken string
+	PAT      string
+}
+
+func (a ConfluenceAuth) empty() bool {
+	return a.PAT == "" && (a.Email == "" || a.APIToken == "")
+}
+
+func (a ConfluenceAuth) apply(req *http.Request) {
+	switch {
+	case a.PAT != "":
+		req.Header.Set("Authorization", "Bearer "+a.PAT)
+	case a.Email != "" && a.APIToken != "":
+		req.SetBasicAuth(a.Email, a.APIToken)
+	}
+}
+
+// ConfluenceConnector talks to the Confluence REST API. The base URL
+// includes the context path, e.g. https://example.atlassian.net/wiki.
+type ConfluenceConnector struct {
+	baseURL string
+	auth    ConfluenceAuth
+	client  *http.Client
+	sleep   func(ctx context.Context, d time.Duration) error
+	ctx     context.Context
+}
+
+// NewConfluenceConnector creates a Confluence connector for
+// CONFLUENCE_BASE_URL, authenticated with CONFLUENCE_PAT or with
+// CONFLUENCE_EMAIL and CONFLUENCE_API_TOKEN
+func NewConfluenceConnector() *ConfluenceConnector {
+	baseURL := os.Getenv("CONFLUENCE_BASE_URL")
+	auth := ConfluenceAuth{
+		Email:    os.Getenv("CONFLUENCE_EMAIL"),
+		APIToken: os.Getenv("CONFLUENCE_API_TOKEN"),
+		PAT:      os.Getenv("CONFLUENCE_PAT"),
+	}
+	if baseURL == "" {
+		log.Println("Warning: CONFLUENCE_BASE_URL not set, Confluence tools are disabled")
+	} else if auth.empty() {
+		log.Println("Warning: no Confluence credentials set, requests must carry their own")
+	}
+	return newConfluenceConnector(baseURL, auth, &http.Client{Timeout: 60 * time.Second})
+}
+
+func newConfluenceConnector(baseURL string, auth ConfluenceAuth, client *http.Client) *ConfluenceConnector {
+	return &ConfluenceConnector{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		auth:    auth,
+		client:  client,
+		sleep:   sleepContext,
+		ctx:     context.Background(),
+	}
+}
+
+// WithAuth returns a connector that uses auth instead of the configured
+// credentials, if auth holds any
+func (c *ConfluenceConnector) WithAuth(auth ConfluenceAuth) *ConfluenceConnector {
+	if auth.empty() {
+		return c
+	}
+	copied := *c
+	copied.auth = auth
+	return &copied
+}
+
+// Configured reports whether CONFLUENCE_BASE_URL is set
+func (c *ConfluenceConnector) Configured() bool {
+	return c.baseURL != ""
+}
+
+// Ping checks that Confluence is reachable and accepts the configured
+// credentials by listing a space
+func (c *ConfluenceConnector) Ping(ctx context.Context) error {
+	copied := *c
+	copied.ctx = ctx
+	return copied.do(http.MethodGet, "/rest/api/space?limit=1", nil, nil)
+}
+
+// ConfluenceError is a failed Confluence call
+type ConfluenceError struct {
+	Status  int    `json:"status"` // Confluence's HTTP status, or the one we answer with
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// CurrentVersion is the page's version when an update conflicted
+	CurrentVersion int `json:"current_version,omitempty"`
+	RetryAfter     int `json:"retry_after,omitempty"` // seconds, when rate limited
+}
+
+func (e *ConfluenceError) Error() string {
+	return fmt.Sprintf("confluence %s: %s", e.Code, e.Message)
+}
+
+// GatewayStatus is the status to answer the gateway's caller with:
+// Confluence's own for client errors and 502 when Confluence itself failed
+func (e *ConfluenceError) GatewayStatus() int {
+	if e.Status >= 400 && e.Status < 500 {
+		return e.Status
+	}
+	return http.StatusBadGateway
+}
+
+// parseConfluenceError condenses Confluence's {"statusCode", "message"}
+// payload. A missing space shows up as a 404, or on create as a 400, naming
+// the space.
+func parseConfluenceError(resp *http.Response, body []byte) *ConfluenceError {
+	var payload struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &payload)
+	message := payload.Message
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	confErr := &ConfluenceError{Status: resp.StatusCode, Code: jiraErrorCode(resp.StatusCode), Message: message}
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		confErr.Code = "permission_denied"
+	case (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest) &&
+		strings.Contains(strings.ToLower(message), "space"):
+		confErr.Status = http.StatusNotFound
+		confErr.Code = "space_not_found"
+	case resp.StatusCode == http.StatusConflict:
+		confErr.Code = "version_conflict"
+	case resp.StatusCode == http.StatusTooManyRequests:
+		confErr.RetryAfter = int(math.Ceil(retryAfter(resp.Header, 0).Seconds()))
+	}
+	return confErr
+}
+
+// send sends a request built by newRequest, retrying rate limited requests
+// after the wait Confluence asks for, as long as it is short, and decodes
+// the response into out
+func (c *ConfluenceConnector) send(method, apiPath string, newRequest func() (*http.Request, error), out interface{}) error {
+	if c.baseURL == "" {
+		return &ConfluenceError{Status: http.StatusServiceUnavailable, Code: "not_configured", Message: "CONFLUENCE_BASE_URL is not set"}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		c.auth.apply(req)
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("Confluence request failed: %w", err)
+		}
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read Confluence response: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			wait := retryAfter(resp.Header, attempt)
+			if attempt < confluenceMaxRetries && wait <= confluenceMaxRetryWait {
+				log.Printf("Confluence returned %d, retrying %s %s in %s", resp.StatusCode, method, apiPath, wait)
+				if err := c.sleep(c.ctx, wait); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if resp.StatusCode >= 300 {
+			return parseConfluenceError(resp, respBody)
+		}
+		if out != nil && len(respBody) > 0 {
+			if err := json.Unmarshal(respBody, out); err != nil {
+				return fmt.Errorf("failed to decode Confluence response: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+// do sends a JSON request
+func (c *ConfluenceConnector) do(method, apiPath string, body, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode Confluence request: %w", err)
+		}
+	}
+	return c.send(method, apiPath, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(c.ctx, method, c.baseURL+apiPath, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req, nil
+	}, out)
+}
+
+// attach uploads a file to a page, replacing an attachment of the same name
+func (c *ConfluenceConnector) attach(pageID, filename string, content []byte) error {
+	contentType := mime.TypeByExtension(path.Ext(filename))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	part.Write(content)
+	form.WriteField("minorEdit", "true")
+	form.Close()
+
+	apiPath := "/rest/api/content/" + url.PathEscape(pageID) + "/child/attachment"
+	return c.send(http.MethodPut, apiPath, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(c.ctx, http.MethodPut, c.baseURL+apiPath, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		// Confluence rejects multipart uploads without it as XSRF
+		req.Header.Set("X-Atlassian-Token", "no-check")
+		return req, nil
+	}, nil)
+}
+
+func confluenceInvalidInput(format string, args ...interface{}) *ConfluenceError {
+	return &ConfluenceError{Status: http.StatusBadRequest, Code: "invalid_input", Message: fmt.Sprintf(format, args...)}
+}
+
+// pageAttachments decodes the images the markdown references, keyed by
+// the reference. Every local image has to be attached.
+func pageAttachments(markdown string, attachments map[string]string) (map[string][]byte, error) {
+	decoded := make(map[string][]byte)
+	names := make(map[string]string)
+	for _, ref := range markdownImages(markdown) {
+		encoded, ok := attachments[ref]
+		if !ok {
+			return nil, confluenceInvalidInput("image %s is referenced but not in attachments", ref)
+		}
+		content, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, confluenceInvalidInput("attachment %s is not valid base64: %v", ref, err)
+		}
+		if len(content) > confluenceMaxAttachment {
+			return nil, confluenceInvalidInput("attachment %s is larger than %d bytes", ref, confluenceMaxAttachment)
+		}
+		// Pages reference attachments by file name alone
+		name := path.Base(ref)
+		if other, ok := names[name]; ok {
+			return nil, confluenceInvalidInput("images %s and %s would both be attached as %s", other, ref, name)
+		}
+		names[name] = ref
+		decoded[ref] = content
+	}
+	return decoded, nil
+}
+
+func (c *ConfluenceConnector) uploadAttachments(pageID string, attachments map[string][]byte) ([]string, error) {
+	refs := make([]string, 0, len(attachments))
+	for ref := range attachments {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	var uploaded []string
+	for _, ref := range refs {
+		name := path.Base(ref)
+		if err := c.attach(pageID, name, attachments[ref]); err != nil {
+			return uploaded, err
+		}
+		uploaded = append(uploaded, name)
+	}
+	return uploaded, nil
+}
+
+// confluencePage is a page as Confluence returns it
+type confluencePage struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Version struct {
+		Number int `json:"number"`
+	} `json:"version"`
+	Space struct {
+		Key string `json:"key"`
+	} `json:"space"`
+	Ancestors []struct {
+		ID string `json:"id"`
+	} `json:"ancestors"`
+	Body struct {
+		Storage struct {
+			Value string `json:"value"`
+		} `json:"storage"`
+	} `json:"body"`
+	Links struct {
+		Base  string `json:"base"`
+		WebUI string `json:"webui"`
+	} `json:"_links"`
+}
+
+func (c *ConfluenceConnector) pageURL(page confluencePage) string {
+	base := page.Links.Base
+	if base == "" {
+		base = c.baseURL
+	}
+	return base + page.Links.WebUI
+}
+
+// PageRef identifies a created or updated page
+type PageRef struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Version     int      `json:"version"`
+	URL         string   `json:"url"`
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+// CreatePageRequest is the input of confluence.create_page
+type CreatePageRequest struct {
+	SpaceKey string `json:"space_key"`
+	ParentID string `json:"parent_id,omitempty"`
+	Title    string `json:"title"`
+	Body     string `json:"body"` // markdown
+	// Attachments holds the base64 content of the local images Body
+	// references, keyed by the path used in the markdown
+	Attachments map[string]string `json:"attachments,omitempty"`
+}
+
+// CreatePage creates a page from markdown and attaches the images it
+// references
+func (c *ConfluenceConnector) CreatePage(input json.RawMessage) (interface{}, error) {
+	var req CreatePageRequest
+	if err := json.Unmarshal(input, &req); err != nil {
+		return nil, confluenceInvalidInput("invalid input: %v", err)
+	}
+	if req.SpaceKey == "" || strings.TrimSpace(req.Title) == "" {
+		return nil, confluenceInvalidInput("space_key and title are required")
+	}
+	attachments, err := pageAttachments(req.Body, req.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"type":  "page",
+		"title": req.Title,
+		"space": map[string]string{"key": req.SpaceKey},
+		"body":  storageBody(markdownToStorage(req.Body)),
+	}
+	if req.ParentID != "" {
+		body["ancestors"] = []map[string]string{{"id": req.ParentID}}
+	}
+	var page confluencePage
+	if err := c.do(http.MethodPost, "/rest/api/content", body, &page); err != nil {
+		return nil, err
+	}
+	log.Printf("Created Confluence page %s in %s", page.ID, req.SpaceKey)
+
+	uploaded, err := c.uploadAttachments(page.ID, attachments)
+	if err != nil {
+		return nil, err
+	}
+	return PageRef{ID: page.ID, Title: page.Title, Version: page.Version.Number, URL: c.pageURL(page), Attachments: uploaded}, nil
+}
+
+func storageBody(value string) map[string]interface{} {
+	return map[string]interface{}{
+		"storage": map[string]string{"value": value, "representation": "storage"},
+	}
+}
+
+// UpdatePageRequest is the input of confluence.update_page
+type UpdatePageRequest struct {
+	PageID string `json:"page_id"`
+	// Version is the version the caller last read; the update is rejected
+	// if the page has changed since
+	Version     int               `json:"version"`
+	Title       string            `json:"title,omitempty"` // unchanged if empty
+	Body        string            `json:"body"`            // markdown
+	Attachments map[string]string `json:"attachments,omitempty"`
+}
+
+// UpdatePage replaces a page's body, as long as nobody else changed it since
+// the version the caller read
+func (c *ConfluenceConnector) UpdatePage(input json.RawMessage) (interface{}, error) {
+	var req UpdatePageRequest
+	if err := json.Unmarshal(input, &req); err != nil {
+		return nil, confluenceInvalidInput("invalid input: %v", err)
+	}
+	if req.PageID == "" || req.Version < 1 {
+		return nil, confluenceInvalidInput("page_id and version are required")
+	}
+	attachments, err := pageAttachments(req.Body, req.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	pagePath := "/rest/api/content/" + url.PathEscape(req.PageID)
+	var current confluencePage
+	if err := c.do(http.MethodGet, pagePath+"?expand=version", nil, &current); err != nil {
+		return nil, pageError(err)
+	}
+	if current.Version.Number != req.Version {
+		return nil, versionConflict(req.PageID, req.Version, current.Version.Number)
+	}
+
+	// Images go up first so the new body never points at a missing one
+	uploaded, err := c.uploadAttachments(req.PageID, attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	title := req.Title
+	if title == "" {
+		title = current.Title
+	}
+	body := map[string]interface{}{
+		"id":      req.PageID,
+		"type":    "page",
+		"title":   title,
+		"version": map[string]int{"number": req.Version + 1},
+		"body":    storageBody(markdownToStorage(req.Body)),
+	}
+	var page confluencePage
+	if err := c.do(http.MethodPut, pagePath, body, &page); err != nil {
+		// Someone else saved between our read and write
+		if confErr, ok := err.(*ConfluenceError); ok && confErr.Status == http.StatusConflict {
+			return nil, versionConflict(req.PageID, req.Version, 0)
+		}
+		return nil, pageError(err)
+	}
+	return PageRef{ID: page.ID, Title: page.Title, Version: page.Version.Number, URL: c.pageURL(page), Attachments: uploaded}, nil
+}
+
+func versionConflict(pageID string, read, current int) *ConfluenceError {
+	message := fmt.Sprintf("page %s changed since version %d", pageID, read)
+	if current > 0 {
+		message += fmt.Sprintf("; it is now at version %d", current)
+	}
+	return &ConfluenceError{Status: http.StatusConflict, Code: "version_conflict", Message: message, CurrentVersion: current}
+}
+
+// pageError names a page Confluence couldn't find
+func pageError(err error) error {
+	if confErr, ok := err.(*ConfluenceError); ok && confErr.Status == http.StatusNotFound && confErr.Code == "not_found" {
+		confErr.Code = "page_not_found"
+	}
+	return err
+}
+
+// GetPageRequest is the input of confluence.get_page: a page ID, or a space
+// key and title
+type GetPageRequest struct {
+	PageID   string `json:"page_id,omitempty"`
+	SpaceKey string `json:"space_key,omitempty"`
+	Title    string `json:"title,omitempty"`
+}
+
+// Page is a Confluence page with its body in storage format and as markdown
+type Page struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	SpaceKey string `json:"space_key"`
+	ParentID string `json:"parent_id,omitempty"`
+	Version  int    `json:"version"`
+	URL      string `json:"url"`
+	Storage  string `json:"storage"`
+	Markdown string `json:"markdown"`
+}
+
+const pageExpand = "body.storage,version,space,ancestors"
+
+// GetPage returns a page
+func (c *ConfluenceConnector) GetPage(input json.RawMessage) (interface{}, error) {
+	var req GetPageRequest
+	if err := json.Unmarshal(input, &req); err != nil {
+		return nil, confluenceInvalidInput("invalid input: %v", err)
+	}
+
+	var page confluencePage
+	switch {
+	case req.PageID != "":
+		path := "/rest/api/content/" + url.PathEscape(req.PageID) + "?expand=" + pageExpand
+		if err := c.do(http.MethodGet, path, nil, &page); err != nil {
+			return nil, pageError(err)
+		}
+	case req.SpaceKey != "" && req.Title != "":
+		query := url.Values{"spaceKey": {req.SpaceKey}, "title": {req.Title}, "type": {"page"}, "expand": {pageExpand}}
+		var found struct {
+			Results []confluencePage `json:"results"`
+		}
+		if err := c.do(http.MethodGet, "/rest/api/content?"+query.Encode(), nil, &found); err != nil {
+			return nil, err
+		}
+		if len(found.Results) == 0 {
+			return nil, &ConfluenceError{Status: http.StatusNotFound, Code: "page_not_found", Message: fmt.Sprintf("no page %q in space %s", req.Title, req.SpaceKey)}
+		}
+		page = found.Results[0]
+	default:
+		return nil, confluenceInvalidInput("page_id, or space_key and title, are required")
+	}
+
+	markdown, err := storageToMarkdown(page.Body.Storage.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert page %s to markdown: %w", page.ID, err)
+	}
+	result := Page{
+		ID:       page.ID,
+		Title:    page.Title,
+		SpaceKey: page.Space.Key,
+		Version:  page.Version.Number,
+		URL:      c.pageURL(page),
+		Storage:  page.Body.Storage.Value,
+		Markdown: markdown,
+	}
+	// The last ancestor is the direct parent
+	if n := len(page.Ancestors); n > 0 {
+		result.ParentID = page.Ancestors[n-1].ID
+	}
+	return result, nil
+}
@@ -0,0 +1,339 @@
+package connectors
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Markdown conversion covers what generated documentation uses: headings,
+// paragraphs, flat lists, block quotes, rules, fenced code, and inline
+// emphasis, code, links and images. Anything else in a page's storage format
+// is reduced to its text when converted back.
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	orderedItemPattern = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+	imagePattern       = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	linkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strongPattern      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	emPattern          = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+	codeSpanPattern    = regexp.MustCompile("`([^`]+)`")
+	cdataPattern       = regexp.MustCompile(`(?s)<!\[CDATA\[(.*?)\]\]>`)
+)
+
+// isRemoteImage reports whether an image reference is a URL rather than a
+// file to attach
+func isRemoteImage(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// markdownImages lists the local images markdown references, in order and
+// without repeats, outside code
+func markdownImages(markdown string) []string {
+	var images []string
+	seen := map[string]bool{}
+	inFence := false
+	for _, line := range strings.Split(markdown, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		line = codeSpanPattern.ReplaceAllString(line, "")
+		for _, m := range imagePattern.FindAllStringSubmatch(line, -1) {
+			if src := m[2]; !isRemoteImage(src) && !seen[src] {
+				seen[src] = true
+				images = append(images, src)
+			}
+		}
+	}
+	return images
+}
+
+// markdownToStorage converts markdown to Confluence storage format. Local
+// images become attachments named after the file.
+func markdownToStorage(markdown string) string {
+	var b strings.Builder
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			fmt.Fprintf(&b, "<p>%s</p>", inlineToStorage(strings.Join(paragraph, " ")))
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			language := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString(codeMacro(language, strings.Join(code, "\n")))
+		case headingPattern.MatchString(trimmed):
+			flush()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			fmt.Fprintf(&b, "<h%d>%s</h%d>", len(m[1]), inlineToStorage(m[2]), len(m[1]))
+		case trimmed == "---" || trimmed == "***" || trimmed == "___":
+			flush()
+			b.WriteString("<hr />")
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			i--
+			fmt.Fprintf(&b, "<blockquote><p>%s</p></blockquote>", inlineToStorage(strings.Join(quote, " ")))
+		case unorderedItem(trimmed) != "" || orderedItemPattern.MatchString(trimmed):
+			flush()
+			tag, item := "ul", unorderedItem
+			if orderedItemPattern.MatchString(trimmed) {
+				tag = "ol"
+				item = func(s string) string {
+					if m := orderedItemPattern.FindStringSubmatch(s); m != nil {
+						return m[1]
+					}
+					return ""
+				}
+			}
+			fmt.Fprintf(&b, "<%s>", tag)
+			for ; i < len(lines) && item(strings.TrimSpace(lines[i])) != ""; i++ {
+				fmt.Fprintf(&b, "<li>%s</li>", inlineToStorage(item(strings.TrimSpace(lines[i]))))
+			}
+			i--
+			fmt.Fprintf(&b, "</%s>", tag)
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+func unorderedItem(line string) string {
+	for _, marker := range []string{"- ", "* ", "+ "} {
+		if strings.HasPrefix(line, marker) {
+			return strings.TrimSpace(line[len(marker):])
+		}
+	}
+	return ""
+}
+
+// codeMacro is Confluence's code block. CDATA can't hold "]]>", so it is
+// split across two sections.
+func codeMacro(language, code string) string {
+	var b strings.Builder
+	b.WriteString(`<ac:structured-macro ac:name="code">`)
+	if language != "" {
+		fmt.Fprintf(&b, `<ac:parameter ac:name="language">%s</ac:parameter>`, html.EscapeString(language))
+	}
+	fmt.Fprintf(&b, "<ac:plain-text-body><![CDATA[%s]]></ac:plain-text-body></ac:structured-macro>",
+		strings.ReplaceAll(code, "]]>", "]]]]><![CDATA[>"))
+	return b.String()
+}
+
+// inlineToStorage converts inline markdown. Code spans are set aside first
+// so nothing inside them is interpreted.
+func inlineToStorage(text string) string {
+	var spans []string
+	text = codeSpanPattern.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(spans)-1)
+	})
+	text = html.EscapeString(text)
+
+	text = imagePattern.ReplaceAllStringFunc(text, func(m string) string {
+		parts := imagePattern.FindStringSubmatch(m)
+		alt, src := parts[1], html.UnescapeString(parts[2])
+		if isRemoteImage(src) {
+			return fmt.Sprintf(`<ac:image ac:alt="%s"><ri:url ri:value="%s" /></ac:image>`, alt, html.EscapeString(src))
+		}
+		return fmt.Sprintf(`<ac:image ac:alt="%s"><ri:attachment ri:filename="%s" /></ac:image>`, alt, html.EscapeString(path.Base(src)))
+	})
+	text = linkPattern.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = strongPattern.ReplaceAllString(text, "<strong>$1$2</strong>")
+	text = emPattern.ReplaceAllString(text, "<em>$1$2</em>")
+
+	for i, span := range spans {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), span, 1)
+	}
+	return text
+}
+
+// storageToMarkdown converts Confluence storage format to markdown. The
+// HTML parser doesn't know CDATA outside foreign content, so sections are
+// escaped to plain text first.
+func storageToMarkdown(storage string) (string, error) {
+	storage = cdataPattern.ReplaceAllStringFunc(storage, func(m string) string {
+		return html.EscapeString(cdataPattern.FindStringSubmatch(m)[1])
+	})
+	context := &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(storage), context)
+	if err != nil {
+		return "", err
+	}
+	var blocks []string
+	for _, n := range nodes {
+		blocks = append(blocks, blockToMarkdown(n)...)
+	}
+	return strings.Join(blocks, "\n\n"), nil
+}
+
+// blockToMarkdown converts a block-level node to markdown blocks
+func blockToMarkdown(n *xhtml.Node) []string {
+	if n.Type == xhtml.TextNode {
+		if text := strings.TrimSpace(n.Data); text != "" {
+			return []string{text}
+		}
+		return nil
+	}
+	if n.Type != xhtml.ElementNode {
+		return nil
+	}
+
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		return []string{strings.Repeat("#", int(n.Data[1]-'0')) + " " + inlineToMarkdown(n)}
+	case "p":
+		if text := inlineToMarkdown(n); text != "" {
+			return []string{text}
+		}
+		return nil
+	case "hr":
+		return []string{"---"}
+	case "blockquote":
+		var lines []string
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			for _, block := range blockToMarkdown(c) {
+				lines = append(lines, "> "+block)
+			}
+		}
+		return []string{strings.Join(lines, "\n>\n")}
+	case "ul", "ol":
+		var items []string
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != xhtml.ElementNode || c.Data != "li" {
+				continue
+			}
+			marker := "- "
+			if n.Data == "ol" {
+				marker = fmt.Sprintf("%d. ", len(items)+1)
+			}
+			items = append(items, marker+inlineToMarkdown(c))
+		}
+		return []string{strings.Join(items, "\n")}
+	case "pre":
+		return []string{"```\n" + textContent(n) + "\n```"}
+	case "ac:structured-macro":
+		if attr(n, "ac:name") == "code" {
+			var language, code string
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				switch {
+				case c.Data == "ac:parameter" && attr(c, "ac:name") == "language":
+					language = textContent(c)
+				case c.Data == "ac:plain-text-body":
+					code = textContent(c)
+				}
+			}
+			return []string{"```" + language + "\n" + code + "\n```"}
+		}
+	case "div", "section", "ac:layout", "ac:layout-section", "ac:layout-cell", "ac:rich-text-body":
+		var blocks []string
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			blocks = append(blocks, blockToMarkdown(c)...)
+		}
+		return blocks
+	}
+	if text := inlineToMarkdown(n); text != "" {
+		return []string{text}
+	}
+	return nil
+}
+
+// inlineToMarkdown converts the children of n to inline markdown
+func inlineToMarkdown(n *xhtml.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeInline(&b, c)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func writeInline(b *strings.Builder, n *xhtml.Node) {
+	switch n.Type {
+	case xhtml.TextNode:
+		b.WriteString(n.Data)
+		return
+	case xhtml.ElementNode:
+	default:
+		return
+	}
+
+	switch n.Data {
+	case "strong", "b":
+		b.WriteString("**" + inlineToMarkdown(n) + "**")
+	case "em", "i":
+		b.WriteString("*" + inlineToMarkdown(n) + "*")
+	case "code":
+		b.WriteString("`" + textContent(n) + "`")
+	case "br":
+		b.WriteString("\n")
+	case "a":
+		b.WriteString("[" + inlineToMarkdown(n) + "](" + attr(n, "href") + ")")
+	case "ac:image":
+		alt := attr(n, "ac:alt")
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.Data {
+			case "ri:attachment":
+				b.WriteString("![" + alt + "](" + attr(c, "ri:filename") + ")")
+			case "ri:url":
+				b.WriteString("![" + alt + "](" + attr(c, "ri:value") + ")")
+			}
+		}
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			writeInline(b, c)
+		}
+	}
+}
+
+// textContent is the text under n
+func textContent(n *xhtml.Node) string {
+	var b strings.Builder
+	var walk func(*xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		if n.Type == xhtml.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func attr(n *xhtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,267 @@
+package connectors
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestConfluence(t *testing.T, handler http.HandlerFunc) *ConfluenceConnector {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return newConfluenceConnector(srv.URL+"/wiki", ConfluenceAuth{Email: "bot@example.com", APIToken: "token"}, srv.Client())
+}
+
+func decodeBody(t *testing.T, r *http.Request) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		t.Errorf("%s %s body: %v", r.Method, r.URL.Path, err)
+	}
+	return body
+}
+
+func storageValue(body map[string]interface{}) string {
+	return body["body"].(map[string]interface{})["storage"].(map[string]interface{})["value"].(string)
+}
+
+func TestConfluenceCreatePageWithAttachments(t *testing.T) {
+	diagram := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+	var uploaded []byte
+	c := newTestConfluence(t, func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "token" {
+			t.Errorf("basic auth = %q, %q, %v", user, pass, ok)
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /wiki/rest/api/content":
+			body := decodeBody(t, r)
+			if body["type"] != "page" || body["title"] != "Architecture" ||
+				body["space"].(map[string]interface{})["key"] != "ENG" ||
+				body["ancestors"].([]interface{})[0].(map[string]interface{})["id"] != "100" {
+				t.Errorf("unexpected page: %v", body)
+			}
+			storage := storageValue(body)
+			for _, want := range []string{"<h1>Architecture</h1>", "<strong>gateway</strong>", `<ri:attachment ri:filename="diagram.png" />`} {
+				if !strings.Contains(storage, want) {
+					t.Errorf("storage lacks %q: %s", want, storage)
+				}
+			}
+			w.Write([]byte(`{"id": "200", "title": "Architecture", "version": {"number": 1}, "_links": {"base": "https://wiki.example.com/wiki", "webui": "/spaces/ENG/pages/200"}}`))
+		case "PUT /wiki/rest/api/content/200/child/attachment":
+			if r.Header.Get("X-Atlassian-Token") != "no-check" {
+				t.Error("attachment upload without X-Atlassian-Token")
+			}
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Filename != "diagram.png" {
+				t.Errorf("uploaded %q, want diagram.png", header.Filename)
+			}
+			uploaded, _ = io.ReadAll(file)
+			w.Write([]byte(`{"results": [{"id": "att1"}]}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	input, _ := json.Marshal(CreatePageRequest{
+		SpaceKey:    "ENG",
+		ParentID:    "100",
+		Title:       "Architecture",
+		Body:        "# Architecture\n\nThe **gateway** fronts every tool.\n\n![diagram](images/diagram.png)",
+		Attachments: map[string]string{"images/diagram.png": base64.StdEncoding.EncodeToString(diagram)},
+	})
+	out, err := c.CreatePage(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := out.(PageRef)
+	if ref.ID != "200" || ref.Version != 1 || ref.URL != "https://wiki.example.com/wiki/spaces/ENG/pages/200" {
+		t.Errorf("ref = %+v", ref)
+	}
+	if len(ref.Attachments) != 1 || string(uploaded) != string(diagram) {
+		t.Errorf("attachments = %v, uploaded %x", ref.Attachments, uploaded)
+	}
+}
+
+func TestConfluenceCreatePageRequiresReferencedImages(t *testing.T) {
+	c := newTestConfluence(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Confluence was called: %s %s", r.Method, r.URL.Path)
+	})
+	_, err := c.CreatePage(json.RawMessage(`{"space_key": "ENG", "title": "T", "body": "![chart](chart.png) and ![logo](https://example.com/logo.png)"}`))
+	var confErr *ConfluenceError
+	if !errors.As(err, &confErr) || confErr.Code != "invalid_input" || !strings.Contains(confErr.Message, "chart.png") {
+		t.Fatalf("err = %v, want chart.png missing", err)
+	}
+}
+
+func TestConfluenceUpdatePageVersionConflict(t *testing.T) {
+	var puts int
+	c := newTestConfluence(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"id": "200", "title": "Architecture", "version": {"number": 4}}`))
+		case http.MethodPut:
+			puts++
+			if v := decodeBody(t, r)["version"].(map[string]interface{})["number"]; v != float64(5) {
+				t.Errorf("update to version %v, want 5", v)
+			}
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"statusCode": 409, "message": "Version must be incremented on update"}`))
+		}
+	})
+
+	_, err := c.UpdatePage(json.RawMessage(`{"page_id": "200", "version": 3, "body": "stale"}`))
+	var confErr *ConfluenceError
+	if !errors.As(err, &confErr) || confErr.GatewayStatus() != http.StatusConflict || confErr.CurrentVersion != 4 {
+		t.Fatalf("stale update err = %+v, want 409 at version 4", err)
+	}
+	if puts != 0 {
+		t.Errorf("stale update was sent")
+	}
+
+	// Someone saves between our read and write
+	_, err = c.UpdatePage(json.RawMessage(`{"page_id": "200", "version": 4, "body": "racing"}`))
+	if !errors.As(err, &confErr) || confErr.Code != "version_conflict" || confErr.GatewayStatus() != http.StatusConflict {
+		t.Fatalf("racing update err = %v, want version_conflict", err)
+	}
+}
+
+func TestConfluenceUpdatePage(t *testing.T) {
+	c := newTestConfluence(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"id": "200", "title": "Architecture", "version": {"number": 4}}`))
+		case http.MethodPut:
+			body := decodeBody(t, r)
+			if body["title"] != "Architecture" || storageValue(body) != "<p>Updated</p>" {
+				t.Errorf("unexpected update: %v", body)
+			}
+			w.Write([]byte(`{"id": "200", "title": "Architecture", "version": {"number": 5}, "_links": {"webui": "/pages/200"}}`))
+		}
+	})
+	out, err := c.UpdatePage(json.RawMessage(`{"page_id": "200", "version": 4, "body": "Updated"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref := out.(PageRef); ref.Version != 5 || !strings.HasSuffix(ref.URL, "/wiki/pages/200") {
+		t.Errorf("ref = %+v", ref)
+	}
+}
+
+func TestConfluenceGetPage(t *testing.T) {
+	storage := `<h2>Setup</h2><p>Run <code>make</code>, see <a href="https://example.com">docs</a>.</p>` +
+		`<ac:structured-macro ac:name="code"><ac:parameter ac:name="language">go</ac:parameter>` +
+		`<ac:plain-text-body><![CDATA[if a < b && ok {}]]></ac:plain-text-body></ac:structured-macro>` +
+		`<p><ac:image ac:alt="flow"><ri:attachment ri:filename="flow.png" /></ac:image></p>`
+	c := newTestConfluence(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wiki/rest/api/content" || r.URL.Query().Get("spaceKey") != "ENG" || r.URL.Query().Get("title") != "Setup" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		page := map[string]interface{}{
+			"id": "300", "title": "Setup",
+			"version":   map[string]int{"number": 2},
+			"space":     map[string]string{"key": "ENG"},
+			"ancestors": []map[string]string{{"id": "1"}, {"id": "100"}},
+			"body":      map[string]interface{}{"storage": map[string]string{"value": storage}},
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": []interface{}{page}})
+	})
+
+	out, err := c.GetPage(json.RawMessage(`{"space_key": "ENG", "title": "Setup"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := out.(Page)
+	want := "## Setup\n\nRun `make`, see [docs](https://example.com).\n\n```go\nif a < b && ok {}\n```\n\n![flow](flow.png)"
+	if page.ParentID != "100" || page.Version != 2 || page.Storage != storage || page.Markdown != want {
+		t.Errorf("page = %+v\nmarkdown:\n%s", page, page.Markdown)
+	}
+}
+
+func TestConfluenceErrors(t *testing.T) {
+	tests := []struct {
+		status  int
+		message string
+		call    func(c *ConfluenceConnector) (interface{}, error)
+		code    string
+		gateway int
+	}{
+		{http.StatusBadRequest, "No space with key : NOPE", func(c *ConfluenceConnector) (interface{}, error) {
+			return c.CreatePage(json.RawMessage(`{"space_key": "NOPE", "title": "T"}`))
+		}, "space_not_found", http.StatusNotFound},
+		{http.StatusForbidden, "Not permitted to use confluence", func(c *ConfluenceConnector) (interface{}, error) {
+			return c.CreatePage(json.RawMessage(`{"space_key": "ENG", "title": "T"}`))
+		}, "permission_denied", http.StatusForbidden},
+		{http.StatusNotFound, "No content found with id: 9", func(c *ConfluenceConnector) (interface{}, error) {
+			return c.GetPage(json.RawMessage(`{"page_id": "9"}`))
+		}, "page_not_found", http.StatusNotFound},
+		{http.StatusInternalServerError, "", func(c *ConfluenceConnector) (interface{}, error) {
+			return c.GetPage(json.RawMessage(`{"page_id": "9"}`))
+		}, "upstream_error", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		c := newTestConfluence(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			json.NewEncoder(w).Encode(map[string]interface{}{"statusCode": tt.status, "message": tt.message})
+		})
+		_, err := tt.call(c)
+		var confErr *ConfluenceError
+		if !errors.As(err, &confErr) || confErr.Code != tt.code || confErr.GatewayStatus() != tt.gateway {
+			t.Errorf("%d %q: err = %+v, want %s answered with %d", tt.status, tt.message, err, tt.code, tt.gateway)
+		}
+	}
+}
+
+func TestConfluencePATAuth(t *testing.T) {
+	c := newTestConfluence(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer caller-pat" {
+			t.Errorf("Authorization = %q, want the caller's PAT", got)
+		}
+		w.Write([]byte(`{"id": "1", "title": "T", "body": {"storage": {"value": "<p>hi</p>"}}}`))
+	})
+	if _, err := c.WithAuth(ConfluenceAuth{PAT: "caller-pat"}).GetPage(json.RawMessage(`{"page_id": "1"}`)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMarkdownStorageRoundTrip(t *testing.T) {
+	markdown := "# Title\n\nSome *emphasis* and **strong** text with `a < b`.\n\n- one\n- two\n\n1. first\n2. second\n\n> quoted\n\n---\n\n```sh\necho ']]>' && exit\n```\n\n![logo](https://example.com/logo.png)"
+	storage := markdownToStorage(markdown)
+	if !strings.Contains(storage, "<code>a &lt; b</code>") || !strings.Contains(storage, `<ri:url ri:value="https://example.com/logo.png" />`) {
+		t.Errorf("storage = %s", storage)
+	}
+	back, err := storageToMarkdown(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back != markdown {
+		t.Errorf("round trip:\n%s\nwant:\n%s", back, markdown)
+	}
+}
+
+func TestConfluencePing(t *testing.T) {
+	c := newTestConfluence(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wiki/rest/api/space" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if _, _, ok := r.BasicAuth(); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"results": []}`))
+	})
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WithAuth(ConfluenceAuth{PAT: "expired"}).Ping(context.Background()); err == nil {
+		t.Error("Ping succeeded with credentials Confluence rejects")
+	}
+}
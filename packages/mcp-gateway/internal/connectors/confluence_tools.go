@@ -0,0 +1,84 @@
+package connectors
+
+import "encoding/json"
+
+const confluencePageRefSchema = `{
+	"type": "object",
+	"properties": {
+		"id": {"type": "string"},
+		"title": {"type": "string"},
+		"version": {"type": "integer"},
+		"url": {"type": "string", "format": "uri"},
+		"attachments": {"type": "array", "items": {"type": "string"}, "description": "File names of the uploaded images"}
+	},
+	"required": ["id", "title", "version", "url"]
+}`
+
+const confluenceAttachmentsSchema = `{
+	"type": "object",
+	"additionalProperties": {"type": "string", "contentEncoding": "base64"},
+	"description": "Base64 content of the local images the body references, keyed by the path used in the markdown"
+}`
+
+// ConfluenceTools are the Confluence connector's tools
+var ConfluenceTools = []ToolSpec{
+	{
+		Name:        "confluence.create_page",
+		Description: "Create a Confluence page from markdown",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"space_key": {"type": "string"},
+		"parent_id": {"type": "string", "description": "ID of the page to create it under"},
+		"title": {"type": "string", "minLength": 1},
+		"body": {"type": "string", "description": "Markdown, converted to Confluence storage format"},
+		"attachments": ` + confluenceAttachmentsSchema + `
+	},
+	"required": ["space_key", "title"]
+}`),
+		OutputSchema: json.RawMessage(confluencePageRefSchema),
+	},
+	{
+		Name:        "confluence.update_page",
+		Description: "Replace a Confluence page's body, failing with 409 if it changed since the version read",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"page_id": {"type": "string"},
+		"version": {"type": "integer", "minimum": 1, "description": "Version the update is based on"},
+		"title": {"type": "string", "description": "New title, unchanged if omitted"},
+		"body": {"type": "string", "description": "Markdown, converted to Confluence storage format"},
+		"attachments": ` + confluenceAttachmentsSchema + `
+	},
+	"required": ["page_id", "version"]
+}`),
+		OutputSchema: json.RawMessage(confluencePageRefSchema),
+	},
+	{
+		Name:        "confluence.get_page",
+		Description: "Get a Confluence page by ID, or by space and title",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"page_id": {"type": "string"},
+		"space_key": {"type": "string"},
+		"title": {"type": "string"}
+	},
+	"anyOf": [{"required": ["page_id"]}, {"required": ["space_key", "title"]}]
+}`),
+		OutputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"id": {"type": "string"},
+		"title": {"type": "string"},
+		"space_key": {"type": "string"},
+		"parent_id": {"type": "string"},
+		"version": {"type": "integer"},
+		"url": {"type": "string", "format": "uri"},
+		"storage": {"type": "string", "description": "Body in Confluence storage format"},
+		"markdown": {"type": "string", "description": "Body converted to markdown"}
+	},
+	"required": ["id", "title", "space_key", "version", "url", "storage", "markdown"]
+}`),
+	},
+}
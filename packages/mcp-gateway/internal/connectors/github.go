@@ -259,7 +259,10 @@ func (g *GitHubConnector) ListRepositories(input json.RawMessage) (interface{},
 	var err error
 	
 	if req.Org != "" {
-		repos, _, err = g.client.Repositories.ListByOrg(g.ctx, req.Org, opts)
+		repos, _, err = g.client.Repositories.ListByOrg(g.ctx, req.Org, &github.RepositoryListByOrgOptions{
+			Type:        req.Type,
+			ListOptions: opts.ListOptions,
+		})
 	} else if req.User != "" {
 		repos, _, err = g.client.Repositories.List(g.ctx, req.User, opts)
 	} else {
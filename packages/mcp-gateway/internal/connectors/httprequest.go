@@ -0,0 +1,348 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	httpDefaultMaxBytes = 1 << 20
+	httpMaxRequestBytes = 5 << 20
+	httpDefaultTimeout  = 15 * time.Second
+	httpMaxTimeout      = 60 * time.Second
+	redactedValue       = "[REDACTED]"
+)
+
+// requestMethods are the methods http.request sends
+var requestMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// HTTPRequestConnector calls arbitrary REST endpoints on allowed hosts.
+// Like the other outbound connectors it never reaches private, loopback or
+// link-local addresses unless their networks are allowed.
+type HTTPRequestConnector struct {
+	guard addressGuard
+	// hosts are the host patterns requests may go to: a host name, a
+	// *.domain wildcard, either optionally with a :port
+	hosts    []string
+	maxBytes int64
+}
+
+// NewHTTPRequestConnector creates a connector for the hosts in
+// HTTP_ALLOWED_HOSTS, which may additionally reach the networks in
+// HTTP_ALLOWED_NETWORKS (both comma separated). Responses are capped at
+// HTTP_MAX_RESPONSE_BYTES. Without allowed hosts every request is refused.
+func NewHTTPRequestConnector() *HTTPRequestConnector {
+	allowed, err := ParseNetworks(os.Getenv("HTTP_ALLOWED_NETWORKS"))
+	if err != nil {
+		log.Printf("Warning: ignoring HTTP_ALLOWED_NETWORKS: %v", err)
+		allowed = nil
+	}
+	var maxBytes int64
+	if v := os.Getenv("HTTP_MAX_RESPONSE_BYTES"); v != "" {
+		if maxBytes, err = strconv.ParseInt(v, 10, 64); err != nil || maxBytes <= 0 {
+			log.Printf("Warning: ignoring HTTP_MAX_RESPONSE_BYTES %q", v)
+			maxBytes = 0
+		}
+	}
+	return newHTTPRequestConnector(splitDomains(os.Getenv("HTTP_ALLOWED_HOSTS")), allowed, maxBytes)
+}
+
+func newHTTPRequestConnector(hosts []string, allowed []*net.IPNet, maxBytes int64) *HTTPRequestConnector {
+	if maxBytes <= 0 {
+		maxBytes = httpDefaultMaxBytes
+	}
+	return &HTTPRequestConnector{guard: addressGuard{allowed: allowed}, hosts: hosts, maxBytes: maxBytes}
+}
+
+// HTTPRequestError is a request the connector refused or couldn't send
+type HTTPRequestError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *HTTPRequestError) Error() string {
+	return fmt.Sprintf("http %s: %s", e.Code, e.Message)
+}
+
+// GatewayStatus is the status to answer the gateway's caller with
+func (e *HTTPRequestError) GatewayStatus() int {
+	return e.Status
+}
+
+func invalidHTTPInput(format string, args ...interface{}) *HTTPRequestError {
+	return &HTTPRequestError{Status: http.StatusBadRequest, Code: "invalid_request", Message: fmt.Sprintf(format, args...)}
+}
+
+// hostAllowed reports whether u's host matches an allowed pattern. A
+// pattern without a port allows every port.
+func (c *HTTPRequestConnector) hostAllowed(u *url.URL) bool {
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	for _, pattern := range c.hosts {
+		patternHost, patternPort, hasPort := strings.Cut(pattern, ":")
+		if hasPort && patternPort != port {
+			continue
+		}
+		if suffix, wildcard := strings.CutPrefix(patternHost, "*."); wildcard {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == patternHost {
+			return true
+		}
+	}
+	return false
+}
+
+type httpRequestInput struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Body is sent as is when it is a JSON string, otherwise as JSON
+	Body      json.RawMessage `json:"body"`
+	TimeoutMS int             `json:"timeout_ms"`
+}
+
+// HTTPResult is the response to an http.request
+type HTTPResult struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// JSON is the parsed body, when it is complete JSON
+	JSON      interface{} `json:"json,omitempty"`
+	Truncated bool        `json:"truncated"`
+	LatencyMS int64       `json:"latency_ms"`
+}
+
+// Request sends one request to an allowed host and returns the response
+// whatever its status. Redirects are returned rather than followed, so
+// credentials never go to a host that isn't allowed.
+func (c *HTTPRequestConnector) Request(input json.RawMessage) (interface{}, error) {
+	var in httpRequestInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil, invalidHTTPInput("invalid input: %v", err)
+	}
+	req, timeout, err := c.buildRequest(&in)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	log.Printf("http.request %s %s headers=%v", req.Method, redactURL(req.URL), RedactHeaders(in.Headers))
+	client := newGuardedClient(c.guard, timeout)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		if isForbidden(err) {
+			return nil, &HTTPRequestError{Status: http.StatusForbidden, Code: "forbidden_address", Message: err.Error()}
+		}
+		return nil, &HTTPRequestError{Status: http.StatusBadGateway, Code: "request_failed", Message: fmt.Sprintf("%s %s: %v", req.Method, redactURL(req.URL), err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxBytes+1))
+	if err != nil {
+		return nil, &HTTPRequestError{Status: http.StatusBadGateway, Code: "request_failed", Message: "reading response: " + err.Error()}
+	}
+	result := &HTTPResult{
+		Method:    req.Method,
+		URL:       req.URL.String(),
+		Status:    resp.StatusCode,
+		Headers:   make(map[string]string, len(resp.Header)),
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	for name := range resp.Header {
+		result.Headers[name] = resp.Header.Get(name)
+	}
+	if int64(len(body)) > c.maxBytes {
+		body, result.Truncated = body[:c.maxBytes], true
+	}
+	result.Body = string(body)
+	if !result.Truncated && len(body) > 0 && json.Valid(body) {
+		json.Unmarshal(body, &result.JSON)
+	}
+	return result, nil
+}
+
+func (c *HTTPRequestConnector) buildRequest(in *httpRequestInput) (*http.Request, time.Duration, error) {
+	method := strings.ToUpper(in.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !requestMethods[method] {
+		return nil, 0, invalidHTTPInput("unsupported method %q", in.Method)
+	}
+	if in.URL == "" {
+		return nil, 0, invalidHTTPInput("url is required")
+	}
+	target, err := url.Parse(in.URL)
+	if err != nil || target.Host == "" {
+		return nil, 0, invalidHTTPInput("invalid url %q", in.URL)
+	}
+	if err := checkScheme(target.Scheme); err != nil {
+		return nil, 0, invalidHTTPInput("%v", err)
+	}
+	if target.User != nil {
+		return nil, 0, invalidHTTPInput("credentials belong in headers, not the url")
+	}
+	if !c.hostAllowed(target) {
+		allowed := "no hosts are allowed; set HTTP_ALLOWED_HOSTS"
+		if len(c.hosts) > 0 {
+			allowed = "allowed hosts: " + strings.Join(c.hosts, ", ")
+		}
+		return nil, 0, &HTTPRequestError{
+			Status:  http.StatusForbidden,
+			Code:    "host_not_allowed",
+			Message: fmt.Sprintf("%s is not an allowed host (%s)", target.Host, allowed),
+		}
+	}
+
+	timeout := httpDefaultTimeout
+	if in.TimeoutMS > 0 {
+		timeout = time.Duration(in.TimeoutMS) * time.Millisecond
+		if timeout > httpMaxTimeout {
+			timeout = httpMaxTimeout
+		}
+	}
+
+	var body io.Reader
+	contentType := ""
+	if len(in.Body) > 0 && string(in.Body) != "null" {
+		if len(in.Body) > httpMaxRequestBytes {
+			return nil, 0, invalidHTTPInput("body is larger than %d bytes", httpMaxRequestBytes)
+		}
+		var text string
+		if json.Unmarshal(in.Body, &text) == nil {
+			body = strings.NewReader(text)
+			contentType = "text/plain; charset=utf-8"
+		} else {
+			body = bytes.NewReader(in.Body)
+			contentType = "application/json"
+		}
+	}
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, 0, invalidHTTPInput("%v", err)
+	}
+	for name, value := range in.Headers {
+		if strings.EqualFold(name, "Host") {
+			return nil, 0, invalidHTTPInput("the Host header can't be set")
+		}
+		req.Header.Set(name, value)
+	}
+	if contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, timeout, nil
+}
+
+// sensitiveHeaderWords mark headers that carry credentials
+var sensitiveHeaderWords = []string{"auth", "token", "key", "secret", "password", "cookie", "session", "signature"}
+
+// isSensitiveHeader reports whether a header carries credentials
+func isSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range sensitiveHeaderWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeaders copies headers with the values of credential headers
+// replaced, for logging
+func RedactHeaders(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if isSensitiveHeader(name) {
+			value = redactedValue
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+// redactURL hides the values of query parameters named like credentials
+func redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	redacted := *u
+	query := u.Query()
+	for name := range query {
+		if isSensitiveHeader(name) {
+			query[name] = []string{redactedValue}
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// HTTPCacheInput is what an http.request is cached under: its input with
+// credential headers and query parameters hashed, so keys hold no secrets yet requests with
+// different credentials never share a response. Only GET and HEAD
+// requests are cacheable.
+func HTTPCacheInput(input json.RawMessage) (json.RawMessage, bool) {
+	var in httpRequestInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil, false
+	}
+	if method := strings.ToUpper(in.Method); method != "" && method != http.MethodGet && method != http.MethodHead {
+		return nil, false
+	}
+	headers := make(map[string]string, len(in.Headers))
+	for name, value := range in.Headers {
+		if isSensitiveHeader(name) {
+			value = hashSecret(value)
+		}
+		headers[strings.ToLower(name)] = value
+	}
+	if u, err := url.Parse(in.URL); err == nil && u.RawQuery != "" {
+		query := u.Query()
+		for name, values := range query {
+			if isSensitiveHeader(name) {
+				for i := range values {
+					values[i] = hashSecret(values[i])
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+		in.URL = u.String()
+	}
+	in.Headers = headers
+	key, err := json.Marshal(in)
+	if err != nil {
+		return nil, false
+	}
+	return key, true
+}
+
+func hashSecret(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,228 @@
+package connectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testHTTPConnector reaches httptest servers on the allowed hosts
+func testHTTPConnector(t *testing.T, maxBytes int64, hosts ...string) *HTTPRequestConnector {
+	networks, err := ParseNetworks("127.0.0.0/8, ::1/128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newHTTPRequestConnector(hosts, networks, maxBytes)
+}
+
+// echoServer answers with the request it got as JSON
+func echoServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/created" {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"method":        r.Method,
+			"path":          r.URL.Path,
+			"query":         r.URL.RawQuery,
+			"authorization": r.Header.Get("Authorization"),
+			"content_type":  r.Header.Get("Content-Type"),
+			"body":          string(body),
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPRequestGet(t *testing.T) {
+	srv := echoServer(t)
+	result, err := testHTTPConnector(t, 0, "127.0.0.1").Request(testInput(t, map[string]interface{}{
+		"url":     srv.URL + "/items?page=2",
+		"headers": map[string]string{"Authorization": "Bearer s3cret"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := result.(*HTTPResult)
+	if resp.Method != http.MethodGet || resp.Status != http.StatusOK || resp.Truncated {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Headers["Content-Type"] != "application/json" {
+		t.Errorf("headers = %v", resp.Headers)
+	}
+	echoed, ok := resp.JSON.(map[string]interface{})
+	if !ok {
+		t.Fatalf("json = %#v, want the parsed body", resp.JSON)
+	}
+	if echoed["method"] != "GET" || echoed["path"] != "/items" || echoed["query"] != "page=2" || echoed["authorization"] != "Bearer s3cret" {
+		t.Errorf("server saw %v", echoed)
+	}
+}
+
+func TestHTTPRequestPost(t *testing.T) {
+	srv := echoServer(t)
+	c := testHTTPConnector(t, 0, "127.0.0.1")
+	tests := []struct {
+		name        string
+		body        interface{}
+		headers     map[string]string
+		wantBody    string
+		contentType string
+	}{
+		{"json body", map[string]interface{}{"name": "widget"}, nil, `{"name":"widget"}`, "application/json"},
+		{"string body", "a=1&b=2", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, "a=1&b=2", "application/x-www-form-urlencoded"},
+		{"plain text", "hello", nil, "hello", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := c.Request(testInput(t, map[string]interface{}{
+				"method": "post", "url": srv.URL + "/created", "headers": tt.headers, "body": tt.body,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := result.(*HTTPResult)
+			echoed := resp.JSON.(map[string]interface{})
+			if resp.Status != http.StatusCreated || echoed["method"] != "POST" {
+				t.Errorf("status %d, method %v", resp.Status, echoed["method"])
+			}
+			if echoed["body"] != tt.wantBody || echoed["content_type"] != tt.contentType {
+				t.Errorf("server got body %q as %q, want %q as %q", echoed["body"], echoed["content_type"], tt.wantBody, tt.contentType)
+			}
+		})
+	}
+}
+
+func TestHTTPRequestTruncatesLargeResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		maxBytes  int64
+		truncated bool
+		length    int
+	}{{64, true, 64}, {100, false, 100}} {
+		result, err := testHTTPConnector(t, tt.maxBytes, "127.0.0.1").Request(testInput(t, map[string]interface{}{"url": srv.URL}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp := result.(*HTTPResult); resp.Truncated != tt.truncated || len(resp.Body) != tt.length {
+			t.Errorf("cap %d: truncated %v with %d bytes, want %v with %d", tt.maxBytes, resp.Truncated, len(resp.Body), tt.truncated, tt.length)
+		}
+	}
+}
+
+func TestHTTPRequestHostAllowlist(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		http.Redirect(w, r, "http://localhost/elsewhere", http.StatusFound)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	tests := []struct {
+		name  string
+		hosts []string
+		url   string
+		code  string
+	}{
+		{"no hosts configured", nil, srv.URL, "host_not_allowed"},
+		{"other host", []string{"api.example.com"}, srv.URL, "host_not_allowed"},
+		{"other port", []string{"127.0.0.1:1"}, srv.URL, "host_not_allowed"},
+		{"wildcard doesn't match apex", []string{"*.example.com"}, "http://example.com/", "host_not_allowed"},
+		{"userinfo", []string{"127.0.0.1"}, "http://user:pass@" + u.Host, "invalid_request"},
+		{"not http", []string{"127.0.0.1"}, "ftp://" + u.Host, "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testHTTPConnector(t, 0, tt.hosts...).Request(testInput(t, map[string]interface{}{"url": tt.url}))
+			var httpErr *HTTPRequestError
+			if !errors.As(err, &httpErr) || httpErr.Code != tt.code {
+				t.Errorf("err = %v, want %s", err, tt.code)
+			}
+		})
+	}
+	if hits != 0 {
+		t.Fatalf("refused requests reached the server %d times", hits)
+	}
+
+	// An allowed host on its port; the redirect off it is returned, not
+	// followed
+	result, err := testHTTPConnector(t, 0, "127.0.0.1:"+u.Port()).Request(testInput(t, map[string]interface{}{"url": srv.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := result.(*HTTPResult); resp.Status != http.StatusFound || resp.Headers["Location"] != "http://localhost/elsewhere" {
+		t.Errorf("response = %+v, want the redirect", resp)
+	}
+
+	// Allowed hosts still can't reach private addresses unless allowed
+	_, err = newHTTPRequestConnector([]string{"127.0.0.1"}, nil, 0).Request(testInput(t, map[string]interface{}{"url": srv.URL}))
+	var httpErr *HTTPRequestError
+	if !errors.As(err, &httpErr) || httpErr.Code != "forbidden_address" || httpErr.GatewayStatus() != http.StatusForbidden {
+		t.Errorf("err = %v, want forbidden_address", err)
+	}
+}
+
+func TestHTTPRequestRedactsCredentialsInLogs(t *testing.T) {
+	srv := echoServer(t)
+	var logs bytes.Buffer
+	output := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(output)
+
+	_, err := testHTTPConnector(t, 0, "127.0.0.1").Request(testInput(t, map[string]interface{}{
+		"url":     srv.URL + "/items?api_key=k3y&page=1",
+		"headers": map[string]string{"Authorization": "Bearer s3cret", "X-Api-Key": "k3y", "Accept": "application/json"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := logs.String(); strings.Contains(out, "s3cret") || strings.Contains(out, "k3y") || !strings.Contains(out, "application/json") {
+		t.Errorf("log = %q, want credentials redacted and other headers kept", out)
+	}
+}
+
+func TestHTTPCacheInput(t *testing.T) {
+	key := func(fields map[string]interface{}) string {
+		input, cacheable := HTTPCacheInput(testInput(t, fields))
+		if !cacheable {
+			return ""
+		}
+		return string(input)
+	}
+	get := func(token string) map[string]interface{} {
+		return map[string]interface{}{"url": "https://api.example.com/items?token=" + token, "headers": map[string]string{"Authorization": "Bearer " + token}}
+	}
+
+	alice, bob := key(get("alice-secret")), key(get("bob-secret"))
+	if alice == "" || strings.Contains(alice, "alice-secret") {
+		t.Errorf("cache input %q holds the credential", alice)
+	}
+	if alice == bob {
+		t.Error("requests with different credentials share a cache key")
+	}
+	if alice != key(get("alice-secret")) {
+		t.Error("cache key isn't stable")
+	}
+	for _, method := range []string{"POST", "delete", "PATCH"} {
+		if key(map[string]interface{}{"method": method, "url": "https://api.example.com/items"}) != "" {
+			t.Errorf("%s requests are cacheable", method)
+		}
+	}
+	if key(map[string]interface{}{"method": "head", "url": "https://api.example.com/items"}) == "" {
+		t.Error("HEAD requests aren't cacheable")
+	}
+}
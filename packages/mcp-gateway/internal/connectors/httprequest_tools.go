@@ -0,0 +1,36 @@
+package connectors
+
+import "encoding/json"
+
+// HTTPRequestTools are the HTTP request connector's tools
+var HTTPRequestTools = []ToolSpec{
+	{
+		Name:        "http.request",
+		Description: "Call a REST endpoint on an allowed host",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"method": {"type": "string", "enum": ["GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"], "default": "GET"},
+		"url": {"type": "string", "format": "uri"},
+		"headers": {"type": "object", "additionalProperties": {"type": "string"}, "description": "Credential headers are redacted from logs and hashed in cache keys"},
+		"body": {"description": "Sent as is when a string, otherwise as JSON"},
+		"timeout_ms": {"type": "integer", "minimum": 1, "maximum": 60000, "default": 15000}
+	},
+	"required": ["url"]
+}`),
+		OutputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"method": {"type": "string"},
+		"url": {"type": "string"},
+		"status": {"type": "integer"},
+		"headers": {"type": "object", "additionalProperties": {"type": "string"}},
+		"body": {"type": "string"},
+		"json": {"description": "The parsed body, when it is complete JSON"},
+		"truncated": {"type": "boolean", "description": "Set when the body was cut at the size cap"},
+		"latency_ms": {"type": "integer"}
+	},
+	"required": ["method", "url", "status", "headers", "body", "truncated"]
+}`),
+	},
+}
@@ -0,0 +1,655 @@
+package connectors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	jiraDefaultPageSize  = 50
+	jiraMaxPageSize      = 100
+	jiraMaxSearchResults = 1000
+	jiraMaxRetries       = 3
+	// jiraMaxRetryWait is the longest Retry-After we wait out before
+	// returning a rate_limited error to the caller instead
+	jiraMaxRetryWait = 30 * time.Second
+)
+
+// jiraSearchFields are returned by Search unless the request asks for others
+var jiraSearchFields = []string{"summary", "status", "issuetype", "project", "priority", "labels", "assignee", "reporter", "created", "updated"}
+
+// JIRAAuth holds JIRA credentials: an account email with an API token for
+// basic auth, or a personal access token sent as a bearer token
+type JIRAAuth struct {
+	Email    string
+	APIToken string
+	PAT      string
+}
+
+func (a JIRAAuth) apply(req *http.Request) {
+	switch {
+	case a.PAT != "":
+		req.Header.Set("Authorization", "Bearer "+a.PAT)
+	case a.Email != "" && a.APIToken != "":
+		req.SetBasicAuth(a.Email, a.APIToken)
+	}
+}
+
+// JIRAConnector talks to the JIRA REST API (v3)
+type JIRAConnector struct {
+	baseURL string
+	auth    JIRAAuth
+	client  *http.Client
+	sleep   func(ctx context.Context, d time.Duration) error
+	ctx     context.Context
+}
+
+// NewJIRAConnector creates a JIRA connector for JIRA_BASE_URL, authenticated
+// with JIRA_PAT or with JIRA_EMAIL and JIRA_API_TOKEN
+func NewJIRAConnector() *JIRAConnector {
+	baseURL := os.Getenv("JIRA_BASE_URL")
+	auth := JIRAAuth{
+		Email:    os.Getenv("JIRA_EMAIL"),
+		APIToken: os.Getenv("JIRA_API_TOKEN"),
+		PAT:      os.Getenv("JIRA_PAT"),
+	}
+	if baseURL == "" {
+		log.Println("Warning: JIRA_BASE_URL not set, JIRA tools are disabled")
+	} else if auth.PAT == "" && (auth.Email == "" || auth.APIToken == "") {
+		log.Println("Warning: no JIRA credentials set, requests must carry their own")
+	}
+	return newJIRAConnector(baseURL, auth, &http.Client{Timeout: 30 * time.Second})
+}
+
+func newJIRAConnector(baseURL string, auth JIRAAuth, client *http.Client) *JIRAConnector {
+	return &JIRAConnector{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		auth:    auth,
+		client:  client,
+		sleep:   sleepContext,
+		ctx:     context.Background(),
+	}
+}
+
+// WithAuth returns a connector that uses auth instead of the configured
+// credentials, if auth holds any
+func (j *JIRAConnector) WithAuth(auth JIRAAuth) *JIRAConnector {
+	if auth.PAT == "" && (auth.Email == "" || auth.APIToken == "") {
+		return j
+	}
+	c := *j
+	c.auth = auth
+	return &c
+}
+
+// Configured reports whether JIRA_BASE_URL is set
+func (j *JIRAConnector) Configured() bool {
+	return j.baseURL != ""
+}
+
+// Ping checks that JIRA is reachable by reading its server info
+func (j *JIRAConnector) Ping(ctx context.Context) error {
+	c := *j
+	c.ctx = ctx
+	return c.do(http.MethodGet, "/rest/api/3/serverInfo", nil, nil)
+}
+
+// JIRAError is a failed JIRA call, condensed from JIRA's error payload
+type JIRAError struct {
+	Status     int               `json:"status"` // JIRA's HTTP status
+	Code       string            `json:"code"`
+	Message    string            `json:"message"`
+	Fields     map[string]string `json:"fields,omitempty"`      // per-field validation errors
+	RetryAfter int               `json:"retry_after,omitempty"` // seconds, when rate limited
+}
+
+func (e *JIRAError) Error() string {
+	return fmt.Sprintf("jira %s: %s", e.Code, e.Message)
+}
+
+// GatewayStatus is the status to answer the gateway's caller with: JIRA's
+// own for client errors and 502 when JIRA itself failed
+func (e *JIRAError) GatewayStatus() int {
+	if e.Status >= 400 && e.Status < 500 {
+		return e.Status
+	}
+	return http.StatusBadGateway
+}
+
+func jiraErrorCode(status int) string {
+	switch {
+	case status == http.StatusBadRequest:
+		return "invalid_request"
+	case status == http.StatusUnauthorized:
+		return "unauthorized"
+	case status == http.StatusForbidden:
+		return "forbidden"
+	case status == http.StatusNotFound:
+		return "not_found"
+	case status == http.StatusConflict:
+		return "conflict"
+	case status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case status >= 500:
+		return "upstream_error"
+	default:
+		return "request_failed"
+	}
+}
+
+// parseJIRAError condenses JIRA's {"errorMessages": [...], "errors": {...}}
+// payload into one message
+func parseJIRAError(resp *http.Response, body []byte) *JIRAError {
+	var payload struct {
+		ErrorMessages []string          `json:"errorMessages"`
+		Errors        map[string]string `json:"errors"`
+	}
+	json.Unmarshal(body, &payload)
+
+	messages := append([]string{}, payload.ErrorMessages...)
+	fields := make([]string, 0, len(payload.Errors))
+	for field := range payload.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		messages = append(messages, field+": "+payload.Errors[field])
+	}
+	if len(messages) == 0 {
+		messages = []string{http.StatusText(resp.StatusCode)}
+	}
+
+	jiraErr := &JIRAError{
+		Status:  resp.StatusCode,
+		Code:    jiraErrorCode(resp.StatusCode),
+		Message: strings.Join(messages, "; "),
+	}
+	if len(payload.Errors) > 0 {
+		jiraErr.Fields = payload.Errors
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		jiraErr.RetryAfter = int(math.Ceil(retryAfter(resp.Header, 0).Seconds()))
+	}
+	return jiraErr
+}
+
+// retryAfter is how long JIRA asks us to wait, from Retry-After, or an
+// exponential backoff if it doesn't say
+func retryAfter(header http.Header, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Second << attempt
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// do sends a request to JIRA and decodes the response into out. Rate
+// limited requests are retried after the wait JIRA asks for, as long as it
+// is short.
+func (j *JIRAConnector) do(method, path string, body, out interface{}) error {
+	if j.baseURL == "" {
+		return &JIRAError{Status: http.StatusServiceUnavailable, Code: "not_configured", Message: "JIRA_BASE_URL is not set"}
+	}
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode JIRA request: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(j.ctx, method, j.baseURL+path, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		j.auth.apply(req)
+
+		resp, err := j.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("JIRA request failed: %w", err)
+		}
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read JIRA response: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			wait := retryAfter(resp.Header, attempt)
+			if attempt < jiraMaxRetries && wait <= jiraMaxRetryWait {
+				log.Printf("JIRA returned %d, retrying %s %s in %s", resp.StatusCode, method, path, wait)
+				if err := j.sleep(j.ctx, wait); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if resp.StatusCode >= 300 {
+			return parseJIRAError(resp, respBody)
+		}
+		if out != nil && len(respBody) > 0 {
+			if err := json.Unmarshal(respBody, out); err != nil {
+				return fmt.Errorf("failed to decode JIRA response: %w", err)
+			}
+		}
+		return nil
+	}
+}
+
+func invalidInput(format string, args ...interface{}) *JIRAError {
+	return &JIRAError{Status: http.StatusBadRequest, Code: "invalid_input", Message: fmt.Sprintf(format, args...)}
+}
+
+// textToADF wraps plain text in an Atlassian Document Format document: one
+// paragraph per blank-line separated block, with single newlines as breaks
+func textToADF(text string) json.RawMessage {
+	type node map[string]interface{}
+	paragraphs := []node{}
+	for _, block := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		content := []node{}
+		for i, line := range strings.Split(block, "\n") {
+			if i > 0 {
+				content = append(content, node{"type": "hardBreak"})
+			}
+			if line != "" {
+				content = append(content, node{"type": "text", "text": line})
+			}
+		}
+		paragraphs = append(paragraphs, node{"type": "paragraph", "content": content})
+	}
+	data, _ := json.Marshal(node{"type": "doc", "version": 1, "content": paragraphs})
+	return data
+}
+
+// CreateTicketRequest is the input of jira.create_ticket
+type CreateTicketRequest struct {
+	Project   string `json:"project"`              // project key
+	IssueType string `json:"issue_type,omitempty"` // defaults to Task
+	Summary   string `json:"summary"`
+	// Description is plain text converted to ADF; DescriptionADF is an ADF
+	// document used as-is and wins if both are set
+	Description    string                 `json:"description,omitempty"`
+	DescriptionADF json.RawMessage        `json:"description_adf,omitempty"`
+	Labels         []string               `json:"labels,omitempty"`
+	CustomFields   map[string]interface{} `json:"custom_fields,omitempty"` // by field ID, e.g. customfield_10010
+}
+
+// TicketRef identifies a created ticket
+type TicketRef struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// CreateTicket creates an issue
+func (j *JIRAConnector) CreateTicket(input json.RawMessage) (interface{}, error) {
+	var req CreateTicketRequest
+	if err := json.Unmarshal(input, &req); err != nil {
+		return nil, invalidInput("invalid input: %v", err)
+	}
+	if req.Project == "" || strings.TrimSpace(req.Summary) == "" {
+		return nil, invalidInput("project and summary are required")
+	}
+	if req.IssueType == "" {
+		req.IssueType = "Task"
+	}
+
+	fields := map[string]interface{}{}
+	for id, value := range req.CustomFields {
+		fields[id] = value
+	}
+	fields["project"] = map[string]string{"key": req.Project}
+	fields["issuetype"] = map[string]string{"name": req.IssueType}
+	fields["summary"] = req.Summary
+	if len(req.DescriptionADF) > 0 {
+		fields["description"] = req.DescriptionADF
+	} else if req.Description != "" {
+		fields["description"] = textToADF(req.Description)
+	}
+	if len(req.Labels) > 0 {
+		fields["labels"] = req.Labels
+	}
+
+	var created struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	if err := j.do(http.MethodPost, "/rest/api/3/issue", map[string]interface{}{"fields": fields}, &created); err != nil {
+		return nil, err
+	}
+	log.Printf("Created JIRA ticket %s in %s", created.Key, req.Project)
+	return TicketRef{ID: created.ID, Key: created.Key, URL: j.browseURL(created.Key)}, nil
+}
+
+// UpdateTicketRequest is the input of jira.update_ticket. Field updates are
+// applied first, then the transition, then the comment.
+type UpdateTicketRequest struct {
+	Key string `json:"key"`
+	// Fields are set as given, by field name or ID
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// Transition is the name of a transition, or of the status it leads to
+	Transition string `json:"transition,omitempty"`
+	Comment    string `json:"comment,omitempty"` // plain text
+}
+
+// UpdateTicketResult is the output of jira.update_ticket
+type UpdateTicketResult struct {
+	Key           string   `json:"key"`
+	UpdatedFields []string `json:"updated_fields,omitempty"`
+	Status        string   `json:"status,omitempty"` // after the transition
+	CommentID     string   `json:"comment_id,omitempty"`
+}
+
+type jiraTransition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	To   struct {
+		Name string `json:"name"`
+	} `json:"to"`
+}
+
+// UpdateTicket updates an issue's fields, transitions it and comments on it
+func (j *JIRAConnector) UpdateTicket(input json.RawMessage) (interface{}, error) {
+	var req UpdateTicketRequest
+	if err := json.Unmarshal(input, &req); err != nil {
+		return nil, invalidInput("invalid input: %v", err)
+	}
+	if req.Key == "" {
+		return nil, invalidInput("key is required")
+	}
+	if len(req.Fields) == 0 && req.Transition == "" && req.Comment == "" {
+		return nil, invalidInput("nothing to update: set fields, transition or comment")
+	}
+
+	result := UpdateTicketResult{Key: req.Key}
+	issuePath := "/rest/api/3/issue/" + url.PathEscape(req.Key)
+
+	if len(req.Fields) > 0 {
+		if err := j.do(http.MethodPut, issuePath, map[string]interface{}{"fields": req.Fields}, nil); err != nil {
+			return nil, err
+		}
+		for field := range req.Fields {
+			result.UpdatedFields = append(result.UpdatedFields, field)
+		}
+		sort.Strings(result.UpdatedFields)
+	}
+
+	if req.Transition != "" {
+		var available struct {
+			Transitions []jiraTransition `json:"transitions"`
+		}
+		if err := j.do(http.MethodGet, issuePath+"/transitions", nil, &available); err != nil {
+			return nil, err
+		}
+		transition, ok := findTransition(available.Transitions, req.Transition)
+		if !ok {
+			names := make([]string, 0, len(available.Transitions))
+			for _, t := range available.Transitions {
+				names = append(names, strconv.Quote(t.Name))
+			}
+			return nil, &JIRAError{
+				Status:  http.StatusBadRequest,
+				Code:    "invalid_transition",
+				Message: fmt.Sprintf("no transition %q from the current status of %s; available: %s", req.Transition, req.Key, strings.Join(names, ", ")),
+			}
+		}
+		body := map[string]interface{}{"transition": map[string]string{"id": transition.ID}}
+		if err := j.do(http.MethodPost, issuePath+"/transitions", body, nil); err != nil {
+			return nil, err
+		}
+		result.Status = transition.To.Name
+	}
+
+	if req.Comment != "" {
+		var comment struct {
+			ID string `json:"id"`
+		}
+		if err := j.do(http.MethodPost, issuePath+"/comment", map[string]interface{}{"body": textToADF(req.Comment)}, &comment); err != nil {
+			return nil, err
+		}
+		result.CommentID = comment.ID
+	}
+
+	return result, nil
+}
+
+// findTransition matches a transition by its name, then by the name of the
+// status it leads to, ignoring case
+func findTransition(transitions []jiraTransition, name string) (jiraTransition, bool) {
+	for _, t := range transitions {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	for _, t := range transitions {
+		if strings.EqualFold(t.To.Name, name) {
+			return t, true
+		}
+	}
+	return jiraTransition{}, false
+}
+
+// GetTicketRequest is the input of jira.get_ticket
+type GetTicketRequest struct {
+	Key    string   `json:"key"`
+	Fields []string `json:"fields,omitempty"` // all fields if empty
+}
+
+// Ticket is a JIRA issue
+type Ticket struct {
+	ID           string                     `json:"id"`
+	Key          string                     `json:"key"`
+	URL          string                     `json:"url"`
+	Summary      string                     `json:"summary"`
+	Status       string                     `json:"status,omitempty"`
+	IssueType    string                     `json:"issue_type,omitempty"`
+	Project      string                     `json:"project,omitempty"` // key
+	Priority     string                     `json:"priority,omitempty"`
+	Labels       []string                   `json:"labels,omitempty"`
+	Assignee     string                     `json:"assignee,omitempty"`
+	Reporter     string                     `json:"reporter,omitempty"`
+	Description  json.RawMessage            `json:"description,omitempty"` // ADF
+	Created      string                     `json:"created,omitempty"`
+	Updated      string                     `json:"updated,omitempty"`
+	CustomFields map[string]json.RawMessage `json:"custom_fields,omitempty"`
+}
+
+// jiraIssue is an issue as JIRA returns it
+type jiraIssue struct {
+	ID     string                     `json:"id"`
+	Key    string                     `json:"key"`
+	Fields map[string]json.RawMessage `json:"fields"`
+}
+
+func (j *JIRAConnector) toTicket(issue jiraIssue) Ticket {
+	ticket := Ticket{ID: issue.ID, Key: issue.Key, URL: j.browseURL(issue.Key)}
+
+	json.Unmarshal(issue.Fields["summary"], &ticket.Summary)
+	ticket.Status = jiraName(issue.Fields["status"])
+	ticket.IssueType = jiraName(issue.Fields["issuetype"])
+	var project struct {
+		Key string `json:"key"`
+	}
+	json.Unmarshal(issue.Fields["project"], &project)
+	ticket.Project = project.Key
+	ticket.Priority = jiraName(issue.Fields["priority"])
+	ticket.Assignee = jiraName(issue.Fields["assignee"])
+	ticket.Reporter = jiraName(issue.Fields["reporter"])
+	json.Unmarshal(issue.Fields["labels"], &ticket.Labels)
+	json.Unmarshal(issue.Fields["created"], &ticket.Created)
+	json.Unmarshal(issue.Fields["updated"], &ticket.Updated)
+	if description := issue.Fields["description"]; len(description) > 0 && string(description) != "null" {
+		ticket.Description = description
+	}
+
+	for name, value := range issue.Fields {
+		if !strings.HasPrefix(name, "customfield_") || len(value) == 0 || string(value) == "null" {
+			continue
+		}
+		if ticket.CustomFields == nil {
+			ticket.CustomFields = make(map[string]json.RawMessage)
+		}
+		ticket.CustomFields[name] = value
+	}
+	return ticket
+}
+
+// jiraName is the display value of an object field such as status, project
+// or assignee
+func jiraName(raw json.RawMessage) string {
+	var named struct {
+		Name        string `json:"name"`
+		Key         string `json:"key"`
+		DisplayName string `json:"displayName"`
+	}
+	json.Unmarshal(raw, &named)
+	switch {
+	case named.DisplayName != "":
+		return named.DisplayName
+	case named.Name != "":
+		return named.Name
+	}
+	return named.Key
+}
+
+func (j *JIRAConnector) browseURL(key string) string {
+	return j.baseURL + "/browse/" + key
+}
+
+// GetTicket returns an issue
+func (j *JIRAConnector) GetTicket(input json.RawMessage) (interface{}, error) {
+	var req GetTicketRequest
+	if err := json.Unmarshal(input, &req); err != nil {
+		return nil, invalidInput("invalid input: %v", err)
+	}
+	if req.Key == "" {
+		return nil, invalidInput("key is required")
+	}
+
+	path := "/rest/api/3/issue/" + url.PathEscape(req.Key)
+	if len(req.Fields) > 0 {
+		path += "?fields=" + url.QueryEscape(strings.Join(req.Fields, ","))
+	}
+	var issue jiraIssue
+	if err := j.do(http.MethodGet, path, nil, &issue); err != nil {
+		return nil, err
+	}
+	return j.toTicket(issue), nil
+}
+
+// SearchRequest is the input of jira.search. Without All it returns one
+// page starting at StartAt; with All it follows pages until every match, up
+// to 1000, is returned.
+type SearchRequest struct {
+	JQL        string   `json:"jql"`
+	StartAt    int      `json:"start_at,omitempty"`
+	MaxResults int      `json:"max_results,omitempty"` // page size, at most 100
+	Fields     []string `json:"fields,omitempty"`
+	All        bool     `json:"all,omitempty"`
+}
+
+// SearchResult is the output of jira.search
+type SearchResult struct {
+	Issues     []Ticket `json:"issues"`
+	StartAt    int      `json:"start_at"`
+	MaxResults int      `json:"max_results"`
+	Total      int      `json:"total"`
+	// NextStartAt is where the next page starts, if there is one
+	NextStartAt *int `json:"next_start_at,omitempty"`
+	Truncated   bool `json:"truncated,omitempty"`
+}
+
+// Search finds issues with JQL
+func (j *JIRAConnector) Search(input json.RawMessage) (interface{}, error) {
+	var req SearchRequest
+	if err := json.Unmarshal(input, &req); err != nil {
+		return nil, invalidInput("invalid input: %v", err)
+	}
+	if strings.TrimSpace(req.JQL) == "" {
+		return nil, invalidInput("jql is required")
+	}
+	if req.StartAt < 0 {
+		return nil, invalidInput("start_at must not be negative")
+	}
+	if req.MaxResults <= 0 {
+		req.MaxResults = jiraDefaultPageSize
+	}
+	if req.MaxResults > jiraMaxPageSize {
+		req.MaxResults = jiraMaxPageSize
+	}
+	fields := req.Fields
+	if len(fields) == 0 {
+		fields = jiraSearchFields
+	}
+
+	result := SearchResult{Issues: []Ticket{}, StartAt: req.StartAt, MaxResults: req.MaxResults}
+	startAt := req.StartAt
+	for {
+		var page struct {
+			StartAt    int         `json:"startAt"`
+			MaxResults int         `json:"maxResults"`
+			Total      int         `json:"total"`
+			Issues     []jiraIssue `json:"issues"`
+		}
+		body := map[string]interface{}{
+			"jql":        req.JQL,
+			"startAt":    startAt,
+			"maxResults": req.MaxResults,
+			"fields":     fields,
+		}
+		if err := j.do(http.MethodPost, "/rest/api/3/search", body, &page); err != nil {
+			return nil, err
+		}
+		for _, issue := range page.Issues {
+			result.Issues = append(result.Issues, j.toTicket(issue))
+		}
+		result.Total = page.Total
+
+		next := page.StartAt + len(page.Issues)
+		if len(page.Issues) == 0 || next >= page.Total {
+			result.NextStartAt = nil
+			break
+		}
+		result.NextStartAt = &next
+		if !req.All {
+			break
+		}
+		if len(result.Issues) >= jiraMaxSearchResults {
+			result.Truncated = true
+			break
+		}
+		startAt = next
+	}
+	return result, nil
+}
@@ -0,0 +1,366 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeJIRA records requests and answers them with handler
+type fakeJIRA struct {
+	handler func(w http.ResponseWriter, r *http.Request, body map[string]interface{})
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (f *fakeJIRA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	f.handler(w, r, body)
+}
+
+func newTestJIRA(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body map[string]interface{})) (*JIRAConnector, *fakeJIRA, *[]time.Duration) {
+	fake := &fakeJIRA{handler: handler}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	j := newJIRAConnector(srv.URL, JIRAAuth{Email: "bot@example.com", APIToken: "token"}, srv.Client())
+	var slept []time.Duration
+	j.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	return j, fake, &slept
+}
+
+func TestJIRACreateTicket(t *testing.T) {
+	j, _, _ := newTestJIRA(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		if r.Method != http.MethodPost || r.URL.Path != "/rest/api/3/issue" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "token" {
+			t.Errorf("basic auth = %q, %q, %v", user, pass, ok)
+		}
+
+		fields := body["fields"].(map[string]interface{})
+		if fields["project"].(map[string]interface{})["key"] != "QL" ||
+			fields["issuetype"].(map[string]interface{})["name"] != "Bug" ||
+			fields["summary"] != "Generation failed" ||
+			fields["customfield_10010"] != "wf-123" {
+			t.Errorf("unexpected fields: %v", fields)
+		}
+		description := fields["description"].(map[string]interface{})
+		if description["type"] != "doc" || len(description["content"].([]interface{})) != 2 {
+			t.Errorf("description is not a two paragraph ADF doc: %v", description)
+		}
+		if labels := fields["labels"].([]interface{}); len(labels) != 1 || labels[0] != "quantumlayer" {
+			t.Errorf("labels = %v", labels)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"10001","key":"QL-42","self":"ignored"}`))
+	})
+
+	out, err := j.CreateTicket(json.RawMessage(`{
+		"project": "QL",
+		"issue_type": "Bug",
+		"summary": "Generation failed",
+		"description": "Workflow wf-123 failed.\n\nSee the logs.",
+		"labels": ["quantumlayer"],
+		"custom_fields": {"customfield_10010": "wf-123"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := out.(TicketRef)
+	if ref.Key != "QL-42" || ref.ID != "10001" || !strings.HasSuffix(ref.URL, "/browse/QL-42") {
+		t.Errorf("ref = %+v", ref)
+	}
+}
+
+func TestJIRACreateTicketValidatesInput(t *testing.T) {
+	j, fake, _ := newTestJIRA(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {})
+
+	_, err := j.CreateTicket(json.RawMessage(`{"project": "QL"}`))
+	var jiraErr *JIRAError
+	if !errors.As(err, &jiraErr) || jiraErr.Code != "invalid_input" || jiraErr.GatewayStatus() != http.StatusBadRequest {
+		t.Fatalf("err = %v, want invalid_input", err)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("JIRA was called: %v", fake.requests)
+	}
+}
+
+func transitionsHandler(t *testing.T, transitioned *string) func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+	return func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		switch r.Method + " " + r.URL.Path {
+		case "PUT /rest/api/3/issue/QL-7":
+			w.WriteHeader(http.StatusNoContent)
+		case "GET /rest/api/3/issue/QL-7/transitions":
+			w.Write([]byte(`{"transitions": [
+				{"id": "11", "name": "Start Progress", "to": {"name": "In Progress"}},
+				{"id": "31", "name": "Resolve", "to": {"name": "Done"}}
+			]}`))
+		case "POST /rest/api/3/issue/QL-7/transitions":
+			*transitioned = body["transition"].(map[string]interface{})["id"].(string)
+			w.WriteHeader(http.StatusNoContent)
+		case "POST /rest/api/3/issue/QL-7/comment":
+			if body["body"].(map[string]interface{})["type"] != "doc" {
+				t.Errorf("comment body is not ADF: %v", body)
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": "5000"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestJIRAUpdateTicketTransitionsByName(t *testing.T) {
+	var transitioned string
+	j, fake, _ := newTestJIRA(t, transitionsHandler(t, &transitioned))
+
+	// "done" matches the Resolve transition's target status
+	out, err := j.UpdateTicket(json.RawMessage(`{
+		"key": "QL-7",
+		"fields": {"summary": "Retry succeeded", "labels": ["fixed"]},
+		"transition": "done",
+		"comment": "Fixed by regeneration"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := out.(UpdateTicketResult)
+	if transitioned != "31" || result.Status != "Done" || result.CommentID != "5000" {
+		t.Errorf("result = %+v, transitioned %q", result, transitioned)
+	}
+	if strings.Join(result.UpdatedFields, ",") != "labels,summary" {
+		t.Errorf("updated fields = %v", result.UpdatedFields)
+	}
+	want := []string{
+		"PUT /rest/api/3/issue/QL-7",
+		"GET /rest/api/3/issue/QL-7/transitions",
+		"POST /rest/api/3/issue/QL-7/transitions",
+		"POST /rest/api/3/issue/QL-7/comment",
+	}
+	if strings.Join(fake.requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests = %v, want %v", fake.requests, want)
+	}
+}
+
+func TestJIRAUpdateTicketUnknownTransition(t *testing.T) {
+	var transitioned string
+	j, _, _ := newTestJIRA(t, transitionsHandler(t, &transitioned))
+
+	_, err := j.UpdateTicket(json.RawMessage(`{"key": "QL-7", "transition": "Reopen"}`))
+	var jiraErr *JIRAError
+	if !errors.As(err, &jiraErr) || jiraErr.Code != "invalid_transition" {
+		t.Fatalf("err = %v, want invalid_transition", err)
+	}
+	if !strings.Contains(jiraErr.Message, `"Start Progress"`) || !strings.Contains(jiraErr.Message, `"Resolve"`) {
+		t.Errorf("message doesn't list the available transitions: %s", jiraErr.Message)
+	}
+	if transitioned != "" {
+		t.Errorf("transitioned to %q", transitioned)
+	}
+}
+
+func TestJIRAGetTicket(t *testing.T) {
+	j, _, _ := newTestJIRA(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		w.Write([]byte(`{"id": "10001", "key": "QL-42", "fields": {
+			"summary": "Generation failed",
+			"status": {"name": "In Progress"},
+			"issuetype": {"name": "Bug"},
+			"project": {"key": "QL", "name": "QuantumLayer"},
+			"labels": ["quantumlayer"],
+			"assignee": {"displayName": "Sam Doe"},
+			"reporter": null,
+			"description": {"type": "doc", "version": 1, "content": []},
+			"customfield_10010": "wf-123",
+			"customfield_10011": null
+		}}`))
+	})
+
+	out, err := j.GetTicket(json.RawMessage(`{"key": "QL-42"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket := out.(Ticket)
+	if ticket.Summary != "Generation failed" || ticket.Status != "In Progress" || ticket.IssueType != "Bug" ||
+		ticket.Project != "QL" || ticket.Assignee != "Sam Doe" || ticket.Reporter != "" {
+		t.Errorf("ticket = %+v", ticket)
+	}
+	if len(ticket.CustomFields) != 1 || string(ticket.CustomFields["customfield_10010"]) != `"wf-123"` {
+		t.Errorf("custom fields = %v", ticket.CustomFields)
+	}
+	if len(ticket.Description) == 0 {
+		t.Error("description is missing")
+	}
+}
+
+// searchHandler serves total issues in pages
+func searchHandler(total int) func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+	return func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		startAt := int(body["startAt"].(float64))
+		maxResults := int(body["maxResults"].(float64))
+		issues := []map[string]interface{}{}
+		for i := startAt; i < total && i < startAt+maxResults; i++ {
+			issues = append(issues, map[string]interface{}{
+				"id":     strings.Repeat("1", i+1),
+				"key":    "QL-" + strings.Repeat("1", i+1),
+				"fields": map[string]interface{}{"summary": "issue"},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"startAt": startAt, "maxResults": maxResults, "total": total, "issues": issues,
+		})
+	}
+}
+
+func TestJIRASearchPage(t *testing.T) {
+	j, fake, _ := newTestJIRA(t, searchHandler(5))
+
+	out, err := j.Search(json.RawMessage(`{"jql": "project = QL", "start_at": 2, "max_results": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := out.(SearchResult)
+	if len(result.Issues) != 2 || result.Total != 5 || result.StartAt != 2 {
+		t.Fatalf("result = %+v", result)
+	}
+	if result.NextStartAt == nil || *result.NextStartAt != 4 {
+		t.Errorf("next_start_at = %v, want 4", result.NextStartAt)
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("requests = %v, want one page", fake.requests)
+	}
+
+	out, err = j.Search(json.RawMessage(`{"jql": "project = QL", "start_at": 4, "max_results": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := out.(SearchResult); len(result.Issues) != 1 || result.NextStartAt != nil {
+		t.Errorf("last page = %+v, want one issue and no next page", result)
+	}
+}
+
+func TestJIRASearchAllFollowsPages(t *testing.T) {
+	j, fake, _ := newTestJIRA(t, searchHandler(5))
+
+	out, err := j.Search(json.RawMessage(`{"jql": "project = QL", "max_results": 2, "all": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := out.(SearchResult)
+	if len(result.Issues) != 5 || result.NextStartAt != nil || result.Truncated {
+		t.Errorf("result = %+v, want all 5 issues", result)
+	}
+	if len(fake.requests) != 3 {
+		t.Errorf("made %d requests, want 3 pages", len(fake.requests))
+	}
+}
+
+func TestJIRAErrorsAreCondensed(t *testing.T) {
+	j, _, _ := newTestJIRA(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errorMessages": ["Invalid request"], "errors": {"summary": "You must specify a summary of the issue.", "issuetype": "Specify a valid issue type"}, "status": 400}`))
+	})
+
+	_, err := j.Search(json.RawMessage(`{"jql": "project = NOPE"}`))
+	var jiraErr *JIRAError
+	if !errors.As(err, &jiraErr) {
+		t.Fatalf("err = %v, want a JIRAError", err)
+	}
+	want := "Invalid request; issuetype: Specify a valid issue type; summary: You must specify a summary of the issue."
+	if jiraErr.Code != "invalid_request" || jiraErr.Message != want || len(jiraErr.Fields) != 2 {
+		t.Errorf("err = %+v", jiraErr)
+	}
+}
+
+func TestJIRARetriesAfterRateLimit(t *testing.T) {
+	calls := 0
+	j, _, slept := newTestJIRA(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"id": "1", "key": "QL-1", "fields": {"summary": "ok"}}`))
+	})
+
+	if _, err := j.GetTicket(json.RawMessage(`{"key": "QL-1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || len(*slept) != 1 || (*slept)[0] != 2*time.Second {
+		t.Errorf("calls = %d, slept = %v, want one 2s wait", calls, *slept)
+	}
+}
+
+func TestJIRAGivesUpOnLongRateLimit(t *testing.T) {
+	j, _, slept := newTestJIRA(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, err := j.GetTicket(json.RawMessage(`{"key": "QL-1"}`))
+	var jiraErr *JIRAError
+	if !errors.As(err, &jiraErr) || jiraErr.Code != "rate_limited" || jiraErr.RetryAfter != 120 {
+		t.Fatalf("err = %+v, want rate_limited with retry_after 120", err)
+	}
+	if jiraErr.GatewayStatus() != http.StatusTooManyRequests || len(*slept) != 0 {
+		t.Errorf("status = %d, slept = %v", jiraErr.GatewayStatus(), *slept)
+	}
+}
+
+func TestJIRAWithAuthUsesPAT(t *testing.T) {
+	j, _, _ := newTestJIRA(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		if got := r.Header.Get("Authorization"); got != "Bearer personal-token" {
+			t.Errorf("Authorization = %q, want the PAT", got)
+		}
+		w.Write([]byte(`{"id": "1", "key": "QL-1", "fields": {}}`))
+	})
+
+	if _, err := j.WithAuth(JIRAAuth{PAT: "personal-token"}).GetTicket(json.RawMessage(`{"key": "QL-1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if j.WithAuth(JIRAAuth{}) != j {
+		t.Error("WithAuth without credentials should keep the configured ones")
+	}
+}
+
+func TestJIRAPing(t *testing.T) {
+	status := http.StatusOK
+	j, fake, _ := newTestJIRA(t, func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"version": "1001.0.0"}`))
+	})
+	if err := j.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.requests[0]; got != "GET /rest/api/3/serverInfo" {
+		t.Errorf("request = %s", got)
+	}
+
+	status = http.StatusInternalServerError
+	if err := j.Ping(context.Background()); err == nil {
+		t.Error("Ping succeeded against a failing JIRA")
+	}
+	if newJIRAConnector("", JIRAAuth{}, nil).Configured() {
+		t.Error("connector without a base URL is configured")
+	}
+}
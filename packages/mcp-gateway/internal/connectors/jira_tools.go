@@ -0,0 +1,121 @@
+package connectors
+
+import "encoding/json"
+
+// ToolSpec describes a connector tool for the gateway's tool catalog, with
+// JSON schemas for its input and output
+type ToolSpec struct {
+	Name         string
+	Description  string
+	InputSchema  json.RawMessage
+	OutputSchema json.RawMessage
+}
+
+const jiraTicketSchema = `{
+	"type": "object",
+	"properties": {
+		"id": {"type": "string"},
+		"key": {"type": "string"},
+		"url": {"type": "string", "format": "uri"},
+		"summary": {"type": "string"},
+		"status": {"type": "string"},
+		"issue_type": {"type": "string"},
+		"project": {"type": "string"},
+		"priority": {"type": "string"},
+		"labels": {"type": "array", "items": {"type": "string"}},
+		"assignee": {"type": "string"},
+		"reporter": {"type": "string"},
+		"description": {"type": "object", "description": "Atlassian Document Format"},
+		"created": {"type": "string"},
+		"updated": {"type": "string"},
+		"custom_fields": {"type": "object"}
+	},
+	"required": ["id", "key", "url", "summary"]
+}`
+
+// JIRATools are the JIRA connector's tools
+var JIRATools = []ToolSpec{
+	{
+		Name:        "jira.create_ticket",
+		Description: "Create a JIRA ticket",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"project": {"type": "string", "description": "Project key"},
+		"issue_type": {"type": "string", "default": "Task"},
+		"summary": {"type": "string", "minLength": 1},
+		"description": {"type": "string", "description": "Plain text, converted to Atlassian Document Format"},
+		"description_adf": {"type": "object", "description": "Atlassian Document Format document, used instead of description"},
+		"labels": {"type": "array", "items": {"type": "string"}},
+		"custom_fields": {"type": "object", "description": "Values by field ID, e.g. customfield_10010"}
+	},
+	"required": ["project", "summary"]
+}`),
+		OutputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"id": {"type": "string"},
+		"key": {"type": "string"},
+		"url": {"type": "string", "format": "uri"}
+	},
+	"required": ["id", "key", "url"]
+}`),
+	},
+	{
+		Name:        "jira.update_ticket",
+		Description: "Update a JIRA ticket's fields, transition it and comment on it",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"key": {"type": "string", "description": "Issue key, e.g. QL-123"},
+		"fields": {"type": "object", "description": "Field values by name or ID"},
+		"transition": {"type": "string", "description": "Transition name, or the name of the status it leads to"},
+		"comment": {"type": "string"}
+	},
+	"required": ["key"]
+}`),
+		OutputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"key": {"type": "string"},
+		"updated_fields": {"type": "array", "items": {"type": "string"}},
+		"status": {"type": "string"},
+		"comment_id": {"type": "string"}
+	},
+	"required": ["key"]
+}`),
+	},
+	{
+		Name:         "jira.get_ticket",
+		Description:  "Get a JIRA ticket",
+		InputSchema:  json.RawMessage(`{"type": "object", "properties": {"key": {"type": "string"}, "fields": {"type": "array", "items": {"type": "string"}}}, "required": ["key"]}`),
+		OutputSchema: json.RawMessage(jiraTicketSchema),
+	},
+	{
+		Name:        "jira.search",
+		Description: "Search JIRA tickets with JQL",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"jql": {"type": "string"},
+		"start_at": {"type": "integer", "minimum": 0},
+		"max_results": {"type": "integer", "minimum": 1, "maximum": 100, "default": 50},
+		"fields": {"type": "array", "items": {"type": "string"}},
+		"all": {"type": "boolean", "description": "Follow pages until every match, up to 1000, is returned"}
+	},
+	"required": ["jql"]
+}`),
+		OutputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"issues": {"type": "array", "items": ` + jiraTicketSchema + `},
+		"start_at": {"type": "integer"},
+		"max_results": {"type": "integer"},
+		"total": {"type": "integer"},
+		"next_start_at": {"type": "integer"},
+		"truncated": {"type": "boolean"}
+	},
+	"required": ["issues", "start_at", "max_results", "total"]
+}`),
+	},
+}
@@ -0,0 +1,541 @@
+package connectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// APISpec is an OpenAPI 2 or 3 document reduced to its operations, with
+// every local $ref resolved
+type APISpec struct {
+	Title           string                    `json:"title"`
+	Version         string                    `json:"version"`
+	SpecVersion     string                    `json:"spec_version"`
+	Servers         []string                  `json:"servers"`
+	Operations      []Operation               `json:"operations"`
+	SecuritySchemes map[string]SecurityScheme `json:"security_schemes,omitempty"`
+	// Unsupported lists constructs that were skipped or only partly
+	// understood, so callers know what the operations leave out
+	Unsupported []string `json:"unsupported,omitempty"`
+}
+
+// Operation is one method on one path
+type Operation struct {
+	ID          string              `json:"operation_id,omitempty"`
+	Method      string              `json:"method"`
+	Path        string              `json:"path"`
+	Summary     string              `json:"summary,omitempty"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"request_body,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	// Auth lists alternative sets of security schemes, any one of which is
+	// enough; an empty set means the operation can be called anonymously
+	Auth [][]string `json:"auth,omitempty"`
+}
+
+// Parameter is a path, query, header or cookie parameter
+type Parameter struct {
+	Name     string          `json:"name"`
+	In       string          `json:"in"`
+	Required bool            `json:"required"`
+	Schema   json.RawMessage `json:"schema,omitempty"`
+}
+
+// RequestBody is an operation's body, in its preferred content type
+type RequestBody struct {
+	Required    bool            `json:"required"`
+	ContentType string          `json:"content_type"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+// Response is a documented response, in its preferred content type
+type Response struct {
+	Description string          `json:"description,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+// SecurityScheme describes how an operation authenticates
+type SecurityScheme struct {
+	Type   string `json:"type"`             // http, apiKey, oauth2 or openIdConnect
+	Scheme string `json:"scheme,omitempty"` // for http: basic or bearer
+	In     string `json:"in,omitempty"`     // for apiKey: header, query or cookie
+	Name   string `json:"name,omitempty"`   // for apiKey
+}
+
+var httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// maxRefDepth bounds $ref resolution on pathological documents
+const maxRefDepth = 64
+
+// ParseSpec parses an OpenAPI 2 or 3 document in JSON or YAML
+func ParseSpec(data []byte) (*APISpec, error) {
+	var raw interface{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		raw = stringKeys(raw)
+	}
+	root, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("document is not an object")
+	}
+
+	p := &specParser{root: root, flagged: make(map[string]bool)}
+	var spec *APISpec
+	switch {
+	case str(root["swagger"]) == "2.0":
+		spec = p.parseSwagger()
+	case strings.HasPrefix(str(root["openapi"]), "3."):
+		spec = p.parseOpenAPI3()
+	default:
+		return nil, fmt.Errorf("not an OpenAPI 2.0 or 3.x document")
+	}
+	spec.Unsupported = p.unsupported
+	return spec, nil
+}
+
+// stringKeys converts the maps YAML decodes to, which may have non-string
+// keys such as response codes, into JSON style maps
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = stringKeys(child)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[fmt.Sprint(k)] = stringKeys(child)
+		}
+		return m
+	case []interface{}:
+		for i, child := range v {
+			v[i] = stringKeys(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+type specParser struct {
+	root        map[string]interface{}
+	unsupported []string
+	flagged     map[string]bool
+}
+
+func (p *specParser) flag(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if !p.flagged[msg] {
+		p.flagged[msg] = true
+		p.unsupported = append(p.unsupported, msg)
+	}
+}
+
+// resolve returns a copy of node with every local $ref replaced by its
+// target. External and recursive refs are flagged and left empty.
+func (p *specParser) resolve(node interface{}, stack map[string]bool) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			if !strings.HasPrefix(ref, "#/") {
+				p.flag("external $ref %s", ref)
+				return map[string]interface{}{}
+			}
+			if stack[ref] || len(stack) >= maxRefDepth {
+				p.flag("recursive $ref %s", ref)
+				return map[string]interface{}{}
+			}
+			target, ok := p.lookup(ref)
+			if !ok {
+				p.flag("unresolved $ref %s", ref)
+				return map[string]interface{}{}
+			}
+			stack[ref] = true
+			resolved := p.resolve(target, stack)
+			delete(stack, ref)
+			return resolved
+		}
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[k] = p.resolve(child, stack)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, child := range v {
+			s[i] = p.resolve(child, stack)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// lookup follows a local JSON pointer such as #/components/schemas/Pet
+func (p *specParser) lookup(ref string) (interface{}, bool) {
+	var node interface{} = p.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = m[token]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// schema converts an OpenAPI schema object to JSON Schema: nullable
+// (x-nullable in 2.0) becomes a "null" type
+func schema(node interface{}) json.RawMessage {
+	m, ok := node.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(toJSONSchema(m))
+	return data
+}
+
+func toJSONSchema(node interface{}) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[k] = toJSONSchema(child)
+		}
+		nullable := m["nullable"] == true || m["x-nullable"] == true
+		delete(m, "nullable")
+		if t, ok := m["type"].(string); ok && nullable {
+			m["type"] = []interface{}{t, "null"}
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, child := range v {
+			s[i] = toJSONSchema(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func (p *specParser) info(spec *APISpec) {
+	info, _ := p.root["info"].(map[string]interface{})
+	spec.Title = str(info["title"])
+	spec.Version = str(info["version"])
+}
+
+func (p *specParser) parseOpenAPI3() *APISpec {
+	spec := &APISpec{SpecVersion: str(p.root["openapi"]), Servers: []string{}, Operations: []Operation{}}
+	p.info(spec)
+	if strings.HasPrefix(spec.SpecVersion, "3.1") {
+		p.flag("OpenAPI 3.1 schemas are validated as JSON Schema draft-07")
+	}
+
+	for _, s := range list(p.root["servers"]) {
+		server, _ := s.(map[string]interface{})
+		serverURL := str(server["url"])
+		// Servers with variables are listed with their defaults
+		variables, _ := server["variables"].(map[string]interface{})
+		for name, v := range variables {
+			variable, _ := v.(map[string]interface{})
+			serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", str(variable["default"]))
+		}
+		if serverURL != "" {
+			spec.Servers = append(spec.Servers, serverURL)
+		}
+	}
+
+	components, _ := p.root["components"].(map[string]interface{})
+	schemes, _ := p.resolve(components["securitySchemes"], map[string]bool{}).(map[string]interface{})
+	for name, s := range schemes {
+		scheme, _ := s.(map[string]interface{})
+		if spec.SecuritySchemes == nil {
+			spec.SecuritySchemes = make(map[string]SecurityScheme)
+		}
+		spec.SecuritySchemes[name] = SecurityScheme{
+			Type:   str(scheme["type"]),
+			Scheme: strings.ToLower(str(scheme["scheme"])),
+			In:     str(scheme["in"]),
+			Name:   str(scheme["name"]),
+		}
+	}
+
+	p.eachOperation(func(path, method string, item, op map[string]interface{}) {
+		operation := p.operation(path, method, item, op)
+
+		if body, ok := op["requestBody"].(map[string]interface{}); ok {
+			contentType, media := pickContent(body["content"])
+			operation.RequestBody = &RequestBody{
+				Required:    body["required"] == true,
+				ContentType: contentType,
+				Schema:      schema(media["schema"]),
+			}
+		}
+		responses, _ := op["responses"].(map[string]interface{})
+		for code, r := range responses {
+			response, _ := r.(map[string]interface{})
+			contentType, media := pickContent(response["content"])
+			operation.Responses[code] = Response{
+				Description: str(response["description"]),
+				ContentType: contentType,
+				Schema:      schema(media["schema"]),
+			}
+		}
+		if _, ok := op["callbacks"]; ok {
+			p.flag("callbacks on %s %s", strings.ToUpper(method), path)
+		}
+		if _, ok := op["links"]; ok {
+			p.flag("links on %s %s", strings.ToUpper(method), path)
+		}
+		spec.Operations = append(spec.Operations, operation)
+	})
+	return spec
+}
+
+func (p *specParser) parseSwagger() *APISpec {
+	spec := &APISpec{SpecVersion: "2.0", Servers: []string{}, Operations: []Operation{}}
+	p.info(spec)
+
+	host, basePath := str(p.root["host"]), str(p.root["basePath"])
+	schemes := strings.Fields(strings.Join(strs(p.root["schemes"]), " "))
+	if len(schemes) == 0 {
+		schemes = []string{"https"}
+	}
+	for _, scheme := range schemes {
+		if host == "" {
+			spec.Servers = append(spec.Servers, basePath)
+			break
+		}
+		spec.Servers = append(spec.Servers, scheme+"://"+host+basePath)
+	}
+
+	definitions, _ := p.root["securityDefinitions"].(map[string]interface{})
+	for name, s := range definitions {
+		scheme, _ := s.(map[string]interface{})
+		if spec.SecuritySchemes == nil {
+			spec.SecuritySchemes = make(map[string]SecurityScheme)
+		}
+		converted := SecurityScheme{Type: str(scheme["type"]), In: str(scheme["in"]), Name: str(scheme["name"])}
+		if converted.Type == "basic" {
+			converted = SecurityScheme{Type: "http", Scheme: "basic"}
+		}
+		spec.SecuritySchemes[name] = converted
+	}
+
+	consumes, produces := strs(p.root["consumes"]), strs(p.root["produces"])
+	p.eachOperation(func(path, method string, item, op map[string]interface{}) {
+		operation := p.operation(path, method, item, op)
+		opConsumes, opProduces := consumes, produces
+		if c := strs(op["consumes"]); len(c) > 0 {
+			opConsumes = c
+		}
+		if c := strs(op["produces"]); len(c) > 0 {
+			opProduces = c
+		}
+
+		// Body and form parameters describe the request body in 2.0
+		var kept []Parameter
+		for _, param := range operation.Parameters {
+			switch param.In {
+			case "body":
+				operation.RequestBody = &RequestBody{
+					Required:    param.Required,
+					ContentType: preferJSON(opConsumes),
+					Schema:      param.Schema,
+				}
+			case "formData":
+				p.flag("formData parameters on %s %s", strings.ToUpper(method), path)
+			default:
+				kept = append(kept, param)
+			}
+		}
+		operation.Parameters = kept
+
+		responses, _ := op["responses"].(map[string]interface{})
+		for code, r := range responses {
+			response, _ := r.(map[string]interface{})
+			converted := Response{Description: str(response["description"])}
+			if s := schema(response["schema"]); s != nil {
+				converted.ContentType = preferJSON(opProduces)
+				converted.Schema = s
+			}
+			operation.Responses[code] = converted
+		}
+		spec.Operations = append(spec.Operations, operation)
+	})
+	return spec
+}
+
+// eachOperation calls fn for every operation, sorted by path and method,
+// with path items and operations already resolved
+func (p *specParser) eachOperation(fn func(path, method string, item, op map[string]interface{})) {
+	paths, _ := p.root["paths"].(map[string]interface{})
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		if strings.HasPrefix(path, "x-") {
+			continue
+		}
+		names = append(names, path)
+	}
+	sort.Strings(names)
+
+	for _, path := range names {
+		item, _ := p.resolve(paths[path], map[string]bool{}).(map[string]interface{})
+		for _, method := range httpMethods {
+			if op, ok := item[method].(map[string]interface{}); ok {
+				fn(path, method, item, op)
+			}
+		}
+	}
+}
+
+// operation fills in what OpenAPI 2 and 3 operations have in common
+func (p *specParser) operation(path, method string, item, op map[string]interface{}) Operation {
+	operation := Operation{
+		ID:         str(op["operationId"]),
+		Method:     strings.ToUpper(method),
+		Path:       path,
+		Summary:    str(op["summary"]),
+		Deprecated: op["deprecated"] == true,
+		Responses:  make(map[string]Response),
+	}
+
+	for _, param := range mergedParameters(item, op) {
+		converted := Parameter{
+			Name:     str(param["name"]),
+			In:       str(param["in"]),
+			Required: param["required"] == true || str(param["in"]) == "path",
+			Schema:   schema(param["schema"]),
+		}
+		if converted.Schema == nil {
+			// 2.0 describes non-body parameters inline
+			inline := map[string]interface{}{}
+			for _, key := range []string{"type", "format", "items", "enum", "minimum", "maximum", "pattern"} {
+				if v, ok := param[key]; ok {
+					inline[key] = v
+				}
+			}
+			converted.Schema = schema(inline)
+		}
+		operation.Parameters = append(operation.Parameters, converted)
+	}
+
+	requirements, ok := op["security"]
+	if !ok {
+		requirements = p.root["security"]
+	}
+	for _, r := range list(requirements) {
+		requirement, _ := r.(map[string]interface{})
+		names := make([]string, 0, len(requirement))
+		for name := range requirement {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		operation.Auth = append(operation.Auth, names)
+	}
+	return operation
+}
+
+// mergedParameters returns the path item's parameters overridden by the
+// operation's, matched by name and location
+func mergedParameters(item, op map[string]interface{}) []map[string]interface{} {
+	var merged []map[string]interface{}
+	index := make(map[string]int)
+	for _, source := range []interface{}{item["parameters"], op["parameters"]} {
+		for _, p := range list(source) {
+			param, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := str(param["in"]) + ":" + str(param["name"])
+			if i, ok := index[key]; ok {
+				merged[i] = param
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, param)
+		}
+	}
+	return merged
+}
+
+// pickContent chooses a media type from an OpenAPI 3 content map,
+// preferring JSON
+func pickContent(node interface{}) (string, map[string]interface{}) {
+	content, _ := node.(map[string]interface{})
+	types := make([]string, 0, len(content))
+	for contentType := range content {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+	contentType := preferJSON(types)
+	if contentType == "" {
+		return "", nil
+	}
+	media, _ := content[contentType].(map[string]interface{})
+	return contentType, media
+}
+
+func preferJSON(types []string) string {
+	for _, t := range types {
+		if t == "application/json" {
+			return t
+		}
+	}
+	for _, t := range types {
+		if isJSONContentType(t) {
+			return t
+		}
+	}
+	if len(types) > 0 {
+		return types[0]
+	}
+	return ""
+}
+
+func isJSONContentType(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json") || contentType == "*/*"
+}
+
+func str(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func list(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+func strs(v interface{}) []string {
+	var out []string
+	for _, item := range list(v) {
+		out = append(out, str(item))
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package connectors
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a request would reach an address
+// outside the public internet that hasn't been explicitly allowed
+var ErrForbiddenAddress = errors.New("address is not allowed")
+
+// deniedNetworks are never dialed unless allowed: loopback, private,
+// link-local (including cloud metadata endpoints), CGNAT and other
+// non-public ranges
+var deniedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// ParseNetworks parses a comma separated list of CIDRs
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(list, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// addressGuard decides which IPs outbound requests may reach
+type addressGuard struct {
+	allowed []*net.IPNet
+}
+
+func (g addressGuard) check(ip net.IP) error {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range g.allowed {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	for _, network := range deniedNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("%w: %s is in %s", ErrForbiddenAddress, ip, network)
+		}
+	}
+	return nil
+}
+
+// control runs after name resolution, right before each connection, so
+// the address checked is the one dialed even if DNS changes between
+// lookups or a redirect points elsewhere
+func (g addressGuard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s is not an IP address", ErrForbiddenAddress, host)
+	}
+	return g.check(ip)
+}
+
+// newGuardedClient returns an HTTP client that only connects to allowed
+// addresses, ignores proxy settings and follows at most five redirects
+func newGuardedClient(guard addressGuard, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: guard.control,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			return checkScheme(req.URL.Scheme)
+		},
+	}
+}
+
+func checkScheme(scheme string) error {
+	if scheme != "http" && scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", scheme)
+	}
+	return nil
+}
+
+// isForbidden reports whether err means the guard refused a connection
+func isForbidden(err error) bool {
+	return errors.Is(err, ErrForbiddenAddress)
+}
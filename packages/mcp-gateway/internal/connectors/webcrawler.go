@@ -0,0 +1,595 @@
+package connectors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// CrawlerUserAgent identifies the crawler to sites and their robots.txt
+	CrawlerUserAgent = "QuantumLayerBot/1.0"
+
+	webMaxPageBytes   = 2 << 20
+	webMaxRobotsBytes = 512 << 10
+	webPageTimeout    = 10 * time.Second
+	webCrawlTimeout   = 60 * time.Second
+	webMaxDepth       = 3
+	webDefaultPages   = 20
+	webMaxPages       = 100
+	webMaxFieldValues = 1000
+)
+
+// WebCrawlerConnector crawls and scrapes sites. It honors robots.txt, only
+// visits the domains it is allowed to, and never reaches private,
+// loopback or link-local addresses unless their networks are allowed.
+type WebCrawlerConnector struct {
+	guard addressGuard
+	// domains, when set, are the only domains (and their subdomains) the
+	// crawler may visit
+	domains []string
+}
+
+// NewWebCrawlerConnector creates a crawler limited to the domains in
+// WEB_ALLOWED_DOMAINS, if set, that may additionally reach the networks in
+// WEB_ALLOWED_NETWORKS (both comma separated)
+func NewWebCrawlerConnector() *WebCrawlerConnector {
+	allowed, err := ParseNetworks(os.Getenv("WEB_ALLOWED_NETWORKS"))
+	if err != nil {
+		log.Printf("Warning: ignoring WEB_ALLOWED_NETWORKS: %v", err)
+		allowed = nil
+	}
+	return newWebCrawlerConnector(splitDomains(os.Getenv("WEB_ALLOWED_DOMAINS")), allowed)
+}
+
+func newWebCrawlerConnector(domains []string, allowed []*net.IPNet) *WebCrawlerConnector {
+	return &WebCrawlerConnector{guard: addressGuard{allowed: allowed}, domains: domains}
+}
+
+func splitDomains(list string) []string {
+	var domains []string
+	for _, domain := range strings.Split(list, ",") {
+		if domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), ".")); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// WebError is a request the crawler refused or couldn't complete
+type WebError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *WebError) Error() string {
+	return fmt.Sprintf("web %s: %s", e.Code, e.Message)
+}
+
+// GatewayStatus is the status to answer the gateway's caller with
+func (e *WebError) GatewayStatus() int {
+	return e.Status
+}
+
+func invalidWebInput(format string, args ...interface{}) *WebError {
+	return &WebError{Status: http.StatusBadRequest, Code: "invalid_request", Message: fmt.Sprintf(format, args...)}
+}
+
+// inDomains reports whether host is one of domains or a subdomain of one
+func inDomains(host string, domains []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDomain refuses hosts outside the connector's allowlist
+func (w *WebCrawlerConnector) checkDomain(host string) error {
+	if len(w.domains) > 0 && !inDomains(host, w.domains) {
+		return &WebError{
+			Status:  http.StatusForbidden,
+			Code:    "domain_not_allowed",
+			Message: fmt.Sprintf("%s is not in the allowed domains (%s)", host, strings.Join(w.domains, ", ")),
+		}
+	}
+	return nil
+}
+
+// parseStartURL checks a URL the caller asked for
+func (w *WebCrawlerConnector) parseStartURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, invalidWebInput("url is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return nil, invalidWebInput("invalid url %q", raw)
+	}
+	if err := checkScheme(u.Scheme); err != nil {
+		return nil, invalidWebInput("%v", err)
+	}
+	if err := w.checkDomain(u.Hostname()); err != nil {
+		return nil, err
+	}
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u, nil
+}
+
+// fetchError wraps a failed fetch, singling out ones the address guard
+// refused
+func fetchError(what string, err error) error {
+	if isForbidden(err) {
+		return &WebError{Status: http.StatusForbidden, Code: "forbidden_address", Message: err.Error()}
+	}
+	return &WebError{Status: http.StatusBadGateway, Code: "fetch_failed", Message: fmt.Sprintf("%s: %v", what, err)}
+}
+
+// fetched is a page as it came back
+type fetched struct {
+	url         *url.URL // after redirects
+	status      int
+	contentType string
+	body        []byte
+	truncated   bool
+}
+
+func (f *fetched) isHTML() bool {
+	mediaType, _, _ := mime.ParseMediaType(f.contentType)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// client follows redirects only within the connector's allowed domains
+func (w *WebCrawlerConnector) client(timeout time.Duration) *http.Client {
+	client := newGuardedClient(w.guard, timeout)
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := checkRedirect(req, via); err != nil {
+			return err
+		}
+		return w.checkDomain(req.URL.Hostname())
+	}
+	return client
+}
+
+func (w *WebCrawlerConnector) fetch(ctx context.Context, client *http.Client, u *url.URL, limit int64) (*fetched, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, invalidWebInput("%v", err)
+	}
+	req.Header.Set("User-Agent", CrawlerUserAgent)
+	req.Header.Set("Accept", "text/html, application/xhtml+xml, */*;q=0.5")
+	resp, err := client.Do(req)
+	if err != nil {
+		var webErr *WebError
+		if errors.As(err, &webErr) {
+			return nil, webErr
+		}
+		return nil, fetchError("fetching "+u.String(), err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fetchError("reading "+u.String(), err)
+	}
+	page := &fetched{url: resp.Request.URL, status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), body: body}
+	if int64(len(body)) > limit {
+		page.body, page.truncated = body[:limit], true
+	}
+	return page, nil
+}
+
+// robots loads the robots.txt rules of a URL's origin. A missing or
+// unreadable robots.txt allows everything, as crawlers conventionally
+// treat it; a 401 or 403 disallows everything.
+func (w *WebCrawlerConnector) robots(ctx context.Context, client *http.Client, u *url.URL) *robotsRules {
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	page, err := w.fetch(ctx, client, robotsURL, webMaxRobotsBytes)
+	switch {
+	case err != nil:
+		return nil
+	case page.status == http.StatusUnauthorized || page.status == http.StatusForbidden:
+		return parseRobots(strings.NewReader("User-agent: *\nDisallow: /"), CrawlerUserAgent)
+	case page.status != http.StatusOK:
+		return nil
+	}
+	return parseRobots(strings.NewReader(string(page.body)), CrawlerUserAgent)
+}
+
+type crawlInput struct {
+	URL string `json:"url"`
+	// Depth is how many links away from url to follow; 0 fetches only url
+	Depth    int `json:"depth"`
+	MaxPages int `json:"max_pages"`
+	// AllowedDomains limits which links are followed; it defaults to the
+	// domain of url and must be within the connector's allowed domains
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// CrawlResult is what a crawl found
+type CrawlResult struct {
+	StartURL string        `json:"start_url"`
+	Pages    []CrawledPage `json:"pages"`
+	Skipped  []SkippedURL  `json:"skipped,omitempty"`
+	// Truncated is set when max_pages stopped the crawl
+	Truncated bool `json:"truncated"`
+}
+
+// CrawledPage is one fetched page
+type CrawledPage struct {
+	URL         string        `json:"url"`
+	Depth       int           `json:"depth"`
+	Status      int           `json:"status"`
+	ContentType string        `json:"content_type,omitempty"`
+	Title       string        `json:"title,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Headings    []string      `json:"headings,omitempty"`
+	Links       []string      `json:"links,omitempty"`
+	Forms       []CrawledForm `json:"forms,omitempty"`
+	Images      int           `json:"images"`
+	Truncated   bool          `json:"truncated,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// CrawledForm is a form found on a page
+type CrawledForm struct {
+	Action string   `json:"action"`
+	Method string   `json:"method"`
+	Inputs []string `json:"inputs"`
+}
+
+// SkippedURL is a link the crawl didn't follow
+type SkippedURL struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"` // robots or domain
+}
+
+// CrawlSite fetches a page and, breadth first, the pages it links to up to
+// the requested depth, staying within the allowed domains and honoring
+// robots.txt
+func (w *WebCrawlerConnector) CrawlSite(input json.RawMessage) (interface{}, error) {
+	var in crawlInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil, invalidWebInput("invalid input: %v", err)
+	}
+	start, err := w.parseStartURL(in.URL)
+	if err != nil {
+		return nil, err
+	}
+	if in.Depth < 0 || in.Depth > webMaxDepth {
+		return nil, invalidWebInput("depth must be between 0 and %d", webMaxDepth)
+	}
+	switch {
+	case in.MaxPages < 0:
+		return nil, invalidWebInput("max_pages must not be negative")
+	case in.MaxPages == 0:
+		in.MaxPages = webDefaultPages
+	case in.MaxPages > webMaxPages:
+		in.MaxPages = webMaxPages
+	}
+	domains := splitDomains(strings.Join(in.AllowedDomains, ","))
+	if len(domains) == 0 {
+		domains = []string{strings.ToLower(start.Hostname())}
+	}
+	for _, domain := range domains {
+		if err := w.checkDomain(domain); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webCrawlTimeout)
+	defer cancel()
+	client := w.client(webPageTimeout)
+
+	robots := make(map[string]*robotsRules)
+	allowedByRobots := func(u *url.URL) bool {
+		rules, ok := robots[u.Host]
+		if !ok {
+			rules = w.robots(ctx, client, u)
+			robots[u.Host] = rules
+		}
+		return rules.allowed(u.RequestURI())
+	}
+	if !allowedByRobots(start) {
+		return nil, &WebError{Status: http.StatusForbidden, Code: "robots_disallowed", Message: fmt.Sprintf("robots.txt disallows %s", start)}
+	}
+
+	result := &CrawlResult{StartURL: start.String(), Pages: []CrawledPage{}}
+	type queued struct {
+		url   *url.URL
+		depth int
+	}
+	queue := []queued{{start, 0}}
+	seen := map[string]bool{start.String(): true}
+	for len(queue) > 0 {
+		if len(result.Pages) == in.MaxPages {
+			result.Truncated = true
+			break
+		}
+		next := queue[0]
+		queue = queue[1:]
+
+		page, links, err := w.crawlPage(ctx, client, next.url)
+		if err != nil && next.url == start {
+			return nil, err
+		}
+		page.Depth = next.depth
+		result.Pages = append(result.Pages, page)
+		if next.depth == in.Depth {
+			continue
+		}
+		for _, link := range links {
+			key := link.String()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			switch {
+			case !inDomains(link.Hostname(), domains) || w.checkDomain(link.Hostname()) != nil:
+				result.Skipped = append(result.Skipped, SkippedURL{URL: key, Reason: "domain"})
+			case !allowedByRobots(link):
+				result.Skipped = append(result.Skipped, SkippedURL{URL: key, Reason: "robots"})
+			default:
+				queue = append(queue, queued{link, next.depth + 1})
+			}
+		}
+	}
+	return result, nil
+}
+
+// crawlPage fetches and summarizes one page, returning the http(s) links
+// on it. Failures are also reported on the page, so that a link that can't
+// be fetched doesn't end the crawl.
+func (w *WebCrawlerConnector) crawlPage(ctx context.Context, client *http.Client, u *url.URL) (CrawledPage, []*url.URL, error) {
+	page := CrawledPage{URL: u.String()}
+	f, err := w.fetch(ctx, client, u, webMaxPageBytes)
+	if err != nil {
+		page.Error = err.Error()
+		return page, nil, err
+	}
+	page.Status, page.ContentType, page.Truncated = f.status, f.contentType, f.truncated
+	if !f.isHTML() {
+		return page, nil, nil
+	}
+
+	doc, err := xhtml.Parse(strings.NewReader(string(f.body)))
+	if err != nil {
+		page.Error = "parsing page: " + err.Error()
+		return page, nil, nil
+	}
+	base := f.url
+	var links []*url.URL
+	var walk func(*xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		if n.Type == xhtml.ElementNode {
+			switch n.DataAtom {
+			case atom.Base:
+				if href, err := f.url.Parse(attr(n, "href")); err == nil && attr(n, "href") != "" {
+					base = href
+				}
+			case atom.Title:
+				if page.Title == "" {
+					page.Title = normalizeSpace(textContent(n))
+				}
+			case atom.Meta:
+				if strings.EqualFold(attr(n, "name"), "description") {
+					page.Description = normalizeSpace(attr(n, "content"))
+				}
+			case atom.H1, atom.H2:
+				if heading := normalizeSpace(textContent(n)); heading != "" {
+					page.Headings = append(page.Headings, heading)
+				}
+			case atom.A:
+				if link := resolveLink(base, attr(n, "href")); link != nil {
+					links = append(links, link)
+				}
+			case atom.Img:
+				page.Images++
+			case atom.Form:
+				page.Forms = append(page.Forms, crawledForm(base, n))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	seen := make(map[string]bool)
+	for _, link := range links {
+		if key := link.String(); !seen[key] {
+			seen[key] = true
+			page.Links = append(page.Links, key)
+		}
+	}
+	return page, links, nil
+}
+
+// resolveLink resolves an href against the page, dropping fragments and
+// links that aren't http(s)
+func resolveLink(base *url.URL, href string) *url.URL {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return nil
+	}
+	u, err := base.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	u.Fragment = ""
+	return u
+}
+
+func crawledForm(base *url.URL, n *xhtml.Node) CrawledForm {
+	form := CrawledForm{Action: base.String(), Method: "GET", Inputs: []string{}}
+	if action := attr(n, "action"); action != "" {
+		if u, err := base.Parse(action); err == nil {
+			form.Action = u.String()
+		}
+	}
+	if method := attr(n, "method"); method != "" {
+		form.Method = strings.ToUpper(method)
+	}
+	var walk func(*xhtml.Node)
+	walk = func(c *xhtml.Node) {
+		if c.Type == xhtml.ElementNode && (c.DataAtom == atom.Input || c.DataAtom == atom.Select || c.DataAtom == atom.Textarea) {
+			if name := attr(c, "name"); name != "" {
+				form.Inputs = append(form.Inputs, name)
+			}
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return form
+}
+
+// ExtractField is one value to scrape, selected by CSS or XPath
+type ExtractField struct {
+	Name  string `json:"name"`
+	CSS   string `json:"css,omitempty"`
+	XPath string `json:"xpath,omitempty"`
+	// Attribute reads an attribute of the selected elements instead of
+	// their text
+	Attribute string `json:"attribute,omitempty"`
+	// Multiple returns every match instead of the first
+	Multiple bool `json:"multiple,omitempty"`
+}
+
+type extractInput struct {
+	URL string `json:"url"`
+	// HTML is scraped instead of fetching url
+	HTML   string         `json:"html"`
+	Fields []ExtractField `json:"fields"`
+}
+
+// ExtractResult holds each field's value: a string, or null when nothing
+// matched, or a list for multiple fields
+type ExtractResult struct {
+	URL    string                 `json:"url,omitempty"`
+	Status int                    `json:"status,omitempty"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+// ExtractData applies CSS or XPath selectors to a fetched page or to
+// markup given inline
+func (w *WebCrawlerConnector) ExtractData(input json.RawMessage) (interface{}, error) {
+	var in extractInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil, invalidWebInput("invalid input: %v", err)
+	}
+	if len(in.Fields) == 0 {
+		return nil, invalidWebInput("fields are required")
+	}
+	seen := make(map[string]bool)
+	for i, field := range in.Fields {
+		switch {
+		case field.Name == "":
+			return nil, invalidWebInput("fields[%d] has no name", i)
+		case seen[field.Name]:
+			return nil, invalidWebInput("field %q is given twice", field.Name)
+		case (field.CSS == "") == (field.XPath == ""):
+			return nil, invalidWebInput("field %q needs either css or xpath", field.Name)
+		}
+		seen[field.Name] = true
+	}
+
+	result := &ExtractResult{Data: make(map[string]interface{}, len(in.Fields))}
+	markup := in.HTML
+	if markup == "" {
+		u, err := w.parseStartURL(in.URL)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), webPageTimeout)
+		defer cancel()
+		client := w.client(webPageTimeout)
+		if !w.robots(ctx, client, u).allowed(u.RequestURI()) {
+			return nil, &WebError{Status: http.StatusForbidden, Code: "robots_disallowed", Message: fmt.Sprintf("robots.txt disallows %s", u)}
+		}
+		page, err := w.fetch(ctx, client, u, webMaxPageBytes)
+		if err != nil {
+			return nil, err
+		}
+		if page.status >= 400 {
+			return nil, &WebError{Status: http.StatusBadGateway, Code: "fetch_failed", Message: fmt.Sprintf("fetching %s: status %d", u, page.status)}
+		}
+		result.URL, result.Status, markup = page.url.String(), page.status, string(page.body)
+	}
+
+	doc, err := xhtml.Parse(strings.NewReader(markup))
+	if err != nil {
+		return nil, &WebError{Status: http.StatusUnprocessableEntity, Code: "invalid_html", Message: err.Error()}
+	}
+	for _, field := range in.Fields {
+		values, err := extractField(doc, field)
+		if err != nil {
+			return nil, invalidWebInput("field %q: %v", field.Name, err)
+		}
+		switch {
+		case field.Multiple:
+			result.Data[field.Name] = values
+		case len(values) > 0:
+			result.Data[field.Name] = values[0]
+		default:
+			result.Data[field.Name] = nil
+		}
+	}
+	return result, nil
+}
+
+// extractField returns the values a field selects, in document order
+func extractField(doc *xhtml.Node, field ExtractField) ([]string, error) {
+	var nodes []*xhtml.Node
+	var attribute string
+	var err error
+	if field.CSS != "" {
+		nodes, err = cssSelect(doc, field.CSS)
+	} else {
+		nodes, attribute, err = xpathSelect(doc, field.XPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if field.Attribute != "" {
+		attribute = strings.ToLower(field.Attribute)
+	}
+
+	values := []string{}
+	for _, value := range xpathValues(nodes, attribute) {
+		if len(values) == webMaxFieldValues {
+			break
+		}
+		values = append(values, normalizeSpace(value))
+	}
+	return values, nil
+}
+
+// Screenshot would need a headless browser, which the gateway doesn't run
+func (w *WebCrawlerConnector) Screenshot(input json.RawMessage) (interface{}, error) {
+	return nil, &WebError{
+		Status:  http.StatusNotImplemented,
+		Code:    "not_implemented",
+		Message: "screenshots need a headless browser, which this gateway doesn't run",
+	}
+}
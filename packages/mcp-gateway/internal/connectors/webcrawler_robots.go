@@ -0,0 +1,108 @@
+package connectors
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// robotsRules are the Allow and Disallow lines of the robots.txt group
+// that applies to the crawler
+type robotsRules struct {
+	rules []robotsRule
+}
+
+type robotsRule struct {
+	allow   bool
+	length  int // of the path as written; longer rules win
+	pattern *regexp.Regexp
+}
+
+// parseRobots reads the group of a robots.txt for userAgent, falling back
+// to the * group. Groups naming several agents share their rules.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	userAgent = strings.ToLower(userAgent)
+	var specific, wildcard []robotsRule
+	var agents []string
+	inRules := false
+	var current []robotsRule
+	flush := func() {
+		for _, agent := range agents {
+			switch {
+			case agent == "*":
+				wildcard = append(wildcard, current...)
+			case strings.Contains(userAgent, agent):
+				specific = append(specific, current...)
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if inRules {
+				flush()
+				agents, current, inRules = nil, nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			// An empty Disallow allows everything
+			if value == "" {
+				continue
+			}
+			current = append(current, robotsRule{allow: key == "allow", length: len(value), pattern: robotsPattern(value)})
+		}
+	}
+	flush()
+
+	if len(specific) > 0 {
+		return &robotsRules{rules: specific}
+	}
+	return &robotsRules{rules: wildcard}
+}
+
+// robotsPattern compiles a robots.txt path, where * matches any run of
+// characters and a trailing $ anchors the end
+func robotsPattern(path string) *regexp.Regexp {
+	anchored := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+	parts := strings.Split(path, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed reports whether the crawler may fetch path (with its query).
+// The longest matching rule decides; Allow wins a tie.
+func (r *robotsRules) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > longest || rule.length == longest && rule.allow {
+			allowed, longest = rule.allow, rule.length
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,1115 @@
+package connectors
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Selectors cover what scraping uses. CSS: type, universal, #id, .class
+// and attribute selectors ([a], =, ~=, |=, ^=, $=, *=), :first-child,
+// :last-child, :only-child and :nth-child(an+b), with descendant, child
+// and sibling combinators and comma groups. XPath 1.0: location paths on
+// the child, descendant, parent, self, ancestor, sibling and attribute
+// axes with the usual abbreviations, and predicates comparing paths,
+// strings and numbers, combined with and/or, using position(), last(),
+// count(), not(), contains(), starts-with(), normalize-space() and
+// string-length().
+
+// normalizeSpace collapses runs of whitespace and trims the ends
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func lookupAttr(n *xhtml.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// nodeValue is a node's string value: the text of an element or the data
+// of a text node
+func nodeValue(n *xhtml.Node) string {
+	if n.Type == xhtml.ElementNode || n.Type == xhtml.DocumentNode {
+		return textContent(n)
+	}
+	return n.Data
+}
+
+func previousElement(n *xhtml.Node) *xhtml.Node {
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == xhtml.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+// elementPosition is n's 1-based position among its parent's elements,
+// and how many there are
+func elementPosition(n *xhtml.Node) (position, count int) {
+	if n.Parent == nil {
+		return 1, 1
+	}
+	for s := n.Parent.FirstChild; s != nil; s = s.NextSibling {
+		if s.Type != xhtml.ElementNode {
+			continue
+		}
+		count++
+		if s == n {
+			position = count
+		}
+	}
+	return position, count
+}
+
+// CSS
+
+type cssSelector []cssComplex
+
+// cssComplex is compound selectors joined by combinators: combinators[i]
+// (' ', '>', '+' or '~') joins parts[i] and parts[i+1]
+type cssComplex struct {
+	parts       []cssCompound
+	combinators []byte
+}
+
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []cssAttr
+	pseudos []cssPseudo
+}
+
+type cssAttr struct {
+	name, op, value string
+}
+
+// cssPseudo is a structural pseudo-class as an+b: the element's position
+// counted from the start, or from the end when fromEnd is set
+type cssPseudo struct {
+	a, b    int
+	fromEnd bool
+	only    bool
+}
+
+type cssParser struct {
+	s   string
+	pos int
+}
+
+// parseCSS parses a selector group
+func parseCSS(s string) (cssSelector, error) {
+	p := &cssParser{s: s}
+	var sel cssSelector
+	for {
+		c, err := p.complex()
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, c)
+		p.skipSpace()
+		if p.pos >= len(p.s) {
+			return sel, nil
+		}
+		if p.s[p.pos] != ',' {
+			return nil, p.errorf("unexpected %q", p.s[p.pos])
+		}
+		p.pos++
+	}
+}
+
+func (p *cssParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("css selector %q at %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *cssParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t\n\r\f", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *cssParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func isNameByte(c byte) bool {
+	return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func (p *cssParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.s) && isNameByte(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *cssParser) complex() (cssComplex, error) {
+	var c cssComplex
+	p.skipSpace()
+	compound, err := p.compound()
+	if err != nil {
+		return c, err
+	}
+	c.parts = append(c.parts, compound)
+	for {
+		spaced := p.skipSpace()
+		next := p.peek()
+		if next == 0 || next == ',' {
+			return c, nil
+		}
+		combinator := byte(' ')
+		switch next {
+		case '>', '+', '~':
+			combinator = next
+			p.pos++
+			p.skipSpace()
+		default:
+			if !spaced {
+				return c, p.errorf("unexpected %q", next)
+			}
+		}
+		compound, err := p.compound()
+		if err != nil {
+			return c, err
+		}
+		c.parts = append(c.parts, compound)
+		c.combinators = append(c.combinators, combinator)
+	}
+}
+
+func (p *cssParser) compound() (cssCompound, error) {
+	var c cssCompound
+	start := p.pos
+	if p.peek() == '*' {
+		c.tag = "*"
+		p.pos++
+	} else if name := p.ident(); name != "" {
+		c.tag = strings.ToLower(name)
+	}
+
+	for {
+		switch p.peek() {
+		case '#':
+			p.pos++
+			if c.id = p.ident(); c.id == "" {
+				return c, p.errorf("expected an id")
+			}
+		case '.':
+			p.pos++
+			class := p.ident()
+			if class == "" {
+				return c, p.errorf("expected a class")
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			attr, err := p.attribute()
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, attr)
+		case ':':
+			pseudo, err := p.pseudo()
+			if err != nil {
+				return c, err
+			}
+			c.pseudos = append(c.pseudos, pseudo)
+		default:
+			if p.pos == start {
+				return c, p.errorf("expected a selector")
+			}
+			return c, nil
+		}
+	}
+}
+
+func (p *cssParser) attribute() (cssAttr, error) {
+	var a cssAttr
+	p.pos++ // [
+	p.skipSpace()
+	if a.name = strings.ToLower(p.ident()); a.name == "" {
+		return a, p.errorf("expected an attribute name")
+	}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return a, nil
+	}
+	if c := p.peek(); strings.IndexByte("~|^$*", c) >= 0 {
+		a.op = string(c)
+		p.pos++
+	}
+	if p.peek() != '=' {
+		return a, p.errorf("expected = in attribute selector")
+	}
+	a.op += "="
+	p.pos++
+	p.skipSpace()
+
+	if quote := p.peek(); quote == '"' || quote == '\'' {
+		end := strings.IndexByte(p.s[p.pos+1:], quote)
+		if end < 0 {
+			return a, p.errorf("unterminated string")
+		}
+		a.value = p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+	} else if a.value = p.ident(); a.value == "" {
+		return a, p.errorf("expected an attribute value")
+	}
+	p.skipSpace()
+	if p.peek() != ']' {
+		return a, p.errorf("expected ]")
+	}
+	p.pos++
+	return a, nil
+}
+
+func (p *cssParser) pseudo() (cssPseudo, error) {
+	p.pos++ // :
+	name := strings.ToLower(p.ident())
+	switch name {
+	case "first-child":
+		return cssPseudo{b: 1}, nil
+	case "last-child":
+		return cssPseudo{b: 1, fromEnd: true}, nil
+	case "only-child":
+		return cssPseudo{only: true}, nil
+	case "nth-child", "nth-last-child":
+		if p.peek() != '(' {
+			return cssPseudo{}, p.errorf("expected ( after :%s", name)
+		}
+		end := strings.IndexByte(p.s[p.pos:], ')')
+		if end < 0 {
+			return cssPseudo{}, p.errorf("unterminated :%s", name)
+		}
+		a, b, err := parseNth(p.s[p.pos+1 : p.pos+end])
+		if err != nil {
+			return cssPseudo{}, p.errorf("%v", err)
+		}
+		p.pos += end + 1
+		return cssPseudo{a: a, b: b, fromEnd: name == "nth-last-child"}, nil
+	}
+	return cssPseudo{}, p.errorf("unsupported pseudo-class :%s", name)
+}
+
+// parseNth parses an+b, odd or even
+func parseNth(expr string) (a, b int, err error) {
+	expr = strings.ToLower(strings.ReplaceAll(expr, " ", ""))
+	switch expr {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+	aPart, bPart, hasN := strings.Cut(expr, "n")
+	if !hasN {
+		b, err = strconv.Atoi(expr)
+		return 0, b, err
+	}
+	switch aPart {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		if a, err = strconv.Atoi(aPart); err != nil {
+			return 0, 0, fmt.Errorf("invalid nth expression %q", expr)
+		}
+	}
+	if bPart != "" {
+		if b, err = strconv.Atoi(bPart); err != nil {
+			return 0, 0, fmt.Errorf("invalid nth expression %q", expr)
+		}
+	}
+	return a, b, nil
+}
+
+func (ps cssPseudo) matches(n *xhtml.Node) bool {
+	position, count := elementPosition(n)
+	if ps.only {
+		return count == 1
+	}
+	if ps.fromEnd {
+		position = count - position + 1
+	}
+	if ps.a == 0 {
+		return position == ps.b
+	}
+	diff := position - ps.b
+	return diff/ps.a >= 0 && diff%ps.a == 0
+}
+
+func (a cssAttr) matches(n *xhtml.Node) bool {
+	value, ok := lookupAttr(n, a.name)
+	if !ok {
+		return false
+	}
+	switch a.op {
+	case "=":
+		return value == a.value
+	case "~=":
+		for _, word := range strings.Fields(value) {
+			if word == a.value {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return value == a.value || strings.HasPrefix(value, a.value+"-")
+	case "^=":
+		return a.value != "" && strings.HasPrefix(value, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(value, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(value, a.value)
+	}
+	return true
+}
+
+func (c cssCompound) matches(n *xhtml.Node) bool {
+	if n.Type != xhtml.ElementNode {
+		return false
+	}
+	if c.tag != "" && c.tag != "*" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" && attr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(attr(n, "class"))
+		for _, want := range c.classes {
+			found := false
+			for _, class := range classes {
+				found = found || class == want
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.matches(n) {
+			return false
+		}
+	}
+	for _, ps := range c.pseudos {
+		if !ps.matches(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAt reports whether n matches the complex selector up to parts[i]
+func (c cssComplex) matchAt(n *xhtml.Node, i int) bool {
+	if !c.parts[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch c.combinators[i-1] {
+	case '>':
+		return n.Parent != nil && c.matchAt(n.Parent, i-1)
+	case '+':
+		prev := previousElement(n)
+		return prev != nil && c.matchAt(prev, i-1)
+	case '~':
+		for s := previousElement(n); s != nil; s = previousElement(s) {
+			if c.matchAt(s, i-1) {
+				return true
+			}
+		}
+		return false
+	default:
+		for a := n.Parent; a != nil; a = a.Parent {
+			if c.matchAt(a, i-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// cssSelect returns the elements under root matching selector, in
+// document order
+func cssSelect(root *xhtml.Node, selector string) ([]*xhtml.Node, error) {
+	sel, err := parseCSS(selector)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*xhtml.Node
+	var walk func(*xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		for _, c := range sel {
+			if c.matchAt(n, len(c.parts)-1) {
+				matches = append(matches, n)
+				break
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for child := root.FirstChild; child != nil; child = child.NextSibling {
+		walk(child)
+	}
+	return matches, nil
+}
+
+// XPath
+
+type xpathToken struct {
+	kind byte // n name, s string, # number, o operator or punctuation
+	text string
+}
+
+func lexXPath(s string) ([]xpathToken, error) {
+	var tokens []xpathToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("xpath %q: unterminated string", s)
+			}
+			tokens = append(tokens, xpathToken{'s', s[i+1 : i+1+end]})
+			i += end + 2
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			start := i
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, xpathToken{'#', s[start:i]})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+			start := i
+			for i < len(s) && (isNameByte(s[i]) || s[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, xpathToken{'n', s[start:i]})
+		default:
+			op := string(c)
+			for _, two := range []string{"//", "::", "..", "!=", "<=", ">="} {
+				if strings.HasPrefix(s[i:], two) {
+					op = two
+					break
+				}
+			}
+			if !xpathOperators[op] {
+				return nil, fmt.Errorf("xpath %q: unexpected %q", s, c)
+			}
+			tokens = append(tokens, xpathToken{'o', op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+var xpathOperators = map[string]bool{
+	"/": true, "//": true, "::": true, ".": true, "..": true, "[": true, "]": true, "(": true, ")": true,
+	"@": true, ",": true, "*": true, "=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+type xpathStep struct {
+	axis  string
+	test  string // element name, *, text() or node(); the name or * on the attribute axis
+	preds []xpathExpr
+}
+
+type xpathPath struct {
+	absolute bool
+	steps    []xpathStep
+}
+
+// xpathExpr is a predicate expression. It evaluates to a bool, float64,
+// string or, for paths, the []string values of the nodes selected.
+type xpathExpr interface {
+	eval(ctx *xpathContext) interface{}
+}
+
+type xpathContext struct {
+	node           *xhtml.Node
+	position, size int
+	order          map[*xhtml.Node]int
+}
+
+type xpathLiteral struct{ value interface{} }
+
+type xpathPathExpr struct{ path xpathPath }
+
+type xpathCall struct {
+	name string
+	args []xpathExpr
+}
+
+type xpathBinary struct {
+	op          string
+	left, right xpathExpr
+}
+
+type xpathParser struct {
+	expr   string
+	tokens []xpathToken
+	pos    int
+}
+
+func (p *xpathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("xpath %q: %s", p.expr, fmt.Sprintf(format, args...))
+}
+
+func (p *xpathParser) peek() xpathToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return xpathToken{}
+}
+
+func (p *xpathParser) peekOp(op string) bool {
+	t := p.peek()
+	return t.kind == 'o' && t.text == op
+}
+
+func (p *xpathParser) expect(op string) error {
+	if !p.peekOp(op) {
+		return p.errorf("expected %s", op)
+	}
+	p.pos++
+	return nil
+}
+
+// parseXPath parses a location path
+func parseXPath(expr string) (xpathPath, error) {
+	tokens, err := lexXPath(expr)
+	if err != nil {
+		return xpathPath{}, err
+	}
+	p := &xpathParser{expr: expr, tokens: tokens}
+	path, err := p.path()
+	if err != nil {
+		return path, err
+	}
+	if p.pos < len(p.tokens) {
+		return path, p.errorf("unexpected %q", p.peek().text)
+	}
+	for i, step := range path.steps {
+		if step.axis == "attribute" && i != len(path.steps)-1 {
+			return path, p.errorf("attribute steps must come last")
+		}
+	}
+	return path, nil
+}
+
+var descendantOrSelf = xpathStep{axis: "descendant-or-self", test: "node()"}
+
+func (p *xpathParser) path() (xpathPath, error) {
+	var path xpathPath
+	switch {
+	case p.peekOp("/"):
+		p.pos++
+		path.absolute = true
+		if !p.startsStep() {
+			return path, nil
+		}
+	case p.peekOp("//"):
+		p.pos++
+		path.absolute = true
+		path.steps = append(path.steps, descendantOrSelf)
+	}
+	for {
+		step, err := p.step()
+		if err != nil {
+			return path, err
+		}
+		path.steps = append(path.steps, step)
+		switch {
+		case p.peekOp("/"):
+			p.pos++
+		case p.peekOp("//"):
+			p.pos++
+			path.steps = append(path.steps, descendantOrSelf)
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *xpathParser) startsStep() bool {
+	t := p.peek()
+	return t.kind == 'n' || t.kind == 'o' && (t.text == "*" || t.text == "@" || t.text == "." || t.text == "..")
+}
+
+var xpathAxes = map[string]bool{
+	"child": true, "descendant": true, "descendant-or-self": true, "self": true, "parent": true,
+	"ancestor": true, "following-sibling": true, "preceding-sibling": true, "attribute": true,
+}
+
+func (p *xpathParser) step() (xpathStep, error) {
+	step := xpathStep{axis: "child"}
+	switch t := p.peek(); {
+	case t.kind == 'o' && t.text == ".":
+		p.pos++
+		return xpathStep{axis: "self", test: "node()"}, nil
+	case t.kind == 'o' && t.text == "..":
+		p.pos++
+		return xpathStep{axis: "parent", test: "node()"}, nil
+	case t.kind == 'o' && t.text == "@":
+		p.pos++
+		step.axis = "attribute"
+	case t.kind == 'n' && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "::":
+		if !xpathAxes[t.text] {
+			return step, p.errorf("unsupported axis %s", t.text)
+		}
+		step.axis = t.text
+		p.pos += 2
+	}
+
+	switch t := p.peek(); {
+	case t.kind == 'o' && t.text == "*":
+		step.test = "*"
+		p.pos++
+	case t.kind == 'n':
+		step.test = strings.ToLower(t.text)
+		p.pos++
+		if p.peekOp("(") {
+			if step.test != "text" && step.test != "node" {
+				return step, p.errorf("unsupported node test %s()", t.text)
+			}
+			p.pos++
+			if err := p.expect(")"); err != nil {
+				return step, err
+			}
+			step.test += "()"
+		}
+	default:
+		return step, p.errorf("expected a node test")
+	}
+	if step.axis == "attribute" && strings.HasSuffix(step.test, "()") {
+		return step, p.errorf("expected an attribute name")
+	}
+
+	for p.peekOp("[") {
+		p.pos++
+		pred, err := p.or()
+		if err != nil {
+			return step, err
+		}
+		if err := p.expect("]"); err != nil {
+			return step, err
+		}
+		step.preds = append(step.preds, pred)
+	}
+	return step, nil
+}
+
+func (p *xpathParser) or() (xpathExpr, error) {
+	left, err := p.and()
+	for err == nil && p.peek().kind == 'n' && p.peek().text == "or" {
+		p.pos++
+		var right xpathExpr
+		right, err = p.and()
+		left = xpathBinary{op: "or", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *xpathParser) and() (xpathExpr, error) {
+	left, err := p.comparison()
+	for err == nil && p.peek().kind == 'n' && p.peek().text == "and" {
+		p.pos++
+		var right xpathExpr
+		right, err = p.comparison()
+		left = xpathBinary{op: "and", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *xpathParser) comparison() (xpathExpr, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "!=", "<", "<=", ">", ">="} {
+		if p.peekOp(op) {
+			p.pos++
+			right, err := p.primary()
+			return xpathBinary{op: op, left: left, right: right}, err
+		}
+	}
+	return left, nil
+}
+
+var xpathFunctions = map[string]bool{
+	"position": true, "last": true, "count": true, "not": true, "contains": true,
+	"starts-with": true, "normalize-space": true, "string-length": true,
+}
+
+func (p *xpathParser) primary() (xpathExpr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == 's':
+		p.pos++
+		return xpathLiteral{t.text}, nil
+	case t.kind == '#':
+		p.pos++
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", t.text)
+		}
+		return xpathLiteral{n}, nil
+	case t.kind == 'o' && t.text == "(":
+		p.pos++
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case t.kind == 'n' && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "(" && t.text != "text" && t.text != "node":
+		if !xpathFunctions[t.text] {
+			return nil, p.errorf("unsupported function %s()", t.text)
+		}
+		p.pos += 2
+		call := xpathCall{name: t.text}
+		for !p.peekOp(")") {
+			if len(call.args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+		}
+		p.pos++
+		return call, nil
+	}
+	path, err := p.path()
+	return xpathPathExpr{path}, err
+}
+
+func (e xpathLiteral) eval(*xpathContext) interface{} { return e.value }
+
+func (e xpathPathExpr) eval(ctx *xpathContext) interface{} {
+	nodes, attribute := evalXPath(e.path, []*xhtml.Node{ctx.node}, ctx.order)
+	return xpathValues(nodes, attribute)
+}
+
+func (e xpathCall) eval(ctx *xpathContext) interface{} {
+	arg := func(i int) interface{} {
+		if i < len(e.args) {
+			return e.args[i].eval(ctx)
+		}
+		return nodeValue(ctx.node)
+	}
+	switch e.name {
+	case "position":
+		return float64(ctx.position)
+	case "last":
+		return float64(ctx.size)
+	case "count":
+		values, _ := arg(0).([]string)
+		return float64(len(values))
+	case "not":
+		return !xpathBool(arg(0))
+	case "contains":
+		return strings.Contains(xpathString(arg(0)), xpathString(arg(1)))
+	case "starts-with":
+		return strings.HasPrefix(xpathString(arg(0)), xpathString(arg(1)))
+	case "normalize-space":
+		return normalizeSpace(xpathString(arg(0)))
+	case "string-length":
+		return float64(len([]rune(xpathString(arg(0)))))
+	}
+	return false
+}
+
+func (e xpathBinary) eval(ctx *xpathContext) interface{} {
+	switch e.op {
+	case "or":
+		return xpathBool(e.left.eval(ctx)) || xpathBool(e.right.eval(ctx))
+	case "and":
+		return xpathBool(e.left.eval(ctx)) && xpathBool(e.right.eval(ctx))
+	}
+	return xpathCompare(e.op, e.left.eval(ctx), e.right.eval(ctx))
+}
+
+func xpathBool(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case []string:
+		return len(v) > 0
+	}
+	return false
+}
+
+func xpathString(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+func xpathNumber(v interface{}) float64 {
+	if n, ok := v.(float64); ok {
+		return n
+	}
+	if b, ok := v.(bool); ok {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(xpathString(v)), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return n
+}
+
+// xpathCompare compares two values; a node set compares true if any of its
+// nodes does
+func xpathCompare(op string, left, right interface{}) bool {
+	if values, ok := left.([]string); ok {
+		for _, v := range values {
+			if xpathCompare(op, v, right) {
+				return true
+			}
+		}
+		return false
+	}
+	if values, ok := right.([]string); ok {
+		for _, v := range values {
+			if xpathCompare(op, left, v) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if op == "=" || op == "!=" {
+		var equal bool
+		_, leftBool := left.(bool)
+		_, rightBool := right.(bool)
+		_, leftNumber := left.(float64)
+		_, rightNumber := right.(float64)
+		switch {
+		case leftBool || rightBool:
+			equal = xpathBool(left) == xpathBool(right)
+		case leftNumber || rightNumber:
+			equal = xpathNumber(left) == xpathNumber(right)
+		default:
+			equal = xpathString(left) == xpathString(right)
+		}
+		return equal == (op == "=")
+	}
+
+	l, r := xpathNumber(left), xpathNumber(right)
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
+
+// xpathValues are the string values of the nodes a path selected, or of
+// their attribute when it ended on the attribute axis
+func xpathValues(nodes []*xhtml.Node, attribute string) []string {
+	values := []string{}
+	for _, n := range nodes {
+		if attribute == "" {
+			values = append(values, nodeValue(n))
+			continue
+		}
+		if attribute == "*" {
+			for _, a := range n.Attr {
+				values = append(values, a.Val)
+			}
+			continue
+		}
+		if value, ok := lookupAttr(n, attribute); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// axisNodes lists the nodes on an axis from n, nearest first for the
+// reverse axes as XPath positions count them
+func axisNodes(n *xhtml.Node, axis string) []*xhtml.Node {
+	var nodes []*xhtml.Node
+	var descend func(*xhtml.Node)
+	descend = func(n *xhtml.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			nodes = append(nodes, c)
+			descend(c)
+		}
+	}
+	switch axis {
+	case "child":
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			nodes = append(nodes, c)
+		}
+	case "descendant":
+		descend(n)
+	case "descendant-or-self":
+		nodes = append(nodes, n)
+		descend(n)
+	case "self", "attribute":
+		nodes = append(nodes, n)
+	case "parent":
+		if n.Parent != nil {
+			nodes = append(nodes, n.Parent)
+		}
+	case "ancestor":
+		for a := n.Parent; a != nil; a = a.Parent {
+			nodes = append(nodes, a)
+		}
+	case "following-sibling":
+		for s := n.NextSibling; s != nil; s = s.NextSibling {
+			nodes = append(nodes, s)
+		}
+	case "preceding-sibling":
+		for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+			nodes = append(nodes, s)
+		}
+	}
+	return nodes
+}
+
+// accepts reports whether n passes the step's node test
+func (s xpathStep) accepts(n *xhtml.Node) bool {
+	switch s.test {
+	case "node()":
+		return n.Type != xhtml.DoctypeNode
+	case "text()":
+		return n.Type == xhtml.TextNode
+	case "*":
+		return n.Type == xhtml.ElementNode
+	}
+	return n.Type == xhtml.ElementNode && n.Data == s.test
+}
+
+// evalXPath applies a path to context nodes. It returns the selected nodes
+// in document order and, if the path ended on the attribute axis, the
+// attribute to read from them.
+func evalXPath(path xpathPath, context []*xhtml.Node, order map[*xhtml.Node]int) ([]*xhtml.Node, string) {
+	nodes := context
+	if path.absolute && len(context) > 0 {
+		root := context[0]
+		for root.Parent != nil {
+			root = root.Parent
+		}
+		nodes = []*xhtml.Node{root}
+	}
+
+	for _, step := range path.steps {
+		if step.axis == "attribute" {
+			var withAttribute []*xhtml.Node
+			for _, n := range nodes {
+				if _, ok := lookupAttr(n, step.test); n.Type == xhtml.ElementNode && (ok || step.test == "*" && len(n.Attr) > 0) {
+					withAttribute = append(withAttribute, n)
+				}
+			}
+			return withAttribute, step.test
+		}
+
+		seen := make(map[*xhtml.Node]bool)
+		var next []*xhtml.Node
+		for _, n := range nodes {
+			var candidates []*xhtml.Node
+			for _, c := range axisNodes(n, step.axis) {
+				if step.accepts(c) {
+					candidates = append(candidates, c)
+				}
+			}
+			for _, pred := range step.preds {
+				var kept []*xhtml.Node
+				for i, c := range candidates {
+					ctx := &xpathContext{node: c, position: i + 1, size: len(candidates), order: order}
+					result := pred.eval(ctx)
+					if number, ok := result.(float64); ok {
+						if number == float64(i+1) {
+							kept = append(kept, c)
+						}
+					} else if xpathBool(result) {
+						kept = append(kept, c)
+					}
+				}
+				candidates = kept
+			}
+			for _, c := range candidates {
+				if !seen[c] {
+					seen[c] = true
+					next = append(next, c)
+				}
+			}
+		}
+		sort.SliceStable(next, func(i, j int) bool { return order[next[i]] < order[next[j]] })
+		nodes = next
+	}
+	return nodes, ""
+}
+
+// documentOrder numbers every node under root in document order
+func documentOrder(root *xhtml.Node) map[*xhtml.Node]int {
+	order := make(map[*xhtml.Node]int)
+	var walk func(*xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		order[n] = len(order)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return order
+}
+
+// xpathSelect evaluates a location path against a document. See
+// evalXPath for what it returns.
+func xpathSelect(doc *xhtml.Node, expr string) ([]*xhtml.Node, string, error) {
+	path, err := parseXPath(expr)
+	if err != nil {
+		return nil, "", err
+	}
+	nodes, attribute := evalXPath(path, []*xhtml.Node{doc}, documentOrder(doc))
+	return nodes, attribute, nil
+}
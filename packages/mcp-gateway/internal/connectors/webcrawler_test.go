@@ -0,0 +1,336 @@
+package connectors
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testCrawler reaches httptest servers, limited to domains if any
+func testCrawler(t *testing.T, domains ...string) *WebCrawlerConnector {
+	networks, err := ParseNetworks("127.0.0.0/8, ::1/128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newWebCrawlerConnector(domains, networks)
+}
+
+// testSite serves a small site: / links to /a and /private/secret, /a
+// links to /b, /b links to /c, and robots.txt disallows /private/
+func testSite(t *testing.T) (*httptest.Server, map[string]int) {
+	hits := make(map[string]int)
+	pages := map[string]string{
+		"/": `<html><head><title>Home</title><meta name="description" content="The  home page"></head>
+<body><h1>Welcome</h1><a href="/a">A</a><a href="/a#top">A again</a><a href="/private/secret">Secret</a>
+<a href="http://localhost/elsewhere">Elsewhere</a><a href="mailto:x@example.com">Mail</a>
+<form action="/search" method="post"><input name="q"><select name="sort"></select></form><img src="/logo.png"></body></html>`,
+		"/a":              `<html><head><title>A</title></head><body><h2>Section A</h2><a href="b">B</a></body></html>`,
+		"/b":              `<html><head><title>B</title></head><body><a href="/c">C</a></body></html>`,
+		"/c":              `<html><head><title>C</title></head><body></body></html>`,
+		"/private/secret": `<html><head><title>Secret</title></head></html>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		if r.UserAgent() != CrawlerUserAgent {
+			t.Errorf("User-Agent = %q", r.UserAgent())
+		}
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, hits
+}
+
+func crawledURLs(result *CrawlResult) []string {
+	var urls []string
+	for _, page := range result.Pages {
+		u, _ := url.Parse(page.URL)
+		urls = append(urls, u.Path)
+	}
+	return urls
+}
+
+func TestCrawlSiteDepth(t *testing.T) {
+	srv, hits := testSite(t)
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"/"}},
+		{1, []string{"/", "/a"}},
+		{3, []string{"/", "/a", "/b", "/c"}},
+	}
+	for _, tt := range tests {
+		result, err := testCrawler(t).CrawlSite(testInput(t, map[string]interface{}{"url": srv.URL, "depth": tt.depth}))
+		if err != nil {
+			t.Fatalf("depth %d: %v", tt.depth, err)
+		}
+		if got := crawledURLs(result.(*CrawlResult)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("depth %d crawled %v, want %v", tt.depth, got, tt.want)
+		}
+	}
+	if hits["/private/secret"] != 0 {
+		t.Error("the crawler fetched a page robots.txt disallows")
+	}
+}
+
+func TestCrawlSitePages(t *testing.T) {
+	srv, _ := testSite(t)
+	result, err := testCrawler(t).CrawlSite(testInput(t, map[string]interface{}{"url": srv.URL, "depth": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawl := result.(*CrawlResult)
+	home := crawl.Pages[0]
+	if home.Status != http.StatusOK || home.Title != "Home" || home.Description != "The home page" || home.Images != 1 {
+		t.Errorf("home = %+v", home)
+	}
+	if !reflect.DeepEqual(home.Headings, []string{"Welcome"}) {
+		t.Errorf("headings = %v", home.Headings)
+	}
+	wantLinks := []string{srv.URL + "/a", srv.URL + "/private/secret", "http://localhost/elsewhere"}
+	if !reflect.DeepEqual(home.Links, wantLinks) {
+		t.Errorf("links = %v, want %v", home.Links, wantLinks)
+	}
+	if len(home.Forms) != 1 || home.Forms[0].Action != srv.URL+"/search" || home.Forms[0].Method != "POST" || !reflect.DeepEqual(home.Forms[0].Inputs, []string{"q", "sort"}) {
+		t.Errorf("forms = %+v", home.Forms)
+	}
+
+	wantSkipped := []SkippedURL{
+		{URL: srv.URL + "/private/secret", Reason: "robots"},
+		{URL: "http://localhost/elsewhere", Reason: "domain"},
+	}
+	if !reflect.DeepEqual(crawl.Skipped, wantSkipped) {
+		t.Errorf("skipped = %+v, want %+v", crawl.Skipped, wantSkipped)
+	}
+}
+
+func TestCrawlSiteMaxPages(t *testing.T) {
+	srv, _ := testSite(t)
+	result, err := testCrawler(t).CrawlSite(testInput(t, map[string]interface{}{"url": srv.URL, "depth": 3, "max_pages": 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crawl := result.(*CrawlResult); len(crawl.Pages) != 2 || !crawl.Truncated {
+		t.Errorf("crawled %v (truncated %v), want 2 pages and truncated", crawledURLs(crawl), crawl.Truncated)
+	}
+}
+
+func TestCrawlSiteRefusals(t *testing.T) {
+	srv, hits := testSite(t)
+	tests := []struct {
+		name    string
+		crawler *WebCrawlerConnector
+		input   map[string]interface{}
+		status  int
+		code    string
+	}{
+		{"outside allowlist", testCrawler(t, "example.com"), map[string]interface{}{"url": srv.URL}, http.StatusForbidden, "domain_not_allowed"},
+		{"follows outside allowlist", testCrawler(t, "127.0.0.1"), map[string]interface{}{"url": srv.URL, "allowed_domains": []string{"example.com"}}, http.StatusForbidden, "domain_not_allowed"},
+		{"robots", testCrawler(t), map[string]interface{}{"url": srv.URL + "/private/secret"}, http.StatusForbidden, "robots_disallowed"},
+		{"private address", newWebCrawlerConnector(nil, nil), map[string]interface{}{"url": srv.URL}, http.StatusForbidden, "forbidden_address"},
+		{"too deep", testCrawler(t), map[string]interface{}{"url": srv.URL, "depth": 4}, http.StatusBadRequest, "invalid_request"},
+		{"not http", testCrawler(t), map[string]interface{}{"url": "file:///etc/passwd"}, http.StatusBadRequest, "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.crawler.CrawlSite(testInput(t, tt.input))
+			var webErr *WebError
+			if !errors.As(err, &webErr) || webErr.GatewayStatus() != tt.status || webErr.Code != tt.code {
+				t.Errorf("err = %v, want %d %s", err, tt.status, tt.code)
+			}
+		})
+	}
+	if hits["/private/secret"] != 0 {
+		t.Error("the crawler fetched a page robots.txt disallows")
+	}
+}
+
+const productsPage = `<html><body>
+<h1 class="title main">Products</h1>
+<ul id="products">
+  <li class="product" data-sku="A1"><a href="/p/1">Widget</a> <span class="price">$5</span></li>
+  <li class="product sale" data-sku="B2"><a href="/p/2">Gadget</a> <span class="price">$7</span></li>
+  <li class="product" data-sku="C3"><a href="/p/3">  Gizmo
+     Deluxe </a><span class="price">$9</span></li>
+</ul>
+<p>Not a product</p>
+</body></html>`
+
+func TestExtractData(t *testing.T) {
+	fields := []ExtractField{
+		{Name: "heading", CSS: "h1.title"},
+		{Name: "names", CSS: "#products > li.product a", Multiple: true},
+		{Name: "sale", CSS: "li.sale[data-sku] .price"},
+		{Name: "skus", CSS: "li.product", Attribute: "data-sku", Multiple: true},
+		{Name: "second", CSS: "li:nth-child(2) a"},
+		{Name: "last", CSS: "ul li:last-child a"},
+		{Name: "missing", CSS: "table"},
+		{Name: "none", CSS: "table", Multiple: true},
+		{Name: "x_names", XPath: "//ul[@id='products']/li/a", Multiple: true},
+		{Name: "x_hrefs", XPath: "//li[contains(@class, 'product')]/a/@href", Multiple: true},
+		{Name: "x_third", XPath: "//li[3]/a"},
+		{Name: "x_last", XPath: "//li[last()]/span[@class='price']"},
+		{Name: "x_text", XPath: "//a[normalize-space()='Gizmo Deluxe']/@href"},
+		{Name: "x_count", XPath: "//li[count(a) = 1 and not(contains(@class, 'sale'))]/@data-sku", Multiple: true},
+	}
+	result, err := testCrawler(t).ExtractData(testInput(t, map[string]interface{}{"html": productsPage, "fields": fields}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"heading": "Products",
+		"names":   []string{"Widget", "Gadget", "Gizmo Deluxe"},
+		"sale":    "$7",
+		"skus":    []string{"A1", "B2", "C3"},
+		"second":  "Gadget",
+		"last":    "Gizmo Deluxe",
+		"missing": nil,
+		"none":    []string{},
+		"x_names": []string{"Widget", "Gadget", "Gizmo Deluxe"},
+		"x_hrefs": []string{"/p/1", "/p/2", "/p/3"},
+		"x_third": "Gizmo Deluxe",
+		"x_last":  "$9",
+		"x_text":  "/p/3",
+		"x_count": []string{"A1", "C3"},
+	}
+	data := result.(*ExtractResult).Data
+	for name, value := range want {
+		if !reflect.DeepEqual(data[name], value) {
+			t.Errorf("%s = %#v, want %#v", name, data[name], value)
+		}
+	}
+}
+
+func TestExtractDataFromURL(t *testing.T) {
+	srv, _ := testSite(t)
+	result, err := testCrawler(t).ExtractData(testInput(t, map[string]interface{}{
+		"url":    srv.URL + "/a",
+		"fields": []ExtractField{{Name: "title", XPath: "//title"}, {Name: "link", CSS: "a", Attribute: "href"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extracted := result.(*ExtractResult)
+	if extracted.URL != srv.URL+"/a" || extracted.Data["title"] != "A" || extracted.Data["link"] != "b" {
+		t.Errorf("result = %+v", extracted)
+	}
+
+	_, err = testCrawler(t).ExtractData(testInput(t, map[string]interface{}{
+		"url":    srv.URL + "/private/secret",
+		"fields": []ExtractField{{Name: "title", CSS: "title"}},
+	}))
+	var webErr *WebError
+	if !errors.As(err, &webErr) || webErr.Code != "robots_disallowed" {
+		t.Errorf("disallowed page: err = %v, want robots_disallowed", err)
+	}
+}
+
+func TestExtractDataRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []ExtractField
+		want   string
+	}{
+		{"no fields", nil, "fields are required"},
+		{"no selector", []ExtractField{{Name: "a"}}, "either css or xpath"},
+		{"both selectors", []ExtractField{{Name: "a", CSS: "a", XPath: "//a"}}, "either css or xpath"},
+		{"duplicate", []ExtractField{{Name: "a", CSS: "a"}, {Name: "a", CSS: "b"}}, "given twice"},
+		{"bad css", []ExtractField{{Name: "a", CSS: "a[href"}}, `field "a"`},
+		{"bad xpath", []ExtractField{{Name: "a", XPath: "//a[@href"}}, `field "a"`},
+		{"unsupported xpath", []ExtractField{{Name: "a", XPath: "//a/@href/b"}}, `field "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testCrawler(t).ExtractData(testInput(t, map[string]interface{}{"html": productsPage, "fields": tt.fields}))
+			var webErr *WebError
+			if !errors.As(err, &webErr) || webErr.Status != http.StatusBadRequest || !strings.Contains(webErr.Message, tt.want) {
+				t.Errorf("err = %v, want a 400 mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScreenshotNotImplemented(t *testing.T) {
+	_, err := testCrawler(t).Screenshot(testInput(t, map[string]interface{}{"url": "https://example.com"}))
+	var webErr *WebError
+	if !errors.As(err, &webErr) || webErr.GatewayStatus() != http.StatusNotImplemented {
+		t.Errorf("err = %v, want 501", err)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	robots := parseRobots(strings.NewReader(`
+# comments are ignored
+User-agent: OtherBot
+Disallow: /
+
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+
+User-agent: quantumlayerbot
+User-agent: another
+Disallow: /bots-only/
+`), CrawlerUserAgent)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/bots-only/page", false},
+		// The specific group replaces the * group
+		{"/private/x", true},
+	}
+	for _, tt := range tests {
+		if got := robots.allowed(tt.path); got != tt.want {
+			t.Errorf("specific group: allowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	wildcard := parseRobots(strings.NewReader(`
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+Disallow:
+`), CrawlerUserAgent)
+	tests = []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/private/x", false},
+		{"/private/public/page", true},
+		{"/docs/file.pdf", false},
+		{"/docs/file.pdf?download=1", true},
+		{"/search", true},
+		{"/search?q=go", false},
+	}
+	for _, tt := range tests {
+		if got := wildcard.allowed(tt.path); got != tt.want {
+			t.Errorf("* group: allowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	var none *robotsRules
+	if !none.allowed("/anything") {
+		t.Error("no robots.txt disallowed a path")
+	}
+}
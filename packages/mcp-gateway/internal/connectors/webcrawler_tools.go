@@ -0,0 +1,127 @@
+package connectors
+
+import "encoding/json"
+
+// WebCrawlerTools are the web crawler connector's tools
+var WebCrawlerTools = []ToolSpec{
+	{
+		Name:        "web.crawl_site",
+		Description: "Crawl a site breadth first within its domain, honoring robots.txt",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"url": {"type": "string", "format": "uri", "description": "Page to start from"},
+		"depth": {"type": "integer", "minimum": 0, "maximum": 3, "default": 0, "description": "How many links away from url to follow"},
+		"max_pages": {"type": "integer", "minimum": 1, "maximum": 100, "default": 20},
+		"allowed_domains": {"type": "array", "items": {"type": "string"}, "description": "Domains whose links are followed; defaults to the domain of url"}
+	},
+	"required": ["url"]
+}`),
+		OutputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"start_url": {"type": "string"},
+		"pages": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"url": {"type": "string"},
+					"depth": {"type": "integer"},
+					"status": {"type": "integer"},
+					"content_type": {"type": "string"},
+					"title": {"type": "string"},
+					"description": {"type": "string"},
+					"headings": {"type": "array", "items": {"type": "string"}},
+					"links": {"type": "array", "items": {"type": "string"}},
+					"forms": {
+						"type": "array",
+						"items": {
+							"type": "object",
+							"properties": {
+								"action": {"type": "string"},
+								"method": {"type": "string"},
+								"inputs": {"type": "array", "items": {"type": "string"}}
+							}
+						}
+					},
+					"images": {"type": "integer"},
+					"truncated": {"type": "boolean"},
+					"error": {"type": "string"}
+				},
+				"required": ["url", "depth"]
+			}
+		},
+		"skipped": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"url": {"type": "string"},
+					"reason": {"type": "string", "enum": ["robots", "domain"]}
+				}
+			}
+		},
+		"truncated": {"type": "boolean", "description": "Set when max_pages stopped the crawl"}
+	},
+	"required": ["start_url", "pages", "truncated"]
+}`),
+	},
+	{
+		Name:        "web.extract_data",
+		Description: "Extract fields from a page with CSS selectors or XPath",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"url": {"type": "string", "format": "uri"},
+		"html": {"type": "string", "description": "Markup to extract from instead of fetching url"},
+		"fields": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"css": {"type": "string"},
+					"xpath": {"type": "string"},
+					"attribute": {"type": "string", "description": "Read this attribute instead of the text"},
+					"multiple": {"type": "boolean", "description": "Return every match instead of the first"}
+				},
+				"required": ["name"]
+			}
+		}
+	},
+	"required": ["fields"]
+}`),
+		OutputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"url": {"type": "string"},
+		"status": {"type": "integer"},
+		"data": {
+			"type": "object",
+			"additionalProperties": {
+				"oneOf": [
+					{"type": "string"},
+					{"type": "array", "items": {"type": "string"}},
+					{"type": "null"}
+				]
+			}
+		}
+	},
+	"required": ["data"]
+}`),
+	},
+	{
+		Name:        "web.screenshot",
+		Description: "Take a screenshot of a page (not available: needs a headless browser)",
+		InputSchema: json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"url": {"type": "string", "format": "uri"}
+	},
+	"required": ["url"]
+}`),
+		OutputSchema: json.RawMessage(`{"type": "object"}`),
+	},
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/quantumlayer/mcp-gateway/internal/connectors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -63,8 +66,8 @@ type MCPGateway struct {
 	Bitbucket *BitbucketConnector
 	
 	// Project Management
-	JIRA       *JIRAConnector
-	Confluence *ConfluenceConnector
+	JIRA       *connectors.JIRAConnector
+	Confluence *connectors.ConfluenceConnector
 	Linear     *LinearConnector
 	Asana      *AsanaConnector
 	
@@ -87,15 +90,17 @@ type MCPGateway struct {
 	PagerDuty *PagerDutyConnector
 	
 	// Data Sources
-	WebCrawler *WebCrawlerConnector
+	WebCrawler *connectors.WebCrawlerConnector
 	Database   *DatabaseConnector
-	APIReader  *APIReaderConnector
+	APIReader  *connectors.APIReaderConnector
+	HTTP       *connectors.HTTPRequestConnector
 	FileSystem *FileSystemConnector
 	
 	// Core Components
 	Cache       *CacheManager
 	RateLimiter *RateLimiter
 	Auth        *AuthManager
+	Connectors  *ConnectorHealth
 }
 
 // MCPRequest represents a request to the MCP Gateway
@@ -107,11 +112,18 @@ type MCPRequest struct {
 	Auth      *AuthContext    `json:"auth,omitempty"`
 }
 
+// gatewayError is a connector error that knows which status to answer with
+type gatewayError interface {
+	error
+	GatewayStatus() int
+}
+
 // MCPResponse represents a response from the MCP Gateway
 type MCPResponse struct {
 	Success   bool        `json:"success"`
 	Data      interface{} `json:"data,omitempty"`
 	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"` // structured error from the connector
 	RequestID string      `json:"request_id"`
 	Cached    bool        `json:"cached"`
 	Duration  float64     `json:"duration_ms"`
@@ -125,6 +137,32 @@ type AuthContext struct {
 	Metadata  map[string]string `json:"metadata"`
 }
 
+// jiraAuth reads JIRA credentials a caller passes in its auth metadata
+// (jira_pat, or jira_email with jira_api_token)
+func jiraAuth(auth *AuthContext) connectors.JIRAAuth {
+	if auth == nil {
+		return connectors.JIRAAuth{}
+	}
+	return connectors.JIRAAuth{
+		Email:    auth.Metadata["jira_email"],
+		APIToken: auth.Metadata["jira_api_token"],
+		PAT:      auth.Metadata["jira_pat"],
+	}
+}
+
+// confluenceAuth reads Confluence credentials a caller passes in its auth
+// metadata (confluence_pat, or confluence_email with confluence_api_token)
+func confluenceAuth(auth *AuthContext) connectors.ConfluenceAuth {
+	if auth == nil {
+		return connectors.ConfluenceAuth{}
+	}
+	return connectors.ConfluenceAuth{
+		Email:    auth.Metadata["confluence_email"],
+		APIToken: auth.Metadata["confluence_api_token"],
+		PAT:      auth.Metadata["confluence_pat"],
+	}
+}
+
 func main() {
 	log.Printf("🌐 MCP Gateway Service v%s Starting...", ServiceVersion)
 	
@@ -137,9 +175,11 @@ func main() {
 	// Health & Info endpoints
 	router.HandleFunc("/health", healthHandler).Methods("GET")
 	router.HandleFunc("/info", infoHandler).Methods("GET")
+	router.HandleFunc("/connectors/health", gateway.connectorsHealthHandler).Methods("GET")
 	
 	// MCP endpoints
 	router.HandleFunc("/api/v1/execute", gateway.executeHandler).Methods("POST")
+	router.HandleFunc("/api/v1/execute-batch", gateway.executeBatchHandler).Methods("POST")
 	router.HandleFunc("/api/v1/tools", gateway.listToolsHandler).Methods("GET")
 	router.HandleFunc("/api/v1/connectors", gateway.listConnectorsHandler).Methods("GET")
 	
@@ -164,13 +204,13 @@ func main() {
 
 // NewMCPGateway creates a new gateway instance
 func NewMCPGateway() *MCPGateway {
-	return &MCPGateway{
+	g := &MCPGateway{
 		// Initialize all connectors
 		GitHub:     NewGitHubConnector(),
 		GitLab:     NewGitLabConnector(),
 		Bitbucket:  NewBitbucketConnector(),
-		JIRA:       NewJIRAConnector(),
-		Confluence: NewConfluenceConnector(),
+		JIRA:       connectors.NewJIRAConnector(),
+		Confluence: connectors.NewConfluenceConnector(),
 		Linear:     NewLinearConnector(),
 		Asana:      NewAsanaConnector(),
 		Slack:      NewSlackConnector(),
@@ -185,50 +225,95 @@ func NewMCPGateway() *MCPGateway {
 		NewRelic:   NewNewRelicConnector(),
 		Sentry:     NewSentryConnector(),
 		PagerDuty:  NewPagerDutyConnector(),
-		WebCrawler: NewWebCrawlerConnector(),
+		WebCrawler: connectors.NewWebCrawlerConnector(),
 		Database:   NewDatabaseConnector(),
-		APIReader:  NewAPIReaderConnector(),
+		APIReader:  connectors.NewAPIReaderConnector(),
+		HTTP:       connectors.NewHTTPRequestConnector(),
 		FileSystem: NewFileSystemConnector(),
 		Cache:      NewCacheManager(),
 		RateLimiter: NewRateLimiter(),
 		Auth:       NewAuthManager(),
 	}
+	
+	// Circuit breakers and health probes, named after the tools' prefixes
+	g.Connectors = NewConnectorHealth(breakerSettingsFromEnv())
+	g.Connectors.Register("github", nil)
+	g.Connectors.Register("jira", g.JIRA)
+	g.Connectors.Register("confluence", g.Confluence)
+	g.Connectors.Register("slack", nil)
+	g.Connectors.Register("web", nil)
+	g.Connectors.Register("db", nil)
+	g.Connectors.Register("api", nil)
+	g.Connectors.Register("http", nil)
+	g.Connectors.Register("aws", nil)
+	g.Connectors.Register("gcp", nil)
+	g.Connectors.Register("azure", nil)
+	return g
 }
 
+// errRateLimited rejects a request over its service's rate limit
+var errRateLimited = errors.New("Rate limit exceeded")
+
 // executeHandler is the main entry point for MCP requests
 func (g *MCPGateway) executeHandler(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	
 	var req MCPRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	
+	response, status, err := g.run(req)
+	if errors.Is(err, errRateLimited) {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	var openErr *CircuitOpenError
+	if errors.As(err, &openErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(openErr.RetryAfter))
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// run executes one MCP request: from the cache if it can, otherwise
+// through the rate limiter and its connector's circuit breaker. It returns
+// the response with the status to answer it with, and the error if the
+// request failed.
+func (g *MCPGateway) run(req MCPRequest) (MCPResponse, int, error) {
+	start := time.Now()
 	log.Printf("Executing MCP tool: %s for service: %s", req.Tool, req.Service)
 	
 	// Check cache first
-	if cachedData, found := g.Cache.Get(req.Tool, req.Input); found {
-		cacheHits.WithLabelValues(req.Tool).Inc()
-		response := MCPResponse{
-			Success:   true,
-			Data:      cachedData,
-			RequestID: req.RequestID,
-			Cached:    true,
-			Duration:  float64(time.Since(start).Milliseconds()),
+	cacheInput, cacheable := g.cacheInput(req)
+	if cacheable {
+		if cachedData, found := g.Cache.Get(req.Tool, cacheInput); found {
+			cacheHits.WithLabelValues(req.Tool).Inc()
+			return MCPResponse{
+				Success:   true,
+				Data:      cachedData,
+				RequestID: req.RequestID,
+				Cached:    true,
+				Duration:  float64(time.Since(start).Milliseconds()),
+			}, http.StatusOK, nil
 		}
-		json.NewEncoder(w).Encode(response)
-		return
 	}
 	
 	// Rate limiting
 	if !g.RateLimiter.Allow(req.Service, req.Tool) {
-		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-		return
+		mcpRequests.WithLabelValues(req.Tool, req.Service, "rate_limited").Inc()
+		return MCPResponse{
+			Success:   false,
+			Error:     errRateLimited.Error(),
+			RequestID: req.RequestID,
+		}, http.StatusTooManyRequests, errRateLimited
 	}
 	
-	// Execute the tool
-	data, err := g.execute(req)
+	// Execute the tool, unless its connector's circuit is open
+	data, err := g.Connectors.Call(req.Tool, func() (interface{}, error) {
+		return g.execute(req)
+	})
 	
 	duration := time.Since(start)
 	mcpDuration.WithLabelValues(req.Tool).Observe(duration.Seconds())
@@ -241,25 +326,38 @@ func (g *MCPGateway) executeHandler(w http.ResponseWriter, r *http.Request) {
 			RequestID: req.RequestID,
 			Duration:  float64(duration.Milliseconds()),
 		}
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
-		return
+		status := http.StatusInternalServerError
+		var connErr gatewayError
+		if errors.As(err, &connErr) {
+			status = connErr.GatewayStatus()
+			response.Details = connErr
+		}
+		return response, status, err
 	}
 	
 	// Cache successful responses
-	g.Cache.Set(req.Tool, req.Input, data)
+	if cacheable {
+		g.Cache.Set(req.Tool, cacheInput, data)
+	}
 	
 	mcpRequests.WithLabelValues(req.Tool, req.Service, "success").Inc()
-	response := MCPResponse{
+	return MCPResponse{
 		Success:   true,
 		Data:      data,
 		RequestID: req.RequestID,
 		Cached:    false,
 		Duration:  float64(duration.Milliseconds()),
+	}, http.StatusOK, nil
+}
+
+// cacheInput is what a request is cached under, and whether it may be
+// cached at all. http.request keys hash their credentials, and only its
+// reads are cached.
+func (g *MCPGateway) cacheInput(req MCPRequest) (json.RawMessage, bool) {
+	if req.Tool == "http.request" {
+		return connectors.HTTPCacheInput(req.Input)
 	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	return req.Input, true
 }
 
 // execute routes requests to appropriate connectors
@@ -277,21 +375,21 @@ func (g *MCPGateway) execute(req MCPRequest) (interface{}, error) {
 		
 	// JIRA operations
 	case "jira.create_ticket":
-		return g.JIRA.CreateTicket(req.Input)
+		return g.JIRA.WithAuth(jiraAuth(req.Auth)).CreateTicket(req.Input)
 	case "jira.update_ticket":
-		return g.JIRA.UpdateTicket(req.Input)
+		return g.JIRA.WithAuth(jiraAuth(req.Auth)).UpdateTicket(req.Input)
 	case "jira.get_ticket":
-		return g.JIRA.GetTicket(req.Input)
+		return g.JIRA.WithAuth(jiraAuth(req.Auth)).GetTicket(req.Input)
 	case "jira.search":
-		return g.JIRA.Search(req.Input)
+		return g.JIRA.WithAuth(jiraAuth(req.Auth)).Search(req.Input)
 		
 	// Confluence operations
 	case "confluence.create_page":
-		return g.Confluence.CreatePage(req.Input)
+		return g.Confluence.WithAuth(confluenceAuth(req.Auth)).CreatePage(req.Input)
 	case "confluence.update_page":
-		return g.Confluence.UpdatePage(req.Input)
+		return g.Confluence.WithAuth(confluenceAuth(req.Auth)).UpdatePage(req.Input)
 	case "confluence.get_page":
-		return g.Confluence.GetPage(req.Input)
+		return g.Confluence.WithAuth(confluenceAuth(req.Auth)).GetPage(req.Input)
 		
 	// Slack operations
 	case "slack.send_message":
@@ -321,6 +419,10 @@ func (g *MCPGateway) execute(req MCPRequest) (interface{}, error) {
 	case "api.test_endpoint":
 		return g.APIReader.TestEndpoint(req.Input)
 		
+	// Generic HTTP
+	case "http.request":
+		return g.HTTP.Request(req.Input)
+		
 	// Cloud operations
 	case "aws.deploy":
 		return g.AWS.Deploy(req.Input)
@@ -356,24 +458,16 @@ func (g *MCPGateway) listToolsHandler(w http.ResponseWriter, r *http.Request) {
 
 // listAllTools returns all available MCP tools
 func (g *MCPGateway) listAllTools() []Tool {
-	return []Tool{
+	tools := []Tool{
 		// GitHub
 		{Name: "github.read_repo", Description: "Read GitHub repository", Category: "repository"},
 		{Name: "github.create_pr", Description: "Create pull request", Category: "repository"},
 		{Name: "github.create_issue", Description: "Create issue", Category: "repository"},
 		
-		// JIRA
-		{Name: "jira.create_ticket", Description: "Create JIRA ticket", Category: "project_mgmt"},
-		{Name: "jira.update_ticket", Description: "Update JIRA ticket", Category: "project_mgmt"},
-		
 		// Slack
 		{Name: "slack.send_message", Description: "Send Slack message", Category: "communication"},
 		{Name: "slack.create_channel", Description: "Create Slack channel", Category: "communication"},
 		
-		// Web
-		{Name: "web.crawl_site", Description: "Crawl website", Category: "data"},
-		{Name: "web.screenshot", Description: "Take screenshot", Category: "data"},
-		
 		// Database
 		{Name: "db.query", Description: "Query database", Category: "data"},
 		{Name: "db.schema", Description: "Get database schema", Category: "data"},
@@ -383,13 +477,71 @@ func (g *MCPGateway) listAllTools() []Tool {
 		{Name: "gcp.deploy", Description: "Deploy to GCP", Category: "cloud"},
 		{Name: "azure.deploy", Description: "Deploy to Azure", Category: "cloud"},
 	}
+	
+	// JIRA
+	for _, spec := range connectors.JIRATools {
+		tools = append(tools, Tool{
+			Name:         spec.Name,
+			Description:  spec.Description,
+			Category:     "project_mgmt",
+			InputSchema:  spec.InputSchema,
+			OutputSchema: spec.OutputSchema,
+		})
+	}
+	
+	// Confluence
+	for _, spec := range connectors.ConfluenceTools {
+		tools = append(tools, Tool{
+			Name:         spec.Name,
+			Description:  spec.Description,
+			Category:     "project_mgmt",
+			InputSchema:  spec.InputSchema,
+			OutputSchema: spec.OutputSchema,
+		})
+	}
+	
+	// API
+	for _, spec := range connectors.APIReaderTools {
+		tools = append(tools, Tool{
+			Name:         spec.Name,
+			Description:  spec.Description,
+			Category:     "data",
+			InputSchema:  spec.InputSchema,
+			OutputSchema: spec.OutputSchema,
+		})
+	}
+	
+	// HTTP
+	for _, spec := range connectors.HTTPRequestTools {
+		tools = append(tools, Tool{
+			Name:         spec.Name,
+			Description:  spec.Description,
+			Category:     "data",
+			InputSchema:  spec.InputSchema,
+			OutputSchema: spec.OutputSchema,
+		})
+	}
+	
+	// Web
+	for _, spec := range connectors.WebCrawlerTools {
+		tools = append(tools, Tool{
+			Name:         spec.Name,
+			Description:  spec.Description,
+			Category:     "data",
+			InputSchema:  spec.InputSchema,
+			OutputSchema: spec.OutputSchema,
+		})
+	}
+	return tools
 }
 
 // Tool represents an MCP tool
 type Tool struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Category    string `json:"category"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	Category     string          `json:"category"`
+	InputSchema  json.RawMessage `json:"input_schema,omitempty"`
+	OutputSchema json.RawMessage `json:"output_schema,omitempty"`
 }
 
 // listConnectorsHandler returns all available connectors
@@ -439,7 +591,46 @@ func (g *MCPGateway) githubHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (g *MCPGateway) jiraHandler(w http.ResponseWriter, r *http.Request) {
-	// Similar implementation for JIRA
+	vars := mux.Vars(r)
+	action := vars["action"]
+	
+	var input json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	var result interface{}
+	var err error
+	
+	switch action {
+	case "create-ticket":
+		result, err = g.JIRA.CreateTicket(input)
+	case "update-ticket":
+		result, err = g.JIRA.UpdateTicket(input)
+	case "get-ticket":
+		result, err = g.JIRA.GetTicket(input)
+	case "search":
+		result, err = g.JIRA.Search(input)
+	default:
+		http.Error(w, fmt.Sprintf("unknown JIRA action: %s", action), http.StatusNotFound)
+		return
+	}
+	
+	var jiraErr *connectors.JIRAError
+	if errors.As(err, &jiraErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(jiraErr.GatewayStatus())
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": jiraErr})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
 }
 
 func (g *MCPGateway) slackHandler(w http.ResponseWriter, r *http.Request) {
@@ -499,19 +690,6 @@ func NewGitLabConnector() *GitLabConnector { return &GitLabConnector{} }
 type BitbucketConnector struct{}
 func NewBitbucketConnector() *BitbucketConnector { return &BitbucketConnector{} }
 
-type JIRAConnector struct{}
-func NewJIRAConnector() *JIRAConnector { return &JIRAConnector{} }
-func (j *JIRAConnector) CreateTicket(input json.RawMessage) (interface{}, error) { return nil, nil }
-func (j *JIRAConnector) UpdateTicket(input json.RawMessage) (interface{}, error) { return nil, nil }
-func (j *JIRAConnector) GetTicket(input json.RawMessage) (interface{}, error) { return nil, nil }
-func (j *JIRAConnector) Search(input json.RawMessage) (interface{}, error) { return nil, nil }
-
-type ConfluenceConnector struct{}
-func NewConfluenceConnector() *ConfluenceConnector { return &ConfluenceConnector{} }
-func (c *ConfluenceConnector) CreatePage(input json.RawMessage) (interface{}, error) { return nil, nil }
-func (c *ConfluenceConnector) UpdatePage(input json.RawMessage) (interface{}, error) { return nil, nil }
-func (c *ConfluenceConnector) GetPage(input json.RawMessage) (interface{}, error) { return nil, nil }
-
 type LinearConnector struct{}
 func NewLinearConnector() *LinearConnector { return &LinearConnector{} }
 
@@ -560,22 +738,11 @@ func NewSentryConnector() *SentryConnector { return &SentryConnector{} }
 type PagerDutyConnector struct{}
 func NewPagerDutyConnector() *PagerDutyConnector { return &PagerDutyConnector{} }
 
-type WebCrawlerConnector struct{}
-func NewWebCrawlerConnector() *WebCrawlerConnector { return &WebCrawlerConnector{} }
-func (w *WebCrawlerConnector) CrawlSite(input json.RawMessage) (interface{}, error) { return nil, nil }
-func (w *WebCrawlerConnector) Screenshot(input json.RawMessage) (interface{}, error) { return nil, nil }
-func (w *WebCrawlerConnector) ExtractData(input json.RawMessage) (interface{}, error) { return nil, nil }
-
 type DatabaseConnector struct{}
 func NewDatabaseConnector() *DatabaseConnector { return &DatabaseConnector{} }
 func (d *DatabaseConnector) Query(input json.RawMessage) (interface{}, error) { return nil, nil }
 func (d *DatabaseConnector) GetSchema(input json.RawMessage) (interface{}, error) { return nil, nil }
 
-type APIReaderConnector struct{}
-func NewAPIReaderConnector() *APIReaderConnector { return &APIReaderConnector{} }
-func (a *APIReaderConnector) ReadSpec(input json.RawMessage) (interface{}, error) { return nil, nil }
-func (a *APIReaderConnector) TestEndpoint(input json.RawMessage) (interface{}, error) { return nil, nil }
-
 type FileSystemConnector struct{}
 func NewFileSystemConnector() *FileSystemConnector { return &FileSystemConnector{} }
 
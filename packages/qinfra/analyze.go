@@ -0,0 +1,536 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Analysis reads existing IaC, runs the vulnerability scanner and
+// compliance checks over it, and scores security, cost and performance
+// from what it finds. Terraform is parsed into resources; other files get
+// the scanner's content checks only.
+
+// AnalyzeRequest is IaC to analyze, by filename
+type AnalyzeRequest struct {
+	Framework  string            `json:"framework"`
+	Code       map[string]string `json:"code"`
+	Compliance []string          `json:"compliance"`
+}
+
+// AnalysisFinding is one problem found in the code
+type AnalysisFinding struct {
+	Category       string `json:"category"` // security, cost, performance
+	Severity       string `json:"severity"` // critical, high, medium, low
+	Resource       string `json:"resource"`
+	Description    string `json:"description"`
+	Recommendation string `json:"recommendation"`
+}
+
+// AnalysisReport scores the code out of 100 per category. Each finding
+// takes its severity's penalty off its category's score.
+type AnalysisReport struct {
+	Framework        string            `json:"framework"`
+	Resources        int               `json:"resources"`
+	SecurityScore    int               `json:"security_score"`
+	CostOptimization int               `json:"cost_optimization"`
+	Performance      int               `json:"performance"`
+	Findings         []AnalysisFinding `json:"findings"`
+	ComplianceReport *ComplianceReport `json:"compliance_report,omitempty"`
+	Recommendations  []string          `json:"recommendations"`
+}
+
+// severityPenalties are the points a finding costs its category's score
+var severityPenalties = map[string]int{"critical": 40, "high": 25, "medium": 15, "low": 5}
+
+var severityOrder = map[string]int{"critical": 0, "high": 1, "medium": 2, "low": 3}
+
+// AnalyzeInfra scores the code in req
+func (q *QInfraEngine) AnalyzeInfra(req AnalyzeRequest) (*AnalysisReport, error) {
+	if len(req.Code) == 0 {
+		return nil, fmt.Errorf("code must include at least one file")
+	}
+	for _, framework := range req.Compliance {
+		if _, ok := q.complianceMgr.frameworks[framework]; !ok {
+			return nil, fmt.Errorf("unknown compliance framework %q", framework)
+		}
+	}
+	framework := req.Framework
+	if framework == "" {
+		framework = detectIaCFramework(req.Code)
+	}
+
+	var blocks []terraformBlock
+	for _, filename := range sortedFilenames(req.Code) {
+		if !strings.HasSuffix(filename, ".tf") {
+			continue
+		}
+		parsed, err := parseTerraform(filename, req.Code[filename])
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, parsed...)
+	}
+
+	report := &AnalysisReport{Framework: framework, Findings: []AnalysisFinding{}}
+	for _, vuln := range q.vulnScanner.ScanInfrastructure(req.Code, framework) {
+		report.Findings = append(report.Findings, AnalysisFinding{
+			Category:       "security",
+			Severity:       vuln.Severity,
+			Resource:       vuln.Affected,
+			Description:    vuln.Description,
+			Recommendation: vuln.Fix,
+		})
+	}
+	for _, block := range blocks {
+		if block.Type != "resource" {
+			continue
+		}
+		report.Resources++
+		report.Findings = append(report.Findings, sizingFindings(block)...)
+	}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return severityOrder[report.Findings[i].Severity] < severityOrder[report.Findings[j].Severity]
+	})
+
+	report.SecurityScore = categoryScore(report.Findings, "security")
+	report.CostOptimization = categoryScore(report.Findings, "cost")
+	report.Performance = categoryScore(report.Findings, "performance")
+
+	seen := make(map[string]bool)
+	report.Recommendations = []string{}
+	recommend := func(recommendation string) {
+		if !seen[recommendation] {
+			seen[recommendation] = true
+			report.Recommendations = append(report.Recommendations, recommendation)
+		}
+	}
+	for _, finding := range report.Findings {
+		recommend(finding.Recommendation)
+	}
+	if len(req.Compliance) > 0 {
+		report.ComplianceReport = q.complianceMgr.Validate(req.Code, req.Compliance)
+		for _, remediation := range report.ComplianceReport.Remediation {
+			recommend(remediation)
+		}
+	}
+	return report, nil
+}
+
+func categoryScore(findings []AnalysisFinding, category string) int {
+	score := 100
+	for _, finding := range findings {
+		if finding.Category == category {
+			score -= severityPenalties[finding.Severity]
+		}
+	}
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// detectIaCFramework guesses the framework of code without one given
+func detectIaCFramework(code map[string]string) string {
+	for filename, content := range code {
+		switch {
+		case strings.HasSuffix(filename, ".tf"):
+			return "terraform"
+		case strings.Contains(content, "AWSTemplateFormatVersion"):
+			return "cloudformation"
+		case strings.Contains(content, "apiVersion:") && strings.Contains(content, "kind:"):
+			return "kubernetes"
+		}
+	}
+	return "unknown"
+}
+
+func sortedFilenames(code map[string]string) []string {
+	filenames := make([]string, 0, len(code))
+	for filename := range code {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+func (q *QInfraEngine) handleAnalyze(c *gin.Context) {
+	var req AnalyzeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := q.AnalyzeInfra(req)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, report)
+}
+
+// terraformBlock is a top level block of terraform code with the
+// assignments inside it, nested ones keyed by their block path, e.g.
+// ingress.cidr_blocks
+type terraformBlock struct {
+	File   string
+	Line   int
+	Type   string // resource, data, variable, ...
+	Labels []string
+	Attrs  map[string]string
+	// Blocks are the paths of the nested blocks
+	Blocks map[string]bool
+}
+
+// Address names the block the way terraform does, e.g. aws_instance.web
+func (b terraformBlock) Address() string {
+	if b.Type == "resource" {
+		return strings.Join(b.Labels, ".")
+	}
+	return strings.Join(append([]string{b.Type}, b.Labels...), ".")
+}
+
+// ResourceType is the first label of a resource block
+func (b terraformBlock) ResourceType() string {
+	if b.Type != "resource" || len(b.Labels) == 0 {
+		return ""
+	}
+	return b.Labels[0]
+}
+
+// affected names the block in findings
+func (b terraformBlock) affected() string {
+	return b.File + ": " + b.Address()
+}
+
+var (
+	blockHeaderPattern = regexp.MustCompile(`^([A-Za-z_][\w-]*)((?:\s+"[^"]*")*)$`)
+	blockLabelPattern  = regexp.MustCompile(`"([^"]*)"`)
+	nestedBlockPattern = regexp.MustCompile(`^([A-Za-z_][\w-]*)(?:\s+"[^"]*")*$`)
+	assignmentPattern  = regexp.MustCompile(`^([A-Za-z_][\w-]*)\s*=\s*(.*)$`)
+	heredocPattern     = regexp.MustCompile(`<<-?([A-Za-z_]\w*)\s*$`)
+)
+
+// parseTerraform reads the blocks of a terraform file. It understands
+// enough HCL to find resources and their settings; expressions are kept as
+// written.
+func parseTerraform(filename, content string) ([]terraformBlock, error) {
+	var blocks []terraformBlock
+	var current *terraformBlock
+	var path []string // nested blocks open in the current block
+	var pending, pendingValue string
+	brackets := 0
+	heredoc, heredocLine := "", 0
+
+	fail := func(line int, format string, args ...interface{}) error {
+		return fmt.Errorf("%s: line %d: %s", filename, line, fmt.Sprintf(format, args...))
+	}
+	key := func(name string) string {
+		return strings.Join(append(append([]string(nil), path...), name), ".")
+	}
+
+	for i, raw := range strings.Split(content, "\n") {
+		line := i + 1
+		if heredoc != "" {
+			if strings.TrimSpace(raw) == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+		code := stripHCLComment(raw)
+		if m := heredocPattern.FindStringSubmatch(code); m != nil {
+			heredoc, heredocLine = m[1], line
+		}
+
+		// A list value spanning lines is collected until it closes
+		if pending != "" {
+			pendingValue += " " + strings.TrimSpace(code)
+			brackets += strings.Count(code, "[") - strings.Count(code, "]")
+			if brackets <= 0 {
+				current.Attrs[pending] = unquoteHCL(pendingValue)
+				pending = ""
+			}
+			continue
+		}
+
+		for _, token := range splitHCLBraces(code) {
+			if token == "}" {
+				if current == nil {
+					return nil, fail(line, "unexpected }")
+				}
+				if len(path) == 0 {
+					blocks = append(blocks, *current)
+					current = nil
+				} else {
+					path = path[:len(path)-1]
+				}
+				continue
+			}
+
+			text := strings.TrimSpace(token)
+			opens := strings.HasSuffix(text, "{")
+			text = strings.TrimSpace(strings.TrimSuffix(text, "{"))
+			switch {
+			case current == nil:
+				m := blockHeaderPattern.FindStringSubmatch(text)
+				if m == nil || !opens {
+					if text == "" && !opens {
+						continue
+					}
+					return nil, fail(line, "expected a block, got %q", strings.TrimSpace(token))
+				}
+				block := terraformBlock{File: filename, Line: line, Type: m[1], Attrs: map[string]string{}, Blocks: map[string]bool{}}
+				for _, label := range blockLabelPattern.FindAllStringSubmatch(m[2], -1) {
+					block.Labels = append(block.Labels, label[1])
+				}
+				current, path = &block, nil
+			case opens:
+				// A nested block, or a map value such as tags = {
+				name := text
+				if m := assignmentPattern.FindStringSubmatch(text); m != nil {
+					name = m[1]
+				} else if m := nestedBlockPattern.FindStringSubmatch(text); m != nil {
+					name = m[1]
+				}
+				current.Blocks[key(name)] = true
+				path = append(path, name)
+			default:
+				m := assignmentPattern.FindStringSubmatch(text)
+				if m == nil {
+					continue
+				}
+				value := strings.TrimSpace(m[2])
+				if open := strings.Count(value, "[") - strings.Count(value, "]"); open > 0 {
+					pending, pendingValue, brackets = key(m[1]), value, open
+					continue
+				}
+				current.Attrs[key(m[1])] = unquoteHCL(value)
+			}
+		}
+	}
+	switch {
+	case heredoc != "":
+		return nil, fail(heredocLine, "heredoc %s is never closed", heredoc)
+	case current != nil:
+		return nil, fail(current.Line, "block %s is never closed", current.Address())
+	}
+	return blocks, nil
+}
+
+// splitHCLBraces cuts a line at the braces outside strings, keeping an
+// opening brace on the text before it and a closing one on its own
+func splitHCLBraces(line string) []string {
+	var tokens []string
+	start, inString, interpolation := 0, false, 0
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case inString && ch == '\\':
+			i++
+		case inString && interpolation == 0 && ch == '"':
+			inString = false
+		case inString && ch == '{' && i > 0 && (line[i-1] == '$' || line[i-1] == '%'):
+			interpolation++
+		case inString && interpolation > 0 && ch == '}':
+			interpolation--
+		case inString:
+		case ch == '"':
+			inString = true
+		case ch == '{':
+			tokens = append(tokens, line[start:i+1])
+			start = i + 1
+		case ch == '}':
+			tokens = append(tokens, line[start:i], "}")
+			start = i + 1
+		}
+	}
+	return append(tokens, line[start:])
+}
+
+// stripHCLComment drops a # or // comment outside strings
+func stripHCLComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && inString:
+			i++
+		case line[i] == '"':
+			inString = !inString
+		case inString:
+		case line[i] == '#', line[i] == '/' && i+1 < len(line) && line[i+1] == '/':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteHCL(value string) string {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), ","))
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' && !strings.Contains(value[1:len(value)-1], `"`) {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Settings that open a firewall rule to the sources they list
+var openSourceAttrs = map[string]bool{
+	"cidr_blocks": true, "ipv6_cidr_blocks": true, "cidr_ipv4": true, "cidr_ipv6": true,
+	"source_ranges": true, "source_address_prefix": true, "source_address_prefixes": true,
+}
+
+// opensToInternet reports an inbound rule of the block that admits any
+// address
+func opensToInternet(b terraformBlock) bool {
+	for key, value := range b.Attrs {
+		name := key[strings.LastIndex(key, ".")+1:]
+		if !openSourceAttrs[name] {
+			continue
+		}
+		prefix := strings.TrimSuffix(key, name)
+		if strings.HasPrefix(key, "egress.") || strings.EqualFold(b.Attrs[prefix+"type"], "egress") ||
+			strings.EqualFold(b.Attrs[prefix+"direction"], "egress") || strings.EqualFold(b.Attrs[prefix+"direction"], "outbound") ||
+			strings.HasPrefix(b.ResourceType(), "aws_vpc_security_group_egress") {
+			continue
+		}
+		for _, any := range []string{`0.0.0.0/0`, `::/0`} {
+			if strings.Contains(value, any) {
+				return true
+			}
+		}
+		if value == "*" || value == "Internet" {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptionAttrs are the settings AWS resources leave unencrypted by
+// default unless they are set
+var encryptionAttrs = map[string]string{
+	"aws_db_instance":     "storage_encrypted",
+	"aws_rds_cluster":     "storage_encrypted",
+	"aws_ebs_volume":      "encrypted",
+	"aws_efs_file_system": "encrypted",
+}
+
+// scanTerraform checks parsed terraform resources for open ingress,
+// unencrypted storage and public databases
+func scanTerraform(blocks []terraformBlock) []VulnerabilityReport {
+	var vulnerabilities []VulnerabilityReport
+	for _, b := range blocks {
+		if b.Type != "resource" {
+			continue
+		}
+		if opensToInternet(b) {
+			vulnerabilities = append(vulnerabilities, VulnerabilityReport{
+				Severity:    "high",
+				CVE:         "CWE-284",
+				Description: "Unrestricted network access detected",
+				Affected:    b.affected(),
+				Fix:         "Restrict CIDR blocks to specific IP ranges",
+			})
+		}
+
+		unencrypted := false
+		for key, value := range b.Attrs {
+			name := key[strings.LastIndex(key, ".")+1:]
+			if (name == "encrypted" || name == "storage_encrypted") && value == "false" {
+				unencrypted = true
+			}
+		}
+		if attr, ok := encryptionAttrs[b.ResourceType()]; ok && b.Attrs[attr] == "" {
+			unencrypted = true
+		}
+		if unencrypted {
+			vulnerabilities = append(vulnerabilities, VulnerabilityReport{
+				Severity:    "high",
+				CVE:         "CWE-311",
+				Description: "Storage is not encrypted at rest",
+				Affected:    b.affected(),
+				Fix:         "Enable encryption at rest",
+			})
+		}
+
+		if b.Attrs["publicly_accessible"] == "true" {
+			vulnerabilities = append(vulnerabilities, VulnerabilityReport{
+				Severity:    "critical",
+				CVE:         "CWE-668",
+				Description: "Database is reachable from the internet",
+				Affected:    b.affected(),
+				Fix:         "Set publicly_accessible = false and reach the database through the VPC",
+			})
+		}
+	}
+	return vulnerabilities
+}
+
+// oversizedVCPUs is the size at which an instance is flagged for
+// right-sizing
+const oversizedVCPUs = 32
+
+var (
+	awsSizePattern   = regexp.MustCompile(`\.(\d*)xlarge$`)
+	gcpCoresPattern  = regexp.MustCompile(`-(\d+)$`)
+	azureSizePattern = regexp.MustCompile(`^Standard_[A-Za-z]+(\d+)`)
+)
+
+// instanceVCPUs estimates the vCPUs of an instance type from its name, 0
+// when the name doesn't say
+func instanceVCPUs(machineType string) int {
+	switch {
+	case strings.HasSuffix(machineType, ".metal"):
+		return 96
+	case awsSizePattern.MatchString(machineType):
+		multiple, _ := strconv.Atoi(awsSizePattern.FindStringSubmatch(machineType)[1])
+		if multiple == 0 {
+			multiple = 1
+		}
+		return 4 * multiple
+	case azureSizePattern.MatchString(machineType):
+		cores, _ := strconv.Atoi(azureSizePattern.FindStringSubmatch(machineType)[1])
+		return cores
+	case gcpCoresPattern.MatchString(machineType) && !strings.HasPrefix(machineType, "db-custom"):
+		cores, _ := strconv.Atoi(gcpCoresPattern.FindStringSubmatch(machineType)[1])
+		return cores
+	}
+	return 0
+}
+
+// sizingFindings flags oversized instances and single zone databases
+func sizingFindings(b terraformBlock) []AnalysisFinding {
+	var findings []AnalysisFinding
+	for _, attr := range []string{"instance_type", "machine_type", "size", "vm_size", "instance_class"} {
+		machineType := b.Attrs[attr]
+		if cpus := instanceVCPUs(machineType); cpus >= oversizedVCPUs {
+			findings = append(findings, AnalysisFinding{
+				Category:       "cost",
+				Severity:       "medium",
+				Resource:       b.affected(),
+				Description:    fmt.Sprintf("%s has about %d vCPUs", machineType, cpus),
+				Recommendation: fmt.Sprintf("Right-size %s to its measured load, or use autoscaling instead of one large instance", b.Address()),
+			})
+		}
+	}
+
+	singleZone := false
+	switch b.ResourceType() {
+	case "aws_db_instance":
+		singleZone = b.Attrs["multi_az"] != "true"
+	case "google_sql_database_instance":
+		singleZone = b.Attrs["settings.availability_type"] != "REGIONAL"
+	case "azurerm_postgresql_flexible_server", "azurerm_mysql_flexible_server":
+		singleZone = !b.Blocks["high_availability"]
+	}
+	if singleZone {
+		findings = append(findings, AnalysisFinding{
+			Category:       "performance",
+			Severity:       "medium",
+			Resource:       b.affected(),
+			Description:    "Database runs in a single zone, so a zone outage takes it down",
+			Recommendation: fmt.Sprintf("Enable high availability across zones for %s", b.Address()),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// secureTerraform is a web tier with nothing to flag
+const secureTerraform = `# Web tier
+resource "aws_security_group" "web" {
+  name = "web-${var.environment}"
+
+  ingress {
+    from_port   = 443
+    to_port     = 443
+    protocol    = "tcp"
+    cidr_blocks = ["10.0.0.0/8"]
+  }
+
+  egress {
+    from_port   = 0
+    to_port     = 0
+    protocol    = "-1"
+    cidr_blocks = ["0.0.0.0/0"] // responses and updates
+  }
+}
+
+resource "aws_instance" "web" {
+  instance_type = "t3.medium"
+
+  root_block_device {
+    encrypted = true
+  }
+}
+
+resource "aws_db_instance" "orders" {
+  instance_class    = "db.t3.medium"
+  storage_encrypted = true
+  multi_az          = true
+}
+`
+
+func analyze(t *testing.T, code map[string]string, compliance ...string) *AnalysisReport {
+	t.Helper()
+	report, err := NewQInfraEngine().AnalyzeInfra(AnalyzeRequest{Code: code, Compliance: compliance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func hasRecommendation(report *AnalysisReport, prefix string) bool {
+	for _, recommendation := range report.Recommendations {
+		if strings.HasPrefix(recommendation, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAnalyzeSecureCode(t *testing.T) {
+	report := analyze(t, map[string]string{"main.tf": secureTerraform})
+	if report.Framework != "terraform" || report.Resources != 3 {
+		t.Errorf("framework %s with %d resources, want terraform with 3", report.Framework, report.Resources)
+	}
+	if report.SecurityScore != 100 || report.CostOptimization != 100 || report.Performance != 100 {
+		t.Errorf("scores %d/%d/%d, findings %+v", report.SecurityScore, report.CostOptimization, report.Performance, report.Findings)
+	}
+	if len(report.Recommendations) != 0 {
+		t.Errorf("recommendations = %v, want none", report.Recommendations)
+	}
+}
+
+func TestAnalyzeMisconfigurationsLowerScores(t *testing.T) {
+	secure := analyze(t, map[string]string{"main.tf": secureTerraform})
+	tests := []struct {
+		name, from, to string
+		category       string
+		recommendation string
+	}{
+		{"open ingress", `cidr_blocks = ["10.0.0.0/8"]`, `cidr_blocks = ["0.0.0.0/0"]`, "security", "Restrict CIDR blocks"},
+		{"unencrypted volume", "encrypted = true", "encrypted = false", "security", "Enable encryption at rest"},
+		{"database encryption left out", "storage_encrypted = true", "", "security", "Enable encryption at rest"},
+		{"public database", "multi_az          = true", "multi_az = true\n  publicly_accessible = true", "security", "Set publicly_accessible = false"},
+		{"oversized instance", `"t3.medium"`, `"m5.16xlarge"`, "cost", "Right-size aws_instance.web"},
+		{"single zone database", "multi_az          = true", "", "performance", "Enable high availability across zones for aws_db_instance.orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := strings.Replace(secureTerraform, tt.from, tt.to, 1)
+			report := analyze(t, map[string]string{"main.tf": code})
+			scores := map[string][2]int{
+				"security":    {report.SecurityScore, secure.SecurityScore},
+				"cost":        {report.CostOptimization, secure.CostOptimization},
+				"performance": {report.Performance, secure.Performance},
+			}
+			for category, score := range scores {
+				if category == tt.category && score[0] >= score[1] {
+					t.Errorf("%s score %d, want below %d", category, score[0], score[1])
+				}
+				if category != tt.category && score[0] != score[1] {
+					t.Errorf("%s score changed from %d to %d", category, score[1], score[0])
+				}
+			}
+			if !hasRecommendation(report, tt.recommendation) {
+				t.Errorf("recommendations %v lack %q", report.Recommendations, tt.recommendation)
+			}
+		})
+	}
+}
+
+func TestAnalyzeFindingsNameResources(t *testing.T) {
+	code := strings.Replace(secureTerraform, `cidr_blocks = ["10.0.0.0/8"]`, `cidr_blocks = [
+      "10.0.0.0/8",
+      "0.0.0.0/0",
+    ]`, 1)
+	code = strings.Replace(code, `"t3.medium"`, `"m5.metal"`, 1)
+	report := analyze(t, map[string]string{"network.tf": code})
+	if len(report.Findings) != 2 {
+		t.Fatalf("findings = %+v, want the open ingress and the metal instance", report.Findings)
+	}
+	if f := report.Findings[0]; f.Category != "security" || f.Severity != "high" || f.Resource != "network.tf: aws_security_group.web" {
+		t.Errorf("first finding = %+v", f)
+	}
+	if f := report.Findings[1]; f.Category != "cost" || f.Resource != "network.tf: aws_instance.web" || !strings.Contains(f.Description, "96 vCPUs") {
+		t.Errorf("second finding = %+v", f)
+	}
+	if report.SecurityScore != 75 || report.CostOptimization != 85 {
+		t.Errorf("scores %d/%d, want 75/85", report.SecurityScore, report.CostOptimization)
+	}
+}
+
+func TestAnalyzeOtherProviders(t *testing.T) {
+	code := map[string]string{"main.tf": `
+resource "google_compute_firewall" "ssh" {
+  direction     = "INGRESS"
+  source_ranges = ["0.0.0.0/0"]
+}
+
+resource "azurerm_network_security_group" "web" {
+  security_rule {
+    direction             = "Outbound"
+    source_address_prefix = "*"
+  }
+}
+
+resource "azurerm_linux_virtual_machine" "web" {
+  size = "Standard_D64s_v5"
+}
+
+resource "google_sql_database_instance" "orders" {
+  settings {
+    tier              = "db-custom-4-15360"
+    availability_type = "ZONAL"
+  }
+}
+`}
+	report := analyze(t, code)
+	var resources []string
+	for _, f := range report.Findings {
+		resources = append(resources, f.Category+" "+strings.TrimPrefix(f.Resource, "main.tf: "))
+	}
+	want := "security google_compute_firewall.ssh, cost azurerm_linux_virtual_machine.web, performance google_sql_database_instance.orders"
+	if got := strings.Join(resources, ", "); got != want {
+		t.Errorf("findings = %s, want %s", got, want)
+	}
+}
+
+func TestAnalyzeGeneratedCode(t *testing.T) {
+	for _, provider := range []string{"aws", "gcp", "azure"} {
+		req := testInfraRequest()
+		req.Provider = provider
+		req.DryRun = true
+		req.Resources = []ResourceDefinition{
+			{Type: "compute", Name: "web"},
+			{Type: "storage", Name: "assets"},
+			{Type: "network", Name: "vpc"},
+			{Type: "database", Name: "orders", Properties: map[string]interface{}{"high_availability": true}},
+		}
+		resp, err := NewQInfraEngine().GenerateInfra(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := NewQInfraEngine().AnalyzeInfra(AnalyzeRequest{Code: resp.Code})
+		if err != nil {
+			t.Fatalf("%s: generated code doesn't parse: %v", provider, err)
+		}
+		if report.Resources == 0 || len(report.Findings) != 0 {
+			t.Errorf("%s: %d resources, findings %+v", provider, report.Resources, report.Findings)
+		}
+	}
+}
+
+func TestAnalyzeCompliance(t *testing.T) {
+	report := analyze(t, map[string]string{"main.tf": secureTerraform}, "SOC2")
+	if report.ComplianceReport == nil || report.ComplianceReport.Framework != "SOC2" {
+		t.Fatalf("compliance report = %+v", report.ComplianceReport)
+	}
+	// The compliance remediation follows the findings' recommendations
+	if !hasRecommendation(report, "Enable access-control to meet compliance") {
+		t.Errorf("recommendations %v lack the SOC2 remediation", report.Recommendations)
+	}
+}
+
+func TestParseTerraform(t *testing.T) {
+	blocks, err := parseTerraform("main.tf", `
+variable "region" { default = "us-east-1" }
+
+resource "aws_instance" "web" {
+  tags = {
+    Name = "web-${var.environment}" # not a block
+  }
+  user_data = <<-EOT
+    #!/bin/bash
+    echo "}"
+  EOT
+  ingress { cidr_blocks = ["0.0.0.0/0"] }
+  instance_type = var.large ? "m5.xlarge" : "t3.small"
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0].Address() != "variable.region" || blocks[1].Address() != "aws_instance.web" {
+		t.Fatalf("blocks = %+v", blocks)
+	}
+	web := blocks[1]
+	want := map[string]string{
+		"tags.Name":           "web-${var.environment}",
+		"user_data":           "<<-EOT",
+		"ingress.cidr_blocks": `["0.0.0.0/0"]`,
+		"instance_type":       `var.large ? "m5.xlarge" : "t3.small"`,
+	}
+	for key, value := range want {
+		if web.Attrs[key] != value {
+			t.Errorf("%s = %q, want %q", key, web.Attrs[key], value)
+		}
+	}
+	if !web.Blocks["ingress"] || !web.Blocks["tags"] || web.Line != 4 {
+		t.Errorf("blocks %v on line %d", web.Blocks, web.Line)
+	}
+
+	for code, want := range map[string]string{
+		"resource \"a\" \"b\" {\n":        `main.tf: line 1: block a.b is never closed`,
+		"}\n":                             `main.tf: line 1: unexpected }`,
+		"instance_type = \"m5.large\"\n":  `main.tf: line 1: expected a block, got "instance_type = \"m5.large\""`,
+		"locals {\n  x = <<EOF\n  y\n}\n": `main.tf: line 2: heredoc EOF is never closed`,
+	} {
+		if _, err := parseTerraform("main.tf", code); err == nil || err.Error() != want {
+			t.Errorf("%q: err = %v, want %s", code, err, want)
+		}
+	}
+}
+
+func TestInstanceVCPUs(t *testing.T) {
+	for machineType, want := range map[string]int{
+		"t3.small": 0, "m6i.xlarge": 4, "c5.9xlarge": 36, "m5.metal": 96,
+		"e2-standard-4": 4, "n2-highmem-32": 32, "db-custom-4-15360": 0,
+		"Standard_B2s": 2, "Standard_D64s_v5": 64, "var.instance_type": 0,
+	} {
+		if got := instanceVCPUs(machineType); got != want {
+			t.Errorf("instanceVCPUs(%q) = %d, want %d", machineType, got, want)
+		}
+	}
+}
+
+func TestHandleAnalyze(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/analyze", NewQInfraEngine().handleAnalyze)
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"code": map[string]string{"main.tf": strings.Replace(secureTerraform, "encrypted = true", "encrypted = false", 1)},
+	})
+	w := post(string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d %s", w.Code, w.Body)
+	}
+	var report AnalysisReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if report.SecurityScore != 75 || report.Recommendations[0] != "Enable encryption at rest" {
+		t.Errorf("report = %+v", report)
+	}
+
+	for body, want := range map[string]string{
+		`{"code": {}}`: "at least one file",
+		`{"code": {"main.tf": "resource \"a\" \"b\" {"}}`:        "never closed",
+		`{"code": {"main.tf": ""}, "compliance": ["ISO-27001"]}`: "unknown compliance framework",
+		`{"code": "main.tf"}`: "cannot unmarshal",
+	} {
+		if w := post(body); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: %d %s, want 400 %s", body, w.Code, w.Body, want)
+		}
+	}
+}
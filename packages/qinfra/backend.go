@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Generated terraform keeps its state in a remote backend: S3 with a
+// DynamoDB lock table on AWS, GCS on GCP and an Azure storage container on
+// Azure. The request metadata supplies the backend and the environment,
+// and each environment's state is kept under its own key.
+
+// deployConfig is where generated code is deployed: the environment, its
+// state backend and what deploy scripts need beyond the code
+type deployConfig struct {
+	Environment string
+	Project     string
+	Region      string
+	Namespace   string // kubernetes; defaults to the environment
+	// State backend: a bucket (an Azure storage account) for terraform and
+	// pulumi, with a DynamoDB lock table on AWS and a resource group and
+	// container on Azure
+	StateBucket        string
+	StateLockTable     string
+	StateRegion        string
+	StateKey           string // the state object, or on GCS its prefix
+	StateResourceGroup string
+	StateContainer     string
+}
+
+// deployMetadataKeys maps request metadata keys to the config they set
+var deployMetadataKeys = map[string]func(*deployConfig) *string{
+	"environment":          func(c *deployConfig) *string { return &c.Environment },
+	"project_name":         func(c *deployConfig) *string { return &c.Project },
+	"region":               func(c *deployConfig) *string { return &c.Region },
+	"namespace":            func(c *deployConfig) *string { return &c.Namespace },
+	"state_bucket":         func(c *deployConfig) *string { return &c.StateBucket },
+	"state_lock_table":     func(c *deployConfig) *string { return &c.StateLockTable },
+	"state_region":         func(c *deployConfig) *string { return &c.StateRegion },
+	"state_key":            func(c *deployConfig) *string { return &c.StateKey },
+	"state_resource_group": func(c *deployConfig) *string { return &c.StateResourceGroup },
+	"state_container":      func(c *deployConfig) *string { return &c.StateContainer },
+}
+
+// Values end up inside double quoted shell words, so they are kept to
+// characters that mean nothing there
+var deployValuePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/:-]*$`)
+
+// newDeployConfig reads the deploy settings from the request metadata
+func newDeployConfig(req InfraRequest) (deployConfig, error) {
+	config := deployConfig{Environment: "dev", Project: "quantum-infra", Region: "us-east-1", StateContainer: "tfstate"}
+	keys := make([]string, 0, len(deployMetadataKeys))
+	for key := range deployMetadataKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		raw, ok := req.Metadata[key]
+		if !ok || raw == nil {
+			continue
+		}
+		value, ok := raw.(string)
+		if !ok {
+			return config, fmt.Errorf("metadata %s must be a string", key)
+		}
+		if value == "" {
+			continue
+		}
+		if !deployValuePattern.MatchString(value) {
+			return config, fmt.Errorf("metadata %s %q may only contain letters, digits and . _ / : -", key, value)
+		}
+		*deployMetadataKeys[key](&config) = value
+	}
+	if config.StateRegion == "" {
+		config.StateRegion = config.Region
+	}
+	return config, nil
+}
+
+// terraformBackends are the backend types terraform state goes to
+var terraformBackends = map[string]string{"aws": "s3", "gcp": "gcs", "azure": "azurerm"}
+
+func terraformBackend(provider string) string {
+	if backend, ok := terraformBackends[provider]; ok {
+		return backend
+	}
+	return terraformBackends["aws"]
+}
+
+// terraformStateKey is where an environment's state goes by default, one
+// key per project and environment. On GCS it is a prefix.
+func terraformStateKey(backend, project, environment string) string {
+	if backend == "gcs" {
+		return project + "/" + environment
+	}
+	return project + "/" + environment + "/terraform.tfstate"
+}
+
+// generateTerraformBackend declares the provider's state backend with the
+// settings the metadata gives. Settings left out, such as a missing
+// bucket, are supplied by the deploy script at init.
+func (q *QInfraEngine) generateTerraformBackend(provider string, config deployConfig) string {
+	backend := terraformBackend(provider)
+	key := config.StateKey
+	if key == "" {
+		key = terraformStateKey(backend, config.Project, config.Environment)
+	}
+	var settings [][2]string
+	set := func(name, value string) {
+		if value != "" {
+			settings = append(settings, [2]string{name, fmt.Sprintf("%q", value)})
+		}
+	}
+	switch backend {
+	case "s3":
+		set("bucket", config.StateBucket)
+		set("key", key)
+		set("region", config.StateRegion)
+		set("dynamodb_table", config.StateLockTable)
+		settings = append(settings, [2]string{"encrypt", "true"})
+	case "gcs":
+		set("bucket", config.StateBucket)
+		set("prefix", key)
+	case "azurerm":
+		set("resource_group_name", config.StateResourceGroup)
+		set("storage_account_name", config.StateBucket)
+		set("container_name", config.StateContainer)
+		set("key", key)
+	}
+
+	width := 0
+	for _, s := range settings {
+		if len(s[0]) > width {
+			width = len(s[0])
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "terraform {\n  backend %q {\n", backend)
+	for _, s := range settings {
+		fmt.Fprintf(&b, "    %-*s = %s\n", width, s[0], s[1])
+	}
+	b.WriteString("  }\n}")
+	return b.String()
+}
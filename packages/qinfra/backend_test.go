@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// terraformBackendFor generates terraform for provider and returns its
+// backend.tf
+func terraformBackendFor(t *testing.T, provider string, metadata map[string]interface{}) string {
+	t.Helper()
+	req := testInfraRequest()
+	req.Provider = provider
+	req.Metadata = metadata
+	req.DryRun = true
+	resp, err := NewQInfraEngine().GenerateInfra(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Code["backend.tf"]
+}
+
+func TestTerraformBackendMatchesProvider(t *testing.T) {
+	metadata := map[string]interface{}{
+		"environment":          "staging",
+		"project_name":         "shop",
+		"region":               "eu-west-1",
+		"state_bucket":         "acme-tf-state",
+		"state_lock_table":     "tf-locks",
+		"state_resource_group": "tf-rg",
+	}
+	tests := []struct {
+		provider string
+		want     []string
+		wantNot  []string
+	}{
+		{"aws", []string{
+			`backend "s3"`, `bucket         = "acme-tf-state"`, `key            = "shop/staging/terraform.tfstate"`,
+			`region         = "eu-west-1"`, `dynamodb_table = "tf-locks"`, `encrypt        = true`,
+		}, []string{"prefix", "storage_account_name"}},
+		{"gcp", []string{
+			`backend "gcs"`, `bucket = "acme-tf-state"`, `prefix = "shop/staging"`,
+		}, []string{"dynamodb_table", "key"}},
+		{"azure", []string{
+			`backend "azurerm"`, `storage_account_name = "acme-tf-state"`, `resource_group_name  = "tf-rg"`,
+			`container_name       = "tfstate"`, `key                  = "shop/staging/terraform.tfstate"`,
+		}, []string{"dynamodb_table", "bucket"}},
+	}
+	for _, tt := range tests {
+		backend := terraformBackendFor(t, tt.provider, metadata)
+		for _, want := range tt.want {
+			if !strings.Contains(backend, want) {
+				t.Errorf("%s backend lacks %q:\n%s", tt.provider, want, backend)
+			}
+		}
+		for _, unwanted := range tt.wantNot {
+			if strings.Contains(backend, unwanted) {
+				t.Errorf("%s backend sets %s:\n%s", tt.provider, unwanted, backend)
+			}
+		}
+	}
+}
+
+func TestTerraformStateKeyedByEnvironment(t *testing.T) {
+	backends := make(map[string]string)
+	for _, env := range []string{"dev", "staging", "prod"} {
+		backend := terraformBackendFor(t, "aws", map[string]interface{}{"environment": env})
+		if want := `"quantum-infra/` + env + `/terraform.tfstate"`; !strings.Contains(backend, want) {
+			t.Errorf("%s backend lacks key %s:\n%s", env, want, backend)
+		}
+		for other, otherBackend := range backends {
+			if otherBackend == backend {
+				t.Errorf("%s and %s share a backend:\n%s", env, other, backend)
+			}
+		}
+		backends[env] = backend
+
+		// Without a bucket the setting is left to init
+		if strings.Contains(backend, "bucket") {
+			t.Errorf("%s backend without a state bucket:\n%s", env, backend)
+		}
+	}
+
+	if backend := terraformBackendFor(t, "gcp", map[string]interface{}{"environment": "prod"}); !strings.Contains(backend, `prefix = "quantum-infra/prod"`) {
+		t.Errorf("gcs backend isn't prefixed by environment:\n%s", backend)
+	}
+	if backend := terraformBackendFor(t, "aws", map[string]interface{}{"state_key": "legacy/terraform.tfstate"}); !strings.Contains(backend, `= "legacy/terraform.tfstate"`) {
+		t.Errorf("state_key not used:\n%s", backend)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DataCenterRequirements is the capacity a data center has to provide
+type DataCenterRequirements struct {
+	VCPUs     int     `json:"vcpus"`
+	MemoryGB  int     `json:"memory_gb"`
+	StorageTB float64 `json:"storage_tb,omitempty"` // usable, after replication
+	// Tier is the Uptime Institute tier, 1 to 4, defaulting to 3
+	Tier int `json:"tier,omitempty"`
+	// PowerBudgetKW caps the facility's draw, including cooling; 0 means
+	// no cap
+	PowerBudgetKW float64 `json:"power_budget_kw,omitempty"`
+	// MaxRacks caps the floor space; 0 means no cap
+	MaxRacks int `json:"max_racks,omitempty"`
+	// RackPowerKW is what each rack can be fed, defaulting to 12 kW
+	RackPowerKW float64 `json:"rack_power_kw,omitempty"`
+}
+
+// DataCenterPlan is the hardware, power and cooling that meet the
+// requirements. An infeasible plan lists the constraints it breaks.
+type DataCenterPlan struct {
+	Tier         string                 `json:"tier"`
+	Availability string                 `json:"availability"`
+	Feasible     bool                   `json:"feasible"`
+	Issues       []string               `json:"issues"`
+	Servers      ServerPlan             `json:"servers"`
+	Racks        RackPlan               `json:"racks"`
+	Power        PowerPlan              `json:"power"`
+	Cooling      CoolingPlan            `json:"cooling"`
+	Network      NetworkPlan            `json:"network"`
+	Requirements DataCenterRequirements `json:"requirements"`
+}
+
+// ServerPlan counts servers, with the capacity they provide
+type ServerPlan struct {
+	Compute   int     `json:"compute"`
+	Spare     int     `json:"spare"` // compute servers held for failures
+	Storage   int     `json:"storage"`
+	Total     int     `json:"total"`
+	VCPUs     int     `json:"vcpus"`
+	MemoryGB  int     `json:"memory_gb"`
+	StorageTB float64 `json:"storage_tb"`
+}
+
+// RackPlan counts racks
+type RackPlan struct {
+	Count          int     `json:"count"`
+	ServersPerRack int     `json:"servers_per_rack"`
+	PowerKW        float64 `json:"power_kw"` // feed per rack
+}
+
+// PowerPlan is the facility's electrical load and the UPS capacity behind it
+type PowerPlan struct {
+	ITLoadKW      float64 `json:"it_load_kw"`
+	PUE           float64 `json:"pue"`
+	FacilityKW    float64 `json:"facility_kw"`
+	Redundancy    string  `json:"redundancy"`
+	UPSModules    int     `json:"ups_modules"`
+	UPSModuleKW   float64 `json:"ups_module_kw"`
+	ProvisionedKW float64 `json:"provisioned_kw"`
+	Generators    int     `json:"generators"`
+}
+
+// CoolingPlan is the heat to remove and the units removing it
+type CoolingPlan struct {
+	HeatLoadKW float64 `json:"heat_load_kw"`
+	Tons       float64 `json:"tons"`
+	Redundancy string  `json:"redundancy"`
+	Units      int     `json:"units"`
+	UnitKW     float64 `json:"unit_kw"`
+}
+
+// NetworkPlan counts switches in a leaf-spine fabric
+type NetworkPlan struct {
+	ToRSwitches   int    `json:"tor_switches"`
+	SpineSwitches int    `json:"spine_switches"`
+	ServerUplink  string `json:"server_uplink"`
+	Redundant     bool   `json:"redundant"`
+}
+
+// Reference hardware the plan is built from
+const (
+	serverVCPUs     = 64
+	serverMemoryGB  = 512
+	serverKW        = 0.8
+	serverUnits     = 2 // rack units
+	storageNodeTB   = 240.0
+	storageReplicas = 3
+	storageNodeKW   = 0.6
+	rackUnits       = 42
+	rackNetworkU    = 4 // for switches and patch panels
+	rackNetworkKW   = 0.5
+	defaultRackKW   = 12
+	leavesPerSpine  = 32
+	upsModuleKW     = 250
+	generatorKW     = 1000
+	coolingUnitKW   = 100
+	kwPerTon        = 3.517
+)
+
+// dataCenterTier is what a tier commits to
+type dataCenterTier struct {
+	Name         string
+	Availability string
+	// Redundancy of power and cooling components: N, N+1 or 2N
+	Redundancy string
+	// SpareFraction of compute servers held for failures
+	SpareFraction float64
+	PUE           float64
+	// RedundantNetwork puts two switches in each rack
+	RedundantNetwork bool
+}
+
+var dataCenterTiers = map[int]dataCenterTier{
+	1: {"Tier I", "99.671%", "N", 0, 1.8, false},
+	2: {"Tier II", "99.741%", "N+1", 0.05, 1.7, false},
+	3: {"Tier III", "99.982%", "N+1", 0.1, 1.5, true},
+	4: {"Tier IV", "99.995%", "2N", 0.2, 1.5, true},
+}
+
+// withRedundancy is how many components to install when n of them carry
+// the load
+func withRedundancy(n int, redundancy string) int {
+	switch redundancy {
+	case "N+1":
+		return n + 1
+	case "2N":
+		return 2 * n
+	}
+	return n
+}
+
+func ceilDiv(load, capacity float64) int {
+	return int(math.Ceil(load/capacity - 1e-9))
+}
+
+// PlanDataCenter sizes servers, racks, power and cooling for the
+// requirements
+func (d *DataCenterManager) PlanDataCenter(req DataCenterRequirements) (*DataCenterPlan, error) {
+	if req.Tier == 0 {
+		req.Tier = 3
+	}
+	if req.RackPowerKW == 0 {
+		req.RackPowerKW = defaultRackKW
+	}
+	tier, ok := dataCenterTiers[req.Tier]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("tier must be 1 to 4, got %d", req.Tier)
+	case req.VCPUs < 0 || req.MemoryGB < 0 || req.StorageTB < 0 || req.PowerBudgetKW < 0 || req.MaxRacks < 0:
+		return nil, fmt.Errorf("capacity, power budget and rack limits can't be negative")
+	case req.VCPUs == 0 && req.MemoryGB == 0 && req.StorageTB == 0:
+		return nil, fmt.Errorf("requirements need vcpus, memory_gb or storage_tb")
+	case req.RackPowerKW < serverKW+rackNetworkKW:
+		return nil, fmt.Errorf("rack_power_kw %.1f can't power a single server", req.RackPowerKW)
+	}
+
+	plan := &DataCenterPlan{Tier: tier.Name, Availability: tier.Availability, Issues: []string{}, Requirements: req}
+
+	// Enough servers for both CPU and memory, plus spares
+	s := &plan.Servers
+	s.Compute = max(ceilDiv(float64(req.VCPUs), serverVCPUs), ceilDiv(float64(req.MemoryGB), serverMemoryGB))
+	s.Spare = int(math.Ceil(float64(s.Compute) * tier.SpareFraction))
+	s.Storage = ceilDiv(req.StorageTB*storageReplicas, storageNodeTB)
+	if s.Storage > 0 {
+		// Replicas go on different nodes
+		s.Storage = max(s.Storage, storageReplicas)
+	}
+	s.Total = s.Compute + s.Spare + s.Storage
+	s.VCPUs = (s.Compute + s.Spare) * serverVCPUs
+	s.MemoryGB = (s.Compute + s.Spare) * serverMemoryGB
+	s.StorageTB = float64(s.Storage) * storageNodeTB / storageReplicas
+
+	// Racks fill up on space or power, whichever runs out first. Storage
+	// nodes are counted at the compute server's draw to keep racks uniform.
+	r := &plan.Racks
+	r.PowerKW = req.RackPowerKW
+	r.ServersPerRack = min((rackUnits-rackNetworkU)/serverUnits, int((req.RackPowerKW-rackNetworkKW)/serverKW))
+	r.Count = ceilDiv(float64(s.Total), float64(r.ServersPerRack))
+
+	p := &plan.Power
+	p.ITLoadKW = round1(float64(s.Compute+s.Spare)*serverKW + float64(s.Storage)*storageNodeKW + float64(r.Count)*rackNetworkKW)
+	p.PUE = tier.PUE
+	p.FacilityKW = round1(p.ITLoadKW * p.PUE)
+	p.Redundancy = tier.Redundancy
+	p.UPSModuleKW = upsModuleKW
+	p.UPSModules = withRedundancy(ceilDiv(p.ITLoadKW, upsModuleKW), tier.Redundancy)
+	p.ProvisionedKW = float64(p.UPSModules) * upsModuleKW
+	p.Generators = withRedundancy(ceilDiv(p.FacilityKW, generatorKW), tier.Redundancy)
+
+	// Every kW of IT load ends up as heat
+	c := &plan.Cooling
+	c.HeatLoadKW = p.ITLoadKW
+	c.Tons = round1(c.HeatLoadKW / kwPerTon)
+	c.Redundancy = tier.Redundancy
+	c.UnitKW = coolingUnitKW
+	c.Units = withRedundancy(ceilDiv(c.HeatLoadKW, coolingUnitKW), tier.Redundancy)
+
+	n := &plan.Network
+	n.Redundant = tier.RedundantNetwork
+	n.ToRSwitches = r.Count
+	n.SpineSwitches = ceilDiv(float64(r.Count), leavesPerSpine)
+	n.ServerUplink = "25Gbps"
+	if n.Redundant {
+		n.ToRSwitches *= 2
+		n.SpineSwitches = max(2, n.SpineSwitches*2)
+		n.ServerUplink = "2x25Gbps"
+	}
+
+	if req.PowerBudgetKW > 0 && p.FacilityKW > req.PowerBudgetKW {
+		plan.Issues = append(plan.Issues, fmt.Sprintf(
+			"the facility draws %.1f kW (%.1f kW of IT load at PUE %.1f), over the %.1f kW power budget",
+			p.FacilityKW, p.ITLoadKW, p.PUE, req.PowerBudgetKW))
+	}
+	if req.MaxRacks > 0 && r.Count > req.MaxRacks {
+		plan.Issues = append(plan.Issues, fmt.Sprintf(
+			"%d racks are needed at %d servers per rack, more than the %d that fit", r.Count, r.ServersPerRack, req.MaxRacks))
+	}
+	plan.Feasible = len(plan.Issues) == 0
+	return plan, nil
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// handleDataCenterPlan serves POST /datacenter/plan
+func (q *QInfraEngine) handleDataCenterPlan(c *gin.Context) {
+	var req struct {
+		Requirements *DataCenterRequirements `json:"requirements" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := q.dataCenterMgr.PlanDataCenter(*req.Requirements)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, plan)
+}
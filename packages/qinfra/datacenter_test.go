@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func planDataCenter(t *testing.T, req DataCenterRequirements) *DataCenterPlan {
+	t.Helper()
+	plan, err := NewDataCenterManager().PlanDataCenter(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestPlanDataCenterScales(t *testing.T) {
+	small := planDataCenter(t, DataCenterRequirements{VCPUs: 512, MemoryGB: 2048})
+	large := planDataCenter(t, DataCenterRequirements{VCPUs: 32000, MemoryGB: 512000, StorageTB: 2000})
+
+	if small.Servers.Compute != 8 || small.Servers.Spare != 1 || small.Racks.Count != 1 {
+		t.Errorf("small plan = %+v servers in %+v, want 8 compute, 1 spare, 1 rack", small.Servers, small.Racks)
+	}
+	if small.Servers.VCPUs < 512 || small.Servers.MemoryGB < 2048 {
+		t.Errorf("small plan provides %+v, under the requirements", small.Servers)
+	}
+	// Memory, not CPU, decides the large plan's compute servers
+	if large.Servers.Compute != 1000 || large.Servers.StorageTB < 2000 {
+		t.Errorf("large plan servers = %+v", large.Servers)
+	}
+
+	for _, got := range []struct {
+		name         string
+		small, large float64
+	}{
+		{"servers", float64(small.Servers.Total), float64(large.Servers.Total)},
+		{"racks", float64(small.Racks.Count), float64(large.Racks.Count)},
+		{"IT load", small.Power.ITLoadKW, large.Power.ITLoadKW},
+		{"UPS modules", float64(small.Power.UPSModules), float64(large.Power.UPSModules)},
+		{"cooling units", float64(small.Cooling.Units), float64(large.Cooling.Units)},
+		{"spine switches", float64(small.Network.SpineSwitches), float64(large.Network.SpineSwitches)},
+	} {
+		if got.large <= got.small {
+			t.Errorf("%s: large plan %v <= small plan %v", got.name, got.large, got.small)
+		}
+	}
+	if large.Power.FacilityKW != round1(large.Power.ITLoadKW*1.5) || large.Cooling.HeatLoadKW != large.Power.ITLoadKW {
+		t.Errorf("large power %+v, cooling %+v", large.Power, large.Cooling)
+	}
+	if !small.Feasible || !large.Feasible {
+		t.Errorf("unconstrained plans infeasible: %v %v", small.Issues, large.Issues)
+	}
+}
+
+func TestPlanDataCenterTierRedundancy(t *testing.T) {
+	req := DataCenterRequirements{VCPUs: 32000, MemoryGB: 128000}
+	plans := make(map[int]*DataCenterPlan)
+	for tier := 1; tier <= 4; tier++ {
+		req.Tier = tier
+		plans[tier] = planDataCenter(t, req)
+	}
+
+	// How much UPS and cooling capacity may fail while the load is still
+	// carried: none at tier I, one unit at II and III, half at IV
+	for tier, plan := range plans {
+		power, cooling := plan.Power, plan.Cooling
+		var ups, units int
+		switch tier {
+		case 1:
+			ups, units = 0, 0
+		case 2, 3:
+			ups, units = 1, 1
+		case 4:
+			ups, units = power.UPSModules/2, cooling.Units/2
+		}
+		if float64(power.UPSModules-ups)*power.UPSModuleKW < power.ITLoadKW || float64(power.UPSModules-ups-1)*power.UPSModuleKW >= power.ITLoadKW {
+			t.Errorf("tier %d: %d UPS modules for %.1f kW, want %d spare", tier, power.UPSModules, power.ITLoadKW, ups)
+		}
+		if float64(cooling.Units-units)*cooling.UnitKW < cooling.HeatLoadKW || float64(cooling.Units-units-1)*cooling.UnitKW >= cooling.HeatLoadKW {
+			t.Errorf("tier %d: %d cooling units for %.1f kW, want %d spare", tier, cooling.Units, cooling.HeatLoadKW, units)
+		}
+	}
+	if plans[1].Power.Redundancy != "N" || plans[3].Power.Redundancy != "N+1" || plans[4].Cooling.Redundancy != "2N" {
+		t.Errorf("redundancy by tier = %s, %s, %s", plans[1].Power.Redundancy, plans[3].Power.Redundancy, plans[4].Cooling.Redundancy)
+	}
+	if plans[1].Servers.Spare != 0 || plans[4].Servers.Spare <= plans[3].Servers.Spare {
+		t.Errorf("spares by tier = %d, %d, %d", plans[1].Servers.Spare, plans[3].Servers.Spare, plans[4].Servers.Spare)
+	}
+	if plans[1].Network.Redundant || !plans[3].Network.Redundant || plans[3].Network.ToRSwitches != 2*plans[3].Racks.Count {
+		t.Errorf("network tier I %+v, tier III %+v", plans[1].Network, plans[3].Network)
+	}
+	if plans[4].Tier != "Tier IV" || plans[4].Availability != "99.995%" {
+		t.Errorf("tier IV plan = %s %s", plans[4].Tier, plans[4].Availability)
+	}
+}
+
+func TestPlanDataCenterFlagsInfeasibleConstraints(t *testing.T) {
+	plan := planDataCenter(t, DataCenterRequirements{VCPUs: 64000, MemoryGB: 256000, PowerBudgetKW: 100, MaxRacks: 5})
+	if plan.Feasible || len(plan.Issues) != 2 {
+		t.Fatalf("plan feasible %v with issues %v, want the power budget and racks flagged", plan.Feasible, plan.Issues)
+	}
+	if !strings.Contains(plan.Issues[0], "100.0 kW power budget") || !strings.Contains(plan.Issues[1], "more than the 5") {
+		t.Errorf("issues = %v", plan.Issues)
+	}
+
+	// Lower density racks need more of them
+	dense := planDataCenter(t, DataCenterRequirements{VCPUs: 6400})
+	sparse := planDataCenter(t, DataCenterRequirements{VCPUs: 6400, RackPowerKW: 5})
+	if sparse.Racks.ServersPerRack >= dense.Racks.ServersPerRack || sparse.Racks.Count <= dense.Racks.Count {
+		t.Errorf("5 kW racks %+v vs 12 kW racks %+v", sparse.Racks, dense.Racks)
+	}
+
+	for _, req := range []DataCenterRequirements{
+		{},
+		{VCPUs: 64, Tier: 5},
+		{VCPUs: -1},
+		{VCPUs: 64, RackPowerKW: 1},
+	} {
+		if _, err := NewDataCenterManager().PlanDataCenter(req); err == nil {
+			t.Errorf("%+v accepted", req)
+		}
+	}
+}
+
+func TestHandleDataCenterPlan(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/datacenter/plan", NewQInfraEngine().handleDataCenterPlan)
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/datacenter/plan", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(`{"requirements": {"vcpus": 1024, "tier": 4}}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"tier":"Tier IV"`) {
+		t.Errorf("plan = %d %s", w.Code, w.Body)
+	}
+	for _, body := range []string{`{}`, `{"requirements": "1000 servers"}`, `{"requirements": {"vcpus": 64, "tier": 9}}`} {
+		if w := post(body); w.Code != http.StatusBadRequest {
+			t.Errorf("plan %s = %d, want 400", body, w.Code)
+		}
+	}
+}
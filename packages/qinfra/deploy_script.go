@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Deploy scripts are generated per framework. Each one takes the target
+// environment and state backend from the request metadata, lets the
+// environment override them, shows what will change and asks before
+// changing anything unless run with --auto-approve.
+
+// scriptPrelude starts every deploy script: strict mode, running from the
+// script's directory, argument parsing and the confirmation gate
+const scriptPrelude = `#!/usr/bin/env bash
+# Generated by QInfra Engine
+set -euo pipefail
+cd "$(dirname "$0")"
+
+usage() {
+  echo "usage: $0 [--auto-approve]" >&2
+  echo "Settings can be overridden through the environment variables set below." >&2
+}
+
+AUTO_APPROVE=false
+for arg in "$@"; do
+  case "$arg" in
+    --auto-approve) AUTO_APPROVE=true ;;
+    -h|--help) usage; exit 0 ;;
+    *) usage; exit 2 ;;
+  esac
+done
+
+# require fails unless the named variable is set
+require() {
+  if [ -z "${!1:-}" ]; then
+    echo "$1 must be set: $2" >&2
+    exit 1
+  fi
+}
+
+confirm() {
+  if [ "$AUTO_APPROVE" = true ]; then
+    return 0
+  fi
+  if [ ! -t 0 ]; then
+    echo "No terminal to confirm on; review the changes above and rerun with --auto-approve" >&2
+    exit 1
+  fi
+  local answer
+  read -r -p "$1 [y/N] " answer
+  case "$answer" in
+    y|Y|yes|YES) ;;
+    *) echo "Aborted, nothing was changed"; exit 1 ;;
+  esac
+}
+
+`
+
+// scriptFailureReport explains a failed run, with rollback instructions
+// once changes started. Scripts define rollback_instructions.
+const scriptFailureReport = `
+STAGE=prepare
+on_exit() {
+  local status=$?
+  if [ "$status" -eq 0 ]; then
+    return
+  fi
+  if [ "$STAGE" = apply ]; then
+    echo "Deployment to $ENVIRONMENT failed while applying changes." >&2
+    rollback_instructions >&2
+  else
+    echo "Deployment to $ENVIRONMENT stopped before applying anything." >&2
+  fi
+}
+trap on_exit EXIT
+`
+
+// generateDeployScript writes the deploy script for the code generated for
+// framework
+func (q *QInfraEngine) generateDeployScript(framework string, req InfraRequest, config deployConfig) string {
+	var b strings.Builder
+	b.WriteString(scriptPrelude)
+	fmt.Fprintf(&b, "ENVIRONMENT=\"${ENVIRONMENT:-%s}\"\n", config.Environment)
+	fmt.Fprintf(&b, "PROJECT=\"${PROJECT:-%s}\"\n", config.Project)
+	b.WriteString(scriptFailureReport)
+
+	switch framework {
+	case "terraform":
+		writeTerraformDeploy(&b, req, config)
+	case "pulumi":
+		writePulumiDeploy(&b, req.Provider, config)
+	case "kubernetes":
+		writeKubernetesDeploy(&b, config)
+	case "docker-compose":
+		writeComposeDeploy(&b)
+	default:
+		b.WriteString(`
+rollback_instructions() { :; }
+echo "No deploy script for ` + framework + `; deploy the generated files manually" >&2
+exit 1
+`)
+	}
+	return b.String()
+}
+
+func writeTerraformDeploy(b *strings.Builder, req InfraRequest, config deployConfig) {
+	b.WriteString("export TF_VAR_environment=\"$ENVIRONMENT\"\n")
+	b.WriteString("export TF_VAR_project_name=\"$PROJECT\"\n")
+	fmt.Fprintf(b, "export TF_VAR_region=\"${TF_VAR_region:-%s}\"\n", config.Region)
+
+	// Variables without a default have to come from the environment
+	resources, _ := NormalizeResources(req.Resources)
+	extra := rendererFor(req.Provider).Variables(resources)
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(b, "require TF_VAR_%s %q\n", name, strings.ToLower(extra[name][:1])+extra[name][1:])
+	}
+
+	b.WriteString("\n# State backend\n")
+	fmt.Fprintf(b, "TF_STATE_BUCKET=\"${TF_STATE_BUCKET:-%s}\"\n", config.StateBucket)
+	// The default key follows the environment the script deploys to
+	key := config.StateKey
+	if key == "" {
+		key = terraformStateKey(terraformBackend(req.Provider), "$PROJECT", "$ENVIRONMENT")
+	}
+	fmt.Fprintf(b, "TF_STATE_KEY=\"${TF_STATE_KEY:-%s}\"\n", key)
+	backendConfig := []string{`-backend-config="key=$TF_STATE_KEY"`}
+	switch terraformBackend(req.Provider) {
+	case "s3":
+		fmt.Fprintf(b, "TF_STATE_REGION=\"${TF_STATE_REGION:-%s}\"\n", config.StateRegion)
+		fmt.Fprintf(b, "TF_STATE_LOCK_TABLE=\"${TF_STATE_LOCK_TABLE:-%s}\"\n", config.StateLockTable)
+		b.WriteString("require TF_STATE_BUCKET \"the S3 bucket holding terraform state\"\n")
+		b.WriteString("require TF_STATE_LOCK_TABLE \"the DynamoDB table locking terraform state\"\n")
+		backendConfig = append(backendConfig,
+			`-backend-config="bucket=$TF_STATE_BUCKET"`,
+			`-backend-config="region=$TF_STATE_REGION"`,
+			`-backend-config="dynamodb_table=$TF_STATE_LOCK_TABLE"`,
+			`-backend-config="encrypt=true"`)
+	case "gcs":
+		// GCS locks state itself
+		b.WriteString("require TF_STATE_BUCKET \"the GCS bucket holding terraform state\"\n")
+		backendConfig = []string{`-backend-config="bucket=$TF_STATE_BUCKET"`, `-backend-config="prefix=$TF_STATE_KEY"`}
+	case "azurerm":
+		fmt.Fprintf(b, "TF_STATE_RESOURCE_GROUP=\"${TF_STATE_RESOURCE_GROUP:-%s}\"\n", config.StateResourceGroup)
+		fmt.Fprintf(b, "TF_STATE_CONTAINER=\"${TF_STATE_CONTAINER:-%s}\"\n", config.StateContainer)
+		b.WriteString("require TF_STATE_BUCKET \"the storage account holding terraform state\"\n")
+		b.WriteString("require TF_STATE_RESOURCE_GROUP \"the resource group of the state storage account\"\n")
+		backendConfig = append(backendConfig,
+			`-backend-config="storage_account_name=$TF_STATE_BUCKET"`,
+			`-backend-config="container_name=$TF_STATE_CONTAINER"`,
+			`-backend-config="resource_group_name=$TF_STATE_RESOURCE_GROUP"`)
+	}
+
+	fmt.Fprintf(b, `
+rollback_instructions() {
+  echo "Terraform records what it changed before failing in the $ENVIRONMENT workspace state."
+  echo "To roll back, check out the previous version of this code and rerun this script,"
+  echo "or inspect the state with: terraform workspace select $ENVIRONMENT && terraform state list"
+  echo "If the state is left locked, release it with: terraform force-unlock <lock id>"
+}
+
+terraform init -input=false -reconfigure \
+  %s
+
+# One workspace per environment keeps their state apart
+terraform workspace select "$ENVIRONMENT" 2>/dev/null || terraform workspace new "$ENVIRONMENT"
+
+terraform validate
+terraform plan -input=false -out=tfplan
+terraform show -no-color tfplan > tfplan.txt
+echo "Plan for $ENVIRONMENT (full plan in tfplan.txt):"
+grep -E '^(Plan:|No changes|Changes to Outputs)' tfplan.txt || true
+if grep -q '^No changes' tfplan.txt; then
+  exit 0
+fi
+
+confirm "Apply this plan to $ENVIRONMENT?"
+STAGE=apply
+terraform apply -input=false tfplan
+echo "Deployed $PROJECT to $ENVIRONMENT"
+`, strings.Join(backendConfig, " \\\n  "))
+}
+
+// pulumiBackends are the URL schemes of self-managed pulumi state
+var pulumiBackends = map[string]string{"aws": "s3", "gcp": "gs", "azure": "azblob"}
+
+// pulumiRegionConfig is the config key each provider reads its region from
+var pulumiRegionConfig = map[string]string{"aws": "aws:region", "gcp": "gcp:region", "azure": "azure-native:location"}
+
+func writePulumiDeploy(b *strings.Builder, provider string, config deployConfig) {
+	// Pulumi Cloud is used unless a state bucket is given
+	backend := ""
+	if config.StateBucket != "" {
+		scheme, ok := pulumiBackends[provider]
+		if !ok {
+			scheme = pulumiBackends["aws"]
+		}
+		backend = scheme + "://" + config.StateBucket
+		if scheme == "azblob" {
+			backend = scheme + "://" + config.StateContainer
+		}
+	}
+	fmt.Fprintf(b, "PULUMI_BACKEND_URL=\"${PULUMI_BACKEND_URL:-%s}\"\n", backend)
+	b.WriteString("PULUMI_STACK=\"${PULUMI_STACK:-$ENVIRONMENT}\"\n")
+	fmt.Fprintf(b, "REGION=\"${REGION:-%s}\"\n", config.Region)
+	if provider == "azure" && config.StateBucket != "" {
+		fmt.Fprintf(b, "export AZURE_STORAGE_ACCOUNT=\"${AZURE_STORAGE_ACCOUNT:-%s}\"\n", config.StateBucket)
+	}
+	if provider == "gcp" {
+		b.WriteString("require GCP_PROJECT \"the GCP project to deploy resources in\"\n")
+	}
+
+	b.WriteString(`
+rollback_instructions() {
+  echo "Pulumi recorded what it changed before failing in stack $PULUMI_STACK."
+  echo "Review it with: pulumi stack history --stack $PULUMI_STACK"
+  echo "If an update is still marked in progress, clear it with: pulumi cancel --stack $PULUMI_STACK"
+  echo "To roll back, check out the previous version of this code and rerun this script."
+}
+
+if [ -n "$PULUMI_BACKEND_URL" ]; then
+  pulumi login "$PULUMI_BACKEND_URL"
+else
+  pulumi whoami >/dev/null
+fi
+
+npm install --no-audit --no-fund
+
+# One stack per environment keeps their state apart
+pulumi stack select --create "$PULUMI_STACK"
+pulumi config set environment "$ENVIRONMENT" --stack "$PULUMI_STACK"
+pulumi config set project_name "$PROJECT" --stack "$PULUMI_STACK"
+`)
+	if key, ok := pulumiRegionConfig[provider]; ok {
+		fmt.Fprintf(b, "pulumi config set %s \"$REGION\" --stack \"$PULUMI_STACK\"\n", key)
+	}
+	if provider == "gcp" {
+		b.WriteString("pulumi config set gcp:project \"$GCP_PROJECT\" --stack \"$PULUMI_STACK\"\n")
+	}
+	b.WriteString(`
+pulumi preview --diff --stack "$PULUMI_STACK" | tee preview.txt
+
+confirm "Apply these changes to $ENVIRONMENT?"
+STAGE=apply
+pulumi up --yes --skip-preview --stack "$PULUMI_STACK"
+echo "Deployed $PROJECT to $ENVIRONMENT"
+`)
+}
+
+// qinfraLabel marks the objects a kubernetes deploy manages, so objects
+// dropped from the manifests are pruned and nothing else is
+const qinfraLabel = "app.kubernetes.io/managed-by=qinfra"
+
+// generateKustomization lists the manifests and labels everything they
+// declare for pruning
+func (q *QInfraEngine) generateKustomization(manifests []string, project string) string {
+	var b strings.Builder
+	b.WriteString("apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n")
+	for _, manifest := range manifests {
+		fmt.Fprintf(&b, "  - %s\n", manifest)
+	}
+	name, value, _ := strings.Cut(qinfraLabel, "=")
+	fmt.Fprintf(&b, "labels:\n  - pairs:\n      %s: %s\n      app.kubernetes.io/part-of: %s\n", name, value, project)
+	return b.String()
+}
+
+func writeKubernetesDeploy(b *strings.Builder, config deployConfig) {
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = "$ENVIRONMENT"
+	}
+	fmt.Fprintf(b, "NAMESPACE=\"${NAMESPACE:-%s}\"\n", namespace)
+	fmt.Fprintf(b, "SELECTOR=\"%s,app.kubernetes.io/part-of=$PROJECT\"\n", qinfraLabel)
+	b.WriteString(`
+rollback_instructions() {
+  echo "Some objects in namespace $NAMESPACE may already be updated."
+  echo "Roll a deployment back with: kubectl -n $NAMESPACE rollout undo deployment/<name>"
+  echo "List what is deployed with: kubectl -n $NAMESPACE get all -l $SELECTOR"
+}
+
+kubectl create namespace "$NAMESPACE" --dry-run=client -o yaml | kubectl apply -f -
+
+# kubectl diff exits 1 when there are differences
+diff_status=0
+kubectl diff -n "$NAMESPACE" -k . || diff_status=$?
+if [ "$diff_status" -gt 1 ]; then
+  exit "$diff_status"
+fi
+if [ "$diff_status" -eq 0 ]; then
+  echo "No changes to apply to $NAMESPACE"
+  exit 0
+fi
+
+confirm "Apply these changes to namespace $NAMESPACE?"
+STAGE=apply
+# Pruning removes labelled objects that are no longer in the manifests
+kubectl apply -n "$NAMESPACE" -k . --prune -l "$SELECTOR"
+kubectl rollout status -n "$NAMESPACE" deployment -l "$SELECTOR" --timeout=5m
+echo "Deployed $PROJECT to namespace $NAMESPACE"
+`)
+}
+
+func writeComposeDeploy(b *strings.Builder) {
+	b.WriteString(`
+rollback_instructions() {
+  echo "Check the containers with: docker compose -p $PROJECT-$ENVIRONMENT ps"
+  echo "Stop them with: docker compose -p $PROJECT-$ENVIRONMENT down"
+}
+
+docker compose -f docker-compose.yml -p "$PROJECT-$ENVIRONMENT" config --quiet
+confirm "Start $PROJECT in $ENVIRONMENT?"
+STAGE=apply
+docker compose -f docker-compose.yml -p "$PROJECT-$ENVIRONMENT" up -d --remove-orphans
+`)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func generateDeploy(t *testing.T, provider, requirements string, metadata map[string]interface{}) *InfraResponse {
+	t.Helper()
+	req := testInfraRequest()
+	req.Provider = provider
+	req.Requirements = requirements
+	req.Metadata = metadata
+	req.DryRun = true
+	resp, err := NewQInfraEngine().GenerateInfra(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// scriptFilePattern matches the generated files a script could name
+var scriptFilePattern = regexp.MustCompile(`[\w./-]+\.(tf|ya?ml|ts|json)\b`)
+
+func checkDeployScript(t *testing.T, resp *InfraResponse) {
+	t.Helper()
+	for _, file := range scriptFilePattern.FindAllString(resp.DeployScript, -1) {
+		if _, ok := resp.Code[file]; !ok {
+			t.Errorf("%s script references %s, which isn't generated", resp.Framework, file)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "deploy.sh")
+	if err := os.WriteFile(path, []byte(resp.DeployScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("bash", "-n", path).CombinedOutput(); err != nil {
+		t.Errorf("%s script doesn't parse: %v\n%s", resp.Framework, err, out)
+	}
+	if _, err := exec.LookPath("shellcheck"); err != nil {
+		t.Log("shellcheck not installed, only checking syntax")
+		return
+	}
+	if out, err := exec.Command("shellcheck", "--shell=bash", path).CombinedOutput(); err != nil {
+		t.Errorf("shellcheck found problems in the %s script:\n%s", resp.Framework, out)
+	}
+}
+
+func TestDeployScripts(t *testing.T) {
+	metadata := map[string]interface{}{
+		"environment":      "staging",
+		"state_bucket":     "acme-tf-state",
+		"state_lock_table": "tf-locks",
+		"namespace":        "web",
+	}
+	tests := []struct {
+		provider, requirements, framework string
+		want                              []string
+	}{
+		{"aws", "web application", "terraform", []string{
+			`backend "s3"`, `bucket=$TF_STATE_BUCKET`, `dynamodb_table=$TF_STATE_LOCK_TABLE`, `${TF_STATE_BUCKET:-acme-tf-state}`,
+			`terraform workspace select "$ENVIRONMENT"`, "terraform workspace new", "-out=tfplan", "tfplan.txt",
+		}},
+		{"gcp", "web application", "terraform", []string{
+			`backend "gcs"`, `prefix=$TF_STATE_KEY`, "require TF_VAR_project_id",
+		}},
+		{"azure", "web application", "terraform", []string{
+			`backend "azurerm"`, `storage_account_name=$TF_STATE_BUCKET`, "require TF_STATE_RESOURCE_GROUP", "require TF_VAR_ssh_public_key",
+		}},
+		{"gcp", "serverless api", "pulumi", []string{
+			"gs://acme-tf-state", `pulumi stack select --create "$PULUMI_STACK"`, "pulumi config set gcp:region", "pulumi preview --diff",
+		}},
+		{"aws", "kubernetes cluster", "kubernetes", []string{
+			`${NAMESPACE:-web}`, "kubectl create namespace", `--prune -l "$SELECTOR"`, "app.kubernetes.io/managed-by=qinfra",
+		}},
+	}
+	for _, tt := range tests {
+		resp := generateDeploy(t, tt.provider, tt.requirements, metadata)
+		if resp.Framework != tt.framework {
+			t.Fatalf("%s %q generated %s, want %s", tt.provider, tt.requirements, resp.Framework, tt.framework)
+		}
+		all := resp.DeployScript
+		for _, content := range resp.Code {
+			all += content
+		}
+		for _, want := range append(tt.want, "set -euo pipefail", "--auto-approve", "${ENVIRONMENT:-staging}", "rollback_instructions") {
+			if !strings.Contains(all, want) {
+				t.Errorf("%s %s deploy lacks %q:\n%s", tt.provider, tt.framework, want, resp.DeployScript)
+			}
+		}
+		checkDeployScript(t, resp)
+	}
+}
+
+func TestKustomizationLabelsManifests(t *testing.T) {
+	resp := generateDeploy(t, "aws", "kubernetes cluster", map[string]interface{}{"project_name": "shop"})
+	kustomization := resp.Code["kustomization.yaml"]
+	for _, want := range []string{"- deployment.yaml", "- service.yaml", "app.kubernetes.io/managed-by: qinfra", "app.kubernetes.io/part-of: shop"} {
+		if !strings.Contains(kustomization, want) {
+			t.Errorf("kustomization lacks %q:\n%s", want, kustomization)
+		}
+	}
+}
+
+func TestTerraformDeployStateKey(t *testing.T) {
+	// The script keys state by the environment it deploys to
+	resp := generateDeploy(t, "gcp", "web application", nil)
+	if want := `TF_STATE_KEY="${TF_STATE_KEY:-$PROJECT/$ENVIRONMENT}"`; !strings.Contains(resp.DeployScript, want) {
+		t.Errorf("deploy script lacks %s", want)
+	}
+	if strings.Contains(resp.Code["backend.tf"], "bucket") || !strings.Contains(resp.DeployScript, "require TF_STATE_BUCKET") {
+		t.Error("the script doesn't require the state bucket backend.tf leaves out")
+	}
+
+	// An explicit state_key wins
+	resp = generateDeploy(t, "aws", "web application", map[string]interface{}{"state_key": "legacy/terraform.tfstate"})
+	if !strings.Contains(resp.DeployScript, `${TF_STATE_KEY:-legacy/terraform.tfstate}`) {
+		t.Error("deploy script ignores state_key")
+	}
+}
+
+func TestDeployConfigRejectsUnsafeMetadata(t *testing.T) {
+	for _, value := range []interface{}{"prod; rm -rf /", "$(whoami)", "a b", 42} {
+		req := testInfraRequest()
+		req.Metadata = map[string]interface{}{"environment": value}
+		if _, err := newDeployConfig(req); err == nil || !strings.Contains(err.Error(), "environment") {
+			t.Errorf("environment %v: err = %v, want it rejected", value, err)
+		}
+	}
+}
+
+// fakeTerraform logs its arguments and reports a plan with one change
+const fakeTerraform = `#!/usr/bin/env bash
+echo "$*" >> "$TERRAFORM_LOG"
+if [ "$1" = show ]; then
+  echo "Plan: 1 to add, 0 to change, 0 to destroy."
+fi
+`
+
+func TestTerraformDeployConfirms(t *testing.T) {
+	resp := generateDeploy(t, "aws", "web application", map[string]interface{}{"state_bucket": "acme-tf-state", "state_lock_table": "tf-locks"})
+
+	dir, bin := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "deploy.sh"), []byte(resp.DeployScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bin, "terraform"), []byte(fakeTerraform), 0755); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) (string, string, error) {
+		log := filepath.Join(t.TempDir(), "terraform.log")
+		cmd := exec.Command(filepath.Join(dir, "deploy.sh"), args...)
+		cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"), "TERRAFORM_LOG="+log)
+		out, err := cmd.CombinedOutput()
+		calls, _ := os.ReadFile(log)
+		return string(out), string(calls), err
+	}
+
+	// Without a terminal it stops at the confirmation gate
+	out, calls, err := run()
+	if err == nil || strings.Contains(calls, "apply") || !strings.Contains(out, "Plan: 1 to add") || !strings.Contains(out, "before applying anything") {
+		t.Errorf("unconfirmed run: err %v, terraform calls:\n%s\noutput:\n%s", err, calls, out)
+	}
+	if !strings.Contains(calls, "bucket=acme-tf-state") || !strings.Contains(calls, "workspace select dev") {
+		t.Errorf("init and workspace calls:\n%s", calls)
+	}
+
+	out, calls, err = run("--auto-approve")
+	if err != nil || !strings.Contains(calls, "apply -input=false tfplan") {
+		t.Errorf("auto-approved run: err %v, terraform calls:\n%s\noutput:\n%s", err, calls, out)
+	}
+
+	if _, _, err := run("--force"); err == nil {
+		t.Error("unknown flag accepted")
+	}
+}
@@ -3,6 +3,7 @@ module github.com/quantumlayer/qinfra
 go 1.21
 
 require (
+	github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared v0.0.0
 	github.com/gin-gonic/gin v1.9.1
 	github.com/google/uuid v1.5.0
 )
@@ -28,8 +29,10 @@ require (
 	golang.org/x/arch v0.3.0 // indirect
 	golang.org/x/crypto v0.9.0 // indirect
 	golang.org/x/net v0.10.0 // indirect
-	golang.org/x/sys v0.8.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared => ../shared
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testInfraRequest() InfraRequest {
+	return InfraRequest{
+		ID:           "infra-1",
+		Type:         "cloud",
+		Provider:     "aws",
+		Requirements: "web application",
+		Resources:    []ResourceDefinition{{Type: "compute", Name: "web"}},
+		Compliance:   []string{"SOC2"},
+		Metadata:     map[string]interface{}{},
+	}
+}
+
+func TestGenerateInfraRunsEveryPhase(t *testing.T) {
+	resp, err := NewQInfraEngine().GenerateInfra(context.Background(), testInfraRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.EstCost == nil || resp.ComplianceReport == nil || resp.Optimizations == nil {
+		t.Errorf("analysis missing: cost %v, compliance %v, optimizations %v", resp.EstCost, resp.ComplianceReport, resp.Optimizations)
+	}
+	if _, ok := resp.Metadata["vulnerabilities_found"]; !ok {
+		t.Error("metadata has no vulnerabilities_found although the scan ran")
+	}
+	if got := resp.Metadata["phases_run"]; !reflect.DeepEqual(got, AnalysisPhases) {
+		t.Errorf("phases_run = %v, want %v", got, AnalysisPhases)
+	}
+}
+
+func TestGenerateInfraDryRun(t *testing.T) {
+	req := testInfraRequest()
+	req.DryRun = true
+	resp, err := NewQInfraEngine().GenerateInfra(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Code) == 0 || resp.Framework == "" {
+		t.Fatalf("dry run returned framework %q and %d files", resp.Framework, len(resp.Code))
+	}
+	if resp.EstCost != nil || resp.ComplianceReport != nil || resp.Vulnerabilities != nil || resp.Optimizations != nil {
+		t.Errorf("dry run ran analysis: %+v", resp)
+	}
+	if _, ok := resp.Metadata["vulnerabilities_found"]; ok {
+		t.Error("dry run reports a vulnerability count")
+	}
+	if got := resp.Metadata["phases_run"]; !reflect.DeepEqual(got, []string{}) {
+		t.Errorf("phases_run = %v, want none", got)
+	}
+	if got := resp.Metadata["phases_skipped"]; !reflect.DeepEqual(got, AnalysisPhases) {
+		t.Errorf("phases_skipped = %v, want %v", got, AnalysisPhases)
+	}
+}
+
+func TestGenerateInfraSkipsPhases(t *testing.T) {
+	req := testInfraRequest()
+	req.Skip = []string{PhaseCost, PhaseCompliance}
+	resp, err := NewQInfraEngine().GenerateInfra(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.EstCost != nil || resp.ComplianceReport != nil {
+		t.Errorf("skipped phases ran: cost %v, compliance %v", resp.EstCost, resp.ComplianceReport)
+	}
+	if resp.Optimizations == nil {
+		t.Error("optimization didn't run")
+	}
+	if got, want := resp.Metadata["phases_run"], []string{PhaseScan, PhaseOptimization}; !reflect.DeepEqual(got, want) {
+		t.Errorf("phases_run = %v, want %v", got, want)
+	}
+	if got, want := resp.Metadata["phases_skipped"], []string{PhaseCompliance, PhaseCost}; !reflect.DeepEqual(got, want) {
+		t.Errorf("phases_skipped = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateRejectsUnknownPhase(t *testing.T) {
+	r := gin.New()
+	r.POST("/generate", NewQInfraEngine().handleGenerate)
+
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(`{"provider": "aws", "skip": ["linting"]}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "linting") {
+		t.Errorf("response = %d %s, want 400 naming the phase", w.Code, w.Body)
+	}
+}
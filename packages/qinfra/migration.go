@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MigrationRequest asks for a plan to move resources between providers
+type MigrationRequest struct {
+	SourceProvider string               `json:"source_provider" binding:"required"`
+	TargetProvider string               `json:"target_provider" binding:"required"`
+	Resources      []ResourceDefinition `json:"resources,omitempty"`
+}
+
+// MigrationPlan is the ordered work to move the resources, with what
+// doesn't carry over and how long it should take
+type MigrationPlan struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Supported bool   `json:"supported"`
+	// Reason says why an unsupported pair has no plan
+	Reason            string            `json:"reason,omitempty"`
+	ResourceMapping   []ResourceMapping `json:"resource_mapping"`
+	Incompatibilities []string          `json:"incompatibilities"`
+	DataTransfer      []DataTransfer    `json:"data_transfer"`
+	Steps             []MigrationStep   `json:"steps"`
+	EstimatedHours    float64           `json:"estimated_hours"`
+	EstimatedTime     string            `json:"estimated_time"`
+}
+
+// ResourceMapping pairs a resource's source service with its target one
+type ResourceMapping struct {
+	Resource string `json:"resource"`
+	Kind     string `json:"kind"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	// SourceType and TargetType are the machine types, where there are any
+	SourceType string `json:"source_type,omitempty"`
+	TargetType string `json:"target_type,omitempty"`
+}
+
+// DataTransfer is how a stateful resource's data is moved
+type DataTransfer struct {
+	Resource string `json:"resource"`
+	Method   string `json:"method"`
+	Notes    string `json:"notes"`
+}
+
+// MigrationStep is one step of a plan
+type MigrationStep struct {
+	Order       int      `json:"order"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Resources   []string `json:"resources,omitempty"`
+	Hours       float64  `json:"hours"`
+}
+
+// providerServices names each provider's service per resource kind, with
+// the Terraform type the renderers emit
+type providerServices struct {
+	Name        string
+	Compute     string
+	Storage     string
+	Network     string
+	Database    func(engine string) string
+	KeyService  string
+	MachineType map[string]string
+	DBClass     map[string]string
+	// VMTool moves virtual machines into this provider
+	VMTool string
+	// DBTool replicates databases into this provider
+	DBTool string
+}
+
+var migrationProviders = map[string]providerServices{
+	"aws": {
+		Name:        "AWS",
+		Compute:     "EC2 instance (aws_instance)",
+		Storage:     "S3 bucket (aws_s3_bucket)",
+		Network:     "VPC (aws_vpc)",
+		Database:    func(engine string) string { return "RDS " + engine + " (aws_db_instance)" },
+		KeyService:  "AWS KMS",
+		MachineType: awsInstanceTypes,
+		DBClass:     awsDBClasses,
+		VMTool:      "AWS Application Migration Service",
+		DBTool:      "AWS Database Migration Service",
+	},
+	"gcp": {
+		Name:        "GCP",
+		Compute:     "Compute Engine instance (google_compute_instance)",
+		Storage:     "Cloud Storage bucket (google_storage_bucket)",
+		Network:     "VPC network and subnetwork (google_compute_network)",
+		Database:    func(engine string) string { return "Cloud SQL for " + engine + " (google_sql_database_instance)" },
+		KeyService:  "Cloud KMS",
+		MachineType: gcpMachineTypes,
+		DBClass:     gcpDBTiers,
+		VMTool:      "Migrate to Virtual Machines",
+		DBTool:      "Database Migration Service",
+	},
+	"azure": {
+		Name:        "Azure",
+		Compute:     "Linux virtual machine (azurerm_linux_virtual_machine)",
+		Storage:     "Storage account (azurerm_storage_account)",
+		Network:     "Virtual network (azurerm_virtual_network)",
+		Database:    func(engine string) string { return "Azure Database for " + engine + " flexible server" },
+		KeyService:  "Azure Key Vault",
+		MachineType: azureVMSizes,
+		DBClass:     azureDBSkus,
+		VMTool:      "Azure Migrate",
+		DBTool:      "Azure Database Migration Service",
+	},
+}
+
+// objectCopyTools copies buckets between a source and target provider
+var objectCopyTools = map[string]string{
+	"aws->gcp":   "Storage Transfer Service",
+	"aws->azure": "AzCopy",
+	"gcp->aws":   "AWS DataSync",
+	"gcp->azure": "AzCopy",
+	"azure->aws": "AWS DataSync",
+	"azure->gcp": "Storage Transfer Service",
+}
+
+// Hours each kind of work takes, which the estimate is built from
+const (
+	hoursFixed        = 2.0  // inventory and cutover
+	hoursPerNetwork   = 1.0  // network and the link between providers
+	hoursKeys         = 0.5  // target encryption keys
+	hoursPerInstance  = 0.75 // on top of a base hour per compute resource
+	hoursPerBucket    = 1.0
+	hoursPerDatabase  = 3.0
+	hoursPerDBGB      = 0.02 // initial load
+	hoursApply        = 0.5
+	hoursDecommission = 0.5
+)
+
+// PlanMigration plans moving the resources from the source provider to
+// the target. A pair the planner has no mappings for is returned with
+// Supported false and the reason.
+func PlanMigration(req MigrationRequest) (*MigrationPlan, error) {
+	resources, err := NormalizeResources(req.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &MigrationPlan{
+		From:              req.SourceProvider,
+		To:                req.TargetProvider,
+		ResourceMapping:   []ResourceMapping{},
+		Incompatibilities: []string{},
+		DataTransfer:      []DataTransfer{},
+		Steps:             []MigrationStep{},
+	}
+	source, sourceOK := migrationProviders[req.SourceProvider]
+	target, targetOK := migrationProviders[req.TargetProvider]
+	switch {
+	case !sourceOK:
+		plan.Reason = fmt.Sprintf("unsupported source provider %q", req.SourceProvider)
+		return plan, nil
+	case !targetOK:
+		plan.Reason = fmt.Sprintf("unsupported target provider %q", req.TargetProvider)
+		return plan, nil
+	case req.SourceProvider == req.TargetProvider:
+		plan.Reason = "source and target provider are the same"
+		return plan, nil
+	}
+	plan.Supported = true
+
+	p := migrationPlanner{plan: plan, source: source, target: target, pair: req.SourceProvider + "->" + req.TargetProvider}
+	p.step("Inventory and map resources",
+		fmt.Sprintf("Export the %s resources and confirm the mapping to %s services below.", source.Name, target.Name),
+		nil, hoursFixed/2)
+	for _, r := range resources {
+		p.mapResource(r)
+	}
+
+	networks := p.byKind(resources, KindNetwork)
+	if len(networks) > 0 {
+		p.step("Recreate networking in "+target.Name,
+			fmt.Sprintf("Create a %s for each network with the same address space, then link it to the %s network with a site-to-site VPN for the transfer.", target.Network, source.Name),
+			names(networks), hoursPerNetwork*float64(len(networks)))
+	}
+
+	encrypted := p.encrypted(resources)
+	if len(encrypted) > 0 {
+		p.step("Create encryption keys in "+target.KeyService,
+			fmt.Sprintf("%s keys can't be exported. Create keys in %s; data is re-encrypted under them as it is copied.", source.KeyService, target.KeyService),
+			encrypted, hoursKeys)
+	}
+
+	for _, r := range p.byKind(resources, KindDatabase) {
+		hours := hoursPerDatabase + hoursPerDBGB*float64(r.StorageGB)
+		p.step("Replicate database "+r.Name,
+			fmt.Sprintf("Start continuous replication of the %s %s database (%d GB) into %s with %s, and let it catch up.", r.Engine, r.EngineVersion, r.StorageGB, target.Database(r.Engine), target.DBTool),
+			[]string{r.Name}, hours)
+	}
+
+	for _, r := range p.byKind(resources, KindStorage) {
+		p.step("Copy bucket "+r.Name,
+			fmt.Sprintf("Copy the objects into the %s with %s, then run an incremental copy before cutover.", target.Storage, objectCopyTools[p.pair]),
+			[]string{r.Name}, hoursPerBucket)
+	}
+
+	for _, r := range p.byKind(resources, KindCompute) {
+		hours := 1 + hoursPerInstance*float64(r.Count)
+		p.step("Migrate compute "+r.Name,
+			fmt.Sprintf("Replicate %d instance(s) to %s with %s, or redeploy the workload onto images built for %s.", r.Count, target.Compute, target.VMTool, target.Name),
+			[]string{r.Name}, hours)
+	}
+
+	p.step("Apply the target Terraform",
+		fmt.Sprintf("Generate Terraform for %s from the same resources with POST /generate and provider %q, and apply it.", target.Name, req.TargetProvider),
+		nil, hoursApply)
+	cutover := "Stop writes, switch DNS to " + target.Name + " and smoke test."
+	if len(p.byKind(resources, KindDatabase)) > 0 {
+		cutover = "Stop writes, wait for database replication to catch up and promote the replicas, switch DNS to " + target.Name + " and smoke test."
+	}
+	p.step("Cut over", cutover, nil, hoursFixed/2)
+	p.step("Decommission "+source.Name+" resources",
+		fmt.Sprintf("After a validation period, destroy the %s resources and revoke the migration credentials.", source.Name),
+		names(resources), hoursDecommission)
+
+	var total float64
+	for _, s := range plan.Steps {
+		total += s.Hours
+	}
+	plan.EstimatedHours = math.Round(total*10) / 10
+	plan.EstimatedTime = fmt.Sprintf("%.0f-%.0f hours", math.Floor(total), math.Ceil(total*1.5))
+	return plan, nil
+}
+
+// migrationPlanner fills in a plan for one provider pair
+type migrationPlanner struct {
+	plan   *MigrationPlan
+	source providerServices
+	target providerServices
+	pair   string
+}
+
+func (p *migrationPlanner) step(title, description string, resources []string, hours float64) {
+	p.plan.Steps = append(p.plan.Steps, MigrationStep{
+		Order:       len(p.plan.Steps) + 1,
+		Title:       title,
+		Description: description,
+		Resources:   resources,
+		Hours:       hours,
+	})
+}
+
+// byKind returns the resources of one kind
+func (p *migrationPlanner) byKind(resources []NormalizedResource, kind string) []NormalizedResource {
+	var matched []NormalizedResource
+	for _, r := range resources {
+		if r.Kind == kind {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// mapResource records a resource's target service, what doesn't carry
+// over, and how its data moves
+func (p *migrationPlanner) mapResource(r NormalizedResource) {
+	m := ResourceMapping{Resource: r.Name, Kind: r.Kind}
+	switch r.Kind {
+	case KindCompute:
+		m.Source, m.Target = p.source.Compute, p.target.Compute
+		m.SourceType, m.TargetType = machineType(r, p.source.MachineType), p.target.MachineType[r.Size]
+		if r.MachineType != "" {
+			p.incompatible("%s: instance_type %s is specific to %s; mapped by its %s size class to %s, check CPU architecture and memory match.", r.Name, r.MachineType, p.source.Name, r.Size, m.TargetType)
+		}
+	case KindDatabase:
+		m.Source, m.Target = p.source.Database(r.Engine), p.target.Database(r.Engine)
+		m.SourceType, m.TargetType = machineType(r, p.source.DBClass), p.target.DBClass[r.Size]
+		if r.MachineType != "" {
+			p.incompatible("%s: instance_class %s is specific to %s; mapped by its %s size class to %s.", r.Name, r.MachineType, p.source.Name, r.Size, m.TargetType)
+		}
+		p.transfer(r.Name, p.target.DBTool, "Continuous replication keeps downtime to the cutover window; extensions and users are migrated separately.")
+		p.databaseIncompatibilities(r)
+	case KindStorage:
+		m.Source, m.Target = p.source.Storage, p.target.Storage
+		p.transfer(r.Name, objectCopyTools[p.pair], "Object metadata carries over; ACLs and bucket policies must be rewritten as "+p.target.Name+" IAM.")
+		if p.plan.To == "azure" {
+			if name := azureStorageName(r.Name); name != r.Name {
+				p.incompatible("%s: storage account names must be 3-24 lowercase letters and digits, so the bucket becomes %s; update clients that use the old name.", r.Name, name)
+			}
+		}
+		if r.Versioning && p.plan.To == "azure" {
+			p.incompatible("%s: only the current version of each object is copied; Azure blob versioning starts fresh.", r.Name)
+		}
+	case KindNetwork:
+		m.Source, m.Target = p.source.Network, p.target.Network
+		if p.plan.To == "gcp" {
+			p.incompatible("%s: GCP networks are global; the %s range becomes a regional subnetwork, and security groups become firewall rules on network tags.", r.Name, r.CIDR)
+		}
+		if p.plan.To == "azure" {
+			p.incompatible("%s: security groups become network security groups attached to subnets, and everything lives in a resource group.", r.Name)
+		}
+	default:
+		m.Source, m.Target = r.Kind, "no mapping"
+		p.incompatible("%s: %s resources aren't mapped and must be migrated by hand.", r.Name, r.Kind)
+	}
+	p.plan.ResourceMapping = append(p.plan.ResourceMapping, m)
+}
+
+func (p *migrationPlanner) databaseIncompatibilities(r NormalizedResource) {
+	if r.HighAvailability {
+		switch p.plan.To {
+		case "gcp":
+			p.incompatible("%s: Multi-AZ becomes a regional Cloud SQL instance with a standby in another zone.", r.Name)
+		case "azure":
+			p.incompatible("%s: high availability becomes a zone-redundant standby, which not every Azure region offers.", r.Name)
+		}
+	}
+	if p.plan.To == "azure" {
+		if mb := azureStorageMB(r.StorageGB); mb != r.StorageGB*1024 {
+			p.incompatible("%s: Azure flexible server storage comes in fixed tiers; %d GB rounds up to %d GB.", r.Name, r.StorageGB, mb/1024)
+		}
+	}
+	if p.plan.To == "gcp" && r.Engine == "postgres" {
+		p.incompatible("%s: Cloud SQL doesn't allow superuser; extensions outside its supported list must be removed first.", r.Name)
+	}
+}
+
+func (p *migrationPlanner) incompatible(format string, args ...interface{}) {
+	p.plan.Incompatibilities = append(p.plan.Incompatibilities, fmt.Sprintf(format, args...))
+}
+
+func (p *migrationPlanner) transfer(resource, method, notes string) {
+	p.plan.DataTransfer = append(p.plan.DataTransfer, DataTransfer{Resource: resource, Method: method, Notes: notes})
+}
+
+// encrypted lists the resources whose encryption keys have to be recreated
+func (p *migrationPlanner) encrypted(resources []NormalizedResource) []string {
+	var encrypted []string
+	for _, r := range resources {
+		if r.Encrypted && r.Kind != KindNetwork {
+			encrypted = append(encrypted, r.Name)
+		}
+	}
+	return encrypted
+}
+
+func names(resources []NormalizedResource) []string {
+	var out []string
+	for _, r := range resources {
+		out = append(out, r.Name)
+	}
+	return out
+}
+
+// handleMigrate serves POST /migrate
+func (q *QInfraEngine) handleMigrate(c *gin.Context) {
+	var req MigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	req.SourceProvider = strings.ToLower(req.SourceProvider)
+	req.TargetProvider = strings.ToLower(req.TargetProvider)
+
+	plan, err := PlanMigration(req)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, plan)
+}
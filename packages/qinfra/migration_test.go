@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func migrationResources() []ResourceDefinition {
+	return []ResourceDefinition{
+		{Type: KindNetwork, Name: "main", Properties: map[string]interface{}{"cidr": "10.8.0.0/16"}},
+		{Type: KindCompute, Name: "web", Properties: map[string]interface{}{"size": "large", "count": float64(3)}},
+		{Type: KindStorage, Name: "user_uploads", Properties: map[string]interface{}{"versioning": true}},
+		{Type: KindDatabase, Name: "orders", Properties: map[string]interface{}{"storage": float64(100), "high_availability": true}},
+	}
+}
+
+func planMigration(t *testing.T, from, to string, resources []ResourceDefinition) *MigrationPlan {
+	t.Helper()
+	plan, err := PlanMigration(MigrationRequest{SourceProvider: from, TargetProvider: to, Resources: resources})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Supported {
+		t.Fatalf("%s to %s unsupported: %s", from, to, plan.Reason)
+	}
+	return plan
+}
+
+// planText joins everything a reader of the plan sees
+func planText(plan *MigrationPlan) string {
+	var b strings.Builder
+	for _, s := range plan.Steps {
+		b.WriteString(s.Title + "\n" + s.Description + "\n")
+	}
+	for _, m := range plan.ResourceMapping {
+		b.WriteString(m.Target + " " + m.TargetType + "\n")
+	}
+	for _, d := range plan.DataTransfer {
+		b.WriteString(d.Method + "\n")
+	}
+	b.WriteString(strings.Join(plan.Incompatibilities, "\n"))
+	return b.String()
+}
+
+func TestPlanMigrationPerProviderPair(t *testing.T) {
+	toGCP := planMigration(t, "aws", "gcp", migrationResources())
+	toAzure := planMigration(t, "aws", "azure", migrationResources())
+
+	if reflect.DeepEqual(toGCP.Steps, toAzure.Steps) {
+		t.Fatal("aws to gcp and aws to azure have the same steps")
+	}
+
+	tests := []struct {
+		plan *MigrationPlan
+		want []string
+	}{
+		{toGCP, []string{
+			"google_compute_instance", "e2-standard-4", "Cloud SQL for postgres", "Storage Transfer Service",
+			"Database Migration Service", "Cloud KMS", "10.8.0.0/16 range becomes a regional subnetwork", "regional Cloud SQL",
+		}},
+		{toAzure, []string{
+			"azurerm_linux_virtual_machine", "Standard_D4s_v5", "Azure Database for postgres", "AzCopy",
+			"Azure Migrate", "Azure Key Vault", "becomes useruploads", "100 GB rounds up to 128 GB", "zone-redundant",
+		}},
+	}
+	for _, tt := range tests {
+		text := planText(tt.plan)
+		for _, want := range tt.want {
+			if !strings.Contains(text, want) {
+				t.Errorf("aws to %s plan lacks %q:\n%s", tt.plan.To, want, text)
+			}
+		}
+	}
+
+	for _, plan := range []*MigrationPlan{toGCP, toAzure} {
+		if len(plan.ResourceMapping) != 4 {
+			t.Errorf("%s mapping = %+v, want every resource", plan.To, plan.ResourceMapping)
+		}
+		if m := plan.ResourceMapping[1]; m.Resource != "web" || m.SourceType != "m6i.xlarge" {
+			t.Errorf("%s web mapping = %+v, want it from m6i.xlarge", plan.To, m)
+		}
+		if len(plan.DataTransfer) != 2 {
+			t.Errorf("%s data transfer = %+v, want the bucket and database", plan.To, plan.DataTransfer)
+		}
+		for i, s := range plan.Steps {
+			if s.Order != i+1 {
+				t.Errorf("%s step %q has order %d, want %d", plan.To, s.Title, s.Order, i+1)
+			}
+		}
+	}
+}
+
+func TestPlanMigrationEstimateScales(t *testing.T) {
+	empty := planMigration(t, "aws", "gcp", nil)
+	full := planMigration(t, "aws", "gcp", migrationResources())
+	if empty.EstimatedHours >= full.EstimatedHours {
+		t.Errorf("estimate without resources %v >= with %v", empty.EstimatedHours, full.EstimatedHours)
+	}
+
+	resources := migrationResources()
+	resources[1].Properties["count"] = float64(10)
+	resources[3].Properties["storage"] = float64(1000)
+	bigger := planMigration(t, "aws", "gcp", resources)
+	if bigger.EstimatedHours <= full.EstimatedHours {
+		t.Errorf("estimate with more instances and data %v <= %v", bigger.EstimatedHours, full.EstimatedHours)
+	}
+	if full.EstimatedTime == "2-4 hours" || !strings.HasSuffix(full.EstimatedTime, "hours") {
+		t.Errorf("estimated time = %q", full.EstimatedTime)
+	}
+}
+
+func TestPlanMigrationFlagsUnsupportedPairs(t *testing.T) {
+	for _, pair := range [][2]string{{"aws", "aws"}, {"aws", "oracle"}, {"onprem", "gcp"}} {
+		plan, err := PlanMigration(MigrationRequest{SourceProvider: pair[0], TargetProvider: pair[1], Resources: migrationResources()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.Supported || plan.Reason == "" || len(plan.Steps) != 0 {
+			t.Errorf("%s to %s = supported %v, reason %q, %d steps; want it flagged", pair[0], pair[1], plan.Supported, plan.Reason, len(plan.Steps))
+		}
+	}
+}
+
+func TestHandleMigrate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/migrate", NewQInfraEngine().handleMigrate)
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/migrate", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post(`{"source_provider": "AWS", "target_provider": "gcp", "resources": [{"type": "compute", "name": "web"}]}`); w.Code != 200 || !strings.Contains(w.Body.String(), "google_compute_instance") {
+		t.Errorf("migrate = %d %s", w.Code, w.Body)
+	}
+	for _, body := range []string{
+		`{"source_provider": "aws"}`,
+		`{"source_provider": "aws", "target_provider": "gcp", "resources": [{"type": "compute", "name": "web", "properties": {"size": "huge"}}]}`,
+	} {
+		if w := post(body); w.Code != 400 {
+			t.Errorf("migrate %s = %d, want 400", body, w.Code)
+		}
+	}
+}
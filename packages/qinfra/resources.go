@@ -0,0 +1,643 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resource kinds a ResourceDefinition can compile to
+const (
+	KindCompute  = "compute"
+	KindStorage  = "storage"
+	KindNetwork  = "network"
+	KindDatabase = "database"
+)
+
+// Size classes shared by every provider; each renderer maps them to its own
+// machine types
+const (
+	SizeSmall  = "small"
+	SizeMedium = "medium"
+	SizeLarge  = "large"
+)
+
+// NormalizedResource is the provider-agnostic form a ResourceDefinition
+// compiles to. Renderers only read this, so a property means the same thing
+// on every provider and a new provider is one ResourceRenderer.
+type NormalizedResource struct {
+	Kind string
+	Name string
+
+	// Encrypted turns on encryption at rest. It defaults to true.
+	Encrypted bool
+	// Public exposes storage and databases outside the private network. It
+	// defaults to false.
+	Public bool
+
+	// Compute and database
+	Size string // small, medium or large
+	// MachineType overrides the size with a provider-specific type, taken
+	// from the instance_type or instance_class property
+	MachineType string
+	Count       int // compute instances
+
+	// Storage
+	Versioning bool
+
+	// Network
+	CIDR string
+
+	// Database
+	Engine           string // postgres or mysql
+	EngineVersion    string
+	StorageGB        int
+	HighAvailability bool
+}
+
+var (
+	defaultCIDR           = "10.0.0.0/16"
+	defaultStorageGB      = 20
+	defaultEngineVersions = map[string]string{"postgres": "15", "mysql": "8.0"}
+	sizeClasses           = []string{SizeSmall, SizeMedium, SizeLarge}
+)
+
+// Normalize compiles a resource definition, filling in defaults and
+// rejecting properties of the wrong type or value. A kind it doesn't know
+// is passed through for the renderer to skip.
+func Normalize(res ResourceDefinition) (NormalizedResource, error) {
+	p := properties{name: res.Name, values: res.Properties}
+	n := NormalizedResource{
+		Kind:      res.Type,
+		Name:      res.Name,
+		Encrypted: p.bool("encrypted", true),
+		Public:    p.bool("public", false),
+	}
+
+	switch res.Type {
+	case KindCompute:
+		n.Size = p.oneOf("size", SizeMedium, sizeClasses)
+		n.MachineType = p.string("instance_type", "")
+		n.Count = p.int("count", 1)
+	case KindStorage:
+		n.Versioning = p.bool("versioning", false)
+	case KindNetwork:
+		n.CIDR = p.string("cidr", defaultCIDR)
+	case KindDatabase:
+		n.Size = p.oneOf("size", SizeSmall, sizeClasses)
+		n.MachineType = p.string("instance_class", "")
+		n.Engine = p.oneOf("engine", "postgres", []string{"postgres", "mysql"})
+		n.EngineVersion = p.string("engine_version", defaultEngineVersions[n.Engine])
+		n.StorageGB = p.int("storage", defaultStorageGB)
+		n.HighAvailability = p.bool("high_availability", false)
+	}
+	if p.err != nil {
+		return n, p.err
+	}
+	if res.Name == "" {
+		return n, fmt.Errorf("%s resource has no name", res.Type)
+	}
+	return n, nil
+}
+
+// NormalizeResources compiles every resource of a request
+func NormalizeResources(resources []ResourceDefinition) ([]NormalizedResource, error) {
+	normalized := make([]NormalizedResource, 0, len(resources))
+	for _, res := range resources {
+		n, err := Normalize(res)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, n)
+	}
+	return normalized, nil
+}
+
+// properties reads typed values from a resource's properties, keeping the
+// first error
+type properties struct {
+	name   string
+	values map[string]interface{}
+	err    error
+}
+
+func (p *properties) fail(key, want string, v interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("resource %q: property %s must be %s, got %v", p.name, key, want, v)
+	}
+}
+
+func (p *properties) string(key, def string) string {
+	v, ok := p.values[key]
+	if !ok || v == nil {
+		return def
+	}
+	s, ok := v.(string)
+	if !ok {
+		p.fail(key, "a string", v)
+		return def
+	}
+	return s
+}
+
+func (p *properties) bool(key string, def bool) bool {
+	v, ok := p.values[key]
+	if !ok || v == nil {
+		return def
+	}
+	b, ok := v.(bool)
+	if !ok {
+		p.fail(key, "true or false", v)
+		return def
+	}
+	return b
+}
+
+// int accepts the float64 JSON numbers decode to, as long as they are
+// positive whole numbers
+func (p *properties) int(key string, def int) int {
+	v, ok := p.values[key]
+	if !ok || v == nil {
+		return def
+	}
+	var f float64
+	switch n := v.(type) {
+	case float64:
+		f = n
+	case int:
+		f = float64(n)
+	default:
+		p.fail(key, "a number", v)
+		return def
+	}
+	if f < 1 || f != float64(int(f)) {
+		p.fail(key, "a positive whole number", v)
+		return def
+	}
+	return int(f)
+}
+
+func (p *properties) oneOf(key, def string, allowed []string) string {
+	s := p.string(key, def)
+	for _, a := range allowed {
+		if s == a {
+			return s
+		}
+	}
+	p.fail(key, "one of "+strings.Join(allowed, ", "), s)
+	return def
+}
+
+// ResourceRenderer writes normalized resources as Terraform for one provider
+type ResourceRenderer interface {
+	Compute(r NormalizedResource) string
+	Storage(r NormalizedResource) string
+	Network(r NormalizedResource) string
+	Database(r NormalizedResource) string
+	// Variables returns the Terraform variables the rendered resources
+	// reference beyond the common ones
+	Variables(resources []NormalizedResource) map[string]string
+}
+
+// renderers holds a ResourceRenderer per Terraform provider
+var renderers = map[string]ResourceRenderer{
+	"aws":   awsRenderer{},
+	"gcp":   gcpRenderer{},
+	"azure": azureRenderer{},
+}
+
+// rendererFor returns the provider's renderer, defaulting to AWS like the
+// provider configuration does
+func rendererFor(provider string) ResourceRenderer {
+	if r, ok := renderers[provider]; ok {
+		return r
+	}
+	return renderers["aws"]
+}
+
+// RenderResource writes one normalized resource as Terraform for provider
+func RenderResource(provider string, r NormalizedResource) string {
+	renderer := rendererFor(provider)
+	switch r.Kind {
+	case KindCompute:
+		return renderer.Compute(r)
+	case KindStorage:
+		return renderer.Storage(r)
+	case KindNetwork:
+		return renderer.Network(r)
+	case KindDatabase:
+		return renderer.Database(r)
+	default:
+		return fmt.Sprintf("# TODO: Generate %s resource", r.Kind)
+	}
+}
+
+// machineType picks the resource's override or the provider's type for its
+// size class
+func machineType(r NormalizedResource, sizes map[string]string) string {
+	if r.MachineType != "" {
+		return r.MachineType
+	}
+	return sizes[r.Size]
+}
+
+func hasKind(resources []NormalizedResource, kind string, encrypted bool) bool {
+	for _, r := range resources {
+		if r.Kind == kind && (!encrypted || r.Encrypted) {
+			return true
+		}
+	}
+	return false
+}
+
+// AWS
+
+type awsRenderer struct{}
+
+var (
+	awsInstanceTypes = map[string]string{SizeSmall: "t3.small", SizeMedium: "t3.medium", SizeLarge: "m6i.xlarge"}
+	awsDBClasses     = map[string]string{SizeSmall: "db.t3.small", SizeMedium: "db.t3.medium", SizeLarge: "db.m6i.xlarge"}
+)
+
+func awsTags(name string) string {
+	return fmt.Sprintf(`  tags = {
+    Name        = "%s"
+    Environment = var.environment
+  }`, name)
+}
+
+func (awsRenderer) Compute(r NormalizedResource) string {
+	return fmt.Sprintf(`resource "aws_instance" "%s" {
+  count         = %d
+  ami           = data.aws_ami.latest.id
+  instance_type = "%s"
+
+  root_block_device {
+    encrypted = %t
+  }
+
+%s
+}`, r.Name, r.Count, machineType(r, awsInstanceTypes), r.Encrypted, awsTags(r.Name))
+}
+
+func (awsRenderer) Storage(r NormalizedResource) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `resource "aws_s3_bucket" "%s" {
+  bucket = "%s-${var.environment}"
+
+%s
+}
+
+resource "aws_s3_bucket_public_access_block" "%s" {
+  bucket                  = aws_s3_bucket.%s.id
+  block_public_acls       = %t
+  block_public_policy     = %t
+  ignore_public_acls      = %t
+  restrict_public_buckets = %t
+}`, r.Name, r.Name, awsTags(r.Name), r.Name, r.Name, !r.Public, !r.Public, !r.Public, !r.Public)
+
+	if r.Encrypted {
+		fmt.Fprintf(&b, `
+
+resource "aws_s3_bucket_server_side_encryption_configuration" "%s" {
+  bucket = aws_s3_bucket.%s.id
+
+  rule {
+    apply_server_side_encryption_by_default {
+      sse_algorithm = "aws:kms"
+    }
+  }
+}`, r.Name, r.Name)
+	}
+	if r.Versioning {
+		fmt.Fprintf(&b, `
+
+resource "aws_s3_bucket_versioning" "%s" {
+  bucket = aws_s3_bucket.%s.id
+
+  versioning_configuration {
+    status = "Enabled"
+  }
+}`, r.Name, r.Name)
+	}
+	return b.String()
+}
+
+func (awsRenderer) Network(r NormalizedResource) string {
+	return fmt.Sprintf(`resource "aws_vpc" "%s" {
+  cidr_block = "%s"
+
+%s
+}`, r.Name, r.CIDR, awsTags(r.Name))
+}
+
+func (awsRenderer) Database(r NormalizedResource) string {
+	return fmt.Sprintf(`resource "aws_db_instance" "%s" {
+  allocated_storage   = %d
+  engine              = "%s"
+  engine_version      = "%s"
+  instance_class      = "%s"
+  db_name             = "%s"
+  username            = "admin"
+  password            = random_password.db_password.result
+  storage_encrypted   = %t
+  publicly_accessible = %t
+  multi_az            = %t
+
+%s
+}`, r.Name, r.StorageGB, r.Engine, r.EngineVersion, machineType(r, awsDBClasses), r.Name,
+		r.Encrypted, r.Public, r.HighAvailability, awsTags(r.Name))
+}
+
+func (awsRenderer) Variables([]NormalizedResource) map[string]string {
+	return nil
+}
+
+// GCP
+
+type gcpRenderer struct{}
+
+var (
+	gcpMachineTypes = map[string]string{SizeSmall: "e2-small", SizeMedium: "e2-medium", SizeLarge: "e2-standard-4"}
+	gcpDBTiers      = map[string]string{SizeSmall: "db-custom-1-3840", SizeMedium: "db-custom-2-7680", SizeLarge: "db-custom-4-15360"}
+)
+
+// GCP encrypts everything at rest with Google-managed keys, so Encrypted
+// there selects the customer-managed key in var.kms_key_id
+
+func (gcpRenderer) Compute(r NormalizedResource) string {
+	encryption := ""
+	if r.Encrypted {
+		encryption = "\n    kms_key_self_link = var.kms_key_id"
+	}
+	return fmt.Sprintf(`resource "google_compute_instance" "%s" {
+  count        = %d
+  name         = "%s-${var.environment}-${count.index}"
+  machine_type = "%s"
+  zone         = "${var.region}-a"
+
+  boot_disk {%s
+    initialize_params {
+      image = "debian-cloud/debian-12"
+    }
+  }
+
+  network_interface {
+    network = "default"
+  }
+
+  labels = {
+    environment = var.environment
+  }
+}`, r.Name, r.Count, r.Name, machineType(r, gcpMachineTypes), encryption)
+}
+
+func (gcpRenderer) Storage(r NormalizedResource) string {
+	prevention := "enforced"
+	if r.Public {
+		prevention = "inherited"
+	}
+	encryption := ""
+	if r.Encrypted {
+		encryption = `
+
+  encryption {
+    default_kms_key_name = var.kms_key_id
+  }`
+	}
+	return fmt.Sprintf(`resource "google_storage_bucket" "%s" {
+  name                        = "%s-${var.environment}"
+  location                    = var.region
+  uniform_bucket_level_access = true
+  public_access_prevention    = "%s"
+
+  versioning {
+    enabled = %t
+  }%s
+
+  labels = {
+    environment = var.environment
+  }
+}`, r.Name, r.Name, prevention, r.Versioning, encryption)
+}
+
+func (gcpRenderer) Network(r NormalizedResource) string {
+	return fmt.Sprintf(`resource "google_compute_network" "%s" {
+  name                    = "%s-${var.environment}"
+  auto_create_subnetworks = false
+}
+
+resource "google_compute_subnetwork" "%s" {
+  name          = "%s-${var.environment}"
+  network       = google_compute_network.%s.id
+  region        = var.region
+  ip_cidr_range = "%s"
+}`, r.Name, r.Name, r.Name, r.Name, r.Name, r.CIDR)
+}
+
+func (gcpRenderer) Database(r NormalizedResource) string {
+	availability := "ZONAL"
+	if r.HighAvailability {
+		availability = "REGIONAL"
+	}
+	encryption := ""
+	if r.Encrypted {
+		encryption = "\n\n  encryption_key_name = var.kms_key_id"
+	}
+	return fmt.Sprintf(`resource "google_sql_database_instance" "%s" {
+  name             = "%s-${var.environment}"
+  database_version = "%s"
+  region           = var.region%s
+
+  settings {
+    tier              = "%s"
+    disk_size         = %d
+    availability_type = "%s"
+
+    ip_configuration {
+      ipv4_enabled = %t
+    }
+
+    user_labels = {
+      environment = var.environment
+    }
+  }
+}`, r.Name, r.Name, gcpDatabaseVersion(r), encryption, machineType(r, gcpDBTiers), r.StorageGB,
+		availability, r.Public)
+}
+
+// gcpDatabaseVersion is Cloud SQL's name for an engine version, e.g.
+// POSTGRES_15 or MYSQL_8_0
+func gcpDatabaseVersion(r NormalizedResource) string {
+	return strings.ToUpper(r.Engine) + "_" + strings.ReplaceAll(r.EngineVersion, ".", "_")
+}
+
+func (gcpRenderer) Variables(resources []NormalizedResource) map[string]string {
+	vars := map[string]string{"project_id": "The GCP project to deploy resources in"}
+	for _, r := range resources {
+		if r.Encrypted {
+			vars["kms_key_id"] = "The Cloud KMS key encrypting resources at rest"
+			break
+		}
+	}
+	return vars
+}
+
+// Azure
+
+type azureRenderer struct{}
+
+var (
+	azureVMSizes = map[string]string{SizeSmall: "Standard_B2s", SizeMedium: "Standard_D2s_v5", SizeLarge: "Standard_D4s_v5"}
+	azureDBSkus  = map[string]string{SizeSmall: "B_Standard_B1ms", SizeMedium: "GP_Standard_D2s_v3", SizeLarge: "GP_Standard_D4s_v3"}
+)
+
+func azureTags(name string) string {
+	return fmt.Sprintf(`  tags = {
+    Name        = "%s"
+    Environment = var.environment
+  }`, name)
+}
+
+func (azureRenderer) Compute(r NormalizedResource) string {
+	return fmt.Sprintf(`resource "azurerm_linux_virtual_machine" "%s" {
+  count                      = %d
+  name                       = "%s-${var.environment}-${count.index}"
+  resource_group_name        = var.resource_group_name
+  location                   = var.location
+  size                       = "%s"
+  admin_username             = "azureuser"
+  network_interface_ids      = [azurerm_network_interface.%s[count.index].id]
+  encryption_at_host_enabled = %t
+
+  admin_ssh_key {
+    username   = "azureuser"
+    public_key = var.ssh_public_key
+  }
+
+  os_disk {
+    caching              = "ReadWrite"
+    storage_account_type = "Premium_LRS"
+  }
+
+  source_image_reference {
+    publisher = "Canonical"
+    offer     = "0001-com-ubuntu-server-jammy"
+    sku       = "22_04-lts"
+    version   = "latest"
+  }
+
+%s
+}`, r.Name, r.Count, r.Name, machineType(r, azureVMSizes), r.Name, r.Encrypted, azureTags(r.Name))
+}
+
+func (azureRenderer) Storage(r NormalizedResource) string {
+	return fmt.Sprintf(`resource "azurerm_storage_account" "%s" {
+  name                              = "%s${var.environment}"
+  resource_group_name               = var.resource_group_name
+  location                          = var.location
+  account_tier                      = "Standard"
+  account_replication_type          = "LRS"
+  infrastructure_encryption_enabled = %t
+  allow_nested_items_to_be_public   = %t
+  public_network_access_enabled     = %t
+
+  blob_properties {
+    versioning_enabled = %t
+  }
+
+%s
+}`, r.Name, azureStorageName(r.Name), r.Encrypted, r.Public, r.Public, r.Versioning, azureTags(r.Name))
+}
+
+// azureStorageName strips what storage account names don't allow
+func azureStorageName(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func (azureRenderer) Network(r NormalizedResource) string {
+	return fmt.Sprintf(`resource "azurerm_virtual_network" "%s" {
+  name                = "%s-${var.environment}"
+  resource_group_name = var.resource_group_name
+  location            = var.location
+  address_space       = ["%s"]
+
+%s
+}`, r.Name, r.Name, r.CIDR, azureTags(r.Name))
+}
+
+// Azure always encrypts flexible servers at rest; Encrypted adds the
+// customer-managed key in var.kms_key_id
+func (azureRenderer) Database(r NormalizedResource) string {
+	resource := "azurerm_postgresql_flexible_server"
+	if r.Engine == "mysql" {
+		resource = "azurerm_mysql_flexible_server"
+	}
+	encryption := ""
+	if r.Encrypted {
+		encryption = `
+
+  identity {
+    type         = "UserAssigned"
+    identity_ids = [var.key_identity_id]
+  }
+
+  customer_managed_key {
+    key_vault_key_id                  = var.kms_key_id
+    primary_user_assigned_identity_id = var.key_identity_id
+  }`
+	}
+	ha := ""
+	if r.HighAvailability {
+		ha = `
+
+  high_availability {
+    mode = "ZoneRedundant"
+  }`
+	}
+	return fmt.Sprintf(`resource "%s" "%s" {
+  name                          = "%s-${var.environment}"
+  resource_group_name           = var.resource_group_name
+  location                      = var.location
+  version                       = "%s"
+  sku_name                      = "%s"
+  storage_mb                    = %d
+  administrator_login           = "dbadmin"
+  administrator_password        = random_password.db_password.result
+  public_network_access_enabled = %t%s%s
+
+%s
+}`, resource, r.Name, r.Name, r.EngineVersion, machineType(r, azureDBSkus), azureStorageMB(r.StorageGB),
+		r.Public, encryption, ha, azureTags(r.Name))
+}
+
+// azureStorageMB rounds a size up to the smallest flexible server storage
+// tier that holds it
+func azureStorageMB(gb int) int {
+	for _, tier := range []int{32, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384} {
+		if gb <= tier {
+			return tier * 1024
+		}
+	}
+	return 16384 * 1024
+}
+
+func (azureRenderer) Variables(resources []NormalizedResource) map[string]string {
+	vars := map[string]string{
+		"resource_group_name": "The resource group to deploy resources in",
+		"location":            "The Azure location to deploy resources in",
+	}
+	if hasKind(resources, KindCompute, false) {
+		vars["ssh_public_key"] = "The SSH public key for virtual machine logins"
+	}
+	if hasKind(resources, KindDatabase, true) {
+		vars["kms_key_id"] = "The Key Vault key encrypting databases at rest"
+		vars["key_identity_id"] = "The user-assigned identity allowed to use the Key Vault key"
+	}
+	return vars
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var providers = []string{"aws", "gcp", "azure"}
+
+func normalize(t *testing.T, kind string, props map[string]interface{}) NormalizedResource {
+	t.Helper()
+	n, err := Normalize(ResourceDefinition{Type: kind, Name: "app", Properties: props})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// assertRenders checks every provider renders r with the attribute each
+// pattern matches, and none renders it with the matches flipped
+func assertRenders(t *testing.T, r NormalizedResource, want bool, patterns map[string]string) {
+	t.Helper()
+	for _, provider := range providers {
+		out := RenderResource(provider, r)
+		if got := regexp.MustCompile(patterns[provider]).MatchString(out); got != want {
+			t.Errorf("%s %s: match of %q = %v, want %v in\n%s", provider, r.Kind, patterns[provider], got, want, out)
+		}
+	}
+}
+
+func TestRenderEncryptionAcrossProviders(t *testing.T) {
+	encrypted := map[string]map[string]string{
+		KindCompute: {
+			"aws":   `root_block_device \{\s*encrypted = true`,
+			"gcp":   `kms_key_self_link = var\.kms_key_id`,
+			"azure": `encryption_at_host_enabled = true`,
+		},
+		KindStorage: {
+			"aws":   `sse_algorithm = "aws:kms"`,
+			"gcp":   `default_kms_key_name = var\.kms_key_id`,
+			"azure": `infrastructure_encryption_enabled = true`,
+		},
+		KindDatabase: {
+			"aws":   `storage_encrypted\s+= true`,
+			"gcp":   `encryption_key_name = var\.kms_key_id`,
+			"azure": `customer_managed_key \{\s*key_vault_key_id\s+= var\.kms_key_id`,
+		},
+	}
+	for kind, patterns := range encrypted {
+		t.Run(kind, func(t *testing.T) {
+			// Encryption is on unless a resource turns it off
+			assertRenders(t, normalize(t, kind, nil), true, patterns)
+			assertRenders(t, normalize(t, kind, map[string]interface{}{"encrypted": false}), false, patterns)
+		})
+	}
+}
+
+func TestRenderPrivateByDefaultAcrossProviders(t *testing.T) {
+	private := map[string]map[string]string{
+		KindStorage: {
+			"aws":   `block_public_policy\s+= true`,
+			"gcp":   `public_access_prevention\s+= "enforced"`,
+			"azure": `public_network_access_enabled\s+= false`,
+		},
+		KindDatabase: {
+			"aws":   `publicly_accessible = false`,
+			"gcp":   `ipv4_enabled = false`,
+			"azure": `public_network_access_enabled = false`,
+		},
+	}
+	for kind, patterns := range private {
+		t.Run(kind, func(t *testing.T) {
+			assertRenders(t, normalize(t, kind, nil), true, patterns)
+			assertRenders(t, normalize(t, kind, map[string]interface{}{"public": true}), false, patterns)
+		})
+	}
+}
+
+func TestRenderSizeAndNetworkAcrossProviders(t *testing.T) {
+	compute := normalize(t, KindCompute, map[string]interface{}{"size": "large", "count": float64(3)})
+	assertRenders(t, compute, true, map[string]string{
+		"aws":   `instance_type = "m6i\.xlarge"`,
+		"gcp":   `machine_type = "e2-standard-4"`,
+		"azure": `size\s+= "Standard_D4s_v5"`,
+	})
+	assertRenders(t, compute, true, map[string]string{"aws": `count\s+= 3`, "gcp": `count\s+= 3`, "azure": `count\s+= 3`})
+
+	network := normalize(t, KindNetwork, map[string]interface{}{"cidr": "10.8.0.0/16"})
+	assertRenders(t, network, true, map[string]string{
+		"aws":   `cidr_block = "10\.8\.0\.0/16"`,
+		"gcp":   `ip_cidr_range = "10\.8\.0\.0/16"`,
+		"azure": `address_space\s+= \["10\.8\.0\.0/16"\]`,
+	})
+
+	database := normalize(t, KindDatabase, map[string]interface{}{"engine": "mysql", "high_availability": true})
+	assertRenders(t, database, true, map[string]string{
+		"aws":   `multi_az\s+= true`,
+		"gcp":   `database_version = "MYSQL_8_0"[\s\S]*availability_type = "REGIONAL"`,
+		"azure": `azurerm_mysql_flexible_server[\s\S]*mode = "ZoneRedundant"`,
+	})
+}
+
+func TestRenderKeepsMachineTypeOverride(t *testing.T) {
+	r := normalize(t, KindCompute, map[string]interface{}{"instance_type": "c7g.large"})
+	if out := RenderResource("aws", r); !strings.Contains(out, `instance_type = "c7g.large"`) {
+		t.Errorf("override not rendered:\n%s", out)
+	}
+}
+
+func TestNormalizeRejectsBadProperties(t *testing.T) {
+	tests := []ResourceDefinition{
+		{Type: KindCompute, Name: "web", Properties: map[string]interface{}{"size": "huge"}},
+		{Type: KindCompute, Name: "web", Properties: map[string]interface{}{"count": 1.5}},
+		{Type: KindStorage, Name: "logs", Properties: map[string]interface{}{"encrypted": "yes"}},
+		{Type: KindDatabase, Name: "db", Properties: map[string]interface{}{"engine": "oracle"}},
+		{Type: KindNetwork, Properties: map[string]interface{}{}},
+	}
+	for _, res := range tests {
+		if _, err := Normalize(res); err == nil {
+			t.Errorf("Normalize(%+v) succeeded", res)
+		}
+	}
+
+	req := testInfraRequest()
+	req.Resources = tests[:1]
+	if _, err := NewQInfraEngine().GenerateInfra(context.Background(), req); err == nil || !strings.Contains(err.Error(), "size") {
+		t.Errorf("GenerateInfra error = %v, want the bad size named", err)
+	}
+}
+
+func TestTerraformVariablesFollowResources(t *testing.T) {
+	engine := NewQInfraEngine()
+	req := testInfraRequest()
+	req.Provider = "gcp"
+	if vars := engine.generateTerraformVariables(req); !strings.Contains(vars, `variable "kms_key_id"`) || !strings.Contains(vars, `variable "project_id"`) {
+		t.Errorf("gcp variables lack the project or key:\n%s", vars)
+	}
+
+	req.Resources = []ResourceDefinition{{Type: KindCompute, Name: "web", Properties: map[string]interface{}{"encrypted": false}}}
+	if vars := engine.generateTerraformVariables(req); strings.Contains(vars, "kms_key_id") {
+		t.Errorf("gcp variables declare a key nothing uses:\n%s", vars)
+	}
+
+	req.Provider = "aws"
+	if vars := engine.generateTerraformVariables(req); strings.Contains(vars, "project_id") {
+		t.Errorf("aws variables declare a GCP project:\n%s", vars)
+	}
+}
@@ -0,0 +1,680 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SOP execution states
+const (
+	ExecutionRunning         = "running"
+	ExecutionWaitingApproval = "waiting_approval"
+	ExecutionSucceeded       = "succeeded"
+	ExecutionFailed          = "failed"
+	ExecutionRolledBack      = "rolled_back"
+	ExecutionRollbackFailed  = "rollback_failed"
+	ExecutionDryRun          = "dry_run"
+)
+
+// SOP step states
+const (
+	StepPending         = "pending"
+	StepWaitingApproval = "waiting_approval"
+	StepRunning         = "running"
+	StepSucceeded       = "succeeded"
+	StepFailed          = "failed"
+	StepPlanned         = "planned"
+	StepRejected        = "rejected"
+)
+
+const (
+	defaultSOPStepTimeout     = 5 * time.Minute
+	defaultSOPApprovalTimeout = 24 * time.Hour
+	// maxStepOutput caps the output kept for each command
+	maxStepOutput = 64 * 1024
+)
+
+// defaultSOPCommands are the executables SOP steps may run unless
+// SOP_ALLOWED_COMMANDS says otherwise
+var defaultSOPCommands = []string{"kubectl", "helm", "terraform", "ansible-playbook", "systemctl", "curl", "echo"}
+
+var (
+	errExecutionNotFound = errors.New("execution not found")
+	errRunbookNotFound   = errors.New("runbook not found")
+	errNotAutomated      = errors.New("runbook is not marked for automation; only dry runs are allowed")
+	errNotWaiting        = errors.New("execution is not waiting for approval")
+	errNotApprover       = errors.New("approver is not listed in the SOP's approvals")
+)
+
+// placeholderPattern matches {{name}} parameters in step commands
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// CommandRunner runs one resolved SOP command. A command that ran and
+// exited non-zero returns its exit code and a nil error; err is set only
+// when the command could not be run or timed out.
+type CommandRunner interface {
+	Run(ctx context.Context, argv []string) (output string, exitCode int, err error)
+}
+
+// execRunner runs commands directly on the host, without a shell
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, argv []string) (string, int, error) {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return string(output), exitErr.ExitCode(), nil
+	}
+	if ctx.Err() != nil {
+		return string(output), -1, fmt.Errorf("command timed out: %w", ctx.Err())
+	}
+	if err != nil {
+		return string(output), -1, err
+	}
+	return string(output), 0, nil
+}
+
+// ExecuteRunbookRequest is the body of POST /sop/runbooks/:id/execute
+type ExecuteRunbookRequest struct {
+	// Parameters fill the {{name}} placeholders in step commands
+	Parameters map[string]string `json:"parameters"`
+	// DryRun resolves and checks the commands without running them
+	DryRun bool `json:"dry_run"`
+	// AutoRollback runs the rollback commands of the steps that ran, in
+	// reverse order, when a step fails
+	AutoRollback bool `json:"auto_rollback"`
+}
+
+// ApproveRequest is the body of POST /sop/executions/:id/approve
+type ApproveRequest struct {
+	Approver string `json:"approver" binding:"required"`
+	Comment  string `json:"comment"`
+}
+
+// StepExecution is the state of one runbook step in an execution
+type StepExecution struct {
+	Name             string     `json:"name"`
+	Command          string     `json:"command"`
+	Validation       string     `json:"validation,omitempty"`
+	Rollback         string     `json:"rollback,omitempty"`
+	Status           string     `json:"status"`
+	Output           string     `json:"output,omitempty"`
+	ExitCode         *int       `json:"exit_code,omitempty"`
+	ValidationOutput string     `json:"validation_output,omitempty"`
+	Error            string     `json:"error,omitempty"`
+	ApprovedBy       string     `json:"approved_by,omitempty"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+	DurationMs       int64      `json:"duration_ms"`
+
+	argv, validationArgv, rollbackArgv []string
+	commandRan                         bool
+}
+
+// RollbackExecution is one rollback command run after a failure
+type RollbackExecution struct {
+	Step       string `json:"step"`
+	Command    string `json:"command"`
+	Status     string `json:"status"`
+	Output     string `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Approval records who let a step run
+type Approval struct {
+	Step       string    `json:"step"`
+	Approver   string    `json:"approver"`
+	Comment    string    `json:"comment,omitempty"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+// SOPExecution is one run of a runbook
+type SOPExecution struct {
+	ID           string              `json:"id"`
+	RunbookID    string              `json:"runbook_id"`
+	Runbook      string              `json:"runbook"`
+	Status       string              `json:"status"`
+	DryRun       bool                `json:"dry_run"`
+	AutoRollback bool                `json:"auto_rollback"`
+	CurrentStep  int                 `json:"current_step"`
+	Steps        []*StepExecution    `json:"steps"`
+	Rollbacks    []RollbackExecution `json:"rollbacks,omitempty"`
+	Approvers    []string            `json:"approvers,omitempty"`
+	Approvals    []Approval          `json:"approvals,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	StartedAt    time.Time           `json:"started_at"`
+	FinishedAt   *time.Time          `json:"finished_at,omitempty"`
+
+	// approved wakes the execution when its gate is approved
+	approved chan struct{}
+}
+
+// snapshot copies the execution so it can be encoded while it runs
+func (e *SOPExecution) snapshot() *SOPExecution {
+	copied := *e
+	copied.Steps = make([]*StepExecution, len(e.Steps))
+	for i, step := range e.Steps {
+		stepCopy := *step
+		copied.Steps[i] = &stepCopy
+	}
+	copied.Rollbacks = append([]RollbackExecution(nil), e.Rollbacks...)
+	copied.Approvals = append([]Approval(nil), e.Approvals...)
+	return &copied
+}
+
+// loadAllowedCommands reads SOP_ALLOWED_COMMANDS, a comma-separated list of
+// executable names
+func loadAllowedCommands() map[string]bool {
+	names := defaultSOPCommands
+	if raw := os.Getenv("SOP_ALLOWED_COMMANDS"); raw != "" {
+		names = strings.Split(raw, ",")
+	}
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			allowed[name] = true
+		}
+	}
+	return allowed
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// resolveCommand fills a command's {{name}} placeholders from params,
+// returning the names it couldn't fill
+func resolveCommand(command string, params map[string]string) (string, []string) {
+	var missing []string
+	resolved := placeholderPattern.ReplaceAllStringFunc(command, func(match string) string {
+		name := placeholderPattern.FindStringSubmatch(match)[1]
+		value, ok := params[name]
+		if !ok {
+			missing = append(missing, name)
+			return match
+		}
+		return value
+	})
+	return resolved, missing
+}
+
+// splitCommand splits a command into arguments the way a shell would for
+// plain words and quotes. Commands run without a shell, so pipes,
+// redirects, substitutions and command lists are refused rather than
+// passed to the program as arguments.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range command {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		case strings.ContainsRune("|&;<>$`\\", r):
+			return nil, fmt.Errorf("shell operator %q is not supported; steps run without a shell", r)
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("command is empty")
+	}
+	return args, nil
+}
+
+// prepareCommand splits a command template into arguments, fills the
+// placeholders in each argument and checks the executable is allowlisted.
+// Splitting before filling keeps a parameter value a single argument, so
+// it can't add flags or commands. It returns the resolved command for
+// display and the placeholders params didn't fill.
+func (s *SOPAutomationEngine) prepareCommand(template string, params map[string]string) (string, []string, []string, error) {
+	resolved, missing := resolveCommand(template, params)
+	words, err := splitCommand(template)
+	if err != nil {
+		return resolved, nil, missing, err
+	}
+	argv := make([]string, len(words))
+	for i, word := range words {
+		argv[i], _ = resolveCommand(word, params)
+	}
+	if strings.ContainsRune(argv[0], '/') || !s.allowedCommands[argv[0]] {
+		return resolved, nil, missing, fmt.Errorf("command %q is not in the allowlist", argv[0])
+	}
+	return resolved, argv, missing, nil
+}
+
+// planExecution resolves every step of a runbook. Unfilled placeholders
+// fail the plan; commands the allowlist refuses are marked on their step.
+func (s *SOPAutomationEngine) planExecution(runbook *SOPRunbook, req ExecuteRunbookRequest) (*SOPExecution, []string, error) {
+	execution := &SOPExecution{
+		ID:           uuid.New().String(),
+		RunbookID:    runbook.ID,
+		Runbook:      runbook.Name,
+		Status:       ExecutionRunning,
+		DryRun:       req.DryRun,
+		AutoRollback: req.AutoRollback,
+		Approvers:    runbook.Approvals,
+		StartedAt:    time.Now(),
+		approved:     make(chan struct{}, 1),
+	}
+
+	missing := map[string]bool{}
+	var rejected []string
+	for _, step := range runbook.Steps {
+		se := &StepExecution{Name: step.Name, Status: StepPending}
+		var problems []string
+		var unfilled []string
+		var err error
+		se.Command, se.argv, unfilled, err = s.prepareCommand(step.Command, req.Parameters)
+		if err != nil {
+			problems = append(problems, "command: "+err.Error())
+		}
+		for _, name := range unfilled {
+			missing[name] = true
+		}
+		if step.Validation != "" {
+			se.Validation, se.validationArgv, unfilled, err = s.prepareCommand(step.Validation, req.Parameters)
+			if err != nil {
+				problems = append(problems, "validation: "+err.Error())
+			}
+			for _, name := range unfilled {
+				missing[name] = true
+			}
+		}
+		if step.Rollback != "" {
+			se.Rollback, se.rollbackArgv, unfilled, err = s.prepareCommand(step.Rollback, req.Parameters)
+			if err != nil {
+				problems = append(problems, "rollback: "+err.Error())
+			}
+			for _, name := range unfilled {
+				missing[name] = true
+			}
+		}
+		if len(problems) > 0 {
+			se.Status = StepRejected
+			se.Error = strings.Join(problems, "; ")
+			rejected = append(rejected, fmt.Sprintf("%s: %s", step.Name, se.Error))
+		}
+		execution.Steps = append(execution.Steps, se)
+	}
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, nil, fmt.Errorf("missing parameters: %s", strings.Join(names, ", "))
+	}
+	return execution, rejected, nil
+}
+
+// Execute starts a runbook. A dry run returns the resolved plan at once;
+// otherwise the steps run in the background and the returned execution is
+// a snapshot of its start.
+func (s *SOPAutomationEngine) Execute(runbookID string, req ExecuteRunbookRequest) (*SOPExecution, []string, error) {
+	s.mu.RLock()
+	runbook, ok := s.runbooks[runbookID]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, nil, errRunbookNotFound
+	}
+	if !runbook.Executable && !req.DryRun {
+		return nil, nil, errNotAutomated
+	}
+
+	execution, rejected, err := s.planExecution(runbook, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if req.DryRun {
+		for _, step := range execution.Steps {
+			if step.Status != StepRejected {
+				step.Status = StepPlanned
+			}
+		}
+		finished := time.Now()
+		execution.Status = ExecutionDryRun
+		execution.FinishedAt = &finished
+		s.storeExecution(execution)
+		return execution.snapshot(), nil, nil
+	}
+	if len(rejected) > 0 {
+		return nil, rejected, nil
+	}
+
+	s.storeExecution(execution)
+	snapshot := execution.snapshot()
+	go s.run(execution)
+	return snapshot, nil, nil
+}
+
+func (s *SOPAutomationEngine) storeExecution(execution *SOPExecution) {
+	s.mu.Lock()
+	s.executions[execution.ID] = execution
+	s.mu.Unlock()
+}
+
+// GetExecution returns a snapshot of an execution
+func (s *SOPAutomationEngine) GetExecution(id string) (*SOPExecution, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	execution, ok := s.executions[id]
+	if !ok {
+		return nil, errExecutionNotFound
+	}
+	return execution.snapshot(), nil
+}
+
+// Approve lets the step an execution is waiting on run
+func (s *SOPAutomationEngine) Approve(id string, req ApproveRequest) (*SOPExecution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	execution, ok := s.executions[id]
+	if !ok {
+		return nil, errExecutionNotFound
+	}
+	if execution.Status != ExecutionWaitingApproval {
+		return nil, errNotWaiting
+	}
+	listed := false
+	for _, approver := range execution.Approvers {
+		if strings.EqualFold(approver, req.Approver) {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		return nil, errNotApprover
+	}
+
+	step := execution.Steps[execution.CurrentStep]
+	execution.Approvals = append(execution.Approvals, Approval{
+		Step:       step.Name,
+		Approver:   req.Approver,
+		Comment:    req.Comment,
+		ApprovedAt: time.Now(),
+	})
+	execution.Status = ExecutionRunning
+	step.Status = StepPending
+	step.ApprovedBy = req.Approver
+	execution.approved <- struct{}{}
+	return execution.snapshot(), nil
+}
+
+// run executes the steps in order, waiting at each approval gate, and
+// rolls back when a step fails and the request asked for it
+func (s *SOPAutomationEngine) run(execution *SOPExecution) {
+	var failed *StepExecution
+	for i, step := range execution.Steps {
+		if len(execution.Approvers) > 0 && !s.awaitApproval(execution, i, step) {
+			failed = step
+			break
+		}
+
+		if !s.runStep(execution, i, step) {
+			failed = step
+			break
+		}
+	}
+
+	if failed == nil {
+		s.finish(execution, ExecutionSucceeded, "")
+		return
+	}
+
+	reason := fmt.Sprintf("step %q failed: %s", failed.Name, failed.Error)
+	if !execution.AutoRollback {
+		s.finish(execution, ExecutionFailed, reason)
+		return
+	}
+	if s.rollback(execution) {
+		s.finish(execution, ExecutionRolledBack, reason)
+	} else {
+		s.finish(execution, ExecutionRollbackFailed, reason)
+	}
+}
+
+// awaitApproval holds a step until Approve is called for it, failing the
+// step if nobody approves it in time
+func (s *SOPAutomationEngine) awaitApproval(execution *SOPExecution, i int, step *StepExecution) bool {
+	s.update(func() {
+		execution.CurrentStep = i
+		execution.Status = ExecutionWaitingApproval
+		step.Status = StepWaitingApproval
+	})
+
+	timer := time.NewTimer(s.approvalTimeout)
+	defer timer.Stop()
+	select {
+	case <-execution.approved:
+		return true
+	case <-timer.C:
+	}
+
+	approved := true
+	s.update(func() {
+		// Approve may have won the race with the timer
+		if execution.Status == ExecutionWaitingApproval {
+			approved = false
+			step.Status = StepFailed
+			step.Error = fmt.Sprintf("not approved within %s", s.approvalTimeout)
+		}
+	})
+	if approved {
+		<-execution.approved
+	}
+	return approved
+}
+
+// runStep runs a step's command and then its validation, returning whether
+// both succeeded
+func (s *SOPAutomationEngine) runStep(execution *SOPExecution, i int, step *StepExecution) bool {
+	started := time.Now()
+	s.update(func() {
+		execution.CurrentStep = i
+		execution.Status = ExecutionRunning
+		step.Status = StepRunning
+		step.StartedAt = &started
+	})
+
+	output, exitCode, err := s.runCommand(step.argv)
+	s.update(func() {
+		step.Output = output
+		step.ExitCode = &exitCode
+		step.commandRan = err == nil && exitCode == 0
+		switch {
+		case err != nil:
+			step.Error = err.Error()
+		case exitCode != 0:
+			step.Error = fmt.Sprintf("command exited with status %d", exitCode)
+		}
+	})
+
+	if step.commandRan && step.validationArgv != nil {
+		output, exitCode, err := s.runCommand(step.validationArgv)
+		s.update(func() {
+			step.ValidationOutput = output
+			switch {
+			case err != nil:
+				step.Error = "validation: " + err.Error()
+			case exitCode != 0:
+				step.Error = fmt.Sprintf("validation exited with status %d", exitCode)
+			}
+		})
+	}
+
+	finished := time.Now()
+	ok := step.commandRan && step.Error == ""
+	s.update(func() {
+		step.FinishedAt = &finished
+		step.DurationMs = finished.Sub(started).Milliseconds()
+		step.Status = StepSucceeded
+		if !ok {
+			step.Status = StepFailed
+		}
+	})
+	return ok
+}
+
+// rollback runs the rollback command of every step whose command ran, the
+// most recent first, returning whether all of them succeeded. A failing
+// rollback doesn't stop the ones before it.
+func (s *SOPAutomationEngine) rollback(execution *SOPExecution) bool {
+	ok := true
+	for i := len(execution.Steps) - 1; i >= 0; i-- {
+		step := execution.Steps[i]
+		if !step.commandRan || step.rollbackArgv == nil {
+			continue
+		}
+
+		started := time.Now()
+		output, exitCode, err := s.runCommand(step.rollbackArgv)
+		result := RollbackExecution{
+			Step:       step.Name,
+			Command:    step.Rollback,
+			Status:     StepSucceeded,
+			Output:     output,
+			DurationMs: time.Since(started).Milliseconds(),
+		}
+		switch {
+		case err != nil:
+			result.Status, result.Error = StepFailed, err.Error()
+		case exitCode != 0:
+			result.Status, result.Error = StepFailed, fmt.Sprintf("rollback exited with status %d", exitCode)
+		}
+		if result.Status == StepFailed {
+			ok = false
+		}
+		s.update(func() {
+			execution.Rollbacks = append(execution.Rollbacks, result)
+		})
+	}
+	return ok
+}
+
+func (s *SOPAutomationEngine) runCommand(argv []string) (string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.stepTimeout)
+	defer cancel()
+	output, exitCode, err := s.runner.Run(ctx, argv)
+	if len(output) > maxStepOutput {
+		output = output[:maxStepOutput] + "\n[output truncated]"
+	}
+	return output, exitCode, err
+}
+
+func (s *SOPAutomationEngine) finish(execution *SOPExecution, status, reason string) {
+	finished := time.Now()
+	s.update(func() {
+		execution.Status = status
+		execution.Error = reason
+		execution.FinishedAt = &finished
+	})
+}
+
+// update changes execution state under the engine's lock
+func (s *SOPAutomationEngine) update(change func()) {
+	s.mu.Lock()
+	change()
+	s.mu.Unlock()
+}
+
+func (s *SOPAutomationEngine) handleExecute(c *gin.Context) {
+	var req ExecuteRunbookRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	execution, rejected, err := s.Execute(c.Param("id"), req)
+	switch {
+	case errors.Is(err, errRunbookNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errNotAutomated):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case len(rejected) > 0:
+		c.JSON(400, gin.H{"error": "runbook has commands that can't be run", "details": rejected})
+		return
+	}
+
+	status := http.StatusAccepted
+	if execution.DryRun {
+		status = http.StatusOK
+	}
+	c.JSON(status, execution)
+}
+
+func (s *SOPAutomationEngine) handleGetExecution(c *gin.Context) {
+	execution, err := s.GetExecution(c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, execution)
+}
+
+func (s *SOPAutomationEngine) handleApprove(c *gin.Context) {
+	var req ApproveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	execution, err := s.Approve(c.Param("id"), req)
+	switch {
+	case errors.Is(err, errExecutionNotFound):
+		c.JSON(404, gin.H{"error": err.Error()})
+	case errors.Is(err, errNotApprover):
+		c.JSON(403, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(200, execution)
+	}
+}
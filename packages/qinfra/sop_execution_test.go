@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRunner records the commands it is given and answers from results,
+// keyed by the joined arguments; anything else succeeds
+type fakeRunner struct {
+	mu      sync.Mutex
+	ran     []string
+	results map[string]int
+}
+
+func (r *fakeRunner) Run(ctx context.Context, argv []string) (string, int, error) {
+	command := strings.Join(argv, " ")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ran = append(r.ran, command)
+	return "ran " + command, r.results[command], nil
+}
+
+func (r *fakeRunner) commands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ran...)
+}
+
+func newTestSOPEngine(results map[string]int) (*SOPAutomationEngine, *fakeRunner, *gin.Engine) {
+	gin.SetMode(gin.TestMode)
+	runner := &fakeRunner{results: results}
+	s := NewSOPAutomationEngine()
+	s.runner = runner
+	s.allowedCommands = map[string]bool{"kubectl": true, "echo": true}
+
+	r := gin.New()
+	r.POST("/sop/runbooks/:id/execute", s.handleExecute)
+	r.GET("/sop/executions/:id", s.handleGetExecution)
+	r.POST("/sop/executions/:id/approve", s.handleApprove)
+	return s, runner, r
+}
+
+var deploySteps = []SOPStep{
+	{Name: "scale", Command: "kubectl scale deploy/web --replicas={{replicas}} -n {{namespace}}", Validation: "kubectl rollout status deploy/web -n {{namespace}}", Rollback: "kubectl scale deploy/web --replicas=1 -n {{namespace}}"},
+	{Name: "migrate", Command: "kubectl apply -f migrate.yaml -n {{namespace}}", Validation: "kubectl wait job/migrate -n {{namespace}}", Rollback: "kubectl delete job/migrate -n {{namespace}}"},
+	{Name: "announce", Command: "echo 'deployed to {{namespace}}'"},
+}
+
+var deployParams = map[string]interface{}{"parameters": map[string]string{"namespace": "prod", "replicas": "3"}}
+
+func sendJSON(r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func startExecution(t *testing.T, r *gin.Engine, runbookID string, body interface{}, want int) *SOPExecution {
+	t.Helper()
+	w := sendJSON(r, http.MethodPost, "/sop/runbooks/"+runbookID+"/execute", body)
+	if w.Code != want {
+		t.Fatalf("execute status = %d, want %d: %s", w.Code, want, w.Body.String())
+	}
+	var execution SOPExecution
+	json.Unmarshal(w.Body.Bytes(), &execution)
+	return &execution
+}
+
+// waitForStatus polls an execution until it reaches status
+func waitForStatus(t *testing.T, s *SOPAutomationEngine, id, status string) *SOPExecution {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		execution, err := s.GetExecution(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if execution.Status == status {
+			return execution
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("execution status = %s, want %s", execution.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func stepStatuses(execution *SOPExecution) []string {
+	var statuses []string
+	for _, step := range execution.Steps {
+		statuses = append(statuses, step.Status)
+	}
+	return statuses
+}
+
+func TestExecuteRunbookRunsStepsInOrder(t *testing.T) {
+	s, runner, r := newTestSOPEngine(nil)
+	runbook := s.GenerateRunbook(&SOPDefinition{Name: "deploy", Steps: deploySteps, Automation: true})
+
+	started := startExecution(t, r, runbook.ID, deployParams, http.StatusAccepted)
+	execution := waitForStatus(t, s, started.ID, ExecutionSucceeded)
+
+	want := []string{
+		"kubectl scale deploy/web --replicas=3 -n prod",
+		"kubectl rollout status deploy/web -n prod",
+		"kubectl apply -f migrate.yaml -n prod",
+		"kubectl wait job/migrate -n prod",
+		"echo deployed to prod",
+	}
+	if got := runner.commands(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ran %q, want %q", got, want)
+	}
+	for _, step := range execution.Steps {
+		if step.Status != StepSucceeded || step.ExitCode == nil || *step.ExitCode != 0 || step.StartedAt == nil || step.FinishedAt == nil {
+			t.Fatalf("step = %+v, want a recorded success", step)
+		}
+	}
+	if execution.Steps[0].ValidationOutput != "ran kubectl rollout status deploy/web -n prod" {
+		t.Fatalf("validation output = %q", execution.Steps[0].ValidationOutput)
+	}
+
+	w := sendJSON(r, http.MethodGet, "/sop/executions/"+started.ID, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"succeeded"`) {
+		t.Fatalf("GET execution = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExecuteRunbookHaltsAndRollsBack(t *testing.T) {
+	tests := []struct {
+		name          string
+		autoRollback  bool
+		wantStatus    string
+		wantRollbacks []string
+	}{
+		{"halts", false, ExecutionFailed, nil},
+		// The failing step's command ran before its validation failed, so
+		// it is rolled back too, most recent first
+		{"rolls back", true, ExecutionRolledBack, []string{"migrate", "scale"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, runner, r := newTestSOPEngine(map[string]int{"kubectl wait job/migrate -n prod": 1})
+			runbook := s.GenerateRunbook(&SOPDefinition{Name: "deploy", Steps: deploySteps, Automation: true})
+
+			body := map[string]interface{}{"parameters": deployParams["parameters"], "auto_rollback": tt.autoRollback}
+			started := startExecution(t, r, runbook.ID, body, http.StatusAccepted)
+			execution := waitForStatus(t, s, started.ID, tt.wantStatus)
+
+			if got := stepStatuses(execution); !reflect.DeepEqual(got, []string{StepSucceeded, StepFailed, StepPending}) {
+				t.Fatalf("step statuses = %v", got)
+			}
+			if !strings.Contains(execution.Steps[1].Error, "validation exited with status 1") {
+				t.Fatalf("failed step error = %q", execution.Steps[1].Error)
+			}
+			for _, command := range runner.commands() {
+				if strings.HasPrefix(command, "echo") {
+					t.Fatal("a step after the failure ran")
+				}
+			}
+
+			var rolledBack []string
+			for _, rollback := range execution.Rollbacks {
+				if rollback.Status != StepSucceeded {
+					t.Fatalf("rollback = %+v", rollback)
+				}
+				rolledBack = append(rolledBack, rollback.Step)
+			}
+			if !reflect.DeepEqual(rolledBack, tt.wantRollbacks) {
+				t.Fatalf("rolled back %v, want %v", rolledBack, tt.wantRollbacks)
+			}
+		})
+	}
+}
+
+func TestExecuteRunbookRollbackFailure(t *testing.T) {
+	s, _, r := newTestSOPEngine(map[string]int{
+		"echo deployed to prod":                         2,
+		"kubectl delete job/migrate -n prod":            1,
+		"kubectl scale deploy/web --replicas=1 -n prod": 0,
+	})
+	runbook := s.GenerateRunbook(&SOPDefinition{Name: "deploy", Steps: deploySteps, Automation: true})
+
+	body := map[string]interface{}{"parameters": deployParams["parameters"], "auto_rollback": true}
+	started := startExecution(t, r, runbook.ID, body, http.StatusAccepted)
+	execution := waitForStatus(t, s, started.ID, ExecutionRollbackFailed)
+
+	// announce has no rollback; migrate's fails but scale's still runs
+	if len(execution.Rollbacks) != 2 || execution.Rollbacks[0].Status != StepFailed || execution.Rollbacks[1].Status != StepSucceeded {
+		t.Fatalf("rollbacks = %+v", execution.Rollbacks)
+	}
+}
+
+func TestExecuteRunbookApprovalGates(t *testing.T) {
+	s, runner, r := newTestSOPEngine(nil)
+	runbook := s.GenerateRunbook(&SOPDefinition{Name: "deploy", Steps: deploySteps[:2], Automation: true, Approvals: []string{"sre-lead"}})
+
+	started := startExecution(t, r, runbook.ID, deployParams, http.StatusAccepted)
+	execution := waitForStatus(t, s, started.ID, ExecutionWaitingApproval)
+	if execution.CurrentStep != 0 || len(runner.commands()) != 0 {
+		t.Fatalf("execution = %+v, want it held before the first step", execution)
+	}
+
+	if w := sendJSON(r, http.MethodPost, "/sop/executions/"+started.ID+"/approve", map[string]string{"approver": "intern"}); w.Code != http.StatusForbidden {
+		t.Fatalf("approval by an unlisted approver = %d", w.Code)
+	}
+	if w := sendJSON(r, http.MethodPost, "/sop/executions/"+started.ID+"/approve", map[string]string{"approver": "sre-lead"}); w.Code != http.StatusOK {
+		t.Fatalf("approve = %d %s", w.Code, w.Body.String())
+	}
+
+	// Held again before the second step
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		execution, _ = s.GetExecution(started.ID)
+		if execution.Status == ExecutionWaitingApproval && execution.CurrentStep == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("execution = %+v, want it waiting before the second step", execution)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(runner.commands()) != 2 {
+		t.Fatalf("ran %q, want only the first step", runner.commands())
+	}
+
+	if _, err := s.Approve(started.ID, ApproveRequest{Approver: "SRE-Lead", Comment: "go"}); err != nil {
+		t.Fatal(err)
+	}
+	execution = waitForStatus(t, s, started.ID, ExecutionSucceeded)
+	if len(execution.Approvals) != 2 || execution.Steps[1].ApprovedBy != "SRE-Lead" || execution.Approvals[1].Step != "migrate" {
+		t.Fatalf("approvals = %+v", execution.Approvals)
+	}
+
+	if w := sendJSON(r, http.MethodPost, "/sop/executions/"+started.ID+"/approve", map[string]string{"approver": "sre-lead"}); w.Code != http.StatusConflict {
+		t.Fatalf("approving a finished execution = %d", w.Code)
+	}
+}
+
+func TestExecuteRunbookApprovalTimeout(t *testing.T) {
+	s, runner, r := newTestSOPEngine(nil)
+	s.approvalTimeout = 20 * time.Millisecond
+	runbook := s.GenerateRunbook(&SOPDefinition{Name: "deploy", Steps: deploySteps[:1], Automation: true, Approvals: []string{"sre-lead"}})
+
+	started := startExecution(t, r, runbook.ID, deployParams, http.StatusAccepted)
+	execution := waitForStatus(t, s, started.ID, ExecutionFailed)
+	if execution.Steps[0].Status != StepFailed || len(runner.commands()) != 0 {
+		t.Fatalf("execution = %+v, want the unapproved step failed without running", execution)
+	}
+}
+
+func TestExecuteRunbookDryRun(t *testing.T) {
+	s, runner, r := newTestSOPEngine(nil)
+	steps := append([]SOPStep{{Name: "wipe", Command: "rm -rf /var/lib/{{namespace}}"}}, deploySteps...)
+	runbook := s.GenerateRunbook(&SOPDefinition{Name: "deploy", Steps: steps})
+
+	body := map[string]interface{}{"parameters": deployParams["parameters"], "dry_run": true}
+	execution := startExecution(t, r, runbook.ID, body, http.StatusOK)
+
+	if execution.Status != ExecutionDryRun || len(runner.commands()) != 0 {
+		t.Fatalf("execution status = %s after running %q", execution.Status, runner.commands())
+	}
+	if got := stepStatuses(execution); !reflect.DeepEqual(got, []string{StepRejected, StepPlanned, StepPlanned, StepPlanned}) {
+		t.Fatalf("step statuses = %v", got)
+	}
+	scale := execution.Steps[1]
+	if scale.Command != "kubectl scale deploy/web --replicas=3 -n prod" || scale.Rollback != "kubectl scale deploy/web --replicas=1 -n prod" {
+		t.Fatalf("resolved step = %+v", scale)
+	}
+	if !strings.Contains(execution.Steps[0].Error, `"rm" is not in the allowlist`) {
+		t.Fatalf("rejected step error = %q", execution.Steps[0].Error)
+	}
+
+	// The same runbook can't run for real, and isn't marked for automation
+	body["dry_run"] = false
+	startExecution(t, r, runbook.ID, body, http.StatusConflict)
+}
+
+func TestExecuteRunbookRejections(t *testing.T) {
+	s, runner, r := newTestSOPEngine(nil)
+	runbook := s.GenerateRunbook(&SOPDefinition{Name: "deploy", Steps: deploySteps, Automation: true})
+	piped := s.GenerateRunbook(&SOPDefinition{Name: "piped", Steps: []SOPStep{{Name: "grep", Command: "kubectl get pods | grep web"}}, Automation: true})
+
+	w := sendJSON(r, http.MethodPost, "/sop/runbooks/"+runbook.ID+"/execute", map[string]interface{}{"parameters": map[string]string{"namespace": "prod"}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "missing parameters: replicas") {
+		t.Fatalf("missing parameter = %d %s", w.Code, w.Body.String())
+	}
+	w = sendJSON(r, http.MethodPost, "/sop/runbooks/"+piped.ID+"/execute", nil)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "shell operator") {
+		t.Fatalf("piped command = %d %s", w.Code, w.Body.String())
+	}
+	startExecution(t, r, "missing", nil, http.StatusNotFound)
+	if w := sendJSON(r, http.MethodGet, "/sop/executions/missing", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("GET missing execution = %d", w.Code)
+	}
+	if len(runner.commands()) != 0 {
+		t.Fatalf("ran %q", runner.commands())
+	}
+}
+
+func TestPrepareCommandKeepsParametersOneArgument(t *testing.T) {
+	s, _, _ := newTestSOPEngine(nil)
+	params := map[string]string{"namespace": "prod --all-namespaces", "pod": "web-1"}
+
+	resolved, argv, missing, err := s.prepareCommand(`kubectl delete pod "{{pod}}" -n {{namespace}} {{grace}}`, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"kubectl", "delete", "pod", "web-1", "-n", "prod --all-namespaces", "{{grace}}"}
+	if !reflect.DeepEqual(argv, want) || !reflect.DeepEqual(missing, []string{"grace"}) {
+		t.Fatalf("argv = %q, missing = %v", argv, missing)
+	}
+	if resolved != `kubectl delete pod "web-1" -n prod --all-namespaces {{grace}}` {
+		t.Fatalf("resolved = %q", resolved)
+	}
+
+	for _, command := range []string{"/usr/bin/kubectl get pods", "kubectl get pods; rm -rf /", "echo $HOME", "echo 'unterminated"} {
+		if _, _, _, err := s.prepareCommand(command, nil); err == nil {
+			t.Errorf("prepareCommand(%q) succeeded", command)
+		}
+	}
+}
@@ -0,0 +1,1206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Contract test generation reads an OpenAPI spec through the MCP gateway's
+// api.read_spec and writes up to three tests per operation: a happy path
+// built from the schemas' examples, a 4xx case leaving out a required
+// parameter, and an auth failure case when the operation needs
+// credentials. The generated suites read the API's address from
+// API_BASE_URL and credentials from API_AUTH_HEADERS.
+const (
+	defaultAPIOperations = 50
+	maxAPIOperations     = 200
+
+	// maxSampleDepth bounds the example values built from nested schemas
+	maxSampleDepth = 6
+
+	// maxAPITestOutput is how much of an execution's output is returned
+	maxAPITestOutput = 16 << 10
+
+	fallbackBaseURL = "http://localhost:8080"
+)
+
+// Cases generated for each operation
+const (
+	CaseHappyPath       = "happy_path"
+	CaseMissingRequired = "missing_required"
+	CaseAuthFailure     = "auth_failure"
+)
+
+var errUnsupportedAPIFramework = errors.New("framework must be pytest, jest or go")
+
+// APITestRequest asks for contract tests of the API described by a spec,
+// given by URL or inline
+type APITestRequest struct {
+	SpecURL string          `json:"spec_url,omitempty"`
+	Spec    json.RawMessage `json:"spec,omitempty"`
+	// Framework is pytest (with httpx), jest (with supertest) or go
+	// (net/http tests)
+	Framework string `json:"framework"`
+	// BaseURL is where the API runs; it defaults to the spec's first server
+	BaseURL string `json:"base_url,omitempty"`
+	// Execute runs the suite in the sandbox against BaseURL
+	Execute bool `json:"execute,omitempty"`
+	// AuthHeaders are sent with the operations that need credentials when
+	// the suite is executed
+	AuthHeaders   map[string]string `json:"auth_headers,omitempty"`
+	MaxOperations int               `json:"max_operations,omitempty"`
+}
+
+// APITestResponse is the generated suite with the operations it covers
+type APITestResponse struct {
+	Success   bool              `json:"success"`
+	SpecTitle string            `json:"spec_title,omitempty"`
+	TestSuite TestSuite         `json:"test_suite"`
+	Coverage  APICoverage       `json:"coverage"`
+	Execution *APITestExecution `json:"execution,omitempty"`
+	// Warnings are parts of the spec the gateway couldn't read
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// APICoverage maps each operation, as "METHOD /path", to its tests
+type APICoverage struct {
+	TotalOperations   int `json:"total_operations"`
+	CoveredOperations int `json:"covered_operations"`
+	SkippedOperations int `json:"skipped_operations"`
+	// Truncated is set when the spec had more operations than were tested
+	Truncated           bool                         `json:"truncated"`
+	TruncatedOperations int                          `json:"truncated_operations,omitempty"`
+	Operations          map[string]OperationCoverage `json:"operations"`
+}
+
+// OperationCoverage is the tests of one operation and the cases skipped
+type OperationCoverage struct {
+	OperationID string        `json:"operation_id,omitempty"`
+	Method      string        `json:"method"`
+	Path        string        `json:"path"`
+	Covered     bool          `json:"covered"`
+	Tests       []string      `json:"tests"`
+	Skipped     []SkippedCase `json:"skipped,omitempty"`
+}
+
+// SkippedCase is a case that wasn't generated, and why
+type SkippedCase struct {
+	Case   string `json:"case"`
+	Reason string `json:"reason"`
+}
+
+// APITestExecution is the outcome of running a suite in the sandbox
+type APITestExecution struct {
+	BaseURL  string          `json:"base_url"`
+	Status   string          `json:"status"`
+	ExitCode int             `json:"exit_code"`
+	Passed   int             `json:"passed"`
+	Failed   int             `json:"failed"`
+	Results  []APITestResult `json:"results"`
+	// NotRun lists tests the framework didn't report on
+	NotRun []string `json:"not_run,omitempty"`
+	Output string   `json:"output"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// APITestResult is whether one generated test passed
+type APITestResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+}
+
+// APISpec is the api.read_spec result: an OpenAPI document reduced to its
+// operations, with schemas in JSON Schema
+type APISpec struct {
+	Title           string                       `json:"title"`
+	Version         string                       `json:"version"`
+	SpecVersion     string                       `json:"spec_version"`
+	Servers         []string                     `json:"servers"`
+	Operations      []APIOperation               `json:"operations"`
+	SecuritySchemes map[string]APISecurityScheme `json:"security_schemes,omitempty"`
+	Unsupported     []string                     `json:"unsupported,omitempty"`
+}
+
+type APIOperation struct {
+	ID          string                 `json:"operation_id,omitempty"`
+	Method      string                 `json:"method"`
+	Path        string                 `json:"path"`
+	Summary     string                 `json:"summary,omitempty"`
+	Parameters  []APIParameter         `json:"parameters,omitempty"`
+	RequestBody *APIRequestBody        `json:"request_body,omitempty"`
+	Responses   map[string]APIResponse `json:"responses"`
+	// Auth lists alternative sets of security schemes; an empty set means
+	// the operation can be called anonymously
+	Auth [][]string `json:"auth,omitempty"`
+}
+
+type APIParameter struct {
+	Name     string          `json:"name"`
+	In       string          `json:"in"`
+	Required bool            `json:"required"`
+	Schema   json.RawMessage `json:"schema,omitempty"`
+}
+
+type APIRequestBody struct {
+	Required    bool            `json:"required"`
+	ContentType string          `json:"content_type"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+type APIResponse struct {
+	Description string          `json:"description,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+type APISecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// MCPClient calls tools on the MCP gateway at MCP_GATEWAY_URL
+type MCPClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewMCPClient() *MCPClient {
+	baseURL := os.Getenv("MCP_GATEWAY_URL")
+	if baseURL == "" {
+		baseURL = "http://mcp-gateway.quantumlayer.svc.cluster.local:8095"
+	}
+	return &MCPClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// MCPError is a tool call the gateway answered with an error
+type MCPError struct {
+	Tool    string
+	Status  int
+	Message string
+}
+
+func (e *MCPError) Error() string {
+	return fmt.Sprintf("%s failed with status %d: %s", e.Tool, e.Status, e.Message)
+}
+
+// Call runs a tool and decodes its data into out
+func (c *MCPClient) Call(ctx context.Context, tool string, input, out interface{}) error {
+	rawInput, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"tool":    tool,
+		"service": "qtest",
+		"input":   json.RawMessage(rawInput),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/execute", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach MCP gateway: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+		Error   string          `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return &MCPError{Tool: tool, Status: resp.StatusCode, Message: "invalid gateway response"}
+	}
+	if resp.StatusCode != http.StatusOK || !result.Success {
+		return &MCPError{Tool: tool, Status: resp.StatusCode, Message: result.Error}
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+// apiFramework describes how one framework's contract tests are written
+// and run
+type apiFramework struct {
+	name     string
+	language string
+	// testName turns a case's words into the framework's test name
+	testName     func(words []string) string
+	setup        func(baseURL string) string
+	test         func(name string, call apiCall) string
+	files        func(tests string) map[string]string
+	dependencies []string
+	command      string
+}
+
+var apiFrameworks = map[string]apiFramework{
+	"pytest": {
+		name:     "pytest",
+		language: "python",
+		testName: func(words []string) string { return "test_" + strings.Join(words, "_") },
+		setup:    pytestSetup,
+		test:     pytestTest,
+		files: func(tests string) map[string]string {
+			return map[string]string{"test_api.py": tests}
+		},
+		dependencies: []string{"pytest", "httpx"},
+		command:      "python -m pytest -v -p no:cacheprovider test_api.py",
+	},
+	"jest": {
+		name:     "jest",
+		language: "javascript",
+		testName: func(words []string) string { return strings.Join(words, " ") },
+		setup:    jestSetup,
+		test:     jestTest,
+		files: func(tests string) map[string]string {
+			return map[string]string{"api.test.js": tests}
+		},
+		dependencies: []string{"jest", "supertest"},
+		command:      "npx jest --verbose --ci",
+	},
+	"go": {
+		name:     "go",
+		language: "go",
+		testName: func(words []string) string {
+			name := "Test"
+			for _, word := range words {
+				name += strings.ToUpper(word[:1]) + word[1:]
+			}
+			return name
+		},
+		setup: goSetup,
+		test:  goTest,
+		files: func(tests string) map[string]string {
+			return map[string]string{
+				"go.mod":      "module apitest\n\ngo 1.21\n",
+				"api_test.go": tests,
+			}
+		},
+		command: "go test -v -count=1 ./...",
+	},
+}
+
+// apiFrameworkAliases are other names the frameworks are asked for by
+var apiFrameworkAliases = map[string]string{
+	"python":     "pytest",
+	"httpx":      "pytest",
+	"javascript": "jest",
+	"supertest":  "jest",
+	"golang":     "go",
+	"net/http":   "go",
+}
+
+func lookupAPIFramework(name string) (apiFramework, error) {
+	name = strings.ToLower(name)
+	if name == "" {
+		name = "pytest"
+	}
+	if alias, ok := apiFrameworkAliases[name]; ok {
+		name = alias
+	}
+	framework, ok := apiFrameworks[name]
+	if !ok {
+		return apiFramework{}, errUnsupportedAPIFramework
+	}
+	return framework, nil
+}
+
+// statusExpectation is the statuses a test accepts: one of Codes, or any
+// in [Min, Max] when Codes is empty
+type statusExpectation struct {
+	Codes    []int
+	Min, Max int
+}
+
+func (e statusExpectation) String() string {
+	if len(e.Codes) == 0 {
+		return fmt.Sprintf("a %dxx status", e.Min/100)
+	}
+	codes := make([]string, len(e.Codes))
+	for i, code := range e.Codes {
+		codes[i] = strconv.Itoa(code)
+	}
+	return "status " + strings.Join(codes, " or ")
+}
+
+// apiCall is one request a generated test makes and what it expects back
+type apiCall struct {
+	Method  string
+	Path    string
+	Query   map[string]string
+	Headers map[string]string
+	// Body is JSON, or empty for none
+	Body          string
+	Authenticated bool
+	Expect        statusExpectation
+}
+
+// GenerateAPITests writes the framework's contract tests for the spec's
+// operations, up to maxOperations
+func GenerateAPITests(spec *APISpec, framework apiFramework, baseURL string, maxOperations int) (TestSuite, APICoverage) {
+	coverage := APICoverage{
+		TotalOperations: len(spec.Operations),
+		Operations:      make(map[string]OperationCoverage),
+	}
+	operations := spec.Operations
+	if len(operations) > maxOperations {
+		coverage.Truncated = true
+		coverage.TruncatedOperations = len(operations) - maxOperations
+	}
+
+	names := make(map[string]int)
+	uniqueName := func(words []string) string {
+		name := framework.testName(words)
+		names[name]++
+		if n := names[name]; n > 1 {
+			name = framework.testName(append(words, strconv.Itoa(n)))
+		}
+		return name
+	}
+
+	var tests []TestCase
+	for i, op := range operations {
+		key := op.Method + " " + op.Path
+		entry := OperationCoverage{OperationID: op.ID, Method: op.Method, Path: op.Path, Tests: []string{}}
+		if i >= maxOperations {
+			entry.Skipped = []SkippedCase{{
+				Case:   "all",
+				Reason: fmt.Sprintf("spec truncated: only the first %d of %d operations are tested", maxOperations, len(operations)),
+			}}
+			coverage.Operations[key] = entry
+			coverage.SkippedOperations++
+			continue
+		}
+
+		cases, skipped := operationCases(op)
+		entry.Skipped = skipped
+		for _, c := range cases {
+			name := uniqueName(append(operationWords(op), strings.Split(c.kind, "_")...))
+			tests = append(tests, TestCase{
+				Name:        name,
+				Description: c.description,
+				Type:        "contract",
+				Code:        framework.test(name, c.call),
+				Assertions:  []string{"responds with " + c.call.Expect.String()},
+				Expected:    c.call.Expect.String(),
+			})
+			entry.Tests = append(entry.Tests, name)
+		}
+		entry.Covered = len(entry.Tests) > 0
+		if entry.Covered {
+			coverage.CoveredOperations++
+		} else {
+			coverage.SkippedOperations++
+		}
+		coverage.Operations[key] = entry
+	}
+
+	suite := TestSuite{
+		ID:        fmt.Sprintf("api-test-%d", time.Now().UnixNano()),
+		Language:  framework.language,
+		Framework: framework.name,
+		TestCount: len(tests),
+		Tests:     tests,
+		SetupCode: framework.setup(baseURL),
+		CreatedAt: time.Now(),
+	}
+	return suite, coverage
+}
+
+type operationCase struct {
+	kind        string
+	description string
+	call        apiCall
+}
+
+// operationCases builds the cases of one operation, and the reasons for
+// those it can't have
+func operationCases(op APIOperation) ([]operationCase, []SkippedCase) {
+	var cases []operationCase
+	var skipped []SkippedCase
+	skip := func(kind, reason string) {
+		skipped = append(skipped, SkippedCase{Case: kind, Reason: reason})
+	}
+
+	if op.RequestBody != nil && !isJSONContentType(op.RequestBody.ContentType) {
+		reason := fmt.Sprintf("request body content type %s isn't supported", op.RequestBody.ContentType)
+		skip(CaseHappyPath, reason)
+		skip(CaseMissingRequired, reason)
+		skip(CaseAuthFailure, reason)
+		return nil, skipped
+	}
+
+	requiresAuth := len(op.Auth) > 0
+	anonymous := false
+	for _, alternative := range op.Auth {
+		if len(alternative) == 0 {
+			anonymous = true
+		}
+	}
+
+	happy := happyPathCall(op)
+	happy.Authenticated = requiresAuth
+	success, ok := successExpectation(op)
+	if ok {
+		happy.Expect = success
+		cases = append(cases, operationCase{
+			kind:        CaseHappyPath,
+			description: fmt.Sprintf("%s %s with example values responds with %s", op.Method, op.Path, success),
+			call:        happy,
+		})
+	} else {
+		skip(CaseHappyPath, "no success response is documented")
+	}
+
+	if missing, what, ok := missingRequiredCall(op, happy); ok {
+		missing.Expect = statusExpectation{Min: 400, Max: 499}
+		cases = append(cases, operationCase{
+			kind:        CaseMissingRequired,
+			description: fmt.Sprintf("%s %s without %s is rejected with a 4xx status", op.Method, op.Path, what),
+			call:        missing,
+		})
+	} else {
+		skip(CaseMissingRequired, what)
+	}
+
+	switch {
+	case !requiresAuth:
+		skip(CaseAuthFailure, "no security requirement is declared")
+	case anonymous:
+		skip(CaseAuthFailure, "anonymous access is allowed")
+	default:
+		unauthenticated := happy
+		unauthenticated.Authenticated = false
+		unauthenticated.Expect = statusExpectation{Codes: []int{http.StatusUnauthorized, http.StatusForbidden}}
+		cases = append(cases, operationCase{
+			kind:        CaseAuthFailure,
+			description: fmt.Sprintf("%s %s without credentials is refused", op.Method, op.Path),
+			call:        unauthenticated,
+		})
+	}
+	return cases, skipped
+}
+
+// happyPathCall fills in every required parameter and the body from the
+// schemas' examples
+func happyPathCall(op APIOperation) apiCall {
+	call := apiCall{
+		Method:  op.Method,
+		Path:    op.Path,
+		Query:   map[string]string{},
+		Headers: map[string]string{},
+	}
+	var cookies []string
+	for _, param := range op.Parameters {
+		if !param.Required {
+			continue
+		}
+		value := paramString(sampleValue(decodeSchema(param.Schema), 0))
+		switch param.In {
+		case "path":
+			call.Path = strings.ReplaceAll(call.Path, "{"+param.Name+"}", url.PathEscape(value))
+		case "query":
+			call.Query[param.Name] = value
+		case "header":
+			call.Headers[param.Name] = value
+		case "cookie":
+			cookies = append(cookies, param.Name+"="+value)
+		}
+	}
+	if len(cookies) > 0 {
+		call.Headers["Cookie"] = strings.Join(cookies, "; ")
+	}
+	if op.RequestBody != nil {
+		body, _ := json.Marshal(sampleValue(decodeSchema(op.RequestBody.Schema), 0))
+		call.Body = string(body)
+	}
+	return call
+}
+
+// missingRequiredCall is the happy path without its first required query,
+// header or cookie parameter, or failing that its required body. It
+// returns what was left out, or why nothing could be.
+func missingRequiredCall(op APIOperation, happy apiCall) (apiCall, string, bool) {
+	missing := happy
+	missing.Query = copyStrings(happy.Query)
+	missing.Headers = copyStrings(happy.Headers)
+
+	onlyPath := false
+	for _, param := range op.Parameters {
+		if !param.Required {
+			continue
+		}
+		switch param.In {
+		case "query":
+			delete(missing.Query, param.Name)
+			return missing, "required query parameter " + param.Name, true
+		case "header":
+			delete(missing.Headers, param.Name)
+			return missing, "required header " + param.Name, true
+		case "cookie":
+			delete(missing.Headers, "Cookie")
+			return missing, "required cookie " + param.Name, true
+		case "path":
+			onlyPath = true
+		}
+	}
+	if op.RequestBody != nil && op.RequestBody.Required {
+		missing.Body = ""
+		return missing, "its required request body", true
+	}
+	if onlyPath {
+		return apiCall{}, "only path parameters are required, and leaving one out changes the route", false
+	}
+	return apiCall{}, "nothing is required", false
+}
+
+// successExpectation is the operation's documented success: its status
+// when exactly one 2xx is documented, otherwise any 2xx
+func successExpectation(op APIOperation) (statusExpectation, bool) {
+	var codes []int
+	ranged := false
+	for status := range op.Responses {
+		switch {
+		case strings.EqualFold(status, "2XX") || status == "default":
+			ranged = true
+		case strings.HasPrefix(status, "2"):
+			if code, err := strconv.Atoi(status); err == nil {
+				codes = append(codes, code)
+			}
+		}
+	}
+	if len(codes) == 1 && !ranged {
+		return statusExpectation{Codes: codes}, true
+	}
+	if len(codes) > 0 || ranged {
+		return statusExpectation{Min: 200, Max: 299}, true
+	}
+	return statusExpectation{}, false
+}
+
+// operationWords names an operation for its tests: its operation ID split
+// into lower-case words, or its method and path
+func operationWords(op APIOperation) []string {
+	source := op.ID
+	if source == "" {
+		source = op.Method + " " + strings.NewReplacer("{", " by ", "}", " ").Replace(op.Path)
+	}
+
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = nil
+		}
+	}
+	runes := []rune(source)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && len(word) > 0 && (unicode.IsLower(word[len(word)-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+	if len(words) == 0 {
+		words = []string{"operation"}
+	}
+	return words
+}
+
+func decodeSchema(raw json.RawMessage) map[string]interface{} {
+	var schema map[string]interface{}
+	json.Unmarshal(raw, &schema)
+	return schema
+}
+
+// sampleValue builds a value a schema accepts, preferring its examples,
+// default and enum over values made up from its type
+func sampleValue(schema map[string]interface{}, depth int) interface{} {
+	if schema == nil {
+		return "example"
+	}
+	if v, ok := schema["example"]; ok {
+		return v
+	}
+	if examples, ok := schema["examples"].([]interface{}); ok && len(examples) > 0 {
+		return examples[0]
+	}
+	if v, ok := schema["default"]; ok {
+		return v
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	if depth > maxSampleDepth {
+		return nil
+	}
+
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alternatives, ok := schema[key].([]interface{}); ok && len(alternatives) > 0 {
+			first, _ := alternatives[0].(map[string]interface{})
+			return sampleValue(first, depth+1)
+		}
+	}
+	if parts, ok := schema["allOf"].([]interface{}); ok {
+		merged := map[string]interface{}{}
+		for _, part := range parts {
+			partSchema, _ := part.(map[string]interface{})
+			if value, ok := sampleValue(partSchema, depth+1).(map[string]interface{}); ok {
+				for k, v := range value {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+
+	switch schemaType(schema) {
+	case "string":
+		return sampleString(schema)
+	case "integer":
+		if min, ok := schema["minimum"].(float64); ok {
+			return int(min)
+		}
+		return 1
+	case "number":
+		if min, ok := schema["minimum"].(float64); ok {
+			return min
+		}
+		return 1.5
+	case "boolean":
+		return true
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		return []interface{}{sampleValue(items, depth+1)}
+	case "object":
+		return sampleObject(schema, depth)
+	case "null":
+		return nil
+	}
+	return "example"
+}
+
+// schemaType is a schema's type, ignoring "null" in a list of types
+func schemaType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	return ""
+}
+
+func sampleString(schema map[string]interface{}) string {
+	var value string
+	switch schema["format"] {
+	case "date-time":
+		value = "2024-01-01T00:00:00Z"
+	case "date":
+		value = "2024-01-01"
+	case "email":
+		value = "user@example.com"
+	case "uuid":
+		value = "123e4567-e89b-12d3-a456-426614174000"
+	case "uri", "url":
+		value = "https://example.com"
+	case "ipv4":
+		value = "192.0.2.1"
+	default:
+		value = "example"
+	}
+	if min, ok := schema["minLength"].(float64); ok && len(value) < int(min) {
+		value += strings.Repeat("x", int(min)-len(value))
+	}
+	if max, ok := schema["maxLength"].(float64); ok && len(value) > int(max) {
+		value = value[:int(max)]
+	}
+	return value
+}
+
+// sampleObject fills in an object's required properties, or all of them
+// when none are required. Read-only properties are left out.
+func sampleObject(schema map[string]interface{}, depth int) map[string]interface{} {
+	properties, _ := schema["properties"].(map[string]interface{})
+	var names []string
+	for _, name := range asList(schema["required"]) {
+		if s, ok := name.(string); ok {
+			names = append(names, s)
+		}
+	}
+	if len(names) == 0 {
+		for name := range properties {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	object := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		property, _ := properties[name].(map[string]interface{})
+		if property["readOnly"] == true {
+			continue
+		}
+		object[name] = sampleValue(property, depth+1)
+	}
+	return object
+}
+
+func asList(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+// paramString renders a sample value as a parameter: arrays as
+// comma-separated values and objects as JSON
+func paramString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = paramString(item)
+		}
+		return strings.Join(parts, ",")
+	case map[string]interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func isJSONContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return contentType == "" || strings.Contains(contentType, "json")
+}
+
+func copyStrings(m map[string]string) map[string]string {
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonString quotes s for Python, JavaScript and Go alike: Go's escapes
+// are a subset of what all three accept
+func jsonString(s string) string {
+	return strconv.Quote(s)
+}
+
+// stringMapLiteral writes m as a map literal, after spread when it is set
+func stringMapLiteral(m map[string]string, spread, open, sep, close string) string {
+	entries := make([]string, 0, len(m)+1)
+	if spread != "" {
+		entries = append(entries, spread)
+	}
+	for _, k := range sortedKeys(m) {
+		entries = append(entries, jsonString(k)+sep+jsonString(m[k]))
+	}
+	return open + strings.Join(entries, ", ") + close
+}
+
+func pytestSetup(baseURL string) string {
+	return `import json
+import os
+
+import httpx
+import pytest
+
+BASE_URL = os.environ.get("API_BASE_URL", ` + jsonString(baseURL) + `)
+# Credentials for operations that need them, as a JSON object of headers
+AUTH_HEADERS = json.loads(os.environ.get("API_AUTH_HEADERS", "{}"))
+
+
+@pytest.fixture
+def client():
+    with httpx.Client(base_url=BASE_URL, timeout=10.0) as client:
+        yield client`
+}
+
+func pytestTest(name string, call apiCall) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "def %s(client):\n", name)
+	b.WriteString("    response = client.request(\n")
+	fmt.Fprintf(&b, "        %s,\n        %s,\n", jsonString(call.Method), jsonString(call.Path))
+	if len(call.Query) > 0 {
+		fmt.Fprintf(&b, "        params=%s,\n", stringMapLiteral(call.Query, "", "{", ": ", "}"))
+	}
+	spread := ""
+	if call.Authenticated {
+		spread = "**AUTH_HEADERS"
+	}
+	headers := stringMapLiteral(call.Headers, spread, "{", ": ", "}")
+	if headers != "{}" {
+		fmt.Fprintf(&b, "        headers=%s,\n", headers)
+	}
+	if call.Body != "" {
+		fmt.Fprintf(&b, "        json=json.loads(%s),\n", jsonString(call.Body))
+	}
+	b.WriteString("    )\n")
+
+	expect := call.Expect
+	switch {
+	case len(expect.Codes) == 1:
+		fmt.Fprintf(&b, "    assert response.status_code == %d, response.text", expect.Codes[0])
+	case len(expect.Codes) > 1:
+		codes := make([]string, len(expect.Codes))
+		for i, code := range expect.Codes {
+			codes[i] = strconv.Itoa(code)
+		}
+		fmt.Fprintf(&b, "    assert response.status_code in (%s), response.text", strings.Join(codes, ", "))
+	default:
+		fmt.Fprintf(&b, "    assert %d <= response.status_code <= %d, response.text", expect.Min, expect.Max)
+	}
+	return b.String()
+}
+
+func jestSetup(baseURL string) string {
+	return `const request = require('supertest');
+
+const BASE_URL = process.env.API_BASE_URL || ` + jsonString(baseURL) + `;
+// Credentials for operations that need them, as a JSON object of headers
+const AUTH_HEADERS = JSON.parse(process.env.API_AUTH_HEADERS || '{}');`
+}
+
+func jestTest(name string, call apiCall) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "test(%s, async () => {\n", jsonString(name))
+	b.WriteString("  const response = await request(BASE_URL)\n")
+	fmt.Fprintf(&b, "    .%s(%s)", strings.ToLower(call.Method), jsonString(call.Path))
+	if len(call.Query) > 0 {
+		fmt.Fprintf(&b, "\n    .query(%s)", stringMapLiteral(call.Query, "", "{", ": ", "}"))
+	}
+	spread := ""
+	if call.Authenticated {
+		spread = "...AUTH_HEADERS"
+	}
+	headers := stringMapLiteral(call.Headers, spread, "{", ": ", "}")
+	if headers != "{}" {
+		fmt.Fprintf(&b, "\n    .set(%s)", headers)
+	}
+	if call.Body != "" {
+		fmt.Fprintf(&b, "\n    .send(%s)", call.Body)
+	}
+	b.WriteString(";\n")
+
+	expect := call.Expect
+	switch {
+	case len(expect.Codes) == 1:
+		fmt.Fprintf(&b, "  expect(response.status).toBe(%d);\n", expect.Codes[0])
+	case len(expect.Codes) > 1:
+		codes := make([]string, len(expect.Codes))
+		for i, code := range expect.Codes {
+			codes[i] = strconv.Itoa(code)
+		}
+		fmt.Fprintf(&b, "  expect([%s]).toContain(response.status);\n", strings.Join(codes, ", "))
+	default:
+		fmt.Fprintf(&b, "  expect(response.status).toBeGreaterThanOrEqual(%d);\n", expect.Min)
+		fmt.Fprintf(&b, "  expect(response.status).toBeLessThanOrEqual(%d);\n", expect.Max)
+	}
+	b.WriteString("});")
+	return b.String()
+}
+
+func goSetup(baseURL string) string {
+	return `package apitest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// baseURL is the API under test, from API_BASE_URL
+func baseURL() string {
+	if v := os.Getenv("API_BASE_URL"); v != "" {
+		return strings.TrimRight(v, "/")
+	}
+	return ` + jsonString(strings.TrimRight(baseURL, "/")) + `
+}
+
+// authHeaders are credentials for operations that need them, from
+// API_AUTH_HEADERS as a JSON object of headers
+func authHeaders(t *testing.T) map[string]string {
+	headers := map[string]string{}
+	if v := os.Getenv("API_AUTH_HEADERS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &headers); err != nil {
+			t.Fatalf("invalid API_AUTH_HEADERS: %v", err)
+		}
+	}
+	return headers
+}
+
+// call makes a request to the API and returns the status and the start of
+// the body
+func call(t *testing.T, method, path string, query, headers map[string]string, body string, authenticated bool) (int, string) {
+	t.Helper()
+	u, err := url.Parse(baseURL() + path)
+	if err != nil {
+		t.Fatalf("invalid URL: %v", err)
+	}
+	q := u.Query()
+	for k, v := range query {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		t.Fatalf("invalid request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authenticated {
+		for k, v := range authHeaders(t) {
+			req.Header.Set(k, v)
+		}
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return resp.StatusCode, string(data)
+}`
+}
+
+func goTest(name string, call apiCall) string {
+	query := "nil"
+	if len(call.Query) > 0 {
+		query = stringMapLiteral(call.Query, "", "map[string]string{", ": ", "}")
+	}
+	headers := "nil"
+	if len(call.Headers) > 0 {
+		headers = stringMapLiteral(call.Headers, "", "map[string]string{", ": ", "}")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "func %s(t *testing.T) {\n", name)
+	fmt.Fprintf(&b, "\tstatus, body := call(t, %s, %s, %s, %s, %s, %t)\n",
+		jsonString(call.Method), jsonString(call.Path), query, headers, jsonString(call.Body), call.Authenticated)
+
+	expect := call.Expect
+	var conditions []string
+	if len(expect.Codes) > 0 {
+		for _, code := range expect.Codes {
+			conditions = append(conditions, fmt.Sprintf("status != %d", code))
+		}
+	} else {
+		conditions = append(conditions, fmt.Sprintf("status < %d || status > %d", expect.Min, expect.Max))
+	}
+	fmt.Fprintf(&b, "\tif %s {\n", strings.Join(conditions, " && "))
+	fmt.Fprintf(&b, "\t\tt.Errorf(\"got status %%d, want %s: %%s\", status, body)\n", expect)
+	b.WriteString("\t}\n}")
+	return b.String()
+}
+
+// ExecuteAPITests runs a suite in the sandbox against baseURL and reports
+// each test's result
+func (s *QTestService) ExecuteAPITests(ctx context.Context, suite TestSuite, framework apiFramework, baseURL string, authHeaders map[string]string) *APITestExecution {
+	auth, _ := json.Marshal(authHeaders)
+	if authHeaders == nil {
+		auth = []byte("{}")
+	}
+	code := suiteTestCode(suite)
+	report := &APITestExecution{BaseURL: baseURL, Results: []APITestResult{}}
+
+	result, err := s.sandbox.Execute(ctx, SandboxExecution{
+		Language:     framework.language,
+		Code:         code,
+		Files:        framework.files(code),
+		Dependencies: framework.dependencies,
+		Command:      framework.command,
+		Timeout:      int(runTimeout.Seconds()),
+		Environment: map[string]string{
+			"API_BASE_URL":     baseURL,
+			"API_AUTH_HEADERS": string(auth),
+		},
+		Network: "egress",
+	})
+	if err != nil {
+		report.Status = "error"
+		report.Error = err.Error()
+		return report
+	}
+
+	output := strings.TrimSpace(result.Output + "\n" + result.Error)
+	report.Status = result.Status
+	report.ExitCode = result.ExitCode
+	report.Output = output
+	if len(report.Output) > maxAPITestOutput {
+		report.Output = report.Output[:maxAPITestOutput] + "\n... (truncated)"
+	}
+
+	reported := flakinessRunners[framework.language].parse(output)
+	for _, test := range suite.Tests {
+		passed, ran := false, false
+		for name, ok := range reported {
+			if testCaseMatches(test.Name, name) {
+				passed, ran = ok, true
+				break
+			}
+		}
+		if !ran {
+			report.NotRun = append(report.NotRun, test.Name)
+			continue
+		}
+		report.Results = append(report.Results, APITestResult{Name: test.Name, Passed: passed})
+		if passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	return report
+}
+
+// defaultBaseURL is the spec's first server, made absolute against
+// fallbackBaseURL when it is a path
+func defaultBaseURL(spec *APISpec) string {
+	if len(spec.Servers) == 0 || spec.Servers[0] == "" {
+		return fallbackBaseURL
+	}
+	server := strings.TrimRight(spec.Servers[0], "/")
+	if strings.HasPrefix(server, "/") {
+		return fallbackBaseURL + server
+	}
+	return server
+}
+
+func (s *QTestService) testAPI(w http.ResponseWriter, r *http.Request) {
+	var req APITestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (req.SpecURL == "") == (len(req.Spec) == 0) {
+		http.Error(w, "one of spec_url or spec is required", http.StatusBadRequest)
+		return
+	}
+	framework, err := lookupAPIFramework(req.Framework)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.MaxOperations == 0 {
+		req.MaxOperations = defaultAPIOperations
+	}
+	if req.MaxOperations < 1 || req.MaxOperations > maxAPIOperations {
+		http.Error(w, fmt.Sprintf("max_operations must be between 1 and %d", maxAPIOperations), http.StatusBadRequest)
+		return
+	}
+	if req.Execute && req.BaseURL == "" {
+		http.Error(w, "base_url is required to execute the suite", http.StatusBadRequest)
+		return
+	}
+	if req.BaseURL != "" {
+		if u, err := url.Parse(req.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "base_url must be an http or https URL", http.StatusBadRequest)
+			return
+		}
+	}
+
+	input := map[string]interface{}{}
+	if req.SpecURL != "" {
+		input["url"] = req.SpecURL
+	} else {
+		input["spec"] = req.Spec
+	}
+	var spec APISpec
+	if err := s.mcp.Call(r.Context(), "api.read_spec", input, &spec); err != nil {
+		var mcpErr *MCPError
+		if errors.As(err, &mcpErr) && mcpErr.Status >= 400 && mcpErr.Status < 500 {
+			http.Error(w, "failed to read spec: "+mcpErr.Message, http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "failed to read spec: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	baseURL := strings.TrimRight(req.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL(&spec)
+	}
+	log.Printf("Generating %s contract tests for %d operations of %q", framework.name, len(spec.Operations), spec.Title)
+	suite, coverage := GenerateAPITests(&spec, framework, baseURL, req.MaxOperations)
+	s.suites.Save(suite, "", nil)
+	testsGenerated.WithLabelValues(framework.language, "contract").Add(float64(suite.TestCount))
+
+	response := APITestResponse{
+		Success:   true,
+		SpecTitle: spec.Title,
+		TestSuite: suite,
+		Coverage:  coverage,
+		Warnings:  spec.Unsupported,
+	}
+	if req.Execute && suite.TestCount > 0 {
+		response.Execution = s.ExecuteAPITests(r.Context(), suite, framework, baseURL, req.AuthHeaders)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
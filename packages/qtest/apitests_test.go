@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// petstoreSpec is what api.read_spec returns for a small pet store
+const petstoreSpec = `{
+	"title": "Petstore",
+	"version": "1.0.0",
+	"spec_version": "3.0.3",
+	"servers": ["https://petstore.example.com/v1"],
+	"operations": [
+		{
+			"operation_id": "listPets",
+			"method": "GET",
+			"path": "/pets",
+			"parameters": [{"name": "limit", "in": "query", "required": true, "schema": {"type": "integer", "minimum": 1}}],
+			"responses": {"200": {"content_type": "application/json", "schema": {"type": "array"}}},
+			"auth": [[], ["apiKey"]]
+		},
+		{
+			"operation_id": "createPet",
+			"method": "POST",
+			"path": "/pets",
+			"request_body": {
+				"required": true,
+				"content_type": "application/json",
+				"schema": {
+					"type": "object",
+					"required": ["name", "tag"],
+					"properties": {
+						"id": {"type": "integer", "readOnly": true},
+						"name": {"type": "string", "example": "Rex"},
+						"tag": {"type": "string", "enum": ["dog", "cat"]}
+					}
+				}
+			},
+			"responses": {"201": {"description": "Created"}, "400": {"description": "Invalid pet"}},
+			"auth": [["apiKey"]]
+		},
+		{
+			"operation_id": "getPetById",
+			"method": "GET",
+			"path": "/pets/{petId}",
+			"parameters": [{"name": "petId", "in": "path", "required": true, "schema": {"type": "string", "format": "uuid"}}],
+			"responses": {"200": {}, "404": {}}
+		},
+		{
+			"method": "PUT",
+			"path": "/pets/{petId}/photo",
+			"parameters": [{"name": "petId", "in": "path", "required": true, "schema": {"type": "string"}}],
+			"request_body": {"required": true, "content_type": "image/png"},
+			"responses": {"204": {}}
+		}
+	],
+	"security_schemes": {"apiKey": {"type": "apiKey", "in": "header", "name": "X-API-Key"}},
+	"unsupported": ["callbacks of createPet"]
+}`
+
+// mcpStub answers api.read_spec with the pet store, or fails with status
+// when it is set
+type mcpStub struct {
+	status int
+
+	mu    sync.Mutex
+	input map[string]interface{}
+}
+
+func (s *mcpStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tool  string                 `json:"tool"`
+		Input map[string]interface{} `json:"input"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	s.mu.Lock()
+	s.input = req.Input
+	s.mu.Unlock()
+
+	if req.Tool != "api.read_spec" {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "unknown tool"})
+		return
+	}
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "spec is not valid OpenAPI"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": json.RawMessage(petstoreSpec)})
+}
+
+// apiSandboxStub reports every test of a pytest run as passed except
+// those named in failing
+type apiSandboxStub struct {
+	failing []string
+
+	mu        sync.Mutex
+	execution SandboxExecution
+}
+
+func (s *apiSandboxStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodPost {
+		json.NewDecoder(r.Body).Decode(&s.execution)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(SandboxResult{ID: "exec-1", Status: "running"})
+		return
+	}
+
+	var output strings.Builder
+	for _, line := range strings.Split(s.execution.Code, "\n") {
+		if !strings.HasPrefix(line, "def test_") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(line, "def "), "(client):")
+		result := "PASSED"
+		for _, failing := range s.failing {
+			if name == failing {
+				result = "FAILED"
+			}
+		}
+		output.WriteString("test_api.py::" + name + " " + result + "\n")
+	}
+	json.NewEncoder(w).Encode(SandboxResult{ID: "exec-1", Status: "success", Output: output.String(), ExitCode: 1})
+}
+
+func newAPITestService(t *testing.T, mcp *mcpStub, sandbox http.Handler) http.Handler {
+	t.Helper()
+	mcpServer := httptest.NewServer(mcp)
+	t.Cleanup(mcpServer.Close)
+	sandboxServer := httptest.NewServer(sandbox)
+	t.Cleanup(sandboxServer.Close)
+
+	s := &QTestService{
+		suites: newSuiteStore(),
+		mcp:    &MCPClient{baseURL: mcpServer.URL, httpClient: mcpServer.Client()},
+		sandbox: &SandboxClient{
+			baseURL:      sandboxServer.URL,
+			httpClient:   sandboxServer.Client(),
+			pollInterval: time.Millisecond,
+		},
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/test-api", s.testAPI).Methods("POST")
+	return router
+}
+
+func postTestAPI(t *testing.T, router http.Handler, req APITestRequest) (*httptest.ResponseRecorder, APITestResponse) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/test-api", bytes.NewReader(body)))
+
+	var resp APITestResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return w, resp
+}
+
+func testCode(suite TestSuite, name string) string {
+	for _, test := range suite.Tests {
+		if test.Name == name {
+			return test.Code
+		}
+	}
+	return ""
+}
+
+func TestTestAPIGeneratesContractTests(t *testing.T) {
+	mcp := &mcpStub{}
+	router := newAPITestService(t, mcp, &apiSandboxStub{})
+
+	w, resp := postTestAPI(t, router, APITestRequest{SpecURL: "https://petstore.example.com/openapi.json"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if mcp.input["url"] != "https://petstore.example.com/openapi.json" {
+		t.Errorf("read_spec input = %v, want the spec URL", mcp.input)
+	}
+
+	suite := resp.TestSuite
+	if suite.Framework != "pytest" || suite.Language != "python" {
+		t.Errorf("suite is %s/%s, want pytest/python", suite.Framework, suite.Language)
+	}
+	if !strings.Contains(suite.SetupCode, `"https://petstore.example.com/v1"`) {
+		t.Errorf("setup doesn't default to the spec's server:\n%s", suite.SetupCode)
+	}
+	if len(resp.Warnings) != 1 {
+		t.Errorf("warnings = %v, want the unsupported callbacks", resp.Warnings)
+	}
+
+	wantTests := map[string][]string{
+		"GET /pets":               {"test_list_pets_happy_path", "test_list_pets_missing_required"},
+		"POST /pets":              {"test_create_pet_happy_path", "test_create_pet_missing_required", "test_create_pet_auth_failure"},
+		"GET /pets/{petId}":       {"test_get_pet_by_id_happy_path"},
+		"PUT /pets/{petId}/photo": {},
+	}
+	for key, want := range wantTests {
+		got := resp.Coverage.Operations[key]
+		if strings.Join(got.Tests, ",") != strings.Join(want, ",") {
+			t.Errorf("%s tests = %v, want %v", key, got.Tests, want)
+		}
+		if got.Covered != (len(want) > 0) {
+			t.Errorf("%s covered = %t", key, got.Covered)
+		}
+	}
+	if c := resp.Coverage; c.TotalOperations != 4 || c.CoveredOperations != 3 || c.SkippedOperations != 1 || c.Truncated {
+		t.Errorf("coverage = %+v, want 3 of 4 operations covered", c)
+	}
+	if suite.TestCount != 6 {
+		t.Errorf("test count = %d, want 6", suite.TestCount)
+	}
+
+	reasons := map[string]string{}
+	for key, op := range resp.Coverage.Operations {
+		for _, skipped := range op.Skipped {
+			reasons[key+" "+skipped.Case] = skipped.Reason
+		}
+	}
+	for key, want := range map[string]string{
+		"GET /pets auth_failure":               "anonymous access is allowed",
+		"GET /pets/{petId} missing_required":   "only path parameters are required",
+		"GET /pets/{petId} auth_failure":       "no security requirement is declared",
+		"PUT /pets/{petId}/photo happy_path":   "image/png",
+		"PUT /pets/{petId}/photo auth_failure": "image/png",
+		"POST /pets missing_required":          "",
+	} {
+		if got, ok := reasons[key]; want == "" && ok || want != "" && !strings.Contains(got, want) {
+			t.Errorf("%s skipped for %q, want %q", key, got, want)
+		}
+	}
+
+	create := testCode(suite, "test_create_pet_happy_path")
+	for _, want := range []string{`"POST"`, `headers={**AUTH_HEADERS}`, `json=json.loads("{\"name\":\"Rex\",\"tag\":\"dog\"}")`, "== 201"} {
+		if !strings.Contains(create, want) {
+			t.Errorf("create pet test is missing %s:\n%s", want, create)
+		}
+	}
+	if code := testCode(suite, "test_create_pet_missing_required"); strings.Contains(code, "json=") || !strings.Contains(code, "400 <= response.status_code <= 499") {
+		t.Errorf("missing body test should send no body and expect a 4xx:\n%s", code)
+	}
+	if code := testCode(suite, "test_create_pet_auth_failure"); strings.Contains(code, "AUTH_HEADERS") || !strings.Contains(code, "in (401, 403)") {
+		t.Errorf("auth failure test should send no credentials and expect 401 or 403:\n%s", code)
+	}
+	if code := testCode(suite, "test_list_pets_missing_required"); strings.Contains(code, "params=") {
+		t.Errorf("missing query test still sends limit:\n%s", code)
+	}
+	if code := testCode(suite, "test_get_pet_by_id_happy_path"); !strings.Contains(code, `"/pets/123e4567-e89b-12d3-a456-426614174000"`) || !strings.Contains(code, "== 200") {
+		t.Errorf("get pet test should fill in the path and expect its one 2xx:\n%s", code)
+	}
+	if resp.Execution != nil {
+		t.Error("suite was executed without execute")
+	}
+}
+
+func TestTestAPIFrameworks(t *testing.T) {
+	tests := []struct {
+		framework string
+		name      string
+		want      []string
+	}{
+		{
+			framework: "jest",
+			name:      "create pet happy path",
+			want:      []string{`.post("/pets")`, `.set({...AUTH_HEADERS})`, `.send({"name":"Rex","tag":"dog"})`, "toBe(201)"},
+		},
+		{
+			framework: "golang",
+			name:      "TestCreatePetHappyPath",
+			want:      []string{`call(t, "POST", "/pets", nil, nil, "{\"name\":\"Rex\",\"tag\":\"dog\"}", true)`, "status != 201"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.framework, func(t *testing.T) {
+			router := newAPITestService(t, &mcpStub{}, &apiSandboxStub{})
+			w, resp := postTestAPI(t, router, APITestRequest{Spec: json.RawMessage(`{"openapi":"3.0.0"}`), Framework: tt.framework})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			code := testCode(resp.TestSuite, tt.name)
+			for _, want := range tt.want {
+				if !strings.Contains(code, want) {
+					t.Errorf("%s is missing %s:\n%s", tt.name, want, code)
+				}
+			}
+		})
+	}
+}
+
+func TestTestAPITruncatesOperations(t *testing.T) {
+	router := newAPITestService(t, &mcpStub{}, &apiSandboxStub{})
+	w, resp := postTestAPI(t, router, APITestRequest{Spec: json.RawMessage(`{}`), MaxOperations: 2})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	c := resp.Coverage
+	if !c.Truncated || c.TruncatedOperations != 2 || c.CoveredOperations != 2 || c.SkippedOperations != 2 {
+		t.Errorf("coverage = %+v, want the last 2 operations truncated", c)
+	}
+	if skipped := c.Operations["GET /pets/{petId}"].Skipped; len(skipped) != 1 || !strings.Contains(skipped[0].Reason, "truncated") {
+		t.Errorf("truncated operation skipped = %v", skipped)
+	}
+}
+
+func TestTestAPIExecutesSuite(t *testing.T) {
+	sandbox := &apiSandboxStub{failing: []string{"test_create_pet_auth_failure"}}
+	router := newAPITestService(t, &mcpStub{}, sandbox)
+
+	w, resp := postTestAPI(t, router, APITestRequest{
+		SpecURL:     "https://petstore.example.com/openapi.json",
+		BaseURL:     "http://petstore.staging:8080/v1/",
+		Execute:     true,
+		AuthHeaders: map[string]string{"X-API-Key": "secret"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	execution := sandbox.execution
+	if execution.Network != "egress" || execution.Environment["API_BASE_URL"] != "http://petstore.staging:8080/v1" {
+		t.Errorf("sandbox execution network %q, environment %v", execution.Network, execution.Environment)
+	}
+	if execution.Environment["API_AUTH_HEADERS"] != `{"X-API-Key":"secret"}` {
+		t.Errorf("auth headers = %q", execution.Environment["API_AUTH_HEADERS"])
+	}
+	if execution.Files["test_api.py"] == "" || !strings.Contains(execution.Command, "pytest") {
+		t.Errorf("sandbox execution files %v, command %q", execution.Files, execution.Command)
+	}
+
+	report := resp.Execution
+	if report == nil {
+		t.Fatal("no execution report")
+	}
+	if report.Passed != 5 || report.Failed != 1 || len(report.NotRun) != 0 {
+		t.Errorf("execution = %+v, want 5 passed and 1 failed", report)
+	}
+	for _, result := range report.Results {
+		if result.Passed != (result.Name != "test_create_pet_auth_failure") {
+			t.Errorf("%s passed = %t", result.Name, result.Passed)
+		}
+	}
+}
+
+func TestTestAPIErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		mcpStatus int
+		req       APITestRequest
+		want      int
+	}{
+		{name: "no spec", req: APITestRequest{}, want: http.StatusBadRequest},
+		{name: "both specs", req: APITestRequest{SpecURL: "https://x", Spec: json.RawMessage(`{}`)}, want: http.StatusBadRequest},
+		{name: "unknown framework", req: APITestRequest{Spec: json.RawMessage(`{}`), Framework: "rspec"}, want: http.StatusBadRequest},
+		{name: "too many operations", req: APITestRequest{Spec: json.RawMessage(`{}`), MaxOperations: 500}, want: http.StatusBadRequest},
+		{name: "execute without base url", req: APITestRequest{Spec: json.RawMessage(`{}`), Execute: true}, want: http.StatusBadRequest},
+		{name: "invalid base url", req: APITestRequest{Spec: json.RawMessage(`{}`), BaseURL: "petstore:8080"}, want: http.StatusBadRequest},
+		{name: "invalid spec", mcpStatus: http.StatusBadRequest, req: APITestRequest{Spec: json.RawMessage(`{}`)}, want: http.StatusUnprocessableEntity},
+		{name: "gateway failure", mcpStatus: http.StatusInternalServerError, req: APITestRequest{Spec: json.RawMessage(`{}`)}, want: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newAPITestService(t, &mcpStub{status: tt.mcpStatus}, &apiSandboxStub{})
+			if w, _ := postTestAPI(t, router, tt.req); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
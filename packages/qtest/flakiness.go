@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+)
+
+// Flakiness detection runs a suite repeatedly in the sandbox-executor with a
+// different seed and, where the framework supports it, a shuffled test order
+// each time. A test that both passes and fails across runs is flaky.
+const (
+	defaultFlakinessRuns = 5
+	maxFlakinessRuns     = 20
+
+	defaultFlakinessParallelism = 4
+	defaultFlakinessBudget      = 5 * time.Minute
+	maxFlakinessBudget          = 15 * time.Minute
+
+	// runTimeout caps each sandbox execution, within the overall budget
+	runTimeout   = 2 * time.Minute
+	pollInterval = 500 * time.Millisecond
+
+	// maxCapturedOutput is how much of a run's output is kept per flaky test
+	maxCapturedOutput = 4096
+)
+
+var (
+	pytestResultPattern = regexp.MustCompile(`(?m)^\S+?::(\S+)\s+(PASSED|FAILED|ERROR)\b`)
+	goTestResultPattern = regexp.MustCompile(`(?m)^\s*--- (PASS|FAIL): (\S+)`)
+	jestResultPattern   = regexp.MustCompile(`(?m)^\s*(✓|✕|√|×)\s+(.+?)(?:\s+\(\d+(?:\.\d+)?\s*m?s\))?\s*$`)
+)
+
+// FlakinessRequest names a stored suite, or gives the code and tests inline
+type FlakinessRequest struct {
+	SuiteID  string `json:"suite_id,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Tests    string `json:"tests,omitempty"`
+	Language string `json:"language,omitempty"`
+	Runs     int    `json:"runs,omitempty"`
+	// TimeBudgetSeconds bounds the whole check; runs not started in time
+	// are skipped
+	TimeBudgetSeconds int `json:"time_budget_seconds,omitempty"`
+}
+
+// FlakinessReport gives each test's pass rate across the runs
+type FlakinessReport struct {
+	SuiteID         string          `json:"suite_id,omitempty"`
+	Language        string          `json:"language"`
+	Framework       string          `json:"framework"`
+	Runs            int             `json:"runs"`
+	CompletedRuns   int             `json:"completed_runs"`
+	Seeds           []int           `json:"seeds"`
+	Tests           []TestStability `json:"tests"`
+	FlakyTests      []string        `json:"flaky_tests"`
+	Improvements    []string        `json:"improvements,omitempty"`
+	RunErrors       []RunError      `json:"run_errors,omitempty"`
+	BudgetExhausted bool            `json:"budget_exhausted"`
+	Duration        float64         `json:"duration_seconds"`
+}
+
+// TestStability is how one test fared across the runs
+type TestStability struct {
+	Name     string  `json:"name"`
+	Runs     int     `json:"runs"`
+	Passed   int     `json:"passed"`
+	Failed   int     `json:"failed"`
+	PassRate float64 `json:"pass_rate"`
+	Flaky    bool    `json:"flaky"`
+	// Outputs holds the output of a passing and a failing run of a flaky
+	// test, so the difference can be inspected
+	Outputs []RunOutput `json:"outputs,omitempty"`
+}
+
+// RunOutput is the captured output of one run
+type RunOutput struct {
+	Run    int    `json:"run"`
+	Seed   int    `json:"seed"`
+	Passed bool   `json:"passed"`
+	Output string `json:"output"`
+}
+
+// RunError is a run that produced no test results
+type RunError struct {
+	Run   int    `json:"run"`
+	Seed  int    `json:"seed"`
+	Error string `json:"error"`
+}
+
+// runResult is the outcome of one run: each test's pass/fail and the output
+type runResult struct {
+	run     int
+	seed    int
+	results map[string]bool
+	output  string
+	err     error
+}
+
+// storedSuite is a generated suite with the code it tests
+type storedSuite struct {
+	Suite        TestSuite `json:"test_suite"`
+	Code         string    `json:"code"`
+	Improvements []string  `json:"improvements"`
+}
+
+// suiteStore keeps generated suites so they can be checked for flakiness
+type suiteStore struct {
+	mu     sync.Mutex
+	suites map[string]*storedSuite
+}
+
+func newSuiteStore() *suiteStore {
+	return &suiteStore{suites: make(map[string]*storedSuite)}
+}
+
+func (s *suiteStore) Save(suite TestSuite, code string, improvements []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.suites[suite.ID] = &storedSuite{Suite: suite, Code: code, Improvements: improvements}
+}
+
+// Get returns a copy of a stored suite
+func (s *suiteStore) Get(id string) (storedSuite, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.suites[id]
+	if !ok {
+		return storedSuite{}, false
+	}
+	copied := *stored
+	copied.Suite.Tests = append([]TestCase(nil), stored.Suite.Tests...)
+	copied.Improvements = append([]string(nil), stored.Improvements...)
+	return copied, true
+}
+
+// MarkFlaky annotates the suite's test cases matching the flaky tests and
+// adds the improvement suggestions
+func (s *suiteStore) MarkFlaky(id string, flaky []string, improvements []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.suites[id]
+	if !ok {
+		return
+	}
+	for i := range stored.Suite.Tests {
+		for _, name := range flaky {
+			if testCaseMatches(stored.Suite.Tests[i].Name, name) {
+				stored.Suite.Tests[i].Flaky = true
+			}
+		}
+	}
+	for _, improvement := range improvements {
+		if !containsString(stored.Improvements, improvement) {
+			stored.Improvements = append(stored.Improvements, improvement)
+		}
+	}
+}
+
+// testCaseMatches reports whether a test name reported by a framework is
+// the named test case. Frameworks prefix names with classes, describe
+// blocks or parent tests.
+func testCaseMatches(caseName, reported string) bool {
+	if caseName == reported {
+		return true
+	}
+	for _, sep := range []string{"::", "/", " ", "."} {
+		if strings.HasSuffix(reported, sep+caseName) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SandboxClient runs code in the sandbox-executor at SANDBOX_EXECUTOR_URL
+type SandboxClient struct {
+	baseURL      string
+	httpClient   *http.Client
+	pollInterval time.Duration
+}
+
+func NewSandboxClient() *SandboxClient {
+	baseURL := os.Getenv("SANDBOX_EXECUTOR_URL")
+	if baseURL == "" {
+		baseURL = "http://sandbox-executor.quantumlayer.svc.cluster.local:8085"
+	}
+	return &SandboxClient{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		pollInterval: pollInterval,
+	}
+}
+
+// SandboxExecution is a sandbox-executor execution request
+type SandboxExecution struct {
+	Language     string            `json:"language"`
+	Code         string            `json:"code"`
+	Files        map[string]string `json:"files,omitempty"`
+	Dependencies []string          `json:"dependencies,omitempty"`
+	Command      string            `json:"command,omitempty"`
+	Timeout      int               `json:"timeout,omitempty"`
+	Environment  map[string]string `json:"environment,omitempty"`
+	// Network is "egress" for executions that must reach the network
+	Network string `json:"network,omitempty"`
+}
+
+// SandboxResult is the part of a sandbox-executor result used here
+type SandboxResult struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// Execute starts an execution and polls until it finishes or ctx is done
+func (c *SandboxClient) Execute(ctx context.Context, execution SandboxExecution) (*SandboxResult, error) {
+	body, err := json.Marshal(execution)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/execute", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var started SandboxResult
+	if err := c.do(req, http.StatusAccepted, &started); err != nil {
+		return nil, fmt.Errorf("failed to start execution: %w", err)
+	}
+
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/executions/"+started.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result SandboxResult
+		if err := c.do(req, http.StatusOK, &result); err != nil {
+			return nil, fmt.Errorf("failed to get execution %s: %w", started.ID, err)
+		}
+		if result.Status != "running" {
+			return &result, nil
+		}
+	}
+}
+
+func (c *SandboxClient) do(req *http.Request, wantStatus int, out interface{}) error {
+	authmiddleware.SetServiceKey(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		return fmt.Errorf("sandbox-executor returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// flakinessRunner describes how to run one language's tests with a seed
+type flakinessRunner struct {
+	language     string
+	framework    string
+	files        func(code, tests string) map[string]string
+	dependencies []string
+	command      func(seed int) string
+	parse        func(output string) map[string]bool
+}
+
+var flakinessRunners = map[string]flakinessRunner{
+	"python": {
+		language:  "python",
+		framework: "pytest",
+		files: func(code, tests string) map[string]string {
+			return map[string]string{"test_main.py": tests}
+		},
+		dependencies: []string{"pytest", "pytest-randomly"},
+		command: func(seed int) string {
+			return fmt.Sprintf("python -m pytest -v -p no:cacheprovider -p randomly --randomly-seed=%d test_main.py", seed)
+		},
+		parse: func(output string) map[string]bool {
+			results := make(map[string]bool)
+			for _, m := range pytestResultPattern.FindAllStringSubmatch(output, -1) {
+				results[m[1]] = m[2] == "PASSED"
+			}
+			return results
+		},
+	},
+	"javascript": {
+		language:  "javascript",
+		framework: "jest",
+		files: func(code, tests string) map[string]string {
+			return map[string]string{"main.test.js": tests}
+		},
+		dependencies: []string{"jest"},
+		command: func(seed int) string {
+			return fmt.Sprintf("npx jest --verbose --ci --randomize --seed=%d", seed)
+		},
+		parse: func(output string) map[string]bool {
+			results := make(map[string]bool)
+			for _, m := range jestResultPattern.FindAllStringSubmatch(output, -1) {
+				results[m[2]] = m[1] == "✓" || m[1] == "√"
+			}
+			return results
+		},
+	},
+	"go": {
+		language:  "go",
+		framework: "testing",
+		files: func(code, tests string) map[string]string {
+			return map[string]string{
+				"go.mod":       "module sandbox\n\ngo 1.21\n",
+				"main_test.go": tests,
+			}
+		},
+		command: func(seed int) string {
+			return fmt.Sprintf("go test -v -count=1 -shuffle=%d ./...", seed)
+		},
+		parse: func(output string) map[string]bool {
+			results := make(map[string]bool)
+			for _, m := range goTestResultPattern.FindAllStringSubmatch(output, -1) {
+				results[m[2]] = m[1] == "PASS"
+			}
+			return results
+		},
+	},
+}
+
+// flakinessParallelism is how many runs execute at once, from
+// FLAKINESS_PARALLELISM
+func flakinessParallelism() int {
+	if v, err := strconv.Atoi(os.Getenv("FLAKINESS_PARALLELISM")); err == nil && v > 0 {
+		return v
+	}
+	return defaultFlakinessParallelism
+}
+
+var errUnsupportedFlakinessLanguage = errors.New("flakiness detection supports python, javascript and go")
+
+// CheckFlakiness runs the tests the given number of times and reports each
+// test's pass rate
+func (s *QTestService) CheckFlakiness(ctx context.Context, language, code, tests string, runs int, budget time.Duration) (*FlakinessReport, error) {
+	runner, ok := flakinessRunners[strings.ToLower(language)]
+	if !ok {
+		return nil, errUnsupportedFlakinessLanguage
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	base := rand.Intn(1 << 30)
+	report := &FlakinessReport{
+		Language:  runner.language,
+		Framework: runner.framework,
+		Runs:      runs,
+		Seeds:     make([]int, runs),
+	}
+	for i := range report.Seeds {
+		report.Seeds[i] = base + i
+	}
+
+	// Run in a bounded batch; runs still waiting when the budget runs out
+	// are skipped
+	results := make([]*runResult, runs)
+	sem := make(chan struct{}, s.flakinessParallelism)
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.runOnce(ctx, runner, i+1, report.Seeds[i], code, tests)
+		}(i)
+	}
+	wg.Wait()
+
+	summarizeRuns(report, results)
+	report.BudgetExhausted = ctx.Err() == context.DeadlineExceeded
+	report.Duration = time.Since(start).Seconds()
+	return report, nil
+}
+
+func (s *QTestService) runOnce(ctx context.Context, runner flakinessRunner, run, seed int, code, tests string) *runResult {
+	timeout := runTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	result := &runResult{run: run, seed: seed}
+	execution, err := s.sandbox.Execute(ctx, SandboxExecution{
+		Language:     runner.language,
+		Code:         code,
+		Files:        runner.files(code, tests),
+		Dependencies: runner.dependencies,
+		Command:      runner.command(seed),
+		Timeout:      int(timeout.Seconds()) + 1,
+	})
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	// Some frameworks report on stderr
+	result.output = strings.TrimSpace(execution.Output + "\n" + execution.Error)
+	result.results = runner.parse(result.output)
+	if len(result.results) == 0 {
+		result.err = fmt.Errorf("run reported no test results (status %s, exit code %d)", execution.Status, execution.ExitCode)
+	}
+	return result
+}
+
+// summarizeRuns fills in the report's per-test pass rates and flaky tests
+func summarizeRuns(report *FlakinessReport, results []*runResult) {
+	stability := make(map[string]*TestStability)
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		if result.err != nil {
+			report.RunErrors = append(report.RunErrors, RunError{Run: result.run, Seed: result.seed, Error: result.err.Error()})
+			continue
+		}
+		report.CompletedRuns++
+
+		for name, passed := range result.results {
+			test, ok := stability[name]
+			if !ok {
+				test = &TestStability{Name: name}
+				stability[name] = test
+			}
+			test.Runs++
+			if passed {
+				test.Passed++
+			} else {
+				test.Failed++
+			}
+		}
+	}
+
+	report.Tests = []TestStability{}
+	report.FlakyTests = []string{}
+	for _, test := range stability {
+		test.PassRate = float64(test.Passed) / float64(test.Runs)
+		test.Flaky = test.Passed > 0 && test.Failed > 0
+		if test.Flaky {
+			test.Outputs = differingOutputs(test.Name, results)
+			report.FlakyTests = append(report.FlakyTests, test.Name)
+			report.Improvements = append(report.Improvements, fmt.Sprintf(
+				"Test %s is flaky: it passed %d of %d runs. Remove its dependence on test order, timing, shared state or unseeded randomness",
+				test.Name, test.Passed, test.Runs))
+		}
+		report.Tests = append(report.Tests, *test)
+	}
+	sort.Slice(report.Tests, func(i, j int) bool { return report.Tests[i].Name < report.Tests[j].Name })
+	sort.Strings(report.FlakyTests)
+	sort.Strings(report.Improvements)
+	sort.Slice(report.RunErrors, func(i, j int) bool { return report.RunErrors[i].Run < report.RunErrors[j].Run })
+}
+
+// differingOutputs returns the output of the first passing and the first
+// failing run of a test
+func differingOutputs(name string, results []*runResult) []RunOutput {
+	var outputs []RunOutput
+	seen := make(map[bool]bool)
+	for _, result := range results {
+		if result == nil || result.err != nil {
+			continue
+		}
+		passed, ran := result.results[name]
+		if !ran || seen[passed] {
+			continue
+		}
+		seen[passed] = true
+
+		output := result.output
+		if len(output) > maxCapturedOutput {
+			output = output[:maxCapturedOutput] + "\n... (truncated)"
+		}
+		outputs = append(outputs, RunOutput{Run: result.run, Seed: result.seed, Passed: passed, Output: output})
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Run < outputs[j].Run })
+	return outputs
+}
+
+func (s *QTestService) checkFlakiness(w http.ResponseWriter, r *http.Request) {
+	var req FlakinessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Runs == 0 {
+		req.Runs = defaultFlakinessRuns
+	}
+	if req.Runs < 2 || req.Runs > maxFlakinessRuns {
+		http.Error(w, fmt.Sprintf("runs must be between 2 and %d", maxFlakinessRuns), http.StatusBadRequest)
+		return
+	}
+	budget := defaultFlakinessBudget
+	if req.TimeBudgetSeconds > 0 {
+		budget = time.Duration(req.TimeBudgetSeconds) * time.Second
+	}
+	if budget > maxFlakinessBudget {
+		budget = maxFlakinessBudget
+	}
+
+	code, tests, language := req.Code, req.Tests, req.Language
+	if req.SuiteID != "" {
+		stored, ok := s.suites.Get(req.SuiteID)
+		if !ok {
+			http.Error(w, "test suite not found", http.StatusNotFound)
+			return
+		}
+		code, tests, language = stored.Code, suiteTestCode(stored.Suite), stored.Suite.Language
+	}
+	if code == "" || tests == "" || language == "" {
+		http.Error(w, "suite_id, or code, tests and language, are required", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Checking %s tests for flakiness over %d runs", language, req.Runs)
+	report, err := s.CheckFlakiness(r.Context(), language, code, tests, req.Runs, budget)
+	if errors.Is(err, errUnsupportedFlakinessLanguage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.SuiteID != "" {
+		report.SuiteID = req.SuiteID
+		s.suites.MarkFlaky(req.SuiteID, report.FlakyTests, report.Improvements)
+	}
+	flakyTestsFound.Add(float64(len(report.FlakyTests)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// suiteTestCode assembles a stored suite into a single test file
+func suiteTestCode(suite TestSuite) string {
+	parts := []string{}
+	if suite.SetupCode != "" {
+		parts = append(parts, suite.SetupCode)
+	}
+	for _, test := range suite.Tests {
+		if test.Code != "" {
+			parts = append(parts, test.Code)
+		}
+	}
+	if suite.TeardownCode != "" {
+		parts = append(parts, suite.TeardownCode)
+	}
+	return strings.Join(parts, "\n\n")
+}
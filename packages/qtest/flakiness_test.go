@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var shufflePattern = regexp.MustCompile(`-shuffle=(\d+)`)
+
+// sandboxStub runs Go tests by seed: TestStable always passes and TestFlaky
+// passes only with an even seed. Each run takes delay.
+type sandboxStub struct {
+	delay time.Duration
+
+	mu         sync.Mutex
+	executions map[string]SandboxExecution
+	started    map[string]time.Time
+	running    int32
+	maxRunning int32
+}
+
+func newSandboxStub(t *testing.T, delay time.Duration) (*sandboxStub, *httptest.Server) {
+	t.Helper()
+	stub := &sandboxStub{
+		delay:      delay,
+		executions: make(map[string]SandboxExecution),
+		started:    make(map[string]time.Time),
+	}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+func (s *sandboxStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodPost {
+		var execution SandboxExecution
+		json.NewDecoder(r.Body).Decode(&execution)
+		id := fmt.Sprintf("exec-%d", len(s.executions)+1)
+		s.executions[id] = execution
+		s.started[id] = time.Now()
+		if running := atomic.AddInt32(&s.running, 1); running > s.maxRunning {
+			s.maxRunning = running
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(SandboxResult{ID: id, Status: "running"})
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/executions/")
+	execution, ok := s.executions[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if time.Since(s.started[id]) < s.delay {
+		json.NewEncoder(w).Encode(SandboxResult{ID: id, Status: "running"})
+		return
+	}
+	if _, done := s.started[id+"-done"]; !done {
+		s.started[id+"-done"] = time.Now()
+		atomic.AddInt32(&s.running, -1)
+	}
+
+	seed, _ := strconv.Atoi(shufflePattern.FindStringSubmatch(execution.Command)[1])
+	flaky := "--- PASS: TestFlaky (0.00s)"
+	if seed%2 == 1 {
+		flaky = "--- FAIL: TestFlaky (0.00s)\n    main_test.go:12: got 2, want 1"
+	}
+	output := fmt.Sprintf("-test.shuffle %d\n=== RUN   TestStable\n--- PASS: TestStable (0.00s)\n=== RUN   TestFlaky\n%s\n", seed, flaky)
+	json.NewEncoder(w).Encode(SandboxResult{ID: id, Status: "success", Output: output})
+}
+
+func newTestService(server *httptest.Server, parallelism int) *QTestService {
+	return &QTestService{
+		analyzer: NewCoverageAnalyzer(),
+		suites:   newSuiteStore(),
+		sandbox: &SandboxClient{
+			baseURL:      server.URL,
+			httpClient:   server.Client(),
+			pollInterval: time.Millisecond,
+		},
+		flakinessParallelism: parallelism,
+	}
+}
+
+func testRouter(s *QTestService) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/flakiness", s.checkFlakiness).Methods("POST")
+	router.HandleFunc("/api/v1/suites/{id}", s.getSuite).Methods("GET")
+	return router
+}
+
+func postFlakiness(t *testing.T, router http.Handler, req FlakinessRequest) (*httptest.ResponseRecorder, FlakinessReport) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/flakiness", bytes.NewReader(body)))
+
+	var report FlakinessReport
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+	}
+	return w, report
+}
+
+func TestCheckFlakinessInline(t *testing.T) {
+	stub, server := newSandboxStub(t, 0)
+	router := testRouter(newTestService(server, 3))
+
+	w, report := postFlakiness(t, router, FlakinessRequest{
+		Code:     "package main\n\nfunc main() {}\n",
+		Tests:    "package main\n",
+		Language: "go",
+		Runs:     6,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	if report.CompletedRuns != 6 || len(report.Seeds) != 6 || report.BudgetExhausted {
+		t.Fatalf("completed %d runs with seeds %v, budget exhausted %v", report.CompletedRuns, report.Seeds, report.BudgetExhausted)
+	}
+	if len(report.FlakyTests) != 1 || report.FlakyTests[0] != "TestFlaky" {
+		t.Fatalf("flaky tests = %v, want [TestFlaky]", report.FlakyTests)
+	}
+
+	// Consecutive seeds alternate between passing and failing TestFlaky
+	want := map[string]TestStability{
+		"TestFlaky":  {Runs: 6, Passed: 3, Failed: 3, PassRate: 0.5, Flaky: true},
+		"TestStable": {Runs: 6, Passed: 6, PassRate: 1},
+	}
+	for _, test := range report.Tests {
+		w := want[test.Name]
+		if test.Runs != w.Runs || test.Passed != w.Passed || test.Failed != w.Failed || test.PassRate != w.PassRate || test.Flaky != w.Flaky {
+			t.Fatalf("%s = %+v, want %+v", test.Name, test, w)
+		}
+	}
+
+	flaky := report.Tests[0]
+	if len(flaky.Outputs) != 2 || flaky.Outputs[0].Passed == flaky.Outputs[1].Passed {
+		t.Fatalf("outputs = %+v, want one passing and one failing run", flaky.Outputs)
+	}
+	for _, output := range flaky.Outputs {
+		if !strings.Contains(output.Output, fmt.Sprintf("-test.shuffle %d", output.Seed)) {
+			t.Fatalf("output of run %d is not from seed %d: %s", output.Run, output.Seed, output.Output)
+		}
+	}
+	if len(report.Improvements) != 1 || !strings.Contains(report.Improvements[0], "TestFlaky is flaky") {
+		t.Fatalf("improvements = %v", report.Improvements)
+	}
+
+	// Every run shuffles with its own seed
+	seen := make(map[string]bool)
+	for _, execution := range stub.executions {
+		if execution.Files["main_test.go"] != "package main\n" || execution.Language != "go" {
+			t.Fatalf("execution = %+v", execution)
+		}
+		seen[execution.Command] = true
+	}
+	if len(seen) != 6 {
+		t.Fatalf("%d distinct commands over 6 runs", len(seen))
+	}
+}
+
+func TestCheckFlakinessMarksStoredSuite(t *testing.T) {
+	_, server := newSandboxStub(t, 0)
+	service := newTestService(server, 2)
+	router := testRouter(service)
+
+	service.suites.Save(TestSuite{
+		ID:       "test-wf-1",
+		Language: "go",
+		Tests: []TestCase{
+			{Name: "TestStable", Code: "func TestStable(t *testing.T) {}"},
+			{Name: "TestFlaky", Code: "func TestFlaky(t *testing.T) {}"},
+		},
+	}, "package main\n\nfunc main() {}\n", []string{"Add tests for main in main.go"})
+
+	w, report := postFlakiness(t, router, FlakinessRequest{SuiteID: "test-wf-1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if report.SuiteID != "test-wf-1" || len(report.FlakyTests) != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/suites/test-wf-1", nil))
+	var stored storedSuite
+	json.Unmarshal(rec.Body.Bytes(), &stored)
+
+	for _, test := range stored.Suite.Tests {
+		if test.Flaky != (test.Name == "TestFlaky") {
+			t.Fatalf("%s flaky = %v", test.Name, test.Flaky)
+		}
+	}
+	if len(stored.Improvements) != 2 || !strings.Contains(stored.Improvements[1], "TestFlaky is flaky") {
+		t.Fatalf("stored improvements = %v", stored.Improvements)
+	}
+}
+
+func TestCheckFlakinessBoundsParallelism(t *testing.T) {
+	stub, server := newSandboxStub(t, 20*time.Millisecond)
+	router := testRouter(newTestService(server, 2))
+
+	w, report := postFlakiness(t, router, FlakinessRequest{Code: "package main", Tests: "package main", Language: "go", Runs: 8})
+	if w.Code != http.StatusOK || report.CompletedRuns != 8 {
+		t.Fatalf("status %d, completed %d runs", w.Code, report.CompletedRuns)
+	}
+	if stub.maxRunning > 2 {
+		t.Fatalf("%d runs at once, want at most 2", stub.maxRunning)
+	}
+}
+
+func TestCheckFlakinessRespectsBudget(t *testing.T) {
+	_, server := newSandboxStub(t, 700*time.Millisecond)
+	router := testRouter(newTestService(server, 1))
+
+	start := time.Now()
+	w, report := postFlakiness(t, router, FlakinessRequest{
+		Code: "package main", Tests: "package main", Language: "go", Runs: 5, TimeBudgetSeconds: 1,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("took %s with a 1s budget", elapsed)
+	}
+	if !report.BudgetExhausted || report.CompletedRuns >= 5 {
+		t.Fatalf("completed %d of 5 runs, budget exhausted %v", report.CompletedRuns, report.BudgetExhausted)
+	}
+}
+
+func TestCheckFlakinessValidation(t *testing.T) {
+	_, server := newSandboxStub(t, 0)
+	router := testRouter(newTestService(server, 1))
+
+	tests := []struct {
+		name       string
+		req        FlakinessRequest
+		wantStatus int
+	}{
+		{"too many runs", FlakinessRequest{Code: "x", Tests: "x", Language: "go", Runs: 21}, http.StatusBadRequest},
+		{"one run", FlakinessRequest{Code: "x", Tests: "x", Language: "go", Runs: 1}, http.StatusBadRequest},
+		{"no tests", FlakinessRequest{Code: "x", Language: "go"}, http.StatusBadRequest},
+		{"unsupported language", FlakinessRequest{Code: "x", Tests: "x", Language: "cobol"}, http.StatusBadRequest},
+		{"unknown suite", FlakinessRequest{SuiteID: "missing"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, _ := postFlakiness(t, router, tt.req); w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestFlakinessRunnersParseResults(t *testing.T) {
+	tests := []struct {
+		language string
+		output   string
+		want     map[string]bool
+	}{
+		{
+			"python",
+			"test_main.py::test_add PASSED                     [ 50%]\ntest_main.py::TestCalc::test_div FAILED  [100%]\n",
+			map[string]bool{"test_add": true, "TestCalc::test_div": false},
+		},
+		{
+			"javascript",
+			"PASS ./main.test.js\n  math\n    ✓ adds numbers (2 ms)\n    ✕ divides numbers (5 ms)\n    ✓ subtracts\n",
+			map[string]bool{"adds numbers": true, "divides numbers": false, "subtracts": true},
+		},
+		{
+			"go",
+			"=== RUN   TestAdd\n--- PASS: TestAdd (0.00s)\n=== RUN   TestDiv\n    --- FAIL: TestDiv/zero (0.00s)\n--- FAIL: TestDiv (0.00s)\n",
+			map[string]bool{"TestAdd": true, "TestDiv/zero": false, "TestDiv": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			got := flakinessRunners[tt.language].parse(tt.output)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("parse = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
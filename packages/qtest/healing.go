@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+	"github.com/gorilla/mux"
+)
+
+// Heal history actions
+const (
+	HealActionHeal   = "heal"
+	HealActionRevert = "revert"
+)
+
+// healWorkflowPrefix namespaces the quantum-drops workflows heal histories
+// are kept in
+const healWorkflowPrefix = "qtest-heal-"
+
+// HealStore keeps the heals applied to each test, oldest first
+type HealStore interface {
+	Append(ctx context.Context, entry TestHistory) error
+	History(ctx context.Context, testID string) ([]TestHistory, error)
+}
+
+// NewHealStore keeps heal histories in quantum-drops at QUANTUM_DROPS_URL,
+// so they survive restarts and are shared between replicas. Without it they
+// are kept in memory.
+func NewHealStore() HealStore {
+	baseURL := os.Getenv("QUANTUM_DROPS_URL")
+	if baseURL == "" {
+		log.Println("⚠️ QUANTUM_DROPS_URL is not set, heal history is kept in memory")
+		return newMemoryHealStore()
+	}
+	return &DropsHealStore{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// memoryHealStore keeps heal histories for the life of the process
+type memoryHealStore struct {
+	mu      sync.Mutex
+	history map[string][]TestHistory
+}
+
+func newMemoryHealStore() *memoryHealStore {
+	return &memoryHealStore{history: make(map[string][]TestHistory)}
+}
+
+func (s *memoryHealStore) Append(_ context.Context, entry TestHistory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history[entry.TestID] = append(s.history[entry.TestID], entry)
+	return nil
+}
+
+func (s *memoryHealStore) History(_ context.Context, testID string) ([]TestHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]TestHistory(nil), s.history[testID]...), nil
+}
+
+// DropsHealStore keeps each test's heal history as the drops of a
+// quantum-drops workflow: every entry is a drop whose artifact is the test
+// code it produced
+type DropsHealStore struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// healDrop is the part of a quantum drop the store reads and writes
+type healDrop struct {
+	ID         string                 `json:"id"`
+	WorkflowID string                 `json:"workflow_id"`
+	RequestID  string                 `json:"request_id"`
+	Stage      string                 `json:"stage"`
+	Type       string                 `json:"type"`
+	Artifact   string                 `json:"artifact"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Version    int                    `json:"version"`
+}
+
+func (s *DropsHealStore) Append(ctx context.Context, entry TestHistory) error {
+	artifact := entry.TestCode
+	entry.TestCode = ""
+	body, err := json.Marshal(healDrop{
+		ID:         entry.ID,
+		WorkflowID: healWorkflowPrefix + entry.TestID,
+		RequestID:  entry.TestID,
+		Stage:      entry.Action,
+		Type:       "tests",
+		Artifact:   artifact,
+		Metadata:   map[string]interface{}{"heal": entry},
+		Version:    entry.Sequence,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/api/v1/drops", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return s.do(req, http.StatusCreated, nil)
+}
+
+func (s *DropsHealStore) History(ctx context.Context, testID string) ([]TestHistory, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		s.baseURL+"/api/v1/workflows/"+url.PathEscape(healWorkflowPrefix+testID)+"/drops", nil)
+	if err != nil {
+		return nil, err
+	}
+	var collection struct {
+		Drops []healDrop `json:"drops"`
+	}
+	if err := s.do(req, http.StatusOK, &collection); err != nil {
+		return nil, err
+	}
+
+	history := []TestHistory{}
+	for _, drop := range collection.Drops {
+		raw, err := json.Marshal(drop.Metadata["heal"])
+		if err != nil {
+			return nil, err
+		}
+		var entry TestHistory
+		if err := json.Unmarshal(raw, &entry); err != nil || entry.Action == "" {
+			continue
+		}
+		entry.TestCode = drop.Artifact
+		history = append(history, entry)
+	}
+	return history, nil
+}
+
+func (s *DropsHealStore) do(req *http.Request, wantStatus int, out interface{}) error {
+	authmiddleware.SetServiceKey(req)
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("quantum-drops returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// record appends an entry to a test's history, numbering it after the
+// entries before it
+func (e *SelfHealingEngine) record(ctx context.Context, history []TestHistory, entry TestHistory) (TestHistory, error) {
+	entry.Sequence = len(history) + 1
+	entry.ID = fmt.Sprintf("heal-%s-%d-%d", entry.TestID, entry.Sequence, entry.Timestamp.UnixNano())
+	return entry, e.store.Append(ctx, entry)
+}
+
+// testVersions maps every test version in a history to its code
+func testVersions(history []TestHistory) map[string]string {
+	versions := make(map[string]string)
+	for _, entry := range history {
+		if _, ok := versions[entry.PreviousVersion]; !ok && entry.PreviousVersion != "" {
+			versions[entry.PreviousVersion] = entry.PreviousCode
+		}
+		versions[entry.TestVersion] = entry.TestCode
+	}
+	return versions
+}
+
+// getHealHistory lists the heals and reverts applied to a test, oldest
+// first
+func (s *QTestService) getHealHistory(w http.ResponseWriter, r *http.Request) {
+	testID := mux.Vars(r)["test_id"]
+	history, err := s.selfHealing.store.History(r.Context(), testID)
+	if err != nil {
+		log.Printf("Failed to load heal history of %s: %v", testID, err)
+		http.Error(w, "failed to load heal history", http.StatusBadGateway)
+		return
+	}
+
+	current := ""
+	if len(history) > 0 {
+		current = history[len(history)-1].TestVersion
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"test_id":         testID,
+		"current_version": current,
+		"history":         history,
+		"count":           len(history),
+	})
+}
+
+// revertHeal restores a test to an earlier version: the one in the body's
+// "version", or the test as it was before its first heal. The revert is
+// itself recorded, so it can be undone the same way.
+func (s *QTestService) revertHeal(w http.ResponseWriter, r *http.Request) {
+	testID := mux.Vars(r)["test_id"]
+	var req struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.selfHealing.mu.Lock()
+	defer s.selfHealing.mu.Unlock()
+
+	history, err := s.selfHealing.store.History(r.Context(), testID)
+	if err != nil {
+		log.Printf("Failed to load heal history of %s: %v", testID, err)
+		http.Error(w, "failed to load heal history", http.StatusBadGateway)
+		return
+	}
+	if len(history) == 0 {
+		http.Error(w, "test has no heal history", http.StatusNotFound)
+		return
+	}
+
+	target := req.Version
+	if target == "" {
+		target = history[0].PreviousVersion
+	}
+	code, ok := testVersions(history)[target]
+	if !ok {
+		http.Error(w, fmt.Sprintf("test has no version %q", target), http.StatusNotFound)
+		return
+	}
+	last := history[len(history)-1]
+	if last.TestVersion == target {
+		http.Error(w, fmt.Sprintf("test is already at version %q", target), http.StatusConflict)
+		return
+	}
+
+	entry, err := s.selfHealing.record(r.Context(), history, TestHistory{
+		TestID:          testID,
+		Action:          HealActionRevert,
+		Timestamp:       time.Now(),
+		CodeVersion:     last.CodeVersion,
+		PreviousVersion: last.TestVersion,
+		PreviousCode:    last.TestCode,
+		TestVersion:     target,
+		TestCode:        code,
+		Success:         true,
+	})
+	if err != nil {
+		log.Printf("Failed to record revert of %s: %v", testID, err)
+		http.Error(w, "failed to record revert", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"test_id":       testID,
+		"test_code":     code,
+		"test_version":  target,
+		"reverted_from": last.TestVersion,
+		"entry":         entry,
+	})
+}
+
+// functionDefinition matches the names of functions defined in Go, Python
+// and JavaScript/TypeScript code
+var functionDefinition = regexp.MustCompile(`(?m)^\s*(?:func\s+(?:\([^)]*\)\s*)?|(?:async\s+)?def\s+|(?:export\s+)?(?:async\s+)?function\s+)([A-Za-z_]\w*)`)
+
+// codeRename is a function renamed between two versions of the code
+type codeRename struct {
+	From string
+	To   string
+}
+
+func (c codeRename) String() string {
+	return fmt.Sprintf("renamed %s to %s", c.From, c.To)
+}
+
+func definedFunctions(code string) []string {
+	var names []string
+	for _, match := range functionDefinition.FindAllStringSubmatch(code, -1) {
+		if !containsString(names, match[1]) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// missingFrom returns the names not in other, in order
+func missingFrom(names, other []string) []string {
+	var missing []string
+	for _, name := range names {
+		if !containsString(other, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// changedFunctions pairs the functions that disappeared from the code with
+// those that appeared, in order of definition, as renames
+func changedFunctions(oldCode, newCode string) []codeRename {
+	oldNames, newNames := definedFunctions(oldCode), definedFunctions(newCode)
+	removed, added := missingFrom(oldNames, newNames), missingFrom(newNames, oldNames)
+	renames := []codeRename{}
+	for i := 0; i < len(removed) && i < len(added); i++ {
+		renames = append(renames, codeRename{From: removed[i], To: added[i]})
+	}
+	return renames
+}
+
+// renameIdentifiers rewrites whole-word uses of renamed functions in test
+// code, all at once so chained renames don't compound
+func renameIdentifiers(testCode string, renames []codeRename) string {
+	if len(renames) == 0 {
+		return testCode
+	}
+	to := make(map[string]string, len(renames))
+	names := make([]string, 0, len(renames))
+	for _, rename := range renames {
+		to[rename.From] = rename.To
+		names = append(names, regexp.QuoteMeta(rename.From))
+	}
+	pattern := regexp.MustCompile(`\b(?:` + strings.Join(names, "|") + `)\b`)
+	return pattern.ReplaceAllStringFunc(testCode, func(name string) string { return to[name] })
+}
+
+func versionHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// dropsStub keeps drops posted to it by workflow, like quantum-drops
+type dropsStub struct {
+	mu    sync.Mutex
+	drops map[string][]healDrop
+	keys  []string
+}
+
+func newDropsStub(t *testing.T) (*dropsStub, *httptest.Server) {
+	t.Helper()
+	stub := &dropsStub{drops: make(map[string][]healDrop)}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/drops", func(w http.ResponseWriter, r *http.Request) {
+		var drop healDrop
+		json.NewDecoder(r.Body).Decode(&drop)
+		stub.mu.Lock()
+		stub.drops[drop.WorkflowID] = append(stub.drops[drop.WorkflowID], drop)
+		stub.keys = append(stub.keys, r.Header.Get("X-API-Key"))
+		stub.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(drop)
+	}).Methods("POST")
+	router.HandleFunc("/api/v1/workflows/{workflow_id}/drops", func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		drops := stub.drops[mux.Vars(r)["workflow_id"]]
+		json.NewEncoder(w).Encode(map[string]interface{}{"drops": drops, "total_drops": len(drops)})
+	}).Methods("GET")
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+func healRouter(store HealStore) *mux.Router {
+	s := &QTestService{selfHealing: &SelfHealingEngine{enabled: true, store: store}}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/heal", s.healTests).Methods("POST")
+	router.HandleFunc("/api/v1/heal/history/{test_id}", s.getHealHistory).Methods("GET")
+	router.HandleFunc("/api/v1/heal/revert/{test_id}", s.revertHeal).Methods("POST")
+	return router
+}
+
+func healRequest(t *testing.T, router http.Handler, method, path string, body interface{}, out interface{}) int {
+	t.Helper()
+	var raw []byte
+	if body != nil {
+		raw, _ = json.Marshal(body)
+	}
+	reader := bytes.NewReader(raw)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, reader))
+	if out != nil && w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode %s: %v", path, err)
+		}
+	}
+	return w.Code
+}
+
+type healHistoryResponse struct {
+	CurrentVersion string        `json:"current_version"`
+	History        []TestHistory `json:"history"`
+	Count          int           `json:"count"`
+}
+
+const originalTest = `func TestAdd(t *testing.T) {
+	if add(1, 2) != 3 {
+		t.Fatal("add(1, 2) != 3")
+	}
+}`
+
+// healTwice renames add to sum, then sum to plus, healing the test after
+// each rename
+func healTwice(t *testing.T, router http.Handler) []string {
+	t.Helper()
+	testCode := originalTest
+	var healed []string
+	for _, rename := range [][2]string{{"add", "sum"}, {"sum", "plus"}} {
+		var resp struct {
+			HealedTest string   `json:"healed_test"`
+			Changes    []string `json:"changes"`
+		}
+		code := healRequest(t, router, http.MethodPost, "/api/v1/heal", map[string]string{
+			"test_id":      "calc-add",
+			"old_code":     "func " + rename[0] + "(a, b int) int { return a + b }",
+			"current_code": "func " + rename[1] + "(a, b int) int { return a + b }",
+			"test_code":    testCode,
+			"failure_msg":  "undefined: " + rename[0],
+		}, &resp)
+		if code != http.StatusOK {
+			t.Fatalf("heal %v: status %d", rename, code)
+		}
+		if len(resp.Changes) != 1 || !strings.Contains(resp.HealedTest, rename[1]+"(1, 2)") {
+			t.Fatalf("heal %v: changes %v, healed test %s", rename, resp.Changes, resp.HealedTest)
+		}
+		testCode = resp.HealedTest
+		healed = append(healed, testCode)
+	}
+	return healed
+}
+
+func TestHealHistoryAndRevert(t *testing.T) {
+	_, drops := newDropsStub(t)
+	stores := map[string]func() HealStore{
+		"memory":        func() HealStore { return newMemoryHealStore() },
+		"quantum-drops": func() HealStore { return &DropsHealStore{baseURL: drops.URL, httpClient: drops.Client()} },
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			router := healRouter(newStore())
+			healed := healTwice(t, router)
+
+			var history healHistoryResponse
+			if code := healRequest(t, router, http.MethodGet, "/api/v1/heal/history/calc-add", nil, &history); code != http.StatusOK {
+				t.Fatalf("history: status %d", code)
+			}
+			if history.Count != 2 || history.CurrentVersion != versionHash(healed[1]) {
+				t.Fatalf("history = %+v", history)
+			}
+			first, second := history.History[0], history.History[1]
+			if first.Action != HealActionHeal || first.PreviousVersion != versionHash(originalTest) || first.TestCode != healed[0] ||
+				first.FailureMsg != "undefined: add" || first.Changes[0] != "renamed add to sum" {
+				t.Errorf("first heal = %+v", first)
+			}
+			if second.Sequence != 2 || second.PreviousVersion != first.TestVersion || second.TestCode != healed[1] {
+				t.Errorf("second heal = %+v", second)
+			}
+
+			// Without a version the test goes back to before its first heal
+			var reverted struct {
+				TestCode     string `json:"test_code"`
+				TestVersion  string `json:"test_version"`
+				RevertedFrom string `json:"reverted_from"`
+			}
+			if code := healRequest(t, router, http.MethodPost, "/api/v1/heal/revert/calc-add", nil, &reverted); code != http.StatusOK {
+				t.Fatalf("revert: status %d", code)
+			}
+			if reverted.TestCode != originalTest || reverted.TestVersion != versionHash(originalTest) || reverted.RevertedFrom != versionHash(healed[1]) {
+				t.Errorf("revert = %+v", reverted)
+			}
+
+			// A restarted service sees the same history, revert included
+			restarted := router
+			if name == "quantum-drops" {
+				restarted = healRouter(newStore())
+			}
+			healRequest(t, restarted, http.MethodGet, "/api/v1/heal/history/calc-add", nil, &history)
+			if history.Count != 3 || history.History[2].Action != HealActionRevert || history.CurrentVersion != versionHash(originalTest) {
+				t.Fatalf("history after revert = %+v", history)
+			}
+
+			// The revert can be undone like a heal
+			if code := healRequest(t, restarted, http.MethodPost, "/api/v1/heal/revert/calc-add",
+				map[string]string{"version": versionHash(healed[0])}, &reverted); code != http.StatusOK || reverted.TestCode != healed[0] {
+				t.Errorf("revert to first heal: status %d, %+v", code, reverted)
+			}
+		})
+	}
+}
+
+func TestRevertHealErrors(t *testing.T) {
+	router := healRouter(newMemoryHealStore())
+	if code := healRequest(t, router, http.MethodPost, "/api/v1/heal/revert/unknown", nil, nil); code != http.StatusNotFound {
+		t.Errorf("test without history: status %d, want 404", code)
+	}
+
+	healTwice(t, router)
+	if code := healRequest(t, router, http.MethodPost, "/api/v1/heal/revert/calc-add", map[string]string{"version": "0123456789ab"}, nil); code != http.StatusNotFound {
+		t.Errorf("unknown version: status %d, want 404", code)
+	}
+	if code := healRequest(t, router, http.MethodPost, "/api/v1/heal/revert/calc-add", map[string]string{"version": versionHash(originalTest)}, nil); code != http.StatusOK {
+		t.Fatalf("revert: status %d", code)
+	}
+	if code := healRequest(t, router, http.MethodPost, "/api/v1/heal/revert/calc-add", nil, nil); code != http.StatusConflict {
+		t.Errorf("revert to the current version: status %d, want 409", code)
+	}
+	if code := healRequest(t, router, http.MethodPost, "/api/v1/heal", map[string]string{"test_code": originalTest}, nil); code != http.StatusBadRequest {
+		t.Errorf("heal without test_id: status %d, want 400", code)
+	}
+}
+
+func TestHealSendsServiceKey(t *testing.T) {
+	t.Setenv("SERVICE_API_KEY", "qtest-key")
+	stub, drops := newDropsStub(t)
+	router := healRouter(&DropsHealStore{baseURL: drops.URL, httpClient: drops.Client()})
+	healTwice(t, router)
+	if len(stub.keys) != 2 || stub.keys[0] != "qtest-key" {
+		t.Errorf("quantum-drops got keys %v", stub.keys)
+	}
+
+	drops.Close()
+	if code := healRequest(t, router, http.MethodPost, "/api/v1/heal", map[string]string{"test_id": "calc-add"}, nil); code != http.StatusBadGateway {
+		t.Errorf("heal with quantum-drops down: status %d, want 502", code)
+	}
+}
+
+func TestAnalyzeCodeChanges(t *testing.T) {
+	s := &QTestService{}
+	tests := []struct {
+		name     string
+		old, new string
+		test     string
+		want     string
+	}{
+		{"python", "def total(items):\n    pass", "def grand_total(items):\n    pass", "assert total([1]) == 1", "assert grand_total([1]) == 1"},
+		{"javascript", "export async function load() {}", "export async function fetchAll() {}", "await load(); loader()", "await fetchAll(); loader()"},
+		{"go method", "func (c *Cart) Add(item Item) {}", "func (c *Cart) Put(item Item) {}", "cart.Add(item)", "cart.Put(item)"},
+		{"swapped names", "func a() {}\nfunc b() {}", "func b() {}\nfunc c() {}", "a(); b()", "c(); b()"},
+		{"unchanged", "func a() {}", "func a() { return }", "a()", "a()"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.adaptTestToChanges(tt.test, s.analyzeCodeChanges(tt.old, tt.new)); got != tt.want {
+				t.Errorf("healed test = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := renameIdentifiers("a(b())", []codeRename{{"a", "b"}, {"b", "c"}}); got != "b(c())" {
+		t.Errorf("chained renames = %q, want b(c())", got)
+	}
+}
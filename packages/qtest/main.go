@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -54,6 +55,8 @@ type TestCase struct {
 	Mocks       []Mock   `json:"mocks,omitempty"`
 	Expected    string   `json:"expected"`
 	Coverage    float64  `json:"coverage"`
+	// Flaky is set when the test both passed and failed across repeated runs
+	Flaky bool `json:"flaky,omitempty"`
 }
 
 type Mock struct {
@@ -83,16 +86,31 @@ type UncoveredCode struct {
 // Self-healing test capabilities
 type SelfHealingEngine struct {
 	enabled bool
-	history map[string][]TestHistory
+	store   HealStore
+
+	// mu keeps a test's history from changing between reading and
+	// appending to it
+	mu sync.Mutex
 }
 
+// TestHistory is one heal, or revert of a heal, applied to a test
 type TestHistory struct {
+	ID          string    `json:"id"`
+	TestID      string    `json:"test_id"`
+	Sequence    int       `json:"sequence"`
+	Action      string    `json:"action"` // heal, revert
 	Timestamp   time.Time `json:"timestamp"`
 	CodeVersion string    `json:"code_version"`
-	TestVersion string    `json:"test_version"`
-	Success     bool      `json:"success"`
-	FailureMsg  string    `json:"failure_msg,omitempty"`
-	AutoFixed   bool      `json:"auto_fixed"`
+	// PreviousVersion and PreviousCode are the test before this entry,
+	// TestVersion and TestCode the test after it
+	PreviousVersion string   `json:"previous_version"`
+	PreviousCode    string   `json:"previous_code,omitempty"`
+	TestVersion     string   `json:"test_version"`
+	TestCode        string   `json:"test_code,omitempty"`
+	Changes         []string `json:"changes,omitempty"`
+	Success         bool     `json:"success"`
+	FailureMsg      string   `json:"failure_msg,omitempty"`
+	AutoFixed       bool     `json:"auto_fixed"`
 }
 
 // Metrics
@@ -119,18 +137,31 @@ var (
 			Help: "Total number of self-healing fixes applied",
 		},
 	)
+
+	flakyTestsFound = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "qtest_flaky_tests_found_total",
+			Help: "Total number of flaky tests found by repeated runs",
+		},
+	)
 )
 
 type QTestService struct {
 	selfHealing *SelfHealingEngine
 	llmClient   *LLMClient
 	analyzer    *CoverageAnalyzer
+	suites      *suiteStore
+	sandbox     *SandboxClient
+	mcp         *MCPClient
+
+	flakinessParallelism int
 }
 
 func init() {
 	prometheus.MustRegister(testsGenerated)
 	prometheus.MustRegister(coverageAchieved)
 	prometheus.MustRegister(selfHealingFixes)
+	prometheus.MustRegister(flakyTestsFound)
 }
 
 func main() {
@@ -139,10 +170,15 @@ func main() {
 	service := &QTestService{
 		selfHealing: &SelfHealingEngine{
 			enabled: true,
-			history: make(map[string][]TestHistory),
+			store:   NewHealStore(),
 		},
 		llmClient:   NewLLMClient(),
 		analyzer:    NewCoverageAnalyzer(),
+		suites:      newSuiteStore(),
+		sandbox:     NewSandboxClient(),
+		mcp:         NewMCPClient(),
+
+		flakinessParallelism: flakinessParallelism(),
 	}
 	
 	router := mux.NewRouter()
@@ -152,14 +188,18 @@ func main() {
 	router.HandleFunc("/api/v1/generate", service.generateTests).Methods("POST")
 	router.HandleFunc("/api/v1/analyze", service.analyzeCoverage).Methods("POST")
 	router.HandleFunc("/api/v1/heal", service.healTests).Methods("POST")
+	router.HandleFunc("/api/v1/heal/history/{test_id}", service.getHealHistory).Methods("GET")
+	router.HandleFunc("/api/v1/heal/revert/{test_id}", service.revertHeal).Methods("POST")
 	router.HandleFunc("/api/v1/validate", service.validateTests).Methods("POST")
 	router.HandleFunc("/api/v1/performance", service.generatePerformanceTests).Methods("POST")
+	router.HandleFunc("/api/v1/flakiness", service.checkFlakiness).Methods("POST")
+	router.HandleFunc("/api/v1/suites/{id}", service.getSuite).Methods("GET")
+	router.HandleFunc("/api/v1/test-api", service.testAPI).Methods("POST")
 	
 	// NEW: MCP-powered API endpoints
 	// Note: These would be implemented in api/handlers.go and registered here
 	// router.HandleFunc("/api/v1/test-github", api.testGitHubRepo).Methods("POST")
 	// router.HandleFunc("/api/v1/test-website", api.testWebsite).Methods("POST")
-	// router.HandleFunc("/api/v1/test-api", api.testAPI).Methods("POST")
 	// router.HandleFunc("/api/v1/mcp/tools", api.listMCPTools).Methods("GET")
 	
 	// Metrics endpoint
@@ -247,6 +287,9 @@ func (s *QTestService) generateTests(w http.ResponseWriter, r *http.Request) {
 	
 	// Generate improvement suggestions
 	improvements := s.suggestImprovements(coverage)
+
+	// Keep the suite so it can be checked for flakiness
+	s.suites.Save(suite, req.Code, improvements)
 	
 	// Update metrics
 	testsGenerated.WithLabelValues(req.Language, req.TestType).Add(float64(len(tests)))
@@ -362,6 +405,17 @@ func (s *QTestService) generatePerformanceTestCases(code, language string) []Tes
 	}
 }
 
+func (s *QTestService) getSuite(w http.ResponseWriter, r *http.Request) {
+	stored, ok := s.suites.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "test suite not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stored)
+}
+
 func (s *QTestService) analyzeCoverage(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Code  string     `json:"code"`
@@ -393,6 +447,10 @@ func (s *QTestService) healTests(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.TestID == "" {
+		http.Error(w, "test_id is required", http.StatusBadRequest)
+		return
+	}
 	
 	// Analyze what changed
 	changes := s.analyzeCodeChanges(req.OldCode, req.CurrentCode)
@@ -401,21 +459,39 @@ func (s *QTestService) healTests(w http.ResponseWriter, r *http.Request) {
 	healedTest := s.adaptTestToChanges(req.TestCode, changes)
 	
 	// Record healing action
-	s.selfHealing.history[req.TestID] = append(s.selfHealing.history[req.TestID], TestHistory{
-		Timestamp:   time.Now(),
-		CodeVersion: s.hashCode(req.CurrentCode),
-		TestVersion: s.hashCode(healedTest),
-		Success:     true,
-		AutoFixed:   true,
-	})
+	s.selfHealing.mu.Lock()
+	defer s.selfHealing.mu.Unlock()
+	history, err := s.selfHealing.store.History(r.Context(), req.TestID)
+	if err == nil {
+		_, err = s.selfHealing.record(r.Context(), history, TestHistory{
+			TestID:          req.TestID,
+			Action:          HealActionHeal,
+			Timestamp:       time.Now(),
+			CodeVersion:     s.hashCode(req.CurrentCode),
+			PreviousVersion: s.hashCode(req.TestCode),
+			PreviousCode:    req.TestCode,
+			TestVersion:     s.hashCode(healedTest),
+			TestCode:        healedTest,
+			Changes:         changes,
+			Success:         true,
+			FailureMsg:      req.FailureMsg,
+			AutoFixed:       true,
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to record heal of %s: %v", req.TestID, err)
+		http.Error(w, "failed to record heal", http.StatusBadGateway)
+		return
+	}
 	
 	selfHealingFixes.Inc()
 	
 	response := map[string]interface{}{
-		"success":     true,
-		"healed_test": healedTest,
-		"changes":     changes,
-		"confidence":  0.95,
+		"success":      true,
+		"healed_test":  healedTest,
+		"changes":      changes,
+		"confidence":   0.95,
+		"test_version": s.hashCode(healedTest),
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
@@ -597,15 +673,26 @@ func (s *QTestService) generateTeardownCode(language, framework string) string {
 }
 
 func (s *QTestService) analyzeCodeChanges(oldCode, newCode string) []string {
-	return []string{}
+	changes := []string{}
+	for _, rename := range changedFunctions(oldCode, newCode) {
+		changes = append(changes, rename.String())
+	}
+	return changes
 }
 
 func (s *QTestService) adaptTestToChanges(testCode string, changes []string) string {
-	return testCode
+	var renames []codeRename
+	for _, change := range changes {
+		var rename codeRename
+		if _, err := fmt.Sscanf(change, "renamed %s to %s", &rename.From, &rename.To); err == nil {
+			renames = append(renames, rename)
+		}
+	}
+	return renameIdentifiers(testCode, renames)
 }
 
 func (s *QTestService) hashCode(code string) string {
-	return ""
+	return versionHash(code)
 }
 
 func (s *QTestService) validateTestCase(test TestCase, language string) bool {
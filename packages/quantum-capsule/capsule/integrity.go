@@ -0,0 +1,189 @@
+package quantumcapsule
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Archive entries written by PackageAsTarGz that are not capsule files
+const (
+	manifestFileName = "QUANTUM_MANIFEST.json"
+	metadataFileName = "QUANTUM_CAPSULE.json"
+)
+
+// IntegrityReport describes the result of verifying a packaged capsule
+type IntegrityReport struct {
+	Valid          bool     `json:"valid"`
+	ExpectedDigest string   `json:"expected_digest"`
+	ActualDigest   string   `json:"actual_digest"`
+	Mismatched     []string `json:"mismatched,omitempty"` // content hash differs
+	Missing        []string `json:"missing,omitempty"`    // recorded but not in archive
+	Unexpected     []string `json:"unexpected,omitempty"` // in archive but not recorded
+
+	Signed         bool     `json:"signed"`
+	SignatureValid bool     `json:"signature_valid"`
+	KeyID          string   `json:"key_id,omitempty"`
+	SignatureError string   `json:"signature_error,omitempty"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// HashContent returns the hex encoded SHA-256 of file content
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ManifestDigest computes the capsule digest from per-file hashes. Paths are
+// sorted so the digest doesn't depend on file order.
+func ManifestDigest(fileHashes map[string]string) string {
+	paths := make([]string, 0, len(fileHashes))
+	for path := range fileHashes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s\x00%s\n", path, fileHashes[path])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// computeChecksums fills in each file's hash and returns the manifest digest
+func computeChecksums(files []CapsuleFile) string {
+	hashes := make(map[string]string, len(files))
+	for i := range files {
+		files[i].Hash = HashContent([]byte(files[i].Content))
+		hashes[files[i].Path] = files[i].Hash
+	}
+	return ManifestDigest(hashes)
+}
+
+// VerifyCapsule reads a packaged capsule, recomputes every file hash and the
+// manifest digest, and compares them with the checksums recorded at creation.
+// A signed capsule must also carry a valid signature by publicKey; unsigned
+// capsules, or signed ones when publicKey is nil, are checked for integrity
+// only and get a warning. An error is returned only when the archive can't
+// be read at all; integrity failures are reported in the IntegrityReport.
+func VerifyCapsule(capsuleData []byte, publicKey ed25519.PublicKey) (*QuantumCapsule, *IntegrityReport, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(capsuleData))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	var capsule *QuantumCapsule
+	var manifest *CapsuleManifest
+	var signature *Signature
+	actual := make(map[string]string)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		content, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read file %s: %w", header.Name, err)
+		}
+
+		switch header.Name {
+		case metadataFileName:
+			if err := json.Unmarshal(content, &capsule); err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal capsule metadata: %w", err)
+			}
+		case manifestFileName:
+			if err := json.Unmarshal(content, &manifest); err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+			}
+		case signatureFileName:
+			if err := json.Unmarshal(content, &signature); err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal signature: %w", err)
+			}
+		default:
+			actual[header.Name] = HashContent(content)
+		}
+	}
+
+	if capsule == nil {
+		return nil, nil, fmt.Errorf("no capsule metadata found")
+	}
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("no manifest found")
+	}
+
+	// Prefer the manifest's checksums; fall back to the capsule metadata for
+	// archives packaged before the manifest recorded them
+	expected := manifest.Files
+	expectedDigest := manifest.Digest
+	if len(expected) == 0 {
+		expected = make(map[string]string, len(capsule.Files))
+		for _, file := range capsule.Files {
+			expected[file.Path] = file.Hash
+		}
+	}
+	if expectedDigest == "" {
+		expectedDigest = capsule.Checksum
+	}
+
+	report := &IntegrityReport{
+		ExpectedDigest: expectedDigest,
+		ActualDigest:   ManifestDigest(actual),
+	}
+
+	for path, hash := range expected {
+		got, ok := actual[path]
+		switch {
+		case !ok:
+			report.Missing = append(report.Missing, path)
+		case got != hash:
+			report.Mismatched = append(report.Mismatched, path)
+		}
+	}
+	for path := range actual {
+		if _, ok := expected[path]; !ok {
+			report.Unexpected = append(report.Unexpected, path)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Mismatched)
+	sort.Strings(report.Unexpected)
+
+	report.Signed = signature != nil
+	switch {
+	case signature == nil:
+		report.Warnings = append(report.Warnings, "capsule is not signed")
+	case publicKey == nil:
+		report.KeyID = signature.KeyID
+		report.Warnings = append(report.Warnings, "no signing key configured, signature not verified")
+	default:
+		report.KeyID = signature.KeyID
+		if err := verifySignature(signature, publicKey, ManifestDigest(expected)); err != nil {
+			report.SignatureError = err.Error()
+		} else {
+			report.SignatureValid = true
+		}
+	}
+
+	report.Valid = len(report.Missing) == 0 &&
+		len(report.Mismatched) == 0 &&
+		len(report.Unexpected) == 0 &&
+		report.ActualDigest == report.ExpectedDigest &&
+		report.SignatureError == ""
+
+	return capsule, report, nil
+}
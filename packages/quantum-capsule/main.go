@@ -2,15 +2,23 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	capsule "github.com/QuantumLayer-dev/quantumlayer-platform/packages/quantum-capsule/capsule"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/quantum-capsule/storage"
 )
 
 // CapsuleRequest for creating a new capsule
@@ -21,10 +29,43 @@ type CapsuleRequest struct {
 	Metadata   map[string]interface{} `json:"metadata"`
 }
 
-// Storage for capsules (in-memory for now, should use S3/MinIO in production)
-var capsuleStorage = make(map[string]*capsule.QuantumCapsule)
+// Storage for capsules, selected with CAPSULE_STORE
+var capsuleStore storage.Store
+
+// Signs new capsules; nil when CAPSULE_SIGNING_KEY is unset
+var capsuleSigner *capsule.Signer
 
 func main() {
+	var err error
+	capsuleStore, err = storage.NewStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize capsule store: %v", err)
+	}
+
+	capsuleSigner, err = capsule.NewSignerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load capsule signing key: %v", err)
+	}
+	if capsuleSigner != nil {
+		log.Printf("Signing capsules with key %s", capsuleSigner.KeyID())
+	} else {
+		log.Printf("CAPSULE_SIGNING_KEY not set, capsules will be unsigned")
+	}
+
+	// Optional TTL based cleanup, e.g. CAPSULE_TTL=168h
+	if ttlValue := os.Getenv("CAPSULE_TTL"); ttlValue != "" {
+		ttl, err := time.ParseDuration(ttlValue)
+		if err != nil {
+			log.Fatalf("Invalid CAPSULE_TTL %q: %v", ttlValue, err)
+		}
+		interval := time.Hour
+		if ttl < interval {
+			interval = ttl
+		}
+		storage.NewExpirer(capsuleStore, ttl, nil).Start(interval, make(chan struct{}))
+		log.Printf("Capsules expire after %s", ttl)
+	}
+
 	r := gin.Default()
 
 	// Health check
@@ -45,6 +86,9 @@ func main() {
 		
 		// Get capsule metadata
 		v1.GET("/capsules/:id", handleGetCapsule)
+
+		// Delete a capsule
+		v1.DELETE("/capsules/:id", handleDeleteCapsule)
 		
 		// Download capsule as tar.gz
 		v1.GET("/capsules/:id/download", handleDownloadCapsule)
@@ -57,6 +101,9 @@ func main() {
 		
 		// Validate a capsule
 		v1.POST("/capsules/validate", handleValidateCapsule)
+
+		// Public key for verifying capsule signatures
+		v1.GET("/signing-key", handleGetSigningKey)
 	}
 
 	port := os.Getenv("PORT")
@@ -88,33 +135,89 @@ func handleCreateCapsule(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if capsuleSigner != nil {
+		cap.Sign(capsuleSigner)
+	}
 
-	// Store in memory
-	capsuleStorage[cap.ID] = cap
+	if err := capsuleStore.Save(cap); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusCreated, cap)
 }
 
-func handleGetCapsule(c *gin.Context) {
-	id := c.Param("id")
-	
-	cap, exists := capsuleStorage[id]
-	if !exists {
+// loadCapsule fetches the capsule named by the :id parameter, writing an
+// error response and returning nil if it can't be loaded
+func loadCapsule(c *gin.Context) *capsule.QuantumCapsule {
+	cap, err := capsuleStore.Get(c.Param("id"))
+	if err == storage.ErrNotFound {
 		c.JSON(http.StatusNotFound, gin.H{"error": "capsule not found"})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	return cap
+}
+
+func handleGetCapsule(c *gin.Context) {
+	cap := loadCapsule(c)
+	if cap == nil {
 		return
 	}
 
 	c.JSON(http.StatusOK, cap)
 }
 
-func handleDownloadCapsule(c *gin.Context) {
+func handleDeleteCapsule(c *gin.Context) {
 	id := c.Param("id")
-	
-	cap, exists := capsuleStorage[id]
-	if !exists {
+
+	err := capsuleStore.Delete(id)
+	if err == storage.ErrNotFound {
 		c.JSON(http.StatusNotFound, gin.H{"error": "capsule not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":     id,
+		"status": "deleted",
+	})
+}
+
+func handleDownloadCapsule(c *gin.Context) {
+	// With ?presigned=true, redirect to object storage instead of proxying
+	// the archive. Stores that can't presign serve it directly.
+	if presigner, ok := capsuleStore.(storage.Presigner); ok && c.Query("presigned") == "true" {
+		u, err := presigner.PresignDownload(c.Param("id"), presignedURLExpiry)
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "capsule not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusTemporaryRedirect, u.String())
+		return
+	}
+
+	cap := loadCapsule(c)
+	if cap == nil {
+		return
+	}
+
+	// Large capsules are streamed with chunked encoding rather than built
+	// in memory; smaller ones are buffered so Content-Length can be sent
+	if cap.EstimatedArchiveSize() > downloadStreamThreshold() {
+		streamCapsule(c, cap)
+		return
+	}
 
 	// Package as tar.gz
 	data, err := cap.PackageAsTarGz()
@@ -132,14 +235,62 @@ func handleDownloadCapsule(c *gin.Context) {
 	c.Data(http.StatusOK, "application/gzip", data)
 }
 
+// presignedURLExpiry is how long a presigned download URL stays valid
+const presignedURLExpiry = 15 * time.Minute
+
+// Capsules estimated above this size are streamed, overridable with
+// CAPSULE_STREAM_THRESHOLD_BYTES
+const defaultDownloadStreamThreshold = 32 << 20 // 32MB
+
+func downloadStreamThreshold() int64 {
+	if v := os.Getenv("CAPSULE_STREAM_THRESHOLD_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultDownloadStreamThreshold
+}
+
+// streamCapsule writes the archive straight to the response. Once the first
+// bytes are sent the status can't change, so a failure part way through is
+// only logged; the archive is left without its gzip trailer, which clients
+// reject as truncated.
+func streamCapsule(c *gin.Context, cap *capsule.QuantumCapsule) {
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.tar.gz", cap.ID))
+	c.Status(http.StatusOK)
+
+	if err := cap.PackageToWriter(c.Writer); err != nil {
+		log.Printf("Failed to stream capsule %s: %v", cap.ID, err)
+		c.Abort()
+		return
+	}
+	c.Writer.Flush()
+}
+
 func handleListCapsules(c *gin.Context) {
-	capsules := make([]*capsule.QuantumCapsule, 0, len(capsuleStorage))
-	for _, cap := range capsuleStorage {
-		capsules = append(capsules, cap)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	capsules, total, err := capsuleStore.List(offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"total": len(capsules),
+		"total":    total,
+		"count":    len(capsules),
+		"offset":   offset,
+		"limit":    limit,
 		"capsules": capsules,
 	})
 }
@@ -161,15 +312,9 @@ func handleCreateFromWorkflow(c *gin.Context) {
 		workflowAPI = "http://workflow-api.temporal.svc.cluster.local:8080"
 	}
 
-	resp, err := http.Get(fmt.Sprintf("%s/api/v1/workflows/%s/result", workflowAPI, req.WorkflowID))
+	body, status, err := fetchWorkflowResult(c.Request.Context(), fmt.Sprintf("%s/api/v1/workflows/%s/result", workflowAPI, req.WorkflowID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch workflow result"})
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusNotFound, gin.H{"error": "workflow result not found"})
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -186,8 +331,8 @@ func handleCreateFromWorkflow(c *gin.Context) {
 		} `json:"metadata"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse workflow result"})
+	if err := json.Unmarshal(body, &result); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to parse workflow result"})
 		return
 	}
 
@@ -219,13 +364,103 @@ func handleCreateFromWorkflow(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if capsuleSigner != nil {
+		cap.Sign(capsuleSigner)
+	}
 
 	// Store
-	capsuleStorage[cap.ID] = cap
+	if err := capsuleStore.Save(cap); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusCreated, cap)
 }
 
+// Defaults for fetching workflow results, overridable with
+// WORKFLOW_FETCH_TIMEOUT (duration) and WORKFLOW_RESULT_MAX_BYTES
+const (
+	defaultWorkflowFetchTimeout = 30 * time.Second
+	defaultWorkflowResultMax    = 50 << 20 // 50MB
+)
+
+var errWorkflowResultTooLarge = errors.New("workflow result exceeds maximum size")
+
+func workflowFetchTimeout() time.Duration {
+	if v := os.Getenv("WORKFLOW_FETCH_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultWorkflowFetchTimeout
+}
+
+func workflowResultMaxBytes() int64 {
+	if v := os.Getenv("WORKFLOW_RESULT_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultWorkflowResultMax
+}
+
+// fetchWorkflowResult downloads a workflow result bounded by a timeout and a
+// maximum body size. On failure it returns the HTTP status to report:
+// 504 on timeout, 413 when the result is too large, 404 when the workflow
+// API has no result and 502 for other upstream failures.
+func fetchWorkflowResult(parent context.Context, url string) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(parent, workflowFetchTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to build workflow request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if isTimeout(ctx, err) {
+			return nil, http.StatusGatewayTimeout, errors.New("timed out fetching workflow result")
+		}
+		return nil, http.StatusBadGateway, errors.New("failed to fetch workflow result")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, http.StatusNotFound, errors.New("workflow result not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, http.StatusBadGateway, fmt.Errorf("workflow API returned status %d", resp.StatusCode)
+	}
+
+	maxBytes := workflowResultMaxBytes()
+	if resp.ContentLength > maxBytes {
+		return nil, http.StatusRequestEntityTooLarge, errWorkflowResultTooLarge
+	}
+
+	// Read one byte past the limit so an oversized body is detected without buffering it all
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		if isTimeout(ctx, err) {
+			return nil, http.StatusGatewayTimeout, errors.New("timed out reading workflow result")
+		}
+		return nil, http.StatusBadGateway, errors.New("failed to read workflow result")
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, http.StatusRequestEntityTooLarge, errWorkflowResultTooLarge
+	}
+
+	return body, http.StatusOK, nil
+}
+
+func isTimeout(ctx context.Context, err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
 func handleValidateCapsule(c *gin.Context) {
 	// Read uploaded file
 	file, header, err := c.Request.FormFile("capsule")
@@ -242,8 +477,12 @@ func handleValidateCapsule(c *gin.Context) {
 		return
 	}
 
-	// Validate capsule
-	cap, err := capsule.ValidateCapsule(buf.Bytes())
+	// Validate capsule structure, recompute checksums and check the signature
+	var publicKey ed25519.PublicKey
+	if capsuleSigner != nil {
+		publicKey = capsuleSigner.PublicKey()
+	}
+	cap, report, err := capsule.VerifyCapsule(buf.Bytes(), publicKey)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"valid": false,
@@ -252,10 +491,37 @@ func handleValidateCapsule(c *gin.Context) {
 		return
 	}
 
+	if !report.Valid {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"valid":     false,
+			"error":     "capsule integrity check failed",
+			"signed":    report.Signed,
+			"integrity": report,
+			"filename":  header.Filename,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"valid":    true,
-		"capsule":  cap,
-		"filename": header.Filename,
-		"size":     header.Size,
+		"valid":     true,
+		"signed":    report.Signed,
+		"warnings":  report.Warnings,
+		"capsule":   cap,
+		"integrity": report,
+		"filename":  header.Filename,
+		"size":      header.Size,
 	})
-}
\ No newline at end of file
+}
+
+func handleGetSigningKey(c *gin.Context) {
+	if capsuleSigner == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "capsule signing is not configured"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"key_id":     capsuleSigner.KeyID(),
+		"algorithm":  capsule.SignatureAlgorithm,
+		"public_key": base64.StdEncoding.EncodeToString(capsuleSigner.PublicKey()),
+	})
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	capsule "github.com/QuantumLayer-dev/quantumlayer-platform/packages/quantum-capsule/capsule"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/quantum-capsule/storage"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func packagedCapsule(t *testing.T, tamper bool) []byte {
+	t.Helper()
+	cap, err := capsule.CreateCapsule("wf-1", []capsule.CapsuleFile{
+		{Path: "main.go", Content: "package main\n", Mode: 0644},
+	}, nil)
+	if err != nil {
+		t.Fatalf("CreateCapsule: %v", err)
+	}
+	if tamper {
+		// Changed after the checksums were recorded
+		cap.Files[0].Content = "package evil\n"
+	}
+	data, err := cap.PackageAsTarGz()
+	if err != nil {
+		t.Fatalf("PackageAsTarGz: %v", err)
+	}
+	return data
+}
+
+func uploadCapsule(t *testing.T, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("capsule", "capsule.tar.gz")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	r := gin.New()
+	r.POST("/api/v1/capsules/validate", handleValidateCapsule)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/capsules/validate", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandleValidateCapsule(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           []byte
+		wantStatus     int
+		wantMismatched []string
+	}{
+		{"valid", packagedCapsule(t, false), http.StatusOK, nil},
+		{"tampered", packagedCapsule(t, true), http.StatusUnprocessableEntity, []string{"main.go"}},
+		{"not an archive", []byte("garbage"), http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := uploadCapsule(t, tt.data)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			var resp struct {
+				Valid     bool                     `json:"valid"`
+				Integrity *capsule.IntegrityReport `json:"integrity"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.Valid != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("valid = %v", resp.Valid)
+			}
+			if tt.wantMismatched != nil {
+				if resp.Integrity == nil || len(resp.Integrity.Mismatched) != 1 || resp.Integrity.Mismatched[0] != tt.wantMismatched[0] {
+					t.Fatalf("integrity = %+v, want %v mismatched", resp.Integrity, tt.wantMismatched)
+				}
+			}
+		})
+	}
+}
+
+// useSigner signs capsules with a fixed test key for the rest of the test
+func useSigner(t *testing.T) *capsule.Signer {
+	t.Helper()
+	signer := capsule.NewSigner(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize)))
+	capsuleSigner = signer
+	t.Cleanup(func() { capsuleSigner = nil })
+	return signer
+}
+
+func TestHandleValidateSignedCapsule(t *testing.T) {
+	tests := []struct {
+		name         string
+		sign         bool
+		tamper       bool
+		wantStatus   int
+		wantSigned   bool
+		wantWarnings int
+	}{
+		{"signed", true, false, http.StatusOK, true, 0},
+		{"signed and tampered", true, true, http.StatusUnprocessableEntity, true, 0},
+		{"unsigned legacy capsule", false, false, http.StatusOK, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := useSigner(t)
+			cap, err := capsule.CreateCapsule("wf-1", []capsule.CapsuleFile{
+				{Path: "main.go", Content: "package main\n", Mode: 0644},
+			}, nil)
+			if err != nil {
+				t.Fatalf("CreateCapsule: %v", err)
+			}
+			if tt.sign {
+				cap.Sign(signer)
+			}
+			if tt.tamper {
+				cap.Files[0].Content = "package evil\n"
+			}
+			data, err := cap.PackageAsTarGz()
+			if err != nil {
+				t.Fatalf("PackageAsTarGz: %v", err)
+			}
+
+			w := uploadCapsule(t, data)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			var resp struct {
+				Signed    bool                     `json:"signed"`
+				Integrity *capsule.IntegrityReport `json:"integrity"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.Signed != tt.wantSigned || len(resp.Integrity.Warnings) != tt.wantWarnings {
+				t.Fatalf("signed = %v, warnings = %v; want %v and %d warnings", resp.Signed, resp.Integrity.Warnings, tt.wantSigned, tt.wantWarnings)
+			}
+			if tt.sign && !resp.Integrity.SignatureValid {
+				t.Fatalf("signature not verified: %+v", resp.Integrity)
+			}
+			if tt.tamper && (len(resp.Integrity.Mismatched) != 1 || resp.Integrity.Mismatched[0] != "main.go") {
+				t.Fatalf("mismatched = %v, want [main.go]", resp.Integrity.Mismatched)
+			}
+		})
+	}
+}
+
+func TestHandleGetSigningKey(t *testing.T) {
+	serve := func() *httptest.ResponseRecorder {
+		r := gin.New()
+		r.GET("/api/v1/signing-key", handleGetSigningKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/signing-key", nil))
+		return w
+	}
+
+	if w := serve(); w.Code != http.StatusNotFound {
+		t.Fatalf("status without a key = %d, want 404", w.Code)
+	}
+
+	signer := useSigner(t)
+	w := serve()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		KeyID     string `json:"key_id"`
+		Algorithm string `json:"algorithm"`
+		PublicKey string `json:"public_key"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	key, _ := base64.StdEncoding.DecodeString(resp.PublicKey)
+	if resp.KeyID != signer.KeyID() || resp.Algorithm != "ed25519" || !signer.PublicKey().Equal(ed25519.PublicKey(key)) {
+		t.Fatalf("response = %+v", resp)
+	}
+}
+
+// workflowStub serves a workflow result with handler and points
+// WORKFLOW_API_URL at it, with a short fetch timeout and a 1KB size limit
+func workflowStub(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	t.Setenv("WORKFLOW_API_URL", srv.URL)
+	t.Setenv("WORKFLOW_FETCH_TIMEOUT", "200ms")
+	t.Setenv("WORKFLOW_RESULT_MAX_BYTES", "1024")
+	return srv.URL
+}
+
+// stall blocks until the client gives up or the test times out
+func stall(r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func TestFetchWorkflowResult(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "ok",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"files":[]}`))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"files":[]}`,
+		},
+		{
+			name: "exactly the size limit",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(bytes.Repeat([]byte("a"), 1024))
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   strings.Repeat("a", 1024),
+		},
+		{
+			name:       "timeout waiting for headers",
+			handler:    func(w http.ResponseWriter, r *http.Request) { stall(r) },
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name: "timeout reading body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"files":`))
+				w.(http.Flusher).Flush()
+				stall(r)
+			},
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name: "oversized content length",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "4096")
+				w.Write(bytes.Repeat([]byte("a"), 4096))
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "oversized chunked body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < 4; i++ {
+					w.Write(bytes.Repeat([]byte("a"), 512))
+					w.(http.Flusher).Flush()
+				}
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "not found",
+			handler:    func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) },
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "upstream error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "boom", http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := workflowStub(t, tt.handler)
+			body, status, err := fetchWorkflowResult(context.Background(), url+"/result")
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d (err %v), want %d", status, err, tt.wantStatus)
+			}
+			if (err == nil) != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("err = %v with status %d", err, status)
+			}
+			if string(body) != tt.wantBody {
+				t.Fatalf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestFetchWorkflowResultUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	if _, status, err := fetchWorkflowResult(context.Background(), url); status != http.StatusBadGateway || err == nil {
+		t.Fatalf("status = %d, err = %v; want 502", status, err)
+	}
+}
+
+func TestHandleCreateFromWorkflow(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+	}{
+		{
+			name: "created",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/workflows/wf-1/result" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(`{"files":[{"path":"main.go","content":"package main\n"}],"metadata":{"language":"go"}}`))
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "timeout",
+			handler:    func(w http.ResponseWriter, r *http.Request) { stall(r) },
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name: "too large",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(bytes.Repeat([]byte(" "), 2048))
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflowStub(t, tt.handler)
+			capsuleStore = storage.NewMemoryStore()
+
+			r := gin.New()
+			r.POST("/api/v1/capsules/from-workflow", handleCreateFromWorkflow)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/capsules/from-workflow",
+				strings.NewReader(`{"workflow_id":"wf-1","result_id":"res-1"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			_, total, _ := capsuleStore.List(0, 0)
+			if wantStored := tt.wantStatus == http.StatusCreated; (total == 1) != wantStored {
+				t.Fatalf("stored %d capsules, want stored = %v", total, wantStored)
+			}
+		})
+	}
+}
+
+func TestHandleDownloadCapsuleStreams(t *testing.T) {
+	cap, err := capsule.CreateCapsule("wf-1", []capsule.CapsuleFile{
+		{Path: "main.go", Content: "package main\n", Mode: 0644},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capsuleStore = storage.NewMemoryStore()
+	if err := capsuleStore.Save(cap); err != nil {
+		t.Fatal(err)
+	}
+	want, err := cap.PackageAsTarGz()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		threshold string
+		streamed  bool
+	}{
+		{"0", true},
+		{"", false},
+	} {
+		t.Setenv("CAPSULE_STREAM_THRESHOLD_BYTES", tt.threshold)
+		r := gin.New()
+		r.GET("/api/v1/capsules/:id/download", handleDownloadCapsule)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/capsules/"+cap.ID+"/download", nil))
+
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" {
+			t.Fatalf("threshold %q: status %d, type %q", tt.threshold, w.Code, w.Header().Get("Content-Type"))
+		}
+		// Only a buffered archive knows its length up front
+		if hasLength := w.Header().Get("Content-Length") != ""; hasLength == tt.streamed {
+			t.Errorf("threshold %q: Content-Length %q, want streamed = %v", tt.threshold, w.Header().Get("Content-Length"), tt.streamed)
+		}
+		got, err := capsule.ValidateCapsule(w.Body.Bytes())
+		if err != nil {
+			t.Fatalf("threshold %q: downloaded archive is invalid: %v", tt.threshold, err)
+		}
+		if got.ID != cap.ID || w.Body.Len() != len(want) {
+			t.Errorf("threshold %q: downloaded %s, %d bytes; want %s, %d bytes", tt.threshold, got.ID, w.Body.Len(), cap.ID, len(want))
+		}
+	}
+}
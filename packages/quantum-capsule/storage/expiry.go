@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"log"
+	"time"
+)
+
+// Clock abstracts time so expiry can be driven deterministically
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Expirer removes capsules older than a TTL
+type Expirer struct {
+	store Store
+	ttl   time.Duration
+	clock Clock
+}
+
+// NewExpirer creates an expirer using the wall clock. A nil clock defaults to the wall clock.
+func NewExpirer(store Store, ttl time.Duration, clock Clock) *Expirer {
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &Expirer{store: store, ttl: ttl, clock: clock}
+}
+
+// ExpireOnce deletes every capsule created more than ttl ago and returns their IDs
+func (e *Expirer) ExpireOnce() ([]string, error) {
+	return e.store.DeleteCreatedBefore(e.clock.Now().Add(-e.ttl))
+}
+
+// Start runs ExpireOnce every interval until stop is closed
+func (e *Expirer) Start(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := e.ExpireOnce()
+				if err != nil {
+					log.Printf("Capsule expiry failed: %v", err)
+				}
+				if len(deleted) > 0 {
+					log.Printf("Expired %d capsules older than %s", len(deleted), e.ttl)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
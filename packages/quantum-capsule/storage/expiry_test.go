@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestExpirerExpireOnce(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			// Capsules created at base, base+1h, ... base+3h
+			for i := 0; i < 4; i++ {
+				store.Save(testCapsule(fmt.Sprintf("cap-%d", i), base.Add(time.Duration(i)*time.Hour)))
+			}
+
+			clock := &fakeClock{now: base.Add(2 * time.Hour)}
+			expirer := NewExpirer(store, 90*time.Minute, clock)
+
+			steps := []struct {
+				advance time.Duration
+				want    []string
+			}{
+				{0, []string{"cap-0"}},         // cutoff base+30m
+				{0, nil},                       // nothing new has aged out
+				{time.Hour, []string{"cap-1"}}, // cutoff base+1h30m
+				{3 * time.Hour, []string{"cap-2", "cap-3"}},
+			}
+			for i, step := range steps {
+				clock.now = clock.now.Add(step.advance)
+				deleted, err := expirer.ExpireOnce()
+				if err != nil {
+					t.Fatalf("step %d: ExpireOnce: %v", i, err)
+				}
+				sort.Strings(deleted)
+				if fmt.Sprint(deleted) != fmt.Sprint(step.want) {
+					t.Fatalf("step %d: expired %v, want %v", i, deleted, step.want)
+				}
+			}
+
+			if _, total, _ := store.List(0, 0); total != 0 {
+				t.Fatalf("%d capsules left, want 0", total)
+			}
+		})
+	}
+}
+
+func TestExpirerKeepsCapsuleAtCutoff(t *testing.T) {
+	store := NewMemoryStore()
+	store.Save(testCapsule("cap", base))
+
+	expirer := NewExpirer(store, time.Hour, &fakeClock{now: base.Add(time.Hour)})
+	if deleted, _ := expirer.ExpireOnce(); len(deleted) != 0 {
+		t.Fatalf("expired %v exactly at the TTL, want none", deleted)
+	}
+}
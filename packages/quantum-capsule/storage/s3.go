@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	capsule "github.com/QuantumLayer-dev/quantumlayer-platform/packages/quantum-capsule/capsule"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Objects kept for each capsule under capsules/<id>/
+const (
+	s3Prefix         = "capsules/"
+	s3ManifestObject = "capsule.json"
+	s3ArchiveObject  = "capsule.tar.gz"
+)
+
+// s3RequestTimeout bounds metadata requests; archive uploads are not bounded
+const s3RequestTimeout = 30 * time.Second
+
+// Presigner is implemented by stores that can hand out a time-limited URL
+// for downloading a capsule's archive directly from object storage
+type Presigner interface {
+	PresignDownload(id string, expiry time.Duration) (*url.URL, error)
+}
+
+// S3Config configures an S3Store
+type S3Config struct {
+	Endpoint  string // host:port, or a URL whose scheme selects TLS
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	// PublicEndpoint, if set, is used in presigned URLs instead of
+	// Endpoint, for clients that can't reach the in-cluster address
+	PublicEndpoint string
+}
+
+// S3Store keeps each capsule in an S3 compatible bucket, such as MinIO, as
+// its JSON document and its packaged tar.gz under capsules/<id>/. Nothing
+// is cached: capsules are read from the bucket when requested.
+type S3Store struct {
+	client    *minio.Client
+	presigner *minio.Client
+	bucket    string
+}
+
+// NewS3StoreFromEnv creates an S3 store from S3_ENDPOINT, S3_BUCKET,
+// S3_ACCESS_KEY, S3_SECRET_KEY, S3_REGION and S3_PUBLIC_ENDPOINT
+func NewS3StoreFromEnv() (*S3Store, error) {
+	cfg := S3Config{
+		Endpoint:       os.Getenv("S3_ENDPOINT"),
+		Bucket:         os.Getenv("S3_BUCKET"),
+		AccessKey:      os.Getenv("S3_ACCESS_KEY"),
+		SecretKey:      os.Getenv("S3_SECRET_KEY"),
+		Region:         os.Getenv("S3_REGION"),
+		PublicEndpoint: os.Getenv("S3_PUBLIC_ENDPOINT"),
+	}
+	if cfg.Bucket == "" {
+		cfg.Bucket = "quantumlayer"
+	}
+	return NewS3Store(cfg)
+}
+
+// NewS3Store connects to the bucket, creating it if it doesn't exist
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("S3 endpoint is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	client, err := newS3Client(cfg.Endpoint, cfg)
+	if err != nil {
+		return nil, err
+	}
+	presigner := client
+	if cfg.PublicEndpoint != "" {
+		if presigner, err = newS3Client(cfg.PublicEndpoint, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", cfg.Bucket, err)
+		}
+	}
+
+	return &S3Store{client: client, presigner: presigner, bucket: cfg.Bucket}, nil
+}
+
+// newS3Client creates a client for endpoint. The region is set explicitly
+// so presigning doesn't need to ask the server for the bucket location.
+func newS3Client(endpoint string, cfg S3Config) (*minio.Client, error) {
+	host, secure := endpoint, false
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint %q: %w", endpoint, err)
+		}
+		host, secure = u.Host, u.Scheme == "https"
+	}
+
+	client, err := minio.New(host, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: secure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+	return client, nil
+}
+
+// key returns the object key of one of a capsule's objects, rejecting IDs
+// that would escape its prefix
+func (s *S3Store) key(id, object string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid capsule id %q", id)
+	}
+	return s3Prefix + id + "/" + object, nil
+}
+
+func isNoSuchKey(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+// Save uploads the capsule's archive, then its document. The document is
+// written last so a capsule is never listed without its archive.
+func (s *S3Store) Save(cap *capsule.QuantumCapsule) error {
+	archiveKey, err := s.key(cap.ID, s3ArchiveObject)
+	if err != nil {
+		return err
+	}
+	manifestKey, _ := s.key(cap.ID, s3ManifestObject)
+
+	data, err := json.Marshal(cap)
+	if err != nil {
+		return fmt.Errorf("failed to encode capsule: %w", err)
+	}
+
+	// Stream the archive into the upload rather than packaging it in memory
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(cap.PackageToWriter(pw))
+	}()
+	_, err = s.client.PutObject(context.Background(), s.bucket, archiveKey, pr, -1,
+		minio.PutObjectOptions{ContentType: "application/gzip"})
+	pr.CloseWithError(err)
+	if err != nil {
+		return fmt.Errorf("failed to upload capsule archive: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	_, err = s.client.PutObject(ctx, s.bucket, manifestKey, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return fmt.Errorf("failed to store capsule: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(id string) (*capsule.QuantumCapsule, error) {
+	key, err := s.key(id, s3ManifestObject)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capsule: %w", err)
+	}
+	defer obj.Close()
+
+	var cap capsule.QuantumCapsule
+	if err := json.NewDecoder(obj).Decode(&cap); err != nil {
+		if isNoSuchKey(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to decode capsule: %w", err)
+	}
+	return &cap, nil
+}
+
+func (s *S3Store) Delete(id string) error {
+	key, err := s.key(id, s3ManifestObject)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	if _, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err != nil {
+		if isNoSuchKey(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete capsule: %w", err)
+	}
+	return s.remove(ctx, id)
+}
+
+// remove deletes a capsule's document, then its archive
+func (s *S3Store) remove(ctx context.Context, id string) error {
+	for _, object := range []string{s3ManifestObject, s3ArchiveObject} {
+		key, _ := s.key(id, object)
+		if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to delete capsule: %w", err)
+		}
+	}
+	return nil
+}
+
+// s3Entry is a stored capsule as seen in a bucket listing. Capsules are
+// written once, so the document's modification time stands in for its
+// creation time.
+type s3Entry struct {
+	id       string
+	modified time.Time
+}
+
+// entries lists every capsule by its document, newest first
+func (s *S3Store) entries(ctx context.Context) ([]s3Entry, error) {
+	var entries []s3Entry
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s3Prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list capsules: %w", obj.Err)
+		}
+		id, object, ok := strings.Cut(strings.TrimPrefix(obj.Key, s3Prefix), "/")
+		if !ok || object != s3ManifestObject {
+			continue
+		}
+		entries = append(entries, s3Entry{id: id, modified: obj.LastModified})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modified.After(entries[j].modified)
+	})
+	return entries, nil
+}
+
+// List pages through the bucket listing and only downloads the capsules on
+// the requested page
+func (s *S3Store) List(offset, limit int) ([]*capsule.QuantumCapsule, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	entries, err := s.entries(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if offset >= len(entries) {
+		return []*capsule.QuantumCapsule{}, len(entries), nil
+	}
+	end := len(entries)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	capsules := make([]*capsule.QuantumCapsule, 0, end-offset)
+	for _, entry := range entries[offset:end] {
+		cap, err := s.Get(entry.id)
+		if err == ErrNotFound {
+			// Deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		capsules = append(capsules, cap)
+	}
+	return capsules, len(entries), nil
+}
+
+func (s *S3Store) DeleteCreatedBefore(cutoff time.Time) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	entries, err := s.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, entry := range entries {
+		if !entry.modified.Before(cutoff) {
+			continue
+		}
+		if err := s.remove(ctx, entry.id); err != nil {
+			return deleted, fmt.Errorf("failed to delete capsule %s: %w", entry.id, err)
+		}
+		deleted = append(deleted, entry.id)
+	}
+	return deleted, nil
+}
+
+// PresignDownload returns a URL the capsule's archive can be downloaded
+// from without going through this service
+func (s *S3Store) PresignDownload(id string, expiry time.Duration) (*url.URL, error) {
+	key, err := s.key(id, s3ArchiveObject)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+	if _, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err != nil {
+		if isNoSuchKey(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find capsule archive: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%s.tar.gz", id))
+	u, err := s.presigner.PresignedGetObject(ctx, s.bucket, key, expiry, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign capsule download: %w", err)
+	}
+	return u, nil
+}
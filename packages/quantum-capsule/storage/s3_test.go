@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	capsule "github.com/QuantumLayer-dev/quantumlayer-platform/packages/quantum-capsule/capsule"
+	"github.com/minio/minio-go/v7"
+)
+
+// s3TestStore connects to the MinIO or S3 server at S3_TEST_ENDPOINT with
+// a bucket of its own, removed after the test. Without an endpoint the
+// test is skipped; for a local run:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=localhost:9000 go test ./packages/quantum-capsule/storage/
+func s3TestStore(t *testing.T) *S3Store {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	cfg := S3Config{
+		Endpoint:  endpoint,
+		Bucket:    fmt.Sprintf("capsule-test-%d", time.Now().UnixNano()),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+	}
+	if cfg.AccessKey == "" {
+		cfg.AccessKey, cfg.SecretKey = "minioadmin", "minioadmin"
+	}
+
+	store, err := NewS3Store(cfg)
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		for obj := range store.client.ListObjects(ctx, store.bucket, minio.ListObjectsOptions{Recursive: true}) {
+			store.client.RemoveObject(ctx, store.bucket, obj.Key, minio.RemoveObjectOptions{})
+		}
+		if err := store.client.RemoveBucket(ctx, store.bucket); err != nil {
+			t.Logf("failed to remove bucket %s: %v", store.bucket, err)
+		}
+	})
+	return store
+}
+
+func TestS3StoreSaveGetDelete(t *testing.T) {
+	store := s3TestStore(t)
+
+	if err := store.Save(testCapsule("cap-1", base)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	got, err := store.Get("cap-1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.ID != "cap-1" || !got.CreatedAt.Equal(base) || len(got.Files) != 1 || got.Files[0].Content != "package main\n" {
+		t.Fatalf("Get = %+v", got)
+	}
+
+	// The archive is stored next to the document
+	if _, err := store.client.StatObject(context.Background(), store.bucket, "capsules/cap-1/capsule.tar.gz", minio.StatObjectOptions{}); err != nil {
+		t.Errorf("archive: %v", err)
+	}
+
+	if err := store.Delete("cap-1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("cap-1"); err != ErrNotFound {
+		t.Fatalf("Get after delete: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete("cap-1"); err != ErrNotFound {
+		t.Fatalf("second Delete: err = %v, want ErrNotFound", err)
+	}
+	for _, id := range []string{"../escape", "a/b", ".."} {
+		if _, err := store.Get(id); err != ErrNotFound {
+			t.Errorf("Get(%q): err = %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestS3StoreListAndExpire(t *testing.T) {
+	store := s3TestStore(t)
+
+	// The bucket orders capsules by when they were uploaded
+	for i := 0; i < 3; i++ {
+		if err := store.Save(testCapsule(fmt.Sprintf("cap-%d", i), base)); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		time.Sleep(1100 * time.Millisecond)
+	}
+	// Objects that aren't capsule documents are ignored
+	store.client.PutObject(context.Background(), store.bucket, "capsules/stray.txt", strings.NewReader("x"), 1, minio.PutObjectOptions{})
+
+	page, total, err := store.List(0, 2)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 3 || fmt.Sprint(ids(page)) != "[cap-2 cap-1]" {
+		t.Fatalf("List(0, 2) = %v, total %d; want [cap-2 cap-1], total 3", ids(page), total)
+	}
+	if page, _, _ := store.List(2, 2); fmt.Sprint(ids(page)) != "[cap-0]" {
+		t.Fatalf("List(2, 2) = %v, want [cap-0]", ids(page))
+	}
+
+	entries, err := store.entries(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Everything uploaded before the newest capsule
+	deleted, err := store.DeleteCreatedBefore(entries[0].modified)
+	if err != nil {
+		t.Fatalf("DeleteCreatedBefore: %v", err)
+	}
+	if len(deleted) != 2 {
+		t.Fatalf("deleted %v, want the two older capsules", deleted)
+	}
+	if remaining, total, _ := store.List(0, 0); total != 1 || remaining[0].ID != "cap-2" {
+		t.Fatalf("remaining %v, want [cap-2]", ids(remaining))
+	}
+}
+
+func TestS3StorePresignDownload(t *testing.T) {
+	store := s3TestStore(t)
+	cap, err := capsule.CreateCapsule("wf-1", []capsule.CapsuleFile{
+		{Path: "main.go", Content: "package main\n", Mode: 0644},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(cap); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	u, err := store.PresignDownload(cap.ID, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignDownload: %v", err)
+	}
+	resp, err := http.Get(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("download = %d %s", resp.StatusCode, data)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Disposition"), cap.ID+".tar.gz") {
+		t.Errorf("Content-Disposition = %q", resp.Header.Get("Content-Disposition"))
+	}
+	got, err := capsule.ValidateCapsule(data)
+	if err != nil {
+		t.Fatalf("downloaded archive is invalid: %v", err)
+	}
+	if got.ID != cap.ID {
+		t.Errorf("downloaded capsule %s, want %s", got.ID, cap.ID)
+	}
+
+	if _, err := store.PresignDownload("missing", time.Minute); err != ErrNotFound {
+		t.Errorf("missing capsule: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNewS3StoreConfig(t *testing.T) {
+	if _, err := NewS3Store(S3Config{Bucket: "b"}); err == nil {
+		t.Error("store created without an endpoint")
+	}
+	if _, err := newS3Client("http://%zz", S3Config{}); err == nil {
+		t.Error("client created for an invalid endpoint")
+	}
+
+	for endpoint, secure := range map[string]bool{
+		"minio:9000":             false,
+		"http://minio:9000":      false,
+		"https://s3.example.com": true,
+	} {
+		client, err := newS3Client(endpoint, S3Config{Region: "eu-west-2"})
+		if err != nil {
+			t.Fatalf("%s: %v", endpoint, err)
+		}
+		if got := client.EndpointURL().Scheme == "https"; got != secure {
+			t.Errorf("%s: secure = %v, want %v", endpoint, got, secure)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	capsule "github.com/QuantumLayer-dev/quantumlayer-platform/packages/quantum-capsule/capsule"
+)
+
+// ErrNotFound is returned when a capsule does not exist in the store
+var ErrNotFound = errors.New("capsule not found")
+
+// Store persists capsules. Implementations must be safe for concurrent use.
+type Store interface {
+	Save(cap *capsule.QuantumCapsule) error
+	Get(id string) (*capsule.QuantumCapsule, error)
+	Delete(id string) error
+	// List returns capsules newest first, skipping offset and returning at
+	// most limit entries, along with the total number of capsules
+	List(offset, limit int) ([]*capsule.QuantumCapsule, int, error)
+	// DeleteCreatedBefore removes capsules created before cutoff and returns their IDs
+	DeleteCreatedBefore(cutoff time.Time) ([]string, error)
+}
+
+// NewStoreFromEnv selects a store using CAPSULE_STORE, or STORAGE_BACKEND
+// if it isn't set (memory, filesystem or s3)
+func NewStoreFromEnv() (Store, error) {
+	backend := os.Getenv("CAPSULE_STORE")
+	if backend == "" {
+		backend = os.Getenv("STORAGE_BACKEND")
+	}
+
+	switch backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "s3":
+		return NewS3StoreFromEnv()
+	case "filesystem":
+		dir := os.Getenv("CAPSULE_STORAGE_DIR")
+		if dir == "" {
+			dir = "/data/capsules"
+		}
+		return NewFileStore(dir)
+	default:
+		return nil, fmt.Errorf("unknown capsule store %q", backend)
+	}
+}
+
+// paginate sorts capsules newest first and slices out one page
+func paginate(capsules []*capsule.QuantumCapsule, offset, limit int) []*capsule.QuantumCapsule {
+	sort.Slice(capsules, func(i, j int) bool {
+		return capsules[i].CreatedAt.After(capsules[j].CreatedAt)
+	})
+
+	if offset >= len(capsules) {
+		return []*capsule.QuantumCapsule{}
+	}
+	end := len(capsules)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return capsules[offset:end]
+}
+
+// MemoryStore keeps capsules in memory; contents are lost on restart
+type MemoryStore struct {
+	capsules map[string]*capsule.QuantumCapsule
+	mu       sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		capsules: make(map[string]*capsule.QuantumCapsule),
+	}
+}
+
+func (s *MemoryStore) Save(cap *capsule.QuantumCapsule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capsules[cap.ID] = cap
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*capsule.QuantumCapsule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cap, ok := s.capsules[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cap, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.capsules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.capsules, id)
+	return nil
+}
+
+func (s *MemoryStore) List(offset, limit int) ([]*capsule.QuantumCapsule, int, error) {
+	s.mu.RLock()
+	capsules := make([]*capsule.QuantumCapsule, 0, len(s.capsules))
+	for _, cap := range s.capsules {
+		capsules = append(capsules, cap)
+	}
+	s.mu.RUnlock()
+
+	return paginate(capsules, offset, limit), len(capsules), nil
+}
+
+func (s *MemoryStore) DeleteCreatedBefore(cutoff time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted []string
+	for id, cap := range s.capsules {
+		if cap.CreatedAt.Before(cutoff) {
+			delete(s.capsules, id)
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted, nil
+}
+
+// FileStore keeps each capsule as a JSON document in a directory. Each
+// file's modification time is set to the capsule's creation time, so
+// listing and expiry work from the directory alone and only decode the
+// capsules they return.
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewFileStore creates a filesystem store rooted at dir, creating it if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create capsule storage dir: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// path maps a capsule ID to its file, rejecting IDs that would escape the store
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid capsule id %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+func (s *FileStore) Save(cap *capsule.QuantumCapsule) error {
+	path, err := s.path(cap.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cap)
+	if err != nil {
+		return fmt.Errorf("failed to encode capsule: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write to a temp file and rename so readers never see a partial capsule
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write capsule: %w", err)
+	}
+	if !cap.CreatedAt.IsZero() {
+		if err := os.Chtimes(tmp, cap.CreatedAt, cap.CreatedAt); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to set capsule time: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to store capsule: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Get(id string) (*capsule.QuantumCapsule, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return readCapsuleFile(path)
+}
+
+func (s *FileStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete capsule: %w", err)
+	}
+	return nil
+}
+
+// List reads the directory and only decodes the capsules on the requested page
+func (s *FileStore) List(offset, limit int) ([]*capsule.QuantumCapsule, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := s.entries()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if offset >= len(entries) {
+		return []*capsule.QuantumCapsule{}, len(entries), nil
+	}
+	end := len(entries)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	capsules := make([]*capsule.QuantumCapsule, 0, end-offset)
+	for _, entry := range entries[offset:end] {
+		cap, err := readCapsuleFile(entry.path)
+		if err != nil {
+			continue
+		}
+		capsules = append(capsules, cap)
+	}
+	return capsules, len(entries), nil
+}
+
+func (s *FileStore) DeleteCreatedBefore(cutoff time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, entry := range entries {
+		if !entry.created.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			return deleted, fmt.Errorf("failed to delete capsule %s: %w", entry.id, err)
+		}
+		deleted = append(deleted, entry.id)
+	}
+	return deleted, nil
+}
+
+// fileEntry is a stored capsule as seen in a directory listing
+type fileEntry struct {
+	id      string
+	path    string
+	created time.Time
+}
+
+// entries lists every capsule file, newest first. Callers must hold s.mu.
+func (s *FileStore) entries() ([]fileEntry, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capsule storage dir: %w", err)
+	}
+
+	entries := make([]fileEntry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			// Deleted since the directory was read
+			continue
+		}
+		entries = append(entries, fileEntry{
+			id:      strings.TrimSuffix(name, ".json"),
+			path:    filepath.Join(s.dir, name),
+			created: info.ModTime(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].created.Equal(entries[j].created) {
+			return entries[i].id < entries[j].id
+		}
+		return entries[i].created.After(entries[j].created)
+	})
+	return entries, nil
+}
+
+func readCapsuleFile(path string) (*capsule.QuantumCapsule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read capsule: %w", err)
+	}
+
+	var cap capsule.QuantumCapsule
+	if err := json.Unmarshal(data, &cap); err != nil {
+		return nil, fmt.Errorf("failed to decode capsule: %w", err)
+	}
+	return &cap, nil
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	capsule "github.com/QuantumLayer-dev/quantumlayer-platform/packages/quantum-capsule/capsule"
+)
+
+// base is the creation time of the first test capsule; file modification
+// times are kept to the second so tests avoid sub-second precision
+var base = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func testCapsule(id string, created time.Time) *capsule.QuantumCapsule {
+	return &capsule.QuantumCapsule{
+		ID:        id,
+		CreatedAt: created,
+		Files:     []capsule.CapsuleFile{{Path: "main.go", Content: "package main\n"}},
+	}
+}
+
+// stores returns a fresh store of every kind that runs without a server
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	}
+}
+
+func ids(capsules []*capsule.QuantumCapsule) []string {
+	out := make([]string, 0, len(capsules))
+	for _, cap := range capsules {
+		out = append(out, cap.ID)
+	}
+	return out
+}
+
+func TestStoreSaveGetDelete(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Save(testCapsule("cap-1", base)); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			got, err := store.Get("cap-1")
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if got.ID != "cap-1" || !got.CreatedAt.Equal(base) || len(got.Files) != 1 {
+				t.Fatalf("Get = %+v", got)
+			}
+
+			if err := store.Delete("cap-1"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Get("cap-1"); err != ErrNotFound {
+				t.Fatalf("Get after delete: err = %v, want ErrNotFound", err)
+			}
+			if err := store.Delete("cap-1"); err != ErrNotFound {
+				t.Fatalf("second Delete: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStoreRejectsPathIDs(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"../escape", "a/b", `a\b`, ".."} {
+				if _, err := store.Get(id); err != ErrNotFound {
+					t.Errorf("Get(%q): err = %v, want ErrNotFound", id, err)
+				}
+			}
+		})
+	}
+
+	fileStore, _ := NewFileStore(t.TempDir())
+	if err := fileStore.Save(testCapsule("../escape", base)); err == nil {
+		t.Fatal("FileStore saved a capsule whose ID escapes its directory")
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 5; i++ {
+				// Saved out of order; listing is newest first
+				id := []int{2, 0, 4, 1, 3}[i]
+				if err := store.Save(testCapsule(fmt.Sprintf("cap-%d", id), base.Add(time.Duration(id)*time.Hour))); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+
+			tests := []struct {
+				offset, limit int
+				want          []string
+			}{
+				{0, 0, []string{"cap-4", "cap-3", "cap-2", "cap-1", "cap-0"}},
+				{0, 2, []string{"cap-4", "cap-3"}},
+				{2, 2, []string{"cap-2", "cap-1"}},
+				{4, 2, []string{"cap-0"}},
+				{5, 2, []string{}},
+			}
+			for _, tt := range tests {
+				page, total, err := store.List(tt.offset, tt.limit)
+				if err != nil {
+					t.Fatalf("List(%d, %d): %v", tt.offset, tt.limit, err)
+				}
+				if total != 5 {
+					t.Fatalf("List(%d, %d) total = %d, want 5", tt.offset, tt.limit, total)
+				}
+				if fmt.Sprint(ids(page)) != fmt.Sprint(tt.want) {
+					t.Fatalf("List(%d, %d) = %v, want %v", tt.offset, tt.limit, ids(page), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileStoreListOnlyDecodesPage(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	store.Save(testCapsule("new", base.Add(time.Hour)))
+	store.Save(testCapsule("old", base))
+
+	// Corrupt the capsule that isn't on the first page
+	oldPath := filepath.Join(dir, "old.json")
+	if err := os.WriteFile(oldPath, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(oldPath, base, base)
+
+	page, total, err := store.List(0, 1)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 2 || len(page) != 1 || page[0].ID != "new" {
+		t.Fatalf("List(0, 1) = %v, total %d; want [new], total 2", ids(page), total)
+	}
+
+	// Temp files from interrupted saves are not capsules
+	os.WriteFile(filepath.Join(dir, "partial.json.tmp"), []byte("{"), 0644)
+	if _, total, _ := store.List(0, 0); total != 2 {
+		t.Fatalf("total with a temp file = %d, want 2", total)
+	}
+}
+
+func TestStoreDeleteCreatedBefore(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 4; i++ {
+				store.Save(testCapsule(fmt.Sprintf("cap-%d", i), base.Add(time.Duration(i)*time.Hour)))
+			}
+
+			deleted, err := store.DeleteCreatedBefore(base.Add(2 * time.Hour))
+			if err != nil {
+				t.Fatalf("DeleteCreatedBefore: %v", err)
+			}
+			sort.Strings(deleted)
+			if fmt.Sprint(deleted) != "[cap-0 cap-1]" {
+				t.Fatalf("deleted %v, want [cap-0 cap-1]", deleted)
+			}
+
+			remaining, total, _ := store.List(0, 0)
+			if total != 2 || fmt.Sprint(ids(remaining)) != "[cap-3 cap-2]" {
+				t.Fatalf("remaining %v, want [cap-3 cap-2]", ids(remaining))
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+)
+
+const insertDropQuery = `INSERT INTO quantum_drops (id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at,
+			  encrypted, key_version, wrapped_key, nonce, artifact_size)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+
+// dbExecer is satisfied by both *sql.DB and *sql.Tx
+type dbExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// BatchDropResult is one drop of a batch that was stored
+type BatchDropResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+}
+
+// BatchDropFailure is one drop of a batch that wasn't stored, and why
+type BatchDropFailure struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// validateDrop checks the fields a drop can't be found again without
+func validateDrop(drop QuantumDrop) error {
+	switch {
+	case drop.WorkflowID == "":
+		return errors.New("workflow_id is required")
+	case drop.Stage == "":
+		return errors.New("stage is required")
+	case drop.Type == "":
+		return errors.New("type is required")
+	case drop.Version < 0:
+		return errors.New("version must not be negative")
+	}
+	return nil
+}
+
+// insertDrop fills in a drop's ID and creation time and stores it, with
+// its artifact encrypted if encryption is configured
+func insertDrop(exec dbExecer, drop *QuantumDrop) error {
+	if drop.ID == "" {
+		drop.ID = fmt.Sprintf("drop-%s-%s-%d", drop.WorkflowID, drop.Stage, time.Now().UnixNano())
+	}
+	drop.CreatedAt = time.Now()
+
+	stored, err := artifacts.Seal(drop.ID, drop.Artifact)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt artifact: %w", err)
+	}
+	metadataJSON, _ := json.Marshal(drop.Metadata)
+	_, err = exec.Exec(insertDropQuery, drop.ID, drop.WorkflowID, drop.RequestID, drop.Stage, drop.Type,
+		stored.Artifact, metadataJSON, drop.Version, drop.CreatedAt,
+		stored.Encrypted, stored.KeyVersion, stored.WrappedKey, stored.Nonce, artifactSize(drop.Artifact))
+	return err
+}
+
+// createBatchDrops stores several drops at once. By default the batch is
+// all-or-nothing: one invalid drop rejects it and a failed insert rolls
+// back the rest. With ?partial=true each drop is stored on its own and the
+// response lists which indices failed and why, so callers can retry only
+// those.
+func createBatchDrops(c *gin.Context) {
+	partial := false
+	if raw := c.Query("partial"); raw != "" {
+		var err error
+		if partial, err = strconv.ParseBool(raw); err != nil {
+			apierror.RespondError(c, apierror.Validation("partial must be true or false"))
+			return
+		}
+	}
+
+	var drops []QuantumDrop
+	if err := c.ShouldBindJSON(&drops); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	for i := range drops {
+		tagRequest(c, &drops[i])
+	}
+
+	if partial {
+		createDropsPartially(c, drops)
+		return
+	}
+
+	var invalid []BatchDropFailure
+	for i, drop := range drops {
+		if err := validateDrop(drop); err != nil {
+			invalid = append(invalid, BatchDropFailure{Index: i, ID: drop.ID, Reason: err.Error()})
+		}
+	}
+	if len(invalid) > 0 {
+		apierror.RespondError(c, apierror.Validation("Batch contains invalid drops").WithDetails(invalid))
+		return
+	}
+
+	// Begin transaction
+	tx, err := db.Begin()
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to start transaction"))
+		return
+	}
+
+	for i := range drops {
+		err := insertDrop(tx, &drops[i])
+		if err == nil {
+			err = notifyDrop(tx, drops[i])
+		}
+		if err != nil {
+			tx.Rollback()
+			apierror.RespondError(c, apierror.Internal("Failed to store drops").WithDetails(
+				[]BatchDropFailure{{Index: i, ID: drops[i].ID, Reason: err.Error()}}))
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to commit transaction"))
+		return
+	}
+	semantic.IndexAsync(drops...)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Batch drops created successfully",
+		"count":   len(drops),
+	})
+}
+
+// createDropsPartially stores each drop independently. It answers 201 when
+// every drop was stored, 207 when some were and 422 when none were.
+func createDropsPartially(c *gin.Context, drops []QuantumDrop) {
+	created := []BatchDropResult{}
+	failed := []BatchDropFailure{}
+	var stored []QuantumDrop
+	for i := range drops {
+		drop := &drops[i]
+		if err := validateDrop(*drop); err != nil {
+			failed = append(failed, BatchDropFailure{Index: i, ID: drop.ID, Reason: err.Error()})
+			continue
+		}
+		if err := insertDrop(db, drop); err != nil {
+			failed = append(failed, BatchDropFailure{Index: i, ID: drop.ID, Reason: err.Error()})
+			continue
+		}
+		if err := notifyDrop(db, *drop); err != nil {
+			logging.ForRequest(logger, c).WithError(err).WithField("drop_id", drop.ID).Warn("Failed to announce drop")
+		}
+		created = append(created, BatchDropResult{Index: i, ID: drop.ID})
+		stored = append(stored, *drop)
+	}
+	semantic.IndexAsync(stored...)
+
+	status, message := http.StatusCreated, "Batch drops created successfully"
+	switch {
+	case len(failed) > 0 && len(created) > 0:
+		status, message = http.StatusMultiStatus, "Some drops in the batch failed"
+	case len(failed) > 0:
+		status, message = http.StatusUnprocessableEntity, "No drops in the batch were stored"
+	}
+	c.JSON(status, gin.H{
+		"message": message,
+		"count":   len(created),
+		"created": created,
+		"failed":  failed,
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+const batchWithInvalidDrop = `[
+	{"workflow_id": "wf-1", "stage": "prompt", "type": "prompt", "artifact": "a"},
+	{"workflow_id": "wf-1", "type": "code", "artifact": "b"},
+	{"workflow_id": "wf-1", "stage": "tests", "type": "tests", "artifact": "c"}
+]`
+
+var (
+	insertDropPattern = regexp.QuoteMeta("INSERT INTO quantum_drops")
+	notifyDropPattern = regexp.QuoteMeta("SELECT pg_notify($1, $2)")
+)
+
+func postBatch(query, body string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.POST("/api/v1/drops/batch", createBatchDrops)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/drops/batch"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+type batchResponse struct {
+	Count   int                `json:"count"`
+	Created []BatchDropResult  `json:"created"`
+	Failed  []BatchDropFailure `json:"failed"`
+	Error   *struct {
+		Code    string             `json:"code"`
+		Details []BatchDropFailure `json:"details"`
+	} `json:"error"`
+}
+
+func decodeBatch(t *testing.T, w *httptest.ResponseRecorder) batchResponse {
+	t.Helper()
+	var resp batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+func TestCreateBatchDropsAllOrNothingRejectsInvalidDrop(t *testing.T) {
+	mock := mockDB(t)
+
+	w := postBatch("", batchWithInvalidDrop)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400: %s", w.Code, w.Body.String())
+	}
+	resp := decodeBatch(t, w)
+	if resp.Error == nil || len(resp.Error.Details) != 1 {
+		t.Fatalf("details = %+v, want one failure", resp.Error)
+	}
+	if failure := resp.Error.Details[0]; failure.Index != 1 || failure.Reason != "stage is required" {
+		t.Errorf("failure = %+v, want index 1 missing stage", failure)
+	}
+	// Nothing may touch the database
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateBatchDropsAllOrNothingRollsBack(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(insertDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(notifyDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertDropPattern).WillReturnError(errors.New("duplicate key"))
+	mock.ExpectRollback()
+
+	body := `[
+		{"workflow_id": "wf-1", "stage": "prompt", "type": "prompt"},
+		{"workflow_id": "wf-1", "stage": "code", "type": "code"}
+	]`
+	w := postBatch("", body)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500: %s", w.Code, w.Body.String())
+	}
+	resp := decodeBatch(t, w)
+	if resp.Error == nil || len(resp.Error.Details) != 1 || resp.Error.Details[0].Index != 1 {
+		t.Errorf("details = %+v, want failure at index 1", resp.Error)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateBatchDropsAllOrNothingCommits(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(insertDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(notifyDropPattern).WithArgs(dropEventsChannel, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(notifyDropPattern).WithArgs(dropEventsChannel, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	body := `[
+		{"workflow_id": "wf-1", "stage": "prompt", "type": "prompt"},
+		{"workflow_id": "wf-1", "stage": "code", "type": "code"}
+	]`
+	w := postBatch("?partial=false", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+	if resp := decodeBatch(t, w); resp.Count != 2 {
+		t.Errorf("count = %d, want 2", resp.Count)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateBatchDropsPartialStoresValidDrops(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectExec(insertDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(notifyDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(notifyDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := postBatch("?partial=true", batchWithInvalidDrop)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want 207: %s", w.Code, w.Body.String())
+	}
+	resp := decodeBatch(t, w)
+	if resp.Count != 2 || len(resp.Created) != 2 {
+		t.Fatalf("created = %+v, want 2 drops", resp.Created)
+	}
+	if resp.Created[0].Index != 0 || resp.Created[1].Index != 2 || resp.Created[0].ID == "" {
+		t.Errorf("created = %+v, want indices 0 and 2 with IDs", resp.Created)
+	}
+	if len(resp.Failed) != 1 || resp.Failed[0].Index != 1 || resp.Failed[0].Reason != "stage is required" {
+		t.Errorf("failed = %+v, want index 1 missing stage", resp.Failed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateBatchDropsPartialReportsInsertErrors(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectExec(insertDropPattern).WillReturnError(errors.New("duplicate key"))
+
+	w := postBatch("?partial=true", `[{"id": "drop-1", "workflow_id": "wf-1", "stage": "code", "type": "code"}]`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", w.Code, w.Body.String())
+	}
+	resp := decodeBatch(t, w)
+	if len(resp.Created) != 0 || len(resp.Failed) != 1 {
+		t.Fatalf("response = %+v, want one failure", resp)
+	}
+	if failure := resp.Failed[0]; failure.ID != "drop-1" || failure.Reason != "duplicate key" {
+		t.Errorf("failure = %+v", failure)
+	}
+}
+
+func TestCreateBatchDropsRejectsInvalidPartialFlag(t *testing.T) {
+	mockDB(t)
+	if w := postBatch("?partial=maybe", `[]`); w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// Artifacts are optionally envelope encrypted: each drop's artifact is
+// sealed with AES-256-GCM under its own random data key, and that data key
+// is stored wrapped by a master key. Rows written before encryption was
+// enabled stay readable; their encrypted column is false.
+
+// dataKeySize is the size of per-drop data keys and of master keys: AES-256
+const dataKeySize = 32
+
+// errDecrypt means a stored artifact couldn't be decrypted, because its
+// master key isn't configured or the row was tampered with
+var errDecrypt = errors.New("failed to decrypt artifact")
+
+// MasterKey wraps and unwraps data keys. Keys held in a KMS can implement
+// it; local keys come from the environment.
+type MasterKey interface {
+	Version() string
+	Wrap(dataKey []byte) ([]byte, error)
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+// localKey is a master key held in memory
+type localKey struct {
+	version string
+	aead    cipher.AEAD
+}
+
+func newLocalKey(version string, key []byte) (*localKey, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("master key %s is %d bytes, want %d", version, len(key), dataKeySize)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &localKey{version: version, aead: aead}, nil
+}
+
+func (k *localKey) Version() string { return k.version }
+
+// Wrap seals the data key, prefixed with its nonce
+func (k *localKey) Wrap(dataKey []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, dataKey, []byte(k.version)), nil
+}
+
+func (k *localKey) Unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < k.aead.NonceSize() {
+		return nil, errDecrypt
+	}
+	nonce, sealed := wrapped[:k.aead.NonceSize()], wrapped[k.aead.NonceSize():]
+	dataKey, err := k.aead.Open(nil, nonce, sealed, []byte(k.version))
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ArtifactCipher encrypts artifacts with the newest master key and
+// decrypts them with whichever key they were written with. A nil
+// ArtifactCipher stores artifacts in plaintext.
+type ArtifactCipher struct {
+	keys []MasterKey // newest first
+}
+
+// NewArtifactCipher creates a cipher encrypting with keys[0]
+func NewArtifactCipher(keys ...MasterKey) (*ArtifactCipher, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no master keys")
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if seen[key.Version()] {
+			return nil, fmt.Errorf("master key version %s is configured twice", key.Version())
+		}
+		seen[key.Version()] = true
+	}
+	return &ArtifactCipher{keys: keys}, nil
+}
+
+// parseMasterKeys reads comma separated version:base64 master keys, newest
+// first. A single key may leave out its version, which is then "1".
+func parseMasterKeys(spec string) ([]MasterKey, error) {
+	entries := strings.Split(spec, ",")
+	var keys []MasterKey
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		version, encoded, found := strings.Cut(entry, ":")
+		if !found {
+			if len(entries) > 1 {
+				return nil, errors.New("every master key needs a version when several are configured")
+			}
+			version, encoded = "1", entry
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s is not valid base64: %w", version, err)
+		}
+		key, err := newLocalKey(version, raw)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// artifactCipherFromEnv reads master keys from ENCRYPTION_KEYS, newest
+// first, or the single ENCRYPTION_KEY. Without either artifacts are stored
+// in plaintext.
+func artifactCipherFromEnv() (*ArtifactCipher, error) {
+	spec := os.Getenv("ENCRYPTION_KEYS")
+	if spec == "" {
+		spec = os.Getenv("ENCRYPTION_KEY")
+	}
+	if spec == "" {
+		return nil, nil
+	}
+	keys, err := parseMasterKeys(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewArtifactCipher(keys...)
+}
+
+// artifacts encrypts drops' artifacts when encryption is configured
+var artifacts *ArtifactCipher
+
+// ActiveVersion is the version of the key new artifacts are encrypted with
+func (c *ArtifactCipher) ActiveVersion() string {
+	if c == nil {
+		return ""
+	}
+	return c.keys[0].Version()
+}
+
+func (c *ArtifactCipher) key(version string) MasterKey {
+	if c == nil {
+		return nil
+	}
+	for _, key := range c.keys {
+		if key.Version() == version {
+			return key
+		}
+	}
+	return nil
+}
+
+// StoredArtifact is an artifact as its quantum_drops row holds it
+type StoredArtifact struct {
+	Artifact   string
+	Encrypted  bool
+	KeyVersion sql.NullString
+	WrappedKey sql.NullString
+	Nonce      sql.NullString
+}
+
+// Seal prepares an artifact for storage. The drop ID is authenticated with
+// it, so a sealed artifact can't be moved to another row.
+func (c *ArtifactCipher) Seal(dropID, artifact string) (StoredArtifact, error) {
+	if c == nil {
+		return StoredArtifact{Artifact: artifact}, nil
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return StoredArtifact{}, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return StoredArtifact{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return StoredArtifact{}, err
+	}
+	master := c.keys[0]
+	wrapped, err := master.Wrap(dataKey)
+	if err != nil {
+		return StoredArtifact{}, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	sealed := aead.Seal(nil, nonce, []byte(artifact), []byte(dropID))
+	return StoredArtifact{
+		Artifact:   base64.StdEncoding.EncodeToString(sealed),
+		Encrypted:  true,
+		KeyVersion: sql.NullString{String: master.Version(), Valid: true},
+		WrappedKey: sql.NullString{String: base64.StdEncoding.EncodeToString(wrapped), Valid: true},
+		Nonce:      sql.NullString{String: base64.StdEncoding.EncodeToString(nonce), Valid: true},
+	}, nil
+}
+
+// Open returns a stored artifact's plaintext
+func (c *ArtifactCipher) Open(dropID string, stored StoredArtifact) (string, error) {
+	if !stored.Encrypted {
+		return stored.Artifact, nil
+	}
+	master := c.key(stored.KeyVersion.String)
+	if master == nil {
+		return "", fmt.Errorf("%w: master key %q is not configured", errDecrypt, stored.KeyVersion.String)
+	}
+	wrapped, err1 := base64.StdEncoding.DecodeString(stored.WrappedKey.String)
+	nonce, err2 := base64.StdEncoding.DecodeString(stored.Nonce.String)
+	sealed, err3 := base64.StdEncoding.DecodeString(stored.Artifact)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return "", fmt.Errorf("%w: %v", errDecrypt, err)
+	}
+	dataKey, err := master.Unwrap(wrapped)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return "", errDecrypt
+	}
+	plain, err := aead.Open(nil, nonce, sealed, []byte(dropID))
+	if err != nil {
+		return "", errDecrypt
+	}
+	return string(plain), nil
+}
+
+// artifactSizeColumn selects an artifact's plaintext length, falling back
+// to LENGTH for rows written before artifact_size existed, all of which are
+// plaintext
+const artifactSizeColumn = "COALESCE(artifact_size, LENGTH(artifact))"
+
+// artifactSize measures an artifact like Postgres' LENGTH, in characters
+func artifactSize(artifact string) int {
+	return utf8.RuneCountInString(artifact)
+}
+
+// createEncryptionColumns adds the columns encrypted artifacts need
+func createEncryptionColumns() {
+	columns := []string{
+		"ALTER TABLE quantum_drops ADD COLUMN IF NOT EXISTS encrypted BOOLEAN NOT NULL DEFAULT FALSE;",
+		"ALTER TABLE quantum_drops ADD COLUMN IF NOT EXISTS key_version VARCHAR(64);",
+		"ALTER TABLE quantum_drops ADD COLUMN IF NOT EXISTS wrapped_key TEXT;",
+		"ALTER TABLE quantum_drops ADD COLUMN IF NOT EXISTS nonce TEXT;",
+		// The plaintext's length, as LENGTH(artifact) measures ciphertext
+		"ALTER TABLE quantum_drops ADD COLUMN IF NOT EXISTS artifact_size INT;",
+	}
+	for _, column := range columns {
+		if _, err := db.Exec(column); err != nil {
+			logger.WithError(err).Warn("Failed to add encryption column")
+		}
+	}
+}
+
+// ReencryptReport sums up a re-encryption run
+type ReencryptReport struct {
+	KeyVersion  string `json:"key_version"`
+	Reencrypted int    `json:"reencrypted"`
+	Failed      int    `json:"failed"`
+	Batches     int    `json:"batches"`
+}
+
+// reencryptArtifacts encrypts every plaintext artifact, and every one
+// written with an older key, with the active key, batchSize rows at a
+// time. Each batch commits on its own, so a run can be stopped and resumed.
+// Rows that can't be decrypted are logged and left alone.
+func reencryptArtifacts(ctx context.Context, enc *ArtifactCipher, batchSize int) (*ReencryptReport, error) {
+	if enc == nil {
+		return nil, errors.New("encryption is not configured")
+	}
+	report := &ReencryptReport{KeyVersion: enc.ActiveVersion()}
+	after := ""
+	for {
+		last, reencrypted, failed, err := reencryptBatch(ctx, enc, after, batchSize)
+		if err != nil {
+			return report, err
+		}
+		if last == "" {
+			return report, nil
+		}
+		report.Batches++
+		report.Reencrypted += reencrypted
+		report.Failed += failed
+		logger.WithField("batch", report.Batches).WithField("reencrypted", report.Reencrypted).Info("Re-encrypted artifacts")
+		after = last
+	}
+}
+
+// reencryptBatch re-encrypts the batch of rows after the given ID and
+// returns the last ID it looked at, or "" when there were none
+func reencryptBatch(ctx context.Context, enc *ArtifactCipher, after string, batchSize int) (last string, reencrypted, failed int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, artifact, encrypted, key_version, wrapped_key, nonce
+			  FROM quantum_drops WHERE (encrypted = FALSE OR key_version IS DISTINCT FROM $1) AND id > $2
+			  ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED`, enc.ActiveVersion(), after, batchSize)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	type row struct {
+		id     string
+		stored StoredArtifact
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.stored.Artifact, &r.stored.Encrypted, &r.stored.KeyVersion, &r.stored.WrappedKey, &r.stored.Nonce); err != nil {
+			rows.Close()
+			return "", 0, 0, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", 0, 0, err
+	}
+	if len(batch) == 0 {
+		return "", 0, 0, nil
+	}
+
+	for _, r := range batch {
+		plain, err := enc.Open(r.id, r.stored)
+		if err != nil {
+			logger.WithError(err).WithField("drop_id", r.id).Warn("Skipping artifact that can't be decrypted")
+			failed++
+			continue
+		}
+		sealed, err := enc.Seal(r.id, plain)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE quantum_drops SET artifact = $2, encrypted = TRUE, key_version = $3,
+			  wrapped_key = $4, nonce = $5, artifact_size = COALESCE(artifact_size, $6) WHERE id = $1`,
+			r.id, sealed.Artifact, sealed.KeyVersion, sealed.WrappedKey, sealed.Nonce, artifactSize(plain)); err != nil {
+			return "", 0, 0, err
+		}
+		reencrypted++
+	}
+	if err := tx.Commit(); err != nil {
+		return "", 0, 0, err
+	}
+	return batch[len(batch)-1].id, reencrypted, failed, nil
+}
+
+// KeyVersionCount is how many drops use a key version
+type KeyVersionCount struct {
+	// Version is empty for plaintext rows
+	Version string `json:"version"`
+	Rows    int    `json:"rows"`
+	// Configured is false for versions whose key is missing, whose rows
+	// can't be read
+	Configured bool `json:"configured"`
+}
+
+// getEncryptionStatus reports which key versions stored artifacts use
+func getEncryptionStatus(c *gin.Context) {
+	rows, err := db.Query(`SELECT COALESCE(key_version, ''), encrypted, COUNT(*)
+			  FROM quantum_drops GROUP BY 1, 2 ORDER BY 1`)
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to count drops by key version"))
+		return
+	}
+	defer rows.Close()
+
+	plaintext := 0
+	versions := []KeyVersionCount{}
+	for rows.Next() {
+		var count KeyVersionCount
+		var encrypted bool
+		if err := rows.Scan(&count.Version, &encrypted, &count.Rows); err != nil {
+			apierror.RespondError(c, apierror.Internal("Failed to count drops by key version"))
+			return
+		}
+		if !encrypted {
+			plaintext += count.Rows
+			continue
+		}
+		count.Configured = artifacts.key(count.Version) != nil
+		versions = append(versions, count)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":        artifacts != nil,
+		"active_version": artifacts.ActiveVersion(),
+		"plaintext_rows": plaintext,
+		"key_versions":   versions,
+	})
+}
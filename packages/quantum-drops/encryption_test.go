@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+func testMasterKey(t *testing.T, version string, fill byte) MasterKey {
+	t.Helper()
+	key, err := newLocalKey(version, []byte(strings.Repeat(string(fill), dataKeySize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testCipher(t *testing.T, keys ...MasterKey) *ArtifactCipher {
+	t.Helper()
+	enc, err := NewArtifactCipher(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+// useCipher sets the cipher handlers encrypt with for the rest of the test
+func useCipher(t *testing.T, enc *ArtifactCipher) {
+	previous := artifacts
+	artifacts = enc
+	t.Cleanup(func() { artifacts = previous })
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	enc := testCipher(t, testMasterKey(t, "1", 'a'))
+	artifact := "func secret() string { return \"proprietary ✓\" }"
+
+	stored, err := enc.Seal("drop-1", artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.Encrypted || stored.KeyVersion.String != "1" || !stored.WrappedKey.Valid || !stored.Nonce.Valid {
+		t.Errorf("stored = %+v, want encrypted with key 1", stored)
+	}
+	if strings.Contains(stored.Artifact, "proprietary") {
+		t.Error("sealed artifact holds the plaintext")
+	}
+
+	again, _ := enc.Seal("drop-1", artifact)
+	if again.Artifact == stored.Artifact || again.WrappedKey == stored.WrappedKey {
+		t.Error("two seals share a data key or ciphertext")
+	}
+
+	got, err := enc.Open("drop-1", stored)
+	if err != nil || got != artifact {
+		t.Errorf("Open = %q, %v, want the artifact", got, err)
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	enc := testCipher(t, testMasterKey(t, "1", 'a'))
+	stored, err := enc.Seal("drop-1", "artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := enc.Open("drop-2", stored); !errors.Is(err, errDecrypt) {
+		t.Errorf("opened under another drop's ID: err = %v", err)
+	}
+
+	sealed, _ := base64.StdEncoding.DecodeString(stored.Artifact)
+	sealed[0] ^= 1
+	flipped := stored
+	flipped.Artifact = base64.StdEncoding.EncodeToString(sealed)
+	if _, err := enc.Open("drop-1", flipped); !errors.Is(err, errDecrypt) {
+		t.Errorf("opened a modified ciphertext: err = %v", err)
+	}
+
+	relabeled := stored
+	relabeled.KeyVersion.String = "2"
+	if _, err := testCipher(t, testMasterKey(t, "2", 'a')).Open("drop-1", relabeled); !errors.Is(err, errDecrypt) {
+		t.Errorf("opened a data key wrapped under another version: err = %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := testMasterKey(t, "1", 'a')
+	stored, err := testCipher(t, old).Seal("drop-1", "artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := testCipher(t, testMasterKey(t, "2", 'b'), old)
+	if got, err := rotated.Open("drop-1", stored); err != nil || got != "artifact" {
+		t.Errorf("Open with the old key still configured = %q, %v", got, err)
+	}
+	fresh, _ := rotated.Seal("drop-2", "artifact")
+	if fresh.KeyVersion.String != "2" || rotated.ActiveVersion() != "2" {
+		t.Errorf("sealed with key %s, want the newest, 2", fresh.KeyVersion.String)
+	}
+
+	retired := testCipher(t, testMasterKey(t, "2", 'b'))
+	if _, err := retired.Open("drop-1", stored); !errors.Is(err, errDecrypt) || !strings.Contains(err.Error(), `"1"`) {
+		t.Errorf("Open without key 1: err = %v, want it named as missing", err)
+	}
+}
+
+func TestPlaintextPassthrough(t *testing.T) {
+	var enc *ArtifactCipher
+	stored, err := enc.Seal("drop-1", "artifact")
+	if err != nil || stored.Encrypted || stored.Artifact != "artifact" {
+		t.Errorf("nil cipher Seal = %+v, %v, want plaintext", stored, err)
+	}
+
+	legacy := StoredArtifact{Artifact: "written before encryption"}
+	for _, enc := range []*ArtifactCipher{nil, testCipher(t, testMasterKey(t, "1", 'a'))} {
+		if got, err := enc.Open("drop-1", legacy); err != nil || got != legacy.Artifact {
+			t.Errorf("Open plaintext row = %q, %v", got, err)
+		}
+	}
+}
+
+func TestParseMasterKeys(t *testing.T) {
+	a := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	b := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32)))
+
+	keys, err := parseMasterKeys(a)
+	if err != nil || len(keys) != 1 || keys[0].Version() != "1" {
+		t.Errorf("single bare key: %v, %v", keys, err)
+	}
+	keys, err = parseMasterKeys("v3:" + b + ", v2:" + a)
+	if err != nil || len(keys) != 2 || keys[0].Version() != "v3" || keys[1].Version() != "v2" {
+		t.Errorf("versioned keys: %v, %v", keys, err)
+	}
+
+	short := base64.StdEncoding.EncodeToString([]byte("too short"))
+	for _, spec := range []string{"v1:not base64!", "v1:" + short, a + "," + b} {
+		if _, err := parseMasterKeys(spec); err == nil {
+			t.Errorf("parseMasterKeys(%q) accepted", spec)
+		}
+	}
+
+	if _, err := NewArtifactCipher(testMasterKey(t, "1", 'a'), testMasterKey(t, "1", 'b')); err == nil {
+		t.Error("duplicate key versions accepted")
+	}
+}
+
+func TestArtifactCipherFromEnv(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEYS", "")
+	t.Setenv("ENCRYPTION_KEY", "")
+	if enc, err := artifactCipherFromEnv(); enc != nil || err != nil {
+		t.Errorf("unconfigured: %v, %v, want plaintext storage", enc, err)
+	}
+
+	t.Setenv("ENCRYPTION_KEY", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	if enc, err := artifactCipherFromEnv(); err != nil || enc.ActiveVersion() != "1" {
+		t.Errorf("ENCRYPTION_KEY: %v, %v", enc, err)
+	}
+
+	t.Setenv("ENCRYPTION_KEYS", "2:"+base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32))))
+	if enc, err := artifactCipherFromEnv(); err != nil || enc.ActiveVersion() != "2" {
+		t.Errorf("ENCRYPTION_KEYS should win: %v, %v", enc, err)
+	}
+}
+
+// capture records a string argument for later matchers to use
+type capture struct{ into *string }
+
+func (m capture) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*m.into = s
+	return ok
+}
+
+func TestInsertDropEncrypts(t *testing.T) {
+	enc := testCipher(t, testMasterKey(t, "1", 'a'))
+	useCipher(t, enc)
+	mock := mockDB(t)
+
+	var artifact, wrapped, nonce string
+	arg := sqlmock.AnyArg()
+	mock.ExpectExec(insertDropPattern).
+		WithArgs("drop-1", "wf-1", arg, arg, arg, capture{&artifact}, arg, arg, arg, true, "1", capture{&wrapped}, capture{&nonce}, 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	drop := QuantumDrop{ID: "drop-1", WorkflowID: "wf-1", Artifact: "résumé ✓✓"}
+	if err := insertDrop(db, &drop); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if drop.Artifact != "résumé ✓✓" {
+		t.Errorf("insertDrop replaced the drop's artifact with %q", drop.Artifact)
+	}
+
+	stored := StoredArtifact{Artifact: artifact, Encrypted: true, KeyVersion: sql.NullString{String: "1", Valid: true},
+		WrappedKey: sql.NullString{String: wrapped, Valid: true}, Nonce: sql.NullString{String: nonce, Valid: true}}
+	if got, err := enc.Open("drop-1", stored); err != nil || got != drop.Artifact {
+		t.Errorf("stored artifact opens to %q, %v", got, err)
+	}
+}
+
+var storedDropColumns = []string{"id", "workflow_id", "request_id", "stage", "type", "artifact", "metadata",
+	"version", "created_at", "encrypted", "key_version", "wrapped_key", "nonce"}
+
+func storedDropRow(t *testing.T, rows *sqlmock.Rows, enc *ArtifactCipher, id, artifact string) *sqlmock.Rows {
+	t.Helper()
+	stored, err := enc.Seal(id, artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows.AddRow(id, "wf-1", "req-1", "code", "code", stored.Artifact, nil, 1, time.Now(),
+		stored.Encrypted, stored.KeyVersion, stored.WrappedKey, stored.Nonce)
+}
+
+func getDropsFor(path string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/api/v1/drops/:id", getDrop)
+	router.GET("/api/v1/workflows/:workflow_id/drops", getWorkflowDrops)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestReadsDecryptTransparently(t *testing.T) {
+	enc := testCipher(t, testMasterKey(t, "2", 'b'), testMasterKey(t, "1", 'a'))
+	useCipher(t, enc)
+	mock := mockDB(t)
+
+	rows := sqlmock.NewRows(storedDropColumns)
+	rows = storedDropRow(t, rows, nil, "drop-plain", "old plaintext")
+	rows = storedDropRow(t, rows, testCipher(t, testMasterKey(t, "1", 'a')), "drop-v1", "under key 1")
+	rows = storedDropRow(t, rows, enc, "drop-v2", "under key 2")
+	mock.ExpectQuery(regexp.QuoteMeta("FROM quantum_drops WHERE workflow_id = $1")).WithArgs("wf-1").WillReturnRows(rows)
+
+	w := getDropsFor("/api/v1/workflows/wf-1/drops")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var collection DropCollection
+	if err := json.Unmarshal(w.Body.Bytes(), &collection); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, drop := range collection.Drops {
+		got = append(got, drop.Artifact)
+	}
+	if strings.Join(got, "|") != "old plaintext|under key 1|under key 2" {
+		t.Errorf("artifacts = %q", got)
+	}
+}
+
+func TestReadWithMissingKeyFails(t *testing.T) {
+	useCipher(t, testCipher(t, testMasterKey(t, "2", 'b')))
+	mock := mockDB(t)
+
+	rows := storedDropRow(t, sqlmock.NewRows(storedDropColumns), testCipher(t, testMasterKey(t, "1", 'a')), "drop-1", "artifact")
+	mock.ExpectQuery(regexp.QuoteMeta("FROM quantum_drops WHERE id = $1")).WithArgs("drop-1").WillReturnRows(rows)
+
+	w := getDropsFor("/api/v1/drops/drop-1")
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "Failed to decrypt drop") {
+		t.Errorf("status = %d, body %s, want a decryption failure", w.Code, w.Body.String())
+	}
+}
+
+var reencryptPattern = regexp.QuoteMeta("FROM quantum_drops WHERE (encrypted = FALSE OR key_version IS DISTINCT FROM $1) AND id > $2")
+
+func TestReencryptArtifacts(t *testing.T) {
+	old := testCipher(t, testMasterKey(t, "1", 'a'))
+	enc := testCipher(t, testMasterKey(t, "2", 'b'), testMasterKey(t, "1", 'a'))
+	lost := testCipher(t, testMasterKey(t, "0", 'z'))
+	mock := mockDB(t)
+
+	columns := []string{"id", "artifact", "encrypted", "key_version", "wrapped_key", "nonce"}
+	row := func(rows *sqlmock.Rows, c *ArtifactCipher, id, artifact string) *sqlmock.Rows {
+		stored, err := c.Seal(id, artifact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows.AddRow(id, stored.Artifact, stored.Encrypted, stored.KeyVersion, stored.WrappedKey, stored.Nonce)
+	}
+	arg := sqlmock.AnyArg()
+
+	// First batch: a plaintext row and one under the old key
+	mock.ExpectBegin()
+	mock.ExpectQuery(reencryptPattern).WithArgs("2", "", 2).
+		WillReturnRows(row(row(sqlmock.NewRows(columns), nil, "a", "plain"), old, "b", "old key"))
+	mock.ExpectExec("UPDATE quantum_drops SET artifact").WithArgs("a", arg, "2", arg, arg, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE quantum_drops SET artifact").WithArgs("b", arg, "2", arg, arg, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// Second batch: a row whose key is gone is skipped
+	mock.ExpectBegin()
+	mock.ExpectQuery(reencryptPattern).WithArgs("2", "b", 2).
+		WillReturnRows(row(sqlmock.NewRows(columns), lost, "c", "unreadable"))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(reencryptPattern).WithArgs("2", "c", 2).WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectRollback()
+
+	report, err := reencryptArtifacts(context.Background(), enc, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReencryptReport{KeyVersion: "2", Reencrypted: 2, Failed: 1, Batches: 2}
+	if *report != want {
+		t.Errorf("report = %+v, want %+v", *report, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := reencryptArtifacts(context.Background(), nil, 2); err == nil {
+		t.Error("re-encrypted without a cipher")
+	}
+}
+
+func TestEncryptionStatus(t *testing.T) {
+	useCipher(t, testCipher(t, testMasterKey(t, "2", 'b'), testMasterKey(t, "1", 'a')))
+	mock := mockDB(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM quantum_drops GROUP BY 1, 2")).
+		WillReturnRows(sqlmock.NewRows([]string{"key_version", "encrypted", "count"}).
+			AddRow("", false, 40).
+			AddRow("0", true, 3).
+			AddRow("1", true, 10).
+			AddRow("2", true, 7))
+
+	router := gin.New()
+	router.GET("/api/v1/admin/encryption", getEncryptionStatus)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/encryption", nil))
+
+	var status struct {
+		Enabled       bool              `json:"enabled"`
+		ActiveVersion string            `json:"active_version"`
+		PlaintextRows int               `json:"plaintext_rows"`
+		KeyVersions   []KeyVersionCount `json:"key_versions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Enabled || status.ActiveVersion != "2" || status.PlaintextRows != 40 {
+		t.Errorf("status = %+v", status)
+	}
+	want := []KeyVersionCount{{"0", 3, false}, {"1", 10, true}, {"2", 7, true}}
+	if len(status.KeyVersions) != len(want) {
+		t.Fatalf("key versions = %+v, want %+v", status.KeyVersions, want)
+	}
+	for i := range want {
+		if status.KeyVersions[i] != want[i] {
+			t.Errorf("key version %d = %+v, want %+v", i, status.KeyVersions[i], want[i])
+		}
+	}
+}
@@ -3,33 +3,47 @@ module github.com/QuantumLayer-dev/quantumlayer-platform/packages/quantum-drops
 go 1.21
 
 require (
-    github.com/gin-gonic/gin v1.9.1
-    github.com/lib/pq v1.10.9
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared v0.0.0
+	github.com/gin-gonic/gin v1.9.1
+	github.com/lib/pq v1.10.9
+	github.com/prometheus/client_golang v1.17.0
+	github.com/sirupsen/logrus v1.9.3
 )
 
 require (
-    github.com/bytedance/sonic v1.9.1 // indirect
-    github.com/chenzhuoyu/base64x v0.0.0-20221115062448-fe3a3abad311 // indirect
-    github.com/gabriel-vasile/mimetype v1.4.2 // indirect
-    github.com/gin-contrib/sse v0.1.0 // indirect
-    github.com/go-playground/locales v0.14.1 // indirect
-    github.com/go-playground/universal-translator v0.18.1 // indirect
-    github.com/go-playground/validator/v10 v10.14.0 // indirect
-    github.com/goccy/go-json v0.10.2 // indirect
-    github.com/json-iterator/go v1.1.12 // indirect
-    github.com/klauspost/cpuid/v2 v2.2.4 // indirect
-    github.com/leodido/go-urn v1.2.4 // indirect
-    github.com/mattn/go-isatty v0.0.19 // indirect
-    github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
-    github.com/modern-go/reflect2 v1.0.2 // indirect
-    github.com/pelletier/go-toml/v2 v2.0.8 // indirect
-    github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
-    github.com/ugorji/go/codec v1.2.11 // indirect
-    golang.org/x/arch v0.3.0 // indirect
-    golang.org/x/crypto v0.9.0 // indirect
-    golang.org/x/net v0.10.0 // indirect
-    golang.org/x/sys v0.8.0 // indirect
-    golang.org/x/text v0.9.0 // indirect
-    google.golang.org/protobuf v1.30.0 // indirect
-    gopkg.in/yaml.v3 v3.0.1 // indirect
-)
\ No newline at end of file
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/bytedance/sonic v1.9.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/chenzhuoyu/base64x v0.0.0-20221115062448-fe3a3abad311 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/gabriel-vasile/mimetype v1.4.2 // indirect
+	github.com/gin-contrib/sse v0.1.0 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/go-playground/validator/v10 v10.14.0 // indirect
+	github.com/goccy/go-json v0.10.2 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.4 // indirect
+	github.com/leodido/go-urn v1.2.4 // indirect
+	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/pelletier/go-toml/v2 v2.0.8 // indirect
+	github.com/prometheus/client_model v0.4.1-0.20230718164431-9a2bf3000d16 // indirect
+	github.com/prometheus/common v0.44.0 // indirect
+	github.com/prometheus/procfs v0.11.1 // indirect
+	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
+	github.com/ugorji/go/codec v1.2.11 // indirect
+	golang.org/x/arch v0.3.0 // indirect
+	golang.org/x/crypto v0.9.0 // indirect
+	golang.org/x/net v0.10.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared => ../shared
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // QuantumDrop represents an intermediate generation artifact
@@ -47,73 +53,152 @@ type DropSummary struct {
 
 var db *sql.DB
 
-func main() {
-	// Initialize database connection
-	dbHost := os.Getenv("DB_HOST")
-	if dbHost == "" {
-		dbHost = "postgres-ha.quantumlayer.svc.cluster.local"
-	}
-	
-	dbUser := os.Getenv("DB_USER")
-	if dbUser == "" {
-		dbUser = "quantumlayer"
-	}
-	
-	dbPass := os.Getenv("DB_PASSWORD")
-	if dbPass == "" {
-		dbPass = "quantum2024"
-	}
-	
-	dbName := os.Getenv("DB_NAME")
-	if dbName == "" {
-		dbName = "quantumdrops"
-	}
+var logger = logging.New("quantum-drops")
 
-	connStr := fmt.Sprintf("host=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbUser, dbPass, dbName)
+// requestIDMetadataKey is the metadata key holding the X-Request-ID of the
+// request that created a drop. It is the HTTP correlation ID, unlike the
+// drop's request_id, which names the generation request.
+const requestIDMetadataKey = "http_request_id"
+
+func main() {
+	connStr := openDB()
+	defer db.Close()
 
 	var err error
-	db, err = sql.Open("postgres", connStr)
+	artifacts, err = artifactCipherFromEnv()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logger.WithError(err).Fatal("Invalid encryption configuration")
 	}
-	defer db.Close()
 
 	// Create tables if not exists
 	createTables()
+	createEncryptionColumns()
+	createWebhookTables()
+
+	if len(os.Args) > 1 && os.Args[1] == "reencrypt-artifacts" {
+		runReencrypt(os.Args[2:])
+		return
+	}
+
+	// Prune drops past their retention in the background
+	pruner.Start(context.Background())
+
+	// Forward stored drops to the workflows' event streams
+	if err := dropStreams.Listen(connStr); err != nil {
+		logger.WithError(err).Warn("Failed to listen for drop events")
+	}
+
+	auth, err := authmiddleware.FromEnv("/metrics")
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid authentication configuration")
+	}
+	if warning := auth.Warning(); warning != "" {
+		logger.Warn("Authentication: " + warning)
+	}
 
 	// Setup Gin router
-	r := gin.Default()
+	r := gin.New()
+	r.Use(logging.RequestID(), logging.Middleware(logger), gin.Recovery(), authmiddleware.Middleware(auth))
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	// QuantumDrops API endpoints
 	r.POST("/api/v1/drops", createDrop)
 	r.GET("/api/v1/drops/:id", getDrop)
 	r.GET("/api/v1/workflows/:workflow_id/drops", getWorkflowDrops)
+	r.GET("/api/v1/workflows/:workflow_id/drops/stream", streamWorkflowDrops)
 	r.GET("/api/v1/workflows/:workflow_id/drops/:stage", getDropByStage)
 	r.GET("/api/v1/workflows/:workflow_id/summary", getDropsSummary)
+	r.GET("/api/v1/workflows/:workflow_id/timeline", getWorkflowTimeline)
 	r.POST("/api/v1/workflows/:workflow_id/rollback/:drop_id", rollbackToDrop)
 	r.DELETE("/api/v1/drops/:id", deleteDrop)
 
+	// Encryption at rest
+	r.GET("/api/v1/admin/encryption", getEncryptionStatus)
+
 	// Batch operations
 	r.POST("/api/v1/drops/batch", createBatchDrops)
 	r.GET("/api/v1/drops/search", searchDrops)
 
+	// Semantic search
+	r.GET("/api/v1/drops/semantic-search", semanticSearchDrops)
+	r.POST("/api/v1/admin/semantic-index/backfill", backfillSemanticIndex)
+
+	// Retention
+	r.GET("/api/v1/drops/retention", getRetentionPolicy)
+	r.POST("/api/v1/drops/prune", pruneDrops)
+
+	// Webhook subscriptions and failed deliveries
+	r.POST("/api/v1/webhooks", createWebhook)
+	r.GET("/api/v1/webhooks", listWebhooks)
+	r.DELETE("/api/v1/webhooks/:id", deleteWebhook)
+	r.GET("/api/v1/webhooks/dead-letters", listDeadLetters)
+	r.POST("/api/v1/webhooks/dead-letters/:id/redeliver", redeliverDeadLetter)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8090"
 	}
 
-	log.Printf("Starting QuantumDrops service on port %s", port)
+	logger.WithField("port", port).Info("Starting QuantumDrops service")
 	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+		logger.WithError(err).Fatal("Failed to start server")
 	}
 }
 
+// openDB connects db from the DB_* environment and returns the connection
+// string
+func openDB() string {
+	dbHost := os.Getenv("DB_HOST")
+	if dbHost == "" {
+		dbHost = "postgres-ha.quantumlayer.svc.cluster.local"
+	}
+	
+	dbUser := os.Getenv("DB_USER")
+	if dbUser == "" {
+		dbUser = "quantumlayer"
+	}
+	
+	dbPass := os.Getenv("DB_PASSWORD")
+	if dbPass == "" {
+		dbPass = "quantum2024"
+	}
+	
+	dbName := os.Getenv("DB_NAME")
+	if dbName == "" {
+		dbName = "quantumdrops"
+	}
+
+	connStr := fmt.Sprintf("host=%s user=%s password=%s dbname=%s sslmode=disable",
+		dbHost, dbUser, dbPass, dbName)
+
+	var err error
+	db, err = sql.Open("postgres", connStr)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to connect to database")
+	}
+	return connStr
+}
+
+// runReencrypt migrates stored artifacts to the active master key, for
+// "quantum-drops reencrypt-artifacts"
+func runReencrypt(args []string) {
+	flags := flag.NewFlagSet("reencrypt-artifacts", flag.ExitOnError)
+	batchSize := flags.Int("batch-size", 500, "rows to re-encrypt per transaction")
+	flags.Parse(args)
+
+	report, err := reencryptArtifacts(context.Background(), artifacts, *batchSize)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to re-encrypt artifacts")
+	}
+	logger.WithField("key_version", report.KeyVersion).WithField("reencrypted", report.Reencrypted).
+		WithField("failed", report.Failed).Info("Re-encryption finished")
+}
+
 func createTables() {
 	// Create tables
 	query := `
@@ -131,7 +216,7 @@ func createTables() {
 
 	_, err := db.Exec(query)
 	if err != nil {
-		log.Printf("Warning: Failed to create quantum_drops table: %v", err)
+		logger.WithError(err).Warn("Failed to create quantum_drops table")
 	}
 
 	// Create indexes
@@ -145,7 +230,7 @@ func createTables() {
 	for _, idx := range indexes {
 		_, err := db.Exec(idx)
 		if err != nil {
-			log.Printf("Warning: Failed to create index: %v", err)
+			logger.WithError(err).Warn("Failed to create index")
 		}
 	}
 
@@ -161,39 +246,54 @@ func createTables() {
 
 	_, err = db.Exec(collectionQuery)
 	if err != nil {
-		log.Printf("Warning: Failed to create drop_collections table: %v", err)
+		logger.WithError(err).Warn("Failed to create drop_collections table")
 	}
+
+	// Embeddings for semantic search, when pgvector is installed
+	semantic.vectors = createEmbeddingColumns()
 }
 
 // API Handlers
 
+// tagRequest records the ID of the request creating a drop in its metadata,
+// so the drop can be traced back to the calls that produced it
+func tagRequest(c *gin.Context, drop *QuantumDrop) {
+	id := c.GetString(logging.RequestIDKey)
+	if id == "" {
+		return
+	}
+	if drop.Metadata == nil {
+		drop.Metadata = make(map[string]interface{})
+	}
+	drop.Metadata[requestIDMetadataKey] = id
+}
+
 func createDrop(c *gin.Context) {
 	var drop QuantumDrop
 	if err := c.ShouldBindJSON(&drop); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.RespondError(c, apierror.Validation(err.Error()))
 		return
 	}
+	tagRequest(c, &drop)
 
 	// Generate ID if not provided
 	if drop.ID == "" {
 		drop.ID = fmt.Sprintf("drop-%s-%s-%d", drop.WorkflowID, drop.Stage, time.Now().Unix())
 	}
-	drop.CreatedAt = time.Now()
 
 	// Store in database
-	metadataJSON, _ := json.Marshal(drop.Metadata)
-	query := `INSERT INTO quantum_drops (id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at)
-			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	
-	_, err := db.Exec(query, drop.ID, drop.WorkflowID, drop.RequestID, drop.Stage, drop.Type, 
-		drop.Artifact, metadataJSON, drop.Version, drop.CreatedAt)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store drop", "details": err.Error()})
+	if err := insertDrop(db, &drop); err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to store drop").WithDetails(err.Error()))
 		return
 	}
 
+	if err := notifyDrop(db, drop); err != nil {
+		logging.ForRequest(logger, c).WithError(err).WithField("drop_id", drop.ID).Warn("Failed to announce drop")
+	}
+
 	// Update collection
 	updateCollection(drop.WorkflowID, drop.RequestID)
+	semantic.IndexAsync(drop)
 
 	c.JSON(http.StatusCreated, drop)
 }
@@ -201,58 +301,40 @@ func createDrop(c *gin.Context) {
 func getDrop(c *gin.Context) {
 	dropID := c.Param("id")
 
-	var drop QuantumDrop
-	var metadataJSON []byte
-	query := `SELECT id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at
+	query := `SELECT ` + dropColumns + `
 			  FROM quantum_drops WHERE id = $1`
 	
-	err := db.QueryRow(query, dropID).Scan(&drop.ID, &drop.WorkflowID, &drop.RequestID, 
-		&drop.Stage, &drop.Type, &drop.Artifact, &metadataJSON, &drop.Version, &drop.CreatedAt)
+	drop, err := scanDrop(db.QueryRow(query, dropID))
 	
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found"})
+		apierror.RespondError(c, apierror.NotFound("Drop not found"))
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve drop"})
+		respondDropError(c, err)
 		return
 	}
 
-	if metadataJSON != nil {
-		json.Unmarshal(metadataJSON, &drop.Metadata)
-	}
-
 	c.JSON(http.StatusOK, drop)
 }
 
 func getWorkflowDrops(c *gin.Context) {
 	workflowID := c.Param("workflow_id")
 	
-	query := `SELECT id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at
+	query := `SELECT ` + dropColumns + `
 			  FROM quantum_drops WHERE workflow_id = $1 ORDER BY created_at ASC`
 	
 	rows, err := db.Query(query, workflowID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve drops"})
+		apierror.RespondError(c, apierror.Internal("Failed to retrieve drops"))
 		return
 	}
 	defer rows.Close()
 
-	drops := []QuantumDrop{}
-	for rows.Next() {
-		var drop QuantumDrop
-		var metadataJSON []byte
-		
-		err := rows.Scan(&drop.ID, &drop.WorkflowID, &drop.RequestID, &drop.Stage, 
-			&drop.Type, &drop.Artifact, &metadataJSON, &drop.Version, &drop.CreatedAt)
-		if err != nil {
-			continue
-		}
-		
-		if metadataJSON != nil {
-			json.Unmarshal(metadataJSON, &drop.Metadata)
-		}
-		drops = append(drops, drop)
+	drops, err := scanDrops(rows)
+	if err != nil {
+		respondDropError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, DropCollection{
@@ -267,40 +349,33 @@ func getDropByStage(c *gin.Context) {
 	workflowID := c.Param("workflow_id")
 	stage := c.Param("stage")
 
-	var drop QuantumDrop
-	var metadataJSON []byte
-	query := `SELECT id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at
+	query := `SELECT ` + dropColumns + `
 			  FROM quantum_drops WHERE workflow_id = $1 AND stage = $2 
 			  ORDER BY created_at DESC LIMIT 1`
 	
-	err := db.QueryRow(query, workflowID, stage).Scan(&drop.ID, &drop.WorkflowID, &drop.RequestID,
-		&drop.Stage, &drop.Type, &drop.Artifact, &metadataJSON, &drop.Version, &drop.CreatedAt)
+	drop, err := scanDrop(db.QueryRow(query, workflowID, stage))
 	
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found for stage"})
+		apierror.RespondError(c, apierror.NotFound("Drop not found for stage"))
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve drop"})
+		respondDropError(c, err)
 		return
 	}
 
-	if metadataJSON != nil {
-		json.Unmarshal(metadataJSON, &drop.Metadata)
-	}
-
 	c.JSON(http.StatusOK, drop)
 }
 
 func getDropsSummary(c *gin.Context) {
 	workflowID := c.Param("workflow_id")
 
-	query := `SELECT id, stage, type, created_at, LENGTH(artifact) as size
+	query := `SELECT id, stage, type, created_at, ` + artifactSizeColumn + ` as size
 			  FROM quantum_drops WHERE workflow_id = $1 ORDER BY created_at ASC`
 	
 	rows, err := db.Query(query, workflowID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve summary"})
+		apierror.RespondError(c, apierror.Internal("Failed to retrieve summary"))
 		return
 	}
 	defer rows.Close()
@@ -327,20 +402,17 @@ func rollbackToDrop(c *gin.Context) {
 	dropID := c.Param("drop_id")
 
 	// Get the drop to rollback to
-	var drop QuantumDrop
-	var metadataJSON []byte
-	query := `SELECT id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at
+	query := `SELECT ` + dropColumns + `
 			  FROM quantum_drops WHERE id = $1 AND workflow_id = $2`
 	
-	err := db.QueryRow(query, dropID, workflowID).Scan(&drop.ID, &drop.WorkflowID, &drop.RequestID,
-		&drop.Stage, &drop.Type, &drop.Artifact, &metadataJSON, &drop.Version, &drop.CreatedAt)
+	drop, err := scanDrop(db.QueryRow(query, dropID, workflowID))
 	
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found"})
+		apierror.RespondError(c, apierror.NotFound("Drop not found"))
 		return
 	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve drop"})
+		respondDropError(c, err)
 		return
 	}
 
@@ -359,20 +431,26 @@ func rollbackToDrop(c *gin.Context) {
 			"original_stage": drop.Stage,
 		},
 	}
+	tagRequest(c, &rollbackDrop)
 
 	// Store rollback drop
-	rollbackMetadataJSON, _ := json.Marshal(rollbackDrop.Metadata)
-	insertQuery := `INSERT INTO quantum_drops (id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at)
-					 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	
-	_, err = db.Exec(insertQuery, rollbackDrop.ID, rollbackDrop.WorkflowID, rollbackDrop.RequestID,
-		rollbackDrop.Stage, rollbackDrop.Type, rollbackDrop.Artifact, rollbackMetadataJSON,
-		rollbackDrop.Version, rollbackDrop.CreatedAt)
-	
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rollback"})
+	if err := insertDrop(db, &rollbackDrop); err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to create rollback"))
 		return
 	}
+	if err := notifyDrop(db, rollbackDrop); err != nil {
+		logging.ForRequest(logger, c).WithError(err).WithField("drop_id", rollbackDrop.ID).Warn("Failed to announce drop")
+	}
+	semantic.IndexAsync(rollbackDrop)
+
+	webhooks.Dispatch(c.Request.Context(), WebhookEventRollback, gin.H{
+		"workflow_id":      workflowID,
+		"rollback_drop_id": rollbackDrop.ID,
+		"original_drop_id": dropID,
+		"stage":            drop.Stage,
+		"type":             drop.Type,
+		"version":          rollbackDrop.Version,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Rollback successful",
@@ -387,70 +465,26 @@ func deleteDrop(c *gin.Context) {
 	query := `DELETE FROM quantum_drops WHERE id = $1`
 	result, err := db.Exec(query, dropID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete drop"})
+		apierror.RespondError(c, apierror.Internal("Failed to delete drop"))
 		return
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Drop not found"})
+		apierror.RespondError(c, apierror.NotFound("Drop not found"))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Drop deleted successfully"})
 }
 
-func createBatchDrops(c *gin.Context) {
-	var drops []QuantumDrop
-	if err := c.ShouldBindJSON(&drops); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Begin transaction
-	tx, err := db.Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
-		return
-	}
-
-	for _, drop := range drops {
-		if drop.ID == "" {
-			drop.ID = fmt.Sprintf("drop-%s-%s-%d", drop.WorkflowID, drop.Stage, time.Now().UnixNano())
-		}
-		drop.CreatedAt = time.Now()
-
-		metadataJSON, _ := json.Marshal(drop.Metadata)
-		query := `INSERT INTO quantum_drops (id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at)
-				  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-		
-		_, err := tx.Exec(query, drop.ID, drop.WorkflowID, drop.RequestID, drop.Stage, drop.Type,
-			drop.Artifact, metadataJSON, drop.Version, drop.CreatedAt)
-		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store drops", "details": err.Error()})
-			return
-		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Batch drops created successfully",
-		"count":   len(drops),
-	})
-}
-
 func searchDrops(c *gin.Context) {
 	stage := c.Query("stage")
 	dropType := c.Query("type")
 	workflowID := c.Query("workflow_id")
 	limit := c.DefaultQuery("limit", "100")
 
-	query := `SELECT id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at
+	query := `SELECT ` + dropColumns + `
 			  FROM quantum_drops WHERE 1=1`
 	args := []interface{}{}
 	argCount := 0
@@ -478,32 +512,76 @@ func searchDrops(c *gin.Context) {
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search drops"})
+		apierror.RespondError(c, apierror.Internal("Failed to search drops"))
 		return
 	}
 	defer rows.Close()
 
+	drops, err := scanDrops(rows)
+	if err != nil {
+		respondDropError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": drops,
+		"count":   len(drops),
+	})
+}
+
+// dropColumns are the columns scanDrop reads
+const dropColumns = `id, workflow_id, request_id, stage, type, artifact, metadata, version, created_at,
+			  encrypted, key_version, wrapped_key, nonce`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDrop reads a drop selected with dropColumns, decrypting its artifact
+func scanDrop(row rowScanner) (QuantumDrop, error) {
+	var drop QuantumDrop
+	var metadataJSON []byte
+	var stored StoredArtifact
+	err := row.Scan(&drop.ID, &drop.WorkflowID, &drop.RequestID, &drop.Stage, &drop.Type,
+		&stored.Artifact, &metadataJSON, &drop.Version, &drop.CreatedAt,
+		&stored.Encrypted, &stored.KeyVersion, &stored.WrappedKey, &stored.Nonce)
+	if err != nil {
+		return drop, err
+	}
+
+	if metadataJSON != nil {
+		json.Unmarshal(metadataJSON, &drop.Metadata)
+	}
+	drop.Artifact, err = artifacts.Open(drop.ID, stored)
+	return drop, err
+}
+
+// scanDrops reads every drop in rows. Rows that fail to scan are skipped,
+// but one that can't be decrypted fails the whole read.
+func scanDrops(rows *sql.Rows) ([]QuantumDrop, error) {
 	drops := []QuantumDrop{}
 	for rows.Next() {
-		var drop QuantumDrop
-		var metadataJSON []byte
-		
-		err := rows.Scan(&drop.ID, &drop.WorkflowID, &drop.RequestID, &drop.Stage,
-			&drop.Type, &drop.Artifact, &metadataJSON, &drop.Version, &drop.CreatedAt)
+		drop, err := scanDrop(rows)
+		if errors.Is(err, errDecrypt) {
+			return nil, err
+		}
 		if err != nil {
 			continue
 		}
-		
-		if metadataJSON != nil {
-			json.Unmarshal(metadataJSON, &drop.Metadata)
-		}
 		drops = append(drops, drop)
 	}
+	return drops, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"results": drops,
-		"count":   len(drops),
-	})
+// respondDropError reports a failure to read drops
+func respondDropError(c *gin.Context, err error) {
+	if errors.Is(err, errDecrypt) {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to decrypt drop")
+		apierror.RespondError(c, apierror.Internal("Failed to decrypt drop"))
+		return
+	}
+	apierror.RespondError(c, apierror.Internal("Failed to retrieve drop"))
 }
 
 func updateCollection(workflowID, requestID string) {
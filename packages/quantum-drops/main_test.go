@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// storedRequestID matches the metadata argument of an insert holding id
+type storedRequestID struct {
+	id string
+}
+
+func (m storedRequestID) Match(v driver.Value) bool {
+	raw, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(raw, &metadata); err != nil {
+		return false
+	}
+	return metadata[requestIDMetadataKey] == m.id
+}
+
+// postDrop creates a drop through the request ID middleware, sending
+// requestID when it is set
+func postDrop(requestID string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Use(logging.RequestID())
+	router.POST("/api/v1/drops", createDrop)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/drops",
+		strings.NewReader(`{"workflow_id": "wf-1", "stage": "code", "type": "code"}`))
+	if requestID != "" {
+		req.Header.Set(logging.RequestIDHeader, requestID)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func expectDropWithRequestID(mock sqlmock.Sqlmock, id string) {
+	arg := sqlmock.AnyArg()
+	mock.ExpectExec(insertDropPattern).
+		WithArgs(arg, "wf-1", arg, "code", "code", arg, storedRequestID{id}, arg, arg, false, arg, arg, arg, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(notifyDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func dropRequestID(t *testing.T, w *httptest.ResponseRecorder) interface{} {
+	t.Helper()
+	var drop QuantumDrop
+	if err := json.Unmarshal(w.Body.Bytes(), &drop); err != nil {
+		t.Fatal(err)
+	}
+	return drop.Metadata[requestIDMetadataKey]
+}
+
+func TestCreateDropPreservesRequestID(t *testing.T) {
+	mock := mockDB(t)
+	expectDropWithRequestID(mock, "req-from-gateway")
+
+	w := postDrop("req-from-gateway")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(logging.RequestIDHeader); got != "req-from-gateway" {
+		t.Errorf("response X-Request-ID = %q, want the caller's ID echoed", got)
+	}
+	if got := dropRequestID(t, w); got != "req-from-gateway" {
+		t.Errorf("drop metadata request ID = %v, want req-from-gateway", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateDropGeneratesRequestID(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectExec(insertDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(notifyDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := postDrop("")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+	id := w.Header().Get(logging.RequestIDHeader)
+	if id == "" {
+		t.Fatal("no X-Request-ID generated")
+	}
+	if got := dropRequestID(t, w); got != id {
+		t.Errorf("drop metadata request ID = %v, want %s", got, id)
+	}
+}
+
+func TestCreateDropReplacesMalformedRequestID(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectExec(insertDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(notifyDropPattern).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := postDrop(strings.Repeat("x", 200))
+	if id := w.Header().Get(logging.RequestIDHeader); id == "" || len(id) > 128 {
+		t.Errorf("X-Request-ID = %q, want a generated ID in place of the oversized one", id)
+	}
+}
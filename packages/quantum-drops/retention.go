@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultPruneInterval = time.Hour
+
+	// pruneBatchSize bounds the IDs deleted by one statement
+	pruneBatchSize = 500
+)
+
+// RetentionPolicy decides which drops are kept. A drop is pruned once it is
+// older than MaxAge, unless it is one of the latest KeepVersions versions of
+// its workflow stage. With MaxAge zero every drop beyond those versions is
+// pruned whatever its age; with both zero nothing is.
+type RetentionPolicy struct {
+	MaxAge       time.Duration `json:"-"`
+	MaxAgeDays   float64       `json:"max_age_days,omitempty"`
+	KeepVersions int           `json:"keep_versions,omitempty"`
+}
+
+func newRetentionPolicy(maxAge time.Duration, keepVersions int) RetentionPolicy {
+	return RetentionPolicy{
+		MaxAge:       maxAge,
+		MaxAgeDays:   maxAge.Hours() / 24,
+		KeepVersions: keepVersions,
+	}
+}
+
+// Enabled reports whether the policy prunes anything
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.KeepVersions > 0
+}
+
+// PrunedDrop is a drop removed, or in a dry run one that would be
+type PrunedDrop struct {
+	ID         string    `json:"id"`
+	WorkflowID string    `json:"workflow_id"`
+	Stage      string    `json:"stage"`
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	Size       int       `json:"size"`
+}
+
+// PruneReport is the outcome of one pruning run
+type PruneReport struct {
+	DryRun      bool            `json:"dry_run"`
+	Policy      RetentionPolicy `json:"policy"`
+	Scanned     int             `json:"scanned"`
+	Pruned      int             `json:"pruned"`
+	FreedBytes  int             `json:"freed_bytes"`
+	Drops       []PrunedDrop    `json:"drops"`
+	StartedAt   time.Time       `json:"started_at"`
+	CompletedAt time.Time       `json:"completed_at"`
+}
+
+// DropPruner enforces a retention policy in the background and on demand
+type DropPruner struct {
+	policy   RetentionPolicy
+	interval time.Duration
+	now      func() time.Time
+
+	// mu keeps pruning runs from overlapping
+	mu sync.Mutex
+}
+
+// NewDropPruner creates a pruner configured from DROP_RETENTION_DAYS,
+// DROP_RETENTION_KEEP_VERSIONS and DROP_PRUNE_INTERVAL_MINUTES. Drops are
+// kept forever unless one of the first two is set.
+func NewDropPruner() *DropPruner {
+	var maxAge time.Duration
+	if v := os.Getenv("DROP_RETENTION_DAYS"); v != "" {
+		if days, err := strconv.ParseFloat(v, 64); err == nil && days > 0 {
+			maxAge = time.Duration(days * float64(24*time.Hour))
+		}
+	}
+
+	keepVersions := 0
+	if v := os.Getenv("DROP_RETENTION_KEEP_VERSIONS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			keepVersions = n
+		}
+	}
+
+	interval := DefaultPruneInterval
+	if v := os.Getenv("DROP_PRUNE_INTERVAL_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			interval = time.Duration(n) * time.Minute
+		}
+	}
+
+	return &DropPruner{
+		policy:   newRetentionPolicy(maxAge, keepVersions),
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+var pruner = NewDropPruner()
+
+// Start prunes on every interval until ctx is done. It does nothing when
+// the policy keeps every drop.
+func (p *DropPruner) Start(ctx context.Context) {
+	if !p.policy.Enabled() {
+		return
+	}
+	logger.WithFields(logrus.Fields{
+		"interval":      p.interval.String(),
+		"max_age":       p.policy.MaxAge.String(),
+		"keep_versions": p.policy.KeepVersions,
+	}).Info("Pruning drops in the background")
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := p.Prune(ctx, p.policy, false)
+				if err != nil {
+					logger.WithError(err).Error("Failed to prune drops")
+				} else if report.Pruned > 0 {
+					logger.WithFields(logrus.Fields{"pruned": report.Pruned, "freed_bytes": report.FreedBytes}).Info("Pruned drops")
+				}
+			}
+		}
+	}()
+}
+
+// Prune removes the drops policy doesn't keep, or only reports them when
+// dryRun is set
+func (p *DropPruner) Prune(ctx context.Context, policy RetentionPolicy, dryRun bool) (*PruneReport, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := &PruneReport{DryRun: dryRun, Policy: policy, Drops: []PrunedDrop{}, StartedAt: p.now()}
+	if !policy.Enabled() {
+		report.CompletedAt = p.now()
+		return report, nil
+	}
+
+	// Artifacts aren't read; the newest version of each stage comes first
+	rows, err := db.QueryContext(ctx, `SELECT id, workflow_id, stage, version, created_at, `+artifactSizeColumn+`
+		FROM quantum_drops ORDER BY workflow_id, stage, version DESC, created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list drops: %w", err)
+	}
+	var drops []PrunedDrop
+	for rows.Next() {
+		var drop PrunedDrop
+		if err := rows.Scan(&drop.ID, &drop.WorkflowID, &drop.Stage, &drop.Version, &drop.CreatedAt, &drop.Size); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read drops: %w", err)
+		}
+		drops = append(drops, drop)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read drops: %w", err)
+	}
+
+	report.Scanned = len(drops)
+	report.Drops = selectPrunable(drops, policy, p.now())
+	report.Pruned = len(report.Drops)
+	for _, drop := range report.Drops {
+		report.FreedBytes += drop.Size
+	}
+
+	if !dryRun && len(report.Drops) > 0 {
+		if err := deletePruned(ctx, report.Drops, p.now()); err != nil {
+			return nil, err
+		}
+	}
+	report.CompletedAt = p.now()
+	return report, nil
+}
+
+// selectPrunable picks the drops policy doesn't keep from drops ordered by
+// workflow and stage, newest version first
+func selectPrunable(drops []PrunedDrop, policy RetentionPolicy, now time.Time) []PrunedDrop {
+	cutoff := now.Add(-policy.MaxAge)
+	prunable := []PrunedDrop{}
+	rank := 0
+	for i, drop := range drops {
+		if i == 0 || drop.WorkflowID != drops[i-1].WorkflowID || drop.Stage != drops[i-1].Stage {
+			rank = 0
+		}
+		rank++
+
+		if policy.KeepVersions > 0 && rank <= policy.KeepVersions {
+			continue
+		}
+		if policy.MaxAge > 0 && !drop.CreatedAt.Before(cutoff) {
+			continue
+		}
+		prunable = append(prunable, drop)
+	}
+	return prunable
+}
+
+// deletePruned removes drops and takes them off their collections' counts
+// in one transaction
+func deletePruned(ctx context.Context, drops []PrunedDrop, now time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(drops); start += pruneBatchSize {
+		end := start + pruneBatchSize
+		if end > len(drops) {
+			end = len(drops)
+		}
+		ids := make([]string, 0, end-start)
+		for _, drop := range drops[start:end] {
+			ids = append(ids, drop.ID)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM quantum_drops WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+			return fmt.Errorf("failed to delete drops: %w", err)
+		}
+	}
+
+	counts := make(map[string]int)
+	var workflows []string
+	for _, drop := range drops {
+		if counts[drop.WorkflowID] == 0 {
+			workflows = append(workflows, drop.WorkflowID)
+		}
+		counts[drop.WorkflowID]++
+	}
+	for _, workflowID := range workflows {
+		if _, err := tx.ExecContext(ctx, `UPDATE drop_collections SET total_drops = GREATEST(total_drops - $2, 0), updated_at = $3
+			WHERE workflow_id = $1`, workflowID, counts[workflowID], now); err != nil {
+			return fmt.Errorf("failed to update collection %s: %w", workflowID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit pruning: %w", err)
+	}
+	return nil
+}
+
+// pruneDrops prunes drops on demand. dry_run reports what would be pruned
+// without deleting it; max_age_days and keep_versions override the
+// configured policy for this run.
+func pruneDrops(c *gin.Context) {
+	dryRun := false
+	if raw := c.Query("dry_run"); raw != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			apierror.RespondError(c, apierror.Validation("dry_run must be true or false"))
+			return
+		}
+	}
+
+	policy := pruner.policy
+	if raw := c.Query("max_age_days"); raw != "" {
+		days, err := strconv.ParseFloat(raw, 64)
+		if err != nil || days < 0 {
+			apierror.RespondError(c, apierror.Validation("max_age_days must be a non-negative number"))
+			return
+		}
+		policy = newRetentionPolicy(time.Duration(days*float64(24*time.Hour)), policy.KeepVersions)
+	}
+	if raw := c.Query("keep_versions"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			apierror.RespondError(c, apierror.Validation("keep_versions must be a non-negative integer"))
+			return
+		}
+		policy.KeepVersions = n
+	}
+	if !policy.Enabled() {
+		apierror.RespondError(c, apierror.Validation("no retention policy configured; set max_age_days or keep_versions"))
+		return
+	}
+
+	report, err := pruner.Prune(c.Request.Context(), policy, dryRun)
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to prune drops")
+		apierror.RespondError(c, apierror.Internal("Failed to prune drops"))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// getRetentionPolicy returns the policy the background pruner enforces
+func getRetentionPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"policy":           pruner.policy,
+		"enabled":          pruner.policy.Enabled(),
+		"interval_minutes": pruner.interval.Minutes(),
+	})
+}
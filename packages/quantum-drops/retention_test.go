@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+var retentionColumns = []string{"id", "workflow_id", "stage", "version", "created_at", "size"}
+
+// retentionNow is the fake clock of the retention tests
+var retentionNow = time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func daysAgo(days int) time.Time {
+	return retentionNow.Add(-time.Duration(days) * 24 * time.Hour)
+}
+
+// expectDropListing returns stored drops in the order the pruner reads them:
+// by workflow and stage, newest version first
+func expectDropListing(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM quantum_drops ORDER BY workflow_id, stage, version DESC, created_at DESC")).
+		WillReturnRows(sqlmock.NewRows(retentionColumns).
+			AddRow("wf1-code-v3", "wf-1", "code_generation", 3, daysAgo(40), 300).
+			AddRow("wf1-code-v2", "wf-1", "code_generation", 2, daysAgo(45), 200).
+			AddRow("wf1-code-v1", "wf-1", "code_generation", 1, daysAgo(50), 100).
+			AddRow("wf1-frd-v1", "wf-1", "frd_generation", 1, daysAgo(50), 50).
+			AddRow("wf2-code-v2", "wf-2", "code_generation", 2, daysAgo(1), 20).
+			AddRow("wf2-code-v1", "wf-2", "code_generation", 1, daysAgo(31), 10))
+}
+
+func newTestPruner(policy RetentionPolicy) *DropPruner {
+	return &DropPruner{policy: policy, interval: time.Hour, now: func() time.Time { return retentionNow }}
+}
+
+func prunedIDs(report *PruneReport) []string {
+	ids := []string{}
+	for _, drop := range report.Drops {
+		ids = append(ids, drop.ID)
+	}
+	return ids
+}
+
+func TestPruneKeepsLatestVersions(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{
+		{
+			name:   "max age",
+			policy: newRetentionPolicy(30*24*time.Hour, 0),
+			want:   []string{"wf1-code-v3", "wf1-code-v2", "wf1-code-v1", "wf1-frd-v1", "wf2-code-v1"},
+		},
+		{
+			name:   "keep versions",
+			policy: newRetentionPolicy(0, 2),
+			want:   []string{"wf1-code-v1"},
+		},
+		{
+			// Old drops go unless they are the stage's latest version
+			name:   "max age keeping the latest version",
+			policy: newRetentionPolicy(30*24*time.Hour, 1),
+			want:   []string{"wf1-code-v2", "wf1-code-v1", "wf2-code-v1"},
+		},
+		{
+			name:   "max age past every drop",
+			policy: newRetentionPolicy(60*24*time.Hour, 1),
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDB(t)
+			expectDropListing(mock)
+
+			report, err := newTestPruner(tt.policy).Prune(context.Background(), tt.policy, true)
+			if err != nil {
+				t.Fatalf("Prune: %v", err)
+			}
+			if got := prunedIDs(report); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pruned %v, want %v", got, tt.want)
+			}
+			if report.Scanned != 6 || report.Pruned != len(tt.want) {
+				t.Errorf("scanned %d and pruned %d, want 6 and %d", report.Scanned, report.Pruned, len(tt.want))
+			}
+			// A dry run deletes nothing
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPruneDeletesDrops(t *testing.T) {
+	mock := mockDB(t)
+	expectDropListing(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM quantum_drops WHERE id = ANY($1)")).
+		WithArgs("{\"wf1-code-v2\",\"wf1-code-v1\",\"wf2-code-v1\"}").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE drop_collections SET total_drops")).
+		WithArgs("wf-1", 2, retentionNow).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE drop_collections SET total_drops")).
+		WithArgs("wf-2", 1, retentionNow).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	policy := newRetentionPolicy(30*24*time.Hour, 1)
+	report, err := newTestPruner(policy).Prune(context.Background(), policy, false)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if report.DryRun || report.Pruned != 3 || report.FreedBytes != 310 {
+		t.Errorf("report = %+v, want 3 drops and 310 bytes pruned", report)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPruneRollsBackOnError(t *testing.T) {
+	mock := mockDB(t)
+	expectDropListing(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM quantum_drops")).WillReturnError(context.DeadlineExceeded)
+	mock.ExpectRollback()
+
+	policy := newRetentionPolicy(0, 2)
+	if _, err := newTestPruner(policy).Prune(context.Background(), policy, false); err == nil {
+		t.Fatal("Prune succeeded, want the delete error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPruneEndpoint(t *testing.T) {
+	previous := pruner
+	pruner = newTestPruner(newRetentionPolicy(0, 0))
+	t.Cleanup(func() { pruner = previous })
+
+	router := gin.New()
+	router.POST("/api/v1/drops/prune", pruneDrops)
+	prune := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/drops/prune"+query, nil))
+		return w
+	}
+
+	for _, query := range []string{"", "?dry_run=maybe", "?keep_versions=-1", "?max_age_days=soon"} {
+		if w := prune(query); w.Code != http.StatusBadRequest {
+			t.Errorf("prune%s: status = %d, want 400", query, w.Code)
+		}
+	}
+
+	// The query overrides the configured policy
+	mock := mockDB(t)
+	expectDropListing(mock)
+	w := prune("?dry_run=true&max_age_days=30&keep_versions=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	var report PruneReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Pruned != 3 || report.Policy.MaxAgeDays != 30 || report.Policy.KeepVersions != 1 {
+		t.Errorf("report = %+v, want a dry run of 3 drops under the given policy", report)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
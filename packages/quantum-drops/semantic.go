@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultSemanticTopK      = 10
+	MaxSemanticTopK          = 100
+	DefaultBackfillBatchSize = 16
+	DefaultEmbeddingsTimeout = 30 * time.Second
+
+	// embeddingsPath is the llm-router's embeddings endpoint
+	embeddingsPath = "/api/v1/embeddings"
+
+	// An artifact is embedded as up to maxChunksPerDrop chunks of
+	// chunkRunes runes, well under the router's per-input token limit;
+	// anything past them is left out
+	chunkRunes       = 2000
+	maxChunksPerDrop = 8
+
+	// maxBackfillBatchSize keeps a batch's chunks within one embeddings
+	// request, which the router caps at 256 inputs
+	maxBackfillBatchSize = 256 / maxChunksPerDrop
+
+	// maxConcurrentIndexing bounds the new drops embedded at once
+	maxConcurrentIndexing = 4
+)
+
+var (
+	// errSemanticUnavailable is returned when the semantic index isn't set up
+	errSemanticUnavailable = errors.New("semantic search is not available")
+	// errEmbedQuery is returned when a search query can't be embedded
+	errEmbedQuery = errors.New("failed to embed the query")
+)
+
+// EmbeddingsClient embeds text with the llm-router
+type EmbeddingsClient struct {
+	url      string
+	provider string
+	http     *http.Client
+}
+
+// Embeddings are the vectors for a list of inputs, in input order
+type Embeddings struct {
+	Model   string
+	Vectors [][]float32
+}
+
+type embeddingsRequest struct {
+	Input    []string `json:"input"`
+	Provider string   `json:"provider,omitempty"`
+}
+
+type embeddingsResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed returns the embeddings of inputs
+func (c *EmbeddingsClient) Embed(ctx context.Context, inputs []string) (*Embeddings, error) {
+	body, err := json.Marshal(embeddingsRequest{Input: inputs, Provider: c.provider})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := logging.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embeddings service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	var decoded embeddingsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("invalid embeddings response: %w", err)
+	}
+	if len(decoded.Data) != len(inputs) {
+		return nil, fmt.Errorf("embeddings service returned %d vectors for %d inputs", len(decoded.Data), len(inputs))
+	}
+	sort.Slice(decoded.Data, func(i, j int) bool { return decoded.Data[i].Index < decoded.Data[j].Index })
+	result := &Embeddings{Model: decoded.Model, Vectors: make([][]float32, len(inputs))}
+	for i, item := range decoded.Data {
+		if item.Index != i || len(item.Embedding) == 0 {
+			return nil, errors.New("embeddings response is missing vectors")
+		}
+		result.Vectors[i] = item.Embedding
+	}
+	return result, nil
+}
+
+// SemanticIndex stores an embedding of each drop's artifact in a pgvector
+// column and searches drops by cosine similarity to a query. It needs
+// both an embeddings service and the vector extension; without either,
+// indexing is skipped and searches answer 501.
+type SemanticIndex struct {
+	client *EmbeddingsClient
+	// vectors is set once the embedding columns exist
+	vectors bool
+
+	sem     chan struct{}
+	pending sync.WaitGroup
+}
+
+// NewSemanticIndex creates an index embedding with the llm-router at
+// EMBEDDINGS_URL, pinned to EMBEDDINGS_PROVIDER when it is set so every
+// vector comes from the same model. Without EMBEDDINGS_URL the index is
+// off.
+func NewSemanticIndex() *SemanticIndex {
+	s := &SemanticIndex{sem: make(chan struct{}, maxConcurrentIndexing)}
+	base := strings.TrimSuffix(os.Getenv("EMBEDDINGS_URL"), "/")
+	if base == "" {
+		return s
+	}
+	if !strings.HasSuffix(base, embeddingsPath) {
+		base += embeddingsPath
+	}
+	s.client = &EmbeddingsClient{
+		url:      base,
+		provider: os.Getenv("EMBEDDINGS_PROVIDER"),
+		http:     &http.Client{Timeout: DefaultEmbeddingsTimeout},
+	}
+	return s
+}
+
+var semantic = NewSemanticIndex()
+
+// Available reports whether drops can be indexed and searched
+func (s *SemanticIndex) Available() bool {
+	return s.client != nil && s.vectors
+}
+
+// unavailableReason says what the index is missing
+func (s *SemanticIndex) unavailableReason() string {
+	if s.client == nil {
+		return "Semantic search is not configured; set EMBEDDINGS_URL"
+	}
+	return "Semantic search needs the pgvector extension in the database"
+}
+
+// createEmbeddingColumns enables pgvector and adds the columns embeddings
+// are stored in, reporting whether they are usable. The column takes
+// vectors of any dimension; embedding_model records which model produced
+// each, as only vectors from the same model can be compared.
+func createEmbeddingColumns() bool {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS vector;",
+		"ALTER TABLE quantum_drops ADD COLUMN IF NOT EXISTS embedding vector;",
+		"ALTER TABLE quantum_drops ADD COLUMN IF NOT EXISTS embedding_model VARCHAR(255);",
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			logger.WithError(err).Warn("pgvector is unavailable, semantic search is disabled")
+			return false
+		}
+	}
+	return true
+}
+
+// chunkArtifact splits an artifact into the chunks it is embedded as,
+// dropping what is past the last one
+func chunkArtifact(artifact string) []string {
+	runes := []rune(strings.TrimSpace(artifact))
+	var chunks []string
+	for start := 0; start < len(runes) && len(chunks) < maxChunksPerDrop; start += chunkRunes {
+		end := start + chunkRunes
+		if end > len(runes) {
+			end = len(runes)
+		}
+		chunks = append(chunks, string(runes[start:end]))
+	}
+	return chunks
+}
+
+// poolVectors averages the vectors of a drop's chunks into one of unit
+// length. Vectors of another dimension than the first are ignored.
+func poolVectors(vectors [][]float32) []float32 {
+	pooled := make([]float64, len(vectors[0]))
+	for _, v := range vectors {
+		if len(v) != len(pooled) {
+			continue
+		}
+		for i, x := range v {
+			pooled[i] += float64(x)
+		}
+	}
+	var norm float64
+	for _, x := range pooled {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	result := make([]float32, len(pooled))
+	for i, x := range pooled {
+		if norm > 0 {
+			x /= norm
+		}
+		result[i] = float32(x)
+	}
+	return result
+}
+
+// vectorLiteral formats a vector as pgvector's text input
+func vectorLiteral(v []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(x), 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// indexDrops embeds the artifacts of drops in one request and stores the
+// result, returning how many were indexed. Drops with empty artifacts are
+// skipped.
+func (s *SemanticIndex) indexDrops(ctx context.Context, drops []QuantumDrop) (int, error) {
+	if !s.Available() {
+		return 0, errSemanticUnavailable
+	}
+	var inputs []string
+	var indexed []QuantumDrop
+	var spans [][2]int
+	for _, drop := range drops {
+		chunks := chunkArtifact(drop.Artifact)
+		if len(chunks) == 0 {
+			continue
+		}
+		spans = append(spans, [2]int{len(inputs), len(inputs) + len(chunks)})
+		inputs = append(inputs, chunks...)
+		indexed = append(indexed, drop)
+	}
+	if len(inputs) == 0 {
+		return 0, nil
+	}
+
+	embeddings, err := s.client.Embed(ctx, inputs)
+	if err != nil {
+		return 0, err
+	}
+	for i, drop := range indexed {
+		vector := poolVectors(embeddings.Vectors[spans[i][0]:spans[i][1]])
+		if _, err := db.ExecContext(ctx, `UPDATE quantum_drops SET embedding = $1::vector, embedding_model = $2 WHERE id = $3`,
+			vectorLiteral(vector), embeddings.Model, drop.ID); err != nil {
+			return i, fmt.Errorf("failed to store embedding of %s: %w", drop.ID, err)
+		}
+	}
+	return len(indexed), nil
+}
+
+// IndexAsync indexes newly stored drops in the background, so storing a
+// drop never waits on the embeddings service. It does nothing when the
+// index is unavailable.
+func (s *SemanticIndex) IndexAsync(drops ...QuantumDrop) {
+	if !s.Available() || len(drops) == 0 {
+		return
+	}
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		s.sem <- struct{}{}
+		defer func() { <-s.sem }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*DefaultEmbeddingsTimeout)
+		defer cancel()
+		for start := 0; start < len(drops); start += maxBackfillBatchSize {
+			end := start + maxBackfillBatchSize
+			if end > len(drops) {
+				end = len(drops)
+			}
+			if _, err := s.indexDrops(ctx, drops[start:end]); err != nil {
+				logger.WithError(err).WithField("drops", end-start).Warn("Failed to index drops for semantic search")
+			}
+		}
+	}()
+}
+
+// BackfillReport sums up one backfill run
+type BackfillReport struct {
+	Indexed int `json:"indexed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	Batches int `json:"batches"`
+	// NextAfter resumes the backfill where this run stopped; it is empty
+	// once every drop has been looked at
+	NextAfter string `json:"next_after,omitempty"`
+	Done      bool   `json:"done"`
+}
+
+// Backfill indexes drops without an embedding in ID order, batchSize at a
+// time, starting after the given ID and stopping after maxBatches batches
+// (0 runs until every drop has been looked at). A batch the embeddings
+// service fails is counted and skipped so one bad batch can't stall the
+// run.
+func (s *SemanticIndex) Backfill(ctx context.Context, after string, batchSize, maxBatches int) (*BackfillReport, error) {
+	if !s.Available() {
+		return nil, errSemanticUnavailable
+	}
+	report := &BackfillReport{}
+	for maxBatches == 0 || report.Batches < maxBatches {
+		drops, last, unreadable, err := unindexedDrops(ctx, after, batchSize)
+		if err != nil {
+			return report, err
+		}
+		if last == "" {
+			report.Done = true
+			report.NextAfter = ""
+			return report, nil
+		}
+		report.Batches++
+		report.Failed += unreadable
+		indexed, err := s.indexDrops(ctx, drops)
+		report.Indexed += indexed
+		if err != nil {
+			report.Failed += len(drops) - indexed
+			logger.WithError(err).WithField("after", after).Warn("Failed to index batch of drops")
+		} else {
+			report.Skipped += len(drops) - indexed
+		}
+		after = last
+		report.NextAfter = last
+		logger.WithFields(logrus.Fields{"batch": report.Batches, "indexed": report.Indexed}).Info("Indexed drops for semantic search")
+	}
+	return report, nil
+}
+
+// unindexedDrops reads the batch of drops without an embedding after the
+// given ID. It returns the last ID it looked at, or "" when there were
+// none, and how many drops couldn't be read.
+func unindexedDrops(ctx context.Context, after string, batchSize int) (drops []QuantumDrop, last string, unreadable int, err error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+dropColumns+`
+			  FROM quantum_drops WHERE embedding IS NULL AND id > $1
+			  ORDER BY id LIMIT $2`, after, batchSize)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to list unindexed drops: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		drop, err := scanDrop(rows)
+		if drop.ID != "" {
+			last = drop.ID
+		}
+		if err != nil {
+			logger.WithError(err).WithField("drop_id", drop.ID).Warn("Failed to read drop for indexing")
+			unreadable++
+			continue
+		}
+		drops = append(drops, drop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", 0, fmt.Errorf("failed to list unindexed drops: %w", err)
+	}
+	return drops, last, unreadable, nil
+}
+
+// SemanticMatch is a drop found by semantic search
+type SemanticMatch struct {
+	QuantumDrop
+	Similarity float64 `json:"similarity"`
+}
+
+// scoredRow scans a drop selected with dropColumns followed by its
+// similarity
+type scoredRow struct {
+	rows       *sql.Rows
+	similarity *float64
+}
+
+func (r scoredRow) Scan(dest ...interface{}) error {
+	return r.rows.Scan(append(dest, r.similarity)...)
+}
+
+// Search returns the topK drops most similar to query, optionally only
+// those of one type or stage. Only drops embedded by the same model as the
+// query are compared.
+func (s *SemanticIndex) Search(ctx context.Context, query, dropType, stage string, topK int) ([]SemanticMatch, string, error) {
+	if !s.Available() {
+		return nil, "", errSemanticUnavailable
+	}
+	embeddings, err := s.client.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errEmbedQuery, err)
+	}
+
+	sqlQuery := `SELECT ` + dropColumns + `, 1 - (embedding <=> $1::vector) AS similarity
+			  FROM quantum_drops WHERE embedding IS NOT NULL AND embedding_model = $2`
+	args := []interface{}{vectorLiteral(embeddings.Vectors[0]), embeddings.Model}
+	if dropType != "" {
+		args = append(args, dropType)
+		sqlQuery += fmt.Sprintf(" AND type = $%d", len(args))
+	}
+	if stage != "" {
+		args = append(args, stage)
+		sqlQuery += fmt.Sprintf(" AND stage = $%d", len(args))
+	}
+	args = append(args, topK)
+	sqlQuery += fmt.Sprintf(" ORDER BY embedding <=> $1::vector LIMIT $%d", len(args))
+
+	rows, err := db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to search drops: %w", err)
+	}
+	defer rows.Close()
+	matches := []SemanticMatch{}
+	for rows.Next() {
+		var match SemanticMatch
+		match.QuantumDrop, err = scanDrop(scoredRow{rows: rows, similarity: &match.Similarity})
+		if errors.Is(err, errDecrypt) {
+			return nil, "", err
+		}
+		if err != nil {
+			continue
+		}
+		matches = append(matches, match)
+	}
+	return matches, embeddings.Model, rows.Err()
+}
+
+// semanticSearchDrops finds the drops whose artifacts are closest in
+// meaning to q. top_k bounds the results; type and stage filter them.
+func semanticSearchDrops(c *gin.Context) {
+	if !semantic.Available() {
+		apierror.RespondError(c, apierror.NotImplemented(semantic.unavailableReason()))
+		return
+	}
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		apierror.RespondError(c, apierror.Validation("q is required"))
+		return
+	}
+	topK := DefaultSemanticTopK
+	if raw := c.Query("top_k"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > MaxSemanticTopK {
+			apierror.RespondError(c, apierror.Validation(fmt.Sprintf("top_k must be between 1 and %d", MaxSemanticTopK)))
+			return
+		}
+		topK = n
+	}
+
+	ctx := logging.WithRequestID(c.Request.Context(), c.GetString(logging.RequestIDKey))
+	matches, model, err := semantic.Search(ctx, query, c.Query("type"), c.Query("stage"), topK)
+	switch {
+	case errors.Is(err, errDecrypt):
+		respondDropError(c, err)
+		return
+	case errors.Is(err, errEmbedQuery):
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to embed search query")
+		apierror.RespondError(c, apierror.Upstream("Failed to embed the query").WithDetails(err.Error()))
+		return
+	case err != nil:
+		logging.ForRequest(logger, c).WithError(err).Error("Semantic search failed")
+		apierror.RespondError(c, apierror.Internal("Failed to search drops"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   query,
+		"model":   model,
+		"results": matches,
+		"count":   len(matches),
+	})
+}
+
+// backfillSemanticIndex indexes existing drops that have no embedding yet.
+// batch_size drops are embedded per request; max_batches bounds the run,
+// which resumes from the returned next_after when passed back as after.
+func backfillSemanticIndex(c *gin.Context) {
+	if !semantic.Available() {
+		apierror.RespondError(c, apierror.NotImplemented(semantic.unavailableReason()))
+		return
+	}
+	batchSize := DefaultBackfillBatchSize
+	if raw := c.Query("batch_size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxBackfillBatchSize {
+			apierror.RespondError(c, apierror.Validation(fmt.Sprintf("batch_size must be between 1 and %d", maxBackfillBatchSize)))
+			return
+		}
+		batchSize = n
+	}
+	maxBatches := 0
+	if raw := c.Query("max_batches"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			apierror.RespondError(c, apierror.Validation("max_batches must be a non-negative integer"))
+			return
+		}
+		maxBatches = n
+	}
+
+	report, err := semantic.Backfill(c.Request.Context(), c.Query("after"), batchSize, maxBatches)
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to backfill the semantic index")
+		apierror.RespondError(c, apierror.Internal("Failed to backfill the semantic index").WithDetails(report))
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
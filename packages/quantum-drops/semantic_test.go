@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// embeddingsServer fakes the llm-router, embedding each input with embed
+// and recording the requests it got
+type embeddingsServer struct {
+	embed  func(input string) []float32
+	status int
+
+	mu       sync.Mutex
+	requests []embeddingsRequest
+}
+
+func (s *embeddingsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req embeddingsRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+	if s.status != 0 {
+		http.Error(w, `{"error": "all embedding providers failed"}`, s.status)
+		return
+	}
+
+	var resp struct {
+		Model string                   `json:"model"`
+		Data  []map[string]interface{} `json:"data"`
+	}
+	resp.Model = "test-embed"
+	for i, input := range req.Input {
+		resp.Data = append(resp.Data, map[string]interface{}{"index": i, "embedding": s.embed(input)})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// useSemantic replaces the global semantic index with one embedding with
+// server, with pgvector available
+func useSemantic(t *testing.T, server *embeddingsServer) {
+	t.Helper()
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	t.Setenv("EMBEDDINGS_URL", srv.URL)
+	t.Setenv("EMBEDDINGS_PROVIDER", "azure")
+	index := NewSemanticIndex()
+	index.vectors = true
+
+	previous := semantic
+	semantic = index
+	t.Cleanup(func() { semantic = previous })
+}
+
+func semanticRequest(method, path string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/api/v1/drops/semantic-search", semanticSearchDrops)
+	router.POST("/api/v1/admin/semantic-index/backfill", backfillSemanticIndex)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+var (
+	semanticSearchPattern = regexp.QuoteMeta("1 - (embedding <=> $1::vector) AS similarity")
+	storeEmbeddingPattern = regexp.QuoteMeta("UPDATE quantum_drops SET embedding = $1::vector, embedding_model = $2 WHERE id = $3")
+	unindexedPattern      = regexp.QuoteMeta("FROM quantum_drops WHERE embedding IS NULL AND id > $1")
+)
+
+func TestChunkArtifact(t *testing.T) {
+	tests := []struct {
+		name     string
+		artifact string
+		chunks   int
+		last     int
+	}{
+		{"empty", "  \n", 0, 0},
+		{"short", "func main() {}", 1, 14},
+		{"two chunks", strings.Repeat("é", chunkRunes+10), 2, 10},
+		{"truncated", strings.Repeat("x", chunkRunes*(maxChunksPerDrop+3)), maxChunksPerDrop, chunkRunes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkArtifact(tt.artifact)
+			if len(chunks) != tt.chunks {
+				t.Fatalf("%d chunks, want %d", len(chunks), tt.chunks)
+			}
+			if tt.chunks > 0 {
+				if got := len([]rune(chunks[len(chunks)-1])); got != tt.last {
+					t.Errorf("last chunk has %d runes, want %d", got, tt.last)
+				}
+			}
+		})
+	}
+}
+
+func TestPoolVectors(t *testing.T) {
+	pooled := poolVectors([][]float32{{3, 0}, {0, 4}, {1, 2, 3}})
+	want := []float32{3 / 5.0, 4 / 5.0}
+	for i := range want {
+		if math.Abs(float64(pooled[i]-want[i])) > 1e-6 {
+			t.Fatalf("pooled = %v, want %v", pooled, want)
+		}
+	}
+	if got := vectorLiteral([]float32{0.5, -1, 2e-3}); got != "[0.5,-1,0.002]" {
+		t.Errorf("vectorLiteral = %s", got)
+	}
+}
+
+func TestSemanticSearchUnavailable(t *testing.T) {
+	previous := semantic
+	t.Cleanup(func() { semantic = previous })
+
+	t.Setenv("EMBEDDINGS_URL", "")
+	semantic = NewSemanticIndex()
+	semantic.vectors = true
+	w := semanticRequest(http.MethodGet, "/api/v1/drops/semantic-search?q=payments")
+	if w.Code != http.StatusNotImplemented || !strings.Contains(w.Body.String(), "EMBEDDINGS_URL") {
+		t.Errorf("without embeddings: status %d, body %s; want 501", w.Code, w.Body.String())
+	}
+
+	t.Setenv("EMBEDDINGS_URL", "http://llm-router:8080")
+	semantic = NewSemanticIndex()
+	for _, path := range []string{"/api/v1/drops/semantic-search?q=payments", "/api/v1/admin/semantic-index/backfill"} {
+		method := http.MethodGet
+		if strings.Contains(path, "backfill") {
+			method = http.MethodPost
+		}
+		w := semanticRequest(method, path)
+		if w.Code != http.StatusNotImplemented || !strings.Contains(w.Body.String(), "pgvector") {
+			t.Errorf("%s without pgvector: status %d, body %s; want 501", path, w.Code, w.Body.String())
+		}
+	}
+
+	// Drops stored meanwhile aren't sent anywhere
+	semantic.IndexAsync(QuantumDrop{ID: "drop-1", Artifact: "code"})
+	semantic.pending.Wait()
+}
+
+func TestSemanticSearch(t *testing.T) {
+	server := &embeddingsServer{embed: func(string) []float32 { return []float32{1, 0} }}
+	useSemantic(t, server)
+	mock := mockDB(t)
+
+	rows := sqlmock.NewRows(append(storedDropColumns, "similarity")).
+		AddRow("drop-1", "wf-1", "req-1", "code", "code", "func reconcile() {}", nil, 1, time.Now(), false, nil, nil, nil, 0.92).
+		AddRow("drop-2", "wf-2", "req-2", "code", "code", "func pay() {}", nil, 1, time.Now(), false, nil, nil, nil, 0.71)
+	mock.ExpectQuery(semanticSearchPattern+".*"+regexp.QuoteMeta("AND embedding_model = $2 AND type = $3 AND stage = $4 ORDER BY embedding <=> $1::vector LIMIT $5")).
+		WithArgs("[1,0]", "test-embed", "code", "code", 5).
+		WillReturnRows(rows)
+
+	w := semanticRequest(http.MethodGet, "/api/v1/drops/semantic-search?q=payment+reconciliation&top_k=5&type=code&stage=code")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Model   string          `json:"model"`
+		Results []SemanticMatch `json:"results"`
+		Count   int             `json:"count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Model != "test-embed" || resp.Count != 2 || resp.Results[0].ID != "drop-1" || resp.Results[0].Similarity != 0.92 ||
+		resp.Results[0].Artifact != "func reconcile() {}" {
+		t.Errorf("response = %+v", resp)
+	}
+	if len(server.requests) != 1 || server.requests[0].Input[0] != "payment reconciliation" || server.requests[0].Provider != "azure" {
+		t.Errorf("embeddings requests = %+v", server.requests)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSemanticSearchRejectsBadQueries(t *testing.T) {
+	useSemantic(t, &embeddingsServer{embed: func(string) []float32 { return []float32{1} }})
+	mockDB(t)
+
+	for _, query := range []string{"", "?q=+", "?q=x&top_k=0", "?q=x&top_k=101", "?q=x&top_k=many"} {
+		if w := semanticRequest(http.MethodGet, "/api/v1/drops/semantic-search"+query); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestSemanticSearchEmbeddingsFailure(t *testing.T) {
+	useSemantic(t, &embeddingsServer{status: http.StatusBadGateway})
+	mockDB(t)
+
+	w := semanticRequest(http.MethodGet, "/api/v1/drops/semantic-search?q=payments")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "all embedding providers failed") {
+		t.Errorf("status = %d, body %s; want 502 with the router's error", w.Code, w.Body.String())
+	}
+}
+
+func TestIndexAsyncStoresPooledEmbedding(t *testing.T) {
+	server := &embeddingsServer{embed: func(input string) []float32 {
+		if strings.HasPrefix(input, "a") {
+			return []float32{1, 0}
+		}
+		return []float32{0, 1}
+	}}
+	useSemantic(t, server)
+	mock := mockDB(t)
+	mock.ExpectExec(storeEmbeddingPattern).
+		WithArgs("[0.70710677,0.70710677]", "test-embed", "drop-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	artifact := strings.Repeat("a", chunkRunes) + strings.Repeat("b", 10)
+	semantic.IndexAsync(QuantumDrop{ID: "drop-1", Artifact: artifact}, QuantumDrop{ID: "drop-empty"})
+	semantic.pending.Wait()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if len(server.requests) != 1 || len(server.requests[0].Input) != 2 {
+		t.Errorf("embeddings requests = %+v, want one with both chunks", server.requests)
+	}
+}
+
+func TestBackfillSemanticIndex(t *testing.T) {
+	server := &embeddingsServer{embed: func(string) []float32 { return []float32{0, 1} }}
+	useSemantic(t, server)
+	mock := mockDB(t)
+
+	mock.ExpectQuery(unindexedPattern).WithArgs("", 2).WillReturnRows(
+		storedDropRow(t, storedDropRow(t, sqlmock.NewRows(storedDropColumns), nil, "a", "first"), nil, "b", " "))
+	mock.ExpectExec(storeEmbeddingPattern).WithArgs("[0,1]", "test-embed", "a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(unindexedPattern).WithArgs("b", 2).WillReturnRows(
+		storedDropRow(t, sqlmock.NewRows(storedDropColumns), nil, "c", "third"))
+	mock.ExpectExec(storeEmbeddingPattern).WithArgs("[0,1]", "test-embed", "c").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(unindexedPattern).WithArgs("c", 2).WillReturnRows(sqlmock.NewRows(storedDropColumns))
+
+	w := semanticRequest(http.MethodPost, "/api/v1/admin/semantic-index/backfill?batch_size=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var report BackfillReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report != (BackfillReport{Indexed: 2, Skipped: 1, Batches: 2, Done: true}) {
+		t.Errorf("report = %+v", report)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackfillSemanticIndexResumes(t *testing.T) {
+	useSemantic(t, &embeddingsServer{status: http.StatusServiceUnavailable})
+	mock := mockDB(t)
+	mock.ExpectQuery(unindexedPattern).WithArgs("a", 1).WillReturnRows(
+		storedDropRow(t, sqlmock.NewRows(storedDropColumns), nil, "b", "second"))
+
+	w := semanticRequest(http.MethodPost, "/api/v1/admin/semantic-index/backfill?batch_size=1&max_batches=1&after=a")
+	var report BackfillReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || report != (BackfillReport{Failed: 1, Batches: 1, NextAfter: "b"}) {
+		t.Errorf("status = %d, report = %+v; want the failed batch skipped and the run resumable after it", w.Code, report)
+	}
+
+	if w := semanticRequest(http.MethodPost, "/api/v1/admin/semantic-index/backfill?batch_size=33"); w.Code != http.StatusBadRequest {
+		t.Errorf("oversized batch: status = %d, want 400", w.Code)
+	}
+}
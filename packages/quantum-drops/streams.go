@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DefaultStreamHeartbeat       = 30 * time.Second
+	DefaultMaxStreamsPerWorkflow = 20
+
+	// dropEventsChannel is the PostgreSQL channel stored drops are
+	// announced on
+	dropEventsChannel = "quantum_drop_events"
+
+	// streamBuffer is how many events a stream holds for a slow client
+	// before it falls back to reading the drops again
+	streamBuffer = 64
+
+	// listenerPingInterval is how long the listener goes without
+	// notifications before checking its connection
+	listenerPingInterval = 90 * time.Second
+)
+
+var errTooManyStreams = errors.New("too many streams for workflow")
+
+var streamConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "quantum_drops_stream_connections",
+	Help: "Open drop event streams",
+})
+
+func init() {
+	prometheus.MustRegister(streamConnections)
+}
+
+// DropEvent summarizes a stored drop for stream clients, without its
+// artifact
+type DropEvent struct {
+	ID         string    `json:"id"`
+	WorkflowID string    `json:"workflow_id"`
+	RequestID  string    `json:"request_id"`
+	Stage      string    `json:"stage"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	Size       int       `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newDropEvent(drop QuantumDrop) DropEvent {
+	return DropEvent{
+		ID:         drop.ID,
+		WorkflowID: drop.WorkflowID,
+		RequestID:  drop.RequestID,
+		Stage:      drop.Stage,
+		Type:       drop.Type,
+		Version:    drop.Version,
+		Size:       len(drop.Artifact),
+		CreatedAt:  drop.CreatedAt,
+	}
+}
+
+// notifyDrop announces a stored drop to every replica's streams. Within a
+// transaction PostgreSQL holds the notification until commit.
+func notifyDrop(exec dbExecer, drop QuantumDrop) error {
+	payload, err := json.Marshal(newDropEvent(drop))
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec(`SELECT pg_notify($1, $2)`, dropEventsChannel, string(payload))
+	return err
+}
+
+// dropStream is one client following a workflow's drops
+type dropStream struct {
+	workflowID string
+	events     chan DropEvent
+	// resync asks the client's handler to read the workflow's drops again
+	// after events may have been missed
+	resync chan struct{}
+}
+
+func (s *dropStream) requestResync() {
+	select {
+	case s.resync <- struct{}{}:
+	default:
+	}
+}
+
+// DropStreamHub fans drop notifications out to the streams following each
+// workflow
+type DropStreamHub struct {
+	maxPerWorkflow int
+	heartbeat      time.Duration
+
+	mu      sync.Mutex
+	streams map[string]map[*dropStream]struct{}
+}
+
+// NewDropStreamHub creates a hub configured from
+// DROP_STREAM_MAX_PER_WORKFLOW and DROP_STREAM_HEARTBEAT_SECONDS
+func NewDropStreamHub() *DropStreamHub {
+	maxPerWorkflow := DefaultMaxStreamsPerWorkflow
+	if v := os.Getenv("DROP_STREAM_MAX_PER_WORKFLOW"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxPerWorkflow = n
+		}
+	}
+
+	heartbeat := DefaultStreamHeartbeat
+	if v := os.Getenv("DROP_STREAM_HEARTBEAT_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			heartbeat = time.Duration(n) * time.Second
+		}
+	}
+
+	return &DropStreamHub{
+		maxPerWorkflow: maxPerWorkflow,
+		heartbeat:      heartbeat,
+		streams:        make(map[string]map[*dropStream]struct{}),
+	}
+}
+
+var dropStreams = NewDropStreamHub()
+
+func (h *DropStreamHub) subscribe(workflowID string) (*dropStream, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	streams := h.streams[workflowID]
+	if len(streams) >= h.maxPerWorkflow {
+		return nil, errTooManyStreams
+	}
+	if streams == nil {
+		streams = make(map[*dropStream]struct{})
+		h.streams[workflowID] = streams
+	}
+	stream := &dropStream{
+		workflowID: workflowID,
+		events:     make(chan DropEvent, streamBuffer),
+		resync:     make(chan struct{}, 1),
+	}
+	streams[stream] = struct{}{}
+	streamConnections.Inc()
+	return stream, nil
+}
+
+func (h *DropStreamHub) unsubscribe(stream *dropStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	streams := h.streams[stream.workflowID]
+	if _, ok := streams[stream]; !ok {
+		return
+	}
+	delete(streams, stream)
+	if len(streams) == 0 {
+		delete(h.streams, stream.workflowID)
+	}
+	streamConnections.Dec()
+}
+
+// publish hands an event to the workflow's streams. A stream whose buffer
+// is full is told to resync rather than holding up the others.
+func (h *DropStreamHub) publish(event DropEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for stream := range h.streams[event.WorkflowID] {
+		select {
+		case stream.events <- event:
+		default:
+			stream.requestResync()
+		}
+	}
+}
+
+// resyncAll tells every stream to read its drops again
+func (h *DropStreamHub) resyncAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, streams := range h.streams {
+		for stream := range streams {
+			stream.requestResync()
+		}
+	}
+}
+
+// Listen receives drop notifications on a dedicated connection and
+// publishes them until the process exits. The listener reconnects on its
+// own; streams resync after a reconnection since notifications sent in
+// between are lost.
+func (h *DropStreamHub) Listen(connStr string) error {
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.WithError(err).Warn("Drop event listener error")
+		}
+	})
+	if err := listener.Listen(dropEventsChannel); err != nil {
+		listener.Close()
+		return err
+	}
+	go h.run(listener.Notify, listener.Ping)
+	return nil
+}
+
+func (h *DropStreamHub) run(notifications <-chan *pq.Notification, ping func() error) {
+	for {
+		select {
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			if n == nil {
+				h.resyncAll()
+				continue
+			}
+			var event DropEvent
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				logger.WithError(err).Warn("Ignoring malformed drop event")
+				continue
+			}
+			h.publish(event)
+		case <-time.After(listenerPingInterval):
+			go ping()
+		}
+	}
+}
+
+// workflowDropEvents lists a workflow's drops as events, oldest first
+func workflowDropEvents(workflowID string) ([]DropEvent, error) {
+	rows, err := db.Query(`SELECT id, workflow_id, request_id, stage, type, version, created_at, `+artifactSizeColumn+`
+			  FROM quantum_drops WHERE workflow_id = $1 ORDER BY created_at ASC, id ASC`, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []DropEvent{}
+	for rows.Next() {
+		var event DropEvent
+		if err := rows.Scan(&event.ID, &event.WorkflowID, &event.RequestID, &event.Stage, &event.Type,
+			&event.Version, &event.CreatedAt, &event.Size); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// writeEvent writes one Server-Sent Event and flushes it to the client
+func writeEvent(c *gin.Context, id, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(c.Writer, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// streamWorkflowDrops follows a workflow's drops as Server-Sent Events. The
+// drops stored so far are replayed as "drop" events, then "ready" marks the
+// end of the replay and each new drop follows as another "drop" event.
+// "heartbeat" events keep idle connections open. Workflows without drops
+// can be followed before their first drop is stored.
+func streamWorkflowDrops(c *gin.Context) {
+	workflowID := c.Param("workflow_id")
+
+	// Subscribe before reading the drops so none stored in between is missed
+	stream, err := dropStreams.subscribe(workflowID)
+	if err != nil {
+		apierror.RespondError(c, apierror.New(apierror.CodeRateLimited,
+			fmt.Sprintf("At most %d streams can follow a workflow", dropStreams.maxPerWorkflow)))
+		return
+	}
+	defer dropStreams.unsubscribe(stream)
+
+	existing, err := workflowDropEvents(workflowID)
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to retrieve drops"))
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	seen := make(map[string]bool)
+	send := func(events []DropEvent) error {
+		for _, event := range events {
+			if seen[event.ID] {
+				continue
+			}
+			seen[event.ID] = true
+			if err := writeEvent(c, event.ID, "drop", event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := send(existing); err != nil {
+		return
+	}
+	if err := writeEvent(c, "", "ready", gin.H{"workflow_id": workflowID, "replayed": len(existing)}); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(dropStreams.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event := <-stream.events:
+			err = send([]DropEvent{event})
+		case <-stream.resync:
+			events, queryErr := workflowDropEvents(workflowID)
+			if queryErr != nil {
+				logging.ForRequest(logger, c).WithError(queryErr).WithField("workflow_id", workflowID).Error("Failed to resync drop stream")
+				continue
+			}
+			err = send(events)
+		case now := <-heartbeat.C:
+			err = writeEvent(c, "", "heartbeat", gin.H{"time": now.UTC()})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var (
+	dropEventColumns  = []string{"id", "workflow_id", "request_id", "stage", "type", "version", "created_at", "size"}
+	dropEventsPattern = regexp.QuoteMeta("FROM quantum_drops WHERE workflow_id = $1 ORDER BY created_at ASC, id ASC")
+)
+
+// sseEvent is one Server-Sent Event read by a test client
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// useTestHub swaps in a hub with a short heartbeat for one test
+func useTestHub(t *testing.T, maxPerWorkflow int, heartbeat time.Duration) *DropStreamHub {
+	t.Helper()
+	hub := &DropStreamHub{
+		maxPerWorkflow: maxPerWorkflow,
+		heartbeat:      heartbeat,
+		streams:        make(map[string]map[*dropStream]struct{}),
+	}
+	previous := dropStreams
+	dropStreams = hub
+	t.Cleanup(func() { dropStreams = previous })
+	return hub
+}
+
+func streamServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	router := gin.New()
+	router.GET("/api/v1/workflows/:workflow_id/drops", getWorkflowDrops)
+	router.GET("/api/v1/workflows/:workflow_id/drops/stream", streamWorkflowDrops)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openStream connects to a workflow's stream and delivers its events on the
+// returned channel until the test ends
+func openStream(t *testing.T, server *httptest.Server, workflowID string) (*http.Response, <-chan sseEvent) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/workflows/"+workflowID+"/drops/stream", nil)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var event sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				events <- event
+				event = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return resp, events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return sseEvent{}
+}
+
+// waitForStreams waits until the hub has n streams for the workflow
+func waitForStreams(t *testing.T, hub *DropStreamHub, workflowID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hub.mu.Lock()
+		got := len(hub.streams[workflowID])
+		hub.mu.Unlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("workflow %s has %d streams, want %d", workflowID, got, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStreamReplaysAndFollowsDrops(t *testing.T) {
+	hub := useTestHub(t, 5, time.Hour)
+	mock := mockDB(t)
+	created := time.Date(2024, 9, 5, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(dropEventsPattern).WithArgs("wf-1").
+		WillReturnRows(sqlmock.NewRows(dropEventColumns).
+			AddRow("drop-1", "wf-1", "req-1", "prompt_enhancement", "prompt", 1, created, 120).
+			AddRow("drop-2", "wf-1", "req-1", "frd_generation", "frd", 1, created.Add(time.Second), 800))
+
+	server := streamServer(t)
+	resp, events := openStream(t, server, "wf-1")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	for _, want := range []string{"drop-1", "drop-2"} {
+		event := nextEvent(t, events)
+		var drop DropEvent
+		json.Unmarshal([]byte(event.Data), &drop)
+		if event.Event != "drop" || event.ID != want || drop.ID != want || drop.WorkflowID != "wf-1" {
+			t.Errorf("replayed %+v, want drop %s", event, want)
+		}
+	}
+	if event := nextEvent(t, events); event.Event != "ready" || !strings.Contains(event.Data, `"replayed":2`) {
+		t.Errorf("got %+v, want ready after 2 drops", event)
+	}
+	if got := testutil.ToFloat64(streamConnections); got < 1 {
+		t.Errorf("stream connections = %v, want at least 1", got)
+	}
+
+	// Replayed drops aren't sent twice; new drops and other workflows'
+	// drops are told apart
+	hub.publish(DropEvent{ID: "drop-2", WorkflowID: "wf-1"})
+	hub.publish(DropEvent{ID: "drop-x", WorkflowID: "wf-2"})
+	hub.publish(DropEvent{ID: "drop-3", WorkflowID: "wf-1", Stage: "code_generation", Size: 4096})
+	event := nextEvent(t, events)
+	var drop DropEvent
+	json.Unmarshal([]byte(event.Data), &drop)
+	if event.ID != "drop-3" || drop.Stage != "code_generation" || drop.Size != 4096 {
+		t.Errorf("got %+v, want drop-3", event)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	resp.Body.Close()
+	waitForStreams(t, hub, "wf-1", 0)
+}
+
+func TestStreamForUnknownWorkflowWaitsForDrops(t *testing.T) {
+	hub := useTestHub(t, 5, 20*time.Millisecond)
+	mock := mockDB(t)
+	mock.ExpectQuery(dropEventsPattern).WithArgs("wf-new").WillReturnRows(sqlmock.NewRows(dropEventColumns))
+
+	_, events := openStream(t, streamServer(t), "wf-new")
+	if event := nextEvent(t, events); event.Event != "ready" || !strings.Contains(event.Data, `"replayed":0`) {
+		t.Fatalf("got %+v, want ready without drops", event)
+	}
+	if event := nextEvent(t, events); event.Event != "heartbeat" {
+		t.Errorf("got %+v, want a heartbeat while idle", event)
+	}
+
+	hub.publish(DropEvent{ID: "drop-1", WorkflowID: "wf-new"})
+	for {
+		event := nextEvent(t, events)
+		if event.Event == "heartbeat" {
+			continue
+		}
+		if event.Event != "drop" || event.ID != "drop-1" {
+			t.Errorf("got %+v, want the first drop", event)
+		}
+		break
+	}
+}
+
+func TestStreamResyncsMissedDrops(t *testing.T) {
+	hub := useTestHub(t, 5, time.Hour)
+	mock := mockDB(t)
+	created := time.Date(2024, 9, 5, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(dropEventsPattern).WithArgs("wf-1").
+		WillReturnRows(sqlmock.NewRows(dropEventColumns).
+			AddRow("drop-1", "wf-1", "req-1", "prompt_enhancement", "prompt", 1, created, 120))
+	mock.ExpectQuery(dropEventsPattern).WithArgs("wf-1").
+		WillReturnRows(sqlmock.NewRows(dropEventColumns).
+			AddRow("drop-1", "wf-1", "req-1", "prompt_enhancement", "prompt", 1, created, 120).
+			AddRow("drop-2", "wf-1", "req-1", "frd_generation", "frd", 1, created.Add(time.Second), 800))
+
+	_, events := openStream(t, streamServer(t), "wf-1")
+	nextEvent(t, events)
+	nextEvent(t, events)
+
+	// A reconnected listener may have missed notifications
+	notifications := make(chan *pq.Notification)
+	go hub.run(notifications, func() error { return nil })
+	notifications <- nil
+	close(notifications)
+
+	if event := nextEvent(t, events); event.ID != "drop-2" {
+		t.Errorf("got %+v, want the missed drop-2 only", event)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStreamLimitPerWorkflow(t *testing.T) {
+	hub := useTestHub(t, 1, time.Hour)
+	mock := mockDB(t)
+	mock.ExpectQuery(dropEventsPattern).WithArgs("wf-1").WillReturnRows(sqlmock.NewRows(dropEventColumns))
+
+	server := streamServer(t)
+	_, events := openStream(t, server, "wf-1")
+	nextEvent(t, events)
+
+	resp, err := server.Client().Get(server.URL + "/api/v1/workflows/wf-1/drops/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second stream status = %d, want 429", resp.StatusCode)
+	}
+	waitForStreams(t, hub, "wf-1", 1)
+}
+
+func TestListenerPublishesNotifications(t *testing.T) {
+	hub := useTestHub(t, 5, time.Hour)
+	stream, err := hub.subscribe("wf-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hub.unsubscribe(stream)
+
+	payload, _ := json.Marshal(newDropEvent(QuantumDrop{ID: "drop-1", WorkflowID: "wf-1", Stage: "code", Artifact: "package main"}))
+	notifications := make(chan *pq.Notification, 2)
+	notifications <- &pq.Notification{Channel: dropEventsChannel, Extra: "not json"}
+	notifications <- &pq.Notification{Channel: dropEventsChannel, Extra: string(payload)}
+	close(notifications)
+	hub.run(notifications, func() error { return nil })
+
+	select {
+	case event := <-stream.events:
+		if event.ID != "drop-1" || event.Size != len("package main") {
+			t.Errorf("event = %+v", event)
+		}
+	default:
+		t.Fatal("notification wasn't published")
+	}
+}
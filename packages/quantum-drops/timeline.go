@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// TimelineStage is one stage of a workflow's timeline: a run of consecutive
+// drops stored for the same stage. A stage revisited later, after a
+// rollback for instance, appears again.
+type TimelineStage struct {
+	Stage       string    `json:"stage"`
+	Types       []string  `json:"types"`
+	Drops       int       `json:"drops"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+
+	// ElapsedMs is the time from the previous stage's last drop to this
+	// stage's first, roughly how long the stage took to produce; OffsetMs
+	// is the time since the workflow's first drop
+	ElapsedMs int64 `json:"elapsed_ms"`
+	OffsetMs  int64 `json:"offset_ms"`
+
+	ArtifactSize   int `json:"artifact_size"`
+	CumulativeSize int `json:"cumulative_size"`
+}
+
+// WorkflowTimeline is a workflow's journey through its stages
+type WorkflowTimeline struct {
+	WorkflowID        string          `json:"workflow_id"`
+	TotalDrops        int             `json:"total_drops"`
+	StartedAt         time.Time       `json:"started_at"`
+	CompletedAt       time.Time       `json:"completed_at"`
+	TotalDurationMs   int64           `json:"total_duration_ms"`
+	TotalArtifactSize int             `json:"total_artifact_size"`
+	Stages            []TimelineStage `json:"stages"`
+}
+
+func getWorkflowTimeline(c *gin.Context) {
+	workflowID := c.Param("workflow_id")
+
+	query := `SELECT id, stage, type, created_at, ` + artifactSizeColumn + ` as size
+			  FROM quantum_drops WHERE workflow_id = $1 ORDER BY created_at ASC, id ASC`
+
+	rows, err := db.Query(query, workflowID)
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to retrieve timeline"))
+		return
+	}
+	defer rows.Close()
+
+	drops := []DropSummary{}
+	for rows.Next() {
+		var drop DropSummary
+		if err := rows.Scan(&drop.ID, &drop.Stage, &drop.Type, &drop.CreatedAt, &drop.Size); err != nil {
+			continue
+		}
+		drops = append(drops, drop)
+	}
+	if err := rows.Err(); err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to retrieve timeline"))
+		return
+	}
+	if len(drops) == 0 {
+		apierror.RespondError(c, apierror.NotFound("No drops found for workflow"))
+		return
+	}
+
+	c.JSON(http.StatusOK, buildTimeline(workflowID, drops))
+}
+
+// buildTimeline groups drops, oldest first, into stages
+func buildTimeline(workflowID string, drops []DropSummary) WorkflowTimeline {
+	timeline := WorkflowTimeline{
+		WorkflowID: workflowID,
+		TotalDrops: len(drops),
+		Stages:     []TimelineStage{},
+	}
+	if len(drops) == 0 {
+		return timeline
+	}
+	timeline.StartedAt = drops[0].CreatedAt
+
+	var current *TimelineStage
+	var previousEnd time.Time
+	for _, drop := range drops {
+		if current == nil || current.Stage != drop.Stage {
+			if current != nil {
+				previousEnd = current.CompletedAt
+			}
+			stage := TimelineStage{
+				Stage:     drop.Stage,
+				Types:     []string{},
+				StartedAt: drop.CreatedAt,
+				OffsetMs:  drop.CreatedAt.Sub(timeline.StartedAt).Milliseconds(),
+			}
+			if !previousEnd.IsZero() {
+				stage.ElapsedMs = drop.CreatedAt.Sub(previousEnd).Milliseconds()
+			}
+			timeline.Stages = append(timeline.Stages, stage)
+			current = &timeline.Stages[len(timeline.Stages)-1]
+		}
+
+		current.Drops++
+		current.CompletedAt = drop.CreatedAt
+		if !containsString(current.Types, drop.Type) {
+			current.Types = append(current.Types, drop.Type)
+		}
+		current.ArtifactSize += drop.Size
+		timeline.TotalArtifactSize += drop.Size
+		current.CumulativeSize = timeline.TotalArtifactSize
+	}
+
+	timeline.CompletedAt = drops[len(drops)-1].CreatedAt
+	timeline.TotalDurationMs = timeline.CompletedAt.Sub(timeline.StartedAt).Milliseconds()
+	return timeline
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
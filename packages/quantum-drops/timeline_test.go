@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+var timelineColumns = []string{"id", "stage", "type", "created_at", "size"}
+
+func getTimeline(workflowID string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/api/v1/workflows/:workflow_id/timeline", getWorkflowTimeline)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/workflows/"+workflowID+"/timeline", nil))
+	return w
+}
+
+func TestWorkflowTimeline(t *testing.T) {
+	mock := mockDB(t)
+	start := time.Date(2024, 9, 5, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM quantum_drops WHERE workflow_id = $1 ORDER BY created_at ASC")).
+		WithArgs("wf-1").
+		WillReturnRows(sqlmock.NewRows(timelineColumns).
+			AddRow("drop-1", "prompt_enhancement", "prompt", start, 100).
+			AddRow("drop-2", "frd_generation", "frd", start.Add(2*time.Second), 400).
+			AddRow("drop-3", "code_generation", "code", start.Add(7*time.Second), 1000).
+			AddRow("drop-4", "code_generation", "files", start.Add(8*time.Second), 500).
+			AddRow("drop-5", "test_generation", "tests", start.Add(11500*time.Millisecond), 300))
+
+	w := getTimeline("wf-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var timeline WorkflowTimeline
+	if err := json.Unmarshal(w.Body.Bytes(), &timeline); err != nil {
+		t.Fatal(err)
+	}
+
+	if timeline.TotalDrops != 5 || timeline.TotalArtifactSize != 2300 || timeline.TotalDurationMs != 11500 {
+		t.Errorf("totals = %d drops, %d bytes, %dms; want 5, 2300, 11500",
+			timeline.TotalDrops, timeline.TotalArtifactSize, timeline.TotalDurationMs)
+	}
+
+	type stageSummary struct {
+		Stage          string
+		Types          []string
+		Drops          int
+		ElapsedMs      int64
+		OffsetMs       int64
+		ArtifactSize   int
+		CumulativeSize int
+	}
+	want := []stageSummary{
+		{"prompt_enhancement", []string{"prompt"}, 1, 0, 0, 100, 100},
+		{"frd_generation", []string{"frd"}, 1, 2000, 2000, 400, 500},
+		{"code_generation", []string{"code", "files"}, 2, 5000, 7000, 1500, 2000},
+		{"test_generation", []string{"tests"}, 1, 3500, 11500, 300, 2300},
+	}
+	var got []stageSummary
+	for _, stage := range timeline.Stages {
+		got = append(got, stageSummary{stage.Stage, stage.Types, stage.Drops, stage.ElapsedMs,
+			stage.OffsetMs, stage.ArtifactSize, stage.CumulativeSize})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stages =\n%+v\nwant\n%+v", got, want)
+	}
+	if code := timeline.Stages[2]; !code.StartedAt.Equal(start.Add(7*time.Second)) || !code.CompletedAt.Equal(start.Add(8*time.Second)) {
+		t.Errorf("code_generation ran %s to %s", code.StartedAt, code.CompletedAt)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuildTimelineRevisitedStage(t *testing.T) {
+	start := time.Date(2024, 9, 5, 10, 0, 0, 0, time.UTC)
+	timeline := buildTimeline("wf-1", []DropSummary{
+		{ID: "drop-1", Stage: "code_generation", Type: "code", CreatedAt: start, Size: 10},
+		{ID: "drop-2", Stage: "test_generation", Type: "tests", CreatedAt: start.Add(time.Second), Size: 20},
+		{ID: "drop-3", Stage: "code_generation", Type: "code", CreatedAt: start.Add(4 * time.Second), Size: 30},
+	})
+
+	var stages []string
+	for _, stage := range timeline.Stages {
+		stages = append(stages, stage.Stage)
+	}
+	if want := []string{"code_generation", "test_generation", "code_generation"}; !reflect.DeepEqual(stages, want) {
+		t.Fatalf("stages = %v, want %v", stages, want)
+	}
+	if last := timeline.Stages[2]; last.ElapsedMs != 3000 || last.CumulativeSize != 60 {
+		t.Errorf("revisited stage elapsed %dms with %d bytes so far, want 3000ms and 60", last.ElapsedMs, last.CumulativeSize)
+	}
+}
+
+func TestWorkflowTimelineNotFound(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM quantum_drops")).
+		WithArgs("wf-missing").
+		WillReturnRows(sqlmock.NewRows(timelineColumns))
+
+	if w := getTimeline("wf-missing"); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestWorkflowTimelineQueryError(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM quantum_drops")).WillReturnError(errors.New("connection refused"))
+
+	if w := getTimeline("wf-1"); w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/webhook"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultWebhookMaxAttempts = 5
+	DefaultWebhookBackoff     = 2 * time.Second
+	DefaultWebhookMaxBackoff  = time.Minute
+	DefaultWebhookTimeout     = 10 * time.Second
+)
+
+// WebhookEventRollback is sent after a workflow is rolled back to a drop
+const WebhookEventRollback = "drop.rollback"
+
+// WebhookSubscription receives the listed events, or every event when
+// Events is empty
+type WebhookSubscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateWebhookRequest represents a webhook subscription request
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// WebhookEnvelope is the body of every delivery. ID stays the same across
+// retries and redeliveries so receivers can deduplicate.
+type WebhookEnvelope struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// DeadLetter is a delivery that failed permanently and can be redelivered
+type DeadLetter struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	URL            string          `json:"url"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error"`
+	LastStatus     int             `json:"last_status,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	FailedAt       time.Time       `json:"failed_at"`
+	RedeliveredAt  *time.Time      `json:"redelivered_at,omitempty"`
+}
+
+// WebhookDispatcher delivers events to subscribers with bounded retries and
+// exponential backoff, and dead-letters deliveries that never succeed
+type WebhookDispatcher struct {
+	sender *webhook.Sender
+}
+
+// NewWebhookDispatcher creates a dispatcher configured from
+// WEBHOOK_MAX_ATTEMPTS and WEBHOOK_BACKOFF_SECONDS
+func NewWebhookDispatcher() *WebhookDispatcher {
+	maxAttempts := DefaultWebhookMaxAttempts
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxAttempts = n
+		}
+	}
+
+	backoff := DefaultWebhookBackoff
+	if v := os.Getenv("WEBHOOK_BACKOFF_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			backoff = time.Duration(n) * time.Second
+		}
+	}
+
+	return &WebhookDispatcher{
+		sender: webhook.New(webhook.Config{
+			HeaderPrefix: "X-QuantumDrops",
+			MaxAttempts:  maxAttempts,
+			Backoff:      backoff,
+			MaxBackoff:   DefaultWebhookMaxBackoff,
+			HTTPClient:   &http.Client{Timeout: DefaultWebhookTimeout},
+			OnRetry: func(d webhook.Delivery, attempt int, wait time.Duration, err error) {
+				logger.WithError(err).WithFields(logrus.Fields{
+					"delivery_id": d.ID,
+					"url":         d.URL,
+					"attempt":     attempt,
+					"retry_in":    wait.String(),
+				}).Warn("Webhook delivery failed, retrying")
+			},
+		}),
+	}
+}
+
+var webhooks = NewWebhookDispatcher()
+
+func createWebhookTables() {
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+			id VARCHAR(255) PRIMARY KEY,
+			url TEXT NOT NULL,
+			events TEXT[] NOT NULL DEFAULT '{}',
+			secret TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+			id VARCHAR(255) PRIMARY KEY,
+			subscription_id VARCHAR(255) NOT NULL,
+			url TEXT NOT NULL,
+			event VARCHAR(100) NOT NULL,
+			payload JSONB NOT NULL,
+			attempts INT NOT NULL,
+			last_error TEXT,
+			last_status INT,
+			created_at TIMESTAMP NOT NULL,
+			failed_at TIMESTAMP NOT NULL,
+			redelivered_at TIMESTAMP
+		);`,
+		"CREATE INDEX IF NOT EXISTS idx_dead_letters_pending ON webhook_dead_letters(failed_at) WHERE redelivered_at IS NULL;",
+	}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			logger.WithError(err).Warn("Failed to create webhook tables")
+		}
+	}
+}
+
+// Dispatch sends an event to every interested subscriber in the background.
+// Deliveries outlive the request but keep its ID for logging.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context, event string, data interface{}) {
+	ctx = context.WithoutCancel(ctx)
+	log := logging.FromContext(logger, ctx).WithField("event", event)
+
+	subs, err := subscriptionsFor(event)
+	if err != nil {
+		log.WithError(err).Error("Failed to load webhooks")
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+
+	envelope := WebhookEnvelope{
+		ID:        newID("evt"),
+		Event:     event,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		log.WithError(err).Error("Failed to encode webhook payload")
+		return
+	}
+
+	for _, sub := range subs {
+		go func(sub *WebhookSubscription) {
+			letter := d.deliver(ctx, sub, envelope, payload)
+			if letter == nil {
+				return
+			}
+			if err := saveDeadLetter(letter); err != nil {
+				log.WithError(err).WithField("subscription_id", sub.ID).Error("Failed to store dead letter")
+			}
+		}(sub)
+	}
+}
+
+// deliver sends a payload to one subscriber, retrying failed attempts, and
+// returns a dead letter if every attempt failed
+func (d *WebhookDispatcher) deliver(ctx context.Context, sub *WebhookSubscription, envelope WebhookEnvelope, payload []byte) *DeadLetter {
+	attempts, err := d.sender.Send(ctx, webhook.Delivery{
+		URL:    sub.URL,
+		Secret: sub.Secret,
+		Event:  envelope.Event,
+		ID:     envelope.ID,
+		Body:   payload,
+	})
+	if err == nil {
+		return nil
+	}
+
+	logging.FromContext(logger, ctx).WithError(err).WithFields(logrus.Fields{
+		"subscription_id": sub.ID,
+		"event_id":        envelope.ID,
+		"attempts":        attempts,
+	}).Warn("Webhook delivery failed, dead-lettering")
+	letter := &DeadLetter{
+		ID:             newID("dlq"),
+		SubscriptionID: sub.ID,
+		URL:            sub.URL,
+		Event:          envelope.Event,
+		Payload:        payload,
+		Attempts:       attempts,
+		LastError:      err.Error(),
+		CreatedAt:      envelope.CreatedAt,
+		FailedAt:       time.Now(),
+	}
+	var werr *webhook.Error
+	if errors.As(err, &werr) {
+		letter.LastStatus = werr.StatusCode
+	}
+	return letter
+}
+
+// subscriptionsFor returns the subscriptions that receive an event
+func subscriptionsFor(event string) ([]*WebhookSubscription, error) {
+	rows, err := db.Query(`SELECT id, url, events, COALESCE(secret, ''), created_at
+		FROM webhook_subscriptions
+		WHERE cardinality(events) = 0 OR $1 = ANY(events)`, event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+	return scanSubscriptions(rows)
+}
+
+func getSubscription(id string) (*WebhookSubscription, error) {
+	rows, err := db.Query(`SELECT id, url, events, COALESCE(secret, ''), created_at
+		FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook: %w", err)
+	}
+	defer rows.Close()
+
+	subs, err := scanSubscriptions(rows)
+	if err != nil || len(subs) == 0 {
+		return nil, err
+	}
+	return subs[0], nil
+}
+
+func scanSubscriptions(rows *sql.Rows) ([]*WebhookSubscription, error) {
+	subs := []*WebhookSubscription{}
+	for rows.Next() {
+		var sub WebhookSubscription
+		if err := rows.Scan(&sub.ID, &sub.URL, pq.Array(&sub.Events), &sub.Secret, &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read webhook: %w", err)
+		}
+		subs = append(subs, &sub)
+	}
+	return subs, rows.Err()
+}
+
+func saveDeadLetter(letter *DeadLetter) error {
+	_, err := db.Exec(`INSERT INTO webhook_dead_letters
+		(id, subscription_id, url, event, payload, attempts, last_error, last_status, created_at, failed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		letter.ID, letter.SubscriptionID, letter.URL, letter.Event, []byte(letter.Payload),
+		letter.Attempts, letter.LastError, letter.LastStatus, letter.CreatedAt, letter.FailedAt)
+	return err
+}
+
+const deadLetterColumns = `id, subscription_id, url, event, payload, attempts,
+	COALESCE(last_error, ''), COALESCE(last_status, 0), created_at, failed_at, redelivered_at`
+
+func scanDeadLetter(row interface{ Scan(...interface{}) error }) (*DeadLetter, error) {
+	var letter DeadLetter
+	var payload []byte
+	var redeliveredAt sql.NullTime
+	err := row.Scan(&letter.ID, &letter.SubscriptionID, &letter.URL, &letter.Event, &payload,
+		&letter.Attempts, &letter.LastError, &letter.LastStatus, &letter.CreatedAt, &letter.FailedAt, &redeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	letter.Payload = payload
+	if redeliveredAt.Valid {
+		letter.RedeliveredAt = &redeliveredAt.Time
+	}
+	return &letter, nil
+}
+
+// newID returns a random identifier with the given prefix
+func newID(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", prefix, time.Now().Unix(), hex.EncodeToString(b))
+}
+
+// API Handlers
+
+func createWebhook(c *gin.Context) {
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		apierror.RespondError(c, apierror.Validation("url must be an absolute http or https URL"))
+		return
+	}
+
+	sub := &WebhookSubscription{
+		ID:        newID("webhook"),
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    req.Secret,
+		CreatedAt: time.Now(),
+	}
+	if sub.Events == nil {
+		sub.Events = []string{}
+	}
+
+	_, err = db.Exec(`INSERT INTO webhook_subscriptions (id, url, events, secret, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)`,
+		sub.ID, sub.URL, pq.Array(sub.Events), sub.Secret, sub.CreatedAt)
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to save webhook").WithDetails(err.Error()))
+		return
+	}
+
+	sub.Secret = ""
+	c.JSON(http.StatusCreated, sub)
+}
+
+func listWebhooks(c *gin.Context) {
+	rows, err := db.Query(`SELECT id, url, events, '', created_at
+		FROM webhook_subscriptions ORDER BY created_at ASC`)
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to list webhooks"))
+		return
+	}
+	defer rows.Close()
+
+	subs, err := scanSubscriptions(rows)
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to list webhooks"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": subs,
+		"count":    len(subs),
+	})
+}
+
+func deleteWebhook(c *gin.Context) {
+	result, err := db.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, c.Param("id"))
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to delete webhook"))
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		apierror.RespondError(c, apierror.NotFound("Webhook not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// listDeadLetters returns failed deliveries, newest first. Redelivered ones
+// are only included with ?include_redelivered=true.
+func listDeadLetters(c *gin.Context) {
+	query := `SELECT ` + deadLetterColumns + ` FROM webhook_dead_letters WHERE 1=1`
+	args := []interface{}{}
+	argCount := 0
+
+	if c.Query("include_redelivered") != "true" {
+		query += " AND redelivered_at IS NULL"
+	}
+	if event := c.Query("event"); event != "" {
+		argCount++
+		query += fmt.Sprintf(" AND event = $%d", argCount)
+		args = append(args, event)
+	}
+	if subscriptionID := c.Query("subscription_id"); subscriptionID != "" {
+		argCount++
+		query += fmt.Sprintf(" AND subscription_id = $%d", argCount)
+		args = append(args, subscriptionID)
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		apierror.RespondError(c, apierror.Validation("limit must be a positive integer"))
+		return
+	}
+	argCount++
+	query += fmt.Sprintf(" ORDER BY failed_at DESC LIMIT $%d", argCount)
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to list dead letters"))
+		return
+	}
+	defer rows.Close()
+
+	letters := []*DeadLetter{}
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dead_letters": letters,
+		"count":        len(letters),
+	})
+}
+
+// redeliverDeadLetter makes one more delivery attempt with the original
+// payload. On success the dead letter is marked redelivered; on failure its
+// attempt count and last error are updated.
+func redeliverDeadLetter(c *gin.Context) {
+	row := db.QueryRow(`SELECT `+deadLetterColumns+` FROM webhook_dead_letters WHERE id = $1`, c.Param("id"))
+	letter, err := scanDeadLetter(row)
+	if err == sql.ErrNoRows {
+		apierror.RespondError(c, apierror.NotFound("Dead letter not found"))
+		return
+	}
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to retrieve dead letter"))
+		return
+	}
+	if letter.RedeliveredAt != nil {
+		apierror.RespondError(c, apierror.Conflict("Dead letter was already redelivered"))
+		return
+	}
+
+	sub, err := getSubscription(letter.SubscriptionID)
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Failed to load webhook"))
+		return
+	}
+	if sub == nil {
+		apierror.RespondError(c, apierror.NotFound("Webhook subscription no longer exists"))
+		return
+	}
+
+	var envelope WebhookEnvelope
+	json.Unmarshal(letter.Payload, &envelope)
+
+	delivery := webhook.Delivery{
+		URL:    sub.URL,
+		Secret: sub.Secret,
+		Event:  letter.Event,
+		ID:     envelope.ID,
+		Body:   letter.Payload,
+	}
+	if werr := webhooks.sender.Post(c.Request.Context(), delivery); werr != nil {
+		letter.Attempts++
+		letter.LastError = werr.Error()
+		letter.LastStatus = werr.StatusCode
+		letter.FailedAt = time.Now()
+		_, err := db.Exec(`UPDATE webhook_dead_letters
+			SET attempts = $2, last_error = $3, last_status = $4, failed_at = $5 WHERE id = $1`,
+			letter.ID, letter.Attempts, letter.LastError, letter.LastStatus, letter.FailedAt)
+		if err != nil {
+			logging.ForRequest(logger, c).WithError(err).WithField("dead_letter_id", letter.ID).Error("Failed to update dead letter")
+		}
+		apierror.RespondError(c, apierror.Upstream("Redelivery failed").WithDetails(letter))
+		return
+	}
+
+	now := time.Now()
+	letter.Attempts++
+	letter.RedeliveredAt = &now
+	_, err = db.Exec(`UPDATE webhook_dead_letters SET attempts = $2, redelivered_at = $3 WHERE id = $1`,
+		letter.ID, letter.Attempts, now)
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).WithField("dead_letter_id", letter.ID).Error("Failed to mark dead letter redelivered")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Redelivery successful",
+		"dead_letter": letter,
+	})
+}
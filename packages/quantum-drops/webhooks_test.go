@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/webhook"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// receiver answers with statuses in turn, repeating the last one, and
+// records the headers and body of every request
+type receiver struct {
+	statuses []int
+
+	mu       sync.Mutex
+	requests []http.Header
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.requests = append(r.requests, req.Header)
+	r.bodies = append(r.bodies, body)
+	n := len(r.requests)
+	r.mu.Unlock()
+
+	status := r.statuses[len(r.statuses)-1]
+	if n <= len(r.statuses) {
+		status = r.statuses[n-1]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	t.Helper()
+	recv := &receiver{statuses: statuses}
+	srv := httptest.NewServer(recv)
+	t.Cleanup(srv.Close)
+	return recv, srv.URL
+}
+
+// testDispatcher retries up to 3 times without sleeping
+func testDispatcher() *WebhookDispatcher {
+	return &WebhookDispatcher{
+		sender: webhook.New(webhook.Config{
+			HeaderPrefix: "X-QuantumDrops",
+			MaxAttempts:  3,
+			Sleep:        func(context.Context, time.Duration) error { return nil },
+		}),
+	}
+}
+
+// mockDB replaces the global database with a sqlmock
+func mockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	previous := db
+	db = mockDB
+	t.Cleanup(func() {
+		db = previous
+		mockDB.Close()
+	})
+	return mock
+}
+
+func testEnvelope(t *testing.T) (WebhookEnvelope, []byte) {
+	t.Helper()
+	envelope := WebhookEnvelope{
+		ID:        "evt-1",
+		Event:     WebhookEventRollback,
+		CreatedAt: time.Now(),
+		Data:      map[string]string{"workflow_id": "wf-1"},
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope, payload
+}
+
+func TestWebhookDispatcherDeliver(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantDead     bool
+		wantStatus   int
+	}{
+		{"delivered", []int{200}, 1, false, 0},
+		{"retried after server error", []int{503, 200}, 2, false, 0},
+		{"retried after rate limiting", []int{429, 429, 204}, 3, false, 0},
+		{"dead-lettered after max attempts", []int{500}, 3, true, 500},
+		{"client error is not retried", []int{410, 200}, 1, true, 410},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recv, url := newReceiver(t, tt.statuses...)
+			envelope, payload := testEnvelope(t)
+			sub := &WebhookSubscription{ID: "webhook-1", URL: url, Secret: "s3cret"}
+
+			letter := testDispatcher().deliver(context.Background(), sub, envelope, payload)
+			if recv.count() != tt.wantAttempts {
+				t.Fatalf("received %d attempts, want %d", recv.count(), tt.wantAttempts)
+			}
+			for i, header := range recv.requests {
+				if header.Get("X-QuantumDrops-Delivery") != "evt-1" || header.Get("X-QuantumDrops-Event") != WebhookEventRollback {
+					t.Fatalf("attempt %d headers = %v", i+1, header)
+				}
+				if header.Get("X-QuantumDrops-Signature") != "sha256="+webhook.Sign("s3cret", recv.bodies[i]) {
+					t.Fatalf("attempt %d is not signed with the subscription secret", i+1)
+				}
+			}
+
+			if !tt.wantDead {
+				if letter != nil {
+					t.Fatalf("dead letter = %+v, want none", letter)
+				}
+				return
+			}
+			if letter == nil {
+				t.Fatal("no dead letter for a failed delivery")
+			}
+			if letter.Attempts != tt.wantAttempts || letter.LastStatus != tt.wantStatus || letter.SubscriptionID != "webhook-1" {
+				t.Fatalf("dead letter = %+v, want %d attempts ending in %d", letter, tt.wantAttempts, tt.wantStatus)
+			}
+			if string(letter.Payload) != string(payload) {
+				t.Fatalf("dead letter payload = %s, want the original envelope", letter.Payload)
+			}
+		})
+	}
+}
+
+func TestDispatchStoresDeadLetter(t *testing.T) {
+	mock := mockDB(t)
+	_, url := newReceiver(t, http.StatusBadGateway)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_subscriptions")).
+		WithArgs(WebhookEventRollback).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "events", "secret", "created_at"}).
+			AddRow("webhook-1", url, "{drop.rollback}", "", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_dead_letters")).
+		WithArgs(sqlmock.AnyArg(), "webhook-1", url, WebhookEventRollback, sqlmock.AnyArg(),
+			3, "webhook returned status 502", http.StatusBadGateway, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	testDispatcher().Dispatch(context.Background(), WebhookEventRollback, map[string]string{"workflow_id": "wf-1"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mock.ExpectationsWereMet() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("dead letter not stored: %v", mock.ExpectationsWereMet())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var deadLetterRowColumns = []string{"id", "subscription_id", "url", "event", "payload", "attempts",
+	"last_error", "last_status", "created_at", "failed_at", "redelivered_at"}
+
+func TestRedeliverDeadLetter(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+		wantUpdate string
+		wantArgs   []driver.Value
+	}{
+		{"redelivered", http.StatusOK, http.StatusOK,
+			"SET attempts = $2, redelivered_at = $3",
+			[]driver.Value{"dlq-1", 4, sqlmock.AnyArg()}},
+		{"still failing", http.StatusServiceUnavailable, http.StatusBadGateway,
+			"SET attempts = $2, last_error = $3, last_status = $4, failed_at = $5",
+			[]driver.Value{"dlq-1", 4, "webhook returned status 503", http.StatusServiceUnavailable, sqlmock.AnyArg()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDB(t)
+			recv, url := newReceiver(t, tt.status)
+			_, payload := testEnvelope(t)
+			webhooks = testDispatcher()
+
+			now := time.Now()
+			mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_dead_letters WHERE id = $1")).
+				WithArgs("dlq-1").
+				WillReturnRows(sqlmock.NewRows(deadLetterRowColumns).
+					AddRow("dlq-1", "webhook-1", url, WebhookEventRollback, payload, 3, "boom", 500, now, now, nil))
+			mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_subscriptions WHERE id = $1")).
+				WithArgs("webhook-1").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "url", "events", "secret", "created_at"}).
+					AddRow("webhook-1", url, "{}", "s3cret", now))
+			mock.ExpectExec(regexp.QuoteMeta(tt.wantUpdate)).
+				WithArgs(tt.wantArgs...).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			r := gin.New()
+			r.POST("/api/v1/webhooks/dead-letters/:id/redeliver", redeliverDeadLetter)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/dead-letters/dlq-1/redeliver", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			// Exactly one attempt, with the original delivery ID
+			if recv.count() != 1 || recv.requests[0].Get("X-QuantumDrops-Delivery") != "evt-1" {
+				t.Fatalf("received %d attempts, headers %v", recv.count(), recv.requests)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
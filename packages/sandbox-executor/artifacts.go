@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// Default artifact caps, unless SANDBOX_MAX_ARTIFACT_BYTES and
+// SANDBOX_MAX_ARTIFACT_FILE_BYTES say otherwise
+const (
+	DefaultMaxArtifactBytes     = 50 << 20
+	DefaultMaxArtifactFileBytes = 10 << 20
+)
+
+// Artifact is a file a program wrote that matched Artifacts, kept after the
+// run for download
+type Artifact struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+// SkippedArtifact matched Artifacts but wasn't kept
+type SkippedArtifact struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+}
+
+var (
+	maxArtifactBytes     = loadByteLimit("SANDBOX_MAX_ARTIFACT_BYTES", DefaultMaxArtifactBytes)
+	maxArtifactFileBytes = loadByteLimit("SANDBOX_MAX_ARTIFACT_FILE_BYTES", DefaultMaxArtifactFileBytes)
+
+	// artifactsRoot holds one directory of artifacts per execution
+	artifactsRoot = loadArtifactsRoot()
+)
+
+func loadArtifactsRoot() string {
+	if dir := os.Getenv("SANDBOX_ARTIFACTS_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "sandbox-artifacts")
+}
+
+// artifactsDir is where an execution's artifacts are stored
+func artifactsDir(execID string) string {
+	return filepath.Join(artifactsRoot, execID)
+}
+
+// collectArtifacts copies the captured files matching the globs from dir to
+// dest, in path order. Files over the per-file cap, or past the total cap,
+// are reported as skipped.
+func collectArtifacts(dir, dest string, globs []string) (artifacts []Artifact, skipped []SkippedArtifact, err error) {
+	var total int64
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Only regular files; never follow links the program left behind
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !matchesCapture(globs, rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Size() > maxArtifactFileBytes:
+			skipped = append(skipped, SkippedArtifact{Path: rel, Size: info.Size(),
+				Reason: fmt.Sprintf("larger than the %d byte per-file limit", maxArtifactFileBytes)})
+			return nil
+		case total+info.Size() > maxArtifactBytes:
+			skipped = append(skipped, SkippedArtifact{Path: rel, Size: info.Size(),
+				Reason: fmt.Sprintf("past the %d byte total limit", maxArtifactBytes)})
+			return nil
+		}
+
+		contentType, err := copyArtifact(path, filepath.Join(dest, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		artifacts = append(artifacts, Artifact{Path: rel, Size: info.Size(), ContentType: contentType})
+		return nil
+	})
+	return artifacts, skipped, err
+}
+
+// copyArtifact copies src to dst byte for byte and returns its content type,
+// from the extension or, failing that, the content
+func copyArtifact(src, dst string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(in, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+	if _, err := out.Write(head); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return "", err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(src))
+	if contentType == "" {
+		contentType = http.DetectContentType(head)
+	}
+	return contentType, out.Close()
+}
+
+// loadResult finds an execution or responds 404
+func loadResult(c *gin.Context) (*ExecutionResult, bool) {
+	result, ok := executions.Load(c.Param("id"))
+	if !ok {
+		apierror.RespondError(c, apierror.NotFound("execution not found"))
+		return nil, false
+	}
+	return result.(*ExecutionResult), true
+}
+
+func handleListArtifacts(c *gin.Context) {
+	result, ok := loadResult(c)
+	if !ok {
+		return
+	}
+	artifacts := result.Artifacts
+	if artifacts == nil {
+		artifacts = []Artifact{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":        result.ID,
+		"status":    result.Status,
+		"artifacts": artifacts,
+		"skipped":   result.SkippedArtifacts,
+		"total":     len(artifacts),
+	})
+}
+
+// handleGetArtifact downloads one artifact. Only paths in the execution's
+// artifact list are served, so the path can't reach outside its directory.
+func handleGetArtifact(c *gin.Context) {
+	result, ok := loadResult(c)
+	if !ok {
+		return
+	}
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	for _, artifact := range result.Artifacts {
+		if artifact.Path != path {
+			continue
+		}
+		c.Header("Content-Type", artifact.ContentType)
+		c.FileAttachment(filepath.Join(artifactsDir(result.ID), filepath.FromSlash(path)), filepath.Base(path))
+		return
+	}
+	apierror.RespondError(c, apierror.NotFound("artifact not found"))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pngHeader isn't valid UTF-8, so any text handling would mangle it
+var pngHeader = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0xff, 0xfe}
+
+func setArtifactLimits(t *testing.T, total, perFile int64) {
+	t.Helper()
+	previousTotal, previousFile := maxArtifactBytes, maxArtifactFileBytes
+	maxArtifactBytes, maxArtifactFileBytes = total, perFile
+	t.Cleanup(func() { maxArtifactBytes, maxArtifactFileBytes = previousTotal, previousFile })
+}
+
+func TestCollectArtifacts(t *testing.T) {
+	setArtifactLimits(t, 100, 40)
+	src, dest := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string][]byte{
+		"out/chart.png": pngHeader,
+		"out/big.png":   bytes.Repeat([]byte{0xff}, 41),
+		"report.json":   []byte(`{"ok": true}`),
+		"scratch.txt":   []byte("not asked for"),
+	})
+
+	artifacts, skipped, err := collectArtifacts(src, dest, []string{"out/*.png", "report.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 2 || artifacts[0].Path != "out/chart.png" || artifacts[1].Path != "report.json" {
+		t.Fatalf("artifacts = %+v, want the chart and report", artifacts)
+	}
+	if artifacts[0].ContentType != "image/png" || !strings.HasPrefix(artifacts[1].ContentType, "application/json") {
+		t.Errorf("content types = %q, %q", artifacts[0].ContentType, artifacts[1].ContentType)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "out", "chart.png")); !bytes.Equal(got, pngHeader) {
+		t.Errorf("stored chart = %x, want %x", got, pngHeader)
+	}
+	if len(skipped) != 1 || skipped[0].Path != "out/big.png" || skipped[0].Size != 41 || !strings.Contains(skipped[0].Reason, "per-file") {
+		t.Errorf("skipped = %+v, want the big image over the per-file cap", skipped)
+	}
+}
+
+func TestCollectArtifactsTotalCap(t *testing.T) {
+	setArtifactLimits(t, 10, 10)
+	src := t.TempDir()
+	writeFiles(t, src, map[string][]byte{"a.bin": make([]byte, 6), "b.bin": make([]byte, 6), "c.bin": make([]byte, 4)})
+
+	artifacts, skipped, err := collectArtifacts(src, t.TempDir(), []string{"*.bin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b doesn't fit after a, but the smaller c still does
+	if len(artifacts) != 2 || artifacts[0].Path != "a.bin" || artifacts[1].Path != "c.bin" {
+		t.Errorf("artifacts = %+v, want a and c", artifacts)
+	}
+	if len(skipped) != 1 || skipped[0].Path != "b.bin" || !strings.Contains(skipped[0].Reason, "total") {
+		t.Errorf("skipped = %+v, want b over the total cap", skipped)
+	}
+}
+
+func TestArtifactEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previousRoot := artifactsRoot
+	artifactsRoot = t.TempDir()
+	t.Cleanup(func() { artifactsRoot = previousRoot })
+
+	src := t.TempDir()
+	writeFiles(t, src, map[string][]byte{"out/chart.png": pngHeader, "out/huge.png": make([]byte, 64)})
+	setArtifactLimits(t, 100, 32)
+	artifacts, skipped, err := collectArtifacts(src, artifactsDir("exec-1"), []string{"out/*.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executions.Store("exec-1", &ExecutionResult{ID: "exec-1", Status: "success", Artifacts: artifacts, SkippedArtifacts: skipped})
+	t.Cleanup(func() { executions.Delete("exec-1") })
+
+	r := gin.New()
+	r.GET("/api/v1/executions/:id/artifacts", handleListArtifacts)
+	r.GET("/api/v1/executions/:id/artifacts/*path", handleGetArtifact)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/api/v1/executions/exec-1/artifacts")
+	var listing struct {
+		Artifacts []Artifact        `json:"artifacts"`
+		Skipped   []SkippedArtifact `json:"skipped"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("list = %d %s", w.Code, w.Body)
+	}
+	if len(listing.Artifacts) != 1 || listing.Artifacts[0].Size != int64(len(pngHeader)) || len(listing.Skipped) != 1 {
+		t.Errorf("listing = %+v, want the chart with huge.png skipped", listing)
+	}
+
+	w = get("/api/v1/executions/exec-1/artifacts/out/chart.png")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), pngHeader) {
+		t.Fatalf("download = %d %x, want the original bytes", w.Code, w.Body.Bytes())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("content type = %q, want image/png", ct)
+	}
+
+	for _, path := range []string{
+		"/api/v1/executions/exec-1/artifacts/out/huge.png",
+		"/api/v1/executions/exec-1/artifacts/../exec-1/out/chart.png",
+		"/api/v1/executions/missing/artifacts",
+	} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestExecuteRejectsInvalidArtifactGlob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/execute", handleExecute)
+	body := `{"language": "python", "code": "print(1)", "artifacts": ["out/[.png"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/execute", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "artifacts") {
+		t.Errorf("response = %d %s, want 400 naming artifacts", w.Code, w.Body)
+	}
+}
@@ -3,9 +3,11 @@ module github.com/QuantumLayer-dev/quantumlayer-platform/packages/sandbox-execut
 go 1.21
 
 require (
+	github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared v0.0.0
 	github.com/gin-gonic/gin v1.9.1
 	github.com/google/uuid v1.5.0
 	github.com/gorilla/websocket v1.5.1
+	github.com/sirupsen/logrus v1.9.3
 )
 
 require (
@@ -34,3 +36,5 @@ require (
 	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared => ../shared
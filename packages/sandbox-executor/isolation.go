@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Container runtimes an execution can run under. runsc (gVisor) and kata
+// put a kernel boundary between the code and the host; runc doesn't.
+const (
+	RuntimeRunc  = "runc"
+	RuntimeRunsc = "runsc"
+	RuntimeKata  = "kata"
+)
+
+// Isolation levels a request can ask for. Strong isolation only runs under
+// a hardened runtime and fails when none is installed.
+const (
+	IsolationStandard = "standard"
+	IsolationStrong   = "strong"
+)
+
+// Network access a request can ask for. Executions have no network unless
+// they ask for egress and SANDBOX_ALLOW_EGRESS is true.
+const (
+	NetworkNone   = "none"
+	NetworkEgress = "egress"
+)
+
+// egressDockerNetwork is the Docker network egress executions join
+const egressDockerNetwork = "bridge"
+
+// defaultSeccompProfile is where the Dockerfile installs seccomp.json
+const defaultSeccompProfile = "/etc/sandbox-executor/seccomp.json"
+
+var (
+	errInvalidIsolation   = errors.New("invalid isolation")
+	errRuntimeUnavailable = errors.New("container runtime unavailable")
+	errInvalidNetwork     = errors.New("invalid network")
+	errEgressNotAllowed   = errors.New("network egress is not allowed")
+)
+
+// dockerRuntimeNames are the names each runtime is registered under in the
+// Docker daemon's configuration
+var dockerRuntimeNames = map[string]string{
+	RuntimeRunc:  "runc",
+	RuntimeRunsc: "runsc",
+	RuntimeKata:  "kata-runtime",
+}
+
+// hardenedRuntimes are tried in order for strong isolation
+var hardenedRuntimes = []string{RuntimeRunsc, RuntimeKata}
+
+// IsolationPolicy is how executions are isolated from the host, configured
+// with SANDBOX_RUNTIME, SANDBOX_SECCOMP_PROFILE and SANDBOX_ALLOW_EGRESS
+type IsolationPolicy struct {
+	// Runtime runs standard executions, and strong ones if it is hardened
+	Runtime string
+	// SeccompProfile is the path of the seccomp profile every execution
+	// runs with
+	SeccompProfile string
+	// AllowEgress lets executions that ask for it reach the network, e.g.
+	// to test a deployed API
+	AllowEgress bool
+
+	runtimes *runtimeDetector
+}
+
+// runtimeDetector asks the Docker daemon which runtimes it has. Successful
+// answers are cached for a minute; failures aren't, since the daemon may
+// still be starting.
+type runtimeDetector struct {
+	mu        sync.Mutex
+	available map[string]bool
+	checkedAt time.Time
+	detect    func(ctx context.Context) (map[string]bool, error)
+}
+
+var isolationPolicy = loadIsolationPolicy()
+
+// loadIsolationPolicy reads the isolation settings. An unknown runtime is
+// fatal rather than quietly falling back to runc.
+func loadIsolationPolicy() IsolationPolicy {
+	policy := IsolationPolicy{
+		Runtime:        RuntimeRunc,
+		SeccompProfile: defaultSeccompProfile,
+		runtimes:       &runtimeDetector{detect: dockerRuntimes},
+	}
+	if v := os.Getenv("SANDBOX_RUNTIME"); v != "" {
+		if _, ok := dockerRuntimeNames[v]; !ok {
+			logger.WithField("runtime", v).Fatal("SANDBOX_RUNTIME must be runc, runsc or kata")
+		}
+		policy.Runtime = v
+	}
+	if v := os.Getenv("SANDBOX_SECCOMP_PROFILE"); v != "" {
+		policy.SeccompProfile = v
+	}
+	policy.AllowEgress = os.Getenv("SANDBOX_ALLOW_EGRESS") == "true"
+	return policy
+}
+
+// ResolveNetwork picks the Docker network for a requested network access.
+// An empty value means none.
+func (p IsolationPolicy) ResolveNetwork(network string) (string, error) {
+	switch network {
+	case "", NetworkNone:
+		return "none", nil
+	case NetworkEgress:
+		if !p.AllowEgress {
+			return "", fmt.Errorf("%w: SANDBOX_ALLOW_EGRESS is not enabled", errEgressNotAllowed)
+		}
+		return egressDockerNetwork, nil
+	default:
+		return "", fmt.Errorf("%w %q: must be %s or %s", errInvalidNetwork, network, NetworkNone, NetworkEgress)
+	}
+}
+
+// Resolve picks the runtime for an isolation level. It fails closed: a
+// configured or required runtime that isn't installed is an error, never a
+// reason to fall back to runc. An empty level means standard.
+func (p IsolationPolicy) Resolve(ctx context.Context, isolation string) (string, error) {
+	if _, err := os.Stat(p.SeccompProfile); err != nil {
+		return "", fmt.Errorf("%w: seccomp profile %s is not readable: %v", errRuntimeUnavailable, p.SeccompProfile, err)
+	}
+
+	switch isolation {
+	case "", IsolationStandard:
+		if p.Runtime == RuntimeRunc {
+			return RuntimeRunc, nil
+		}
+		return p.Runtime, p.requireRuntime(ctx, p.Runtime)
+	case IsolationStrong:
+		if p.Runtime != RuntimeRunc {
+			return p.Runtime, p.requireRuntime(ctx, p.Runtime)
+		}
+		available, err := p.runtimes.Available(ctx)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errRuntimeUnavailable, err)
+		}
+		for _, runtime := range hardenedRuntimes {
+			if available[dockerRuntimeNames[runtime]] {
+				return runtime, nil
+			}
+		}
+		return "", fmt.Errorf("%w: strong isolation requires the runsc or kata runtime and neither is installed", errRuntimeUnavailable)
+	default:
+		return "", fmt.Errorf("%w %q: must be standard or strong", errInvalidIsolation, isolation)
+	}
+}
+
+func (p IsolationPolicy) requireRuntime(ctx context.Context, runtime string) error {
+	available, err := p.runtimes.Available(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errRuntimeUnavailable, err)
+	}
+	if !available[dockerRuntimeNames[runtime]] {
+		return fmt.Errorf("%w: the %s runtime is not installed in the Docker daemon", errRuntimeUnavailable, runtime)
+	}
+	return nil
+}
+
+// dockerArgs are the docker run flags that apply a runtime and the seccomp
+// profile
+func (p IsolationPolicy) dockerArgs(runtime string) []string {
+	return []string{
+		"--runtime", dockerRuntimeNames[runtime],
+		"--security-opt", "seccomp=" + p.SeccompProfile,
+	}
+}
+
+// Available returns the Docker runtime names the daemon has registered
+func (d *runtimeDetector) Available(ctx context.Context) (map[string]bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.available != nil && time.Since(d.checkedAt) < time.Minute {
+		return d.available, nil
+	}
+	available, err := d.detect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Docker runtimes: %w", err)
+	}
+	d.available, d.checkedAt = available, time.Now()
+	return available, nil
+}
+
+// respondIsolationError rejects a bad isolation level as invalid and a
+// missing runtime or seccomp profile as unavailable
+func respondIsolationError(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidIsolation) || errors.Is(err, errInvalidNetwork) {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	if errors.Is(err, errEgressNotAllowed) {
+		apierror.RespondError(c, apierror.New(apierror.CodeForbidden, err.Error()))
+		return
+	}
+	apierror.RespondError(c, apierror.Unavailable(err.Error()))
+}
+
+// logIsolationPolicy reports at startup whether executions will be able to
+// run, since a missing runtime only fails them one by one
+func logIsolationPolicy() {
+	entry := logger.WithFields(logrus.Fields{
+		"runtime":         isolationPolicy.Runtime,
+		"seccomp_profile": isolationPolicy.SeccompProfile,
+	})
+	for _, isolation := range []string{IsolationStandard, IsolationStrong} {
+		if runtime, err := isolationPolicy.Resolve(context.Background(), isolation); err != nil {
+			entry.WithError(err).WithField("isolation", isolation).Warn("Executions will be rejected until the runtime is available")
+		} else {
+			entry.WithFields(logrus.Fields{"isolation": isolation, "resolved_runtime": runtime}).Info("Isolation available")
+		}
+	}
+}
+
+func dockerRuntimes(ctx context.Context) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "docker", "info", "--format", "{{json .Runtimes}}").Output()
+	if err != nil {
+		return nil, err
+	}
+	var runtimes map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(out))), &runtimes); err != nil {
+		return nil, err
+	}
+
+	available := make(map[string]bool, len(runtimes))
+	for name := range runtimes {
+		available[name] = true
+	}
+	return available, nil
+}
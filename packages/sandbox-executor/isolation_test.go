@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testPolicy uses the repo's seccomp profile and a daemon that has the
+// given runtimes
+func testPolicy(runtime string, installed ...string) IsolationPolicy {
+	available := make(map[string]bool)
+	for _, name := range installed {
+		available[name] = true
+	}
+	return IsolationPolicy{
+		Runtime:        runtime,
+		SeccompProfile: "seccomp.json",
+		runtimes: &runtimeDetector{detect: func(context.Context) (map[string]bool, error) {
+			return available, nil
+		}},
+	}
+}
+
+func TestIsolationResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    IsolationPolicy
+		isolation string
+		want      string
+		wantErr   error
+	}{
+		{"default", testPolicy(RuntimeRunc, "runc"), "", RuntimeRunc, nil},
+		{"standard with runc", testPolicy(RuntimeRunc), IsolationStandard, RuntimeRunc, nil},
+		{"strong prefers gVisor", testPolicy(RuntimeRunc, "runc", "runsc", "kata-runtime"), IsolationStrong, RuntimeRunsc, nil},
+		{"strong falls back to kata", testPolicy(RuntimeRunc, "runc", "kata-runtime"), IsolationStrong, RuntimeKata, nil},
+		{"strong without a hardened runtime", testPolicy(RuntimeRunc, "runc"), IsolationStrong, "", errRuntimeUnavailable},
+		{"configured runtime installed", testPolicy(RuntimeRunsc, "runc", "runsc"), IsolationStandard, RuntimeRunsc, nil},
+		{"configured runtime missing", testPolicy(RuntimeKata, "runc", "runsc"), "", "", errRuntimeUnavailable},
+		{"strong with configured runtime missing", testPolicy(RuntimeKata, "runc", "runsc"), IsolationStrong, "", errRuntimeUnavailable},
+		{"unknown isolation", testPolicy(RuntimeRunc, "runc"), "maximum", "", errInvalidIsolation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Resolve(context.Background(), tt.isolation)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Fatalf("runtime = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsolationFailsClosed(t *testing.T) {
+	// A missing seccomp profile blocks every execution
+	policy := testPolicy(RuntimeRunc, "runc")
+	policy.SeccompProfile = "missing.json"
+	if _, err := policy.Resolve(context.Background(), IsolationStandard); !errors.Is(err, errRuntimeUnavailable) {
+		t.Fatalf("err = %v, want %v", err, errRuntimeUnavailable)
+	}
+
+	// So does a daemon that can't be asked for its runtimes, and the
+	// failure isn't cached
+	calls := 0
+	policy = testPolicy(RuntimeRunc)
+	policy.runtimes.detect = func(context.Context) (map[string]bool, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("Cannot connect to the Docker daemon")
+		}
+		return map[string]bool{"runsc": true}, nil
+	}
+	if _, err := policy.Resolve(context.Background(), IsolationStrong); !errors.Is(err, errRuntimeUnavailable) {
+		t.Fatalf("err = %v, want %v", err, errRuntimeUnavailable)
+	}
+	if got, err := policy.Resolve(context.Background(), IsolationStrong); err != nil || got != RuntimeRunsc {
+		t.Fatalf("after the daemon started: %s, %v", got, err)
+	}
+}
+
+func TestExecuteRejectsUnavailableIsolation(t *testing.T) {
+	defer func(policy IsolationPolicy) { isolationPolicy = policy }(isolationPolicy)
+	isolationPolicy = testPolicy(RuntimeRunc, "runc")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/execute", handleExecute)
+	r.POST("/api/v1/execute-project", handleExecuteProject)
+
+	tests := []struct {
+		path       string
+		body       map[string]interface{}
+		wantStatus int
+	}{
+		{"/api/v1/execute", map[string]interface{}{"language": "python", "code": "print(1)", "isolation": "strong"}, http.StatusServiceUnavailable},
+		{"/api/v1/execute", map[string]interface{}{"language": "python", "code": "print(1)", "isolation": "paranoid"}, http.StatusBadRequest},
+		{"/api/v1/execute-project", map[string]interface{}{
+			"language": "python", "files": map[string]string{"main.py": "print(1)"}, "entry_point": "main.py", "isolation": "strong",
+		}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(tt.body)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(body)))
+		if w.Code != tt.wantStatus {
+			t.Fatalf("%s isolation %v: status %d, want %d: %s", tt.path, tt.body["isolation"], w.Code, tt.wantStatus, w.Body)
+		}
+	}
+
+	// Nothing was started
+	executions.Range(func(key, _ interface{}) bool {
+		t.Fatalf("execution %v started", key)
+		return false
+	})
+}
+
+func TestDockerCommandIsolation(t *testing.T) {
+	req := ExecutionRequest{
+		Language:  "python",
+		Code:      "print(1)",
+		Runtime:   RuntimeRunsc,
+		Resources: ResourceLimits{CPULimit: "1", MemoryLimit: "512m", DiskLimit: "256m", PIDsLimit: 128},
+	}
+	cmd := strings.Join(buildDockerCommand(req, runtimes["python"], "/tmp/src", "/tmp/src/main.py", ""), " ")
+
+	for _, want := range []string{
+		"--runtime runsc",
+		"--security-opt seccomp=" + isolationPolicy.SeccompProfile,
+		"--read-only",
+		"--tmpfs /tmp:rw,exec,size=256m",
+		"--cap-drop ALL",
+	} {
+		if !strings.Contains(cmd, want) {
+			t.Fatalf("docker command missing %q: %s", want, cmd)
+		}
+	}
+}
+
+func TestSeccompProfileDeniesEscapes(t *testing.T) {
+	data, err := os.ReadFile("seccomp.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile struct {
+		DefaultAction string `json:"defaultAction"`
+		Syscalls      []struct {
+			Names  []string        `json:"names"`
+			Action string          `json:"action"`
+			Args   json.RawMessage `json:"args"`
+		} `json:"syscalls"`
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		t.Fatalf("seccomp.json: %v", err)
+	}
+
+	denied := make(map[string]bool)
+	for _, rule := range profile.Syscalls {
+		if rule.Action != "SCMP_ACT_ERRNO" || rule.Args != nil {
+			continue
+		}
+		for _, name := range rule.Names {
+			denied[name] = true
+		}
+	}
+	for _, name := range []string{"mount", "ptrace", "unshare", "setns", "bpf", "keyctl", "kexec_load", "init_module"} {
+		if !denied[name] {
+			t.Errorf("seccomp profile allows %s", name)
+		}
+	}
+}
+
+func TestResolveNetwork(t *testing.T) {
+	tests := []struct {
+		network     string
+		allowEgress bool
+		want        string
+		wantErr     error
+	}{
+		{network: "", want: "none"},
+		{network: NetworkNone, allowEgress: true, want: "none"},
+		{network: NetworkEgress, allowEgress: true, want: egressDockerNetwork},
+		{network: NetworkEgress, wantErr: errEgressNotAllowed},
+		{network: "host", allowEgress: true, wantErr: errInvalidNetwork},
+	}
+	for _, tt := range tests {
+		policy := IsolationPolicy{AllowEgress: tt.allowEgress}
+		got, err := policy.ResolveNetwork(tt.network)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("ResolveNetwork(%q) with egress allowed %v = %q, %v; want %q, %v", tt.network, tt.allowEgress, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	req := ExecutionRequest{
+		Language:      "python",
+		Code:          "print(1)",
+		Resources:     ResourceLimits{CPULimit: "1", MemoryLimit: "512m", DiskLimit: "256m", PIDsLimit: 128},
+		DockerNetwork: egressDockerNetwork,
+	}
+	if cmd := strings.Join(buildDockerCommand(req, runtimes["python"], "/tmp/src", "/tmp/src/main.py", ""), " "); !strings.Contains(cmd, "--network bridge") {
+		t.Errorf("docker command doesn't join the egress network: %s", cmd)
+	}
+	req.DockerNetwork = ""
+	if cmd := strings.Join(buildDockerCommand(req, runtimes["python"], "/tmp/src", "/tmp/src/main.py", ""), " "); !strings.Contains(cmd, "--network none") {
+		t.Errorf("docker command isn't isolated by default: %s", cmd)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resourceBound is the default, floor and ceiling for one resource.
+// Requests below the floor are raised to it; requests above the ceiling are
+// rejected.
+type resourceBound struct {
+	Default float64
+	Min     float64
+	Max     float64
+}
+
+// LimitPolicy bounds the resources an execution may use. Every execution
+// runs with a CPU, memory, disk and PID limit, whether or not it asks for
+// one.
+type LimitPolicy struct {
+	CPU    resourceBound // cores
+	Memory resourceBound // bytes
+	Disk   resourceBound // bytes per writable mount
+	PIDs   resourceBound
+}
+
+var limitPolicy = loadLimitPolicy()
+
+// loadLimitPolicy reads SANDBOX_<RESOURCE>_{DEFAULT,MIN,MAX} for the cpu,
+// memory, disk and pids resources, keeping the built-in bounds for anything
+// unset or invalid
+func loadLimitPolicy() LimitPolicy {
+	policy := LimitPolicy{
+		CPU:    resourceBound{Default: 1, Min: 0.1, Max: 2},
+		Memory: resourceBound{Default: 512 << 20, Min: 64 << 20, Max: 2 << 30},
+		Disk:   resourceBound{Default: 256 << 20, Min: 16 << 20, Max: 1 << 30},
+		PIDs:   resourceBound{Default: 128, Min: 16, Max: 512},
+	}
+
+	policy.CPU = loadBound("CPU", policy.CPU, parseCPU)
+	policy.Memory = loadBound("MEMORY", policy.Memory, parseBytes)
+	policy.Disk = loadBound("DISK", policy.Disk, parseBytes)
+	policy.PIDs = loadBound("PIDS", policy.PIDs, parsePIDs)
+	return policy
+}
+
+func loadBound(name string, bound resourceBound, parse func(string) (float64, error)) resourceBound {
+	loaded := bound
+	for suffix, field := range map[string]*float64{"DEFAULT": &loaded.Default, "MIN": &loaded.Min, "MAX": &loaded.Max} {
+		key := "SANDBOX_" + name + "_" + suffix
+		raw := os.Getenv(key)
+		if raw == "" {
+			continue
+		}
+		v, err := parse(raw)
+		if err != nil {
+			logger.WithError(err).WithField("variable", key).Warn("Ignoring invalid resource limit")
+			continue
+		}
+		*field = v
+	}
+
+	if loaded.Min > loaded.Max || loaded.Default < loaded.Min || loaded.Default > loaded.Max {
+		logger.WithField("resource", strings.ToLower(name)).Warn("Resource limits must satisfy min <= default <= max, using built-in limits")
+		return bound
+	}
+	return loaded
+}
+
+// Resolve fills in default limits, raises limits below the floor, and
+// rejects limits above the ceiling. The returned limits are normalized to
+// the values passed to Docker.
+func (p LimitPolicy) Resolve(requested ResourceLimits) (ResourceLimits, error) {
+	cpu, err := p.CPU.resolve("cpu_limit", requested.CPULimit, parseCPU)
+	if err != nil {
+		return ResourceLimits{}, err
+	}
+	memory, err := p.Memory.resolve("memory_limit", requested.MemoryLimit, parseBytes)
+	if err != nil {
+		return ResourceLimits{}, err
+	}
+	disk, err := p.Disk.resolve("disk_limit", requested.DiskLimit, parseBytes)
+	if err != nil {
+		return ResourceLimits{}, err
+	}
+
+	pids := p.PIDs.Default
+	if requested.PIDsLimit != 0 {
+		if pids, err = p.PIDs.resolve("pids_limit", strconv.Itoa(requested.PIDsLimit), parsePIDs); err != nil {
+			return ResourceLimits{}, err
+		}
+	}
+
+	return ResourceLimits{
+		CPULimit:    strconv.FormatFloat(cpu, 'f', -1, 64),
+		MemoryLimit: formatBytes(memory),
+		DiskLimit:   formatBytes(disk),
+		PIDsLimit:   int(pids),
+	}, nil
+}
+
+func (b resourceBound) resolve(field, raw string, parse func(string) (float64, error)) (float64, error) {
+	if raw == "" {
+		return b.Default, nil
+	}
+	v, err := parse(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %v", field, raw, err)
+	}
+	if v > b.Max {
+		return 0, fmt.Errorf("%s %q exceeds the maximum of %s", field, raw, b.format(field, b.Max))
+	}
+	if v < b.Min {
+		return b.Min, nil
+	}
+	return v, nil
+}
+
+func (b resourceBound) format(field string, v float64) string {
+	switch field {
+	case "memory_limit", "disk_limit":
+		return formatBytes(v)
+	default:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+}
+
+func parseCPU(raw string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("must be a positive number of cores")
+	}
+	return v, nil
+}
+
+func parsePIDs(raw string) (float64, error) {
+	v, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("must be a positive number of processes")
+	}
+	return float64(v), nil
+}
+
+// parseBytes parses a Docker-style size such as "256m" or "1g"
+func parseBytes(raw string) (float64, error) {
+	s := strings.ToLower(strings.TrimSpace(raw))
+	s = strings.TrimSuffix(s, "b")
+
+	multiplier := 1.0
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		}
+		if multiplier != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("must be a positive size such as 256m")
+	}
+	return v * multiplier, nil
+}
+
+// formatBytes renders a size in the largest whole unit Docker accepts
+func formatBytes(v float64) string {
+	n := int64(v)
+	switch {
+	case n%(1<<30) == 0:
+		return fmt.Sprintf("%dg", n>>30)
+	case n%(1<<20) == 0:
+		return fmt.Sprintf("%dm", n>>20)
+	case n%(1<<10) == 0:
+		return fmt.Sprintf("%dk", n>>10)
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLimitPolicyResolve(t *testing.T) {
+	policy := LimitPolicy{
+		CPU:    resourceBound{Default: 1, Min: 0.1, Max: 2},
+		Memory: resourceBound{Default: 512 << 20, Min: 64 << 20, Max: 2 << 30},
+		Disk:   resourceBound{Default: 256 << 20, Min: 16 << 20, Max: 1 << 30},
+		PIDs:   resourceBound{Default: 128, Min: 16, Max: 512},
+	}
+	tests := []struct {
+		name      string
+		requested ResourceLimits
+		want      ResourceLimits
+		wantErr   string
+	}{
+		{
+			name: "defaults",
+			want: ResourceLimits{CPULimit: "1", MemoryLimit: "512m", DiskLimit: "256m", PIDsLimit: 128},
+		},
+		{
+			name:      "within bounds",
+			requested: ResourceLimits{CPULimit: "1.5", MemoryLimit: "1G", DiskLimit: "524288k", PIDsLimit: 256},
+			want:      ResourceLimits{CPULimit: "1.5", MemoryLimit: "1g", DiskLimit: "512m", PIDsLimit: 256},
+		},
+		{
+			name:      "raised to the floor",
+			requested: ResourceLimits{CPULimit: "0.01", MemoryLimit: "1m", DiskLimit: "4096", PIDsLimit: 2},
+			want:      ResourceLimits{CPULimit: "0.1", MemoryLimit: "64m", DiskLimit: "16m", PIDsLimit: 16},
+		},
+		{
+			name:      "at the ceiling",
+			requested: ResourceLimits{CPULimit: "2", MemoryLimit: "2g", DiskLimit: "1g", PIDsLimit: 512},
+			want:      ResourceLimits{CPULimit: "2", MemoryLimit: "2g", DiskLimit: "1g", PIDsLimit: 512},
+		},
+		{
+			name:      "partial request",
+			requested: ResourceLimits{MemoryLimit: "128m"},
+			want:      ResourceLimits{CPULimit: "1", MemoryLimit: "128m", DiskLimit: "256m", PIDsLimit: 128},
+		},
+		{name: "cpu above the ceiling", requested: ResourceLimits{CPULimit: "4"}, wantErr: `cpu_limit "4" exceeds the maximum of 2`},
+		{name: "memory above the ceiling", requested: ResourceLimits{MemoryLimit: "4g"}, wantErr: `memory_limit "4g" exceeds the maximum of 2g`},
+		{name: "disk above the ceiling", requested: ResourceLimits{DiskLimit: "2048m"}, wantErr: `disk_limit "2048m" exceeds the maximum of 1g`},
+		{name: "pids above the ceiling", requested: ResourceLimits{PIDsLimit: 10000}, wantErr: `pids_limit "10000" exceeds the maximum of 512`},
+		{name: "invalid cpu", requested: ResourceLimits{CPULimit: "lots"}, wantErr: `invalid cpu_limit "lots"`},
+		{name: "negative memory", requested: ResourceLimits{MemoryLimit: "-1m"}, wantErr: `invalid memory_limit "-1m"`},
+		{name: "negative pids", requested: ResourceLimits{PIDsLimit: -1}, wantErr: `invalid pids_limit "-1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Resolve(tt.requested)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%+v) = %+v, want %+v", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadLimitPolicy(t *testing.T) {
+	builtIn := loadLimitPolicy()
+
+	t.Setenv("SANDBOX_MEMORY_MAX", "4g")
+	t.Setenv("SANDBOX_MEMORY_DEFAULT", "1g")
+	t.Setenv("SANDBOX_PIDS_MIN", "lots")
+	// A floor above the ceiling is rejected as a whole
+	t.Setenv("SANDBOX_CPU_MIN", "3")
+
+	policy := loadLimitPolicy()
+	if policy.Memory != (resourceBound{Default: 1 << 30, Min: builtIn.Memory.Min, Max: 4 << 30}) {
+		t.Errorf("memory = %+v, want the configured default and ceiling", policy.Memory)
+	}
+	if policy.PIDs != builtIn.PIDs {
+		t.Errorf("pids = %+v, want the built-in bounds for an invalid floor", policy.PIDs)
+	}
+	if policy.CPU != builtIn.CPU {
+		t.Errorf("cpu = %+v, want the built-in bounds when min > max", policy.CPU)
+	}
+	if policy.Disk != builtIn.Disk {
+		t.Errorf("disk = %+v, want the built-in bounds", policy.Disk)
+	}
+}
+
+func TestParseAndFormatBytes(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"256m", "256m"},
+		{"256MB", "256m"},
+		{" 1g ", "1g"},
+		{"2048k", "2m"},
+		{"1536m", "1536m"},
+		{"0.5g", "512m"},
+		{"1000", "1000"},
+		{"1024", "1k"},
+	}
+	for _, tt := range tests {
+		v, err := parseBytes(tt.raw)
+		if err != nil {
+			t.Errorf("parseBytes(%q): %v", tt.raw, err)
+			continue
+		}
+		if got := formatBytes(v); got != tt.want {
+			t.Errorf("formatBytes(parseBytes(%q)) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+	for _, raw := range []string{"", "m", "0", "-5m", "ten"} {
+		if _, err := parseBytes(raw); err == nil {
+			t.Errorf("parseBytes(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestExecuteRejectsLimitsAboveCeiling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/execute", handleExecute)
+	r.POST("/api/v1/execute-project", handleExecuteProject)
+
+	for _, tt := range []struct {
+		path string
+		body map[string]interface{}
+	}{
+		{"/api/v1/execute", map[string]interface{}{
+			"language": "python", "code": "print(1)", "resources": map[string]interface{}{"memory_limit": "64g"},
+		}},
+		{"/api/v1/execute", map[string]interface{}{
+			"language": "python", "code": "print(1)", "resources": map[string]interface{}{"pids_limit": 100000},
+		}},
+		{"/api/v1/execute-project", map[string]interface{}{
+			"language": "python", "files": map[string]string{"main.py": "print(1)"}, "entry_point": "main.py",
+			"resources": map[string]interface{}{"cpu_limit": "64"},
+		}},
+	} {
+		body, _ := json.Marshal(tt.body)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "exceeds the maximum") {
+			t.Errorf("%s %v: status %d %s, want 400", tt.path, tt.body["resources"], w.Code, w.Body)
+		}
+	}
+
+	executions.Range(func(key, _ interface{}) bool {
+		t.Fatalf("execution %v started", key)
+		return false
+	})
+}
+
+// forkBomb forks sleeping children until fork fails, then reports how many
+// it managed to start
+const forkBomb = `import os, time
+started = 0
+try:
+    while True:
+        if os.fork() == 0:
+            time.sleep(30)
+            os._exit(0)
+        started += 1
+except OSError:
+    print("contained", started)
+`
+
+func TestForkBombIsContained(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a container")
+	}
+	if err := exec.Command("docker", "info").Run(); err != nil {
+		t.Skip("Docker is not available")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte(forkBomb), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seccomp, err := filepath.Abs("seccomp.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(policy IsolationPolicy) { isolationPolicy = policy }(isolationPolicy)
+	isolationPolicy = testPolicy(RuntimeRunc, "runc")
+	isolationPolicy.SeccompProfile = seccomp
+
+	// The request asks for no limits; the policy's defaults still apply
+	limits, err := limitPolicy.Resolve(ResourceLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := ExecutionRequest{Language: "python", Runtime: RuntimeRunc, Resources: limits}
+	args := buildDockerCommand(req, runtimes["python"], dir, filepath.Join(dir, "main.py"), "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if ctx.Err() != nil {
+		t.Fatalf("fork bomb wasn't contained within the timeout: %s", out)
+	}
+	if err != nil {
+		t.Fatalf("docker run: %v: %s", err, out)
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 || fields[0] != "contained" {
+		t.Fatalf("output = %q", out)
+	}
+	started, _ := strconv.Atoi(fields[1])
+	if started >= limits.PIDsLimit {
+		t.Errorf("started %d processes under a limit of %d", started, limits.PIDsLimit)
+	}
+}
@@ -5,18 +5,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
 )
 
 // ExecutionRequest represents a code execution request
@@ -30,13 +34,34 @@ type ExecutionRequest struct {
 	Timeout      int                    `json:"timeout,omitempty"` // seconds, default 30
 	Environment  map[string]string      `json:"environment,omitempty"`
 	Resources    ResourceLimits         `json:"resources,omitempty"`
+
+	// Isolation is standard (the default) or strong; strong runs only under
+	// the runsc or kata runtime
+	Isolation string `json:"isolation,omitempty"`
+	// Runtime is the container runtime Isolation resolved to
+	Runtime string `json:"-"`
+
+	// Network is none (the default) or egress, which is only allowed when
+	// SANDBOX_ALLOW_EGRESS is true
+	Network string `json:"network,omitempty"`
+	// DockerNetwork is the Docker network Network resolved to
+	DockerNetwork string `json:"-"`
+
+	// Globs, relative to the working directory, of files the program writes
+	// that should be returned in the result, e.g. "report.txt" or "out/**"
+	CaptureOutputs []string `json:"capture_outputs,omitempty"`
+
+	// Globs, in the same form, of files to keep after the run for download
+	// from /executions/:id/artifacts, e.g. "out/*.png" or "report.json"
+	Artifacts []string `json:"artifacts,omitempty"`
 }
 
 // ResourceLimits defines resource constraints
 type ResourceLimits struct {
 	CPULimit    string `json:"cpu_limit,omitempty"`    // e.g., "0.5" for half CPU
 	MemoryLimit string `json:"memory_limit,omitempty"` // e.g., "256m"
-	DiskLimit   string `json:"disk_limit,omitempty"`   // e.g., "100m"
+	DiskLimit   string `json:"disk_limit,omitempty"`   // e.g., "100m", per writable mount
+	PIDsLimit   int    `json:"pids_limit,omitempty"`   // e.g., 64
 }
 
 // ExecutionResult represents the execution output
@@ -48,6 +73,14 @@ type ExecutionResult struct {
 	ExitCode   int              `json:"exit_code"`
 	Duration   float64          `json:"duration_seconds"`
 	Metrics    ExecutionMetrics `json:"metrics"`
+	Resources  ResourceLimits   `json:"resources"`
+	Runtime    string           `json:"runtime"`
+	Outputs    []OutputFile     `json:"outputs,omitempty"`
+	// SkippedOutputs matched CaptureOutputs but didn't fit the size cap
+	SkippedOutputs []string `json:"skipped_outputs,omitempty"`
+	Artifacts      []Artifact `json:"artifacts,omitempty"`
+	// SkippedArtifacts matched Artifacts but were over a size cap
+	SkippedArtifacts []SkippedArtifact `json:"skipped_artifacts,omitempty"`
 	StartedAt  time.Time        `json:"started_at"`
 	FinishedAt time.Time        `json:"finished_at"`
 }
@@ -138,16 +171,27 @@ var (
 	
 	// WebSocket connections
 	wsConnections = sync.Map{}
+
+	logger = logging.New("sandbox-executor")
 )
 
 func main() {
-	r := gin.Default()
+	auth, err := authmiddleware.FromEnv()
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid authentication configuration")
+	}
+	if warning := auth.Warning(); warning != "" {
+		logger.Warn("Authentication: " + warning)
+	}
+
+	r := gin.New()
+	r.Use(logging.Middleware(logger), gin.Recovery())
 
 	// Enable CORS
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 		
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -156,6 +200,7 @@ func main() {
 		
 		c.Next()
 	})
+	r.Use(authmiddleware.Middleware(auth))
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -192,16 +237,18 @@ func main() {
 		port = "8091"
 	}
 
-	log.Printf("Starting Sandbox Executor on port %s", port)
+	logIsolationPolicy()
+
+	logger.WithField("port", port).Info("Starting Sandbox Executor")
 	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+		logger.WithError(err).Fatal("Failed to start server")
 	}
 }
 
 func handleExecute(c *gin.Context) {
 	var req ExecutionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.RespondError(c, apierror.Validation(err.Error()))
 		return
 	}
 
@@ -216,7 +263,35 @@ func handleExecute(c *gin.Context) {
 	// Get runtime configuration
 	runtime, exists := runtimes[strings.ToLower(req.Language)]
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported language: " + req.Language})
+		apierror.RespondError(c, apierror.Validation("unsupported language: " + req.Language))
+		return
+	}
+
+	// Apply default resource limits and reject any over the ceiling
+	resources, err := limitPolicy.Resolve(req.Resources)
+	if err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	req.Resources = resources
+
+	if err := validateCaptureGlobs("capture_outputs", req.CaptureOutputs); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	if err := validateCaptureGlobs("artifacts", req.Artifacts); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+
+	// Pick the container runtime, refusing to run if it isn't installed
+	req.Runtime, err = isolationPolicy.Resolve(c.Request.Context(), req.Isolation)
+	if err != nil {
+		respondIsolationError(c, err)
+		return
+	}
+	if req.DockerNetwork, err = isolationPolicy.ResolveNetwork(req.Network); err != nil {
+		respondIsolationError(c, err)
 		return
 	}
 
@@ -225,6 +300,8 @@ func handleExecute(c *gin.Context) {
 		ID:        req.ID,
 		Status:    "running",
 		StartedAt: time.Now(),
+		Resources: resources,
+		Runtime:   req.Runtime,
 	}
 
 	// Store execution
@@ -244,11 +321,23 @@ func executeCode(req ExecutionRequest, runtime RuntimeContainer, result *Executi
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Timeout)*time.Second)
 	defer cancel()
 
+	execLog := logger.WithFields(logrus.Fields{
+		"execution_id": req.ID,
+		"language":     runtime.Language,
+	})
+	execLog.WithFields(logging.Content(logger, "code", req.Code)).WithFields(logrus.Fields{
+		"timeout_seconds": req.Timeout,
+		"files":           len(req.Files),
+		"dependencies":    len(req.Dependencies),
+	}).Info("Execution started")
+	defer logExecutionResult(execLog, result)
+
 	// Create temporary directory
 	tempDir, err := os.MkdirTemp("", "sandbox-"+req.ID)
 	if err != nil {
 		result.Status = "error"
 		result.Error = fmt.Sprintf("Failed to create temp directory: %v", err)
+		execLog.WithError(err).Error("Failed to create temp directory")
 		result.FinishedAt = time.Now()
 		return
 	}
@@ -259,6 +348,7 @@ func executeCode(req ExecutionRequest, runtime RuntimeContainer, result *Executi
 	if err := os.WriteFile(filename, []byte(req.Code), 0644); err != nil {
 		result.Status = "error"
 		result.Error = fmt.Sprintf("Failed to write code file: %v", err)
+		execLog.WithError(err).Error("Failed to write code file")
 		result.FinishedAt = time.Now()
 		return
 	}
@@ -270,12 +360,14 @@ func executeCode(req ExecutionRequest, runtime RuntimeContainer, result *Executi
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			result.Status = "error"
 			result.Error = fmt.Sprintf("Failed to create directory %s: %v", dir, err)
+			execLog.WithError(err).WithField("path", dir).Error("Failed to create directory")
 			result.FinishedAt = time.Now()
 			return
 		}
 		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
 			result.Status = "error"
 			result.Error = fmt.Sprintf("Failed to write file %s: %v", path, err)
+			execLog.WithError(err).WithField("path", path).Error("Failed to write file")
 			result.FinishedAt = time.Now()
 			return
 		}
@@ -283,20 +375,61 @@ func executeCode(req ExecutionRequest, runtime RuntimeContainer, result *Executi
 
 	// Install dependencies if needed
 	if len(req.Dependencies) > 0 {
-		if err := installDependencies(ctx, tempDir, req.Language, req.Dependencies); err != nil {
+		if err := installDependencies(ctx, tempDir, req.Language, req.Runtime, req.Dependencies); err != nil {
 			result.Status = "error"
 			result.Error = fmt.Sprintf("Failed to install dependencies: %v", err)
+			execLog.WithError(err).Error("Failed to install dependencies")
+			result.FinishedAt = time.Now()
+			return
+		}
+	}
+
+	// Create a directory for the files the program writes
+	var outputDir string
+	if len(req.CaptureOutputs) > 0 || len(req.Artifacts) > 0 {
+		outputDir, err = os.MkdirTemp("", "sandbox-out-"+req.ID)
+		if err != nil {
+			result.Status = "error"
+			result.Error = fmt.Sprintf("Failed to create output directory: %v", err)
+			execLog.WithError(err).Error("Failed to create output directory")
+			result.FinishedAt = time.Now()
+			return
+		}
+		defer os.RemoveAll(outputDir)
+
+		if err := writeCaptureMarker(tempDir); err != nil {
+			result.Status = "error"
+			result.Error = fmt.Sprintf("Failed to prepare output capture: %v", err)
+			execLog.WithError(err).Error("Failed to prepare output capture")
 			result.FinishedAt = time.Now()
 			return
 		}
 	}
 
 	// Build Docker command
-	dockerCmd := buildDockerCommand(req, runtime, tempDir, filename)
+	dockerCmd := buildDockerCommand(req, runtime, tempDir, filename, outputDir)
 
 	// Execute with streaming
 	executeWithStreaming(ctx, dockerCmd, req.ID, result)
 
+	// Collect the output files
+	if len(req.CaptureOutputs) > 0 {
+		outputs, skipped, err := collectOutputs(outputDir, req.CaptureOutputs)
+		if err != nil {
+			execLog.WithError(err).Warn("Failed to collect output files")
+		}
+		result.Outputs = outputs
+		result.SkippedOutputs = skipped
+	}
+	if len(req.Artifacts) > 0 {
+		artifacts, skipped, err := collectArtifacts(outputDir, artifactsDir(req.ID), req.Artifacts)
+		if err != nil {
+			execLog.WithError(err).Warn("Failed to collect artifacts")
+		}
+		result.Artifacts = artifacts
+		result.SkippedArtifacts = skipped
+	}
+
 	// Update metrics
 	result.FinishedAt = time.Now()
 	result.Duration = result.FinishedAt.Sub(result.StartedAt).Seconds()
@@ -306,16 +439,47 @@ func executeCode(req ExecutionRequest, runtime RuntimeContainer, result *Executi
 	}
 }
 
-func buildDockerCommand(req ExecutionRequest, runtime RuntimeContainer, tempDir, filename string) []string {
-	cmd := []string{"docker", "run", "--rm"}
-	
-	// Add resource limits
-	if req.Resources.CPULimit != "" {
-		cmd = append(cmd, "--cpus", req.Resources.CPULimit)
+// logExecutionResult logs how an execution ended. Program output may echo
+// the submitted code, so it is only logged at debug level.
+func logExecutionResult(execLog *logrus.Entry, result *ExecutionResult) {
+	entry := execLog.WithFields(logrus.Fields{
+		"status":           result.Status,
+		"exit_code":        result.ExitCode,
+		"duration_seconds": result.Duration,
+	})
+	if logger.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		entry = entry.WithFields(logrus.Fields{
+			"output": result.Output,
+			"error":  result.Error,
+		})
 	}
-	if req.Resources.MemoryLimit != "" {
-		cmd = append(cmd, "-m", req.Resources.MemoryLimit)
+
+	if result.Status == "success" {
+		entry.Info("Execution finished")
+	} else {
+		entry.Warn("Execution finished")
 	}
+}
+
+// buildDockerCommand runs the code with the request's resolved resource
+// limits, under its resolved runtime and the seccomp profile. The workspace is mounted read-only and copied into a size-capped
+// tmpfs, and the root filesystem is read-only, so a program can't fill the
+// host's disk; tmpfs usage also counts against the memory limit. When
+// outputDir is set, files the run writes are copied there for capture.
+func buildDockerCommand(req ExecutionRequest, runtime RuntimeContainer, tempDir, filename, outputDir string) []string {
+	cmd := []string{"docker", "run", "--rm"}
+	
+	// Add resource limits; swap is capped at the memory limit
+	limits := req.Resources
+	cmd = append(cmd, "--cpus", limits.CPULimit)
+	cmd = append(cmd, "-m", limits.MemoryLimit, "--memory-swap", limits.MemoryLimit)
+	cmd = append(cmd, "--pids-limit", strconv.Itoa(limits.PIDsLimit))
+	
+	// Add disk limits
+	cmd = append(cmd, "--read-only")
+	cmd = append(cmd, "--tmpfs", "/app:rw,exec,size="+limits.DiskLimit)
+	cmd = append(cmd, "--tmpfs", "/tmp:rw,exec,size="+limits.DiskLimit)
+	cmd = append(cmd, "-e", "HOME=/tmp")
 	
 	// Add environment variables
 	for key, value := range req.Environment {
@@ -323,30 +487,45 @@ func buildDockerCommand(req ExecutionRequest, runtime RuntimeContainer, tempDir,
 	}
 	
 	// Mount volume
-	cmd = append(cmd, "-v", fmt.Sprintf("%s:/app", tempDir))
+	cmd = append(cmd, "-v", fmt.Sprintf("%s:/src:ro", tempDir))
+	if outputDir != "" {
+		cmd = append(cmd, "-v", fmt.Sprintf("%s:%s", outputDir, outputsMount))
+	}
 	cmd = append(cmd, "-w", "/app")
 	
-	// Add network isolation
-	cmd = append(cmd, "--network", "none")
+	// Add network isolation; egress has to be asked for and allowed
+	network := req.DockerNetwork
+	if network == "" {
+		network = "none"
+	}
+	cmd = append(cmd, "--network", network)
 	
 	// Add security options
 	cmd = append(cmd, "--security-opt", "no-new-privileges")
 	cmd = append(cmd, "--cap-drop", "ALL")
+	cmd = append(cmd, isolationPolicy.dockerArgs(req.Runtime)...)
 	
 	// Add image
 	cmd = append(cmd, runtime.Image)
 	
 	// Add command
+	var script string
 	if req.Command != "" {
-		cmd = append(cmd, "sh", "-c", req.Command)
+		script = req.Command
 	} else if runtime.BuildCmd != "" {
 		// Languages that need compilation
-		buildAndRun := fmt.Sprintf("%s main%s && %s", runtime.BuildCmd, runtime.Extension, runtime.RunCmd)
-		cmd = append(cmd, "sh", "-c", buildAndRun)
+		script = fmt.Sprintf("%s main%s && %s", runtime.BuildCmd, runtime.Extension, runtime.RunCmd)
+	} else if outputDir != "" {
+		// Interpreted languages; the shell stays to capture outputs
+		script = fmt.Sprintf("%s %s", runtime.RunCmd, filepath.Base(filename))
 	} else {
 		// Interpreted languages
-		cmd = append(cmd, runtime.RunCmd, filepath.Base(filename))
+		script = fmt.Sprintf("exec %s %s", runtime.RunCmd, filepath.Base(filename))
+	}
+	if outputDir != "" {
+		script = captureScript(script)
 	}
+	cmd = append(cmd, "sh", "-c", "cp -a /src/. /app && "+script)
 	
 	return cmd
 }
@@ -359,6 +538,7 @@ func executeWithStreaming(ctx context.Context, dockerCmd []string, execID string
 	if err != nil {
 		result.Status = "error"
 		result.Error = fmt.Sprintf("Failed to create stdout pipe: %v", err)
+		logger.WithError(err).WithField("execution_id", execID).Error("Failed to create stdout pipe")
 		return
 	}
 	
@@ -366,6 +546,7 @@ func executeWithStreaming(ctx context.Context, dockerCmd []string, execID string
 	if err != nil {
 		result.Status = "error"
 		result.Error = fmt.Sprintf("Failed to create stderr pipe: %v", err)
+		logger.WithError(err).WithField("execution_id", execID).Error("Failed to create stderr pipe")
 		return
 	}
 	
@@ -373,6 +554,7 @@ func executeWithStreaming(ctx context.Context, dockerCmd []string, execID string
 	if err := cmd.Start(); err != nil {
 		result.Status = "error"
 		result.Error = fmt.Sprintf("Failed to start execution: %v", err)
+		logger.WithError(err).WithField("execution_id", execID).Error("Failed to start execution")
 		return
 	}
 	
@@ -440,8 +622,15 @@ func streamToWebSocket(execID, data, stream string) {
 	}
 }
 
-func installDependencies(ctx context.Context, dir, language string, deps []string) error {
+// installDependencies runs package installs, which may execute package
+// scripts, under the execution's runtime and seccomp profile
+func installDependencies(ctx context.Context, dir, language, runtime string, deps []string) error {
 	var cmd *exec.Cmd
+	dockerRun := func(image string, args ...string) *exec.Cmd {
+		run := append([]string{"run", "--rm"}, isolationPolicy.dockerArgs(runtime)...)
+		run = append(run, "-v", dir+":/app", "-w", "/app", image)
+		return exec.CommandContext(ctx, "docker", append(run, args...)...)
+	}
 	
 	switch strings.ToLower(language) {
 	case "python":
@@ -450,8 +639,7 @@ func installDependencies(ctx context.Context, dir, language string, deps []strin
 		if err := os.WriteFile(reqFile, []byte(strings.Join(deps, "\n")), 0644); err != nil {
 			return err
 		}
-		cmd = exec.CommandContext(ctx, "docker", "run", "--rm", "-v", dir+":/app", "-w", "/app",
-			"python:3.11-slim", "pip", "install", "-r", "requirements.txt", "--target", ".")
+		cmd = dockerRun("python:3.11-slim", "pip", "install", "-r", "requirements.txt", "--target", ".")
 			
 	case "javascript", "typescript":
 		// Create package.json
@@ -467,20 +655,17 @@ func installDependencies(ctx context.Context, dir, language string, deps []strin
 		if err := os.WriteFile(filepath.Join(dir, "package.json"), data, 0644); err != nil {
 			return err
 		}
-		cmd = exec.CommandContext(ctx, "docker", "run", "--rm", "-v", dir+":/app", "-w", "/app",
-			"node:18-alpine", "npm", "install")
+		cmd = dockerRun("node:18-alpine", "npm", "install")
 			
 	case "go":
 		// Initialize go.mod
-		cmd = exec.CommandContext(ctx, "docker", "run", "--rm", "-v", dir+":/app", "-w", "/app",
-			"golang:1.21-alpine", "go", "mod", "init", "sandbox")
+		cmd = dockerRun("golang:1.21-alpine", "go", "mod", "init", "sandbox")
 		if err := cmd.Run(); err != nil {
 			return err
 		}
 		// Get dependencies
 		for _, dep := range deps {
-			cmd = exec.CommandContext(ctx, "docker", "run", "--rm", "-v", dir+":/app", "-w", "/app",
-				"golang:1.21-alpine", "go", "get", dep)
+			cmd = dockerRun("golang:1.21-alpine", "go", "get", dep)
 			if err := cmd.Run(); err != nil {
 				return err
 			}
@@ -500,7 +685,7 @@ func handleGetExecution(c *gin.Context) {
 	if result, ok := executions.Load(id); ok {
 		c.JSON(http.StatusOK, result)
 	} else {
-		c.JSON(http.StatusNotFound, gin.H{"error": "execution not found"})
+		apierror.RespondError(c, apierror.NotFound("execution not found"))
 	}
 }
 
@@ -510,7 +695,7 @@ func handleStreamExecution(c *gin.Context) {
 	// Upgrade to WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade to websocket: %v", err)
+		logger.WithError(err).WithField("execution_id", id).Warn("Failed to upgrade to websocket")
 		return
 	}
 	defer conn.Close()
@@ -566,7 +751,7 @@ func handleValidate(c *gin.Context) {
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.RespondError(c, apierror.Validation(err.Error()))
 		return
 	}
 	
@@ -601,20 +786,49 @@ func handleExecuteProject(c *gin.Context) {
 		Dependencies []string          `json:"dependencies,omitempty"`
 		Command      string            `json:"command,omitempty"`
 		Timeout      int               `json:"timeout,omitempty"`
+		Resources    ResourceLimits    `json:"resources,omitempty"`
+		Isolation    string            `json:"isolation,omitempty"`
+		CaptureOutputs []string        `json:"capture_outputs,omitempty"`
+		Artifacts    []string          `json:"artifacts,omitempty"`
+		Network      string            `json:"network,omitempty"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.RespondError(c, apierror.Validation(err.Error()))
 		return
 	}
 	
 	// Get entry point content
 	entryContent, exists := req.Files[req.EntryPoint]
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "entry point file not found"})
+		apierror.RespondError(c, apierror.Validation("entry point file not found"))
 		return
 	}
 	
+	resources, err := limitPolicy.Resolve(req.Resources)
+	if err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	if err := validateCaptureGlobs("capture_outputs", req.CaptureOutputs); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	if err := validateCaptureGlobs("artifacts", req.Artifacts); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	runtimeName, err := isolationPolicy.Resolve(c.Request.Context(), req.Isolation)
+	if err != nil {
+		respondIsolationError(c, err)
+		return
+	}
+	dockerNetwork, err := isolationPolicy.ResolveNetwork(req.Network)
+	if err != nil {
+		respondIsolationError(c, err)
+		return
+	}
+
 	// Create execution request
 	execReq := ExecutionRequest{
 		ID:           uuid.New().String(),
@@ -624,12 +838,19 @@ func handleExecuteProject(c *gin.Context) {
 		Dependencies: req.Dependencies,
 		Command:      req.Command,
 		Timeout:      req.Timeout,
+		Resources:    resources,
+		Isolation:    req.Isolation,
+		Runtime:      runtimeName,
+		CaptureOutputs: req.CaptureOutputs,
+		Artifacts:    req.Artifacts,
+		Network:      req.Network,
+		DockerNetwork: dockerNetwork,
 	}
 	
 	// Get runtime
 	runtime, exists := runtimes[strings.ToLower(req.Language)]
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported language"})
+		apierror.RespondError(c, apierror.Validation("unsupported language"))
 		return
 	}
 	
@@ -638,6 +859,8 @@ func handleExecuteProject(c *gin.Context) {
 		ID:        execReq.ID,
 		Status:    "running",
 		StartedAt: time.Now(),
+		Resources: resources,
+		Runtime:   runtimeName,
 	}
 	
 	// Store and execute
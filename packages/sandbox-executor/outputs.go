@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxCaptureBytes caps the total size of captured output files unless
+// SANDBOX_MAX_CAPTURE_BYTES says otherwise
+const DefaultMaxCaptureBytes = 5 << 20
+
+// outputsMount is where the container copies the files a run wrote
+const outputsMount = "/out"
+
+// captureMarker is written to the workspace just before the container
+// starts. Files newer than it were written by the run. Its time comes from
+// the host so coarse file timestamps can't make a run's first writes look
+// as old as the marker.
+const captureMarker = ".sandbox-start"
+
+// OutputFile is a file a program wrote that matched CaptureOutputs
+type OutputFile struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Encoding string `json:"encoding"` // utf-8 or base64
+	Content  string `json:"content"`
+}
+
+var maxCaptureBytes = loadByteLimit("SANDBOX_MAX_CAPTURE_BYTES", DefaultMaxCaptureBytes)
+
+// loadByteLimit reads a positive byte count from the environment variable
+// name, keeping def if it is unset or invalid
+func loadByteLimit(name string, def int64) int64 {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+		logger.WithField("value", v).Warn("Invalid " + name + ", using default")
+	}
+	return def
+}
+
+// validateCaptureGlobs rejects patterns of the option filepath.Match can't
+// use
+func validateCaptureGlobs(option string, globs []string) error {
+	for _, glob := range globs {
+		if glob == "" {
+			return fmt.Errorf("%s patterns must not be empty", option)
+		}
+		if _, err := filepath.Match(strings.TrimSuffix(glob, "/**"), ""); err != nil {
+			return fmt.Errorf("invalid %s pattern %q", option, glob)
+		}
+	}
+	return nil
+}
+
+// matchesCapture reports whether a path relative to the working directory
+// matches one of the globs. A pattern ending in "/**" matches everything
+// under that directory.
+func matchesCapture(globs []string, path string) bool {
+	for _, glob := range globs {
+		if dir, ok := strings.CutSuffix(glob, "/**"); ok {
+			if strings.HasPrefix(path, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(glob, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCaptureMarker marks the time before the run starts
+func writeCaptureMarker(workspace string) error {
+	return os.WriteFile(filepath.Join(workspace, captureMarker), nil, 0644)
+}
+
+// captureScript wraps the run script so that, after it exits, files created
+// or changed during the run are copied to outputsMount. The script runs in
+// a subshell so an explicit exit doesn't skip the copy; its exit code is
+// kept.
+func captureScript(script string) string {
+	return "(" + script + "); status=$?; " +
+		"(find . -type f -newer /src/" + captureMarker + " | tar -cf - -T - | tar -xof - -C " + outputsMount + ") 2>/dev/null; " +
+		"exit $status"
+}
+
+// collectOutputs reads the captured files matching the globs, in path order,
+// until maxCaptureBytes is reached. Files past the cap are reported as
+// skipped.
+func collectOutputs(dir string, globs []string) (outputs []OutputFile, skipped []string, err error) {
+	var total int64
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Only regular files; never follow links the program left behind
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !matchesCapture(globs, rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if total+info.Size() > maxCaptureBytes {
+			skipped = append(skipped, rel)
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		total += int64(len(data))
+
+		file := OutputFile{Path: rel, Size: int64(len(data)), Encoding: "utf-8"}
+		if utf8.Valid(data) && !strings.ContainsRune(string(data), 0) {
+			file.Content = string(data)
+		} else {
+			file.Encoding = "base64"
+			file.Content = base64.StdEncoding.EncodeToString(data)
+		}
+		outputs = append(outputs, file)
+		return nil
+	})
+	return outputs, skipped, err
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for path, content := range files {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func setMaxCaptureBytes(t *testing.T, n int64) {
+	t.Helper()
+	previous := maxCaptureBytes
+	maxCaptureBytes = n
+	t.Cleanup(func() { maxCaptureBytes = previous })
+}
+
+func TestMatchesCapture(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"*.json", "report.json", true},
+		{"*.json", "out/report.json", false},
+		{"out/*.csv", "out/data.csv", true},
+		{"out/**", "out/a/b/c.txt", true},
+		{"out/**", "output/c.txt", false},
+		{"out/**", "out", false},
+		{"result.txt", "result.txt", true},
+		{"../*", "secret.txt", false},
+	}
+	for _, tt := range tests {
+		if got := matchesCapture([]string{tt.glob}, tt.path); got != tt.want {
+			t.Errorf("matchesCapture(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCaptureGlobs(t *testing.T) {
+	if err := validateCaptureGlobs("capture_outputs", []string{"*.json", "out/**", "data/?.csv"}); err != nil {
+		t.Errorf("valid patterns: %v", err)
+	}
+	for _, globs := range [][]string{{""}, {"out/[.txt"}, {"*.json", "[a-"}} {
+		err := validateCaptureGlobs("capture_outputs", globs)
+		if err == nil || !strings.Contains(err.Error(), "capture_outputs") {
+			t.Errorf("%q: err = %v, want one naming capture_outputs", globs, err)
+		}
+	}
+}
+
+func TestCollectOutputs(t *testing.T) {
+	dir := t.TempDir()
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+	writeFiles(t, dir, map[string][]byte{
+		"report.json":      []byte(`{"ok": true}`),
+		"out/chart.png":    binary,
+		"out/deep/log.txt": []byte("héllo"),
+		"main.py":          []byte("print(1)"),
+	})
+
+	outputs, skipped, err := collectOutputs(dir, []string{"*.json", "out/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 0 {
+		t.Errorf("skipped = %v, want none", skipped)
+	}
+	want := []OutputFile{
+		{Path: "out/chart.png", Size: int64(len(binary)), Encoding: "base64", Content: base64.StdEncoding.EncodeToString(binary)},
+		{Path: "out/deep/log.txt", Size: 6, Encoding: "utf-8", Content: "héllo"},
+		{Path: "report.json", Size: 12, Encoding: "utf-8", Content: `{"ok": true}`},
+	}
+	if len(outputs) != len(want) {
+		t.Fatalf("outputs = %+v, want %+v", outputs, want)
+	}
+	for i := range want {
+		if outputs[i] != want[i] {
+			t.Errorf("outputs[%d] = %+v, want %+v", i, outputs[i], want[i])
+		}
+	}
+}
+
+func TestCollectOutputsSizeCap(t *testing.T) {
+	setMaxCaptureBytes(t, 10)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{
+		"a.txt": []byte("123456"),
+		"b.txt": []byte("123456"),
+		"c.txt": []byte("1234"),
+	})
+
+	outputs, skipped, err := collectOutputs(dir, []string{"*.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b doesn't fit after a, but the smaller c still does
+	if len(outputs) != 2 || outputs[0].Path != "a.txt" || outputs[1].Path != "c.txt" {
+		t.Errorf("outputs = %+v, want a and c", outputs)
+	}
+	if len(skipped) != 1 || skipped[0] != "b.txt" {
+		t.Errorf("skipped = %v, want b", skipped)
+	}
+}
+
+func TestCollectOutputsStaysInDirectory(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "out")
+	writeFiles(t, root, map[string][]byte{
+		"secret.txt":     []byte("host secret"),
+		"secrets/key":    []byte("host key"),
+		"out/result.txt": []byte("42"),
+	})
+	// Links a program leaves behind point outside the capture directory
+	if err := os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(dir, "leak.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "secrets"), filepath.Join(dir, "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs, _, err := collectOutputs(dir, []string{"*.txt", "linked/**", "../*", "../secrets/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || outputs[0].Path != "result.txt" {
+		t.Errorf("outputs = %+v, want only result.txt", outputs)
+	}
+}
+
+// TestCaptureScript runs the capture wrapper with the container's /src and
+// /out paths pointed at temporary directories
+func TestCaptureScript(t *testing.T) {
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar is not installed")
+	}
+	src, app, out := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFiles(t, app, map[string][]byte{"input.txt": []byte("old")})
+	if err := writeCaptureMarker(src); err != nil {
+		t.Fatal(err)
+	}
+
+	script := captureScript("mkdir -p out && echo new > out/result.txt && exit 3")
+	script = strings.NewReplacer("/src/", src+"/", outputsMount, out).Replace(script)
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = app
+	err := cmd.Run()
+	if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 3 {
+		t.Fatalf("err = %v, want the program's exit status 3", err)
+	}
+
+	outputs, _, err := collectOutputs(out, []string{"*", "out/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || outputs[0].Path != "out/result.txt" || outputs[0].Content != "new\n" {
+		t.Errorf("outputs = %+v, want only the file the run wrote", outputs)
+	}
+}
+
+func TestDockerCommandMountsOutputs(t *testing.T) {
+	req := ExecutionRequest{
+		Language:  "python",
+		Resources: ResourceLimits{CPULimit: "1", MemoryLimit: "512m", DiskLimit: "256m", PIDsLimit: 128},
+	}
+	cmd := buildDockerCommand(req, runtimes["python"], "/tmp/src", "/tmp/src/main.py", "/tmp/out")
+	joined := strings.Join(cmd, " ")
+	if !strings.Contains(joined, "-v /tmp/out:"+outputsMount) {
+		t.Errorf("output directory isn't mounted: %s", joined)
+	}
+	script := cmd[len(cmd)-1]
+	if strings.Contains(script, "exec python") || !strings.Contains(script, "-newer /src/"+captureMarker) {
+		t.Errorf("script doesn't capture outputs: %s", script)
+	}
+
+	cmd = buildDockerCommand(req, runtimes["python"], "/tmp/src", "/tmp/src/main.py", "")
+	if joined := strings.Join(cmd, " "); strings.Contains(joined, outputsMount) || strings.Contains(joined, captureMarker) {
+		t.Errorf("capture set up without capture_outputs: %s", joined)
+	}
+}
+
+func TestExecuteRejectsInvalidCaptureGlob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/execute", handleExecute)
+	body := `{"language": "python", "code": "print(1)", "capture_outputs": ["out/[.txt"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/execute", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "capture_outputs") {
+		t.Errorf("response = %d %s, want 400 naming capture_outputs", w.Code, w.Body)
+	}
+}
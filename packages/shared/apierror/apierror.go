@@ -0,0 +1,156 @@
+// Package apierror defines the error response returned by the platform's
+// HTTP services, so clients can handle failures the same way everywhere:
+//
+//	{"error": {"code": "not_found", "message": "...", "details": ..., "request_id": "..."}}
+package apierror
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code classifies an error independently of its message
+type Code string
+
+const (
+	CodeValidation      Code = "validation_error"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodePayloadTooLarge Code = "payload_too_large"
+	CodeUnprocessable   Code = "unprocessable"
+	CodeRateLimited     Code = "rate_limited"
+	CodeInternal        Code = "internal_error"
+	CodeUpstream        Code = "upstream_error"
+	CodeUnavailable     Code = "unavailable"
+	CodeTimeout         Code = "timeout"
+	CodeNotImplemented  Code = "not_implemented"
+)
+
+// statusByCode maps each code to the HTTP status it is served with
+var statusByCode = map[Code]int{
+	CodeValidation:      http.StatusBadRequest,
+	CodeUnauthorized:    http.StatusUnauthorized,
+	CodeForbidden:       http.StatusForbidden,
+	CodeNotFound:        http.StatusNotFound,
+	CodeConflict:        http.StatusConflict,
+	CodePayloadTooLarge: http.StatusRequestEntityTooLarge,
+	CodeUnprocessable:   http.StatusUnprocessableEntity,
+	CodeRateLimited:     http.StatusTooManyRequests,
+	CodeInternal:        http.StatusInternalServerError,
+	CodeUpstream:        http.StatusBadGateway,
+	CodeUnavailable:     http.StatusServiceUnavailable,
+	CodeTimeout:         http.StatusGatewayTimeout,
+	CodeNotImplemented:  http.StatusNotImplemented,
+}
+
+// RequestIDHeader carries the request ID between services and back to clients
+const RequestIDHeader = "X-Request-ID"
+
+// Error is a typed API error
+type Error struct {
+	Code      Code        `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// Response is the JSON body of every error response
+type Response struct {
+	Error *Error `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Status returns the HTTP status for the error's code
+func (e *Error) Status() int {
+	if status, ok := statusByCode[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// WithDetails returns a copy of the error carrying extra context for clients
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// New creates an error with the given code
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Validation reports a malformed or invalid request
+func Validation(message string) *Error { return New(CodeValidation, message) }
+
+// Unauthorized reports a request without valid credentials
+func Unauthorized(message string) *Error { return New(CodeUnauthorized, message) }
+
+// NotFound reports a missing resource
+func NotFound(message string) *Error { return New(CodeNotFound, message) }
+
+// Conflict reports a request that clashes with the current state
+func Conflict(message string) *Error { return New(CodeConflict, message) }
+
+// Unprocessable reports a well-formed request that can't be carried out
+func Unprocessable(message string) *Error { return New(CodeUnprocessable, message) }
+
+// Internal reports a server side failure
+func Internal(message string) *Error { return New(CodeInternal, message) }
+
+// Upstream reports a failure in a dependency the service called
+func Upstream(message string) *Error { return New(CodeUpstream, message) }
+
+// Unavailable reports that the service can't handle requests right now
+func Unavailable(message string) *Error { return New(CodeUnavailable, message) }
+
+// NotImplemented reports a feature this deployment isn't set up to serve
+func NotImplemented(message string) *Error { return New(CodeNotImplemented, message) }
+
+// RespondError writes err as an error response and aborts the request.
+// Errors that aren't *Error are logged and reported as internal errors so
+// their text doesn't leak to clients.
+func RespondError(c *gin.Context, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		log.Printf("Unhandled error on %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+		apiErr = Internal("internal server error")
+	}
+
+	resp := *apiErr
+	resp.RequestID = RequestID(c)
+	c.AbortWithStatusJSON(resp.Status(), Response{Error: &resp})
+}
+
+// RequestID returns the ID of the current request, taken from the context,
+// the request header or the response header, generating one if none is set
+func RequestID(c *gin.Context) string {
+	if id := c.GetString("request_id"); id != "" {
+		return id
+	}
+	if id := c.GetHeader(RequestIDHeader); id != "" {
+		return id
+	}
+	if id := c.Writer.Header().Get(RequestIDHeader); id != "" {
+		return id
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(buf)
+	c.Set("request_id", id)
+	c.Header(RequestIDHeader, id)
+	return id
+}
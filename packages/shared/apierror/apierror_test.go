@@ -0,0 +1,116 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// respond serves a request, carrying requestID if set, whose handler fails
+// with err
+func respond(err error, requestID string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.GET("/",
+		func(c *gin.Context) { RespondError(c, err) },
+		// Handlers after an error must not run
+		func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) },
+	)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// decode parses a response body, requiring exactly the documented shape
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", w.Body, err)
+	}
+	if len(body) != 1 || body["error"] == nil {
+		t.Fatalf("body = %s, want a single \"error\" object", w.Body)
+	}
+	for key := range body["error"] {
+		switch key {
+		case "code", "message", "details", "request_id":
+		default:
+			t.Fatalf("unexpected field %q in %s", key, w.Body)
+		}
+	}
+	return body["error"]
+}
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    Code
+		wantMessage string
+		wantDetails string
+	}{
+		{"validation", Validation("name is required"), http.StatusBadRequest, CodeValidation, "name is required", "<nil>"},
+		{"not found", NotFound("Image not found"), http.StatusNotFound, CodeNotFound, "Image not found", "<nil>"},
+		{"conflict", Conflict("already promoted"), http.StatusConflict, CodeConflict, "already promoted", "<nil>"},
+		{"unprocessable", Unprocessable("checksum mismatch"), http.StatusUnprocessableEntity, CodeUnprocessable, "checksum mismatch", "<nil>"},
+		{"upstream", Upstream("Trivy failed"), http.StatusBadGateway, CodeUpstream, "Trivy failed", "<nil>"},
+		{"unavailable", Unavailable("draining"), http.StatusServiceUnavailable, CodeUnavailable, "draining", "<nil>"},
+		{"timeout", New(CodeTimeout, "too slow"), http.StatusGatewayTimeout, CodeTimeout, "too slow", "<nil>"},
+		{"not implemented", NotImplemented("no index"), http.StatusNotImplemented, CodeNotImplemented, "no index", "<nil>"},
+		{"with details", Validation("bad request").WithDetails(map[string]string{"field": "name"}), http.StatusBadRequest, CodeValidation, "bad request", "map[field:name]"},
+		{"wrapped", fmt.Errorf("loading: %w", NotFound("gone")), http.StatusNotFound, CodeNotFound, "gone", "<nil>"},
+		{"unknown code", New(Code("teapot"), "short and stout"), http.StatusInternalServerError, Code("teapot"), "short and stout", "<nil>"},
+		{"plain error is not leaked", errors.New("pq: password authentication failed"), http.StatusInternalServerError, CodeInternal, "internal server error", "<nil>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := respond(tt.err, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+				t.Fatalf("content type = %q", ct)
+			}
+
+			body := decode(t, w)
+			if body["code"] != string(tt.wantCode) || body["message"] != tt.wantMessage {
+				t.Fatalf("error = %v, want code %s, message %q", body, tt.wantCode, tt.wantMessage)
+			}
+			if fmt.Sprint(body["details"]) != tt.wantDetails {
+				t.Fatalf("details = %v, want %s", body["details"], tt.wantDetails)
+			}
+			if id, _ := body["request_id"].(string); id == "" || w.Header().Get(RequestIDHeader) != id {
+				t.Fatalf("request_id = %v, header %q; want the same non-empty ID", body["request_id"], w.Header().Get(RequestIDHeader))
+			}
+		})
+	}
+}
+
+func TestRespondErrorKeepsRequestID(t *testing.T) {
+	w := respond(NotFound("missing"), "req-123")
+	if body := decode(t, w); body["request_id"] != "req-123" {
+		t.Fatalf("request_id = %v, want the caller's req-123", body["request_id"])
+	}
+}
+
+func TestWithDetailsCopies(t *testing.T) {
+	base := Validation("bad")
+	detailed := base.WithDetails("extra")
+	if base.Details != nil || detailed.Details != "extra" || detailed.Message != "bad" {
+		t.Fatalf("base = %+v, detailed = %+v", base, detailed)
+	}
+}
@@ -0,0 +1,228 @@
+// Package authmiddleware authenticates requests to the platform's gin
+// services with per-tenant API keys, so every service checks callers the
+// same way.
+//
+// Callers send their key in the X-API-Key header, or as a bearer token in
+// Authorization. A request with a key the KeyStore knows continues with
+// the key's tenant ID set on the gin and request contexts; any other gets
+// a 401 apierror response. Paths on the allowlist, such as health checks,
+// and CORS preflight requests are served without a key.
+package authmiddleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// Header carries the API key
+const Header = "X-API-Key"
+
+// TenantKey is the gin context key holding the authenticated tenant ID
+const TenantKey = "tenant_id"
+
+// ServiceKeyEnv names the variable holding the key a service sends when it
+// calls other services
+const ServiceKeyEnv = "SERVICE_API_KEY"
+
+// DefaultAllow lists the probe paths served without a key
+var DefaultAllow = []string{"/health", "/healthz", "/ready", "/readyz", "/live", "/livez"}
+
+// KeyStore resolves API keys to the tenant they belong to
+type KeyStore interface {
+	// Tenant returns the tenant ID of key and whether the key is valid
+	Tenant(key string) (string, bool)
+}
+
+// StaticKeys is a KeyStore over a fixed set of keys. Keys are held as
+// SHA-256 digests so lookups don't compare secrets byte by byte.
+type StaticKeys struct {
+	tenants map[[sha256.Size]byte]string
+}
+
+// NewStaticKeys creates a key store from a map of key to tenant ID
+func NewStaticKeys(keys map[string]string) *StaticKeys {
+	s := &StaticKeys{tenants: make(map[[sha256.Size]byte]string, len(keys))}
+	for key, tenant := range keys {
+		s.tenants[sha256.Sum256([]byte(key))] = tenant
+	}
+	return s
+}
+
+// Tenant implements KeyStore
+func (s *StaticKeys) Tenant(key string) (string, bool) {
+	tenant, ok := s.tenants[sha256.Sum256([]byte(key))]
+	return tenant, ok
+}
+
+// Len returns the number of keys
+func (s *StaticKeys) Len() int {
+	return len(s.tenants)
+}
+
+// ParseKeys parses a comma separated list of tenant:key pairs, e.g.
+// "acme:k3y1,globex:k3y2". A tenant may hold several keys so they can be
+// rotated.
+func ParseKeys(spec string) (*StaticKeys, error) {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		tenant, key, ok := strings.Cut(pair, ":")
+		tenant, key = strings.TrimSpace(tenant), strings.TrimSpace(key)
+		if !ok || tenant == "" || key == "" {
+			return nil, fmt.Errorf("API key entry %q is not tenant:key", redact(pair))
+		}
+		if other, dup := keys[key]; dup && other != tenant {
+			return nil, fmt.Errorf("API key of tenant %q is also assigned to %q", tenant, other)
+		}
+		keys[key] = tenant
+	}
+	return NewStaticKeys(keys), nil
+}
+
+// redact keeps the tenant part of a malformed entry for error messages
+func redact(pair string) string {
+	if tenant, _, ok := strings.Cut(pair, ":"); ok {
+		return tenant + ":***"
+	}
+	return "***"
+}
+
+// Config configures the middleware
+type Config struct {
+	Keys KeyStore
+	// Allow lists paths served without a key. An entry ending in "*"
+	// matches every path with that prefix.
+	Allow []string
+	// Disabled lets every request through without a tenant
+	Disabled bool
+}
+
+// FromEnv reads the key store from API_KEYS, as parsed by ParseKeys, and
+// lets AUTH_DISABLED=true turn authentication off for local development.
+// With neither set the store is empty and every request outside the
+// allowlist is rejected. allow is added to DefaultAllow.
+func FromEnv(allow ...string) (Config, error) {
+	cfg := Config{Allow: append(append([]string{}, DefaultAllow...), allow...)}
+
+	if v := os.Getenv("AUTH_DISABLED"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("AUTH_DISABLED: %w", err)
+		}
+		cfg.Disabled = disabled
+	}
+
+	keys, err := ParseKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		return cfg, fmt.Errorf("API_KEYS: %w", err)
+	}
+	cfg.Keys = keys
+	return cfg, nil
+}
+
+// Warning describes a configuration that doesn't protect the service as
+// expected, or returns "" when keys are configured
+func (cfg Config) Warning() string {
+	switch {
+	case cfg.Disabled:
+		return "authentication is disabled, every request is allowed"
+	case cfg.Keys == nil:
+		return "no API key store is configured, every request is rejected"
+	}
+	if keys, ok := cfg.Keys.(*StaticKeys); ok && keys.Len() == 0 {
+		return "API_KEYS is empty, every request is rejected"
+	}
+	return ""
+}
+
+// Middleware rejects requests without a valid API key
+func Middleware(cfg Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Disabled || c.Request.Method == http.MethodOptions || allowed(cfg.Allow, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		key := requestKey(c.Request)
+		if key == "" {
+			apierror.RespondError(c, apierror.Unauthorized("API key required").WithDetails(gin.H{"header": Header}))
+			return
+		}
+		var tenant string
+		ok := false
+		if cfg.Keys != nil {
+			tenant, ok = cfg.Keys.Tenant(key)
+		}
+		if !ok {
+			apierror.RespondError(c, apierror.Unauthorized("invalid API key"))
+			return
+		}
+
+		c.Set(TenantKey, tenant)
+		c.Request = c.Request.WithContext(WithTenant(c.Request.Context(), tenant))
+		c.Next()
+	}
+}
+
+func allowed(allow []string, path string) bool {
+	for _, entry := range allow {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// requestKey returns the key from X-API-Key or a bearer Authorization header
+func requestKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get(Header)); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// SetServiceKey adds the key from SERVICE_API_KEY to an outgoing request to
+// another service, if one is set
+func SetServiceKey(req *http.Request) {
+	if key := os.Getenv(ServiceKeyEnv); key != "" {
+		req.Header.Set(Header, key)
+	}
+}
+
+type tenantContextKey struct{}
+
+// WithTenant returns a context carrying a tenant ID
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant ID set by the middleware, or ""
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// Tenant returns the tenant ID of the current request, or "" when the
+// request wasn't authenticated
+func Tenant(c *gin.Context) string {
+	return c.GetString(TenantKey)
+}
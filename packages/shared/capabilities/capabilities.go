@@ -0,0 +1,128 @@
+// Package capabilities describes the languages, frameworks and project
+// types the generation pipeline supports, so services accept and reject the
+// same requests. The built-in catalog can be replaced by a JSON file, which
+// lets every service share one ConfigMap.
+package capabilities
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Language is a supported language and the frameworks available for it
+type Language struct {
+	Name       string   `json:"name"`
+	Aliases    []string `json:"aliases,omitempty"`
+	Frameworks []string `json:"frameworks"`
+}
+
+// Catalog lists everything generation requests may ask for
+type Catalog struct {
+	Languages    []Language `json:"languages"`
+	ProjectTypes []string   `json:"project_types"`
+}
+
+// Default returns the built-in catalog
+func Default() *Catalog {
+	return &Catalog{
+		Languages: []Language{
+			{Name: "python", Aliases: []string{"py", "python3"}, Frameworks: []string{"fastapi", "flask", "django"}},
+			{Name: "javascript", Aliases: []string{"js", "node", "nodejs"}, Frameworks: []string{"express", "next", "react", "vue"}},
+			{Name: "typescript", Aliases: []string{"ts"}, Frameworks: []string{"express", "nestjs", "next", "react", "angular", "vue"}},
+			{Name: "go", Aliases: []string{"golang"}, Frameworks: []string{"gin", "echo", "fiber"}},
+			{Name: "java", Frameworks: []string{"spring", "quarkus", "micronaut"}},
+			{Name: "rust", Aliases: []string{"rs"}, Frameworks: []string{"actix", "rocket", "warp"}},
+		},
+		ProjectTypes: []string{"api", "web", "webapp", "cli", "library", "function", "microservice", "microservices", "code"},
+	}
+}
+
+// Load reads a catalog from a JSON file, or returns the default catalog
+// when path is empty
+func Load(path string) (*Catalog, error) {
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capabilities: %w", err)
+	}
+
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse capabilities: %w", err)
+	}
+	if len(catalog.Languages) == 0 || len(catalog.ProjectTypes) == 0 {
+		return nil, fmt.Errorf("capabilities file %s must list languages and project_types", path)
+	}
+	return &catalog, nil
+}
+
+// Normalize lower-cases and trims a language, framework or type name
+func Normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Language returns the language named by name or one of its aliases
+func (c *Catalog) Language(name string) (*Language, bool) {
+	name = Normalize(name)
+	for i := range c.Languages {
+		lang := &c.Languages[i]
+		if lang.Name == name {
+			return lang, true
+		}
+		for _, alias := range lang.Aliases {
+			if alias == name {
+				return lang, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// HasProjectType reports whether projectType is supported
+func (c *Catalog) HasProjectType(projectType string) bool {
+	projectType = Normalize(projectType)
+	for _, t := range c.ProjectTypes {
+		if t == projectType {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsFramework reports whether framework is available for the language
+func (l *Language) SupportsFramework(framework string) bool {
+	framework = Normalize(framework)
+	for _, f := range l.Frameworks {
+		if f == framework {
+			return true
+		}
+	}
+	return false
+}
+
+// FrameworkLanguages returns the languages a framework is available for
+func (c *Catalog) FrameworkLanguages(framework string) []string {
+	var languages []string
+	for i := range c.Languages {
+		if c.Languages[i].SupportsFramework(framework) {
+			languages = append(languages, c.Languages[i].Name)
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// LanguageNames returns the canonical names of the supported languages
+func (c *Catalog) LanguageNames() []string {
+	names := make([]string, 0, len(c.Languages))
+	for _, lang := range c.Languages {
+		names = append(names, lang.Name)
+	}
+	return names
+}
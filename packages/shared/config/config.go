@@ -16,6 +16,10 @@ type Config struct {
 	LLM      LLMConfig      `mapstructure:"llm"`
 	Tracing  TracingConfig  `mapstructure:"tracing"`
 	Audit    AuditConfig    `mapstructure:"audit"`
+	Proxy    ProxyConfig    `mapstructure:"proxy"`
+
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Request   RequestConfig   `mapstructure:"request"`
 }
 
 type ServerConfig struct {
@@ -64,6 +68,102 @@ type AuditConfig struct {
 	Level   string `mapstructure:"level"`
 }
 
+// ProxyConfig configures calls a gateway makes to upstream services
+type ProxyConfig struct {
+	Timeout   int                       `mapstructure:"timeout"` // seconds, for upstreams without their own
+	Upstreams map[string]UpstreamConfig `mapstructure:"upstreams"`
+	Breaker   BreakerConfig             `mapstructure:"breaker"`
+	Aggregate AggregateConfig           `mapstructure:"aggregate"`
+	Health    HealthConfig              `mapstructure:"health"`
+}
+
+type UpstreamConfig struct {
+	Timeout int `mapstructure:"timeout"` // seconds
+}
+
+// BreakerConfig sets when an upstream's circuit breaker opens: once at
+// least MinRequests were made in the Interval and the share that failed
+// reaches FailureRate. It stays open for OpenTimeout, then lets
+// HalfOpenRequests through to probe the upstream.
+type BreakerConfig struct {
+	MinRequests      uint32  `mapstructure:"min_requests"`
+	FailureRate      float64 `mapstructure:"failure_rate"`
+	Interval         int     `mapstructure:"interval"`     // seconds
+	OpenTimeout      int     `mapstructure:"open_timeout"` // seconds
+	HalfOpenRequests uint32  `mapstructure:"half_open_requests"`
+}
+
+// AggregateConfig configures endpoints that combine several upstreams into
+// one response. Timeout is the deadline shared by all of the calls; CacheTTL
+// is how long, in seconds, a complete result is reused.
+type AggregateConfig struct {
+	Timeout  int `mapstructure:"timeout"`
+	CacheTTL int `mapstructure:"cache_ttl"`
+}
+
+// RateLimitConfig configures a gateway's per-client rate limits. Groups
+// are keyed by route group name; routes in a group without its own entry
+// use "default". Clients listed in Bypass, by their rate limit subject (for
+// example an internal service's spiffe:// identity), are never limited.
+type RateLimitConfig struct {
+	Enabled bool                     `mapstructure:"enabled"`
+	Groups  map[string]RateLimitRule `mapstructure:"groups"`
+	Bypass  []string                 `mapstructure:"bypass"`
+}
+
+// RateLimitRule is a token bucket refilled with Requests tokens every
+// Period seconds and holding at most Burst tokens, or Requests if Burst is
+// unset
+type RateLimitRule struct {
+	Requests int `mapstructure:"requests"`
+	Period   int `mapstructure:"period"` // seconds
+	Burst    int `mapstructure:"burst"`
+}
+
+// RequestConfig limits the bodies a gateway accepts before proxying them.
+// MaxBodyBytes applies to route groups without their own entry in Groups; a
+// limit of zero or less disables the cap. Routes with a schema validate
+// their bodies against it when ValidateSchemas is set.
+type RequestConfig struct {
+	MaxBodyBytes    int64            `mapstructure:"max_body_bytes"`
+	Groups          map[string]int64 `mapstructure:"groups"`
+	ValidateSchemas bool             `mapstructure:"validate_schemas"`
+}
+
+// BodyLimit returns the maximum body size for a route group
+func (r RequestConfig) BodyLimit(group string) int64 {
+	if limit, ok := r.Groups[group]; ok {
+		return limit
+	}
+	return r.MaxBodyBytes
+}
+
+// Rule returns the limit for a route group
+func (r RateLimitConfig) Rule(group string) (RateLimitRule, bool) {
+	if rule, ok := r.Groups[group]; ok && rule.Requests > 0 && rule.Period > 0 {
+		return rule, true
+	}
+	rule, ok := r.Groups["default"]
+	return rule, ok && rule.Requests > 0 && rule.Period > 0
+}
+
+// HealthConfig configures a gateway's aggregated health check. Every
+// upstream's /health gets Timeout milliseconds to answer. If any of the
+// Critical upstreams, by their key under upstreams, is down the gateway is
+// unavailable; any other failed probe only makes it degraded.
+type HealthConfig struct {
+	Timeout  int      `mapstructure:"timeout"`
+	Critical []string `mapstructure:"critical"`
+}
+
+// UpstreamTimeout returns the timeout for an upstream in seconds
+func (p ProxyConfig) UpstreamTimeout(name string) int {
+	if upstream, ok := p.Upstreams[name]; ok && upstream.Timeout > 0 {
+		return upstream.Timeout
+	}
+	return p.Timeout
+}
+
 // Load loads configuration from environment variables and config files
 func Load(serviceName string) (*Config, error) {
 	v := viper.New()
@@ -99,6 +199,36 @@ func Load(serviceName string) (*Config, error) {
 	v.SetDefault("audit.log_path", "/var/log/audit")
 	v.SetDefault("audit.level", "info")
 
+	// Workflow generation may long-poll for up to two minutes
+	v.SetDefault("proxy.timeout", 30)
+	v.SetDefault("proxy.upstreams.workflow_api.timeout", 130)
+	v.SetDefault("proxy.upstreams.llm_router.timeout", 90)
+	v.SetDefault("proxy.upstreams.agent_orchestrator.timeout", 60)
+	v.SetDefault("proxy.upstreams.meta_prompt_engine.timeout", 30)
+	v.SetDefault("proxy.upstreams.parser.timeout", 30)
+	v.SetDefault("proxy.breaker.min_requests", 10)
+	v.SetDefault("proxy.breaker.failure_rate", 0.5)
+	v.SetDefault("proxy.breaker.interval", 60)
+	v.SetDefault("proxy.breaker.open_timeout", 30)
+	v.SetDefault("proxy.breaker.half_open_requests", 3)
+	v.SetDefault("proxy.aggregate.timeout", 10)
+	v.SetDefault("proxy.aggregate.cache_ttl", 3)
+	v.SetDefault("proxy.health.timeout", 1500)
+	v.SetDefault("proxy.health.critical", []string{"workflow_api", "llm_router"})
+
+	v.SetDefault("rate_limit.enabled", true)
+	v.SetDefault("rate_limit.groups.generate.requests", 10)
+	v.SetDefault("rate_limit.groups.generate.period", 60)
+	v.SetDefault("rate_limit.groups.read.requests", 120)
+	v.SetDefault("rate_limit.groups.read.period", 60)
+	v.SetDefault("rate_limit.groups.default.requests", 60)
+	v.SetDefault("rate_limit.groups.default.period", 60)
+
+	v.SetDefault("request.max_body_bytes", 1<<20)
+	v.SetDefault("request.groups.generate", 256<<10)
+	v.SetDefault("request.groups.llm", 512<<10)
+	v.SetDefault("request.validate_schemas", true)
+
 	// Read from environment variables
 	v.SetEnvPrefix(strings.ToUpper(strings.ReplaceAll(serviceName, "-", "_")))
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
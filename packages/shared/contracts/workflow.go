@@ -0,0 +1,99 @@
+// Package contracts holds the request and response bodies of the platform's
+// public HTTP APIs. The services that serve an endpoint bind and write these
+// types, and api-docs generates the published OpenAPI spec from them, so the
+// documentation follows the wire format instead of a copy of it.
+package contracts
+
+import (
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/capabilities"
+)
+
+// CodeGenerationRequest starts a code generation workflow
+type CodeGenerationRequest struct {
+	ID            string                 `json:"id,omitempty"`
+	Prompt        string                 `json:"prompt" binding:"required" example:"Create a REST API with user authentication"`
+	Language      string                 `json:"language" binding:"required" example:"python"`
+	Framework     string                 `json:"framework,omitempty" example:"fastapi"`
+	Type          string                 `json:"type" binding:"required" example:"api"`
+	GenerateTests bool                   `json:"generate_tests,omitempty"`
+	GenerateDocs  bool                   `json:"generate_docs,omitempty"`
+	Requirements  map[string]interface{} `json:"requirements,omitempty"`
+
+	// Optional URL to POST the outcome to once the workflow closes, signed
+	// with CallbackSecret when set
+	CallbackURL    string `json:"callback_url,omitempty"`
+	CallbackSecret string `json:"callback_secret,omitempty"`
+
+	// AutoPackage builds a downloadable capsule once the workflow completes
+	AutoPackage bool `json:"auto_package,omitempty"`
+}
+
+// WorkflowResponse reports a workflow that was started, stopped or is still
+// running
+type WorkflowResponse struct {
+	WorkflowID string `json:"workflow_id" example:"code-gen-3f2a"`
+	RunID      string `json:"run_id"`
+	Status     string `json:"status" example:"started"`
+	Message    string `json:"message"`
+	// AlreadyRunning is set when the request repeated the ID or
+	// Idempotency-Key of a workflow already started, which is returned
+	// instead of a new one
+	AlreadyRunning bool `json:"already_running,omitempty"`
+}
+
+// WorkflowResult is returned instead of a WorkflowResponse when a generate
+// request waited for the workflow and it completed in time
+type WorkflowResult struct {
+	WorkflowID string       `json:"workflow_id"`
+	RunID      string       `json:"run_id"`
+	Status     string       `json:"status" example:"completed"`
+	Result     interface{}  `json:"result"`
+	Capsule    *CapsuleInfo `json:"capsule,omitempty"`
+}
+
+// CapsuleInfo reports the capsule built for a workflow started with
+// auto_package. A capsule that couldn't be built doesn't fail the workflow;
+// the builder's error is reported here instead.
+type CapsuleInfo struct {
+	Status      string `json:"status" enums:"pending,packaged,failed"`
+	CapsuleID   string `json:"capsule_id,omitempty"`
+	DownloadURL string `json:"download_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// TerminateRequest gives the reason recorded in the workflow history
+type TerminateRequest struct {
+	Reason string `json:"reason"`
+}
+
+// StageProgress reports one stage of a workflow
+type StageProgress struct {
+	Name         string     `json:"name"`
+	Status       string     `json:"status" enums:"completed,active,pending,skipped"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	Drops        int        `json:"drops"`
+	ArtifactSize int        `json:"artifact_size"`
+}
+
+// WorkflowProgress is the response of the progress endpoint
+type WorkflowProgress struct {
+	WorkflowID   string          `json:"workflow_id"`
+	WorkflowType string          `json:"workflow_type"`
+	Status       string          `json:"status"`
+	StartTime    *time.Time      `json:"start_time,omitempty"`
+	CloseTime    *time.Time      `json:"close_time,omitempty"`
+	Percentage   int             `json:"percentage"`
+	Stages       []StageProgress `json:"stages"`
+	DropsError   string          `json:"drops_error,omitempty"`
+	Capsule      *CapsuleInfo    `json:"capsule,omitempty"`
+}
+
+// Capabilities lists what generation requests may ask for
+type Capabilities struct {
+	Languages      []capabilities.Language `json:"languages"`
+	ProjectTypes   []string                `json:"project_types"`
+	MaxPromptBytes int                     `json:"max_prompt_bytes"`
+}
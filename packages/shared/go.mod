@@ -3,6 +3,7 @@ module github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared
 go 1.21
 
 require (
+	github.com/gin-gonic/gin v1.9.1
 	github.com/sirupsen/logrus v1.9.3
 	github.com/sony/gobreaker v0.5.0
 	go.opentelemetry.io/otel v1.19.0
@@ -0,0 +1,192 @@
+// Package logging builds JSON structured loggers for the platform's
+// services, so log aggregators see the same fields everywhere.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// New returns a JSON logger tagged with the service name. The level is read
+// from LOG_LEVEL and defaults to info.
+func New(service string) *logrus.Entry {
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+	logger.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+
+	logger.SetLevel(logrus.InfoLevel)
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if level, err := logrus.ParseLevel(strings.ToLower(v)); err == nil {
+			logger.SetLevel(level)
+		} else {
+			logger.WithField("log_level", v).Warn("Unknown LOG_LEVEL, using info")
+		}
+	}
+
+	return logger.WithField("service", service)
+}
+
+// Content describes sensitive content such as submitted code by its size
+// and hash. The content itself is only included at debug level.
+func Content(logger *logrus.Entry, key, content string) logrus.Fields {
+	sum := sha256.Sum256([]byte(content))
+	fields := logrus.Fields{
+		key + "_bytes":  len(content),
+		key + "_sha256": hex.EncodeToString(sum[:8]),
+	}
+	if logger.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		fields[key] = content
+	}
+	return fields
+}
+
+// UpstreamKey is the gin context key a proxying handler sets to the name of
+// the service it forwarded the request to, for the request's log line
+const UpstreamKey = "upstream_service"
+
+// Middleware logs one line per request. Health and readiness checks are
+// logged at debug level so probes don't drown out real traffic.
+func Middleware(logger *logrus.Entry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		entry := ForRequest(logger, c).WithFields(logrus.Fields{
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"status":     c.Writer.Status(),
+			"latency_ms": time.Since(start).Milliseconds(),
+			"client_ip":  c.ClientIP(),
+		})
+		if upstream := c.GetString(UpstreamKey); upstream != "" {
+			entry = entry.WithField("upstream_service", upstream)
+		}
+		if len(c.Errors) > 0 {
+			entry = entry.WithField("errors", c.Errors.String())
+		}
+
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			entry.Error("Request failed")
+		case status >= 400:
+			entry.Warn("Request rejected")
+		case c.Request.URL.Path == "/health" || c.Request.URL.Path == "/ready":
+			entry.Debug("Request handled")
+		default:
+			entry.Info("Request handled")
+		}
+	}
+}
+
+// requestID is the ID a handler responded with, or else the one a caller
+// such as the API gateway sent, so one ID follows a request across services
+func requestID(c *gin.Context) string {
+	if id := c.Writer.Header().Get(RequestIDHeader); id != "" {
+		return id
+	}
+	if id := c.GetString(RequestIDKey); id != "" {
+		return id
+	}
+	return c.GetHeader(RequestIDHeader)
+}
+
+// RequestIDHeader carries a request's correlation ID between services and
+// back to clients
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the gin context key holding the request ID. apierror
+// reads the same key, so error responses carry the ID too.
+const RequestIDKey = "request_id"
+
+// maxRequestIDLength bounds IDs taken from callers
+const maxRequestIDLength = 128
+
+// RequestID gives every request a correlation ID: the caller's X-Request-ID,
+// or a new one when it is missing or malformed. The ID is set on the gin and
+// request contexts and the request headers, for handlers and calls they
+// make to other services, and echoed in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.TrimSpace(c.GetHeader(RequestIDHeader))
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set(RequestIDKey, id)
+		c.Request.Header.Set(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// validRequestID accepts IDs of printable ASCII up to maxRequestIDLength
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// randomSource supplies request IDs
+var randomSource io.Reader = rand.Reader
+
+// newRequestID returns a random ID, or one taken from the clock if the
+// random source fails, so every request still gets an ID
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(randomSource, buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a context carrying a request ID, for work that
+// outlives the request such as background deliveries
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID set by RequestID, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// ForRequest returns logger tagged with the request's ID and tenant, so
+// every line a handler logs can be traced back to the request
+func ForRequest(logger *logrus.Entry, c *gin.Context) *logrus.Entry {
+	entry := logger
+	if id := requestID(c); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	if tenant := c.GetString("tenant_id"); tenant != "" {
+		entry = entry.WithField("tenant_id", tenant)
+	}
+	return entry
+}
+
+// FromContext returns logger tagged with the request ID carried by ctx, if
+// any
+func FromContext(logger *logrus.Entry, ctx context.Context) *logrus.Entry {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return logger.WithField("request_id", id)
+	}
+	return logger
+}
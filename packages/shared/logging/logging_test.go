@@ -0,0 +1,199 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// captured returns a logger like New's writing to a buffer, and a function
+// decoding the JSON lines written so far
+func captured(t *testing.T, level string) (*bytes.Buffer, func() []map[string]interface{}) {
+	t.Helper()
+	t.Setenv("LOG_LEVEL", level)
+	var buf bytes.Buffer
+	return &buf, func() []map[string]interface{} {
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+		for scanner.Scan() {
+			var line map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("log line %q is not JSON: %v", scanner.Text(), err)
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+}
+
+func TestContentIsHashedUnlessDebug(t *testing.T) {
+	code := "print('secret')"
+	tests := []struct {
+		level    string
+		wantCode bool
+	}{
+		{"info", false},
+		{"warn", false},
+		{"debug", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			buf, lines := captured(t, tt.level)
+			logger := New("sandbox-executor")
+			logger.Logger.SetOutput(buf)
+
+			logger.WithFields(Content(logger, "code", code)).Warn("Executing code")
+			got := lines()
+			if len(got) != 1 {
+				t.Fatalf("got %d log lines, want 1", len(got))
+			}
+			line := got[0]
+			if line["service"] != "sandbox-executor" || line["level"] != "warning" || line["msg"] != "Executing code" {
+				t.Errorf("line = %v", line)
+			}
+			if line["code_bytes"] != float64(len(code)) || line["code_sha256"] != "3c59a50dd5ce110c" {
+				t.Errorf("code_bytes %v, code_sha256 %v", line["code_bytes"], line["code_sha256"])
+			}
+			if _, ok := line["code"]; ok != tt.wantCode {
+				t.Errorf("code logged = %v, want %v", ok, tt.wantCode)
+			}
+			if !tt.wantCode && strings.Contains(buf.String(), "secret") {
+				t.Errorf("code leaked into the log: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestNewUnknownLevel(t *testing.T) {
+	buf, lines := captured(t, "verbose")
+	logger := New("capsule-builder")
+	logger.Logger.SetOutput(buf)
+
+	if level := logger.Logger.GetLevel().String(); level != "info" {
+		t.Errorf("level = %s, want info", level)
+	}
+	logger.Debug("dropped")
+	logger.Info("kept")
+	if got := lines(); len(got) != 1 || got[0]["msg"] != "kept" {
+		t.Errorf("lines = %v, want only the info line", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	buf, lines := captured(t, "info")
+	logger := New("capsule-builder")
+	logger.Logger.SetOutput(buf)
+
+	r := gin.New()
+	r.Use(Middleware(logger))
+	r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/api/v1/capsules", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	r.GET("/api/v1/capsules/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/health", nil),
+		httptest.NewRequest(http.MethodPost, "/api/v1/capsules", nil),
+		httptest.NewRequest(http.MethodGet, "/api/v1/capsules/missing", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Health checks are only logged at debug level
+	got := lines()
+	if len(got) != 2 {
+		t.Fatalf("got %d lines, want 2: %v", len(got), got)
+	}
+	for i, want := range []struct {
+		method, path, level string
+		status              float64
+	}{
+		{"POST", "/api/v1/capsules", "info", 201},
+		{"GET", "/api/v1/capsules/missing", "warning", 404},
+	} {
+		line := got[i]
+		if line["method"] != want.method || line["path"] != want.path || line["level"] != want.level ||
+			line["status"] != want.status || line["service"] != "capsule-builder" {
+			t.Errorf("line %d = %v", i, line)
+		}
+		if _, ok := line["latency_ms"]; !ok {
+			t.Errorf("line %d has no latency_ms", i)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name, sent string
+		keep       bool
+	}{
+		{"caller ID", "gw-7f3a", true},
+		{"missing", "", false},
+		{"forged log fields", "abc\" level=error msg=\"forged", false},
+		{"newline", "abc\ndef", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, lines := captured(t, "info")
+			logger := New("quantum-drops")
+			logger.Logger.SetOutput(buf)
+
+			var inHandler, inHeader, inContext string
+			r := gin.New()
+			r.Use(RequestID(), Middleware(logger))
+			r.GET("/drops", func(c *gin.Context) {
+				inHandler = c.GetString(RequestIDKey)
+				inHeader = c.Request.Header.Get(RequestIDHeader)
+				inContext = RequestIDFromContext(c.Request.Context())
+				c.Set(UpstreamKey, "capsule-builder")
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/drops", nil)
+			req.Header[http.CanonicalHeaderKey(RequestIDHeader)] = []string{tt.sent}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.keep && id != tt.sent {
+				t.Errorf("response ID = %q, want the caller's %q", id, tt.sent)
+			}
+			if !tt.keep && (!validRequestID(id) || id == tt.sent) {
+				t.Errorf("response ID = %q, want a new ID", id)
+			}
+			if inHandler != id || inHeader != id || inContext != id {
+				t.Errorf("handler saw %q, header %q, context %q; response %q", inHandler, inHeader, inContext, id)
+			}
+			line := lines()[0]
+			if line["request_id"] != id || line["upstream_service"] != "capsule-builder" {
+				t.Errorf("log line = %v", line)
+			}
+		})
+	}
+}
+
+// failingReader fails every read, like an exhausted random source
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, io.ErrUnexpectedEOF }
+
+func TestNewRequestIDWithoutRandomness(t *testing.T) {
+	if id := newRequestID(); len(id) != 32 {
+		t.Errorf("random ID %q, want 32 hex characters", id)
+	}
+
+	defer func(r io.Reader) { randomSource = r }(randomSource)
+	randomSource = failingReader{}
+	if id := newRequestID(); !validRequestID(id) {
+		t.Errorf("fallback ID %q is not a valid request ID", id)
+	}
+}
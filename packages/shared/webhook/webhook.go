@@ -0,0 +1,182 @@
+// Package webhook delivers signed JSON payloads to subscriber URLs with
+// bounded retries and exponential backoff, so every service sends webhooks
+// and callbacks the same way.
+//
+// Each delivery carries <prefix>-Event and, when set, <prefix>-Delivery and
+// <prefix>-Signature headers. The signature is "sha256=" followed by the hex
+// HMAC-SHA256 of the body keyed by the subscriber's secret. Network errors,
+// 5xx and 429 responses are retried; other client errors are not.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = 2 * time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// Config holds sender configuration
+type Config struct {
+	// HeaderPrefix names the headers, e.g. "X-Registry" for X-Registry-Event
+	HeaderPrefix string
+	MaxAttempts  int
+	// Backoff is the wait before the first retry; it doubles on each attempt
+	// up to MaxBackoff, or without limit when MaxBackoff is zero
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	HTTPClient *http.Client
+
+	// Sleep waits between attempts; it defaults to a timer that stops early
+	// when the context is done
+	Sleep func(ctx context.Context, d time.Duration) error
+	// OnRetry is called before waiting to retry a failed attempt
+	OnRetry func(delivery Delivery, attempt int, wait time.Duration, err error)
+}
+
+// Delivery is one payload to send
+type Delivery struct {
+	URL    string
+	Secret string
+	Event  string
+	// ID identifies the delivery; it stays the same across retries so
+	// receivers can deduplicate
+	ID   string
+	Body []byte
+}
+
+// Error is a failed delivery attempt
+type Error struct {
+	StatusCode int // 0 when no response was received
+	Retryable  bool
+	Err        error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Sender delivers webhooks
+type Sender struct {
+	headerPrefix string
+	maxAttempts  int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	httpClient   *http.Client
+	sleep        func(ctx context.Context, d time.Duration) error
+	onRetry      func(delivery Delivery, attempt int, wait time.Duration, err error)
+}
+
+// New creates a sender, filling in defaults for unset fields
+func New(config Config) *Sender {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = DefaultBackoff
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	if config.Sleep == nil {
+		config.Sleep = sleep
+	}
+
+	return &Sender{
+		headerPrefix: config.HeaderPrefix,
+		maxAttempts:  config.MaxAttempts,
+		backoff:      config.Backoff,
+		maxBackoff:   config.MaxBackoff,
+		httpClient:   config.HTTPClient,
+		sleep:        config.Sleep,
+		onRetry:      config.OnRetry,
+	}
+}
+
+// Send delivers a payload, retrying failed attempts with exponential
+// backoff. It returns the number of attempts made and, on failure, the last
+// attempt's *Error or the context's error.
+func (s *Sender) Send(ctx context.Context, delivery Delivery) (int, error) {
+	wait := s.backoff
+
+	for attempt := 1; ; attempt++ {
+		err := s.Post(ctx, delivery)
+		if err == nil {
+			return attempt, nil
+		}
+		if !err.Retryable || attempt >= s.maxAttempts {
+			return attempt, err
+		}
+
+		if s.onRetry != nil {
+			s.onRetry(delivery, attempt, wait, err)
+		}
+		if err := s.sleep(ctx, wait); err != nil {
+			return attempt, err
+		}
+		wait *= 2
+		if s.maxBackoff > 0 && wait > s.maxBackoff {
+			wait = s.maxBackoff
+		}
+	}
+}
+
+// Post makes a single delivery attempt
+func (s *Sender) Post(ctx context.Context, delivery Delivery) *Error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return &Error{Err: fmt.Errorf("failed to create webhook request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(s.headerPrefix+"-Event", delivery.Event)
+	if delivery.ID != "" {
+		req.Header.Set(s.headerPrefix+"-Delivery", delivery.ID)
+	}
+	if delivery.Secret != "" {
+		req.Header.Set(s.headerPrefix+"-Signature", "sha256="+Sign(delivery.Secret, delivery.Body))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return &Error{Retryable: true, Err: fmt.Errorf("webhook request failed: %w", err)}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &Error{
+		StatusCode: resp.StatusCode,
+		Retryable:  resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		Err:        fmt.Errorf("webhook returned status %d", resp.StatusCode),
+	}
+}
+
+// Sign is the hex HMAC-SHA256 of body keyed by secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver answers each request with the next status in statuses, repeating
+// the last one, and records what it received
+type receiver struct {
+	statuses []int
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	n := len(r.requests)
+	r.mu.Unlock()
+
+	status := r.statuses[len(r.statuses)-1]
+	if n <= len(r.statuses) {
+		status = r.statuses[n-1]
+	}
+	w.WriteHeader(status)
+}
+
+// newSender returns a sender that records its waits instead of sleeping
+func newSender(maxBackoff time.Duration) (*Sender, *[]time.Duration) {
+	var waits []time.Duration
+	return New(Config{
+		HeaderPrefix: "X-Test",
+		MaxAttempts:  4,
+		Backoff:      time.Second,
+		MaxBackoff:   maxBackoff,
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		},
+	}), &waits
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	recv := &receiver{statuses: []int{http.StatusOK}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	sender, _ := newSender(0)
+	body := []byte(`{"event":"scan.completed"}`)
+	attempts, err := sender.Send(context.Background(), Delivery{
+		URL: srv.URL, Secret: "s3cret", Event: "scan.completed", ID: "dlv-1", Body: body,
+	})
+	if err != nil || attempts != 1 {
+		t.Fatalf("Send = %d attempts, %v; want 1, nil", attempts, err)
+	}
+
+	req := recv.requests[0]
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := req.Header.Get("X-Test-Signature"); got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+	if req.Header.Get("X-Test-Event") != "scan.completed" || req.Header.Get("X-Test-Delivery") != "dlv-1" {
+		t.Fatalf("headers = %v", req.Header)
+	}
+	if req.Header.Get("Content-Type") != "application/json" || string(recv.bodies[0]) != string(body) {
+		t.Fatalf("content type %q, body %q", req.Header.Get("Content-Type"), recv.bodies[0])
+	}
+}
+
+func TestSendWithoutSecretIsUnsigned(t *testing.T) {
+	recv := &receiver{statuses: []int{http.StatusNoContent}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	sender, _ := newSender(0)
+	if _, err := sender.Send(context.Background(), Delivery{URL: srv.URL, Event: "e", Body: []byte("{}")}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if sig, id := recv.requests[0].Header.Get("X-Test-Signature"), recv.requests[0].Header.Get("X-Test-Delivery"); sig != "" || id != "" {
+		t.Fatalf("signature %q, delivery %q; want neither", sig, id)
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxBackoff   time.Duration
+		wantAttempts int
+		wantStatus   int // of the returned error, 0 for success
+		wantWaits    string
+	}{
+		{"succeeds first time", []int{200}, 0, 1, 0, "[]"},
+		{"retries 5xx", []int{500, 503, 200}, 0, 3, 0, "[1s 2s]"},
+		{"retries 429", []int{429, 202}, 0, 2, 0, "[1s]"},
+		{"gives up after max attempts", []int{502}, 0, 4, 502, "[1s 2s 4s]"},
+		{"caps backoff", []int{500}, 3 * time.Second, 4, 500, "[1s 2s 3s]"},
+		{"does not retry 4xx", []int{400}, 0, 1, 400, "[]"},
+		{"does not retry 404", []int{404, 200}, 0, 1, 404, "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recv := &receiver{statuses: tt.statuses}
+			srv := httptest.NewServer(recv)
+			defer srv.Close()
+
+			sender, waits := newSender(tt.maxBackoff)
+			attempts, err := sender.Send(context.Background(), Delivery{URL: srv.URL, Event: "e", Body: []byte("{}")})
+			if attempts != tt.wantAttempts || len(recv.requests) != tt.wantAttempts {
+				t.Fatalf("attempts = %d, received %d; want %d", attempts, len(recv.requests), tt.wantAttempts)
+			}
+			if fmt.Sprint(*waits) != tt.wantWaits {
+				t.Fatalf("waits = %v, want %s", *waits, tt.wantWaits)
+			}
+
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+				return
+			}
+			var werr *Error
+			if !errors.As(err, &werr) || werr.StatusCode != tt.wantStatus {
+				t.Fatalf("err = %v, want status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSendRetriesUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	sender, waits := newSender(0)
+	attempts, err := sender.Send(context.Background(), Delivery{URL: url, Event: "e", Body: []byte("{}")})
+	var werr *Error
+	if attempts != 4 || !errors.As(err, &werr) || werr.StatusCode != 0 || !werr.Retryable {
+		t.Fatalf("Send = %d attempts, %v; want 4 retryable failures", attempts, err)
+	}
+	if len(*waits) != 3 {
+		t.Fatalf("waits = %v", *waits)
+	}
+}
+
+func TestSendStopsWhenContextDone(t *testing.T) {
+	recv := &receiver{statuses: []int{500}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var retried []int
+	sender := New(Config{
+		HeaderPrefix: "X-Test",
+		Backoff:      time.Hour,
+		OnRetry: func(d Delivery, attempt int, wait time.Duration, err error) {
+			retried = append(retried, attempt)
+			cancel()
+		},
+	})
+
+	attempts, err := sender.Send(ctx, Delivery{URL: srv.URL, Event: "e", Body: []byte("{}")})
+	if attempts != 1 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send = %d attempts, %v; want 1, context.Canceled", attempts, err)
+	}
+	if fmt.Sprint(retried) != "[1]" {
+		t.Fatalf("OnRetry called for attempts %v", retried)
+	}
+}
@@ -1052,11 +1052,10 @@ func StoreQuantumDropActivity(ctx context.Context, drop types.QuantumDrop) error
 	}
 
 	// Make HTTP request to store the drop
-	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/v1/drops", dropsURL), bytes.NewBuffer(jsonData))
+	req, err := newServiceRequest(ctx, "POST", fmt.Sprintf("%s/api/v1/drops", dropsURL), bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
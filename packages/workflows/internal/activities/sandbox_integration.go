@@ -5,10 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
 	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/workflows/internal/types"
 )
 
@@ -25,6 +27,20 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// newServiceRequest creates a request to another platform service, sending
+// SERVICE_API_KEY so the service's auth middleware accepts it
+func newServiceRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	authmiddleware.SetServiceKey(req)
+	return req, nil
+}
+
 // Sandbox Execution Types
 type SandboxExecutionRequest struct {
 	ID           string            `json:"id"`
@@ -79,7 +95,11 @@ func ExecuteInSandboxActivity(ctx context.Context, request SandboxExecutionReque
 
 	// Call Sandbox Executor service
 	url := fmt.Sprintf("%s/api/v1/execute", SandboxExecutorURL)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	req, err := newServiceRequest(ctx, http.MethodPost, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call sandbox executor: %w", err)
 	}
@@ -97,7 +117,11 @@ func ExecuteInSandboxActivity(ctx context.Context, request SandboxExecutionReque
 
 	// Get execution result
 	resultURL := fmt.Sprintf("%s/api/v1/executions/%s", SandboxExecutorURL, executionID)
-	resultResp, err := http.Get(resultURL)
+	resultReq, err := newServiceRequest(ctx, http.MethodGet, resultURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resultResp, err := http.DefaultClient.Do(resultReq)
 	if err != nil {
 		// Return partial result if we can't get the full result
 		return &SandboxExecutionResult{
@@ -131,7 +155,11 @@ func BuildCapsuleActivity(ctx context.Context, request CapsuleBuilderRequest) (*
 
 	// Call Capsule Builder service
 	url := fmt.Sprintf("%s/api/v1/build", CapsuleBuilderURL)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+	req, err := newServiceRequest(ctx, http.MethodPost, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call capsule builder: %w", err)
 	}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/orchestrator"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisConsensusKeyPrefix     = "agent-orchestrator:consensus:"
+	redisConsensusIndexKey      = "agent-orchestrator:consensus"
+	redisConsensusProjectPrefix = "agent-orchestrator:consensus-project:"
+	// Consensus records are an audit trail, so they outlive task records
+	redisConsensusTTL = 90 * 24 * time.Hour
+)
+
+// RedisConsensusStore persists consensus records in Redis, indexed overall
+// and per project
+type RedisConsensusStore struct {
+	client *redis.Client
+}
+
+// NewRedisConsensusStore stores consensus records through client
+func NewRedisConsensusStore(client *redis.Client) *RedisConsensusStore {
+	return &RedisConsensusStore{client: client}
+}
+
+func (s *RedisConsensusStore) Save(record *orchestrator.ConsensusRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode consensus record: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	member := redis.Z{Score: float64(record.StartedAt.UnixNano()), Member: record.ID}
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, redisConsensusKeyPrefix+record.ID, data, redisConsensusTTL)
+	pipe.ZAdd(ctx, redisConsensusIndexKey, member)
+	if record.ProjectID != "" {
+		pipe.ZAdd(ctx, redisConsensusProjectPrefix+record.ProjectID, member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save consensus record: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisConsensusStore) Get(id string) (*orchestrator.ConsensusRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, redisConsensusKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, orchestrator.ErrConsensusNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consensus record: %w", err)
+	}
+
+	var record orchestrator.ConsensusRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode consensus record: %w", err)
+	}
+	return &record, nil
+}
+
+func (s *RedisConsensusStore) List(projectID string, limit int) ([]*orchestrator.ConsensusRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	index := redisConsensusIndexKey
+	if projectID != "" {
+		index = redisConsensusProjectPrefix + projectID
+	}
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+	ids, err := s.client.ZRevRange(ctx, index, 0, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consensus ids: %w", err)
+	}
+
+	records := []*orchestrator.ConsensusRecord{}
+	if len(ids) == 0 {
+		return records, nil
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, redisConsensusKeyPrefix+id)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load consensus records: %w", err)
+	}
+
+	var expired []interface{}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// Record expired, drop it from the index
+			expired = append(expired, ids[i])
+			continue
+		}
+		var record orchestrator.ConsensusRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+	if len(expired) > 0 {
+		s.client.ZRem(ctx, index, expired...)
+	}
+	return records, nil
+}
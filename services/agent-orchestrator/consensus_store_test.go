@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/orchestrator"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisConsensusStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := NewRedisConsensusStore(client)
+
+	approve := true
+	start := time.Now()
+	for i, projectID := range []string{"p1", "p2", "p1"} {
+		err := store.Save(&orchestrator.ConsensusRecord{
+			ID:        []string{"c1", "c2", "c3"}[i],
+			ProjectID: projectID,
+			Topic:     "topic",
+			Votes:     []orchestrator.ConsensusVote{{AgentID: "a", Decision: &approve, Reasoning: "fine"}},
+			Outcome:   orchestrator.ConsensusApproved,
+			StartedAt: start.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	record, err := store.Get("c1")
+	if err != nil || record.ProjectID != "p1" || len(record.Votes) != 1 || !*record.Votes[0].Decision {
+		t.Fatalf("Get = %+v, %v", record, err)
+	}
+	if _, err := store.Get("missing"); !errors.Is(err, orchestrator.ErrConsensusNotFound) {
+		t.Fatalf("Get(missing) error = %v", err)
+	}
+
+	records, err := store.List("p1", 0)
+	if err != nil || len(records) != 2 || records[0].ID != "c3" || records[1].ID != "c1" {
+		t.Fatalf("List(p1) = %+v, %v, want c3 then c1", records, err)
+	}
+	if records, _ := store.List("", 2); len(records) != 2 || records[0].ID != "c3" {
+		t.Fatalf("List limited to 2 = %+v", records)
+	}
+
+	// Expired records drop out of the listing and the index
+	mr.Del(redisConsensusKeyPrefix + "c3")
+	if records, _ := store.List("p1", 0); len(records) != 1 || records[0].ID != "c1" {
+		t.Fatalf("List after expiry = %+v", records)
+	}
+	if members, _ := mr.ZMembers(redisConsensusProjectPrefix + "p1"); len(members) != 1 {
+		t.Fatalf("project index = %v, want the expired id removed", members)
+	}
+}
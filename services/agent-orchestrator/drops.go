@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+	"github.com/google/uuid"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/orchestrator"
+)
+
+const dropsPublishTimeout = 30 * time.Second
+
+// artifactKinds maps orchestrator task types to the drop type of their output
+var artifactKinds = map[string]string{
+	"analyze_requirements": "requirements",
+	"design_system":        "architecture",
+	"generate_api":         "code",
+}
+
+// QuantumDrop is the quantum-drops service's artifact record
+type QuantumDrop struct {
+	ID         string                 `json:"id"`
+	WorkflowID string                 `json:"workflow_id"`
+	RequestID  string                 `json:"request_id"`
+	Stage      string                 `json:"stage"`
+	Type       string                 `json:"type"`
+	Artifact   string                 `json:"artifact"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Version    int                    `json:"version"`
+}
+
+// DropsPublisher stores agent output in quantum-drops so the capsule-builder
+// can consume it like workflow output
+type DropsPublisher struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewDropsPublisher creates a publisher for the service at QUANTUM_DROPS_URL
+func NewDropsPublisher() *DropsPublisher {
+	baseURL := os.Getenv("QUANTUM_DROPS_URL")
+	if baseURL == "" {
+		baseURL = "http://quantum-drops.quantumlayer.svc.cluster.local:8090"
+	}
+	return &DropsPublisher{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: dropsPublishTimeout},
+	}
+}
+
+// Publish creates all drops in one batch request
+func (p *DropsPublisher) Publish(ctx context.Context, drops []QuantumDrop) error {
+	body, err := json.Marshal(drops)
+	if err != nil {
+		return fmt.Errorf("failed to encode drops: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/v1/drops/batch", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create drops request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	authmiddleware.SetServiceKey(req)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish drops: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("quantum-drops returned status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// buildDrops turns each agent's stage output into drops: one for the task
+// result and one per generated file. The workflow ID is the project ID so
+// capsule-builder can build from it; the request ID is the session.
+func buildDrops(projectID, sessionID string, stages []orchestrator.StageOutput) []QuantumDrop {
+	drops := []QuantumDrop{}
+	for _, stage := range stages {
+		metadata := map[string]interface{}{
+			"source":    "agent-orchestrator",
+			"task_id":   stage.TaskID,
+			"task_type": stage.TaskType,
+			"agent_id":  stage.AgentID,
+		}
+
+		if artifact := stageArtifact(stage.Result); artifact != "" {
+			kind, ok := artifactKinds[stage.TaskType]
+			if !ok {
+				kind = stage.TaskType
+			}
+			drops = append(drops, QuantumDrop{
+				ID:         "drop-" + uuid.New().String(),
+				WorkflowID: projectID,
+				RequestID:  sessionID,
+				Stage:      string(stage.Role),
+				Type:       kind,
+				Artifact:   artifact,
+				Metadata:   metadata,
+				Version:    1,
+			})
+		}
+
+		paths := make([]string, 0, len(stage.Files))
+		for path := range stage.Files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fileMetadata := map[string]interface{}{"path": path}
+			for k, v := range metadata {
+				fileMetadata[k] = v
+			}
+			drops = append(drops, QuantumDrop{
+				ID:         "drop-" + uuid.New().String(),
+				WorkflowID: projectID,
+				RequestID:  sessionID,
+				Stage:      string(stage.Role),
+				Type:       "code",
+				Artifact:   stage.Files[path],
+				Metadata:   fileMetadata,
+				Version:    1,
+			})
+		}
+	}
+	return drops
+}
+
+// stageArtifact renders a task result as drop content
+func stageArtifact(result interface{}) string {
+	switch v := result.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
+}
+
+var dropsPublisher = NewDropsPublisher()
+
+// publishStageDrops stores a run's stage output in quantum-drops and records
+// the drop IDs in the result metrics. A failure is logged and reported in
+// the metrics but doesn't fail the run.
+func publishStageDrops(projectID, sessionID string, result *orchestrator.ProcessResult) {
+	if result.Metrics == nil {
+		result.Metrics = map[string]interface{}{}
+	}
+
+	drops := buildDrops(projectID, sessionID, result.Stages)
+	if len(drops) == 0 {
+		result.Metrics["drop_ids"] = []string{}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dropsPublishTimeout)
+	defer cancel()
+
+	if err := dropsPublisher.Publish(ctx, drops); err != nil {
+		log.Printf("Failed to persist %d drops for session %s: %v", len(drops), sessionID, err)
+		result.Metrics["drops_error"] = err.Error()
+		return
+	}
+
+	ids := make([]string, 0, len(drops))
+	for _, drop := range drops {
+		ids = append(ids, drop.ID)
+	}
+	result.Metrics["drop_ids"] = ids
+}
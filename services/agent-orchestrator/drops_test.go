@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/orchestrator"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// useDropsServer points the drops publisher at handler for one test
+func useDropsServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	previous := dropsPublisher
+	dropsPublisher = &DropsPublisher{baseURL: srv.URL, httpClient: srv.Client()}
+	t.Cleanup(func() {
+		dropsPublisher = previous
+		srv.Close()
+	})
+	return srv
+}
+
+func testStages() []orchestrator.StageOutput {
+	return []orchestrator.StageOutput{
+		{
+			TaskID: "task-1", TaskType: "design_system", AgentID: "architect-1", Role: types.RoleArchitect,
+			Result: map[string]interface{}{"pattern": "layered"},
+		},
+		{
+			TaskID: "task-2", TaskType: "generate_api", AgentID: "backend-1", Role: types.RoleBackendDev,
+			Result: "generated 2 files",
+			Files:  map[string]string{"main.go": "package main", "api/routes.go": "package api"},
+		},
+		{TaskID: "task-3", TaskType: "review", AgentID: "qa-1", Role: types.RoleQA},
+	}
+}
+
+func TestBuildDrops(t *testing.T) {
+	drops := buildDrops("project-1", "session-1", testStages())
+
+	want := []struct{ stage, kind, path, artifact string }{
+		{"architect", "architecture", "", "{\n  \"pattern\": \"layered\"\n}"},
+		{"backend-developer", "code", "", "generated 2 files"},
+		{"backend-developer", "code", "api/routes.go", "package api"},
+		{"backend-developer", "code", "main.go", "package main"},
+	}
+	if len(drops) != len(want) {
+		t.Fatalf("got %d drops, want %d: %+v", len(drops), len(want), drops)
+	}
+	for i, w := range want {
+		d := drops[i]
+		path, _ := d.Metadata["path"].(string)
+		if d.Stage != w.stage || d.Type != w.kind || path != w.path || d.Artifact != w.artifact {
+			t.Errorf("drop %d = stage %q type %q path %q artifact %q", i, d.Stage, d.Type, path, d.Artifact)
+		}
+		if d.WorkflowID != "project-1" || d.RequestID != "session-1" || d.Version != 1 || d.ID == "" {
+			t.Errorf("drop %d = %+v", i, d)
+		}
+		if d.Metadata["source"] != "agent-orchestrator" || d.Metadata["task_id"] == "" {
+			t.Errorf("drop %d metadata = %v", i, d.Metadata)
+		}
+	}
+}
+
+func TestPublishStageDrops(t *testing.T) {
+	var posted []QuantumDrop
+	useDropsServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/drops/batch" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	result := &orchestrator.ProcessResult{Stages: testStages()}
+	publishStageDrops("project-1", "session-1", result)
+
+	ids, _ := result.Metrics["drop_ids"].([]string)
+	if len(posted) != 4 || len(ids) != 4 {
+		t.Fatalf("posted %d drops, recorded IDs %v", len(posted), result.Metrics["drop_ids"])
+	}
+	for i, drop := range posted {
+		if ids[i] != drop.ID {
+			t.Errorf("drop_ids[%d] = %q, want %q", i, ids[i], drop.ID)
+		}
+	}
+	if _, failed := result.Metrics["drops_error"]; failed {
+		t.Errorf("drops_error = %v", result.Metrics["drops_error"])
+	}
+}
+
+func TestPublishStageDropsUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		down bool
+	}{
+		{"server error", false},
+		{"unreachable", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := useDropsServer(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+			})
+			if tt.down {
+				srv.Close()
+			}
+
+			// The run still completes; the failure is reported in its metrics
+			result := &orchestrator.ProcessResult{Success: true, Stages: testStages()}
+			publishStageDrops("project-1", "session-1", result)
+			if !result.Success {
+				t.Error("a drops failure failed the run")
+			}
+			if msg, _ := result.Metrics["drops_error"].(string); msg == "" {
+				t.Errorf("metrics = %v, want drops_error", result.Metrics)
+			}
+			if _, ok := result.Metrics["drop_ids"]; ok {
+				t.Errorf("drop_ids recorded for unpublished drops: %v", result.Metrics["drop_ids"])
+			}
+		})
+	}
+}
+
+func TestPublishStageDropsWithoutOutput(t *testing.T) {
+	useDropsServer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+	})
+	result := &orchestrator.ProcessResult{Stages: []orchestrator.StageOutput{{TaskID: "task-1", TaskType: "review"}}}
+	publishStageDrops("project-1", "session-1", result)
+	if ids, ok := result.Metrics["drop_ids"].([]string); !ok || len(ids) != 0 {
+		t.Errorf("drop_ids = %v, want an empty list", result.Metrics["drop_ids"])
+	}
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -28,11 +33,19 @@ type TaskRequest struct {
 	Description  string                 `json:"description" binding:"required"`
 	Priority     int                    `json:"priority,omitempty"`
 	Requirements map[string]interface{} `json:"requirements,omitempty"`
+
+	// PreferredRole favours agents of that role; RequiredCapabilities
+	// rules out agents lacking any of them
+	PreferredRole        types.AgentRole         `json:"preferred_role,omitempty"`
+	RequiredCapabilities []types.AgentCapability `json:"required_capabilities,omitempty"`
 }
 
 type ConsensusRequest struct {
-	Topic    string      `json:"topic" binding:"required"`
-	Proposal interface{} `json:"proposal" binding:"required"`
+	Topic           string      `json:"topic" binding:"required"`
+	Proposal        interface{} `json:"proposal" binding:"required"`
+	ProjectID       string      `json:"project_id,omitempty"`
+	MinParticipants int         `json:"min_participants,omitempty"` // active agents required to hold the vote
+	Quorum          int         `json:"quorum,omitempty"`           // votes required for the outcome to count
 }
 
 // Response structures
@@ -51,6 +64,7 @@ type AgentResponse struct {
 type AgentMetricsResponse struct {
 	Agents  map[string]types.AgentMetrics `json:"agents"`
 	Summary map[string]interface{}        `json:"summary"`
+	Queue   orchestrator.QueueMetrics     `json:"queue"`
 }
 
 // Simple in-memory message bus implementation
@@ -86,6 +100,9 @@ func (b *InMemoryMessageBus) Unsubscribe(ctx context.Context, topic string) erro
 var (
 	agentOrchestrator *orchestrator.AgentOrchestrator
 	llmEndpoint       string
+
+	// shuttingDown is set once SIGTERM is received; new requests are refused
+	shuttingDown atomic.Bool
 )
 
 func main() {
@@ -100,17 +117,91 @@ func main() {
 		llmEndpoint = "http://llm-router.quantumlayer.svc.cluster.local:8080"
 	}
 
-	// Create message bus
-	messageBus := NewInMemoryMessageBus()
+	// Create message bus. NATS lets agents on different replicas coordinate;
+	// the in-memory bus only works within one process.
+	var messageBus types.MessageBus = NewInMemoryMessageBus()
+	var natsBus *NATSMessageBus
+	if os.Getenv("MESSAGE_BUS") == "nats" {
+		natsURL := os.Getenv("NATS_URL")
+		if natsURL == "" {
+			natsURL = "nats://nats.quantumlayer.svc.cluster.local:4222"
+		}
+		bus, err := NewNATSMessageBus(natsURL)
+		if err != nil {
+			log.Printf("Warning: NATS message bus unavailable: %v. Using in-memory message bus.", err)
+		} else {
+			natsBus = bus
+			messageBus = bus
+		}
+	}
+
+	shutdownTimeout := 30 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			shutdownTimeout = d
+		}
+	}
+
+	pendingPollInterval := 30 * time.Second
+	if v := os.Getenv("PENDING_TASKS_POLL_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			pendingPollInterval = d
+		}
+	}
 
 	// Initialize orchestrator
 	agentOrchestrator = orchestrator.NewAgentOrchestrator(llmEndpoint, messageBus)
 
+	// Persist task status, session events and tasks left unfinished at
+	// shutdown in Redis when configured, otherwise keep them in memory
+	var pendingStore PendingTaskStore
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		store, err := NewRedisTaskStore(redisURL)
+		if err != nil {
+			log.Printf("Warning: Redis task store unavailable: %v. Using in-memory task store.", err)
+		} else {
+			agentOrchestrator.SetTaskStore(store)
+			agentOrchestrator.SetConsensusStore(NewRedisConsensusStore(store.client))
+			sessionHub = NewSessionHub(NewRedisSessionEventLog(store.client))
+			pendingStore = store
+		}
+	}
+	if pendingStore == nil {
+		// Without Redis, PENDING_TASKS_FILE must be on a persistent volume
+		if path := os.Getenv("PENDING_TASKS_FILE"); path != "" {
+			pendingStore = &FilePendingStore{path: path}
+		} else {
+			log.Printf("Warning: no REDIS_URL or PENDING_TASKS_FILE, unfinished tasks will be lost on shutdown")
+		}
+	}
+
+	// Requeue tasks left by replicas that have shut down
+	stopPendingPoller := make(chan struct{})
+	if pendingStore != nil {
+		restorePendingTasks(agentOrchestrator, pendingStore)
+		if pendingPollInterval > 0 {
+			pollPendingTasks(agentOrchestrator, pendingStore, pendingPollInterval, stopPendingPoller)
+		}
+	}
+
+	// Stop agents that sit idle too long
+	stopReaper := make(chan struct{})
+	idleTimeout := 30 * time.Minute
+	if v := os.Getenv("AGENT_IDLE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			idleTimeout = d
+		}
+	}
+	if idleTimeout > 0 {
+		agentOrchestrator.StartIdleReaper(idleTimeout, time.Minute, stopReaper)
+	}
+
 	// Setup Gin router
 	r := gin.Default()
 
 	// Middleware
 	r.Use(gin.Recovery())
+	r.Use(drainMiddleware())
 	r.Use(corsMiddleware())
 
 	// Health endpoints
@@ -122,10 +213,14 @@ func main() {
 	{
 		// Main processing endpoint
 		api.POST("/process", handleProcess)
+		api.POST("/process/async", handleProcessAsync)
+		api.GET("/sessions/:id/events", handleSessionEvents)
 
 		// Task management
 		api.POST("/tasks", handleCreateTask)
+		api.GET("/tasks", handleListTasks)
 		api.GET("/tasks/:id", handleGetTask)
+		api.GET("/tasks/queue", handleGetQueue)
 
 		// Agent management
 		api.POST("/agents/spawn", handleSpawnAgent)
@@ -135,12 +230,67 @@ func main() {
 
 		// Consensus
 		api.POST("/consensus", handleConsensus)
+		api.GET("/consensus", handleListConsensus)
+		api.GET("/consensus/:id", handleGetConsensus)
+	}
+
+	// Create HTTP server
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
 	}
 
 	// Start server
-	log.Printf("Agent Orchestrator starting on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	go func() {
+		log.Printf("Agent Orchestrator starting on port %s", port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// Wait for interrupt
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down agent orchestrator, draining in-flight requests...")
+	shuttingDown.Store(true)
+	close(stopReaper)
+	// Stop taking other replicas' tasks before saving our own
+	close(stopPendingPoller)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Wait for in-flight requests and running tasks, then persist anything
+	// unfinished
+	gracefulShutdown(ctx, srv, agentOrchestrator, pendingStore)
+
+	if err := agentOrchestrator.Shutdown(ctx); err != nil {
+		log.Printf("Agent shutdown error: %v", err)
+	}
+
+	if natsBus != nil {
+		if err := natsBus.Close(); err != nil {
+			log.Printf("NATS close error: %v", err)
+		}
+	}
+
+	log.Println("Agent orchestrator exited")
+}
+
+// drainMiddleware refuses new requests once shutdown has started so that
+// keep-alive connections don't sneak work in while we drain
+func drainMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if shuttingDown.Load() {
+			c.Header("Connection", "close")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "server is shutting down",
+			})
+			return
+		}
+		c.Next()
 	}
 }
 
@@ -194,7 +344,8 @@ func handleProcess(c *gin.Context) {
 
 	// Process request with agents
 	ctx := context.Background()
-	result, err := agentOrchestrator.ProcessRequest(ctx, req.Requirements, req.ProjectID)
+	sessionID := uuid.New().String()
+	result, err := agentOrchestrator.ProcessRequestWithProgress(ctx, req.Requirements, req.ProjectID, sessionID, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, AgentResponse{
 			Success:   false,
@@ -204,9 +355,11 @@ func handleProcess(c *gin.Context) {
 		return
 	}
 
+	publishStageDrops(req.ProjectID, sessionID, result)
+
 	c.JSON(http.StatusOK, AgentResponse{
 		Success:       result.Success,
-		SessionID:     uuid.New().String(),
+		SessionID:     sessionID,
 		ProjectID:     req.ProjectID,
 		GeneratedCode: result.GeneratedCode,
 		Architecture:  result.Architecture,
@@ -231,27 +384,91 @@ func handleCreateTask(c *gin.Context) {
 		Requirements: req.Requirements,
 		Status:       types.TaskPending,
 		CreatedAt:    time.Now(),
+
+		PreferredRole:        req.PreferredRole,
+		RequiredCapabilities: req.RequiredCapabilities,
+	}
+	if err := orchestrator.ValidateTaskHints(task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	ctx := context.Background()
-	if err := agentOrchestrator.AssignTask(ctx, task); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// Reject work nothing can run rather than letting it sit in the queue
+	if !agentOrchestrator.HasCapableAgent(task) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": noCapableAgentError(task),
+		})
 		return
 	}
 
+	// Queue the task; it is dispatched to an idle agent by priority
+	ctx := context.Background()
+	agentOrchestrator.EnqueueTask(ctx, task)
+
 	c.JSON(http.StatusCreated, task)
 }
 
+// noCapableAgentError names what no agent offers: the task type or the
+// required capabilities
+func noCapableAgentError(task *types.Task) string {
+	if len(task.RequiredCapabilities) == 0 {
+		return fmt.Sprintf("no agent can handle tasks of type %s", task.Type)
+	}
+	capabilities := make([]string, len(task.RequiredCapabilities))
+	for i, capability := range task.RequiredCapabilities {
+		capabilities[i] = string(capability)
+	}
+	return fmt.Sprintf("no agent can handle tasks of type %s requiring %s", task.Type, strings.Join(capabilities, ", "))
+}
+
 func handleGetTask(c *gin.Context) {
-	taskID := c.Param("id")
-	
-	// This would need to be implemented in the orchestrator
+	record, err := agentOrchestrator.GetTask(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, orchestrator.ErrTaskNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+func handleListTasks(c *gin.Context) {
+	filter := orchestrator.TaskFilter{
+		Status:  types.TaskStatus(c.Query("status")),
+		AgentID: c.Query("agent_id"),
+		Limit:   100,
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		if limit > 1000 {
+			limit = 1000
+		}
+		filter.Limit = limit
+	}
+
+	tasks, err := agentOrchestrator.ListTasks(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"id":     taskID,
-		"status": "pending",
+		"tasks": tasks,
+		"total": len(tasks),
 	})
 }
 
+func handleGetQueue(c *gin.Context) {
+	c.JSON(http.StatusOK, agentOrchestrator.QueueMetrics())
+}
+
 func handleSpawnAgent(c *gin.Context) {
 	var req struct {
 		Role string `json:"role" binding:"required"`
@@ -306,14 +523,15 @@ func handleSpawnAgent(c *gin.Context) {
 }
 
 func handleListAgents(c *gin.Context) {
-	metrics := agentOrchestrator.MonitorAgents()
-	
-	agents := []gin.H{}
-	for id, metric := range metrics {
-		agents = append(agents, gin.H{
-			"id":         id,
-			"metrics":    metric,
-		})
+	agents := agentOrchestrator.ListAgents()
+	if state := c.Query("state"); state != "" {
+		filtered := []orchestrator.AgentInfo{}
+		for _, agent := range agents {
+			if string(agent.State) == state {
+				filtered = append(filtered, agent)
+			}
+		}
+		agents = filtered
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -346,17 +564,44 @@ func handleGetMetrics(c *gin.Context) {
 			"success_rate":  successRate,
 			"total_failures": totalFailures,
 		},
+		Queue: agentOrchestrator.QueueMetrics(),
 	})
 }
 
 func handleStopAgent(c *gin.Context) {
 	agentID := c.Param("id")
-	
-	// This would need to be implemented in the orchestrator
-	c.JSON(http.StatusOK, gin.H{
-		"id":     agentID,
-		"status": "stopped",
-	})
+	force := c.Query("force") == "true"
+
+	// Bound how long a graceful stop waits for the in-flight task
+	timeout := 30 * time.Second
+	if v := os.Getenv("AGENT_STOP_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			timeout = d
+		}
+	}
+	if v := c.Query("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "timeout must be a duration such as 30s"})
+			return
+		}
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	result, err := agentOrchestrator.StopAgent(ctx, agentID, force)
+	if err != nil {
+		if errors.Is(err, orchestrator.ErrAgentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
 }
 
 func handleConsensus(c *gin.Context) {
@@ -365,10 +610,22 @@ func handleConsensus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.MinParticipants < 0 || req.Quorum < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_participants and quorum must not be negative"})
+		return
+	}
 
 	ctx := context.Background()
-	consensus, err := agentOrchestrator.RequestConsensus(ctx, req.Topic, req.Proposal)
+	consensus, err := agentOrchestrator.RequestConsensus(ctx, req.Topic, req.Proposal, orchestrator.ConsensusOptions{
+		ProjectID:       req.ProjectID,
+		MinParticipants: req.MinParticipants,
+		Quorum:          req.Quorum,
+	})
 	if err != nil {
+		if errors.Is(err, orchestrator.ErrQuorumUnreachable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -376,6 +633,46 @@ func handleConsensus(c *gin.Context) {
 	c.JSON(http.StatusOK, consensus)
 }
 
+func handleGetConsensus(c *gin.Context) {
+	record, err := agentOrchestrator.GetConsensus(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, orchestrator.ErrConsensusNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "consensus not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+func handleListConsensus(c *gin.Context) {
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		if n > 1000 {
+			n = 1000
+		}
+		limit = n
+	}
+
+	records, err := agentOrchestrator.ListConsensus(c.Query("project_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"consensus": records,
+		"total":     len(records),
+	})
+}
+
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+const (
+	natsSubjectPrefix  = "agents."
+	natsQueuePrefix    = "agent-orchestrator."
+	natsPendingLimit   = 1000
+	natsReconnectWait  = 2 * time.Second
+	natsConnectTimeout = 5 * time.Second
+)
+
+// natsBroadcastTopics are delivered to every replica. All other topics use a
+// queue group so only one replica handles each message.
+var natsBroadcastTopics = map[string]bool{
+	"agent.broadcast": true,
+	"consensus":       true,
+}
+
+// natsPending is a message that couldn't be published while disconnected
+type natsPending struct {
+	subject string
+	data    []byte
+}
+
+// NATSMessageBus is a MessageBus backed by NATS, so agents on different
+// orchestrator replicas can talk to each other
+type NATSMessageBus struct {
+	conn *nats.Conn
+
+	subscriptions map[string][]*nats.Subscription
+	pending       []natsPending
+	mu            sync.Mutex
+}
+
+// NewNATSMessageBus connects to the NATS server at url. The connection keeps
+// retrying in the background if the server is unreachable at startup.
+func NewNATSMessageBus(url string) (*NATSMessageBus, error) {
+	b := &NATSMessageBus{
+		subscriptions: make(map[string][]*nats.Subscription),
+	}
+
+	conn, err := nats.Connect(url,
+		nats.Name("agent-orchestrator"),
+		nats.Timeout(natsConnectTimeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(natsReconnectWait),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("NATS disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("NATS reconnected to %s", nc.ConnectedUrl())
+			b.flushPending()
+		}),
+		nats.ConnectHandler(func(nc *nats.Conn) {
+			b.flushPending()
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	b.conn = conn
+	return b, nil
+}
+
+func (b *NATSMessageBus) Publish(ctx context.Context, topic string, msg *types.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	subject := natsSubjectPrefix + topic
+	if err := b.conn.Publish(subject, data); err != nil {
+		if !isNATSDisconnected(err) {
+			return fmt.Errorf("failed to publish to %s: %w", topic, err)
+		}
+		return b.bufferPending(subject, data)
+	}
+	return nil
+}
+
+func (b *NATSMessageBus) Subscribe(ctx context.Context, topic string, handler func(*types.Message)) error {
+	subject := natsSubjectPrefix + topic
+	cb := func(m *nats.Msg) {
+		var msg types.Message
+		if err := json.Unmarshal(m.Data, &msg); err != nil {
+			log.Printf("Dropping undecodable message on %s: %v", topic, err)
+			return
+		}
+		handler(&msg)
+	}
+
+	var sub *nats.Subscription
+	var err error
+	if natsBroadcastTopics[topic] {
+		sub, err = b.conn.Subscribe(subject, cb)
+	} else {
+		sub, err = b.conn.QueueSubscribe(subject, natsQueuePrefix+topic, cb)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+	}
+
+	b.mu.Lock()
+	b.subscriptions[topic] = append(b.subscriptions[topic], sub)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *NATSMessageBus) Unsubscribe(ctx context.Context, topic string) error {
+	b.mu.Lock()
+	subs := b.subscriptions[topic]
+	delete(b.subscriptions, topic)
+	b.mu.Unlock()
+
+	var errs []error
+	for _, sub := range subs {
+		if err := sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close drains subscriptions and closes the connection
+func (b *NATSMessageBus) Close() error {
+	b.mu.Lock()
+	dropped := len(b.pending)
+	b.mu.Unlock()
+	if dropped > 0 {
+		log.Printf("Closing NATS bus with %d unpublished messages", dropped)
+	}
+	return b.conn.Drain()
+}
+
+// bufferPending holds a message for re-publishing once the connection is
+// back, dropping the oldest message when the buffer is full
+func (b *NATSMessageBus) bufferPending(subject string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.pending) >= natsPendingLimit {
+		b.pending = b.pending[1:]
+		log.Printf("NATS publish buffer full, dropped oldest message")
+	}
+	b.pending = append(b.pending, natsPending{subject: subject, data: data})
+	return nil
+}
+
+// flushPending re-publishes messages buffered while disconnected
+func (b *NATSMessageBus) flushPending() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	for i, p := range pending {
+		if err := b.conn.Publish(p.subject, p.data); err != nil {
+			// Lost the connection again, keep the rest for the next reconnect
+			b.mu.Lock()
+			b.pending = append(pending[i:], b.pending...)
+			b.mu.Unlock()
+			log.Printf("Failed to re-publish buffered messages: %v", err)
+			return
+		}
+	}
+	log.Printf("Re-published %d messages buffered while disconnected", len(pending))
+}
+
+// isNATSDisconnected reports whether a publish failed only because the
+// connection is down or its reconnect buffer is full
+func isNATSDisconnected(err error) bool {
+	return errors.Is(err, nats.ErrReconnectBufExceeded) ||
+		errors.Is(err, nats.ErrConnectionReconnecting)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+// runNATS starts an embedded NATS server on port, or a random port when
+// port is -1
+func runNATS(t *testing.T, port int) *server.Server {
+	t.Helper()
+	opts := natstest.DefaultTestOptions
+	opts.Port = port
+	s := natstest.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func natsPort(s *server.Server) int {
+	return s.Addr().(*net.TCPAddr).Port
+}
+
+func newBus(t *testing.T, url string) *NATSMessageBus {
+	t.Helper()
+	bus, err := NewNATSMessageBus(url)
+	if err != nil {
+		t.Fatalf("NewNATSMessageBus: %v", err)
+	}
+	t.Cleanup(func() { bus.conn.Close() })
+	return bus
+}
+
+// inbox collects messages delivered to a subscription
+type inbox struct {
+	mu   sync.Mutex
+	msgs []*types.Message
+}
+
+func (in *inbox) handle(msg *types.Message) {
+	in.mu.Lock()
+	in.msgs = append(in.msgs, msg)
+	in.mu.Unlock()
+}
+
+func (in *inbox) count() int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return len(in.msgs)
+}
+
+// waitFor polls until cond holds or fails the test after timeout
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func publishN(t *testing.T, bus *NATSMessageBus, topic string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		msg := &types.Message{ID: fmt.Sprintf("msg-%d", i), From: "agent-1", Content: "hello"}
+		if err := bus.Publish(context.Background(), topic, msg); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+}
+
+func TestNATSBusTopicDelivery(t *testing.T) {
+	tests := []struct {
+		topic string
+		// each message reaches one replica, or every replica for broadcasts
+		wantPerReplica int
+		wantTotal      int
+	}{
+		{"agent.backend-1", -1, 10},
+		{"agent.broadcast", 10, 20},
+		{"consensus", 10, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			s := runNATS(t, -1)
+			replicas := []*NATSMessageBus{newBus(t, s.ClientURL()), newBus(t, s.ClientURL())}
+			inboxes := []*inbox{{}, {}}
+			for i, bus := range replicas {
+				if err := bus.Subscribe(context.Background(), tt.topic, inboxes[i].handle); err != nil {
+					t.Fatalf("Subscribe: %v", err)
+				}
+				bus.conn.Flush()
+			}
+
+			publishN(t, replicas[0], tt.topic, 10)
+			waitFor(t, 2*time.Second, "deliveries", func() bool {
+				return inboxes[0].count()+inboxes[1].count() >= tt.wantTotal
+			})
+			// Give stray duplicates a chance to arrive
+			time.Sleep(100 * time.Millisecond)
+
+			if total := inboxes[0].count() + inboxes[1].count(); total != tt.wantTotal {
+				t.Fatalf("delivered %d messages, want %d", total, tt.wantTotal)
+			}
+			if tt.wantPerReplica >= 0 {
+				for i, in := range inboxes {
+					if in.count() != tt.wantPerReplica {
+						t.Fatalf("replica %d received %d, want %d", i, in.count(), tt.wantPerReplica)
+					}
+				}
+			}
+			if msg := inboxes[0].msgs[0]; msg.From != "agent-1" || msg.Content != "hello" {
+				t.Fatalf("message = %+v", msg)
+			}
+		})
+	}
+}
+
+func TestNATSBusUnsubscribe(t *testing.T) {
+	s := runNATS(t, -1)
+	bus := newBus(t, s.ClientURL())
+	ctx := context.Background()
+
+	// Both subscriptions share the topic's queue group, so each message
+	// reaches only one of them
+	in := &inbox{}
+	bus.Subscribe(ctx, "agent.backend-1", in.handle)
+	bus.Subscribe(ctx, "agent.backend-1", in.handle)
+	bus.conn.Flush()
+	publishN(t, bus, "agent.backend-1", 1)
+	waitFor(t, 2*time.Second, "first delivery", func() bool { return in.count() == 1 })
+
+	if err := bus.Unsubscribe(ctx, "agent.backend-1"); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	if err := bus.Unsubscribe(ctx, "never-subscribed"); err != nil {
+		t.Fatalf("Unsubscribe of an unknown topic: %v", err)
+	}
+	bus.conn.Flush()
+	publishN(t, bus, "agent.backend-1", 1)
+	time.Sleep(100 * time.Millisecond)
+	if in.count() != 1 {
+		t.Fatalf("received %d messages after unsubscribing, want 1", in.count())
+	}
+}
+
+func TestNATSBusDropsUndecodableMessages(t *testing.T) {
+	s := runNATS(t, -1)
+	bus := newBus(t, s.ClientURL())
+
+	in := &inbox{}
+	bus.Subscribe(context.Background(), "agent.broadcast", in.handle)
+	bus.conn.Flush()
+
+	raw, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer raw.Close()
+	raw.Publish(natsSubjectPrefix+"agent.broadcast", []byte("not json"))
+	raw.Flush()
+	publishN(t, bus, "agent.broadcast", 1)
+
+	waitFor(t, 2*time.Second, "valid message", func() bool { return in.count() == 1 })
+	time.Sleep(100 * time.Millisecond)
+	if in.count() != 1 || in.msgs[0].ID != "msg-0" {
+		t.Fatalf("received %d messages, want only the valid one", in.count())
+	}
+}
+
+func TestNATSBusRedeliversAfterReconnect(t *testing.T) {
+	s := runNATS(t, -1)
+	port := natsPort(s)
+	bus := newBus(t, s.ClientURL())
+
+	in := &inbox{}
+	bus.Subscribe(context.Background(), "agent.broadcast", in.handle)
+	bus.conn.Flush()
+
+	s.Shutdown()
+	waitFor(t, 2*time.Second, "disconnect", func() bool { return !bus.conn.IsConnected() })
+
+	// Published while the server is down
+	publishN(t, bus, "agent.broadcast", 5)
+
+	runNATS(t, port)
+	waitFor(t, 10*time.Second, "buffered messages after reconnect", func() bool { return in.count() == 5 })
+}
+
+func TestNATSBusConnectsWhenServerStartsLater(t *testing.T) {
+	// Reserve a port, then free it for the server started below
+	s := runNATS(t, -1)
+	port := natsPort(s)
+	url := s.ClientURL()
+	s.Shutdown()
+
+	bus := newBus(t, url)
+	in := &inbox{}
+	if err := bus.Subscribe(context.Background(), "agent.broadcast", in.handle); err != nil {
+		t.Fatalf("Subscribe before connecting: %v", err)
+	}
+	publishN(t, bus, "agent.broadcast", 3)
+
+	runNATS(t, port)
+	waitFor(t, 10*time.Second, "messages published before connecting", func() bool { return in.count() == 3 })
+}
+
+func TestNATSBusPendingBufferDropsOldest(t *testing.T) {
+	bus := &NATSMessageBus{subscriptions: make(map[string][]*nats.Subscription)}
+	for i := 0; i <= natsPendingLimit; i++ {
+		bus.bufferPending(fmt.Sprintf("subject-%d", i), nil)
+	}
+
+	if len(bus.pending) != natsPendingLimit {
+		t.Fatalf("buffered %d messages, want %d", len(bus.pending), natsPendingLimit)
+	}
+	if first, last := bus.pending[0].subject, bus.pending[natsPendingLimit-1].subject; first != "subject-1" || last != fmt.Sprintf("subject-%d", natsPendingLimit) {
+		t.Fatalf("buffer holds %s..%s, want the oldest message dropped", first, last)
+	}
+}
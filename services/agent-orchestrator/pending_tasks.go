@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/orchestrator"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+const redisPendingTasksKey = "agent-orchestrator:pending-tasks"
+
+// PendingTaskStore keeps tasks a replica couldn't finish before shutting
+// down so that another replica can requeue them
+type PendingTaskStore interface {
+	SavePending(tasks []*types.Task) error
+	// TakePending removes and returns every saved task. Concurrent callers
+	// never receive the same task.
+	TakePending() ([]*types.Task, error)
+}
+
+// SavePending appends tasks to a list shared by every replica, so tasks
+// left by replicas shutting down at the same time are all kept
+func (s *RedisTaskStore) SavePending(tasks []*types.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, 0, len(tasks))
+	for _, task := range tasks {
+		data, err := json.Marshal(task)
+		if err != nil {
+			return fmt.Errorf("failed to encode task %s: %w", task.ID, err)
+		}
+		values = append(values, data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.client.RPush(ctx, redisPendingTasksKey, values...).Err(); err != nil {
+		return fmt.Errorf("failed to save pending tasks: %w", err)
+	}
+	return nil
+}
+
+// TakePending reads and deletes the list in one transaction, so each task
+// is requeued by exactly one replica
+func (s *RedisTaskStore) TakePending() ([]*types.Task, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipe := s.client.TxPipeline()
+	values := pipe.LRange(ctx, redisPendingTasksKey, 0, -1)
+	pipe.Del(ctx, redisPendingTasksKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to take pending tasks: %w", err)
+	}
+
+	tasks := make([]*types.Task, 0, len(values.Val()))
+	for _, value := range values.Val() {
+		var task types.Task
+		if err := json.Unmarshal([]byte(value), &task); err != nil {
+			log.Printf("Dropping undecodable pending task: %v", err)
+			continue
+		}
+		tasks = append(tasks, &task)
+	}
+	return tasks, nil
+}
+
+// FilePendingStore keeps pending tasks in a file. It only survives a
+// restart if the file is on a volume the next pod mounts.
+type FilePendingStore struct {
+	path string
+}
+
+func (s *FilePendingStore) SavePending(tasks []*types.Task) error {
+	// Keep tasks not yet taken by a previous replica
+	existing, err := s.read()
+	if err != nil {
+		return err
+	}
+	tasks = append(existing, tasks...)
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(tasks)
+	if err != nil {
+		return fmt.Errorf("failed to encode tasks: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *FilePendingStore) TakePending() ([]*types.Task, error) {
+	tasks, err := s.read()
+	if err != nil || len(tasks) == 0 {
+		return tasks, err
+	}
+	if err := os.Remove(s.path); err != nil {
+		return nil, fmt.Errorf("failed to remove pending tasks file: %w", err)
+	}
+	return tasks, nil
+}
+
+func (s *FilePendingStore) read() ([]*types.Task, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending tasks: %w", err)
+	}
+
+	var tasks []*types.Task
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return nil, fmt.Errorf("failed to decode pending tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// restorePendingTasks requeues tasks left by replicas that have shut down
+// and returns how many were requeued
+func restorePendingTasks(orch *orchestrator.AgentOrchestrator, store PendingTaskStore) int {
+	tasks, err := store.TakePending()
+	if err != nil {
+		log.Printf("Failed to load pending tasks: %v", err)
+		return 0
+	}
+
+	ctx := context.Background()
+	for _, task := range tasks {
+		orch.EnqueueTask(ctx, task)
+	}
+	if len(tasks) > 0 {
+		log.Printf("Requeued %d tasks from previous shutdown", len(tasks))
+	}
+	return len(tasks)
+}
+
+// pollPendingTasks keeps requeueing pending tasks. During a rolling deploy
+// the old replica saves its tasks after the new one has started, so
+// checking only at startup would leave them until the next restart.
+func pollPendingTasks(orch *orchestrator.AgentOrchestrator, store PendingTaskStore, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				restorePendingTasks(orch, store)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// gracefulShutdown stops accepting requests and waits for in-flight ones,
+// then waits for running tasks and saves whatever is unfinished for another
+// replica. Both waits end when ctx does.
+func gracefulShutdown(ctx context.Context, srv *http.Server, orch *orchestrator.AgentOrchestrator, store PendingTaskStore) {
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	incomplete := orch.Drain(ctx)
+	if len(incomplete) == 0 {
+		return
+	}
+	if store == nil {
+		log.Printf("Dropping %d incomplete tasks: no pending task store configured", len(incomplete))
+		return
+	}
+	if err := store.SavePending(incomplete); err != nil {
+		log.Printf("Failed to persist %d incomplete tasks: %v", len(incomplete), err)
+		return
+	}
+	log.Printf("Persisted %d incomplete tasks", len(incomplete))
+}
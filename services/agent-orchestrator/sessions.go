@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/orchestrator"
+	"github.com/redis/go-redis/v9"
+)
+
+// Session event types added by the service around the orchestrator's
+// progress events. Completed and failed events end the stream and carry
+// the AgentResponse.
+const (
+	SessionEventAccepted  = "session.accepted"
+	SessionEventCompleted = "session.completed"
+	SessionEventFailed    = "session.failed"
+)
+
+const (
+	redisSessionKeyPrefix = "agent-orchestrator:session:"
+	redisSessionTTL       = 24 * time.Hour
+
+	// sessionPollInterval bounds how long a stream waits before checking
+	// the log again, so events appended by another replica still arrive
+	sessionPollInterval = time.Second
+	sessionKeepAlive    = 15 * time.Second
+)
+
+// ErrSessionNotFound is returned for sessions with no recorded events
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionEvent is one entry in a session's event log. Index is its position
+// in the log and is used as the SSE event ID for replay.
+type SessionEvent struct {
+	Index     int             `json:"index"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// Final reports whether the event ends the session
+func (e *SessionEvent) Final() bool {
+	return e.Type == SessionEventCompleted || e.Type == SessionEventFailed
+}
+
+// SessionEventLog persists session events so reconnecting clients can replay
+// them from an index
+type SessionEventLog interface {
+	Append(sessionID string, event *SessionEvent) error
+	Since(sessionID string, from int) ([]SessionEvent, error)
+}
+
+// MemorySessionEventLog keeps session events in process memory
+type MemorySessionEventLog struct {
+	sessions map[string][]SessionEvent
+	mu       sync.RWMutex
+}
+
+// NewMemorySessionEventLog creates an empty in-memory event log
+func NewMemorySessionEventLog() *MemorySessionEventLog {
+	return &MemorySessionEventLog{sessions: make(map[string][]SessionEvent)}
+}
+
+func (l *MemorySessionEventLog) Append(sessionID string, event *SessionEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.Index = len(l.sessions[sessionID])
+	l.sessions[sessionID] = append(l.sessions[sessionID], *event)
+	return nil
+}
+
+func (l *MemorySessionEventLog) Since(sessionID string, from int) ([]SessionEvent, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	events, ok := l.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if from >= len(events) {
+		return nil, nil
+	}
+	return append([]SessionEvent(nil), events[from:]...), nil
+}
+
+// RedisSessionEventLog keeps session events in a Redis list per session, so
+// any replica can serve a session's stream
+type RedisSessionEventLog struct {
+	client *redis.Client
+}
+
+// NewRedisSessionEventLog stores session events using client
+func NewRedisSessionEventLog(client *redis.Client) *RedisSessionEventLog {
+	return &RedisSessionEventLog{client: client}
+}
+
+func (l *RedisSessionEventLog) Append(sessionID string, event *SessionEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode session event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := redisSessionKeyPrefix + sessionID + ":events"
+	pipe := l.client.TxPipeline()
+	length := pipe.RPush(ctx, key, data)
+	pipe.Expire(ctx, key, redisSessionTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to append session event: %w", err)
+	}
+	event.Index = int(length.Val()) - 1
+	return nil
+}
+
+func (l *RedisSessionEventLog) Since(sessionID string, from int) ([]SessionEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := redisSessionKeyPrefix + sessionID + ":events"
+	values, err := l.client.LRange(ctx, key, int64(from), -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session events: %w", err)
+	}
+	if len(values) == 0 {
+		exists, err := l.client.Exists(ctx, key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session events: %w", err)
+		}
+		if exists == 0 {
+			return nil, ErrSessionNotFound
+		}
+		return nil, nil
+	}
+
+	events := make([]SessionEvent, 0, len(values))
+	for i, value := range values {
+		var event SessionEvent
+		if err := json.Unmarshal([]byte(value), &event); err != nil {
+			return nil, fmt.Errorf("failed to decode session event: %w", err)
+		}
+		// The index is assigned by position; RPUSH can't know it up front
+		event.Index = from + i
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// SessionHub records session events and wakes streams waiting on them
+type SessionHub struct {
+	log SessionEventLog
+
+	waiters map[string]chan struct{}
+	mu      sync.Mutex
+}
+
+// NewSessionHub creates a hub backed by log
+func NewSessionHub(log SessionEventLog) *SessionHub {
+	return &SessionHub{
+		log:     log,
+		waiters: make(map[string]chan struct{}),
+	}
+}
+
+// Publish appends an event to a session's log and wakes its streams
+func (h *SessionHub) Publish(sessionID, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode %s event for session %s: %v", eventType, sessionID, err)
+		return
+	}
+
+	event := &SessionEvent{
+		Type:      eventType,
+		Data:      payload,
+		Timestamp: time.Now(),
+	}
+	if err := h.log.Append(sessionID, event); err != nil {
+		log.Printf("Failed to record %s event for session %s: %v", eventType, sessionID, err)
+		return
+	}
+
+	h.mu.Lock()
+	if ch, ok := h.waiters[sessionID]; ok {
+		close(ch)
+		delete(h.waiters, sessionID)
+	}
+	h.mu.Unlock()
+}
+
+// wait returns a channel closed on the session's next event
+func (h *SessionHub) wait(sessionID string) <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch, ok := h.waiters[sessionID]
+	if !ok {
+		ch = make(chan struct{})
+		h.waiters[sessionID] = ch
+	}
+	return ch
+}
+
+var sessionHub = NewSessionHub(NewMemorySessionEventLog())
+
+// handleProcessAsync starts a ProcessRequest run in the background and
+// returns its session ID; progress is streamed from /sessions/:id/events
+func handleProcessAsync(c *gin.Context) {
+	var req AgentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.ProjectID == "" {
+		req.ProjectID = uuid.New().String()
+	}
+	sessionID := uuid.New().String()
+
+	// Record the session before returning so the events URL resolves at once
+	sessionHub.Publish(sessionID, SessionEventAccepted, gin.H{
+		"session_id": sessionID,
+		"project_id": req.ProjectID,
+	})
+
+	go runSession(sessionID, req)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"session_id": sessionID,
+		"project_id": req.ProjectID,
+		"events_url": "/api/v1/sessions/" + sessionID + "/events",
+	})
+}
+
+// runSession runs a request, publishing progress and the final response
+func runSession(sessionID string, req AgentRequest) {
+	progress := func(event orchestrator.ProgressEvent) {
+		sessionHub.Publish(sessionID, string(event.Type), event)
+	}
+
+	ctx := context.Background()
+	result, err := agentOrchestrator.ProcessRequestWithProgress(ctx, req.Requirements, req.ProjectID, sessionID, progress)
+	if err != nil {
+		log.Printf("Session %s failed: %v", sessionID, err)
+		sessionHub.Publish(sessionID, SessionEventFailed, AgentResponse{
+			Success:   false,
+			SessionID: sessionID,
+			ProjectID: req.ProjectID,
+			Error:     err.Error(),
+		})
+		return
+	}
+
+	publishStageDrops(req.ProjectID, sessionID, result)
+
+	sessionHub.Publish(sessionID, SessionEventCompleted, AgentResponse{
+		Success:       result.Success,
+		SessionID:     sessionID,
+		ProjectID:     req.ProjectID,
+		GeneratedCode: result.GeneratedCode,
+		Architecture:  result.Architecture,
+		Tests:         result.Tests,
+		Documentation: result.Documentation,
+		Metrics:       result.Metrics,
+	})
+}
+
+// handleSessionEvents streams a session's events as Server-Sent Events,
+// replaying from ?from= or the Last-Event-ID header, until the session ends
+func handleSessionEvents(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	next := 0
+	if v := c.GetHeader("Last-Event-ID"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			next = n + 1
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a non-negative integer"})
+			return
+		}
+		next = n
+	}
+
+	events, err := sessionHub.log.Since(sessionID, next)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	keepAlive := time.NewTicker(sessionKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		// Register before writing so an event published meanwhile isn't missed
+		woken := sessionHub.wait(sessionID)
+
+		for _, event := range events {
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Index, event.Type, event.Data)
+			next = event.Index + 1
+			if event.Final() {
+				c.Writer.Flush()
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		if shuttingDown.Load() {
+			return
+		}
+
+		select {
+		case <-woken:
+		case <-time.After(sessionPollInterval):
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+
+		events, err = sessionHub.log.Since(sessionID, next)
+		if err != nil {
+			log.Printf("Failed to read events for session %s: %v", sessionID, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/orchestrator"
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/types"
+)
+
+func newRedisStore(t *testing.T) *RedisTaskStore {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	store, err := NewRedisTaskStore("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("NewRedisTaskStore: %v", err)
+	}
+	t.Cleanup(func() { store.client.Close() })
+	return store
+}
+
+func TestGracefulShutdownFinishesInFlightRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer shuttingDown.Store(false)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	r := gin.New()
+	r.Use(drainMiddleware())
+	r.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"status": "done"})
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: r}
+	go srv.Serve(ln)
+
+	type result struct {
+		status int
+		err    error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		resp.Body.Close()
+		inFlight <- result{status: resp.StatusCode}
+	}()
+	<-entered
+
+	shuttingDown.Store(true)
+	done := make(chan struct{})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		gracefulShutdown(ctx, srv, orchestrator.NewAgentOrchestrator("", nil), newRedisStore(t))
+		close(done)
+	}()
+
+	// New requests on open connections are refused while draining
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("request during shutdown got %d, want 503", w.Code)
+	}
+
+	select {
+	case <-done:
+		t.Fatal("shutdown finished before the in-flight request")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+	res := <-inFlight
+	if res.err != nil || res.status != http.StatusOK {
+		t.Fatalf("in-flight request = %d, %v; want 200", res.status, res.err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not finish after the in-flight request")
+	}
+}
+
+func TestPendingTasksReloadedAfterShutdown(t *testing.T) {
+	stores := map[string]func(t *testing.T) PendingTaskStore{
+		"redis": func(t *testing.T) PendingTaskStore { return newRedisStore(t) },
+		"file": func(t *testing.T) PendingTaskStore {
+			return &FilePendingStore{path: filepath.Join(t.TempDir(), "pending.json")}
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+
+			// No agents are running, so the tasks stay queued
+			old := orchestrator.NewAgentOrchestrator("", nil)
+			ctx := context.Background()
+			old.EnqueueTask(ctx, &types.Task{ID: "task-1", Type: "generate_api", Priority: 1})
+			old.EnqueueTask(ctx, &types.Task{ID: "task-2", Type: "design_system", Priority: 5})
+
+			shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			gracefulShutdown(shutdownCtx, &http.Server{}, old, store)
+
+			next := orchestrator.NewAgentOrchestrator("", nil)
+			if n := restorePendingTasks(next, store); n != 2 {
+				t.Fatalf("restored %d tasks, want 2", n)
+			}
+			if depth := next.QueueMetrics().Depth; depth != 2 {
+				t.Fatalf("queue depth after restore = %d, want 2", depth)
+			}
+			record, err := next.GetTask("task-2")
+			if err != nil || record.Priority != 5 || record.Status != types.TaskPending {
+				t.Fatalf("restored task-2 = %+v, %v", record, err)
+			}
+
+			// Tasks are handed to exactly one replica
+			if n := restorePendingTasks(orchestrator.NewAgentOrchestrator("", nil), store); n != 0 {
+				t.Fatalf("second restore requeued %d tasks, want 0", n)
+			}
+		})
+	}
+}
+
+func TestRedisPendingTasksKeepEveryReplicasTasks(t *testing.T) {
+	store := newRedisStore(t)
+	if err := store.SavePending([]*types.Task{{ID: "a"}}); err != nil {
+		t.Fatalf("SavePending: %v", err)
+	}
+	if err := store.SavePending([]*types.Task{{ID: "b"}, {ID: "c"}}); err != nil {
+		t.Fatalf("SavePending: %v", err)
+	}
+
+	tasks, err := store.TakePending()
+	if err != nil {
+		t.Fatalf("TakePending: %v", err)
+	}
+	if len(tasks) != 3 || tasks[0].ID != "a" || tasks[2].ID != "c" {
+		t.Fatalf("TakePending = %v, want a, b, c", tasks)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/packages/agents/orchestrator"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisTaskKeyPrefix = "agent-orchestrator:task:"
+	redisTaskIndexKey  = "agent-orchestrator:tasks"
+	redisTaskTTL       = 7 * 24 * time.Hour
+)
+
+// RedisTaskStore persists task records in Redis so task status survives
+// restarts and is visible to every replica
+type RedisTaskStore struct {
+	client *redis.Client
+}
+
+// NewRedisTaskStore connects to the Redis instance at redisURL
+func NewRedisTaskStore(redisURL string) (*RedisTaskStore, error) {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	client := redis.NewClient(opt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &RedisTaskStore{client: client}, nil
+}
+
+func (s *RedisTaskStore) Save(record *orchestrator.TaskRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode task record: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, redisTaskKeyPrefix+record.ID, data, redisTaskTTL)
+	pipe.ZAdd(ctx, redisTaskIndexKey, redis.Z{
+		Score:  float64(record.CreatedAt.UnixNano()),
+		Member: record.ID,
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save task record: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisTaskStore) Get(id string) (*orchestrator.TaskRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, redisTaskKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, orchestrator.ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task record: %w", err)
+	}
+
+	var record orchestrator.TaskRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode task record: %w", err)
+	}
+	return &record, nil
+}
+
+func (s *RedisTaskStore) List(filter orchestrator.TaskFilter) ([]*orchestrator.TaskRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ids, err := s.client.ZRevRange(ctx, redisTaskIndexKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list task ids: %w", err)
+	}
+
+	records := []*orchestrator.TaskRecord{}
+	const batch = 100
+	for start := 0; start < len(ids); start += batch {
+		end := start + batch
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		keys := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			keys = append(keys, redisTaskKeyPrefix+id)
+		}
+		values, err := s.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load task records: %w", err)
+		}
+
+		var expired []interface{}
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				// Record expired, drop it from the index
+				expired = append(expired, ids[start+i])
+				continue
+			}
+			var record orchestrator.TaskRecord
+			if err := json.Unmarshal([]byte(data), &record); err != nil {
+				continue
+			}
+			if !filter.Matches(&record) {
+				continue
+			}
+			records = append(records, &record)
+			if filter.Limit > 0 && len(records) >= filter.Limit {
+				return records, nil
+			}
+		}
+		if len(expired) > 0 {
+			s.client.ZRem(ctx, redisTaskIndexKey, expired...)
+		}
+	}
+
+	return records, nil
+}
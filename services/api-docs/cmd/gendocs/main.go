@@ -0,0 +1,25 @@
+// Command gendocs regenerates docs/swagger.json from the annotations in
+// api-docs. Run it with go generate from the service directory.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/quantumlayer-dev/quantumlayer-platform/services/api-docs/internal/apispec"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "service directory holding the annotations")
+	out := flag.String("o", "docs/swagger.json", "file to write the spec to")
+	flag.Parse()
+
+	data, err := apispec.Generate(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+}
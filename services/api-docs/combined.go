@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quantumlayer-dev/quantumlayer-platform/services/api-docs/docs"
+	"github.com/quantumlayer-dev/quantumlayer-platform/services/api-docs/internal/apispec"
+)
+
+const (
+	// specFetchTimeout bounds fetching one service's spec
+	specFetchTimeout = 5 * time.Second
+	// maxServiceSpecBytes caps a service's spec
+	maxServiceSpecBytes = 5 << 20
+	// combinedSpecTTL is how long a combined spec is served before the
+	// services are asked again
+	combinedSpecTTL = time.Minute
+	// localSpecService names the spec api-docs generates itself
+	localSpecService = "api-docs"
+)
+
+// specService is a service whose /openapi.json is merged into the combined spec
+type specService struct {
+	Name string
+	URL  string
+}
+
+// serviceStatus reports how fetching one service's spec went
+type serviceStatus struct {
+	Name  string `json:"name"`
+	URL   string `json:"url,omitempty"`
+	Paths int    `json:"paths"`
+	Error string `json:"error,omitempty"`
+}
+
+// parseSpecServices reads OPENAPI_SERVICES, a comma-separated list of
+// name=base-url pairs
+func parseSpecServices(raw string) ([]specService, error) {
+	var services []specService
+	seen := map[string]bool{localSpecService: true}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, url, ok := strings.Cut(entry, "=")
+		name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+		if !ok || name == "" || url == "" {
+			return nil, fmt.Errorf("invalid OPENAPI_SERVICES entry %q, want name=url", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("service %q is listed twice in OPENAPI_SERVICES", name)
+		}
+		seen[name] = true
+		services = append(services, specService{Name: name, URL: strings.TrimSuffix(url, "/")})
+	}
+	return services, nil
+}
+
+// specAggregator merges the spec api-docs generates with the specs the
+// platform's services publish, caching the result for a while
+type specAggregator struct {
+	services []specService
+	local    []byte
+	client   *http.Client
+	ttl      time.Duration
+
+	mu       sync.Mutex
+	cached   []byte
+	cachedAt time.Time
+}
+
+func newSpecAggregator(services []specService) *specAggregator {
+	return &specAggregator{
+		services: services,
+		local:    docs.SwaggerJSON,
+		client:   &http.Client{Timeout: specFetchTimeout},
+		ttl:      combinedSpecTTL,
+	}
+}
+
+// newSpecAggregatorFromEnv configures the aggregator from OPENAPI_SERVICES
+func newSpecAggregatorFromEnv() (*specAggregator, error) {
+	services, err := parseSpecServices(os.Getenv("OPENAPI_SERVICES"))
+	if err != nil {
+		return nil, err
+	}
+	return newSpecAggregator(services), nil
+}
+
+// handleCombined serves the merged spec. Services that can't be reached or
+// don't publish a usable spec are left out and listed under x-services.
+func (a *specAggregator) handleCombined(c *gin.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cached == nil || time.Since(a.cachedAt) >= a.ttl {
+		combined, err := a.combine(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		a.cached, a.cachedAt = combined, time.Now()
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", a.cached)
+}
+
+// combine fetches every service's spec in parallel and merges them, the
+// local spec first so its definitions keep their names
+func (a *specAggregator) combine(ctx context.Context) ([]byte, error) {
+	local, err := apispec.Parse(a.local)
+	if err != nil {
+		return nil, fmt.Errorf("generated spec: %w", err)
+	}
+
+	statuses := make([]serviceStatus, len(a.services)+1)
+	sources := make([]*apispec.Source, len(a.services)+1)
+	statuses[0] = serviceStatus{Name: localSpecService}
+	sources[0] = &apispec.Source{Service: localSpecService, Doc: local}
+
+	var wg sync.WaitGroup
+	for i, service := range a.services {
+		statuses[i+1] = serviceStatus{Name: service.Name, URL: service.URL}
+		wg.Add(1)
+		go func(i int, service specService) {
+			defer wg.Done()
+			doc, err := a.fetch(ctx, service)
+			if err != nil {
+				statuses[i].Error = err.Error()
+				return
+			}
+			sources[i] = &apispec.Source{Service: service.Name, Doc: doc}
+		}(i+1, service)
+	}
+	wg.Wait()
+
+	var merged []apispec.Source
+	for i, source := range sources {
+		if source == nil {
+			continue
+		}
+		paths, _ := source.Doc["paths"].(map[string]interface{})
+		statuses[i].Paths = len(paths)
+		merged = append(merged, *source)
+	}
+
+	combined, conflicts := apispec.Merge(local["info"], merged)
+	combined["x-services"] = statuses
+	combined["x-conflicts"] = conflicts
+	return json.MarshalIndent(combined, "", "    ")
+}
+
+// fetch downloads and parses one service's spec
+func (a *specAggregator) fetch(ctx context.Context, service specService) (apispec.Document, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, service.URL+"/openapi.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch spec: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("spec request returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxServiceSpecBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec: %w", err)
+	}
+	if len(data) > maxServiceSpecBytes {
+		return nil, fmt.Errorf("spec exceeds %d bytes", maxServiceSpecBytes)
+	}
+
+	return apispec.Parse(data)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/spec"
+)
+
+const serviceASpec = `{
+	"swagger": "2.0",
+	"basePath": "/a/v1",
+	"tags": [{"name": "Items"}],
+	"paths": {
+		"/items": {"get": {"tags": ["Items"], "responses": {
+			"200": {"description": "OK", "schema": {"type": "array", "items": {"$ref": "#/definitions/Item"}}},
+			"500": {"description": "Error", "schema": {"$ref": "#/definitions/common.Error"}}
+		}}}
+	},
+	"definitions": {
+		"Item": {"type": "object", "properties": {"id": {"type": "string"}}},
+		"common.Error": {"type": "object", "properties": {"error": {"type": "string"}}}
+	}
+}`
+
+const serviceBSpec = `{
+	"swagger": "2.0",
+	"basePath": "/b",
+	"tags": [{"name": "Items"}, {"name": "Orders"}],
+	"paths": {
+		"/orders": {"post": {"tags": ["Orders"], "responses": {
+			"201": {"description": "Created", "schema": {"$ref": "#/definitions/Order"}},
+			"500": {"description": "Error", "schema": {"$ref": "#/definitions/common.Error"}}
+		}}}
+	},
+	"definitions": {
+		"Item": {"type": "object", "properties": {"sku": {"type": "string"}, "quantity": {"type": "integer"}}},
+		"Order": {"type": "object", "properties": {"items": {"type": "array", "items": {"$ref": "#/definitions/Item"}}}},
+		"common.Error": {"type": "object", "properties": {"error": {"type": "string"}}}
+	}
+}`
+
+func specServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openapi.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type combinedSpec struct {
+	Paths       map[string]map[string]json.RawMessage `json:"paths"`
+	Definitions map[string]json.RawMessage            `json:"definitions"`
+	Tags        []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+	Services  []serviceStatus   `json:"x-services"`
+	Conflicts []json.RawMessage `json:"x-conflicts"`
+}
+
+func getCombined(t *testing.T, aggregator *specAggregator) ([]byte, combinedSpec) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/openapi/combined.json", aggregator.handleCombined)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi/combined.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+
+	var combined combinedSpec
+	if err := json.Unmarshal(w.Body.Bytes(), &combined); err != nil {
+		t.Fatal(err)
+	}
+	return w.Body.Bytes(), combined
+}
+
+func TestCombinedSpecMergesServices(t *testing.T) {
+	a, b := specServer(t, serviceASpec), specServer(t, serviceBSpec)
+	aggregator := newSpecAggregator([]specService{{Name: "svc-a", URL: a.URL}, {Name: "svc-b", URL: b.URL}})
+
+	body, combined := getCombined(t, aggregator)
+
+	if len(combined.Conflicts) != 0 {
+		t.Fatalf("conflicts = %s, want none", combined.Conflicts)
+	}
+	for path, method := range map[string]string{
+		"/a/v1/items":                   "get",
+		"/b/orders":                     "post",
+		"/api/v1/workflows/generate":    "post",
+		"/api/v1/workflows/{id}/cancel": "post",
+	} {
+		if _, ok := combined.Paths[path][method]; !ok {
+			t.Errorf("%s %s missing from combined spec", method, path)
+		}
+	}
+
+	// The identical error schema is kept once; the two different Items
+	// both survive, svc-b's renamed along with the references to it
+	for _, name := range []string{"common.Error", "Item", "svc-b.Item", "Order", "contracts.CodeGenerationRequest"} {
+		if _, ok := combined.Definitions[name]; !ok {
+			t.Errorf("definition %s missing", name)
+		}
+	}
+	for _, name := range []string{"svc-a.Item", "svc-b.common.Error", "svc-b.Order"} {
+		if _, ok := combined.Definitions[name]; ok {
+			t.Errorf("definition %s should not exist", name)
+		}
+	}
+	var order struct {
+		Properties struct {
+			Items struct {
+				Items struct {
+					Ref string `json:"$ref"`
+				} `json:"items"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	json.Unmarshal(combined.Definitions["Order"], &order)
+	if ref := order.Properties.Items.Items.Ref; ref != "#/definitions/svc-b.Item" {
+		t.Errorf("Order items ref = %q, want svc-b's Item", ref)
+	}
+
+	var tags []string
+	for _, tag := range combined.Tags {
+		tags = append(tags, tag.Name)
+	}
+	if len(tags) != 4 || tags[2] != "Items" || tags[3] != "Orders" {
+		t.Errorf("tags = %v, want api-docs' tags then Items and Orders once", tags)
+	}
+
+	var swagger spec.Swagger
+	if err := json.Unmarshal(body, &swagger); err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.ExpandSpec(&swagger, nil); err != nil {
+		t.Fatalf("combined spec has unresolved refs: %v", err)
+	}
+}
+
+func TestCombinedSpecReportsConflictsAndFailures(t *testing.T) {
+	a := specServer(t, serviceASpec)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	aggregator := newSpecAggregator([]specService{
+		{Name: "svc-a", URL: a.URL},
+		{Name: "svc-a-copy", URL: a.URL},
+		{Name: "svc-down", URL: down.URL},
+	})
+
+	_, combined := getCombined(t, aggregator)
+
+	if len(combined.Conflicts) != 1 {
+		t.Fatalf("conflicts = %s, want svc-a-copy's GET /a/v1/items", combined.Conflicts)
+	}
+	var conflict struct {
+		Service  string `json:"service"`
+		Name     string `json:"name"`
+		KeptFrom string `json:"kept_from"`
+	}
+	json.Unmarshal(combined.Conflicts[0], &conflict)
+	if conflict.Service != "svc-a-copy" || conflict.Name != "GET /a/v1/items" || conflict.KeptFrom != "svc-a" {
+		t.Fatalf("conflict = %+v", conflict)
+	}
+
+	statuses := map[string]serviceStatus{}
+	for _, status := range combined.Services {
+		statuses[status.Name] = status
+	}
+	if s := statuses["svc-down"]; s.Error == "" || s.Paths != 0 {
+		t.Errorf("svc-down status = %+v, want the fetch error", s)
+	}
+	if s := statuses["svc-a"]; s.Error != "" || s.Paths != 1 {
+		t.Errorf("svc-a status = %+v", s)
+	}
+	if s := statuses[localSpecService]; s.Paths == 0 {
+		t.Errorf("local status = %+v, want its paths counted", s)
+	}
+}
+
+func TestParseSpecServices(t *testing.T) {
+	services, err := parseSpecServices(" llm-router=http://llm-router:8080/ , qtest=http://qtest:8091")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 || services[0] != (specService{Name: "llm-router", URL: "http://llm-router:8080"}) {
+		t.Fatalf("services = %+v", services)
+	}
+	for _, raw := range []string{"llm-router", "a=http://a,a=http://b", "api-docs=http://x", "=http://x"} {
+		if _, err := parseSpecServices(raw); err == nil {
+			t.Errorf("parseSpecServices(%q) succeeded", raw)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Package docs registers the generated OpenAPI spec with swag so gin-swagger
+// serves it. Run go generate in services/api-docs after changing an
+// annotation or a contract type to refresh swagger.json.
+package docs
+
+import (
+	_ "embed"
+
+	"github.com/swaggo/swag"
+)
+
+// SwaggerJSON is the generated spec
+//
+//go:embed swagger.json
+var SwaggerJSON []byte
+
+type spec struct{}
+
+func (spec) ReadDoc() string {
+	return string(SwaggerJSON)
+}
+
+func init() {
+	swag.Register(swag.Name, spec{})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/contracts"
+)
+
+// The functions below only carry the annotations swag builds the spec from;
+// the endpoints are served by workflow-api. Request and response bodies are
+// the contract types that service binds and writes, so a change to the wire
+// format shows up here when docs/swagger.json is regenerated.
+
+// These packages are referenced by name from the annotations, which needs
+// them imported for swag to resolve the types from source
+var (
+	_ contracts.CodeGenerationRequest
+	_ apierror.Response
+)
+
+// generateCode godoc
+// @Summary Generate code
+// @Description Starts a code generation workflow. With wait, blocks until the workflow completes or the wait runs out. Repeating an id or Idempotency-Key returns the workflow already started, with already_running set, instead of starting another.
+// @Tags Workflows
+// @Accept json
+// @Produce json
+// @Param wait query string false "How long to wait for the result, as a duration (60s) or seconds; capped at 120s"
+// @Param request body contracts.CodeGenerationRequest true "Code generation request"
+// @Param Idempotency-Key header string false "Keys the workflow when the request has no id, so a retry returns the workflow already started"
+// @Success 200 {object} contracts.WorkflowResult "Completed within the wait"
+// @Success 202 {object} contracts.WorkflowResponse "Started, or still running after the wait"
+// @Failure 400 {object} apierror.Response
+// @Failure 413 {object} apierror.Response
+// @Router /workflows/generate [post]
+func generateCode() {}
+
+// generateExtendedCode godoc
+// @Summary Generate code with the extended pipeline
+// @Description Starts the multi-stage workflow that also produces an FRD, tests, documentation and deployment artifacts. Repeating an id or Idempotency-Key returns the workflow already started, with already_running set, instead of starting another.
+// @Tags Workflows
+// @Accept json
+// @Produce json
+// @Param wait query string false "How long to wait for the result, as a duration (60s) or seconds; capped at 120s"
+// @Param request body contracts.CodeGenerationRequest true "Code generation request"
+// @Param Idempotency-Key header string false "Keys the workflow when the request has no id, so a retry returns the workflow already started"
+// @Success 200 {object} contracts.WorkflowResult "Completed within the wait"
+// @Success 202 {object} contracts.WorkflowResponse "Started, or still running after the wait"
+// @Failure 400 {object} apierror.Response
+// @Failure 413 {object} apierror.Response
+// @Router /workflows/generate-extended [post]
+func generateExtendedCode() {}
+
+// generateIntelligentCode godoc
+// @Summary Generate a multi-file project
+// @Description Starts the intelligent workflow that plans and generates a multi-file project. Repeating an id or Idempotency-Key returns the workflow already started, with already_running set, instead of starting another.
+// @Tags Workflows
+// @Accept json
+// @Produce json
+// @Param wait query string false "How long to wait for the result, as a duration (60s) or seconds; capped at 120s"
+// @Param request body contracts.CodeGenerationRequest true "Code generation request"
+// @Param Idempotency-Key header string false "Keys the workflow when the request has no id, so a retry returns the workflow already started"
+// @Success 200 {object} contracts.WorkflowResult "Completed within the wait"
+// @Success 202 {object} contracts.WorkflowResponse "Started, or still running after the wait"
+// @Failure 400 {object} apierror.Response
+// @Failure 413 {object} apierror.Response
+// @Router /workflows/generate-intelligent [post]
+func generateIntelligentCode() {}
+
+// getWorkflowResult godoc
+// @Summary Get a workflow result
+// @Description Returns the output of a completed workflow, waiting up to 10s for a running one
+// @Tags Workflows
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /workflows/{id}/result [get]
+func getWorkflowResult() {}
+
+// getWorkflowProgress godoc
+// @Summary Get workflow progress
+// @Description Reports which stages of a workflow have stored their output and how far along it is
+// @Tags Workflows
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Success 200 {object} contracts.WorkflowProgress
+// @Failure 404 {object} map[string]interface{}
+// @Router /workflows/{id}/progress [get]
+func getWorkflowProgress() {}
+
+// cancelWorkflow godoc
+// @Summary Cancel a workflow
+// @Description Asks a running workflow to stop after cleaning up
+// @Tags Workflows
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Success 202 {object} contracts.WorkflowResponse
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "The workflow is not running"
+// @Router /workflows/{id}/cancel [post]
+func cancelWorkflow() {}
+
+// terminateWorkflow godoc
+// @Summary Terminate a workflow
+// @Description Stops a running workflow immediately, without running its cleanup
+// @Tags Workflows
+// @Accept json
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Param request body contracts.TerminateRequest false "Reason recorded in the workflow history"
+// @Success 200 {object} contracts.WorkflowResponse
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{} "The workflow is not running"
+// @Router /workflows/{id}/terminate [post]
+func terminateWorkflow() {}
+
+// getCapabilities godoc
+// @Summary List generation capabilities
+// @Description Lists the languages, frameworks and project types generation requests may use, and the prompt size limit
+// @Tags Capabilities
+// @Produce json
+// @Success 200 {object} contracts.Capabilities
+// @Router /capabilities [get]
+func getCapabilities() {}
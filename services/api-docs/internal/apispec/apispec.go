@@ -0,0 +1,35 @@
+// Package apispec generates the platform's OpenAPI spec from the swag
+// annotations in api-docs and the contract types they reference
+package apispec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/swaggo/swag"
+)
+
+// MainFile holds the general API annotations, relative to the service directory
+const MainFile = "main.go"
+
+// Generate parses the annotations in the service directory dir, resolving
+// the referenced types from its dependencies' source, and returns the spec
+// as indented JSON
+func Generate(dir string) ([]byte, error) {
+	parser := swag.New(
+		swag.SetParseDependency(swag.ParseModels),
+		swag.ParseUsingGoList(true),
+		swag.SetDebugger(log.New(io.Discard, "", 0)),
+	)
+	if err := parser.ParseAPI(dir, MainFile, 100); err != nil {
+		return nil, fmt.Errorf("failed to parse annotations: %w", err)
+	}
+
+	data, err := json.MarshalIndent(parser.GetSwagger(), "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spec: %w", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,224 @@
+package apispec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// sections are the top-level maps of reusable objects operations refer to
+// with $ref
+var sections = []string{"definitions", "parameters", "responses"}
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+// Document is a parsed Swagger 2.0 spec
+type Document map[string]interface{}
+
+// Source is one service's spec to merge
+type Source struct {
+	Service string
+	Doc     Document
+}
+
+// Conflict is something a service documents that another service already
+// claimed; the first service's version is kept
+type Conflict struct {
+	Service  string `json:"service"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	KeptFrom string `json:"kept_from"`
+}
+
+// Parse decodes a spec, accepting only Swagger 2.0 documents
+func Parse(data []byte) (Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+	if version, _ := doc["swagger"].(string); version != "2.0" {
+		return nil, fmt.Errorf("unsupported spec version %q, want swagger 2.0", version)
+	}
+	return doc, nil
+}
+
+// Merge combines the specs of several services into one, in order. Each
+// service's paths are prefixed with its basePath. Definitions, parameters
+// and responses that are identical across services are kept once; a name
+// that means different things in two services is renamed to
+// "<service>.<name>" in the later one and its references rewritten. An
+// operation or security definition already documented by an earlier service
+// is dropped and reported as a conflict.
+func Merge(info interface{}, sources []Source) (Document, []Conflict) {
+	merged := Document{
+		"swagger":             "2.0",
+		"info":                info,
+		"paths":               map[string]interface{}{},
+		"securityDefinitions": map[string]interface{}{},
+	}
+	for _, section := range sections {
+		merged[section] = map[string]interface{}{}
+	}
+
+	var tags []interface{}
+	seenTags := map[string]bool{}
+	owners := map[string]string{}
+	conflicts := []Conflict{}
+
+	for _, source := range sources {
+		renames := reusableRenames(merged, source)
+
+		for _, section := range sections {
+			target := merged[section].(map[string]interface{})
+			for name, object := range objectMap(source.Doc[section]) {
+				ref := "#/" + section + "/" + name
+				if renamed, ok := renames[ref]; ok {
+					name = strings.TrimPrefix(renamed, "#/"+section+"/")
+				}
+				if _, ok := target[name]; !ok {
+					target[name] = rewriteRefs(object, renames)
+				}
+			}
+		}
+
+		basePath := strings.TrimSuffix(stringValue(source.Doc["basePath"]), "/")
+		paths := merged["paths"].(map[string]interface{})
+		for path, item := range objectMap(source.Doc["paths"]) {
+			fullPath := basePath + path
+			mergedItem, ok := paths[fullPath].(map[string]interface{})
+			if !ok {
+				mergedItem = map[string]interface{}{}
+			}
+			for key, value := range objectMap(item) {
+				if !isMethod(key) {
+					// Path-level parameters and extensions
+					if _, ok := mergedItem[key]; !ok {
+						mergedItem[key] = rewriteRefs(value, renames)
+					}
+					continue
+				}
+				operation := strings.ToUpper(key) + " " + fullPath
+				if owner, ok := owners[operation]; ok {
+					conflicts = append(conflicts, Conflict{Service: source.Service, Kind: "operation", Name: operation, KeptFrom: owner})
+					continue
+				}
+				owners[operation] = source.Service
+				mergedItem[key] = rewriteRefs(value, renames)
+			}
+			if len(mergedItem) > 0 {
+				paths[fullPath] = mergedItem
+			}
+		}
+
+		securityDefinitions := merged["securityDefinitions"].(map[string]interface{})
+		for name, definition := range objectMap(source.Doc["securityDefinitions"]) {
+			existing, ok := securityDefinitions[name]
+			if !ok {
+				securityDefinitions[name] = definition
+				owners["security "+name] = source.Service
+				continue
+			}
+			if !reflect.DeepEqual(existing, definition) {
+				conflicts = append(conflicts, Conflict{Service: source.Service, Kind: "security_definition", Name: name, KeptFrom: owners["security "+name]})
+			}
+		}
+
+		for _, tag := range sliceValue(source.Doc["tags"]) {
+			name := stringValue(objectMap(tag)["name"])
+			if name == "" || seenTags[name] {
+				continue
+			}
+			seenTags[name] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(tags) > 0 {
+		merged["tags"] = tags
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Service != conflicts[j].Service {
+			return conflicts[i].Service < conflicts[j].Service
+		}
+		return conflicts[i].Name < conflicts[j].Name
+	})
+	return merged, conflicts
+}
+
+// reusableRenames decides which of a source's reusable objects must be
+// renamed because the merged spec already holds a different object under
+// the same name. Renaming one object changes the objects that refer to it,
+// so it repeats until nothing else needs renaming.
+func reusableRenames(merged Document, source Source) map[string]string {
+	renames := map[string]string{}
+	for changed := true; changed; {
+		changed = false
+		for _, section := range sections {
+			existing := merged[section].(map[string]interface{})
+			for name, object := range objectMap(source.Doc[section]) {
+				ref := "#/" + section + "/" + name
+				if _, ok := renames[ref]; ok {
+					continue
+				}
+				current, ok := existing[name]
+				if !ok || reflect.DeepEqual(current, rewriteRefs(object, renames)) {
+					continue
+				}
+				renames[ref] = "#/" + section + "/" + source.Service + "." + name
+				changed = true
+			}
+		}
+	}
+	return renames
+}
+
+// rewriteRefs returns a copy of value with every $ref in renames replaced
+func rewriteRefs(value interface{}, renames map[string]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if ref, ok := item.(string); ok && key == "$ref" {
+				if renamed, ok := renames[ref]; ok {
+					item = renamed
+				}
+			}
+			copied[key] = rewriteRefs(item, renames)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = rewriteRefs(item, renames)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+func isMethod(key string) bool {
+	for _, method := range methods {
+		if key == method {
+			return true
+		}
+	}
+	return false
+}
+
+func objectMap(value interface{}) map[string]interface{} {
+	m, _ := value.(map[string]interface{})
+	return m
+}
+
+func sliceValue(value interface{}) []interface{} {
+	s, _ := value.([]interface{})
+	return s
+}
+
+func stringValue(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
@@ -0,0 +1,55 @@
+package apispec
+
+import (
+	"testing"
+)
+
+func mustParse(t *testing.T, data string) Document {
+	t.Helper()
+	doc, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// An object that reads the same in two services but refers to a renamed
+// object means something different too, so it is renamed with it
+func TestMergeRenamesDependents(t *testing.T) {
+	first := mustParse(t, `{"swagger": "2.0", "definitions": {
+		"Item": {"type": "object", "properties": {"id": {"type": "string"}}},
+		"Order": {"type": "object", "properties": {"item": {"$ref": "#/definitions/Item"}}}
+	}}`)
+	second := mustParse(t, `{"swagger": "2.0", "paths": {"/orders": {"get": {"responses": {
+		"200": {"description": "OK", "schema": {"$ref": "#/definitions/Order"}}
+	}}}}, "definitions": {
+		"Item": {"type": "object", "properties": {"sku": {"type": "string"}}},
+		"Order": {"type": "object", "properties": {"item": {"$ref": "#/definitions/Item"}}}
+	}}`)
+
+	merged, conflicts := Merge(nil, []Source{{Service: "one", Doc: first}, {Service: "two", Doc: second}})
+	if len(conflicts) != 0 {
+		t.Fatalf("conflicts = %+v", conflicts)
+	}
+
+	definitions := merged["definitions"].(map[string]interface{})
+	if len(definitions) != 4 {
+		t.Fatalf("definitions = %v, want Item and Order from both services", definitions)
+	}
+	order := definitions["two.Order"].(map[string]interface{})
+	ref := order["properties"].(map[string]interface{})["item"].(map[string]interface{})["$ref"]
+	if ref != "#/definitions/two.Item" {
+		t.Fatalf("two.Order refers to %v", ref)
+	}
+
+	response := merged["paths"].(map[string]interface{})["/orders"].(map[string]interface{})["get"].(map[string]interface{})["responses"].(map[string]interface{})["200"].(map[string]interface{})
+	if ref := response["schema"].(map[string]interface{})["$ref"]; ref != "#/definitions/two.Order" {
+		t.Fatalf("operation refers to %v", ref)
+	}
+}
+
+func TestParseRejectsOpenAPI3(t *testing.T) {
+	if _, err := Parse([]byte(`{"openapi": "3.0.3", "paths": {}}`)); err == nil {
+		t.Fatal("Parse accepted an OpenAPI 3 document")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/contracts"
+	"github.com/go-openapi/spec"
+	"github.com/quantumlayer-dev/quantumlayer-platform/services/api-docs/docs"
+	"github.com/quantumlayer-dev/quantumlayer-platform/services/api-docs/internal/apispec"
+)
+
+func loadSpec(t *testing.T) *spec.Swagger {
+	t.Helper()
+	var swagger spec.Swagger
+	if err := json.Unmarshal(docs.SwaggerJSON, &swagger); err != nil {
+		t.Fatalf("docs/swagger.json does not parse: %v", err)
+	}
+	return &swagger
+}
+
+func TestSpecUpToDate(t *testing.T) {
+	generated, err := apispec.Generate(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(generated, docs.SwaggerJSON) {
+		t.Fatal("docs/swagger.json is stale, run go generate in services/api-docs")
+	}
+}
+
+func TestSpecEndpoints(t *testing.T) {
+	swagger := loadSpec(t)
+	if swagger.Swagger != "2.0" || swagger.BasePath != "/api/v1" {
+		t.Fatalf("swagger %q with base path %q", swagger.Swagger, swagger.BasePath)
+	}
+
+	tests := []struct {
+		method, path string
+		body         string // definition of the body parameter, if any
+		status       int
+		response     string
+	}{
+		{"POST", "/workflows/generate", "contracts.CodeGenerationRequest", 202, "contracts.WorkflowResponse"},
+		{"POST", "/workflows/generate-extended", "contracts.CodeGenerationRequest", 200, "contracts.WorkflowResult"},
+		{"POST", "/workflows/generate-intelligent", "contracts.CodeGenerationRequest", 400, "apierror.Response"},
+		{"GET", "/workflows/{id}/progress", "", 200, "contracts.WorkflowProgress"},
+		{"POST", "/workflows/{id}/cancel", "", 202, "contracts.WorkflowResponse"},
+		{"POST", "/workflows/{id}/terminate", "contracts.TerminateRequest", 200, "contracts.WorkflowResponse"},
+		{"GET", "/capabilities", "", 200, "contracts.Capabilities"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			item, ok := swagger.Paths.Paths[tt.path]
+			if !ok {
+				t.Fatal("path missing")
+			}
+			op := map[string]*spec.Operation{"GET": item.Get, "POST": item.Post}[tt.method]
+			if op == nil {
+				t.Fatal("operation missing")
+			}
+
+			if tt.body != "" {
+				var found bool
+				for _, param := range op.Parameters {
+					if param.In == "body" {
+						found = true
+						if ref := definitionName(param.Schema); ref != tt.body {
+							t.Fatalf("body schema = %q, want %q", ref, tt.body)
+						}
+					}
+				}
+				if !found {
+					t.Fatal("no body parameter")
+				}
+			}
+
+			resp, ok := op.Responses.StatusCodeResponses[tt.status]
+			if !ok {
+				t.Fatalf("no %d response", tt.status)
+			}
+			if ref := definitionName(resp.Schema); ref != tt.response {
+				t.Fatalf("%d schema = %q, want %q", tt.status, ref, tt.response)
+			}
+		})
+	}
+}
+
+func TestSpecRefsResolve(t *testing.T) {
+	swagger := loadSpec(t)
+	if err := spec.ExpandSpec(swagger, nil); err != nil {
+		t.Fatalf("spec does not expand: %v", err)
+	}
+}
+
+// TestSpecMatchesContracts checks the definitions against the Go types the
+// services encode, so a field added to a contract can't go undocumented
+func TestSpecMatchesContracts(t *testing.T) {
+	swagger := loadSpec(t)
+
+	for name, value := range map[string]interface{}{
+		"contracts.CodeGenerationRequest": contracts.CodeGenerationRequest{},
+		"contracts.WorkflowResponse":      contracts.WorkflowResponse{},
+		"contracts.WorkflowResult":        contracts.WorkflowResult{},
+		"contracts.TerminateRequest":      contracts.TerminateRequest{},
+		"contracts.WorkflowProgress":      contracts.WorkflowProgress{},
+		"contracts.StageProgress":         contracts.StageProgress{},
+		"contracts.Capabilities":          contracts.Capabilities{},
+		"apierror.Response":               apierror.Response{},
+		"apierror.Error":                  apierror.Error{},
+	} {
+		schema, ok := swagger.Definitions[name]
+		if !ok {
+			t.Errorf("definition %s missing", name)
+			continue
+		}
+		var documented []string
+		for property := range schema.Properties {
+			documented = append(documented, property)
+		}
+		sort.Strings(documented)
+
+		if want := jsonFields(reflect.TypeOf(value)); !reflect.DeepEqual(documented, want) {
+			t.Errorf("%s documents %v, the type encodes %v", name, documented, want)
+		}
+	}
+
+	required := swagger.Definitions["contracts.CodeGenerationRequest"].Required
+	sort.Strings(required)
+	if !reflect.DeepEqual(required, []string{"language", "prompt", "type"}) {
+		t.Errorf("CodeGenerationRequest requires %v", required)
+	}
+}
+
+// definitionName returns the definition a schema refers to
+func definitionName(schema *spec.Schema) string {
+	if schema == nil {
+		return ""
+	}
+	return strings.TrimPrefix(schema.Ref.String(), "#/definitions/")
+}
+
+// jsonFields lists the JSON names of a struct's encoded fields, sorted
+func jsonFields(typ reflect.Type) []string {
+	var fields []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+)
+
+// Statuses of a deployment made from a capsule before it is running. A
+// deployment that failed to get there stays failed, with the reason in
+// Error.
+const (
+	StatusTesting   = "testing"
+	StatusBuilding  = "building"
+	StatusDeploying = "deploying"
+	StatusFailed    = "failed"
+)
+
+const (
+	// capsulePipelineTimeout bounds testing, building and deploying a capsule
+	capsulePipelineTimeout = 30 * time.Minute
+
+	// smokeTestTimeoutSeconds bounds the capsule's test command in the sandbox
+	smokeTestTimeoutSeconds = 300
+
+	// maxSmokeTestOutput is how much of the test output a deployment keeps
+	maxSmokeTestOutput = 64 << 10
+
+	downstreamTimeout = 30 * time.Second
+)
+
+var (
+	errCapsuleNotFound      = errors.New("capsule not found")
+	errCapsuleNotDeployable = errors.New("capsule can't be deployed")
+	errDownstream           = errors.New("downstream service error")
+	errDeploymentNotReady   = errors.New("deployment is not running yet")
+)
+
+// DeployFromCapsuleRequest deploys a built capsule in one call
+type DeployFromCapsuleRequest struct {
+	CapsuleID  string `json:"capsule_id" binding:"required"`
+	TTLMinutes int    `json:"ttl_minutes" binding:"gte=0"`
+	// RunSmokeTest runs the capsule's test command in the sandbox first and
+	// deploys only if it passes
+	RunSmokeTest bool              `json:"run_smoke_test"`
+	Port         int32             `json:"port" binding:"gte=0,lte=65535"`
+	Environment  map[string]string `json:"environment"`
+}
+
+// SmokeTestResult is the outcome of a capsule's test command
+type SmokeTestResult struct {
+	ExecutionID     string  `json:"execution_id"`
+	Command         string  `json:"command"`
+	Passed          bool    `json:"passed"`
+	Status          string  `json:"status"`
+	ExitCode        int     `json:"exit_code"`
+	Output          string  `json:"output"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// CapsuleDeployConfig is where deploy-from-capsule finds capsules, runs
+// their tests and pushes their images, configured with CAPSULE_BUILDER_URL,
+// SANDBOX_EXECUTOR_URL and IMAGE_REGISTRY
+type CapsuleDeployConfig struct {
+	CapsuleBuilderURL string
+	SandboxURL        string
+	Registry          string
+	HTTPClient        *http.Client
+	// SandboxPollInterval is how often a running smoke test is checked
+	SandboxPollInterval time.Duration
+}
+
+func capsuleDeployConfigFromEnv() CapsuleDeployConfig {
+	config := CapsuleDeployConfig{
+		CapsuleBuilderURL:   "http://capsule-builder.quantumlayer.svc.cluster.local:8086",
+		SandboxURL:          "http://sandbox-executor.quantumlayer.svc.cluster.local:8085",
+		Registry:            "ghcr.io/quantumlayer-dev/capsules",
+		HTTPClient:          &http.Client{Timeout: downstreamTimeout},
+		SandboxPollInterval: 2 * time.Second,
+	}
+	if v := os.Getenv("CAPSULE_BUILDER_URL"); v != "" {
+		config.CapsuleBuilderURL = v
+	}
+	if v := os.Getenv("SANDBOX_EXECUTOR_URL"); v != "" {
+		config.SandboxURL = v
+	}
+	if v := os.Getenv("IMAGE_REGISTRY"); v != "" {
+		config.Registry = v
+	}
+	config.CapsuleBuilderURL = strings.TrimSuffix(config.CapsuleBuilderURL, "/")
+	config.SandboxURL = strings.TrimSuffix(config.SandboxURL, "/")
+	config.Registry = strings.TrimSuffix(config.Registry, "/")
+	return config
+}
+
+// capsule is the part of a capsule-builder capsule a deployment needs
+type capsule struct {
+	ID         string `json:"id"`
+	WorkflowID string `json:"workflow_id"`
+	Name       string `json:"name"`
+	Language   string `json:"language"`
+	Structure  map[string]struct {
+		Content string `json:"content"`
+		Type    string `json:"type"`
+	} `json:"structure"`
+	Metadata struct {
+		Dependencies []string `json:"dependencies"`
+		TestCommand  string   `json:"test_command"`
+	} `json:"metadata"`
+}
+
+// files maps each of the capsule's paths to its content
+func (c *capsule) files() map[string]string {
+	files := make(map[string]string, len(c.Structure))
+	for path, file := range c.Structure {
+		files[path] = file.Content
+	}
+	return files
+}
+
+// entryPoint picks the file the sandbox treats as the program: the first
+// source file, or failing that the first file
+func (c *capsule) entryPoint() string {
+	paths := make([]string, 0, len(c.Structure))
+	for path := range c.Structure {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if c.Structure[path].Type == "source" {
+			return path
+		}
+	}
+	if len(paths) > 0 {
+		return paths[0]
+	}
+	return ""
+}
+
+// DeployFromCapsule starts deploying a capsule: optionally running its tests
+// in the sandbox, building its image and deploying it. It returns the
+// deployment as soon as the capsule has been checked; the deployment's
+// status follows the pipeline through testing, building and deploying.
+func (dm *DeploymentManager) DeployFromCapsule(ctx context.Context, tenant string, req DeployFromCapsuleRequest) (*DeploymentResponse, error) {
+	capsule, err := dm.fetchCapsule(ctx, req.CapsuleID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := capsule.Structure["Dockerfile"]; !ok {
+		return nil, fmt.Errorf("%w: it has no Dockerfile", errCapsuleNotDeployable)
+	}
+	if req.RunSmokeTest && capsule.Metadata.TestCommand == "" {
+		return nil, fmt.Errorf("%w: it has no test command to smoke test with", errCapsuleNotDeployable)
+	}
+	if req.TTLMinutes == 0 {
+		req.TTLMinutes = 60
+	}
+
+	id := newDeploymentID()
+	status := StatusBuilding
+	if req.RunSmokeTest {
+		status = StatusTesting
+	}
+	now := time.Now()
+	stored := &StoredDeployment{Deployment: DeploymentResponse{
+		ID:         id,
+		TenantID:   tenant,
+		Namespace:  dm.tenantNamespace(tenant),
+		WorkflowID: capsule.WorkflowID,
+		CapsuleID:  capsule.ID,
+		Name:       capsule.Name,
+		URL:        "http://" + dm.appHost(id),
+		Status:     status,
+		TTL:        req.TTLMinutes,
+		ExpiresAt:  now.Add(time.Duration(req.TTLMinutes) * time.Minute),
+		CreatedAt:  now,
+	}}
+	if err := dm.store.Put(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	dm.pipelines.Add(1)
+	go func() {
+		defer dm.pipelines.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), capsulePipelineTimeout)
+		defer cancel()
+		dm.runCapsulePipeline(ctx, tenant, id, capsule, req)
+	}()
+
+	return &stored.Deployment, nil
+}
+
+// runCapsulePipeline tests, builds and deploys a capsule, recording each
+// step on the deployment. It stops if the deployment is deleted meanwhile.
+func (dm *DeploymentManager) runCapsulePipeline(ctx context.Context, tenant, id string, capsule *capsule, req DeployFromCapsuleRequest) {
+	var smokeTest *SmokeTestResult
+	if req.RunSmokeTest {
+		result, err := dm.runSmokeTest(ctx, capsule)
+		if err != nil {
+			dm.failPipeline(ctx, id, fmt.Sprintf("smoke test could not run: %v", err), nil)
+			return
+		}
+		if !result.Passed {
+			dm.failPipeline(ctx, id, "smoke test failed; deployment aborted", result)
+			return
+		}
+		smokeTest = result
+		if !dm.updatePipeline(ctx, id, func(dep *DeploymentResponse) {
+			dep.Status = StatusBuilding
+			dep.SmokeTest = smokeTest
+		}) {
+			return
+		}
+	}
+
+	image := fmt.Sprintf("%s/%s:%s", dm.capsuleDeploy.Registry, strings.ToLower(capsule.ID), id)
+	if err := dm.images.Build(ctx, ImageBuild{Name: "build-" + id, Image: image, Files: capsule.files()}); err != nil {
+		dm.failPipeline(ctx, id, err.Error(), smokeTest)
+		return
+	}
+
+	if !dm.updatePipeline(ctx, id, func(dep *DeploymentResponse) { dep.Status = StatusDeploying }) {
+		return
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if _, err := dm.store.Get(ctx, id); err != nil {
+		log.Printf("Abandoning deployment %s of capsule %s: %v", id, capsule.ID, err)
+		return
+	}
+	stored, err := dm.createDeployment(ctx, tenant, id, DeploymentRequest{
+		WorkflowID:  capsule.WorkflowID,
+		CapsuleID:   capsule.ID,
+		Name:        capsule.Name,
+		Image:       image,
+		Port:        req.Port,
+		TTLMinutes:  req.TTLMinutes,
+		Environment: req.Environment,
+	})
+	if err != nil {
+		dm.failPipelineLocked(ctx, id, fmt.Sprintf("deployment failed: %v", err), smokeTest)
+		return
+	}
+	stored.Deployment.SmokeTest = smokeTest
+	if err := dm.store.Put(ctx, stored); err != nil {
+		log.Printf("Failed to record deployment %s of capsule %s: %v", id, capsule.ID, err)
+		return
+	}
+	log.Printf("Deployed capsule %s as %s at %s", capsule.ID, id, stored.Deployment.URL)
+}
+
+// updatePipeline changes a deployment that is still in its pipeline,
+// returning false if it was deleted
+func (dm *DeploymentManager) updatePipeline(ctx context.Context, id string, update func(*DeploymentResponse)) bool {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	return dm.updatePipelineLocked(ctx, id, update)
+}
+
+func (dm *DeploymentManager) updatePipelineLocked(ctx context.Context, id string, update func(*DeploymentResponse)) bool {
+	stored, err := dm.store.Get(ctx, id)
+	if err != nil {
+		log.Printf("Abandoning deployment %s: %v", id, err)
+		return false
+	}
+	update(&stored.Deployment)
+	if err := dm.store.Put(ctx, stored); err != nil {
+		log.Printf("Failed to update deployment %s: %v", id, err)
+		return false
+	}
+	return true
+}
+
+// failPipeline marks a deployment failed, keeping the smoke test that
+// stopped it or ran before it failed
+func (dm *DeploymentManager) failPipeline(ctx context.Context, id, reason string, smokeTest *SmokeTestResult) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.failPipelineLocked(ctx, id, reason, smokeTest)
+}
+
+func (dm *DeploymentManager) failPipelineLocked(ctx context.Context, id, reason string, smokeTest *SmokeTestResult) {
+	log.Printf("Deployment %s failed: %s", id, reason)
+	dm.updatePipelineLocked(ctx, id, func(dep *DeploymentResponse) {
+		dep.Status = StatusFailed
+		dep.Error = reason
+		dep.SmokeTest = smokeTest
+	})
+}
+
+// fetchCapsule reads a capsule from the capsule builder
+func (dm *DeploymentManager) fetchCapsule(ctx context.Context, capsuleID string) (*capsule, error) {
+	endpoint := dm.capsuleDeploy.CapsuleBuilderURL + "/api/v1/capsules/" + url.PathEscape(capsuleID)
+	var c capsule
+	status, err := dm.doJSON(ctx, http.MethodGet, endpoint, nil, &c)
+	if status == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", errCapsuleNotFound, capsuleID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: capsule builder: %v", errDownstream, err)
+	}
+	return &c, nil
+}
+
+// runSmokeTest runs the capsule's test command in the sandbox and waits
+// for it to finish
+func (dm *DeploymentManager) runSmokeTest(ctx context.Context, capsule *capsule) (*SmokeTestResult, error) {
+	body := map[string]interface{}{
+		"language":     capsule.Language,
+		"files":        capsule.files(),
+		"entry_point":  capsule.entryPoint(),
+		"dependencies": capsule.Metadata.Dependencies,
+		"command":      capsule.Metadata.TestCommand,
+		"timeout":      smokeTestTimeoutSeconds,
+	}
+	var started struct {
+		ID string `json:"id"`
+	}
+	if _, err := dm.doJSON(ctx, http.MethodPost, dm.capsuleDeploy.SandboxURL+"/api/v1/execute-project", body, &started); err != nil {
+		return nil, fmt.Errorf("sandbox executor: %w", err)
+	}
+	if started.ID == "" {
+		return nil, errors.New("sandbox executor returned no execution ID")
+	}
+
+	ticker := time.NewTicker(dm.capsuleDeploy.SandboxPollInterval)
+	defer ticker.Stop()
+	for {
+		var execution struct {
+			Status   string  `json:"status"`
+			Output   string  `json:"output"`
+			Error    string  `json:"error"`
+			ExitCode int     `json:"exit_code"`
+			Duration float64 `json:"duration_seconds"`
+		}
+		if _, err := dm.doJSON(ctx, http.MethodGet, dm.capsuleDeploy.SandboxURL+"/api/v1/executions/"+url.PathEscape(started.ID), nil, &execution); err != nil {
+			return nil, fmt.Errorf("sandbox executor: %w", err)
+		}
+		if execution.Status != "running" {
+			output := execution.Output
+			if len(output) > maxSmokeTestOutput {
+				output = output[len(output)-maxSmokeTestOutput:]
+			}
+			return &SmokeTestResult{
+				ExecutionID:     started.ID,
+				Command:         capsule.Metadata.TestCommand,
+				Passed:          execution.Status == "success" && execution.ExitCode == 0,
+				Status:          execution.Status,
+				ExitCode:        execution.ExitCode,
+				Output:          output,
+				Error:           execution.Error,
+				DurationSeconds: execution.Duration,
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("gave up waiting for execution %s: %w", started.ID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// doJSON sends a JSON request and decodes a 2xx response into out,
+// returning the response status
+func (dm *DeploymentManager) doJSON(ctx context.Context, method, endpoint string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	authmiddleware.SetServiceKey(req)
+
+	resp, err := dm.capsuleDeploy.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%s %s returned status %d", method, endpoint, resp.StatusCode)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("invalid response from %s: %w", endpoint, err)
+	}
+	return resp.StatusCode, nil
+}
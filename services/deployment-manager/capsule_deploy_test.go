@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// stubCapsuleBuilder serves a single capsule
+func stubCapsuleBuilder(t *testing.T, testCommand string, withDockerfile bool) *httptest.Server {
+	t.Helper()
+	structure := map[string]interface{}{
+		"main.py":          map[string]string{"path": "main.py", "content": "print('hi')", "type": "source"},
+		"test_main.py":     map[string]string{"path": "test_main.py", "content": "def test(): pass", "type": "test"},
+		"requirements.txt": map[string]string{"path": "requirements.txt", "content": "flask", "type": "config"},
+	}
+	if withDockerfile {
+		structure["Dockerfile"] = map[string]string{"path": "Dockerfile", "content": "FROM python:3.11", "type": "config"}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/capsules/capsule-1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":          "capsule-1",
+			"workflow_id": "wf-1",
+			"name":        "demo",
+			"language":    "python",
+			"structure":   structure,
+			"metadata":    map[string]interface{}{"test_command": testCommand},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// stubSandbox runs every execution to the given result once release is
+// closed, recording the projects it was asked to run
+type stubSandbox struct {
+	*httptest.Server
+	release chan struct{}
+	status  string
+	exit    int
+	output  string
+
+	mu       sync.Mutex
+	projects []map[string]interface{}
+}
+
+func newStubSandbox(t *testing.T, status string, exit int, output string) *stubSandbox {
+	t.Helper()
+	s := &stubSandbox{release: make(chan struct{}), status: status, exit: exit, output: output}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/execute-project":
+			var project map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&project)
+			s.mu.Lock()
+			s.projects = append(s.projects, project)
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]string{"id": "exec-1", "status": "running"})
+		case r.URL.Path == "/api/v1/executions/exec-1":
+			select {
+			case <-s.release:
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"id": "exec-1", "status": s.status, "exit_code": s.exit, "output": s.output, "duration_seconds": 1.5,
+				})
+			default:
+				json.NewEncoder(w).Encode(map[string]string{"id": "exec-1", "status": "running"})
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newCapsuleTestManager wires a manager to the stubs, with Kaniko jobs that
+// finish as soon as they are created, succeeding unless buildFails
+func newCapsuleTestManager(builder, sandbox string, buildFails bool) (*DeploymentManager, *fake.Clientset) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		if buildFails {
+			job.Status.Failed = 1
+		} else {
+			job.Status.Succeeded = 1
+		}
+		return false, nil, nil
+	})
+
+	dm := newTestManager()
+	dm.clientset = clientset
+	dm.images = &KanikoBuilder{
+		clientset:    clientset,
+		namespace:    "quantumlayer-builds",
+		kanikoImage:  "kaniko:test",
+		pushSecret:   "push-secret",
+		timeout:      5 * time.Second,
+		pollInterval: time.Millisecond,
+	}
+	dm.capsuleDeploy = CapsuleDeployConfig{
+		CapsuleBuilderURL:   builder,
+		SandboxURL:          sandbox,
+		Registry:            "registry.example.com/capsules",
+		HTTPClient:          http.DefaultClient,
+		SandboxPollInterval: time.Millisecond,
+	}
+	return dm, clientset
+}
+
+func getDeployment(t *testing.T, r http.Handler, id string) DeploymentResponse {
+	t.Helper()
+	w := call(t, r, testTenant, http.MethodGet, "/api/v1/deployments/"+id, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get deployment: status %d: %s", w.Code, w.Body)
+	}
+	var dep DeploymentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &dep); err != nil {
+		t.Fatalf("decode deployment: %v", err)
+	}
+	return dep
+}
+
+func TestDeployFromCapsule(t *testing.T) {
+	builder := stubCapsuleBuilder(t, "pytest -q", true)
+	sandbox := newStubSandbox(t, "success", 0, "1 passed")
+	dm, clientset := newCapsuleTestManager(builder.URL, sandbox.URL, false)
+	r := newRouter(dm)
+
+	w := call(t, r, testTenant, http.MethodPost, "/api/v1/deploy-from-capsule", DeployFromCapsuleRequest{
+		CapsuleID:    "capsule-1",
+		RunSmokeTest: true,
+	})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	var started DeploymentResponse
+	json.Unmarshal(w.Body.Bytes(), &started)
+	if started.Status != StatusTesting || started.URL != "http://"+started.ID+".apps.example.com" {
+		t.Fatalf("started = %+v, want testing with its URL", started)
+	}
+
+	// While the smoke test runs the deployment reports it and can't be
+	// changed
+	if dep := getDeployment(t, r, started.ID); dep.Status != StatusTesting {
+		t.Errorf("status during smoke test = %q, want testing", dep.Status)
+	}
+	w = call(t, r, testTenant, http.MethodPut, "/api/v1/deployments/"+started.ID, UpdateDeploymentRequest{Image: "other:v2"})
+	if w.Code != http.StatusConflict {
+		t.Errorf("update during smoke test: status = %d, want 409", w.Code)
+	}
+
+	close(sandbox.release)
+	dm.pipelines.Wait()
+
+	dep := getDeployment(t, r, started.ID)
+	if dep.Status != "pending" || dep.Error != "" {
+		t.Errorf("deployment = %+v, want pending in the cluster", dep)
+	}
+	if dep.SmokeTest == nil || !dep.SmokeTest.Passed || dep.SmokeTest.Output != "1 passed" {
+		t.Errorf("smoke test = %+v, want passed with its output", dep.SmokeTest)
+	}
+
+	sandbox.mu.Lock()
+	project := sandbox.projects[0]
+	sandbox.mu.Unlock()
+	if project["command"] != "pytest -q" || project["entry_point"] != "main.py" {
+		t.Errorf("sandbox project = %v, want the test command with main.py", project)
+	}
+
+	ctx := context.Background()
+	live, err := clientset.AppsV1().Deployments(dm.tenantNamespace(testTenant)).Get(ctx, started.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	wantImage := "registry.example.com/capsules/capsule-1:" + started.ID
+	if image := live.Spec.Template.Spec.Containers[0].Image; image != wantImage {
+		t.Errorf("image = %q, want %q", image, wantImage)
+	}
+
+	// The build's job and context are cleaned up
+	jobs, _ := clientset.BatchV1().Jobs("quantumlayer-builds").List(ctx, metav1.ListOptions{})
+	configMaps, _ := clientset.CoreV1().ConfigMaps("quantumlayer-builds").List(ctx, metav1.ListOptions{})
+	if len(jobs.Items) != 0 || len(configMaps.Items) != 0 {
+		t.Errorf("left %d jobs and %d config maps behind", len(jobs.Items), len(configMaps.Items))
+	}
+}
+
+func TestDeployFromCapsuleFailedSmokeTest(t *testing.T) {
+	builder := stubCapsuleBuilder(t, "pytest -q", true)
+	sandbox := newStubSandbox(t, "error", 1, "FAILED test_main.py::test")
+	close(sandbox.release)
+	dm, clientset := newCapsuleTestManager(builder.URL, sandbox.URL, false)
+	r := newRouter(dm)
+
+	w := call(t, r, testTenant, http.MethodPost, "/api/v1/deploy-from-capsule", DeployFromCapsuleRequest{
+		CapsuleID:    "capsule-1",
+		RunSmokeTest: true,
+	})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	var started DeploymentResponse
+	json.Unmarshal(w.Body.Bytes(), &started)
+	dm.pipelines.Wait()
+
+	dep := getDeployment(t, r, started.ID)
+	if dep.Status != StatusFailed || !strings.Contains(dep.Error, "smoke test failed") {
+		t.Errorf("deployment = %+v, want failed by its smoke test", dep)
+	}
+	if dep.SmokeTest == nil || dep.SmokeTest.Passed || dep.SmokeTest.ExitCode != 1 || dep.SmokeTest.Output != "FAILED test_main.py::test" {
+		t.Errorf("smoke test = %+v, want the failing output", dep.SmokeTest)
+	}
+
+	ctx := context.Background()
+	jobs, _ := clientset.BatchV1().Jobs("quantumlayer-builds").List(ctx, metav1.ListOptions{})
+	deployments, _ := clientset.AppsV1().Deployments(dm.tenantNamespace(testTenant)).List(ctx, metav1.ListOptions{})
+	if len(jobs.Items) != 0 || len(deployments.Items) != 0 {
+		t.Errorf("built %d images and created %d deployments after a failed smoke test", len(jobs.Items), len(deployments.Items))
+	}
+}
+
+func TestDeployFromCapsuleFailedBuild(t *testing.T) {
+	builder := stubCapsuleBuilder(t, "", true)
+	dm, clientset := newCapsuleTestManager(builder.URL, "", true)
+	r := newRouter(dm)
+
+	w := call(t, r, testTenant, http.MethodPost, "/api/v1/deploy-from-capsule", DeployFromCapsuleRequest{CapsuleID: "capsule-1"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	var started DeploymentResponse
+	json.Unmarshal(w.Body.Bytes(), &started)
+	if started.Status != StatusBuilding {
+		t.Errorf("started status = %q, want building", started.Status)
+	}
+	dm.pipelines.Wait()
+
+	dep := getDeployment(t, r, started.ID)
+	if dep.Status != StatusFailed || !strings.Contains(dep.Error, errBuildFailed.Error()) {
+		t.Errorf("deployment = %+v, want failed by its build", dep)
+	}
+	deployments, _ := clientset.AppsV1().Deployments(dm.tenantNamespace(testTenant)).List(context.Background(), metav1.ListOptions{})
+	if len(deployments.Items) != 0 {
+		t.Errorf("created %d deployments after a failed build", len(deployments.Items))
+	}
+}
+
+func TestDeployFromCapsuleRejectsCapsules(t *testing.T) {
+	tests := []struct {
+		name           string
+		capsuleID      string
+		testCommand    string
+		withDockerfile bool
+		runSmokeTest   bool
+		want           int
+	}{
+		{name: "unknown capsule", capsuleID: "capsule-2", withDockerfile: true, want: http.StatusNotFound},
+		{name: "no Dockerfile", capsuleID: "capsule-1", want: http.StatusUnprocessableEntity},
+		{name: "no test command", capsuleID: "capsule-1", withDockerfile: true, runSmokeTest: true, want: http.StatusUnprocessableEntity},
+		{name: "no capsule ID", withDockerfile: true, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := stubCapsuleBuilder(t, tt.testCommand, tt.withDockerfile)
+			dm, _ := newCapsuleTestManager(builder.URL, "", false)
+			r := newRouter(dm)
+
+			w := call(t, r, testTenant, http.MethodPost, "/api/v1/deploy-from-capsule", DeployFromCapsuleRequest{
+				CapsuleID:    tt.capsuleID,
+				RunSmokeTest: tt.runSmokeTest,
+			})
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if deployments, _ := dm.ListDeployments(context.Background(), testTenant); len(deployments) != 0 {
+				t.Errorf("stored %d deployments for a rejected capsule", len(deployments))
+			}
+		})
+	}
+}
+
+func TestDeployFromCapsuleUnreachableBuilder(t *testing.T) {
+	dm, _ := newCapsuleTestManager("http://127.0.0.1:1", "", false)
+	w := call(t, newRouter(dm), testTenant, http.MethodPost, "/api/v1/deploy-from-capsule", DeployFromCapsuleRequest{CapsuleID: "capsule-1"})
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502: %s", w.Code, w.Body)
+	}
+}
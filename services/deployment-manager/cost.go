@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Default container resources when a request doesn't set them
+const (
+	defaultMemory = "256Mi"
+	defaultCPU    = "200m"
+)
+
+var errInvalidResources = errors.New("invalid resources")
+
+// Pricing is what a unit of resources costs per hour, configured with
+// COST_CPU_CORE_HOUR, COST_MEMORY_GIB_HOUR and COST_CURRENCY
+type Pricing struct {
+	CPUCoreHour   float64
+	MemoryGiBHour float64
+	Currency      string
+}
+
+func pricingFromEnv() (Pricing, error) {
+	pricing := Pricing{CPUCoreHour: 0.04, MemoryGiBHour: 0.005, Currency: "USD"}
+	for name, price := range map[string]*float64{
+		"COST_CPU_CORE_HOUR":   &pricing.CPUCoreHour,
+		"COST_MEMORY_GIB_HOUR": &pricing.MemoryGiBHour,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return Pricing{}, fmt.Errorf("invalid %s %q: must be a non-negative number", name, v)
+		}
+		*price = f
+	}
+	if v := os.Getenv("COST_CURRENCY"); v != "" {
+		pricing.Currency = v
+	}
+	return pricing, nil
+}
+
+// CostEstimate is the estimated cost of running a deployment for its whole
+// TTL at its current size
+type CostEstimate struct {
+	Currency   string  `json:"currency"`
+	HourlyCost float64 `json:"hourly_cost"`
+	TotalCost  float64 `json:"total_cost"`
+	// Replicas includes the canary's replica while one is running
+	Replicas int32   `json:"replicas"`
+	Hours    float64 `json:"hours"`
+}
+
+// withDefaults fills in the default CPU and memory and checks both parse
+func (r ResourceRequirements) withDefaults() (ResourceRequirements, error) {
+	if r.Memory == "" {
+		r.Memory = defaultMemory
+	}
+	if r.CPU == "" {
+		r.CPU = defaultCPU
+	}
+	for name, value := range map[string]string{"cpu": r.CPU, "memory": r.Memory} {
+		q, err := resource.ParseQuantity(value)
+		if err != nil || q.Sign() <= 0 {
+			return r, fmt.Errorf("%w: %s %q must be a positive quantity", errInvalidResources, name, value)
+		}
+	}
+	return r, nil
+}
+
+// Estimate prices replicas of a container with the given resources over
+// ttlMinutes
+func (p Pricing) Estimate(resources ResourceRequirements, replicas int32, ttlMinutes int) CostEstimate {
+	cpu := resource.MustParse(resources.CPU)
+	memory := resource.MustParse(resources.Memory)
+
+	cores := float64(cpu.MilliValue()) / 1000
+	gib := float64(memory.Value()) / (1 << 30)
+	hourly := (cores*p.CPUCoreHour + gib*p.MemoryGiBHour) * float64(replicas)
+	hours := float64(ttlMinutes) / 60
+
+	return CostEstimate{
+		Currency:   p.Currency,
+		HourlyCost: roundCost(hourly),
+		TotalCost:  roundCost(hourly * hours),
+		Replicas:   replicas,
+		Hours:      hours,
+	}
+}
+
+func roundCost(cost float64) float64 {
+	return math.Round(cost*10000) / 10000
+}
+
+// refreshCost recomputes a deployment's estimate from its current revision
+// and canary
+func (dm *DeploymentManager) refreshCost(stored *StoredDeployment) {
+	dep := &stored.Deployment
+	replicas := stored.current().Replicas
+	if dep.Canary != nil {
+		replicas++
+	}
+	cost := dm.pricing.Estimate(dep.Resources, replicas, dep.TTL)
+	dep.Cost = &cost
+}
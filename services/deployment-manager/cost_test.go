@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+)
+
+// costNear compares costs allowing for rounding to four decimal places
+func costNear(got, want float64) bool {
+	return math.Abs(got-want) < 0.0001
+}
+
+func deployWithResources(t *testing.T, dm *DeploymentManager, ttl int) *DeploymentResponse {
+	t.Helper()
+	resp, err := dm.CreateDeployment(context.Background(), testTenant, DeploymentRequest{
+		WorkflowID: "wf-1",
+		CapsuleID:  "capsule-1",
+		Name:       "demo",
+		Image:      "demo:v1",
+		TTLMinutes: ttl,
+		Resources:  ResourceRequirements{CPU: "500m", Memory: "1Gi"},
+	})
+	if err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+	return resp
+}
+
+func TestCostEstimate(t *testing.T) {
+	dm := newTestManager()
+	dep := deployWithResources(t, dm, 120)
+
+	// 0.5 cores * 0.04 + 1 GiB * 0.005 per hour, for two hours
+	want := CostEstimate{Currency: "USD", HourlyCost: 0.025, TotalCost: 0.05, Replicas: 1, Hours: 2}
+	if dep.Cost == nil || *dep.Cost != want {
+		t.Fatalf("cost = %+v, want %+v", dep.Cost, want)
+	}
+
+	// Defaults are priced when no resources are requested
+	id := deploy(t, dm, "demo:v1")
+	got, _ := dm.GetDeployment(context.Background(), testTenant, id)
+	if got.Resources.CPU != defaultCPU || got.Resources.Memory != defaultMemory || got.Cost.TotalCost == 0 {
+		t.Fatalf("default resources %+v cost %+v", got.Resources, got.Cost)
+	}
+}
+
+func TestCostScalesWithReplicasAndTTL(t *testing.T) {
+	dm := newTestManager()
+	base := deployWithResources(t, dm, 60).Cost
+
+	if longer := deployWithResources(t, dm, 180).Cost; !costNear(longer.TotalCost, 3*base.TotalCost) || longer.HourlyCost != base.HourlyCost {
+		t.Fatalf("3x TTL cost %+v, base %+v", longer, base)
+	}
+
+	dep := deployWithResources(t, dm, 60)
+	replicas := int32(4)
+	update(t, dm, dep.ID, UpdateDeploymentRequest{Replicas: &replicas})
+
+	got, _ := dm.GetDeployment(context.Background(), testTenant, dep.ID)
+	if got.Cost.Replicas != 4 || !costNear(got.Cost.HourlyCost, 4*base.HourlyCost) || !costNear(got.Cost.TotalCost, 4*base.TotalCost) {
+		t.Fatalf("cost after scaling to 4 = %+v, base %+v", got.Cost, base)
+	}
+
+	// Rolling back to one replica brings the estimate back down
+	if _, err := dm.RollbackDeployment(context.Background(), testTenant, dep.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = dm.GetDeployment(context.Background(), testTenant, dep.ID)
+	if *got.Cost != *base {
+		t.Fatalf("cost after rollback = %+v, want %+v", got.Cost, base)
+	}
+}
+
+func TestCostIncludesCanary(t *testing.T) {
+	dm := newTestManager()
+	r := newRouter(dm)
+	dep := deployCanary(t, r, 20)
+
+	got, _ := dm.GetDeployment(context.Background(), testTenant, dep.ID)
+	if got.Cost.Replicas != 2 || !costNear(got.Cost.HourlyCost, 2*dep.Cost.HourlyCost) {
+		t.Fatalf("cost with canary = %+v, without %+v", got.Cost, dep.Cost)
+	}
+
+	call(t, r, testTenant, http.MethodDelete, "/api/v1/deployments/"+dep.ID+"/canary", nil)
+	got, _ = dm.GetDeployment(context.Background(), testTenant, dep.ID)
+	if *got.Cost != *dep.Cost {
+		t.Fatalf("cost after abort = %+v, want %+v", got.Cost, dep.Cost)
+	}
+}
+
+func TestDeployRejectsInvalidResources(t *testing.T) {
+	dm := newTestManager()
+	w := call(t, newRouter(dm), testTenant, http.MethodPost, "/api/v1/deploy", DeploymentRequest{
+		WorkflowID: "wf-1",
+		CapsuleID:  "capsule-1",
+		Name:       "demo",
+		Image:      "demo:v1",
+		Resources:  ResourceRequirements{CPU: "lots"},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400: %s", w.Code, w.Body)
+	}
+
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["error"] == "" {
+		t.Fatal("missing error message")
+	}
+}
+
+func TestPricingFromEnv(t *testing.T) {
+	t.Setenv("COST_CPU_CORE_HOUR", "0.1")
+	t.Setenv("COST_CURRENCY", "EUR")
+	pricing, err := pricingFromEnv()
+	if err != nil || pricing.CPUCoreHour != 0.1 || pricing.MemoryGiBHour != 0.005 || pricing.Currency != "EUR" {
+		t.Fatalf("pricing = %+v, %v", pricing, err)
+	}
+
+	t.Setenv("COST_MEMORY_GIB_HOUR", "-1")
+	if _, err := pricingFromEnv(); err == nil {
+		t.Fatal("negative price accepted")
+	}
+}
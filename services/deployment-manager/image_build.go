@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// maxBuildContextBytes keeps a build context within a ConfigMap's limit
+	maxBuildContextBytes = 900 << 10
+
+	// buildLogTailLines is how much of a failed build's log is reported
+	buildLogTailLines = 50
+)
+
+var errBuildFailed = errors.New("image build failed")
+
+// ImageBuild is a container image to build from a set of files, one of
+// which must be the Dockerfile
+type ImageBuild struct {
+	// Name identifies the build's Kubernetes objects
+	Name  string
+	Image string
+	Files map[string]string
+}
+
+// ImageBuilder builds and pushes container images
+type ImageBuilder interface {
+	Build(ctx context.Context, build ImageBuild) error
+}
+
+// KanikoBuilder builds images with a Kaniko job per build, the build
+// context mounted from a ConfigMap
+type KanikoBuilder struct {
+	clientset    kubernetes.Interface
+	namespace    string
+	kanikoImage  string
+	pushSecret   string
+	timeout      time.Duration
+	pollInterval time.Duration
+}
+
+// NewKanikoBuilderFromEnv configures a builder from BUILD_NAMESPACE,
+// KANIKO_IMAGE, REGISTRY_PUSH_SECRET and BUILD_TIMEOUT_MINUTES
+func NewKanikoBuilderFromEnv(clientset kubernetes.Interface) (*KanikoBuilder, error) {
+	b := &KanikoBuilder{
+		clientset:    clientset,
+		namespace:    "quantumlayer-builds",
+		kanikoImage:  "gcr.io/kaniko-project/executor:v1.9.0",
+		pushSecret:   "ghcr-push-secret",
+		timeout:      15 * time.Minute,
+		pollInterval: 5 * time.Second,
+	}
+	if v := os.Getenv("BUILD_NAMESPACE"); v != "" {
+		b.namespace = v
+	}
+	if v := os.Getenv("KANIKO_IMAGE"); v != "" {
+		b.kanikoImage = v
+	}
+	if v := os.Getenv("REGISTRY_PUSH_SECRET"); v != "" {
+		b.pushSecret = v
+	}
+	if v := os.Getenv("BUILD_TIMEOUT_MINUTES"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes <= 0 {
+			return nil, fmt.Errorf("invalid BUILD_TIMEOUT_MINUTES %q", v)
+		}
+		b.timeout = time.Duration(minutes) * time.Minute
+	}
+	return b, nil
+}
+
+// Build runs a Kaniko job for the build and waits for it to finish. The
+// job and its context are removed afterwards.
+func (b *KanikoBuilder) Build(ctx context.Context, build ImageBuild) error {
+	if _, ok := build.Files["Dockerfile"]; !ok {
+		return fmt.Errorf("%w: no Dockerfile", errBuildFailed)
+	}
+
+	configMap, items, err := buildContextConfigMap(build, b.namespace)
+	if err != nil {
+		return err
+	}
+	if _, err := b.clientset.CoreV1().ConfigMaps(b.namespace).Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create build context: %w", err)
+	}
+	defer b.cleanup(build.Name)
+
+	job := b.buildJob(build, items)
+	if _, err := b.clientset.BatchV1().Jobs(b.namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create build job: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: timed out after %s", errBuildFailed, b.timeout)
+		case <-ticker.C:
+		}
+
+		job, err := b.clientset.BatchV1().Jobs(b.namespace).Get(ctx, build.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Printf("Failed to check build job %s: %v", build.Name, err)
+			continue
+		}
+		if job.Status.Succeeded > 0 {
+			return nil
+		}
+		if job.Status.Failed > 0 {
+			return fmt.Errorf("%w: %s", errBuildFailed, b.buildLogs(ctx, build.Name))
+		}
+	}
+}
+
+// buildContextConfigMap holds the build's files. ConfigMap keys can't
+// contain slashes, so files are stored under numbered keys and mounted
+// back at their paths.
+func buildContextConfigMap(build ImageBuild, namespace string) (*corev1.ConfigMap, []corev1.KeyToPath, error) {
+	paths := make([]string, 0, len(build.Files))
+	size := 0
+	for path, content := range build.Files {
+		paths = append(paths, path)
+		size += len(content)
+	}
+	if size > maxBuildContextBytes {
+		return nil, nil, fmt.Errorf("%w: build context is %d bytes, more than the %d allowed", errBuildFailed, size, maxBuildContextBytes)
+	}
+	sort.Strings(paths)
+
+	data := make(map[string]string, len(paths))
+	items := make([]corev1.KeyToPath, 0, len(paths))
+	for i, path := range paths {
+		key := fmt.Sprintf("file-%d", i)
+		data[key] = build.Files[path]
+		items = append(items, corev1.KeyToPath{Key: key, Path: strings.TrimPrefix(path, "/")})
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      build.Name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app": "kaniko-build", "managed-by": "deployment-manager"},
+		},
+		Data: data,
+	}, items, nil
+}
+
+func (b *KanikoBuilder) buildJob(build ImageBuild, items []corev1.KeyToPath) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      build.Name,
+			Namespace: b.namespace,
+			Labels:    map[string]string{"app": "kaniko-build", "managed-by": "deployment-manager"},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: int32Ptr(0),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": "kaniko-build"},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:  "kaniko",
+						Image: b.kanikoImage,
+						Args: []string{
+							"--dockerfile=/workspace/Dockerfile",
+							"--context=dir:///workspace",
+							"--destination=" + build.Image,
+						},
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "build-context", MountPath: "/workspace"},
+							{Name: "registry-secret", MountPath: "/kaniko/.docker", ReadOnly: true},
+						},
+					}},
+					Volumes: []corev1.Volume{
+						{
+							Name: "build-context",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: build.Name},
+									Items:                items,
+								},
+							},
+						},
+						{
+							Name: "registry-secret",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: b.pushSecret,
+									Items:      []corev1.KeyToPath{{Key: ".dockerconfigjson", Path: "config.json"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// buildLogs returns the end of a failed build's log, or why it couldn't
+// be read
+func (b *KanikoBuilder) buildLogs(ctx context.Context, jobName string) string {
+	pods, err := b.clientset.CoreV1().Pods(b.namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + jobName})
+	if err != nil || len(pods.Items) == 0 {
+		return "build job failed; no logs available"
+	}
+
+	tail := int64(buildLogTailLines)
+	stream, err := b.clientset.CoreV1().Pods(b.namespace).GetLogs(pods.Items[0].Name, &corev1.PodLogOptions{TailLines: &tail}).Stream(ctx)
+	if err != nil {
+		return "build job failed; no logs available"
+	}
+	defer stream.Close()
+	logs, _ := io.ReadAll(io.LimitReader(stream, 64<<10))
+	return strings.TrimSpace(string(logs))
+}
+
+// cleanup removes a build's job, its pods and its context
+func (b *KanikoBuilder) cleanup(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	propagation := metav1.DeletePropagationBackground
+	if err := b.clientset.BatchV1().Jobs(b.namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil {
+		log.Printf("Failed to delete build job %s: %v", name, err)
+	}
+	if err := b.clientset.CoreV1().ConfigMaps(b.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		log.Printf("Failed to delete build context %s: %v", name, err)
+	}
+}
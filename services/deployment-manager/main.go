@@ -6,7 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -29,7 +29,16 @@ type DeploymentRequest struct {
 	Port        int32             `json:"port"`
 	TTLMinutes  int               `json:"ttl_minutes"`
 	Environment map[string]string `json:"environment"`
-	Resources   ResourceRequirements `json:"resources"`
+	// Secrets are env vars stored in a Secret created for the deployment
+	// rather than in its pod spec
+	Secrets map[string]string `json:"secrets"`
+	// SecretRefs set env vars from Secrets already in the namespace
+	SecretRefs []SecretRef           `json:"secret_refs"`
+	Resources  ResourceRequirements `json:"resources"`
+	// Strategy is recreate, rolling (the default) or canary
+	Strategy string `json:"strategy"`
+	// CanaryWeight is the percentage of traffic a canary receives
+	CanaryWeight int `json:"canary_weight"`
 }
 
 type ResourceRequirements struct {
@@ -39,6 +48,8 @@ type ResourceRequirements struct {
 
 type DeploymentResponse struct {
 	ID         string    `json:"id"`
+	TenantID   string    `json:"tenant_id"`
+	Namespace  string    `json:"namespace"`
 	WorkflowID string    `json:"workflow_id"`
 	CapsuleID  string    `json:"capsule_id"`
 	Name       string    `json:"name"`
@@ -47,13 +58,41 @@ type DeploymentResponse struct {
 	TTL        int       `json:"ttl_minutes"`
 	ExpiresAt  time.Time `json:"expires_at"`
 	CreatedAt  time.Time `json:"created_at"`
+
+	// Replicas and ReadyReplicas are read from the cluster
+	Replicas      int32 `json:"replicas"`
+	ReadyReplicas int32 `json:"ready_replicas"`
+
+	Strategy     string        `json:"strategy"`
+	CanaryWeight int           `json:"canary_weight,omitempty"`
+	Canary       *CanaryStatus `json:"canary,omitempty"`
+
+	Resources ResourceRequirements `json:"resources"`
+	Cost      *CostEstimate        `json:"cost,omitempty"`
+
+	// SecretEnv names the env vars set from secrets; their values are
+	// never returned
+	SecretEnv []string `json:"secret_env,omitempty"`
+
+	// Error and SmokeTest are set on deployments made from capsules
+	Error     string           `json:"error,omitempty"`
+	SmokeTest *SmokeTestResult `json:"smoke_test,omitempty"`
 }
 
 type DeploymentManager struct {
-	clientset     *kubernetes.Clientset
-	namespace     string
-	baseURL       string
-	deployments   map[string]*DeploymentResponse
+	clientset        kubernetes.Interface
+	namespace        string // prefix of each tenant's namespace
+	baseURL          string
+	quota            TenantQuota
+	pricing          Pricing
+	ingressNamespace string
+	store            DeploymentStore
+	images           ImageBuilder
+	capsuleDeploy    CapsuleDeployConfig
+	// pipelines tracks deploy-from-capsule runs in progress
+	pipelines sync.WaitGroup
+	// mu serializes changes to deployments made by this replica
+	mu sync.Mutex
 }
 
 func NewDeploymentManager() (*DeploymentManager, error) {
@@ -80,17 +119,64 @@ func NewDeploymentManager() (*DeploymentManager, error) {
 		baseURL = "apps.quantumlayer.io"
 	}
 
+	ingressNamespace := os.Getenv("INGRESS_NAMESPACE")
+	if ingressNamespace == "" {
+		ingressNamespace = "ingress-nginx"
+	}
+
+	quota := tenantQuotaFromEnv()
+	if err := quota.Validate(); err != nil {
+		return nil, err
+	}
+
+	pricing, err := pricingFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewDeploymentStoreFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := NewKanikoBuilderFromEnv(clientset)
+	if err != nil {
+		return nil, err
+	}
+
 	return &DeploymentManager{
-		clientset:   clientset,
-		namespace:   namespace,
-		baseURL:     baseURL,
-		deployments: make(map[string]*DeploymentResponse),
+		clientset:        clientset,
+		namespace:        namespace,
+		baseURL:          baseURL,
+		quota:            quota,
+		pricing:          pricing,
+		ingressNamespace: ingressNamespace,
+		store:            store,
+		images:           images,
+		capsuleDeploy:    capsuleDeployConfigFromEnv(),
 	}, nil
 }
 
-func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req DeploymentRequest) (*DeploymentResponse, error) {
-	deploymentID := fmt.Sprintf("app-%s", uuid.New().String()[:8])
-	
+// CreateDeployment deploys an app into the tenant's namespace, creating the
+// namespace first if needed
+func (dm *DeploymentManager) CreateDeployment(ctx context.Context, tenant string, req DeploymentRequest) (*DeploymentResponse, error) {
+	stored, err := dm.createDeployment(ctx, tenant, newDeploymentID(), req)
+	if err != nil {
+		return nil, err
+	}
+	if err := dm.store.Put(ctx, stored); err != nil {
+		return nil, err
+	}
+	return &stored.Deployment, nil
+}
+
+func newDeploymentID() string {
+	return fmt.Sprintf("app-%s", uuid.New().String()[:8])
+}
+
+// createDeployment creates the Kubernetes objects of a deployment and
+// returns its record, which the caller stores
+func (dm *DeploymentManager) createDeployment(ctx context.Context, tenant, deploymentID string, req DeploymentRequest) (*StoredDeployment, error) {
 	// Set defaults
 	if req.Port == 0 {
 		req.Port = 8080
@@ -98,19 +184,24 @@ func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req Deploymen
 	if req.TTLMinutes == 0 {
 		req.TTLMinutes = 60 // Default 1 hour
 	}
+	if err := req.normalizeStrategy(); err != nil {
+		return nil, err
+	}
+	resources, err := req.Resources.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if err := req.validateSecrets(); err != nil {
+		return nil, err
+	}
 
-	// Create namespace if it doesn't exist
-	_, err := dm.clientset.CoreV1().Namespaces().Get(ctx, dm.namespace, metav1.GetOptions{})
+	// Create the tenant's namespace if it doesn't exist
+	namespace, err := dm.ensureTenantNamespace(ctx, tenant)
 	if err != nil {
-		ns := &corev1.Namespace{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: dm.namespace,
-			},
-		}
-		_, err = dm.clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
-		if err != nil && !strings.Contains(err.Error(), "already exists") {
-			return nil, fmt.Errorf("failed to create namespace: %w", err)
-		}
+		return nil, err
+	}
+	if err := dm.checkSecretRefs(ctx, namespace, req.SecretRefs); err != nil {
+		return nil, err
 	}
 
 	// Prepare labels
@@ -119,32 +210,19 @@ func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req Deploymen
 		"workflow-id": req.WorkflowID,
 		"capsule-id":  req.CapsuleID,
 		"managed-by":  "deployment-manager",
+		tenantLabel:   tenant,
 	}
 
-	// Prepare environment variables
-	envVars := []corev1.EnvVar{}
-	for k, v := range req.Environment {
-		envVars = append(envVars, corev1.EnvVar{
-			Name:  k,
-			Value: v,
-		})
-	}
-
-	// Set resource defaults
-	memoryLimit := "256Mi"
-	cpuLimit := "200m"
-	if req.Resources.Memory != "" {
-		memoryLimit = req.Resources.Memory
-	}
-	if req.Resources.CPU != "" {
-		cpuLimit = req.Resources.CPU
+	// Keep secret values out of the pod spec
+	if err := dm.createSecret(ctx, namespace, deploymentID, labels, req.Secrets); err != nil {
+		return nil, err
 	}
 
 	// Create Deployment
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      deploymentID,
-			Namespace: dm.namespace,
+			Namespace: namespace,
 			Labels:    labels,
 			Annotations: map[string]string{
 				"ttl":        fmt.Sprintf("%d", req.TTLMinutes),
@@ -156,6 +234,7 @@ func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req Deploymen
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
+			Strategy: deploymentStrategy(req.Strategy),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
@@ -171,11 +250,11 @@ func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req Deploymen
 									Name:          "http",
 								},
 							},
-							Env: envVars,
+							Env: containerEnv(secretEnvVars(deploymentID, req), req.Environment),
 							Resources: corev1.ResourceRequirements{
 								Limits: corev1.ResourceList{
-									corev1.ResourceMemory: resource.MustParse(memoryLimit),
-									corev1.ResourceCPU:    resource.MustParse(cpuLimit),
+									corev1.ResourceMemory: resource.MustParse(resources.Memory),
+									corev1.ResourceCPU:    resource.MustParse(resources.CPU),
 								},
 								Requests: corev1.ResourceList{
 									corev1.ResourceMemory: resource.MustParse("128Mi"),
@@ -189,8 +268,9 @@ func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req Deploymen
 		},
 	}
 
-	_, err = dm.clientset.AppsV1().Deployments(dm.namespace).Create(ctx, deployment, metav1.CreateOptions{})
+	_, err = dm.clientset.AppsV1().Deployments(namespace).Create(ctx, deployment, metav1.CreateOptions{})
 	if err != nil {
+		dm.deleteSecret(ctx, namespace, deploymentID, metav1.DeleteOptions{})
 		return nil, fmt.Errorf("failed to create deployment: %w", err)
 	}
 
@@ -198,7 +278,7 @@ func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req Deploymen
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      deploymentID,
-			Namespace: dm.namespace,
+			Namespace: namespace,
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
@@ -214,19 +294,19 @@ func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req Deploymen
 		},
 	}
 
-	_, err = dm.clientset.CoreV1().Services(dm.namespace).Create(ctx, service, metav1.CreateOptions{})
+	_, err = dm.clientset.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create service: %w", err)
 	}
 
 	// Create Ingress
-	subdomain := fmt.Sprintf("%s.%s", deploymentID, dm.baseURL)
+	subdomain := dm.appHost(deploymentID)
 	pathType := networkingv1.PathTypePrefix
 	
 	ingress := &networkingv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      deploymentID,
-			Namespace: dm.namespace,
+			Namespace: namespace,
 			Labels:    labels,
 			Annotations: map[string]string{
 				"nginx.ingress.kubernetes.io/rewrite-target": "/",
@@ -260,7 +340,7 @@ func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req Deploymen
 		},
 	}
 
-	_, err = dm.clientset.NetworkingV1().Ingresses(dm.namespace).Create(ctx, ingress, metav1.CreateOptions{})
+	_, err = dm.clientset.NetworkingV1().Ingresses(namespace).Create(ctx, ingress, metav1.CreateOptions{})
 	if err != nil {
 		log.Printf("Warning: Failed to create ingress: %v", err)
 		// Continue without ingress - can still use NodePort
@@ -269,40 +349,130 @@ func (dm *DeploymentManager) CreateDeployment(ctx context.Context, req Deploymen
 	// Create response
 	response := &DeploymentResponse{
 		ID:         deploymentID,
+		TenantID:   tenant,
+		Namespace:  namespace,
 		WorkflowID: req.WorkflowID,
 		CapsuleID:  req.CapsuleID,
 		Name:       req.Name,
 		URL:        fmt.Sprintf("http://%s", subdomain),
 		Status:     "deploying",
+		Replicas:   1,
 		TTL:        req.TTLMinutes,
 		ExpiresAt:  time.Now().Add(time.Duration(req.TTLMinutes) * time.Minute),
 		CreatedAt:  time.Now(),
+
+		Strategy:     req.Strategy,
+		CanaryWeight: req.CanaryWeight,
+
+		Resources: resources,
+		SecretEnv: secretEnvNames(req),
 	}
 
-	dm.deployments[deploymentID] = response
-	
-	return response, nil
+	stored := &StoredDeployment{
+		Deployment: *response,
+		Revisions: []Revision{{
+			Revision:    1,
+			Image:       req.Image,
+			Environment: req.Environment,
+			Replicas:    1,
+			CreatedAt:   response.CreatedAt,
+		}},
+	}
+	dm.refreshCost(stored)
+	return stored, nil
 }
 
-func (dm *DeploymentManager) GetDeployment(ctx context.Context, id string) (*DeploymentResponse, error) {
-	if dep, exists := dm.deployments[id]; exists {
-		// Update status from kubernetes
-		deployment, err := dm.clientset.AppsV1().Deployments(dm.namespace).Get(ctx, id, metav1.GetOptions{})
-		if err != nil {
-			dep.Status = "unknown"
-		} else {
-			if deployment.Status.ReadyReplicas > 0 {
-				dep.Status = "running"
-			} else {
-				dep.Status = "pending"
-			}
+// tenantDeployment loads a deployment owned by tenant; other tenants'
+// deployments are not found
+func (dm *DeploymentManager) tenantDeployment(ctx context.Context, tenant, id string) (*StoredDeployment, error) {
+	stored, err := dm.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Deployment.TenantID != tenant {
+		return nil, errDeploymentNotFound
+	}
+	return stored, nil
+}
+
+// liveDeployment is tenantDeployment for changes to a deployment, which
+// need it to have been created in the cluster
+func (dm *DeploymentManager) liveDeployment(ctx context.Context, tenant, id string) (*StoredDeployment, error) {
+	stored, err := dm.tenantDeployment(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored.Revisions) == 0 {
+		return nil, fmt.Errorf("%w: status is %s", errDeploymentNotReady, stored.Deployment.Status)
+	}
+	return stored, nil
+}
+
+// GetDeployment returns the stored deployment with its status read from
+// the cluster
+func (dm *DeploymentManager) GetDeployment(ctx context.Context, tenant, id string) (*DeploymentResponse, error) {
+	stored, err := dm.tenantDeployment(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deployments from capsules report their pipeline's status until
+	// they are created in the cluster
+	dep := stored.Deployment
+	if len(stored.Revisions) == 0 {
+		return &dep, nil
+	}
+	live, err := dm.clientset.AppsV1().Deployments(dep.Namespace).Get(ctx, id, metav1.GetOptions{})
+	mergeLiveStatus(&dep, live, err)
+	return &dep, nil
+}
+
+// mergeLiveStatus sets a deployment's status and replica counts from its
+// Kubernetes deployment, or marks the status unknown when it can't be read
+func mergeLiveStatus(dep *DeploymentResponse, live *appsv1.Deployment, err error) {
+	if err != nil {
+		dep.Status = "unknown"
+		dep.ReadyReplicas = 0
+		return
+	}
+
+	if live.Spec.Replicas != nil {
+		dep.Replicas = *live.Spec.Replicas
+	}
+	dep.ReadyReplicas = live.Status.ReadyReplicas
+	if dep.ReadyReplicas > 0 {
+		dep.Status = "running"
+	} else {
+		dep.Status = "pending"
+	}
+}
+
+// ListDeployments returns the tenant's deployments as stored
+func (dm *DeploymentManager) ListDeployments(ctx context.Context, tenant string) ([]DeploymentResponse, error) {
+	stored, err := dm.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deployments := []DeploymentResponse{}
+	for _, s := range stored {
+		if s.Deployment.TenantID == tenant {
+			deployments = append(deployments, s.Deployment)
 		}
-		return dep, nil
 	}
-	return nil, fmt.Errorf("deployment not found")
+	return deployments, nil
+}
+
+// DeleteDeployment removes one of the tenant's deployments
+func (dm *DeploymentManager) DeleteDeployment(ctx context.Context, tenant, id string) error {
+	stored, err := dm.tenantDeployment(ctx, tenant, id)
+	if err != nil {
+		return err
+	}
+	return dm.deleteDeployment(ctx, stored.Deployment.Namespace, id)
 }
 
-func (dm *DeploymentManager) DeleteDeployment(ctx context.Context, id string) error {
+func (dm *DeploymentManager) deleteDeployment(ctx context.Context, namespace, id string) error {
 	// Delete Kubernetes resources
 	deletePolicy := metav1.DeletePropagationForeground
 	deleteOptions := metav1.DeleteOptions{
@@ -310,25 +480,27 @@ func (dm *DeploymentManager) DeleteDeployment(ctx context.Context, id string) er
 	}
 
 	// Delete deployment
-	err := dm.clientset.AppsV1().Deployments(dm.namespace).Delete(ctx, id, deleteOptions)
+	err := dm.clientset.AppsV1().Deployments(namespace).Delete(ctx, id, deleteOptions)
 	if err != nil {
 		log.Printf("Failed to delete deployment: %v", err)
 	}
 
 	// Delete service
-	err = dm.clientset.CoreV1().Services(dm.namespace).Delete(ctx, id, deleteOptions)
+	err = dm.clientset.CoreV1().Services(namespace).Delete(ctx, id, deleteOptions)
 	if err != nil {
 		log.Printf("Failed to delete service: %v", err)
 	}
 
 	// Delete ingress
-	err = dm.clientset.NetworkingV1().Ingresses(dm.namespace).Delete(ctx, id, deleteOptions)
+	err = dm.clientset.NetworkingV1().Ingresses(namespace).Delete(ctx, id, deleteOptions)
 	if err != nil {
 		log.Printf("Failed to delete ingress: %v", err)
 	}
 
-	delete(dm.deployments, id)
-	return nil
+	dm.deleteCanary(ctx, namespace, id)
+	dm.deleteSecret(ctx, namespace, id, deleteOptions)
+
+	return dm.store.Delete(ctx, id)
 }
 
 // TTL Cleanup worker
@@ -348,30 +520,37 @@ func (dm *DeploymentManager) StartTTLCleanup(ctx context.Context) {
 }
 
 func (dm *DeploymentManager) cleanupExpiredDeployments(ctx context.Context) {
-	for id, dep := range dm.deployments {
-		if time.Now().After(dep.ExpiresAt) {
-			log.Printf("Cleaning up expired deployment: %s", id)
-			err := dm.DeleteDeployment(ctx, id)
-			if err != nil {
-				log.Printf("Failed to cleanup deployment %s: %v", id, err)
-			}
-		}
+	stored, err := dm.store.List(ctx)
+	if err != nil {
+		log.Printf("Failed to list deployments for cleanup: %v", err)
+		return
 	}
-}
 
-func int32Ptr(i int32) *int32 { return &i }
+	var expired []DeploymentResponse
+	for _, s := range stored {
+		if time.Now().After(s.Deployment.ExpiresAt) {
+			expired = append(expired, s.Deployment)
+		}
+	}
 
-func main() {
-	dm, err := NewDeploymentManager()
-	if err != nil {
-		log.Fatal("Failed to create deployment manager:", err)
+	for _, dep := range expired {
+		log.Printf("Cleaning up expired deployment: %s", dep.ID)
+		err := dm.deleteDeployment(ctx, dep.Namespace, dep.ID)
+		if err != nil {
+			log.Printf("Failed to cleanup deployment %s: %v", dep.ID, err)
+		}
 	}
+}
 
-	// Start TTL cleanup worker
-	ctx := context.Background()
-	dm.StartTTLCleanup(ctx)
+// appHost is the host a deployment is served at
+func (dm *DeploymentManager) appHost(id string) string {
+	return fmt.Sprintf("%s.%s", id, dm.baseURL)
+}
 
-	// Setup Gin router
+func int32Ptr(i int32) *int32 { return &i }
+
+// newRouter sets up the HTTP routes
+func newRouter(dm *DeploymentManager) *gin.Engine {
 	r := gin.Default()
 
 	// Health check
@@ -379,30 +558,51 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
 
+	// Every API route is scoped to the caller's tenant
+	api := r.Group("/api/v1", tenantMiddleware(dm))
+
 	// Deploy application
-	r.POST("/api/v1/deploy", func(c *gin.Context) {
+	api.POST("/deploy", func(c *gin.Context) {
 		var req DeploymentRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		response, err := dm.CreateDeployment(c.Request.Context(), req)
+		response, err := dm.CreateDeployment(c.Request.Context(), tenantID(c), req)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondDeploymentError(c, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, response)
 	})
 
+	// Test, build and deploy a capsule; progress is reported on the
+	// deployment
+	api.POST("/deploy-from-capsule", func(c *gin.Context) {
+		var req DeployFromCapsuleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		response, err := dm.DeployFromCapsule(c.Request.Context(), tenantID(c), req)
+		if err != nil {
+			respondDeploymentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, response)
+	})
+
 	// Get deployment status
-	r.GET("/api/v1/deployments/:id", func(c *gin.Context) {
+	api.GET("/deployments/:id", func(c *gin.Context) {
 		id := c.Param("id")
 		
-		response, err := dm.GetDeployment(c.Request.Context(), id)
+		response, err := dm.GetDeployment(c.Request.Context(), tenantID(c), id)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+			respondDeploymentError(c, err)
 			return
 		}
 
@@ -410,27 +610,134 @@ func main() {
 	})
 
 	// Delete deployment
-	r.DELETE("/api/v1/deployments/:id", func(c *gin.Context) {
+	api.DELETE("/deployments/:id", func(c *gin.Context) {
 		id := c.Param("id")
 		
-		err := dm.DeleteDeployment(c.Request.Context(), id)
+		err := dm.DeleteDeployment(c.Request.Context(), tenantID(c), id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondDeploymentError(c, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "deployment deleted"})
 	})
 
-	// List all deployments
-	r.GET("/api/v1/deployments", func(c *gin.Context) {
-		deployments := []DeploymentResponse{}
-		for _, dep := range dm.deployments {
-			deployments = append(deployments, *dep)
+	// Update deployment image, environment or replicas
+	api.PUT("/deployments/:id", func(c *gin.Context) {
+		var req UpdateDeploymentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Image == "" && req.Environment == nil && req.Replicas == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "one of image, environment or replicas is required"})
+			return
+		}
+		if req.Replicas != nil && *req.Replicas < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "replicas must not be negative"})
+			return
+		}
+
+		// Canary deployments try out a new image or environment on a
+		// canary first
+		tenant, id := tenantID(c), c.Param("id")
+		if (req.Image != "" || req.Environment != nil) && dm.UsesCanary(c.Request.Context(), tenant, id) {
+			canary, err := dm.StartCanary(c.Request.Context(), tenant, id, req)
+			if err != nil {
+				respondDeploymentError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusAccepted, canary)
+			return
+		}
+
+		revision, err := dm.UpdateDeployment(c.Request.Context(), tenant, id, req)
+		if err != nil {
+			respondDeploymentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, revision)
+	})
+
+	// Send all traffic to the canary and make it the current version
+	api.POST("/deployments/:id/promote", func(c *gin.Context) {
+		revision, err := dm.PromoteCanary(c.Request.Context(), tenantID(c), c.Param("id"))
+		if err != nil {
+			respondDeploymentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, revision)
+	})
+
+	// Remove the canary, returning all traffic to the current version
+	api.DELETE("/deployments/:id/canary", func(c *gin.Context) {
+		if err := dm.AbortCanary(c.Request.Context(), tenantID(c), c.Param("id")); err != nil {
+			respondDeploymentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "canary removed"})
+	})
+
+	// List deployment revisions
+	api.GET("/deployments/:id/revisions", func(c *gin.Context) {
+		revisions, err := dm.ListRevisions(c.Request.Context(), tenantID(c), c.Param("id"))
+		if err != nil {
+			respondDeploymentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+	})
+
+	// Roll back to the previous or a given revision
+	api.POST("/deployments/:id/rollback", func(c *gin.Context) {
+		var req RollbackRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 		}
+
+		revision, err := dm.RollbackDeployment(c.Request.Context(), tenantID(c), c.Param("id"), req.Revision)
+		if err != nil {
+			respondDeploymentError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, revision)
+	})
+
+	// List the tenant's deployments
+	api.GET("/deployments", func(c *gin.Context) {
+		deployments, err := dm.ListDeployments(c.Request.Context(), tenantID(c))
+		if err != nil {
+			respondDeploymentError(c, err)
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{"deployments": deployments})
 	})
 
+	return r
+}
+
+func main() {
+	dm, err := NewDeploymentManager()
+	if err != nil {
+		log.Fatal("Failed to create deployment manager:", err)
+	}
+
+	// Start TTL cleanup worker
+	ctx := context.Background()
+	dm.StartTTLCleanup(ctx)
+
+	r := newRouter(dm)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8087"
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisDeploymentKeyPrefix = "deployment-manager:deployment:"
+	redisDeploymentIndexKey  = "deployment-manager:deployments"
+)
+
+// RedisDeploymentStore persists deployments in Redis so they survive
+// restarts and are shared by every replica
+type RedisDeploymentStore struct {
+	client *redis.Client
+}
+
+// NewRedisDeploymentStore connects to the Redis instance at redisURL
+func NewRedisDeploymentStore(redisURL string) (*RedisDeploymentStore, error) {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	client := redis.NewClient(opt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &RedisDeploymentStore{client: client}, nil
+}
+
+func (s *RedisDeploymentStore) Put(ctx context.Context, dep *StoredDeployment) error {
+	data, err := json.Marshal(dep)
+	if err != nil {
+		return fmt.Errorf("failed to encode deployment: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, redisDeploymentKeyPrefix+dep.Deployment.ID, data, 0)
+	pipe.ZAdd(ctx, redisDeploymentIndexKey, redis.Z{
+		Score:  float64(dep.Deployment.CreatedAt.UnixNano()),
+		Member: dep.Deployment.ID,
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save deployment: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisDeploymentStore) Get(ctx context.Context, id string) (*StoredDeployment, error) {
+	data, err := s.client.Get(ctx, redisDeploymentKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, errDeploymentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	var dep StoredDeployment
+	if err := json.Unmarshal(data, &dep); err != nil {
+		return nil, fmt.Errorf("failed to decode deployment: %w", err)
+	}
+	return &dep, nil
+}
+
+func (s *RedisDeploymentStore) List(ctx context.Context) ([]*StoredDeployment, error) {
+	ids, err := s.client.ZRange(ctx, redisDeploymentIndexKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployment ids: %w", err)
+	}
+
+	deployments := []*StoredDeployment{}
+	const batch = 100
+	for start := 0; start < len(ids); start += batch {
+		end := start + batch
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		keys := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			keys = append(keys, redisDeploymentKeyPrefix+id)
+		}
+		values, err := s.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load deployments: %w", err)
+		}
+
+		for _, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var dep StoredDeployment
+			if err := json.Unmarshal([]byte(data), &dep); err != nil {
+				continue
+			}
+			deployments = append(deployments, &dep)
+		}
+	}
+	return deployments, nil
+}
+
+func (s *RedisDeploymentStore) Delete(ctx context.Context, id string) error {
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, redisDeploymentKeyPrefix+id)
+	pipe.ZRem(ctx, redisDeploymentIndexKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete deployment: %w", err)
+	}
+	return nil
+}
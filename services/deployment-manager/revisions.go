@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// maxRevisions is how many revisions are kept per deployment
+const maxRevisions = 20
+
+var (
+	errDeploymentNotFound = errors.New("deployment not found")
+	errRevisionNotFound   = errors.New("revision not found")
+	errNoPreviousRevision = errors.New("deployment has no previous revision")
+	errRevisionCurrent    = errors.New("revision is already current")
+)
+
+// Revision is one version of a deployment's container spec
+type Revision struct {
+	Revision    int               `json:"revision"`
+	Image       string            `json:"image"`
+	Environment map[string]string `json:"environment,omitempty"`
+	Replicas    int32             `json:"replicas"`
+	// RollbackOf is the revision this one restored, if it was a rollback
+	RollbackOf int       `json:"rollback_of,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// UpdateDeploymentRequest changes a deployment's spec; unset fields keep
+// their current values
+type UpdateDeploymentRequest struct {
+	Image       string            `json:"image"`
+	Environment map[string]string `json:"environment"`
+	Replicas    *int32            `json:"replicas"`
+}
+
+// RollbackRequest selects the revision to roll back to; zero means the one
+// before the current revision
+type RollbackRequest struct {
+	Revision int `json:"revision"`
+}
+
+// ListRevisions returns a deployment's revisions, oldest first
+func (dm *DeploymentManager) ListRevisions(ctx context.Context, tenant, id string) ([]Revision, error) {
+	stored, err := dm.tenantDeployment(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	return stored.Revisions, nil
+}
+
+// UpdateDeployment applies a new spec to a deployment and records it as a
+// new revision
+func (dm *DeploymentManager) UpdateDeployment(ctx context.Context, tenant, id string, req UpdateDeploymentRequest) (*Revision, error) {
+	// Held across the Kubernetes update so revisions are recorded in the
+	// order they were applied
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	stored, err := dm.liveDeployment(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Deployment.Canary != nil {
+		return nil, errCanaryInProgress
+	}
+
+	next := stored.current()
+	next.RollbackOf = 0
+	if req.Image != "" {
+		next.Image = req.Image
+	}
+	if req.Environment != nil {
+		next.Environment = req.Environment
+	}
+	if req.Replicas != nil {
+		next.Replicas = *req.Replicas
+	}
+	rev, err := dm.applyRevision(ctx, stored, next)
+	if err != nil {
+		return nil, err
+	}
+	return rev, dm.store.Put(ctx, stored)
+}
+
+// RollbackDeployment restores the spec of an earlier revision, recording
+// the rollback as a new revision. A target of zero means the revision
+// before the current one.
+func (dm *DeploymentManager) RollbackDeployment(ctx context.Context, tenant, id string, target int) (*Revision, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	stored, err := dm.liveDeployment(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Deployment.Canary != nil {
+		return nil, errCanaryInProgress
+	}
+	revisions := stored.Revisions
+
+	current := stored.current()
+	if target == 0 {
+		if len(revisions) < 2 {
+			return nil, errNoPreviousRevision
+		}
+		target = revisions[len(revisions)-2].Revision
+	}
+	if target == current.Revision {
+		return nil, errRevisionCurrent
+	}
+
+	for _, rev := range revisions {
+		if rev.Revision == target {
+			rev.RollbackOf = target
+			applied, err := dm.applyRevision(ctx, stored, rev)
+			if err != nil {
+				return nil, err
+			}
+			return applied, dm.store.Put(ctx, stored)
+		}
+	}
+	return nil, errRevisionNotFound
+}
+
+// applyRevision updates the Kubernetes deployment to rev's spec and appends
+// it as the next revision of stored, which the caller saves. The caller
+// holds dm.mu.
+func (dm *DeploymentManager) applyRevision(ctx context.Context, stored *StoredDeployment, rev Revision) (*Revision, error) {
+	dep := &stored.Deployment
+	id := dep.ID
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := dm.clientset.AppsV1().Deployments(dep.Namespace).Get(ctx, id, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if len(deployment.Spec.Template.Spec.Containers) == 0 {
+			return fmt.Errorf("deployment %s has no containers", id)
+		}
+
+		deployment.Spec.Replicas = int32Ptr(rev.Replicas)
+		container := &deployment.Spec.Template.Spec.Containers[0]
+		container.Image = rev.Image
+		container.Env = containerEnv(container.Env, rev.Environment)
+
+		_, err = dm.clientset.AppsV1().Deployments(dep.Namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update deployment: %w", err)
+	}
+
+	rev.Revision = stored.current().Revision + 1
+	rev.CreatedAt = time.Now()
+	stored.Revisions = appendRevision(stored.Revisions, rev)
+	dep.Replicas = rev.Replicas
+	dm.refreshCost(stored)
+	return &rev, nil
+}
+
+// appendRevision adds rev, dropping the oldest revisions beyond maxRevisions
+func appendRevision(revisions []Revision, rev Revision) []Revision {
+	revisions = append(revisions, rev)
+	if len(revisions) > maxRevisions {
+		revisions = append([]Revision(nil), revisions[len(revisions)-maxRevisions:]...)
+	}
+	return revisions
+}
+
+// envVars converts an environment map to container env vars, sorted by name
+func envVars(environment map[string]string) []corev1.EnvVar {
+	vars := []corev1.EnvVar{}
+	for k, v := range environment {
+		vars = append(vars, corev1.EnvVar{
+			Name:  k,
+			Value: v,
+		})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+// respondDeploymentError maps deployment, revision, strategy, resource and
+// secret errors to HTTP statuses
+func respondDeploymentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errInvalidStrategy), errors.Is(err, errInvalidResources),
+		errors.Is(err, errInvalidSecrets), errors.Is(err, errSecretNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errDeploymentNotFound), errors.Is(err, errRevisionNotFound),
+		errors.Is(err, errCapsuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errCapsuleNotDeployable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, errDownstream):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	case errors.Is(err, errNoPreviousRevision), errors.Is(err, errRevisionCurrent),
+		errors.Is(err, errNotCanary), errors.Is(err, errNoCanary), errors.Is(err, errCanaryInProgress),
+		errors.Is(err, errDeploymentNotReady):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
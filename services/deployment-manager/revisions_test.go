@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestManager() *DeploymentManager {
+	return &DeploymentManager{
+		clientset:        fake.NewSimpleClientset(),
+		namespace:        "quantumlayer-apps",
+		baseURL:          "apps.example.com",
+		quota:            TenantQuota{CPU: "2", Memory: "4Gi", Pods: "10"},
+		pricing:          Pricing{CPUCoreHour: 0.04, MemoryGiBHour: 0.005, Currency: "USD"},
+		ingressNamespace: "ingress-nginx",
+		store:            NewMemoryDeploymentStore(),
+	}
+}
+
+// testTenant owns the deployments in the revision tests
+const testTenant = "acme"
+
+func deploy(t *testing.T, dm *DeploymentManager, image string) string {
+	t.Helper()
+	resp, err := dm.CreateDeployment(context.Background(), testTenant, DeploymentRequest{
+		WorkflowID:  "wf-1",
+		CapsuleID:   "capsule-1",
+		Name:        "demo",
+		Image:       image,
+		Environment: map[string]string{"LOG_LEVEL": "info"},
+	})
+	if err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+	return resp.ID
+}
+
+func update(t *testing.T, dm *DeploymentManager, id string, req UpdateDeploymentRequest) {
+	t.Helper()
+	if _, err := dm.UpdateDeployment(context.Background(), testTenant, id, req); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+}
+
+// liveSpec reads back the image, env and replicas Kubernetes holds
+func liveSpec(t *testing.T, dm *DeploymentManager, id string) (string, map[string]string, int32) {
+	t.Helper()
+	deployment, err := dm.clientset.AppsV1().Deployments(dm.tenantNamespace(testTenant)).Get(context.Background(), id, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	container := deployment.Spec.Template.Spec.Containers[0]
+	env := make(map[string]string)
+	for _, v := range container.Env {
+		env[v.Name] = v.Value
+	}
+	return container.Image, env, *deployment.Spec.Replicas
+}
+
+func TestRollbackDeployment(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       int
+		wantImage    string
+		wantLogLevel string
+		wantReplicas int32
+	}{
+		{"previous revision", 0, "demo:v2", "debug", 2},
+		{"first revision", 1, "demo:v1", "info", 1},
+		{"second revision", 2, "demo:v2", "debug", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm := newTestManager()
+			id := deploy(t, dm, "demo:v1")
+			replicas := int32(2)
+			update(t, dm, id, UpdateDeploymentRequest{Image: "demo:v2", Environment: map[string]string{"LOG_LEVEL": "debug"}, Replicas: &replicas})
+			update(t, dm, id, UpdateDeploymentRequest{Image: "demo:v3"})
+
+			if image, _, _ := liveSpec(t, dm, id); image != "demo:v3" {
+				t.Fatalf("image after updates = %s, want demo:v3", image)
+			}
+
+			rev, err := dm.RollbackDeployment(context.Background(), testTenant, id, tt.target)
+			if err != nil {
+				t.Fatalf("RollbackDeployment: %v", err)
+			}
+			image, env, replicas := liveSpec(t, dm, id)
+			if image != tt.wantImage || env["LOG_LEVEL"] != tt.wantLogLevel || replicas != tt.wantReplicas {
+				t.Fatalf("deployment runs %s with LOG_LEVEL=%s x%d, want %s with %s x%d",
+					image, env["LOG_LEVEL"], replicas, tt.wantImage, tt.wantLogLevel, tt.wantReplicas)
+			}
+			if rev.Revision != 4 || rev.Image != tt.wantImage {
+				t.Fatalf("rollback recorded as %+v, want revision 4 running %s", rev, tt.wantImage)
+			}
+		})
+	}
+}
+
+func TestRollbackIsRecordedAsRevision(t *testing.T) {
+	dm := newTestManager()
+	id := deploy(t, dm, "demo:v1")
+	update(t, dm, id, UpdateDeploymentRequest{Image: "demo:v2"})
+	if _, err := dm.RollbackDeployment(context.Background(), testTenant, id, 0); err != nil {
+		t.Fatalf("RollbackDeployment: %v", err)
+	}
+
+	revisions, err := dm.ListRevisions(context.Background(), testTenant, id)
+	if err != nil {
+		t.Fatalf("ListRevisions: %v", err)
+	}
+	want := []struct {
+		image      string
+		rollbackOf int
+	}{{"demo:v1", 0}, {"demo:v2", 0}, {"demo:v1", 1}}
+	if len(revisions) != len(want) {
+		t.Fatalf("got %d revisions, want %d", len(revisions), len(want))
+	}
+	for i, rev := range revisions {
+		if rev.Revision != i+1 || rev.Image != want[i].image || rev.RollbackOf != want[i].rollbackOf {
+			t.Fatalf("revision %d = %+v, want %s rolling back %d", i+1, rev, want[i].image, want[i].rollbackOf)
+		}
+	}
+
+	// Rolling back again returns to the revision before the rollback
+	if _, err := dm.RollbackDeployment(context.Background(), testTenant, id, 0); err != nil {
+		t.Fatalf("second RollbackDeployment: %v", err)
+	}
+	if image, _, _ := liveSpec(t, dm, id); image != "demo:v2" {
+		t.Fatalf("image = %s, want demo:v2", image)
+	}
+}
+
+func TestRollbackDeploymentErrors(t *testing.T) {
+	dm := newTestManager()
+	id := deploy(t, dm, "demo:v1")
+
+	tests := []struct {
+		name    string
+		id      string
+		target  int
+		wantErr error
+	}{
+		{"no previous revision", id, 0, errNoPreviousRevision},
+		{"current revision", id, 1, errRevisionCurrent},
+		{"unknown revision", id, 7, errRevisionNotFound},
+		{"unknown deployment", "app-missing", 0, errDeploymentNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := dm.RollbackDeployment(context.Background(), testTenant, tt.id, tt.target)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if image, _, _ := liveSpec(t, dm, id); image != "demo:v1" {
+		t.Fatalf("failed rollbacks changed the image to %s", image)
+	}
+}
+
+func TestRevisionHistoryIsBounded(t *testing.T) {
+	dm := newTestManager()
+	id := deploy(t, dm, "demo:v0")
+	for i := 1; i <= maxRevisions+5; i++ {
+		update(t, dm, id, UpdateDeploymentRequest{Image: "demo:next"})
+	}
+
+	revisions, _ := dm.ListRevisions(context.Background(), testTenant, id)
+	if len(revisions) != maxRevisions || revisions[len(revisions)-1].Revision != maxRevisions+6 {
+		t.Fatalf("kept %d revisions ending at %d, want the latest %d", len(revisions), revisions[len(revisions)-1].Revision, maxRevisions)
+	}
+	if _, err := dm.RollbackDeployment(context.Background(), testTenant, id, 1); !errors.Is(err, errRevisionNotFound) {
+		t.Fatalf("rollback to a dropped revision: err = %v, want %v", err, errRevisionNotFound)
+	}
+}
+
+func TestDeleteDeploymentDropsRevisions(t *testing.T) {
+	dm := newTestManager()
+	id := deploy(t, dm, "demo:v1")
+	dm.DeleteDeployment(context.Background(), testTenant, id)
+
+	if _, err := dm.ListRevisions(context.Background(), testTenant, id); !errors.Is(err, errDeploymentNotFound) {
+		t.Fatalf("err = %v, want %v", err, errDeploymentNotFound)
+	}
+}
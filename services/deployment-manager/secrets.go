@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	errInvalidSecrets = errors.New("invalid secrets")
+	errSecretNotFound = errors.New("secret not found")
+)
+
+// SecretRef sets an env var from a key of a Secret that already exists in
+// the tenant's namespace
+type SecretRef struct {
+	Name    string `json:"name"`
+	Key     string `json:"key"`
+	EnvName string `json:"env_name"`
+}
+
+// validateSecrets checks the names of a request's secret env vars and
+// that no env var is set twice
+func (req *DeploymentRequest) validateSecrets() error {
+	set := make(map[string]string)
+	for name := range req.Environment {
+		set[name] = "environment"
+	}
+	claim := func(name, from string) error {
+		if errs := validation.IsEnvVarName(name); len(errs) > 0 {
+			return fmt.Errorf("%w: %s env var %q: %s", errInvalidSecrets, from, name, strings.Join(errs, "; "))
+		}
+		if other, ok := set[name]; ok {
+			return fmt.Errorf("%w: env var %q is set by both %s and %s", errInvalidSecrets, name, other, from)
+		}
+		set[name] = from
+		return nil
+	}
+
+	for _, name := range sortedKeys(req.Secrets) {
+		if err := claim(name, "secrets"); err != nil {
+			return err
+		}
+	}
+	for i, ref := range req.SecretRefs {
+		if ref.Name == "" || ref.Key == "" || ref.EnvName == "" {
+			return fmt.Errorf("%w: secret_refs[%d] needs a name, key and env_name", errInvalidSecrets, i)
+		}
+		if errs := validation.IsDNS1123Subdomain(ref.Name); len(errs) > 0 {
+			return fmt.Errorf("%w: secret_refs[%d] name %q: %s", errInvalidSecrets, i, ref.Name, strings.Join(errs, "; "))
+		}
+		if err := claim(ref.EnvName, "secret_refs"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSecretRefs makes sure every referenced Secret and key exists, so a
+// deployment doesn't start with pods that can't be created
+func (dm *DeploymentManager) checkSecretRefs(ctx context.Context, namespace string, refs []SecretRef) error {
+	for _, ref := range refs {
+		secret, err := dm.clientset.CoreV1().Secrets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("%w: %q in namespace %s", errSecretNotFound, ref.Name, namespace)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read secret %s: %w", ref.Name, err)
+		}
+		if _, ok := secret.Data[ref.Key]; !ok {
+			return fmt.Errorf("%w: %q has no key %q", errSecretNotFound, ref.Name, ref.Key)
+		}
+	}
+	return nil
+}
+
+// createSecret stores a deployment's secret values in a Secret named after
+// it, carrying its labels. Deployments without secrets get none.
+func (dm *DeploymentManager) createSecret(ctx context.Context, namespace, id string, labels, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	data := make(map[string][]byte, len(values))
+	for k, v := range values {
+		data[k] = []byte(v)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      id,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+	if _, err := dm.clientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create secret: %w", err)
+	}
+	return nil
+}
+
+// deleteSecret removes a deployment's Secret, if it has one
+func (dm *DeploymentManager) deleteSecret(ctx context.Context, namespace, id string, options metav1.DeleteOptions) {
+	err := dm.clientset.CoreV1().Secrets(namespace).Delete(ctx, id, options)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Failed to delete secret: %v", err)
+	}
+}
+
+// secretEnvVars references a request's secrets, stored in the Secret named
+// id, and its secret refs from container env vars
+func secretEnvVars(id string, req DeploymentRequest) []corev1.EnvVar {
+	vars := []corev1.EnvVar{}
+	for _, name := range sortedKeys(req.Secrets) {
+		vars = append(vars, secretKeyEnv(name, id, name))
+	}
+	for _, ref := range req.SecretRefs {
+		vars = append(vars, secretKeyEnv(ref.EnvName, ref.Name, ref.Key))
+	}
+	return vars
+}
+
+func secretKeyEnv(name, secret, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+				Key:                  key,
+			},
+		},
+	}
+}
+
+// containerEnv replaces the plain env vars of a container with environment,
+// keeping the ones set from secrets. A secret wins over a plain value of
+// the same name.
+func containerEnv(current []corev1.EnvVar, environment map[string]string) []corev1.EnvVar {
+	var vars []corev1.EnvVar
+	fromSecret := make(map[string]bool)
+	for _, v := range current {
+		if v.ValueFrom != nil && v.ValueFrom.SecretKeyRef != nil {
+			vars = append(vars, v)
+			fromSecret[v.Name] = true
+		}
+	}
+	for _, v := range envVars(environment) {
+		if !fromSecret[v.Name] {
+			vars = append(vars, v)
+		}
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+// secretEnvNames lists the env vars a request sets from secrets, never
+// their values
+func secretEnvNames(req DeploymentRequest) []string {
+	names := sortedKeys(req.Secrets)
+	for _, ref := range req.SecretRefs {
+		names = append(names, ref.EnvName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// liveEnv reads back a deployment's container env vars by name
+func liveEnv(t *testing.T, dm *DeploymentManager, id string) map[string]corev1.EnvVar {
+	t.Helper()
+	deployment, err := dm.clientset.AppsV1().Deployments(dm.tenantNamespace(testTenant)).Get(context.Background(), id, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	env := make(map[string]corev1.EnvVar)
+	for _, v := range deployment.Spec.Template.Spec.Containers[0].Env {
+		env[v.Name] = v
+	}
+	return env
+}
+
+func assertSecretKeyRef(t *testing.T, v corev1.EnvVar, secret, key string) {
+	t.Helper()
+	if v.Value != "" || v.ValueFrom == nil || v.ValueFrom.SecretKeyRef == nil {
+		t.Fatalf("%s = %+v, want a secretKeyRef", v.Name, v)
+	}
+	if ref := v.ValueFrom.SecretKeyRef; ref.Name != secret || ref.Key != key {
+		t.Errorf("%s references %s/%s, want %s/%s", v.Name, ref.Name, ref.Key, secret, key)
+	}
+}
+
+func TestDeploySecretsAreStoredInSecret(t *testing.T) {
+	dm := newTestManager()
+	r := newRouter(dm)
+	ctx := context.Background()
+	namespace := dm.tenantNamespace(testTenant)
+
+	w := call(t, r, testTenant, http.MethodPost, "/api/v1/deploy", DeploymentRequest{
+		WorkflowID:  "wf-1",
+		CapsuleID:   "capsule-1",
+		Name:        "demo",
+		Image:       "demo:v1",
+		Environment: map[string]string{"LOG_LEVEL": "info"},
+		Secrets:     map[string]string{"DB_PASSWORD": "hunter2", "API_TOKEN": "tok-123"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("deploy: status %d: %s", w.Code, w.Body)
+	}
+	var dep DeploymentResponse
+	json.Unmarshal(w.Body.Bytes(), &dep)
+
+	secret, err := dm.clientset.CoreV1().Secrets(namespace).Get(ctx, dep.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("deployment secret: %v", err)
+	}
+	if string(secret.Data["DB_PASSWORD"]) != "hunter2" || string(secret.Data["API_TOKEN"]) != "tok-123" {
+		t.Errorf("secret data = %v", secret.Data)
+	}
+	if secret.Labels["app"] != dep.ID || secret.Labels["managed-by"] != "deployment-manager" || secret.Labels[tenantLabel] != testTenant {
+		t.Errorf("secret labels = %v, want the deployment's", secret.Labels)
+	}
+
+	env := liveEnv(t, dm, dep.ID)
+	assertSecretKeyRef(t, env["DB_PASSWORD"], dep.ID, "DB_PASSWORD")
+	assertSecretKeyRef(t, env["API_TOKEN"], dep.ID, "API_TOKEN")
+	if env["LOG_LEVEL"].Value != "info" {
+		t.Errorf("LOG_LEVEL = %+v, want the plain value", env["LOG_LEVEL"])
+	}
+
+	// Status and list name the secret env vars but never return values
+	for _, path := range []string{"/api/v1/deploy", "/api/v1/deployments/" + dep.ID, "/api/v1/deployments", "/api/v1/deployments/" + dep.ID + "/revisions"} {
+		body := w.Body.String()
+		if path != "/api/v1/deploy" {
+			body = call(t, r, testTenant, http.MethodGet, path, nil).Body.String()
+		}
+		if strings.Contains(body, "hunter2") || strings.Contains(body, "tok-123") {
+			t.Errorf("%s echoes a secret value: %s", path, body)
+		}
+	}
+	if strings.Join(dep.SecretEnv, ",") != "API_TOKEN,DB_PASSWORD" {
+		t.Errorf("secret_env = %v", dep.SecretEnv)
+	}
+
+	// Updating the environment keeps the secret env vars
+	update(t, dm, dep.ID, UpdateDeploymentRequest{Environment: map[string]string{"LOG_LEVEL": "debug"}})
+	env = liveEnv(t, dm, dep.ID)
+	assertSecretKeyRef(t, env["DB_PASSWORD"], dep.ID, "DB_PASSWORD")
+	if env["LOG_LEVEL"].Value != "debug" {
+		t.Errorf("LOG_LEVEL = %+v after update", env["LOG_LEVEL"])
+	}
+
+	// Cleanup deletes the secret with the deployment
+	if w := call(t, r, testTenant, http.MethodDelete, "/api/v1/deployments/"+dep.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", w.Code, w.Body)
+	}
+	if _, err := dm.clientset.CoreV1().Secrets(namespace).Get(ctx, dep.ID, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("secret after delete: %v, want not found", err)
+	}
+}
+
+func TestDeploySecretRefs(t *testing.T) {
+	dm := newTestManager()
+	r := newRouter(dm)
+	ctx := context.Background()
+	namespace := dm.tenantNamespace(testTenant)
+
+	req := DeploymentRequest{
+		WorkflowID: "wf-1",
+		CapsuleID:  "capsule-1",
+		Name:       "demo",
+		Image:      "demo:v1",
+		SecretRefs: []SecretRef{{Name: "shared-db", Key: "password", EnvName: "DATABASE_PASSWORD"}},
+	}
+
+	// The referenced secret must exist before anything is created
+	w := call(t, r, testTenant, http.MethodPost, "/api/v1/deploy", req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "shared-db") {
+		t.Fatalf("missing secret: status %d: %s, want 400", w.Code, w.Body)
+	}
+	if list, _ := dm.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{}); len(list.Items) != 0 {
+		t.Fatalf("deployments created despite a missing secret: %d", len(list.Items))
+	}
+
+	dm.clientset.CoreV1().Secrets(namespace).Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared-db", Namespace: namespace},
+		Data:       map[string][]byte{"username": []byte("app")},
+	}, metav1.CreateOptions{})
+	w = call(t, r, testTenant, http.MethodPost, "/api/v1/deploy", req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `no key \"password\"`) {
+		t.Fatalf("missing key: status %d: %s, want 400", w.Code, w.Body)
+	}
+
+	dm.clientset.CoreV1().Secrets(namespace).Update(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "shared-db", Namespace: namespace},
+		Data:       map[string][]byte{"password": []byte("s3cret")},
+	}, metav1.UpdateOptions{})
+	w = call(t, r, testTenant, http.MethodPost, "/api/v1/deploy", req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("deploy: status %d: %s", w.Code, w.Body)
+	}
+	var dep DeploymentResponse
+	json.Unmarshal(w.Body.Bytes(), &dep)
+	assertSecretKeyRef(t, liveEnv(t, dm, dep.ID)["DATABASE_PASSWORD"], "shared-db", "password")
+
+	// Without secrets of its own the deployment gets no secret
+	if _, err := dm.clientset.CoreV1().Secrets(namespace).Get(ctx, dep.ID, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("deployment secret: %v, want none", err)
+	}
+}
+
+func TestValidateSecrets(t *testing.T) {
+	tests := []struct {
+		name string
+		req  DeploymentRequest
+		err  string
+	}{
+		{name: "none"},
+		{
+			name: "secrets and refs",
+			req: DeploymentRequest{
+				Environment: map[string]string{"PORT": "8080"},
+				Secrets:     map[string]string{"DB_PASSWORD": "x"},
+				SecretRefs:  []SecretRef{{Name: "shared", Key: "token", EnvName: "TOKEN"}},
+			},
+		},
+		{
+			name: "secret shadows environment",
+			req: DeploymentRequest{
+				Environment: map[string]string{"DB_PASSWORD": "plain"},
+				Secrets:     map[string]string{"DB_PASSWORD": "x"},
+			},
+			err: "set by both environment and secrets",
+		},
+		{
+			name: "ref shadows secret",
+			req: DeploymentRequest{
+				Secrets:    map[string]string{"TOKEN": "x"},
+				SecretRefs: []SecretRef{{Name: "shared", Key: "token", EnvName: "TOKEN"}},
+			},
+			err: "set by both secrets and secret_refs",
+		},
+		{
+			name: "invalid env name",
+			req:  DeploymentRequest{Secrets: map[string]string{"1PASSWORD": "x"}},
+			err:  `"1PASSWORD"`,
+		},
+		{
+			name: "incomplete ref",
+			req:  DeploymentRequest{SecretRefs: []SecretRef{{Name: "shared", EnvName: "TOKEN"}}},
+			err:  "secret_refs[0] needs a name, key and env_name",
+		},
+		{
+			name: "invalid secret name",
+			req:  DeploymentRequest{SecretRefs: []SecretRef{{Name: "Shared_DB", Key: "token", EnvName: "TOKEN"}}},
+			err:  `"Shared_DB"`,
+		},
+	}
+	for _, tt := range tests {
+		err := tt.req.validateSecrets()
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: validateSecrets() = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
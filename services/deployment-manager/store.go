@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// StoredDeployment is a deployment's recorded state and revision history
+type StoredDeployment struct {
+	Deployment DeploymentResponse `json:"deployment"`
+	Revisions  []Revision         `json:"revisions"`
+}
+
+// current is the deployment's latest revision
+func (s *StoredDeployment) current() Revision {
+	return s.Revisions[len(s.Revisions)-1]
+}
+
+// copy returns a StoredDeployment sharing nothing mutable with s
+func (s *StoredDeployment) copy() *StoredDeployment {
+	copied := *s
+	if s.Deployment.Canary != nil {
+		canary := *s.Deployment.Canary
+		copied.Deployment.Canary = &canary
+	}
+	if s.Deployment.Cost != nil {
+		cost := *s.Deployment.Cost
+		copied.Deployment.Cost = &cost
+	}
+	if s.Deployment.SmokeTest != nil {
+		smokeTest := *s.Deployment.SmokeTest
+		copied.Deployment.SmokeTest = &smokeTest
+	}
+	copied.Deployment.SecretEnv = append([]string(nil), s.Deployment.SecretEnv...)
+	copied.Revisions = append([]Revision(nil), s.Revisions...)
+	return &copied
+}
+
+// DeploymentStore persists deployments. Implementations must be safe for
+// concurrent use; Get returns errDeploymentNotFound for unknown IDs.
+type DeploymentStore interface {
+	Put(ctx context.Context, dep *StoredDeployment) error
+	Get(ctx context.Context, id string) (*StoredDeployment, error)
+	// List returns every deployment, oldest first
+	List(ctx context.Context) ([]*StoredDeployment, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// NewDeploymentStoreFromEnv selects a store using DEPLOYMENT_STORE (memory
+// or redis). The Redis store connects to REDIS_URL.
+func NewDeploymentStoreFromEnv() (DeploymentStore, error) {
+	switch backend := os.Getenv("DEPLOYMENT_STORE"); backend {
+	case "", "memory":
+		return NewMemoryDeploymentStore(), nil
+	case "redis":
+		redisURL := os.Getenv("REDIS_URL")
+		if redisURL == "" {
+			return nil, fmt.Errorf("REDIS_URL is required for the redis deployment store")
+		}
+		return NewRedisDeploymentStore(redisURL)
+	default:
+		return nil, fmt.Errorf("unknown deployment store %q", backend)
+	}
+}
+
+// MemoryDeploymentStore keeps deployments in memory; they are lost on
+// restart
+type MemoryDeploymentStore struct {
+	deployments map[string]*StoredDeployment
+	mu          sync.RWMutex
+}
+
+// NewMemoryDeploymentStore creates an empty in-memory store
+func NewMemoryDeploymentStore() *MemoryDeploymentStore {
+	return &MemoryDeploymentStore{
+		deployments: make(map[string]*StoredDeployment),
+	}
+}
+
+func (s *MemoryDeploymentStore) Put(ctx context.Context, dep *StoredDeployment) error {
+	s.mu.Lock()
+	s.deployments[dep.Deployment.ID] = dep.copy()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryDeploymentStore) Get(ctx context.Context, id string) (*StoredDeployment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dep, ok := s.deployments[id]
+	if !ok {
+		return nil, errDeploymentNotFound
+	}
+	return dep.copy(), nil
+}
+
+func (s *MemoryDeploymentStore) List(ctx context.Context) ([]*StoredDeployment, error) {
+	s.mu.RLock()
+	deployments := make([]*StoredDeployment, 0, len(s.deployments))
+	for _, dep := range s.deployments {
+		deployments = append(deployments, dep.copy())
+	}
+	s.mu.RUnlock()
+
+	sortDeployments(deployments)
+	return deployments, nil
+}
+
+func (s *MemoryDeploymentStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.deployments, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// sortDeployments orders deployments oldest first
+func sortDeployments(deployments []*StoredDeployment) {
+	sort.Slice(deployments, func(i, j int) bool {
+		return deployments[i].Deployment.CreatedAt.Before(deployments[j].Deployment.CreatedAt)
+	})
+}
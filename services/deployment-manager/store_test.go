@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newRedisTestStore(t *testing.T) *RedisDeploymentStore {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	store, err := NewRedisDeploymentStore("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatalf("NewRedisDeploymentStore: %v", err)
+	}
+	return store
+}
+
+func testStores(t *testing.T) map[string]func() DeploymentStore {
+	return map[string]func() DeploymentStore{
+		"memory": func() DeploymentStore { return NewMemoryDeploymentStore() },
+		"redis":  func() DeploymentStore { return newRedisTestStore(t) },
+	}
+}
+
+func storedDeployment(id string, createdAt time.Time) *StoredDeployment {
+	return &StoredDeployment{
+		Deployment: DeploymentResponse{
+			ID:        id,
+			TenantID:  testTenant,
+			Status:    "deploying",
+			CreatedAt: createdAt,
+			Canary:    &CanaryStatus{Image: "demo:v2", Weight: 10},
+		},
+		Revisions: []Revision{{Revision: 1, Image: "demo:v1", Replicas: 1}},
+	}
+}
+
+func TestDeploymentStores(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for name, newStore := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore()
+
+			if _, err := store.Get(ctx, "app-missing"); !errors.Is(err, errDeploymentNotFound) {
+				t.Fatalf("Get missing: err = %v, want %v", err, errDeploymentNotFound)
+			}
+
+			newer := storedDeployment("app-2", now)
+			older := storedDeployment("app-1", now.Add(-time.Hour))
+			for _, dep := range []*StoredDeployment{newer, older} {
+				if err := store.Put(ctx, dep); err != nil {
+					t.Fatalf("Put: %v", err)
+				}
+			}
+
+			// Changes after Put aren't visible until the next Put
+			older.Deployment.Canary.Weight = 50
+			older.Revisions = append(older.Revisions, Revision{Revision: 2, Image: "demo:v2"})
+			got, err := store.Get(ctx, "app-1")
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if got.Deployment.Canary.Weight != 10 || len(got.Revisions) != 1 || got.current().Image != "demo:v1" {
+				t.Fatalf("Get = %+v", got)
+			}
+
+			if err := store.Put(ctx, older); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			got, _ = store.Get(ctx, "app-1")
+			if len(got.Revisions) != 2 || got.Deployment.Canary.Weight != 50 || !got.Deployment.CreatedAt.Equal(older.Deployment.CreatedAt) {
+				t.Fatalf("Get after update = %+v", got)
+			}
+
+			list, err := store.List(ctx)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(list) != 2 || list[0].Deployment.ID != "app-1" || list[1].Deployment.ID != "app-2" {
+				t.Fatalf("List = %v, want app-1 then app-2", list)
+			}
+
+			if err := store.Delete(ctx, "app-1"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Get(ctx, "app-1"); !errors.Is(err, errDeploymentNotFound) {
+				t.Fatalf("Get deleted: err = %v", err)
+			}
+			if list, _ := store.List(ctx); len(list) != 1 {
+				t.Fatalf("List after delete has %d deployments", len(list))
+			}
+		})
+	}
+}
+
+// A deployment and its history survive a restart when stored in Redis
+func TestRedisStoreSharesDeployments(t *testing.T) {
+	store := newRedisTestStore(t)
+	dm := newTestManager()
+	dm.store = store
+	id := deploy(t, dm, "demo:v1")
+	update(t, dm, id, UpdateDeploymentRequest{Image: "demo:v2"})
+
+	restarted := newTestManager()
+	restarted.clientset = dm.clientset
+	restarted.store = store
+
+	revisions, err := restarted.ListRevisions(context.Background(), testTenant, id)
+	if err != nil || len(revisions) != 2 || revisions[1].Image != "demo:v2" {
+		t.Fatalf("revisions after restart = %+v, %v", revisions, err)
+	}
+	if _, err := restarted.RollbackDeployment(context.Background(), testTenant, id, 0); err != nil {
+		t.Fatalf("RollbackDeployment after restart: %v", err)
+	}
+	if image, _, _ := liveSpec(t, restarted, id); image != "demo:v1" {
+		t.Fatalf("image = %s, want demo:v1", image)
+	}
+	if _, err := restarted.GetDeployment(context.Background(), "other", id); !errors.Is(err, errDeploymentNotFound) {
+		t.Fatalf("other tenant: err = %v, want %v", err, errDeploymentNotFound)
+	}
+}
+
+func TestGetDeploymentMergesLiveStatus(t *testing.T) {
+	dm := newTestManager()
+	ctx := context.Background()
+	id := deploy(t, dm, "demo:v1")
+	deployments := dm.clientset.AppsV1().Deployments(dm.tenantNamespace(testTenant))
+
+	got, _ := dm.GetDeployment(ctx, testTenant, id)
+	if got.Status != "pending" || got.Replicas != 1 || got.ReadyReplicas != 0 {
+		t.Fatalf("before pods are ready: %s %d/%d", got.Status, got.ReadyReplicas, got.Replicas)
+	}
+
+	// The cluster was scaled outside the manager and has pods ready
+	live, _ := deployments.Get(ctx, id, metav1.GetOptions{})
+	live.Spec.Replicas = int32Ptr(3)
+	live.Status.ReadyReplicas = 2
+	deployments.Update(ctx, live, metav1.UpdateOptions{})
+
+	got, _ = dm.GetDeployment(ctx, testTenant, id)
+	if got.Status != "running" || got.Replicas != 3 || got.ReadyReplicas != 2 {
+		t.Fatalf("running: %s %d/%d", got.Status, got.ReadyReplicas, got.Replicas)
+	}
+	if got.Cost == nil || got.Name != "demo" {
+		t.Fatalf("stored fields lost in merge: %+v", got)
+	}
+
+	// Live status isn't written back to the store
+	stored, _ := dm.store.Get(ctx, id)
+	if stored.Deployment.Status != "deploying" || stored.Deployment.ReadyReplicas != 0 {
+		t.Fatalf("stored deployment = %+v", stored.Deployment)
+	}
+
+	deployments.Delete(ctx, id, metav1.DeleteOptions{})
+	got, err := dm.GetDeployment(ctx, testTenant, id)
+	if err != nil || got.Status != "unknown" || got.ReadyReplicas != 0 {
+		t.Fatalf("without a live deployment: %+v, %v", got, err)
+	}
+}
+
+func TestNewDeploymentStoreFromEnv(t *testing.T) {
+	t.Setenv("DEPLOYMENT_STORE", "")
+	if store, err := NewDeploymentStoreFromEnv(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := store.(*MemoryDeploymentStore); !ok {
+		t.Fatalf("default store is %T", store)
+	}
+
+	mr := miniredis.RunT(t)
+	t.Setenv("DEPLOYMENT_STORE", "redis")
+	t.Setenv("REDIS_URL", "redis://"+mr.Addr())
+	if store, err := NewDeploymentStoreFromEnv(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := store.(*RedisDeploymentStore); !ok {
+		t.Fatalf("redis store is %T", store)
+	}
+
+	t.Setenv("REDIS_URL", "")
+	if _, err := NewDeploymentStoreFromEnv(); err == nil {
+		t.Fatal("redis store without REDIS_URL accepted")
+	}
+	t.Setenv("DEPLOYMENT_STORE", "etcd")
+	if _, err := NewDeploymentStoreFromEnv(); err == nil {
+		t.Fatal("unknown store accepted")
+	}
+}
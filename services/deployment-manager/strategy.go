@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// Deployment strategies. A canary deployment rolls out image and
+// environment changes to a second Deployment that receives a share of the
+// traffic until it is promoted.
+const (
+	StrategyRecreate = "recreate"
+	StrategyRolling  = "rolling"
+	StrategyCanary   = "canary"
+
+	defaultCanaryWeight = 10
+
+	canaryAnnotation       = "nginx.ingress.kubernetes.io/canary"
+	canaryWeightAnnotation = "nginx.ingress.kubernetes.io/canary-weight"
+)
+
+var (
+	errInvalidStrategy  = errors.New("invalid deployment strategy")
+	errNotCanary        = errors.New("deployment does not use the canary strategy")
+	errNoCanary         = errors.New("deployment has no canary")
+	errCanaryInProgress = errors.New("deployment has a canary in progress")
+)
+
+// CanaryStatus describes the version a canary deployment is running
+type CanaryStatus struct {
+	Image       string            `json:"image"`
+	Environment map[string]string `json:"environment,omitempty"`
+	Weight      int               `json:"weight"`
+	StartedAt   time.Time         `json:"started_at"`
+}
+
+// normalizeStrategy defaults the strategy to rolling and the canary weight
+// to defaultCanaryWeight, and checks both
+func (req *DeploymentRequest) normalizeStrategy() error {
+	switch req.Strategy {
+	case "":
+		req.Strategy = StrategyRolling
+	case StrategyRecreate, StrategyRolling, StrategyCanary:
+	default:
+		return fmt.Errorf("%w %q: must be recreate, rolling or canary", errInvalidStrategy, req.Strategy)
+	}
+
+	if req.Strategy != StrategyCanary {
+		req.CanaryWeight = 0
+		return nil
+	}
+	if req.CanaryWeight == 0 {
+		req.CanaryWeight = defaultCanaryWeight
+	}
+	if req.CanaryWeight < 1 || req.CanaryWeight > 99 {
+		return fmt.Errorf("%w: canary_weight must be between 1 and 99", errInvalidStrategy)
+	}
+	return nil
+}
+
+// deploymentStrategy is the Kubernetes rollout strategy for a strategy.
+// Canary deployments roll their primary like rolling ones.
+func deploymentStrategy(strategy string) appsv1.DeploymentStrategy {
+	if strategy == StrategyRecreate {
+		return appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	}
+	return appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType}
+}
+
+func canaryName(id string) string {
+	return id + "-canary"
+}
+
+// UsesCanary reports whether one of the tenant's deployments uses the
+// canary strategy
+func (dm *DeploymentManager) UsesCanary(ctx context.Context, tenant, id string) bool {
+	stored, err := dm.tenantDeployment(ctx, tenant, id)
+	return err == nil && stored.Deployment.Strategy == StrategyCanary
+}
+
+// StartCanary deploys the updated image and environment alongside the
+// current version and routes the deployment's canary weight of traffic to it
+func (dm *DeploymentManager) StartCanary(ctx context.Context, tenant, id string, req UpdateDeploymentRequest) (*CanaryStatus, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	stored, err := dm.liveDeployment(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	dep := &stored.Deployment
+	if dep.Strategy != StrategyCanary {
+		return nil, errNotCanary
+	}
+	if dep.Canary != nil {
+		return nil, errCanaryInProgress
+	}
+
+	current := stored.current()
+	canary := &CanaryStatus{
+		Image:       current.Image,
+		Environment: current.Environment,
+		Weight:      dep.CanaryWeight,
+		StartedAt:   time.Now(),
+	}
+	if req.Image != "" {
+		canary.Image = req.Image
+	}
+	if req.Environment != nil {
+		canary.Environment = req.Environment
+	}
+
+	if err := dm.createCanary(ctx, dep, canary); err != nil {
+		// Don't leave a canary taking traffic that isn't tracked
+		dm.deleteCanary(ctx, dep.Namespace, id)
+		return nil, err
+	}
+
+	dep.Canary = canary
+	dm.refreshCost(stored)
+	if err := dm.store.Put(ctx, stored); err != nil {
+		return nil, err
+	}
+	return canary, nil
+}
+
+// createCanary creates the canary's Deployment and Service from the
+// primary's, and an ingress on the same host carrying the canary weight
+func (dm *DeploymentManager) createCanary(ctx context.Context, dep *DeploymentResponse, canary *CanaryStatus) error {
+	name := canaryName(dep.ID)
+
+	primary, err := dm.clientset.AppsV1().Deployments(dep.Namespace).Get(ctx, dep.ID, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	if len(primary.Spec.Template.Spec.Containers) == 0 {
+		return fmt.Errorf("deployment %s has no containers", dep.ID)
+	}
+
+	labels := make(map[string]string, len(primary.Labels)+1)
+	for k, v := range primary.Labels {
+		labels[k] = v
+	}
+	labels["app"] = name
+	labels["track"] = "canary"
+
+	template := primary.Spec.Template.DeepCopy()
+	template.Labels = labels
+	container := &template.Spec.Containers[0]
+	container.Image = canary.Image
+	container.Env = containerEnv(container.Env, canary.Environment)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   dep.Namespace,
+			Labels:      labels,
+			Annotations: primary.Annotations,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(1),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Strategy: deploymentStrategy(StrategyRolling),
+			Template: *template,
+		},
+	}
+	if _, err := dm.clientset.AppsV1().Deployments(dep.Namespace).Create(ctx, deployment, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create canary deployment: %w", err)
+	}
+
+	primaryService, err := dm.clientset.CoreV1().Services(dep.Namespace).Get(ctx, dep.ID, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get service: %w", err)
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: dep.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports:    primaryService.Spec.Ports,
+			Type:     corev1.ServiceTypeClusterIP,
+		},
+	}
+	if _, err := dm.clientset.CoreV1().Services(dep.Namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create canary service: %w", err)
+	}
+
+	primaryIngress, err := dm.clientset.NetworkingV1().Ingresses(dep.Namespace).Get(ctx, dep.ID, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get ingress: %w", err)
+	}
+	annotations := make(map[string]string, len(primaryIngress.Annotations)+2)
+	for k, v := range primaryIngress.Annotations {
+		annotations[k] = v
+	}
+	annotations[canaryAnnotation] = "true"
+	annotations[canaryWeightAnnotation] = strconv.Itoa(canary.Weight)
+
+	spec := *primaryIngress.Spec.DeepCopy()
+	for _, rule := range spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for i := range rule.HTTP.Paths {
+			rule.HTTP.Paths[i].Backend.Service = &networkingv1.IngressServiceBackend{
+				Name: name,
+				Port: networkingv1.ServiceBackendPort{Number: 80},
+			}
+		}
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   dep.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: spec,
+	}
+	if _, err := dm.clientset.NetworkingV1().Ingresses(dep.Namespace).Create(ctx, ingress, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create canary ingress: %w", err)
+	}
+	return nil
+}
+
+// PromoteCanary sends all traffic to the canary, rolls the primary to the
+// canary's version, recorded as a new revision, and removes the canary
+func (dm *DeploymentManager) PromoteCanary(ctx context.Context, tenant, id string) (*Revision, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	stored, err := dm.liveDeployment(ctx, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	dep := &stored.Deployment
+	if dep.Canary == nil {
+		return nil, errNoCanary
+	}
+
+	if err := dm.setCanaryWeight(ctx, dep, 100); err != nil {
+		return nil, err
+	}
+
+	next := stored.current()
+	next.RollbackOf = 0
+	next.Image = dep.Canary.Image
+	next.Environment = dep.Canary.Environment
+	rev, err := dm.applyRevision(ctx, stored, next)
+	if err != nil {
+		return nil, err
+	}
+
+	dm.deleteCanary(ctx, dep.Namespace, id)
+	dep.Canary = nil
+	dm.refreshCost(stored)
+	return rev, dm.store.Put(ctx, stored)
+}
+
+// AbortCanary removes the canary, returning all traffic to the primary
+func (dm *DeploymentManager) AbortCanary(ctx context.Context, tenant, id string) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	stored, err := dm.liveDeployment(ctx, tenant, id)
+	if err != nil {
+		return err
+	}
+	dep := &stored.Deployment
+	if dep.Canary == nil {
+		return errNoCanary
+	}
+
+	dm.deleteCanary(ctx, dep.Namespace, id)
+	dep.Canary = nil
+	dm.refreshCost(stored)
+	return dm.store.Put(ctx, stored)
+}
+
+func (dm *DeploymentManager) setCanaryWeight(ctx context.Context, dep *DeploymentResponse, weight int) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ingress, err := dm.clientset.NetworkingV1().Ingresses(dep.Namespace).Get(ctx, canaryName(dep.ID), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if ingress.Annotations == nil {
+			ingress.Annotations = make(map[string]string)
+		}
+		ingress.Annotations[canaryWeightAnnotation] = strconv.Itoa(weight)
+
+		_, err = dm.clientset.NetworkingV1().Ingresses(dep.Namespace).Update(ctx, ingress, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update canary weight: %w", err)
+	}
+	return nil
+}
+
+// deleteCanary removes whatever canary resources exist for a deployment,
+// the ingress first so no traffic reaches a canary being torn down
+func (dm *DeploymentManager) deleteCanary(ctx context.Context, namespace, id string) {
+	name := canaryName(id)
+	deletePolicy := metav1.DeletePropagationForeground
+	deleteOptions := metav1.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	}
+
+	err := dm.clientset.NetworkingV1().Ingresses(namespace).Delete(ctx, name, deleteOptions)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Failed to delete canary ingress: %v", err)
+	}
+	err = dm.clientset.CoreV1().Services(namespace).Delete(ctx, name, deleteOptions)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Failed to delete canary service: %v", err)
+	}
+	err = dm.clientset.AppsV1().Deployments(namespace).Delete(ctx, name, deleteOptions)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Failed to delete canary deployment: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// deployCanary deploys demo:v1 with the canary strategy and starts a canary
+// running demo:v2
+func deployCanary(t *testing.T, r http.Handler, weight int) DeploymentResponse {
+	t.Helper()
+	w := call(t, r, testTenant, http.MethodPost, "/api/v1/deploy", DeploymentRequest{
+		WorkflowID:   "wf-1",
+		CapsuleID:    "capsule-1",
+		Name:         "demo",
+		Image:        "demo:v1",
+		Strategy:     StrategyCanary,
+		CanaryWeight: weight,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("deploy: status %d: %s", w.Code, w.Body)
+	}
+	var dep DeploymentResponse
+	json.Unmarshal(w.Body.Bytes(), &dep)
+
+	w = call(t, r, testTenant, http.MethodPut, "/api/v1/deployments/"+dep.ID, UpdateDeploymentRequest{Image: "demo:v2"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("start canary: status %d: %s", w.Code, w.Body)
+	}
+	return dep
+}
+
+func TestCanaryCreatesSecondaryDeployment(t *testing.T) {
+	dm := newTestManager()
+	dep := deployCanary(t, newRouter(dm), 25)
+	ctx := context.Background()
+
+	canary, err := dm.clientset.AppsV1().Deployments(dep.Namespace).Get(ctx, canaryName(dep.ID), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("canary deployment: %v", err)
+	}
+	if image := canary.Spec.Template.Spec.Containers[0].Image; image != "demo:v2" {
+		t.Fatalf("canary runs %s, want demo:v2", image)
+	}
+	if image, _, _ := liveSpec(t, dm, dep.ID); image != "demo:v1" {
+		t.Fatalf("primary runs %s, want demo:v1 until promotion", image)
+	}
+
+	primaryIngress, _ := dm.clientset.NetworkingV1().Ingresses(dep.Namespace).Get(ctx, dep.ID, metav1.GetOptions{})
+	ingress, err := dm.clientset.NetworkingV1().Ingresses(dep.Namespace).Get(ctx, canaryName(dep.ID), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("canary ingress: %v", err)
+	}
+	if ingress.Annotations[canaryAnnotation] != "true" || ingress.Annotations[canaryWeightAnnotation] != "25" {
+		t.Fatalf("canary ingress annotations = %v, want canary with weight 25", ingress.Annotations)
+	}
+	if ingress.Spec.Rules[0].Host != primaryIngress.Spec.Rules[0].Host {
+		t.Fatalf("canary host %s, want the primary's %s", ingress.Spec.Rules[0].Host, primaryIngress.Spec.Rules[0].Host)
+	}
+	if backend := ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name; backend != canaryName(dep.ID) {
+		t.Fatalf("canary ingress routes to %s", backend)
+	}
+	if _, err := dm.clientset.CoreV1().Services(dep.Namespace).Get(ctx, canaryName(dep.ID), metav1.GetOptions{}); err != nil {
+		t.Fatalf("canary service: %v", err)
+	}
+}
+
+func TestPromoteCanaryShiftsAllTraffic(t *testing.T) {
+	dm := newTestManager()
+	r := newRouter(dm)
+	dep := deployCanary(t, r, 0)
+	ctx := context.Background()
+
+	ingress, _ := dm.clientset.NetworkingV1().Ingresses(dep.Namespace).Get(ctx, canaryName(dep.ID), metav1.GetOptions{})
+	if weight := ingress.Annotations[canaryWeightAnnotation]; weight != "10" {
+		t.Fatalf("default canary weight = %s, want 10", weight)
+	}
+
+	w := call(t, r, testTenant, http.MethodPost, "/api/v1/deployments/"+dep.ID+"/promote", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("promote: status %d: %s", w.Code, w.Body)
+	}
+
+	// The canary took all traffic before the primary was rolled
+	var shifted bool
+	for _, action := range dm.clientset.(*fake.Clientset).Actions() {
+		update, ok := action.(k8stesting.UpdateAction)
+		if !ok || action.GetResource().Resource != "ingresses" {
+			continue
+		}
+		if obj := update.GetObject().(*networkingv1.Ingress); obj.Name == canaryName(dep.ID) && obj.Annotations[canaryWeightAnnotation] == "100" {
+			shifted = true
+		}
+	}
+	if !shifted {
+		t.Fatal("promotion did not set the canary weight to 100")
+	}
+
+	if image, _, _ := liveSpec(t, dm, dep.ID); image != "demo:v2" {
+		t.Fatalf("primary runs %s after promotion, want demo:v2", image)
+	}
+	if _, err := dm.clientset.AppsV1().Deployments(dep.Namespace).Get(ctx, canaryName(dep.ID), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("canary deployment still exists: %v", err)
+	}
+	if _, err := dm.clientset.NetworkingV1().Ingresses(dep.Namespace).Get(ctx, canaryName(dep.ID), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("canary ingress still exists: %v", err)
+	}
+
+	revisions, _ := dm.ListRevisions(context.Background(), testTenant, dep.ID)
+	if len(revisions) != 2 || revisions[1].Image != "demo:v2" {
+		t.Fatalf("revisions = %+v, want the promotion recorded", revisions)
+	}
+	if got, _ := dm.GetDeployment(ctx, testTenant, dep.ID); got.Canary != nil {
+		t.Fatalf("canary still reported: %+v", got.Canary)
+	}
+}
+
+func TestCanaryConflicts(t *testing.T) {
+	dm := newTestManager()
+	r := newRouter(dm)
+	dep := deployCanary(t, r, 50)
+	path := "/api/v1/deployments/" + dep.ID
+	replicas := int32(3)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"second canary", http.MethodPut, path, UpdateDeploymentRequest{Image: "demo:v3"}},
+		{"scale", http.MethodPut, path, UpdateDeploymentRequest{Replicas: &replicas}},
+		{"rollback", http.MethodPost, path + "/rollback", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := call(t, r, testTenant, tt.method, tt.path, tt.body); w.Code != http.StatusConflict {
+				t.Fatalf("status %d, want 409: %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	// Aborting returns all traffic to the primary
+	if w := call(t, r, testTenant, http.MethodDelete, path+"/canary", nil); w.Code != http.StatusOK {
+		t.Fatalf("abort: status %d: %s", w.Code, w.Body)
+	}
+	if _, err := dm.clientset.NetworkingV1().Ingresses(dep.Namespace).Get(context.Background(), canaryName(dep.ID), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("canary ingress still exists: %v", err)
+	}
+	if w := call(t, r, testTenant, http.MethodPost, path+"/promote", nil); w.Code != http.StatusConflict {
+		t.Fatalf("promote without canary: status %d, want 409", w.Code)
+	}
+}
+
+func TestDeploymentStrategies(t *testing.T) {
+	tests := []struct {
+		strategy   string
+		weight     int
+		wantStatus int
+		wantType   appsv1.DeploymentStrategyType
+	}{
+		{"", 0, http.StatusOK, appsv1.RollingUpdateDeploymentStrategyType},
+		{StrategyRolling, 0, http.StatusOK, appsv1.RollingUpdateDeploymentStrategyType},
+		{StrategyRecreate, 0, http.StatusOK, appsv1.RecreateDeploymentStrategyType},
+		{StrategyCanary, 30, http.StatusOK, appsv1.RollingUpdateDeploymentStrategyType},
+		{StrategyCanary, 100, http.StatusBadRequest, ""},
+		{"blue-green", 0, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			dm := newTestManager()
+			w := call(t, newRouter(dm), testTenant, http.MethodPost, "/api/v1/deploy", DeploymentRequest{
+				WorkflowID:   "wf-1",
+				CapsuleID:    "capsule-1",
+				Name:         "demo",
+				Image:        "demo:v1",
+				Strategy:     tt.strategy,
+				CanaryWeight: tt.weight,
+			})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var dep DeploymentResponse
+			json.Unmarshal(w.Body.Bytes(), &dep)
+			deployment, err := dm.clientset.AppsV1().Deployments(dep.Namespace).Get(context.Background(), dep.ID, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deployment.Spec.Strategy.Type != tt.wantType {
+				t.Fatalf("strategy type = %s, want %s", deployment.Spec.Strategy.Type, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestUpdateWithoutCanaryStrategy(t *testing.T) {
+	dm := newTestManager()
+	id := deploy(t, dm, "demo:v1")
+
+	if _, err := dm.StartCanary(context.Background(), testTenant, id, UpdateDeploymentRequest{Image: "demo:v2"}); err != errNotCanary {
+		t.Fatalf("StartCanary err = %v, want %v", err, errNotCanary)
+	}
+	// A rolling deployment updates in place
+	w := call(t, newRouter(dm), testTenant, http.MethodPut, "/api/v1/deployments/"+id, UpdateDeploymentRequest{Image: "demo:v2"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if image, _, _ := liveSpec(t, dm, id); image != "demo:v2" {
+		t.Fatalf("image = %s, want demo:v2", image)
+	}
+}
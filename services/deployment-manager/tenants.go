@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TenantHeader carries the tenant ID. It is set by the gateway after
+// authenticating the caller, so it is trusted as-is.
+const TenantHeader = "X-Tenant-ID"
+
+const (
+	tenantLabel      = "quantumlayer.io/tenant"
+	tenantContextKey = "tenant_id"
+
+	tenantQuotaName  = "tenant-quota"
+	tenantPolicyName = "tenant-isolation"
+)
+
+// Tenant IDs must be valid as part of a namespace name
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// TenantQuota is the resource quota applied to every tenant namespace,
+// configured with TENANT_QUOTA_CPU, TENANT_QUOTA_MEMORY and TENANT_QUOTA_PODS
+type TenantQuota struct {
+	CPU    string
+	Memory string
+	Pods   string
+}
+
+func tenantQuotaFromEnv() TenantQuota {
+	quota := TenantQuota{CPU: "4", Memory: "8Gi", Pods: "20"}
+	if v := os.Getenv("TENANT_QUOTA_CPU"); v != "" {
+		quota.CPU = v
+	}
+	if v := os.Getenv("TENANT_QUOTA_MEMORY"); v != "" {
+		quota.Memory = v
+	}
+	if v := os.Getenv("TENANT_QUOTA_PODS"); v != "" {
+		quota.Pods = v
+	}
+	return quota
+}
+
+// Validate checks that every quantity parses
+func (q TenantQuota) Validate() error {
+	for name, value := range map[string]string{"cpu": q.CPU, "memory": q.Memory, "pods": q.Pods} {
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return fmt.Errorf("invalid tenant %s quota %q: %w", name, value, err)
+		}
+	}
+	return nil
+}
+
+// tenantMiddleware requires a valid tenant ID on every request and stores
+// it for the handlers
+func tenantMiddleware(dm *DeploymentManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := c.GetHeader(TenantHeader)
+		if tenant == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": TenantHeader + " header is required"})
+			return
+		}
+		if !tenantIDPattern.MatchString(tenant) || len(dm.tenantNamespace(tenant)) > 63 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid tenant ID"})
+			return
+		}
+		c.Set(tenantContextKey, tenant)
+		c.Next()
+	}
+}
+
+func tenantID(c *gin.Context) string {
+	return c.GetString(tenantContextKey)
+}
+
+// tenantNamespace is the namespace holding a tenant's deployments
+func (dm *DeploymentManager) tenantNamespace(tenant string) string {
+	return dm.namespace + "-" + tenant
+}
+
+// ensureTenantNamespace creates the tenant's namespace with its quota and
+// network policy. Each is created only if missing, so a namespace left
+// half set up by an earlier failure is completed.
+func (dm *DeploymentManager) ensureTenantNamespace(ctx context.Context, tenant string) (string, error) {
+	namespace := dm.tenantNamespace(tenant)
+	labels := map[string]string{
+		tenantLabel:  tenant,
+		"managed-by": "deployment-manager",
+	}
+
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   namespace,
+			Labels: labels,
+		},
+	}
+	_, err := dm.clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("failed to create namespace: %w", err)
+	}
+
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tenantQuotaName,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ResourceQuotaSpec{
+			Hard: corev1.ResourceList{
+				corev1.ResourceLimitsCPU:    resource.MustParse(dm.quota.CPU),
+				corev1.ResourceLimitsMemory: resource.MustParse(dm.quota.Memory),
+				corev1.ResourcePods:         resource.MustParse(dm.quota.Pods),
+			},
+		},
+	}
+	_, err = dm.clientset.CoreV1().ResourceQuotas(namespace).Create(ctx, quota, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("failed to create resource quota: %w", err)
+	}
+
+	// Only pods in the same namespace and the ingress controller may
+	// connect to the tenant's pods
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tenantPolicyName,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						{PodSelector: &metav1.LabelSelector{}},
+						{NamespaceSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{"kubernetes.io/metadata.name": dm.ingressNamespace},
+						}},
+					},
+				},
+			},
+		},
+	}
+	_, err = dm.clientset.NetworkingV1().NetworkPolicies(namespace).Create(ctx, policy, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("failed to create network policy: %w", err)
+	}
+
+	return namespace, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// call sends a request as tenant through the router
+func call(t *testing.T, r http.Handler, tenant, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func deployAs(t *testing.T, r http.Handler, tenant string) DeploymentResponse {
+	t.Helper()
+	w := call(t, r, tenant, http.MethodPost, "/api/v1/deploy", DeploymentRequest{
+		WorkflowID: "wf-" + tenant,
+		CapsuleID:  "capsule-" + tenant,
+		Name:       tenant + "-app",
+		Image:      tenant + "/app:v1",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("deploy as %s: status %d: %s", tenant, w.Code, w.Body)
+	}
+	var resp DeploymentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode deploy response: %v", err)
+	}
+	return resp
+}
+
+func TestTenantsGetSeparateNamespaces(t *testing.T) {
+	dm := newTestManager()
+	r := newRouter(dm)
+	ctx := context.Background()
+
+	for _, tenant := range []string{"acme", "globex"} {
+		dep := deployAs(t, r, tenant)
+		namespace := "quantumlayer-apps-" + tenant
+		if dep.Namespace != namespace || dep.TenantID != tenant {
+			t.Fatalf("%s deployment in %s for %s, want %s", tenant, dep.Namespace, dep.TenantID, namespace)
+		}
+
+		ns, err := dm.clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("namespace %s: %v", namespace, err)
+		}
+		if ns.Labels[tenantLabel] != tenant {
+			t.Fatalf("namespace labels = %v", ns.Labels)
+		}
+
+		quota, err := dm.clientset.CoreV1().ResourceQuotas(namespace).Get(ctx, tenantQuotaName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("quota in %s: %v", namespace, err)
+		}
+		hard := quota.Spec.Hard
+		if cpu, mem, pods := hard[corev1.ResourceLimitsCPU], hard[corev1.ResourceLimitsMemory], hard[corev1.ResourcePods]; cpu.String() != "2" || mem.String() != "4Gi" || pods.String() != "10" {
+			t.Fatalf("quota = %v", hard)
+		}
+
+		policy, err := dm.clientset.NetworkingV1().NetworkPolicies(namespace).Get(ctx, tenantPolicyName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("network policy in %s: %v", namespace, err)
+		}
+		from := policy.Spec.Ingress[0].From
+		if len(from) != 2 || from[1].NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"] != "ingress-nginx" {
+			t.Fatalf("policy admits %+v, want the namespace and the ingress controller", from)
+		}
+
+		if _, err := dm.clientset.AppsV1().Deployments(namespace).Get(ctx, dep.ID, metav1.GetOptions{}); err != nil {
+			t.Fatalf("deployment %s not in %s: %v", dep.ID, namespace, err)
+		}
+	}
+}
+
+func TestTenantsCannotSeeEachOthersDeployments(t *testing.T) {
+	dm := newTestManager()
+	r := newRouter(dm)
+	acme := deployAs(t, r, "acme")
+	globex := deployAs(t, r, "globex")
+
+	// Listing is scoped to the caller
+	for tenant, want := range map[string]string{"acme": acme.ID, "globex": globex.ID} {
+		w := call(t, r, tenant, http.MethodGet, "/api/v1/deployments", nil)
+		var resp struct {
+			Deployments []DeploymentResponse `json:"deployments"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if len(resp.Deployments) != 1 || resp.Deployments[0].ID != want {
+			t.Fatalf("%s lists %+v, want only %s", tenant, resp.Deployments, want)
+		}
+	}
+
+	// Every per-deployment route treats another tenant's deployment as missing
+	path := "/api/v1/deployments/" + acme.ID
+	for _, req := range []struct {
+		method, path string
+		body         interface{}
+	}{
+		{http.MethodGet, path, nil},
+		{http.MethodPut, path, UpdateDeploymentRequest{Image: "evil:latest"}},
+		{http.MethodGet, path + "/revisions", nil},
+		{http.MethodPost, path + "/rollback", RollbackRequest{Revision: 1}},
+		{http.MethodDelete, path, nil},
+	} {
+		if w := call(t, r, "globex", req.method, req.path, req.body); w.Code != http.StatusNotFound {
+			t.Fatalf("globex %s %s: status %d, want 404", req.method, req.path, w.Code)
+		}
+	}
+
+	deployment, err := dm.clientset.AppsV1().Deployments(acme.Namespace).Get(context.Background(), acme.ID, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("acme's deployment was deleted by globex: %v", err)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "acme/app:v1" {
+		t.Fatalf("acme's image = %s, changed by globex", image)
+	}
+
+	// The owner can still delete it
+	if w := call(t, r, "acme", http.MethodDelete, path, nil); w.Code != http.StatusOK {
+		t.Fatalf("acme delete: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	r := newRouter(newTestManager())
+
+	tests := []struct {
+		name       string
+		tenant     string
+		wantStatus int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"uppercase", "Acme", http.StatusBadRequest},
+		{"underscore", "acme_corp", http.StatusBadRequest},
+		{"leading hyphen", "-acme", http.StatusBadRequest},
+		{"namespace too long", strings.Repeat("a", 50), http.StatusBadRequest},
+		{"valid", "acme-corp", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := call(t, r, tt.tenant, http.MethodGet, "/api/v1/deployments", nil); w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestEnsureTenantNamespaceCompletesSetup(t *testing.T) {
+	dm := newTestManager()
+	ctx := context.Background()
+
+	// A namespace left without its quota and policy
+	dm.clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "quantumlayer-apps-acme"},
+	}, metav1.CreateOptions{})
+
+	for i := 0; i < 2; i++ {
+		if _, err := dm.ensureTenantNamespace(ctx, "acme"); err != nil {
+			t.Fatalf("ensureTenantNamespace call %d: %v", i+1, err)
+		}
+	}
+	if _, err := dm.clientset.CoreV1().ResourceQuotas("quantumlayer-apps-acme").Get(ctx, tenantQuotaName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("quota: %v", err)
+	}
+	if _, err := dm.clientset.NetworkingV1().NetworkPolicies("quantumlayer-apps-acme").Get(ctx, tenantPolicyName, metav1.GetOptions{}); err != nil {
+		t.Fatalf("network policy: %v", err)
+	}
+}
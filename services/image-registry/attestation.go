@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// Signature states summarized by listImages
+const (
+	SignatureVerified   = "signed_verified"
+	SignatureUnverified = "signed_unverified"
+	SignatureUnsigned   = "unsigned"
+)
+
+const (
+	InTotoStatementType = "https://in-toto.io/Statement/v1"
+	// GoldenImagePredicateType identifies the registry's attestation predicate
+	GoldenImagePredicateType = "https://quantumlayer.dev/attestations/golden-image/v1"
+)
+
+// InTotoStatement is an in-toto attestation statement, the format admission
+// policies such as Kyverno and the sigstore policy-controller consume
+type InTotoStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []InTotoSubject      `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     GoldenImagePredicate `json:"predicate"`
+}
+
+// InTotoSubject is the artifact a statement is about
+type InTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// GoldenImagePredicate is what the registry attests about an image
+type GoldenImagePredicate struct {
+	ImageID         string         `json:"image_id"`
+	Name            string         `json:"name"`
+	Version         string         `json:"version"`
+	Environment     string         `json:"environment"`
+	Hardening       string         `json:"hardening,omitempty"`
+	Compliance      []string       `json:"compliance,omitempty"`
+	SeveritySummary map[string]int `json:"severity_summary,omitempty"`
+	LastScanned     *time.Time     `json:"last_scanned,omitempty"`
+	Signature       Attestation    `json:"signature"`
+}
+
+// recordVerification stores the outcome of verifying the attestation's
+// signature at now
+func (a *Attestation) recordVerification(err error, now time.Time) {
+	a.CheckedAt = now
+	if err != nil {
+		a.Verified = false
+		a.VerifyError = err.Error()
+		return
+	}
+	a.Verified = true
+	a.VerifiedAt = now
+	a.VerifyError = ""
+}
+
+// signatureStatus classifies an image's signature; callers hold ir.mu
+func signatureStatus(image *GoldenImage) string {
+	switch {
+	case image.Attestation == nil:
+		return SignatureUnsigned
+	case image.Attestation.Verified:
+		return SignatureVerified
+	default:
+		return SignatureUnverified
+	}
+}
+
+// summarizeSignatures counts images by signature status
+func (ir *ImageRegistry) summarizeSignatures(images []*GoldenImage) map[string]int {
+	summary := map[string]int{
+		SignatureVerified:   0,
+		SignatureUnverified: 0,
+		SignatureUnsigned:   0,
+	}
+	ir.mu.RLock()
+	defer ir.mu.RUnlock()
+	for _, image := range images {
+		summary[signatureStatus(image)]++
+	}
+	return summary
+}
+
+// verifyImage re-verifies an image's signature with Cosign and records the
+// result, so a revoked key or replaced signature shows up as unverified
+func (ir *ImageRegistry) verifyImage(c *gin.Context) {
+	image := ir.lookupImage(c)
+	if image == nil {
+		return
+	}
+
+	ir.mu.RLock()
+	id, imageRef, digest := image.ID, image.RegistryURL, image.Digest
+	var signature string
+	if image.Attestation != nil {
+		signature = image.Attestation.Signature
+	}
+	ir.mu.RUnlock()
+
+	if signature == "" {
+		apierror.RespondError(c, apierror.Conflict("Image is not signed").WithDetails(gin.H{
+			"id": id,
+		}))
+		return
+	}
+
+	verifyErr := ir.signer.Verify(c.Request.Context(), imageRef, digest, signature)
+	if verifyErr != nil && !errors.Is(verifyErr, ErrSignatureNotVerified) {
+		// Verification didn't run, so the recorded result still stands
+		logging.ForRequest(logger, c).WithError(verifyErr).WithField("image_id", id).Error("Failed to verify image signature")
+		apierror.RespondError(c, apierror.Upstream("Signature verification failed to run").WithDetails(gin.H{
+			"id":    id,
+			"error": verifyErr.Error(),
+		}))
+		return
+	}
+
+	ir.mu.Lock()
+	if image.Attestation == nil || image.Attestation.Signature != signature {
+		ir.mu.Unlock()
+		apierror.RespondError(c, apierror.Conflict("Image was re-signed during verification; retry").WithDetails(gin.H{
+			"id": id,
+		}))
+		return
+	}
+	image.Attestation.recordVerification(verifyErr, time.Now())
+	attestation := *image.Attestation
+	status := signatureStatus(image)
+	ir.mu.Unlock()
+
+	if err := ir.saveImage(image); err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to update image in database after verification")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":               id,
+		"verified":         attestation.Verified,
+		"signature_status": status,
+		"attestation":      attestation,
+	})
+}
+
+// getAttestation returns an image's attestation as an in-toto statement
+func (ir *ImageRegistry) getAttestation(c *gin.Context) {
+	image := ir.lookupImage(c)
+	if image == nil {
+		return
+	}
+
+	ir.mu.RLock()
+	defer ir.mu.RUnlock()
+
+	if image.Attestation == nil {
+		apierror.RespondError(c, apierror.NotFound("Image has no attestation"))
+		return
+	}
+	algorithm, hex, ok := strings.Cut(image.Digest, ":")
+	if !isKnownDigest(image.Digest) || !ok {
+		apierror.RespondError(c, apierror.Conflict("Image digest is not known"))
+		return
+	}
+
+	predicate := GoldenImagePredicate{
+		ImageID:         image.ID,
+		Name:            image.Name,
+		Version:         image.Version,
+		Environment:     image.Environment,
+		Hardening:       image.Hardening,
+		Compliance:      image.Compliance,
+		SeveritySummary: image.SeveritySummary,
+		Signature:       *image.Attestation,
+	}
+	if predicate.Environment == "" {
+		predicate.Environment = EnvDev
+	}
+	if !image.LastScanned.IsZero() {
+		lastScanned := image.LastScanned
+		predicate.LastScanned = &lastScanned
+	}
+
+	c.JSON(http.StatusOK, InTotoStatement{
+		Type: InTotoStatementType,
+		Subject: []InTotoSubject{{
+			Name:   repositoryName(image.RegistryURL),
+			Digest: map[string]string{algorithm: hex},
+		}},
+		PredicateType: GoldenImagePredicateType,
+		Predicate:     predicate,
+	})
+}
+
+// repositoryName strips the scheme and tag from an image reference, leaving
+// the name admission policies match images against
+func repositoryName(imageRef string) string {
+	if i := strings.Index(imageRef, "://"); i >= 0 {
+		imageRef = imageRef[i+3:]
+	}
+	if i := strings.Index(imageRef, "@"); i >= 0 {
+		imageRef = imageRef[:i]
+	}
+	if i := strings.LastIndex(imageRef, ":"); i > strings.LastIndex(imageRef, "/") {
+		imageRef = imageRef[:i]
+	}
+	return imageRef
+}
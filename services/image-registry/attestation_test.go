@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func signedImage(verified bool) *GoldenImage {
+	signedAt := time.Now().Add(-time.Hour)
+	attestation := &Attestation{Signature: "MEUCIQ-sig", SignedBy: "cosign-system", SignedAt: signedAt}
+	if verified {
+		attestation.Verified = true
+		attestation.VerifiedAt = signedAt
+	}
+	return &GoldenImage{
+		ID:          "img-1",
+		Name:        "web",
+		Version:     "1.0.0",
+		RegistryURL: "http://registry.local:5000/web:1.0.0",
+		Digest:      testDigest,
+		Compliance:  []string{"SOC2"},
+		Attestation: attestation,
+	}
+}
+
+func TestVerifyImage(t *testing.T) {
+	tests := []struct {
+		name         string
+		verified     bool // what Cosign answers
+		wasVerified  bool
+		wantVerified bool
+		wantStatus   string
+	}{
+		{"confirms a signature", true, false, true, SignatureVerified},
+		{"revokes a rejected signature", false, true, false, SignatureUnverified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := signedImage(tt.wasVerified)
+			ir := newTestRegistry(image)
+			ir.signer = cosignStub(t, http.StatusOK, "MEUCIQ-sig", tt.verified)
+
+			w := serve(ir.verifyImage, http.MethodPost, "/images/:id/verify", "/images/img-1/verify", nil)
+			assertStatus(t, w, http.StatusOK)
+
+			var resp struct {
+				Verified        bool   `json:"verified"`
+				SignatureStatus string `json:"signature_status"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Verified != tt.wantVerified || resp.SignatureStatus != tt.wantStatus {
+				t.Fatalf("response = %+v, want verified %v (%s)", resp, tt.wantVerified, tt.wantStatus)
+			}
+
+			a := image.Attestation
+			if a.Verified != tt.wantVerified || a.CheckedAt.IsZero() {
+				t.Fatalf("attestation = %+v, want verified %v and a check time", a, tt.wantVerified)
+			}
+			if tt.wantVerified && (a.VerifiedAt.Before(a.CheckedAt) || a.VerifyError != "") {
+				t.Fatalf("attestation = %+v, want verified_at updated and no error", a)
+			}
+			if !tt.wantVerified && a.VerifyError == "" {
+				t.Fatalf("attestation = %+v, want the rejection recorded", a)
+			}
+		})
+	}
+}
+
+func TestVerifyImageCosignUnreachable(t *testing.T) {
+	image := signedImage(true)
+	ir := newTestRegistry(image)
+	ir.signer = &Signer{cosignURL: "http://127.0.0.1:1", httpClient: http.DefaultClient}
+
+	w := serve(ir.verifyImage, http.MethodPost, "/images/:id/verify", "/images/img-1/verify", nil)
+	assertStatus(t, w, http.StatusBadGateway)
+	if !image.Attestation.Verified || !image.Attestation.CheckedAt.IsZero() {
+		t.Fatalf("attestation = %+v, want the earlier result kept when verification can't run", image.Attestation)
+	}
+}
+
+func TestVerifyImageUnsigned(t *testing.T) {
+	ir := newTestRegistry(&GoldenImage{ID: "img-1", Digest: testDigest})
+	ir.signer = cosignStub(t, http.StatusOK, "MEUCIQ-sig", true)
+
+	w := serve(ir.verifyImage, http.MethodPost, "/images/:id/verify", "/images/img-1/verify", nil)
+	assertStatus(t, w, http.StatusConflict)
+}
+
+func TestGetAttestation(t *testing.T) {
+	ir := newTestRegistry(signedImage(true))
+
+	w := serve(ir.getAttestation, http.MethodGet, "/images/:id/attestation", "/images/img-1/attestation", nil)
+	assertStatus(t, w, http.StatusOK)
+
+	var statement InTotoStatement
+	if err := json.Unmarshal(w.Body.Bytes(), &statement); err != nil {
+		t.Fatal(err)
+	}
+	if statement.Type != InTotoStatementType || statement.PredicateType != GoldenImagePredicateType {
+		t.Fatalf("statement types = %q, %q", statement.Type, statement.PredicateType)
+	}
+	if len(statement.Subject) != 1 {
+		t.Fatalf("subject = %+v, want one", statement.Subject)
+	}
+	subject := statement.Subject[0]
+	if subject.Name != "registry.local:5000/web" || "sha256:"+subject.Digest["sha256"] != testDigest {
+		t.Fatalf("subject = %+v", subject)
+	}
+	p := statement.Predicate
+	if p.ImageID != "img-1" || p.Environment != EnvDev || !p.Signature.Verified || p.Signature.Signature != "MEUCIQ-sig" {
+		t.Fatalf("predicate = %+v", p)
+	}
+}
+
+func TestGetAttestationUnsigned(t *testing.T) {
+	ir := newTestRegistry(&GoldenImage{ID: "img-1", Digest: testDigest})
+
+	w := serve(ir.getAttestation, http.MethodGet, "/images/:id/attestation", "/images/img-1/attestation", nil)
+	assertStatus(t, w, http.StatusNotFound)
+}
+
+func TestListImagesSignatureStatus(t *testing.T) {
+	verified, unverified := signedImage(true), signedImage(false)
+	unverified.ID = "img-2"
+	ir := newTestRegistry(verified, unverified, &GoldenImage{ID: "img-3"}, &GoldenImage{ID: "img-4"})
+
+	w := serve(ir.listImages, http.MethodGet, "/images", "/images", nil)
+	assertStatus(t, w, http.StatusOK)
+
+	var resp struct {
+		SignatureStatus map[string]int `json:"signature_status"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	want := map[string]int{SignatureVerified: 1, SignatureUnverified: 1, SignatureUnsigned: 2}
+	for status, count := range want {
+		if resp.SignatureStatus[status] != count {
+			t.Fatalf("signature_status = %v, want %v", resp.SignatureStatus, want)
+		}
+	}
+}
+
+func TestRepositoryName(t *testing.T) {
+	for ref, want := range map[string]string{
+		"http://registry.local:5000/web:1.0.0":   "registry.local:5000/web",
+		"registry.local/team/web:1":              "registry.local/team/web",
+		"registry.local:5000/web":                "registry.local:5000/web",
+		"registry.local/web@sha256:0123456789ab": "registry.local/web",
+	} {
+		if got := repositoryName(ref); got != want {
+			t.Errorf("repositoryName(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultBatchScanWorkers bounds how many images a batch scans at once
+const DefaultBatchScanWorkers = 4
+
+// BatchScanRequest selects images to scan by platform, compliance
+// framework or explicit IDs. Filters combine; at least one is required.
+type BatchScanRequest struct {
+	Platform   string   `json:"platform,omitempty"`
+	Compliance string   `json:"compliance,omitempty"`
+	ImageIDs   []string `json:"image_ids,omitempty"`
+	Workers    int      `json:"workers,omitempty"`
+}
+
+// BatchScanResult is the outcome of scanning one image in a batch
+type BatchScanResult struct {
+	ImageID         string         `json:"image_id"`
+	ImageName       string         `json:"image_name,omitempty"`
+	Status          string         `json:"status"` // complete, failed, skipped
+	Error           string         `json:"error,omitempty"`
+	SeveritySummary map[string]int `json:"severity_summary,omitempty"`
+	Duration        string         `json:"duration,omitempty"`
+}
+
+// BatchScanReport aggregates the results of a batch scan
+type BatchScanReport struct {
+	StartedAt       time.Time         `json:"started_at"`
+	CompletedAt     time.Time         `json:"completed_at"`
+	Total           int               `json:"total"`
+	Succeeded       int               `json:"succeeded"`
+	Failed          int               `json:"failed"`
+	Skipped         int               `json:"skipped"`
+	SeveritySummary map[string]int    `json:"severity_summary"`
+	Results         []BatchScanResult `json:"results"`
+}
+
+// batchScanWorkers returns the worker pool size, honouring a requested size
+// up to BATCH_SCAN_WORKERS
+func batchScanWorkers(requested int) int {
+	limit := DefaultBatchScanWorkers
+	if v := os.Getenv("BATCH_SCAN_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	if requested > 0 && requested < limit {
+		return requested
+	}
+	return limit
+}
+
+// batchScanTargets resolves the request filters to a list of images
+func (ir *ImageRegistry) batchScanTargets(req *BatchScanRequest) ([]*GoldenImage, []BatchScanResult, error) {
+	var missing []BatchScanResult
+
+	var candidates []*GoldenImage
+	if len(req.ImageIDs) > 0 {
+		seen := make(map[string]bool)
+		for _, id := range req.ImageIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			image, err := ir.getImageByID(id)
+			if err != nil {
+				return nil, nil, err
+			}
+			if image == nil {
+				missing = append(missing, BatchScanResult{ImageID: id, Status: ScanFailed, Error: "image not found"})
+				continue
+			}
+			candidates = append(candidates, image)
+		}
+	} else {
+		candidates = ir.cachedImages()
+		if ir.db != nil {
+			var err error
+			switch {
+			case req.Platform != "":
+				candidates, err = ir.db.GetImagesByPlatform(req.Platform)
+			case req.Compliance != "":
+				candidates, err = ir.db.GetImagesByCompliance(req.Compliance)
+			default:
+				candidates, err = ir.db.ListImages()
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	targets := []*GoldenImage{}
+	for _, img := range candidates {
+		if req.Platform != "" && img.Platform != req.Platform {
+			continue
+		}
+		if req.Compliance != "" && !containsString(img.Compliance, req.Compliance) {
+			continue
+		}
+		// Scan the cached copy so results land on the object handlers see
+		image, err := ir.getImageByID(img.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if image != nil {
+			targets = append(targets, image)
+		}
+	}
+
+	return targets, missing, nil
+}
+
+// scanBatch scans every image matching the filter with a bounded worker
+// pool and returns an aggregate report once all scans have finished
+func (ir *ImageRegistry) scanBatch(c *gin.Context) {
+	var req BatchScanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	if req.Platform == "" && req.Compliance == "" && len(req.ImageIDs) == 0 {
+		apierror.RespondError(c, apierror.Validation("platform, compliance or image_ids is required"))
+		return
+	}
+
+	targets, results, err := ir.batchScanTargets(&req)
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to resolve batch scan targets")
+		apierror.RespondError(c, apierror.Internal("Failed to query images"))
+		return
+	}
+
+	report := BatchScanReport{
+		StartedAt:       time.Now(),
+		SeveritySummary: map[string]int{},
+	}
+
+	workers := batchScanWorkers(req.Workers)
+	work := make(chan *GoldenImage)
+	resultsCh := make(chan BatchScanResult, len(targets))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for image := range work {
+				resultsCh <- ir.scanForBatch(image)
+			}
+		}()
+	}
+	for _, image := range targets {
+		work <- image
+	}
+	close(work)
+	wg.Wait()
+	close(resultsCh)
+
+	for result := range resultsCh {
+		results = append(results, result)
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case ScanComplete:
+			report.Succeeded++
+			for severity, count := range result.SeveritySummary {
+				report.SeveritySummary[severity] += count
+			}
+		case "skipped":
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+	}
+	report.Total = len(results)
+	report.Results = results
+	report.CompletedAt = time.Now()
+
+	logging.ForRequest(logger, c).WithFields(logrus.Fields{
+		"succeeded": report.Succeeded,
+		"failed":    report.Failed,
+		"skipped":   report.Skipped,
+	}).Info("Batch scan finished")
+
+	c.JSON(http.StatusOK, report)
+}
+
+// scanForBatch runs a scan of one image synchronously. Images that already
+// have a scan in progress are skipped rather than scanned twice.
+func (ir *ImageRegistry) scanForBatch(image *GoldenImage) BatchScanResult {
+	result := BatchScanResult{
+		ImageID:   image.ID,
+		ImageName: image.Name,
+	}
+
+	job, _, created := ir.scanner.newJob(image.ID)
+	if !created {
+		result.Status = "skipped"
+		result.Error = "scan already in progress as job " + job.ID
+		return result
+	}
+
+	started := time.Now()
+	err := ir.runScan(job, image)
+	result.Duration = time.Since(started).String()
+	if err != nil {
+		result.Status = ScanFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	ir.mu.RLock()
+	result.SeveritySummary = image.SeveritySummary
+	ir.mu.RUnlock()
+	result.Status = ScanComplete
+	return result
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
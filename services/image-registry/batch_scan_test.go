@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trivyStub scans each image slowly enough for scans to overlap, failing
+// references that contain "broken", and records the peak concurrency
+type trivyStub struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	scanned  []string
+}
+
+func (s *trivyStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Image string `json:"image"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.peak {
+		s.peak = s.inFlight
+	}
+	s.scanned = append(s.scanned, req.Image)
+	s.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+
+	if strings.Contains(req.Image, "broken") {
+		http.Error(w, "manifest unknown", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(w, `{"Results":[{"Target":"os","Vulnerabilities":[
+		{"VulnerabilityID":"CVE-2024-1","PkgName":"openssl","Severity":"HIGH"},
+		{"VulnerabilityID":"CVE-2024-2","PkgName":"zlib","Severity":"LOW"}]}]}`)
+}
+
+// batchRegistry returns a registry of docker images scanned by a Trivy stub
+func batchRegistry(t *testing.T, images ...*GoldenImage) (*ImageRegistry, *trivyStub) {
+	t.Helper()
+	stub := &trivyStub{}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	ir := newTestRegistry(images...)
+	ir.scanner.trivyURL = srv.URL
+	return ir, stub
+}
+
+func batchScan(t *testing.T, ir *ImageRegistry, req BatchScanRequest) BatchScanReport {
+	t.Helper()
+	w := serve(ir.scanBatch, http.MethodPost, "/images/scan/batch", "/images/scan/batch", req)
+	assertStatus(t, w, http.StatusOK)
+	var report BatchScanReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode batch report: %v", err)
+	}
+	return report
+}
+
+func dockerImages(n int) []*GoldenImage {
+	images := make([]*GoldenImage, n)
+	for i := range images {
+		images[i] = &GoldenImage{
+			ID:          fmt.Sprintf("img-%d", i),
+			Name:        fmt.Sprintf("web-%d", i),
+			Platform:    "docker",
+			RegistryURL: fmt.Sprintf("registry.local/web-%d:1", i),
+		}
+	}
+	return images
+}
+
+func TestScanBatchConcurrencyLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		workers  int
+		wantPeak int
+	}{
+		{"requested workers", "", 2, 2},
+		{"default limit", "", 0, DefaultBatchScanWorkers},
+		{"request capped by BATCH_SCAN_WORKERS", "3", 10, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BATCH_SCAN_WORKERS", tt.env)
+			t.Setenv("SCAN_CONCURRENCY", "10")
+			ir, stub := batchRegistry(t, dockerImages(8)...)
+
+			report := batchScan(t, ir, BatchScanRequest{Platform: "docker", Workers: tt.workers})
+			if report.Total != 8 || report.Succeeded != 8 {
+				t.Fatalf("report = %d total, %d succeeded; want 8 of 8", report.Total, report.Succeeded)
+			}
+			if stub.peak != tt.wantPeak {
+				t.Fatalf("peak concurrent scans = %d, want %d", stub.peak, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestScanBatchPartialFailures(t *testing.T) {
+	images := dockerImages(3)
+	images = append(images,
+		&GoldenImage{ID: "img-broken", Name: "broken", Platform: "docker", RegistryURL: "registry.local/broken:1"},
+		&GoldenImage{ID: "img-unpushed", Name: "unpushed", Platform: "docker"},
+		&GoldenImage{ID: "img-busy", Name: "busy", Platform: "docker", RegistryURL: "registry.local/busy:1"},
+		&GoldenImage{ID: "img-vm", Name: "vm", Platform: "vmware", RegistryURL: "registry.local/vm:1"},
+	)
+	ir, stub := batchRegistry(t, images...)
+	// A scan of img-busy is already running
+	ir.scanner.newJob("img-busy")
+
+	ids := []string{"img-0", "img-1", "img-2", "img-broken", "img-unpushed", "img-busy", "img-missing", "img-0"}
+	report := batchScan(t, ir, BatchScanRequest{ImageIDs: ids, Platform: "docker"})
+
+	if report.Total != 7 || report.Succeeded != 3 || report.Failed != 3 || report.Skipped != 1 {
+		t.Fatalf("report = %d total, %d succeeded, %d failed, %d skipped; want 7, 3, 3, 1",
+			report.Total, report.Succeeded, report.Failed, report.Skipped)
+	}
+	if report.SeveritySummary["high"] != 3 || report.SeveritySummary["low"] != 3 {
+		t.Fatalf("severity summary = %v, want 3 high and 3 low", report.SeveritySummary)
+	}
+
+	status := make(map[string]BatchScanResult)
+	for _, result := range report.Results {
+		status[result.ImageID] = result
+	}
+	for id, want := range map[string]string{
+		"img-0": ScanComplete, "img-broken": ScanFailed, "img-unpushed": ScanFailed,
+		"img-busy": "skipped", "img-missing": ScanFailed,
+	} {
+		if status[id].Status != want {
+			t.Errorf("%s = %+v, want %s", id, status[id], want)
+		}
+	}
+	if !strings.Contains(status["img-broken"].Error, "status 500") || status["img-missing"].Error != "image not found" {
+		t.Errorf("errors = %q, %q", status["img-broken"].Error, status["img-missing"].Error)
+	}
+
+	// Failures don't stop the rest of the batch, and nothing is scanned twice
+	if len(stub.scanned) != 4 {
+		t.Fatalf("trivy scanned %v, want the 3 good images and the broken one", stub.scanned)
+	}
+	if images[0].SeveritySummary["high"] != 1 || !images[3].LastScanned.IsZero() {
+		t.Fatalf("img-0 summary %v, broken image scanned at %v", images[0].SeveritySummary, images[3].LastScanned)
+	}
+}
+
+func TestScanBatchRequiresFilter(t *testing.T) {
+	ir, _ := batchRegistry(t)
+	w := serve(ir.scanBatch, http.MethodPost, "/images/scan/batch", "/images/scan/batch", BatchScanRequest{})
+	assertStatus(t, w, http.StatusBadRequest)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCallbackURL is the address builders use to report back to this service
+const DefaultCallbackURL = "http://image-registry.quantumlayer.svc.cluster.local:8096"
+
+// Build outcomes reported to POST /images/:id/build-complete
+const (
+	BuildSucceeded = "succeeded"
+	BuildFailed    = "failed"
+)
+
+// BuildCompletion is sent by the Packer builder, or a registry push
+// notification, once an image has been pushed
+type BuildCompletion struct {
+	Status string `json:"status" binding:"required"`
+	Digest string `json:"digest,omitempty"` // manifest digest of the pushed image
+	Size   int64  `json:"size,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+var digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// isKnownDigest reports whether digest is a real image digest. Images built
+// before digests were reported by the builder carry made up values, and
+// images still building have none.
+func isKnownDigest(digest string) bool {
+	return digestPattern.MatchString(digest)
+}
+
+// buildCallbackURL returns the URL builders call when an image is pushed
+func buildCallbackURL(imageID string) string {
+	base := os.Getenv("BUILD_CALLBACK_URL")
+	if base == "" {
+		base = DefaultCallbackURL
+	}
+	return fmt.Sprintf("%s/images/%s/build-complete", strings.TrimRight(base, "/"), imageID)
+}
+
+// completeBuild records the result of an image build and, once the image is
+// in the registry, generates its SBOM
+func (ir *ImageRegistry) completeBuild(c *gin.Context) {
+	image := ir.lookupImage(c)
+	if image == nil {
+		return
+	}
+
+	var req BuildCompletion
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	if req.Status != BuildSucceeded && req.Status != BuildFailed {
+		apierror.RespondError(c, apierror.Validation(fmt.Sprintf("status must be %s or %s", BuildSucceeded, BuildFailed)))
+		return
+	}
+	if req.Digest != "" && !isKnownDigest(req.Digest) {
+		apierror.RespondError(c, apierror.Validation("digest must be sha256:<64 hex characters>"))
+		return
+	}
+
+	ir.mu.Lock()
+	if req.Status == BuildFailed {
+		image.SBOM = map[string]interface{}{"status": "skipped", "error": "build failed: " + req.Error}
+	} else {
+		if req.Digest != "" {
+			image.Digest = req.Digest
+		}
+		if req.Size > 0 {
+			image.Size = req.Size
+		}
+		image.SBOM = map[string]interface{}{"status": "pending"}
+	}
+	snapshot := *image
+	ir.mu.Unlock()
+
+	if ir.db != nil {
+		if err := ir.db.SaveImage(&snapshot); err != nil {
+			logging.ForRequest(logger, c).WithError(err).Error("Failed to update image in database after build")
+		}
+	}
+
+	if req.Status == BuildSucceeded {
+		go ir.generateSBOM(image)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":     snapshot.ID,
+		"status": req.Status,
+		"image":  &snapshot,
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// syftStub fails the first failures requests, then returns one CycloneDX
+// component
+func syftStub(t *testing.T, failures int32) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			http.Error(w, "image not found", http.StatusServiceUnavailable)
+			return
+		}
+		var req struct {
+			Output string `json:"output"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Output == "cyclonedx-json" {
+			w.Write([]byte(`{"components":[{"name":"openssl","version":"3.0.2"}]}`))
+			return
+		}
+		w.Write([]byte(`{"spdxVersion":"SPDX-2.3"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// sbomStatus reads an image's SBOM summary under the registry lock
+func sbomStatus(ir *ImageRegistry, image *GoldenImage) map[string]interface{} {
+	ir.mu.RLock()
+	defer ir.mu.RUnlock()
+	return image.SBOM
+}
+
+// waitForSBOM waits until SBOM generation for image has finished
+func waitForSBOM(t *testing.T, ir *ImageRegistry, image *GoldenImage) map[string]interface{} {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if summary := sbomStatus(ir, image); summary["status"] != "pending" {
+			return summary
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("SBOM generation did not finish")
+	return nil
+}
+
+func TestBuildImageWaitsForBuildBeforeSBOM(t *testing.T) {
+	syft, calls := syftStub(t, 0)
+	ir := newTestRegistry()
+	ir.sboms.syftURL = syft.URL
+
+	w := serve(ir.buildImage, http.MethodPost, "/images/build", "/images/build",
+		BuildRequest{Name: "web", BaseOS: "debian-12", Platform: "docker"})
+	assertStatus(t, w, http.StatusAccepted)
+
+	var resp struct {
+		Image GoldenImage `json:"image"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Image.SBOM["status"] != "waiting_for_build" {
+		t.Fatalf("sbom = %v, want waiting_for_build", resp.Image.SBOM)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(calls); n != 0 {
+		t.Fatalf("syft called %d times before the build finished", n)
+	}
+}
+
+func TestCompleteBuildGeneratesSBOM(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		wantStatus   string
+		wantAttempts int
+		wantDelays   []time.Duration
+	}{
+		{"first attempt", 0, "complete", 1, nil},
+		{"after retries", 2, "complete", 3, []time.Duration{time.Second, 2 * time.Second}},
+		{"retries exhausted", 100, "failed", 3, []time.Duration{time.Second, 2 * time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			syft, _ := syftStub(t, tt.failures)
+			image := &GoldenImage{ID: "img-1", RegistryURL: "registry.local/web:1.0.0", SBOM: map[string]interface{}{"status": "waiting_for_build"}}
+			ir := newTestRegistry(image)
+			ir.sboms.syftURL = syft.URL
+			ir.sboms.retryDelay = time.Second
+
+			var mu sync.Mutex
+			var delays []time.Duration
+			ir.sboms.sleep = func(d time.Duration) {
+				mu.Lock()
+				delays = append(delays, d)
+				mu.Unlock()
+			}
+
+			w := serve(ir.completeBuild, http.MethodPost, "/images/:id/build-complete", "/images/img-1/build-complete",
+				BuildCompletion{Status: BuildSucceeded, Digest: testDigest, Size: 2048})
+			assertStatus(t, w, http.StatusOK)
+
+			// Reading the image while the SBOM is generated must not race
+			for i := 0; i < 5; i++ {
+				assertStatus(t, serve(ir.getImage, http.MethodGet, "/images/:id", "/images/img-1", nil), http.StatusOK)
+			}
+
+			summary := waitForSBOM(t, ir, image)
+			if summary["status"] != tt.wantStatus || summary["attempts"] != tt.wantAttempts {
+				t.Fatalf("sbom = %v, want status %s after %v attempts", summary, tt.wantStatus, tt.wantAttempts)
+			}
+			mu.Lock()
+			if len(delays) != len(tt.wantDelays) || (len(delays) > 0 && delays[len(delays)-1] != tt.wantDelays[len(tt.wantDelays)-1]) {
+				t.Fatalf("retry delays = %v, want %v", delays, tt.wantDelays)
+			}
+			mu.Unlock()
+
+			snapshot := ir.snapshotImage(image)
+			if snapshot.Digest != testDigest || snapshot.Size != 2048 {
+				t.Fatalf("digest %q, size %d; want the reported build", snapshot.Digest, snapshot.Size)
+			}
+			if tt.wantStatus == "complete" && len(ir.sboms.components["img-1"]) != 1 {
+				t.Fatalf("components = %v", ir.sboms.components["img-1"])
+			}
+		})
+	}
+}
+
+func TestCompleteBuildFailed(t *testing.T) {
+	syft, calls := syftStub(t, 0)
+	image := &GoldenImage{ID: "img-1", RegistryURL: "registry.local/web:1.0.0"}
+	ir := newTestRegistry(image)
+	ir.sboms.syftURL = syft.URL
+
+	w := serve(ir.completeBuild, http.MethodPost, "/images/:id/build-complete", "/images/img-1/build-complete",
+		BuildCompletion{Status: BuildFailed, Error: "provisioner exited 1"})
+	assertStatus(t, w, http.StatusOK)
+
+	time.Sleep(50 * time.Millisecond)
+	if summary := sbomStatus(ir, image); summary["status"] != "skipped" {
+		t.Fatalf("sbom = %v, want skipped", summary)
+	}
+	if n := atomic.LoadInt32(calls); n != 0 {
+		t.Fatalf("syft called %d times for a failed build", n)
+	}
+}
+
+func TestCompleteBuildValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body BuildCompletion
+	}{
+		{"unknown status", BuildCompletion{Status: "done"}},
+		{"missing status", BuildCompletion{}},
+		{"bad digest", BuildCompletion{Status: BuildSucceeded, Digest: "md5:abc"}},
+		{"short digest", BuildCompletion{Status: BuildSucceeded, Digest: "sha256:abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ir := newTestRegistry(&GoldenImage{ID: "img-1"})
+			w := serve(ir.completeBuild, http.MethodPost, "/images/:id/build-complete", "/images/img-1/build-complete", tt.body)
+			assertStatus(t, w, http.StatusBadRequest)
+		})
+	}
+}
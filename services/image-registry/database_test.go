@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+// testDB is a Postgres database shared by the database tests. It is nil when
+// neither DATABASE_TEST_URL nor Docker is available, and those tests skip.
+var testDB *Database
+
+func TestMain(m *testing.M) {
+	cleanup, err := startTestDatabase()
+	if err != nil {
+		log.Printf("Postgres unavailable, skipping database tests: %v", err)
+	}
+
+	code := m.Run()
+	if cleanup != nil {
+		cleanup()
+	}
+	os.Exit(code)
+}
+
+// startTestDatabase connects to DATABASE_TEST_URL, or starts a throwaway
+// Postgres container with dockertest
+func startTestDatabase() (func(), error) {
+	if dbURL := os.Getenv("DATABASE_TEST_URL"); dbURL != "" {
+		db, err := openDatabase(dbURL)
+		if err != nil {
+			return nil, err
+		}
+		testDB = db
+		return func() { db.Close() }, nil
+	}
+
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Client.Ping(); err != nil {
+		return nil, err
+	}
+
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "15-alpine",
+		Env: []string{
+			"POSTGRES_USER=postgres",
+			"POSTGRES_PASSWORD=postgres",
+			"POSTGRES_DB=image_registry",
+		},
+	}, func(config *docker.HostConfig) {
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Reap the container even if the tests are killed
+	resource.Expire(300)
+
+	dbURL := fmt.Sprintf("postgres://postgres:postgres@%s/image_registry?sslmode=disable", resource.GetHostPort("5432/tcp"))
+	pool.MaxWait = 60 * time.Second
+	if err := pool.Retry(func() error {
+		db, err := openDatabase(dbURL)
+		if err != nil {
+			return err
+		}
+		testDB = db
+		return nil
+	}); err != nil {
+		pool.Purge(resource)
+		return nil, err
+	}
+
+	return func() {
+		testDB.Close()
+		pool.Purge(resource)
+	}, nil
+}
+
+// database returns the shared test database with every table emptied
+func database(t *testing.T) *Database {
+	t.Helper()
+	if testDB == nil {
+		t.Skip("Postgres not available: set DATABASE_TEST_URL or run Docker")
+	}
+	if err := testDB.initSchema(); err != nil {
+		t.Fatalf("initSchema: %v", err)
+	}
+	for _, table := range []string{"golden_images", "image_sboms", "sbom_components", "image_promotions", "node_reports", "scan_webhooks", "image_patch_status"} {
+		if _, err := testDB.conn.Exec(`TRUNCATE ` + table); err != nil {
+			t.Fatalf("truncate %s: %v", table, err)
+		}
+	}
+	return testDB
+}
+
+func saveImages(t *testing.T, db *Database, images ...*GoldenImage) {
+	t.Helper()
+	for _, image := range images {
+		if err := db.SaveImage(image); err != nil {
+			t.Fatalf("SaveImage(%s): %v", image.ID, err)
+		}
+	}
+}
+
+func imageIDs(images []*GoldenImage) []string {
+	ids := make([]string, 0, len(images))
+	for _, image := range images {
+		ids = append(ids, image.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func assertIDs(t *testing.T, images []*GoldenImage, want ...string) {
+	t.Helper()
+	got := imageIDs(images)
+	sort.Strings(want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got images %v, want %v", got, want)
+	}
+}
+
+func TestDatabaseSaveAndGetImage(t *testing.T) {
+	db := database(t)
+
+	built := time.Now().UTC().Truncate(time.Millisecond)
+	image := &GoldenImage{
+		ID:          "img-1",
+		Name:        "ubuntu-base",
+		Version:     "1.0.0",
+		ParentID:    "img-0",
+		BaseImageID: "base-1",
+		BaseOS:      "ubuntu-22.04",
+		Platform:    "aws",
+		Environment: EnvStaging,
+		Packages:    []string{"nginx", "curl"},
+		Hardening:   "CIS",
+		Compliance:  []string{"SOC2"},
+		RegistryURL: "registry.local/ubuntu-base:1.0.0",
+		Digest:      "sha256:abc",
+		Size:        1024,
+		Vulnerabilities: []Vulnerability{
+			{ID: "CVE-2024-0001", CVE: "CVE-2024-0001", Severity: "high"},
+		},
+		SeveritySummary: map[string]int{"high": 1},
+		Attestation:     &Attestation{Signature: "sig", SignedBy: "cosign", Verified: true},
+		BuildTime:       built,
+		Metadata:        map[string]interface{}{"owner": "platform"},
+	}
+	saveImages(t, db, image)
+
+	got, err := db.GetImage("img-1")
+	if err != nil {
+		t.Fatalf("GetImage: %v", err)
+	}
+	if got == nil {
+		t.Fatal("GetImage returned nil for a saved image")
+	}
+	if got.Name != image.Name || got.ParentID != "img-0" || got.BaseImageID != "base-1" || got.Environment != EnvStaging || got.Size != 1024 {
+		t.Fatalf("GetImage = %+v", got)
+	}
+	if fmt.Sprint(got.Packages) != "[nginx curl]" || fmt.Sprint(got.Compliance) != "[SOC2]" {
+		t.Fatalf("packages %v, compliance %v", got.Packages, got.Compliance)
+	}
+	if len(got.Vulnerabilities) != 1 || got.SeveritySummary["high"] != 1 {
+		t.Fatalf("vulnerabilities %v, summary %v", got.Vulnerabilities, got.SeveritySummary)
+	}
+	if got.Attestation == nil || !got.Attestation.Verified || got.Metadata["owner"] != "platform" {
+		t.Fatalf("attestation %+v, metadata %v", got.Attestation, got.Metadata)
+	}
+	if !got.BuildTime.Equal(built) {
+		t.Fatalf("build time %s, want %s", got.BuildTime, built)
+	}
+
+	// Saving again updates in place
+	image.Environment = EnvProd
+	image.Packages = []string{"nginx"}
+	saveImages(t, db, image)
+	got, err = db.GetImage("img-1")
+	if err != nil {
+		t.Fatalf("GetImage after update: %v", err)
+	}
+	if got.Environment != EnvProd || fmt.Sprint(got.Packages) != "[nginx]" {
+		t.Fatalf("updated image = %+v", got)
+	}
+
+	missing, err := db.GetImage("no-such-image")
+	if err != nil || missing != nil {
+		t.Fatalf("GetImage(missing) = %v, %v; want nil, nil", missing, err)
+	}
+}
+
+func TestDatabaseGetImagesByCompliance(t *testing.T) {
+	db := database(t)
+	saveImages(t, db,
+		&GoldenImage{ID: "soc2-hipaa", Name: "a", Version: "1", BaseOS: "ubuntu", Platform: "aws", Compliance: []string{"SOC2", "HIPAA"}},
+		&GoldenImage{ID: "pci", Name: "b", Version: "1", BaseOS: "ubuntu", Platform: "aws", Compliance: []string{"PCI-DSS"}},
+		&GoldenImage{ID: "empty", Name: "c", Version: "1", BaseOS: "ubuntu", Platform: "aws", Compliance: []string{}},
+		&GoldenImage{ID: "none", Name: "d", Version: "1", BaseOS: "ubuntu", Platform: "aws"},
+	)
+
+	tests := []struct {
+		framework string
+		want      []string
+	}{
+		{"SOC2", []string{"soc2-hipaa"}},
+		{"HIPAA", []string{"soc2-hipaa"}},
+		{"PCI-DSS", []string{"pci"}},
+		{"SOC", nil},  // whole elements only, not substrings
+		{"soc2", nil}, // case sensitive
+		{"FedRAMP", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.framework, func(t *testing.T) {
+			images, err := db.GetImagesByCompliance(tt.framework)
+			if err != nil {
+				t.Fatalf("GetImagesByCompliance: %v", err)
+			}
+			assertIDs(t, images, tt.want...)
+		})
+	}
+}
+
+func TestDatabaseQueryImages(t *testing.T) {
+	db := database(t)
+	saveImages(t, db,
+		&GoldenImage{ID: "aws-dev", Name: "web", Version: "1", BaseOS: "ubuntu", Platform: "aws"},
+		&GoldenImage{ID: "aws-prod", Name: "web", Version: "2", BaseOS: "ubuntu", Platform: "aws", Environment: EnvProd},
+		&GoldenImage{ID: "azure-staging", Name: "db", Version: "1", BaseOS: "rhel", Platform: "azure", Environment: EnvStaging},
+	)
+
+	all, err := db.ListImages()
+	if err != nil {
+		t.Fatalf("ListImages: %v", err)
+	}
+	assertIDs(t, all, "aws-dev", "aws-prod", "azure-staging")
+
+	byPlatform, err := db.GetImagesByPlatform("aws")
+	if err != nil {
+		t.Fatalf("GetImagesByPlatform: %v", err)
+	}
+	assertIDs(t, byPlatform, "aws-dev", "aws-prod")
+
+	byName, err := db.GetImagesByName("web")
+	if err != nil {
+		t.Fatalf("GetImagesByName: %v", err)
+	}
+	assertIDs(t, byName, "aws-dev", "aws-prod")
+
+	// An image saved without an environment counts as dev
+	dev, err := db.ListImagesByEnvironment(EnvDev)
+	if err != nil {
+		t.Fatalf("ListImagesByEnvironment: %v", err)
+	}
+	assertIDs(t, dev, "aws-dev")
+	prod, err := db.ListImagesByEnvironment(EnvProd)
+	if err != nil {
+		t.Fatalf("ListImagesByEnvironment: %v", err)
+	}
+	assertIDs(t, prod, "aws-prod")
+}
+
+func TestDatabaseDeleteImage(t *testing.T) {
+	db := database(t)
+	saveImages(t, db, &GoldenImage{ID: "img-1", Name: "web", Version: "1", BaseOS: "ubuntu", Platform: "aws"})
+	if err := db.SaveSBOM("img-1", "spdx-json", []byte("{}"), time.Now()); err != nil {
+		t.Fatalf("SaveSBOM: %v", err)
+	}
+	if err := db.SaveSBOMComponents("img-1", []SBOMComponent{{Name: "openssl", Version: "3.0.2"}}); err != nil {
+		t.Fatalf("SaveSBOMComponents: %v", err)
+	}
+
+	if err := db.DeleteImage("img-1"); err != nil {
+		t.Fatalf("DeleteImage: %v", err)
+	}
+	if image, _ := db.GetImage("img-1"); image != nil {
+		t.Fatal("image still stored after delete")
+	}
+	if sbom, _ := db.GetSBOM("img-1", "spdx-json"); sbom != nil {
+		t.Fatal("SBOM still stored after delete")
+	}
+	hits, err := db.FindSBOMComponents("openssl")
+	if err != nil {
+		t.Fatalf("FindSBOMComponents: %v", err)
+	}
+	if len(hits) != 0 {
+		t.Fatalf("SBOM components still indexed after delete: %v", hits)
+	}
+}
+
+func TestDatabasePatchStatus(t *testing.T) {
+	db := database(t)
+
+	if status, err := db.GetPatchStatus("img-1"); err != nil || status != nil {
+		t.Fatalf("GetPatchStatus before save = %v, %v", status, err)
+	}
+
+	checked := time.Now().UTC().Truncate(time.Millisecond)
+	status := &PatchStatus{
+		ImageID:       "img-1",
+		PatchesNeeded: 1,
+		Patches:       []PackagePatch{{Package: "openssl", InstalledVersion: "3.0.2", FixedVersion: "3.0.8", CVEs: []string{"CVE-2023-0286"}, Severity: "high"}},
+		CVEsFixed:     []string{"CVE-2023-0286"},
+		Scanned:       true,
+		LastChecked:   checked,
+	}
+	if err := db.SavePatchStatus(status); err != nil {
+		t.Fatalf("SavePatchStatus: %v", err)
+	}
+	status.UpToDate, status.PatchesNeeded, status.Patches = true, 0, nil
+	if err := db.SavePatchStatus(status); err != nil {
+		t.Fatalf("SavePatchStatus again: %v", err)
+	}
+
+	got, err := db.GetPatchStatus("img-1")
+	if err != nil {
+		t.Fatalf("GetPatchStatus: %v", err)
+	}
+	if got == nil || !got.UpToDate || got.PatchesNeeded != 0 || !got.LastChecked.Equal(checked) {
+		t.Fatalf("GetPatchStatus = %+v, want the second save", got)
+	}
+	if components, err := db.GetSBOMComponents("img-1"); err != nil || len(components) != 0 {
+		t.Fatalf("GetSBOMComponents = %v, %v", components, err)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultNodeStaleHours is how old a node report may be before the node's
+// state is treated as unknown
+const DefaultNodeStaleHours = 24
+
+// NodeReport is the inventory a node agent posts about its current state
+type NodeReport struct {
+	NodeID       string            `json:"node_id" binding:"required"`
+	Hostname     string            `json:"hostname,omitempty"`
+	Platform     string            `json:"platform" binding:"required"`
+	DataCenter   string            `json:"datacenter,omitempty"`
+	Environment  string            `json:"environment,omitempty"`
+	ImageID      string            `json:"image_id,omitempty"`
+	ImageDigest  string            `json:"image_digest" binding:"required"`
+	Packages     []string          `json:"packages"`
+	ConfigHashes map[string]string `json:"config_hashes,omitempty"` // path -> hash
+	ReportedAt   time.Time         `json:"reported_at"`
+}
+
+// DriftDetectionRequest represents a drift detection request
+type DriftDetectionRequest struct {
+	Platform    string   `json:"platform"`
+	DataCenter  string   `json:"datacenter,omitempty"`
+	Environment string   `json:"environment,omitempty"`
+	ImageIDs    []string `json:"image_ids,omitempty"`
+}
+
+// DriftReport represents drift detection results
+type DriftReport struct {
+	Timestamp      time.Time     `json:"timestamp"`
+	TotalNodes     int           `json:"total_nodes"`
+	DriftedNodes   int           `json:"drifted_nodes"`
+	CompliantNodes int           `json:"compliant_nodes"`
+	UnknownNodes   int           `json:"unknown_nodes"`
+	Details        []DriftDetail `json:"details"`
+	Unknown        []UnknownNode `json:"unknown"`
+}
+
+// DriftDetail represents drift details for a node
+type DriftDetail struct {
+	NodeID        string    `json:"node_id"`
+	CurrentImage  string    `json:"current_image"`
+	ExpectedImage string    `json:"expected_image"`
+	DriftType     string    `json:"drift_type"` // version, packages, config
+	Severity      string    `json:"severity"`   // critical, high, medium, low
+	Diverged      []string  `json:"diverged,omitempty"`
+	ReportedAt    time.Time `json:"reported_at"`
+}
+
+// UnknownNode is a node whose state can't be assessed
+type UnknownNode struct {
+	NodeID     string    `json:"node_id"`
+	Reason     string    `json:"reason"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+// nodeStaleAfter returns the report age beyond which a node is unknown
+func nodeStaleAfter() time.Duration {
+	hours := DefaultNodeStaleHours
+	if v := os.Getenv("NODE_REPORT_STALE_HOURS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			hours = n
+		}
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// reportNode stores the latest inventory of a node
+func (ir *ImageRegistry) reportNode(c *gin.Context) {
+	var report NodeReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+	if report.Environment == "" {
+		report.Environment = EnvDev
+	}
+	if !isValidEnvironment(report.Environment) {
+		apierror.RespondError(c, apierror.Validation(fmt.Sprintf("unknown environment %q", report.Environment)))
+		return
+	}
+	if report.ReportedAt.IsZero() || report.ReportedAt.After(time.Now()) {
+		report.ReportedAt = time.Now()
+	}
+
+	if ir.db != nil {
+		if err := ir.db.SaveNodeReport(&report); err != nil {
+			logging.ForRequest(logger, c).WithError(err).Error("Failed to save node report")
+			apierror.RespondError(c, apierror.Internal("Failed to store node report"))
+			return
+		}
+	} else {
+		ir.mu.Lock()
+		ir.nodes[report.NodeID] = &report
+		ir.mu.Unlock()
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"node_id":     report.NodeID,
+		"status":      "recorded",
+		"reported_at": report.ReportedAt,
+	})
+}
+
+// nodeReports returns the latest report of every node
+func (ir *ImageRegistry) nodeReports() ([]*NodeReport, error) {
+	if ir.db != nil {
+		return ir.db.ListNodeReports()
+	}
+
+	ir.mu.RLock()
+	defer ir.mu.RUnlock()
+	reports := make([]*NodeReport, 0, len(ir.nodes))
+	for _, report := range ir.nodes {
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// expectedImage picks the newest golden image for a platform and environment
+func expectedImage(images []*GoldenImage, platform, environment string) *GoldenImage {
+	var expected *GoldenImage
+	for _, img := range images {
+		env := img.Environment
+		if env == "" {
+			env = EnvDev
+		}
+		if img.Platform != platform || env != environment {
+			continue
+		}
+		if expected == nil || img.BuildTime.After(expected.BuildTime) {
+			expected = img
+		}
+	}
+	return expected
+}
+
+// detectDrift compares reported node state against the expected golden images
+func (ir *ImageRegistry) detectDrift(c *gin.Context) {
+	var req DriftDetectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+
+	reports, err := ir.nodeReports()
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to load node reports")
+		apierror.RespondError(c, apierror.Internal("Failed to load node inventory"))
+		return
+	}
+
+	images := ir.cachedImages()
+	if ir.db != nil {
+		if dbImages, err := ir.db.ListImages(); err == nil {
+			images = dbImages
+		} else {
+			logging.ForRequest(logger, c).WithError(err).Error("Failed to list images from database")
+		}
+	}
+
+	imageFilter := make(map[string]bool, len(req.ImageIDs))
+	for _, id := range req.ImageIDs {
+		imageFilter[id] = true
+	}
+
+	report := DriftReport{
+		Timestamp: time.Now(),
+		Details:   []DriftDetail{},
+		Unknown:   []UnknownNode{},
+	}
+	staleCutoff := time.Now().Add(-nodeStaleAfter())
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].NodeID < reports[j].NodeID })
+	for _, node := range reports {
+		if req.Platform != "" && node.Platform != req.Platform {
+			continue
+		}
+		if req.DataCenter != "" && node.DataCenter != req.DataCenter {
+			continue
+		}
+		if req.Environment != "" && node.Environment != req.Environment {
+			continue
+		}
+
+		expected := expectedImage(images, node.Platform, node.Environment)
+		if len(imageFilter) > 0 && (expected == nil || !imageFilter[expected.ID]) && !imageFilter[node.ImageID] {
+			continue
+		}
+
+		report.TotalNodes++
+
+		if node.ReportedAt.Before(staleCutoff) {
+			report.UnknownNodes++
+			report.Unknown = append(report.Unknown, UnknownNode{
+				NodeID:     node.NodeID,
+				Reason:     fmt.Sprintf("last report older than %s", nodeStaleAfter()),
+				ReportedAt: node.ReportedAt,
+			})
+			continue
+		}
+		if expected == nil {
+			report.UnknownNodes++
+			report.Unknown = append(report.Unknown, UnknownNode{
+				NodeID:     node.NodeID,
+				Reason:     fmt.Sprintf("no golden image for platform %s in %s", node.Platform, node.Environment),
+				ReportedAt: node.ReportedAt,
+			})
+			continue
+		}
+
+		details := compareNode(node, expected)
+		if len(details) == 0 {
+			report.CompliantNodes++
+			continue
+		}
+		report.DriftedNodes++
+		report.Details = append(report.Details, details...)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// compareNode classifies how a node diverges from its expected image
+func compareNode(node *NodeReport, expected *GoldenImage) []DriftDetail {
+	var details []DriftDetail
+	current := node.ImageID
+	if current == "" {
+		current = node.ImageDigest
+	}
+	expectedRef := fmt.Sprintf("%s-v%s", expected.Name, expected.Version)
+	detail := func(driftType, severity string, diverged []string) DriftDetail {
+		return DriftDetail{
+			NodeID:        node.NodeID,
+			CurrentImage:  current,
+			ExpectedImage: expectedRef,
+			DriftType:     driftType,
+			Severity:      severity,
+			Diverged:      diverged,
+			ReportedAt:    node.ReportedAt,
+		}
+	}
+
+	// Version drift: the node runs a different image build. Without a known
+	// digest for the expected image only the reported image ID can be checked.
+	var versionDiverged []string
+	switch {
+	case isKnownDigest(expected.Digest):
+		if node.ImageDigest != expected.Digest {
+			versionDiverged = []string{fmt.Sprintf("digest %s != %s", node.ImageDigest, expected.Digest)}
+		}
+	case node.ImageID != "" && node.ImageID != expected.ID:
+		versionDiverged = []string{fmt.Sprintf("image %s != %s (expected digest unknown)", node.ImageID, expected.ID)}
+	}
+	if len(versionDiverged) > 0 {
+		severity := "high"
+		// Running a build that is behind a prod image is the riskiest case
+		if node.Environment == EnvProd {
+			severity = "critical"
+		}
+		details = append(details, detail("version", severity, versionDiverged))
+	}
+
+	// Package drift: missing or changed packages are worse than extras
+	want := packageVersions(expected.Packages)
+	have := packageVersions(node.Packages)
+	var missing, changed, extra []string
+	for name, version := range want {
+		got, ok := have[name]
+		switch {
+		case !ok:
+			missing = append(missing, name)
+		case version != "" && got != version:
+			changed = append(changed, fmt.Sprintf("%s %s != %s", name, got, version))
+		}
+	}
+	for name := range have {
+		if _, ok := want[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+	if len(missing)+len(changed)+len(extra) > 0 {
+		severity := "low"
+		switch {
+		case len(missing) > 0:
+			severity = "high"
+		case len(changed) > 0:
+			severity = "medium"
+		}
+		sort.Strings(missing)
+		sort.Strings(changed)
+		sort.Strings(extra)
+		var diverged []string
+		for _, m := range missing {
+			diverged = append(diverged, "missing "+m)
+		}
+		diverged = append(diverged, changed...)
+		for _, e := range extra {
+			diverged = append(diverged, "unexpected "+e)
+		}
+		details = append(details, detail("packages", severity, diverged))
+	}
+
+	// Config drift: compare against hashes recorded in the image metadata
+	if expectedHashes := configHashes(expected.Metadata); len(expectedHashes) > 0 {
+		var diverged []string
+		severity := "medium"
+		for path, hash := range expectedHashes {
+			if node.ConfigHashes[path] != hash {
+				diverged = append(diverged, path)
+				// Changes to security relevant config are escalated
+				if isSecurityConfig(path) {
+					severity = "high"
+				}
+			}
+		}
+		if len(diverged) > 0 {
+			sort.Strings(diverged)
+			details = append(details, detail("config", severity, diverged))
+		}
+	}
+
+	return details
+}
+
+// configHashes reads the expected config hashes from image metadata
+func configHashes(metadata map[string]interface{}) map[string]string {
+	raw, ok := metadata["config_hashes"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	hashes := make(map[string]string, len(raw))
+	for path, hash := range raw {
+		if s, ok := hash.(string); ok {
+			hashes[path] = s
+		}
+	}
+	return hashes
+}
+
+func isSecurityConfig(path string) bool {
+	for _, marker := range []string{"ssh", "sudoers", "pam", "audit", "selinux", "apparmor", "firewall", "iptables"} {
+		if strings.Contains(path, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCompareNodeVersion(t *testing.T) {
+	const otherDigest = "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+
+	tests := []struct {
+		name           string
+		expectedDigest string
+		node           NodeReport
+		wantDiverged   string
+	}{
+		{"digest matches", testDigest, NodeReport{ImageID: "img-1", ImageDigest: testDigest}, ""},
+		{"digest differs", testDigest, NodeReport{ImageID: "img-1", ImageDigest: otherDigest}, "digest " + otherDigest + " != " + testDigest},
+		{"digest unknown, same image", "", NodeReport{ImageID: "img-1", ImageDigest: otherDigest}, ""},
+		{"digest unknown, other image", "", NodeReport{ImageID: "img-0", ImageDigest: otherDigest}, "image img-0 != img-1 (expected digest unknown)"},
+		{"digest unknown, no image ID", "", NodeReport{ImageDigest: otherDigest}, ""},
+		{"made up digest", "sha256:6f1c2d1e-0b7a-4c1e-9f3a-2d1c0b7a4c1e", NodeReport{ImageID: "img-1", ImageDigest: otherDigest}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := &GoldenImage{ID: "img-1", Name: "web", Version: "1.0.0", Digest: tt.expectedDigest, Packages: []string{"nginx"}}
+			node := tt.node
+			node.NodeID, node.Packages = "node-1", []string{"nginx"}
+
+			details := compareNode(&node, expected)
+			if tt.wantDiverged == "" {
+				if len(details) != 0 {
+					t.Fatalf("drift = %+v, want none", details)
+				}
+				return
+			}
+			if len(details) != 1 || details[0].DriftType != "version" || fmt.Sprint(details[0].Diverged) != "["+tt.wantDiverged+"]" {
+				t.Fatalf("drift = %+v, want version drift %q", details, tt.wantDiverged)
+			}
+		})
+	}
+}
+
+func TestCompareNodeUnknownDigestStillChecksPackages(t *testing.T) {
+	expected := &GoldenImage{ID: "img-1", Name: "web", Version: "1.0.0", Packages: []string{"nginx=1.24"}}
+	node := &NodeReport{NodeID: "node-1", ImageID: "img-1", ImageDigest: testDigest, Packages: []string{"nginx=1.22"}}
+
+	details := compareNode(node, expected)
+	if len(details) != 1 || details[0].DriftType != "packages" {
+		t.Fatalf("drift = %+v, want only package drift", details)
+	}
+}
+
+// detect runs drift detection for the docker platform
+func detect(t *testing.T, ir *ImageRegistry) DriftReport {
+	t.Helper()
+	w := serve(ir.detectDrift, http.MethodPost, "/drift/detect", "/drift/detect", DriftDetectionRequest{Platform: "docker"})
+	assertStatus(t, w, http.StatusOK)
+	var report DriftReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode drift report: %v", err)
+	}
+	return report
+}
+
+func TestDetectDriftUsesReportedDigest(t *testing.T) {
+	syft, _ := syftStub(t, 0)
+	ir := newTestRegistry()
+	ir.sboms.syftURL = syft.URL
+
+	image := build(t, ir, BuildRequest{Name: "web", BaseOS: "debian-12", Platform: "docker"})
+	if image.Digest != "" {
+		t.Fatalf("digest = %q before the build completed, want none", image.Digest)
+	}
+
+	const nodeDigest = "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+	w := serve(ir.reportNode, http.MethodPost, "/nodes/report", "/nodes/report", NodeReport{
+		NodeID: "node-1", Platform: "docker", ImageID: image.ID, ImageDigest: nodeDigest, ReportedAt: time.Now(),
+	})
+	assertStatus(t, w, http.StatusAccepted)
+
+	// Until the builder reports the digest the node is judged by image ID
+	if report := detect(t, ir); report.CompliantNodes != 1 || report.DriftedNodes != 0 {
+		t.Fatalf("report = %+v, want the node compliant", report)
+	}
+
+	w = serve(ir.completeBuild, http.MethodPost, "/images/:id/build-complete", "/images/"+image.ID+"/build-complete",
+		BuildCompletion{Status: BuildSucceeded, Digest: testDigest})
+	assertStatus(t, w, http.StatusOK)
+	waitForSBOM(t, ir, ir.images[image.ID])
+
+	report := detect(t, ir)
+	if report.DriftedNodes != 1 || len(report.Details) != 1 || report.Details[0].DriftType != "version" {
+		t.Fatalf("report = %+v, want version drift against the built digest", report)
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// PackageChange describes a package whose version differs between two images
+type PackageChange struct {
+	Name        string `json:"name"`
+	FromVersion string `json:"from_version"`
+	ToVersion   string `json:"to_version"`
+}
+
+// HardeningChange describes a hardening profile difference
+type HardeningChange struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Changed bool   `json:"changed"`
+}
+
+// VulnerabilityDelta compares the latest scans of two images
+type VulnerabilityDelta struct {
+	BaseScanned  bool     `json:"base_scanned"`
+	OtherScanned bool     `json:"other_scanned"`
+	Fixed        []string `json:"fixed"`      // present in base, gone in other
+	Introduced   []string `json:"introduced"` // absent in base, present in other
+	Unchanged    int      `json:"unchanged"`
+}
+
+// ImageDiff is the result of GET /images/:id/diff/:other_id
+type ImageDiff struct {
+	BaseID        string             `json:"base_id"`
+	BaseVersion   string             `json:"base_version"`
+	OtherID       string             `json:"other_id"`
+	OtherVersion  string             `json:"other_version"`
+	SharedLineage bool               `json:"shared_lineage"`
+	Warning       string             `json:"warning,omitempty"`
+	Added         []string           `json:"added"`
+	Removed       []string           `json:"removed"`
+	Upgraded      []PackageChange    `json:"upgraded"`
+	Downgraded    []PackageChange    `json:"downgraded"`
+	Hardening     HardeningChange    `json:"hardening"`
+	Vulnerability VulnerabilityDelta `json:"vulnerabilities"`
+}
+
+// parsePackage splits "name=version" or "name@version" into its parts.
+// Packages listed without a version return an empty version.
+func parsePackage(pkg string) (string, string) {
+	if i := strings.IndexAny(pkg, "=@"); i > 0 {
+		return pkg[:i], pkg[i+1:]
+	}
+	return pkg, ""
+}
+
+// packageVersions maps package name to version
+func packageVersions(packages []string) map[string]string {
+	versions := make(map[string]string, len(packages))
+	for _, pkg := range packages {
+		name, version := parsePackage(pkg)
+		versions[name] = version
+	}
+	return versions
+}
+
+// compareVersions compares dotted versions segment by segment, numerically
+// where both segments are numbers. It returns -1, 0 or 1.
+func compareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool {
+			return r == '.' || r == '-' || r == '+' || r == '~' || r == ':'
+		})
+	}
+	as, bs := split(a), split(b)
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		if x == y {
+			continue
+		}
+
+		xn, xerr := strconv.Atoi(strings.TrimRightFunc(x, func(r rune) bool { return !unicode.IsDigit(r) }))
+		yn, yerr := strconv.Atoi(strings.TrimRightFunc(y, func(r rune) bool { return !unicode.IsDigit(r) }))
+		switch {
+		case xerr == nil && yerr == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// nextPatchVersion bumps the last numeric segment of a version
+func nextPatchVersion(version string) string {
+	parts := strings.Split(version, ".")
+	if n, err := strconv.Atoi(parts[len(parts)-1]); err == nil {
+		parts[len(parts)-1] = strconv.Itoa(n + 1)
+		return strings.Join(parts, ".")
+	}
+	return version + ".1"
+}
+
+// ancestors returns the chain of parent images starting with image's parent.
+// The walk stops at missing parents and guards against cycles.
+func (ir *ImageRegistry) ancestors(image *GoldenImage) []*GoldenImage {
+	var chain []*GoldenImage
+	seen := map[string]bool{image.ID: true}
+
+	for parentID := image.ParentID; parentID != "" && !seen[parentID]; {
+		seen[parentID] = true
+		parent, err := ir.getImageByID(parentID)
+		if err != nil {
+			logger.WithError(err).WithField("image_id", parentID).Error("Failed to load parent image")
+			break
+		}
+		if parent == nil {
+			break
+		}
+		chain = append(chain, parent)
+		parentID = parent.ParentID
+	}
+
+	return chain
+}
+
+// sharesLineage reports whether two images have a common ancestor or one
+// descends from the other
+func (ir *ImageRegistry) sharesLineage(a, b *GoldenImage) bool {
+	family := map[string]bool{a.ID: true}
+	for _, img := range ir.ancestors(a) {
+		family[img.ID] = true
+	}
+	if family[b.ID] {
+		return true
+	}
+	for _, img := range ir.ancestors(b) {
+		if family[img.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+// diffImages compares base against other
+func (ir *ImageRegistry) diffImages(base, other *GoldenImage) ImageDiff {
+	diff := ImageDiff{
+		BaseID:       base.ID,
+		BaseVersion:  base.Version,
+		OtherID:      other.ID,
+		OtherVersion: other.Version,
+		Added:        []string{},
+		Removed:      []string{},
+		Upgraded:     []PackageChange{},
+		Downgraded:   []PackageChange{},
+		Hardening: HardeningChange{
+			From:    base.Hardening,
+			To:      other.Hardening,
+			Changed: base.Hardening != other.Hardening,
+		},
+	}
+
+	diff.SharedLineage = ir.sharesLineage(base, other)
+	if !diff.SharedLineage {
+		diff.Warning = "images do not share a lineage; diff compares unrelated builds"
+	}
+
+	basePkgs := packageVersions(base.Packages)
+	otherPkgs := packageVersions(other.Packages)
+	for name, version := range otherPkgs {
+		baseVersion, ok := basePkgs[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case baseVersion != version:
+			change := PackageChange{Name: name, FromVersion: baseVersion, ToVersion: version}
+			if compareVersions(baseVersion, version) > 0 {
+				diff.Downgraded = append(diff.Downgraded, change)
+			} else {
+				diff.Upgraded = append(diff.Upgraded, change)
+			}
+		}
+	}
+	for name := range basePkgs {
+		if _, ok := otherPkgs[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Upgraded, func(i, j int) bool { return diff.Upgraded[i].Name < diff.Upgraded[j].Name })
+	sort.Slice(diff.Downgraded, func(i, j int) bool { return diff.Downgraded[i].Name < diff.Downgraded[j].Name })
+
+	diff.Vulnerability = vulnerabilityDelta(base, other)
+
+	return diff
+}
+
+// vulnerabilityDelta compares CVEs from the latest scans of two images
+func vulnerabilityDelta(base, other *GoldenImage) VulnerabilityDelta {
+	delta := VulnerabilityDelta{
+		BaseScanned:  !base.LastScanned.IsZero(),
+		OtherScanned: !other.LastScanned.IsZero(),
+		Fixed:        []string{},
+		Introduced:   []string{},
+	}
+
+	cves := func(img *GoldenImage) map[string]bool {
+		set := make(map[string]bool, len(img.Vulnerabilities))
+		for _, v := range img.Vulnerabilities {
+			set[v.CVE] = true
+		}
+		return set
+	}
+	baseCVEs, otherCVEs := cves(base), cves(other)
+
+	for cve := range baseCVEs {
+		if otherCVEs[cve] {
+			delta.Unchanged++
+		} else {
+			delta.Fixed = append(delta.Fixed, cve)
+		}
+	}
+	for cve := range otherCVEs {
+		if !baseCVEs[cve] {
+			delta.Introduced = append(delta.Introduced, cve)
+		}
+	}
+	sort.Strings(delta.Fixed)
+	sort.Strings(delta.Introduced)
+
+	return delta
+}
+
+// diffImage returns package, hardening and vulnerability differences between two images
+func (ir *ImageRegistry) diffImage(c *gin.Context) {
+	base := ir.lookupImage(c)
+	if base == nil {
+		return
+	}
+
+	other, err := ir.getImageByID(c.Param("other_id"))
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to get image from database")
+		apierror.RespondError(c, apierror.Internal("Failed to load image"))
+		return
+	}
+	if other == nil {
+		apierror.RespondError(c, apierror.NotFound(fmt.Sprintf("Image %s not found", c.Param("other_id"))))
+		return
+	}
+
+	c.JSON(http.StatusOK, ir.diffImages(base, other))
+}
+
+// imagesByName returns every version of a named image
+func (ir *ImageRegistry) imagesByName(name string) ([]*GoldenImage, error) {
+	if ir.db != nil {
+		return ir.db.GetImagesByName(name)
+	}
+
+	var images []*GoldenImage
+	for _, img := range ir.cachedImages() {
+		if img.Name == name {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+// listVersions returns every version of a named image ordered by build time.
+// The route shares the /images/:id prefix, so the parameter holds the image name.
+func (ir *ImageRegistry) listVersions(c *gin.Context) {
+	name := c.Param("id")
+
+	images, err := ir.imagesByName(name)
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to list image versions")
+		apierror.RespondError(c, apierror.Internal("Failed to list image versions"))
+		return
+	}
+	if len(images) == 0 {
+		apierror.RespondError(c, apierror.NotFound(fmt.Sprintf("No images named %s", name)))
+		return
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].BuildTime.Before(images[j].BuildTime)
+	})
+
+	versions := make([]gin.H, 0, len(images))
+	for _, img := range images {
+		versions = append(versions, gin.H{
+			"id":         img.ID,
+			"version":    img.Version,
+			"parent_id":  img.ParentID,
+			"build_time": img.BuildTime,
+			"packages":   img.Packages,
+			"hardening":  img.Hardening,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":     name,
+		"total":    len(versions),
+		"versions": versions,
+	})
+}
+
+// Inheritance records how an image's effective configuration was resolved
+// from its base image
+type Inheritance struct {
+	BaseImageID         string   `json:"base_image_id"`
+	DeclaredPackages    []string `json:"declared_packages"`
+	InheritedPackages   []string `json:"inherited_packages"`
+	DeclaredCompliance  []string `json:"declared_compliance"`
+	InheritedCompliance []string `json:"inherited_compliance"`
+	HardeningInherited  bool     `json:"hardening_inherited"`
+}
+
+// applyInheritance resolves the image's effective packages, hardening and
+// compliance on top of base. Declared packages override the base's version
+// of the same package; compliance frameworks are unioned; hardening and
+// platform settings fall back to the base's when not declared.
+func applyInheritance(image, base *GoldenImage, req BuildRequest) {
+	inheritance := &Inheritance{
+		BaseImageID:         base.ID,
+		DeclaredPackages:    append([]string{}, req.Packages...),
+		InheritedPackages:   []string{},
+		DeclaredCompliance:  append([]string{}, req.Compliance...),
+		InheritedCompliance: []string{},
+	}
+
+	declared := packageVersions(req.Packages)
+	effective := []string{}
+	for _, pkg := range base.Packages {
+		name, _ := parsePackage(pkg)
+		if _, overridden := declared[name]; overridden {
+			continue
+		}
+		effective = append(effective, pkg)
+		inheritance.InheritedPackages = append(inheritance.InheritedPackages, pkg)
+	}
+	image.Packages = append(effective, req.Packages...)
+
+	compliance := append([]string{}, req.Compliance...)
+	seen := make(map[string]bool, len(compliance))
+	for _, framework := range compliance {
+		seen[framework] = true
+	}
+	for _, framework := range base.Compliance {
+		if !seen[framework] {
+			seen[framework] = true
+			compliance = append(compliance, framework)
+			inheritance.InheritedCompliance = append(inheritance.InheritedCompliance, framework)
+		}
+	}
+	image.Compliance = compliance
+
+	if image.Hardening == "" {
+		image.Hardening = base.Hardening
+		inheritance.HardeningInherited = base.Hardening != ""
+	}
+	if image.BaseOS == "" {
+		image.BaseOS = base.BaseOS
+	}
+	if image.Platform == "" {
+		image.Platform = base.Platform
+	}
+
+	image.Inheritance = inheritance
+}
+
+// getLineage returns the inheritance chain of an image, starting with the
+// image itself and ending at its root ancestor
+func (ir *ImageRegistry) getLineage(c *gin.Context) {
+	image := ir.lookupImage(c)
+	if image == nil {
+		return
+	}
+
+	chain := append([]*GoldenImage{image}, ir.ancestors(image)...)
+
+	lineage := make([]gin.H, 0, len(chain))
+	for depth, img := range chain {
+		lineage = append(lineage, gin.H{
+			"depth":         depth,
+			"id":            img.ID,
+			"name":          img.Name,
+			"version":       img.Version,
+			"parent_id":     img.ParentID,
+			"base_image_id": img.BaseImageID,
+			"hardening":     img.Hardening,
+			"packages":      img.Packages,
+			"compliance":    img.Compliance,
+			"build_time":    img.BuildTime,
+		})
+	}
+
+	// A parent that can no longer be loaded leaves the chain incomplete
+	root := chain[len(chain)-1]
+	complete := root.ParentID == ""
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":       image.ID,
+		"depth":    len(chain) - 1,
+		"complete": complete,
+		"lineage":  lineage,
+	})
+}
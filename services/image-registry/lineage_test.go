@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.9", "1.10", -1},
+		{"3.0.13", "3.0.2", 1},
+		{"1.2", "1.2.1", -1},
+		{"1:2.3-1ubuntu1", "1:2.3-1ubuntu2", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// webVersions is three builds of the web image, stored out of build order,
+// and an unrelated api image
+func webVersions() []*GoldenImage {
+	built := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []*GoldenImage{
+		{ID: "web-3", Name: "web", Version: "1.0.2", ParentID: "web-2", BuildTime: built.Add(2 * time.Hour),
+			Packages: []string{"nginx=1.25.3", "openssl=3.0.13", "curl"}, Hardening: "STIG",
+			Vulnerabilities: []Vulnerability{{CVE: "CVE-2024-0002"}, {CVE: "CVE-2024-0003"}}, LastScanned: built.Add(3 * time.Hour)},
+		{ID: "web-1", Name: "web", Version: "1.0.0", BuildTime: built,
+			Packages: []string{"nginx=1.24.0", "openssl=3.0.9", "debug-tools"}, Hardening: "CIS",
+			Vulnerabilities: []Vulnerability{{CVE: "CVE-2024-0001"}, {CVE: "CVE-2024-0002"}}, LastScanned: built.Add(time.Hour)},
+		{ID: "web-2", Name: "web", Version: "1.0.1", ParentID: "web-1", BuildTime: built.Add(time.Hour),
+			Packages: []string{"nginx=1.24.0", "openssl=3.0.13"}, Hardening: "CIS"},
+		{ID: "api-1", Name: "api", Version: "1.0.0", BuildTime: built,
+			Packages: []string{"nginx=1.9.0"}, Hardening: "CIS"},
+	}
+}
+
+func TestListVersions(t *testing.T) {
+	ir := newTestRegistry(webVersions()...)
+
+	w := serve(ir.listVersions, http.MethodGet, "/images/:id/versions", "/images/web/versions", nil)
+	assertStatus(t, w, http.StatusOK)
+	var resp struct {
+		Name     string `json:"name"`
+		Total    int    `json:"total"`
+		Versions []struct {
+			ID       string   `json:"id"`
+			Version  string   `json:"version"`
+			ParentID string   `json:"parent_id"`
+			Packages []string `json:"packages"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode versions: %v", err)
+	}
+	if resp.Name != "web" || resp.Total != 3 || len(resp.Versions) != 3 {
+		t.Fatalf("versions = %+v", resp)
+	}
+	for i, want := range []struct{ id, version, parent string }{
+		{"web-1", "1.0.0", ""}, {"web-2", "1.0.1", "web-1"}, {"web-3", "1.0.2", "web-2"},
+	} {
+		got := resp.Versions[i]
+		if got.ID != want.id || got.Version != want.version || got.ParentID != want.parent {
+			t.Errorf("versions[%d] = %+v, want %s %s parent %q", i, got, want.id, want.version, want.parent)
+		}
+	}
+
+	w = serve(ir.listVersions, http.MethodGet, "/images/:id/versions", "/images/no-such-image/versions", nil)
+	assertStatus(t, w, http.StatusNotFound)
+}
+
+func diff(t *testing.T, ir *ImageRegistry, id, otherID string) ImageDiff {
+	t.Helper()
+	w := serve(ir.diffImage, http.MethodGet, "/images/:id/diff/:other_id", "/images/"+id+"/diff/"+otherID, nil)
+	assertStatus(t, w, http.StatusOK)
+	var d ImageDiff
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+		t.Fatalf("decode diff: %v", err)
+	}
+	return d
+}
+
+func TestDiffImage(t *testing.T) {
+	ir := newTestRegistry(webVersions()...)
+
+	d := diff(t, ir, "web-1", "web-3")
+	for _, c := range []struct {
+		field     string
+		got, want interface{}
+	}{
+		{"versions", d.BaseVersion + " " + d.OtherVersion, "1.0.0 1.0.2"},
+		{"shared lineage", d.SharedLineage, true},
+		{"warning", d.Warning, ""},
+		{"added", d.Added, []string{"curl"}},
+		{"removed", d.Removed, []string{"debug-tools"}},
+		{"upgraded", d.Upgraded, []PackageChange{{"nginx", "1.24.0", "1.25.3"}, {"openssl", "3.0.9", "3.0.13"}}},
+		{"downgraded", d.Downgraded, []PackageChange{}},
+		{"hardening", d.Hardening, HardeningChange{From: "CIS", To: "STIG", Changed: true}},
+		{"fixed", d.Vulnerability.Fixed, []string{"CVE-2024-0001"}},
+		{"introduced", d.Vulnerability.Introduced, []string{"CVE-2024-0003"}},
+		{"unchanged", d.Vulnerability.Unchanged, 1},
+		{"scanned", [2]bool{d.Vulnerability.BaseScanned, d.Vulnerability.OtherScanned}, [2]bool{true, true}},
+	} {
+		if fmt.Sprint(c.got) != fmt.Sprint(c.want) {
+			t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+		}
+	}
+
+	// Diffing backwards reports the same packages as downgrades, and a
+	// version that was never scanned says so
+	d = diff(t, ir, "web-3", "web-2")
+	if fmt.Sprint(d.Downgraded) != fmt.Sprint([]PackageChange{{"nginx", "1.25.3", "1.24.0"}}) || len(d.Upgraded) != 0 {
+		t.Errorf("web-3 to web-2: upgraded %v, downgraded %v", d.Upgraded, d.Downgraded)
+	}
+	if !d.Vulnerability.BaseScanned || d.Vulnerability.OtherScanned {
+		t.Errorf("web-3 to web-2 scanned = %+v", d.Vulnerability)
+	}
+
+	// 1.9.0 to 1.24.0 is an upgrade even though it sorts lower as a string
+	d = diff(t, ir, "api-1", "web-2")
+	if d.SharedLineage || d.Warning == "" {
+		t.Errorf("unrelated images: shared lineage %v, warning %q", d.SharedLineage, d.Warning)
+	}
+	if fmt.Sprint(d.Upgraded) != fmt.Sprint([]PackageChange{{"nginx", "1.9.0", "1.24.0"}}) {
+		t.Errorf("api-1 to web-2 upgraded = %v", d.Upgraded)
+	}
+
+	w := serve(ir.diffImage, http.MethodGet, "/images/:id/diff/:other_id", "/images/web-1/diff/no-such-image", nil)
+	assertStatus(t, w, http.StatusNotFound)
+}
+
+func TestApplyInheritance(t *testing.T) {
+	base := &GoldenImage{
+		ID:         "base",
+		BaseOS:     "ubuntu-22.04",
+		Platform:   "aws",
+		Packages:   []string{"openssl=3.0.2", "curl=7.81", "nginx"},
+		Hardening:  "CIS",
+		Compliance: []string{"SOC2", "HIPAA"},
+	}
+
+	tests := []struct {
+		name                string
+		req                 BuildRequest
+		wantPackages        []string
+		wantInherited       []string
+		wantCompliance      []string
+		wantHardening       string
+		wantHardeningCopied bool
+		wantPlatform        string
+	}{
+		{
+			name:                "inherits everything undeclared",
+			req:                 BuildRequest{},
+			wantPackages:        []string{"openssl=3.0.2", "curl=7.81", "nginx"},
+			wantInherited:       []string{"openssl=3.0.2", "curl=7.81", "nginx"},
+			wantCompliance:      []string{"SOC2", "HIPAA"},
+			wantHardening:       "CIS",
+			wantHardeningCopied: true,
+			wantPlatform:        "aws",
+		},
+		{
+			name: "declared packages override the base version",
+			req: BuildRequest{
+				Packages: []string{"openssl@3.0.13", "redis"},
+				Platform: "gcp",
+			},
+			wantPackages:        []string{"curl=7.81", "nginx", "openssl@3.0.13", "redis"},
+			wantInherited:       []string{"curl=7.81", "nginx"},
+			wantCompliance:      []string{"SOC2", "HIPAA"},
+			wantHardening:       "CIS",
+			wantHardeningCopied: true,
+			wantPlatform:        "gcp",
+		},
+		{
+			name: "compliance is unioned and hardening kept",
+			req: BuildRequest{
+				Hardening:  "STIG",
+				Compliance: []string{"PCI-DSS", "SOC2"},
+			},
+			wantPackages:   []string{"openssl=3.0.2", "curl=7.81", "nginx"},
+			wantInherited:  []string{"openssl=3.0.2", "curl=7.81", "nginx"},
+			wantCompliance: []string{"PCI-DSS", "SOC2", "HIPAA"},
+			wantHardening:  "STIG",
+			wantPlatform:   "aws",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := &GoldenImage{
+				Packages:   tt.req.Packages,
+				Hardening:  tt.req.Hardening,
+				Compliance: tt.req.Compliance,
+				Platform:   tt.req.Platform,
+			}
+			applyInheritance(image, base, tt.req)
+
+			for _, c := range []struct {
+				field     string
+				got, want interface{}
+			}{
+				{"packages", image.Packages, tt.wantPackages},
+				{"inherited packages", image.Inheritance.InheritedPackages, tt.wantInherited},
+				{"compliance", image.Compliance, tt.wantCompliance},
+				{"hardening", image.Hardening, tt.wantHardening},
+				{"hardening inherited", image.Inheritance.HardeningInherited, tt.wantHardeningCopied},
+				{"platform", image.Platform, tt.wantPlatform},
+				{"base os", image.BaseOS, "ubuntu-22.04"},
+				{"inheritance base", image.Inheritance.BaseImageID, "base"},
+			} {
+				if fmt.Sprint(c.got) != fmt.Sprint(c.want) {
+					t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+// build posts a build request and returns the created image
+func build(t *testing.T, ir *ImageRegistry, req BuildRequest) *GoldenImage {
+	t.Helper()
+	w := serve(ir.buildImage, http.MethodPost, "/images/build", "/images/build", req)
+	assertStatus(t, w, http.StatusAccepted)
+
+	var resp struct {
+		Image GoldenImage `json:"image"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode build response: %v", err)
+	}
+	return &resp.Image
+}
+
+func TestBuildImageInheritsFromBaseImage(t *testing.T) {
+	base := &GoldenImage{
+		ID: "base", Name: "ubuntu-base", Version: "1.0.0", BaseOS: "debian-12", Platform: "docker",
+		Packages: []string{"openssl=3.0.2"}, Hardening: "CIS", Compliance: []string{"SOC2"},
+	}
+	ir := newTestRegistry(base)
+
+	app := build(t, ir, BuildRequest{Name: "web", BaseImageID: "base", Packages: []string{"nginx"}})
+	if app.BaseImageID != "base" || app.ParentID != "" || app.Version != "1.0.0" {
+		t.Fatalf("app = base %q, parent %q, version %s", app.BaseImageID, app.ParentID, app.Version)
+	}
+	if fmt.Sprint(app.Packages) != "[openssl=3.0.2 nginx]" || app.Hardening != "CIS" || fmt.Sprint(app.Compliance) != "[SOC2]" {
+		t.Fatalf("app did not inherit from base: %+v", app)
+	}
+
+	// A new version continues the lineage and keeps its base
+	rebuilt := build(t, ir, BuildRequest{Name: "web", ParentID: app.ID, Packages: []string{"nginx=1.25"}})
+	if rebuilt.ParentID != app.ID || rebuilt.BaseImageID != "base" || rebuilt.Version != "1.0.1" {
+		t.Fatalf("rebuild = parent %q, base %q, version %s", rebuilt.ParentID, rebuilt.BaseImageID, rebuilt.Version)
+	}
+	if fmt.Sprint(rebuilt.Packages) != "[openssl=3.0.2 nginx=1.25]" {
+		t.Fatalf("rebuild packages = %v", rebuilt.Packages)
+	}
+}
+
+func TestBuildImageParentDoesNotInherit(t *testing.T) {
+	parent := &GoldenImage{
+		ID: "web-1", Name: "web", Version: "1.0.0", BaseOS: "debian-12", Platform: "docker",
+		Packages: []string{"nginx", "debug-tools"}, Hardening: "CIS", Compliance: []string{"SOC2"},
+	}
+	ir := newTestRegistry(parent)
+
+	// A version that drops packages must not get them back from its parent
+	next := build(t, ir, BuildRequest{Name: "web", ParentID: "web-1", BaseOS: "debian-12", Platform: "docker", Packages: []string{"nginx"}})
+	if next.Version != "1.0.1" || next.ParentID != "web-1" || next.BaseImageID != "" {
+		t.Fatalf("next = version %s, parent %q, base %q", next.Version, next.ParentID, next.BaseImageID)
+	}
+	if fmt.Sprint(next.Packages) != "[nginx]" || next.Hardening != "" || len(next.Compliance) != 0 || next.Inheritance != nil {
+		t.Fatalf("next inherited from its parent: %+v", next)
+	}
+}
+
+func TestBuildImageMissingBase(t *testing.T) {
+	ir := newTestRegistry()
+	w := serve(ir.buildImage, http.MethodPost, "/images/build", "/images/build",
+		BuildRequest{Name: "web", BaseImageID: "no-such-image"})
+	assertStatus(t, w, http.StatusNotFound)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testDigest is a well formed image digest as reported by the builder
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// newTestRegistry returns a registry that keeps everything in memory
+func newTestRegistry(images ...*GoldenImage) *ImageRegistry {
+	ir := &ImageRegistry{
+		registryURL: DefaultRegistryURL,
+		images:      make(map[string]*GoldenImage),
+		scanner:     NewScanner(),
+		promotions:  make(map[string][]Promotion),
+		nodes:       make(map[string]*NodeReport),
+		sboms:       NewSBOMGenerator(),
+		webhooks:    NewWebhookNotifier(),
+		signer:      NewSigner(),
+		patches:     make(map[string]*PatchStatus),
+	}
+	for _, image := range images {
+		ir.images[image.ID] = image
+	}
+	return ir
+}
+
+// serve runs a single request through handler mounted at route
+func serve(handler gin.HandlerFunc, method, route, path string, body interface{}) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(method, route, handler)
+
+	var reqBody bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&reqBody).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &reqBody)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// decodeError returns the apierror body of a response
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) (code string, details map[string]interface{}) {
+	t.Helper()
+	var resp struct {
+		Error struct {
+			Code    string                 `json:"code"`
+			Details map[string]interface{} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode error response %q: %v", w.Body, err)
+	}
+	return resp.Error.Code, resp.Error.Details
+}
+
+func assertStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("status = %d, want %d: %s", w.Code, want, w.Body)
+	}
+}
+
+// buildWithRequestID builds an image through the request ID middleware,
+// sending requestID when it is set, and returns the stored image
+func buildWithRequestID(t *testing.T, requestID string) (*httptest.ResponseRecorder, *GoldenImage) {
+	t.Helper()
+	ir := newTestRegistry()
+	r := gin.New()
+	r.Use(logging.RequestID())
+	r.POST("/images/build", ir.buildImage)
+
+	body, _ := json.Marshal(BuildRequest{Name: "web", BaseOS: "debian-12", Platform: "docker"})
+	req := httptest.NewRequest(http.MethodPost, "/images/build", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if requestID != "" {
+		req.Header.Set(logging.RequestIDHeader, requestID)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assertStatus(t, w, http.StatusAccepted)
+
+	var resp struct {
+		Image GoldenImage `json:"image"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	image, err := ir.getImageByID(resp.Image.ID)
+	if err != nil || image == nil {
+		t.Fatalf("built image %s not stored: %v", resp.Image.ID, err)
+	}
+	return w, image
+}
+
+func TestBuildImagePreservesRequestID(t *testing.T) {
+	w, image := buildWithRequestID(t, "req-from-gateway")
+	if got := w.Header().Get(logging.RequestIDHeader); got != "req-from-gateway" {
+		t.Errorf("response X-Request-ID = %q, want the caller's ID echoed", got)
+	}
+	if got := image.Metadata[requestIDMetadataKey]; got != "req-from-gateway" {
+		t.Errorf("image metadata request ID = %v, want req-from-gateway", got)
+	}
+}
+
+func TestBuildImageGeneratesRequestID(t *testing.T) {
+	w, image := buildWithRequestID(t, "")
+	id := w.Header().Get(logging.RequestIDHeader)
+	if id == "" {
+		t.Fatal("no X-Request-ID generated")
+	}
+	if got := image.Metadata[requestIDMetadataKey]; got != id {
+		t.Errorf("image metadata request ID = %v, want %s", got, id)
+	}
+}
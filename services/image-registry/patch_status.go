@@ -0,0 +1,423 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultPatchStatusMaxAgeMinutes is how old a computed patch status may be
+// before it is recomputed
+const DefaultPatchStatusMaxAgeMinutes = 60
+
+// Worst offenders listed by GET /patch-status/summary
+const (
+	DefaultPatchOffenders = 10
+	MaxPatchOffenders     = 100
+)
+
+// Where a patch status took the installed packages from
+const (
+	PackagesFromSBOM  = "sbom"
+	PackagesFromBuild = "build"
+	PackagesFromScan  = "scan"
+)
+
+// severityRank orders severities from least to most severe
+var severityRank = map[string]int{
+	"unknown":  0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// PackagePatch is an installed package with a fixed version available
+type PackagePatch struct {
+	Package          string   `json:"package"`
+	InstalledVersion string   `json:"installed_version"`
+	FixedVersion     string   `json:"fixed_version"` // lowest version resolving every listed CVE
+	CVEs             []string `json:"cves"`
+	Severity         string   `json:"severity"` // worst severity among the CVEs
+}
+
+// PatchOffender is an image listed among the worst offenders of a summary
+type PatchOffender struct {
+	ImageID         string         `json:"image_id"`
+	ImageName       string         `json:"image_name"`
+	Version         string         `json:"version"`
+	Environment     string         `json:"environment"`
+	PatchesNeeded   int            `json:"patches_needed"`
+	SeveritySummary map[string]int `json:"severity_summary"`
+	LastChecked     time.Time      `json:"last_checked"`
+}
+
+// PatchSummary aggregates the patch status of every image
+type PatchSummary struct {
+	TotalImages      int             `json:"total_images"`
+	UpToDate         int             `json:"up_to_date"`
+	NeedingPatches   int             `json:"needing_patches"`
+	NotScanned       int             `json:"not_scanned"`
+	OutstandingFixes map[string]int  `json:"outstanding_fixes"` // fixable CVEs by severity, summed over images
+	WorstOffenders   []PatchOffender `json:"worst_offenders"`
+	GeneratedAt      time.Time       `json:"generated_at"`
+}
+
+// patchStatusMaxAge returns the age beyond which a patch status is recomputed
+func patchStatusMaxAge() time.Duration {
+	minutes := DefaultPatchStatusMaxAgeMinutes
+	if v := os.Getenv("PATCH_STATUS_MAX_AGE_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			minutes = n
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// fixedVersionFor picks the lowest of Trivy's comma separated fixed
+// versions that is newer than installed. It returns "" when installed
+// already has every fix.
+func fixedVersionFor(installed, fixedVersions string) string {
+	var candidates []string
+	for _, v := range strings.Split(fixedVersions, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			candidates = append(candidates, v)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return compareVersions(candidates[i], candidates[j]) < 0
+	})
+	for _, v := range candidates {
+		if installed == "" || compareVersions(installed, v) < 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+// computePatchStatus works out which packages of an image have fixes for
+// the vulnerabilities of its latest scan. Installed versions come from the
+// SBOM components when there are any, then from the build's package list,
+// then from the scan itself. A package missing from the SBOM is no longer
+// in the image and its findings are dropped.
+func computePatchStatus(image *GoldenImage, components []SBOMComponent, latestVersion string, now time.Time) *PatchStatus {
+	status := &PatchStatus{
+		ImageID:         image.ID,
+		ImageName:       image.Name,
+		Environment:     image.Environment,
+		CurrentVersion:  image.Version,
+		LatestVersion:   latestVersion,
+		Patches:         []PackagePatch{},
+		CVEsFixed:       []string{},
+		UnfixedCVEs:     []string{},
+		SeveritySummary: severitySummary(nil),
+		Scanned:         !image.LastScanned.IsZero(),
+		ScannedAt:       image.LastScanned,
+		LastChecked:     now,
+	}
+
+	installed := map[string]string{}
+	switch {
+	case len(components) > 0:
+		status.PackageSource = PackagesFromSBOM
+		for _, comp := range components {
+			installed[comp.Name] = comp.Version
+		}
+	case len(image.Packages) > 0:
+		status.PackageSource = PackagesFromBuild
+		installed = packageVersions(image.Packages)
+	default:
+		status.PackageSource = PackagesFromScan
+	}
+
+	patches := map[string]*PackagePatch{}
+	fixable := map[string]string{} // CVE -> worst severity
+	unfixed := map[string]bool{}
+	seen := map[string]bool{} // package/CVE pairs, Trivy reports some per target
+	for _, v := range image.Vulnerabilities {
+		key := v.PackageName + "/" + v.CVE
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		version := v.InstalledVersion
+		if known, ok := installed[v.PackageName]; ok && known != "" {
+			version = known
+		} else if !ok && status.PackageSource == PackagesFromSBOM && v.PackageName != "" {
+			continue
+		}
+
+		if v.FixVersion == "" {
+			unfixed[v.CVE] = true
+			continue
+		}
+		fixed := fixedVersionFor(version, v.FixVersion)
+		if fixed == "" {
+			continue
+		}
+
+		patch, ok := patches[v.PackageName]
+		if !ok {
+			patch = &PackagePatch{Package: v.PackageName, InstalledVersion: version, Severity: "unknown"}
+			patches[v.PackageName] = patch
+		}
+		if compareVersions(fixed, patch.FixedVersion) > 0 {
+			patch.FixedVersion = fixed
+		}
+		patch.CVEs = append(patch.CVEs, v.CVE)
+		severity := normalizeSeverity(v.Severity)
+		if severityRank[severity] > severityRank[patch.Severity] {
+			patch.Severity = severity
+		}
+		if current, ok := fixable[v.CVE]; !ok || severityRank[severity] > severityRank[current] {
+			fixable[v.CVE] = severity
+		}
+	}
+
+	for _, patch := range patches {
+		sort.Strings(patch.CVEs)
+		status.Patches = append(status.Patches, *patch)
+	}
+	sort.Slice(status.Patches, func(i, j int) bool {
+		a, b := status.Patches[i], status.Patches[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] > severityRank[b.Severity]
+		}
+		return a.Package < b.Package
+	})
+
+	// A CVE also found in a package without a fix isn't resolved by patching
+	for cve, severity := range fixable {
+		if unfixed[cve] {
+			continue
+		}
+		status.CVEsFixed = append(status.CVEsFixed, cve)
+		status.SeveritySummary[severity]++
+	}
+	for cve := range unfixed {
+		status.UnfixedCVEs = append(status.UnfixedCVEs, cve)
+	}
+	sort.Strings(status.CVEsFixed)
+	sort.Strings(status.UnfixedCVEs)
+
+	status.PatchesNeeded = len(status.Patches)
+	status.UpToDate = status.Scanned && status.PatchesNeeded == 0
+	return status
+}
+
+func normalizeSeverity(severity string) string {
+	severity = strings.ToLower(severity)
+	if _, ok := severityRank[severity]; ok {
+		return severity
+	}
+	return "unknown"
+}
+
+// latestVersion returns the newest version among images sharing a name
+func (ir *ImageRegistry) latestVersion(image *GoldenImage) (string, error) {
+	images, err := ir.imagesByName(image.Name)
+	if err != nil {
+		return "", err
+	}
+	latest := image.Version
+	for _, img := range images {
+		if compareVersions(img.Version, latest) > 0 {
+			latest = img.Version
+		}
+	}
+	return latest, nil
+}
+
+// patchStatus returns the stored patch status of an image, recomputing it
+// when refresh is set, it is older than PATCH_STATUS_MAX_AGE_MINUTES, or the
+// image has been scanned since
+func (ir *ImageRegistry) patchStatus(image *GoldenImage, refresh bool) (*PatchStatus, error) {
+	image = ir.snapshotImage(image)
+
+	if !refresh {
+		stored, err := ir.loadPatchStatus(image.ID)
+		if err != nil {
+			logger.WithError(err).WithField("image_id", image.ID).Warn("Failed to load patch status, recomputing")
+		}
+		if stored != nil && time.Since(stored.LastChecked) <= patchStatusMaxAge() && !image.LastScanned.After(stored.ScannedAt) {
+			// Promotion moves an image without changing its packages
+			copied := *stored
+			copied.Environment = image.Environment
+			return &copied, nil
+		}
+	}
+
+	components, err := ir.loadSBOMComponents(image.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SBOM components: %w", err)
+	}
+	latest, err := ir.latestVersion(image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the latest version: %w", err)
+	}
+
+	status := computePatchStatus(image, components, latest, time.Now())
+	if err := ir.storePatchStatus(status); err != nil {
+		logger.WithError(err).WithField("image_id", image.ID).Error("Failed to store patch status")
+	}
+	return status, nil
+}
+
+func (ir *ImageRegistry) loadPatchStatus(imageID string) (*PatchStatus, error) {
+	if ir.db != nil {
+		return ir.db.GetPatchStatus(imageID)
+	}
+
+	ir.mu.RLock()
+	defer ir.mu.RUnlock()
+	return ir.patches[imageID], nil
+}
+
+func (ir *ImageRegistry) storePatchStatus(status *PatchStatus) error {
+	if ir.db != nil {
+		return ir.db.SavePatchStatus(status)
+	}
+
+	ir.mu.Lock()
+	ir.patches[status.ImageID] = status
+	ir.mu.Unlock()
+	return nil
+}
+
+// getPatchStatus reports which packages of an image have fixes available.
+// ?refresh=true recomputes the status regardless of its age.
+func (ir *ImageRegistry) getPatchStatus(c *gin.Context) {
+	image := ir.lookupImage(c)
+	if image == nil {
+		return
+	}
+
+	status, err := ir.patchStatus(image, c.Query("refresh") == "true")
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).WithField("image_id", image.ID).Error("Failed to compute patch status")
+		apierror.RespondError(c, apierror.Internal("Failed to compute patch status"))
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// getPatchSummary aggregates patch status across images, optionally
+// filtered by ?environment=, listing up to ?limit= worst offenders
+func (ir *ImageRegistry) getPatchSummary(c *gin.Context) {
+	environment := c.Query("environment")
+	if environment != "" && !isValidEnvironment(environment) {
+		apierror.RespondError(c, apierror.Validation(fmt.Sprintf("unknown environment %q", environment)))
+		return
+	}
+	limit := DefaultPatchOffenders
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxPatchOffenders {
+			apierror.RespondError(c, apierror.Validation(fmt.Sprintf("limit must be between 1 and %d", MaxPatchOffenders)))
+			return
+		}
+		limit = n
+	}
+
+	images := filterByEnvironment(ir.cachedImages(), environment)
+	if ir.db != nil {
+		var err error
+		if environment != "" {
+			images, err = ir.db.ListImagesByEnvironment(environment)
+		} else {
+			images, err = ir.db.ListImages()
+		}
+		if err != nil {
+			logging.ForRequest(logger, c).WithError(err).Error("Failed to list images from database")
+			apierror.RespondError(c, apierror.Internal("Failed to list images"))
+			return
+		}
+	}
+
+	statuses := make([]*PatchStatus, 0, len(images))
+	for _, img := range images {
+		// Compute against the cached copy so scans in flight are seen
+		image, err := ir.getImageByID(img.ID)
+		if err != nil || image == nil {
+			continue
+		}
+		status, err := ir.patchStatus(image, false)
+		if err != nil {
+			logging.ForRequest(logger, c).WithError(err).WithField("image_id", image.ID).Error("Failed to compute patch status")
+			apierror.RespondError(c, apierror.Internal("Failed to compute patch status"))
+			return
+		}
+		statuses = append(statuses, status)
+	}
+
+	c.JSON(http.StatusOK, summarizePatchStatus(statuses, limit, time.Now()))
+}
+
+// summarizePatchStatus counts images by patch state and ranks those needing
+// patches by their most severe fixable CVEs, then by patch count
+func summarizePatchStatus(statuses []*PatchStatus, limit int, now time.Time) PatchSummary {
+	summary := PatchSummary{
+		TotalImages:      len(statuses),
+		OutstandingFixes: severitySummary(nil),
+		WorstOffenders:   []PatchOffender{},
+		GeneratedAt:      now,
+	}
+
+	var offenders []*PatchStatus
+	for _, status := range statuses {
+		switch {
+		case !status.Scanned:
+			summary.NotScanned++
+		case status.UpToDate:
+			summary.UpToDate++
+		}
+		if status.PatchesNeeded == 0 {
+			continue
+		}
+		summary.NeedingPatches++
+		for severity, n := range status.SeveritySummary {
+			summary.OutstandingFixes[severity] += n
+		}
+		offenders = append(offenders, status)
+	}
+
+	order := []string{"critical", "high", "medium", "low", "unknown"}
+	sort.Slice(offenders, func(i, j int) bool {
+		a, b := offenders[i], offenders[j]
+		for _, severity := range order {
+			if a.SeveritySummary[severity] != b.SeveritySummary[severity] {
+				return a.SeveritySummary[severity] > b.SeveritySummary[severity]
+			}
+		}
+		if a.PatchesNeeded != b.PatchesNeeded {
+			return a.PatchesNeeded > b.PatchesNeeded
+		}
+		return a.ImageID < b.ImageID
+	})
+	if len(offenders) > limit {
+		offenders = offenders[:limit]
+	}
+	for _, status := range offenders {
+		summary.WorstOffenders = append(summary.WorstOffenders, PatchOffender{
+			ImageID:         status.ImageID,
+			ImageName:       status.ImageName,
+			Version:         status.CurrentVersion,
+			Environment:     status.Environment,
+			PatchesNeeded:   status.PatchesNeeded,
+			SeveritySummary: status.SeveritySummary,
+			LastChecked:     status.LastChecked,
+		})
+	}
+
+	return summary
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFixedVersionFor(t *testing.T) {
+	tests := []struct {
+		installed, fixed, want string
+	}{
+		{"1.1.1k", "1.1.1t", "1.1.1t"},
+		{"3.0.2", "1.1.1t, 3.0.8", "3.0.8"},
+		{"1.0.2", "3.0.8, 1.1.1t", "1.1.1t"},
+		{"3.0.8", "3.0.8", ""},
+		{"3.0.9", "1.1.1t, 3.0.8", ""},
+		{"", "2.4.1", "2.4.1"},
+		{"2.36-9ubuntu1", "2.36-9ubuntu1.2", "2.36-9ubuntu1.2"},
+	}
+	for _, tt := range tests {
+		if got := fixedVersionFor(tt.installed, tt.fixed); got != tt.want {
+			t.Errorf("fixedVersionFor(%q, %q) = %q, want %q", tt.installed, tt.fixed, got, tt.want)
+		}
+	}
+}
+
+func scannedImage(id string, vulnerabilities ...Vulnerability) *GoldenImage {
+	return &GoldenImage{
+		ID:              id,
+		Name:            "ubuntu-base",
+		Version:         "1.0.0",
+		Environment:     EnvDev,
+		Packages:        []string{"openssl=3.0.2", "curl", "zlib=1.2.11"},
+		Vulnerabilities: vulnerabilities,
+		LastScanned:     time.Now().Add(-time.Hour),
+	}
+}
+
+func TestComputePatchStatus(t *testing.T) {
+	image := scannedImage("img-1",
+		Vulnerability{CVE: "CVE-2023-0286", Severity: "high", PackageName: "openssl", InstalledVersion: "3.0.2", FixVersion: "3.0.8"},
+		Vulnerability{CVE: "CVE-2024-0727", Severity: "medium", PackageName: "openssl", InstalledVersion: "3.0.2", FixVersion: "1.1.1x, 3.0.13"},
+		Vulnerability{CVE: "CVE-2023-38545", Severity: "critical", PackageName: "curl", InstalledVersion: "7.81.0", FixVersion: "7.81.0-1ubuntu1.14"},
+		// Reported again for a second target
+		Vulnerability{CVE: "CVE-2023-38545", Severity: "critical", PackageName: "curl", InstalledVersion: "7.81.0", FixVersion: "7.81.0-1ubuntu1.14"},
+		Vulnerability{CVE: "CVE-2022-37434", Severity: "critical", PackageName: "zlib", InstalledVersion: "1.2.11", FixVersion: ""},
+		// The scan saw an older version than the build installed
+		Vulnerability{CVE: "CVE-2018-25032", Severity: "high", PackageName: "zlib", InstalledVersion: "1.2.10", FixVersion: "1.2.11"},
+	)
+
+	status := computePatchStatus(image, nil, "1.0.3", time.Now())
+
+	if status.PackageSource != PackagesFromBuild || !status.Scanned || status.UpToDate {
+		t.Fatalf("status = %+v, want a scanned image needing patches from the build package list", status)
+	}
+	if status.PatchesNeeded != 2 || len(status.Patches) != 2 {
+		t.Fatalf("patches = %+v, want curl and openssl", status.Patches)
+	}
+	curl, openssl := status.Patches[0], status.Patches[1]
+	if curl.Package != "curl" || curl.Severity != "critical" || fmt.Sprint(curl.CVEs) != "[CVE-2023-38545]" {
+		t.Errorf("first patch = %+v, want curl for the critical CVE once", curl)
+	}
+	if openssl.Package != "openssl" || openssl.FixedVersion != "3.0.13" || openssl.Severity != "high" || len(openssl.CVEs) != 2 {
+		t.Errorf("openssl patch = %+v, want 3.0.13 resolving both CVEs", openssl)
+	}
+	if fmt.Sprint(status.CVEsFixed) != "[CVE-2023-0286 CVE-2023-38545 CVE-2024-0727]" {
+		t.Errorf("cves fixed = %v", status.CVEsFixed)
+	}
+	if fmt.Sprint(status.UnfixedCVEs) != "[CVE-2022-37434]" {
+		t.Errorf("unfixed cves = %v", status.UnfixedCVEs)
+	}
+	if status.SeveritySummary["critical"] != 1 || status.SeveritySummary["high"] != 1 || status.SeveritySummary["medium"] != 1 {
+		t.Errorf("severity summary = %v", status.SeveritySummary)
+	}
+	if status.CurrentVersion != "1.0.0" || status.LatestVersion != "1.0.3" {
+		t.Errorf("versions = %s, %s", status.CurrentVersion, status.LatestVersion)
+	}
+}
+
+func TestComputePatchStatusFromSBOM(t *testing.T) {
+	image := scannedImage("img-1",
+		Vulnerability{CVE: "CVE-2023-0286", Severity: "high", PackageName: "openssl", InstalledVersion: "3.0.2", FixVersion: "3.0.8"},
+		Vulnerability{CVE: "CVE-2023-38545", Severity: "critical", PackageName: "curl", InstalledVersion: "7.81.0", FixVersion: "7.88.1"},
+	)
+	// Since the scan openssl was upgraded and curl removed
+	components := []SBOMComponent{{Name: "openssl", Version: "3.0.8"}, {Name: "bash", Version: "5.1"}}
+
+	status := computePatchStatus(image, components, "1.0.0", time.Now())
+	if status.PackageSource != PackagesFromSBOM || !status.UpToDate || status.PatchesNeeded != 0 || len(status.CVEsFixed) != 0 {
+		t.Errorf("status = %+v, want up to date from the SBOM", status)
+	}
+}
+
+func TestComputePatchStatusNotScanned(t *testing.T) {
+	image := &GoldenImage{ID: "img-1", Version: "1.0.0"}
+	status := computePatchStatus(image, nil, "1.0.0", time.Now())
+	if status.Scanned || status.UpToDate || status.PackageSource != PackagesFromScan {
+		t.Errorf("status = %+v, want an unscanned image not reported up to date", status)
+	}
+}
+
+func TestPatchStatusFreshness(t *testing.T) {
+	image := scannedImage("img-1",
+		Vulnerability{CVE: "CVE-2023-0286", Severity: "high", PackageName: "openssl", FixVersion: "3.0.8"},
+	)
+	ir := newTestRegistry(image)
+
+	first, err := ir.patchStatus(image, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := ir.patchStatus(image, false)
+	if !again.LastChecked.Equal(first.LastChecked) {
+		t.Errorf("fresh status was recomputed")
+	}
+
+	// A new scan makes the stored status stale
+	image.Vulnerabilities = nil
+	image.LastScanned = time.Now()
+	rescanned, _ := ir.patchStatus(image, false)
+	if !rescanned.UpToDate || rescanned.LastChecked.Equal(first.LastChecked) {
+		t.Errorf("status after rescan = %+v, want it recomputed as up to date", rescanned)
+	}
+
+	// So does age
+	ir.patches[image.ID].LastChecked = time.Now().Add(-2 * patchStatusMaxAge())
+	aged, _ := ir.patchStatus(image, false)
+	if time.Since(aged.LastChecked) > time.Minute {
+		t.Errorf("status checked %s was served past its max age", aged.LastChecked)
+	}
+}
+
+func TestGetPatchStatus(t *testing.T) {
+	latest := scannedImage("img-2")
+	latest.Version = "1.0.1"
+	image := scannedImage("img-1",
+		Vulnerability{CVE: "CVE-2023-0286", Severity: "high", PackageName: "openssl", InstalledVersion: "3.0.2", FixVersion: "3.0.8"},
+	)
+	ir := newTestRegistry(image, latest)
+
+	w := serve(ir.getPatchStatus, http.MethodGet, "/images/:id/patch-status", "/images/img-1/patch-status?refresh=true", nil)
+	assertStatus(t, w, http.StatusOK)
+	var status PatchStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.UpToDate || status.PatchesNeeded != 1 || status.LatestVersion != "1.0.1" || fmt.Sprint(status.CVEsFixed) != "[CVE-2023-0286]" {
+		t.Errorf("status = %+v", status)
+	}
+
+	w = serve(ir.getPatchStatus, http.MethodGet, "/images/:id/patch-status", "/images/missing/patch-status", nil)
+	assertStatus(t, w, http.StatusNotFound)
+}
+
+func TestGetPatchSummary(t *testing.T) {
+	critical := scannedImage("img-critical",
+		Vulnerability{CVE: "CVE-2023-38545", Severity: "critical", PackageName: "curl", InstalledVersion: "7.81.0", FixVersion: "7.88.1"},
+	)
+	many := scannedImage("img-many",
+		Vulnerability{CVE: "CVE-2023-0286", Severity: "high", PackageName: "openssl", InstalledVersion: "3.0.2", FixVersion: "3.0.8"},
+		Vulnerability{CVE: "CVE-2023-4911", Severity: "high", PackageName: "glibc", InstalledVersion: "2.35", FixVersion: "2.35-0ubuntu3.4"},
+	)
+	many.Environment = EnvProd
+	clean := scannedImage("img-clean")
+	unscanned := &GoldenImage{ID: "img-new", Name: "rhel-base", Version: "1.0.0", Environment: EnvDev}
+	ir := newTestRegistry(critical, many, clean, unscanned)
+
+	w := serve(ir.getPatchSummary, http.MethodGet, "/patch-status/summary", "/patch-status/summary", nil)
+	assertStatus(t, w, http.StatusOK)
+	var summary PatchSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalImages != 4 || summary.UpToDate != 1 || summary.NeedingPatches != 2 || summary.NotScanned != 1 {
+		t.Errorf("summary counts = %+v", summary)
+	}
+	if summary.OutstandingFixes["critical"] != 1 || summary.OutstandingFixes["high"] != 2 {
+		t.Errorf("outstanding fixes = %v", summary.OutstandingFixes)
+	}
+	if len(summary.WorstOffenders) != 2 || summary.WorstOffenders[0].ImageID != "img-critical" || summary.WorstOffenders[1].PatchesNeeded != 2 {
+		t.Errorf("worst offenders = %+v, want the critical image first", summary.WorstOffenders)
+	}
+
+	w = serve(ir.getPatchSummary, http.MethodGet, "/patch-status/summary", "/patch-status/summary?environment=prod&limit=1", nil)
+	assertStatus(t, w, http.StatusOK)
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	if summary.TotalImages != 1 || len(summary.WorstOffenders) != 1 || summary.WorstOffenders[0].ImageID != "img-many" {
+		t.Errorf("prod summary = %+v", summary)
+	}
+
+	w = serve(ir.getPatchSummary, http.MethodGet, "/patch-status/summary", "/patch-status/summary?limit=0", nil)
+	assertStatus(t, w, http.StatusBadRequest)
+}
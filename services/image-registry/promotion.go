@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Image lifecycle environments, in promotion order
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+var promotionOrder = []string{EnvDev, EnvStaging, EnvProd}
+
+// Promotion records an image moving between environments
+type Promotion struct {
+	ID              string    `json:"id"`
+	ImageID         string    `json:"image_id"`
+	FromEnvironment string    `json:"from_environment"`
+	ToEnvironment   string    `json:"to_environment"`
+	PromotedBy      string    `json:"promoted_by"`
+	PromotedAt      time.Time `json:"promoted_at"`
+}
+
+// PromoteRequest is the body of POST /images/:id/promote
+type PromoteRequest struct {
+	PromotedBy        string `json:"promoted_by"`
+	TargetEnvironment string `json:"target_environment,omitempty"`
+}
+
+// nextEnvironment returns the stage after env, or "" if env is the last stage
+func nextEnvironment(env string) string {
+	for i, e := range promotionOrder {
+		if e == env && i+1 < len(promotionOrder) {
+			return promotionOrder[i+1]
+		}
+	}
+	return ""
+}
+
+// isValidEnvironment reports whether env is a known lifecycle stage
+func isValidEnvironment(env string) bool {
+	for _, e := range promotionOrder {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredCompliance returns the compliance frameworks an image must declare
+// before entering env. Configured with REQUIRED_COMPLIANCE_STAGING and
+// REQUIRED_COMPLIANCE_PROD as comma separated lists; prod requires SOC2
+// unless overridden.
+func requiredCompliance(env string) []string {
+	defaults := map[string]string{
+		EnvStaging: "",
+		EnvProd:    "SOC2",
+	}
+
+	value, ok := os.LookupEnv("REQUIRED_COMPLIANCE_" + strings.ToUpper(env))
+	if !ok {
+		value = defaults[env]
+	}
+
+	var frameworks []string
+	for _, f := range strings.Split(value, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			frameworks = append(frameworks, f)
+		}
+	}
+	return frameworks
+}
+
+// promotionBlockers returns every reason an image can't enter target.
+// Callers must hold ir.mu.
+func promotionBlockers(image *GoldenImage, target string) []string {
+	var blockers []string
+
+	if image.LastScanned.IsZero() {
+		blockers = append(blockers, "image has not been scanned for vulnerabilities")
+	} else {
+		critical := 0
+		for _, v := range image.Vulnerabilities {
+			if v.Severity == "critical" {
+				critical++
+			}
+		}
+		if critical > 0 {
+			blockers = append(blockers, fmt.Sprintf("latest scan found %d critical vulnerabilities", critical))
+		}
+	}
+
+	if image.Attestation == nil {
+		blockers = append(blockers, "image has no Cosign attestation")
+	} else if !image.Attestation.Verified {
+		blockers = append(blockers, "image Cosign attestation is not verified")
+	}
+
+	declared := make(map[string]bool, len(image.Compliance))
+	for _, c := range image.Compliance {
+		declared[c] = true
+	}
+	for _, required := range requiredCompliance(target) {
+		if !declared[required] {
+			blockers = append(blockers, fmt.Sprintf("missing required compliance framework %s", required))
+		}
+	}
+
+	return blockers
+}
+
+// promoteImage moves an image to the next environment if it passes the promotion gates
+func (ir *ImageRegistry) promoteImage(c *gin.Context) {
+	image := ir.lookupImage(c)
+	if image == nil {
+		return
+	}
+
+	var req PromoteRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.RespondError(c, apierror.Validation(err.Error()))
+			return
+		}
+	}
+	if req.PromotedBy == "" {
+		req.PromotedBy = c.GetHeader("X-User")
+	}
+	if req.PromotedBy == "" {
+		apierror.RespondError(c, apierror.Validation("promoted_by is required"))
+		return
+	}
+
+	// Check the gates and move the image under one lock so concurrent
+	// promotions or a re-scan can't change the image in between
+	ir.mu.Lock()
+	current := image.Environment
+	if current == "" {
+		current = EnvDev
+	}
+
+	target := nextEnvironment(current)
+	if target == "" {
+		ir.mu.Unlock()
+		apierror.RespondError(c, apierror.Conflict(fmt.Sprintf("image is already in %s", current)).WithDetails(gin.H{
+			"environment": current,
+		}))
+		return
+	}
+	if req.TargetEnvironment != "" && req.TargetEnvironment != target {
+		ir.mu.Unlock()
+		apierror.RespondError(c, apierror.Validation(fmt.Sprintf("image in %s can only be promoted to %s", current, target)))
+		return
+	}
+
+	if blockers := promotionBlockers(image, target); len(blockers) > 0 {
+		ir.mu.Unlock()
+		apierror.RespondError(c, apierror.Unprocessable("promotion criteria not met").WithDetails(gin.H{
+			"id":       image.ID,
+			"from":     current,
+			"to":       target,
+			"blockers": blockers,
+		}))
+		return
+	}
+
+	image.Environment = target
+	ir.mu.Unlock()
+
+	promotion := Promotion{
+		ID:              uuid.New().String(),
+		ImageID:         image.ID,
+		FromEnvironment: current,
+		ToEnvironment:   target,
+		PromotedBy:      req.PromotedBy,
+		PromotedAt:      time.Now(),
+	}
+
+	if err := ir.saveImage(image); err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to update image in database after promotion")
+	}
+	if err := ir.recordPromotion(promotion); err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to record promotion")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":        image.ID,
+		"status":    "promoted",
+		"promotion": promotion,
+	})
+}
+
+// getPromotions returns the promotion history of an image
+func (ir *ImageRegistry) getPromotions(c *gin.Context) {
+	image := ir.lookupImage(c)
+	if image == nil {
+		return
+	}
+
+	var promotions []Promotion
+	if ir.db != nil {
+		dbPromotions, err := ir.db.ListPromotions(image.ID)
+		if err != nil {
+			logging.ForRequest(logger, c).WithError(err).Error("Failed to list promotions")
+			apierror.RespondError(c, apierror.Internal("Failed to load promotion history"))
+			return
+		}
+		promotions = dbPromotions
+	} else {
+		ir.mu.RLock()
+		promotions = append([]Promotion{}, ir.promotions[image.ID]...)
+		ir.mu.RUnlock()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":          image.ID,
+		"environment": image.Environment,
+		"total":       len(promotions),
+		"promotions":  promotions,
+	})
+}
+
+// recordPromotion stores a promotion in the database or in memory
+func (ir *ImageRegistry) recordPromotion(p Promotion) error {
+	if ir.db != nil {
+		return ir.db.SavePromotion(&p)
+	}
+
+	ir.mu.Lock()
+	ir.promotions[p.ImageID] = append(ir.promotions[p.ImageID], p)
+	ir.mu.Unlock()
+	return nil
+}
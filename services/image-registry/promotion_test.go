@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func promotableImage() *GoldenImage {
+	return &GoldenImage{
+		ID:          "img-1",
+		Environment: EnvDev,
+		Compliance:  []string{"SOC2"},
+		LastScanned: time.Now(),
+		Attestation: &Attestation{Signature: "sig", Verified: true},
+	}
+}
+
+func TestPromoteImageConcurrently(t *testing.T) {
+	image := promotableImage()
+	ir := newTestRegistry(image)
+
+	const requests = 20
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := serve(ir.promoteImage, http.MethodPost, "/images/:id/promote", "/images/img-1/promote",
+				PromoteRequest{PromotedBy: "alice", TargetEnvironment: EnvStaging})
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	promoted := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			promoted++
+		case http.StatusBadRequest:
+			// Lost the race: the image is already in staging
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if promoted != 1 {
+		t.Fatalf("%d requests promoted the image to staging, want exactly 1", promoted)
+	}
+	if image.Environment != EnvStaging {
+		t.Fatalf("environment = %s, want staging", image.Environment)
+	}
+	if got := len(ir.promotions["img-1"]); got != 1 {
+		t.Fatalf("recorded %d promotions, want 1", got)
+	}
+}
+
+func TestPromoteImageBlocked(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(image *GoldenImage)
+	}{
+		{"unverified signature", func(image *GoldenImage) { image.Attestation.Verified = false }},
+		{"unsigned", func(image *GoldenImage) { image.Attestation = nil }},
+		{"not scanned", func(image *GoldenImage) { image.LastScanned = time.Time{} }},
+		{"critical vulnerability", func(image *GoldenImage) {
+			image.Vulnerabilities = []Vulnerability{{ID: "CVE-1", Severity: "critical"}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := promotableImage()
+			tt.modify(image)
+			ir := newTestRegistry(image)
+
+			w := serve(ir.promoteImage, http.MethodPost, "/images/:id/promote", "/images/img-1/promote",
+				PromoteRequest{PromotedBy: "alice"})
+			assertStatus(t, w, http.StatusUnprocessableEntity)
+			if image.Environment != EnvDev {
+				t.Fatalf("environment = %s after a blocked promotion", image.Environment)
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultSyftURL         = "http://syft.syft-system.svc.cluster.local:8080"
+	DefaultSBOMTimeout     = 10 * time.Minute
+	DefaultSBOMMaxAttempts = 3
+	DefaultSBOMRetryDelay  = 30 * time.Second
+)
+
+// SBOM formats we generate and serve, mapped to Syft output names
+var sbomFormats = map[string]string{
+	"cyclonedx": "cyclonedx-json",
+	"spdx":      "spdx-json",
+}
+
+// SBOMComponent is a package recorded in an image SBOM, indexed for search
+type SBOMComponent struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Type    string `json:"type,omitempty"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+// storedSBOM is a gzip compressed SBOM document
+type storedSBOM struct {
+	Format      string
+	Data        []byte
+	GeneratedAt time.Time
+}
+
+// SBOMGenerator produces SBOMs with a Syft HTTP wrapper and keeps them in
+// the database, or in memory when no database is configured
+type SBOMGenerator struct {
+	syftURL    string
+	httpClient *http.Client
+
+	// Failed generations are retried with a doubling delay
+	maxAttempts int
+	retryDelay  time.Duration
+	sleep       func(time.Duration)
+
+	documents  map[string]map[string]*storedSBOM // image ID -> format -> document
+	components map[string][]SBOMComponent        // image ID -> components
+	mu         sync.RWMutex
+}
+
+// NewSBOMGenerator creates a generator configured from SYFT_URL and
+// SBOM_MAX_ATTEMPTS
+func NewSBOMGenerator() *SBOMGenerator {
+	syftURL := os.Getenv("SYFT_URL")
+	if syftURL == "" {
+		syftURL = DefaultSyftURL
+	}
+
+	maxAttempts := DefaultSBOMMaxAttempts
+	if v := os.Getenv("SBOM_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxAttempts = n
+		}
+	}
+
+	return &SBOMGenerator{
+		syftURL:     strings.TrimRight(syftURL, "/"),
+		httpClient:  &http.Client{Timeout: DefaultSBOMTimeout},
+		maxAttempts: maxAttempts,
+		retryDelay:  DefaultSBOMRetryDelay,
+		sleep:       time.Sleep,
+		documents:   make(map[string]map[string]*storedSBOM),
+		components:  make(map[string][]SBOMComponent),
+	}
+}
+
+// generate asks Syft for an SBOM of imageRef in the given format. The
+// response is compressed as it streams in; for CycloneDX the components are
+// decoded from the same stream.
+func (g *SBOMGenerator) generate(ctx context.Context, imageRef, format string) ([]byte, []SBOMComponent, error) {
+	reqBody, _ := json.Marshal(map[string]string{
+		"image":  imageRef,
+		"output": sbomFormats[format],
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.syftURL+"/sbom", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create syft request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("syft request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, nil, fmt.Errorf("syft returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	tee := io.TeeReader(resp.Body, gz)
+
+	var components []SBOMComponent
+	if format == "cyclonedx" {
+		var doc struct {
+			Components []SBOMComponent `json:"components"`
+		}
+		if err := json.NewDecoder(tee).Decode(&doc); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode cyclonedx sbom: %w", err)
+		}
+		components = doc.Components
+	}
+	// Drain anything the decoder didn't consume so the stored copy is complete
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return nil, nil, fmt.Errorf("failed to read sbom: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to compress sbom: %w", err)
+	}
+
+	return compressed.Bytes(), components, nil
+}
+
+// generateSBOM builds SBOMs for every supported format and records the
+// outcome on the image's SBOM summary. It runs once the image has been
+// built, retrying failures since Syft can't pull an image that is still
+// being pushed.
+func (ir *ImageRegistry) generateSBOM(image *GoldenImage) {
+	g := ir.sboms
+
+	ir.mu.RLock()
+	id, imageRef := image.ID, image.RegistryURL
+	ir.mu.RUnlock()
+
+	generatedAt := time.Now()
+	var components []SBOMComponent
+	var genErr error
+	attempts := 0
+
+	if imageRef == "" {
+		genErr = fmt.Errorf("image has no registry URL")
+	} else {
+		delay := g.retryDelay
+		for attempts = 1; ; attempts++ {
+			generatedAt = time.Now()
+			components, genErr = ir.generateSBOMDocuments(id, imageRef, generatedAt)
+			if genErr == nil || attempts >= g.maxAttempts {
+				break
+			}
+			logger.WithError(genErr).WithFields(logrus.Fields{
+				"image_id": id,
+				"attempt":  attempts,
+				"max":      g.maxAttempts,
+				"retry_in": delay.String(),
+			}).Warn("SBOM generation failed, retrying")
+			g.sleep(delay)
+			delay *= 2
+		}
+	}
+
+	summary := map[string]interface{}{
+		"generated_at": generatedAt,
+		"attempts":     attempts,
+	}
+	if genErr != nil {
+		logger.WithError(genErr).WithField("image_id", id).Error("SBOM generation failed")
+		summary["status"] = "failed"
+		summary["error"] = genErr.Error()
+	} else {
+		if err := ir.storeSBOMComponents(id, components); err != nil {
+			logger.WithError(err).WithField("image_id", id).Error("Failed to index SBOM components")
+		}
+		summary["status"] = "complete"
+		summary["components"] = len(components)
+		summary["formats"] = []string{"cyclonedx", "spdx"}
+	}
+
+	// Persist a copy taken under the lock so handlers can serialize the
+	// cached image while it is written
+	ir.mu.Lock()
+	image.SBOM = summary
+	snapshot := *image
+	ir.mu.Unlock()
+
+	if ir.db != nil {
+		if err := ir.db.SaveImage(&snapshot); err != nil {
+			logger.WithError(err).Error("Failed to update image in database after SBOM generation")
+		}
+	}
+}
+
+// generateSBOMDocuments generates and stores the SBOM in every format,
+// returning the CycloneDX components
+func (ir *ImageRegistry) generateSBOMDocuments(id, imageRef string, generatedAt time.Time) ([]SBOMComponent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSBOMTimeout)
+	defer cancel()
+
+	var components []SBOMComponent
+	for format := range sbomFormats {
+		data, comps, err := ir.sboms.generate(ctx, imageRef, format)
+		if err != nil {
+			return nil, fmt.Errorf("%s generation failed: %w", format, err)
+		}
+		if format == "cyclonedx" {
+			components = comps
+		}
+		if err := ir.storeSBOM(id, format, data, generatedAt); err != nil {
+			return nil, fmt.Errorf("failed to store %s sbom: %w", format, err)
+		}
+	}
+	return components, nil
+}
+
+func (ir *ImageRegistry) storeSBOM(imageID, format string, data []byte, generatedAt time.Time) error {
+	if ir.db != nil {
+		return ir.db.SaveSBOM(imageID, format, data, generatedAt)
+	}
+
+	g := ir.sboms
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.documents[imageID] == nil {
+		g.documents[imageID] = make(map[string]*storedSBOM)
+	}
+	g.documents[imageID][format] = &storedSBOM{Format: format, Data: data, GeneratedAt: generatedAt}
+	return nil
+}
+
+func (ir *ImageRegistry) storeSBOMComponents(imageID string, components []SBOMComponent) error {
+	if ir.db != nil {
+		return ir.db.SaveSBOMComponents(imageID, components)
+	}
+
+	g := ir.sboms
+	g.mu.Lock()
+	g.components[imageID] = components
+	g.mu.Unlock()
+	return nil
+}
+
+func (ir *ImageRegistry) loadSBOMComponents(imageID string) ([]SBOMComponent, error) {
+	if ir.db != nil {
+		return ir.db.GetSBOMComponents(imageID)
+	}
+
+	g := ir.sboms
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.components[imageID], nil
+}
+
+func (ir *ImageRegistry) loadSBOM(imageID, format string) (*storedSBOM, error) {
+	if ir.db != nil {
+		return ir.db.GetSBOM(imageID, format)
+	}
+
+	g := ir.sboms
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.documents[imageID][format], nil
+}
+
+// getSBOM streams an image SBOM in the requested format
+func (ir *ImageRegistry) getSBOM(c *gin.Context) {
+	image := ir.lookupImage(c)
+	if image == nil {
+		return
+	}
+
+	format := c.DefaultQuery("format", "cyclonedx")
+	if _, ok := sbomFormats[format]; !ok {
+		apierror.RespondError(c, apierror.Validation("format must be cyclonedx or spdx"))
+		return
+	}
+
+	sbom, err := ir.loadSBOM(image.ID, format)
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to load SBOM")
+		apierror.RespondError(c, apierror.Internal("Failed to load SBOM"))
+		return
+	}
+	if sbom == nil {
+		apierror.RespondError(c, apierror.NotFound("SBOM not available").WithDetails(gin.H{
+			"sbom": image.SBOM,
+		}))
+		return
+	}
+
+	c.Header("Content-Type", "application/json")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s.json", image.ID, format))
+	c.Header("Last-Modified", sbom.GeneratedAt.UTC().Format(http.TimeFormat))
+
+	// Clients that accept gzip get the stored bytes as is
+	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		c.Status(http.StatusOK)
+		c.Writer.Write(sbom.Data)
+		return
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(sbom.Data))
+	if err != nil {
+		apierror.RespondError(c, apierror.Internal("Stored SBOM is corrupt"))
+		return
+	}
+	defer gz.Close()
+
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, gz); err != nil {
+		logging.ForRequest(logger, c).WithError(err).WithField("image_id", image.ID).Error("Failed to stream SBOM")
+	}
+}
+
+// SBOMMatch is an image containing a package matched by an SBOM search
+type SBOMMatch struct {
+	ImageID     string `json:"image_id"`
+	ImageName   string `json:"image_name"`
+	Version     string `json:"image_version"`
+	Platform    string `json:"platform"`
+	Environment string `json:"environment"`
+	Package     string `json:"package"`
+	PackageVer  string `json:"package_version"`
+	PURL        string `json:"purl,omitempty"`
+}
+
+// searchSBOM finds every image containing a package, optionally restricted to
+// versions below version_lt or equal to version
+func (ir *ImageRegistry) searchSBOM(c *gin.Context) {
+	pkg := c.Query("package")
+	if pkg == "" {
+		apierror.RespondError(c, apierror.Validation("package is required"))
+		return
+	}
+	versionLT := c.Query("version_lt")
+	versionEQ := c.Query("version")
+
+	var hits map[string][]SBOMComponent
+	if ir.db != nil {
+		var err error
+		hits, err = ir.db.FindSBOMComponents(pkg)
+		if err != nil {
+			logging.ForRequest(logger, c).WithError(err).Error("Failed to search SBOM components")
+			apierror.RespondError(c, apierror.Internal("Failed to search SBOMs"))
+			return
+		}
+	} else {
+		hits = make(map[string][]SBOMComponent)
+		ir.sboms.mu.RLock()
+		for imageID, components := range ir.sboms.components {
+			for _, comp := range components {
+				if comp.Name == pkg {
+					hits[imageID] = append(hits[imageID], comp)
+				}
+			}
+		}
+		ir.sboms.mu.RUnlock()
+	}
+
+	matches := []SBOMMatch{}
+	for imageID, components := range hits {
+		image, err := ir.getImageByID(imageID)
+		if err != nil || image == nil {
+			continue
+		}
+		for _, comp := range components {
+			if versionEQ != "" && comp.Version != versionEQ {
+				continue
+			}
+			if versionLT != "" && compareVersions(comp.Version, versionLT) >= 0 {
+				continue
+			}
+			matches = append(matches, SBOMMatch{
+				ImageID:     image.ID,
+				ImageName:   image.Name,
+				Version:     image.Version,
+				Platform:    image.Platform,
+				Environment: image.Environment,
+				Package:     comp.Name,
+				PackageVer:  comp.Version,
+				PURL:        comp.PURL,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"package":    pkg,
+		"version_lt": versionLT,
+		"total":      len(matches),
+		"matches":    matches,
+	})
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultTrivyURL        = "http://trivy.trivy-system.svc.cluster.local:8080"
+	DefaultScanMaxAgeHours = 24
+	DefaultScanConcurrency = 4
+	DefaultScanTimeout     = 10 * time.Minute
+)
+
+// Scan job states
+const (
+	ScanQueued   = "queued"
+	ScanScanning = "scanning"
+	ScanComplete = "complete"
+	ScanFailed   = "failed"
+)
+
+// ScanJob tracks an asynchronous vulnerability scan of an image
+type ScanJob struct {
+	ID          string         `json:"id"`
+	ImageID     string         `json:"image_id"`
+	Status      string         `json:"status"`
+	Error       string         `json:"error,omitempty"`
+	Summary     map[string]int `json:"severity_summary,omitempty"`
+	QueuedAt    time.Time      `json:"queued_at"`
+	StartedAt   *time.Time     `json:"started_at,omitempty"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+}
+
+// trivyReport mirrors the parts of Trivy's JSON report we consume
+type trivyReport struct {
+	Results []struct {
+		Target          string               `json:"Target"`
+		Vulnerabilities []trivyVulnerability `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+type trivyVulnerability struct {
+	VulnerabilityID  string `json:"VulnerabilityID"`
+	PkgName          string `json:"PkgName"`
+	InstalledVersion string `json:"InstalledVersion"`
+	FixedVersion     string `json:"FixedVersion"`
+	Severity         string `json:"Severity"`
+	Title            string `json:"Title"`
+	Description      string `json:"Description"`
+	CVSS             map[string]struct {
+		V2Score float64 `json:"V2Score"`
+		V3Score float64 `json:"V3Score"`
+	} `json:"CVSS"`
+}
+
+// Scanner runs vulnerability scans against a Trivy server
+type Scanner struct {
+	trivyURL   string
+	httpClient *http.Client
+	maxAge     time.Duration
+	slots      chan struct{}
+
+	jobs map[string]*ScanJob // latest job per image ID
+	mu   sync.RWMutex
+}
+
+// NewScanner creates a scanner configured from the environment
+func NewScanner() *Scanner {
+	trivyURL := os.Getenv("TRIVY_URL")
+	if trivyURL == "" {
+		trivyURL = DefaultTrivyURL
+	}
+
+	maxAgeHours := DefaultScanMaxAgeHours
+	if v := os.Getenv("SCAN_MAX_AGE_HOURS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxAgeHours = n
+		}
+	}
+
+	concurrency := DefaultScanConcurrency
+	if v := os.Getenv("SCAN_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			concurrency = n
+		}
+	}
+
+	return &Scanner{
+		trivyURL:   strings.TrimRight(trivyURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultScanTimeout},
+		maxAge:     time.Duration(maxAgeHours) * time.Hour,
+		slots:      make(chan struct{}, concurrency),
+		jobs:       make(map[string]*ScanJob),
+	}
+}
+
+// Scan asks Trivy to scan an image reference and returns the parsed findings
+func (s *Scanner) Scan(ctx context.Context, imageRef string) ([]Vulnerability, error) {
+	reqBody, _ := json.Marshal(map[string]string{"image": imageRef})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.trivyURL+"/scan", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scan request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("trivy request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("trivy returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var report trivyReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode trivy report: %w", err)
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			description := v.Title
+			if description == "" {
+				description = v.Description
+			}
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:               uuid.New().String(),
+				CVE:              v.VulnerabilityID,
+				Severity:         strings.ToLower(v.Severity),
+				Description:      description,
+				FixVersion:       v.FixedVersion,
+				PackageName:      v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				CVSSScore:        cvssScore(v),
+			})
+		}
+	}
+
+	return vulnerabilities, nil
+}
+
+// cvssScore prefers the NVD v3 score, then the highest vendor v3 score,
+// then any v2 score
+func cvssScore(v trivyVulnerability) float64 {
+	if nvd, ok := v.CVSS["nvd"]; ok && nvd.V3Score > 0 {
+		return nvd.V3Score
+	}
+
+	var v3, v2 float64
+	for _, score := range v.CVSS {
+		if score.V3Score > v3 {
+			v3 = score.V3Score
+		}
+		if score.V2Score > v2 {
+			v2 = score.V2Score
+		}
+	}
+	if v3 > 0 {
+		return v3
+	}
+	return v2
+}
+
+// severitySummary counts vulnerabilities per severity level
+func severitySummary(vulnerabilities []Vulnerability) map[string]int {
+	summary := map[string]int{
+		"critical": 0,
+		"high":     0,
+		"medium":   0,
+		"low":      0,
+		"unknown":  0,
+	}
+	for _, v := range vulnerabilities {
+		if _, ok := summary[v.Severity]; ok {
+			summary[v.Severity]++
+		} else {
+			summary["unknown"]++
+		}
+	}
+	return summary
+}
+
+// latestJob returns the most recent scan job for an image
+func (s *Scanner) latestJob(imageID string) *ScanJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[imageID]
+	if !ok {
+		return nil
+	}
+	snapshot := *job
+	return &snapshot
+}
+
+// updateJob applies fn to a job under the scanner lock
+func (s *Scanner) updateJob(job *ScanJob, fn func(*ScanJob)) {
+	s.mu.Lock()
+	fn(job)
+	s.mu.Unlock()
+}
+
+// enqueueScan records a queued scan job for an image and runs it in the background.
+// If a scan for the image is already queued or running, that job is returned instead.
+func (ir *ImageRegistry) enqueueScan(image *GoldenImage) *ScanJob {
+	job, snapshot, created := ir.scanner.newJob(image.ID)
+	if created {
+		go ir.runScan(job, image)
+	}
+	return snapshot
+}
+
+// newJob records a queued job for an image. If a scan is already queued or
+// running, its snapshot is returned and created is false.
+func (s *Scanner) newJob(imageID string) (job *ScanJob, snapshot *ScanJob, created bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.jobs[imageID]; ok && (existing.Status == ScanQueued || existing.Status == ScanScanning) {
+		copied := *existing
+		return existing, &copied, false
+	}
+	job = &ScanJob{
+		ID:       uuid.New().String(),
+		ImageID:  imageID,
+		Status:   ScanQueued,
+		QueuedAt: time.Now(),
+	}
+	s.jobs[imageID] = job
+	copied := *job
+	return job, &copied, true
+}
+
+// runScan executes a scan job, bounded by the scanner's concurrency slots
+func (ir *ImageRegistry) runScan(job *ScanJob, image *GoldenImage) error {
+	s := ir.scanner
+
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	started := time.Now()
+	s.updateJob(job, func(j *ScanJob) {
+		j.Status = ScanScanning
+		j.StartedAt = &started
+	})
+
+	var vulnerabilities []Vulnerability
+	var err error
+	if image.RegistryURL == "" {
+		err = fmt.Errorf("image has no registry URL to scan")
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultScanTimeout)
+		vulnerabilities, err = s.Scan(ctx, image.RegistryURL)
+		cancel()
+	}
+
+	completed := time.Now()
+	if err != nil {
+		logger.WithError(err).WithField("image_id", image.ID).Error("Scan failed")
+		s.updateJob(job, func(j *ScanJob) {
+			j.Status = ScanFailed
+			j.Error = err.Error()
+			j.CompletedAt = &completed
+		})
+		return err
+	}
+
+	summary := severitySummary(vulnerabilities)
+
+	ir.mu.Lock()
+	previous := image.Vulnerabilities
+	image.Vulnerabilities = vulnerabilities
+	image.SeveritySummary = summary
+	image.LastScanned = completed
+	ir.mu.Unlock()
+
+	if err := ir.saveImage(image); err != nil {
+		logger.WithError(err).Error("Failed to update image in database after scan")
+	}
+
+	s.updateJob(job, func(j *ScanJob) {
+		j.Status = ScanComplete
+		j.Summary = summary
+		j.CompletedAt = &completed
+	})
+
+	ir.notifyScanComplete(image, previous)
+	return nil
+}
+
+// getScanStatus returns the latest scan job for an image
+func (ir *ImageRegistry) getScanStatus(c *gin.Context) {
+	image := ir.lookupImage(c)
+	if image == nil {
+		return
+	}
+
+	job := ir.scanner.latestJob(image.ID)
+	if job == nil {
+		// No job in this process; report what the stored record knows
+		if image.LastScanned.IsZero() {
+			apierror.RespondError(c, apierror.NotFound("Image has not been scanned"))
+			return
+		}
+		completed := image.LastScanned
+		job = &ScanJob{
+			ImageID:     image.ID,
+			Status:      ScanComplete,
+			Summary:     image.SeveritySummary,
+			CompletedAt: &completed,
+		}
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// startRescanScheduler periodically rescans images whose last scan is
+// older than SCAN_MAX_AGE_HOURS
+func (ir *ImageRegistry) startRescanScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			ir.rescanStaleImages()
+		}
+	}()
+}
+
+func (ir *ImageRegistry) rescanStaleImages() {
+	images := ir.cachedImages()
+	if ir.db != nil {
+		dbImages, err := ir.db.ListImages()
+		if err != nil {
+			logger.WithError(err).Error("Rescan scheduler failed to list images")
+		} else {
+			images = dbImages
+		}
+	}
+
+	cutoff := time.Now().Add(-ir.scanner.maxAge)
+	queued := 0
+	for _, img := range images {
+		if img.LastScanned.After(cutoff) {
+			continue
+		}
+		// Scan the cached copy so results land on the object handlers see
+		image, err := ir.getImageByID(img.ID)
+		if err != nil || image == nil {
+			continue
+		}
+		ir.enqueueScan(image)
+		queued++
+	}
+
+	if queued > 0 {
+		logger.WithFields(logrus.Fields{
+			"queued":  queued,
+			"max_age": ir.scanner.maxAge.String(),
+		}).Info("Rescan scheduler queued stale images")
+	}
+}
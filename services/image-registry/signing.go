@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCosignURL      = "http://cosign-webhook.cosign-system.svc.cluster.local:8080"
+	DefaultSigningTimeout = 2 * time.Minute
+)
+
+// ErrSignatureNotVerified means Cosign checked a signature and rejected it,
+// as opposed to verification not running at all
+var ErrSignatureNotVerified = errors.New("signature not verified")
+
+// Signer signs images and verifies their signatures through the Cosign webhook
+type Signer struct {
+	cosignURL  string
+	publicKey  string // PEM key to verify against instead of the webhook's own
+	httpClient *http.Client
+}
+
+// NewSigner creates a signer for COSIGN_URL. If COSIGN_PUBLIC_KEY names a
+// key file, signatures are verified against that key.
+func NewSigner() *Signer {
+	cosignURL := os.Getenv("COSIGN_URL")
+	if cosignURL == "" {
+		cosignURL = DefaultCosignURL
+	}
+
+	var publicKey string
+	if path := os.Getenv("COSIGN_PUBLIC_KEY"); path != "" {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to read COSIGN_PUBLIC_KEY, verifying with the webhook's key")
+		} else {
+			publicKey = string(key)
+		}
+	}
+
+	return &Signer{
+		cosignURL:  strings.TrimRight(cosignURL, "/"),
+		publicKey:  publicKey,
+		httpClient: &http.Client{Timeout: DefaultSigningTimeout},
+	}
+}
+
+// Sign asks Cosign to sign an image and returns the signature
+func (s *Signer) Sign(ctx context.Context, imageRef, digest string, metadata map[string]interface{}) (string, error) {
+	var result struct {
+		Signature string `json:"signature"`
+	}
+	if err := s.post(ctx, "/sign", map[string]interface{}{
+		"image":     imageRef,
+		"digest":    digest,
+		"timestamp": time.Now().Unix(),
+		"metadata":  metadata,
+	}, &result); err != nil {
+		return "", err
+	}
+	if result.Signature == "" {
+		return "", fmt.Errorf("cosign returned no signature")
+	}
+	return result.Signature, nil
+}
+
+// Verify runs cosign verify for an image's signature. It returns nil only
+// when Cosign confirms the signature, and an error wrapping
+// ErrSignatureNotVerified when Cosign rejects it.
+func (s *Signer) Verify(ctx context.Context, imageRef, digest, signature string) error {
+	var result struct {
+		Verified bool   `json:"verified"`
+		Error    string `json:"error"`
+	}
+	req := map[string]string{
+		"image":     imageRef,
+		"digest":    digest,
+		"signature": signature,
+	}
+	if s.publicKey != "" {
+		req["public_key"] = s.publicKey
+	}
+	if err := s.post(ctx, "/verify", req, &result); err != nil {
+		return err
+	}
+	if !result.Verified {
+		if result.Error != "" {
+			return fmt.Errorf("%w: %s", ErrSignatureNotVerified, result.Error)
+		}
+		return ErrSignatureNotVerified
+	}
+	return nil
+}
+
+func (s *Signer) post(ctx context.Context, path string, body interface{}, result interface{}) error {
+	reqBody, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cosignURL+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create cosign request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cosign request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("cosign returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode cosign response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// cosignStub serves /sign and /verify with fixed responses
+func cosignStub(t *testing.T, signStatus int, signature string, verified bool) *Signer {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sign":
+			w.WriteHeader(signStatus)
+			json.NewEncoder(w).Encode(map[string]string{"signature": signature})
+		case "/verify":
+			var req struct {
+				Signature string `json:"signature"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(map[string]bool{"verified": verified && req.Signature == signature})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return &Signer{cosignURL: srv.URL, httpClient: srv.Client()}
+}
+
+func TestSignImage(t *testing.T) {
+	tests := []struct {
+		name         string
+		signer       func(t *testing.T) *Signer
+		wantStatus   int
+		wantSigned   bool
+		wantVerified bool
+	}{
+		{
+			name:         "signed and verified",
+			signer:       func(t *testing.T) *Signer { return cosignStub(t, http.StatusOK, "MEUCIQ-sig", true) },
+			wantStatus:   http.StatusOK,
+			wantSigned:   true,
+			wantVerified: true,
+		},
+		{
+			name:       "signing fails",
+			signer:     func(t *testing.T) *Signer { return cosignStub(t, http.StatusInternalServerError, "", false) },
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "no signature returned",
+			signer:     func(t *testing.T) *Signer { return cosignStub(t, http.StatusOK, "", true) },
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name: "cosign unreachable",
+			signer: func(t *testing.T) *Signer {
+				return &Signer{cosignURL: "http://127.0.0.1:1", httpClient: http.DefaultClient}
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "signature not verified",
+			signer:     func(t *testing.T) *Signer { return cosignStub(t, http.StatusOK, "MEUCIQ-sig", false) },
+			wantStatus: http.StatusBadGateway,
+			wantSigned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := &GoldenImage{ID: "img-1", RegistryURL: "registry.local/web:1", Digest: testDigest}
+			ir := newTestRegistry(image)
+			ir.signer = tt.signer(t)
+
+			w := serve(ir.signImage, http.MethodPost, "/images/:id/sign", "/images/img-1/sign", nil)
+			assertStatus(t, w, tt.wantStatus)
+			if tt.wantStatus != http.StatusOK {
+				if code, _ := decodeError(t, w); code != "upstream_error" {
+					t.Fatalf("error code = %s, want upstream_error", code)
+				}
+			}
+
+			if !tt.wantSigned {
+				if image.Attestation != nil {
+					t.Fatalf("attestation = %+v after failed signing, want none", image.Attestation)
+				}
+				return
+			}
+			if image.Attestation == nil || image.Attestation.Signature != "MEUCIQ-sig" {
+				t.Fatalf("attestation = %+v, want the Cosign signature", image.Attestation)
+			}
+			if image.Attestation.Verified != tt.wantVerified {
+				t.Fatalf("verified = %v, want %v", image.Attestation.Verified, tt.wantVerified)
+			}
+
+			// An unverified signature keeps the image out of staging
+			blocked := false
+			for _, blocker := range promotionBlockers(image, EnvStaging) {
+				blocked = blocked || blocker == "image Cosign attestation is not verified"
+			}
+			if blocked == tt.wantVerified {
+				t.Fatalf("blocked on verification = %v, want %v", blocked, !tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestSignImageWithoutDigest(t *testing.T) {
+	// Still building, or a legacy image with a made up digest
+	for _, digest := range []string{"", "sha256:6f1c2d1e-0b7a-4c1e-9f3a-2d1c0b7a4c1e"} {
+		image := &GoldenImage{ID: "img-1", RegistryURL: "registry.local/web:1", Digest: digest}
+		ir := newTestRegistry(image)
+		ir.signer = cosignStub(t, http.StatusOK, "MEUCIQ-sig", true)
+
+		w := serve(ir.signImage, http.MethodPost, "/images/:id/sign", "/images/img-1/sign", nil)
+		assertStatus(t, w, http.StatusConflict)
+		if image.Attestation != nil {
+			t.Fatalf("digest %q: image was signed without a known digest", digest)
+		}
+	}
+}
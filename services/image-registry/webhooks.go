@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/logging"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/webhook"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultWebhookMaxAttempts = 5
+	DefaultWebhookBackoff     = 2 * time.Second
+	DefaultWebhookTimeout     = 10 * time.Second
+)
+
+// WebhookEventScanCompleted is sent after a successful scan
+const WebhookEventScanCompleted = "scan.completed"
+
+// WebhookSubscription delivers scan results for one image, or for every
+// image when ImageID is empty
+type WebhookSubscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	ImageID   string    `json:"image_id,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateWebhookRequest represents a webhook subscription request
+type CreateWebhookRequest struct {
+	URL     string `json:"url" binding:"required"`
+	ImageID string `json:"image_id,omitempty"`
+	Secret  string `json:"secret,omitempty"`
+}
+
+// ScanWebhookPayload summarises a completed scan for subscribers
+type ScanWebhookPayload struct {
+	Event           string          `json:"event"`
+	ImageID         string          `json:"image_id"`
+	ImageName       string          `json:"image_name"`
+	ImageVersion    string          `json:"image_version"`
+	Platform        string          `json:"platform"`
+	ScannedAt       time.Time       `json:"scanned_at"`
+	SeveritySummary map[string]int  `json:"severity_summary"`
+	Total           int             `json:"total_vulnerabilities"`
+	NewCVEs         []Vulnerability `json:"new_cves"`
+}
+
+// WebhookNotifier delivers webhook payloads with retry and exponential backoff
+type WebhookNotifier struct {
+	sender *webhook.Sender
+
+	subscriptions map[string]*WebhookSubscription // used when no database
+	mu            sync.RWMutex
+}
+
+// NewWebhookNotifier creates a notifier configured from WEBHOOK_MAX_ATTEMPTS
+// and WEBHOOK_BACKOFF_SECONDS
+func NewWebhookNotifier() *WebhookNotifier {
+	maxAttempts := DefaultWebhookMaxAttempts
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxAttempts = n
+		}
+	}
+
+	backoff := DefaultWebhookBackoff
+	if v := os.Getenv("WEBHOOK_BACKOFF_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			backoff = time.Duration(n) * time.Second
+		}
+	}
+
+	return &WebhookNotifier{
+		sender: webhook.New(webhook.Config{
+			HeaderPrefix: "X-Registry",
+			MaxAttempts:  maxAttempts,
+			Backoff:      backoff,
+			HTTPClient:   &http.Client{Timeout: DefaultWebhookTimeout},
+			OnRetry: func(d webhook.Delivery, attempt int, wait time.Duration, err error) {
+				logger.WithError(err).WithFields(logrus.Fields{
+					"delivery_id": d.ID,
+					"attempt":     attempt,
+					"retry_in":    wait.String(),
+				}).Warn("Webhook delivery failed, retrying")
+			},
+		}),
+		subscriptions: make(map[string]*WebhookSubscription),
+	}
+}
+
+// deliver posts a payload to a subscriber, retrying failed attempts with
+// exponential backoff. Client errors other than 429 are not retried.
+func (n *WebhookNotifier) deliver(sub *WebhookSubscription, body []byte) error {
+	_, err := n.sender.Send(context.Background(), webhook.Delivery{
+		URL:    sub.URL,
+		Secret: sub.Secret,
+		Event:  WebhookEventScanCompleted,
+		ID:     uuid.New().String(),
+		Body:   body,
+	})
+	return err
+}
+
+// newCVEs returns vulnerabilities whose CVE was not present in the previous scan
+func newCVEs(previous, current []Vulnerability) []Vulnerability {
+	seen := make(map[string]bool, len(previous))
+	for _, v := range previous {
+		seen[v.CVE+"|"+v.PackageName] = true
+	}
+
+	added := []Vulnerability{}
+	for _, v := range current {
+		if !seen[v.CVE+"|"+v.PackageName] {
+			added = append(added, v)
+		}
+	}
+	return added
+}
+
+// subscriptionsFor returns the webhooks interested in an image
+func (ir *ImageRegistry) subscriptionsFor(imageID string) ([]*WebhookSubscription, error) {
+	if ir.db != nil {
+		return ir.db.ListWebhooks(imageID)
+	}
+
+	n := ir.webhooks
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	subs := []*WebhookSubscription{}
+	for _, sub := range n.subscriptions {
+		if sub.ImageID == "" || sub.ImageID == imageID {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+// notifyScanComplete sends a scan summary to every matching subscriber
+func (ir *ImageRegistry) notifyScanComplete(image *GoldenImage, previous []Vulnerability) {
+	subs, err := ir.subscriptionsFor(image.ID)
+	if err != nil {
+		logger.WithError(err).WithField("image_id", image.ID).Error("Failed to load webhooks")
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+
+	ir.mu.RLock()
+	payload := ScanWebhookPayload{
+		Event:           WebhookEventScanCompleted,
+		ImageID:         image.ID,
+		ImageName:       image.Name,
+		ImageVersion:    image.Version,
+		Platform:        image.Platform,
+		ScannedAt:       image.LastScanned,
+		SeveritySummary: image.SeveritySummary,
+		Total:           len(image.Vulnerabilities),
+		NewCVEs:         newCVEs(previous, image.Vulnerabilities),
+	}
+	ir.mu.RUnlock()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.WithError(err).Error("Failed to encode webhook payload")
+		return
+	}
+
+	for _, sub := range subs {
+		go func(sub *WebhookSubscription) {
+			if err := ir.webhooks.deliver(sub, body); err != nil {
+				logger.WithError(err).WithFields(logrus.Fields{
+					"webhook_id": sub.ID,
+					"url":        sub.URL,
+				}).Error("Webhook delivery failed")
+			}
+		}(sub)
+	}
+}
+
+// createWebhook subscribes a URL to scan completion events
+func (ir *ImageRegistry) createWebhook(c *gin.Context) {
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondError(c, apierror.Validation(err.Error()))
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		apierror.RespondError(c, apierror.Validation("url must be an absolute http or https URL"))
+		return
+	}
+
+	if req.ImageID != "" {
+		image, err := ir.getImageByID(req.ImageID)
+		if err != nil {
+			apierror.RespondError(c, apierror.Internal("Failed to load image"))
+			return
+		}
+		if image == nil {
+			apierror.RespondError(c, apierror.NotFound("Image not found"))
+			return
+		}
+	}
+
+	sub := &WebhookSubscription{
+		ID:        uuid.New().String(),
+		URL:       req.URL,
+		ImageID:   req.ImageID,
+		Secret:    req.Secret,
+		CreatedAt: time.Now(),
+	}
+
+	if ir.db != nil {
+		if err := ir.db.SaveWebhook(sub); err != nil {
+			logging.ForRequest(logger, c).WithError(err).Error("Failed to save webhook")
+			apierror.RespondError(c, apierror.Internal("Failed to save webhook"))
+			return
+		}
+	} else {
+		ir.webhooks.mu.Lock()
+		ir.webhooks.subscriptions[sub.ID] = sub
+		ir.webhooks.mu.Unlock()
+	}
+
+	c.JSON(http.StatusCreated, redactSecret(sub))
+}
+
+// listWebhooks returns subscriptions, optionally only those for ?image_id=
+func (ir *ImageRegistry) listWebhooks(c *gin.Context) {
+	var subs []*WebhookSubscription
+	var err error
+
+	imageID := c.Query("image_id")
+	if imageID != "" {
+		subs, err = ir.subscriptionsFor(imageID)
+	} else if ir.db != nil {
+		subs, err = ir.db.ListWebhooks("")
+	} else {
+		ir.webhooks.mu.RLock()
+		for _, sub := range ir.webhooks.subscriptions {
+			subs = append(subs, sub)
+		}
+		ir.webhooks.mu.RUnlock()
+	}
+	if err != nil {
+		logging.ForRequest(logger, c).WithError(err).Error("Failed to list webhooks")
+		apierror.RespondError(c, apierror.Internal("Failed to list webhooks"))
+		return
+	}
+
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	redacted := make([]*WebhookSubscription, 0, len(subs))
+	for _, sub := range subs {
+		redacted = append(redacted, redactSecret(sub))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":    len(redacted),
+		"webhooks": redacted,
+	})
+}
+
+// deleteWebhook removes a subscription
+func (ir *ImageRegistry) deleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+
+	if ir.db != nil {
+		deleted, err := ir.db.DeleteWebhook(id)
+		if err != nil {
+			logging.ForRequest(logger, c).WithError(err).Error("Failed to delete webhook")
+			apierror.RespondError(c, apierror.Internal("Failed to delete webhook"))
+			return
+		}
+		if !deleted {
+			apierror.RespondError(c, apierror.NotFound("Webhook not found"))
+			return
+		}
+	} else {
+		ir.webhooks.mu.Lock()
+		_, exists := ir.webhooks.subscriptions[id]
+		delete(ir.webhooks.subscriptions, id)
+		ir.webhooks.mu.Unlock()
+		if !exists {
+			apierror.RespondError(c, apierror.NotFound("Webhook not found"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// redactSecret returns a copy of sub safe to return to clients
+func redactSecret(sub *WebhookSubscription) *WebhookSubscription {
+	copied := *sub
+	if copied.Secret != "" {
+		copied.Secret = strings.Repeat("*", 8)
+	}
+	return &copied
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/webhook"
+)
+
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// subscriber answers with statuses in turn, repeating the last one, and
+// passes every request it receives to deliveries
+func subscriber(t *testing.T, statuses ...int) (*httptest.Server, chan delivery) {
+	t.Helper()
+	deliveries := make(chan delivery, 10)
+	var mu sync.Mutex
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		status := statuses[len(statuses)-1]
+		if n < len(statuses) {
+			status = statuses[n]
+		}
+		n++
+		mu.Unlock()
+		deliveries <- delivery{header: r.Header, body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, deliveries
+}
+
+// waitDeliveries collects deliveries until none arrive for a short while
+func waitDeliveries(deliveries chan delivery) []delivery {
+	var got []delivery
+	for {
+		select {
+		case d := <-deliveries:
+			got = append(got, d)
+		case <-time.After(300 * time.Millisecond):
+			return got
+		}
+	}
+}
+
+func TestNotifyScanComplete(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantWaits    int
+	}{
+		{"delivered", []int{http.StatusOK}, 1, 0},
+		{"retries server errors", []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, 3, 2},
+		{"retries rate limiting", []int{http.StatusTooManyRequests, http.StatusAccepted}, 2, 1},
+		{"gives up after max attempts", []int{http.StatusInternalServerError}, 3, 2},
+		{"does not retry client errors", []int{http.StatusBadRequest, http.StatusOK}, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, deliveries := subscriber(t, tt.statuses...)
+
+			image := &GoldenImage{
+				ID: "img-1", Name: "web", Version: "1.0.0", Platform: "docker",
+				Vulnerabilities: []Vulnerability{{CVE: "CVE-2024-1", PackageName: "openssl", Severity: "HIGH"}},
+				SeveritySummary: map[string]int{"HIGH": 1},
+			}
+			ir := newTestRegistry(image)
+			ir.webhooks.subscriptions["wh-1"] = &WebhookSubscription{ID: "wh-1", URL: srv.URL, Secret: "s3cret"}
+
+			var mu sync.Mutex
+			var waits []time.Duration
+			ir.webhooks.sender = webhook.New(webhook.Config{
+				HeaderPrefix: "X-Registry",
+				MaxAttempts:  3,
+				Backoff:      time.Second,
+				Sleep: func(ctx context.Context, d time.Duration) error {
+					mu.Lock()
+					waits = append(waits, d)
+					mu.Unlock()
+					return nil
+				},
+			})
+
+			ir.notifyScanComplete(image, nil)
+			got := waitDeliveries(deliveries)
+			if len(got) != tt.wantAttempts {
+				t.Fatalf("received %d deliveries, want %d", len(got), tt.wantAttempts)
+			}
+			mu.Lock()
+			if len(waits) != tt.wantWaits {
+				t.Fatalf("waited %v, want %d waits", waits, tt.wantWaits)
+			}
+			mu.Unlock()
+
+			first := got[0]
+			if want := "sha256=" + webhook.Sign("s3cret", first.body); first.header.Get("X-Registry-Signature") != want {
+				t.Fatalf("signature = %q, want %q", first.header.Get("X-Registry-Signature"), want)
+			}
+			if first.header.Get("X-Registry-Event") != WebhookEventScanCompleted {
+				t.Fatalf("event = %q", first.header.Get("X-Registry-Event"))
+			}
+			// Retries are the same delivery
+			for _, d := range got[1:] {
+				if d.header.Get("X-Registry-Delivery") != first.header.Get("X-Registry-Delivery") {
+					t.Fatalf("delivery IDs differ across retries")
+				}
+			}
+
+			var payload ScanWebhookPayload
+			if err := json.Unmarshal(first.body, &payload); err != nil {
+				t.Fatalf("decode payload: %v", err)
+			}
+			if payload.ImageID != "img-1" || payload.Total != 1 || len(payload.NewCVEs) != 1 {
+				t.Fatalf("payload = %+v", payload)
+			}
+		})
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"os"
 	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
 )
 
 // QInfraClient is the client for QInfra API
@@ -101,6 +103,7 @@ func (c *QInfraClient) GenerateInfrastructure(ctx context.Context, request map[s
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	authmiddleware.SetServiceKey(req)
 	
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -142,6 +145,7 @@ func (c *QInfraClient) BuildGoldenImage(ctx context.Context, imageSpec map[strin
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	authmiddleware.SetServiceKey(req)
 	
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -189,6 +193,7 @@ func (c *QInfraClient) GenerateSOP(ctx context.Context, sopRequest map[string]in
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	authmiddleware.SetServiceKey(req)
 	
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -228,6 +233,7 @@ func (c *QInfraClient) ValidateCompliance(ctx context.Context, complianceRequest
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	authmiddleware.SetServiceKey(req)
 	
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -264,6 +270,7 @@ func (c *QInfraClient) OptimizeCost(ctx context.Context, costRequest map[string]
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	authmiddleware.SetServiceKey(req)
 	
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -314,6 +321,7 @@ func (c *QuantumDropsClient) CreateDrop(ctx context.Context, dropRequest map[str
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	authmiddleware.SetServiceKey(req)
 	
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaxBestOfCandidates caps how many providers one best-of request fans out to
+const MaxBestOfCandidates = 8
+
+// CandidateSpec names a provider and, optionally, the model to use with it
+type CandidateSpec struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`
+}
+
+// BestOfRequest is a generate request run against several providers. Its
+// provider and model are ignored; Candidates lists them instead, defaulting
+// to BEST_OF_CANDIDATES.
+type BestOfRequest struct {
+	GenerateRequest
+	Candidates []CandidateSpec `json:"candidates,omitempty"`
+	Scorer     string          `json:"scorer,omitempty"`
+}
+
+// Candidate is one provider's answer to a best-of request
+type Candidate struct {
+	Index     int               `json:"index"`
+	Provider  string            `json:"provider"`
+	Model     string            `json:"model,omitempty"`
+	Response  *GenerateResponse `json:"response,omitempty"`
+	Score     float64           `json:"score"`
+	Error     string            `json:"error,omitempty"`
+	LatencyMS int64             `json:"latency_ms"`
+}
+
+// BestOfResponse holds every candidate and the one the scorer selected
+type BestOfResponse struct {
+	Selected      *GenerateResponse `json:"selected"`
+	SelectedIndex int               `json:"selected_index"`
+	Scorer        string            `json:"scorer"`
+	Candidates    []Candidate       `json:"candidates"`
+}
+
+// Scorer rates a candidate response; the highest score is selected
+type Scorer interface {
+	Score(req GenerateRequest, resp GenerateResponse) float64
+}
+
+// lengthScorer prefers the longest answer, on the basis that truncated or
+// refused generations are short
+type lengthScorer struct{}
+
+func (lengthScorer) Score(_ GenerateRequest, resp GenerateResponse) float64 {
+	return float64(utf8.RuneCountInString(strings.TrimSpace(resp.Content)))
+}
+
+// scorers maps a scorer name to its implementation
+var scorers = map[string]Scorer{
+	"length": lengthScorer{},
+}
+
+// defaultScorer returns BEST_OF_SCORER, or "length"
+func defaultScorer() string {
+	if name := os.Getenv("BEST_OF_SCORER"); name != "" {
+		return name
+	}
+	return "length"
+}
+
+// defaultCandidates parses BEST_OF_CANDIDATES, a comma separated list of
+// provider or provider:model entries. It defaults to Azure and Bedrock.
+func defaultCandidates() []CandidateSpec {
+	value := os.Getenv("BEST_OF_CANDIDATES")
+	if value == "" {
+		value = "azure,aws"
+	}
+
+	var specs []CandidateSpec
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		provider, model, _ := strings.Cut(entry, ":")
+		specs = append(specs, CandidateSpec{Provider: provider, Model: model})
+	}
+	return specs
+}
+
+// runCandidates calls every candidate concurrently. A failed candidate
+// records its error; it doesn't affect the others.
+func runCandidates(ctx context.Context, req GenerateRequest, specs []CandidateSpec, scorer Scorer) []Candidate {
+	candidates := make([]Candidate, len(specs))
+
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		wg.Add(1)
+		go func(i int, spec CandidateSpec) {
+			defer wg.Done()
+
+			candidate := &candidates[i]
+			*candidate = Candidate{Index: i, Provider: spec.Provider, Model: spec.Model}
+			candidateReq := req
+			candidateReq.Provider = spec.Provider
+			candidateReq.Model = spec.Model
+
+			// A provider panicking on an unexpected response must not take
+			// the other candidates, or the process, down with it
+			defer func() {
+				if r := recover(); r != nil {
+					candidate.Response = nil
+					candidate.Error = fmt.Sprintf("provider panicked: %v", r)
+					log.Printf("Best-of candidate %d (%s) panicked: %v", i, spec.Provider, r)
+				}
+			}()
+
+			start := time.Now()
+			resp, err := providers[spec.Provider](ctx, candidateReq)
+			candidate.LatencyMS = time.Since(start).Milliseconds()
+
+			if err != nil {
+				candidate.Error = err.Error()
+				log.Printf("Best-of candidate %d (%s) failed: %v", i, spec.Provider, err)
+				return
+			}
+			candidate.Response = &resp
+			candidate.Model = resp.Model
+			candidate.Score = scorer.Score(candidateReq, resp)
+		}(i, spec)
+	}
+	wg.Wait()
+
+	return candidates
+}
+
+// selectCandidate returns the index of the best scoring successful
+// candidate, preferring earlier candidates on ties, or -1 if all failed
+func selectCandidate(candidates []Candidate) int {
+	selected := -1
+	for i, candidate := range candidates {
+		if candidate.Response == nil {
+			continue
+		}
+		if selected == -1 || candidate.Score > candidates[selected].Score {
+			selected = i
+		}
+	}
+	return selected
+}
+
+func handleGenerateBestOf(c *gin.Context) {
+	var req BestOfRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := normalizeRequest(&req.GenerateRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	specs := req.Candidates
+	if len(specs) == 0 {
+		specs = defaultCandidates()
+	}
+	if len(specs) == 0 || len(specs) > MaxBestOfCandidates {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("between 1 and %d candidates are required", MaxBestOfCandidates),
+		})
+		return
+	}
+	for _, spec := range specs {
+		if _, ok := providers[spec.Provider]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported provider: " + spec.Provider})
+			return
+		}
+	}
+
+	if req.Scorer == "" {
+		req.Scorer = defaultScorer()
+	}
+	scorer, ok := scorers[req.Scorer]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scorer: " + req.Scorer})
+		return
+	}
+
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Int("llm.best_of.candidates", len(specs)),
+		attribute.String("llm.best_of.scorer", req.Scorer),
+		attribute.Int("llm.max_tokens", req.MaxTokens),
+	)
+
+	candidates := runCandidates(ctx, req.GenerateRequest, specs, scorer)
+	selected := selectCandidate(candidates)
+	span.SetAttributes(attribute.Int("llm.best_of.selected", selected))
+
+	resp := BestOfResponse{
+		SelectedIndex: selected,
+		Scorer:        req.Scorer,
+		Candidates:    candidates,
+	}
+	if selected == -1 {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":      fmt.Sprintf("all %d candidates failed", len(candidates)),
+			"candidates": candidates,
+		})
+		return
+	}
+
+	resp.Selected = candidates[selected].Response
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useProviders replaces the provider table for one test
+func useProviders(t *testing.T, stubs map[string]providerFunc) {
+	t.Helper()
+	previous := providers
+	providers = stubs
+	t.Cleanup(func() { providers = previous })
+}
+
+// answer stubs a provider that always replies with content
+func answer(provider, content string) providerFunc {
+	return func(_ context.Context, req GenerateRequest) (GenerateResponse, error) {
+		model := req.Model
+		if model == "" {
+			model = provider + "-default"
+		}
+		return GenerateResponse{Content: content, Provider: provider, Model: model}, nil
+	}
+}
+
+func postBestOf(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/generate/best-of", handleGenerateBestOf)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/generate/best-of", strings.NewReader(body)))
+	return w
+}
+
+func TestBestOfSelectsHighestScore(t *testing.T) {
+	// Each stub waits for the other, so the test only passes if the
+	// candidates run concurrently
+	var started sync.WaitGroup
+	started.Add(2)
+	concurrent := func(call providerFunc) providerFunc {
+		return func(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+			started.Done()
+			done := make(chan struct{})
+			go func() { started.Wait(); close(done) }()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				return GenerateResponse{}, errors.New("candidates ran one after another")
+			}
+			return call(ctx, req)
+		}
+	}
+	useProviders(t, map[string]providerFunc{
+		"short": concurrent(answer("short", "ok")),
+		"long":  concurrent(answer("long", "def handler():\n    return 42")),
+	})
+
+	w := postBestOf(t, `{"prompt": "Write a handler", "candidates": [
+		{"provider": "short"}, {"provider": "long", "model": "long-large"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d %s", w.Code, w.Body)
+	}
+	var resp BestOfResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.SelectedIndex != 1 || resp.Selected == nil || resp.Selected.Provider != "long" {
+		t.Fatalf("selected %d %+v, want the longer answer", resp.SelectedIndex, resp.Selected)
+	}
+	if resp.Scorer != "length" || len(resp.Candidates) != 2 {
+		t.Fatalf("response = %+v", resp)
+	}
+	short, long := resp.Candidates[0], resp.Candidates[1]
+	if short.Provider != "short" || short.Model != "short-default" || short.Score != 2 || short.Error != "" {
+		t.Errorf("short candidate = %+v", short)
+	}
+	if long.Model != "long-large" || long.Score <= short.Score {
+		t.Errorf("long candidate = %+v", long)
+	}
+}
+
+func TestBestOfTieKeepsFirst(t *testing.T) {
+	useProviders(t, map[string]providerFunc{
+		"a": answer("a", "same"),
+		"b": answer("b", "also"),
+	})
+	w := postBestOf(t, `{"prompt": "p", "candidates": [{"provider": "b"}, {"provider": "a"}]}`)
+	var resp BestOfResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.SelectedIndex != 0 || resp.Selected.Provider != "b" {
+		t.Errorf("status %d, selected %d, want the first of two equal scores", w.Code, resp.SelectedIndex)
+	}
+}
+
+func TestBestOfFailedCandidates(t *testing.T) {
+	useProviders(t, map[string]providerFunc{
+		"ok": answer("ok", "a short answer"),
+		"down": func(context.Context, GenerateRequest) (GenerateResponse, error) {
+			return GenerateResponse{}, errors.New("503 from provider")
+		},
+		"broken": func(context.Context, GenerateRequest) (GenerateResponse, error) {
+			var choices []string
+			return GenerateResponse{Content: choices[0]}, nil
+		},
+	})
+
+	w := postBestOf(t, `{"prompt": "p", "candidates": [{"provider": "down"}, {"provider": "broken"}, {"provider": "ok"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d %s", w.Code, w.Body)
+	}
+	var resp BestOfResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.SelectedIndex != 2 {
+		t.Errorf("selected %d, want the one that answered", resp.SelectedIndex)
+	}
+	if c := resp.Candidates[0]; c.Error != "503 from provider" || c.Response != nil {
+		t.Errorf("failed candidate = %+v", c)
+	}
+	if c := resp.Candidates[1]; !strings.HasPrefix(c.Error, "provider panicked") || c.Response != nil {
+		t.Errorf("panicking candidate = %+v", c)
+	}
+
+	w = postBestOf(t, `{"prompt": "p", "candidates": [{"provider": "down"}, {"provider": "broken"}]}`)
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "all 2 candidates failed") {
+		t.Errorf("all failing = %d %s, want 502", w.Code, w.Body)
+	}
+}
+
+func TestBestOfDefaultCandidates(t *testing.T) {
+	useProviders(t, map[string]providerFunc{
+		"a": answer("a", "first"),
+		"b": answer("b", "second answer"),
+	})
+	t.Setenv("BEST_OF_CANDIDATES", " a:a-mini, ,b ")
+
+	w := postBestOf(t, `{"messages": [{"role": "user", "content": "p"}]}`)
+	var resp BestOfResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status = %d %s", w.Code, w.Body)
+	}
+	if len(resp.Candidates) != 2 || resp.Candidates[0].Model != "a-mini" || resp.Candidates[1].Provider != "b" {
+		t.Errorf("candidates = %+v, want a:a-mini and b", resp.Candidates)
+	}
+}
+
+func TestBestOfRejectsInvalidRequests(t *testing.T) {
+	useProviders(t, map[string]providerFunc{"a": answer("a", "x")})
+	many := strings.Repeat(`{"provider": "a"},`, MaxBestOfCandidates+1)
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"no prompt", `{"candidates": [{"provider": "a"}]}`, "prompt is required"},
+		{"too many candidates", `{"prompt": "p", "candidates": [` + strings.TrimSuffix(many, ",") + `]}`, "between 1 and 8 candidates"},
+		{"unknown provider", `{"prompt": "p", "candidates": [{"provider": "a"}, {"provider": "gemini"}]}`, "unsupported provider: gemini"},
+		{"unknown scorer", `{"prompt": "p", "candidates": [{"provider": "a"}], "scorer": "vibes"}`, "unknown scorer: vibes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postBestOf(t, tt.body)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("response = %d %s, want 400 %q", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
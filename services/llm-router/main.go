@@ -13,6 +13,12 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type GenerateRequest struct {
@@ -46,8 +52,21 @@ var (
 	azureKey        string
 	azureDeployment string
 	bedrockClient   *bedrockruntime.Client
+
+	// httpClient propagates trace context to provider APIs
+	httpClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+	// providers maps a request's provider name to the function calling it
+	providers = map[string]providerFunc{
+		"azure":   callAzureOpenAI,
+		"aws":     callAWSBedrock,
+		"bedrock": callAWSBedrock,
+	}
 )
 
+// providerFunc sends a normalized request to one LLM provider
+type providerFunc func(ctx context.Context, req GenerateRequest) (GenerateResponse, error)
+
 func init() {
 	// Azure OpenAI config
 	azureEndpoint = os.Getenv("AZURE_OPENAI_ENDPOINT")
@@ -65,18 +84,24 @@ func init() {
 		config.WithRegion("us-east-1"),
 	)
 	if err == nil {
+		otelaws.AppendMiddlewares(&cfg.APIOptions)
 		bedrockClient = bedrockruntime.NewFromConfig(cfg)
 	}
 }
 
 func main() {
+	shutdownTracing := initTracing()
+	defer shutdownTracing()
+
 	r := gin.Default()
+	r.Use(otelgin.Middleware(serviceName))
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
 
 	r.POST("/generate", handleGenerate)
+	r.POST("/generate/best-of", handleGenerateBestOf)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -96,6 +121,44 @@ func handleGenerate(c *gin.Context) {
 		return
 	}
 
+	if err := normalizeRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("llm.provider", req.Provider),
+		attribute.Int("llm.max_tokens", req.MaxTokens),
+	)
+
+	call, ok := providers[req.Provider]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported provider: " + req.Provider})
+		return
+	}
+
+	resp, err := call(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("llm.model", resp.Model),
+		attribute.Int("llm.prompt_tokens", resp.PromptTokens),
+		attribute.Int("llm.completion_tokens", resp.CompletionTokens),
+	)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// normalizeRequest converts the messages format to prompt/system, checks
+// there is a prompt and fills in the default provider and max tokens
+func normalizeRequest(req *GenerateRequest) error {
 	// Convert messages format to prompt/system format
 	if len(req.Messages) > 0 {
 		for _, msg := range req.Messages {
@@ -112,8 +175,7 @@ func handleGenerate(c *gin.Context) {
 
 	// Validate we have a prompt
 	if req.Prompt == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "prompt is required"})
-		return
+		return fmt.Errorf("prompt is required")
 	}
 
 	// Default provider
@@ -125,29 +187,13 @@ func handleGenerate(c *gin.Context) {
 	if req.MaxTokens == 0 {
 		req.MaxTokens = 4000
 	}
-
-	var resp GenerateResponse
-	var err error
-
-	switch req.Provider {
-	case "azure":
-		resp, err = callAzureOpenAI(req)
-	case "aws", "bedrock":
-		resp, err = callAWSBedrock(req)
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported provider: " + req.Provider})
-		return
-	}
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, resp)
+	return nil
 }
 
-func callAzureOpenAI(req GenerateRequest) (GenerateResponse, error) {
+func callAzureOpenAI(ctx context.Context, req GenerateRequest) (resp GenerateResponse, err error) {
+	ctx, span := startProviderSpan(ctx, "azure.chat_completions", "azure", azureDeployment)
+	defer func() { endProviderSpan(span, resp, err) }()
+
 	url := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=2024-06-01",
 		azureEndpoint, azureDeployment)
 
@@ -174,7 +220,7 @@ func callAzureOpenAI(req GenerateRequest) (GenerateResponse, error) {
 		return GenerateResponse{}, err
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return GenerateResponse{}, err
 	}
@@ -182,8 +228,7 @@ func callAzureOpenAI(req GenerateRequest) (GenerateResponse, error) {
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("api-key", azureKey)
 
-	client := &http.Client{}
-	httpResp, err := client.Do(httpReq)
+	httpResp, err := httpClient.Do(httpReq)
 	if err != nil {
 		return GenerateResponse{}, err
 	}
@@ -227,16 +272,19 @@ func callAzureOpenAI(req GenerateRequest) (GenerateResponse, error) {
 	}, nil
 }
 
-func callAWSBedrock(req GenerateRequest) (GenerateResponse, error) {
-	if bedrockClient == nil {
-		return GenerateResponse{}, fmt.Errorf("AWS Bedrock client not initialized")
-	}
-
+func callAWSBedrock(ctx context.Context, req GenerateRequest) (resp GenerateResponse, err error) {
 	modelID := "anthropic.claude-3-5-sonnet-20241022-v2:0"
 	if req.Model != "" {
 		modelID = req.Model
 	}
 
+	ctx, span := startProviderSpan(ctx, "bedrock.invoke_model", "aws", modelID)
+	defer func() { endProviderSpan(span, resp, err) }()
+
+	if bedrockClient == nil {
+		return GenerateResponse{}, fmt.Errorf("AWS Bedrock client not initialized")
+	}
+
 	// Build Claude messages
 	messages := []map[string]interface{}{}
 	if req.System != "" {
@@ -263,7 +311,7 @@ func callAWSBedrock(req GenerateRequest) (GenerateResponse, error) {
 		return GenerateResponse{}, err
 	}
 
-	result, err := bedrockClient.InvokeModel(context.TODO(), &bedrockruntime.InvokeModelInput{
+	result, err := bedrockClient.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
 		ModelId:     &modelID,
 		Body:        jsonData,
 		ContentType: stringPtr("application/json"),
@@ -301,6 +349,31 @@ func callAWSBedrock(req GenerateRequest) (GenerateResponse, error) {
 	}, nil
 }
 
+// startProviderSpan starts a client span for a call to an LLM provider
+func startProviderSpan(ctx context.Context, name, provider, model string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("llm.provider", provider),
+			attribute.String("llm.model", model),
+		),
+	)
+}
+
+// endProviderSpan records the outcome of a provider call and ends its span
+func endProviderSpan(span trace.Span, resp GenerateResponse, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(
+			attribute.Int("llm.prompt_tokens", resp.PromptTokens),
+			attribute.Int("llm.completion_tokens", resp.CompletionTokens),
+		)
+	}
+	span.End()
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
\ No newline at end of file
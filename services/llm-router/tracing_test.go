@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useAzure points the Azure OpenAI provider at handler for one test
+func useAzure(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	previous := azureEndpoint
+	azureEndpoint = srv.URL
+	t.Cleanup(func() {
+		azureEndpoint = previous
+		srv.Close()
+	})
+}
+
+const azureCompletion = `{
+	"choices": [{"message": {"role": "assistant", "content": "def handler(): pass"}}],
+	"usage": {"prompt_tokens": 12, "completion_tokens": 5}
+}`
+
+func TestTraceContextReachesProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracetest.NewInMemoryExporter()
+	t.Cleanup(installTracing(sdktrace.WithSyncer(exporter)))
+
+	var received string
+	useAzure(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(azureCompletion))
+	})
+
+	const (
+		callerTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+		callerSpan  = "00f067aa0ba902b7"
+	)
+	r := gin.New()
+	r.Use(otelgin.Middleware(serviceName))
+	r.POST("/generate", handleGenerate)
+	req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(`{"prompt": "Write a handler", "provider": "azure"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+callerTrace+"-"+callerSpan+"-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("generate = %d %s, want 200", w.Code, w.Body)
+	}
+
+	// The request span continues the caller's trace, the provider call is
+	// its child and the outgoing HTTP request is the provider call's child
+	spans := exporter.GetSpans()
+	byParent := map[string]tracetest.SpanStub{}
+	for _, s := range spans {
+		if s.SpanContext.TraceID().String() != callerTrace {
+			t.Errorf("span %q is in trace %s, want the caller's", s.Name, s.SpanContext.TraceID())
+		}
+		byParent[s.Parent.SpanID().String()] = s
+	}
+	server, ok := byParent[callerSpan]
+	if !ok || server.Name != "/generate" {
+		t.Fatalf("no request span under the caller's span in %d spans", len(spans))
+	}
+	provider, ok := byParent[server.SpanContext.SpanID().String()]
+	if !ok || provider.Name != "azure.chat_completions" {
+		t.Fatalf("request span has no provider span as its child")
+	}
+	outgoing, ok := byParent[provider.SpanContext.SpanID().String()]
+	if !ok {
+		t.Fatalf("provider span %q has no HTTP client span as its child", provider.Name)
+	}
+
+	want := "00-" + callerTrace + "-" + outgoing.SpanContext.SpanID().String() + "-01"
+	if received != want {
+		t.Errorf("traceparent sent to the provider = %q, want %q", received, want)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultAnomalyThreshold is how many standard deviations from its
+	// baseline a metric must be to be reported
+	DefaultAnomalyThreshold = 3.0
+
+	// DefaultBaselineWindow is how many of the latest history samples make
+	// up a metric's baseline
+	DefaultBaselineWindow = 30
+
+	// MinBaselineSamples is the fewest history samples a baseline is
+	// computed from
+	MinBaselineSamples = 5
+
+	maxBaselineWindow = 10000
+)
+
+// AnomalyDetectionRequest holds current metric values and their history.
+// Each metric's current value is compared to the latest Window samples of
+// its history; a metric with history but no current value has its last
+// sample compared to the ones before it.
+type AnomalyDetectionRequest struct {
+	Platform string             `json:"platform"`
+	Metrics  map[string]float64 `json:"metrics"`
+	// History lists each metric's past samples, oldest first
+	History map[string][]float64 `json:"history"`
+	// Threshold is in standard deviations, DefaultAnomalyThreshold unless
+	// set
+	Threshold float64 `json:"threshold,omitempty"`
+	// Window is how many samples the rolling baseline spans,
+	// DefaultBaselineWindow unless set
+	Window     int                      `json:"window,omitempty"`
+	TimeWindow string                   `json:"time_window"`
+	Nodes      []map[string]interface{} `json:"nodes,omitempty"`
+}
+
+// Validate checks the request and fills in the default threshold and
+// window
+func (r *AnomalyDetectionRequest) Validate() error {
+	if r.Threshold == 0 {
+		r.Threshold = DefaultAnomalyThreshold
+	}
+	if r.Threshold < 0 {
+		return errors.New("threshold must be positive")
+	}
+	if r.Window == 0 {
+		r.Window = DefaultBaselineWindow
+	}
+	if r.Window < MinBaselineSamples || r.Window > maxBaselineWindow {
+		return fmt.Errorf("window must be between %d and %d", MinBaselineSamples, maxBaselineWindow)
+	}
+	if len(r.Metrics) == 0 && len(r.History) == 0 {
+		return errors.New("metrics or history is required")
+	}
+	for metric, value := range r.Metrics {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("metric %s isn't a finite number", metric)
+		}
+	}
+	for metric, samples := range r.History {
+		for _, v := range samples {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("history of %s has a sample that isn't a finite number", metric)
+			}
+		}
+	}
+	return nil
+}
+
+// MetricBaseline is what one metric was compared to
+type MetricBaseline struct {
+	Value   float64 `json:"value"`
+	Mean    float64 `json:"mean"`
+	StdDev  float64 `json:"std_dev"`
+	Samples int     `json:"samples"`
+	// ZScore is left zero when the baseline never varied, since any
+	// change from a constant baseline is an anomaly
+	ZScore   float64 `json:"z_score"`
+	Constant bool    `json:"constant,omitempty"`
+	Anomaly  bool    `json:"anomaly"`
+}
+
+// AnomalyReport lists the metrics that deviated from their baselines
+type AnomalyReport struct {
+	AnomaliesDetected int                       `json:"anomalies_detected"`
+	Anomalies         []AnomalyDetection        `json:"anomalies"`
+	Threshold         float64                   `json:"threshold"`
+	Baselines         map[string]MetricBaseline `json:"baselines"`
+	// Skipped are metrics without enough history for a baseline, with why
+	Skipped map[string]string `json:"skipped,omitempty"`
+}
+
+// performAnomalyDetection reports each metric whose current value is more
+// than the threshold's standard deviations from the mean of its rolling
+// baseline
+func (ai *QInfraAI) performAnomalyDetection(request AnomalyDetectionRequest) AnomalyReport {
+	report := AnomalyReport{
+		Anomalies: []AnomalyDetection{},
+		Threshold: request.Threshold,
+		Baselines: make(map[string]MetricBaseline),
+		Skipped:   make(map[string]string),
+	}
+
+	names := make(map[string]bool)
+	for metric := range request.Metrics {
+		names[metric] = true
+	}
+	for metric := range request.History {
+		names[metric] = true
+	}
+	metrics := make([]string, 0, len(names))
+	for metric := range names {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	nodes := nodeIDs(request.Nodes)
+	for _, metric := range metrics {
+		history := request.History[metric]
+		value, current := request.Metrics[metric]
+		if !current {
+			if len(history) == 0 {
+				continue
+			}
+			value, history = history[len(history)-1], history[:len(history)-1]
+		}
+		if len(history) > request.Window {
+			history = history[len(history)-request.Window:]
+		}
+		if len(history) < MinBaselineSamples {
+			report.Skipped[metric] = fmt.Sprintf("needs %d history samples for a baseline, has %d", MinBaselineSamples, len(history))
+			continue
+		}
+
+		baseline := metricBaseline(value, history, request.Threshold)
+		report.Baselines[metric] = baseline
+		if baseline.Anomaly {
+			report.Anomalies = append(report.Anomalies, newMetricAnomaly(metric, baseline, request.Threshold, nodes))
+		}
+	}
+
+	if len(report.Skipped) == 0 {
+		report.Skipped = nil
+	}
+	report.AnomaliesDetected = len(report.Anomalies)
+	return report
+}
+
+// metricBaseline compares value to the mean and standard deviation of
+// history
+func metricBaseline(value float64, history []float64, threshold float64) MetricBaseline {
+	mean := 0.0
+	for _, v := range history {
+		mean += v
+	}
+	mean /= float64(len(history))
+
+	variance := 0.0
+	for _, v := range history {
+		variance += (v - mean) * (v - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(history)-1))
+
+	baseline := MetricBaseline{Value: value, Mean: mean, StdDev: stdDev, Samples: len(history)}
+	if stdDev == 0 {
+		baseline.Constant = true
+		baseline.Anomaly = value != mean
+		return baseline
+	}
+	baseline.ZScore = (value - mean) / stdDev
+	baseline.Anomaly = math.Abs(baseline.ZScore) > threshold
+	return baseline
+}
+
+func newMetricAnomaly(metric string, baseline MetricBaseline, threshold float64, nodes []string) AnomalyDetection {
+	direction, kind := "above", "metric_spike"
+	if baseline.Value < baseline.Mean {
+		direction, kind = "below", "metric_drop"
+	}
+
+	severity, score := "medium", math.Erf(math.Abs(baseline.ZScore)/math.Sqrt2)
+	deviation := fmt.Sprintf("%.1f standard deviations %s", math.Abs(baseline.ZScore), direction)
+	if baseline.Constant {
+		score, deviation = 1, direction
+	}
+	if baseline.Constant || math.Abs(baseline.ZScore) >= 2*threshold {
+		severity = "high"
+	}
+
+	return AnomalyDetection{
+		ID:       uuid.New().String(),
+		Type:     kind,
+		Severity: severity,
+		// The chance a normal deviation is smaller than this one
+		AnomalyScore:   score,
+		Description:    fmt.Sprintf("%s at %.4g is %s its baseline of %.4g", metric, baseline.Value, deviation, baseline.Mean),
+		AffectedNodes:  nodes,
+		Pattern:        fmt.Sprintf("Deviation from a rolling baseline of %d samples", baseline.Samples),
+		FirstSeen:      time.Now(),
+		Recommendation: anomalyRecommendation(metric, kind),
+		Metric:         metric,
+		Value:          baseline.Value,
+		Baseline:       baseline.Mean,
+		StdDev:         baseline.StdDev,
+		ZScore:         baseline.ZScore,
+	}
+}
+
+func anomalyRecommendation(metric, kind string) string {
+	switch {
+	case strings.Contains(metric, "cpu") && kind == "metric_spike":
+		return "Investigate the processes behind the CPU spike and whether workload explains it"
+	case strings.Contains(metric, "memory") && kind == "metric_spike":
+		return "Check for memory leaks or unbounded caches in recently changed services"
+	case strings.Contains(metric, "disk") && kind == "metric_spike":
+		return "Find what is filling the disk and check log rotation and cleanup jobs"
+	case strings.Contains(metric, "error") && kind == "metric_spike":
+		return "Correlate the error increase with recent deployments and roll back if needed"
+	default:
+		return fmt.Sprintf("Review recent changes that could affect %s", metric)
+	}
+}
+
+// nodeIDs collects the IDs of the nodes a request is about
+func nodeIDs(nodes []map[string]interface{}) []string {
+	ids := []string{}
+	for _, node := range nodes {
+		for _, key := range []string{"node_id", "id", "name"} {
+			if id, ok := node[key].(string); ok && id != "" {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids
+}
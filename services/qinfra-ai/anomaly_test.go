@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func detect(t *testing.T, request AnomalyDetectionRequest) AnomalyReport {
+	t.Helper()
+	if err := request.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	return (&QInfraAI{}).performAnomalyDetection(request)
+}
+
+func TestAnomalyDetectionStableMetrics(t *testing.T) {
+	report := detect(t, AnomalyDetectionRequest{
+		Metrics: map[string]float64{"cpu_usage": 86, "memory_usage": 61, "disk_io": 212},
+		History: map[string][]float64{
+			"cpu_usage":    noisy(1, 30, 85, 4),
+			"memory_usage": noisy(2, 30, 60, 2),
+			"disk_io":      noisy(3, 30, 200, 15),
+		},
+	})
+	// A CPU above 80% is no anomaly for a node that always runs hot
+	if report.AnomaliesDetected != 0 || len(report.Anomalies) != 0 {
+		t.Errorf("anomalies = %+v, want none", report.Anomalies)
+	}
+	if len(report.Baselines) != 3 {
+		t.Errorf("baselines = %v, want one per metric", report.Baselines)
+	}
+	if cpu := report.Baselines["cpu_usage"]; cpu.Samples != 30 || cpu.Mean < 83 || cpu.Mean > 87 {
+		t.Errorf("cpu baseline = %+v, want the mean of 30 samples near 85", cpu)
+	}
+}
+
+func TestAnomalyDetectionSpike(t *testing.T) {
+	report := detect(t, AnomalyDetectionRequest{
+		Metrics: map[string]float64{"cpu_usage": 97, "memory_usage": 61},
+		History: map[string][]float64{
+			"cpu_usage":    noisy(1, 30, 40, 3),
+			"memory_usage": noisy(2, 30, 60, 2),
+		},
+		Nodes: []map[string]interface{}{{"node_id": "node-007"}},
+	})
+	if report.AnomaliesDetected != 1 {
+		t.Fatalf("anomalies = %+v, want one", report.Anomalies)
+	}
+	anomaly := report.Anomalies[0]
+	if anomaly.Metric != "cpu_usage" || anomaly.Type != "metric_spike" || anomaly.Severity != "high" {
+		t.Errorf("anomaly = %+v, want a high cpu_usage spike", anomaly)
+	}
+	if anomaly.ZScore < 6 || anomaly.AnomalyScore < 0.99 || anomaly.Value != 97 {
+		t.Errorf("z-score %.2f, score %.3f, want a deviation far past the threshold", anomaly.ZScore, anomaly.AnomalyScore)
+	}
+	if len(anomaly.AffectedNodes) != 1 || anomaly.AffectedNodes[0] != "node-007" {
+		t.Errorf("affected nodes = %v, want the request's node", anomaly.AffectedNodes)
+	}
+	if !report.Baselines["cpu_usage"].Anomaly || report.Baselines["memory_usage"].Anomaly {
+		t.Errorf("baselines = %+v, want only cpu_usage flagged", report.Baselines)
+	}
+}
+
+func TestAnomalyDetectionFromHistory(t *testing.T) {
+	// Without a current value the latest sample is judged against the rest
+	history := append(noisy(1, 20, 500, 20), 120)
+	report := detect(t, AnomalyDetectionRequest{History: map[string][]float64{"requests_per_second": history}})
+	if report.AnomaliesDetected != 1 || report.Anomalies[0].Type != "metric_drop" || report.Anomalies[0].Value != 120 {
+		t.Errorf("anomalies = %+v, want a drop to 120", report.Anomalies)
+	}
+	if got := report.Baselines["requests_per_second"].Samples; got != 20 {
+		t.Errorf("baseline samples = %d, want the 20 before the latest", got)
+	}
+}
+
+func TestAnomalyDetectionRollingWindow(t *testing.T) {
+	// Latency moved from 50ms to 200ms a while ago; the window only sees
+	// the new level
+	history := append(noisy(1, 40, 50, 5), noisy(2, 20, 200, 10)...)
+	request := AnomalyDetectionRequest{
+		Metrics: map[string]float64{"latency_ms": 205},
+		History: map[string][]float64{"latency_ms": history},
+		Window:  20,
+	}
+	report := detect(t, request)
+	if report.AnomaliesDetected != 0 {
+		t.Errorf("anomalies = %+v, want none against the recent baseline", report.Anomalies)
+	}
+	if mean := report.Baselines["latency_ms"].Mean; mean < 190 {
+		t.Errorf("baseline mean = %.1f, want only the new level", mean)
+	}
+
+	request.Window = 60
+	if mean := detect(t, request).Baselines["latency_ms"].Mean; mean > 150 {
+		t.Errorf("baseline mean over 60 samples = %.1f, want the old level included", mean)
+	}
+}
+
+func TestAnomalyDetectionThreshold(t *testing.T) {
+	history := noisy(1, 30, 100, 10)
+	baseline := metricBaseline(0, history, DefaultAnomalyThreshold)
+	value := baseline.Mean + 2.5*baseline.StdDev
+
+	request := AnomalyDetectionRequest{
+		Metrics: map[string]float64{"memory_usage": value},
+		History: map[string][]float64{"memory_usage": history},
+	}
+	if report := detect(t, request); report.AnomaliesDetected != 0 {
+		t.Errorf("2.5 standard deviations flagged at the default threshold of 3")
+	}
+	request.Threshold = 2
+	report := detect(t, request)
+	if report.AnomaliesDetected != 1 || report.Anomalies[0].Severity != "medium" {
+		t.Errorf("anomalies = %+v, want one medium anomaly at a threshold of 2", report.Anomalies)
+	}
+}
+
+func TestAnomalyDetectionEdgeCases(t *testing.T) {
+	report := detect(t, AnomalyDetectionRequest{
+		Metrics: map[string]float64{"replicas": 2, "queue_depth": 3, "cpu_usage": 50},
+		History: map[string][]float64{
+			"replicas":    {3, 3, 3, 3, 3, 3},
+			"queue_depth": {1, 2, 3},
+		},
+	})
+	if report.AnomaliesDetected != 1 || report.Anomalies[0].Metric != "replicas" || !report.Baselines["replicas"].Constant {
+		t.Errorf("anomalies = %+v, want a change from the constant replica count", report.Anomalies)
+	}
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("report doesn't encode: %v", err)
+	}
+	if report.Skipped["queue_depth"] == "" || report.Skipped["cpu_usage"] == "" {
+		t.Errorf("skipped = %v, want metrics without enough history", report.Skipped)
+	}
+}
+
+func TestDetectAnomaliesValidation(t *testing.T) {
+	router := gin.New()
+	router.POST("/api/v1/detect-anomalies", (&QInfraAI{}).detectAnomalies)
+
+	tests := []struct {
+		name string
+		body interface{}
+		want int
+	}{
+		{name: "nothing to check", body: map[string]interface{}{"platform": "aws"}, want: http.StatusBadRequest},
+		{name: "negative threshold", body: AnomalyDetectionRequest{Metrics: map[string]float64{"cpu": 1}, Threshold: -1}, want: http.StatusBadRequest},
+		{name: "window too small", body: AnomalyDetectionRequest{Metrics: map[string]float64{"cpu": 1}, Window: 2}, want: http.StatusBadRequest},
+		{name: "valid", body: AnomalyDetectionRequest{Metrics: map[string]float64{"cpu": 90}, History: map[string][]float64{"cpu": noisy(1, 10, 40, 2)}}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/detect-anomalies", bytes.NewReader(body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCanaryConfidence = 0.95
+
+	// MinCanarySamples is the fewest samples per side a metric is compared
+	// with; fewer can't reach significance at the usual confidence levels
+	MinCanarySamples = 5
+
+	// MaxCanarySamples bounds each side of a metric, since the shift
+	// estimate looks at every canary/baseline pair
+	MaxCanarySamples = 1000
+
+	// canarySafeScore is the lowest score a canary can proceed with
+	canarySafeScore = 70.0
+)
+
+// Canary verdicts of a metric
+const (
+	MetricPass         = "pass"
+	MetricDegraded     = "degraded"
+	MetricImproved     = "improved"
+	MetricInconclusive = "inconclusive"
+)
+
+// canaryMetricWeights is how much each metric counts towards the score;
+// other metrics weigh defaultCanaryWeight
+var canaryMetricWeights = map[string]float64{
+	"error_rate": 30,
+	"latency":    20,
+	"cpu":        15,
+	"memory":     10,
+}
+
+const defaultCanaryWeight = 10.0
+
+// criticalCanaryMetrics fail the canary on their own when degraded
+var criticalCanaryMetrics = map[string]bool{
+	"error_rate": true,
+}
+
+// higherIsBetterMetrics are degraded when they drop rather than rise
+var higherIsBetterMetrics = map[string]bool{
+	"throughput":   true,
+	"success_rate": true,
+	"availability": true,
+}
+
+// CanaryAnalysisRequest holds samples of each metric from the canary and
+// the baseline over the same period
+type CanaryAnalysisRequest struct {
+	DeploymentID    string               `json:"deployment_id"`
+	CanarySamples   map[string][]float64 `json:"canary_samples" binding:"required"`
+	BaselineSamples map[string][]float64 `json:"baseline_samples" binding:"required"`
+	// Confidence is the level a difference must be significant at, 0.95
+	// unless set
+	Confidence float64 `json:"confidence,omitempty"`
+	// HigherIsBetter names metrics besides throughput, success_rate and
+	// availability that degrade by dropping
+	HigherIsBetter []string `json:"higher_is_better,omitempty"`
+	Duration       string   `json:"duration"`
+}
+
+// Validate checks the samples can be compared and fills in the default
+// confidence
+func (r *CanaryAnalysisRequest) Validate() error {
+	if r.Confidence == 0 {
+		r.Confidence = DefaultCanaryConfidence
+	}
+	if r.Confidence < 0.5 || r.Confidence >= 1 {
+		return errors.New("confidence must be at least 0.5 and below 1")
+	}
+	shared := 0
+	for metric, canary := range r.CanarySamples {
+		baseline, ok := r.BaselineSamples[metric]
+		if !ok {
+			continue
+		}
+		shared++
+		if len(canary) > MaxCanarySamples || len(baseline) > MaxCanarySamples {
+			return fmt.Errorf("metric %s has more than %d samples", metric, MaxCanarySamples)
+		}
+		for _, v := range append(append([]float64{}, canary...), baseline...) {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("metric %s has a sample that isn't a finite number", metric)
+			}
+		}
+	}
+	if shared == 0 {
+		return errors.New("canary_samples and baseline_samples share no metric")
+	}
+	return nil
+}
+
+// CanaryMetricResult compares one metric's canary samples to its baseline
+type CanaryMetricResult struct {
+	Verdict         string  `json:"verdict"`
+	CanarySamples   int     `json:"canary_samples"`
+	BaselineSamples int     `json:"baseline_samples"`
+	CanaryMedian    float64 `json:"canary_median"`
+	BaselineMedian  float64 `json:"baseline_median"`
+	// Difference is the estimated shift of the canary from the baseline,
+	// the median of all canary-baseline differences, with its confidence
+	// interval
+	Difference float64 `json:"difference"`
+	CILower    float64 `json:"ci_lower"`
+	CIUpper    float64 `json:"ci_upper"`
+	// PValue is the chance of a difference at least this much in the
+	// degrading direction were the canary no worse than the baseline
+	PValue float64 `json:"p_value"`
+	Weight float64 `json:"weight"`
+}
+
+// performCanaryAnalysis compares each metric with a one-sided Mann-Whitney U
+// test, so a canary is only judged worse when the difference is unlikely to
+// be noise given the samples. The significance level is split across the
+// metrics compared (Bonferroni), keeping the chance of any false alarm
+// within the confidence. The score is the share of the metrics' weight
+// that isn't significantly degraded.
+func (ai *QInfraAI) performCanaryAnalysis(request CanaryAnalysisRequest) CanaryAnalysis {
+	higherIsBetter := make(map[string]bool)
+	for metric := range higherIsBetterMetrics {
+		higherIsBetter[metric] = true
+	}
+	for _, metric := range request.HigherIsBetter {
+		higherIsBetter[metric] = true
+	}
+
+	metrics := make([]string, 0, len(request.CanarySamples))
+	for metric := range request.CanarySamples {
+		if _, ok := request.BaselineSamples[metric]; ok {
+			metrics = append(metrics, metric)
+		}
+	}
+	sort.Strings(metrics)
+
+	compared := 0
+	for _, metric := range metrics {
+		if len(request.CanarySamples[metric]) >= MinCanarySamples && len(request.BaselineSamples[metric]) >= MinCanarySamples {
+			compared++
+		}
+	}
+	alpha := 1 - request.Confidence
+	if compared > 1 {
+		alpha /= float64(compared)
+	}
+
+	results := make(map[string]CanaryMetricResult, len(metrics))
+	anomalies := []string{}
+	var totalWeight, passedWeight float64
+	criticalDegraded := false
+	for _, metric := range metrics {
+		weight, ok := canaryMetricWeights[metric]
+		if !ok {
+			weight = defaultCanaryWeight
+		}
+		result := compareCanaryMetric(request.CanarySamples[metric], request.BaselineSamples[metric], higherIsBetter[metric], alpha)
+		result.Weight = weight
+		results[metric] = result
+
+		switch result.Verdict {
+		case MetricInconclusive:
+			anomalies = append(anomalies, fmt.Sprintf("Not enough samples to compare %s (need %d per side)", metric, MinCanarySamples))
+			continue
+		case MetricDegraded:
+			anomalies = append(anomalies, fmt.Sprintf("%s %s by %s (p=%.4f)", metric, changeWord(result.Difference), formatCanaryDifference(metric, result.Difference), result.PValue))
+			if criticalCanaryMetrics[metric] {
+				criticalDegraded = true
+			}
+		default:
+			passedWeight += weight
+		}
+		totalWeight += weight
+	}
+
+	canaryScore := 0.0
+	if totalWeight > 0 {
+		canaryScore = math.Round(passedWeight/totalWeight*1000) / 10
+	}
+	safeToProceed := totalWeight > 0 && !criticalDegraded && canaryScore >= canarySafeScore
+
+	recommendation := "Safe to proceed with full rollout"
+	switch {
+	case totalWeight == 0:
+		recommendation = "Collect more samples before deciding - no metric could be compared"
+	case criticalDegraded || canaryScore < 50:
+		recommendation = "Rollback immediately - significant degradation detected"
+	case canaryScore < canarySafeScore:
+		recommendation = "Investigate issues before proceeding - moderate concerns detected"
+	}
+
+	return CanaryAnalysis{
+		DeploymentID:   request.DeploymentID,
+		CanaryScore:    canaryScore,
+		SafeToProceed:  safeToProceed,
+		ErrorRate:      results["error_rate"].Difference,
+		LatencyImpact:  results["latency"].Difference,
+		CPUImpact:      results["cpu"].Difference,
+		MemoryImpact:   results["memory"].Difference,
+		Anomalies:      anomalies,
+		Recommendation: recommendation,
+		AnalyzedAt:     time.Now(),
+		Confidence:     request.Confidence,
+		Metrics:        results,
+	}
+}
+
+// compareCanaryMetric tests whether the canary is worse than the baseline,
+// or better, at significance level alpha
+func compareCanaryMetric(canary, baseline []float64, higherIsBetter bool, alpha float64) CanaryMetricResult {
+	result := CanaryMetricResult{
+		Verdict:         MetricInconclusive,
+		CanarySamples:   len(canary),
+		BaselineSamples: len(baseline),
+		PValue:          1,
+	}
+	if len(canary) == 0 || len(baseline) == 0 {
+		return result
+	}
+	result.CanaryMedian = median(canary)
+	result.BaselineMedian = median(baseline)
+	result.Difference, result.CILower, result.CIUpper = hodgesLehmann(canary, baseline, 1-alpha)
+	if len(canary) < MinCanarySamples || len(baseline) < MinCanarySamples {
+		return result
+	}
+
+	// The test is for the canary being larger; flip the samples when
+	// larger is better
+	pGreater, pLess := mannWhitneyU(canary, baseline)
+	pWorse, pBetter := pGreater, pLess
+	if higherIsBetter {
+		pWorse, pBetter = pLess, pGreater
+	}
+	result.PValue = pWorse
+
+	switch {
+	case pWorse < alpha:
+		result.Verdict = MetricDegraded
+	case pBetter < alpha:
+		result.Verdict = MetricImproved
+	default:
+		result.Verdict = MetricPass
+	}
+	return result
+}
+
+// mannWhitneyU returns the one-sided p-values of x being stochastically
+// larger and smaller than y, using the normal approximation with tie and
+// continuity corrections
+func mannWhitneyU(x, y []float64) (pGreater, pLess float64) {
+	type sample struct {
+		value float64
+		fromX bool
+	}
+	n1, n2 := float64(len(x)), float64(len(y))
+	samples := make([]sample, 0, len(x)+len(y))
+	for _, v := range x {
+		samples = append(samples, sample{v, true})
+	}
+	for _, v := range y {
+		samples = append(samples, sample{v, false})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+
+	// Ties share the average of their ranks
+	rankSumX, tieTerm := 0.0, 0.0
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].value == samples[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if samples[k].fromX {
+				rankSumX += rank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+
+	n := n1 + n2
+	u := rankSumX - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if variance <= 0 {
+		// Every sample is the same value
+		return 1, 1
+	}
+	sd := math.Sqrt(variance)
+	pGreater = 1 - normalCDF((u-mean-0.5)/sd)
+	pLess = normalCDF((u - mean + 0.5) / sd)
+	return math.Min(pGreater, 1), math.Min(pLess, 1)
+}
+
+// hodgesLehmann estimates the shift of x from y as the median of all
+// pairwise differences, with the distribution-free confidence interval
+// that goes with the Mann-Whitney test
+func hodgesLehmann(x, y []float64, confidence float64) (estimate, lower, upper float64) {
+	diffs := make([]float64, 0, len(x)*len(y))
+	for _, a := range x {
+		for _, b := range y {
+			diffs = append(diffs, a-b)
+		}
+	}
+	sort.Float64s(diffs)
+	estimate = median(diffs)
+
+	n1, n2 := float64(len(x)), float64(len(y))
+	z := normalQuantile(1 - (1-confidence)/2)
+	k := int(math.Floor(n1*n2/2 - z*math.Sqrt(n1*n2*(n1+n2+1)/12)))
+	if k < 0 {
+		k = 0
+	}
+	if k >= len(diffs) {
+		k = len(diffs) - 1
+	}
+	return estimate, diffs[k], diffs[len(diffs)-1-k]
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func normalCDF(z float64) float64 {
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
+
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+func changeWord(difference float64) string {
+	if difference < 0 {
+		return "decreased"
+	}
+	return "increased"
+}
+
+// formatCanaryDifference writes a shift in the metric's unit: error rates
+// are fractions and latencies milliseconds
+func formatCanaryDifference(metric string, difference float64) string {
+	difference = math.Abs(difference)
+	switch {
+	case metric == "error_rate":
+		return fmt.Sprintf("%.2f%%", difference*100)
+	case strings.Contains(metric, "latency"):
+		return fmt.Sprintf("%.2fms", difference)
+	default:
+		return fmt.Sprintf("%.4g", difference)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// noisy draws n samples around mean with the given spread, seeded so the
+// tests are repeatable
+func noisy(seed int64, n int, mean, spread float64) []float64 {
+	r := rand.New(rand.NewSource(seed))
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = mean + r.NormFloat64()*spread
+	}
+	return samples
+}
+
+func analyze(t *testing.T, request CanaryAnalysisRequest) CanaryAnalysis {
+	t.Helper()
+	if err := request.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	return (&QInfraAI{}).performCanaryAnalysis(request)
+}
+
+func TestCanaryAnalysisDecisions(t *testing.T) {
+	tests := []struct {
+		name         string
+		canary       map[string][]float64
+		baseline     map[string][]float64
+		safe         bool
+		wantVerdicts map[string]string
+	}{
+		{
+			name: "clearly higher error rate",
+			canary: map[string][]float64{
+				"error_rate": noisy(1, 30, 0.05, 0.005),
+				"latency":    noisy(2, 30, 120, 10),
+			},
+			baseline: map[string][]float64{
+				"error_rate": noisy(3, 30, 0.01, 0.005),
+				"latency":    noisy(4, 30, 120, 10),
+			},
+			safe:         false,
+			wantVerdicts: map[string]string{"error_rate": MetricDegraded, "latency": MetricPass},
+		},
+		{
+			name: "clearly higher latency and cpu",
+			canary: map[string][]float64{
+				"error_rate": noisy(5, 30, 0.01, 0.002),
+				"latency":    noisy(6, 30, 200, 10),
+				"cpu":        noisy(7, 30, 0.8, 0.05),
+				"memory":     noisy(8, 30, 512, 20),
+			},
+			baseline: map[string][]float64{
+				"error_rate": noisy(9, 30, 0.01, 0.002),
+				"latency":    noisy(10, 30, 120, 10),
+				"cpu":        noisy(11, 30, 0.4, 0.05),
+				"memory":     noisy(12, 30, 512, 20),
+			},
+			safe:         false,
+			wantVerdicts: map[string]string{"error_rate": MetricPass, "latency": MetricDegraded, "cpu": MetricDegraded, "memory": MetricPass},
+		},
+		{
+			name: "indistinguishable samples",
+			canary: map[string][]float64{
+				"error_rate": noisy(13, 40, 0.01, 0.004),
+				"latency":    noisy(14, 40, 120, 15),
+				"cpu":        noisy(15, 40, 0.5, 0.1),
+				"memory":     noisy(16, 40, 512, 30),
+			},
+			baseline: map[string][]float64{
+				"error_rate": noisy(113, 40, 0.01, 0.004),
+				"latency":    noisy(114, 40, 120, 15),
+				"cpu":        noisy(115, 40, 0.5, 0.1),
+				"memory":     noisy(116, 40, 512, 30),
+			},
+			safe:         true,
+			wantVerdicts: map[string]string{"error_rate": MetricPass, "latency": MetricPass, "cpu": MetricPass, "memory": MetricPass},
+		},
+		{
+			// A few spikes push the canary's mean latency well past 10%
+			// over the baseline, which fixed thresholds took for a
+			// regression
+			name: "noisy latency with outliers",
+			canary: map[string][]float64{
+				"latency": {100, 104, 97, 101, 99, 420, 103, 98, 102, 96},
+			},
+			baseline: map[string][]float64{
+				"latency": {101, 99, 103, 98, 100, 102, 97, 104, 99, 101},
+			},
+			safe:         true,
+			wantVerdicts: map[string]string{"latency": MetricPass},
+		},
+		{
+			name: "lower error rate",
+			canary: map[string][]float64{
+				"error_rate": noisy(21, 30, 0.002, 0.001),
+			},
+			baseline: map[string][]float64{
+				"error_rate": noisy(22, 30, 0.02, 0.003),
+			},
+			safe:         true,
+			wantVerdicts: map[string]string{"error_rate": MetricImproved},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis := analyze(t, CanaryAnalysisRequest{CanarySamples: tt.canary, BaselineSamples: tt.baseline})
+			if analysis.SafeToProceed != tt.safe {
+				t.Errorf("safe = %t with score %.1f, want %t: %v", analysis.SafeToProceed, analysis.CanaryScore, tt.safe, analysis.Anomalies)
+			}
+			for metric, want := range tt.wantVerdicts {
+				if got := analysis.Metrics[metric]; got.Verdict != want {
+					t.Errorf("%s verdict = %s (p=%.4f), want %s", metric, got.Verdict, got.PValue, want)
+				}
+			}
+			if tt.safe && len(analysis.Anomalies) != 0 {
+				t.Errorf("anomalies = %v, want none", analysis.Anomalies)
+			}
+		})
+	}
+}
+
+func TestCanaryAnalysisScore(t *testing.T) {
+	// Degraded error rates roll back whatever the other metrics do
+	analysis := analyze(t, CanaryAnalysisRequest{
+		CanarySamples:   map[string][]float64{"error_rate": noisy(1, 30, 0.05, 0.005), "latency": noisy(2, 30, 120, 10)},
+		BaselineSamples: map[string][]float64{"error_rate": noisy(3, 30, 0.01, 0.005), "latency": noisy(4, 30, 120, 10)},
+	})
+	if analysis.CanaryScore != 40 || analysis.Recommendation != "Rollback immediately - significant degradation detected" {
+		t.Errorf("score %.1f, recommendation %q, want 40 and a rollback", analysis.CanaryScore, analysis.Recommendation)
+	}
+	if analysis.ErrorRate < 0.03 || analysis.ErrorRate > 0.05 {
+		t.Errorf("error rate shift = %f, want about 0.04", analysis.ErrorRate)
+	}
+	result := analysis.Metrics["error_rate"]
+	if result.CILower > result.Difference || result.Difference > result.CIUpper || result.CILower <= 0 {
+		t.Errorf("confidence interval [%f, %f] doesn't hold a positive shift %f", result.CILower, result.CIUpper, result.Difference)
+	}
+}
+
+func TestCanaryAnalysisHigherIsBetter(t *testing.T) {
+	canary := map[string][]float64{"throughput": noisy(1, 20, 800, 20), "cache_hit_ratio": noisy(2, 20, 0.6, 0.02)}
+	baseline := map[string][]float64{"throughput": noisy(3, 20, 1000, 20), "cache_hit_ratio": noisy(4, 20, 0.9, 0.02)}
+
+	analysis := analyze(t, CanaryAnalysisRequest{CanarySamples: canary, BaselineSamples: baseline})
+	if analysis.Metrics["throughput"].Verdict != MetricDegraded {
+		t.Errorf("throughput drop verdict = %s, want degraded", analysis.Metrics["throughput"].Verdict)
+	}
+	if analysis.Metrics["cache_hit_ratio"].Verdict != MetricImproved {
+		t.Errorf("cache hit ratio verdict = %s, want improved while lower is better", analysis.Metrics["cache_hit_ratio"].Verdict)
+	}
+
+	analysis = analyze(t, CanaryAnalysisRequest{CanarySamples: canary, BaselineSamples: baseline, HigherIsBetter: []string{"cache_hit_ratio"}})
+	if analysis.Metrics["cache_hit_ratio"].Verdict != MetricDegraded || analysis.SafeToProceed {
+		t.Errorf("cache hit ratio verdict = %s, safe = %t, want a degraded unsafe canary", analysis.Metrics["cache_hit_ratio"].Verdict, analysis.SafeToProceed)
+	}
+}
+
+func TestCanaryAnalysisNeedsSamples(t *testing.T) {
+	analysis := analyze(t, CanaryAnalysisRequest{
+		CanarySamples:   map[string][]float64{"error_rate": {0.5, 0.6, 0.7}},
+		BaselineSamples: map[string][]float64{"error_rate": {0.01, 0.01, 0.02}},
+	})
+	if analysis.SafeToProceed || analysis.Metrics["error_rate"].Verdict != MetricInconclusive {
+		t.Errorf("safe = %t, verdict = %s, want an inconclusive unsafe canary", analysis.SafeToProceed, analysis.Metrics["error_rate"].Verdict)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	x := []float64{6, 7, 8, 9, 10}
+	y := []float64{1, 2, 3, 4, 5}
+	pGreater, pLess := mannWhitneyU(x, y)
+	// U = 25, mean 12.5, sd 4.787: z = 2.507
+	if pGreater < 0.005 || pGreater > 0.007 || pLess < 0.99 {
+		t.Errorf("p-values = %f, %f, want about 0.006 and 1", pGreater, pLess)
+	}
+
+	if pGreater, pLess := mannWhitneyU([]float64{3, 3, 3}, []float64{3, 3, 3}); pGreater != 1 || pLess != 1 {
+		t.Errorf("identical samples p-values = %f, %f, want 1", pGreater, pLess)
+	}
+}
+
+func TestAnalyzeCanaryValidation(t *testing.T) {
+	router := gin.New()
+	router.POST("/api/v1/analyze-canary", (&QInfraAI{}).analyzeCanary)
+
+	samples := []float64{1, 2, 3, 4, 5}
+	tests := []struct {
+		name string
+		body interface{}
+		want int
+	}{
+		{name: "no samples", body: map[string]interface{}{"deployment_id": "d1"}, want: http.StatusBadRequest},
+		{
+			name: "no shared metric",
+			body: CanaryAnalysisRequest{CanarySamples: map[string][]float64{"cpu": samples}, BaselineSamples: map[string][]float64{"memory": samples}},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "confidence out of range",
+			body: CanaryAnalysisRequest{CanarySamples: map[string][]float64{"cpu": samples}, BaselineSamples: map[string][]float64{"cpu": samples}, Confidence: 1.5},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "too many samples",
+			body: CanaryAnalysisRequest{CanarySamples: map[string][]float64{"cpu": make([]float64, MaxCanarySamples+1)}, BaselineSamples: map[string][]float64{"cpu": samples}},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "valid",
+			body: CanaryAnalysisRequest{DeploymentID: "d1", CanarySamples: map[string][]float64{"cpu": samples}, BaselineSamples: map[string][]float64{"cpu": samples}},
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/analyze-canary", bytes.NewReader(body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
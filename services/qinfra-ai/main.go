@@ -3,14 +3,12 @@ package main
 import (
 	"fmt"
 	"log"
-	"math"
 	"math/rand"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 const (
@@ -22,6 +20,8 @@ const (
 type QInfraAI struct {
 	aiEngineURL string
 	models      map[string]interface{}
+	outcomes    PatchOutcomeStore
+	remediation *RemediationKB
 }
 
 // DriftPrediction represents a drift prediction result
@@ -55,6 +55,10 @@ type PatchRiskAssessment struct {
 	TestingRequired string    `json:"testing_required"`
 	Recommendation  string    `json:"recommendation"`
 	AssessedAt      time.Time `json:"assessed_at"`
+	// Basis says whether the score rests on recorded deployments of similar
+	// patches, and how many, or on the heuristic failure rate
+	Basis   string           `json:"basis"`
+	Factors PatchRiskFactors `json:"factors"`
 }
 
 // AnomalyDetection represents detected anomalies
@@ -68,6 +72,13 @@ type AnomalyDetection struct {
 	Pattern         string    `json:"pattern"`
 	FirstSeen       time.Time `json:"first_seen"`
 	Recommendation  string    `json:"recommendation"`
+	// Metric is the metric that deviated, with its value, the baseline it
+	// was compared to and how many standard deviations away it was
+	Metric   string  `json:"metric,omitempty"`
+	Value    float64 `json:"value"`
+	Baseline float64 `json:"baseline"`
+	StdDev   float64 `json:"std_dev"`
+	ZScore   float64 `json:"z_score"`
 }
 
 // RemediationAdvice represents AI-generated remediation advice
@@ -81,6 +92,11 @@ type RemediationAdvice struct {
 	RiskOfFix       string    `json:"risk_of_fix"`
 	AlternativeActions []string `json:"alternative_actions"`
 	GeneratedAt     time.Time `json:"generated_at"`
+	// KnowledgeBaseEntry is the knowledge base entry the steps came from;
+	// Fallback is set when none matched the issue type
+	KnowledgeBaseEntry string  `json:"kb_entry"`
+	MatchQuality       float64 `json:"match_quality"`
+	Fallback           bool    `json:"fallback"`
 }
 
 // Step represents a remediation step
@@ -104,6 +120,9 @@ type CanaryAnalysis struct {
 	Anomalies       []string  `json:"anomalies"`
 	Recommendation  string    `json:"recommendation"`
 	AnalyzedAt      time.Time `json:"analyzed_at"`
+	// Confidence is the level the metrics were compared at
+	Confidence float64                       `json:"confidence"`
+	Metrics    map[string]CanaryMetricResult `json:"metrics"`
 }
 
 // RiskDashboard represents overall infrastructure risk
@@ -144,6 +163,8 @@ func NewQInfraAI() *QInfraAI {
 	return &QInfraAI{
 		aiEngineURL: aiURL,
 		models:      make(map[string]interface{}),
+		outcomes:    newOutcomeStore(),
+		remediation: newRemediationKB(),
 	}
 }
 
@@ -174,6 +195,7 @@ func main() {
 		
 		// Patch Risk Assessment
 		apiV1.POST("/assess-patch-risk", ai.assessPatchRisk)
+		apiV1.POST("/patch-outcomes", ai.recordPatchOutcome)
 		
 		// Anomaly Detection
 		apiV1.POST("/detect-anomalies", ai.detectAnomalies)
@@ -285,286 +307,100 @@ func (ai *QInfraAI) performDriftPrediction(nodeID, platform string, state map[st
 
 // assessPatchRisk evaluates the risk of applying a patch
 func (ai *QInfraAI) assessPatchRisk(c *gin.Context) {
-	var request struct {
-		PatchID      string   `json:"patch_id"`
-		CVE          string   `json:"cve"`
-		TargetNodes  []string `json:"target_nodes"`
-		Environment  string   `json:"environment"`
-		Dependencies []string `json:"dependencies,omitempty"`
-	}
-
+	var request PatchRiskRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Simulate risk assessment
-	assessment := ai.performPatchRiskAssessment(request)
+	assessment := ai.performPatchRiskAssessment(c.Request.Context(), request)
 
 	c.JSON(http.StatusOK, assessment)
 }
 
-// performPatchRiskAssessment simulates patch risk analysis
-func (ai *QInfraAI) performPatchRiskAssessment(request struct {
-	PatchID      string   `json:"patch_id"`
-	CVE          string   `json:"cve"`
-	TargetNodes  []string `json:"target_nodes"`
-	Environment  string   `json:"environment"`
-	Dependencies []string `json:"dependencies,omitempty"`
-}) PatchRiskAssessment {
-	rand.Seed(time.Now().UnixNano())
-	
-	// Simulate ML-based risk scoring
-	baseRisk := rand.Float64() * 0.5 // Base risk 0-0.5
-	
-	// Adjust based on environment
-	if request.Environment == "production" {
-		baseRisk += 0.2
-	}
-	
-	// Adjust based on dependencies
-	dependencyRisk := float64(len(request.Dependencies)) * 0.05
-	totalRisk := math.Min(baseRisk+dependencyRisk, 1.0)
-	
-	successProbability := 1.0 - totalRisk
-	
-	testingRequired := "Basic validation"
-	if totalRisk > 0.7 {
-		testingRequired = "Full regression testing with canary deployment"
-	} else if totalRisk > 0.4 {
-		testingRequired = "Integration testing with staged rollout"
+// recordPatchOutcome stores how a patch deployment went, for scoring
+// similar patches
+func (ai *QInfraAI) recordPatchOutcome(c *gin.Context) {
+	var request PatchOutcomeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	
-	recommendation := "Safe to deploy with standard procedures"
-	if totalRisk > 0.7 {
-		recommendation = "High risk - recommend extensive testing and phased rollout"
-	} else if totalRisk > 0.4 {
-		recommendation = "Medium risk - deploy to staging first, monitor for 24 hours"
+	if err := request.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	return PatchRiskAssessment{
-		PatchID:            request.PatchID,
-		CVE:                request.CVE,
-		RiskScore:          totalRisk,
-		SuccessProbability: successProbability,
-		ImpactRadius:       fmt.Sprintf("%d nodes", len(request.TargetNodes)),
-		Dependencies:       request.Dependencies,
-		TestingRequired:    testingRequired,
-		Recommendation:     recommendation,
-		AssessedAt:         time.Now(),
+	outcome := newPatchOutcome(request)
+	if err := ai.outcomes.RecordOutcome(c.Request.Context(), outcome); err != nil {
+		log.Printf("Failed to record outcome of patch %s: %v", outcome.PatchID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record patch outcome"})
+		return
 	}
+
+	c.JSON(http.StatusCreated, outcome)
 }
 
 // detectAnomalies identifies unusual patterns in infrastructure
 func (ai *QInfraAI) detectAnomalies(c *gin.Context) {
-	var request struct {
-		Platform   string                   `json:"platform"`
-		Metrics    map[string]float64       `json:"metrics"`
-		TimeWindow string                   `json:"time_window"`
-		Nodes      []map[string]interface{} `json:"nodes,omitempty"`
-	}
-
+	var request AnomalyDetectionRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Simulate anomaly detection
-	anomalies := ai.performAnomalyDetection(request)
-
-	c.JSON(http.StatusOK, gin.H{
-		"anomalies_detected": len(anomalies),
-		"anomalies": anomalies,
-	})
-}
-
-// performAnomalyDetection simulates anomaly detection
-func (ai *QInfraAI) performAnomalyDetection(request struct {
-	Platform   string                   `json:"platform"`
-	Metrics    map[string]float64       `json:"metrics"`
-	TimeWindow string                   `json:"time_window"`
-	Nodes      []map[string]interface{} `json:"nodes,omitempty"`
-}) []AnomalyDetection {
-	anomalies := []AnomalyDetection{}
-	
-	// Simulate detection of various anomaly types
-	if request.Metrics["cpu_usage"] > 80 {
-		anomalies = append(anomalies, AnomalyDetection{
-			ID:           uuid.New().String(),
-			Type:         "resource_spike",
-			Severity:     "high",
-			AnomalyScore: 0.85,
-			Description:  "Unusual CPU usage pattern detected",
-			AffectedNodes: []string{"node-001", "node-002"},
-			Pattern:      "Sudden spike without corresponding workload increase",
-			FirstSeen:    time.Now().Add(-30 * time.Minute),
-			Recommendation: "Investigate process causing CPU spike, possible crypto-mining",
-		})
+	if err := request.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	
-	// Configuration drift anomaly
-	anomalies = append(anomalies, AnomalyDetection{
-		ID:           uuid.New().String(),
-		Type:         "configuration_drift",
-		Severity:     "medium",
-		AnomalyScore: 0.62,
-		Description:  "Unexpected configuration changes detected",
-		AffectedNodes: []string{"node-003"},
-		Pattern:      "Files modified outside of deployment window",
-		FirstSeen:    time.Now().Add(-2 * time.Hour),
-		Recommendation: "Review recent changes, restore from golden image if unauthorized",
-	})
 
-	return anomalies
+	report := ai.performAnomalyDetection(request)
+
+	c.JSON(http.StatusOK, report)
 }
 
 // recommendAction provides AI-generated remediation advice
 func (ai *QInfraAI) recommendAction(c *gin.Context) {
-	var request struct {
-		IssueID     string                 `json:"issue_id"`
-		IssueType   string                 `json:"issue_type"`
-		Severity    string                 `json:"severity"`
-		Context     map[string]interface{} `json:"context"`
-		Constraints []string               `json:"constraints,omitempty"`
-	}
+	var request RemediationRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate remediation advice
-	advice := ai.generateRemediationAdvice(request)
+	advice, err := ai.generateRemediationAdvice(request)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, advice)
 }
 
-// generateRemediationAdvice creates AI-powered remediation steps
-func (ai *QInfraAI) generateRemediationAdvice(request struct {
-	IssueID     string                 `json:"issue_id"`
-	IssueType   string                 `json:"issue_type"`
-	Severity    string                 `json:"severity"`
-	Context     map[string]interface{} `json:"context"`
-	Constraints []string               `json:"constraints,omitempty"`
-}) RemediationAdvice {
-	// Simulate AI-generated remediation based on issue type
-	var steps []Step
-	autoFixable := false
-	confidenceScore := 0.0
-	estimatedTime := "5 minutes"
-	riskOfFix := "low"
-	
-	switch request.IssueType {
-	case "drift":
-		autoFixable = true
-		confidenceScore = 0.92
-		steps = []Step{
-			{
-				Order:      1,
-				Action:     "Backup current configuration",
-				Command:    "kubectl create backup drift-backup-$(date +%s)",
-				Validation: "Verify backup created successfully",
-				Rollback:   "N/A",
-			},
-			{
-				Order:      2,
-				Action:     "Apply golden image configuration",
-				Command:    "qinfra apply-golden-image --node=${NODE_ID}",
-				Validation: "Check configuration matches golden image",
-				Rollback:   "kubectl restore backup drift-backup-*",
-			},
-			{
-				Order:      3,
-				Action:     "Verify services are running",
-				Command:    "qinfra verify-services --node=${NODE_ID}",
-				Validation: "All services report healthy status",
-				Rollback:   "kubectl rollback deployment",
-			},
-		}
-		
-	case "vulnerability":
-		autoFixable = request.Severity != "critical"
-		confidenceScore = 0.78
-		estimatedTime = "15 minutes"
-		riskOfFix = "medium"
-		steps = []Step{
-			{
-				Order:      1,
-				Action:     "Identify affected packages",
-				Command:    "qinfra scan-vulnerabilities --cve=${CVE_ID}",
-				Validation: "List of affected packages generated",
-			},
-			{
-				Order:      2,
-				Action:     "Test patch in staging",
-				Command:    "qinfra test-patch --env=staging --cve=${CVE_ID}",
-				Validation: "Patch successfully applied in staging",
-			},
-			{
-				Order:      3,
-				Action:     "Apply patch with canary deployment",
-				Command:    "qinfra patch --canary=10% --cve=${CVE_ID}",
-				Validation: "Monitor error rates for 30 minutes",
-				Rollback:   "qinfra rollback-patch --cve=${CVE_ID}",
-			},
-			{
-				Order:      4,
-				Action:     "Complete rollout",
-				Command:    "qinfra patch --complete --cve=${CVE_ID}",
-				Validation: "All nodes patched successfully",
-				Rollback:   "qinfra rollback-patch --all --cve=${CVE_ID}",
-			},
-		}
-		
-	default:
-		confidenceScore = 0.65
-		estimatedTime = "30 minutes"
-		steps = []Step{
-			{
-				Order:      1,
-				Action:     "Investigate issue",
-				Command:    "qinfra diagnose --issue=${ISSUE_ID}",
-				Validation: "Root cause identified",
-			},
-			{
-				Order:      2,
-				Action:     "Apply recommended fix",
-				Command:    "qinfra fix --issue=${ISSUE_ID} --dry-run",
-				Validation: "Dry run completed without errors",
-			},
-		}
+// generateRemediationAdvice renders remediation steps from the knowledge base
+func (ai *QInfraAI) generateRemediationAdvice(request RemediationRequest) (RemediationAdvice, error) {
+	kb := ai.remediation
+	if kb == nil {
+		kb = defaultRemediationKB
 	}
-
-	return RemediationAdvice{
-		IssueID:         request.IssueID,
-		IssueType:       request.IssueType,
-		AutoFixable:     autoFixable,
-		ConfidenceScore: confidenceScore,
-		Steps:           steps,
-		EstimatedTime:   estimatedTime,
-		RiskOfFix:       riskOfFix,
-		AlternativeActions: []string{
-			"Schedule manual intervention",
-			"Isolate affected nodes",
-			"Revert to previous golden image",
-		},
-		GeneratedAt:     time.Now(),
+	advice, err := kb.Advise(request)
+	if err != nil {
+		return RemediationAdvice{}, err
 	}
+	advice.GeneratedAt = time.Now()
+	return advice, nil
 }
 
 // analyzeCanary performs canary deployment analysis
 func (ai *QInfraAI) analyzeCanary(c *gin.Context) {
-	var request struct {
-		DeploymentID string             `json:"deployment_id"`
-		CanaryMetrics map[string]float64 `json:"canary_metrics"`
-		BaselineMetrics map[string]float64 `json:"baseline_metrics"`
-		Duration      string             `json:"duration"`
-	}
-
+	var request CanaryAnalysisRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := request.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Analyze canary deployment
 	analysis := ai.performCanaryAnalysis(request)
@@ -572,66 +408,6 @@ func (ai *QInfraAI) analyzeCanary(c *gin.Context) {
 	c.JSON(http.StatusOK, analysis)
 }
 
-// performCanaryAnalysis analyzes canary deployment safety
-func (ai *QInfraAI) performCanaryAnalysis(request struct {
-	DeploymentID string             `json:"deployment_id"`
-	CanaryMetrics map[string]float64 `json:"canary_metrics"`
-	BaselineMetrics map[string]float64 `json:"baseline_metrics"`
-	Duration      string             `json:"duration"`
-}) CanaryAnalysis {
-	// Calculate differences between canary and baseline
-	errorRateDiff := request.CanaryMetrics["error_rate"] - request.BaselineMetrics["error_rate"]
-	latencyDiff := request.CanaryMetrics["latency"] - request.BaselineMetrics["latency"]
-	cpuDiff := request.CanaryMetrics["cpu"] - request.BaselineMetrics["cpu"]
-	memoryDiff := request.CanaryMetrics["memory"] - request.BaselineMetrics["memory"]
-	
-	// Calculate overall canary score (0-100, higher is better)
-	canaryScore := 100.0
-	anomalies := []string{}
-	
-	if errorRateDiff > 0.01 { // 1% increase in errors
-		canaryScore -= 30
-		anomalies = append(anomalies, "Error rate increased by "+fmt.Sprintf("%.2f%%", errorRateDiff*100))
-	}
-	
-	if latencyDiff > request.BaselineMetrics["latency"]*0.1 { // 10% latency increase
-		canaryScore -= 20
-		anomalies = append(anomalies, "Latency increased by "+fmt.Sprintf("%.2fms", latencyDiff))
-	}
-	
-	if cpuDiff > request.BaselineMetrics["cpu"]*0.2 { // 20% CPU increase
-		canaryScore -= 15
-		anomalies = append(anomalies, "CPU usage increased significantly")
-	}
-	
-	if memoryDiff > request.BaselineMetrics["memory"]*0.15 { // 15% memory increase
-		canaryScore -= 10
-		anomalies = append(anomalies, "Memory usage increased")
-	}
-	
-	safeToProceed := canaryScore >= 70
-	recommendation := "Safe to proceed with full rollout"
-	
-	if canaryScore < 50 {
-		recommendation = "Rollback immediately - significant degradation detected"
-	} else if canaryScore < 70 {
-		recommendation = "Investigate issues before proceeding - moderate concerns detected"
-	}
-
-	return CanaryAnalysis{
-		DeploymentID:   request.DeploymentID,
-		CanaryScore:    canaryScore,
-		SafeToProceed:  safeToProceed,
-		ErrorRate:      errorRateDiff,
-		LatencyImpact:  latencyDiff,
-		CPUImpact:      cpuDiff,
-		MemoryImpact:   memoryDiff,
-		Anomalies:      anomalies,
-		Recommendation: recommendation,
-		AnalyzedAt:     time.Now(),
-	}
-}
-
 // getRiskDashboard provides overall infrastructure risk assessment
 func (ai *QInfraAI) getRiskDashboard(c *gin.Context) {
 	// Generate comprehensive risk dashboard
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// seedOutcomes records n deployments of a package, the first failures of
+// which failed
+func seedOutcomes(t *testing.T, store PatchOutcomeStore, pkg, platform string, n, failures int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		success := i >= failures
+		outcome := newPatchOutcome(PatchOutcomeRequest{
+			PatchID:  fmt.Sprintf("%s-patch-%d", pkg, i),
+			Package:  pkg,
+			Platform: platform,
+			Nodes:    []string{"node-1"},
+			Success:  &success,
+		})
+		if err := store.RecordOutcome(context.Background(), outcome); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func nodes(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("node-%d", i)
+	}
+	return ids
+}
+
+func TestPackageFamily(t *testing.T) {
+	tests := map[string]string{
+		"openssl":                  "openssl",
+		"openssl-libs-3.0.7":       "openssl",
+		"OpenSSL3":                 "openssl",
+		"openssh-server":           "openssh",
+		"kernel-5.14.0-362.el9":    "kernel",
+		"python3.11":               "python",
+		"nginx=1.24.0-1~jammy":     "nginx",
+		"log4j-core@2.17.1":        "log4j",
+		"libcurl-devel":            "libcurl",
+		"  Apache2-Utils ":         "apache",
+		"github.com/gin-gonic/gin": "github.com/gin-gonic/gin",
+		"":                         "",
+	}
+	for name, want := range tests {
+		if got := packageFamily(name); got != want {
+			t.Errorf("packageFamily(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestPatchRiskOrderingFromHistory(t *testing.T) {
+	store := newMemoryOutcomeStore()
+	seedOutcomes(t, store, "openssl", "linux", 20, 0)
+	seedOutcomes(t, store, "kernel", "linux", 10, 1)
+	seedOutcomes(t, store, "nginx", "linux", 10, 6)
+	// Failures on another platform don't count against openssl on linux
+	seedOutcomes(t, store, "openssl", "windows", 10, 10)
+	ai := &QInfraAI{outcomes: store}
+
+	assess := func(pkg string) PatchRiskAssessment {
+		return ai.performPatchRiskAssessment(context.Background(), PatchRiskRequest{
+			PatchID:     pkg + "-update",
+			Package:     pkg,
+			Platform:    "Linux",
+			TargetNodes: nodes(10),
+			Environment: "production",
+		})
+	}
+	reliable, kernel, unknown, flaky := assess("openssl-libs"), assess("kernel"), assess("redis"), assess("nginx")
+
+	ordered := []PatchRiskAssessment{reliable, kernel, unknown, flaky}
+	for i := 1; i < len(ordered); i++ {
+		if ordered[i-1].RiskScore >= ordered[i].RiskScore {
+			t.Errorf("%s risk %.4f isn't below %s risk %.4f", ordered[i-1].Factors.PackageFamily, ordered[i-1].RiskScore,
+				ordered[i].Factors.PackageFamily, ordered[i].RiskScore)
+		}
+	}
+
+	if reliable.Factors.Method != "historical" || reliable.Factors.History.Samples != 20 || !strings.Contains(reliable.Basis, "0 of 20") {
+		t.Errorf("openssl basis = %q, factors = %+v, want 20 historical samples", reliable.Basis, reliable.Factors)
+	}
+	if unknown.Factors.Method != "heuristic" || unknown.Factors.History.Samples != 0 || !strings.HasPrefix(unknown.Basis, "Heuristic") {
+		t.Errorf("redis basis = %q, want the heuristic labeled", unknown.Basis)
+	}
+	if unknown.Factors.FailureProbability != HeuristicFailureRate {
+		t.Errorf("heuristic failure probability = %f, want %f", unknown.Factors.FailureProbability, HeuristicFailureRate)
+	}
+	if flaky.SuccessProbability >= 0.5 || flaky.RiskScore <= 0.4 {
+		t.Errorf("nginx success %.4f, risk %.4f, want a likely failure scored medium or higher", flaky.SuccessProbability, flaky.RiskScore)
+	}
+}
+
+func TestPatchRiskFactorsOrdering(t *testing.T) {
+	ai := &QInfraAI{outcomes: newMemoryOutcomeStore()}
+	assess := func(request PatchRiskRequest) float64 {
+		request.Package = "openssl"
+		return ai.performPatchRiskAssessment(context.Background(), request).RiskScore
+	}
+
+	tests := []struct {
+		name          string
+		lower, higher PatchRiskRequest
+	}{
+		{
+			name:   "environment",
+			lower:  PatchRiskRequest{Environment: "staging", TargetNodes: nodes(5)},
+			higher: PatchRiskRequest{Environment: "production", TargetNodes: nodes(5)},
+		},
+		{
+			name:   "development below staging",
+			lower:  PatchRiskRequest{Environment: "development", TargetNodes: nodes(5)},
+			higher: PatchRiskRequest{Environment: "staging", TargetNodes: nodes(5)},
+		},
+		{
+			name:   "blast radius",
+			lower:  PatchRiskRequest{Environment: "production", TargetNodes: nodes(2)},
+			higher: PatchRiskRequest{Environment: "production", TargetNodes: nodes(200)},
+		},
+		{
+			name:   "dependencies",
+			lower:  PatchRiskRequest{Environment: "production", TargetNodes: nodes(5)},
+			higher: PatchRiskRequest{Environment: "production", TargetNodes: nodes(5), Dependencies: []string{"libssl", "curl", "nginx"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if lower, higher := assess(tt.lower), assess(tt.higher); lower >= higher {
+				t.Errorf("risk %.4f isn't below %.4f", lower, higher)
+			}
+		})
+	}
+}
+
+func TestPatchRiskIsDeterministic(t *testing.T) {
+	store := newMemoryOutcomeStore()
+	seedOutcomes(t, store, "openssl", "linux", 8, 3)
+	ai := &QInfraAI{outcomes: store}
+	request := PatchRiskRequest{PatchID: "openssl-3.0.13", Platform: "linux", TargetNodes: nodes(12), Environment: "production", Dependencies: []string{"nginx"}}
+
+	first := ai.performPatchRiskAssessment(context.Background(), request)
+	for i := 0; i < 5; i++ {
+		again := ai.performPatchRiskAssessment(context.Background(), request)
+		if again.RiskScore != first.RiskScore || again.Recommendation != first.Recommendation {
+			t.Fatalf("assessment %d = %.4f %q, want %.4f %q", i, again.RiskScore, again.Recommendation, first.RiskScore, first.Recommendation)
+		}
+	}
+
+	// (3 + 0.4) / (8 + 2) = 0.34; log10(13) / log10(1001) = 0.3713; 1 / 11 = 0.0909
+	want := 1.0 * (0.7*0.34 + 0.2*0.3713 + 0.1*0.0909)
+	if diff := first.RiskScore - want; diff > 0.0002 || diff < -0.0002 {
+		t.Errorf("risk = %.4f, want %.4f from the documented formula", first.RiskScore, want)
+	}
+}
+
+func patchRouter(ai *QInfraAI) *gin.Engine {
+	router := gin.New()
+	router.POST("/api/v1/assess-patch-risk", ai.assessPatchRisk)
+	router.POST("/api/v1/patch-outcomes", ai.recordPatchOutcome)
+	return router
+}
+
+func post(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload)))
+	return w
+}
+
+func TestRecordPatchOutcome(t *testing.T) {
+	router := patchRouter(&QInfraAI{outcomes: newMemoryOutcomeStore()})
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		want int
+	}{
+		{name: "missing success", body: map[string]interface{}{"patch_id": "p1", "nodes": []string{"n1"}}, want: http.StatusBadRequest},
+		{name: "no nodes", body: map[string]interface{}{"patch_id": "p1", "nodes": []string{}, "success": true}, want: http.StatusBadRequest},
+		{name: "negative duration", body: map[string]interface{}{"patch_id": "p1", "nodes": []string{"n1"}, "success": true, "duration_seconds": -1}, want: http.StatusBadRequest},
+		{name: "failure", body: map[string]interface{}{"patch_id": "nginx-1.24.0", "platform": "linux", "nodes": []string{"n1", "n2"}, "success": false, "duration_seconds": 42}, want: http.StatusCreated},
+		{name: "rollback", body: map[string]interface{}{"patch_id": "p2", "package": "nginx", "platform": "linux", "nodes": []string{"n1"}, "success": true, "rolled_back": true}, want: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := post(router, "/api/v1/patch-outcomes", tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	w := post(router, "/api/v1/assess-patch-risk", PatchRiskRequest{PatchID: "nginx-1.25.3", Platform: "linux", TargetNodes: []string{"n1"}})
+	var assessment PatchRiskAssessment
+	if err := json.Unmarshal(w.Body.Bytes(), &assessment); err != nil {
+		t.Fatal(err)
+	}
+	if history := assessment.Factors.History; history.Samples != 2 || history.Failures != 2 || history.Rollbacks != 1 {
+		t.Errorf("history = %+v, want both recorded nginx deployments counted as failures", history)
+	}
+}
+
+func TestPostgresOutcomeStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := &postgresOutcomeStore{db: db}
+
+	success := true
+	outcome := newPatchOutcome(PatchOutcomeRequest{PatchID: "p1", Package: "openssl-libs", Platform: "Linux", Environment: "production",
+		Nodes: []string{"n1", "n2"}, Success: &success, DurationSeconds: 30})
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO patch_outcomes")).
+		WithArgs(outcome.ID, "p1", "openssl", "linux", "production", `["n1","n2"]`, 2, true, false, 30.0, outcome.RecordedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := store.RecordOutcome(context.Background(), outcome); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM patch_outcomes WHERE package_family = $1 AND platform = $2")).
+		WithArgs("openssl", "linux").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "failures", "rollbacks"}).AddRow(12, 3, 1))
+	history, err := store.SimilarOutcomes(context.Background(), "openssl", "linux")
+	if err != nil || history != (PatchHistory{Samples: 12, Failures: 3, Rollbacks: 1}) {
+		t.Errorf("history = %+v, %v", history, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fallbackIssueType is the issue type of the entry answering issue types
+// the knowledge base has no entry for
+const fallbackIssueType = "*"
+
+// unknownConditionCredit is how much a condition the request says nothing
+// about counts towards match quality, against 1 for a satisfied one
+const unknownConditionCredit = 0.5
+
+//go:embed remediation_kb.yaml
+var defaultRemediationKBData []byte
+
+// RemediationRequest is the body of /api/v1/recommend-action
+type RemediationRequest struct {
+	IssueID     string                 `json:"issue_id"`
+	IssueType   string                 `json:"issue_type"`
+	Severity    string                 `json:"severity"`
+	Context     map[string]interface{} `json:"context"`
+	Constraints []string               `json:"constraints,omitempty"`
+}
+
+// RemediationKB maps issue types and request context to remediation steps
+type RemediationKB struct {
+	Entries []*RemediationEntry `yaml:"entries" json:"entries"`
+}
+
+// RemediationEntry is the advice for one issue type under some conditions
+type RemediationEntry struct {
+	ID        string `yaml:"id" json:"id"`
+	IssueType string `yaml:"issue_type" json:"issue_type"`
+	// When maps "severity" or a context key to the values the entry applies to
+	When map[string][]string `yaml:"when" json:"when"`
+	// Requires lists "nodes", "cve" or context keys the steps need a value for
+	Requires           []string        `yaml:"requires" json:"requires"`
+	AutoFixable        bool            `yaml:"auto_fixable" json:"auto_fixable"`
+	Confidence         float64         `yaml:"confidence" json:"confidence"`
+	EstimatedTime      string          `yaml:"estimated_time" json:"estimated_time"`
+	RiskOfFix          string          `yaml:"risk_of_fix" json:"risk_of_fix"`
+	Steps              []*StepTemplate `yaml:"steps" json:"steps"`
+	AlternativeActions []string        `yaml:"alternative_actions" json:"alternative_actions"`
+}
+
+// StepTemplate is a remediation step whose fields are text/template
+// strings rendered with remediationData
+type StepTemplate struct {
+	Action     string `yaml:"action" json:"action"`
+	Command    string `yaml:"command" json:"command"`
+	Validation string `yaml:"validation" json:"validation"`
+	Rollback   string `yaml:"rollback" json:"rollback"`
+	// PerNode renders the step once for each node
+	PerNode bool `yaml:"per_node" json:"per_node"`
+
+	action, command, validation, rollback *template.Template
+}
+
+// remediationData is what step templates are rendered with
+type remediationData struct {
+	IssueID   string
+	IssueType string
+	Severity  string
+	NodeID    string
+	Nodes     []string
+	CVE       string
+	Context   map[string]interface{}
+}
+
+var stepFuncs = template.FuncMap{"join": strings.Join}
+
+var defaultRemediationKB = mustParseRemediationKB(defaultRemediationKBData)
+
+func mustParseRemediationKB(data []byte) *RemediationKB {
+	kb, err := parseRemediationKB(data)
+	if err != nil {
+		panic(fmt.Sprintf("embedded remediation knowledge base: %v", err))
+	}
+	return kb
+}
+
+// LoadRemediationKB reads a YAML or JSON knowledge base from path
+func LoadRemediationKB(path string) (*RemediationKB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	kb, err := ParseRemediationKB(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return kb, nil
+}
+
+// newRemediationKB loads the knowledge base at REMEDIATION_KB_PATH, keeping
+// the embedded one when it's unset or fails to load
+func newRemediationKB() *RemediationKB {
+	path := os.Getenv("REMEDIATION_KB_PATH")
+	if path == "" {
+		return defaultRemediationKB
+	}
+	kb, err := LoadRemediationKB(path)
+	if err != nil {
+		log.Printf("Warning: Remediation knowledge base unavailable: %v. Using the built-in one.", err)
+		return defaultRemediationKB
+	}
+	return kb
+}
+
+// ParseRemediationKB parses and validates a YAML or JSON knowledge base.
+// One without a fallback entry gets the default knowledge base's.
+func ParseRemediationKB(data []byte) (*RemediationKB, error) {
+	kb, err := parseRemediationKB(data)
+	if err != nil {
+		return nil, err
+	}
+	if kb.fallback() == nil {
+		kb.Entries = append(kb.Entries, defaultRemediationKB.fallback())
+	}
+	return kb, nil
+}
+
+func parseRemediationKB(data []byte) (*RemediationKB, error) {
+	var kb RemediationKB
+	if err := yaml.Unmarshal(data, &kb); err != nil {
+		return nil, err
+	}
+	if len(kb.Entries) == 0 {
+		return nil, errors.New("knowledge base has no entries")
+	}
+
+	ids := make(map[string]bool)
+	for i, entry := range kb.Entries {
+		if entry.ID == "" {
+			return nil, fmt.Errorf("entry %d has no id", i)
+		}
+		if ids[entry.ID] {
+			return nil, fmt.Errorf("duplicate entry %q", entry.ID)
+		}
+		ids[entry.ID] = true
+		if err := entry.compile(); err != nil {
+			return nil, fmt.Errorf("entry %q: %w", entry.ID, err)
+		}
+	}
+	return &kb, nil
+}
+
+func (e *RemediationEntry) compile() error {
+	if e.IssueType == "" {
+		return errors.New("no issue_type")
+	}
+	if e.Confidence <= 0 || e.Confidence > 1 {
+		return fmt.Errorf("confidence %v isn't in (0, 1]", e.Confidence)
+	}
+	if len(e.Steps) == 0 {
+		return errors.New("no steps")
+	}
+	for key, values := range e.When {
+		if len(values) == 0 {
+			return fmt.Errorf("condition on %q has no values", key)
+		}
+	}
+
+	// Rendering against sample data catches misspelled fields at load
+	// rather than on a request
+	sample := remediationData{IssueID: "ISSUE-1", NodeID: "node-1", Nodes: []string{"node-1"}, CVE: "CVE-2024-0001"}
+	for i, step := range e.Steps {
+		if step.Action == "" {
+			return fmt.Errorf("step %d has no action", i+1)
+		}
+		if step.PerNode && !e.requires("nodes") {
+			return fmt.Errorf("step %d is per_node but the entry doesn't require nodes", i+1)
+		}
+		fields := []struct {
+			name string
+			text string
+			tmpl **template.Template
+		}{
+			{"action", step.Action, &step.action},
+			{"command", step.Command, &step.command},
+			{"validation", step.Validation, &step.validation},
+			{"rollback", step.Rollback, &step.rollback},
+		}
+		for _, field := range fields {
+			tmpl, err := template.New(field.name).Funcs(stepFuncs).Option("missingkey=zero").Parse(field.text)
+			if err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+			if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+			*field.tmpl = tmpl
+		}
+	}
+	return nil
+}
+
+func (e *RemediationEntry) requires(name string) bool {
+	for _, required := range e.Requires {
+		if required == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (kb *RemediationKB) fallback() *RemediationEntry {
+	for _, entry := range kb.Entries {
+		if entry.IssueType == fallbackIssueType {
+			return entry
+		}
+	}
+	return nil
+}
+
+// remediationMatch is an entry applicable to a request
+type remediationMatch struct {
+	entry     *RemediationEntry
+	satisfied int
+	quality   float64
+}
+
+func (m remediationMatch) confidence() float64 {
+	return math.Round(m.entry.Confidence*m.quality*100) / 100
+}
+
+// match scores an entry against a request. An entry is excluded when the
+// request contradicts one of its conditions or lacks a value it requires.
+// Quality is (1 + satisfied + 0.5 × unknown) / (1 + conditions), so an
+// entry without conditions and one with every condition satisfied both
+// match fully.
+func (e *RemediationEntry) match(request RemediationRequest, data remediationData) (remediationMatch, bool) {
+	for _, required := range e.Requires {
+		if !hasRequiredValue(required, request, data) {
+			return remediationMatch{}, false
+		}
+	}
+
+	m := remediationMatch{entry: e}
+	unknown := 0
+	for key, values := range e.When {
+		value := conditionValue(key, request)
+		switch {
+		case value == "":
+			unknown++
+		case containsFold(values, value):
+			m.satisfied++
+		default:
+			return remediationMatch{}, false
+		}
+	}
+	m.quality = (1 + float64(m.satisfied) + unknownConditionCredit*float64(unknown)) / float64(1+len(e.When))
+	return m, true
+}
+
+func hasRequiredValue(name string, request RemediationRequest, data remediationData) bool {
+	switch name {
+	case "nodes":
+		return len(data.Nodes) > 0
+	case "cve":
+		return data.CVE != ""
+	default:
+		return conditionValue(name, request) != ""
+	}
+}
+
+func conditionValue(key string, request RemediationRequest) string {
+	if key == "severity" {
+		return request.Severity
+	}
+	return contextString(request.Context, key)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func contextString(ctx map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := ctx[key].(type) {
+		case string:
+			if v = strings.TrimSpace(v); v != "" {
+				return v
+			}
+		case float64, bool:
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// contextNodes reads node IDs from context.node_ids, context.nodes or
+// context.node_id
+func contextNodes(ctx map[string]interface{}) []string {
+	var nodes []string
+	for _, key := range []string{"node_ids", "nodes"} {
+		switch v := ctx[key].(type) {
+		case []interface{}:
+			for _, node := range v {
+				if id, ok := node.(string); ok && strings.TrimSpace(id) != "" {
+					nodes = append(nodes, strings.TrimSpace(id))
+				}
+			}
+		case []string:
+			nodes = append(nodes, v...)
+		}
+		if len(nodes) > 0 {
+			return nodes
+		}
+	}
+	if id := contextString(ctx, "node_id"); id != "" {
+		return []string{id}
+	}
+	return nil
+}
+
+func newRemediationData(request RemediationRequest) remediationData {
+	data := remediationData{
+		IssueID:   request.IssueID,
+		IssueType: request.IssueType,
+		Severity:  request.Severity,
+		Nodes:     contextNodes(request.Context),
+		CVE:       contextString(request.Context, "cve", "cve_id"),
+		Context:   request.Context,
+	}
+	if len(data.Nodes) > 0 {
+		data.NodeID = data.Nodes[0]
+	}
+	return data
+}
+
+// Advise picks the entry best matching a request and renders its steps.
+// The entry satisfying the most conditions wins, then the one with the
+// highest confidence, then the one listed first. Requests matching no
+// entry for their issue type get the fallback entry.
+func (kb *RemediationKB) Advise(request RemediationRequest) (RemediationAdvice, error) {
+	data := newRemediationData(request)
+
+	var best *remediationMatch
+	for _, entry := range kb.Entries {
+		if !strings.EqualFold(entry.IssueType, request.IssueType) {
+			continue
+		}
+		m, ok := entry.match(request, data)
+		if !ok {
+			continue
+		}
+		if best == nil || m.satisfied > best.satisfied ||
+			(m.satisfied == best.satisfied && m.confidence() > best.confidence()) {
+			best = &m
+		}
+	}
+
+	fallback := best == nil
+	if fallback {
+		entry := kb.fallback()
+		if entry == nil {
+			return RemediationAdvice{}, fmt.Errorf("no remediation for issue type %q", request.IssueType)
+		}
+		m, ok := entry.match(request, data)
+		if !ok {
+			return RemediationAdvice{}, fmt.Errorf("no remediation for issue type %q", request.IssueType)
+		}
+		best = &m
+	}
+
+	steps, err := best.entry.render(data)
+	if err != nil {
+		return RemediationAdvice{}, fmt.Errorf("entry %q: %w", best.entry.ID, err)
+	}
+	return RemediationAdvice{
+		IssueID:            request.IssueID,
+		IssueType:          request.IssueType,
+		AutoFixable:        best.entry.AutoFixable,
+		ConfidenceScore:    best.confidence(),
+		Steps:              steps,
+		EstimatedTime:      best.entry.EstimatedTime,
+		RiskOfFix:          best.entry.RiskOfFix,
+		AlternativeActions: best.entry.AlternativeActions,
+		KnowledgeBaseEntry: best.entry.ID,
+		MatchQuality:       math.Round(best.quality*100) / 100,
+		Fallback:           fallback,
+	}, nil
+}
+
+func (e *RemediationEntry) render(data remediationData) ([]Step, error) {
+	var steps []Step
+	for _, tmpl := range e.Steps {
+		runs := []remediationData{data}
+		if tmpl.PerNode {
+			runs = runs[:0]
+			for _, node := range data.Nodes {
+				run := data
+				run.NodeID = node
+				runs = append(runs, run)
+			}
+		}
+		for _, run := range runs {
+			step, err := tmpl.render(run)
+			if err != nil {
+				return nil, err
+			}
+			step.Order = len(steps) + 1
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+func (s *StepTemplate) render(data remediationData) (Step, error) {
+	var step Step
+	fields := []struct {
+		tmpl *template.Template
+		out  *string
+	}{
+		{s.action, &step.Action},
+		{s.command, &step.Command},
+		{s.validation, &step.Validation},
+		{s.rollback, &step.Rollback},
+	}
+	for _, field := range fields {
+		var b strings.Builder
+		if err := field.tmpl.Execute(&b, data); err != nil {
+			return Step{}, err
+		}
+		*field.out = b.String()
+	}
+	return step, nil
+}
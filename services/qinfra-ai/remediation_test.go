@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testRemediationKB = `
+entries:
+  - id: drift-restore
+    issue_type: drift
+    requires: [nodes]
+    auto_fixable: true
+    confidence: 0.9
+    steps:
+      - action: "Restore {{.NodeID}}"
+        command: "qinfra restore --node={{.NodeID}}"
+        per_node: true
+      - action: "Verify {{join .Nodes \",\"}}"
+  - id: vuln-patch
+    issue_type: vulnerability
+    requires: [cve]
+    auto_fixable: true
+    confidence: 0.8
+    steps:
+      - action: "Patch {{.CVE}}"
+        command: "qinfra patch --cve={{.CVE}}"
+  - id: vuln-kernel
+    issue_type: vulnerability
+    when:
+      package: [kernel]
+      severity: [critical, high]
+    requires: [cve]
+    confidence: 0.8
+    steps:
+      - action: "Live patch {{.CVE}} on {{.Context.package}}"
+        command: "qinfra livepatch --cve={{.CVE}}"
+`
+
+func loadTestKB(t *testing.T, content string) *RemediationKB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kb.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	kb, err := LoadRemediationKB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kb
+}
+
+func TestRemediationRendersContext(t *testing.T) {
+	kb := loadTestKB(t, testRemediationKB)
+
+	advice, err := kb.Advise(RemediationRequest{IssueID: "D-1", IssueType: "drift",
+		Context: map[string]interface{}{"node_ids": []interface{}{"web-1", "web-2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Step{
+		{Order: 1, Action: "Restore web-1", Command: "qinfra restore --node=web-1"},
+		{Order: 2, Action: "Restore web-2", Command: "qinfra restore --node=web-2"},
+		{Order: 3, Action: "Verify web-1,web-2"},
+	}
+	if len(advice.Steps) != len(want) {
+		t.Fatalf("steps = %+v, want %+v", advice.Steps, want)
+	}
+	for i := range want {
+		if advice.Steps[i] != want[i] {
+			t.Errorf("step %d = %+v, want %+v", i+1, advice.Steps[i], want[i])
+		}
+	}
+	if advice.KnowledgeBaseEntry != "drift-restore" || advice.Fallback || advice.ConfidenceScore != 0.9 {
+		t.Errorf("advice = %+v, want drift-restore at full confidence", advice)
+	}
+
+	advice, err = kb.Advise(RemediationRequest{IssueType: "vulnerability", Context: map[string]interface{}{"cve": "CVE-2024-3094"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(advice.Steps) != 1 || advice.Steps[0].Command != "qinfra patch --cve=CVE-2024-3094" {
+		t.Errorf("steps = %+v, want the CVE rendered", advice.Steps)
+	}
+}
+
+func TestRemediationMatchQuality(t *testing.T) {
+	kb := loadTestKB(t, testRemediationKB)
+	advise := func(severity string, context map[string]interface{}) RemediationAdvice {
+		advice, err := kb.Advise(RemediationRequest{IssueType: "vulnerability", Severity: severity, Context: context})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return advice
+	}
+
+	full := advise("critical", map[string]interface{}{"cve": "CVE-2024-1086", "package": "kernel"})
+	if full.KnowledgeBaseEntry != "vuln-kernel" || full.MatchQuality != 1 || full.ConfidenceScore != 0.8 {
+		t.Errorf("advice = %+v, want vuln-kernel fully matched", full)
+	}
+	if full.Steps[0].Action != "Live patch CVE-2024-1086 on kernel" {
+		t.Errorf("action = %q", full.Steps[0].Action)
+	}
+
+	// Unknown severity: the kernel entry still wins on its satisfied
+	// condition but with less confidence
+	partial := advise("", map[string]interface{}{"cve": "CVE-2024-1086", "package": "kernel"})
+	if partial.KnowledgeBaseEntry != "vuln-kernel" || partial.ConfidenceScore >= full.ConfidenceScore {
+		t.Errorf("advice = %+v, want vuln-kernel below %.2f confidence", partial, full.ConfidenceScore)
+	}
+
+	// A contradicted condition rules the kernel entry out
+	if other := advise("low", map[string]interface{}{"cve": "CVE-2024-1086", "package": "kernel"}); other.KnowledgeBaseEntry != "vuln-patch" {
+		t.Errorf("entry = %q, want vuln-patch", other.KnowledgeBaseEntry)
+	}
+	if other := advise("critical", map[string]interface{}{"cve": "CVE-2023-44487", "package": "nginx"}); other.KnowledgeBaseEntry != "vuln-patch" {
+		t.Errorf("entry = %q, want vuln-patch", other.KnowledgeBaseEntry)
+	}
+}
+
+func TestRemediationFallback(t *testing.T) {
+	kb := loadTestKB(t, testRemediationKB)
+
+	tests := []struct {
+		name    string
+		request RemediationRequest
+	}{
+		{name: "unknown issue type", request: RemediationRequest{IssueID: "X-9", IssueType: "certificate-expiry"}},
+		{name: "missing required cve", request: RemediationRequest{IssueID: "V-2", IssueType: "vulnerability"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advice, err := kb.Advise(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !advice.Fallback || advice.AutoFixable || len(advice.Steps) == 0 {
+				t.Fatalf("advice = %+v, want the fallback investigation", advice)
+			}
+			if !strings.Contains(advice.Steps[0].Command, tt.request.IssueID) {
+				t.Errorf("command = %q, want issue %s", advice.Steps[0].Command, tt.request.IssueID)
+			}
+		})
+	}
+}
+
+func TestParseRemediationKBErrors(t *testing.T) {
+	tests := map[string]string{
+		"no entries":        `entries: []`,
+		"bad template":      `{"entries": [{"id": "a", "issue_type": "drift", "confidence": 0.5, "steps": [{"action": "{{.NodeID"}]}]}`,
+		"unknown field":     `{"entries": [{"id": "a", "issue_type": "drift", "confidence": 0.5, "steps": [{"action": "{{.Node}}"}]}]}`,
+		"confidence":        `{"entries": [{"id": "a", "issue_type": "drift", "confidence": 1.5, "steps": [{"action": "x"}]}]}`,
+		"no steps":          `{"entries": [{"id": "a", "issue_type": "drift", "confidence": 0.5}]}`,
+		"per node unneeded": `{"entries": [{"id": "a", "issue_type": "drift", "confidence": 0.5, "steps": [{"action": "x", "per_node": true}]}]}`,
+	}
+	for name, content := range tests {
+		if _, err := ParseRemediationKB([]byte(content)); err == nil {
+			t.Errorf("%s: parsed without error", name)
+		}
+	}
+}
+
+func TestRecommendActionDefaultKB(t *testing.T) {
+	router := gin.New()
+	router.POST("/api/v1/recommend-action", (&QInfraAI{}).recommendAction)
+
+	w := post(router, "/api/v1/recommend-action", RemediationRequest{IssueID: "V-7", IssueType: "vulnerability", Severity: "critical",
+		Context: map[string]interface{}{"cve_id": "CVE-2024-6387", "node_ids": []string{"bastion-1"}}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var advice RemediationAdvice
+	if err := json.Unmarshal(w.Body.Bytes(), &advice); err != nil {
+		t.Fatal(err)
+	}
+	if advice.AutoFixable || advice.KnowledgeBaseEntry != "vulnerability-critical" {
+		t.Errorf("advice = %+v, want critical vulnerabilities left to an operator", advice)
+	}
+	if command := advice.Steps[0].Command; !strings.Contains(command, "CVE-2024-6387") || !strings.Contains(command, "bastion-1") {
+		t.Errorf("command = %q, want the CVE and node rendered", command)
+	}
+}
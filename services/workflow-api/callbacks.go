@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/webhook"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	workflowpb "go.temporal.io/api/workflow/v1"
+)
+
+const (
+	// DefaultCallbackMaxAttempts is how many times a callback is tried
+	DefaultCallbackMaxAttempts = 5
+
+	// DefaultCallbackBackoff is the wait before the first retry; it doubles
+	// on each attempt up to DefaultCallbackMaxBackoff
+	DefaultCallbackBackoff    = 1 * time.Second
+	DefaultCallbackMaxBackoff = 1 * time.Minute
+
+	// DefaultCallbackPollInterval is how often watched workflows are checked
+	DefaultCallbackPollInterval = 5 * time.Second
+
+	callbackTimeout = 10 * time.Second
+	callbackWorkers = 4
+)
+
+// Callback is where to report a workflow's outcome
+type Callback struct {
+	URL    string
+	Secret string
+}
+
+// CallbackPayload is the body POSTed to a callback URL when a workflow closes
+type CallbackPayload struct {
+	Event        string       `json:"event"`
+	WorkflowID   string       `json:"workflow_id"`
+	RunID        string       `json:"run_id"`
+	WorkflowType string       `json:"workflow_type"`
+	Status       string       `json:"status"`
+	StartTime    *time.Time   `json:"start_time,omitempty"`
+	CloseTime    *time.Time   `json:"close_time,omitempty"`
+	Result       interface{}  `json:"result,omitempty"`
+	Error        string       `json:"error,omitempty"`
+	Capsule      *CapsuleInfo `json:"capsule,omitempty"`
+}
+
+type callbackWatch struct {
+	workflowID string
+	runID      string
+	callback   Callback
+}
+
+type closedWorkflow struct {
+	watch callbackWatch
+	info  *workflowpb.WorkflowExecutionInfo
+}
+
+// CallbackWatcher polls the workflows that asked for a callback and, once
+// one closes, posts its outcome to the callback URL. Watches live in memory,
+// so workflows started before a restart get no callback.
+type CallbackWatcher struct {
+	enabled      bool
+	pollInterval time.Duration
+	sender       *webhook.Sender
+
+	watches map[string]callbackWatch
+	mu      sync.Mutex
+	closed  chan closedWorkflow
+}
+
+// NewCallbackWatcher creates a watcher configured from CALLBACKS_ENABLED,
+// CALLBACK_POLL_SECONDS, CALLBACK_MAX_ATTEMPTS and CALLBACK_BACKOFF_SECONDS
+func NewCallbackWatcher() *CallbackWatcher {
+	w := &CallbackWatcher{
+		enabled:      os.Getenv("CALLBACKS_ENABLED") != "false",
+		pollInterval: DefaultCallbackPollInterval,
+		watches:      make(map[string]callbackWatch),
+		closed:       make(chan closedWorkflow, 100),
+	}
+	maxAttempts := DefaultCallbackMaxAttempts
+	backoff := DefaultCallbackBackoff
+
+	if v := os.Getenv("CALLBACK_POLL_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			w.pollInterval = time.Duration(n) * time.Second
+		}
+	}
+	if v := os.Getenv("CALLBACK_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxAttempts = n
+		}
+	}
+	if v := os.Getenv("CALLBACK_BACKOFF_SECONDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			backoff = time.Duration(n) * time.Second
+		}
+	}
+
+	w.sender = webhook.New(webhook.Config{
+		HeaderPrefix: "X-QuantumLayer",
+		MaxAttempts:  maxAttempts,
+		Backoff:      backoff,
+		MaxBackoff:   DefaultCallbackMaxBackoff,
+		HTTPClient:   &http.Client{Timeout: callbackTimeout},
+		OnRetry: func(delivery webhook.Delivery, attempt int, wait time.Duration, err error) {
+			log.Printf("Callback attempt %d to %s failed, retrying in %s: %v", attempt, delivery.URL, wait, err)
+		},
+	})
+	return w
+}
+
+var callbacks = NewCallbackWatcher()
+
+// Start runs the poll loop and the delivery workers until ctx is done
+func (w *CallbackWatcher) Start(ctx context.Context) {
+	if !w.enabled {
+		log.Printf("Workflow callbacks are disabled")
+		return
+	}
+
+	for i := 0; i < callbackWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case closed := <-w.closed:
+					w.notify(ctx, closed)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.poll(ctx)
+			}
+		}
+	}()
+}
+
+// Watch registers a callback for when the workflow run closes
+func (w *CallbackWatcher) Watch(workflowID, runID string, callback Callback) {
+	w.mu.Lock()
+	w.watches[workflowID] = callbackWatch{workflowID: workflowID, runID: runID, callback: callback}
+	w.mu.Unlock()
+}
+
+// poll checks each watched workflow once and hands closed ones to the
+// delivery workers
+func (w *CallbackWatcher) poll(ctx context.Context) {
+	w.mu.Lock()
+	watches := make([]callbackWatch, 0, len(w.watches))
+	for _, watch := range w.watches {
+		watches = append(watches, watch)
+	}
+	w.mu.Unlock()
+
+	for _, watch := range watches {
+		describeCtx, cancel := context.WithTimeout(ctx, callbackTimeout)
+		resp, err := temporalClient.DescribeWorkflowExecution(describeCtx, watch.workflowID, watch.runID)
+		cancel()
+		if err != nil {
+			var notFound *serviceerror.NotFound
+			if errors.As(err, &notFound) {
+				log.Printf("Dropping callback for workflow %s: workflow not found", watch.workflowID)
+				w.unwatch(watch.workflowID)
+			} else {
+				log.Printf("Failed to check workflow %s for callback: %v", watch.workflowID, err)
+			}
+			continue
+		}
+
+		info := resp.GetWorkflowExecutionInfo()
+		if info.GetStatus() == enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING {
+			continue
+		}
+
+		w.unwatch(watch.workflowID)
+		select {
+		case w.closed <- closedWorkflow{watch: watch, info: info}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *CallbackWatcher) unwatch(workflowID string) {
+	w.mu.Lock()
+	delete(w.watches, workflowID)
+	w.mu.Unlock()
+}
+
+// notify builds the payload for a closed workflow and delivers it, logging
+// a dead letter if every attempt fails
+func (w *CallbackWatcher) notify(ctx context.Context, closed closedWorkflow) {
+	payload := w.buildPayload(ctx, closed)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode callback for workflow %s: %v", payload.WorkflowID, err)
+		return
+	}
+
+	attempts, err := w.deliver(ctx, closed.watch.callback, payload.Event, body)
+	if err != nil {
+		log.Printf("Callback dead letter: workflow=%s event=%s url=%s attempts=%d error=%v",
+			payload.WorkflowID, payload.Event, closed.watch.callback.URL, attempts, err)
+		return
+	}
+	log.Printf("Delivered %s callback for workflow %s", payload.Event, payload.WorkflowID)
+}
+
+func (w *CallbackWatcher) buildPayload(ctx context.Context, closed closedWorkflow) CallbackPayload {
+	info := closed.info
+	status := statusName(info.GetStatus())
+	payload := CallbackPayload{
+		Event:        "workflow." + status,
+		WorkflowID:   closed.watch.workflowID,
+		RunID:        closed.watch.runID,
+		WorkflowType: info.GetType().GetName(),
+		Status:       status,
+	}
+	if info.GetStartTime() != nil {
+		t := info.GetStartTime().AsTime()
+		payload.StartTime = &t
+	}
+	if info.GetCloseTime() != nil {
+		t := info.GetCloseTime().AsTime()
+		payload.CloseTime = &t
+	}
+
+	// The run's result, or the error it failed, timed out or was stopped with
+	resultCtx, cancel := context.WithTimeout(ctx, callbackTimeout)
+	defer cancel()
+	var result interface{}
+	if err := temporalClient.GetWorkflow(resultCtx, closed.watch.workflowID, closed.watch.runID).Get(resultCtx, &result); err != nil {
+		payload.Error = err.Error()
+	} else {
+		payload.Result = result
+	}
+
+	// Wait for the capsule so the callback can link to it
+	if info.GetStatus() == enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED {
+		packageCtx, cancelPackage := context.WithTimeout(ctx, packageTimeout)
+		defer cancelPackage()
+		payload.Capsule = packager.Package(packageCtx, closed.watch.workflowID)
+	}
+	return payload
+}
+
+// deliver posts a callback, retrying failed attempts with exponential
+// backoff. It returns the number of attempts made.
+func (w *CallbackWatcher) deliver(ctx context.Context, callback Callback, event string, body []byte) (int, error) {
+	return w.sender.Send(ctx, webhook.Delivery{
+		URL:    callback.URL,
+		Secret: callback.Secret,
+		Event:  event,
+		Body:   body,
+	})
+}
+
+// takeCallback removes the callback from a request, so its URL and secret
+// stay out of the workflow's history, and returns it if one was given
+func takeCallback(req *CodeGenerationRequest) *Callback {
+	if req.CallbackURL == "" {
+		return nil
+	}
+	callback := &Callback{URL: req.CallbackURL, Secret: req.CallbackSecret}
+	req.CallbackURL = ""
+	req.CallbackSecret = ""
+	return callback
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/webhook"
+)
+
+// receiver answers with statuses in turn, repeating the last one, and
+// records the headers and body of every request
+type receiver struct {
+	statuses []int
+
+	mu       sync.Mutex
+	requests []http.Header
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.requests = append(r.requests, req.Header)
+	r.bodies = append(r.bodies, body)
+	n := len(r.requests)
+	r.mu.Unlock()
+
+	status := r.statuses[len(r.statuses)-1]
+	if n <= len(r.statuses) {
+		status = r.statuses[n-1]
+	}
+	w.WriteHeader(status)
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	t.Helper()
+	recv := &receiver{statuses: statuses}
+	srv := httptest.NewServer(recv)
+	t.Cleanup(srv.Close)
+	return recv, srv.URL
+}
+
+// testWatcher retries up to 4 times, recording waits instead of sleeping
+func testWatcher(waits *[]time.Duration) *CallbackWatcher {
+	return &CallbackWatcher{
+		sender: webhook.New(webhook.Config{
+			HeaderPrefix: "X-QuantumLayer",
+			MaxAttempts:  4,
+			Backoff:      time.Second,
+			MaxBackoff:   3 * time.Second,
+			Sleep: func(_ context.Context, d time.Duration) error {
+				*waits = append(*waits, d)
+				return nil
+			},
+		}),
+	}
+}
+
+func TestCallbackDeliver(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+		wantWaits    []time.Duration
+	}{
+		{"delivered", []int{200}, 1, false, nil},
+		{"retried after server error", []int{502, 204}, 2, false, []time.Duration{time.Second}},
+		{"retried after rate limiting", []int{429, 429, 200}, 3, false, []time.Duration{time.Second, 2 * time.Second}},
+		{"backoff capped", []int{500}, 4, true, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+		{"client error is not retried", []int{404, 200}, 1, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recv, url := newReceiver(t, tt.statuses...)
+			var waits []time.Duration
+			body := []byte(`{"event":"workflow.completed","workflow_id":"wf-1"}`)
+
+			attempts, err := testWatcher(&waits).deliver(context.Background(), Callback{URL: url, Secret: "s3cret"}, "workflow.completed", body)
+			if attempts != tt.wantAttempts || len(recv.requests) != tt.wantAttempts {
+				t.Fatalf("attempts = %d, received %d; want %d", attempts, len(recv.requests), tt.wantAttempts)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if len(waits) != len(tt.wantWaits) {
+				t.Fatalf("waits = %v, want %v", waits, tt.wantWaits)
+			}
+			for i := range waits {
+				if waits[i] != tt.wantWaits[i] {
+					t.Fatalf("waits = %v, want %v", waits, tt.wantWaits)
+				}
+			}
+
+			for i, header := range recv.requests {
+				if header.Get("X-QuantumLayer-Event") != "workflow.completed" || header.Get("Content-Type") != "application/json" {
+					t.Fatalf("attempt %d headers = %v", i+1, header)
+				}
+				if header.Get("X-QuantumLayer-Signature") != "sha256="+webhook.Sign("s3cret", body) || string(recv.bodies[i]) != string(body) {
+					t.Fatalf("attempt %d is not the signed payload", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestCallbackDeliverReportsStatus(t *testing.T) {
+	_, url := newReceiver(t, http.StatusGone)
+	var waits []time.Duration
+
+	_, err := testWatcher(&waits).deliver(context.Background(), Callback{URL: url}, "workflow.failed", []byte("{}"))
+	var werr *webhook.Error
+	if !errors.As(err, &werr) || werr.StatusCode != http.StatusGone || werr.Retryable {
+		t.Fatalf("err = %v, want a non-retryable 410", err)
+	}
+}
+
+func TestCallbackDeliverWithoutSecretIsUnsigned(t *testing.T) {
+	recv, url := newReceiver(t, http.StatusOK)
+	var waits []time.Duration
+
+	if _, err := testWatcher(&waits).deliver(context.Background(), Callback{URL: url}, "workflow.completed", []byte("{}")); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if sig := recv.requests[0].Get("X-QuantumLayer-Signature"); sig != "" {
+		t.Fatalf("signature = %q, want none without a secret", sig)
+	}
+}
+
+func TestCallbackDeliverStopsWhenContextDone(t *testing.T) {
+	recv, url := newReceiver(t, http.StatusServiceUnavailable)
+	w := &CallbackWatcher{sender: webhook.New(webhook.Config{MaxAttempts: 5, Backoff: time.Hour})}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	attempts, err := w.deliver(ctx, Callback{URL: url}, "workflow.completed", []byte("{}"))
+	if !errors.Is(err, context.Canceled) || attempts != 1 || len(recv.requests) != 1 {
+		t.Fatalf("attempts = %d, err = %v; want to stop after the first attempt", attempts, err)
+	}
+}
+
+func TestNewCallbackWatcherMaxAttempts(t *testing.T) {
+	t.Setenv("CALLBACK_MAX_ATTEMPTS", "1")
+	recv, url := newReceiver(t, http.StatusInternalServerError)
+
+	attempts, err := NewCallbackWatcher().deliver(context.Background(), Callback{URL: url}, "workflow.completed", []byte("{}"))
+	if err == nil || attempts != 1 || len(recv.requests) != 1 {
+		t.Fatalf("attempts = %d, err = %v; want a single failed attempt", attempts, err)
+	}
+}
+
+func TestTakeCallback(t *testing.T) {
+	req := &CodeGenerationRequest{CallbackURL: "https://example.com/hook", CallbackSecret: "s3cret"}
+	callback := takeCallback(req)
+	if callback == nil || callback.URL != "https://example.com/hook" || callback.Secret != "s3cret" {
+		t.Fatalf("callback = %+v", callback)
+	}
+	if req.CallbackURL != "" || req.CallbackSecret != "" {
+		t.Fatalf("request still carries the callback: %+v", req)
+	}
+	if takeCallback(&CodeGenerationRequest{}) != nil {
+		t.Fatal("callback returned for a request without one")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+)
+
+// IdempotencyKeyHeader lets a client without its own request ID retry a
+// start without starting the workflow twice
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the header we accept
+const maxIdempotencyKeyLength = 255
+
+// requestID returns the ID a start is keyed on: the one the client sent,
+// else one derived from its Idempotency-Key, else a fresh one. It responds
+// and returns false when the key is too long.
+func requestID(c *gin.Context, id string) (string, bool) {
+	if id != "" {
+		return id, true
+	}
+	key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+	if key == "" {
+		return uuid.New().String(), true
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid Idempotency-Key",
+			"details": "Idempotency-Key must be at most 255 characters",
+		})
+		return "", false
+	}
+	// Hashed so any header value makes a well formed workflow ID
+	sum := sha256.Sum256([]byte(key))
+	return "idem-" + hex.EncodeToString(sum[:16]), true
+}
+
+// startWorkflow starts a workflow that is rejected if its ID was used
+// before, so a retried request can't run it twice. It returns the new run,
+// or responds and returns false when the start failed or repeated an
+// earlier one; a repeat gets 200 with the workflow already started.
+func startWorkflow(c *gin.Context, options client.StartWorkflowOptions, workflowType string, arg interface{}, failure string) (client.WorkflowRun, bool) {
+	options.WorkflowIDReusePolicy = enumspb.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE
+	options.WorkflowExecutionErrorWhenAlreadyStarted = true
+
+	ctx := c.Request.Context()
+	traceWorkflowStart(ctx, options, workflowType)
+
+	we, err := temporalClient.ExecuteWorkflow(ctx, options, workflowType, arg)
+	if err == nil {
+		return we, true
+	}
+
+	var started *serviceerror.WorkflowExecutionAlreadyStarted
+	if errors.As(err, &started) {
+		c.JSON(http.StatusOK, WorkflowResponse{
+			WorkflowID:     options.ID,
+			RunID:          started.RunId,
+			Status:         "already_started",
+			Message:        "A workflow with this ID was already started; returning it instead of starting another",
+			AlreadyRunning: true,
+		})
+		return nil, false
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   failure,
+		"details": err.Error(),
+	})
+	return nil, false
+}
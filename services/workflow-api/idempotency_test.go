@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+)
+
+// fakeTemporal starts each workflow ID once, rejecting repeats the way the
+// server does under WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE
+type fakeTemporal struct {
+	client.Client
+	mu      sync.Mutex
+	started map[string]client.StartWorkflowOptions
+	err     error
+}
+
+func (f *fakeTemporal) ExecuteWorkflow(_ context.Context, options client.StartWorkflowOptions, _ interface{}, _ ...interface{}) (client.WorkflowRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	if _, ok := f.started[options.ID]; ok {
+		return nil, serviceerror.NewWorkflowExecutionAlreadyStarted("already started", "", "run-"+options.ID)
+	}
+	f.started[options.ID] = options
+	return completedRun{id: options.ID}, nil
+}
+
+// testTemporal replaces the global Temporal client for the test
+func testTemporal(t *testing.T) *fakeTemporal {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	f := &fakeTemporal{started: make(map[string]client.StartWorkflowOptions)}
+	previous := temporalClient
+	temporalClient = f
+	t.Cleanup(func() { temporalClient = previous })
+	return f
+}
+
+func postStart(path, body string, headers map[string]string) (*httptest.ResponseRecorder, WorkflowResponse) {
+	r := gin.New()
+	r.POST("/api/v1/workflows/generate", handleGenerateCode)
+	r.POST("/api/v1/workflows/generate-extended", handleGenerateExtendedCode)
+	r.POST("/api/v1/workflows/generate-intelligent", handleGenerateIntelligentCode)
+	r.POST("/api/v1/workflows/generate-infrastructure", handleGenerateInfrastructure)
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp WorkflowResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+const generateBody = `{"id": "req-1", "prompt": "Create a REST API", "language": "python", "type": "api"}`
+
+func TestDuplicateStartReturnsExistingWorkflow(t *testing.T) {
+	infraBody := `{"workflow_id": "code-gen-req-1", "provider": "aws"}`
+	tests := []struct {
+		path, body, workflowID string
+	}{
+		{"/api/v1/workflows/generate", generateBody, "code-gen-req-1"},
+		{"/api/v1/workflows/generate-extended", generateBody, "extended-code-gen-req-1"},
+		{"/api/v1/workflows/generate-intelligent", generateBody, "intelligent-code-gen-req-1"},
+		{"/api/v1/workflows/generate-infrastructure", infraBody, "infra-for-code-gen-req-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			temporal := testTemporal(t)
+
+			w, first := postStart(tt.path, tt.body, nil)
+			if w.Code != http.StatusAccepted || first.AlreadyRunning {
+				t.Fatalf("first start = %d %s, want 202", w.Code, w.Body)
+			}
+			if first.WorkflowID != tt.workflowID {
+				t.Errorf("workflow ID = %q, want %q", first.WorkflowID, tt.workflowID)
+			}
+			if policy := temporal.started[tt.workflowID].WorkflowIDReusePolicy; policy != enumspb.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE {
+				t.Errorf("reuse policy = %v, want reject duplicate", policy)
+			}
+
+			w, again := postStart(tt.path, tt.body, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("repeated start = %d %s, want 200", w.Code, w.Body)
+			}
+			if !again.AlreadyRunning || again.WorkflowID != tt.workflowID || again.RunID != "run-"+tt.workflowID {
+				t.Errorf("repeated start = %+v, want the existing workflow flagged already_running", again)
+			}
+			if len(temporal.started) != 1 {
+				t.Errorf("started %d workflows, want 1", len(temporal.started))
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyDerivesWorkflowID(t *testing.T) {
+	temporal := testTemporal(t)
+	body := `{"prompt": "Create a REST API", "language": "python", "type": "api"}`
+	key := map[string]string{IdempotencyKeyHeader: "client-retry-7"}
+
+	_, first := postStart("/api/v1/workflows/generate", body, key)
+	w, again := postStart("/api/v1/workflows/generate", body, key)
+	if w.Code != http.StatusOK || !again.AlreadyRunning || again.WorkflowID != first.WorkflowID {
+		t.Fatalf("retry with the same key = %d %+v, want the first workflow %s", w.Code, again, first.WorkflowID)
+	}
+
+	_, other := postStart("/api/v1/workflows/generate", body, map[string]string{IdempotencyKeyHeader: "client-retry-8"})
+	_, unkeyed := postStart("/api/v1/workflows/generate", body, nil)
+	if other.AlreadyRunning || unkeyed.AlreadyRunning || len(temporal.started) != 3 {
+		t.Errorf("started %d workflows, want a new one for another key and for no key", len(temporal.started))
+	}
+
+	w, _ = postStart("/api/v1/workflows/generate", body, map[string]string{IdempotencyKeyHeader: strings.Repeat("k", 256)})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("oversized key = %d, want 400", w.Code)
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	temporal := testTemporal(t)
+	temporal.err = errors.New("temporal unavailable")
+
+	w, _ := postStart("/api/v1/workflows/generate", generateBody, nil)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "temporal unavailable") {
+		t.Errorf("response = %d %s, want 500 with the error", w.Code, w.Body)
+	}
+}
@@ -2,56 +2,66 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/contracts"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.temporal.io/sdk/client"
 )
 
-type CodeGenerationRequest struct {
-	ID           string                 `json:"id,omitempty"`
-	Prompt       string                 `json:"prompt" binding:"required"`
-	Language     string                 `json:"language" binding:"required"`
-	Framework    string                 `json:"framework,omitempty"`
-	Type         string                 `json:"type" binding:"required"`
-	GenerateTests bool                  `json:"generate_tests,omitempty"`
-	GenerateDocs  bool                  `json:"generate_docs,omitempty"`
-	Requirements map[string]interface{} `json:"requirements,omitempty"`
-}
-
-type WorkflowResponse struct {
-	WorkflowID string `json:"workflow_id"`
-	RunID      string `json:"run_id"`
-	Status     string `json:"status"`
-	Message    string `json:"message"`
-}
+// The public request and response bodies live in the shared contracts
+// package, which api-docs generates the OpenAPI spec from
+type (
+	CodeGenerationRequest = contracts.CodeGenerationRequest
+	WorkflowResponse      = contracts.WorkflowResponse
+	TerminateRequest      = contracts.TerminateRequest
+)
 
 var temporalClient client.Client
 
 func main() {
+	shutdownTracing := initTracing()
+	defer shutdownTracing()
+
+	loadValidationConfig()
+
 	// Initialize Temporal client
 	temporalHost := os.Getenv("TEMPORAL_HOST")
 	if temporalHost == "" {
 		temporalHost = "temporal-frontend.temporal.svc.cluster.local:7233"
 	}
 
-	c, err := client.Dial(client.Options{
-		HostPort:  temporalHost,
-		Namespace: "quantumlayer",
-	})
+	options, err := temporalClientOptions(temporalHost)
+	if err != nil {
+		log.Fatal("Unable to create Temporal tracing interceptor", err)
+	}
+
+	c, err := client.Dial(options)
 	if err != nil {
 		log.Fatal("Unable to create Temporal client", err)
 	}
 	defer c.Close()
 	temporalClient = c
 
+	// Report closed workflows to the callbacks requests asked for
+	callbacks.Start(context.Background())
+
+	// Package the workflows that asked for a capsule once they complete
+	packager.Start(context.Background())
+
 	// Setup Gin router
 	r := gin.Default()
+	r.Use(otelgin.Middleware(serviceName))
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -72,13 +82,16 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "ready"})
 	})
 
-	// Trigger code generation workflow
+	// Supported languages, frameworks and types
+	r.GET("/api/v1/capabilities", handleGetCapabilities)
+
+	// Trigger code generation workflow; ?wait=60s blocks for the result
 	r.POST("/api/v1/workflows/generate", handleGenerateCode)
 	
 	// Trigger extended code generation workflow
 	r.POST("/api/v1/workflows/generate-extended", handleGenerateExtendedCode)
 	
-	// Trigger intelligent code generation workflow (v2)
+	// Trigger intelligent code generation workflow (v2), also accepts ?wait=
 	r.POST("/api/v1/workflows/generate-intelligent", handleGenerateIntelligentCode)
 
 	// Get workflow status
@@ -86,6 +99,13 @@ func main() {
 
 	// Get workflow result
 	r.GET("/api/v1/workflows/:id/result", handleGetWorkflowResult)
+
+	// Get stage-level progress
+	r.GET("/api/v1/workflows/:id/progress", handleGetWorkflowProgress)
+
+	// Stop a running workflow
+	r.POST("/api/v1/workflows/:id/cancel", handleCancelWorkflow)
+	r.POST("/api/v1/workflows/:id/terminate", handleTerminateWorkflow)
 	
 	// Infrastructure generation endpoints
 	r.POST("/api/v1/workflows/generate-infrastructure", handleGenerateInfrastructure)
@@ -104,15 +124,21 @@ func main() {
 
 func handleGenerateCode(c *gin.Context) {
 	var req CodeGenerationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindGenerationRequest(c, &req) {
+		return
+	}
+	wait, ok := parseWait(c)
+	if !ok {
 		return
 	}
 
-	// Generate request ID if not provided
-	if req.ID == "" {
-		req.ID = uuid.New().String()
+	// Key the workflow on the client's ID or Idempotency-Key, so a retried
+	// request finds the workflow it already started
+	id, ok := requestID(c, req.ID)
+	if !ok {
+		return
 	}
+	req.ID = id
 
 	// Create workflow ID
 	workflowID := fmt.Sprintf("code-gen-%s", req.ID)
@@ -124,34 +150,26 @@ func handleGenerateCode(c *gin.Context) {
 		WorkflowExecutionTimeout: 5 * time.Minute,
 	}
 
-	// Start workflow
-	we, err := temporalClient.ExecuteWorkflow(
-		context.Background(),
-		options,
-		"CodeGenerationWorkflow",
-		req,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to start workflow",
-			"details": err.Error(),
-		})
+	callback := takeCallback(&req)
+	we, ok := startWorkflow(c, options, "CodeGenerationWorkflow", req, "Failed to start workflow")
+	if !ok {
 		return
 	}
+	if callback != nil {
+		callbacks.Watch(we.GetID(), we.GetRunID(), *callback)
+	}
+	if req.AutoPackage {
+		packager.Watch(we.GetID(), we.GetRunID(), req)
+	}
 
-	c.JSON(http.StatusAccepted, WorkflowResponse{
-		WorkflowID: we.GetID(),
-		RunID:      we.GetRunID(),
-		Status:     "started",
-		Message:    "Workflow started successfully",
-	})
+	respondWorkflowStarted(c, we, wait, "Workflow started successfully")
 }
 
 func handleGetWorkflow(c *gin.Context) {
 	workflowID := c.Param("id")
 
 	// Get workflow execution
-	ctx := context.Background()
+	ctx := c.Request.Context()
 	resp, err := temporalClient.DescribeWorkflowExecution(ctx, workflowID, "")
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Workflow not found"})
@@ -173,15 +191,17 @@ func handleGetWorkflow(c *gin.Context) {
 
 func handleGenerateExtendedCode(c *gin.Context) {
 	var req CodeGenerationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindGenerationRequest(c, &req) {
 		return
 	}
 
-	// Generate request ID if not provided
-	if req.ID == "" {
-		req.ID = uuid.New().String()
+	// Key the workflow on the client's ID or Idempotency-Key, so a retried
+	// request finds the workflow it already started
+	id, ok := requestID(c, req.ID)
+	if !ok {
+		return
 	}
+	req.ID = id
 
 	// Create workflow ID
 	workflowID := fmt.Sprintf("extended-code-gen-%s", req.ID)
@@ -193,20 +213,17 @@ func handleGenerateExtendedCode(c *gin.Context) {
 		WorkflowExecutionTimeout: 10 * time.Minute, // Extended timeout
 	}
 
-	// Start extended workflow
-	we, err := temporalClient.ExecuteWorkflow(
-		context.Background(),
-		options,
-		"ExtendedCodeGenerationWorkflow", // Use extended workflow
-		req,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to start extended workflow",
-			"details": err.Error(),
-		})
+	callback := takeCallback(&req)
+	we, ok := startWorkflow(c, options, "ExtendedCodeGenerationWorkflow", req, "Failed to start extended workflow")
+	if !ok {
 		return
 	}
+	if callback != nil {
+		callbacks.Watch(we.GetID(), we.GetRunID(), *callback)
+	}
+	if req.AutoPackage {
+		packager.Watch(we.GetID(), we.GetRunID(), req)
+	}
 
 	c.JSON(http.StatusAccepted, WorkflowResponse{
 		WorkflowID: we.GetID(),
@@ -218,15 +235,21 @@ func handleGenerateExtendedCode(c *gin.Context) {
 
 func handleGenerateIntelligentCode(c *gin.Context) {
 	var req CodeGenerationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindGenerationRequest(c, &req) {
+		return
+	}
+	wait, ok := parseWait(c)
+	if !ok {
 		return
 	}
 
-	// Generate request ID if not provided
-	if req.ID == "" {
-		req.ID = uuid.New().String()
+	// Key the workflow on the client's ID or Idempotency-Key, so a retried
+	// request finds the workflow it already started
+	id, ok := requestID(c, req.ID)
+	if !ok {
+		return
 	}
+	req.ID = id
 
 	// Create workflow ID
 	workflowID := fmt.Sprintf("intelligent-code-gen-%s", req.ID)
@@ -238,37 +261,29 @@ func handleGenerateIntelligentCode(c *gin.Context) {
 		WorkflowExecutionTimeout: 10 * time.Minute, // Extended timeout
 	}
 
-	// Start intelligent workflow
-	we, err := temporalClient.ExecuteWorkflow(
-		context.Background(),
-		options,
-		"IntelligentCodeGenerationWorkflow", // Use intelligent workflow
-		req,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to start intelligent workflow",
-			"details": err.Error(),
-		})
+	callback := takeCallback(&req)
+	we, ok := startWorkflow(c, options, "IntelligentCodeGenerationWorkflow", req, "Failed to start intelligent workflow")
+	if !ok {
 		return
 	}
+	if callback != nil {
+		callbacks.Watch(we.GetID(), we.GetRunID(), *callback)
+	}
+	if req.AutoPackage {
+		packager.Watch(we.GetID(), we.GetRunID(), req)
+	}
 
-	c.JSON(http.StatusAccepted, WorkflowResponse{
-		WorkflowID: we.GetID(),
-		RunID:      we.GetRunID(),
-		Status:     "started",
-		Message:    "Intelligent workflow started successfully (3 stages + multi-file generation)",
-	})
+	respondWorkflowStarted(c, we, wait, "Intelligent workflow started successfully (3 stages + multi-file generation)")
 }
 
 func handleGetWorkflowResult(c *gin.Context) {
 	workflowID := c.Param("id")
 
 	// Get workflow handle
-	we := temporalClient.GetWorkflow(context.Background(), workflowID, "")
+	we := temporalClient.GetWorkflow(c.Request.Context(), workflowID, "")
 
 	// Get result with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
 	var result interface{}
@@ -281,7 +296,110 @@ func handleGetWorkflowResult(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	// Workflows started with auto_package carry their capsule
+	packageCtx, cancelPackage := context.WithTimeout(c.Request.Context(), packageWait)
+	defer cancelPackage()
+	c.JSON(http.StatusOK, withCapsule(result, packager.Package(packageCtx, workflowID)))
+}
+
+// handleCancelWorkflow asks a running workflow to stop. The workflow gets a
+// chance to clean up, so it may take a moment to show as canceled.
+func handleCancelWorkflow(c *gin.Context) {
+	workflowID := c.Param("id")
+	ctx := c.Request.Context()
+
+	if !checkWorkflowRunning(c, workflowID) {
+		return
+	}
+
+	if err := temporalClient.CancelWorkflow(ctx, workflowID, ""); err != nil {
+		respondStopError(c, workflowID, "Failed to cancel workflow", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, WorkflowResponse{
+		WorkflowID: workflowID,
+		Status:     "canceling",
+		Message:    "Workflow cancellation requested",
+	})
+}
+
+// handleTerminateWorkflow stops a running workflow immediately, without
+// running any of its cleanup
+func handleTerminateWorkflow(c *gin.Context) {
+	workflowID := c.Param("id")
+	ctx := c.Request.Context()
+
+	var req TerminateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "Terminated via workflow API"
+	}
+
+	if !checkWorkflowRunning(c, workflowID) {
+		return
+	}
+
+	if err := temporalClient.TerminateWorkflow(ctx, workflowID, "", req.Reason); err != nil {
+		respondStopError(c, workflowID, "Failed to terminate workflow", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, WorkflowResponse{
+		WorkflowID: workflowID,
+		Status:     "terminated",
+		Message:    "Workflow terminated: " + req.Reason,
+	})
+}
+
+// checkWorkflowRunning responds with 404 or 409 and returns false unless the
+// workflow exists and is still running
+func checkWorkflowRunning(c *gin.Context, workflowID string) bool {
+	resp, err := temporalClient.DescribeWorkflowExecution(c.Request.Context(), workflowID, "")
+	if err != nil {
+		var notFound *serviceerror.NotFound
+		if errors.As(err, &notFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workflow not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to describe workflow",
+				"details": err.Error(),
+			})
+		}
+		return false
+	}
+
+	if info := resp.WorkflowExecutionInfo; info != nil && info.Status != enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "Workflow is no longer running",
+			"workflow_id": workflowID,
+			"status":      info.Status.String(),
+		})
+		return false
+	}
+	return true
+}
+
+// respondStopError reports a failed cancel or terminate. Temporal answers
+// NotFound when the workflow finished after we checked it.
+func respondStopError(c *gin.Context, workflowID, message string, err error) {
+	var notFound *serviceerror.NotFound
+	if errors.As(err, &notFound) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "Workflow is no longer running",
+			"workflow_id": workflowID,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   message,
+		"details": err.Error(),
+	})
 }
 
 // Infrastructure generation request
@@ -303,10 +421,15 @@ func handleGenerateInfrastructure(c *gin.Context) {
 		return
 	}
 
-	// Generate workflow ID
-	workflowID := fmt.Sprintf("infra-gen-%s", uuid.New().String())
-	if req.WorkflowID != "" {
-		workflowID = fmt.Sprintf("infra-for-%s", req.WorkflowID)
+	// Generate workflow ID. Infrastructure for a code workflow is keyed on
+	// it; otherwise on the Idempotency-Key, if any.
+	workflowID := fmt.Sprintf("infra-for-%s", req.WorkflowID)
+	if req.WorkflowID == "" {
+		id, ok := requestID(c, "")
+		if !ok {
+			return
+		}
+		workflowID = fmt.Sprintf("infra-gen-%s", id)
 	}
 
 	// Workflow options
@@ -317,17 +440,8 @@ func handleGenerateInfrastructure(c *gin.Context) {
 	}
 
 	// Start infrastructure workflow
-	we, err := temporalClient.ExecuteWorkflow(
-		context.Background(),
-		options,
-		"InfrastructureGenerationWorkflow",
-		req,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to start infrastructure workflow",
-			"details": err.Error(),
-		})
+	we, ok := startWorkflow(c, options, "InfrastructureGenerationWorkflow", req, "Failed to start infrastructure workflow")
+	if !ok {
 		return
 	}
 
@@ -343,7 +457,7 @@ func handleGetInfrastructureStatus(c *gin.Context) {
 	workflowID := c.Param("id")
 
 	// Get workflow execution
-	ctx := context.Background()
+	ctx := c.Request.Context()
 	resp, err := temporalClient.DescribeWorkflowExecution(ctx, workflowID, "")
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Infrastructure workflow not found"})
@@ -352,13 +466,7 @@ func handleGetInfrastructureStatus(c *gin.Context) {
 
 	status := "unknown"
 	if resp.WorkflowExecutionInfo != nil {
-		if resp.WorkflowExecutionInfo.Status == 1 { // Running
-			status = "running"
-		} else if resp.WorkflowExecutionInfo.Status == 2 { // Completed
-			status = "completed"
-		} else if resp.WorkflowExecutionInfo.Status == 3 { // Failed
-			status = "failed"
-		}
+		status = statusName(resp.WorkflowExecutionInfo.Status)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -367,4 +475,33 @@ func handleGetInfrastructureStatus(c *gin.Context) {
 		"start_time":  resp.WorkflowExecutionInfo.StartTime,
 		"close_time":  resp.WorkflowExecutionInfo.CloseTime,
 	})
-}
\ No newline at end of file
+}
+
+// statusName is the lower-case name of a workflow execution status
+func statusName(status enumspb.WorkflowExecutionStatus) string {
+	switch status {
+	case enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING:
+		return "running"
+	case enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED:
+		return "completed"
+	case enumspb.WORKFLOW_EXECUTION_STATUS_FAILED:
+		return "failed"
+	case enumspb.WORKFLOW_EXECUTION_STATUS_CANCELED:
+		return "canceled"
+	case enumspb.WORKFLOW_EXECUTION_STATUS_TERMINATED:
+		return "terminated"
+	case enumspb.WORKFLOW_EXECUTION_STATUS_TIMED_OUT:
+		return "timed_out"
+	default:
+		return "unknown"
+	}
+}
+
+// traceWorkflowStart tags the request span with the workflow being started
+func traceWorkflowStart(ctx context.Context, options client.StartWorkflowOptions, workflowType string) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("workflow.type", workflowType),
+		attribute.String("workflow.id", options.ID),
+		attribute.String("temporal.task_queue", options.TaskQueue),
+	)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+)
+
+// stopTemporal holds one workflow in the given status and records the
+// cancel and terminate calls made against it
+type stopTemporal struct {
+	client.Client
+	status     enumspb.WorkflowExecutionStatus // unset means the workflow doesn't exist
+	describe   error
+	stop       error
+	canceled   []string
+	terminated map[string]string // workflow ID to reason
+}
+
+func (f *stopTemporal) DescribeWorkflowExecution(_ context.Context, workflowID, _ string) (*workflowservice.DescribeWorkflowExecutionResponse, error) {
+	if f.describe != nil {
+		return nil, f.describe
+	}
+	if f.status == enumspb.WORKFLOW_EXECUTION_STATUS_UNSPECIFIED {
+		return nil, serviceerror.NewNotFound("workflow not found for ID: " + workflowID)
+	}
+	return &workflowservice.DescribeWorkflowExecutionResponse{
+		WorkflowExecutionInfo: &workflowpb.WorkflowExecutionInfo{Status: f.status},
+	}, nil
+}
+
+func (f *stopTemporal) CancelWorkflow(_ context.Context, workflowID, _ string) error {
+	if f.stop != nil {
+		return f.stop
+	}
+	f.canceled = append(f.canceled, workflowID)
+	return nil
+}
+
+func (f *stopTemporal) TerminateWorkflow(_ context.Context, workflowID, _, reason string, _ ...interface{}) error {
+	if f.stop != nil {
+		return f.stop
+	}
+	f.terminated[workflowID] = reason
+	return nil
+}
+
+// stopWorkflow posts to a cancel or terminate endpoint with f as the
+// Temporal client
+func stopWorkflow(t *testing.T, f *stopTemporal, path, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	f.terminated = map[string]string{}
+	previous := temporalClient
+	temporalClient = f
+	t.Cleanup(func() { temporalClient = previous })
+
+	r := gin.New()
+	r.POST("/api/v1/workflows/:id/cancel", handleCancelWorkflow)
+	r.POST("/api/v1/workflows/:id/terminate", handleTerminateWorkflow)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestCancelWorkflow(t *testing.T) {
+	running := enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING
+	tests := []struct {
+		name       string
+		temporal   stopTemporal
+		wantStatus int
+		wantCancel bool
+	}{
+		{"running", stopTemporal{status: running}, http.StatusAccepted, true},
+		{"unknown workflow", stopTemporal{}, http.StatusNotFound, false},
+		{"completed", stopTemporal{status: enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED}, http.StatusConflict, false},
+		{"already canceled", stopTemporal{status: enumspb.WORKFLOW_EXECUTION_STATUS_CANCELED}, http.StatusConflict, false},
+		{"finished after the check", stopTemporal{status: running, stop: serviceerror.NewNotFound("workflow execution already completed")}, http.StatusConflict, false},
+		{"describe fails", stopTemporal{describe: errors.New("temporal unavailable")}, http.StatusInternalServerError, false},
+		{"cancel fails", stopTemporal{status: running, stop: errors.New("temporal unavailable")}, http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, resp := stopWorkflow(t, &tt.temporal, "/api/v1/workflows/code-gen-req-1/cancel", "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			if canceled := len(tt.temporal.canceled) == 1; canceled != tt.wantCancel {
+				t.Errorf("canceled %v, want cancel %v", tt.temporal.canceled, tt.wantCancel)
+			}
+			if tt.wantCancel && (resp["workflow_id"] != "code-gen-req-1" || resp["status"] != "canceling") {
+				t.Errorf("response = %v", resp)
+			}
+			if w.Code == http.StatusConflict && resp["workflow_id"] != "code-gen-req-1" {
+				t.Errorf("conflict response = %v, want the workflow ID", resp)
+			}
+		})
+	}
+}
+
+func TestConflictReportsStatus(t *testing.T) {
+	f := &stopTemporal{status: enumspb.WORKFLOW_EXECUTION_STATUS_TERMINATED}
+	_, resp := stopWorkflow(t, f, "/api/v1/workflows/code-gen-req-1/cancel", "")
+	if resp["status"] != "Terminated" {
+		t.Errorf("response = %v, want the workflow's status", resp)
+	}
+}
+
+func TestTerminateWorkflow(t *testing.T) {
+	running := enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING
+	tests := []struct {
+		name       string
+		temporal   stopTemporal
+		body       string
+		wantStatus int
+		wantReason string // empty when the workflow must not be terminated
+	}{
+		{"with reason", stopTemporal{status: running}, `{"reason": "runaway generation"}`, http.StatusOK, "runaway generation"},
+		{"without body", stopTemporal{status: running}, "", http.StatusOK, "Terminated via workflow API"},
+		{"malformed body", stopTemporal{status: running}, `{"reason": `, http.StatusBadRequest, ""},
+		{"unknown workflow", stopTemporal{}, "", http.StatusNotFound, ""},
+		{"failed", stopTemporal{status: enumspb.WORKFLOW_EXECUTION_STATUS_FAILED}, "", http.StatusConflict, ""},
+		{"finished after the check", stopTemporal{status: running, stop: serviceerror.NewNotFound("workflow execution already completed")}, "", http.StatusConflict, ""},
+		{"terminate fails", stopTemporal{status: running, stop: errors.New("temporal unavailable")}, "", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, resp := stopWorkflow(t, &tt.temporal, "/api/v1/workflows/code-gen-req-1/terminate", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			reason, terminated := tt.temporal.terminated["code-gen-req-1"]
+			if terminated != (tt.wantReason != "") || reason != tt.wantReason {
+				t.Errorf("terminated with reason %q (%v), want %q", reason, terminated, tt.wantReason)
+			}
+			if tt.wantReason != "" && (resp["status"] != "terminated" || resp["message"] != "Workflow terminated: "+tt.wantReason) {
+				t.Errorf("response = %v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/contracts"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+)
+
+// Capsule states reported for workflows started with auto_package
+const (
+	CapsulePending  = "pending"
+	CapsulePackaged = "packaged"
+	CapsuleFailed   = "failed"
+)
+
+const (
+	// DefaultPackagePollInterval is how often watched workflows are checked
+	DefaultPackagePollInterval = 5 * time.Second
+
+	// packageTimeout bounds one call to the capsule builder
+	packageTimeout = 60 * time.Second
+
+	// packageWait is how long a result request waits for the capsule before
+	// reporting it as pending
+	packageWait = 10 * time.Second
+
+	// packageRetention is how long a packaged workflow's capsule is
+	// remembered for its result and progress
+	packageRetention = 24 * time.Hour
+)
+
+type CapsuleInfo = contracts.CapsuleInfo
+
+// packageJob is the capsule of one workflow. done is closed once the
+// builder has answered.
+type packageJob struct {
+	workflowID string
+	runID      string
+	request    capsuleBuildRequest
+	info       CapsuleInfo
+	started    bool
+	finishedAt time.Time
+	done       chan struct{}
+}
+
+// capsuleBuildRequest is the body of capsule-builder's build-from-workflow
+type capsuleBuildRequest struct {
+	WorkflowID string `json:"workflow_id"`
+	Language   string `json:"language,omitempty"`
+	Framework  string `json:"framework,omitempty"`
+	Type       string `json:"type,omitempty"`
+}
+
+// CapsulePackager builds a capsule for each workflow started with
+// auto_package once it completes, polling the workflows like the callback
+// watcher does. Reading a completed workflow's result packages it straight
+// away if the poll hasn't yet. Jobs live in memory, so workflows started
+// before a restart aren't packaged.
+type CapsulePackager struct {
+	builderURL   string
+	downloadURL  string
+	httpClient   *http.Client
+	pollInterval time.Duration
+
+	jobs map[string]*packageJob
+	mu   sync.Mutex
+}
+
+// NewCapsulePackager creates a packager for CAPSULE_BUILDER_URL. Download
+// links point at CAPSULE_DOWNLOAD_URL, which defaults to the builder.
+func NewCapsulePackager() *CapsulePackager {
+	builderURL := os.Getenv("CAPSULE_BUILDER_URL")
+	if builderURL == "" {
+		builderURL = "http://capsule-builder.quantumlayer.svc.cluster.local:8086"
+	}
+	downloadURL := os.Getenv("CAPSULE_DOWNLOAD_URL")
+	if downloadURL == "" {
+		downloadURL = builderURL
+	}
+	return &CapsulePackager{
+		builderURL:   strings.TrimSuffix(builderURL, "/"),
+		downloadURL:  strings.TrimSuffix(downloadURL, "/"),
+		httpClient:   &http.Client{Timeout: packageTimeout},
+		pollInterval: DefaultPackagePollInterval,
+		jobs:         make(map[string]*packageJob),
+	}
+}
+
+var packager = NewCapsulePackager()
+
+// Start runs the poll loop until ctx is done
+func (p *CapsulePackager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.poll(ctx)
+			}
+		}
+	}()
+}
+
+// Watch packages the workflow run once it completes
+func (p *CapsulePackager) Watch(workflowID, runID string, req CodeGenerationRequest) {
+	p.mu.Lock()
+	p.jobs[workflowID] = &packageJob{
+		workflowID: workflowID,
+		runID:      runID,
+		request: capsuleBuildRequest{
+			WorkflowID: workflowID,
+			Language:   req.Language,
+			Framework:  req.Framework,
+			Type:       req.Type,
+		},
+		info: CapsuleInfo{Status: CapsulePending},
+		done: make(chan struct{}),
+	}
+	p.mu.Unlock()
+}
+
+// Info returns the capsule of a watched workflow, or nil if it wasn't
+// started with auto_package
+func (p *CapsulePackager) Info(workflowID string) *CapsuleInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	job, ok := p.jobs[workflowID]
+	if !ok {
+		return nil
+	}
+	info := job.info
+	return &info
+}
+
+// Package builds the capsule of a watched workflow that has completed, if
+// that hasn't started already, and waits for it until ctx is done. It
+// returns nil if the workflow wasn't started with auto_package.
+func (p *CapsulePackager) Package(ctx context.Context, workflowID string) *CapsuleInfo {
+	job := p.start(workflowID)
+	if job == nil {
+		return nil
+	}
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+	}
+	return p.Info(workflowID)
+}
+
+// Trigger is Package without the wait, for callers that mustn't block on
+// the builder
+func (p *CapsulePackager) Trigger(workflowID string) *CapsuleInfo {
+	if p.start(workflowID) == nil {
+		return nil
+	}
+	return p.Info(workflowID)
+}
+
+// start begins building a watched workflow's capsule unless it already has
+func (p *CapsulePackager) start(workflowID string) *packageJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	job, ok := p.jobs[workflowID]
+	if !ok {
+		return nil
+	}
+	if !job.started {
+		job.started = true
+		go p.build(job)
+	}
+	return job
+}
+
+// poll starts packaging the watched workflows that completed and forgets
+// those that closed any other way, as well as capsules past their retention
+func (p *CapsulePackager) poll(ctx context.Context) {
+	p.mu.Lock()
+	var waiting []*packageJob
+	for id, job := range p.jobs {
+		switch {
+		case !job.started:
+			waiting = append(waiting, job)
+		case !job.finishedAt.IsZero() && time.Since(job.finishedAt) > packageRetention:
+			delete(p.jobs, id)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, job := range waiting {
+		describeCtx, cancel := context.WithTimeout(ctx, callbackTimeout)
+		resp, err := temporalClient.DescribeWorkflowExecution(describeCtx, job.workflowID, job.runID)
+		cancel()
+		if err != nil {
+			var notFound *serviceerror.NotFound
+			if errors.As(err, &notFound) {
+				log.Printf("Not packaging workflow %s: workflow not found", job.workflowID)
+				p.forget(job.workflowID)
+			} else {
+				log.Printf("Failed to check workflow %s for packaging: %v", job.workflowID, err)
+			}
+			continue
+		}
+
+		switch resp.GetWorkflowExecutionInfo().GetStatus() {
+		case enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING:
+		case enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED:
+			p.Trigger(job.workflowID)
+		default:
+			// Nothing to package from a workflow that didn't finish
+			p.forget(job.workflowID)
+		}
+	}
+}
+
+func (p *CapsulePackager) forget(workflowID string) {
+	p.mu.Lock()
+	delete(p.jobs, workflowID)
+	p.mu.Unlock()
+}
+
+// build asks the capsule builder for the job's capsule and records the
+// outcome
+func (p *CapsulePackager) build(job *packageJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), packageTimeout)
+	defer cancel()
+
+	info := CapsuleInfo{Status: CapsulePackaged}
+	capsuleID, err := p.requestCapsule(ctx, job.request)
+	if err != nil {
+		log.Printf("Failed to package workflow %s: %v", job.workflowID, err)
+		info = CapsuleInfo{Status: CapsuleFailed, Error: err.Error()}
+	} else {
+		log.Printf("Packaged workflow %s as capsule %s", job.workflowID, capsuleID)
+		info.CapsuleID = capsuleID
+		info.DownloadURL = p.downloadURL + "/api/v1/capsules/" + capsuleID + "/download"
+	}
+
+	p.mu.Lock()
+	job.info = info
+	job.finishedAt = time.Now()
+	p.mu.Unlock()
+	close(job.done)
+}
+
+// requestCapsule calls build-from-workflow and returns the new capsule's
+// ID, or the builder's error message
+func (p *CapsulePackager) requestCapsule(ctx context.Context, build capsuleBuildRequest) (string, error) {
+	body, err := json.Marshal(build)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.builderURL+"/api/v1/build-from-workflow", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create capsule request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	authmiddleware.SetServiceKey(req)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach capsule builder: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read capsule builder response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		var apiErr apierror.Response
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != nil && apiErr.Error.Message != "" {
+			return "", fmt.Errorf("capsule builder returned status %d: %s", resp.StatusCode, apiErr.Error.Message)
+		}
+		return "", fmt.Errorf("capsule builder returned status %d", resp.StatusCode)
+	}
+
+	var capsule struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &capsule); err != nil || capsule.ID == "" {
+		return "", errors.New("capsule builder returned no capsule ID")
+	}
+	return capsule.ID, nil
+}
+
+// withCapsule adds a workflow's capsule to its result under "capsule". A
+// result that isn't a JSON object is returned unchanged.
+func withCapsule(result interface{}, info *CapsuleInfo) interface{} {
+	if info == nil {
+		return result
+	}
+	fields, ok := result.(map[string]interface{})
+	if !ok {
+		return result
+	}
+	enriched := make(map[string]interface{}, len(fields)+1)
+	for key, value := range fields {
+		enriched[key] = value
+	}
+	enriched["capsule"] = info
+	return enriched
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/contracts"
+	"github.com/gin-gonic/gin"
+	"go.temporal.io/sdk/client"
+)
+
+// testPackager packages against a stub capsule builder and replaces the
+// global packager for the test
+func testPackager(t *testing.T, builder http.HandlerFunc) *CapsulePackager {
+	t.Helper()
+	srv := httptest.NewServer(builder)
+	t.Cleanup(srv.Close)
+	t.Setenv("CAPSULE_BUILDER_URL", srv.URL)
+	t.Setenv("CAPSULE_DOWNLOAD_URL", "https://capsules.example.com/")
+
+	p := NewCapsulePackager()
+	previous := packager
+	packager = p
+	t.Cleanup(func() { packager = previous })
+	return p
+}
+
+func builderReturning(status int, body string, requests *[]capsuleBuildRequest) http.HandlerFunc {
+	var mu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req capsuleBuildRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		*requests = append(*requests, req)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+func watchTestWorkflow(p *CapsulePackager, workflowID string) {
+	p.Watch(workflowID, "run-1", CodeGenerationRequest{Language: "python", Framework: "fastapi", Type: "api", AutoPackage: true})
+}
+
+func TestPackageBuildsCapsule(t *testing.T) {
+	var requests []capsuleBuildRequest
+	p := testPackager(t, builderReturning(http.StatusCreated, `{"id": "capsule-1", "name": "project"}`, &requests))
+	watchTestWorkflow(p, "code-gen-1")
+
+	if info := p.Info("code-gen-1"); info == nil || info.Status != CapsulePending {
+		t.Fatalf("info before packaging = %+v, want pending", info)
+	}
+
+	info := p.Package(context.Background(), "code-gen-1")
+	want := CapsuleInfo{
+		Status:      CapsulePackaged,
+		CapsuleID:   "capsule-1",
+		DownloadURL: "https://capsules.example.com/api/v1/capsules/capsule-1/download",
+	}
+	if info == nil || *info != want {
+		t.Fatalf("info = %+v, want %+v", info, want)
+	}
+	wantRequest := capsuleBuildRequest{WorkflowID: "code-gen-1", Language: "python", Framework: "fastapi", Type: "api"}
+	if len(requests) != 1 || requests[0] != wantRequest {
+		t.Errorf("builder requests = %+v, want %+v", requests, wantRequest)
+	}
+}
+
+func TestPackageReportsBuilderError(t *testing.T) {
+	var requests []capsuleBuildRequest
+	p := testPackager(t, builderReturning(http.StatusUnprocessableEntity,
+		`{"error": {"code": "UNPROCESSABLE", "message": "workflow has no code drop to package"}}`, &requests))
+	watchTestWorkflow(p, "code-gen-1")
+
+	info := p.Package(context.Background(), "code-gen-1")
+	if info == nil || info.Status != CapsuleFailed {
+		t.Fatalf("info = %+v, want failed", info)
+	}
+	if want := "capsule builder returned status 422: workflow has no code drop to package"; info.Error != want {
+		t.Errorf("error = %q, want %q", info.Error, want)
+	}
+	if info.CapsuleID != "" || info.DownloadURL != "" {
+		t.Errorf("failed capsule has ID %q and URL %q", info.CapsuleID, info.DownloadURL)
+	}
+}
+
+func TestPackageBuildsOnce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	p := testPackager(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "capsule-1"}`))
+	})
+	watchTestWorkflow(p, "code-gen-1")
+
+	if info := p.Trigger("code-gen-1"); info == nil || info.Status != CapsulePending {
+		t.Fatalf("triggered info = %+v, want pending", info)
+	}
+
+	// A caller that gives up waiting sees the capsule as pending
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if info := p.Package(ctx, "code-gen-1"); info.Status != CapsulePending {
+		t.Errorf("status after timeout = %s, want pending", info.Status)
+	}
+
+	close(release)
+	if info := p.Package(context.Background(), "code-gen-1"); info.Status != CapsulePackaged {
+		t.Errorf("status = %s, want packaged", info.Status)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("builder called %d times, want 1", n)
+	}
+}
+
+func TestPackageUnwatchedWorkflow(t *testing.T) {
+	var requests []capsuleBuildRequest
+	p := testPackager(t, builderReturning(http.StatusCreated, `{"id": "capsule-1"}`, &requests))
+
+	if info := p.Package(context.Background(), "code-gen-1"); info != nil {
+		t.Errorf("info = %+v, want nil", info)
+	}
+	if len(requests) != 0 {
+		t.Errorf("builder called for a workflow without auto_package")
+	}
+}
+
+func TestWithCapsule(t *testing.T) {
+	info := &CapsuleInfo{Status: CapsuleFailed, Error: "capsule builder returned status 500"}
+	result := map[string]interface{}{"code": "print('hi')", "success": true}
+
+	enriched, ok := withCapsule(result, info).(map[string]interface{})
+	if !ok {
+		t.Fatalf("enriched result is %T", enriched)
+	}
+	if enriched["capsule"] != info || enriched["code"] != "print('hi')" || enriched["success"] != true {
+		t.Errorf("enriched = %+v", enriched)
+	}
+	if _, ok := result["capsule"]; ok {
+		t.Error("withCapsule modified the original result")
+	}
+
+	if got := withCapsule(result, nil); got.(map[string]interface{})["capsule"] != nil {
+		t.Error("result without a capsule was enriched")
+	}
+	if got := withCapsule("done", info); got != "done" {
+		t.Errorf("non-object result = %v, want it unchanged", got)
+	}
+}
+
+// completedRun is a workflow run that has already completed with result
+type completedRun struct {
+	client.WorkflowRun
+	id     string
+	result interface{}
+}
+
+func (r completedRun) GetID() string    { return r.id }
+func (r completedRun) GetRunID() string { return "run-1" }
+
+func (r completedRun) Get(_ context.Context, valuePtr interface{}) error {
+	*valuePtr.(*interface{}) = r.result
+	return nil
+}
+
+func TestWaitedResultIncludesCapsule(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var requests []capsuleBuildRequest
+	p := testPackager(t, builderReturning(http.StatusCreated, `{"id": "capsule-1"}`, &requests))
+	watchTestWorkflow(p, "code-gen-1")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/workflows/generate?wait=5s", nil)
+	respondWorkflowStarted(c, completedRun{id: "code-gen-1", result: map[string]interface{}{"success": true}}, 5*time.Second, "started")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var got contracts.WorkflowResult
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Capsule == nil || got.Capsule.CapsuleID != "capsule-1" || got.Capsule.DownloadURL == "" {
+		t.Errorf("capsule = %+v, want capsule-1 with a download URL", got.Capsule)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/authmiddleware"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/contracts"
+	"github.com/gin-gonic/gin"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+)
+
+// workflowStages lists, in order, the stages each workflow type stores a
+// QuantumDrop for. They must match the stage names the workflows use.
+var workflowStages = map[string][]string{
+	"ExtendedCodeGenerationWorkflow": {
+		"prompt_enhancement",
+		"frd_generation",
+		"project_structure",
+		"code_generation",
+		"test_plan_generation",
+		"test_generation",
+		"documentation",
+		"files_compilation",
+		"completion",
+		"enterprise_deployment",
+		"security_compliance",
+		"enterprise_monitoring",
+	},
+	"IntelligentCodeGenerationWorkflow": {
+		"intelligent_code_generation",
+	},
+}
+
+// Stage states reported by the progress endpoint
+const (
+	StageCompleted = "completed"
+	StageActive    = "active"
+	StagePending   = "pending"
+	StageSkipped   = "skipped"
+)
+
+// DropSummary is one entry of the quantum-drops workflow summary
+type DropSummary struct {
+	ID        string    `json:"id"`
+	Stage     string    `json:"stage"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int       `json:"size"`
+}
+
+type (
+	StageProgress    = contracts.StageProgress
+	WorkflowProgress = contracts.WorkflowProgress
+)
+
+type cachedDrops struct {
+	drops   []DropSummary
+	fetched time.Time
+}
+
+// DropsClient reads drop summaries from quantum-drops, caching each
+// workflow's summary briefly so polling clients don't reach the database
+// on every request
+type DropsClient struct {
+	baseURL    string
+	httpClient *http.Client
+	ttl        time.Duration
+
+	cache map[string]cachedDrops
+	mu    sync.Mutex
+}
+
+// NewDropsClient creates a client for QUANTUM_DROPS_URL
+func NewDropsClient() *DropsClient {
+	baseURL := os.Getenv("QUANTUM_DROPS_URL")
+	if baseURL == "" {
+		baseURL = "http://quantum-drops.quantumlayer.svc.cluster.local:8090"
+	}
+	return &DropsClient{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		ttl:        5 * time.Second,
+		cache:      make(map[string]cachedDrops),
+	}
+}
+
+var dropsClient = NewDropsClient()
+
+// Summary returns the drops stored for a workflow, oldest first
+func (d *DropsClient) Summary(ctx context.Context, workflowID string) ([]DropSummary, error) {
+	d.mu.Lock()
+	if entry, ok := d.cache[workflowID]; ok && time.Since(entry.fetched) < d.ttl {
+		d.mu.Unlock()
+		return entry.drops, nil
+	}
+	d.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+"/api/v1/workflows/"+workflowID+"/summary", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create drops request: %w", err)
+	}
+	authmiddleware.SetServiceKey(req)
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch drops: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("quantum-drops returned status %d", resp.StatusCode)
+	}
+
+	var summary struct {
+		Summaries []DropSummary `json:"summaries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		return nil, fmt.Errorf("failed to decode drops summary: %w", err)
+	}
+
+	d.mu.Lock()
+	// Drop expired entries so finished workflows don't accumulate
+	for id, entry := range d.cache {
+		if time.Since(entry.fetched) >= d.ttl {
+			delete(d.cache, id)
+		}
+	}
+	d.cache[workflowID] = cachedDrops{drops: summary.Summaries, fetched: time.Now()}
+	d.mu.Unlock()
+
+	return summary.Summaries, nil
+}
+
+// handleGetWorkflowProgress reports which stages of a workflow have stored
+// their output, which one is running, and the overall percentage
+func handleGetWorkflowProgress(c *gin.Context) {
+	workflowID := c.Param("id")
+	ctx := c.Request.Context()
+
+	resp, err := temporalClient.DescribeWorkflowExecution(ctx, workflowID, "")
+	if err != nil {
+		var notFound *serviceerror.NotFound
+		if errors.As(err, &notFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workflow not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to describe workflow",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	info := resp.WorkflowExecutionInfo
+	progress := WorkflowProgress{
+		WorkflowID:   workflowID,
+		WorkflowType: info.GetType().GetName(),
+		Status:       info.GetStatus().String(),
+	}
+	if info.GetStartTime() != nil {
+		t := info.GetStartTime().AsTime()
+		progress.StartTime = &t
+	}
+	if info.GetCloseTime() != nil {
+		t := info.GetCloseTime().AsTime()
+		progress.CloseTime = &t
+	}
+
+	drops, err := dropsClient.Summary(ctx, workflowID)
+	if err != nil {
+		// Still report the stage list; it will show as pending
+		log.Printf("Failed to load drops for workflow %s: %v", workflowID, err)
+		progress.DropsError = err.Error()
+	}
+
+	progress.Stages = buildStageProgress(progress.WorkflowType, info.GetStatus(), progress.StartTime, drops)
+	progress.Percentage = stagePercentage(progress.Stages, info.GetStatus())
+	if info.GetStatus() == enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED {
+		progress.Capsule = packager.Trigger(workflowID)
+	} else {
+		progress.Capsule = packager.Info(workflowID)
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// buildStageProgress marks each known stage of the workflow type completed
+// once it has a drop. While the workflow runs the first stage after the
+// last completed one is active; stages passed over without a drop, or left
+// when the workflow completed, were skipped. Stages with drops that aren't
+// in the known list are appended in the order their drops were stored.
+func buildStageProgress(workflowType string, status enumspb.WorkflowExecutionStatus, startTime *time.Time, drops []DropSummary) []StageProgress {
+	known := workflowStages[workflowType]
+	stages := make([]StageProgress, 0, len(known))
+	index := make(map[string]int, len(known))
+	for _, name := range known {
+		index[name] = len(stages)
+		stages = append(stages, StageProgress{Name: name, Status: StagePending})
+	}
+
+	for _, drop := range drops {
+		i, ok := index[drop.Stage]
+		if !ok {
+			i = len(stages)
+			index[drop.Stage] = i
+			stages = append(stages, StageProgress{Name: drop.Stage})
+		}
+		stage := &stages[i]
+		stage.Status = StageCompleted
+		stage.Drops++
+		stage.ArtifactSize += drop.Size
+		if stage.CompletedAt == nil || drop.CreatedAt.After(*stage.CompletedAt) {
+			createdAt := drop.CreatedAt
+			stage.CompletedAt = &createdAt
+		}
+	}
+
+	// Stages store their drops in order, so known stages before the last
+	// completed one were passed over
+	lastCompleted := -1
+	for i := range known {
+		if stages[i].Status == StageCompleted {
+			lastCompleted = i
+		}
+	}
+
+	// A stage starts when the one before it finished. Until the first drop
+	// arrives there's no telling how far the workflow got, so nothing is
+	// marked active.
+	last := startTime
+	activeSet := len(drops) == 0
+	for i := range stages {
+		stage := &stages[i]
+		switch {
+		case stage.Status == StageCompleted:
+			stage.StartedAt = last
+			last = stage.CompletedAt
+		case i < lastCompleted || status == enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED:
+			stage.Status = StageSkipped
+		case status == enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING && !activeSet:
+			stage.Status = StageActive
+			stage.StartedAt = last
+			activeSet = true
+		}
+	}
+
+	return stages
+}
+
+// stagePercentage is the share of stages that are done. A completed
+// workflow is always 100%.
+func stagePercentage(stages []StageProgress, status enumspb.WorkflowExecutionStatus) int {
+	if status == enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED {
+		return 100
+	}
+	if len(stages) == 0 {
+		return 0
+	}
+
+	done := 0
+	for _, stage := range stages {
+		if stage.Status == StageCompleted || stage.Status == StageSkipped {
+			done++
+		}
+	}
+	return done * 100 / len(stages)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/contrib/opentelemetry"
+	"go.temporal.io/sdk/interceptor"
+)
+
+const serviceName = "workflow-api"
+
+var tracer = otel.Tracer(serviceName)
+
+// initTracing installs a tracer provider and W3C trace context propagation
+// so spans join the caller's trace. Spans are exported to the Jaeger
+// collector at JAEGER_ENDPOINT when it is set; TRACE_SAMPLING_RATE sets the
+// ratio of new traces that are sampled.
+func initTracing() func() {
+	var exporters []sdktrace.TracerProviderOption
+	if endpoint := os.Getenv("JAEGER_ENDPOINT"); endpoint != "" {
+		if !strings.HasSuffix(endpoint, "/api/traces") {
+			endpoint = strings.TrimSuffix(endpoint, "/") + "/api/traces"
+		}
+		exporter, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(endpoint)))
+		if err != nil {
+			log.Printf("Warning: tracing exporter unavailable: %v", err)
+		} else {
+			exporters = append(exporters, sdktrace.WithBatcher(exporter))
+		}
+	}
+	return installTracing(exporters...)
+}
+
+// installTracing sets up propagation and a tracer provider sampling at
+// TRACE_SAMPLING_RATE that sends spans to exporters
+func installTracing(exporters ...sdktrace.TracerProviderOption) func() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	rate := 0.1
+	if v := os.Getenv("TRACE_SAMPLING_RATE"); v != "" {
+		if r, err := strconv.ParseFloat(v, 64); err == nil {
+			rate = r
+		}
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		// Follow the caller's sampling decision so traces aren't cut short
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(rate))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(serviceName),
+		)),
+	}
+	opts = append(opts, exporters...)
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+
+	return func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down tracer provider: %v", err)
+		}
+	}
+}
+
+// temporalClientOptions configures the Temporal client at hostPort to carry
+// the request's trace context into the workflows it starts
+func temporalClientOptions(hostPort string) (client.Options, error) {
+	tracingInterceptor, err := opentelemetry.NewTracingInterceptor(opentelemetry.TracerOptions{})
+	if err != nil {
+		return client.Options{}, err
+	}
+	return client.Options{
+		HostPort:     hostPort,
+		Namespace:    "quantumlayer",
+		Interceptors: []interceptor.ClientInterceptor{tracingInterceptor},
+	}, nil
+}
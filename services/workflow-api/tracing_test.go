@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"google.golang.org/grpc"
+)
+
+// startRecorder is a Temporal frontend that accepts every workflow start and
+// keeps the trace header the client sent with it
+type startRecorder struct {
+	workflowservice.UnimplementedWorkflowServiceServer
+	mu      sync.Mutex
+	tracing map[string]string
+}
+
+func (s *startRecorder) StartWorkflowExecution(_ context.Context, req *workflowservice.StartWorkflowExecutionRequest) (*workflowservice.StartWorkflowExecutionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if payload := req.GetHeader().GetFields()["_tracer-data"]; payload != nil {
+		converter.GetDefaultDataConverter().FromPayload(payload, &s.tracing)
+	}
+	return &workflowservice.StartWorkflowExecutionResponse{RunId: "run-1", Started: true}, nil
+}
+
+// useTracedTemporal records spans in memory and points the global Temporal
+// client, configured as in main, at a startRecorder
+func useTracedTemporal(t *testing.T) (*tracetest.InMemoryExporter, *startRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	exporter := tracetest.NewInMemoryExporter()
+	t.Cleanup(installTracing(sdktrace.WithSyncer(exporter)))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &startRecorder{}
+	srv := grpc.NewServer()
+	workflowservice.RegisterWorkflowServiceServer(srv, recorder)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	options, err := temporalClientOptions(lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.NewLazyClient(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousClient := temporalClient
+	temporalClient = c
+	t.Cleanup(func() {
+		temporalClient = previousClient
+		c.Close()
+	})
+	return exporter, recorder
+}
+
+func TestTraceContextReachesWorkflow(t *testing.T) {
+	exporter, recorder := useTracedTemporal(t)
+
+	const (
+		callerTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+		callerSpan  = "00f067aa0ba902b7"
+	)
+	r := gin.New()
+	r.Use(otelgin.Middleware(serviceName))
+	r.POST("/api/v1/workflows/generate", handleGenerateCode)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/workflows/generate", strings.NewReader(`{"id": "req-1", "prompt": "Create a REST API", "language": "python", "type": "api"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+callerTrace+"-"+callerSpan+"-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("start = %d %s, want 202", w.Code, w.Body)
+	}
+
+	spans := exporter.GetSpans()
+	var server, start *tracetest.SpanStub
+	for i := range spans {
+		switch {
+		case spans[i].SpanKind == trace.SpanKindServer:
+			server = &spans[i]
+		case spans[i].Name == "StartWorkflow:CodeGenerationWorkflow":
+			start = &spans[i]
+		}
+	}
+	if server == nil || start == nil {
+		t.Fatalf("spans = %v, want a server span and a workflow start span", spanNames(spans))
+	}
+
+	// The request span continues the caller's trace and names the workflow
+	if server.SpanContext.TraceID().String() != callerTrace || server.Parent.SpanID().String() != callerSpan {
+		t.Errorf("server span is in trace %s under %s, want the caller's", server.SpanContext.TraceID(), server.Parent.SpanID())
+	}
+	attrs := map[string]string{}
+	for _, kv := range server.Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["workflow.id"] != "code-gen-req-1" || attrs["workflow.type"] != "CodeGenerationWorkflow" {
+		t.Errorf("server span attributes = %v", attrs)
+	}
+
+	// Starting the workflow is a child span, handed to Temporal in the header
+	if start.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("start span has parent %s, want the request span %s", start.Parent.SpanID(), server.SpanContext.SpanID())
+	}
+	want := "00-" + callerTrace + "-" + start.SpanContext.SpanID().String() + "-01"
+	if got := recorder.tracing["traceparent"]; got != want {
+		t.Errorf("traceparent sent to Temporal = %q, want %q", got, want)
+	}
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+	}
+	return names
+}
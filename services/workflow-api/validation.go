@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/capabilities"
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/contracts"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// DefaultMaxPromptBytes is the largest prompt accepted unless
+// MAX_PROMPT_BYTES says otherwise
+const DefaultMaxPromptBytes = 32 * 1024
+
+// maxBodyOverhead is room for the rest of a request body beside the prompt
+const maxBodyOverhead = 64 * 1024
+
+// FieldError points at the request field a validation failure is about
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var (
+	catalog        = capabilities.Default()
+	maxPromptBytes = DefaultMaxPromptBytes
+)
+
+func init() {
+	// Report JSON field names in binding errors so they match FieldError
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "" || name == "-" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// loadValidationConfig reads the capabilities catalog from CAPABILITIES_FILE
+// and the prompt limit from MAX_PROMPT_BYTES
+func loadValidationConfig() {
+	loaded, err := capabilities.Load(os.Getenv("CAPABILITIES_FILE"))
+	if err != nil {
+		log.Printf("Warning: using built-in capabilities: %v", err)
+	} else {
+		catalog = loaded
+	}
+
+	if v := os.Getenv("MAX_PROMPT_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxPromptBytes = n
+		} else {
+			log.Printf("Warning: invalid MAX_PROMPT_BYTES %q, using %d", v, maxPromptBytes)
+		}
+	}
+}
+
+// bindGenerationRequest decodes and validates a code generation request,
+// normalizing its language, framework and type. It responds and returns
+// false when the request is rejected.
+func bindGenerationRequest(c *gin.Context, req *CodeGenerationRequest) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxPromptBytes+maxBodyOverhead))
+
+	if err := c.ShouldBindJSON(req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.RespondError(c, promptTooLarge())
+			return false
+		}
+
+		var invalid validator.ValidationErrors
+		if errors.As(err, &invalid) {
+			fields := make([]FieldError, 0, len(invalid))
+			for _, fe := range invalid {
+				fields = append(fields, FieldError{Field: fe.Field(), Message: fieldMessage(fe)})
+			}
+			apierror.RespondError(c, apierror.Validation("Invalid request").WithDetails(fields))
+			return false
+		}
+
+		apierror.RespondError(c, apierror.Validation("Request body must be valid JSON").WithDetails(err.Error()))
+		return false
+	}
+
+	if err := validateGenerationRequest(req); err != nil {
+		apierror.RespondError(c, err)
+		return false
+	}
+	return true
+}
+
+// validateGenerationRequest checks a bound request against the prompt limit
+// and the capabilities catalog, normalizing it in place
+func validateGenerationRequest(req *CodeGenerationRequest) *apierror.Error {
+	if len(req.Prompt) > maxPromptBytes {
+		return promptTooLarge()
+	}
+
+	var fields []FieldError
+
+	req.Prompt = strings.TrimSpace(req.Prompt)
+	if req.Prompt == "" {
+		fields = append(fields, FieldError{Field: "prompt", Message: "prompt must not be blank"})
+	}
+
+	req.Framework = capabilities.Normalize(req.Framework)
+	lang, ok := catalog.Language(req.Language)
+	if !ok {
+		fields = append(fields, FieldError{
+			Field:   "language",
+			Message: fmt.Sprintf("unsupported language %q, expected one of: %s", req.Language, strings.Join(catalog.LanguageNames(), ", ")),
+		})
+	} else {
+		req.Language = lang.Name
+		if req.Framework != "" && !lang.SupportsFramework(req.Framework) {
+			fields = append(fields, FieldError{Field: "framework", Message: frameworkMessage(req.Framework, lang)})
+		}
+	}
+
+	req.Type = capabilities.Normalize(req.Type)
+	if !catalog.HasProjectType(req.Type) {
+		fields = append(fields, FieldError{
+			Field:   "type",
+			Message: fmt.Sprintf("unsupported type %q, expected one of: %s", req.Type, strings.Join(catalog.ProjectTypes, ", ")),
+		})
+	}
+
+	fields = append(fields, validateCallback(req)...)
+
+	if len(fields) > 0 {
+		return apierror.Validation("Invalid request").WithDetails(fields)
+	}
+	return nil
+}
+
+// validateCallback checks the callback URL is an absolute http(s) URL and
+// that callbacks are enabled
+func validateCallback(req *CodeGenerationRequest) []FieldError {
+	if req.CallbackURL == "" {
+		if req.CallbackSecret != "" {
+			return []FieldError{{Field: "callback_secret", Message: "callback_secret requires callback_url"}}
+		}
+		return nil
+	}
+	if !callbacks.enabled {
+		return []FieldError{{Field: "callback_url", Message: "callbacks are disabled on this server"}}
+	}
+	u, err := url.Parse(req.CallbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return []FieldError{{Field: "callback_url", Message: "callback_url must be an absolute http or https URL"}}
+	}
+	return nil
+}
+
+func promptTooLarge() *apierror.Error {
+	return apierror.New(apierror.CodePayloadTooLarge, "Prompt is too large").WithDetails([]FieldError{{
+		Field:   "prompt",
+		Message: fmt.Sprintf("prompt must be at most %d bytes", maxPromptBytes),
+	}})
+}
+
+func frameworkMessage(framework string, lang *capabilities.Language) string {
+	languages := catalog.FrameworkLanguages(framework)
+	if len(languages) == 0 {
+		return fmt.Sprintf("unsupported framework %q for %s, expected one of: %s", framework, lang.Name, strings.Join(lang.Frameworks, ", "))
+	}
+	return fmt.Sprintf("framework %q requires %s, not %s", framework, strings.Join(languages, " or "), lang.Name)
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	if fe.Tag() == "required" {
+		return fe.Field() + " is required"
+	}
+	return fmt.Sprintf("%s failed the %s check", fe.Field(), fe.Tag())
+}
+
+// handleGetCapabilities lists the languages, frameworks and project types
+// generation requests may use, and the prompt size limit
+func handleGetCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, contracts.Capabilities{
+		Languages:      catalog.Languages,
+		ProjectTypes:   catalog.ProjectTypes,
+		MaxPromptBytes: maxPromptBytes,
+	})
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// withMaxPromptBytes lowers the prompt limit for one test
+func withMaxPromptBytes(t *testing.T, n int) {
+	t.Helper()
+	previous := maxPromptBytes
+	maxPromptBytes = n
+	t.Cleanup(func() { maxPromptBytes = previous })
+}
+
+// fieldErrors returns the field errors an API error carries, by field
+func fieldErrors(t *testing.T, err *apierror.Error) map[string]string {
+	t.Helper()
+	fields, ok := err.Details.([]FieldError)
+	if !ok {
+		t.Fatalf("details = %#v, want field errors", err.Details)
+	}
+	byField := make(map[string]string, len(fields))
+	for _, f := range fields {
+		byField[f.Field] = f.Message
+	}
+	return byField
+}
+
+func TestValidateGenerationRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  CodeGenerationRequest
+		want map[string]string // field to message; nil when the request is valid
+	}{
+		{
+			name: "valid",
+			req:  CodeGenerationRequest{Prompt: "Create a REST API", Language: "python", Framework: "fastapi", Type: "api"},
+		},
+		{
+			name: "without framework",
+			req:  CodeGenerationRequest{Prompt: "Create a CLI", Language: "go", Type: "cli"},
+		},
+		{
+			name: "blank prompt",
+			req:  CodeGenerationRequest{Prompt: " \n\t ", Language: "python", Type: "api"},
+			want: map[string]string{"prompt": "prompt must not be blank"},
+		},
+		{
+			name: "unsupported language",
+			req:  CodeGenerationRequest{Prompt: "Create a REST API", Language: "cobol", Type: "api"},
+			want: map[string]string{"language": `unsupported language "cobol", expected one of: python, javascript, typescript, go, java, rust`},
+		},
+		{
+			name: "framework for another language",
+			req:  CodeGenerationRequest{Prompt: "Create a REST API", Language: "python", Framework: "express", Type: "api"},
+			want: map[string]string{"framework": `framework "express" requires javascript or typescript, not python`},
+		},
+		{
+			name: "unknown framework",
+			req:  CodeGenerationRequest{Prompt: "Create a REST API", Language: "go", Framework: "beego", Type: "api"},
+			want: map[string]string{"framework": `unsupported framework "beego" for go, expected one of: gin, echo, fiber`},
+		},
+		{
+			name: "unsupported type",
+			req:  CodeGenerationRequest{Prompt: "Create a game", Language: "rust", Type: "game"},
+			want: map[string]string{"type": `unsupported type "game", expected one of: api, web, webapp, cli, library, function, microservice, microservices, code`},
+		},
+		{
+			name: "every problem at once",
+			req:  CodeGenerationRequest{Prompt: " ", Language: "cobol", Framework: "spring", Type: "game"},
+			want: map[string]string{
+				"prompt":   "prompt must not be blank",
+				"language": `unsupported language "cobol", expected one of: python, javascript, typescript, go, java, rust`,
+				"type":     `unsupported type "game", expected one of: api, web, webapp, cli, library, function, microservice, microservices, code`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGenerationRequest(&tt.req)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("err = %v %v, want none", err, err.Details)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("request accepted, want a validation error")
+			}
+			if err.Code != apierror.CodeValidation || err.Status() != http.StatusBadRequest {
+				t.Errorf("code %s status %d, want validation_error 400", err.Code, err.Status())
+			}
+			got := fieldErrors(t, err)
+			if len(got) != len(tt.want) {
+				t.Errorf("field errors = %v, want %v", got, tt.want)
+			}
+			for field, message := range tt.want {
+				if got[field] != message {
+					t.Errorf("%s: %q, want %q", field, got[field], message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateGenerationRequestNormalizes(t *testing.T) {
+	req := CodeGenerationRequest{Prompt: "  Create a web app \n", Language: " Node ", Framework: "Next", Type: " WebApp"}
+	if err := validateGenerationRequest(&req); err != nil {
+		t.Fatalf("err = %v %v", err, err.Details)
+	}
+	if req.Prompt != "Create a web app" || req.Language != "javascript" || req.Framework != "next" || req.Type != "webapp" {
+		t.Errorf("normalized to %+v", req)
+	}
+}
+
+func TestValidateGenerationRequestPromptLimit(t *testing.T) {
+	withMaxPromptBytes(t, 16)
+	tests := []struct {
+		prompt string
+		ok     bool
+	}{
+		{strings.Repeat("a", 16), true},
+		{strings.Repeat("a", 17), false},
+		// The limit is in bytes, not characters
+		{strings.Repeat("é", 9), false},
+	}
+	for _, tt := range tests {
+		req := CodeGenerationRequest{Prompt: tt.prompt, Language: "python", Type: "api"}
+		err := validateGenerationRequest(&req)
+		if (err == nil) != tt.ok {
+			t.Errorf("%d byte prompt: err = %v, want ok %v", len(tt.prompt), err, tt.ok)
+			continue
+		}
+		if err != nil {
+			if err.Code != apierror.CodePayloadTooLarge || err.Status() != http.StatusRequestEntityTooLarge {
+				t.Errorf("code %s status %d, want payload_too_large 413", err.Code, err.Status())
+			}
+			if msg := fieldErrors(t, err)["prompt"]; msg != "prompt must be at most 16 bytes" {
+				t.Errorf("prompt error = %q", msg)
+			}
+		}
+	}
+}
+
+func TestBindGenerationRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withMaxPromptBytes(t, 1024)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   apierror.Code
+		wantFields []string
+	}{
+		{
+			name:       "valid",
+			body:       `{"prompt": "Create a REST API", "language": "Python", "type": "api"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing required fields",
+			body:       `{"framework": "flask"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   apierror.CodeValidation,
+			wantFields: []string{"prompt", "language", "type"},
+		},
+		{
+			name:       "unsupported language",
+			body:       `{"prompt": "Create a REST API", "language": "cobol", "type": "api"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   apierror.CodeValidation,
+			wantFields: []string{"language"},
+		},
+		{
+			name:       "malformed JSON",
+			body:       `{"prompt": "Create a REST API",`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   apierror.CodeValidation,
+		},
+		{
+			name:       "body over the limit",
+			body:       `{"prompt": "` + strings.Repeat("a", 1024+maxBodyOverhead) + `", "language": "python", "type": "api"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   apierror.CodePayloadTooLarge,
+			wantFields: []string{"prompt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bound CodeGenerationRequest
+			r := gin.New()
+			r.POST("/generate", func(c *gin.Context) {
+				if bindGenerationRequest(c, &bound) {
+					c.Status(http.StatusOK)
+				}
+			})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d %s, want %d", w.Code, w.Body, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK {
+				if bound.Language != "python" {
+					t.Errorf("bound %+v, want the language normalized", bound)
+				}
+				return
+			}
+
+			var resp struct {
+				Error struct {
+					Code    apierror.Code `json:"code"`
+					Details []FieldError  `json:"details"`
+				} `json:"error"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Error.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Error.Code, tt.wantCode)
+			}
+			var fields []string
+			for _, f := range resp.Error.Details {
+				fields = append(fields, f.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumLayer-dev/quantumlayer-platform/packages/shared/contracts"
+	"github.com/gin-gonic/gin"
+	"go.temporal.io/sdk/client"
+)
+
+// MaxWait bounds how long a generate request may block on ?wait=
+const MaxWait = 120 * time.Second
+
+// waitRetryAfter is the Retry-After sent when a workflow outlives the wait
+const waitRetryAfter = 5 * time.Second
+
+// parseWait reads the optional ?wait= duration, either a Go duration such as
+// "60s" or a number of seconds, capped at MaxWait. It responds and returns
+// false when the value is invalid.
+func parseWait(c *gin.Context) (time.Duration, bool) {
+	raw := c.Query("wait")
+	if raw == "" {
+		return 0, true
+	}
+
+	wait, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(raw)
+		if convErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid wait duration",
+				"details": fmt.Sprintf("wait must be a duration such as 60s, got %q", raw),
+			})
+			return 0, false
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid wait duration",
+			"details": "wait must not be negative",
+		})
+		return 0, false
+	}
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+	return wait, true
+}
+
+// respondWorkflowStarted answers a generate request. Without a wait it
+// returns 202 straight away; with one it blocks on the workflow result until
+// the wait runs out, returning 200 with the result or 202 with Retry-After
+// if the workflow is still running. The result is read on the request's
+// goroutine under its context, so a client hanging up ends the poll.
+func respondWorkflowStarted(c *gin.Context, we client.WorkflowRun, wait time.Duration, message string) {
+	started := WorkflowResponse{
+		WorkflowID: we.GetID(),
+		RunID:      we.GetRunID(),
+		Status:     "started",
+		Message:    message,
+	}
+	if wait == 0 {
+		c.JSON(http.StatusAccepted, started)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+	defer cancel()
+
+	var result interface{}
+	err := we.Get(ctx, &result)
+	if err == nil {
+		packageCtx, cancelPackage := context.WithTimeout(c.Request.Context(), packageWait)
+		defer cancelPackage()
+		c.JSON(http.StatusOK, contracts.WorkflowResult{
+			WorkflowID: we.GetID(),
+			RunID:      we.GetRunID(),
+			Status:     "completed",
+			Result:     result,
+			Capsule:    packager.Package(packageCtx, we.GetID()),
+		})
+		return
+	}
+
+	if c.Request.Context().Err() != nil {
+		// The client went away; there's no one to answer
+		log.Printf("Client disconnected while waiting for workflow %s", we.GetID())
+		return
+	}
+	if ctx.Err() != nil {
+		started.Status = "running"
+		started.Message = fmt.Sprintf("Workflow still running after %s; poll /api/v1/workflows/%s/result", wait, we.GetID())
+		c.Header("Retry-After", strconv.Itoa(int(waitRetryAfter.Seconds())))
+		c.JSON(http.StatusAccepted, started)
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":       "Workflow failed",
+		"workflow_id": we.GetID(),
+		"details":     err.Error(),
+	})
+}